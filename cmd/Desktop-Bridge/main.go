@@ -35,28 +35,43 @@ package main
 */
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"runtime/pprof"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/api"
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/caldav"
 	"github.com/ProtonMail/proton-bridge/internal/cmd"
 	"github.com/ProtonMail/proton-bridge/internal/cookies"
+	"github.com/ProtonMail/proton-bridge/internal/diagnostics"
 	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/internal/frontend"
 	"github.com/ProtonMail/proton-bridge/internal/imap"
+	"github.com/ProtonMail/proton-bridge/internal/imap/fetch"
+	"github.com/ProtonMail/proton-bridge/internal/ldap"
+	"github.com/ProtonMail/proton-bridge/internal/notifications"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
 	"github.com/ProtonMail/proton-bridge/internal/smtp"
+	"github.com/ProtonMail/proton-bridge/internal/stats"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/internal/store/rules"
+	"github.com/ProtonMail/proton-bridge/internal/transfer"
 	"github.com/ProtonMail/proton-bridge/internal/updates"
+	"github.com/ProtonMail/proton-bridge/internal/users"
 	"github.com/ProtonMail/proton-bridge/internal/users/credentials"
 	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/ProtonMail/proton-bridge/pkg/constants"
+	"github.com/ProtonMail/proton-bridge/pkg/keychain"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
-	"github.com/allan-simon/go-singleinstance"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 const (
@@ -65,6 +80,9 @@ const (
 	cacheVersion = "c11"
 
 	appName = "bridge"
+
+	// instanceTakeoverTimeout is how long the running instance has to stop.
+	instanceTakeoverTimeout = 30 * time.Second
 )
 
 var (
@@ -82,6 +100,18 @@ func main() {
 			cli.BoolFlag{
 				Name:  "noninteractive",
 				Usage: "Start Bridge entirely noninteractively"},
+			cli.BoolFlag{
+				Name:  "tray",
+				Usage: "Show only tray icon with status of accounts instead of window"},
+			cli.BoolFlag{
+				Name:  "safe-mode",
+				Usage: "Start Bridge without window, with read-only cache and verbose log"},
+			cli.BoolFlag{
+				Name:  "takeover",
+				Usage: "Stop already running Bridge and start instead of it"},
+			cli.StringFlag{
+				Name:  "recover",
+				Usage: "Run recovery and exit (one of repair-cache, reset-settings, export-diagnostics, rollback-update)"},
 		},
 		run,
 	)
@@ -94,16 +124,18 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 	// We need to have config instance to setup a logs, panic handler, etc ...
 	cfg := config.New(appName, constants.Version, constants.Revision, cacheVersion)
 
-	// We want to know about any problem. Our PanicHandler calls sentry which is
-	// not dependent on anything else. If that fails, it tries to create crash
-	// report which will not be possible if no folder can be created. That's the
-	// only problem we will not be notified about in any way.
+	// We want to know about any problem. Our PanicHandler saves crash report
+	// which is sent only when the user agrees. It will not be possible if no
+	// folder can be created. That's the only problem we will not be notified
+	// about in any way.
+	bridge.SetCrashReportDir(cfg.GetCrashReportDir())
 	panicHandler := &cmd.PanicHandler{
 		AppName: "ProtonMail Bridge",
 		Config:  cfg,
 		Err:     &contextError,
 	}
 	defer panicHandler.HandlePanic()
+	transfer.SetCrashReportSaver(bridge.NewCrashReportSaver(panicHandler.AppName, cfg.GetVersion()))
 
 	// First we need config and create necessary folder; it's dependency for everything.
 	if err := cfg.CreateDirs(); err != nil {
@@ -113,10 +145,13 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 	// Setup of logs should be as soon as possible to ensure we record every wanted report in the log.
 	logLevel := context.GlobalString("log-level")
 	debugClient, debugServer := config.SetupLog(cfg, logLevel)
+	logrus.AddHook(bridge.CrashLogHook())
 
 	// Doesn't make sense to continue when Bridge was invoked with wrong arguments.
 	// We should tell that to the user before we do anything else.
-	if context.Args().First() != "" {
+	// Only CLI accepts arguments which are account commands run without the shell.
+	scriptArgs := []string(context.Args())
+	if len(scriptArgs) != 0 && !context.GlobalBool("cli") {
 		_ = cli.ShowAppHelp(context)
 		return cli.NewExitError("Unknown argument", 4)
 	}
@@ -142,29 +177,94 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 		log.Error("Cannot clear old data: ", err)
 	}
 
-	// GetTLSConfig is needed for IMAP, SMTL and local bridge API (to check second instance).
+	// TLS config is needed for IMAP, SMTL and local bridge API (to check second instance).
 	//
 	// This should be called after ClearOldData, in order to re-create the
 	// certificates if clean data will remove them (accidentally or on purpose).
-	tls, err := config.GetTLSConfig(cfg)
+	certManager, err := config.NewCertManager(cfg)
 	if err != nil {
 		log.WithError(err).Fatal("Cannot get TLS certificate")
 	}
+	tls := certManager.TLSConfig()
 
 	pref := preferences.New(cfg)
 
+	if levels, err := config.ParseLogLevels(pref.Get(preferences.LogLevelsKey)); err != nil {
+		log.WithError(err).Error("Invalid log levels of subsystems, using log level for all")
+	} else {
+		config.SetLogLevels(levels)
+	}
+
+	if pref.GetBool(preferences.LogAnonymizeKey) {
+		if key, err := config.LoadLogAnonymizationKey(cfg.GetLogAnonymizationKeyPath()); err != nil {
+			log.WithError(err).Error("Cannot load key of log pseudonyms, log is not anonymized")
+		} else {
+			config.SetLogAnonymization(key)
+		}
+	}
+
 	// Now we can try to proceed with starting the bridge. First we need to ensure
-	// this is the only instance. If not, we will end and focus the existing one.
-	lock, err := singleinstance.CreateLockFile(cfg.GetLockPath())
+	// this is the only instance. If not, the existing one runs the account
+	// command, stops to let this one take over or gets the focus.
+	instance, err := bridge.AcquireInstance(cfg.GetLockPath(), cfg.GetInstanceSocketPath())
 	if err != nil {
 		log.Warn("Bridge is already running")
-		if err := api.CheckOtherInstanceAndFocus(pref.GetInt(preferences.APIPortKey), tls); err != nil {
-			cmd.DisableRestart()
-			log.Error("Second instance: ", err)
+		instanceClient := bridge.NewInstanceClient(cfg.GetLockPath(), cfg.GetInstanceSocketPath())
+
+		switch {
+		case len(scriptArgs) != 0:
+			err := instanceClient.RunCommand(scriptArgs, frontend.ScriptEnv(), readScriptInput(), os.Stdout)
+			if errors.Cause(err) == bridge.ErrInstanceUnreachable {
+				log.WithError(err).Error("Cannot forward command")
+				return cli.NewExitError("Bridge is already running and does not accept commands.", 3)
+			}
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			return nil
+		case context.GlobalBool("takeover"):
+			if instance, err = instanceClient.Takeover(instanceTakeoverTimeout); err != nil {
+				cmd.DisableRestart()
+				log.WithError(err).Error("Cannot take over running instance")
+				return cli.NewExitError("Bridge is already running.", 3)
+			}
+			log.Info("Took over running instance")
+		default:
+			if err := instanceClient.Focus(); err != nil {
+				log.WithError(err).Warn("Cannot focus running instance, trying local API")
+				if err := api.CheckOtherInstanceAndFocus(pref.GetInt(preferences.APIPortKey), tls); err != nil {
+					cmd.DisableRestart()
+					log.Error("Second instance: ", err)
+				}
+			}
+			return cli.NewExitError("Bridge is already running.", 3)
 		}
-		return cli.NewExitError("Bridge is already running.", 3)
 	}
-	defer lock.Close() //nolint[errcheck]
+	defer instance.Close() //nolint[errcheck]
+
+	// Starts which crash before the grace period are counted so that users
+	// are not stuck in a crash loop. Safe mode skips the most likely causes
+	// and tells users how to recover.
+	startupGuard := cmd.NewStartupGuard(cfg.GetStartupAttemptsPath())
+
+	if option := context.GlobalString("recover"); option != "" {
+		cmd.DisableRestart()
+		if err := cmd.Recover(cfg, pref, option); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		startupGuard.Finish()
+		return nil
+	}
+
+	crashLoop := startupGuard.IsCrashLoop()
+	safeMode := crashLoop || context.GlobalBool("safe-mode")
+	if safeMode {
+		cmd.PrintSafeModeInfo(cfg, crashLoop)
+		config.RaiseLogLevel(logrus.DebugLevel)
+		store.SetSafeMode(true)
+	}
+
+	time.AfterFunc(cmd.StartupGracePeriod, startupGuard.Finish)
 
 	// In case user wants to do CPU or memory profiles...
 	if doCPUProfile := context.GlobalBool("cpu-prof"); doCPUProfile {
@@ -181,13 +281,26 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 	eventListener := listener.New()
 	events.SetupEvents(eventListener)
 
+	keychain.SetFileOptions(keychain.FileOptions{
+		Path:       cfg.GetKeychainPath(),
+		Passphrase: getKeychainPassphrase(context, cfg, pref, safeMode),
+		Force:      pref.GetBool(preferences.KeychainFileKey),
+	})
+
 	credentialsStore, credentialsError := credentials.NewStore(appName)
 	if credentialsError != nil {
 		log.Error("Could not get credentials store: ", credentialsError)
+		if credentialsError == keychain.ErrNoPassphrase {
+			log.Error("Encrypted file keychain is used, set its passphrase in ", keychain.FilePassphraseEnv, " or start with --cli in a terminal to enter it")
+		}
 	}
 
 	cm := pmapi.NewClientManager(cfg.GetAPIConfig())
 
+	if err := pmapi.SetUpstreamProxy(pref.Get(preferences.UpstreamProxyKey)); err != nil {
+		log.WithError(err).Error("Invalid upstream proxy, using proxy from environment")
+	}
+
 	// Different build types have different roundtrippers (e.g. we want to enable
 	// TLS fingerprint checks in production builds). GetRoundTripper has a different
 	// implementation depending on whether build flag pmapi_prod is used or not.
@@ -201,30 +314,235 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 		cm.SetCookieJar(jar)
 	}
 
+	message.SetHeaderLimits(message.HeaderLimits{
+		MaxFields:    pref.GetInt(preferences.HeaderMaxFieldsKey),
+		MaxFieldSize: pref.GetInt(preferences.HeaderMaxFieldSizeKey),
+		MaxTotalSize: pref.GetInt(preferences.HeaderMaxTotalSizeKey),
+	})
+
+	message.SetTemplateOptions(message.TemplateOptions{
+		Locale: pref.Get(preferences.MessageLocaleKey),
+		Dir:    cfg.GetTemplatesDir(),
+	})
+
+	fetch.SetOptions(fetch.Options{
+		DownloadWorkers: pref.GetInt(preferences.FetchDownloadWorkersKey),
+		BuildWorkers:    pref.GetInt(preferences.FetchBuildWorkersKey),
+		Window:          pref.GetInt(preferences.FetchWindowKey),
+	})
+
+	imap.SetAttachmentPlaceholderSize(int64(pref.GetInt(preferences.AttPlaceholderSizeKey)))
+	imap.SetMessageSizeLimit(int64(pref.GetInt(preferences.MessageSizeLimitKey)))
+	imap.SetDeferredExpunge(pref.GetBool(preferences.DeferredExpungeKey))
+	imap.SetCommandTracing(pref.GetBool(preferences.IMAPTraceKey))
+	imap.SetBodyEncoding(message.ParseBodyEncoding(pref.Get(preferences.BodyEncodingKey)))
+	imap.SetDecryptionPlaceholder(message.ParsePlaceholderMode(pref.Get(preferences.DecryptionPlaceholderKey)))
+	imap.SetAppleMailCompatibility(pref.Get(preferences.AppleMailCompatKey))
+	imap.SetSessionQuota(imap.SessionQuota{
+		FetchBytesPerHour: int64(pref.GetInt(preferences.FetchQuotaKey)) << 20,
+		AppendsPerDay:     int64(pref.GetInt(preferences.AppendQuotaKey)),
+	})
+	imap.SetConnectionLimits(preferences.GetConnectionLimits(pref))
+	smtp.SetConnectionLimits(preferences.GetConnectionLimits(pref))
+
+	store.SetHideSelfSentDuplicates(pref.GetBool(preferences.HideSelfSentKey))
+
+	store.SetAutocryptImport(pref.GetBool(preferences.AutocryptImportKey))
+
+	store.SetSyncThrottleOptions(preferences.GetSyncThrottleOptions(pref))
+
+	store.SetDeletedRetention(preferences.GetDeletedRetention(pref))
+
+	store.SetLocalArchiveOptions(store.LocalArchiveOptions{
+		Dir:       pref.Get(preferences.LocalArchiveDirKey),
+		Format:    pref.Get(preferences.LocalArchiveFormatKey),
+		Mailboxes: preferences.SplitList(pref.Get(preferences.LocalArchiveMailboxesKey)),
+	})
+
+	store.SetRetentionOptions(preferences.GetRetentionOptions(pref))
+
+	store.SetScanOptions(preferences.GetScanOptions(pref))
+
+	store.SetPhishingOptions(preferences.GetPhishingOptions(pref))
+
+	store.SetPollOptions(preferences.GetPollOptions(pref))
+
+	store.SetStorageBackend(pref.Get(preferences.StorageBackendKey))
+
+	store.SetCompactionOptions(preferences.GetCompactionOptions(pref))
+
+	diagnostics.SetReproDir(cfg.GetReproDir())
+
+	updates.SetChannel(pref.Get(preferences.UpdateChannelKey))
+	updates.SetRollbackDir(cfg.GetRollbackDir())
+
+	if localRules, err := rules.Load(cfg.GetLocalRulesPath()); err != nil {
+		logrus.WithError(err).Error("Local rules are not applied")
+	} else {
+		store.SetLocalRules(localRules)
+	}
+
+	users.SetStartupConcurrency(pref.GetInt(preferences.StartupConcurrencyKey))
+
+	if err := stats.Load(cfg.GetStatsPath()); err != nil {
+		log.WithError(err).Error("Cannot load history of metrics, it is kept only in memory")
+	}
+
 	bridgeInstance := bridge.New(cfg, pref, panicHandler, eventListener, cm, credentialsStore)
+
+	// Scripted commands manage accounts and exit without starting servers.
+	if len(scriptArgs) != 0 {
+		if err := frontend.RunScript(scriptArgs, pref, bridgeInstance); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		startupGuard.Finish()
+		return nil
+	}
+
+	go func() {
+		defer panicHandler.HandlePanic()
+		certManager.Watch()
+	}()
+
 	imapBackend := imap.NewIMAPBackend(panicHandler, eventListener, cfg, bridgeInstance)
 	smtpBackend := smtp.NewSMTPBackend(panicHandler, eventListener, pref, bridgeInstance)
 
+	apiServer := api.NewAPIServer(pref, tls, cfg.GetTLSCertPath(), cfg.GetTLSKeyPath(), eventListener, bridgeInstance, bridgeInstance, bridgeInstance, bridgeInstance, bridgeInstance, frontend.NewWizard(pref, bridgeInstance), bridgeInstance)
 	go func() {
 		defer panicHandler.HandlePanic()
-		apiServer := api.NewAPIServer(pref, tls, cfg.GetTLSCertPath(), cfg.GetTLSKeyPath(), eventListener)
 		apiServer.ListenAndServe()
 	}()
 
+	remoteAccess := bridge.LoadRemoteAccess(pref)
+	bridge.SetRemoteAccess(remoteAccess)
+	authPolicy := remoteAccess.HardenAuthPolicy(preferences.GetAuthPolicy(pref))
+
+	imapPort := pref.GetInt(preferences.IMAPPortKey)
+	imapServer := imap.NewIMAPServer(debugClient, debugServer, imapPort, tls, authPolicy, imapBackend, eventListener)
 	go func() {
 		defer panicHandler.HandlePanic()
-		imapPort := pref.GetInt(preferences.IMAPPortKey)
-		imapServer := imap.NewIMAPServer(debugClient, debugServer, imapPort, tls, imapBackend, eventListener)
 		imapServer.ListenAndServe()
 	}()
 
+	smtpPort := pref.GetInt(preferences.SMTPPortKey)
+	useSSL := pref.GetBool(preferences.SMTPSSLKey)
+	smtpServer := smtp.NewSMTPServer(debugClient || debugServer, smtpPort, useSSL, tls, authPolicy, smtpBackend, eventListener)
 	go func() {
 		defer panicHandler.HandlePanic()
-		smtpPort := pref.GetInt(preferences.SMTPPortKey)
-		useSSL := pref.GetBool(preferences.SMTPSSLKey)
-		smtpServer := smtp.NewSMTPServer(debugClient || debugServer, smtpPort, useSSL, tls, smtpBackend, eventListener)
 		smtpServer.ListenAndServe()
 	}()
+	smtpServer.SetImplicitTLSPort(pref.GetInt(preferences.SMTPImplicitTLSPortKey))
+
+	// Ports, SMTP security and bind address changed by frontend are applied
+	// without restart; open connections are served until clients close them.
+	go func() {
+		defer panicHandler.HandlePanic()
+
+		listenerSettingsCh := make(chan string)
+		eventListener.Add(events.ListenerSettingsChangedEvent, listenerSettingsCh)
+
+		for range listenerSettingsCh {
+			bridge.SetRemoteAccess(bridge.LoadRemoteAccess(pref))
+			imapServer.Reload(pref.GetInt(preferences.IMAPPortKey))
+			smtpServer.Reload(pref.GetInt(preferences.SMTPPortKey), pref.GetBool(preferences.SMTPSSLKey))
+			smtpServer.SetImplicitTLSPort(pref.GetInt(preferences.SMTPImplicitTLSPortKey))
+		}
+	}()
+
+	// Ports dedicated to accounts are updated whenever an account is added or removed.
+	if bridgeInstance.IsAccountPortsEnabled() {
+		go func() {
+			defer panicHandler.HandlePanic()
+
+			userRefreshCh := make(chan string)
+			eventListener.Add(events.UserRefreshEvent, userRefreshCh)
+
+			for {
+				imapPorts, smtpPorts := map[int]string{}, map[int]string{}
+				for userID, accountPorts := range bridgeInstance.AssignAccountPorts() {
+					imapPorts[accountPorts.IMAP] = userID
+					smtpPorts[accountPorts.SMTP] = userID
+				}
+				imapServer.SetAccountPorts(imapPorts)
+				smtpServer.SetAccountPorts(smtpPorts)
+
+				<-userRefreshCh
+			}
+		}()
+	}
+
+	// Optional servers are closed on takeover as well.
+	var closers []func()
+
+	if pref.GetBool(preferences.CalDAVEnabledKey) {
+		caldavPort := pref.GetInt(preferences.CalDAVPortKey)
+		caldavServer := caldav.NewCalDAVServer(caldavPort, tls, bridgeInstance, eventListener)
+		closers = append(closers, caldavServer.Close)
+		go func() {
+			defer panicHandler.HandlePanic()
+			caldavServer.ListenAndServe()
+		}()
+	}
+
+	if pref.GetBool(preferences.EventSocketEnabledKey) {
+		publisher := events.NewPublisher(eventListener, cfg.GetEventSocketPath())
+		closers = append(closers, func() { _ = publisher.Close() })
+		go func() {
+			defer panicHandler.HandlePanic()
+			if err := publisher.ListenAndServe(); err != nil {
+				log.WithError(err).Error("Cannot publish events")
+			}
+		}()
+	}
+
+	if pref.GetBool(preferences.GRPCEnabledKey) {
+		grpcService := frontend.NewGRPCService(pref, eventListener, bridgeInstance, cfg.GetGRPCSocketPath())
+		closers = append(closers, grpcService.Close)
+		go func() {
+			defer panicHandler.HandlePanic()
+			if err := grpcService.ListenAndServe(); err != nil {
+				log.WithError(err).Error("Cannot serve gRPC API")
+			}
+		}()
+	}
+
+	if pref.GetBool(preferences.LDAPEnabledKey) {
+		ldapPort := pref.GetInt(preferences.LDAPPortKey)
+		ldapServer := ldap.NewLDAPServer(ldapPort, tls, bridgeInstance, eventListener)
+		closers = append(closers, ldapServer.Close)
+		go func() {
+			defer panicHandler.HandlePanic()
+			ldapServer.ListenAndServe()
+		}()
+	}
+
+	// Instances started later forward account commands to this one or take
+	// over. On takeover all servers and stores are closed before the lock is
+	// released, so the new instance can listen and open databases right away.
+	go func() {
+		defer panicHandler.HandlePanic()
+		tookOver := false
+		handler := frontend.NewInstanceHandler(pref, eventListener, bridgeInstance, func() {
+			imapServer.Close()
+			smtpServer.Close()
+			apiServer.Close()
+			for _, closeServer := range closers {
+				closeServer()
+			}
+			if err := bridgeInstance.Close(); err != nil {
+				log.WithError(err).Error("Cannot close stores")
+			}
+			startupGuard.Finish()
+			cmd.DisableRestart()
+			tookOver = true
+		})
+		if err := instance.ListenAndServe(handler); err != nil {
+			log.WithError(err).Error("Cannot accept requests of other instances")
+		}
+		if tookOver {
+			os.Exit(0)
+		}
+	}()
 
 	// Decide about frontend mode before initializing rest of bridge.
 	var frontendMode string
@@ -234,10 +552,21 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 		frontendMode = "cli"
 	case context.GlobalBool("noninteractive"):
 		frontendMode = "noninteractive"
+	case context.GlobalBool("tray"):
+		frontendMode = "tray"
 	default:
 		frontendMode = "qt"
 	}
 
+	// Safe mode avoids the GUI; the shell is usable only from a terminal.
+	if safeMode && (frontendMode == "qt" || frontendMode == "tray") {
+		if terminal.IsTerminal(int(os.Stdin.Fd())) {
+			frontendMode = "cli"
+		} else {
+			frontendMode = "noninteractive"
+		}
+	}
+
 	log.WithField("mode", frontendMode).Debug("Determined frontend mode to use")
 
 	// If we are starting bridge in noninteractive mode, simply block instead of starting a frontend.
@@ -246,6 +575,14 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 		return nil
 	}
 
+	// Only desktop frontends show notifications; the shell may run on a server without desktop.
+	if frontendMode == "qt" || frontendMode == "tray" {
+		go func() {
+			defer panicHandler.HandlePanic()
+			notifications.New(pref, eventListener, bridgeInstance, "ProtonMail Bridge").Watch()
+		}()
+	}
+
 	showWindowOnStart := !context.GlobalBool("no-window")
 	frontend := frontend.New(constants.Version, constants.BuildVersion, frontendMode, showWindowOnStart, panicHandler, cfg, pref, eventListener, updates, bridgeInstance, smtpBackend)
 
@@ -256,6 +593,8 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 		return cli.NewExitError("Frontend error", 2)
 	}
 
+	startupGuard.Finish()
+
 	if frontend.IsAppRestarting() {
 		cmd.RestartApp()
 	}
@@ -293,3 +632,59 @@ func migratePreferencesFromC10(cfg *config.Config) {
 
 	log.Info("Preferences migrated")
 }
+
+// getKeychainPassphrase returns the passphrase of the file keychain from the
+// environment. When it is not set and the file keychain is used by the shell,
+// the passphrase is prompted for in the terminal instead.
+func getKeychainPassphrase(context *cli.Context, cfg *config.Config, pref *config.Preferences, safeMode bool) string {
+	if passphrase := os.Getenv(keychain.FilePassphraseEnv); passphrase != "" {
+		return passphrase
+	}
+	if !pref.GetBool(preferences.KeychainFileKey) || !(context.GlobalBool("cli") || safeMode) {
+		return ""
+	}
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return ""
+	}
+
+	_, err := os.Stat(cfg.GetKeychainPath())
+	isNew := os.IsNotExist(err)
+
+	for attempt := 0; attempt < 3; attempt++ {
+		passphrase := readPassphrase("Keychain passphrase: ")
+		if passphrase == "" || !isNew {
+			return passphrase
+		}
+		if readPassphrase("Repeat keychain passphrase: ") == passphrase {
+			return passphrase
+		}
+		fmt.Println("Passphrases do not match.")
+	}
+	return ""
+}
+
+func readPassphrase(prompt string) string {
+	fmt.Print(prompt)
+	defer fmt.Println()
+
+	passphrase, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		log.WithError(err).Warn("Cannot read keychain passphrase")
+		return ""
+	}
+	return string(passphrase)
+}
+
+// readScriptInput returns the standard input for account commands forwarded
+// to the running instance. Secrets cannot be prompted for in a terminal, so
+// they must be set in the environment then.
+func readScriptInput() string {
+	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return ""
+	}
+	input, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		log.WithError(err).Warn("Cannot read standard input")
+	}
+	return string(input)
+}
@@ -20,10 +20,12 @@ package main
 import (
 	"runtime/pprof"
 
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/cmd"
 	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/internal/frontend"
 	"github.com/ProtonMail/proton-bridge/internal/importexport"
+	"github.com/ProtonMail/proton-bridge/internal/transfer"
 	"github.com/ProtonMail/proton-bridge/internal/updates"
 	"github.com/ProtonMail/proton-bridge/internal/users/credentials"
 	"github.com/ProtonMail/proton-bridge/pkg/config"
@@ -60,16 +62,18 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 	// We need to have config instance to setup a logs, panic handler, etc ...
 	cfg := config.New(appName, constants.Version, constants.Revision, "")
 
-	// We want to know about any problem. Our PanicHandler calls sentry which is
-	// not dependent on anything else. If that fails, it tries to create crash
-	// report which will not be possible if no folder can be created. That's the
-	// only problem we will not be notified about in any way.
+	// We want to know about any problem. Our PanicHandler saves crash report
+	// which is sent only when the user agrees. It will not be possible if no
+	// folder can be created. That's the only problem we will not be notified
+	// about in any way.
+	bridge.SetCrashReportDir(cfg.GetCrashReportDir())
 	panicHandler := &cmd.PanicHandler{
 		AppName: "ProtonMail Import-Export app",
 		Config:  cfg,
 		Err:     &contextError,
 	}
 	defer panicHandler.HandlePanic()
+	transfer.SetCrashReportSaver(bridge.NewCrashReportSaver(panicHandler.AppName, cfg.GetVersion()))
 
 	// First we need config and create necessary folder; it's dependency for everything.
 	if err := cfg.CreateDirs(); err != nil {
@@ -79,6 +83,7 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 	// Setup of logs should be as soon as possible to ensure we record every wanted report in the log.
 	logLevel := context.GlobalString("log-level")
 	_, _ = config.SetupLog(cfg, logLevel)
+	logrus.AddHook(bridge.CrashLogHook())
 
 	// Doesn't make sense to continue when Import-Export was invoked with wrong arguments.
 	// We should tell that to the user before we do anything else.
@@ -0,0 +1,157 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/users"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// maxAddressRequestSize is how much of the request body is read.
+const maxAddressRequestSize = 64 * 1024
+
+// addressSettings reads and changes display names and signatures of
+// addresses. Every call is authenticated by the access token of the account.
+type addressSettings interface {
+	GetAddressSettings(account, accessToken string) ([]users.AddressSettings, error)
+	SetAddressSettings(account, accessToken string, settings users.AddressSettings) error
+	GetAppendSignature(account, accessToken string) (bool, error)
+	SetAppendSignature(account, accessToken string, enabled bool) error
+}
+
+type addressSettingsResponse struct {
+	AppendSignature bool                   `json:"append_signature"`
+	Addresses       []addressSettingsEntry `json:"addresses"`
+}
+
+type addressSettingsEntry struct {
+	Address     string `json:"address"`
+	DisplayName string `json:"display_name"`
+	Signature   string `json:"signature"`
+}
+
+// addressSettingsRequest changes only the fields which are present.
+type addressSettingsRequest struct {
+	AppendSignature *bool   `json:"append_signature"`
+	DisplayName     *string `json:"display_name"`
+	Signature       *string `json:"signature"`
+}
+
+// addressesHandler serves `/addresses/{account}` with GET of settings of all
+// addresses and PUT of `append_signature`, and `/addresses/{account}/{address}`
+// with PUT of `display_name` and `signature` as JSON. Missing fields are not
+// changed. The access token is passed the same way as to `/plugins/`.
+func addressesHandler(ctx handlerContext) error {
+	if ctx.addresses == nil {
+		return writePluginError(ctx.resp, http.StatusServiceUnavailable, "address settings are not available")
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(ctx.req.URL.Path, "/addresses/"), "/", 2)
+	if parts[0] == "" {
+		return writePluginError(ctx.resp, http.StatusNotFound, "use /addresses/{account}/{address}")
+	}
+	account, address := parts[0], ""
+	if len(parts) == 2 {
+		address = parts[1]
+	}
+
+	accessToken := strings.TrimPrefix(ctx.req.Header.Get("Authorization"), "Bearer ")
+
+	if ctx.req.Method == http.MethodGet && address == "" {
+		return writeAddressSettings(ctx, account, accessToken)
+	}
+	if ctx.req.Method != http.MethodPut {
+		return writePluginError(ctx.resp, http.StatusMethodNotAllowed, "settings can be read by GET of account and changed by PUT")
+	}
+
+	var req addressSettingsRequest
+	if err := json.NewDecoder(io.LimitReader(ctx.req.Body, maxAddressRequestSize)).Decode(&req); err != nil {
+		return writePluginError(ctx.resp, http.StatusBadRequest, "invalid JSON: "+err.Error())
+	}
+
+	if address == "" {
+		if req.AppendSignature == nil {
+			return writePluginError(ctx.resp, http.StatusBadRequest, "append_signature is missing")
+		}
+		if err := ctx.addresses.SetAppendSignature(account, accessToken, *req.AppendSignature); err != nil {
+			return writeAddressSettingsError(ctx.resp, err)
+		}
+		ctx.resp.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	all, err := ctx.addresses.GetAddressSettings(account, accessToken)
+	if err != nil {
+		return writeAddressSettingsError(ctx.resp, err)
+	}
+	for _, settings := range all {
+		if !strings.EqualFold(settings.Address, address) {
+			continue
+		}
+		if req.DisplayName != nil {
+			settings.DisplayName = *req.DisplayName
+		}
+		if req.Signature != nil {
+			settings.Signature = *req.Signature
+		}
+		if err := ctx.addresses.SetAddressSettings(account, accessToken, settings); err != nil {
+			return writeAddressSettingsError(ctx.resp, err)
+		}
+		ctx.resp.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return writePluginError(ctx.resp, http.StatusNotFound, "address "+address+" does not belong to the account")
+}
+
+func writeAddressSettings(ctx handlerContext, account, accessToken string) error {
+	all, err := ctx.addresses.GetAddressSettings(account, accessToken)
+	if err != nil {
+		return writeAddressSettingsError(ctx.resp, err)
+	}
+	appendSignature, err := ctx.addresses.GetAppendSignature(account, accessToken)
+	if err != nil {
+		return writeAddressSettingsError(ctx.resp, err)
+	}
+
+	res := addressSettingsResponse{AppendSignature: appendSignature, Addresses: []addressSettingsEntry{}}
+	for _, settings := range all {
+		res.Addresses = append(res.Addresses, addressSettingsEntry{
+			Address:     settings.Address,
+			DisplayName: settings.DisplayName,
+			Signature:   settings.Signature,
+		})
+	}
+	return writeJSON(ctx.resp, http.StatusOK, res)
+}
+
+func writeAddressSettingsError(resp http.ResponseWriter, err error) error {
+	switch err {
+	case bridge.ErrInvalidAccessToken:
+		return writePluginError(resp, http.StatusUnauthorized, err.Error())
+	case pmapi.ErrAPINotReachable:
+		return writePluginError(resp, http.StatusServiceUnavailable, err.Error())
+	}
+	log.WithError(err).Error("Address settings failed")
+	return writePluginError(resp, http.StatusInternalServerError, err.Error())
+}
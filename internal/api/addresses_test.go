@@ -0,0 +1,124 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+type testAddressSettings struct {
+	appendSignature bool
+	addresses       []users.AddressSettings
+}
+
+func (s *testAddressSettings) check(account, accessToken string) error {
+	if account != "user@pm.me" || accessToken != "access" {
+		return bridge.ErrInvalidAccessToken
+	}
+	return nil
+}
+
+func (s *testAddressSettings) GetAddressSettings(account, accessToken string) ([]users.AddressSettings, error) {
+	if err := s.check(account, accessToken); err != nil {
+		return nil, err
+	}
+	return s.addresses, nil
+}
+
+func (s *testAddressSettings) SetAddressSettings(account, accessToken string, settings users.AddressSettings) error {
+	if err := s.check(account, accessToken); err != nil {
+		return err
+	}
+	for i := range s.addresses {
+		if s.addresses[i].Address == settings.Address {
+			s.addresses[i] = settings
+		}
+	}
+	return nil
+}
+
+func (s *testAddressSettings) GetAppendSignature(account, accessToken string) (bool, error) {
+	return s.appendSignature, s.check(account, accessToken)
+}
+
+func (s *testAddressSettings) SetAppendSignature(account, accessToken string, enabled bool) error {
+	if err := s.check(account, accessToken); err != nil {
+		return err
+	}
+	s.appendSignature = enabled
+	return nil
+}
+
+func requestAddresses(settings *testAddressSettings, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp := httptest.NewRecorder()
+
+	wrapper(&apiServer{addresses: settings}, addressesHandler)(resp, req)
+	return resp
+}
+
+func TestAddressesHandler(t *testing.T) {
+	settings := &testAddressSettings{addresses: []users.AddressSettings{
+		{Address: "user@pm.me", DisplayName: "User", Signature: "<div>User</div>"},
+		{Address: "alias@pm.me", DisplayName: "Alias"},
+	}}
+
+	resp := requestAddresses(settings, http.MethodPut, "/addresses/user@pm.me/Alias@pm.me", "access", `{"signature":"<b>Alias</b>"}`)
+	require.Equal(t, http.StatusNoContent, resp.Code)
+
+	resp = requestAddresses(settings, http.MethodPut, "/addresses/user@pm.me", "access", `{"append_signature":true}`)
+	require.Equal(t, http.StatusNoContent, resp.Code)
+
+	resp = requestAddresses(settings, http.MethodGet, "/addresses/user@pm.me", "access", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	res := addressSettingsResponse{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &res))
+	require.True(t, res.AppendSignature)
+	require.Equal(t, []addressSettingsEntry{
+		{Address: "user@pm.me", DisplayName: "User", Signature: "<div>User</div>"},
+		{Address: "alias@pm.me", DisplayName: "Alias", Signature: "<b>Alias</b>"},
+	}, res.Addresses)
+}
+
+func TestAddressesHandlerErrors(t *testing.T) {
+	settings := &testAddressSettings{addresses: []users.AddressSettings{{Address: "user@pm.me"}}}
+
+	resp := requestAddresses(settings, http.MethodGet, "/addresses/user@pm.me", "", "")
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = requestAddresses(settings, http.MethodPut, "/addresses/user@pm.me/other@pm.me", "access", `{"display_name":"Other"}`)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = requestAddresses(settings, http.MethodPut, "/addresses/user@pm.me", "access", `{}`)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = requestAddresses(settings, http.MethodDelete, "/addresses/user@pm.me/user@pm.me", "access", "")
+	require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+}
@@ -18,16 +18,24 @@
 // Package api provides HTTP API of the Bridge.
 //
 // API endpoints:
+//  * /addresses/, see addressesHandler
+//  * /bulk/, see bulkHandler
 //  * /focus, see focusHandler
+//  * /oauth/token, see oauthTokenHandler
+//  * /plugins/, see pluginsHandler
+//  * /status, see statusHandler
+//  * /wizard, see wizardHandler
 package api
 
 import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/incidents"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
 	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
@@ -46,10 +54,25 @@ type apiServer struct {
 	certPath      string
 	keyPath       string
 	eventListener listener.Listener
+	oauth         oauthTokenIssuer
+	plugins       pluginStorage
+	addresses     addressSettings
+	bulk          bulkOperations
+	messages      fullMessages
+	wizard        onboardingWizard
+	status        apiStatusProvider
+
+	lock   sync.Mutex
+	server *http.Server
 }
 
-// NewAPIServer returns prepared API server struct.
-func NewAPIServer(pref *config.Preferences, tls *tls.Config, certPath, keyPath string, eventListener listener.Listener) *apiServer { //nolint[golint]
+// NewAPIServer returns prepared API server struct. The oauth issues tokens
+// for OAuth clients, the plugins store values of companion tools, the
+// addresses change display names and signatures, the bulk applies actions
+// to many messages, the messages build complete messages too large for
+// IMAP clients, the wizard adds accounts and the status reports
+// availability of Proton API.
+func NewAPIServer(pref *config.Preferences, tls *tls.Config, certPath, keyPath string, eventListener listener.Listener, oauth oauthTokenIssuer, plugins pluginStorage, addresses addressSettings, bulk bulkOperations, messages fullMessages, wizard onboardingWizard, status apiStatusProvider) *apiServer { //nolint[golint]
 	return &apiServer{
 		host:          bridge.Host,
 		pref:          pref,
@@ -57,13 +80,28 @@ func NewAPIServer(pref *config.Preferences, tls *tls.Config, certPath, keyPath s
 		certPath:      certPath,
 		keyPath:       keyPath,
 		eventListener: eventListener,
+		oauth:         oauth,
+		plugins:       plugins,
+		addresses:     addresses,
+		bulk:          bulk,
+		messages:      messages,
+		wizard:        wizard,
+		status:        status,
 	}
 }
 
 // Starts the server.
 func (api *apiServer) ListenAndServe() {
 	mux := http.NewServeMux()
+	mux.HandleFunc("/addresses/", wrapper(api, addressesHandler))
+	mux.HandleFunc("/bulk/", wrapper(api, bulkHandler))
 	mux.HandleFunc("/focus", wrapper(api, focusHandler))
+	mux.HandleFunc("/messages/", wrapper(api, messagesHandler))
+	mux.HandleFunc("/oauth/token", wrapper(api, oauthTokenHandler))
+	mux.HandleFunc("/plugins/", wrapper(api, pluginsHandler))
+	mux.HandleFunc("/status", wrapper(api, statusHandler))
+	mux.HandleFunc("/wizard", wrapper(api, wizardHandler))
+	mux.HandleFunc("/wizard/", wrapper(api, wizardHandler))
 
 	addr := api.getAddress()
 	server := &http.Server{
@@ -73,14 +111,29 @@ func (api *apiServer) ListenAndServe() {
 		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
 	}
 
+	api.lock.Lock()
+	api.server = server
+	api.lock.Unlock()
+
 	log.Info("API listening at ", addr)
-	if err := server.ListenAndServeTLS(api.certPath, api.keyPath); err != nil {
+	if err := server.ListenAndServeTLS(api.certPath, api.keyPath); err != nil && err != http.ErrServerClosed {
 		api.eventListener.Emit(events.ErrorEvent, "API failed: "+err.Error())
+		incidents.Report(incidents.ServerFailed, "", "API failed: "+err.Error())
 		log.Error("API failed: ", err)
 	}
 	defer server.Close() //nolint[errcheck]
 }
 
+// Close stops the server.
+func (api *apiServer) Close() {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	if api.server != nil {
+		_ = api.server.Close()
+	}
+}
+
 func (api *apiServer) getAddress() string {
 	port := api.pref.GetInt(preferences.APIPortKey)
 	newPort := ports.FindFreePortFrom(port)
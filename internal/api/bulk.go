@@ -0,0 +1,119 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// maxBulkRequestSize is how much of the request body is read.
+const maxBulkRequestSize = 64 * 1024
+
+// bulkOperations applies actions to messages selected by the query. Every
+// call is authenticated by the access token of the account.
+type bulkOperations interface {
+	ApplyBulkAction(account, accessToken string, query store.BulkQuery, action store.BulkAction, dryRun bool) ([]*pmapi.Message, error)
+}
+
+type bulkRequest struct {
+	Query  string `json:"query"`
+	Action string `json:"action"`
+	DryRun bool   `json:"dry_run"`
+}
+
+type bulkResponse struct {
+	Matched  int                `json:"matched"`
+	Messages []bulkMessageEntry `json:"messages"`
+}
+
+type bulkMessageEntry struct {
+	ID      string    `json:"id"`
+	Subject string    `json:"subject"`
+	Sender  string    `json:"sender"`
+	Time    time.Time `json:"time"`
+}
+
+// bulkHandler serves `/bulk/{account}` with POST of JSON `query`, `action`
+// and `dry_run`, see store.ParseBulkQuery and store.ParseBulkAction. It
+// responds with the matching messages, which were changed unless dry_run
+// is set. The access token is passed the same way as to `/plugins/`.
+func bulkHandler(ctx handlerContext) error {
+	if ctx.bulk == nil {
+		return writePluginError(ctx.resp, http.StatusServiceUnavailable, "bulk operations are not available")
+	}
+
+	account := strings.TrimPrefix(ctx.req.URL.Path, "/bulk/")
+	if account == "" || strings.Contains(account, "/") {
+		return writePluginError(ctx.resp, http.StatusNotFound, "use /bulk/{account}")
+	}
+	if ctx.req.Method != http.MethodPost {
+		return writePluginError(ctx.resp, http.StatusMethodNotAllowed, "bulk operations are run by POST")
+	}
+
+	var req bulkRequest
+	if err := json.NewDecoder(io.LimitReader(ctx.req.Body, maxBulkRequestSize)).Decode(&req); err != nil {
+		return writePluginError(ctx.resp, http.StatusBadRequest, "invalid JSON: "+err.Error())
+	}
+
+	query, err := store.ParseBulkQuery(req.Query)
+	if err != nil {
+		return writePluginError(ctx.resp, http.StatusBadRequest, "invalid query: "+err.Error())
+	}
+	action, err := store.ParseBulkAction(req.Action)
+	if err != nil {
+		return writePluginError(ctx.resp, http.StatusBadRequest, "invalid action: "+err.Error())
+	}
+
+	accessToken := strings.TrimPrefix(ctx.req.Header.Get("Authorization"), "Bearer ")
+
+	msgs, err := ctx.bulk.ApplyBulkAction(account, accessToken, query, action, req.DryRun)
+	if err != nil {
+		return writeBulkError(ctx.resp, err)
+	}
+
+	res := bulkResponse{Matched: len(msgs), Messages: []bulkMessageEntry{}}
+	for _, msg := range msgs {
+		entry := bulkMessageEntry{ID: msg.ID, Subject: msg.Subject, Time: time.Unix(msg.Time, 0)}
+		if msg.Sender != nil {
+			entry.Sender = msg.Sender.Address
+		}
+		res.Messages = append(res.Messages, entry)
+	}
+	return writeJSON(ctx.resp, http.StatusOK, res)
+}
+
+func writeBulkError(resp http.ResponseWriter, err error) error {
+	switch err {
+	case bridge.ErrInvalidAccessToken:
+		return writePluginError(resp, http.StatusUnauthorized, err.Error())
+	case store.ErrAllMailOpNotAllowed:
+		return writePluginError(resp, http.StatusBadRequest, err.Error())
+	case pmapi.ErrAPINotReachable:
+		return writePluginError(resp, http.StatusServiceUnavailable, err.Error())
+	}
+	log.WithError(err).Error("Bulk operation failed")
+	return writePluginError(resp, http.StatusInternalServerError, err.Error())
+}
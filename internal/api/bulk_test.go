@@ -0,0 +1,94 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+type testBulkOperations struct {
+	query   store.BulkQuery
+	action  store.BulkAction
+	applied bool
+}
+
+func (b *testBulkOperations) ApplyBulkAction(account, accessToken string, query store.BulkQuery, action store.BulkAction, dryRun bool) ([]*pmapi.Message, error) {
+	if account != "user@pm.me" || accessToken != "access" {
+		return nil, bridge.ErrInvalidAccessToken
+	}
+	b.query, b.action, b.applied = query, action, !dryRun
+	return []*pmapi.Message{{ID: "msg1", Subject: "Hello"}}, nil
+}
+
+func requestBulk(bulk *testBulkOperations, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp := httptest.NewRecorder()
+
+	wrapper(&apiServer{bulk: bulk}, bulkHandler)(resp, req)
+	return resp
+}
+
+func TestBulkHandler(t *testing.T) {
+	bulk := &testBulkOperations{}
+
+	resp := requestBulk(bulk, http.MethodPost, "/bulk/user@pm.me", "access", `{"query":"label:Newsletters from:news","action":"label:Folders/Old","dry_run":true}`)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, store.BulkQuery{Mailbox: "Newsletters", From: "news"}, bulk.query)
+	require.Equal(t, store.BulkAction{Name: store.BulkLabel, Mailbox: "Folders/Old"}, bulk.action)
+	require.False(t, bulk.applied)
+
+	res := bulkResponse{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &res))
+	require.Equal(t, 1, res.Matched)
+	require.Equal(t, "msg1", res.Messages[0].ID)
+
+	resp = requestBulk(bulk, http.MethodPost, "/bulk/user@pm.me", "access", `{"query":"from:news","action":"trash"}`)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.True(t, bulk.applied)
+}
+
+func TestBulkHandlerErrors(t *testing.T) {
+	bulk := &testBulkOperations{}
+
+	resp := requestBulk(bulk, http.MethodPost, "/bulk/user@pm.me", "", `{"query":"from:news","action":"read"}`)
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = requestBulk(bulk, http.MethodPost, "/bulk/user@pm.me", "access", `{"query":"","action":"read"}`)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = requestBulk(bulk, http.MethodPost, "/bulk/user@pm.me", "access", `{"query":"from:news","action":"archive"}`)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = requestBulk(bulk, http.MethodGet, "/bulk/user@pm.me", "access", "")
+	require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+
+	resp = requestBulk(bulk, http.MethodPost, "/bulk/", "access", "")
+	require.Equal(t, http.StatusNotFound, resp.Code)
+}
@@ -33,6 +33,13 @@ type handlerContext struct {
 	req           *http.Request
 	resp          http.ResponseWriter
 	eventListener listener.Listener
+	oauth         oauthTokenIssuer
+	plugins       pluginStorage
+	addresses     addressSettings
+	bulk          bulkOperations
+	messages      fullMessages
+	wizard        onboardingWizard
+	status        apiStatusProvider
 }
 
 func wrapper(api *apiServer, callback handler) httpHandler {
@@ -41,6 +48,13 @@ func wrapper(api *apiServer, callback handler) httpHandler {
 			req:           req,
 			resp:          w,
 			eventListener: api.eventListener,
+			oauth:         api.oauth,
+			plugins:       api.plugins,
+			addresses:     api.addresses,
+			bulk:          api.bulk,
+			messages:      api.messages,
+			wizard:        api.wizard,
+			status:        api.status,
 		}
 		err := callback(ctx)
 		if err != nil {
@@ -0,0 +1,76 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// fullMessages builds complete messages which IMAP clients get only as
+// a truncated preview because of the message size limit. Every call is
+// authenticated by the access token of the account.
+type fullMessages interface {
+	BuildFullMessage(account, accessToken, messageID string) (io.ReadCloser, error)
+}
+
+// messagesHandler serves `/messages/{account}/{messageID}` with GET of the
+// complete message in RFC 822 format. The access token is passed the same
+// way as to `/plugins/`.
+func messagesHandler(ctx handlerContext) error {
+	if ctx.messages == nil {
+		return writePluginError(ctx.resp, http.StatusServiceUnavailable, "message download is not available")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(ctx.req.URL.Path, "/messages/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return writePluginError(ctx.resp, http.StatusNotFound, "use /messages/{account}/{messageID}")
+	}
+	if ctx.req.Method != http.MethodGet {
+		return writePluginError(ctx.resp, http.StatusMethodNotAllowed, "messages are downloaded by GET")
+	}
+
+	accessToken := strings.TrimPrefix(ctx.req.Header.Get("Authorization"), "Bearer ")
+
+	body, err := ctx.messages.BuildFullMessage(parts[0], accessToken, parts[1])
+	switch err {
+	case nil:
+	case bridge.ErrInvalidAccessToken:
+		return writePluginError(ctx.resp, http.StatusUnauthorized, err.Error())
+	case pmapi.ErrAPINotReachable:
+		return writePluginError(ctx.resp, http.StatusServiceUnavailable, err.Error())
+	default:
+		log.WithError(err).Error("Cannot build full message")
+		return writePluginError(ctx.resp, http.StatusNotFound, err.Error())
+	}
+
+	defer body.Close() //nolint[errcheck]
+
+	// The message is built while being sent, so its length is not known and
+	// building errors can only cut the response.
+	ctx.resp.Header().Set("Content-Type", "message/rfc822")
+	ctx.resp.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(ctx.resp, body); err != nil {
+		log.WithError(err).Error("Cannot send full message")
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/stretchr/testify/require"
+)
+
+type testFullMessages struct{}
+
+func (testFullMessages) BuildFullMessage(account, accessToken, messageID string) (io.ReadCloser, error) {
+	if account != "user@pm.me" || accessToken != "access" {
+		return nil, bridge.ErrInvalidAccessToken
+	}
+	if messageID != "msg1" {
+		return nil, errors.New("no such message")
+	}
+	return ioutil.NopCloser(strings.NewReader("Subject: Hello\r\n\r\nBody\r\n")), nil
+}
+
+func requestMessage(method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp := httptest.NewRecorder()
+
+	wrapper(&apiServer{messages: testFullMessages{}}, messagesHandler)(resp, req)
+	return resp
+}
+
+func TestMessagesHandler(t *testing.T) {
+	resp := requestMessage(http.MethodGet, "/messages/user@pm.me/msg1", "access")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "message/rfc822", resp.Header().Get("Content-Type"))
+	require.Equal(t, "Subject: Hello\r\n\r\nBody\r\n", resp.Body.String())
+}
+
+func TestMessagesHandlerErrors(t *testing.T) {
+	resp := requestMessage(http.MethodGet, "/messages/user@pm.me/msg1", "")
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = requestMessage(http.MethodGet, "/messages/user@pm.me/msg2", "access")
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = requestMessage(http.MethodGet, "/messages/user@pm.me", "access")
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = requestMessage(http.MethodPost, "/messages/user@pm.me/msg1", "access")
+	require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+}
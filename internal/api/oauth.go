@@ -0,0 +1,94 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+)
+
+// oauthTokenIssuer issues tokens of bridge accounts to OAuth clients.
+type oauthTokenIssuer interface {
+	IssueOAuthTokens(username, password string) (bridge.OAuthTokens, error)
+	RefreshOAuthTokens(refreshToken string) (bridge.OAuthTokens, error)
+}
+
+// oauthTokenResponse is the successful response of token endpoint (RFC 6749 section 5.1).
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// oauthErrorResponse is the error response of token endpoint (RFC 6749 section 5.2).
+type oauthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// oauthTokenHandler is the token endpoint for clients which support only
+// OAuth. Tokens are issued by bridge for the account and its bridge password
+// (grant type `password`) or for the previously issued refresh token (grant
+// type `refresh_token`). The access token is then used by XOAUTH2 or
+// OAUTHBEARER to log in to IMAP and SMTP.
+func oauthTokenHandler(ctx handlerContext) error {
+	if ctx.req.Method != http.MethodPost {
+		return writeOAuthError(ctx.resp, http.StatusMethodNotAllowed, "invalid_request", "token has to be requested by POST")
+	}
+	if ctx.oauth == nil {
+		return writeOAuthError(ctx.resp, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+	}
+
+	var tokens bridge.OAuthTokens
+	var err error
+
+	switch grantType := ctx.req.PostFormValue("grant_type"); grantType {
+	case "password":
+		tokens, err = ctx.oauth.IssueOAuthTokens(ctx.req.PostFormValue("username"), ctx.req.PostFormValue("password"))
+	case "refresh_token":
+		tokens, err = ctx.oauth.RefreshOAuthTokens(ctx.req.PostFormValue("refresh_token"))
+	default:
+		return writeOAuthError(ctx.resp, http.StatusBadRequest, "unsupported_grant_type", "use password or refresh_token")
+	}
+	if err != nil {
+		log.WithError(err).Warn("OAuth token was not issued")
+		return writeOAuthError(ctx.resp, http.StatusBadRequest, "invalid_grant", err.Error())
+	}
+
+	ctx.resp.Header().Set("Cache-Control", "no-store")
+	return writeJSON(ctx.resp, http.StatusOK, oauthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(tokens.Expires).Seconds()),
+		RefreshToken: tokens.RefreshToken,
+	})
+}
+
+func writeOAuthError(resp http.ResponseWriter, status int, code, description string) error {
+	return writeJSON(resp, status, oauthErrorResponse{Error: code, ErrorDescription: description})
+}
+
+func writeJSON(resp http.ResponseWriter, status int, body interface{}) error {
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(status)
+	return json.NewEncoder(resp).Encode(body)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/stretchr/testify/require"
+)
+
+type testOAuthIssuer struct{}
+
+func (testOAuthIssuer) IssueOAuthTokens(username, password string) (bridge.OAuthTokens, error) {
+	if username != "user@pm.me" || password != "bridge pass" {
+		return bridge.OAuthTokens{}, bridge.ErrInvalidGrant
+	}
+	return bridge.OAuthTokens{AccessToken: "access", RefreshToken: "refresh", Expires: time.Now().Add(time.Hour)}, nil
+}
+
+func (testOAuthIssuer) RefreshOAuthTokens(refreshToken string) (bridge.OAuthTokens, error) {
+	if refreshToken != "refresh" {
+		return bridge.OAuthTokens{}, bridge.ErrInvalidGrant
+	}
+	return bridge.OAuthTokens{AccessToken: "access2", RefreshToken: "refresh2", Expires: time.Now().Add(time.Hour)}, nil
+}
+
+func requestOAuthToken(t *testing.T, form url.Values) (int, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp := httptest.NewRecorder()
+
+	wrapper(&apiServer{oauth: testOAuthIssuer{}}, oauthTokenHandler)(resp, req)
+
+	body := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	return resp.Code, body
+}
+
+func TestOAuthTokenPasswordGrant(t *testing.T) {
+	code, body := requestOAuthToken(t, url.Values{"grant_type": {"password"}, "username": {"user@pm.me"}, "password": {"bridge pass"}})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "access", body["access_token"])
+	require.Equal(t, "refresh", body["refresh_token"])
+	require.Equal(t, "Bearer", body["token_type"])
+	require.InDelta(t, 3600, body["expires_in"], 5)
+
+	code, body = requestOAuthToken(t, url.Values{"grant_type": {"password"}, "username": {"user@pm.me"}, "password": {"wrong"}})
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, "invalid_grant", body["error"])
+}
+
+func TestOAuthTokenRefreshGrant(t *testing.T) {
+	code, body := requestOAuthToken(t, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"refresh"}})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "access2", body["access_token"])
+	require.Equal(t, "refresh2", body["refresh_token"])
+
+	code, body = requestOAuthToken(t, url.Values{"grant_type": {"client_credentials"}})
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, "unsupported_grant_type", body["error"])
+}
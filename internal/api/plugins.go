@@ -0,0 +1,136 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+)
+
+// maxPluginRequestSize is how much of the request body is read; the size
+// of values is further limited by the store.
+const maxPluginRequestSize = 1024 * 1024
+
+// pluginStorage stores values of companion tools per account. Every call
+// is authenticated by the access token of the account.
+type pluginStorage interface {
+	GetPluginValue(account, accessToken, plugin, key string) ([]byte, error)
+	SetPluginValue(account, accessToken, plugin, key string, value []byte) error
+	DeletePluginValue(account, accessToken, plugin, key string) error
+	GetPluginKeys(account, accessToken, plugin string) ([]string, error)
+}
+
+type pluginKeysResponse struct {
+	Keys []string `json:"keys"`
+}
+
+type pluginErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// pluginsHandler serves `/plugins/{account}/{plugin}/{key}` with GET, PUT
+// and DELETE of the raw value and `/plugins/{account}/{plugin}/` with GET
+// of all keys. The access token issued by `/oauth/token` or the `token`
+// command is passed as `Authorization: Bearer` header. Values are stored
+// encrypted in the account's database.
+func pluginsHandler(ctx handlerContext) error {
+	if ctx.plugins == nil {
+		return writePluginError(ctx.resp, http.StatusServiceUnavailable, "plugin storage is not available")
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(ctx.req.URL.Path, "/plugins/"), "/", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return writePluginError(ctx.resp, http.StatusNotFound, "use /plugins/{account}/{plugin}/{key}")
+	}
+	account, plugin, key := parts[0], parts[1], ""
+	if len(parts) == 3 {
+		key = parts[2]
+	}
+
+	accessToken := strings.TrimPrefix(ctx.req.Header.Get("Authorization"), "Bearer ")
+
+	if key == "" {
+		if ctx.req.Method != http.MethodGet {
+			return writePluginError(ctx.resp, http.StatusMethodNotAllowed, "keys can be only listed by GET")
+		}
+		keys, err := ctx.plugins.GetPluginKeys(account, accessToken, plugin)
+		if err != nil {
+			return writePluginStorageError(ctx.resp, err)
+		}
+		if keys == nil {
+			keys = []string{}
+		}
+		return writeJSON(ctx.resp, http.StatusOK, pluginKeysResponse{Keys: keys})
+	}
+
+	switch ctx.req.Method {
+	case http.MethodGet:
+		value, err := ctx.plugins.GetPluginValue(account, accessToken, plugin, key)
+		if err != nil {
+			return writePluginStorageError(ctx.resp, err)
+		}
+		ctx.resp.Header().Set("Content-Type", "application/octet-stream")
+		_, err = ctx.resp.Write(value)
+		return err
+
+	case http.MethodPut:
+		value, err := ioutil.ReadAll(io.LimitReader(ctx.req.Body, maxPluginRequestSize))
+		if err != nil {
+			return err
+		}
+		if err := ctx.plugins.SetPluginValue(account, accessToken, plugin, key, value); err != nil {
+			return writePluginStorageError(ctx.resp, err)
+		}
+		ctx.resp.WriteHeader(http.StatusNoContent)
+		return nil
+
+	case http.MethodDelete:
+		if err := ctx.plugins.DeletePluginValue(account, accessToken, plugin, key); err != nil {
+			return writePluginStorageError(ctx.resp, err)
+		}
+		ctx.resp.WriteHeader(http.StatusNoContent)
+		return nil
+
+	default:
+		return writePluginError(ctx.resp, http.StatusMethodNotAllowed, "use GET, PUT or DELETE")
+	}
+}
+
+func writePluginStorageError(resp http.ResponseWriter, err error) error {
+	switch err {
+	case bridge.ErrInvalidAccessToken:
+		return writePluginError(resp, http.StatusUnauthorized, err.Error())
+	case store.ErrNoSuchPluginValue:
+		return writePluginError(resp, http.StatusNotFound, err.Error())
+	case store.ErrInvalidPluginKey:
+		return writePluginError(resp, http.StatusBadRequest, err.Error())
+	case store.ErrPluginLimitReached:
+		return writePluginError(resp, http.StatusRequestEntityTooLarge, err.Error())
+	}
+	log.WithError(err).Error("Plugin storage failed")
+	return writePluginError(resp, http.StatusInternalServerError, err.Error())
+}
+
+func writePluginError(resp http.ResponseWriter, status int, message string) error {
+	return writeJSON(resp, status, pluginErrorResponse{Error: message})
+}
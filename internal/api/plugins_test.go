@@ -0,0 +1,125 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/stretchr/testify/require"
+)
+
+type testPluginStorage map[string][]byte
+
+func (s testPluginStorage) check(account, accessToken string) error {
+	if account != "user@pm.me" || accessToken != "access" {
+		return bridge.ErrInvalidAccessToken
+	}
+	return nil
+}
+
+func (s testPluginStorage) GetPluginValue(account, accessToken, plugin, key string) ([]byte, error) {
+	if err := s.check(account, accessToken); err != nil {
+		return nil, err
+	}
+	value, ok := s[plugin+"/"+key]
+	if !ok {
+		return nil, store.ErrNoSuchPluginValue
+	}
+	return value, nil
+}
+
+func (s testPluginStorage) SetPluginValue(account, accessToken, plugin, key string, value []byte) error {
+	if err := s.check(account, accessToken); err != nil {
+		return err
+	}
+	s[plugin+"/"+key] = value
+	return nil
+}
+
+func (s testPluginStorage) DeletePluginValue(account, accessToken, plugin, key string) error {
+	if err := s.check(account, accessToken); err != nil {
+		return err
+	}
+	delete(s, plugin+"/"+key)
+	return nil
+}
+
+func (s testPluginStorage) GetPluginKeys(account, accessToken, plugin string) (keys []string, err error) {
+	if err := s.check(account, accessToken); err != nil {
+		return nil, err
+	}
+	for k := range s {
+		if strings.HasPrefix(k, plugin+"/") {
+			keys = append(keys, strings.TrimPrefix(k, plugin+"/"))
+		}
+	}
+	return keys, nil
+}
+
+func requestPlugins(storage testPluginStorage, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp := httptest.NewRecorder()
+
+	wrapper(&apiServer{plugins: storage}, pluginsHandler)(resp, req)
+	return resp
+}
+
+func TestPluginsHandler(t *testing.T) {
+	storage := testPluginStorage{}
+
+	resp := requestPlugins(storage, http.MethodPut, "/plugins/user@pm.me/notifier/last", "access", "msg1")
+	require.Equal(t, http.StatusNoContent, resp.Code)
+
+	resp = requestPlugins(storage, http.MethodGet, "/plugins/user@pm.me/notifier/last", "access", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "msg1", resp.Body.String())
+
+	resp = requestPlugins(storage, http.MethodGet, "/plugins/user@pm.me/notifier/", "access", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	keys := pluginKeysResponse{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &keys))
+	require.Equal(t, []string{"last"}, keys.Keys)
+
+	resp = requestPlugins(storage, http.MethodDelete, "/plugins/user@pm.me/notifier/last", "access", "")
+	require.Equal(t, http.StatusNoContent, resp.Code)
+
+	resp = requestPlugins(storage, http.MethodGet, "/plugins/user@pm.me/notifier/last", "access", "")
+	require.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestPluginsHandlerRequiresToken(t *testing.T) {
+	storage := testPluginStorage{"notifier/last": []byte("msg1")}
+
+	resp := requestPlugins(storage, http.MethodGet, "/plugins/user@pm.me/notifier/last", "", "")
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = requestPlugins(storage, http.MethodGet, "/plugins/other@pm.me/notifier/last", "access", "")
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = requestPlugins(storage, http.MethodGet, "/plugins/user@pm.me", "access", "")
+	require.Equal(t, http.StatusNotFound, resp.Code)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// apiStatusProvider reports whether requests are sent to the Proton API.
+type apiStatusProvider interface {
+	GetAPIStatus() pmapi.APIStatus
+}
+
+type statusResponse struct {
+	API apiStatusResponse `json:"api"`
+}
+
+type apiStatusResponse struct {
+	Available bool       `json:"available"`
+	State     string     `json:"state"`
+	Failures  int        `json:"failures,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	Since     *time.Time `json:"since,omitempty"`
+	NextProbe *time.Time `json:"next_probe,omitempty"`
+}
+
+// statusHandler serves `/status` with GET of the Proton API availability.
+// While requests to the API are suspended after repeated failures, the
+// response has status 503 so it can be used by health checks as is.
+func statusHandler(ctx handlerContext) error {
+	if ctx.req.Method != http.MethodGet {
+		http.Error(ctx.resp, "status can be only read by GET", http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	status := ctx.status.GetAPIStatus()
+	res := statusResponse{API: apiStatusResponse{
+		Available: status.IsAvailable(),
+		State:     status.State.String(),
+		Failures:  status.Failures,
+		LastError: status.LastError,
+	}}
+	if !status.Since.IsZero() {
+		res.API.Since = &status.Since
+	}
+	if !status.NextProbe.IsZero() {
+		res.API.NextProbe = &status.NextProbe
+	}
+
+	code := http.StatusOK
+	if !status.IsAvailable() {
+		code = http.StatusServiceUnavailable
+	}
+	return writeJSON(ctx.resp, code, res)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+type testStatusProvider pmapi.APIStatus
+
+func (p testStatusProvider) GetAPIStatus() pmapi.APIStatus {
+	return pmapi.APIStatus(p)
+}
+
+func requestStatus(status testStatusProvider, method string) (*httptest.ResponseRecorder, statusResponse) {
+	req := httptest.NewRequest(method, "/status", nil)
+	resp := httptest.NewRecorder()
+
+	wrapper(&apiServer{status: status}, statusHandler)(resp, req)
+
+	res := statusResponse{}
+	_ = json.Unmarshal(resp.Body.Bytes(), &res)
+	return resp, res
+}
+
+func TestStatusHandler(t *testing.T) {
+	resp, res := requestStatus(testStatusProvider{}, http.MethodGet)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, apiStatusResponse{Available: true, State: "closed"}, res.API)
+
+	since := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	resp, res = requestStatus(testStatusProvider{
+		State:     pmapi.CircuitOpen,
+		Failures:  5,
+		LastError: "Service Unavailable",
+		Since:     since,
+		NextProbe: since.Add(time.Minute),
+	}, http.MethodGet)
+	require.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	require.False(t, res.API.Available)
+	require.Equal(t, "open", res.API.State)
+	require.Equal(t, 5, res.API.Failures)
+	require.Equal(t, "Service Unavailable", res.API.LastError)
+	require.Equal(t, since, *res.API.Since)
+	require.Equal(t, since.Add(time.Minute), *res.API.NextProbe)
+
+	resp, _ = requestStatus(testStatusProvider{}, http.MethodPost)
+	require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+}
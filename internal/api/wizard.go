@@ -0,0 +1,122 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/frontend/wizard"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// onboardingWizard adds accounts by the same flow as CLI and GUI.
+type onboardingWizard interface {
+	GetState() wizard.State
+	Start()
+	SubmitCredentials(username, password string) error
+	SubmitTwoFactor(code string) error
+	SubmitMailboxPassword(mailboxPassword string) error
+	ConfigureClient(name string, addressIndex int) error
+	Finish() error
+}
+
+// wizardHandler serves `/wizard` with GET of the current state and
+// `/wizard/{action}` with POST of form values. Actions are `start` to cancel
+// the flow in progress, `credentials` with `username` and `password`,
+// `two-factor` with `code`, `mailbox-password` with `password`, `client`
+// with name of `client` from the state and index of `address`, and `finish`
+// after the client was configured or skipped. Every response is the state
+// of the flow. Bridge passwords in client configuration are included only
+// in responses to actions with credentials.
+func wizardHandler(ctx handlerContext) error {
+	if ctx.wizard == nil {
+		return writeJSON(ctx.resp, http.StatusServiceUnavailable, wizard.State{Error: "wizard is not available"})
+	}
+
+	action := strings.Trim(strings.TrimPrefix(ctx.req.URL.Path, "/wizard"), "/")
+	if action == "" {
+		if ctx.req.Method != http.MethodGet {
+			return writeWizardError(ctx, http.StatusMethodNotAllowed, "state can be only read by GET")
+		}
+		return writeJSON(ctx.resp, http.StatusOK, ctx.wizard.GetState().WithoutSecrets())
+	}
+
+	if ctx.req.Method != http.MethodPost {
+		return writeWizardError(ctx, http.StatusMethodNotAllowed, "actions have to be sent by POST")
+	}
+
+	var err error
+	withSecrets := false
+
+	switch action {
+	case "start":
+		ctx.wizard.Start()
+	case "credentials":
+		withSecrets = true
+		err = ctx.wizard.SubmitCredentials(ctx.req.PostFormValue("username"), ctx.req.PostFormValue("password"))
+	case "two-factor":
+		withSecrets = true
+		err = ctx.wizard.SubmitTwoFactor(ctx.req.PostFormValue("code"))
+	case "mailbox-password":
+		withSecrets = true
+		err = ctx.wizard.SubmitMailboxPassword(ctx.req.PostFormValue("password"))
+	case "client":
+		addressIndex := 0
+		if address := ctx.req.PostFormValue("address"); address != "" {
+			if addressIndex, err = strconv.Atoi(address); err != nil {
+				return writeWizardError(ctx, http.StatusBadRequest, "address has to be index of address")
+			}
+		}
+		err = ctx.wizard.ConfigureClient(ctx.req.PostFormValue("client"), addressIndex)
+	case "finish":
+		err = ctx.wizard.Finish()
+	default:
+		return writeWizardError(ctx, http.StatusNotFound, "unknown action "+action)
+	}
+
+	if err != nil {
+		log.WithError(err).WithField("action", action).Warn("Wizard action failed")
+		return writeWizardError(ctx, getWizardErrorStatus(err), err.Error())
+	}
+
+	state := ctx.wizard.GetState()
+	if !withSecrets {
+		state = state.WithoutSecrets()
+	}
+	return writeJSON(ctx.resp, http.StatusOK, state)
+}
+
+func getWizardErrorStatus(err error) int {
+	switch err {
+	case wizard.ErrWrongStep:
+		return http.StatusConflict
+	case pmapi.ErrAPINotReachable:
+		return http.StatusServiceUnavailable
+	case pmapi.ErrUpgradeApplication:
+		return http.StatusUpgradeRequired
+	}
+	return http.StatusBadRequest
+}
+
+func writeWizardError(ctx handlerContext, status int, message string) error {
+	state := ctx.wizard.GetState().WithoutSecrets()
+	state.Error = message
+	return writeJSON(ctx.resp, status, state)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/frontend/wizard"
+	"github.com/stretchr/testify/require"
+)
+
+// testWizard adds the account right after credentials.
+type testWizard struct {
+	step wizard.Step
+}
+
+func (w *testWizard) GetState() wizard.State {
+	state := wizard.State{Step: w.step}
+	if w.step == wizard.StepClientConfig {
+		state.Configs = []wizard.ClientConfig{{Address: "user@pm.me", Password: "bridgepass"}}
+	}
+	return state
+}
+
+func (w *testWizard) Start() {
+	w.step = wizard.StepCredentials
+}
+
+func (w *testWizard) SubmitCredentials(username, password string) error {
+	if w.step != wizard.StepCredentials {
+		return wizard.ErrWrongStep
+	}
+	if username == "" || password == "" {
+		return wizard.ErrEmptyValue
+	}
+	w.step = wizard.StepClientConfig
+	return nil
+}
+
+func (w *testWizard) SubmitTwoFactor(code string) error {
+	return wizard.ErrWrongStep
+}
+
+func (w *testWizard) SubmitMailboxPassword(mailboxPassword string) error {
+	return wizard.ErrWrongStep
+}
+
+func (w *testWizard) ConfigureClient(name string, addressIndex int) error {
+	return wizard.ErrUnknownClient
+}
+
+func (w *testWizard) Finish() error {
+	if w.step != wizard.StepClientConfig {
+		return wizard.ErrWrongStep
+	}
+	w.step = wizard.StepDone
+	return nil
+}
+
+func requestWizard(w *testWizard, method, path string, form url.Values) (*httptest.ResponseRecorder, wizard.State) {
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp := httptest.NewRecorder()
+
+	wrapper(&apiServer{wizard: w}, wizardHandler)(resp, req)
+
+	var state wizard.State
+	_ = json.NewDecoder(resp.Body).Decode(&state)
+	return resp, state
+}
+
+func TestWizardHandler(t *testing.T) {
+	w := &testWizard{step: wizard.StepCredentials}
+
+	resp, state := requestWizard(w, http.MethodGet, "/wizard", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, wizard.StepCredentials, state.Step)
+
+	resp, state = requestWizard(w, http.MethodPost, "/wizard/finish", nil)
+	require.Equal(t, http.StatusConflict, resp.Code)
+	require.Equal(t, wizard.ErrWrongStep.Error(), state.Error)
+
+	resp, state = requestWizard(w, http.MethodPost, "/wizard/credentials", url.Values{"username": {"user"}})
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	require.Equal(t, wizard.ErrEmptyValue.Error(), state.Error)
+
+	resp, state = requestWizard(w, http.MethodPost, "/wizard/credentials", url.Values{"username": {"user"}, "password": {"pass"}})
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, wizard.StepClientConfig, state.Step)
+	require.Equal(t, "bridgepass", state.Configs[0].Password)
+
+	// Password is shown only to the one who provided credentials.
+	resp, state = requestWizard(w, http.MethodGet, "/wizard", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "user@pm.me", state.Configs[0].Address)
+	require.Empty(t, state.Configs[0].Password)
+
+	resp, _ = requestWizard(w, http.MethodPost, "/wizard/client", url.Values{"client": {"Apple Mail"}, "address": {"first"}})
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp, _ = requestWizard(w, http.MethodPost, "/wizard/unknown", nil)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp, _ = requestWizard(w, http.MethodGet, "/wizard/finish", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+
+	resp, state = requestWizard(w, http.MethodPost, "/wizard/finish", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, wizard.StepDone, state.Step)
+
+	resp, state = requestWizard(w, http.MethodPost, "/wizard/start", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, wizard.StepCredentials, state.Step)
+}
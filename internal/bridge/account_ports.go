@@ -0,0 +1,164 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/ports"
+)
+
+const maxAccountPort = 65535
+
+// AccountPorts is the pair of IMAP and SMTP ports dedicated to one account.
+type AccountPorts struct {
+	IMAP int `json:"imap"`
+	SMTP int `json:"smtp"`
+}
+
+// IsAccountPortsEnabled returns whether accounts get dedicated ports.
+func (b *Bridge) IsAccountPortsEnabled() bool {
+	return b.pref.GetBool(preferences.AccountPortsKey)
+}
+
+// GetAccountPorts returns ports dedicated to accounts by user ID. The map is
+// empty when dedicated ports are disabled.
+func (b *Bridge) GetAccountPorts() map[string]AccountPorts {
+	if !b.IsAccountPortsEnabled() {
+		return map[string]AccountPorts{}
+	}
+
+	b.accountPortsLock.Lock()
+	defer b.accountPortsLock.Unlock()
+
+	return b.loadAccountPorts()
+}
+
+// GetAccountPortsUserID returns ID of the user to whom the port is dedicated.
+func (b *Bridge) GetAccountPortsUserID(port int) (string, bool) {
+	for userID, accountPorts := range b.GetAccountPorts() {
+		if accountPorts.IMAP == port || accountPorts.SMTP == port {
+			return userID, true
+		}
+	}
+	return "", false
+}
+
+// AssignAccountPorts dedicates ports to accounts which don't have them yet
+// and releases ports of removed accounts. Assignments are persisted so
+// accounts keep their ports after restart.
+func (b *Bridge) AssignAccountPorts() map[string]AccountPorts {
+	if !b.IsAccountPortsEnabled() {
+		return map[string]AccountPorts{}
+	}
+
+	b.accountPortsLock.Lock()
+	defer b.accountPortsLock.Unlock()
+
+	userIDs := []string{}
+	for _, user := range b.GetUsers() {
+		userIDs = append(userIDs, user.ID())
+	}
+
+	reserved := []int{
+		b.pref.GetInt(preferences.APIPortKey),
+		b.pref.GetInt(preferences.IMAPPortKey),
+		b.pref.GetInt(preferences.SMTPPortKey),
+		b.pref.GetInt(preferences.CalDAVPortKey),
+		b.pref.GetInt(preferences.LDAPPortKey),
+		b.pref.GetInt(preferences.SMTPImplicitTLSPortKey),
+	}
+
+	accountPorts := assignAccountPorts(
+		b.loadAccountPorts(),
+		userIDs,
+		b.pref.GetInt(preferences.IMAPPortKey)+1,
+		b.pref.GetInt(preferences.SMTPPortKey)+1,
+		reserved,
+		ports.IsPortFree,
+	)
+
+	if data, err := json.Marshal(accountPorts); err != nil {
+		log.WithError(err).Error("Cannot save account ports")
+	} else {
+		b.pref.Set(preferences.AccountPortsMapKey, string(data))
+	}
+
+	return accountPorts
+}
+
+func (b *Bridge) loadAccountPorts() map[string]AccountPorts {
+	accountPorts := map[string]AccountPorts{}
+
+	if value := b.pref.Get(preferences.AccountPortsMapKey); value != "" {
+		if err := json.Unmarshal([]byte(value), &accountPorts); err != nil {
+			log.WithError(err).Warn("Cannot parse account ports, assigning new ones")
+			return map[string]AccountPorts{}
+		}
+	}
+
+	return accountPorts
+}
+
+// assignAccountPorts keeps ports of existing accounts and assigns the first
+// unused free ports from imapStart and smtpStart to the new ones.
+func assignAccountPorts(
+	assigned map[string]AccountPorts,
+	userIDs []string,
+	imapStart, smtpStart int,
+	reserved []int,
+	isFree func(int) bool,
+) map[string]AccountPorts {
+	used := map[int]bool{}
+	for _, port := range reserved {
+		used[port] = true
+	}
+
+	accountPorts := map[string]AccountPorts{}
+	for _, userID := range userIDs {
+		if pair, ok := assigned[userID]; ok {
+			accountPorts[userID] = pair
+			used[pair.IMAP] = true
+			used[pair.SMTP] = true
+		}
+	}
+
+	nextPort := func(port int) int {
+		for (used[port] || !isFree(port)) && port < maxAccountPort {
+			port++
+		}
+		used[port] = true
+		return port
+	}
+
+	// Users are sorted to assign the same ports regardless of the order of
+	// the accounts.
+	sort.Strings(userIDs)
+	for _, userID := range userIDs {
+		if _, ok := accountPorts[userID]; ok {
+			continue
+		}
+		imapStart = nextPort(imapStart)
+		smtpStart = nextPort(smtpStart)
+		accountPorts[userID] = AccountPorts{IMAP: imapStart, SMTP: smtpStart}
+	}
+
+	return accountPorts
+}
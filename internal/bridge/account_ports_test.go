@@ -0,0 +1,41 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignAccountPorts(t *testing.T) {
+	isFree := func(port int) bool { return port != 1145 }
+
+	assigned := map[string]AccountPorts{
+		"removed": {IMAP: 1144, SMTP: 1026},
+		"kept":    {IMAP: 1150, SMTP: 1030},
+	}
+
+	accountPorts := assignAccountPorts(assigned, []string{"new2", "kept", "new1"}, 1144, 1026, []int{1146, 1042}, isFree)
+
+	require.Equal(t, map[string]AccountPorts{
+		"kept": {IMAP: 1150, SMTP: 1030},
+		"new1": {IMAP: 1144, SMTP: 1026},
+		"new2": {IMAP: 1147, SMTP: 1027},
+	}, accountPorts)
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import "github.com/ProtonMail/proton-bridge/internal/users"
+
+// GetAddressSettings returns display names and signatures of addresses of
+// the account authenticated by the access token.
+func (b *Bridge) GetAddressSettings(account, accessToken string) ([]users.AddressSettings, error) {
+	user, err := b.getAuthorizedUser(account, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return user.GetAddressSettings(), nil
+}
+
+// SetAddressSettings changes the display name and the signature of the
+// address of the account authenticated by the access token.
+func (b *Bridge) SetAddressSettings(account, accessToken string, settings users.AddressSettings) error {
+	user, err := b.getAuthorizedUser(account, accessToken)
+	if err != nil {
+		return err
+	}
+	return user.SetAddressSettings(settings)
+}
+
+// GetAppendSignature returns whether signatures are appended to messages
+// sent by the account authenticated by the access token.
+func (b *Bridge) GetAppendSignature(account, accessToken string) (bool, error) {
+	user, err := b.getAuthorizedUser(account, accessToken)
+	if err != nil {
+		return false, err
+	}
+	return user.GetAppendSignature(), nil
+}
+
+// SetAppendSignature sets whether signatures are appended to messages sent
+// by the account authenticated by the access token.
+func (b *Bridge) SetAppendSignature(account, accessToken string, enabled bool) error {
+	user, err := b.getAuthorizedUser(account, accessToken)
+	if err != nil {
+		return err
+	}
+	return user.SetAppendSignature(enabled)
+}
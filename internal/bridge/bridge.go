@@ -19,9 +19,12 @@
 package bridge
 
 import (
+	"context"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/ProtonMail/proton-bridge/internal/importer"
 	"github.com/ProtonMail/proton-bridge/internal/metrics"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
 	"github.com/ProtonMail/proton-bridge/internal/users"
@@ -40,10 +43,14 @@ type Bridge struct {
 
 	pref          PreferenceProvider
 	clientManager users.ClientManager
+	storeFactory  *storeFactory
+	importer      *importer.Importer
 
 	userAgentClientName    string
 	userAgentClientVersion string
 	userAgentOS            string
+
+	accountPortsLock sync.Mutex
 }
 
 func New(
@@ -60,13 +67,34 @@ func New(
 		clientManager.AllowProxy()
 	}
 
-	storeFactory := newStoreFactory(config, panicHandler, clientManager, eventListener)
+	// Custom resolvers and API host are set before start as well so no
+	// request goes to the default ones on networks which block them.
+	dohProviders, err := pmapi.ParseDoHProviders(pref.Get(preferences.DoHProvidersKey))
+	if err != nil {
+		log.WithError(err).Warn("Invalid DoH providers, using default ones")
+	}
+	clientManager.SetDoHProviders(dohProviders)
+
+	apiHost, err := pmapi.ParseAPIHost(pref.Get(preferences.APIHostKey))
+	if err != nil {
+		log.WithError(err).Warn("Invalid API host, using default one")
+	}
+	clientManager.SetAPIHost(apiHost)
+
+	messageCacheSize := int64(pref.GetInt(preferences.MessageCacheSizeKey))
+	cacheLocation := cacheLocation{
+		backend: pref.Get(preferences.CacheBackendKey),
+		dir:     pref.Get(preferences.CacheDirKey),
+	}
+	storeFactory := newStoreFactory(config, panicHandler, clientManager, eventListener, messageCacheSize, cacheLocation)
 	u := users.New(config, panicHandler, eventListener, clientManager, credStorer, storeFactory, true)
 	b := &Bridge{
 		Users: u,
 
 		pref:          pref,
 		clientManager: clientManager,
+		storeFactory:  storeFactory,
+		importer:      importer.New(config, panicHandler, clientManager),
 	}
 
 	if pref.GetBool(preferences.FirstStartKey) {
@@ -75,10 +103,20 @@ func New(
 	}
 
 	go b.heartbeat()
+	go b.recordStats(config.GetVersion(), storeFactory)
 
 	return b
 }
 
+// Close stops watchers and closes stores of all users and the caches, so
+// another instance can open them. Bridge cannot be used afterwards.
+func (b *Bridge) Close() error {
+	b.StopWatchers()
+	err := b.CloseStores()
+	b.storeFactory.close()
+	return err
+}
+
 // heartbeat sends a heartbeat signal once a day.
 func (b *Bridge) heartbeat() {
 	ticker := time.NewTicker(1 * time.Minute)
@@ -125,6 +163,30 @@ func (b *Bridge) updateUserAgent() {
 	b.clientManager.SetUserAgent(b.userAgentClientName, b.userAgentClientVersion, b.userAgentOS)
 }
 
+// GetRetryMetrics returns counts of API requests retried since start,
+// e.g. because of throttling.
+func (b *Bridge) GetRetryMetrics() pmapi.RetryMetrics {
+	return b.clientManager.GetRetryMetrics()
+}
+
+// GetAPIStatus returns whether requests are sent to the API or suspended
+// because the API failed repeatedly.
+func (b *Bridge) GetAPIStatus() pmapi.APIStatus {
+	return b.clientManager.GetAPIStatus()
+}
+
+// SetDoHProviders sets DNS-over-HTTPS resolvers used by alternative routing.
+// Default resolvers are used when empty.
+func (b *Bridge) SetDoHProviders(providers []string) {
+	b.clientManager.SetDoHProviders(providers)
+}
+
+// SetAPIHost pins the API host so alternative routing never switches away
+// from it. The default host is used when empty.
+func (b *Bridge) SetAPIHost(host string) {
+	b.clientManager.SetAPIHost(host)
+}
+
 // ReportBug reports a new bug from the user.
 func (b *Bridge) ReportBug(osType, osVersion, description, accountName, address, emailClient string) error {
 	c := b.clientManager.GetAnonymousClient()
@@ -141,7 +203,7 @@ func (b *Bridge) ReportBug(osType, osVersion, description, accountName, address,
 		Email:       address,
 	}
 
-	if err := c.Report(report); err != nil {
+	if err := c.Report(context.Background(), report); err != nil {
 		log.Error("Reporting bug failed: ", err)
 		return err
 	}
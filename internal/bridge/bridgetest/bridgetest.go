@@ -0,0 +1,239 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package bridgetest boots the whole bridge against the fake API from
+// pkg/pmapi/fakeserver, so features can be covered by full-stack Go tests
+// using real IMAP and SMTP clients. Credentials are kept in memory instead
+// of the keychain and all files are in a temporary folder.
+package bridgetest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/imap"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/smtp"
+	"github.com/ProtonMail/proton-bridge/internal/users"
+	pkgconfig "github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi/fakeserver"
+	"github.com/stretchr/testify/require"
+)
+
+// syncTimeout is how long WaitForSync waits for the sync to finish.
+const syncTimeout = 30 * time.Second
+
+// Harness is a running bridge with fake API. IMAP and SMTP servers are
+// started with the first call of IMAPAddr or SMTPAddr.
+type Harness struct {
+	t testing.TB
+
+	// Controller sets up users, labels and messages on the fake API
+	// and checks which calls bridge made.
+	Controller *fakeserver.Controller
+	Bridge     *bridge.Bridge
+
+	cfg      *config
+	pref     *pkgconfig.Preferences
+	listener listener.Listener
+	accounts map[string]account
+
+	imapAddr, smtpAddr string
+
+	cleanups []func()
+}
+
+// New starts bridge with fake API. The caller closes the harness.
+func New(t testing.TB) *Harness {
+	dir, err := ioutil.TempDir("", "bridgetest")
+	require.NoError(t, err)
+
+	cfg := &config{dir: dir, imapPort: freePort(), smtpPort: freePort()}
+	_, err = pkgconfig.GenerateTLSConfig(cfg.GetTLSCertPath(), cfg.GetTLSKeyPath())
+	require.NoError(t, err)
+
+	clientManager := pmapi.NewClientManager(cfg.GetAPIConfig())
+	controller := fakeserver.NewController(clientManager)
+
+	pref := preferences.New(cfg)
+	eventListener := listener.New()
+
+	h := &Harness{
+		t:          t,
+		Controller: controller,
+		Bridge:     bridge.New(cfg, pref, &panicHandler{t: t}, eventListener, clientManager, newCredStore()),
+		cfg:        cfg,
+		pref:       pref,
+		listener:   eventListener,
+		accounts:   map[string]account{},
+	}
+	h.cleanups = append(h.cleanups, func() { _ = cfg.ClearData() })
+
+	return h
+}
+
+type account struct {
+	addressID string
+	keyRing   *crypto.KeyRing
+}
+
+// Close logs out all users, stops servers and removes all files.
+func (h *Harness) Close() {
+	for i := len(h.cleanups) - 1; i >= 0; i-- {
+		h.cleanups[i]()
+	}
+	h.cleanups = nil
+}
+
+// CreateUser adds the user with one address `<username>@pm.test` to the fake
+// API. The password is used for login and as mailbox password.
+func (h *Harness) CreateUser(username, password string) *pmapi.User {
+	user, addresses, keyRing, err := h.Controller.CreateUser(username, username+"@pm.test", password)
+	require.NoError(h.t, err)
+
+	h.accounts[username] = account{addressID: (*addresses)[0].ID, keyRing: keyRing}
+	return user
+}
+
+// Login logs the user in bridge and waits until the first sync finishes.
+func (h *Harness) Login(username, password string) *users.User {
+	client, auth, err := h.Bridge.Login(username, password)
+	require.NoError(h.t, err)
+
+	user, err := h.Bridge.FinishLogin(client, auth, password)
+	require.NoError(h.t, err)
+	h.cleanups = append(h.cleanups, func() { _ = user.Logout() })
+
+	h.WaitForSync(username)
+	return user
+}
+
+// AddMessage adds the plain text message to labels of the user on the fake
+// API. The body is encrypted by the address key like the API does.
+// It returns the ID of the message.
+func (h *Harness) AddMessage(username string, message *pmapi.Message, body string, labelIDs ...string) string {
+	account, ok := h.accounts[username]
+	require.True(h.t, ok, "user %s was not created by harness", username)
+
+	encrypted, err := account.keyRing.Encrypt(crypto.NewPlainMessageFromString(body), account.keyRing)
+	require.NoError(h.t, err)
+	armored, err := encrypted.GetArmored()
+	require.NoError(h.t, err)
+
+	if message.Header == nil {
+		message.Header = mail.Header{}
+	}
+	if message.MIMEType == "" {
+		message.MIMEType = "text/plain"
+	}
+	if message.Time == 0 {
+		message.Time = time.Now().Unix()
+	}
+	message.AddressID = account.addressID
+	message.Body = armored
+	message.LabelIDs = append(message.LabelIDs, labelIDs...)
+
+	require.NoError(h.t, h.Controller.AddUserMessage(username, message))
+	return message.ID
+}
+
+// WaitForSync waits until the store of the user is synced with the API.
+func (h *Harness) WaitForSync(username string) {
+	user, err := h.Bridge.GetUser(username)
+	require.NoError(h.t, err)
+
+	store := user.GetStore()
+	require.NotNil(h.t, store)
+
+	require.Eventually(h.t, func() bool { return !store.TestIsSyncRunning() }, syncTimeout, 10*time.Millisecond)
+	store.TestSync()
+	require.Eventually(h.t, func() bool { return !store.TestIsSyncRunning() }, syncTimeout, 10*time.Millisecond)
+}
+
+// IMAPAddr starts the IMAP server if it is not running yet
+// and returns its address.
+func (h *Harness) IMAPAddr() string {
+	if h.imapAddr != "" {
+		return h.imapAddr
+	}
+
+	tls, err := pkgconfig.GetTLSConfig(h.cfg)
+	require.NoError(h.t, err)
+
+	port := h.pref.GetInt(preferences.IMAPPortKey)
+	backend := imap.NewIMAPBackend(&panicHandler{t: h.t}, h.listener, h.cfg, h.Bridge)
+	server := imap.NewIMAPServer(false, false, port, tls, preferences.GetAuthPolicy(h.pref), backend, h.listener)
+
+	go server.ListenAndServe()
+	h.cleanups = append(h.cleanups, server.Close)
+
+	h.imapAddr = waitForPort(h.t, port)
+	return h.imapAddr
+}
+
+// SMTPAddr starts the SMTP server if it is not running yet
+// and returns its address. The server uses STARTTLS.
+func (h *Harness) SMTPAddr() string {
+	if h.smtpAddr != "" {
+		return h.smtpAddr
+	}
+
+	tls, err := pkgconfig.GetTLSConfig(h.cfg)
+	require.NoError(h.t, err)
+
+	port := h.pref.GetInt(preferences.SMTPPortKey)
+	backend := smtp.NewSMTPBackend(&panicHandler{t: h.t}, h.listener, h.pref, h.Bridge)
+	server := smtp.NewSMTPServer(false, port, false, tls, preferences.GetAuthPolicy(h.pref), backend, h.listener)
+
+	go server.ListenAndServe()
+	h.cleanups = append(h.cleanups, server.Close)
+
+	h.smtpAddr = waitForPort(h.t, port)
+	return h.smtpAddr
+}
+
+func waitForPort(t testing.TB, port int) string {
+	addr := net.JoinHostPort(bridge.Host, strconv.Itoa(port))
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond, fmt.Sprintf("server on %s did not start", addr))
+	return addr
+}
+
+type panicHandler struct {
+	t testing.TB
+}
+
+func (ph *panicHandler) HandlePanic() {
+	if r := recover(); r != nil {
+		ph.t.Errorf("panic: %v", r)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridgetest
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/emersion/go-imap"
+	imapClient "github.com/emersion/go-imap/client"
+	r "github.com/stretchr/testify/require"
+)
+
+const (
+	testUsername = "user"
+	testPassword = "password"
+)
+
+func TestSync(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	h.CreateUser(testUsername, testPassword)
+	for _, subject := range []string{"first", "second", "third"} {
+		h.AddMessage(testUsername, &pmapi.Message{Subject: subject}, "Hello", pmapi.InboxLabel)
+	}
+	h.AddMessage(testUsername, &pmapi.Message{Subject: "archived"}, "Hello", pmapi.ArchiveLabel)
+
+	user := h.Login(testUsername, testPassword)
+
+	address, err := user.GetStore().GetAddress(h.accounts[testUsername].addressID)
+	r.NoError(t, err)
+
+	inbox, err := address.GetMailbox("INBOX")
+	r.NoError(t, err)
+	total, _, _, err := inbox.GetCounts()
+	r.NoError(t, err)
+	r.Equal(t, uint(3), total)
+
+	archive, err := address.GetMailbox("Archive")
+	r.NoError(t, err)
+	total, _, _, err = archive.GetCounts()
+	r.NoError(t, err)
+	r.Equal(t, uint(1), total)
+}
+
+func TestIMAPFetch(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	h.CreateUser(testUsername, testPassword)
+	h.AddMessage(testUsername, &pmapi.Message{
+		Subject: "Hello",
+		Sender:  &mail.Address{Name: "Sender", Address: "sender@pm.test"},
+		ToList:  []*mail.Address{{Address: testUsername + "@pm.test"}},
+	}, "Hello from the fake server", pmapi.InboxLabel)
+	h.Login(testUsername, testPassword)
+
+	client, err := imapClient.Dial(h.IMAPAddr())
+	r.NoError(t, err)
+	defer client.Logout() //nolint[errcheck]
+
+	r.NoError(t, client.Login(testUsername+"@pm.test", BridgePassword))
+
+	status, err := client.Select("INBOX", true)
+	r.NoError(t, err)
+	r.Equal(t, uint32(1), status.Messages)
+
+	section := &imap.BodySectionName{}
+	messages := make(chan *imap.Message, 1)
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(1)
+	r.NoError(t, client.Fetch(seqSet, []imap.FetchItem{imap.FetchEnvelope, section.FetchItem()}, messages))
+
+	msg := <-messages
+	r.NotNil(t, msg)
+	r.Equal(t, "Hello", msg.Envelope.Subject)
+	r.Equal(t, "sender@pm.test", msg.Envelope.From[0].Address())
+
+	body, err := ioutil.ReadAll(msg.GetBody(section))
+	r.NoError(t, err)
+	r.Contains(t, string(body), "Hello from the fake server")
+}
+
+func TestSMTPSend(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	h.CreateUser(testUsername, testPassword)
+	h.Login(testUsername, testPassword)
+
+	client, err := smtp.Dial(h.SMTPAddr())
+	r.NoError(t, err)
+	defer client.Close() //nolint[errcheck]
+
+	r.NoError(t, client.StartTLS(&tls.Config{InsecureSkipVerify: true})) //nolint[gosec]
+	r.NoError(t, client.Auth(smtp.PlainAuth("", testUsername+"@pm.test", BridgePassword, "127.0.0.1")))
+	r.NoError(t, client.Mail(testUsername+"@pm.test"))
+	r.NoError(t, client.Rcpt("recipient@pm.test"))
+
+	w, err := client.Data()
+	r.NoError(t, err)
+	_, err = w.Write([]byte(strings.Join([]string{
+		"From: " + testUsername + "@pm.test",
+		"To: recipient@pm.test",
+		"Subject: Sent by SMTP",
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"",
+		"Hello",
+		"",
+	}, "\r\n")))
+	r.NoError(t, err)
+	r.NoError(t, w.Close())
+	r.NoError(t, client.Quit())
+
+	sent, err := h.Controller.GetMessages(testUsername, pmapi.SentLabel)
+	r.NoError(t, err)
+	r.Len(t, sent, 1)
+	r.Equal(t, "Sent by SMTP", sent[0].Subject)
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridgetest
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/users/credentials"
+	"github.com/ProtonMail/proton-bridge/pkg/constants"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// BridgePassword is the password for IMAP and SMTP of all users.
+const BridgePassword = "bridgepassword"
+
+// config keeps all files of bridge in a temporary folder.
+type config struct {
+	dir string
+
+	imapPort, smtpPort int
+}
+
+func (c *config) ClearData() error {
+	return os.RemoveAll(c.dir)
+}
+func (c *config) GetAPIConfig() *pmapi.ClientConfig {
+	return &pmapi.ClientConfig{
+		AppVersion: "Bridge_" + constants.Version,
+		ClientID:   "bridge",
+	}
+}
+func (c *config) GetVersion() string             { return constants.Version }
+func (c *config) GetDBDir() string               { return c.dir }
+func (c *config) GetLogDir() string              { return c.dir }
+func (c *config) GetTransferDir() string         { return c.dir }
+func (c *config) GetIMAPCachePath() string       { return filepath.Join(c.dir, "user_info.json") }
+func (c *config) GetEventsPath() string          { return filepath.Join(c.dir, "events.json") }
+func (c *config) GetPreferencesPath() string     { return filepath.Join(c.dir, "prefs.json") }
+func (c *config) GetTLSCertPath() string         { return filepath.Join(c.dir, "cert.pem") }
+func (c *config) GetTLSKeyPath() string          { return filepath.Join(c.dir, "key.pem") }
+func (c *config) GetMessageCacheDir() string     { return filepath.Join(c.dir, "messages") }
+func (c *config) GetMessageCacheKeyPath() string { return filepath.Join(c.dir, "message_cache.key") }
+func (c *config) GetAttachmentCacheDir() string  { return filepath.Join(c.dir, "attachments") }
+func (c *config) GetSearchIndexDir() string      { return filepath.Join(c.dir, "search") }
+func (c *config) GetDefaultAPIPort() int         { return freePort() }
+func (c *config) GetDefaultIMAPPort() int        { return c.imapPort }
+func (c *config) GetDefaultSMTPPort() int        { return c.smtpPort }
+func (c *config) GetDefaultCalDAVPort() int      { return freePort() }
+func (c *config) GetDefaultLDAPPort() int        { return freePort() }
+func (c *config) GetLogPrefix() string           { return "test" }
+
+// freePort returns a port which is not used at the moment.
+func freePort() int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer l.Close() //nolint[errcheck]
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+var errNoCredentials = errors.New("no credentials for user") //nolint[gochecknoglobals]
+
+// credStore keeps credentials in memory instead of the keychain.
+type credStore struct {
+	lock        sync.Mutex
+	credentials map[string]*credentials.Credentials
+}
+
+func newCredStore() *credStore {
+	return &credStore{credentials: map[string]*credentials.Credentials{}}
+}
+
+func (c *credStore) List() (userIDs []string, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for userID := range c.credentials {
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
+}
+
+func (c *credStore) Add(userID, userName, apiToken, mailboxPassword string, emails []string) (*credentials.Credentials, error) {
+	c.lock.Lock()
+	c.credentials[userID] = &credentials.Credentials{
+		UserID:                userID,
+		Name:                  userName,
+		Emails:                strings.Join(emails, ";"),
+		APIToken:              apiToken,
+		MailboxPassword:       mailboxPassword,
+		BridgePassword:        BridgePassword,
+		IsCombinedAddressMode: true,
+	}
+	c.lock.Unlock()
+
+	return c.Get(userID)
+}
+
+func (c *credStore) Get(userID string) (*credentials.Credentials, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	creds, ok := c.credentials[userID]
+	if !ok {
+		return nil, errNoCredentials
+	}
+	copied := *creds
+	return &copied, nil
+}
+
+func (c *credStore) update(userID string, update func(*credentials.Credentials)) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	creds, ok := c.credentials[userID]
+	if !ok {
+		return errNoCredentials
+	}
+	update(creds)
+	return nil
+}
+
+func (c *credStore) SwitchAddressMode(userID string) error {
+	return c.update(userID, func(creds *credentials.Credentials) {
+		creds.IsCombinedAddressMode = !creds.IsCombinedAddressMode
+	})
+}
+
+func (c *credStore) UpdateEmails(userID string, emails []string) error {
+	return c.update(userID, func(creds *credentials.Credentials) {
+		creds.Emails = strings.Join(emails, ";")
+	})
+}
+
+func (c *credStore) UpdatePassword(userID, password string) error {
+	return c.update(userID, func(creds *credentials.Credentials) {
+		creds.MailboxPassword = password
+	})
+}
+
+func (c *credStore) UpdateToken(userID, apiToken string) error {
+	return c.update(userID, func(creds *credentials.Credentials) {
+		creds.APIToken = apiToken
+	})
+}
+
+// GetCacheKey returns the same key for the user on every call, as the real
+// store does.
+func (c *credStore) GetCacheKey(userID string) ([]byte, error) {
+	if _, err := c.Get(userID); err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256([]byte(userID))
+	return key[:], nil
+}
+
+func (c *credStore) RotateRefreshTokenNonce(userID string) (*credentials.Credentials, error) {
+	if err := c.update(userID, func(creds *credentials.Credentials) {
+		creds.RefreshTokenNonce = strconv.FormatInt(time.Now().UnixNano(), 16)
+	}); err != nil {
+		return nil, err
+	}
+	return c.Get(userID)
+}
+
+func (c *credStore) Logout(userID string) error {
+	return c.update(userID, func(creds *credentials.Credentials) {
+		creds.Logout()
+	})
+}
+
+func (c *credStore) Delete(userID string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.credentials, userID)
+	return nil
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// ApplyBulkAction applies the action to messages matching the query of the
+// account authenticated by the access token.
+func (b *Bridge) ApplyBulkAction(account, accessToken string, query store.BulkQuery, action store.BulkAction, dryRun bool) ([]*pmapi.Message, error) {
+	user, err := b.getAuthorizedUser(account, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return user.ApplyBulkAction(query, action, dryRun)
+}
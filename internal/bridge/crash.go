@@ -0,0 +1,292 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/diagnostics"
+	"github.com/ProtonMail/proton-bridge/pkg/sentry"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxCrashLogLines is how many recent log lines are kept for crash reports.
+	maxCrashLogLines = 100
+
+	// maxCrashReports is how many crash reports are kept; the oldest are removed.
+	maxCrashReports = 10
+
+	crashReportPrefix = "crash_"
+)
+
+var (
+	crashReportDir     string       //nolint[gochecknoglobals]
+	crashReportDirLock sync.RWMutex //nolint[gochecknoglobals]
+
+	crashLog = &crashLogHook{} //nolint[gochecknoglobals]
+)
+
+// CrashReport is a crash saved locally until the user decides to send it
+// or discard it. It contains no email addresses or subjects.
+type CrashReport struct {
+	ID        string `json:"-"`
+	Created   time.Time
+	AppName   string
+	Version   string
+	OS        string
+	Arch      string
+	GoVersion string
+	Error     string
+	Stack     string
+	Log       []string
+}
+
+// SetCrashReportDir sets the folder where crash reports are saved.
+// Empty dir disables saving.
+func SetCrashReportDir(dir string) {
+	crashReportDirLock.Lock()
+	defer crashReportDirLock.Unlock()
+
+	crashReportDir = dir
+}
+
+func getCrashReportDir() string {
+	crashReportDirLock.RLock()
+	defer crashReportDirLock.RUnlock()
+
+	return crashReportDir
+}
+
+// CrashLogHook returns the log hook which keeps recent redacted log lines
+// to be included in crash reports.
+func CrashLogHook() logrus.Hook {
+	return crashLog
+}
+
+type crashLogHook struct {
+	lock  sync.Mutex
+	lines []string
+}
+
+func (h *crashLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *crashLogHook) Fire(entry *logrus.Entry) error {
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	line := &strings.Builder{}
+	fmt.Fprintf(line, "%s %s %s", entry.Time.Format(time.RFC3339), entry.Level, entry.Message)
+	for _, key := range keys {
+		fmt.Fprintf(line, " %s=%v", key, entry.Data[key])
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.lines = append(h.lines, diagnostics.Redact(line.String()))
+	if len(h.lines) > maxCrashLogLines {
+		h.lines = h.lines[len(h.lines)-maxCrashLogLines:]
+	}
+
+	return nil
+}
+
+func (h *crashLogHook) recent() []string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return append([]string{}, h.lines...)
+}
+
+// NewCrashReport captures stacks of all goroutines, recent log lines and
+// platform info. It has to be called from the crashed goroutine, e.g. in
+// defer with recover, so its stack is the first one.
+func NewCrashReport(appName, version string, reason interface{}) *CrashReport {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	return &CrashReport{
+		Created:   time.Now(),
+		AppName:   appName,
+		Version:   version,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		Error:     diagnostics.Redact(fmt.Sprint(reason)),
+		Stack:     string(buf),
+		Log:       crashLog.recent(),
+	}
+}
+
+// SaveCrashReport stores the report locally. Nothing is sent until the user
+// agrees in the frontend.
+func SaveCrashReport(report *CrashReport) (path string, err error) {
+	dir := getCrashReportDir()
+	if dir == "" {
+		return "", errors.New("no folder for crash reports")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	report.ID = fmt.Sprintf("%s%d", crashReportPrefix, report.Created.UnixNano())
+	path = filepath.Join(dir, report.ID+".json")
+
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return "", err
+	}
+
+	return path, pruneCrashReports(dir)
+}
+
+// NewCrashReportSaver returns function saving crash reports of recovered
+// panics for packages which cannot import bridge. It has to be called from
+// the crashed goroutine like NewCrashReport.
+func NewCrashReportSaver(appName, version string) func(reason interface{}) {
+	return func(reason interface{}) {
+		report := NewCrashReport(appName, version, reason)
+		if path, err := SaveCrashReport(report); err != nil {
+			log.WithError(err).Error("Cannot save crash report")
+		} else {
+			log.Warn("Crash report saved to ", path)
+		}
+	}
+}
+
+func pruneCrashReports(dir string) error {
+	reports, err := ListCrashReports()
+	if err != nil {
+		return err
+	}
+
+	if len(reports) <= maxCrashReports {
+		return nil
+	}
+
+	for _, report := range reports[:len(reports)-maxCrashReports] {
+		if err := os.Remove(filepath.Join(dir, report.ID+".json")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListCrashReports returns saved crash reports which were not sent or
+// discarded yet, the oldest first.
+func ListCrashReports() (reports []*CrashReport, err error) {
+	dir := getCrashReportDir()
+	if dir == "" {
+		return nil, nil
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, crashReportPrefix) || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Clean(filepath.Join(dir, name)))
+		if err != nil {
+			return nil, err
+		}
+
+		report := &CrashReport{}
+		if err := json.Unmarshal(b, report); err != nil {
+			log.WithError(err).WithField("file", name).Warn("Cannot read crash report")
+			continue
+		}
+		report.ID = strings.TrimSuffix(name, ".json")
+
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Created.Before(reports[j].Created)
+	})
+
+	return reports, nil
+}
+
+// DiscardCrashReport removes the saved crash report.
+func DiscardCrashReport(report *CrashReport) error {
+	dir := getCrashReportDir()
+	if dir == "" || report.ID == "" {
+		return nil
+	}
+
+	if err := os.Remove(filepath.Join(dir, report.ID+".json")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// SubmitCrashReport sends the saved crash report to Sentry and removes it.
+// It must be called only after the user agreed to send it.
+func SubmitCrashReport(report *CrashReport, clientID, appVersion, userAgent string) error {
+	extra := map[string]interface{}{
+		"AppName":   report.AppName,
+		"Created":   report.Created.Format(time.RFC3339),
+		"Arch":      report.Arch,
+		"GoVersion": report.GoVersion,
+		"Log":       strings.Join(report.Log, "\n"),
+	}
+
+	if err := sentry.ReportSavedCrash(clientID, appVersion, userAgent, errors.New(report.Error), report.Stack, extra); err != nil {
+		return errors.Wrap(err, "failed to send crash report")
+	}
+
+	return DiscardCrashReport(report)
+}
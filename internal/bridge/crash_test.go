@@ -0,0 +1,101 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrashLogHookKeepsRecentRedactedLines(t *testing.T) {
+	hook := &crashLogHook{}
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	logger.AddHook(hook)
+
+	for i := 0; i < maxCrashLogLines+5; i++ {
+		logger.WithField("n", i).Info("Message from user@pm.me")
+	}
+
+	lines := hook.recent()
+	require.Len(t, lines, maxCrashLogLines)
+	require.Contains(t, lines[len(lines)-1], "n="+strconv.Itoa(maxCrashLogLines+4))
+	for _, line := range lines {
+		require.NotContains(t, line, "user@pm.me")
+	}
+}
+
+func TestSaveCrashReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crash")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	SetCrashReportDir(dir)
+	defer SetCrashReportDir("")
+
+	var report *CrashReport
+	func() {
+		defer func() {
+			report = NewCrashReport("Bridge", "1.2.3", recover())
+		}()
+		panic("failed for user@pm.me")
+	}()
+
+	require.NotContains(t, report.Error, "user@pm.me")
+	require.Contains(t, report.Stack, "crash_test.go")
+
+	_, err = SaveCrashReport(report)
+	require.NoError(t, err)
+
+	reports, err := ListCrashReports()
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	require.Equal(t, "1.2.3", reports[0].Version)
+	require.Equal(t, report.Error, reports[0].Error)
+
+	require.NoError(t, DiscardCrashReport(reports[0]))
+	reports, err = ListCrashReports()
+	require.NoError(t, err)
+	require.Empty(t, reports)
+}
+
+func TestSaveCrashReportPrunesOldest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crash")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	SetCrashReportDir(dir)
+	defer SetCrashReportDir("")
+
+	created := time.Now()
+	for i := 0; i < maxCrashReports+2; i++ {
+		_, err := SaveCrashReport(&CrashReport{Created: created.Add(time.Duration(i) * time.Second), Error: strconv.Itoa(i)})
+		require.NoError(t, err)
+	}
+
+	reports, err := ListCrashReports()
+	require.NoError(t, err)
+	require.Len(t, reports, maxCrashReports)
+	require.Equal(t, "2", reports[0].Error)
+}
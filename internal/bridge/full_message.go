@@ -0,0 +1,30 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import "io"
+
+// BuildFullMessage returns the complete message of the account authenticated
+// by the access token, including messages IMAP serves only as a preview.
+func (b *Bridge) BuildFullMessage(account, accessToken, messageID string) (io.ReadCloser, error) {
+	user, err := b.getAuthorizedUser(account, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return user.BuildFullMessage(messageID)
+}
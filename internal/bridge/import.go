@@ -0,0 +1,80 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"os"
+
+	"github.com/ProtonMail/proton-bridge/internal/importer"
+	"github.com/ProtonMail/proton-bridge/internal/migration"
+)
+
+// ImportMessages imports local EML and MBOX files from path to the account
+// of the address. Messages are encrypted with keys of the address, or of all
+// addresses if the address is not found. The folderMapping maps local folder
+// names to ProtonMail folder names.
+func (b *Bridge) ImportMessages(address, path string, folderMapping map[string]string, progress importer.ProgressFunc) (imported, failed uint, err error) {
+	options, err := b.importOptions(address, folderMapping)
+	if err != nil {
+		return 0, 0, err
+	}
+	options.Path = path
+
+	return b.importer.Import(options, progress)
+}
+
+// MigrationStores returns local stores of other email clients found
+// in the home folder of the user.
+func (b *Bridge) MigrationStores() []migration.Store {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.WithError(err).Warn("Cannot find home folder")
+		return nil
+	}
+	return migration.Discover(home)
+}
+
+// MigrateMessages imports messages from the local store of other email
+// client to the account of the address like ImportMessages. Messages with
+// Message-ID already in the account are skipped.
+func (b *Bridge) MigrateMessages(address string, store migration.Store, folderMapping map[string]string, progress importer.ProgressFunc) (imported, failed uint, err error) {
+	options, err := b.importOptions(address, folderMapping)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return b.importer.Migrate(store, options, progress)
+}
+
+func (b *Bridge) importOptions(address string, folderMapping map[string]string) (importer.Options, error) {
+	user, err := b.Users.GetUser(address)
+	if err != nil {
+		return importer.Options{}, err
+	}
+
+	addressID, err := user.GetAddressID(address)
+	if err != nil {
+		log.WithError(err).Info("Address does not exist, using all addresses")
+	}
+
+	return importer.Options{
+		UserID:        user.ID(),
+		AddressID:     addressID,
+		FolderMapping: folderMapping,
+	}, nil
+}
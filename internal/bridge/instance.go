@@ -0,0 +1,283 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allan-simon/go-singleinstance"
+	"github.com/pkg/errors"
+)
+
+// Requests sent by other instances to the running one.
+const (
+	instanceFocus    = "focus"
+	instanceRun      = "run"
+	instanceTakeover = "takeover"
+)
+
+// instanceDialTimeout is how long a new instance waits for the running one.
+// Forwarded commands, e.g. login, can take much longer to finish.
+const instanceDialTimeout = 3 * time.Second
+
+var (
+	// ErrAlreadyRunning is returned when other instance holds the lock.
+	ErrAlreadyRunning = errors.New("bridge is already running")
+
+	// ErrInstanceUnreachable is returned when the running instance does not
+	// accept requests, e.g. it is an older version or it is still starting.
+	ErrInstanceUnreachable = errors.New("running instance is unreachable")
+)
+
+type instanceRequest struct {
+	Type  string            `json:"type"`
+	Args  []string          `json:"args,omitempty"`
+	Env   map[string]string `json:"env,omitempty"`
+	Input string            `json:"input,omitempty"`
+}
+
+type instanceResponse struct {
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// InstanceHandler handles requests of instances started while bridge is
+// already running.
+type InstanceHandler interface {
+	// Focus shows the window of the running instance.
+	Focus()
+	// RunCommand runs the account command given on the command line of the
+	// new instance. Env contains secrets from the environment of the new
+	// instance which would otherwise be read from in.
+	RunCommand(args []string, env map[string]string, in io.Reader, out io.Writer) error
+	// Takeover stops the running instance, so the new one can start. It is
+	// called before the lock is released and the other instance answered,
+	// therefore it must release everything the new one opens but must not
+	// exit.
+	Takeover()
+}
+
+// Instance holds the lock which ensures only one bridge runs at a time and
+// accepts requests of other instances on the unix socket.
+type Instance struct {
+	socketPath string
+
+	lock   sync.Mutex
+	file   *os.File
+	ln     net.Listener
+	closed bool
+}
+
+// AcquireInstance locks the file at lockPath. ErrAlreadyRunning is returned
+// when other instance holds the lock.
+func AcquireInstance(lockPath, socketPath string) (*Instance, error) {
+	file, err := singleinstance.CreateLockFile(lockPath)
+	if err != nil {
+		return nil, ErrAlreadyRunning
+	}
+	return &Instance{socketPath: socketPath, file: file}, nil
+}
+
+// ListenAndServe accepts requests of other instances until the instance
+// is closed.
+func (i *Instance) ListenAndServe(handler InstanceHandler) error {
+	// Forwarded commands print secrets, so the socket must not be reachable
+	// by others before its mode is changed.
+	dir := filepath.Dir(i.socketPath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return err
+	}
+
+	// Only the lock holder listens, so an existing socket is a leftover.
+	if err := os.Remove(i.socketPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	ln, err := net.Listen("unix", i.socketPath)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(i.socketPath, 0600); err != nil {
+		_ = ln.Close()
+		return err
+	}
+
+	i.lock.Lock()
+	if i.closed {
+		i.lock.Unlock()
+		return ln.Close()
+	}
+	i.ln = ln
+	i.lock.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if i.isClosed() {
+				return nil
+			}
+			return err
+		}
+		if takeover := i.serve(conn, handler); takeover {
+			return nil
+		}
+	}
+}
+
+// serve handles one request and returns whether the other instance takes
+// over. Requests are served one by one, so commands do not interleave.
+func (i *Instance) serve(conn net.Conn, handler InstanceHandler) (takeover bool) {
+	defer conn.Close() //nolint[errcheck]
+
+	var req instanceRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		log.WithError(err).Warn("Invalid request from other instance")
+		return false
+	}
+
+	log.WithField("request", req.Type).Info("Request from other instance")
+
+	var res instanceResponse
+	switch req.Type {
+	case instanceFocus:
+		handler.Focus()
+	case instanceRun:
+		out := &strings.Builder{}
+		if err := handler.RunCommand(req.Args, req.Env, strings.NewReader(req.Input), out); err != nil {
+			res.Error = err.Error()
+		}
+		res.Output = out.String()
+	case instanceTakeover:
+		// Lock is released last, once nothing is used by this instance.
+		log.Info("Other instance takes over")
+		handler.Takeover()
+		if err := i.Close(); err != nil {
+			log.WithError(err).Warn("Cannot release instance lock")
+		}
+		takeover = true
+	default:
+		res.Error = "unknown request " + req.Type
+	}
+
+	if err := json.NewEncoder(conn).Encode(res); err != nil {
+		log.WithError(err).Warn("Cannot respond to other instance")
+	}
+	return takeover
+}
+
+// Close stops accepting requests and releases the lock.
+func (i *Instance) Close() error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.closed {
+		return nil
+	}
+	i.closed = true
+
+	if i.ln != nil {
+		_ = i.ln.Close()
+	}
+	return i.file.Close()
+}
+
+func (i *Instance) isClosed() bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	return i.closed
+}
+
+// InstanceClient sends requests of a new instance to the running one.
+type InstanceClient struct {
+	lockPath   string
+	socketPath string
+}
+
+// NewInstanceClient returns client of the instance holding the lock at
+// lockPath and listening at socketPath.
+func NewInstanceClient(lockPath, socketPath string) *InstanceClient {
+	return &InstanceClient{lockPath: lockPath, socketPath: socketPath}
+}
+
+// Focus asks the running instance to show its window.
+func (c *InstanceClient) Focus() error {
+	_, err := c.request(instanceRequest{Type: instanceFocus})
+	return err
+}
+
+// RunCommand runs the account command in the running instance and writes
+// its output to out. Errors of the command are returned as they are,
+// failures to reach the instance wrap ErrInstanceUnreachable.
+func (c *InstanceClient) RunCommand(args []string, env map[string]string, input string, out io.Writer) error {
+	res, err := c.request(instanceRequest{Type: instanceRun, Args: args, Env: env, Input: input})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(out, res.Output); err != nil {
+		return err
+	}
+	if res.Error != "" {
+		return errors.New(res.Error)
+	}
+	return nil
+}
+
+// Takeover asks the running instance to stop and returns the instance
+// acquired once the lock is released. It fails when the lock is not released
+// within timeout.
+func (c *InstanceClient) Takeover(timeout time.Duration) (*Instance, error) {
+	if _, err := c.request(instanceRequest{Type: instanceTakeover}); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		instance, err := AcquireInstance(c.lockPath, c.socketPath)
+		if err == nil || time.Now().After(deadline) {
+			return instance, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (c *InstanceClient) request(req instanceRequest) (res instanceResponse, err error) {
+	conn, err := net.DialTimeout("unix", c.socketPath, instanceDialTimeout)
+	if err != nil {
+		return res, errors.Wrap(ErrInstanceUnreachable, err.Error())
+	}
+	defer conn.Close() //nolint[errcheck]
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return res, errors.Wrap(ErrInstanceUnreachable, err.Error())
+	}
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		return res, errors.Wrap(ErrInstanceUnreachable, err.Error())
+	}
+	return res, nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type testInstanceHandler struct {
+	focused  chan struct{}
+	takeover chan struct{}
+
+	lockPath, socketPath string
+	lockedOnTakeover     bool
+}
+
+func (h *testInstanceHandler) Focus() {
+	h.focused <- struct{}{}
+}
+
+func (h *testInstanceHandler) RunCommand(args []string, env map[string]string, in io.Reader, out io.Writer) error {
+	input, _ := ioutil.ReadAll(in)
+	fmt.Fprintf(out, "%s %s %s", strings.Join(args, " "), env["BRIDGE_PASSWORD"], input)
+	if args[0] == "fail" {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+func (h *testInstanceHandler) Takeover() {
+	_, err := AcquireInstance(h.lockPath, h.socketPath)
+	h.lockedOnTakeover = err == ErrAlreadyRunning
+	close(h.takeover)
+}
+
+func newTestInstance(t *testing.T, dir string) (instance *Instance, client *InstanceClient, handler *testInstanceHandler, done chan error) {
+	lockPath, socketPath := filepath.Join(dir, "bridge.lock"), filepath.Join(dir, "instance", "instance.sock")
+
+	instance, err := AcquireInstance(lockPath, socketPath)
+	require.NoError(t, err)
+
+	_, err = AcquireInstance(lockPath, socketPath)
+	require.Equal(t, ErrAlreadyRunning, err)
+
+	handler = &testInstanceHandler{
+		focused:    make(chan struct{}, 1),
+		takeover:   make(chan struct{}),
+		lockPath:   lockPath,
+		socketPath: socketPath,
+	}
+	done = make(chan error, 1)
+	go func() { done <- instance.ListenAndServe(handler) }()
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(socketPath)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	dirInfo, err := os.Stat(filepath.Dir(socketPath))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), dirInfo.Mode().Perm())
+
+	return instance, NewInstanceClient(lockPath, socketPath), handler, done
+}
+
+func TestInstanceFocusAndRunCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "instance")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	instance, client, handler, done := newTestInstance(t, dir)
+
+	require.NoError(t, client.Focus())
+	<-handler.focused
+
+	out := &strings.Builder{}
+	require.NoError(t, client.RunCommand([]string{"list"}, map[string]string{"BRIDGE_PASSWORD": "secret"}, "input", out))
+	require.Equal(t, "list secret input", out.String())
+
+	out.Reset()
+	require.EqualError(t, client.RunCommand([]string{"fail"}, nil, "", out), "command failed")
+	require.Equal(t, "fail  ", out.String())
+
+	require.NoError(t, instance.Close())
+	require.NoError(t, <-done)
+
+	err = client.Focus()
+	require.Equal(t, ErrInstanceUnreachable, pkgerrors.Cause(err))
+}
+
+func TestInstanceTakeover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "instance")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	_, client, handler, done := newTestInstance(t, dir)
+
+	newInstance, err := client.Takeover(5 * time.Second)
+	require.NoError(t, err)
+	defer newInstance.Close() //nolint[errcheck]
+
+	<-handler.takeover
+	require.NoError(t, <-done)
+	require.True(t, handler.lockedOnTakeover, "lock must be released after takeover handler")
+}
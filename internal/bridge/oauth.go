@@ -0,0 +1,90 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/users/credentials"
+)
+
+// ErrInvalidGrant is returned when the credentials or the refresh token
+// don't belong to any logged in account.
+var ErrInvalidGrant = errors.New("invalid credentials or refresh token") //nolint[gochecknoglobals]
+
+// OAuthTokens are tokens issued to OAuth clients. The access token is used
+// by XOAUTH2 or OAUTHBEARER authentication of IMAP and SMTP.
+type OAuthTokens struct {
+	AccessToken  string
+	RefreshToken string
+	Expires      time.Time
+}
+
+// IssueOAuthTokens returns tokens for the account when the username and
+// the bridge password are correct.
+func (b *Bridge) IssueOAuthTokens(username, password string) (OAuthTokens, error) {
+	user, err := b.GetUser(username)
+	if err != nil {
+		return OAuthTokens{}, ErrInvalidGrant
+	}
+
+	if err := user.CheckBridgeLogin(password); err != nil {
+		log.WithError(err).Warn("Cannot issue OAuth tokens")
+		return OAuthTokens{}, ErrInvalidGrant
+	}
+
+	refreshToken, err := user.GenerateRefreshToken()
+	if err != nil {
+		return OAuthTokens{}, err
+	}
+
+	accessToken, expires := user.GenerateAccessToken()
+	return OAuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Expires:      expires,
+	}, nil
+}
+
+// RefreshOAuthTokens returns new tokens for the account to which the
+// refresh token was issued. The used refresh token is revoked.
+func (b *Bridge) RefreshOAuthTokens(refreshToken string) (OAuthTokens, error) {
+	userID, err := credentials.GetRefreshTokenUserID(refreshToken)
+	if err != nil {
+		return OAuthTokens{}, ErrInvalidGrant
+	}
+
+	user, err := b.GetUser(userID)
+	if err != nil || user.ID() != userID {
+		return OAuthTokens{}, ErrInvalidGrant
+	}
+
+	newRefreshToken, err := user.RefreshToken(refreshToken)
+	if err != nil {
+		log.WithError(err).Warn("Cannot refresh OAuth tokens")
+		return OAuthTokens{}, ErrInvalidGrant
+	}
+
+	accessToken, expires := user.GenerateAccessToken()
+	return OAuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		Expires:      expires,
+	}, nil
+}
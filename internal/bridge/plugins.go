@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"errors"
+
+	"github.com/ProtonMail/proton-bridge/internal/users"
+)
+
+// ErrInvalidAccessToken is returned when the access token does not belong
+// to the account.
+var ErrInvalidAccessToken = errors.New("invalid account or access token") //nolint[gochecknoglobals]
+
+// GetPluginValue returns the value stored by the plugin for the account
+// authenticated by the access token.
+func (b *Bridge) GetPluginValue(account, accessToken, plugin, key string) ([]byte, error) {
+	user, err := b.getAuthorizedUser(account, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return user.GetPluginValue(plugin, key)
+}
+
+// SetPluginValue stores the value of the plugin for the account
+// authenticated by the access token.
+func (b *Bridge) SetPluginValue(account, accessToken, plugin, key string, value []byte) error {
+	user, err := b.getAuthorizedUser(account, accessToken)
+	if err != nil {
+		return err
+	}
+	return user.SetPluginValue(plugin, key, value)
+}
+
+// DeletePluginValue removes the value stored by the plugin for the account
+// authenticated by the access token.
+func (b *Bridge) DeletePluginValue(account, accessToken, plugin, key string) error {
+	user, err := b.getAuthorizedUser(account, accessToken)
+	if err != nil {
+		return err
+	}
+	return user.DeletePluginValue(plugin, key)
+}
+
+// GetPluginKeys returns keys stored by the plugin for the account
+// authenticated by the access token.
+func (b *Bridge) GetPluginKeys(account, accessToken, plugin string) ([]string, error) {
+	user, err := b.getAuthorizedUser(account, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return user.GetPluginKeys(plugin)
+}
+
+func (b *Bridge) getAuthorizedUser(account, accessToken string) (*users.User, error) {
+	user, err := b.GetUser(account)
+	if err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+
+	if err := user.CheckBridgeAccessToken(accessToken); err != nil {
+		log.WithError(err).Warn("Access to account denied")
+		return nil, ErrInvalidAccessToken
+	}
+	return user, nil
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/authpolicy"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+)
+
+// Hosts from which authentication failed this many times within the
+// window are blocked for the rest of the window.
+const (
+	remoteAuthMaxFailures = 5
+	remoteAuthWindow      = 15 * time.Minute
+)
+
+// RemoteAccess lets clients from other machines, e.g. on LAN or in a VM,
+// connect to IMAP and SMTP servers. CalDAV and control API always stay on
+// loopback.
+type RemoteAccess struct {
+	BindAddress  string       // IP address of the interface to listen on.
+	AllowedHosts []*net.IPNet // Remote hosts which can connect.
+}
+
+var (
+	remoteAccess     RemoteAccess //nolint[gochecknoglobals]
+	remoteAccessLock sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetRemoteAccess sets remote access used by servers started afterwards.
+// Allowed hosts apply also to new connections of running servers.
+func SetRemoteAccess(access RemoteAccess) {
+	remoteAccessLock.Lock()
+	defer remoteAccessLock.Unlock()
+
+	remoteAccess = access
+}
+
+// GetRemoteAccess returns current remote access settings.
+func GetRemoteAccess() RemoteAccess {
+	remoteAccessLock.RLock()
+	defer remoteAccessLock.RUnlock()
+
+	return remoteAccess
+}
+
+// LoadRemoteAccess returns remote access from preferences. Remote access
+// stays disabled when the bind address or the allowed hosts are invalid
+// or when no host is allowed, so servers are never exposed by mistake.
+func LoadRemoteAccess(pref *config.Preferences) RemoteAccess {
+	bindAddress := strings.TrimSpace(pref.Get(preferences.BindAddressKey))
+	if bindAddress == "" {
+		return RemoteAccess{}
+	}
+
+	if ip := net.ParseIP(bindAddress); ip == nil {
+		log.WithField("address", bindAddress).Warn("Invalid bind address, listening on loopback only")
+		return RemoteAccess{}
+	}
+
+	allowedHosts, err := ParseAllowedHosts(pref.Get(preferences.RemoteAllowedHostsKey))
+	if err != nil {
+		log.WithError(err).Warn("Invalid allowed hosts, listening on loopback only")
+		return RemoteAccess{}
+	}
+	if len(allowedHosts) == 0 {
+		log.Warn("No remote host is allowed, listening on loopback only")
+		return RemoteAccess{}
+	}
+
+	return RemoteAccess{
+		BindAddress:  bindAddress,
+		AllowedHosts: allowedHosts,
+	}
+}
+
+// ParseAllowedHosts parses comma-separated IP addresses and networks in
+// CIDR notation, e.g. `192.168.1.10, 10.0.0.0/24`.
+func ParseAllowedHosts(value string) (hosts []*net.IPNet, err error) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", item)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			hosts = append(hosts, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, network)
+	}
+
+	return hosts, nil
+}
+
+// IsEnabled returns whether servers listen on other than loopback interface.
+func (r RemoteAccess) IsEnabled() bool {
+	if r.BindAddress == "" {
+		return false
+	}
+	ip := net.ParseIP(r.BindAddress)
+	return ip != nil && !ip.IsLoopback()
+}
+
+// GetListenHost returns the host on which servers listen.
+func (r RemoteAccess) GetListenHost() string {
+	if r.BindAddress == "" {
+		return Host
+	}
+	return r.BindAddress
+}
+
+// IsAllowed returns whether the client can connect. Loopback clients are
+// always allowed.
+func (r RemoteAccess) IsAllowed(addr net.Addr) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+
+	for _, network := range r.AllowedHosts {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// HardenAuthPolicy returns the policy with mandatory STARTTLS and blocking
+// of hosts guessing passwords when remote access is enabled.
+func (r RemoteAccess) HardenAuthPolicy(policy authpolicy.Policy) authpolicy.Policy {
+	if !r.IsEnabled() {
+		return policy
+	}
+
+	policy.RequireTLS = true
+	if policy.Limiter == nil {
+		policy.Limiter = authpolicy.NewLimiter(remoteAuthMaxFailures, remoteAuthWindow)
+	}
+	return policy
+}
+
+// GetListenAddress returns address with the port on which servers listen.
+func GetListenAddress(port int) string {
+	return fmt.Sprintf("%v:%v", GetRemoteAccess().GetListenHost(), port)
+}
+
+// NewRemoteAccessListener closes connections of clients which are not
+// allowed by current remote access settings.
+func NewRemoteAccessListener(l net.Listener) net.Listener {
+	return &remoteAccessListener{Listener: l}
+}
+
+type remoteAccessListener struct {
+	net.Listener
+}
+
+func (l *remoteAccessListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if GetRemoteAccess().IsAllowed(conn.RemoteAddr()) {
+			return conn, nil
+		}
+
+		log.WithField("remote", conn.RemoteAddr().String()).Warn("Connection from host which is not allowed was refused")
+		_ = conn.Close()
+	}
+}
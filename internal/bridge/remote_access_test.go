@@ -0,0 +1,99 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/authpolicy"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAllowedHosts(t *testing.T) {
+	hosts, err := ParseAllowedHosts(" 192.168.1.10, 10.0.0.0/24,fd00::1 ,")
+	require.NoError(t, err)
+	require.Len(t, hosts, 3)
+	require.Equal(t, "192.168.1.10/32", hosts[0].String())
+	require.Equal(t, "10.0.0.0/24", hosts[1].String())
+	require.Equal(t, "fd00::1/128", hosts[2].String())
+
+	for _, value := range []string{"laptop", "10.0.0.0/33", "192.168.1"} {
+		_, err := ParseAllowedHosts(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestRemoteAccessIsAllowed(t *testing.T) {
+	hosts, err := ParseAllowedHosts("192.168.1.10, 10.0.0.0/24")
+	require.NoError(t, err)
+	access := RemoteAccess{BindAddress: "0.0.0.0", AllowedHosts: hosts}
+
+	for addr, allowed := range map[string]bool{
+		"127.0.0.1:50000":    true,
+		"[::1]:50000":        true,
+		"192.168.1.10:50000": true,
+		"192.168.1.11:50000": false,
+		"10.0.0.200:50000":   true,
+		"10.0.1.1:50000":     false,
+	} {
+		tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+		require.NoError(t, err)
+		require.Equal(t, allowed, access.IsAllowed(tcpAddr), addr)
+	}
+}
+
+func TestRemoteAccessHardensAuthPolicy(t *testing.T) {
+	policy := RemoteAccess{}.HardenAuthPolicy(authpolicy.Policy{})
+	require.Equal(t, authpolicy.Policy{}, policy)
+	require.Equal(t, Host, RemoteAccess{}.GetListenHost())
+
+	access := RemoteAccess{BindAddress: "192.168.1.2"}
+	policy = access.HardenAuthPolicy(authpolicy.Policy{Mechanisms: []string{authpolicy.Plain}})
+	require.True(t, policy.RequireTLS)
+	require.NotNil(t, policy.Limiter)
+	require.Equal(t, []string{authpolicy.Plain}, policy.Mechanisms)
+	require.Equal(t, "192.168.1.2", access.GetListenHost())
+}
+
+func TestLoadRemoteAccess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remote")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	pref := config.NewPreferences(filepath.Join(dir, "prefs.json"))
+
+	pref.Set(preferences.BindAddressKey, "0.0.0.0")
+	require.False(t, LoadRemoteAccess(pref).IsEnabled(), "no allowed host")
+
+	pref.Set(preferences.RemoteAllowedHostsKey, "laptop")
+	require.False(t, LoadRemoteAccess(pref).IsEnabled(), "invalid allowed host")
+
+	pref.Set(preferences.RemoteAllowedHostsKey, "192.168.1.0/24")
+	access := LoadRemoteAccess(pref)
+	require.True(t, access.IsEnabled())
+	require.Equal(t, "0.0.0.0", access.GetListenHost())
+
+	pref.Set(preferences.BindAddressKey, "lan")
+	require.False(t, LoadRemoteAccess(pref).IsEnabled(), "invalid bind address")
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+)
+
+// UploadSettings uploads preferences shared by settings sync together with
+// settings of the account to the account.
+func (b *Bridge) UploadSettings(query string) error {
+	user, err := b.GetUser(query)
+	if err != nil {
+		return err
+	}
+
+	prefs := map[string]string{}
+	for _, key := range preferences.SyncedKeys {
+		prefs[key] = b.pref.Get(key)
+	}
+	return user.UploadSettings(prefs)
+}
+
+// DownloadSettings applies settings uploaded to the account by a bridge of
+// the user on another computer. Only preferences shared by settings sync
+// are applied; some of them are used after restart.
+func (b *Bridge) DownloadSettings(query string) error {
+	user, err := b.GetUser(query)
+	if err != nil {
+		return err
+	}
+
+	prefs, err := user.DownloadSettings()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range preferences.SyncedKeys {
+		if value, ok := prefs[key]; ok {
+			b.pref.Set(key, value)
+		}
+	}
+	return nil
+}
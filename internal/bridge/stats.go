@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/stats"
+)
+
+// statsInterval is how often metrics which are not counted where they
+// happen are sampled and the history is saved.
+const statsInterval = time.Minute
+
+// recordStats samples API errors, cache size, version and settings into
+// the history of daily metrics.
+func (b *Bridge) recordStats(version string, storeFactory *storeFactory) {
+	var lastAPIErrors uint64
+
+	for {
+		retries := b.clientManager.GetRetryMetrics()
+		apiErrors := retries.Retries + retries.GaveUp
+		stats.Add(stats.APIErrors, int64(apiErrors-lastAPIErrors))
+		lastAPIErrors = apiErrors
+
+		stats.SetGauge(stats.CacheSize, storeFactory.getCacheSize())
+		stats.SetInfo(version, b.getSettingsFingerprint())
+
+		if err := stats.Save(); err != nil {
+			log.WithError(err).Warn("Cannot save history of metrics")
+		}
+
+		time.Sleep(statsInterval)
+	}
+}
+
+// getSettingsFingerprint returns the fingerprint of settings changed by the
+// user, i.e. those synced between computers, and ports.
+func (b *Bridge) getSettingsFingerprint() string {
+	values := []string{
+		b.pref.Get(preferences.IMAPPortKey),
+		b.pref.Get(preferences.SMTPPortKey),
+		b.pref.Get(preferences.SMTPSSLKey),
+	}
+	for _, key := range preferences.SyncedKeys {
+		values = append(values, b.pref.Get(key))
+	}
+	return stats.Fingerprint(values...)
+}
@@ -19,6 +19,7 @@ package bridge
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/ProtonMail/proton-bridge/internal/store"
@@ -28,11 +29,14 @@ import (
 )
 
 type storeFactory struct {
-	config        StoreFactoryConfiger
-	panicHandler  users.PanicHandler
-	clientManager users.ClientManager
-	eventListener listener.Listener
-	storeCache    *store.Cache
+	config          StoreFactoryConfiger
+	panicHandler    users.PanicHandler
+	clientManager   users.ClientManager
+	eventListener   listener.Listener
+	storeCache      *store.Cache
+	messageCache    *store.MessageCache
+	attachmentCache *store.AttachmentCache
+	searchIndexes   *store.SearchIndexStorage
 }
 
 func newStoreFactory(
@@ -40,24 +44,158 @@ func newStoreFactory(
 	panicHandler users.PanicHandler,
 	clientManager users.ClientManager,
 	eventListener listener.Listener,
+	messageCacheSize int64,
+	cacheLocation cacheLocation,
 ) *storeFactory {
+	removeOldCacheKey(config)
+
 	return &storeFactory{
-		config:        config,
-		panicHandler:  panicHandler,
-		clientManager: clientManager,
-		eventListener: eventListener,
-		storeCache:    store.NewCache(config.GetIMAPCachePath()),
+		config:          config,
+		panicHandler:    panicHandler,
+		clientManager:   clientManager,
+		eventListener:   eventListener,
+		storeCache:      store.NewCache(config.GetIMAPCachePath()),
+		messageCache:    newMessageCache(config, messageCacheSize, cacheLocation),
+		attachmentCache: newAttachmentCache(config, messageCacheSize, cacheLocation),
+		searchIndexes:   newSearchIndexStorage(config),
+	}
+}
+
+// cacheLocation is where the message and attachment caches are stored.
+// Empty dir means the default cache folder of the config.
+type cacheLocation struct {
+	backend string
+	dir     string
+}
+
+// getDir returns the folder of the cache with the given name or the default
+// folder if no custom location is set.
+func (l cacheLocation) getDir(name, defaultDir string) string {
+	if l.dir == "" {
+		return defaultDir
+	}
+	return filepath.Join(l.dir, name)
+}
+
+// removeOldCacheKey removes the key which encrypted caches of all users before
+// each user got own key stored in the keychain. Content encrypted by it
+// cannot be decrypted anymore and is removed from the caches when used.
+func removeOldCacheKey(config StoreFactoryConfiger) {
+	if err := os.Remove(config.GetMessageCacheKeyPath()); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Warn("Cannot remove old cache key")
+	}
+}
+
+// newMessageCache returns nil, i.e. disabled cache, when the size is zero
+// or the cache cannot be opened.
+func newMessageCache(config StoreFactoryConfiger, size int64, location cacheLocation) *store.MessageCache {
+	if size <= 0 {
+		return nil
+	}
+
+	backend, err := store.NewCacheBackend(location.backend, location.getDir("messages", config.GetMessageCacheDir()))
+	if err != nil {
+		log.WithError(err).Error("Cannot open message cache backend, continuing without cache")
+		return nil
+	}
+
+	messageCache, err := store.NewMessageCacheWithBackend(backend, size)
+	if err != nil {
+		log.WithError(err).Error("Cannot open message cache, continuing without it")
+		_ = backend.Close()
+		return nil
+	}
+
+	return messageCache
+}
+
+// newAttachmentCache returns nil, i.e. disabled cache, when the size is zero
+// or the cache cannot be opened. Attachments have the same size limit as
+// messages.
+func newAttachmentCache(config StoreFactoryConfiger, size int64, location cacheLocation) *store.AttachmentCache {
+	if size <= 0 {
+		return nil
+	}
+
+	backend, err := store.NewCacheBackend(location.backend, location.getDir("attachments", config.GetAttachmentCacheDir()))
+	if err != nil {
+		log.WithError(err).Error("Cannot open attachment cache backend, continuing without cache")
+		return nil
+	}
+
+	attachmentCache, err := store.NewAttachmentCacheWithBackend(backend, size)
+	if err != nil {
+		log.WithError(err).Error("Cannot open attachment cache, continuing without it")
+		_ = backend.Close()
+		return nil
+	}
+
+	return attachmentCache
+}
+
+// newSearchIndexStorage returns nil, i.e. indexes are kept only in memory,
+// when the storage cannot be opened.
+func newSearchIndexStorage(config StoreFactoryConfiger) *store.SearchIndexStorage {
+	searchIndexes, err := store.NewSearchIndexStorage(config.GetSearchIndexDir())
+	if err != nil {
+		log.WithError(err).Error("Cannot open search index storage, continuing without it")
+		return nil
+	}
+
+	return searchIndexes
+}
+
+// getCacheSize returns the total size of cached messages and attachments.
+func (f *storeFactory) getCacheSize() (size int64) {
+	if f.messageCache != nil {
+		size += f.messageCache.Size()
+	}
+	if f.attachmentCache != nil {
+		size += f.attachmentCache.Size()
+	}
+	return size
+}
+
+// close releases the caches shared by stores of all users.
+func (f *storeFactory) close() {
+	if f.messageCache != nil {
+		if err := f.messageCache.Close(); err != nil {
+			log.WithError(err).Warn("Cannot close message cache")
+		}
+	}
+	if f.attachmentCache != nil {
+		if err := f.attachmentCache.Close(); err != nil {
+			log.WithError(err).Warn("Cannot close attachment cache")
+		}
 	}
 }
 
 // New creates new store for given user.
 func (f *storeFactory) New(user store.BridgeUser) (*store.Store, error) {
 	storePath := getUserStorePath(f.config.GetDBDir(), user.ID())
-	return store.New(f.panicHandler, user, f.clientManager, f.eventListener, storePath, f.storeCache)
+	return store.New(f.panicHandler, user, f.clientManager, f.eventListener, storePath, f.storeCache, f.messageCache, f.attachmentCache, f.searchIndexes)
 }
 
 // Remove removes all store files for given user.
 func (f *storeFactory) Remove(userID string) error {
+	if f.messageCache != nil {
+		if err := f.messageCache.RemoveUser(userID); err != nil {
+			log.WithError(err).Warn("Cannot remove user messages from cache")
+		}
+	}
+
+	if f.attachmentCache != nil {
+		if err := f.attachmentCache.RemoveUser(userID); err != nil {
+			log.WithError(err).Warn("Cannot remove user attachments from cache")
+		}
+	}
+
+	if f.searchIndexes != nil {
+		if err := f.searchIndexes.RemoveUser(userID); err != nil {
+			log.WithError(err).Warn("Cannot remove user search index")
+		}
+	}
+
 	storePath := getUserStorePath(f.config.GetDBDir(), userID)
 	return store.RemoveStore(f.storeCache, storePath, userID)
 }
@@ -22,11 +22,18 @@ import "github.com/ProtonMail/proton-bridge/internal/users"
 type Configer interface {
 	users.Configer
 	StoreFactoryConfiger
+
+	GetLogDir() string
+	GetTransferDir() string
 }
 
 type StoreFactoryConfiger interface {
 	GetDBDir() string
 	GetIMAPCachePath() string
+	GetMessageCacheDir() string
+	GetMessageCacheKeyPath() string
+	GetAttachmentCacheDir() string
+	GetSearchIndexDir() string
 }
 
 type PreferenceProvider interface {
@@ -0,0 +1,167 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package caldav
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+func (s *session) propfind(w http.ResponseWriter, r *http.Request, path resourcePath) error {
+	var req propfindRequest
+	if err := decodeBody(r.Body, &req); err != nil {
+		http.Error(w, "Malformed PROPFIND request", http.StatusBadRequest)
+		return nil
+	}
+
+	// Missing body means allprop, see RFC 4918 section 9.1.
+	allProp := req.AllProp != nil || req.Prop == nil
+	var names []xml.Name
+	if req.Prop != nil {
+		names = req.Prop.Names
+	}
+
+	// Infinite depth is not supported, it is handled the same as depth 1.
+	resources, err := s.getResources(path, r.Header.Get("Depth") != "0")
+	if err != nil {
+		return err
+	}
+
+	ms := &multistatus{}
+	for _, res := range resources {
+		ms.Responses = append(ms.Responses, res.response(names, allProp))
+	}
+
+	writeMultistatus(w, ms)
+	return nil
+}
+
+func (s *session) report(w http.ResponseWriter, r *http.Request, path resourcePath) error {
+	if path.kind != calendarResource {
+		http.Error(w, "Reports are supported only on calendars", http.StatusForbidden)
+		return nil
+	}
+
+	var req reportRequest
+	if err := decodeBody(r.Body, &req); err != nil {
+		http.Error(w, "Malformed REPORT request", http.StatusBadRequest)
+		return nil
+	}
+
+	var names []xml.Name
+	if req.Prop != nil {
+		names = req.Prop.Names
+	}
+
+	var (
+		resources []*resource
+		err       error
+	)
+
+	switch {
+	case req.XMLName.Space == nsCalDAV && req.XMLName.Local == "calendar-multiget":
+		resources, err = s.getMultigetResources(path.calendarID, req.Hrefs)
+	case req.XMLName.Space == nsCalDAV && req.XMLName.Local == "calendar-query":
+		resources, err = s.getQueryResources(path.calendarID, req.Filter)
+	default:
+		http.Error(w, "Unsupported report", http.StatusForbidden)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ms := &multistatus{}
+	for _, res := range resources {
+		ms.Responses = append(ms.Responses, res.response(names, false))
+	}
+
+	writeMultistatus(w, ms)
+	return nil
+}
+
+func (s *session) getMultigetResources(calendarID string, hrefs []string) (resources []*resource, err error) {
+	for _, href := range hrefs {
+		hrefPath := href
+		if u, err := url.Parse(href); err == nil {
+			hrefPath = u.Path
+		}
+
+		path, err := parsePath(hrefPath)
+		if err != nil || path.kind != eventResource || path.calendarID != calendarID {
+			continue
+		}
+
+		event, err := s.client.GetCalendarEvent(s.ctx, path.calendarID, path.eventID)
+		if err != nil {
+			log.WithError(err).WithField("href", href).Warn("Cannot get event")
+			continue
+		}
+
+		resources = append(resources, s.newEventResource(event))
+	}
+
+	return resources, nil
+}
+
+func (s *session) getQueryResources(calendarID string, filter *compFilter) (resources []*resource, err error) {
+	start, end := filter.getEventTimeRange()
+
+	events, err := s.listEvents(calendarID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range events {
+		resources = append(resources, s.newEventResource(event))
+	}
+
+	return resources, nil
+}
+
+func (s *session) get(w http.ResponseWriter, r *http.Request, path resourcePath) error {
+	if path.kind != eventResource {
+		http.Error(w, "Only events can be downloaded", http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	event, err := s.client.GetCalendarEvent(s.ctx, path.calendarID, path.eventID)
+	if err != nil {
+		return errors.Wrap(errNotFound, err.Error())
+	}
+
+	data, err := s.getEventData(event)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("ETag", getEventETag(event))
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method != http.MethodHead {
+		_, _ = io.WriteString(w, data)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package caldav
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+const (
+	icsLineEnd = "\r\n"
+	icsProdID  = "-//Proton Technologies//ProtonMail Bridge//EN"
+)
+
+// uniqueEventProperties can be present in several cards of the same event
+// but must be written only once in the merged event.
+var uniqueEventProperties = map[string]bool{ //nolint[gochecknoglobals]
+	"UID":      true,
+	"DTSTAMP":  true,
+	"SEQUENCE": true,
+}
+
+// buildICS merges the decrypted cards of the event into one VCALENDAR.
+// Proton splits the properties of one VEVENT into several cards based on
+// their encryption and signature type, so every card contains only part
+// of the event.
+func buildICS(cards []pmapi.Card) string {
+	var lines []string
+	seen := map[string]bool{}
+
+	for _, card := range cards {
+		for _, line := range getEventLines(card.Data) {
+			name := getPropertyName(line)
+			if uniqueEventProperties[name] {
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("BEGIN:VCALENDAR" + icsLineEnd)
+	b.WriteString("VERSION:2.0" + icsLineEnd)
+	b.WriteString("PRODID:" + icsProdID + icsLineEnd)
+	b.WriteString("BEGIN:VEVENT" + icsLineEnd)
+	for _, line := range lines {
+		b.WriteString(foldLine(line) + icsLineEnd)
+	}
+	b.WriteString("END:VEVENT" + icsLineEnd)
+	b.WriteString("END:VCALENDAR" + icsLineEnd)
+
+	return b.String()
+}
+
+// getEventLines returns the content lines inside the VEVENT component of the
+// card, including nested components (e.g. VALARM). Folded lines are unfolded.
+func getEventLines(data string) (lines []string) {
+	var inEvent bool
+
+	for _, line := range unfoldLines(data) {
+		switch {
+		case strings.EqualFold(line, "BEGIN:VEVENT"):
+			inEvent = true
+		case strings.EqualFold(line, "END:VEVENT"):
+			inEvent = false
+		case inEvent && line != "":
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+func unfoldLines(data string) (lines []string) {
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// foldLine splits lines longer than 75 octets as required by RFC 5545.
+// Lines are split only on UTF-8 character boundaries.
+func foldLine(line string) string {
+	const maxLineLength = 75
+
+	b := &strings.Builder{}
+	length := 0
+	for _, r := range line {
+		runeLength := len(string(r))
+		if length+runeLength > maxLineLength {
+			b.WriteString(icsLineEnd + " ")
+			length = 1
+		}
+		b.WriteRune(r)
+		length += runeLength
+	}
+
+	return b.String()
+}
+
+func getPropertyName(line string) string {
+	if i := strings.IndexAny(line, ":;"); i >= 0 {
+		return strings.ToUpper(line[:i])
+	}
+	return strings.ToUpper(line)
+}
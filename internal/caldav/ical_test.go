@@ -0,0 +1,61 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package caldav
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildICS(t *testing.T) {
+	cards := []pmapi.Card{
+		{Type: pmapi.CardSigned, Data: "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:event@proton.me\r\nDTSTAMP:20200916T120000Z\r\nDTSTART:20200917T120000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+		{Type: pmapi.CardEncrypted | pmapi.CardSigned, Data: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:event@proton.me\r\nDTSTAMP:20200916T120000Z\r\nSUMMARY:Lunch\r\n  with friends\r\nBEGIN:VALARM\r\nTRIGGER:-PT15M\r\nEND:VALARM\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+	}
+
+	require.Equal(t, strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + icsProdID,
+		"BEGIN:VEVENT",
+		"UID:event@proton.me",
+		"DTSTAMP:20200916T120000Z",
+		"DTSTART:20200917T120000Z",
+		"SUMMARY:Lunch with friends",
+		"BEGIN:VALARM",
+		"TRIGGER:-PT15M",
+		"END:VALARM",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n"), buildICS(cards))
+}
+
+func TestFoldLine(t *testing.T) {
+	line := "DESCRIPTION:" + strings.Repeat("ž", 40)
+
+	folded := foldLine(line)
+
+	for _, part := range strings.Split(folded, "\r\n") {
+		require.True(t, len(part) <= 75, "line %q is too long", part)
+	}
+	require.Equal(t, line, strings.ReplaceAll(folded, "\r\n ", ""))
+}
@@ -0,0 +1,395 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package caldav
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+const (
+	principalPath = "/principal/"
+	homePath      = "/calendars/"
+	eventSuffix   = ".ics"
+
+	eventsPageSize = 100
+)
+
+var errNotFound = errors.New("resource not found") //nolint[gochecknoglobals]
+
+type resourceKind int
+
+const (
+	rootResource resourceKind = iota
+	principalResource
+	homeResource
+	calendarResource
+	eventResource
+)
+
+// resourcePath is a parsed request path.
+type resourcePath struct {
+	kind       resourceKind
+	calendarID string
+	eventID    string
+}
+
+func parsePath(p string) (resourcePath, error) {
+	switch {
+	case p == "/" || p == "":
+		return resourcePath{kind: rootResource}, nil
+	case strings.TrimSuffix(p, "/")+"/" == principalPath:
+		return resourcePath{kind: principalResource}, nil
+	case strings.TrimSuffix(p, "/")+"/" == homePath:
+		return resourcePath{kind: homeResource}, nil
+	case !strings.HasPrefix(p, homePath):
+		return resourcePath{}, errNotFound
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(p, homePath), "/"), "/")
+	switch {
+	case len(parts) == 1:
+		return resourcePath{kind: calendarResource, calendarID: parts[0]}, nil
+	case len(parts) == 2 && strings.HasSuffix(parts[1], eventSuffix):
+		return resourcePath{
+			kind:       eventResource,
+			calendarID: parts[0],
+			eventID:    strings.TrimSuffix(parts[1], eventSuffix),
+		}, nil
+	}
+
+	return resourcePath{}, errNotFound
+}
+
+func getCalendarHref(calendarID string) string {
+	return homePath + url.PathEscape(calendarID) + "/"
+}
+
+func getEventHref(calendarID, eventID string) string {
+	return getCalendarHref(calendarID) + url.PathEscape(eventID) + eventSuffix
+}
+
+func getEventETag(event *pmapi.CalendarEvent) string {
+	return fmt.Sprintf("\"%d-%d\"", event.ModifyTime, len(event.SharedEvents)+len(event.CalendarEvents))
+}
+
+type propertyGetter func() (string, error)
+
+// resource is a DAV resource with lazily computed properties.
+type resource struct {
+	href  string
+	props map[xml.Name]propertyGetter
+	// lazyProps are not returned for allprop requests because they are expensive.
+	lazyProps map[xml.Name]bool
+}
+
+func (res *resource) response(names []xml.Name, allProp bool) response {
+	if allProp {
+		names = nil
+		for name := range res.props {
+			if !res.lazyProps[name] {
+				names = append(names, name)
+			}
+		}
+	}
+
+	found := propstat{Status: statusLine(http.StatusOK)}
+	notFound := propstat{Status: statusLine(http.StatusNotFound)}
+
+	for _, name := range names {
+		getter, ok := res.props[name]
+		if !ok {
+			notFound.Prop.Properties = append(notFound.Prop.Properties, property{XMLName: name})
+			continue
+		}
+
+		value, err := getter()
+		if err != nil {
+			log.WithError(err).WithField("href", res.href).WithField("prop", name.Local).Warn("Cannot get property")
+			notFound.Prop.Properties = append(notFound.Prop.Properties, property{XMLName: name})
+			continue
+		}
+
+		found.Prop.Properties = append(found.Prop.Properties, property{XMLName: name, Inner: value})
+	}
+
+	resp := response{Href: res.href}
+	if len(found.Prop.Properties) > 0 {
+		resp.Propstats = append(resp.Propstats, found)
+	}
+	if len(notFound.Prop.Properties) > 0 {
+		resp.Propstats = append(resp.Propstats, notFound)
+	}
+
+	return resp
+}
+
+func staticProperty(value string) propertyGetter {
+	return func() (string, error) { return value, nil }
+}
+
+// session serves requests of one authenticated user.
+type session struct {
+	user   bridgeUser
+	client pmapi.Client
+
+	// ctx of API requests is cancelled when the client disconnects.
+	ctx context.Context
+
+	calendars   []*pmapi.Calendar
+	calendarKRs map[string]*crypto.KeyRing
+}
+
+func newSession(ctx context.Context, user bridgeUser) *session {
+	return &session{
+		user:        user,
+		client:      user.GetTemporaryPMAPIClient(),
+		ctx:         ctx,
+		calendarKRs: map[string]*crypto.KeyRing{},
+	}
+}
+
+func (s *session) getCalendars() ([]*pmapi.Calendar, error) {
+	if s.calendars != nil {
+		return s.calendars, nil
+	}
+
+	calendars, err := s.client.ListCalendars(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.calendars = calendars
+	return calendars, nil
+}
+
+func (s *session) getCalendar(calendarID string) (*pmapi.Calendar, error) {
+	calendars, err := s.getCalendars()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, calendar := range calendars {
+		if calendar.ID == calendarID {
+			return calendar, nil
+		}
+	}
+
+	return nil, errNotFound
+}
+
+func (s *session) getCalendarKeyRing(calendarID string) (*crypto.KeyRing, error) {
+	if kr, ok := s.calendarKRs[calendarID]; ok {
+		return kr, nil
+	}
+
+	kr, err := s.client.KeyRingForCalendarID(s.ctx, calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.calendarKRs[calendarID] = kr
+	return kr, nil
+}
+
+// listEvents returns all events of the calendar in the time range.
+// Zero start or end means the range is not limited from that side.
+func (s *session) listEvents(calendarID string, start, end time.Time) (events []*pmapi.CalendarEvent, err error) {
+	filter := &pmapi.CalendarEventsFilter{PageSize: eventsPageSize}
+	if !start.IsZero() {
+		filter.Start = start.Unix()
+	}
+	if !end.IsZero() {
+		filter.End = end.Unix()
+	}
+
+	for {
+		page, err := s.client.ListCalendarEvents(s.ctx, calendarID, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, page...)
+
+		if len(page) < eventsPageSize {
+			return events, nil
+		}
+
+		filter.Page++
+	}
+}
+
+func (s *session) getEventData(event *pmapi.CalendarEvent) (string, error) {
+	kr, err := s.getCalendarKeyRing(event.CalendarID)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get calendar keyring")
+	}
+
+	cards, err := event.Decrypt(kr)
+	if err != nil {
+		return "", err
+	}
+
+	return buildICS(cards), nil
+}
+
+func (s *session) newRootResource() *resource {
+	return &resource{
+		href: "/",
+		props: map[xml.Name]propertyGetter{
+			propResourceType:         staticProperty("<collection xmlns=\"DAV:\"/>"),
+			propCurrentUserPrincipal: staticProperty(hrefProperty(principalPath)),
+		},
+	}
+}
+
+func (s *session) newPrincipalResource() *resource {
+	return &resource{
+		href: principalPath,
+		props: map[xml.Name]propertyGetter{
+			propResourceType:         staticProperty("<principal xmlns=\"DAV:\"/>"),
+			propDisplayName:          staticProperty(escapeText(s.user.ID())),
+			propCurrentUserPrincipal: staticProperty(hrefProperty(principalPath)),
+			propPrincipalURL:         staticProperty(hrefProperty(principalPath)),
+			propCalendarHomeSet:      staticProperty(hrefProperty(homePath)),
+		},
+	}
+}
+
+func (s *session) newHomeResource() *resource {
+	return &resource{
+		href: homePath,
+		props: map[xml.Name]propertyGetter{
+			propResourceType:         staticProperty("<collection xmlns=\"DAV:\"/>"),
+			propCurrentUserPrincipal: staticProperty(hrefProperty(principalPath)),
+		},
+	}
+}
+
+func (s *session) newCalendarResource(calendar *pmapi.Calendar) *resource {
+	getCTag := func() (string, error) {
+		events, err := s.listEvents(calendar.ID, time.Time{}, time.Time{})
+		if err != nil {
+			return "", err
+		}
+
+		var lastModified int64
+		for _, event := range events {
+			if event.ModifyTime > lastModified {
+				lastModified = event.ModifyTime
+			}
+		}
+
+		return fmt.Sprintf("%d-%d", lastModified, len(events)), nil
+	}
+
+	return &resource{
+		href: getCalendarHref(calendar.ID),
+		props: map[xml.Name]propertyGetter{
+			propResourceType:            staticProperty("<collection xmlns=\"DAV:\"/><calendar xmlns=\"" + nsCalDAV + "\"/>"),
+			propDisplayName:             staticProperty(escapeText(calendar.Name)),
+			propCalendarDescription:     staticProperty(escapeText(calendar.Description)),
+			propCalendarColor:           staticProperty(escapeText(calendar.Color)),
+			propCurrentUserPrincipal:    staticProperty(hrefProperty(principalPath)),
+			propCurrentUserPrivilegeSet: staticProperty("<privilege xmlns=\"DAV:\"><read/></privilege>"),
+			propSupportedComponentSet:   staticProperty("<comp xmlns=\"" + nsCalDAV + "\" name=\"VEVENT\"/>"),
+			propGetCTag:                 getCTag,
+		},
+		lazyProps: map[xml.Name]bool{propGetCTag: true},
+	}
+}
+
+func (s *session) newEventResource(event *pmapi.CalendarEvent) *resource {
+	return &resource{
+		href: getEventHref(event.CalendarID, event.ID),
+		props: map[xml.Name]propertyGetter{
+			propResourceType:   staticProperty(""),
+			propGetETag:        staticProperty(escapeText(getEventETag(event))),
+			propGetContentType: staticProperty("text/calendar; charset=utf-8; component=VEVENT"),
+			propCalendarData: func() (string, error) {
+				data, err := s.getEventData(event)
+				if err != nil {
+					return "", err
+				}
+				return escapeText(data), nil
+			},
+		},
+		lazyProps: map[xml.Name]bool{propCalendarData: true},
+	}
+}
+
+// getResources returns the resource on the path and, if requested, its children.
+func (s *session) getResources(path resourcePath, withChildren bool) ([]*resource, error) {
+	switch path.kind {
+	case rootResource:
+		return []*resource{s.newRootResource()}, nil
+
+	case principalResource:
+		return []*resource{s.newPrincipalResource()}, nil
+
+	case homeResource:
+		resources := []*resource{s.newHomeResource()}
+		if !withChildren {
+			return resources, nil
+		}
+		calendars, err := s.getCalendars()
+		if err != nil {
+			return nil, err
+		}
+		for _, calendar := range calendars {
+			resources = append(resources, s.newCalendarResource(calendar))
+		}
+		return resources, nil
+
+	case calendarResource:
+		calendar, err := s.getCalendar(path.calendarID)
+		if err != nil {
+			return nil, err
+		}
+		resources := []*resource{s.newCalendarResource(calendar)}
+		if !withChildren {
+			return resources, nil
+		}
+		events, err := s.listEvents(calendar.ID, time.Time{}, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			resources = append(resources, s.newEventResource(event))
+		}
+		return resources, nil
+
+	case eventResource:
+		event, err := s.client.GetCalendarEvent(s.ctx, path.calendarID, path.eventID)
+		if err != nil {
+			return nil, err
+		}
+		return []*resource{s.newEventResource(event)}, nil
+	}
+
+	return nil, errNotFound
+}
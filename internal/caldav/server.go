@@ -0,0 +1,172 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package caldav provides read-only CalDAV server of the Bridge exposing
+// calendars of the user to calendar clients.
+//
+// Layout of the served resources (relative to the authenticated user):
+//  * /principal/ is the principal of the user
+//  * /calendars/ is the calendar home
+//  * /calendars/{calendarID}/ is a calendar
+//  * /calendars/{calendarID}/{eventID}.ics is an event
+package caldav
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/incidents"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	log = logrus.WithField("pkg", "caldav") //nolint[gochecknoglobals]
+)
+
+type caldavServer struct {
+	server        *http.Server
+	bridge        bridger
+	eventListener listener.Listener
+}
+
+// NewCalDAVServer constructs a new CalDAV server configured with the given options.
+func NewCalDAVServer(port int, tls *tls.Config, bridge *bridge.Bridge, eventListener listener.Listener) *caldavServer { //nolint[golint]
+	return newCalDAVServer(port, tls, newBridgeWrap(bridge), eventListener)
+}
+
+func newCalDAVServer(port int, tlsConfig *tls.Config, b bridger, eventListener listener.Listener) *caldavServer {
+	s := &caldavServer{
+		bridge:        b,
+		eventListener: eventListener,
+	}
+
+	s.server = &http.Server{
+		Addr:         fmt.Sprintf("%v:%v", bridge.Host, port),
+		Handler:      s,
+		TLSConfig:    tlsConfig,
+		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
+	}
+
+	return s
+}
+
+// Starts the server.
+func (s *caldavServer) ListenAndServe() {
+	log.Info("CalDAV server listening at ", s.server.Addr)
+	l, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		s.eventListener.Emit(events.ErrorEvent, "CalDAV failed: "+err.Error())
+		incidents.Report(incidents.ServerFailed, "", "CalDAV failed: "+err.Error())
+		log.Error("CalDAV failed: ", err)
+		return
+	}
+
+	if err := s.server.Serve(tls.NewListener(l, s.server.TLSConfig)); err != nil && err != http.ErrServerClosed {
+		s.eventListener.Emit(events.ErrorEvent, "CalDAV failed: "+err.Error())
+		incidents.Report(incidents.ServerFailed, "", "CalDAV failed: "+err.Error())
+		log.Error("CalDAV failed: ", err)
+		return
+	}
+
+	log.Info("CalDAV server stopped")
+}
+
+// Stops the server.
+func (s *caldavServer) Close() {
+	_ = s.server.Close()
+}
+
+func (s *caldavServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/.well-known/caldav" {
+		http.Redirect(w, r, principalPath, http.StatusMovedPermanently)
+		return
+	}
+
+	if r.Method == http.MethodOptions {
+		setDAVHeaders(w)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	user, err := s.authenticate(r)
+	if err != nil {
+		log.WithError(err).Warn("CalDAV authentication failed")
+		w.Header().Set("WWW-Authenticate", "Basic realm=\"ProtonMail Bridge\"")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path, err := parsePath(r.URL.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	sess := newSession(r.Context(), user)
+
+	switch r.Method {
+	case "PROPFIND":
+		err = sess.propfind(w, r, path)
+	case "REPORT":
+		err = sess.report(w, r, path)
+	case http.MethodGet, http.MethodHead:
+		err = sess.get(w, r, path)
+	case http.MethodPut, http.MethodDelete, http.MethodPost, "PROPPATCH", "MKCOL", "MKCALENDAR", "COPY", "MOVE":
+		http.Error(w, "Calendars are read-only", http.StatusForbidden)
+	default:
+		setDAVHeaders(w)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	if err != nil {
+		log.WithError(err).WithField("method", r.Method).WithField("path", r.URL.Path).Error("CalDAV request failed")
+		if errors.Cause(err) == errNotFound {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *caldavServer) authenticate(r *http.Request) (bridgeUser, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, errors.New("missing credentials")
+	}
+
+	user, err := s.bridge.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := user.CheckBridgeLogin(password); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func setDAVHeaders(w http.ResponseWriter) {
+	w.Header().Set("DAV", "1, 3, calendar-access")
+	w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND, REPORT")
+}
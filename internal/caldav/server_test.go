@@ -0,0 +1,169 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package caldav
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	pmapimocks "github.com/ProtonMail/proton-bridge/pkg/pmapi/mocks"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+type testBridge struct {
+	user *testUser
+}
+
+func (b *testBridge) GetUser(query string) (bridgeUser, error) {
+	if query != "user@pm.me" {
+		return nil, errors.New("no such user")
+	}
+	return b.user, nil
+}
+
+type testUser struct {
+	client pmapi.Client
+}
+
+func (u *testUser) ID() string { return "userID" }
+
+func (u *testUser) CheckBridgeLogin(password string) error {
+	if password != "bridgepass" {
+		return errors.New("wrong password")
+	}
+	return nil
+}
+
+func (u *testUser) GetTemporaryPMAPIClient() pmapi.Client { return u.client }
+
+func newTestServer(t *testing.T) (*caldavServer, *pmapimocks.MockClient, func()) {
+	ctrl := gomock.NewController(t)
+	client := pmapimocks.NewMockClient(ctrl)
+
+	return newCalDAVServer(0, nil, &testBridge{user: &testUser{client: client}}, nil), client, ctrl.Finish
+}
+
+func doRequest(s *caldavServer, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.SetBasicAuth("user@pm.me", "bridgepass")
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestUnauthorized(t *testing.T) {
+	s, _, finish := newTestServer(t)
+	defer finish()
+
+	req := httptest.NewRequest("PROPFIND", "/", nil)
+	req.SetBasicAuth("user@pm.me", "wrong")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+}
+
+func TestReadOnly(t *testing.T) {
+	s, _, finish := newTestServer(t)
+	defer finish()
+
+	rec := doRequest(s, http.MethodPut, "/calendars/calendarID/eventID.ics", "BEGIN:VCALENDAR", nil)
+
+	require.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestPropfindCalendarHome(t *testing.T) {
+	s, client, finish := newTestServer(t)
+	defer finish()
+
+	client.EXPECT().ListCalendars(gomock.Any()).Return([]*pmapi.Calendar{{ID: "calendarID", Name: "Personal & Work"}}, nil)
+
+	body := `<?xml version="1.0"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:displayname/><d:resourcetype/><c:unknown/></d:prop>
+</d:propfind>`
+	rec := doRequest(s, "PROPFIND", "/calendars/", body, map[string]string{"Depth": "1"})
+
+	require.Equal(t, http.StatusMultiStatus, rec.Code)
+	require.Contains(t, rec.Body.String(), "/calendars/calendarID/")
+	require.Contains(t, rec.Body.String(), "Personal &amp; Work")
+	require.Contains(t, rec.Body.String(), "HTTP/1.1 404 Not Found")
+}
+
+func TestGetEvent(t *testing.T) {
+	s, client, finish := newTestServer(t)
+	defer finish()
+
+	kr, err := crypto.NewKeyRing(nil)
+	require.NoError(t, err)
+
+	client.EXPECT().GetCalendarEvent(gomock.Any(), "calendarID", "eventID").Return(&pmapi.CalendarEvent{
+		ID:         "eventID",
+		CalendarID: "calendarID",
+		ModifyTime: 42,
+		SharedEvents: []pmapi.Card{
+			{Type: pmapi.CardSigned, Data: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:event@proton.me\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+		},
+	}, nil)
+	client.EXPECT().KeyRingForCalendarID(gomock.Any(), "calendarID").Return(kr, nil)
+
+	rec := doRequest(s, http.MethodGet, "/calendars/calendarID/eventID.ics", "", nil)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, `"42-1"`, rec.Header().Get("ETag"))
+	require.Contains(t, rec.Body.String(), "UID:event@proton.me\r\n")
+}
+
+func TestReportCalendarQuery(t *testing.T) {
+	s, client, finish := newTestServer(t)
+	defer finish()
+
+	client.EXPECT().ListCalendarEvents(gomock.Any(), "calendarID", &pmapi.CalendarEventsFilter{
+		Start:    1600000000,
+		End:      1600086400,
+		PageSize: eventsPageSize,
+	}).Return([]*pmapi.CalendarEvent{{ID: "eventID", CalendarID: "calendarID"}}, nil)
+
+	body := `<?xml version="1.0"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/></d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VEVENT">
+        <c:time-range start="20200913T122640Z" end="20200914T122640Z"/>
+      </c:comp-filter>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>`
+	rec := doRequest(s, "REPORT", "/calendars/calendarID/", body, nil)
+
+	require.Equal(t, http.StatusMultiStatus, rec.Code)
+	require.Contains(t, rec.Body.String(), "/calendars/calendarID/eventID.ics")
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package caldav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// XML namespaces used by CalDAV clients.
+const (
+	nsDAV            = "DAV:"
+	nsCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	nsCalendarServer = "http://calendarserver.org/ns/"
+	nsAppleICal      = "http://apple.com/ns/ical/"
+)
+
+const timeRangeFormat = "20060102T150405Z"
+
+//nolint[gochecknoglobals]
+var (
+	propResourceType            = xml.Name{Space: nsDAV, Local: "resourcetype"}
+	propDisplayName             = xml.Name{Space: nsDAV, Local: "displayname"}
+	propCurrentUserPrincipal    = xml.Name{Space: nsDAV, Local: "current-user-principal"}
+	propPrincipalURL            = xml.Name{Space: nsDAV, Local: "principal-URL"}
+	propCurrentUserPrivilegeSet = xml.Name{Space: nsDAV, Local: "current-user-privilege-set"}
+	propGetETag                 = xml.Name{Space: nsDAV, Local: "getetag"}
+	propGetContentType          = xml.Name{Space: nsDAV, Local: "getcontenttype"}
+	propCalendarHomeSet         = xml.Name{Space: nsCalDAV, Local: "calendar-home-set"}
+	propCalendarDescription     = xml.Name{Space: nsCalDAV, Local: "calendar-description"}
+	propCalendarData            = xml.Name{Space: nsCalDAV, Local: "calendar-data"}
+	propSupportedComponentSet   = xml.Name{Space: nsCalDAV, Local: "supported-calendar-component-set"}
+	propGetCTag                 = xml.Name{Space: nsCalendarServer, Local: "getctag"}
+	propCalendarColor           = xml.Name{Space: nsAppleICal, Local: "calendar-color"}
+)
+
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"DAV: response"`
+}
+
+type response struct {
+	Href      string     `xml:"DAV: href"`
+	Propstats []propstat `xml:"DAV: propstat,omitempty"`
+	Status    string     `xml:"DAV: status,omitempty"`
+}
+
+type propstat struct {
+	Prop   propList `xml:"DAV: prop"`
+	Status string   `xml:"DAV: status"`
+}
+
+type propList struct {
+	Properties []property
+}
+
+type property struct {
+	XMLName xml.Name
+	Inner   string `xml:",innerxml"`
+}
+
+// requestedProps is the content of the DAV:prop element in the request
+// which contains only empty elements with names of the requested properties.
+type requestedProps struct {
+	Names []xml.Name
+}
+
+func (props *requestedProps) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			props.Names = append(props.Names, t.Name)
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+type propfindRequest struct {
+	XMLName xml.Name        `xml:"DAV: propfind"`
+	AllProp *struct{}       `xml:"DAV: allprop"`
+	Prop    *requestedProps `xml:"DAV: prop"`
+}
+
+// reportRequest covers both calendar-query and calendar-multiget reports.
+type reportRequest struct {
+	XMLName xml.Name
+	Prop    *requestedProps `xml:"DAV: prop"`
+	Hrefs   []string        `xml:"DAV: href"`
+	Filter  *compFilter     `xml:"urn:ietf:params:xml:ns:caldav filter>comp-filter"`
+}
+
+type compFilter struct {
+	Name        string       `xml:"name,attr"`
+	TimeRange   *timeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	CompFilters []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type timeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+// getEventTimeRange returns the time range requested for VEVENT components.
+func (filter *compFilter) getEventTimeRange() (start, end time.Time) {
+	if filter == nil {
+		return
+	}
+
+	if strings.EqualFold(filter.Name, "VEVENT") && filter.TimeRange != nil {
+		start, _ = time.Parse(timeRangeFormat, filter.TimeRange.Start)
+		end, _ = time.Parse(timeRangeFormat, filter.TimeRange.End)
+		return
+	}
+
+	for i := range filter.CompFilters {
+		if start, end = filter.CompFilters[i].getEventTimeRange(); !start.IsZero() || !end.IsZero() {
+			return
+		}
+	}
+
+	return
+}
+
+// decodeBody decodes the XML request body. An empty body is not an error.
+func decodeBody(r io.Reader, v interface{}) error {
+	if err := xml.NewDecoder(r).Decode(v); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func writeMultistatus(w http.ResponseWriter, ms *multistatus) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+
+	_, _ = io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(ms); err != nil {
+		log.WithError(err).Error("Failed to write multistatus response")
+	}
+}
+
+func escapeText(s string) string {
+	b := &strings.Builder{}
+	_ = xml.EscapeText(b, []byte(s))
+	return b.String()
+}
+
+func hrefProperty(href string) string {
+	return "<href xmlns=\"DAV:\">" + escapeText(href) + "</href>"
+}
+
+func statusLine(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
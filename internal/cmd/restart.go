@@ -24,6 +24,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/frontend"
 	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/urfave/cli"
@@ -98,6 +99,13 @@ func (ph *PanicHandler) HandlePanic() {
 	}
 
 	config.HandlePanic(ph.Config, fmt.Sprintf("Recover: %v", r))
+
+	report := bridge.NewCrashReport(ph.AppName, ph.Config.GetVersion(), fmt.Sprintf("Recover: %v", r))
+	if path, err := bridge.SaveCrashReport(report); err != nil {
+		log.WithError(err).Error("Cannot save crash report")
+	} else {
+		log.Warn("Crash report saved to ", path)
+	}
 	frontend.HandlePanic(ph.AppName)
 
 	*ph.Err = cli.NewExitError("Panic and restart", 255)
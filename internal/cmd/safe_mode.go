@@ -0,0 +1,196 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/diagnostics"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/updates"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	// After how many unfinished starts in a row app starts in safe mode.
+	maxUnfinishedStarts = 3
+
+	// StartupGracePeriod is how long app has to run to consider its start finished.
+	StartupGracePeriod = 2 * time.Minute
+)
+
+// Recovery options offered in safe mode.
+const (
+	RecoverRepairCache   = "repair-cache"
+	RecoverResetSettings = "reset-settings"
+	RecoverDiagnostics   = "export-diagnostics"
+	RecoverRollback      = "rollback-update"
+)
+
+// StartupGuard counts starts which did not finish, i.e. app crashed or was
+// killed before the grace period and did not quit normally. The count is
+// kept in a file to survive crashes which `HandlePanic` cannot handle.
+type StartupGuard struct {
+	path     string
+	attempts int
+}
+
+// NewStartupGuard records a new start attempt.
+func NewStartupGuard(path string) *StartupGuard {
+	guard := &StartupGuard{path: path}
+
+	if data, err := ioutil.ReadFile(filepath.Clean(path)); err == nil {
+		guard.attempts, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	guard.attempts++
+
+	if err := ioutil.WriteFile(path, []byte(strconv.Itoa(guard.attempts)), 0600); err != nil {
+		log.WithError(err).Warn("Cannot record start attempt")
+	}
+
+	return guard
+}
+
+// IsCrashLoop returns whether several previous starts in a row did not finish.
+func (g *StartupGuard) IsCrashLoop() bool {
+	return g.attempts > maxUnfinishedStarts
+}
+
+// Finish marks the start as finished. It is safe to call it more times.
+func (g *StartupGuard) Finish() {
+	if err := os.Remove(g.path); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Warn("Cannot clear start attempts")
+	}
+}
+
+// PrintSafeModeInfo tells the user why app runs in safe mode and how to
+// get out of it. Rollback is offered only when the previous version was kept
+// after in-place update.
+func PrintSafeModeInfo(cfg *config.Config, crashLoop bool) {
+	if crashLoop {
+		log.Warn("Previous starts did not finish, starting in safe mode")
+		fmt.Println("Bridge did not start successfully several times in a row.")
+	}
+	fmt.Print(`Bridge runs in SAFE MODE: the window is not shown, the local cache is
+read-only and the log is verbose. To recover, quit Bridge and start it with:
+
+  --recover ` + RecoverRepairCache + `        to rebuild the local cache from the server
+  --recover ` + RecoverResetSettings + `      to restore the default settings
+  --recover ` + RecoverDiagnostics + `  to save logs for the support
+`)
+	if version := updates.GetRollbackVersion(cfg.GetRollbackDir()); version != "" {
+		fmt.Print(`  --recover ` + RecoverRollback + `     to go back to version ` + version + `
+`)
+	}
+	fmt.Println()
+}
+
+// Recover runs one of the recovery options offered in safe mode.
+func Recover(cfg *config.Config, pref *config.Preferences, option string) error {
+	switch option {
+	case RecoverRepairCache:
+		return repairCache(cfg, pref)
+	case RecoverResetSettings:
+		return resetSettings(cfg)
+	case RecoverDiagnostics:
+		return exportDiagnostics(cfg)
+	case RecoverRollback:
+		return rollbackUpdate(cfg)
+	default:
+		return fmt.Errorf("unknown recovery option %q", option)
+	}
+}
+
+func repairCache(cfg *config.Config, pref *config.Preferences) error {
+	if err := cfg.ClearCache(); err != nil {
+		return errors.Wrap(err, "failed to clear cache")
+	}
+
+	// Caches can be moved outside of the default cache folder.
+	if dir := pref.Get(preferences.CacheDirKey); dir != "" {
+		for _, name := range []string{"messages", "attachments"} {
+			if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+				return errors.Wrap(err, "failed to clear cache")
+			}
+		}
+	}
+
+	fmt.Println("Local cache was removed and will be rebuilt from the server on the next start.")
+	return nil
+}
+
+func resetSettings(cfg *config.Config) error {
+	if err := os.Remove(cfg.GetPreferencesPath()); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove settings")
+	}
+
+	fmt.Println("Settings were reset to default values.")
+	return nil
+}
+
+func rollbackUpdate(cfg *config.Config) error {
+	version, err := updates.Rollback(cfg.GetRollbackDir())
+	if err != nil {
+		return errors.Wrap(err, "failed to roll back update")
+	}
+
+	fmt.Println("Bridge was rolled back to version", version+".")
+	return nil
+}
+
+func exportDiagnostics(cfg *config.Config) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return errors.Wrap(err, "failed to find home directory")
+	}
+	path := filepath.Join(home, fmt.Sprintf("bridge-diagnostics-%d.zip", time.Now().Unix()))
+
+	file, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to create diagnostics file")
+	}
+
+	info := diagnostics.Info{
+		Version:   cfg.GetVersion(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		Created:   time.Now(),
+	}
+
+	diagnostics.SetReproDir(cfg.GetReproDir())
+	if err := diagnostics.WriteBundle(file, info, cfg.GetLogDir()); err != nil {
+		_ = file.Close()
+		return errors.Wrap(err, "failed to write diagnostics")
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.Wrap(err, "failed to write diagnostics")
+	}
+
+	fmt.Println("Diagnostics with redacted email addresses and subjects were saved to\n\n ", path)
+	return nil
+}
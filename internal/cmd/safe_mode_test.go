@@ -0,0 +1,46 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartupGuardDetectsCrashLoop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "startup_attempts")
+
+	for i := 0; i < maxUnfinishedStarts; i++ {
+		require.False(t, NewStartupGuard(path).IsCrashLoop())
+	}
+	require.True(t, NewStartupGuard(path).IsCrashLoop())
+
+	// A finished start resets the count.
+	guard := NewStartupGuard(path)
+	guard.Finish()
+	guard.Finish()
+	require.False(t, NewStartupGuard(path).IsCrashLoop())
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package diagnostics writes information useful for support into a single
+// zip file which users can attach to a support ticket. Email addresses and
+// message subjects are redacted from everything written to the bundle.
+package diagnostics
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/incidents"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxLogLineSize is the longest log line copied to the bundle; longer
+	// lines (e.g. dumped message bodies) are skipped.
+	maxLogLineSize = 1024 * 1024
+
+	redactedEmail   = "[email]"
+	redactedSubject = "[subject]"
+)
+
+var (
+	emailRgx = regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9\-]+(\.[a-zA-Z0-9\-]+)+`) //nolint[gochecknoglobals]
+
+	// Subject as JSON field, logrus text field or message header.
+	subjectJSONRgx   = regexp.MustCompile(`(?i)("subject"\s*:\s*)"(\\.|[^"\\])*"`) //nolint[gochecknoglobals]
+	subjectFieldRgx  = regexp.MustCompile(`(?i)(\bsubject=)("(\\.|[^"\\])*"|\S*)`) //nolint[gochecknoglobals]
+	subjectHeaderRgx = regexp.MustCompile(`(?i)(subject:)[^\r\n\\"]*`)             //nolint[gochecknoglobals]
+)
+
+// Info is the summary written to the bundle as info.json.
+type Info struct {
+	Version   string
+	OS        string
+	Arch      string
+	GoVersion string
+	Created   time.Time
+	Accounts  []Account
+
+	// APIRetries are counts of API requests retried since start by HTTP
+	// status or API code.
+	APIRetries pmapi.RetryMetrics
+
+	Incidents []Incident
+}
+
+// Account describes one account without any personal data.
+type Account struct {
+	Connected  bool
+	Combined   bool
+	Addresses  int
+	Store      *store.Statistics `json:",omitempty"`
+	StoreError string            `json:",omitempty"`
+}
+
+// Incident is an entry of the incident log with redacted message.
+type Incident struct {
+	Kind    incidents.Kind
+	Account int `json:",omitempty"` // Index of the account starting at one.
+	Message string
+	First   time.Time
+	Last    time.Time
+	Count   int
+}
+
+// NewIncidents returns incidents with redacted messages. User IDs are
+// replaced by the index of the account in userIDs starting at one.
+func NewIncidents(list []incidents.Incident, userIDs []string) []Incident {
+	redacted := []Incident{}
+	for _, incident := range list {
+		account := 0
+		for i, userID := range userIDs {
+			if userID == incident.UserID {
+				account = i + 1
+			}
+		}
+		redacted = append(redacted, Incident{
+			Kind:    incident.Kind,
+			Account: account,
+			Message: Redact(incident.Message),
+			First:   incident.First,
+			Last:    incident.Last,
+			Count:   incident.Count,
+		})
+	}
+	return redacted
+}
+
+// Redact replaces email addresses and message subjects in the text.
+func Redact(text string) string {
+	text = subjectJSONRgx.ReplaceAllString(text, `$1"`+redactedSubject+`"`)
+	text = subjectFieldRgx.ReplaceAllString(text, "${1}"+redactedSubject)
+	text = subjectHeaderRgx.ReplaceAllString(text, "$1 "+redactedSubject)
+	return emailRgx.ReplaceAllString(text, redactedEmail)
+}
+
+// WriteBundle writes the zip with the info, redacted log files found
+// in logDir and saved reproduction bundles of messages.
+func WriteBundle(w io.Writer, info Info, logDir string) error {
+	zipWriter := zip.NewWriter(w)
+
+	infoWriter, err := zipWriter.Create("info.json")
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(infoWriter)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(info); err != nil {
+		return errors.Wrap(err, "failed to write info")
+	}
+
+	logs, err := getLogFiles(logDir)
+	if err != nil {
+		return errors.Wrap(err, "failed to list logs")
+	}
+
+	for _, name := range logs {
+		if err := writeLog(zipWriter, logDir, name); err != nil {
+			return errors.Wrap(err, "failed to write log "+name)
+		}
+	}
+
+	if err := writeRepros(zipWriter); err != nil {
+		return errors.Wrap(err, "failed to write reproduction bundles")
+	}
+
+	return zipWriter.Close()
+}
+
+func getLogFiles(logDir string) (names []string, err error) {
+	files, err := ioutil.ReadDir(logDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".log") {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func writeLog(zipWriter *zip.Writer, logDir, name string) error {
+	f, err := os.Open(filepath.Join(logDir, name)) //nolint[gosec]
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint[errcheck]
+
+	w, err := zipWriter.Create("logs/" + name)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(f, 64*1024)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 && len(line) <= maxLogLineSize {
+			if _, err := io.WriteString(w, Redact(line)); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package diagnostics
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/incidents"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{`{"level":"info","msg":"Login","user":"john.doe@pm.me"}`, `{"level":"info","msg":"Login","user":"[email]"}`},
+		{`{"Subject":"Secret \"plan\"","msg":"Imported"}`, `{"Subject":"[subject]","msg":"Imported"}`},
+		{`level=debug msg=Appended subject="Secret plan" mailbox=INBOX`, `level=debug msg=Appended subject=[subject] mailbox=INBOX`},
+		{`level=debug msg=Appended subject=Secret mailbox=INBOX`, `level=debug msg=Appended subject=[subject] mailbox=INBOX`},
+		{`{"msg":"From: a@b.cz\r\nSubject: Secret plan\r\nTo: c@d.org"}`, `{"msg":"From: [email]\r\nSubject: [subject]\r\nTo: [email]"}`},
+		{`Cannot sync mailbox INBOX`, `Cannot sync mailbox INBOX`},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.want, Redact(test.text))
+	}
+}
+
+func TestNewIncidents(t *testing.T) {
+	now := time.Now()
+	list := NewIncidents([]incidents.Incident{
+		{Kind: incidents.SyncFailed, UserID: "user2", Message: "sync of bob@pm.me failed", First: now, Last: now, Count: 2},
+		{Kind: incidents.APIUnreachable, Message: "no internet", First: now, Last: now, Count: 1},
+	}, []string{"user1", "user2"})
+
+	require.Len(t, list, 2)
+	require.Equal(t, 2, list[0].Account)
+	require.Equal(t, "sync of [email] failed", list[0].Message)
+	require.Equal(t, 0, list[1].Account)
+}
+
+func TestWriteBundle(t *testing.T) {
+	logDir, err := ioutil.TempDir("", "diagnostics")
+	require.NoError(t, err)
+	defer os.RemoveAll(logDir) //nolint[errcheck]
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(logDir, "v1_1.log"), []byte(`{"msg":"Login","user":"john@pm.me"}`+"\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(logDir, "other.txt"), []byte("john@pm.me"), 0600))
+
+	b := &bytes.Buffer{}
+	require.NoError(t, WriteBundle(b, Info{Version: "1.5.0", OS: "linux"}, logDir))
+
+	r, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	require.NoError(t, err)
+	require.Len(t, r.File, 2)
+	require.Equal(t, "info.json", r.File[0].Name)
+	require.Equal(t, "logs/v1_1.log", r.File[1].Name)
+
+	f, err := r.File[1].Open()
+	require.NoError(t, err)
+	defer f.Close() //nolint[errcheck]
+	content, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, `{"msg":"Login","user":"[email]"}`+"\n", string(content))
+}
+
+func TestSaveRepro(t *testing.T) {
+	logDir, err := ioutil.TempDir("", "diagnostics")
+	require.NoError(t, err)
+	defer os.RemoveAll(logDir) //nolint[errcheck]
+
+	SetReproDir(filepath.Join(logDir, "repro"))
+	defer SetReproDir("")
+
+	for i := 0; i < maxRepros+2; i++ {
+		repro := message.NewRepro(&pmapi.Message{ID: fmt.Sprint("msg", i)}, message.ReproBuildFailed, errors.New("failed"), time.Now())
+		require.NoError(t, SaveRepro(repro))
+	}
+	// Repeated failure of the same message does not replace the first one.
+	require.NoError(t, SaveRepro(message.NewRepro(&pmapi.Message{ID: "msg10"}, message.ReproDecryptFailed, errors.New("failed"), time.Now())))
+
+	files, err := getReproFiles(filepath.Join(logDir, "repro"))
+	require.NoError(t, err)
+	require.Len(t, files, maxRepros)
+
+	b := &bytes.Buffer{}
+	require.NoError(t, WriteBundle(b, Info{}, logDir))
+
+	r, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	require.NoError(t, err)
+	require.Len(t, r.File, maxRepros+1)
+	require.True(t, strings.HasPrefix(r.File[1].Name, "repro/"))
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package diagnostics
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+)
+
+// maxRepros is how many reproduction bundles are kept; the oldest are removed.
+const maxRepros = 50
+
+var (
+	reproDir     string       //nolint[gochecknoglobals]
+	reproDirLock sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetReproDir sets the folder where reproduction bundles of messages which
+// failed to build are saved. Empty dir disables saving.
+func SetReproDir(dir string) {
+	reproDirLock.Lock()
+	defer reproDirLock.Unlock()
+
+	reproDir = dir
+}
+
+func getReproDir() string {
+	reproDirLock.RLock()
+	defer reproDirLock.RUnlock()
+
+	return reproDir
+}
+
+// SaveRepro saves the reproduction bundle to be included in the next
+// diagnostics bundle. Only the first failure of each message is kept.
+func SaveRepro(repro *message.Repro) error {
+	dir := getReproDir()
+	if dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256([]byte(repro.MessageID))
+	path := filepath.Join(dir, hex.EncodeToString(hash[:8])+".json")
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(repro, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return err
+	}
+
+	return pruneRepros(dir)
+}
+
+func pruneRepros(dir string) error {
+	files, err := getReproFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	if len(files) <= maxRepros {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	for _, file := range files[:len(files)-maxRepros] {
+		if err := os.Remove(filepath.Join(dir, file.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getReproFiles(dir string) (repros []os.FileInfo, err error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
+			repros = append(repros, file)
+		}
+	}
+
+	return repros, nil
+}
+
+// writeRepros copies saved reproduction bundles to the zip. They are
+// redacted already when saved.
+func writeRepros(zipWriter *zip.Writer) error {
+	dir := getReproDir()
+	if dir == "" {
+		return nil
+	}
+
+	files, err := getReproFiles(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dir, file.Name())) //nolint[gosec]
+		if err != nil {
+			return err
+		}
+
+		w, err := zipWriter.Create("repro/" + file.Name())
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -41,6 +41,12 @@ const (
 	UpgradeApplicationEvent      = "upgradeApplication"
 	TLSCertIssue                 = "tlsCertPinningIssue"
 	IMAPTLSBadCert               = "imapTLSBadCert"
+	LocalRuleNotificationEvent   = "localRuleNotification"
+	NewMessageEvent              = "newMessage"
+	SyncFinishedEvent            = "syncFinished"
+	SendFailedEvent              = "sendFailed"
+	SendPolicyWarningEvent       = "sendPolicyWarning"
+	ListenerSettingsChangedEvent = "listenerSettingsChanged"
 
 	// LogoutEventTimeout is the minimum time to permit between logout events being sent.
 	LogoutEventTimeout = 3 * time.Minute
@@ -0,0 +1,238 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("pkg", "events") //nolint[gochecknoglobals]
+
+// Types of events sent by Publisher.
+const (
+	PublishedNewMessage   = "new_message"
+	PublishedSyncFinished = "sync_finished"
+	PublishedAuthExpired  = "auth_expired"
+	PublishedSendFailed   = "send_failed"
+)
+
+// publishedEvents maps events of the event listener to types sent by
+// Publisher. Data of all of them start with the user ID, optionally
+// followed by a colon and the message ID or the error.
+var publishedEvents = map[string]string{ //nolint[gochecknoglobals]
+	NewMessageEvent:   PublishedNewMessage,
+	SyncFinishedEvent: PublishedSyncFinished,
+	LogoutEvent:       PublishedAuthExpired,
+	SendFailedEvent:   PublishedSendFailed,
+}
+
+// publishWriteTimeout is how long a slow client can block the publishing.
+const publishWriteTimeout = time.Second
+
+// PublishedEvent is one line of JSON sent by Publisher.
+type PublishedEvent struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Account   string    `json:"account"`
+	MessageID string    `json:"message_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+func newPublishedEvent(eventName, data string, now time.Time) PublishedEvent {
+	event := PublishedEvent{Type: publishedEvents[eventName], Time: now}
+
+	parts := strings.SplitN(data, ":", 2)
+	event.Account = parts[0]
+	if len(parts) == 2 {
+		switch eventName {
+		case NewMessageEvent:
+			event.MessageID = parts[1]
+		case SendFailedEvent:
+			event.Error = parts[1]
+		}
+	}
+	return event
+}
+
+// Publisher sends selected bridge events as JSON lines to every client
+// connected to the local unix socket, so desktop automation tools and
+// notifier scripts can react to them. Clients only read; anything they
+// write is ignored.
+type Publisher struct {
+	listener listener.Listener
+	path     string
+
+	lock     sync.Mutex
+	ln       net.Listener
+	clients  map[net.Conn]bool
+	channels map[string]chan string
+	done     chan struct{}
+}
+
+// NewPublisher returns publisher of events of the listener on the unix
+// socket at path.
+func NewPublisher(listener listener.Listener, path string) *Publisher {
+	return &Publisher{
+		listener: listener,
+		path:     path,
+		clients:  map[net.Conn]bool{},
+		channels: map[string]chan string{},
+		done:     make(chan struct{}),
+	}
+}
+
+// ListenAndServe accepts clients until the publisher is closed.
+func (p *Publisher) ListenAndServe() error {
+	// Folder of the socket is private so nobody reads events between
+	// listen and chmod.
+	dir := filepath.Dir(p.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return err
+	}
+
+	// Only one bridge runs at a time, so an existing socket is a leftover.
+	if err := os.Remove(p.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	ln, err := net.Listen("unix", p.path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(p.path, 0600); err != nil {
+		_ = ln.Close()
+		return err
+	}
+
+	p.lock.Lock()
+	p.ln = ln
+	for eventName := range publishedEvents {
+		ch := make(chan string)
+		p.channels[eventName] = ch
+		p.listener.Add(eventName, ch)
+		go p.forward(eventName, ch)
+	}
+	p.lock.Unlock()
+
+	log.Info("Events published at ", p.path)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-p.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		p.addClient(conn)
+	}
+}
+
+// Close stops accepting clients and disconnects the current ones.
+func (p *Publisher) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	default:
+		close(p.done)
+	}
+
+	for eventName, ch := range p.channels {
+		p.listener.Remove(eventName, ch)
+	}
+	for conn := range p.clients {
+		_ = conn.Close()
+	}
+	p.clients = map[net.Conn]bool{}
+
+	if p.ln == nil {
+		return nil
+	}
+	return p.ln.Close()
+}
+
+func (p *Publisher) forward(eventName string, ch <-chan string) {
+	for {
+		select {
+		case data := <-ch:
+			p.publish(newPublishedEvent(eventName, data, time.Now()))
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *Publisher) addClient(conn net.Conn) {
+	p.lock.Lock()
+	p.clients[conn] = true
+	p.lock.Unlock()
+
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, conn)
+		p.removeClient(conn)
+	}()
+}
+
+func (p *Publisher) removeClient(conn net.Conn) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.clients[conn] {
+		delete(p.clients, conn)
+		_ = conn.Close()
+	}
+}
+
+func (p *Publisher) publish(event PublishedEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.WithError(err).Error("Cannot encode published event")
+		return
+	}
+	line = append(line, '\n')
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for conn := range p.clients {
+		_ = conn.SetWriteDeadline(time.Now().Add(publishWriteTimeout))
+		if _, err := conn.Write(line); err != nil {
+			log.WithError(err).Debug("Disconnecting client of events")
+			delete(p.clients, conn)
+			_ = conn.Close()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPublishedEvent(t *testing.T) {
+	now := time.Now()
+
+	require.Equal(t, PublishedEvent{Type: PublishedNewMessage, Time: now, Account: "user", MessageID: "msg"}, newPublishedEvent(NewMessageEvent, "user:msg", now))
+	require.Equal(t, PublishedEvent{Type: PublishedSyncFinished, Time: now, Account: "user"}, newPublishedEvent(SyncFinishedEvent, "user", now))
+	require.Equal(t, PublishedEvent{Type: PublishedAuthExpired, Time: now, Account: "user"}, newPublishedEvent(LogoutEvent, "user", now))
+	require.Equal(t, PublishedEvent{Type: PublishedSendFailed, Time: now, Account: "user", Error: "550: rejected"}, newPublishedEvent(SendFailedEvent, "user:550: rejected", now))
+}
+
+func TestPublisher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	eventListener := listener.New()
+	path := filepath.Join(dir, "events", "events.sock")
+	publisher := NewPublisher(eventListener, path)
+
+	served := make(chan error)
+	go func() { served <- publisher.ListenAndServe() }()
+
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		conn, err = net.Dial("unix", path)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	defer conn.Close() //nolint[errcheck]
+
+	dirInfo, err := os.Stat(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), dirInfo.Mode().Perm())
+
+	// The client is registered asynchronously after it connects.
+	require.Eventually(t, func() bool {
+		publisher.lock.Lock()
+		defer publisher.lock.Unlock()
+		return len(publisher.clients) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	eventListener.Emit(NewMessageEvent, "user:msg")
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	require.NoError(t, err)
+
+	var event PublishedEvent
+	require.NoError(t, json.Unmarshal(line, &event))
+	require.Equal(t, PublishedNewMessage, event.Type)
+	require.Equal(t, "user", event.Account)
+	require.Equal(t, "msg", event.MessageID)
+
+	require.NoError(t, publisher.Close())
+	require.NoError(t, <-served)
+}
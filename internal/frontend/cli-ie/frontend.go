@@ -163,6 +163,10 @@ func New( //nolint[funlen]
 		Help: "export messages to mbox files.",
 		Func: fe.noAccountWrapper(fe.exportMessagesToMBOX),
 	})
+	exportCmd.AddCmd(&ishell.Cmd{Name: "html",
+		Help: "export messages of one folder or label to static HTML archive.",
+		Func: fe.noAccountWrapper(fe.exportMessagesToHTML),
+	})
 	fe.AddCmd(exportCmd)
 
 	// System commands.
@@ -170,6 +174,23 @@ func New( //nolint[funlen]
 		Help: "restart the Import-Export app.",
 		Func: fe.restart,
 	})
+	crashCmd := &ishell.Cmd{Name: "crash-reports",
+		Help: "list crash reports saved on this computer. Nothing is sent until you use `crash-reports send`.",
+		Func: fe.listCrashReports,
+	}
+	crashCmd.AddCmd(&ishell.Cmd{Name: "show",
+		Help: "print everything the crash report would send. Optional number from the list, the latest by default.",
+		Func: fe.showCrashReport,
+	})
+	crashCmd.AddCmd(&ishell.Cmd{Name: "send",
+		Help: "send the crash reports to ProtonMail to help fix the problem and remove them.",
+		Func: fe.sendCrashReports,
+	})
+	crashCmd.AddCmd(&ishell.Cmd{Name: "discard",
+		Help: "remove the crash reports without sending them.",
+		Func: fe.discardCrashReports,
+	})
+	fe.AddCmd(crashCmd)
 
 	go func() {
 		defer panicHandler.HandlePanic()
@@ -232,6 +253,7 @@ Welcome to ProtonMail Import-Export app interactive shell
 
 WARNING: The CLI is an experimental feature and does not yet cover all functionality.
 	`)
+	f.notifyCrashReports()
 	f.Run()
 	return nil
 }
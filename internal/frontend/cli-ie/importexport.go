@@ -98,6 +98,47 @@ func (f *frontendCLI) exportMessagesToMBOX(c *ishell.Context) {
 	f.transfer(t, err, true, false)
 }
 
+func (f *frontendCLI) exportMessagesToHTML(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	user, path := f.getUserAndPath(c, true)
+	if user == nil || path == "" {
+		return
+	}
+
+	t, err := f.ie.GetHTMLExporter(user.GetPrimaryAddress(), path)
+	if err != nil {
+		f.printAndLogError("Failed to init transferrer: ", err)
+		return
+	}
+
+	mailboxName := f.readStringInAttempts("Folder or label to export", c.ReadLine, isNotEmpty)
+	if mailboxName == "" {
+		return
+	}
+
+	// Only the selected mailbox is exported to its own archive.
+	found := false
+	for _, rule := range t.GetRules() {
+		if !strings.EqualFold(rule.SourceMailbox.Name, mailboxName) {
+			t.UnsetRule(rule.SourceMailbox)
+			continue
+		}
+		if err := t.SetRule(rule.SourceMailbox, rule.TargetMailboxes, rule.FromTime, rule.ToTime); err != nil {
+			f.printAndLogError("Failed to set rule: ", err)
+			return
+		}
+		found = true
+	}
+	if !found {
+		f.Println("Folder or label", mailboxName, "was not found.")
+		return
+	}
+
+	f.transfer(t, nil, true, false)
+}
+
 func (f *frontendCLI) getUserAndPath(c *ishell.Context, createPath bool) (types.User, string) {
 	user := f.askUserByIndexOrName(c)
 	if user == nil {
@@ -21,8 +21,11 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/abiosoft/ishell"
 )
 
@@ -98,3 +101,78 @@ func (f *frontendCLI) getUserByIndexOrName(arg string) types.User {
 	}
 	return nil
 }
+
+// getUserPorts returns the IMAP and SMTP ports the user should connect to,
+// i.e. ports dedicated to the account when there are any.
+func getUserPorts(bridge types.Bridger, pref *config.Preferences, user types.User) (imapPort, smtpPort int) {
+	if accountPorts, ok := bridge.GetAccountPorts()[user.ID()]; ok {
+		return accountPorts.IMAP, accountPorts.SMTP
+	}
+	return pref.GetInt(preferences.IMAPPortKey), pref.GetInt(preferences.SMTPPortKey)
+}
+
+// accountListItem is an account printed by the list command for pipe filters.
+type accountListItem struct {
+	Index       int    `json:"index"`
+	Account     string `json:"account"`
+	Status      string `json:"status"`
+	AddressMode string `json:"address_mode"`
+}
+
+// accountAddressInfo is a client configuration printed by the info command
+// for pipe filters.
+// formatMegabytes returns the size in bytes as megabytes with one decimal.
+func formatMegabytes(size int64) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+}
+
+type accountAddressInfo struct {
+	Address             string `json:"address"`
+	Host                string `json:"host"`
+	IMAPPort            int    `json:"imap_port"`
+	IMAPSecurity        string `json:"imap_security"`
+	SMTPPort            int    `json:"smtp_port"`
+	SMTPSecurity        string `json:"smtp_security"`
+	SMTPImplicitTLSPort int    `json:"smtp_implicit_tls_port,omitempty"`
+	Username            string `json:"username"`
+	Password            string `json:"password"`
+}
+
+type outboxItem struct {
+	SendAt    time.Time `json:"send_at"`
+	From      string    `json:"from"`
+	To        []string  `json:"to"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+type retentionItem struct {
+	MessageID string    `json:"message_id"`
+	Mailbox   string    `json:"mailbox"`
+	Action    string    `json:"action"`
+	Subject   string    `json:"subject"`
+	Time      time.Time `json:"time"`
+	AppliedAt time.Time `json:"applied_at,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type duplicateItem struct {
+	ExternalID string    `json:"external_id"`
+	Subject    string    `json:"subject"`
+	Time       time.Time `json:"time"`
+	Keep       string    `json:"keep"`
+	Extras     []string  `json:"extras"`
+}
+
+type syncReportItem struct {
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	Elapsed   string    `json:"elapsed"`
+	Resumed   bool      `json:"resumed"`
+	Synced    int       `json:"synced"`
+	Skipped   int       `json:"skipped"`
+	Deleted   int       `json:"deleted"`
+	FailedIDs []string  `json:"failed_ids"`
+	Bytes     int64     `json:"bytes"`
+	Error     string    `json:"error,omitempty"`
+}
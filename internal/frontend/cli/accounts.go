@@ -18,17 +18,32 @@
 package cli
 
 import (
+	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/wizard"
+	"github.com/ProtonMail/proton-bridge/internal/imap/cache"
+	"github.com/ProtonMail/proton-bridge/internal/importer"
+	"github.com/ProtonMail/proton-bridge/internal/migration"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/internal/store/archive"
+	"github.com/ProtonMail/proton-bridge/internal/store/search"
+	"github.com/ProtonMail/proton-bridge/internal/users"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/abiosoft/ishell"
 )
 
 func (f *frontendCLI) listAccounts(c *ishell.Context) {
 	spacing := "%-2d: %-20s (%-15s, %-15s)\n"
 	f.Printf(bold(strings.Replace(spacing, "d", "s", -1)), "#", "account", "status", "address mode")
+	accounts := []accountListItem{}
 	for idx, user := range f.bridge.GetUsers() {
 		connected := "disconnected"
 		if user.IsConnected() {
@@ -39,8 +54,31 @@ func (f *frontendCLI) listAccounts(c *ishell.Context) {
 			mode = "combined"
 		}
 		f.Printf(spacing, idx, user.Username(), connected, mode)
+		accounts = append(accounts, accountListItem{Index: idx, Account: user.Username(), Status: connected, AddressMode: mode})
 	}
 	f.Println()
+	f.setPipeData(accounts)
+	f.printLoadingAccounts()
+	if f.bridge.IsWaitingForKeychain() {
+		f.notifyWaitingForKeychain()
+	}
+}
+
+// printLoadingAccounts prints accounts which are still being loaded in
+// background or failed to load at startup.
+func (f *frontendCLI) printLoadingAccounts() {
+	for _, progress := range f.bridge.GetStartupProgress() {
+		name := progress.Username
+		if name == "" {
+			name = progress.UserID
+		}
+		switch progress.State {
+		case users.StartupWaiting, users.StartupLoading:
+			f.Printf("Account %s is still being loaded.\n", bold(name))
+		case users.StartupFailed:
+			f.Printf("Account %s failed to load: %s\n", bold(name), progress.Error)
+		}
+	}
 }
 
 func (f *frontendCLI) showAccountInfo(c *ishell.Context) {
@@ -54,37 +92,681 @@ func (f *frontendCLI) showAccountInfo(c *ishell.Context) {
 		return
 	}
 
+	infos := []accountAddressInfo{}
 	if user.IsCombinedAddressMode() {
-		f.showAccountAddressInfo(user, user.GetPrimaryAddress())
+		infos = append(infos, f.showAccountAddressInfo(user, user.GetPrimaryAddress()))
 	} else {
 		for _, address := range user.GetAddresses() {
-			f.showAccountAddressInfo(user, address)
+			infos = append(infos, f.showAccountAddressInfo(user, address))
+		}
+	}
+	f.showAccountUsage(user)
+	f.setPipeData(infos)
+}
+
+// showAccountUsage prints the disk usage of the local database and caches
+// of the account.
+func (f *frontendCLI) showAccountUsage(user types.User) {
+	stats, err := user.GetStoreStatistics()
+	if err != nil {
+		f.printAndLogError("Cannot get local storage usage:", err)
+		return
+	}
+
+	f.Println(bold("Local storage of " + user.Username()))
+	f.Printf("Database:          %s\nMessages:          %d in %d mailboxes\nMessage cache:     %s (%d messages)\nAttachment cache:  %s\n",
+		formatMegabytes(stats.DatabaseSize),
+		stats.Messages,
+		stats.Mailboxes,
+		formatMegabytes(stats.MessageCacheSize),
+		stats.CachedMessages,
+		formatMegabytes(stats.AttachmentCacheSize),
+	)
+	if status, err := user.GetCompactionStatus(); err == nil {
+		switch {
+		case status.Running:
+			f.Printf("Database is being compacted (%.0f %%).\n", status.Progress*100)
+		case status.LastError != "":
+			f.Printf("Last compaction on %s failed: %s\n", status.LastTime.Format("2006-01-02 15:04"), status.LastError)
+		case !status.LastTime.IsZero():
+			f.Printf("Database was compacted on %s from %s to %s.\n", status.LastTime.Format("2006-01-02 15:04"), formatMegabytes(status.SizeBefore), formatMegabytes(status.SizeAfter))
 		}
 	}
+	f.Println("Use `store compact` to remove cached messages which are no longer in the account and `store vacuum` to compact the database.")
+	f.Println("")
 }
 
-func (f *frontendCLI) showAccountAddressInfo(user types.User, address string) {
+func (f *frontendCLI) showAccountAddressInfo(user types.User, address string) accountAddressInfo {
 	smtpSecurity := "STARTTLS"
 	if f.preferences.GetBool(preferences.SMTPSSLKey) {
 		smtpSecurity = "SSL"
 	}
-	f.Println(bold("Configuration for " + address))
-	f.Printf("IMAP Settings\nAddress:   %s\nIMAP port: %d\nUsername:  %s\nPassword:  %s\nSecurity:  %s\n",
-		bridge.Host,
-		f.preferences.GetInt(preferences.IMAPPortKey),
-		address,
-		user.GetBridgePassword(),
-		"STARTTLS",
-	)
-	f.Println("")
-	f.Printf("SMTP Settings\nAddress:   %s\nIMAP port: %d\nUsername:  %s\nPassword:  %s\nSecurity:  %s\n",
-		bridge.Host,
-		f.preferences.GetInt(preferences.SMTPPortKey),
-		address,
-		user.GetBridgePassword(),
-		smtpSecurity,
-	)
-	f.Println("")
+	imapPort, smtpPort := getUserPorts(f.bridge, f.preferences, user)
+	info := accountAddressInfo{
+		Address:             address,
+		Host:                bridge.Host,
+		IMAPPort:            imapPort,
+		IMAPSecurity:        "STARTTLS",
+		SMTPPort:            smtpPort,
+		SMTPSecurity:        smtpSecurity,
+		SMTPImplicitTLSPort: f.preferences.GetInt(preferences.SMTPImplicitTLSPortKey),
+		Username:            address,
+		Password:            user.GetBridgePassword(),
+	}
+	f.Println(bold("Configuration for " + address))
+	f.Printf("IMAP Settings\nAddress:   %s\nIMAP port: %d\nUsername:  %s\nPassword:  %s\nSecurity:  %s\n",
+		info.Host,
+		info.IMAPPort,
+		info.Username,
+		info.Password,
+		info.IMAPSecurity,
+	)
+	f.Println("")
+	f.Printf("SMTP Settings\nAddress:   %s\nIMAP port: %d\nUsername:  %s\nPassword:  %s\nSecurity:  %s\n",
+		info.Host,
+		info.SMTPPort,
+		info.Username,
+		info.Password,
+		info.SMTPSecurity,
+	)
+	if info.SMTPImplicitTLSPort != 0 {
+		f.Printf("SMTP port with SSL (implicit TLS): %d\n", info.SMTPImplicitTLSPort)
+	}
+	f.Println("")
+	return info
+}
+
+func (f *frontendCLI) showAccessToken(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	if !user.IsConnected() {
+		f.Printf("Please login to %s to get access token.\n", bold(user.Username()))
+		return
+	}
+
+	token, expires := user.GenerateAccessToken()
+	f.Printf("Access token for %s (use as XOAUTH2 or OAUTHBEARER bearer token, valid until %s):\n%s\n",
+		bold(user.Username()), expires.Format(time.RFC1123), token)
+
+	refreshToken, err := user.GenerateRefreshToken()
+	if err != nil {
+		f.printAndLogError("Cannot generate refresh token:", err)
+		return
+	}
+	f.Printf("Refresh token (exchange for new access token at https://%s:%s/oauth/token):\n%s\n",
+		bridge.Host, f.preferences.Get(preferences.APIPortKey), refreshToken)
+}
+
+func (f *frontendCLI) undeleteMessages(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	if !user.IsConnected() {
+		f.Printf("Please login to %s to restore messages.\n", bold(user.Username()))
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	hours := f.readStringInAttempts("Restore messages deleted in the last hours (empty for all)", c.ReadLine, func(val string) bool {
+		number, err := strconv.Atoi(val)
+		return val == "" || (err == nil && number > 0)
+	})
+
+	since := time.Time{}
+	if hours != "" {
+		number, _ := strconv.Atoi(hours)
+		since = time.Now().Add(-time.Duration(number) * time.Hour)
+	}
+
+	restored, missing, err := user.UndeleteMessages(since)
+	if err != nil {
+		f.printAndLogError("Cannot restore messages:", err)
+	}
+	f.Printf("Restored %d messages of %s.\n", restored, bold(user.Username()))
+	if missing > 0 {
+		f.Printf("%d messages cannot be restored because they are not in the local message cache.\n", missing)
+	}
+}
+
+func (f *frontendCLI) uploadSettings(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	if !user.IsConnected() {
+		f.Printf("Please login to %s to upload settings.\n", bold(user.Username()))
+		return
+	}
+
+	if err := f.bridge.UploadSettings(user.Username()); err != nil {
+		f.printAndLogError("Cannot upload settings:", err)
+		return
+	}
+	f.Printf("Settings were uploaded to %s. Use `settings download` on your other computers to apply them.\n", bold(user.Username()))
+}
+
+func (f *frontendCLI) downloadSettings(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	if !user.IsConnected() {
+		f.Printf("Please login to %s to download settings.\n", bold(user.Username()))
+		return
+	}
+
+	if err := f.bridge.DownloadSettings(user.Username()); err != nil {
+		if err == store.ErrNoSyncedSettings {
+			f.Printf("No settings were uploaded to %s yet.\n", bold(user.Username()))
+			return
+		}
+		f.printAndLogError("Cannot download settings:", err)
+		return
+	}
+	f.Println("Settings were applied. Restart Bridge to use all of them.")
+}
+
+func (f *frontendCLI) showOutbox(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	msgs, err := user.GetScheduledMessages()
+	if err != nil {
+		f.printAndLogError("Cannot read outbox:", err)
+		return
+	}
+
+	if len(msgs) == 0 {
+		f.Printf("Outbox of %s is empty.\n", bold(user.Username()))
+	}
+
+	items := []outboxItem{}
+	for _, msg := range msgs {
+		f.Printf("%s  from %s to %s", msg.SendAt.Format(time.RFC1123), msg.From, strings.Join(msg.To, ", "))
+		if msg.Attempts > 0 {
+			f.Printf(" (%d failed attempts)", msg.Attempts)
+		}
+		f.Println()
+		if msg.LastError != "" {
+			f.Println("  last error:", msg.LastError)
+		}
+		items = append(items, outboxItem{
+			SendAt:    msg.SendAt,
+			From:      msg.From,
+			To:        msg.To,
+			Attempts:  msg.Attempts,
+			LastError: msg.LastError,
+		})
+	}
+	f.setPipeData(items)
+}
+
+func (f *frontendCLI) showSyncReport(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	report, err := user.GetSyncReport()
+	if err != nil {
+		f.printAndLogError("Cannot read sync report:", err)
+		return
+	}
+
+	if report == nil {
+		f.Printf("There is no finished sync of %s yet.\n", bold(user.Username()))
+		return
+	}
+
+	item := syncReportItem{
+		Started:   time.Unix(report.Started, 0),
+		Finished:  time.Unix(report.Finished, 0),
+		Elapsed:   report.Elapsed.Round(time.Second).String(),
+		Resumed:   report.Resumed,
+		Synced:    report.Synced,
+		Skipped:   report.Skipped,
+		Deleted:   report.Deleted,
+		FailedIDs: report.FailedIDs,
+		Bytes:     report.Bytes,
+		Error:     report.Error,
+	}
+
+	if report.Error != "" {
+		f.Printf("Last sync of %s failed at %s: %s\n", bold(user.Username()), item.Finished.Format(time.RFC1123), report.Error)
+	} else {
+		f.Printf("Last sync of %s finished at %s\n", bold(user.Username()), item.Finished.Format(time.RFC1123))
+	}
+	if report.Resumed {
+		f.Println("The sync continued an interrupted one; counts include only the resumed part.")
+	}
+	f.Println("  elapsed:   ", item.Elapsed)
+	f.Println("  synced:    ", report.Synced)
+	f.Println("  skipped:   ", report.Skipped, "(only in mailboxes excluded from sync)")
+	f.Println("  deleted:   ", report.Deleted, "(not on server anymore)")
+	f.Println("  failed:    ", len(report.FailedIDs))
+	f.Println("  downloaded:", report.Bytes, "bytes of message lists")
+	for _, id := range report.FailedIDs {
+		f.Println("    ", id)
+	}
+	f.setPipeData(item)
+}
+
+func (f *frontendCLI) previewRetention(c *ishell.Context) {
+	f.applyRetention(c, true)
+}
+
+func (f *frontendCLI) runRetention(c *ishell.Context) {
+	f.applyRetention(c, false)
+}
+
+func (f *frontendCLI) applyRetention(c *ishell.Context, dryRun bool) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	if !dryRun && !f.yesNoQuestion("Are you sure you want to remove old messages of "+user.Username()+" now") {
+		return
+	}
+
+	entries, err := user.ApplyRetention(dryRun)
+	if err != nil {
+		f.printAndLogError("Cannot apply retention policies:", err)
+		return
+	}
+
+	if len(entries) == 0 {
+		f.Printf("No messages of %s match retention policies.\n", bold(user.Username()))
+	} else if dryRun {
+		f.Printf("%d messages of %s would be removed:\n", len(entries), bold(user.Username()))
+	} else {
+		f.Printf("%d messages of %s were processed:\n", len(entries), bold(user.Username()))
+	}
+
+	f.printRetentionEntries(entries)
+}
+
+func (f *frontendCLI) removeDuplicates(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	if !user.IsConnected() {
+		f.Printf("Please login to %s to find duplicate messages.\n", bold(user.Username()))
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	mailbox := f.readStringInAttempts("Mailbox, e.g. INBOX or Folders/Work", c.ReadLine, func(val string) bool {
+		return val != ""
+	})
+	if mailbox == "" {
+		return
+	}
+
+	groups, err := user.FindDuplicates(mailbox)
+	if err != nil {
+		f.printAndLogError("Cannot find duplicates:", err)
+		return
+	}
+
+	items := []duplicateItem{}
+	extras := 0
+	for _, group := range groups {
+		item := duplicateItem{
+			ExternalID: group.ExternalID,
+			Subject:    group.Subject,
+			Time:       time.Unix(group.Time, 0),
+			Keep:       group.Keep,
+			Extras:     group.Extras,
+		}
+		f.Printf("%d copies  %s  %q  <%s>\n", len(group.Extras), item.Time.Format("2006-01-02"), group.Subject, group.ExternalID)
+		items = append(items, item)
+		extras += len(group.Extras)
+	}
+	f.setPipeData(items)
+
+	if extras == 0 {
+		f.Printf("No duplicate messages of %s in %s.\n", bold(user.Username()), mailbox)
+		return
+	}
+
+	f.Println("Labels of the copies are added to the kept message, folders are not changed.")
+	if !f.yesNoQuestion(fmt.Sprintf("Are you sure you want to move %d copies to Trash", extras)) {
+		return
+	}
+
+	if err := user.RemoveDuplicates(groups); err != nil {
+		f.printAndLogError("Cannot remove duplicates:", err)
+		return
+	}
+	f.Printf("%d copies of %d messages of %s were moved to Trash.\n", extras, len(groups), bold(user.Username()))
+}
+
+func (f *frontendCLI) verifyStore(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	problems, err := user.VerifyStore()
+	if err != nil {
+		f.printAndLogError("Cannot verify local database:", err)
+		return
+	}
+	f.setPipeData(problems)
+
+	if len(problems) == 0 {
+		f.Printf("Local database of %s is consistent.\n", bold(user.Username()))
+		return
+	}
+
+	for _, problem := range problems {
+		f.Println(problem.String())
+	}
+
+	if !user.IsConnected() {
+		f.Printf("Please login to %s to repair %d problems.\n", bold(user.Username()), len(problems))
+		return
+	}
+
+	f.Println("Affected messages are removed from the mailboxes and their metadata are fetched from the server again; email clients see them as new messages.")
+	if !f.yesNoQuestion(fmt.Sprintf("Are you sure you want to repair %d problems", len(problems))) {
+		return
+	}
+
+	repaired, err := user.RepairStore(problems)
+	if err != nil {
+		f.printAndLogError("Cannot repair local database:", err)
+		return
+	}
+	f.Printf("%d problems in local database of %s were repaired.\n", repaired, bold(user.Username()))
+}
+
+func (f *frontendCLI) compactCache(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	freed, err := user.CompactCache()
+	if err != nil {
+		f.printAndLogError("Cannot compact cache:", err)
+		return
+	}
+	f.Printf("%s of cached messages and attachments of %s were removed.\n", formatMegabytes(freed), bold(user.Username()))
+}
+
+func (f *frontendCLI) compactDatabase(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.Println("The account is read-only until the database is compacted; clients can still read messages.")
+	if !f.yesNoQuestion("Are you sure you want to compact the local database of " + bold(user.Username()) + " now") {
+		return
+	}
+
+	printed := 0
+	before, after, err := user.CompactDatabase(func(progress float64) {
+		if percent := int(progress*10) * 10; percent > printed {
+			printed = percent
+			f.Printf("Copied %d %%.\n", percent)
+		}
+	})
+	if err != nil {
+		f.printAndLogError("Cannot compact local database:", err)
+		return
+	}
+	f.Printf("Local database of %s was compacted from %s to %s.\n", bold(user.Username()), formatMegabytes(before), formatMegabytes(after))
+}
+
+func (f *frontendCLI) showRetentionLog(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	entries, err := user.GetRetentionLog()
+	if err != nil {
+		f.printAndLogError("Cannot read retention log:", err)
+		return
+	}
+
+	if len(entries) == 0 {
+		f.Printf("Retention policies have not removed any message of %s.\n", bold(user.Username()))
+	}
+
+	f.printRetentionEntries(entries)
+}
+
+func (f *frontendCLI) printRetentionEntries(entries []*store.RetentionEntry) {
+	items := []retentionItem{}
+	for _, entry := range entries {
+		item := retentionItem{
+			MessageID: entry.MessageID,
+			Mailbox:   entry.Mailbox,
+			Action:    entry.Action,
+			Subject:   entry.Subject,
+			Time:      time.Unix(entry.Time, 0),
+			Error:     entry.Error,
+		}
+		if entry.AppliedAt != 0 {
+			item.AppliedAt = time.Unix(entry.AppliedAt, 0)
+			f.Printf("%s  ", item.AppliedAt.Format(time.RFC1123))
+		}
+		f.Printf("%-8s %s  %s  %q", entry.Action, entry.Mailbox, item.Time.Format("2006-01-02"), entry.Subject)
+		if entry.Error != "" {
+			f.Printf(" (failed: %s)", entry.Error)
+		}
+		f.Println()
+		items = append(items, item)
+	}
+	f.setPipeData(items)
+}
+
+func (f *frontendCLI) exportMessages(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	if !user.IsConnected() {
+		f.Printf("Please login to %s to export messages.\n", bold(user.Username()))
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	dir := f.readStringInAttempts("Export folder", c.ReadLine, func(val string) bool {
+		return val != ""
+	})
+	if dir == "" {
+		return
+	}
+
+	format := f.readStringInAttempts("Format, "+archive.FormatEML+" or "+archive.FormatMBOX+" (empty for "+archive.FormatEML+")", c.ReadLine, func(val string) bool {
+		return val == "" || val == archive.FormatEML || val == archive.FormatMBOX
+	})
+	if format == "" {
+		format = archive.FormatEML
+	}
+
+	f.Print("Comma-separated mailboxes, e.g. INBOX, Folders/Work (empty for all but All Mail): ")
+	mailboxes := strings.TrimSpace(c.ReadLine())
+	f.Println("Attachments not kept in messages are written as separate files to the attachments folder.")
+	inline := f.yesNoQuestion("Keep attachments in messages")
+	stubs := false
+	if !inline {
+		stubs = f.yesNoQuestion("Replace attachments in messages by stubs and list them in stripped.json")
+	}
+	forSharing := f.yesNoQuestion("Remove Bcc, Proton internal and delivery trace header fields to share messages with others")
+
+	options := store.ExportOptions{
+		Dir:               dir,
+		Format:            format,
+		Mailboxes:         preferences.SplitList(mailboxes),
+		InlineAttachments: inline,
+		AttachmentStubs:   stubs,
+		ForSharing:        forSharing,
+	}
+
+	exported, failed, err := user.ExportMessages(options, func(mailbox string, done, total int) {
+		if done == total {
+			f.Printf("Exported %s (%d messages).\n", mailbox, total)
+		}
+	})
+	if err != nil {
+		f.printAndLogError("Cannot export messages:", err)
+	}
+	f.Printf("Exported %d messages of %s to %s.\n", exported, bold(user.Username()), dir)
+	if failed > 0 {
+		f.Printf("%d messages cannot be exported, see the log for details.\n", failed)
+	}
+}
+
+func (f *frontendCLI) importMessages(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	if !user.IsConnected() {
+		f.Printf("Please login to %s to import messages.\n", bold(user.Username()))
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	path := f.readStringInAttempts("Folder with EML and MBOX files", c.ReadLine, isNotEmpty)
+	if path == "" {
+		return
+	}
+
+	address, folderMapping, ok := f.readImportOptions(c, user)
+	if !ok {
+		return
+	}
+
+	imported, failed, err := f.bridge.ImportMessages(address, path, folderMapping, f.importProgress())
+	f.printImportResult(address, imported, failed, err)
+}
+
+func (f *frontendCLI) migrateMessages(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	if !user.IsConnected() {
+		f.Printf("Please login to %s to migrate messages.\n", bold(user.Username()))
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	stores := f.bridge.MigrationStores()
+	for index, store := range stores {
+		f.Printf("%2d: %s\n", index, store)
+	}
+
+	choice := f.readStringInAttempts("Number of the local store or path to it", c.ReadLine, isNotEmpty)
+	if choice == "" {
+		return
+	}
+
+	var store migration.Store
+	if index, err := strconv.Atoi(choice); err == nil && index >= 0 && index < len(stores) {
+		store = stores[index]
+	} else if store, err = migration.StoreFromPath(choice); err != nil {
+		f.printAndLogError("Cannot migrate messages:", err)
+		return
+	}
+
+	address, folderMapping, ok := f.readImportOptions(c, user)
+	if !ok {
+		return
+	}
+
+	f.Printf("Migrating %s, messages already in the account are skipped.\n", store)
+	imported, failed, err := f.bridge.MigrateMessages(address, store, folderMapping, f.importProgress())
+	f.printImportResult(address, imported, failed, err)
+}
+
+// readImportOptions asks for the address used for encryption and
+// the folder mapping.
+func (f *frontendCLI) readImportOptions(c *ishell.Context, user types.User) (address string, folderMapping map[string]string, ok bool) {
+	address = user.GetPrimaryAddress()
+	if addresses := user.GetAddresses(); len(addresses) > 1 {
+		address = f.readStringInAttempts("Address (empty for "+address+")", c.ReadLine, func(val string) bool {
+			if val == "" {
+				return true
+			}
+			for _, address := range addresses {
+				if val == address {
+					return true
+				}
+			}
+			return false
+		})
+		if address == "" {
+			address = user.GetPrimaryAddress()
+		}
+	}
+
+	f.Print("Comma-separated folder mapping, e.g. Work=Job, Old=Archive (empty to import to matching folders): ")
+	folderMapping, err := importer.ParseFolderMapping(preferences.SplitList(c.ReadLine()))
+	if err != nil {
+		f.printAndLogError("Cannot import messages:", err)
+		return "", nil, false
+	}
+
+	return address, folderMapping, true
+}
+
+// importProgress prints progress every ten percent of processed messages.
+func (f *frontendCLI) importProgress() importer.ProgressFunc {
+	lastPercent := uint(0)
+	return func(imported, failed, total uint) {
+		if total == 0 {
+			return
+		}
+		if percent := (imported + failed) * 100 / total; percent >= lastPercent+10 {
+			lastPercent = percent - percent%10
+			f.Printf("Processed %d of %d messages.\n", imported+failed, total)
+		}
+	}
+}
+
+func (f *frontendCLI) printImportResult(address string, imported, failed uint, err error) {
+	if err != nil {
+		f.printAndLogError("Cannot import messages:", err)
+	}
+	f.Printf("Imported %d messages to %s.\n", imported, bold(address))
+	if failed > 0 {
+		f.Printf("%d messages cannot be imported, see the log for details.\n", failed)
+	}
 }
 
 func (f *frontendCLI) loginAccount(c *ishell.Context) { // nolint[funlen]
@@ -92,10 +774,12 @@ func (f *frontendCLI) loginAccount(c *ishell.Context) { // nolint[funlen]
 	defer f.ShowPrompt(true)
 
 	loginName := ""
+	reloginID := ""
 	if len(c.Args) > 0 {
 		user := f.getUserByIndexOrName(c.Args[0])
 		if user != nil {
 			loginName = user.GetPrimaryAddress()
+			reloginID = user.ID()
 		}
 	}
 
@@ -113,43 +797,115 @@ func (f *frontendCLI) loginAccount(c *ishell.Context) { // nolint[funlen]
 		return
 	}
 
+	// Existing account is logged in again and keeps its cache.
+	loginWizard := wizard.New(f.bridge, f.preferences)
+	if reloginID != "" {
+		loginWizard = wizard.NewRelogin(f.bridge, f.preferences, reloginID)
+	}
+
 	f.Println("Authenticating ... ")
-	client, auth, err := f.bridge.Login(loginName, password)
-	if err != nil {
+	if err := loginWizard.SubmitCredentials(loginName, password); err != nil {
+		if err == wizard.ErrSecurityKeyOnly {
+			f.Println("Login is not possible:", err)
+			return
+		}
 		f.processAPIError(err)
 		return
 	}
 
-	if auth.HasTwoFactor() {
+	if loginWizard.GetState().Step == wizard.StepTwoFactor && !f.loginTwoFactor(c, loginWizard) {
+		return
+	}
+
+	if loginWizard.GetState().Step == wizard.StepMailboxPassword && !f.loginMailboxPassword(c, loginWizard) {
+		return
+	}
+
+	state := loginWizard.GetState()
+	if reloginID != "" {
+		f.Printf("Account %s was logged in again, its messages do not need to be synced again.\n", bold(state.Account))
+	} else {
+		f.Printf("Account %s was added successfully.\n", bold(state.Account))
+	}
+
+	for _, client := range state.Clients {
+		if !f.yesNoQuestion("Do you want to configure " + client + " for " + state.Configs[0].Address) {
+			continue
+		}
+		if err := loginWizard.ConfigureClient(client, 0); err != nil {
+			f.printAndLogError("Cannot configure "+client+":", err)
+		}
+	}
+	_ = loginWizard.Finish()
+
+	f.Println("Use `info` to show configuration of email client.")
+}
+
+// loginTwoFactor asks for the code from authenticator app until it is
+// accepted or the API closes the login session.
+func (f *frontendCLI) loginTwoFactor(c *ishell.Context, loginWizard *wizard.Wizard) bool {
+	if loginWizard.GetState().SecurityKey {
+		f.Println("Security key (U2F/FIDO2) cannot be used with Bridge, use the code from your authenticator app.")
+	}
+
+	for attempt := 0; attempt < maxLoginAttempts; attempt++ {
 		twoFactor := f.readStringInAttempts("Two factor code", c.ReadLine, isNotEmpty)
 		if twoFactor == "" {
-			return
+			loginWizard.Start()
+			return false
 		}
 
-		_, err = client.Auth2FA(twoFactor, auth)
-		if err != nil {
+		err := loginWizard.SubmitTwoFactor(twoFactor)
+		if err == nil {
+			return true
+		}
+		if err == pmapi.ErrBad2FACodeTryAgain {
+			f.Println("Two factor code is incorrect, please try again.")
+			continue
+		}
+
+		loginWizard.Start()
+		if err == pmapi.ErrBad2FACode {
+			f.Println("Two factor code is incorrect, please login again.")
+		} else {
 			f.processAPIError(err)
-			return
 		}
+		return false
 	}
 
-	mailboxPassword := password
-	if auth.HasMailboxPassword() {
-		mailboxPassword = f.readStringInAttempts("Mailbox password", c.ReadPassword, isNotEmpty)
-	}
-	if mailboxPassword == "" {
-		return
-	}
+	loginWizard.Start()
+	f.Println("Too many incorrect two factor codes, please login again.")
+	return false
+}
 
-	f.Println("Adding account ...")
-	user, err := f.bridge.FinishLogin(client, auth, mailboxPassword)
-	if err != nil {
-		log.WithField("username", loginName).WithError(err).Error("Login was unsuccessful")
+// loginMailboxPassword asks for the mailbox password in two password mode
+// and adds the account. Wrong mailbox password can be entered again.
+func (f *frontendCLI) loginMailboxPassword(c *ishell.Context, loginWizard *wizard.Wizard) bool {
+	for attempt := 0; attempt < maxLoginAttempts; attempt++ {
+		mailboxPassword := f.readStringInAttempts("Mailbox password", c.ReadPassword, isNotEmpty)
+		if mailboxPassword == "" {
+			loginWizard.Start()
+			return false
+		}
+
+		f.Println("Adding account ...")
+		err := loginWizard.SubmitMailboxPassword(mailboxPassword)
+		if err == nil {
+			return true
+		}
+		if err == wizard.ErrWrongMailboxPassword {
+			f.Println("Mailbox password is incorrect, please try again.")
+			continue
+		}
+
+		loginWizard.Start()
 		f.Println("Adding account was unsuccessful:", err)
-		return
+		return false
 	}
 
-	f.Printf("Account %s was added successfully.\n", bold(user.Username()))
+	loginWizard.Start()
+	f.Println("Too many incorrect mailbox passwords, please login again.")
+	return false
 }
 
 func (f *frontendCLI) logoutAccount(c *ishell.Context) {
@@ -217,3 +973,425 @@ func (f *frontendCLI) changeMode(c *ishell.Context) {
 	}
 	f.Printf("Address mode for account %s changed to %s\n", user.Username(), newMode)
 }
+
+func (f *frontendCLI) changeSearchLanguage(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	// The language is the last argument after optional index or account name.
+	language := ""
+	if len(c.Args) > 0 {
+		language = strings.ToLower(c.Args[len(c.Args)-1])
+	}
+
+	languages := search.Languages()
+	isKnown := false
+	for _, known := range languages {
+		if language == known {
+			isKnown = true
+			break
+		}
+	}
+	if !isKnown {
+		f.Printf("Search language for account %s is %s. Choose one of: %s\n",
+			user.Username(), bold(user.GetSearchLanguage()), strings.Join(languages, ", "))
+		return
+	}
+
+	if err := user.SetSearchLanguage(language); err != nil {
+		f.printAndLogError("Cannot change search language:", err)
+		return
+	}
+	f.Printf("Search language for account %s changed to %s\n", user.Username(), language)
+}
+
+func (f *frontendCLI) changeSyncExclusions(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Printf("Mailboxes of %s which are not synced: %s\n", user.Username(), strings.Join(user.GetSyncExclusions(), ", "))
+	f.Print("Comma-separated mailboxes, e.g. Archive, All Mail (empty to keep, none to sync all): ")
+	value := strings.TrimSpace(c.ReadLine())
+	if value == "" {
+		return
+	}
+
+	names := []string{}
+	if value != "none" {
+		names = preferences.SplitList(value)
+	}
+
+	if err := user.SetSyncExclusions(names); err != nil {
+		f.printAndLogError("Cannot change mailboxes which are not synced:", err)
+		return
+	}
+	f.Printf("Mailboxes of %s which are not synced changed, account is syncing again.\n", user.Username())
+}
+
+func (f *frontendCLI) changeSyncMaxAge(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Printf("Messages of %s which are synced: %s\n", user.Username(), user.GetSyncMaxAge())
+	f.Print("Sync messages from last number of days (empty to keep, 0 to sync all): ")
+	value := strings.TrimSpace(c.ReadLine())
+	if value == "" {
+		return
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		f.Println("Number of days must be a non-negative number.")
+		return
+	}
+
+	maxAge := store.SyncMaxAge{Days: days}
+	if maxAge.IsEnabled() {
+		maxAge.Mode = f.readStringInAttempts("Older messages ("+strings.Join(store.SyncMaxAgeModes, ", ")+")", c.ReadLine, func(val string) bool {
+			for _, mode := range store.SyncMaxAgeModes {
+				if val == mode {
+					return true
+				}
+			}
+			return false
+		})
+		if maxAge.Mode == "" {
+			return
+		}
+	}
+
+	if err := user.SetSyncMaxAge(maxAge); err != nil {
+		f.printAndLogError("Cannot change maximum age of synced messages:", err)
+		return
+	}
+	f.Printf("Messages of %s which are synced changed to %s.\n", user.Username(), maxAge)
+}
+
+func (f *frontendCLI) changeAccountNotifications(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	rules := user.GetNotificationRules()
+	if rules.Disabled {
+		f.Printf("New messages of %s are not notified.\n", user.Username())
+	} else {
+		f.Printf("New messages of %s are notified in: %s\n", user.Username(), strings.Join(rules.Folders, ", "))
+		if rules.QuietHours.IsEnabled() {
+			f.Printf("Quiet hours without notifications: %s\n", rules.QuietHours)
+		}
+	}
+
+	rules.Disabled = !f.yesNoQuestion("Notify new messages of this account")
+	if !rules.Disabled {
+		f.Print("Comma-separated notified mailboxes, e.g. INBOX, Folders/Work (empty to keep): ")
+		if value := strings.TrimSpace(c.ReadLine()); value != "" {
+			rules.Folders = preferences.SplitList(value)
+		}
+
+		f.Print("Quiet hours, e.g. 22:00-07:00 (empty to keep, none to notify at any time): ")
+		if value := strings.TrimSpace(c.ReadLine()); value == "none" {
+			rules.QuietHours = store.QuietHours{}
+		} else if value != "" {
+			quiet, err := store.ParseQuietHours(value)
+			if err != nil {
+				f.printAndLogError("Cannot change quiet hours:", err)
+				return
+			}
+			rules.QuietHours = quiet
+		}
+	}
+
+	if err := user.SetNotificationRules(rules); err != nil {
+		f.printAndLogError("Cannot change notifications of new messages:", err)
+		return
+	}
+	f.Printf("Notifications of new messages of %s changed.\n", user.Username())
+}
+
+func (f *frontendCLI) changeMailboxMapping(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := user.GetMailboxMapping()
+	mode := f.readStringInAttempts("Mailbox mapping ("+strings.Join(store.MailboxMappings, ", ")+", current "+current+")", c.ReadLine, func(val string) bool {
+		if val == "" {
+			return true
+		}
+		for _, mode := range store.MailboxMappings {
+			if val == mode {
+				return true
+			}
+		}
+		return false
+	})
+	if mode == "" || mode == current {
+		return
+	}
+
+	if err := user.SetMailboxMapping(mode); err != nil {
+		f.printAndLogError("Cannot change mailbox mapping:", err)
+		return
+	}
+	f.Printf("Mailbox mapping of %s changed to %s, please reconnect your client.\n", user.Username(), mode)
+}
+
+func (f *frontendCLI) changeOutgoingMIMEType(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := user.GetOutgoingMIMEType()
+	mode := f.readStringInAttempts("Outgoing MIME type ("+strings.Join(store.OutgoingMIMETypes, ", ")+", current "+current+")", c.ReadLine, func(val string) bool {
+		if val == "" {
+			return true
+		}
+		for _, mode := range store.OutgoingMIMETypes {
+			if val == mode {
+				return true
+			}
+		}
+		return false
+	})
+	if mode == "" || mode == current {
+		return
+	}
+
+	if err := user.SetOutgoingMIMEType(mode); err != nil {
+		f.printAndLogError("Cannot change outgoing MIME type:", err)
+		return
+	}
+	f.Printf("Outgoing messages of %s are now sent as %s.\n", user.Username(), mode)
+}
+
+func (f *frontendCLI) changeRemoteContent(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := user.GetRemoteContentFilter()
+	modes := []string{}
+	for _, mode := range message.RemoteContentModes {
+		modes = append(modes, string(mode))
+	}
+	mode := f.readStringInAttempts("Remote content ("+strings.Join(modes, ", ")+", current "+string(current.Mode)+")", c.ReadLine, func(val string) bool {
+		if val == "" {
+			return true
+		}
+		for _, mode := range modes {
+			if val == mode {
+				return true
+			}
+		}
+		return false
+	})
+	if mode == "" {
+		return
+	}
+
+	filter := message.RemoteContentFilter{Mode: message.RemoteContentMode(mode)}
+	if filter.Mode == message.RemoteContentProxy {
+		f.Println("Original URL is appended escaped to the proxy URL, e.g. https://proxy.example.com/?url=")
+		filter.ProxyURL = f.readStringInAttempts("Proxy URL (current \""+current.ProxyURL+"\")", c.ReadLine, func(val string) bool {
+			proxyURL, err := url.Parse(val)
+			return err == nil && (proxyURL.Scheme == "https" || proxyURL.Scheme == "http") && proxyURL.Host != ""
+		})
+		if filter.ProxyURL == "" {
+			return
+		}
+	}
+	if filter == current {
+		return
+	}
+
+	if err := user.SetRemoteContentFilter(filter); err != nil {
+		f.printAndLogError("Cannot change remote content:", err)
+		return
+	}
+	cache.Clear()
+	f.Printf("Remote content of messages of %s is now %s. Messages already downloaded by clients are not changed.\n", user.Username(), mode)
+}
+
+func (f *frontendCLI) changeFooter(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	text, html := user.GetFooter()
+	f.Printf("Footer text: %s\nFooter HTML: %s\n", text, html)
+
+	f.Print("Footer text (empty to keep, none to remove): ")
+	newText := strings.TrimSpace(c.ReadLine())
+	switch newText {
+	case "":
+		return
+	case "none":
+		newText, html = "", ""
+	default:
+		f.Print("Footer HTML (empty to generate from text): ")
+		html = strings.TrimSpace(c.ReadLine())
+	}
+
+	if err := user.SetFooter(newText, html); err != nil {
+		f.printAndLogError("Cannot change footer:", err)
+		return
+	}
+	if newText == "" {
+		f.Printf("Footer is no longer appended to messages sent by %s.\n", user.Username())
+	} else {
+		f.Printf("Footer is appended to messages sent by %s.\n", user.Username())
+	}
+}
+
+func (f *frontendCLI) changeDefaultExpiration(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Sent messages expire and are deleted from mailboxes of recipients after the given time.")
+	f.Println("Clients can set the expiration of each message in seconds by the " + message.ExpiresInHeader + " header.")
+
+	maxHours := int(message.MaxExpiration / time.Hour)
+	current := int(user.GetDefaultExpiration() / time.Hour)
+	val := f.readStringInAttempts(fmt.Sprintf("Hours until expiration, 0 to disable, at most %d (current %d)", maxHours, current), c.ReadLine, func(val string) bool {
+		hours, err := strconv.Atoi(val)
+		return val == "" || (err == nil && hours >= 0 && hours <= maxHours)
+	})
+	if val == "" {
+		return
+	}
+
+	hours, _ := strconv.Atoi(val)
+	if err := user.SetDefaultExpiration(time.Duration(hours) * time.Hour); err != nil {
+		f.printAndLogError("Cannot change expiration:", err)
+		return
+	}
+	if hours == 0 {
+		f.Printf("Messages sent by %s no longer expire.\n", user.Username())
+	} else {
+		f.Printf("Messages sent by %s expire after %d hours.\n", user.Username(), hours)
+	}
+}
+
+func (f *frontendCLI) changeAddressSettings(c *ishell.Context) { //nolint[funlen]
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	if !user.IsConnected() {
+		f.Printf("Please login to %s to change settings of addresses.\n", bold(user.Username()))
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	addresses := user.GetAddressSettings()
+	for i, address := range addresses {
+		f.Printf("%2d: %s\n    Display name: %s\n    Signature:    %s\n", i, bold(address.Address), address.DisplayName, address.Signature)
+	}
+
+	index := f.readStringInAttempts("Address index (empty to keep all)", c.ReadLine, func(val string) bool {
+		if val == "" {
+			return true
+		}
+		i, err := strconv.Atoi(val)
+		return err == nil && i >= 0 && i < len(addresses)
+	})
+	if i, err := strconv.Atoi(index); err == nil {
+		settings := addresses[i]
+
+		f.Print("Display name (empty to keep): ")
+		if value := strings.TrimSpace(c.ReadLine()); value != "" {
+			settings.DisplayName = value
+		}
+		f.Print("Signature, HTML is allowed (empty to keep, none to remove): ")
+		if value := strings.TrimSpace(c.ReadLine()); value == "none" {
+			settings.Signature = ""
+		} else if value != "" {
+			settings.Signature = value
+		}
+
+		if settings != addresses[i] {
+			if err := user.SetAddressSettings(settings); err != nil {
+				f.printAndLogError("Cannot change settings of address:", err)
+				return
+			}
+			f.Printf("Settings of %s changed.\n", settings.Address)
+		}
+	}
+
+	isAppended := user.GetAppendSignature()
+	msg := "Do you want to append signature of the sending address to messages sent by clients without own signature"
+	if isAppended {
+		msg = "Do you want to stop appending signature of the sending address to sent messages"
+	}
+	if !f.yesNoQuestion(msg) {
+		return
+	}
+	if err := user.SetAppendSignature(!isAppended); err != nil {
+		f.printAndLogError("Cannot change appending of signature:", err)
+		return
+	}
+	if isAppended {
+		f.Printf("Signature is no longer appended to messages sent by %s.\n", user.Username())
+	} else {
+		f.Printf("Signature is appended to messages sent by %s.\n", user.Username())
+	}
+}
+
+func (f *frontendCLI) checkLocalArchive(c *ishell.Context) {
+	if f.preferences.Get(preferences.LocalArchiveDirKey) == "" {
+		f.Println("Local archive is disabled.")
+		return
+	}
+
+	for _, user := range f.bridge.GetUsers() {
+		broken, err := user.VerifyLocalArchive()
+		switch {
+		case err != nil:
+			f.printAndLogError("Cannot check local archive of ", user.Username(), ": ", err)
+		case broken > 0:
+			f.Printf("Local archive of %s has %d missing or changed messages.\n", user.Username(), broken)
+		default:
+			f.Printf("Local archive of %s is complete.\n", user.Username())
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/abiosoft/ishell"
+)
+
+func (f *frontendCLI) notifyCrashReports() {
+	reports, err := bridge.ListCrashReports()
+	if err != nil || len(reports) == 0 {
+		return
+	}
+
+	f.Println(bold("Bridge crashed recently."), "Crash reports were saved on this computer and nothing was sent.")
+	f.Println("Use `crash-reports` to review them and `crash-reports send` to help us fix the problem.")
+}
+
+func (f *frontendCLI) listCrashReports(c *ishell.Context) {
+	reports, err := bridge.ListCrashReports()
+	if err != nil {
+		f.printAndLogError("Cannot read crash reports:", err)
+		return
+	}
+	if len(reports) == 0 {
+		f.Println("No crash reports.")
+		return
+	}
+
+	for i, report := range reports {
+		f.Printf("%2d. %s  %s  %s\n", i+1, report.Created.Format(time.RFC1123), report.Version, firstLine(report.Error))
+	}
+}
+
+func (f *frontendCLI) showCrashReport(c *ishell.Context) {
+	reports, err := bridge.ListCrashReports()
+	if err != nil {
+		f.printAndLogError("Cannot read crash reports:", err)
+		return
+	}
+	if len(reports) == 0 {
+		f.Println("No crash reports.")
+		return
+	}
+
+	index := len(reports)
+	if len(c.Args) > 0 {
+		if index, err = strconv.Atoi(c.Args[0]); err != nil || index < 1 || index > len(reports) {
+			f.Println("Use number from `crash-reports` as parameter.")
+			return
+		}
+	}
+
+	report := reports[index-1]
+	f.Println(bold("Error"))
+	f.Println(report.Error, "\n")
+	f.Println(bold("Platform"))
+	f.Println(report.AppName, report.Version, report.OS, report.Arch, report.GoVersion, "\n")
+	f.Println(bold("Recent log"))
+	f.Println(strings.Join(report.Log, "\n"), "\n")
+	f.Println(bold("State of the app"))
+	f.Println(report.Stack)
+}
+
+func (f *frontendCLI) sendCrashReports(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	reports, err := bridge.ListCrashReports()
+	if err != nil {
+		f.printAndLogError("Cannot read crash reports:", err)
+		return
+	}
+	if len(reports) == 0 {
+		f.Println("No crash reports.")
+		return
+	}
+
+	f.Println("Crash reports contain the error, the state of the app, version of the app and of the system")
+	f.Println("and the recent log with redacted email addresses and subjects. Use `crash-reports show` to see them.")
+	if !f.yesNoQuestion("Do you want to send " + strconv.Itoa(len(reports)) + " crash reports to ProtonMail") {
+		return
+	}
+
+	apiConfig := f.config.GetAPIConfig()
+	sent := 0
+	for _, report := range reports {
+		if err := bridge.SubmitCrashReport(report, apiConfig.ClientID, apiConfig.AppVersion, apiConfig.UserAgent); err != nil {
+			f.printAndLogError("Cannot send crash report:", err)
+			continue
+		}
+		sent++
+	}
+	f.Println("Crash reports sent:", sent)
+}
+
+func (f *frontendCLI) discardCrashReports(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	reports, err := bridge.ListCrashReports()
+	if err != nil {
+		f.printAndLogError("Cannot read crash reports:", err)
+		return
+	}
+	if len(reports) == 0 {
+		f.Println("No crash reports.")
+		return
+	}
+
+	if !f.yesNoQuestion("Are you sure you want to remove " + strconv.Itoa(len(reports)) + " crash reports without sending them") {
+		return
+	}
+
+	for _, report := range reports {
+		if err := bridge.DiscardCrashReport(report); err != nil {
+			f.printAndLogError("Cannot remove crash report:", err)
+			return
+		}
+	}
+	f.Println("Crash reports removed.")
+}
+
+func firstLine(text string) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		return text[:i]
+	}
+	return text
+}
@@ -0,0 +1,365 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/wizard"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// Environment variables with secrets for scripted login. When a variable is
+// not set, the secret is read as the next line of the standard input.
+const (
+	passwordEnv        = "BRIDGE_PASSWORD"
+	mailboxPasswordEnv = "BRIDGE_MAILBOX_PASSWORD"
+	twoFactorEnv       = "BRIDGE_2FA_CODE"
+)
+
+// scriptCommands lists commands which can be run without the interactive shell.
+const scriptCommands = "list, info <account>, token <account>, login --username <name>, logout <account>, delete-account [--clear-cache] <account>, bulk --query <query> --action <action> [--dry-run] <account>, stats [--since <period>]"
+
+// script runs one account command without the interactive shell, so bridge
+// can be provisioned on headless servers. Accounts are chosen explicitly by
+// index or username, never by default.
+type script struct {
+	preferences *config.Preferences
+	bridge      types.Bridger
+
+	lookupEnv func(string) (string, bool)
+	in        *bufio.Reader
+	out       io.Writer
+}
+
+// RunScript runs the command given by args. Secrets are read from stdin
+// or the environment.
+func RunScript(args []string, in io.Reader, out io.Writer, preferences *config.Preferences, bridge types.Bridger) error {
+	return runScript(args, os.LookupEnv, in, out, preferences, bridge)
+}
+
+// RunScriptWithEnv runs the command given by args with secrets from env
+// instead of the environment of the process. It is used for commands
+// forwarded from other instances.
+func RunScriptWithEnv(args []string, env map[string]string, in io.Reader, out io.Writer, preferences *config.Preferences, bridge types.Bridger) error {
+	lookupEnv := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+	return runScript(args, lookupEnv, in, out, preferences, bridge)
+}
+
+// ScriptEnv returns the set environment variables with secrets, so they can
+// be forwarded with the command to other instance.
+func ScriptEnv() map[string]string {
+	env := map[string]string{}
+	for _, key := range []string{passwordEnv, mailboxPasswordEnv, twoFactorEnv} {
+		if value, ok := os.LookupEnv(key); ok {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+func runScript(args []string, lookupEnv func(string) (string, bool), in io.Reader, out io.Writer, preferences *config.Preferences, bridge types.Bridger) error {
+	s := &script{
+		preferences: preferences,
+		bridge:      bridge,
+		lookupEnv:   lookupEnv,
+		in:          bufio.NewReader(in),
+		out:         out,
+	}
+
+	if len(args) == 0 {
+		return errors.New("no command, use one of: " + scriptCommands)
+	}
+
+	switch args[0] {
+	case "list":
+		return s.list()
+	case "info":
+		return s.info(args)
+	case "token":
+		return s.token(args)
+	case "login":
+		return s.login(args)
+	case "logout":
+		return s.logout(args)
+	case "delete-account":
+		return s.deleteAccount(args)
+	case "bulk":
+		return s.bulk(args)
+	case "stats":
+		return s.stats(args)
+	default:
+		return fmt.Errorf("unknown command %q, use one of: %s", args[0], scriptCommands)
+	}
+}
+
+func (s *script) list() error {
+	for idx, user := range s.bridge.GetUsers() {
+		connected := "disconnected"
+		if user.IsConnected() {
+			connected = "connected"
+		}
+		mode := "split"
+		if user.IsCombinedAddressMode() {
+			mode = "combined"
+		}
+		fmt.Fprintf(s.out, "%d\t%s\t%s\t%s\n", idx, user.Username(), connected, mode)
+	}
+	return nil
+}
+
+func (s *script) info(args []string) error {
+	user, err := s.parseUser(s.newFlagSet(args[0]), args[1:])
+	if err != nil {
+		return err
+	}
+	if !user.IsConnected() {
+		return fmt.Errorf("account %s is disconnected", user.Username())
+	}
+
+	addresses := user.GetAddresses()
+	if user.IsCombinedAddressMode() {
+		addresses = []string{user.GetPrimaryAddress()}
+	}
+
+	smtpSecurity := "STARTTLS"
+	if s.preferences.GetBool(preferences.SMTPSSLKey) {
+		smtpSecurity = "SSL"
+	}
+
+	imapPort, smtpPort := getUserPorts(s.bridge, s.preferences, user)
+	for _, address := range addresses {
+		fmt.Fprintf(s.out, "address=%s\nhost=%s\nimap_port=%d\nimap_security=STARTTLS\nsmtp_port=%d\nsmtp_security=%s\nusername=%s\npassword=%s\n\n",
+			address,
+			bridge.Host,
+			imapPort,
+			smtpPort,
+			smtpSecurity,
+			address,
+			user.GetBridgePassword(),
+		)
+	}
+	return nil
+}
+
+// token prints only the access token, so it can be used as the token
+// command of clients authenticating by XOAUTH2.
+func (s *script) token(args []string) error {
+	user, err := s.parseUser(s.newFlagSet(args[0]), args[1:])
+	if err != nil {
+		return err
+	}
+	if !user.IsConnected() {
+		return fmt.Errorf("account %s is disconnected", user.Username())
+	}
+
+	token, _ := user.GenerateAccessToken()
+	fmt.Fprintln(s.out, token)
+	return nil
+}
+
+func (s *script) login(args []string) error {
+	flags := s.newFlagSet(args[0])
+	username := flags.String("username", "", "username or address of the account")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *username == "" {
+		return errors.New("missing --username")
+	}
+
+	password, err := s.readSecret(passwordEnv, "password")
+	if err != nil {
+		return err
+	}
+
+	loginWizard := wizard.New(s.bridge, s.preferences)
+	if err := loginWizard.SubmitCredentials(*username, password); err != nil {
+		return errors.Wrap(err, "authentication failed")
+	}
+
+	if loginWizard.GetState().Step == wizard.StepTwoFactor {
+		twoFactor, err := s.readSecret(twoFactorEnv, "two factor code")
+		if err != nil {
+			loginWizard.Start()
+			return err
+		}
+		if err := loginWizard.SubmitTwoFactor(twoFactor); err != nil {
+			loginWizard.Start()
+			return errors.Wrap(err, "two factor authentication failed")
+		}
+	}
+
+	if loginWizard.GetState().Step == wizard.StepMailboxPassword {
+		mailboxPassword, err := s.readSecret(mailboxPasswordEnv, "mailbox password")
+		if err != nil {
+			loginWizard.Start()
+			return err
+		}
+		if err := loginWizard.SubmitMailboxPassword(mailboxPassword); err != nil {
+			loginWizard.Start()
+			return errors.Wrap(err, "adding account was unsuccessful")
+		}
+	}
+
+	fmt.Fprintf(s.out, "Account %s was added successfully.\n", loginWizard.GetState().Account)
+	return loginWizard.Finish()
+}
+
+func (s *script) logout(args []string) error {
+	user, err := s.parseUser(s.newFlagSet(args[0]), args[1:])
+	if err != nil {
+		return err
+	}
+	return user.Logout()
+}
+
+func (s *script) deleteAccount(args []string) error {
+	flags := s.newFlagSet(args[0])
+	clearCache := flags.Bool("clear-cache", false, "remove also cache of the account")
+	user, err := s.parseUser(flags, args[1:])
+	if err != nil {
+		return err
+	}
+	return s.bridge.DeleteUser(user.ID(), *clearCache)
+}
+
+// bulk applies the action to messages matching the query, e.g.
+// `bulk --query 'label:Newsletters before:2022' --action trash 0`.
+func (s *script) bulk(args []string) error {
+	flags := s.newFlagSet(args[0])
+	queryValue := flags.String("query", "", "terms label:, from:, before: and after:")
+	actionValue := flags.String("action", "", "read, unread, trash, delete, label:<mailbox> or unlabel:<mailbox>")
+	dryRun := flags.Bool("dry-run", false, "only list matching messages")
+	user, err := s.parseUser(flags, args[1:])
+	if err != nil {
+		return err
+	}
+
+	query, err := store.ParseBulkQuery(*queryValue)
+	if err != nil {
+		return errors.Wrap(err, "invalid --query")
+	}
+	action, err := store.ParseBulkAction(*actionValue)
+	if err != nil {
+		return errors.Wrap(err, "invalid --action")
+	}
+
+	msgs, err := user.ApplyBulkAction(query, action, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range msgs {
+		sender := ""
+		if msg.Sender != nil {
+			sender = msg.Sender.Address
+		}
+		fmt.Fprintf(s.out, "%s\t%s\t%s\t%s\n", msg.ID, time.Unix(msg.Time, 0).Format("2006-01-02"), sender, msg.Subject)
+	}
+	if *dryRun {
+		fmt.Fprintf(s.out, "%d messages match, nothing was changed.\n", len(msgs))
+	} else {
+		fmt.Fprintf(s.out, "Action %s was applied to %d messages.\n", action.Name, len(msgs))
+	}
+	return nil
+}
+
+// stats lists daily metrics, e.g. `stats --since 30d`.
+func (s *script) stats(args []string) error {
+	flags := s.newFlagSet(args[0])
+	since := flags.String("since", defaultStatsPeriod, "listed period, e.g. 30d or 12h")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	_, err := writeStats(s.out, *since)
+	return err
+}
+
+func (s *script) newFlagSet(command string) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(s.out)
+	return flags
+}
+
+// parseUser parses flags of the command and returns the user given by the
+// only positional argument.
+func (s *script) parseUser(flags *flag.FlagSet, args []string) (types.User, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() != 1 {
+		return nil, errors.New("expecting account index or username")
+	}
+
+	user := s.findUser(flags.Arg(0))
+	if user == nil {
+		return nil, fmt.Errorf("account %q not found", flags.Arg(0))
+	}
+	return user, nil
+}
+
+func (s *script) findUser(arg string) types.User {
+	users := s.bridge.GetUsers()
+	if index, err := strconv.Atoi(arg); err == nil {
+		if index < 0 || index >= len(users) {
+			return nil
+		}
+		return users[index]
+	}
+	for _, user := range users {
+		if user.Username() == arg || user.GetPrimaryAddress() == arg {
+			return user
+		}
+	}
+	return nil
+}
+
+// readSecret returns the value of the environment variable or the next line
+// of the input.
+func (s *script) readSecret(env, name string) (string, error) {
+	if value, ok := s.lookupEnv(env); ok && value != "" {
+		return value, nil
+	}
+
+	line, err := s.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("cannot read %s from stdin or %s", name, env)
+	}
+
+	secret := strings.TrimRight(line, "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", name)
+	}
+	return secret, nil
+}
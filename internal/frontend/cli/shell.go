@@ -0,0 +1,318 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/ishell"
+	"github.com/abiosoft/readline"
+)
+
+// pipeSeparator separates a command from filters applied to its output,
+// e.g. `list | json 0.account`. It has to be surrounded by spaces.
+const pipeSeparator = "|"
+
+// pipeInput is output of a command or of the previous filter. Data is set
+// when the command provided its output also as a structure.
+type pipeInput struct {
+	text string
+	data interface{}
+}
+
+type pipeFilter func(in pipeInput) (pipeInput, error)
+
+// pipeFilters creates filters from their arguments.
+var pipeFilters = map[string]func(args []string) (pipeFilter, error){ //nolint[gochecknoglobals]
+	"json": newJSONFilter,
+	"grep": newGrepFilter,
+	"head": newHeadFilter,
+}
+
+const pipeHelp = "Output can be piped to filters, e.g. `list | json 0.account` or `info 0 | grep port`:\n" +
+	"  json [path]  print output as JSON, optionally only the field at the dot-separated path\n" +
+	"  grep <text>  print only lines containing the text\n" +
+	"  head <count> print only the first lines"
+
+// AddCmd adds the command to the shell. The command and its subcommands
+// get support for pipes and are available for the help command.
+func (f *frontendCLI) AddCmd(cmd *ishell.Cmd) {
+	f.addPipes(cmd)
+	f.rootCmd.AddCmd(cmd)
+	f.Shell.AddCmd(cmd)
+}
+
+func (f *frontendCLI) addPipes(cmd *ishell.Cmd) {
+	if run := cmd.Func; run != nil {
+		cmd.Func = func(c *ishell.Context) { f.runWithPipes(c, run) }
+	}
+
+	complete := cmd.Completer
+	cmd.Completer = func(args []string) []string {
+		if len(args) > 0 && args[len(args)-1] == pipeSeparator {
+			return pipeFilterNames()
+		}
+		for _, arg := range args {
+			if arg == pipeSeparator {
+				return nil
+			}
+		}
+		if complete != nil {
+			return complete(args)
+		}
+		return childNames(cmd)
+	}
+
+	for _, child := range cmd.Children() {
+		f.addPipes(child)
+	}
+}
+
+// runWithPipes runs the command and passes its output through filters
+// if there are any.
+func (f *frontendCLI) runWithPipes(c *ishell.Context, run func(*ishell.Context)) {
+	args, filters, err := parsePipes(c.Args)
+	if err != nil {
+		f.Println(err)
+		return
+	}
+	if len(filters) == 0 {
+		run(c)
+		return
+	}
+
+	output := &bytes.Buffer{}
+	f.pipeData = nil
+	f.SetOut(output)
+	c.Args = args
+	run(c)
+	f.SetOut(readline.Stdout)
+
+	in := pipeInput{text: output.String(), data: f.pipeData}
+	f.pipeData = nil
+	for _, filter := range filters {
+		if in, err = filter(in); err != nil {
+			f.Println("Filter failed:", err)
+			return
+		}
+	}
+	f.Print(in.text)
+}
+
+// setPipeData provides output of the command as a structure for filters.
+func (f *frontendCLI) setPipeData(data interface{}) {
+	f.pipeData = data
+}
+
+func parsePipes(args []string) (cmdArgs []string, filters []pipeFilter, err error) {
+	stages := [][]string{{}}
+	for _, arg := range args {
+		if arg == pipeSeparator {
+			stages = append(stages, []string{})
+			continue
+		}
+		stages[len(stages)-1] = append(stages[len(stages)-1], arg)
+	}
+
+	for _, stage := range stages[1:] {
+		if len(stage) == 0 {
+			return nil, nil, fmt.Errorf("missing filter after %q, use one of: %s", pipeSeparator, strings.Join(pipeFilterNames(), ", "))
+		}
+		newFilter, ok := pipeFilters[stage[0]]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown filter %q, use one of: %s", stage[0], strings.Join(pipeFilterNames(), ", "))
+		}
+		filter, err := newFilter(stage[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	return stages[0], filters, nil
+}
+
+func newJSONFilter(args []string) (pipeFilter, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("json filter takes at most one path")
+	}
+	path := []string{}
+	if len(args) == 1 {
+		path = strings.Split(strings.Trim(args[0], "."), ".")
+	}
+
+	return func(in pipeInput) (pipeInput, error) {
+		data := in.data
+		if data == nil {
+			data = outputLines(in.text)
+		}
+
+		// Round trip converts structures to maps and slices walked by path.
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return pipeInput{}, err
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return pipeInput{}, err
+		}
+		if value, err = selectJSONPath(value, path); err != nil {
+			return pipeInput{}, err
+		}
+
+		out, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return pipeInput{}, err
+		}
+		return pipeInput{text: string(out) + "\n", data: value}, nil
+	}, nil
+}
+
+func selectJSONPath(value interface{}, path []string) (interface{}, error) {
+	for _, field := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[field]; !ok {
+				return nil, fmt.Errorf("no field %q", field)
+			}
+		case []interface{}:
+			index, err := strconv.Atoi(field)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("no index %q", field)
+			}
+			value = v[index]
+		default:
+			return nil, fmt.Errorf("no field %q", field)
+		}
+	}
+	return value, nil
+}
+
+func newGrepFilter(args []string) (pipeFilter, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("grep filter needs text to search for")
+	}
+	text := strings.ToLower(strings.Join(args, " "))
+
+	return func(in pipeInput) (pipeInput, error) {
+		out := &strings.Builder{}
+		for _, line := range strings.SplitAfter(in.text, "\n") {
+			if strings.Contains(strings.ToLower(line), text) {
+				out.WriteString(line)
+			}
+		}
+		return pipeInput{text: out.String()}, nil
+	}, nil
+}
+
+func newHeadFilter(args []string) (pipeFilter, error) {
+	count := 10
+	if len(args) > 0 {
+		var err error
+		if count, err = strconv.Atoi(args[0]); err != nil || count < 0 {
+			return nil, fmt.Errorf("head filter needs number of lines")
+		}
+	}
+
+	return func(in pipeInput) (pipeInput, error) {
+		lines := strings.SplitAfter(in.text, "\n")
+		if len(lines) > count {
+			lines = lines[:count]
+		}
+		return pipeInput{text: strings.Join(lines, "")}, nil
+	}, nil
+}
+
+// outputLines returns non-empty lines of the output without formatting.
+func outputLines(text string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(stripANSI(text), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// stripANSI removes escape sequences of colors and bold text.
+func stripANSI(text string) string {
+	out := &strings.Builder{}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\x1b' {
+			for i < len(text) && text[i] != 'm' {
+				i++
+			}
+			continue
+		}
+		out.WriteByte(text[i])
+	}
+	return out.String()
+}
+
+func pipeFilterNames() (names []string) {
+	for name := range pipeFilters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+func childNames(cmd *ishell.Cmd) (names []string) {
+	for _, child := range cmd.Children() {
+		names = append(names, child.Name)
+	}
+	return
+}
+
+// printHelp prints help of the command given as arguments or of all
+// commands.
+func (f *frontendCLI) printHelp(c *ishell.Context) {
+	if len(c.Args) == 0 {
+		f.Println(c.HelpText())
+		f.Println(pipeHelp)
+		return
+	}
+
+	cmd, args := f.rootCmd.FindCmd(c.Args)
+	if cmd == nil || len(args) > 0 {
+		f.Println("Unknown command:", strings.Join(c.Args, " "))
+		return
+	}
+
+	f.Print(cmd.HelpText())
+	if len(cmd.Aliases) > 0 {
+		f.Println("Aliases:", strings.Join(cmd.Aliases, ", "))
+	}
+}
+
+func (f *frontendCLI) completeHelp(args []string) []string {
+	cmd, rest := f.rootCmd.FindCmd(args)
+	if cmd == nil || len(rest) > 0 {
+		if len(args) > 0 {
+			return nil
+		}
+		cmd = f.rootCmd
+	}
+	return childNames(cmd)
+}
@@ -19,12 +19,38 @@ package cli
 
 import (
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/diagnostics"
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/imap"
+	"github.com/ProtonMail/proton-bridge/internal/incidents"
+	"github.com/ProtonMail/proton-bridge/internal/ldap"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/smtp"
+	"github.com/ProtonMail/proton-bridge/internal/stats"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/internal/store/archive"
+	"github.com/ProtonMail/proton-bridge/internal/store/rules"
+	"github.com/ProtonMail/proton-bridge/internal/store/scanner"
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/internal/updates"
+	"github.com/ProtonMail/proton-bridge/pkg/authpolicy"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/keychain"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/ProtonMail/proton-bridge/pkg/ports"
 	"github.com/abiosoft/ishell"
+	"github.com/sirupsen/logrus"
 )
 
 var (
@@ -39,7 +65,224 @@ func (f *frontendCLI) restart(c *ishell.Context) {
 	}
 }
 
+func (f *frontendCLI) reloadLocalRules(c *ishell.Context) {
+	path := f.config.GetLocalRulesPath()
+	localRules, err := rules.Load(path)
+	if err != nil {
+		f.Println("Local rules could not be loaded:", err)
+		return
+	}
+
+	store.SetLocalRules(localRules)
+	f.Printf("Loaded %d local rules from %s\n", len(localRules), path)
+}
+
+type incidentItem struct {
+	Kind    string    `json:"kind"`
+	Account string    `json:"account,omitempty"`
+	Message string    `json:"message"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Count   int       `json:"count"`
+}
+
+func (f *frontendCLI) showIncidents(c *ishell.Context) {
+	list := incidents.List()
+	if len(list) == 0 {
+		f.Println("No incidents since Bridge started.")
+	}
+
+	items := []incidentItem{}
+	for _, incident := range list {
+		item := incidentItem{
+			Kind:    string(incident.Kind),
+			Account: incident.UserID,
+			Message: incident.Message,
+			First:   incident.First,
+			Last:    incident.Last,
+			Count:   incident.Count,
+		}
+		if incident.UserID != "" {
+			if user, err := f.bridge.GetUser(incident.UserID); err == nil {
+				item.Account = user.Username()
+			}
+		}
+		items = append(items, item)
+
+		f.Printf("%s  %s", incident.Last.Format(time.RFC1123), bold(item.Kind))
+		if item.Account != "" {
+			f.Printf(" (%s)", item.Account)
+		}
+		if incident.Count > 1 {
+			f.Printf(" %d times since %s", incident.Count, incident.First.Format(time.RFC1123))
+		}
+		f.Println()
+		f.Println("  " + incident.Message)
+	}
+	f.setPipeData(items)
+}
+
+// defaultStatsPeriod is the period listed by stats when none is given.
+const defaultStatsPeriod = "30d"
+
+type statsItem struct {
+	Date           string   `json:"date"`
+	Version        string   `json:"version,omitempty"`
+	SyncedMessages int64    `json:"synced_messages"`
+	SentMessages   int64    `json:"sent_messages"`
+	APIErrors      int64    `json:"api_errors"`
+	CacheSize      int64    `json:"cache_size"`
+	Changes        []string `json:"changes,omitempty"`
+}
+
+// writeStats writes the daily metrics of the period, e.g. 30d, one day per
+// line. Days without any metric recorded, e.g. when bridge was not
+// running, are not listed.
+func writeStats(out io.Writer, period string) ([]statsItem, error) {
+	length, err := stats.ParsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := stats.List(time.Now().Add(-length))
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "No metrics were recorded in this period.")
+		return nil, nil
+	}
+
+	items := []statsItem{}
+	fmt.Fprintf(out, "%-10s  %-12s  %8s  %6s  %10s  %8s  %s\n", "date", "version", "synced", "sent", "api errors", "cache MB", "changes")
+	for _, entry := range entries {
+		item := statsItem{
+			Date:           entry.Date,
+			Version:        entry.Version,
+			SyncedMessages: entry.Counters[stats.SyncedMessages],
+			SentMessages:   entry.Counters[stats.SentMessages],
+			APIErrors:      entry.Counters[stats.APIErrors],
+			CacheSize:      entry.Gauges[stats.CacheSize],
+			Changes:        entry.Changes,
+		}
+		items = append(items, item)
+
+		fmt.Fprintf(out, "%-10s  %-12s  %8d  %6d  %10d  %8d  %s\n",
+			item.Date, item.Version, item.SyncedMessages, item.SentMessages, item.APIErrors,
+			item.CacheSize>>20, strings.Join(item.Changes, ", "),
+		)
+	}
+	return items, nil
+}
+
+func (f *frontendCLI) showStats(c *ishell.Context) {
+	period := defaultStatsPeriod
+	if len(c.Args) > 0 {
+		period = c.Args[0]
+	}
+
+	out := &strings.Builder{}
+	items, err := writeStats(out, period)
+	if err != nil {
+		f.printAndLogError("Cannot list metrics:", err)
+		return
+	}
+	f.Print(out.String())
+	f.setPipeData(items)
+}
+
+func (f *frontendCLI) clearIncidents(c *ishell.Context) {
+	incidents.Clear()
+	f.Println("Incidents cleared.")
+}
+
+func (f *frontendCLI) writeDiagnostics(c *ishell.Context) {
+	path := ""
+	if len(c.Args) > 0 {
+		path = c.Args[0]
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			f.printAndLogError("Cannot find home directory:", err)
+			return
+		}
+		path = filepath.Join(home, fmt.Sprintf("bridge-diagnostics-%d.zip", time.Now().Unix()))
+	}
+
+	info := diagnostics.Info{
+		Version:    f.config.GetVersion(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		GoVersion:  runtime.Version(),
+		Created:    time.Now(),
+		APIRetries: f.bridge.GetRetryMetrics(),
+	}
+
+	userIDs := []string{}
+	for _, user := range f.bridge.GetUsers() {
+		userIDs = append(userIDs, user.ID())
+
+		account := diagnostics.Account{
+			Connected: user.IsConnected(),
+			Combined:  user.IsCombinedAddressMode(),
+			Addresses: len(user.GetAddresses()),
+		}
+		if stats, err := user.GetStoreStatistics(); err != nil {
+			account.StoreError = err.Error()
+		} else {
+			account.Store = &stats
+		}
+		info.Accounts = append(info.Accounts, account)
+	}
+	info.Incidents = diagnostics.NewIncidents(incidents.List(), userIDs)
+
+	file, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		f.printAndLogError("Cannot create diagnostics file:", err)
+		return
+	}
+
+	if err := diagnostics.WriteBundle(file, info, f.config.GetLogDir()); err != nil {
+		_ = file.Close()
+		f.printAndLogError("Cannot write diagnostics:", err)
+		return
+	}
+
+	if err := file.Close(); err != nil {
+		f.printAndLogError("Cannot write diagnostics:", err)
+		return
+	}
+
+	f.Println("Diagnostics with redacted email addresses and subjects were saved to\n\n ", path)
+	f.Println("\nIt also describes the structure of messages which could not be decrypted or built, without their content.")
+}
+
+func (f *frontendCLI) exportCert(c *ishell.Context) {
+	if len(c.Args) == 0 {
+		f.Println("Please choose path where to save the certificate.")
+		return
+	}
+
+	path := c.Args[0]
+	if err := config.ExportCert(f.config.GetTLSCertPath(), path); err != nil {
+		f.printAndLogError("Cannot export certificate: ", err)
+		return
+	}
+	f.Println("Certificate saved to", path)
+}
+
+func (f *frontendCLI) installCert(c *ishell.Context) {
+	if err := config.InstallCert(f.config.GetTLSCertPath()); err != nil {
+		f.printAndLogError("Cannot install certificate: ", err)
+		return
+	}
+	f.Println("Certificate was added to the trust store of the system.")
+}
+
 func (f *frontendCLI) checkInternetConnection(c *ishell.Context) {
+	if status := f.bridge.GetAPIStatus(); !status.IsAvailable() {
+		f.Printf("Requests to the server are suspended since %s after %d failures (%s).\n",
+			status.Since.Format("15:04:05"), status.Failures, status.LastError)
+		f.Println("Clients are served from local cache; the server is checked again in", status.RetryIn(time.Now()).Round(time.Second))
+	}
+
 	if f.bridge.CheckConnection() == nil {
 		f.Println("Internet connection is available.")
 	} else {
@@ -51,6 +294,87 @@ func (f *frontendCLI) printLogDir(c *ishell.Context) {
 	f.Println("Log files are stored in\n\n ", f.config.GetLogDir())
 }
 
+// logSubsystems are offered by completion of log levels; any other value
+// of the pkg log field is accepted too.
+var logSubsystems = []string{"api", "bridge", "caldav", "frontend", "imap", "ldap", "pmapi", "smtp", "store", "users"} //nolint[gochecknoglobals]
+
+func (f *frontendCLI) completeLogSubsystems(args []string) (suggestions []string) {
+	for _, subsystem := range logSubsystems {
+		suggestions = append(suggestions, subsystem+"=")
+	}
+	return suggestions
+}
+
+func (f *frontendCLI) changeLogLevels(c *ishell.Context) {
+	levels := config.GetLogLevels()
+
+	for _, arg := range c.Args {
+		if arg == "reset" {
+			levels = map[string]logrus.Level{}
+			continue
+		}
+
+		if strings.HasSuffix(arg, "=") {
+			delete(levels, strings.TrimSuffix(arg, "="))
+			continue
+		}
+
+		changed, err := config.ParseLogLevels(arg)
+		if err != nil {
+			f.printAndLogError("Cannot change log level:", err)
+			return
+		}
+		for subsystem, level := range changed {
+			levels[subsystem] = level
+		}
+	}
+
+	if len(c.Args) != 0 {
+		config.SetLogLevels(levels)
+		f.preferences.Set(preferences.LogLevelsKey, config.FormatLogLevels(levels))
+	}
+
+	if len(levels) == 0 {
+		f.Println("All subsystems log with the level set by --log-level.")
+		return
+	}
+
+	f.Println("Subsystems with own log level:", bold(config.FormatLogLevels(levels)))
+	f.Println("Other subsystems log with the level set by --log-level.")
+}
+
+func (f *frontendCLI) toggleLogAnonymization(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	if config.IsLogAnonymized() {
+		if f.yesNoQuestion("Are you sure you want to log email addresses, subjects and IDs as they are") {
+			config.SetLogAnonymization(nil)
+			f.preferences.SetBool(preferences.LogAnonymizeKey, false)
+			f.Println("Log is not anonymized anymore.")
+		}
+		return
+	}
+
+	f.Println("Email addresses, subjects and IDs will be replaced by pseudonyms. The same value always")
+	f.Println("has the same pseudonym, so entries about one message or account can still be correlated.")
+	f.Println("Entries logged before are not changed. Debug levels dumping messages are not anonymized.")
+
+	if !f.yesNoQuestion("Are you sure you want to anonymize the log") {
+		return
+	}
+
+	key, err := config.LoadLogAnonymizationKey(f.config.GetLogAnonymizationKeyPath())
+	if err != nil {
+		f.printAndLogError("Cannot load key of log pseudonyms:", err)
+		return
+	}
+
+	config.SetLogAnonymization(key)
+	f.preferences.SetBool(preferences.LogAnonymizeKey, true)
+	f.Println("Log is anonymized.")
+}
+
 func (f *frontendCLI) printManual(c *ishell.Context) {
 	f.Println("More instructions about the Bridge can be found at\n\n  https://protonmail.com/bridge")
 }
@@ -83,16 +407,21 @@ func (f *frontendCLI) changeSMTPSecurity(c *ishell.Context) {
 		newSecurity = "STARTTLS"
 	}
 
-	msg := fmt.Sprintf("Are you sure you want to change SMTP setting to %q and restart the Bridge", newSecurity)
+	msg := fmt.Sprintf("Are you sure you want to change SMTP setting to %q", newSecurity)
 
 	if f.yesNoQuestion(msg) {
 		f.preferences.SetBool(preferences.SMTPSSLKey, !isSSL)
-		f.Println("Restarting Bridge...")
-		f.appRestart = true
-		f.Stop()
+		f.applyListenerSettings()
 	}
 }
 
+// applyListenerSettings moves IMAP and SMTP servers to the changed ports,
+// security and bind address without restart.
+func (f *frontendCLI) applyListenerSettings() {
+	f.eventListener.Emit(events.ListenerSettingsChangedEvent, "")
+	f.Println("Settings applied. Open connections are kept until clients close them.")
+}
+
 func (f *frontendCLI) changePort(c *ishell.Context) {
 	f.ShowPrompt(false)
 	defer f.ShowPrompt(true)
@@ -120,14 +449,184 @@ func (f *frontendCLI) changePort(c *ishell.Context) {
 		f.Println("Saving values IMAP:", newIMAPPort, "SMTP:", newSMTPPort)
 		f.preferences.Set(preferences.IMAPPortKey, newIMAPPort)
 		f.preferences.Set(preferences.SMTPPortKey, newSMTPPort)
-		f.Println("Restarting Bridge...")
-		f.appRestart = true
-		f.Stop()
+		f.applyListenerSettings()
 	} else {
 		f.Println("Nothing changed")
 	}
 }
 
+func (f *frontendCLI) changeSMTPImplicitTLSPort(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	currentPort = f.preferences.Get(preferences.SMTPImplicitTLSPortKey)
+	newPort := f.readStringInAttempts("Set SMTP port with implicit TLS, 0 to disable (current "+currentPort+")", c.ReadLine, f.isPortFree)
+	if newPort == "" || newPort == currentPort {
+		f.Println("Nothing changed")
+		return
+	}
+
+	if newPort != "0" && (newPort == f.preferences.Get(preferences.IMAPPortKey) || newPort == f.preferences.Get(preferences.SMTPPortKey)) {
+		f.Println("SMTP port with implicit TLS must be different from IMAP and SMTP ports!")
+		return
+	}
+
+	f.Println("Saving SMTP port with implicit TLS:", newPort)
+	f.preferences.Set(preferences.SMTPImplicitTLSPortKey, newPort)
+	f.applyListenerSettings()
+}
+
+func (f *frontendCLI) toggleScheduleByDate(c *ishell.Context) {
+	if f.preferences.GetBool(preferences.ScheduleByDateKey) {
+		f.Println("Bridge currently sends messages with Date in the future at that time.")
+		if f.yesNoQuestion("Are you sure you want to send such messages right away") {
+			f.preferences.SetBool(preferences.ScheduleByDateKey, false)
+		}
+	} else {
+		f.Println("Bridge currently sends messages with Date in the future right away.")
+		if f.yesNoQuestion("Are you sure you want to send such messages at that time") {
+			f.preferences.SetBool(preferences.ScheduleByDateKey, true)
+		}
+	}
+}
+
+func (f *frontendCLI) toggleRequestReadReceipt(c *ishell.Context) {
+	if f.preferences.GetBool(preferences.RequestReadReceiptKey) {
+		f.Println("Bridge currently requests read receipt for every sent message.")
+		if f.yesNoQuestion("Are you sure you want to request it only when your client asks for it") {
+			f.preferences.SetBool(preferences.RequestReadReceiptKey, false)
+		}
+	} else {
+		f.Println("Bridge currently requests read receipt only when your client asks for it.")
+		if f.yesNoQuestion("Are you sure you want to request it for every sent message") {
+			f.preferences.SetBool(preferences.RequestReadReceiptKey, true)
+		}
+	}
+}
+
+func (f *frontendCLI) toggleAttachPublicKey(c *ishell.Context) {
+	if f.preferences.GetBool(preferences.AttachPublicKeyKey) {
+		f.Println("Bridge currently attaches your public key to messages sent to recipients outside of Proton.")
+		if f.yesNoQuestion("Are you sure you want to attach it only when enabled in your mail settings") {
+			f.preferences.SetBool(preferences.AttachPublicKeyKey, false)
+		}
+	} else {
+		f.Println("Bridge currently attaches your public key only when enabled in your mail settings.")
+		if f.yesNoQuestion("Are you sure you want to attach it to every message sent to recipients outside of Proton") {
+			f.preferences.SetBool(preferences.AttachPublicKeyKey, true)
+		}
+	}
+}
+
+func (f *frontendCLI) changeAutocrypt(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Autocrypt header lets mail clients of recipients outside of Proton encrypt replies to you.")
+	f.preferences.SetBool(preferences.AutocryptKey, f.yesNoQuestion("Do you want to send your public key by Autocrypt header"))
+
+	f.Println("Keys from Autocrypt headers of received messages can be added to contacts without a key.")
+	importKeys := f.yesNoQuestion("Do you want to add such keys to your contacts")
+	f.preferences.SetBool(preferences.AutocryptImportKey, importKeys)
+	store.SetAutocryptImport(importKeys)
+
+	f.Println("Autocrypt settings were changed.")
+}
+
+func (f *frontendCLI) changeSenderPolicy(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Sender policy decides what to do when the From header or the address used to log in")
+	f.Println("does not match the MAIL FROM address:")
+	f.Println("  " + smtp.SenderPolicyStrict + " - reject the message")
+	f.Println("  " + smtp.SenderPolicyRewrite + " - send from the MAIL FROM address and rewrite the From header")
+	f.Println("  " + smtp.SenderPolicyAllow + " - send from the From header address if it is yours")
+
+	current := f.preferences.Get(preferences.SenderPolicyKey)
+	policy := f.readStringInAttempts("Sender policy (current "+current+")", c.ReadLine, smtp.IsValidSenderPolicy)
+	if policy == "" {
+		return
+	}
+
+	f.preferences.Set(preferences.SenderPolicyKey, policy)
+	f.Println("Sender policy was changed.")
+}
+
+func (f *frontendCLI) changeMessageIDPolicy(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Message-ID policy decides who generates Message-ID of sent messages which have none:")
+	f.Println("  " + smtp.MessageIDPolicyCustomDomain + " - Bridge in the sender domain for custom domains, API for Proton domains")
+	f.Println("  " + smtp.MessageIDPolicyAlways + " - Bridge in the sender domain for all addresses")
+	f.Println("  " + smtp.MessageIDPolicyAPI + " - API")
+
+	current := f.preferences.Get(preferences.MessageIDPolicyKey)
+	policy := f.readStringInAttempts("Message-ID policy (current "+current+")", c.ReadLine, smtp.IsValidMessageIDPolicy)
+	if policy == "" {
+		return
+	}
+
+	f.preferences.Set(preferences.MessageIDPolicyKey, policy)
+	f.Println("Message-ID policy was changed.")
+}
+
+func (f *frontendCLI) changeSendPolicies(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Send policies are checked for every message sent over SMTP by all accounts. Domains include subdomains.")
+	f.Println("  " + smtp.SendPolicyBlock + ":domain - reject messages to recipients in the domain")
+	f.Println("  " + smtp.SendPolicyEncrypt + ":domain - reject messages to recipients in the domain which would not be encrypted")
+	f.Println("  " + smtp.SendPolicyWarnExternal + ":domain - warn when a message from an address in the domain is sent outside of it")
+	f.Println("Use `none` to remove all policies.")
+
+	isPolicies := func(val string) bool {
+		_, err := smtp.ParseSendPolicies(val)
+		return val == "none" || err == nil
+	}
+
+	policies := f.preferences.Get(preferences.SendPoliciesKey)
+	val := f.readStringInAttempts("Comma-separated policies, e.g. block:example.com, encrypt:partner.org (current \""+policies+"\")", c.ReadLine, isPolicies)
+	switch val {
+	case "":
+		return
+	case "none":
+		policies = ""
+	default:
+		parsed, _ := smtp.ParseSendPolicies(val)
+		policies = smtp.FormatSendPolicies(parsed)
+	}
+
+	f.preferences.Set(preferences.SendPoliciesKey, policies)
+	f.Println("Send policies were changed.")
+}
+
+func (f *frontendCLI) changeSMIMECertificates(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Messages for recipients without PGP are signed by S/MIME certificate of the sender address.")
+	f.Println("Put the certificate with its private key in PEM file named by the address into the folder,")
+	f.Println("e.g. alice@example.com.pem. Intermediate certificates can be added to the same file.")
+
+	current := f.preferences.Get(preferences.SMIMEDirKey)
+	dir := f.readStringInAttempts("Absolute path of folder with certificates, `none` to disable (current \""+current+"\")", c.ReadLine, func(val string) bool {
+		return val == "none" || filepath.IsAbs(val)
+	})
+	switch dir {
+	case "":
+		return
+	case "none":
+		f.preferences.Set(preferences.SMIMEDirKey, "")
+		f.Println("Messages are not signed by S/MIME.")
+	default:
+		f.preferences.Set(preferences.SMIMEDirKey, dir)
+		f.Println("Messages are signed by S/MIME when the folder contains certificate of the sender address.")
+	}
+}
+
 func (f *frontendCLI) toggleAllowProxy(c *ishell.Context) {
 	if f.preferences.GetBool(preferences.AllowProxyKey) {
 		f.Println("Bridge is currently set to use alternative routing to connect to Proton if it is being blocked.")
@@ -144,19 +643,898 @@ func (f *frontendCLI) toggleAllowProxy(c *ishell.Context) {
 	}
 }
 
-func (f *frontendCLI) isPortFree(port string) bool {
-	port = strings.Replace(port, ":", "", -1)
-	if port == "" || port == currentPort {
-		return true
+func (f *frontendCLI) toggleLDAP(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	isEnabled := f.preferences.GetBool(preferences.LDAPEnabledKey)
+	msg := "Are you sure you want to enable LDAP server on port " + f.preferences.Get(preferences.LDAPPortKey) + " and restart the Bridge"
+	if isEnabled {
+		msg = "Are you sure you want to disable LDAP server and restart the Bridge"
 	}
-	number, err := strconv.Atoi(port)
-	if err != nil || number < 0 || number > 65535 {
-		f.Println("Input", port, "is not a valid port number.")
-		return false
+
+	if f.yesNoQuestion(msg) {
+		f.preferences.SetBool(preferences.LDAPEnabledKey, !isEnabled)
+		if !isEnabled {
+			f.Println("Use search base " + ldap.BaseDN + " and Bridge username and password in your address book.")
+		}
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
 	}
-	if !ports.IsPortFree(number) {
-		f.Println("Port", number, "is occupied by another process.")
-		return false
+}
+
+func (f *frontendCLI) toggleCalDAV(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	isEnabled := f.preferences.GetBool(preferences.CalDAVEnabledKey)
+	msg := "Are you sure you want to enable CalDAV server on port " + f.preferences.Get(preferences.CalDAVPortKey) + " and restart the Bridge"
+	if isEnabled {
+		msg = "Are you sure you want to disable CalDAV server and restart the Bridge"
 	}
-	return true
+
+	if f.yesNoQuestion(msg) {
+		f.preferences.SetBool(preferences.CalDAVEnabledKey, !isEnabled)
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) toggleEventSocket(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	isEnabled := f.preferences.GetBool(preferences.EventSocketEnabledKey)
+	msg := "Are you sure you want to publish events at " + f.config.GetEventSocketPath() + " and restart the Bridge"
+	if isEnabled {
+		msg = "Are you sure you want to stop publishing events and restart the Bridge"
+	}
+
+	if f.yesNoQuestion(msg) {
+		f.preferences.SetBool(preferences.EventSocketEnabledKey, !isEnabled)
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) toggleNotifications(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	isEnabled := f.preferences.GetBool(preferences.NotificationsEnabledKey)
+	msg := "Are you sure you want to show desktop notifications of new messages"
+	if isEnabled {
+		msg = "Are you sure you want to stop showing desktop notifications of new messages"
+	}
+
+	if f.yesNoQuestion(msg) {
+		f.preferences.SetBool(preferences.NotificationsEnabledKey, !isEnabled)
+		if isEnabled {
+			f.Println("Notifications of new messages are off.")
+		} else {
+			f.Println("Notifications of new messages are on, change notified folders and quiet hours of each account by `change account-notifications`.")
+		}
+	}
+}
+
+func (f *frontendCLI) toggleGRPC(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	isEnabled := f.preferences.GetBool(preferences.GRPCEnabledKey)
+	msg := "Are you sure you want to serve gRPC API for other frontends at " + f.config.GetGRPCSocketPath() + " and restart the Bridge"
+	if isEnabled {
+		msg = "Are you sure you want to stop serving gRPC API and restart the Bridge"
+	}
+
+	if f.yesNoQuestion(msg) {
+		f.preferences.SetBool(preferences.GRPCEnabledKey, !isEnabled)
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) changeMessageLocale(c *ishell.Context) {
+	locale := ""
+	if len(c.Args) > 0 {
+		locale = strings.TrimSpace(c.Args[0])
+	}
+
+	f.preferences.Set(preferences.MessageLocaleKey, locale)
+	message.SetTemplateOptions(message.TemplateOptions{
+		Locale: locale,
+		Dir:    f.config.GetTemplatesDir(),
+	})
+
+	if locale == "" {
+		locale = "system locale"
+	}
+	f.Printf("Messages created by bridge use %s. Built-in translations: %s. Templates can be overridden in %s\n",
+		bold(locale), strings.Join(message.Locales(), ", "), f.config.GetTemplatesDir())
+}
+
+func (f *frontendCLI) toggleAccountPorts(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	isEnabled := f.preferences.GetBool(preferences.AccountPortsKey)
+	msg := "Are you sure you want to listen on dedicated IMAP and SMTP ports for each account and restart the Bridge"
+	if isEnabled {
+		msg = "Are you sure you want to use only shared IMAP and SMTP ports and restart the Bridge"
+	}
+
+	if f.yesNoQuestion(msg) {
+		f.preferences.SetBool(preferences.AccountPortsKey, !isEnabled)
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) toggleHideSelfSent(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	isHidden := f.preferences.GetBool(preferences.HideSelfSentKey)
+	msg := "Are you sure you want to hide received copies of messages sent to own addresses in All Mail and restart the Bridge (full resync is needed)"
+	if isHidden {
+		msg = "Are you sure you want to show received copies of messages sent to own addresses in All Mail and restart the Bridge (full resync is needed)"
+	}
+
+	if f.yesNoQuestion(msg) {
+		f.preferences.SetBool(preferences.HideSelfSentKey, !isHidden)
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) changeLocalArchive(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("New messages in chosen mailboxes are written decrypted to the archive folder. Leave folder empty to disable archiving.")
+
+	currentDir := f.preferences.Get(preferences.LocalArchiveDirKey)
+	f.Printf("Archive folder (current %q): ", currentDir)
+	dir := strings.TrimSpace(c.ReadLine())
+
+	format := f.preferences.Get(preferences.LocalArchiveFormatKey)
+	mailboxes := f.preferences.Get(preferences.LocalArchiveMailboxesKey)
+	if dir != "" {
+		isFormat := func(val string) bool {
+			return val == "" || val == archive.FormatMaildir || val == archive.FormatMBOX
+		}
+		if newFormat := f.readStringInAttempts("Format, "+archive.FormatMaildir+" or "+archive.FormatMBOX+" (current "+format+")", c.ReadLine, isFormat); newFormat != "" {
+			format = newFormat
+		}
+
+		f.Printf("Comma-separated mailboxes, e.g. INBOX, Folders/Work (current %s): ", mailboxes)
+		if newMailboxes := strings.TrimSpace(c.ReadLine()); newMailboxes != "" {
+			mailboxes = newMailboxes
+		}
+	}
+
+	if !f.yesNoQuestion("Are you sure you want to save the local archive settings and restart the Bridge") {
+		return
+	}
+
+	f.preferences.Set(preferences.LocalArchiveDirKey, dir)
+	f.preferences.Set(preferences.LocalArchiveFormatKey, format)
+	f.preferences.Set(preferences.LocalArchiveMailboxesKey, mailboxes)
+	f.Println("Restarting Bridge...")
+	f.appRestart = true
+	f.Stop()
+}
+
+func (f *frontendCLI) changeSyncLimits(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Initial sync can be limited to save bandwidth. Use 0 for no limit and \"none\" to sync at any time.")
+
+	isNonNegative := func(val string) bool {
+		number, err := strconv.ParseFloat(val, 64)
+		return val == "" || (err == nil && number >= 0)
+	}
+	isWindow := func(val string) bool {
+		_, _, err := store.ParseSyncWindow(val)
+		return val == "" || val == "none" || err == nil
+	}
+
+	bytesPerSecond := f.preferences.Get(preferences.SyncMaxBytesKey)
+	if val := f.readStringInAttempts("Bytes per second (current "+bytesPerSecond+")", c.ReadLine, func(val string) bool {
+		_, err := strconv.Atoi(val)
+		return isNonNegative(val) && (val == "" || err == nil)
+	}); val != "" {
+		bytesPerSecond = val
+	}
+
+	requestsPerSecond := f.preferences.Get(preferences.SyncMaxRequestsKey)
+	if val := f.readStringInAttempts("Requests per second (current "+requestsPerSecond+")", c.ReadLine, isNonNegative); val != "" {
+		requestsPerSecond = val
+	}
+
+	window := f.preferences.Get(preferences.SyncWindowKey)
+	if val := f.readStringInAttempts("Time window HH:MM-HH:MM (current \""+window+"\")", c.ReadLine, isWindow); val == "none" {
+		window = ""
+	} else if val != "" {
+		window = val
+	}
+
+	f.preferences.Set(preferences.SyncMaxBytesKey, bytesPerSecond)
+	f.preferences.Set(preferences.SyncMaxRequestsKey, requestsPerSecond)
+	f.preferences.Set(preferences.SyncWindowKey, window)
+	store.SetSyncThrottleOptions(preferences.GetSyncThrottleOptions(f.preferences))
+	f.Println("Sync limits were changed.")
+}
+
+func (f *frontendCLI) changeDeletedRetention(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := f.preferences.Get(preferences.DeletedRetentionKey)
+	days := f.readStringInAttempts("Days to keep deleted messages restorable (current "+current+")", c.ReadLine, func(val string) bool {
+		number, err := strconv.Atoi(val)
+		return err == nil && number >= 0
+	})
+	if days == "" {
+		return
+	}
+
+	f.preferences.Set(preferences.DeletedRetentionKey, days)
+	store.SetDeletedRetention(preferences.GetDeletedRetention(f.preferences))
+	f.Println("Retention of deleted messages was changed.")
+}
+
+func (f *frontendCLI) changeEventPolling(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("New events are polled often while an IMAP client waits for push or was used in last few minutes.")
+	f.Println("Otherwise they are polled with the background interval; use 0 to always poll with the active interval.")
+
+	isSeconds := func(val string) bool {
+		number, err := strconv.Atoi(val)
+		return val == "" || (err == nil && number >= 0)
+	}
+
+	active := f.preferences.Get(preferences.EventPollActiveKey)
+	if val := f.readStringInAttempts("Seconds between polls while clients are active (current "+active+")", c.ReadLine, isSeconds); val != "" {
+		active = val
+	}
+
+	background := f.preferences.Get(preferences.EventPollBackgroundKey)
+	if val := f.readStringInAttempts("Seconds between polls while clients are not active (current "+background+")", c.ReadLine, isSeconds); val != "" {
+		background = val
+	}
+
+	f.preferences.Set(preferences.EventPollActiveKey, active)
+	f.preferences.Set(preferences.EventPollBackgroundKey, background)
+	store.SetPollOptions(preferences.GetPollOptions(f.preferences))
+	f.Println("Event polling was changed.")
+}
+
+func (f *frontendCLI) changeRetentionPolicies(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Messages older than given number of days are regularly removed from chosen mailboxes of all accounts.")
+	f.Println("Use `delete` to move them to Trash (messages in Trash and Spam are deleted permanently) or `archive` to save them to local Maildir first.")
+	f.Println("Use `none` to remove all policies. Use `retention preview` to check which messages would be removed.")
+
+	isPolicies := func(val string) bool {
+		_, err := store.ParseRetentionPolicies(val)
+		return val == "none" || err == nil
+	}
+
+	policies := f.preferences.Get(preferences.RetentionPoliciesKey)
+	if val := f.readStringInAttempts("Comma-separated policies, e.g. Labels/Newsletters=delete:90, Folders/Receipts=archive:365 (current \""+policies+"\")", c.ReadLine, isPolicies); val == "none" {
+		policies = ""
+	} else if val != "" {
+		policies = val
+	}
+
+	archiveDir := f.preferences.Get(preferences.RetentionArchiveDirKey)
+	parsed, _ := store.ParseRetentionPolicies(policies)
+	for _, policy := range parsed {
+		if policy.Action != store.RetentionArchive {
+			continue
+		}
+		f.Printf("Archive folder (current %q): ", archiveDir)
+		if dir := strings.TrimSpace(c.ReadLine()); dir != "" {
+			archiveDir = dir
+		}
+		break
+	}
+
+	f.preferences.Set(preferences.RetentionPoliciesKey, policies)
+	f.preferences.Set(preferences.RetentionArchiveDirKey, archiveDir)
+	store.SetRetentionOptions(preferences.GetRetentionOptions(f.preferences))
+	f.Println("Retention policies were changed.")
+}
+
+func (f *frontendCLI) changeAttachmentScanner(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Attachments are scanned when they are downloaded to the attachment cache.")
+	f.Println("The command gets the attachment on standard input and exits with 1 when it is infected, e.g. `clamdscan --no-summary -`.")
+	f.Println("ICAP server is given by URL of its service, e.g. icap://localhost:1344/avscan. Use `none` to stop scanning.")
+
+	isScanner := func(val string) bool {
+		if val == "" || val == "none" {
+			return true
+		}
+		_, err := scanner.New(val)
+		return err == nil
+	}
+
+	target := f.preferences.Get(preferences.AttachmentScannerKey)
+	if val := f.readStringInAttempts("Scanner command or ICAP URL (current \""+target+"\")", c.ReadLine, isScanner); val == "none" {
+		target = ""
+	} else if val != "" {
+		target = val
+	}
+
+	quarantine := f.preferences.Get(preferences.AttachmentQuarantineKey)
+	if target != "" {
+		f.Printf("Infected messages get the %s keyword. Mailbox to move them to, e.g. Folders/Quarantine, or `none` to keep them (current %q): ", message.InfectedFlag, quarantine)
+		if val := strings.TrimSpace(c.ReadLine()); val == "none" {
+			quarantine = ""
+		} else if val != "" {
+			quarantine = val
+		}
+	}
+
+	f.preferences.Set(preferences.AttachmentScannerKey, target)
+	f.preferences.Set(preferences.AttachmentQuarantineKey, quarantine)
+	store.SetScanOptions(preferences.GetScanOptions(f.preferences))
+	f.Println("Attachment scanner was changed.")
+}
+
+func (f *frontendCLI) changePhishingCheck(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Links of received messages can be checked for punycode hosts, link text showing another domain,")
+	f.Println("lookalikes of protected domains, user info in URL and IP addresses. Messages get the", message.PhishingScoreHeaderKey)
+	f.Println("header with score from 0 to 100, so filters of mail clients can move suspect messages away.")
+
+	enabled := f.yesNoQuestion("Do you want to check links of received messages")
+	f.preferences.SetBool(preferences.PhishingCheckKey, enabled)
+
+	if enabled {
+		domains := f.preferences.Get(preferences.PhishingDomainsKey)
+		f.Printf("Domains protected in addition to %s, comma separated, or `none` (current %q): ", strings.Join(message.DefaultProtectedDomains, ", "), domains)
+		if val := strings.TrimSpace(c.ReadLine()); val == "none" {
+			domains = ""
+		} else if val != "" {
+			domains = strings.Join(preferences.SplitList(val), ",")
+		}
+		f.preferences.Set(preferences.PhishingDomainsKey, domains)
+	}
+
+	store.SetPhishingOptions(preferences.GetPhishingOptions(f.preferences))
+	f.Println("Checking of links was changed. Messages fetched by clients before keep their header.")
+}
+
+func (f *frontendCLI) changeAttachmentPlaceholders(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := f.preferences.Get(preferences.AttPlaceholderSizeKey)
+	size := f.readStringInAttempts("Size in bytes above which attachments are downloaded only when opened, 0 to disable (current "+current+")", c.ReadLine, func(val string) bool {
+		number, err := strconv.Atoi(val)
+		return err == nil && number >= 0
+	})
+	if size == "" {
+		return
+	}
+
+	f.preferences.Set(preferences.AttPlaceholderSizeKey, size)
+	imap.SetAttachmentPlaceholderSize(int64(f.preferences.GetInt(preferences.AttPlaceholderSizeKey)))
+	f.Println("Attachment placeholders were changed.")
+}
+
+func (f *frontendCLI) changeMessageSizeLimit(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := f.preferences.Get(preferences.MessageSizeLimitKey)
+	size := f.readStringInAttempts("Size in bytes above which clients get only a preview of the message, 0 to disable (current "+current+")", c.ReadLine, func(val string) bool {
+		number, err := strconv.Atoi(val)
+		return err == nil && number >= 0
+	})
+	if size == "" {
+		return
+	}
+
+	f.preferences.Set(preferences.MessageSizeLimitKey, size)
+	imap.SetMessageSizeLimit(int64(f.preferences.GetInt(preferences.MessageSizeLimitKey)))
+	f.Println("Message size limit was changed.")
+}
+
+func (f *frontendCLI) changeSessionQuotas(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Clients exceeding a quota get THROTTLED response until the quota renews. Use 0 for no limit.")
+
+	isNonNegative := func(val string) bool {
+		number, err := strconv.Atoi(val)
+		return val == "" || (err == nil && number >= 0)
+	}
+
+	fetchQuota := f.preferences.Get(preferences.FetchQuotaKey)
+	if val := f.readStringInAttempts("Megabytes fetched per hour (current "+fetchQuota+")", c.ReadLine, isNonNegative); val != "" {
+		fetchQuota = val
+	}
+
+	appendQuota := f.preferences.Get(preferences.AppendQuotaKey)
+	if val := f.readStringInAttempts("Messages appended per day (current "+appendQuota+")", c.ReadLine, isNonNegative); val != "" {
+		appendQuota = val
+	}
+
+	f.preferences.Set(preferences.FetchQuotaKey, fetchQuota)
+	f.preferences.Set(preferences.AppendQuotaKey, appendQuota)
+	imap.SetSessionQuota(imap.SessionQuota{
+		FetchBytesPerHour: int64(f.preferences.GetInt(preferences.FetchQuotaKey)) << 20,
+		AppendsPerDay:     int64(f.preferences.GetInt(preferences.AppendQuotaKey)),
+	})
+	f.Println("Session quotas were changed.")
+}
+
+func (f *frontendCLI) changeConnectionLimits(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Limits apply to IMAP and SMTP separately. Use 0 for no limit.")
+
+	isNonNegative := func(val string) bool {
+		number, err := strconv.Atoi(val)
+		return val == "" || (err == nil && number >= 0)
+	}
+
+	maxConnections := f.preferences.Get(preferences.MaxConnectionsKey)
+	if val := f.readStringInAttempts("Simultaneous connections per account (current "+maxConnections+")", c.ReadLine, isNonNegative); val != "" {
+		maxConnections = val
+	}
+
+	f.Println("IMAP clients in IDLE renew it every 29 minutes, shorter idle timeout disconnects them.")
+	idleTimeout := f.preferences.Get(preferences.IdleTimeoutKey)
+	if val := f.readStringInAttempts("Minutes after which idle connections are closed (current "+idleTimeout+")", c.ReadLine, isNonNegative); val != "" {
+		idleTimeout = val
+	}
+
+	f.preferences.Set(preferences.MaxConnectionsKey, maxConnections)
+	f.preferences.Set(preferences.IdleTimeoutKey, idleTimeout)
+	imap.SetConnectionLimits(preferences.GetConnectionLimits(f.preferences))
+	smtp.SetConnectionLimits(preferences.GetConnectionLimits(f.preferences))
+	f.Println("Connection limits were changed.")
+}
+
+// connectionListItem is the number of open sessions printed by the
+// connections command for pipe filters.
+type connectionListItem struct {
+	Account string `json:"account"`
+	IMAP    int    `json:"imap"`
+	SMTP    int    `json:"smtp"`
+}
+
+func (f *frontendCLI) showConnections(c *ishell.Context) {
+	imapCounts := imap.ConnectionCounts()
+	smtpCounts := smtp.ConnectionCounts()
+
+	spacing := "%-30s %6s %6s\n"
+	f.Printf(bold(spacing), "account", "IMAP", "SMTP")
+
+	items := []connectionListItem{}
+	for _, user := range f.bridge.GetUsers() {
+		item := connectionListItem{
+			Account: user.Username(),
+			IMAP:    imapCounts[user.ID()],
+			SMTP:    smtpCounts[user.ID()],
+		}
+		f.Printf(spacing, item.Account, strconv.Itoa(item.IMAP), strconv.Itoa(item.SMTP))
+		items = append(items, item)
+	}
+
+	f.Println()
+	f.Println("Limit per account:", f.preferences.Get(preferences.MaxConnectionsKey), "(0 means no limit)")
+	f.setPipeData(items)
+}
+
+func (f *frontendCLI) changeAuthPolicy(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	requireTLS := f.yesNoQuestion("Require STARTTLS before login (clients set to no encryption will not be able to log in)")
+
+	current := f.preferences.Get(preferences.AuthMechanismsKey)
+	f.Println("Supported authentication mechanisms are", strings.Join(authpolicy.Mechanisms, ", "))
+	mechanisms := f.readStringInAttempts("Allowed mechanisms separated by comma (current "+current+")", c.ReadLine, func(val string) bool {
+		mechanisms, err := authpolicy.ParseMechanisms(val)
+		if err != nil {
+			f.Println(err)
+		}
+		return val == "" || (err == nil && len(mechanisms) > 0)
+	})
+	if mechanisms == "" {
+		mechanisms = current
+	}
+	parsed, _ := authpolicy.ParseMechanisms(mechanisms)
+	mechanisms = strings.Join(parsed, ",")
+
+	if requireTLS == f.preferences.GetBool(preferences.AuthRequireTLSKey) && mechanisms == current {
+		f.Println("Authentication policy was not changed.")
+		return
+	}
+
+	if f.yesNoQuestion("Clients may need to be reconfigured. Are you sure you want to change the policy and restart the Bridge") {
+		f.preferences.SetBool(preferences.AuthRequireTLSKey, requireTLS)
+		f.preferences.Set(preferences.AuthMechanismsKey, mechanisms)
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) changeRemoteAccess(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("IMAP and SMTP can listen on other interface so clients from LAN or a VM can connect.")
+	f.Println("Remote clients must use STARTTLS and hosts failing to log in repeatedly are blocked for a while.")
+	f.Println("Use `none` for bind address to listen on loopback only.")
+
+	bindAddress := f.preferences.Get(preferences.BindAddressKey)
+	if val := f.readStringInAttempts("Bind address, e.g. 192.168.1.2 or 0.0.0.0 for all interfaces (current \""+bindAddress+"\")", c.ReadLine, func(val string) bool {
+		return val == "" || val == "none" || net.ParseIP(val) != nil
+	}); val == "none" {
+		bindAddress = ""
+	} else if val != "" {
+		bindAddress = val
+	}
+
+	allowedHosts := f.preferences.Get(preferences.RemoteAllowedHostsKey)
+	if bindAddress != "" {
+		if val := f.readStringInAttempts("Comma-separated allowed hosts, e.g. 192.168.1.10, 10.0.0.0/24 (current \""+allowedHosts+"\")", c.ReadLine, func(val string) bool {
+			_, err := bridge.ParseAllowedHosts(val)
+			if err != nil {
+				f.Println(err)
+			}
+			return err == nil
+		}); val != "" {
+			allowedHosts = val
+		}
+		if allowedHosts == "" {
+			f.Println("No host is allowed, Bridge will keep listening on loopback only.")
+		}
+	}
+
+	if bindAddress == f.preferences.Get(preferences.BindAddressKey) && allowedHosts == f.preferences.Get(preferences.RemoteAllowedHostsKey) {
+		f.Println("Remote access was not changed.")
+		return
+	}
+
+	if f.yesNoQuestion("Are you sure you want to change remote access") {
+		// Login policy of remote clients is set when servers start.
+		wasEnabled := bridge.LoadRemoteAccess(f.preferences).IsEnabled()
+		f.preferences.Set(preferences.BindAddressKey, bindAddress)
+		f.preferences.Set(preferences.RemoteAllowedHostsKey, allowedHosts)
+		if bridge.LoadRemoteAccess(f.preferences).IsEnabled() == wasEnabled {
+			f.applyListenerSettings()
+			return
+		}
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) changeCacheLocation(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Message and attachment caches can be stored in other folder, e.g. on a bigger volume.")
+	f.Println("Cached content stays encrypted by a key kept in the config folder.")
+	f.Println("Use `" + store.SharedCacheBackend + "` type for network storage; the folder is locked and files are written atomically.")
+	f.Println("Use `default` for folder to store caches next to other cache files.")
+
+	cacheDir := f.preferences.Get(preferences.CacheDirKey)
+	if val := f.readStringInAttempts("Absolute path of cache folder (current \""+cacheDir+"\")", c.ReadLine, func(val string) bool {
+		return val == "" || val == "default" || filepath.IsAbs(val)
+	}); val == "default" {
+		cacheDir = ""
+	} else if val != "" {
+		cacheDir = val
+	}
+
+	backend := f.preferences.Get(preferences.CacheBackendKey)
+	if val := f.readStringInAttempts("Cache type, "+store.LocalCacheBackend+" or "+store.SharedCacheBackend+" (current \""+backend+"\")", c.ReadLine, func(val string) bool {
+		return val == "" || val == store.LocalCacheBackend || val == store.SharedCacheBackend
+	}); val != "" {
+		backend = val
+	}
+
+	if cacheDir == f.preferences.Get(preferences.CacheDirKey) && backend == f.preferences.Get(preferences.CacheBackendKey) {
+		f.Println("Cache location was not changed.")
+		return
+	}
+
+	f.Println("Content cached in the previous folder is not moved and will be downloaded again.")
+	if f.yesNoQuestion("Are you sure you want to change cache location and restart the Bridge") {
+		f.preferences.Set(preferences.CacheDirKey, cacheDir)
+		f.preferences.Set(preferences.CacheBackendKey, backend)
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) changeStorageBackend(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Local databases of accounts are stored in Bolt by default.")
+	f.Println("SQLite lets clients read messages while the account is being synced and its database can be inspected by SQLite tools.")
+
+	backend := f.preferences.Get(preferences.StorageBackendKey)
+	if val := f.readStringInAttempts("Storage, "+storage.BoltBackend+" or "+storage.SQLiteBackend+" (current \""+backend+"\")", c.ReadLine, func(val string) bool {
+		return val == "" || val == storage.BoltBackend || val == storage.SQLiteBackend
+	}); val != "" {
+		backend = val
+	}
+
+	if backend == f.preferences.Get(preferences.StorageBackendKey) {
+		f.Println("Storage was not changed.")
+		return
+	}
+
+	f.Println("Databases are converted when the Bridge starts; it can take a while for big accounts.")
+	if f.yesNoQuestion("Are you sure you want to change storage and restart the Bridge") {
+		f.preferences.Set(preferences.StorageBackendKey, backend)
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) changeDecryptionPlaceholder(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Messages which cannot be decrypted are shown with the original headers, an explanation and the encrypted body as an attachment.")
+	f.Println("With inline, the explanation and the encrypted body are shown in the HTML body of the message.")
+
+	mode := f.preferences.Get(preferences.DecryptionPlaceholderKey)
+	if val := f.readStringInAttempts("Placeholder, "+string(message.PlaceholderAttachment)+" or "+string(message.PlaceholderInline)+" (current \""+mode+"\")", c.ReadLine, func(val string) bool {
+		return val == "" || val == string(message.PlaceholderAttachment) || val == string(message.PlaceholderInline)
+	}); val != "" {
+		mode = val
+	}
+
+	f.preferences.Set(preferences.DecryptionPlaceholderKey, mode)
+	imap.SetDecryptionPlaceholder(message.ParsePlaceholderMode(mode))
+	f.Println("Placeholder of undecryptable messages was changed.")
+}
+
+func (f *frontendCLI) changeBodyEncoding(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Text bodies of messages are encoded as quoted-printable by default.")
+	f.Println("With 8bit, they are sent as raw UTF-8; bodies with lines too long for 8bit are still encoded as quoted-printable.")
+
+	encoding := f.preferences.Get(preferences.BodyEncodingKey)
+	if val := f.readStringInAttempts("Encoding, "+string(message.QuotedPrintable)+" or "+string(message.EightBit)+" (current \""+encoding+"\")", c.ReadLine, func(val string) bool {
+		return val == "" || val == string(message.QuotedPrintable) || val == string(message.EightBit)
+	}); val != "" {
+		encoding = val
+	}
+
+	if encoding == f.preferences.Get(preferences.BodyEncodingKey) {
+		f.Println("Encoding was not changed.")
+		return
+	}
+
+	f.Println("Messages already downloaded by clients keep their encoding.")
+	if f.yesNoQuestion("Are you sure you want to change encoding and restart the Bridge") {
+		f.preferences.Set(preferences.BodyEncodingKey, encoding)
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) changeUpdateChannel(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	f.Println("Beta channel gets new versions sooner; they may be less stable.")
+
+	channel := f.updates.GetChannel()
+	if val := f.readStringInAttempts("Channel, "+updates.StableChannel+" or "+updates.BetaChannel+" (current \""+channel+"\")", c.ReadLine, func(val string) bool {
+		return val == "" || val == updates.StableChannel || val == updates.BetaChannel
+	}); val != "" {
+		channel = val
+	}
+
+	if channel == f.updates.GetChannel() {
+		f.Println("Channel was not changed.")
+		return
+	}
+
+	f.preferences.Set(preferences.UpdateChannelKey, channel)
+	f.updates.SetChannel(channel)
+	f.Println("Updates are checked in the", channel, "channel.")
+	if channel == updates.StableChannel {
+		f.Println("The current version is kept until a newer stable version is released.")
+	}
+}
+
+func (f *frontendCLI) toggleDeferredExpunge(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	isDeferred := f.preferences.GetBool(preferences.DeferredExpungeKey)
+	msg := "Are you sure you want to keep messages flagged as deleted until the client expunges them"
+	if isDeferred {
+		msg = "Are you sure you want to delete messages as soon as they are flagged as deleted"
+	}
+
+	if f.yesNoQuestion(msg) {
+		f.preferences.SetBool(preferences.DeferredExpungeKey, !isDeferred)
+		imap.SetDeferredExpunge(!isDeferred)
+		f.Println("Expunge behaviour was changed.")
+	}
+}
+
+func (f *frontendCLI) toggleDBCompaction(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	isEnabled := f.preferences.GetBool(preferences.DBCompactionKey)
+	msg := "Are you sure you want to compact local databases in background while accounts are idle"
+	if isEnabled {
+		msg = "Are you sure you want to stop compacting local databases in background"
+	}
+
+	if f.yesNoQuestion(msg) {
+		f.preferences.SetBool(preferences.DBCompactionKey, !isEnabled)
+		store.SetCompactionOptions(preferences.GetCompactionOptions(f.preferences))
+		f.Println("Compaction of local databases was changed.")
+	}
+}
+
+func (f *frontendCLI) toggleIMAPTrace(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	isTracing := f.preferences.GetBool(preferences.IMAPTraceKey)
+	msg := "Are you sure you want to log timing of every IMAP command"
+	if isTracing {
+		msg = "Are you sure you want to stop logging timing of IMAP commands"
+	}
+
+	if !f.yesNoQuestion(msg) {
+		return
+	}
+
+	f.preferences.SetBool(preferences.IMAPTraceKey, !isTracing)
+	imap.SetCommandTracing(!isTracing)
+	if isTracing {
+		f.Println("IMAP commands are not traced anymore.")
+		return
+	}
+	f.Println("IMAP commands are traced. Reproduce the slow operation and send the log with a bug report.")
+}
+
+func (f *frontendCLI) toggleKeychainFile(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	isFile := f.preferences.GetBool(preferences.KeychainFileKey)
+
+	// Only CLI asks for the passphrase on start, Bridge started with GUI
+	// could not open the file without the passphrase in the environment.
+	if !isFile && os.Getenv(keychain.FilePassphraseEnv) == "" {
+		f.Println("Encrypted file cannot be used: set its passphrase in " + keychain.FilePassphraseEnv + " for Bridge first, the GUI cannot ask for it on start.")
+		return
+	}
+
+	msg := "Are you sure you want to store credentials in an encrypted file and restart the Bridge (passphrase is read from " + keychain.FilePassphraseEnv + " or asked for on start in CLI, accounts need to be added again)"
+	if isFile {
+		msg = "Are you sure you want to store credentials in the system keychain and restart the Bridge (accounts need to be added again)"
+	}
+
+	if f.yesNoQuestion(msg) {
+		f.preferences.SetBool(preferences.KeychainFileKey, !isFile)
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) isPortFree(port string) bool {
+	port = strings.Replace(port, ":", "", -1)
+	if port == "" || port == currentPort {
+		return true
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 0 || number > 65535 {
+		f.Println("Input", port, "is not a valid port number.")
+		return false
+	}
+	if !ports.IsPortFree(number) {
+		f.Println("Port", number, "is occupied by another process.")
+		return false
+	}
+	return true
+}
+
+func (f *frontendCLI) changeUpstreamProxy(c *ishell.Context) {
+	proxyURL := ""
+	if len(c.Args) > 0 {
+		proxyURL = strings.TrimSpace(c.Args[0])
+	}
+
+	if err := pmapi.SetUpstreamProxy(proxyURL); err != nil {
+		f.printAndLogError("Cannot change proxy:", err)
+		return
+	}
+	f.preferences.Set(preferences.UpstreamProxyKey, proxyURL)
+
+	if proxyURL == "" {
+		f.Println("Bridge connects to Proton using proxy from environment (HTTPS_PROXY, NO_PROXY), if any.")
+		return
+	}
+	f.Println("Bridge connects to Proton through the proxy, new connections will use it.")
+}
+
+func (f *frontendCLI) changeDoHProviders(c *ishell.Context) {
+	value := strings.Join(c.Args, "")
+
+	providers, err := pmapi.ParseDoHProviders(value)
+	if err != nil {
+		f.printAndLogError("Cannot change DoH providers:", err)
+		return
+	}
+	f.preferences.Set(preferences.DoHProvidersKey, strings.Join(providers, ","))
+	f.bridge.SetDoHProviders(providers)
+
+	if len(providers) == 0 {
+		f.Println("Alternative routing looks for proxies using default DNS-over-HTTPS resolvers.")
+		return
+	}
+	f.Println("Alternative routing looks for proxies using", strings.Join(providers, ", "))
+	if !f.preferences.GetBool(preferences.AllowProxyKey) {
+		f.Println("Alternative routing is disabled; use `change proxy` to allow it.")
+	}
+}
+
+func (f *frontendCLI) changeAPIHost(c *ishell.Context) {
+	value := ""
+	if len(c.Args) > 0 {
+		value = c.Args[0]
+	}
+
+	host, err := pmapi.ParseAPIHost(value)
+	if err != nil {
+		f.printAndLogError("Cannot change API host:", err)
+		return
+	}
+	f.preferences.Set(preferences.APIHostKey, host)
+	f.bridge.SetAPIHost(host)
+
+	if host == "" {
+		f.Println("Bridge connects to the default Proton API host.")
+		return
+	}
+	f.Println("Bridge connects only to", host, "and never switches to alternative routing.")
 }
@@ -25,7 +25,8 @@ import (
 )
 
 const (
-	maxInputRepeat = 2
+	maxInputRepeat   = 2
+	maxLoginAttempts = 3
 )
 
 var (
@@ -103,6 +104,12 @@ func (f *frontendCLI) notifyCredentialsError() {
 	f.Println("and restart the application.")
 }
 
+func (f *frontendCLI) notifyWaitingForKeychain() {
+	// Print in 80-column width.
+	f.Println("Waiting for keychain to be unlocked. Accounts are loaded as soon as their")
+	f.Println("credentials can be read.")
+}
+
 func (f *frontendCLI) notifyCertIssue() {
 	// Print in 80-column width.
 	f.Println(`Connection security error: Your network connection to Proton services may
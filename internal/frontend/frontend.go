@@ -19,13 +19,18 @@
 package frontend
 
 import (
+	"os"
+
 	"github.com/0xAX/notificator"
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/frontend/cli"
 	cliie "github.com/ProtonMail/proton-bridge/internal/frontend/cli-ie"
 	"github.com/ProtonMail/proton-bridge/internal/frontend/qt"
 	qtie "github.com/ProtonMail/proton-bridge/internal/frontend/qt-ie"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/tray"
 	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/wizard"
+	"github.com/ProtonMail/proton-bridge/internal/grpc"
 	"github.com/ProtonMail/proton-bridge/internal/importexport"
 	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
@@ -51,7 +56,7 @@ func HandlePanic(appName string) {
 	_ = notify.Push("Fatal Error", "The "+appName+" has encountered a fatal error. ", "/frontend/icon/icon.png", notificator.UR_CRITICAL)
 }
 
-// New returns initialized frontend based on `frontendType`, which can be `cli` or `qt`.
+// New returns initialized frontend based on `frontendType`, which can be `cli`, `tray` or `qt`.
 func New(
 	version,
 	buildVersion,
@@ -69,6 +74,22 @@ func New(
 	return new(version, buildVersion, frontendType, showWindowOnStart, panicHandler, config, preferences, eventListener, updates, bridgeWrap, noEncConfirmator)
 }
 
+// RunScript runs the account command given by args without the interactive
+// shell. Secrets are read from the environment or the standard input.
+func RunScript(args []string, preferences *config.Preferences, bridge *bridge.Bridge) error {
+	return cli.RunScript(args, os.Stdin, os.Stdout, preferences, types.NewBridgeWrap(bridge))
+}
+
+// NewWizard returns the flow of adding an account for the control API.
+func NewWizard(preferences *config.Preferences, bridge *bridge.Bridge) *wizard.Wizard {
+	return wizard.New(types.NewBridgeWrap(bridge), preferences)
+}
+
+// NewGRPCService returns the gRPC control API served on the unix socket at path.
+func NewGRPCService(preferences *config.Preferences, eventListener listener.Listener, bridge *bridge.Bridge, path string) *grpc.Service {
+	return grpc.NewService(preferences, eventListener, types.NewBridgeWrap(bridge), NewWizard(preferences, bridge), path)
+}
+
 func new(
 	version,
 	buildVersion,
@@ -85,6 +106,8 @@ func new(
 	switch frontendType {
 	case "cli":
 		return cli.New(panicHandler, config, preferences, eventListener, updates, bridge)
+	case "tray":
+		return tray.New(version, panicHandler, eventListener, bridge)
 	default:
 		return qt.New(version, buildVersion, showWindowOnStart, panicHandler, config, preferences, eventListener, updates, bridge, noEncConfirmator)
 	}
@@ -0,0 +1,66 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package frontend
+
+import (
+	"io"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/cli"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+)
+
+// instanceHandler handles requests of bridge instances started later.
+type instanceHandler struct {
+	preferences   *config.Preferences
+	eventListener listener.Listener
+	bridge        types.Bridger
+	takeover      func()
+}
+
+// NewInstanceHandler returns handler of requests of other instances. The
+// takeover function stops the application.
+func NewInstanceHandler(preferences *config.Preferences, eventListener listener.Listener, bridge *bridge.Bridge, takeover func()) bridge.InstanceHandler {
+	return &instanceHandler{
+		preferences:   preferences,
+		eventListener: eventListener,
+		bridge:        types.NewBridgeWrap(bridge),
+		takeover:      takeover,
+	}
+}
+
+func (h *instanceHandler) Focus() {
+	h.eventListener.Emit(events.SecondInstanceEvent, "")
+}
+
+func (h *instanceHandler) RunCommand(args []string, env map[string]string, in io.Reader, out io.Writer) error {
+	return cli.RunScriptWithEnv(args, env, in, out, h.preferences, h.bridge)
+}
+
+func (h *instanceHandler) Takeover() {
+	h.takeover()
+}
+
+// ScriptEnv returns secrets for account commands from the environment, so
+// they can be forwarded to the running instance.
+func ScriptEnv() map[string]string {
+	return cli.ScriptEnv()
+}
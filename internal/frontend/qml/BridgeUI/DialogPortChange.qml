@@ -26,7 +26,7 @@ Dialog {
     id: root
 
     title : "Set IMAP & SMTP settings"
-    subtitle : "Changes require reconfiguration of Mail client. (Bridge will automatically restart)"
+    subtitle : "Changes require reconfiguration of Mail client. (Open connections are kept until clients close them)"
     isDialogBusy: currentIndex==1
 
     Column {
@@ -130,9 +130,7 @@ Dialog {
                 bold      : true
             }
             text : "IMAP: " + imapPort.text + "\nSMTP: " + smtpPort.text + "\nSMTP Connection Mode: " + getSelectedSSLMode() + "\n\n" +
-            qsTr("Settings will be applied after the next start. You will need to reconfigure your email client(s).", "after user changes their ports they will see this notification to reconfigure their setup") +
-            "\n\n" +
-            qsTr("Bridge will now restart.", "after user changes their ports this appears to notify the user of restart")
+            qsTr("Settings are applied now. You will need to reconfigure your email client(s).", "after user changes their ports they will see this notification to reconfigure their setup")
             wrapMode: Text.Wrap
             horizontalAlignment: Text.AlignHCenter
         }
@@ -226,8 +224,7 @@ Dialog {
         target: timer
         onTriggered: {
             go.setPortsAndSecurity(imapPort.text, smtpPort.text, securitySMTPSTARTTLS.checked)
-            go.isRestarting = true
-            Qt.quit()
+            root.hide()
         }
     }
 }
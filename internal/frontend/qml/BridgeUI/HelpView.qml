@@ -66,6 +66,16 @@ Item {
                 onClicked: go.openManual()
             }
 
+            ButtonIconText {
+                id: statistics
+                anchors.left: parent.left
+                text: qsTr("Statistics", "title of button that opens graph of daily metrics")
+                leftIcon.text  : Style.fa.bar_chart
+                rightIcon.text : Style.fa.chevron_circle_right
+                rightIcon.font.pointSize : Style.settings.toggleSize * Style.pt
+                onClicked: statsWin.showStats()
+            }
+
             ButtonIconText {
                 id: updates
                 anchors.left: parent.left
@@ -83,7 +93,7 @@ Item {
             // Bottom version notes
             Rectangle {
                 anchors.horizontalCenter : parent.horizontalCenter
-                height: viewAccount.separatorNoAccount - 3.2*manual.height
+                height: viewAccount.separatorNoAccount - 4.2*manual.height
                 width: wrapper.width
                 color : "transparent"
                 AccessibleText {
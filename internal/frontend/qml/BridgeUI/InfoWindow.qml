@@ -46,6 +46,7 @@ Window {
         property string password : "undef"
         property int portIMAP : 0
         property int portSMTP : 0
+        property string syncReport : ""
     }
     property string address : "undef"
     property int indexAccount : 0
@@ -107,6 +108,10 @@ Window {
         }
         Rectangle { width: Style.main.dummy; height: Style.main.fontSize; color: "#00000000"}
         Rectangle { width: Style.main.dummy; height: Style.info.topMargin; color: "#00000000"}
+
+        TextLabel { text:  qsTr("LAST SYNC", "title of the portion of the configuration screen that contains the report of the last sync"); state: "heading"; visible: root.accData.syncReport != "" }
+        Rectangle { width: Style.main.dummy; height: Style.info.topMargin; color: "#00000000"; visible: root.accData.syncReport != "" }
+        TextValue { text: root.accData.syncReport; visible: root.accData.syncReport != "" }
     }
 
     // apple mail button
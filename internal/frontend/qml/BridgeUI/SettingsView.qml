@@ -58,6 +58,21 @@ Item {
                 }
             }
 
+            ButtonIconText {
+                id: storageUsage
+                text: qsTr("Local storage", "button to show disk usage of local cache of accounts in settings")
+                leftIcon.text  : Style.fa.database
+                rightIcon {
+                    text : qsTr("Show", "clickable link next to local storage button in settings")
+                    color: Style.main.text
+                    font {
+                        pointSize : Style.settings.fontSize * Style.pt
+                        underline : true
+                    }
+                }
+                onClicked: storageWin.showUsage()
+            }
+
             ButtonIconText {
                 id: cacheKeychain
                 text: qsTr("Clear Keychain", "button to clear keychain in settings")
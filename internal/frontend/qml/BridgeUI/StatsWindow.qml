@@ -0,0 +1,162 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+
+// Window with graph of daily metrics
+
+import QtQuick 2.8
+import QtQuick.Window 2.2
+import BridgeUI 1.0
+import ProtonUI 1.0
+
+
+Window {
+    id:root
+    width  : Style.stats.width
+    height : Style.stats.height
+    minimumWidth  : Style.stats.width
+    minimumHeight : Style.stats.height
+    maximumWidth  : Style.stats.width
+    maximumHeight : Style.stats.height
+    color: "transparent"
+    flags  : Qt.Window | Qt.Dialog | Qt.FramelessWindowHint
+    title  : qsTr("Statistics", "title of the window with graph of daily metrics")
+
+    Accessible.role: Accessible.Window
+    Accessible.name: title
+    Accessible.description: Accessible.name
+
+    property int days : 30
+    property var statsDays : []
+    property string selected : ""
+
+    WindowTitleBar {
+        id: titleBar
+        window: root
+    }
+
+    Rectangle { // background
+        color: Style.main.background
+        anchors {
+            left   : parent.left
+            right  : parent.right
+            top    : titleBar.bottom
+            bottom : parent.bottom
+        }
+        border {
+            width: Style.main.border
+            color: Style.tabbar.background
+        }
+    }
+
+    Column {
+        anchors {
+            left: parent.left
+            top: titleBar.bottom
+            leftMargin: Style.main.leftMargin
+            topMargin: Style.info.topMargin
+        }
+        width : root.width - Style.main.leftMargin - Style.main.rightMargin
+        spacing: Style.info.topMargin
+
+        TextLabel { text: qsTr("SYNCED AND SENT MESSAGES IN LAST %1 DAYS", "title of the graph of daily metrics").arg(root.days); state: "heading" }
+
+        Row {
+            spacing: Style.main.leftMargin
+            AccessibleText { text: "■ " + qsTr("synced", "legend of the graph of daily metrics"); color: Style.main.textBlue; font.pointSize: Style.main.fontSize * Style.pt }
+            AccessibleText { text: "■ " + qsTr("sent", "legend of the graph of daily metrics"); color: Style.main.text; font.pointSize: Style.main.fontSize * Style.pt }
+            AccessibleText { text: "| " + qsTr("version or settings changed", "legend of the graph of daily metrics"); color: Style.main.textRed; font.pointSize: Style.main.fontSize * Style.pt }
+        }
+
+        Canvas {
+            id: graph
+            width: parent.width
+            height: Style.stats.graphHeight
+
+            onPaint: {
+                var ctx = getContext("2d")
+                ctx.reset()
+
+                var n = root.statsDays.length
+                if (n == 0) return
+
+                var max = 1
+                for (var i = 0; i < n; i++) {
+                    max = Math.max(max, root.statsDays[i].synced, root.statsDays[i].sent)
+                }
+
+                var barWidth = width / n
+                for (var i = 0; i < n; i++) {
+                    var day = root.statsDays[i]
+                    var x = i * barWidth
+
+                    ctx.fillStyle = Style.main.textBlue
+                    var synced = height * day.synced / max
+                    ctx.fillRect(x, height - synced, barWidth / 2, synced)
+
+                    ctx.fillStyle = Style.main.text
+                    var sent = height * day.sent / max
+                    ctx.fillRect(x + barWidth / 2, height - sent, barWidth / 2, sent)
+
+                    if (day.changes != "") {
+                        ctx.fillStyle = Style.main.textRed
+                        ctx.fillRect(x, 0, 1, height)
+                    }
+                }
+            }
+
+            MouseArea {
+                anchors.fill: parent
+                hoverEnabled: true
+                onPositionChanged: {
+                    var n = root.statsDays.length
+                    if (n == 0) return
+                    var day = root.statsDays[Math.min(n - 1, Math.floor(mouse.x * n / width))]
+                    root.selected = qsTr("%1: %2 synced, %3 sent, %4 API errors, cache %5 MB", "description of a day in the graph of daily metrics")
+                    .arg(day.date).arg(day.synced).arg(day.sent).arg(day.apiErrors).arg(Math.round(day.cacheSize / 1048576))
+                    if (day.changes != "") root.selected += " (" + day.changes + ")"
+                }
+                onExited: root.selected = ""
+            }
+        }
+
+        AccessibleText {
+            width: parent.width
+            wrapMode: Text.Wrap
+            color: Style.main.text
+            font.pointSize: Style.main.fontSize * Style.pt
+            text: root.selected != "" ? root.selected : (
+                root.statsDays.length == 0 ?
+                qsTr("No metrics were recorded in this period.", "shown instead of the graph of daily metrics when there are none") :
+                qsTr("Point at a day to see details.", "hint below the graph of daily metrics")
+            )
+        }
+    }
+
+    function showStats() {
+        root.statsDays = JSON.parse(go.getStats(root.days))
+        root.selected = ""
+        graph.requestPaint()
+        root.show()
+        root.raise()
+        root.requestActivate()
+    }
+
+    function hide() {
+        root.visible = false
+    }
+}
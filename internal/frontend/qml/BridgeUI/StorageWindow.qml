@@ -0,0 +1,152 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+
+// Window with disk usage of local database and caches of accounts
+
+import QtQuick 2.8
+import QtQuick.Window 2.2
+import BridgeUI 1.0
+import ProtonUI 1.0
+
+
+Window {
+    id:root
+    width  : Style.storage.width
+    height : Style.storage.height
+    minimumWidth  : Style.storage.width
+    minimumHeight : Style.storage.height
+    maximumWidth  : Style.storage.width
+    maximumHeight : Style.storage.height
+    color: "transparent"
+    flags  : Qt.Window | Qt.Dialog | Qt.FramelessWindowHint
+    title  : qsTr("Local storage", "title of the window with disk usage of accounts")
+
+    Accessible.role: Accessible.Window
+    Accessible.name: title
+    Accessible.description: Accessible.name
+
+    property var accounts : []
+    property string result : ""
+
+    WindowTitleBar {
+        id: titleBar
+        window: root
+    }
+
+    Rectangle { // background
+        color: Style.main.background
+        anchors {
+            left   : parent.left
+            right  : parent.right
+            top    : titleBar.bottom
+            bottom : parent.bottom
+        }
+        border {
+            width: Style.main.border
+            color: Style.tabbar.background
+        }
+    }
+
+    Column {
+        anchors {
+            left: parent.left
+            top: titleBar.bottom
+            leftMargin: Style.main.leftMargin
+            topMargin: Style.info.topMargin
+        }
+        width : root.width - Style.main.leftMargin - Style.main.rightMargin
+        spacing: Style.info.topMargin
+
+        TextLabel { text: qsTr("LOCAL STORAGE OF ACCOUNTS", "title of the list of disk usage of accounts"); state: "heading" }
+
+        Repeater {
+            model: root.accounts
+
+            Column {
+                width: parent.width
+
+                AccessibleText {
+                    text: modelData.account
+                    color: Style.main.text
+                    font {
+                        pointSize: Style.main.fontSize * Style.pt
+                        bold: true
+                    }
+                }
+
+                AccessibleText {
+                    width: parent.width
+                    wrapMode: Text.Wrap
+                    color: modelData.error ? Style.main.textRed : Style.main.text
+                    font.pointSize: Style.main.fontSize * Style.pt
+                    text: modelData.error ? modelData.error : qsTr(
+                        "Database %1 MB with %2 messages, message cache %3 MB with %4 messages, attachment cache %5 MB",
+                        "disk usage of one account"
+                    )
+                    .arg(root.megabytes(modelData.databaseSize))
+                    .arg(modelData.messages)
+                    .arg(root.megabytes(modelData.messageCacheSize))
+                    .arg(modelData.cachedMessages)
+                    .arg(root.megabytes(modelData.attachmentCacheSize))
+                }
+
+                ClickIconText {
+                    visible: !modelData.error
+                    text      : qsTr("Compact cache", "action to remove cached messages no longer in the account")
+                    iconText  : Style.fa.compress
+                    textColor : Style.main.textBlue
+                    onClicked: {
+                        var freed = go.compactAccountCache(modelData.userID)
+                        root.result = freed < 0 ?
+                        qsTr("Cache of %1 could not be compacted.", "shown when compaction of cache failed").arg(modelData.account) :
+                        qsTr("%1 MB were removed from cache of %2.", "shown after compaction of cache").arg(root.megabytes(freed * 1024)).arg(modelData.account)
+                        root.accounts = JSON.parse(go.getAccountUsage())
+                    }
+                }
+            }
+        }
+
+        AccessibleText {
+            width: parent.width
+            wrapMode: Text.Wrap
+            color: Style.main.text
+            font.pointSize: Style.main.fontSize * Style.pt
+            text: root.result != "" ? root.result : (
+                root.accounts.length == 0 ?
+                qsTr("There are no accounts.", "shown instead of the disk usage when there are no accounts") :
+                qsTr("Compacting removes cached messages which were deleted or moved out of the account.", "hint below the disk usage of accounts")
+            )
+        }
+    }
+
+    function megabytes(size) {
+        return (size / 1048576).toFixed(1)
+    }
+
+    function showUsage() {
+        root.accounts = JSON.parse(go.getAccountUsage())
+        root.result = ""
+        root.show()
+        root.raise()
+        root.requestActivate()
+    }
+
+    function hide() {
+        root.visible = false
+    }
+}
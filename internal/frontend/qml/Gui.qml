@@ -33,6 +33,8 @@ Item {
     property int warningFlags: 0
 
     InfoWindow      { id: infoWin      }
+    StatsWindow     { id: statsWin     }
+    StorageWindow   { id: storageWin   }
     OutgoingNoEncPopup { id: outgoingNoEncPopup }
     BugReportWindow {
         id: bugreportWin
@@ -34,7 +34,7 @@ Column {
         text: qsTr("Select format of exported email:")
 
         InfoToolTip {
-            info: qsTr("MBOX exports one file for each folder", "todo") + "\n" + qsTr("EML exports one file for each email", "todo")
+            info: qsTr("MBOX exports one file for each folder", "todo") + "\n" + qsTr("EML exports one file for each email", "todo") + "\n" + qsTr("HTML exports browsable archive with threads for each folder", "todo")
             anchors {
                 left: parent.right
                 leftMargin: Style.dialog.spacing
@@ -50,7 +50,7 @@ Column {
         }
 
         Repeater {
-            model: [ "MBOX", "EML" ]
+            model: [ "MBOX", "EML", "HTML" ]
             delegate : RadioButton {
                 id: radioDelegate
                 checked: modelData=="MBOX"
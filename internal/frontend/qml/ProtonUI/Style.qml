@@ -197,7 +197,7 @@ QtObject {
 
     property QtObject info : QtObject {
         property real width          : 315 * px
-        property real height         : 450 * px
+        property real height         : 520 * px
         property real heightHeader   : 32  * px
         property real topMargin      : 18  * px
         property real iconSize       : 16  * px
@@ -205,6 +205,17 @@ QtObject {
         property real widthValue     : 180 * px
     }
 
+    property QtObject stats : QtObject {
+        property real width       : 520 * px
+        property real height      : 360 * px
+        property real graphHeight : 200 * px
+    }
+
+    property QtObject storage : QtObject {
+        property real width       : 520 * px
+        property real height      : 360 * px
+    }
+
     property QtObject exporting : QtObject {
         property color background         : dialog.background
         property color rowBackground      : "#f8f8f8"
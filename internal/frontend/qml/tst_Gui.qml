@@ -335,6 +335,20 @@ Window {
             return "Mutt is the best"
         }
 
+        function getStats(days) {
+            return '[{"date":"2020-10-01","synced":120,"sent":3,"apiErrors":0,"cacheSize":52428800,"changes":""},' +
+                '{"date":"2020-10-02","synced":40,"sent":5,"apiErrors":2,"cacheSize":62914560,"changes":"version changed from 1.4.5 to 1.5.0"}]'
+        }
+
+        function getAccountUsage() {
+            return '[{"userID":"1","account":"bridge@pm.me","databaseSize":8388608,"messages":1200,"messageCacheSize":52428800,"cachedMessages":340,"attachmentCacheSize":10485760}]'
+        }
+
+        function compactAccountCache(userID) {
+            console.log("Test: Compact cache of account ", userID)
+            return 2048
+        }
+
         function sendBug(desc,client,address){
             console.log("bug report ", "desc '"+desc+"'", "client '"+client+"'", "address '"+address+"'")
             return !desc.includes("fail")
@@ -27,6 +27,7 @@ import (
 const (
 	TypeEML  = "EML"
 	TypeMBOX = "MBOX"
+	TypeHTML = "HTML"
 )
 
 func (f *FrontendQt) LoadStructureForExport(addressOrID string) {
@@ -69,6 +70,8 @@ func (f *FrontendQt) StartExport(rootPath, login, fileType string, attachEncrypt
 	} else if fileType == TypeMBOX {
 
 		target = transfer.NewMBOXProvider(rootPath)
+	} else if fileType == TypeHTML {
+		target = transfer.NewHTMLProvider(rootPath)
 	} else {
 		log.Errorln("Wrong file format:", fileType)
 		return
@@ -41,6 +41,7 @@ type AccountInfo struct {
 	_ string `property:"aliases"`
 	_ bool   `property:"isExpanded"`
 	_ bool   `property:"isCombinedAddressMode"`
+	_ string `property:"syncReport"`
 }
 
 // Constants for data map.
@@ -22,9 +22,12 @@ package qt
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/wizard"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
 	"github.com/ProtonMail/proton-bridge/pkg/keychain"
 	pmapi "github.com/ProtonMail/proton-bridge/pkg/pmapi"
@@ -70,6 +73,7 @@ func (s *FrontendQt) loadAccounts() {
 		acc_info.SetAliases(strings.Join(user.GetAddresses(), ";"))
 		acc_info.SetIsExpanded(user.ID() == s.userIDAdded)
 		acc_info.SetIsCombinedAddressMode(user.IsCombinedAddressMode())
+		acc_info.SetSyncReport(getSyncReportSummary(user))
 
 		s.Accounts.addAccount(acc_info)
 	}
@@ -78,6 +82,30 @@ func (s *FrontendQt) loadAccounts() {
 	s.userIDAdded = ""
 }
 
+// getSyncReportSummary returns one line about the last sync of the user.
+// Message IDs of failed messages are listed by the CLI command sync-report.
+func getSyncReportSummary(user types.User) string {
+	report, err := user.GetSyncReport()
+	if err != nil {
+		log.WithError(err).Warn("Cannot read sync report")
+		return ""
+	}
+	if report == nil {
+		return ""
+	}
+
+	summary := fmt.Sprintf(
+		"%s: %d synced, %d skipped, %d failed in %s",
+		time.Unix(report.Finished, 0).Format("2006-01-02 15:04"),
+		report.Synced, report.Skipped, len(report.FailedIDs),
+		report.Elapsed.Round(time.Second),
+	)
+	if report.Error != "" {
+		summary += " (sync failed: " + report.Error + ")"
+	}
+	return summary
+}
+
 func (s *FrontendQt) clearCache() {
 	defer s.Qml.ProcessFinished()
 	if err := s.bridge.ClearData(); err != nil {
@@ -141,15 +169,15 @@ func (s *FrontendQt) showLoginError(err error, scope string) bool {
 //  1: when has 2FA
 //  2: when has no 2FA but have MBOX
 func (s *FrontendQt) login(login, password string) int {
-	var err error
-	s.authClient, s.auth, err = s.bridge.Login(login, password)
+	s.loginWizard.Start()
+	err := s.loginWizard.SubmitCredentials(login, password)
 	if s.showLoginError(err, "login") {
 		return -1
 	}
-	if s.auth.HasTwoFactor() {
+	switch s.loginWizard.GetState().Step {
+	case wizard.StepTwoFactor:
 		return 1
-	}
-	if s.auth.HasMailboxPassword() {
+	case wizard.StepMailboxPassword:
 		return 2
 	}
 	return 0 // No 2FA, no mailbox password.
@@ -160,40 +188,41 @@ func (s *FrontendQt) login(login, password string) int {
 //   0 : single password mode
 //   1 : two password mode
 func (s *FrontendQt) auth2FA(twoFacAuth string) int {
-	var err error
-	if s.auth == nil || s.authClient == nil {
-		err = fmt.Errorf("missing authentication in auth2FA %p %p", s.auth, s.authClient)
-	} else {
-		_, err = s.authClient.Auth2FA(twoFacAuth, s.auth)
-	}
-
+	err := s.loginWizard.SubmitTwoFactor(twoFacAuth)
 	if s.showLoginError(err, "auth2FA") {
 		return -1
 	}
 
-	if s.auth.HasMailboxPassword() {
+	if s.loginWizard.GetState().Step == wizard.StepMailboxPassword {
 		return 1 // Ask for mailbox password.
 	}
 	return 0 // One password.
 }
 
 // addAccount adds an account. It should close login modal ProcessFinished if ok.
+// In single password mode the account was already added by the wizard.
 func (s *FrontendQt) addAccount(mailboxPassword string) int {
-	if s.auth == nil || s.authClient == nil {
-		log.Errorf("Missing authentication in addAccount %p %p", s.auth, s.authClient)
+	if s.loginWizard.GetState().Step == wizard.StepMailboxPassword {
+		if err := s.loginWizard.SubmitMailboxPassword(mailboxPassword); err != nil {
+			s.Qml.SetAddAccountWarning("Failure: "+err.Error(), -2)
+			return -1
+		}
+	}
+
+	state := s.loginWizard.GetState()
+	if state.Step != wizard.StepClientConfig {
+		log.Errorf("Missing authentication in addAccount, wizard is in step %s", state.Step)
 		s.Qml.SetAddAccountWarning(s.Qml.WrongMailboxPassword(), -2)
 		return -1
 	}
 
-	user, err := s.bridge.FinishLogin(s.authClient, s.auth, mailboxPassword)
-	if err != nil {
-		log.WithError(err).Error("Login was unsuccessful")
-		s.Qml.SetAddAccountWarning("Failure: "+err.Error(), -2)
-		return -1
+	// Email client is configured from the account list.
+	if err := s.loginWizard.Finish(); err != nil {
+		log.WithError(err).Warn("Cannot finish login wizard")
 	}
 
-	s.userIDAdded = user.ID()
-	s.eventListener.Emit(events.UserRefreshEvent, user.ID())
+	s.userIDAdded = state.AccountID
+	s.eventListener.Emit(events.UserRefreshEvent, state.AccountID)
 	s.Qml.ProcessFinished()
 	return 0
 }
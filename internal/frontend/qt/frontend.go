@@ -42,13 +42,13 @@ import (
 	"github.com/ProtonMail/proton-bridge/internal/frontend/autoconfig"
 	"github.com/ProtonMail/proton-bridge/internal/frontend/qt-common"
 	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/wizard"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
 	"github.com/ProtonMail/proton-bridge/internal/updates"
 	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/ProtonMail/proton-bridge/pkg/ports"
 	"github.com/ProtonMail/proton-bridge/pkg/useragent"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
-	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/sirupsen/logrus"
 	"github.com/kardianos/osext"
 	"github.com/skratchdot/open-golang/open"
@@ -85,9 +85,8 @@ type FrontendQt struct {
 	programName string                     // Program name (shown in taskbar).
 	programVer  string                     // Program version (shown in help).
 
-	authClient pmapi.Client
-
-	auth *pmapi.Auth
+	// loginWizard adds accounts by the same flow as other frontends.
+	loginWizard *wizard.Wizard
 
 	AutostartEntry *autostart.App
 
@@ -122,6 +121,7 @@ func New(
 		updates:           updates,
 		bridge:            bridge,
 		noEncConfirmator:  noEncConfirmator,
+		loginWizard:       wizard.New(bridge, preferences),
 
 		programName: prgName,
 		programVer:  "v" + version,
@@ -186,6 +186,7 @@ func (s *FrontendQt) watchEvents() {
 	logoutCh := s.getEventChannel(events.LogoutEvent)
 	updateApplicationCh := s.getEventChannel(events.UpgradeApplicationEvent)
 	newUserCh := s.getEventChannel(events.UserRefreshEvent)
+	syncFinishedCh := s.getEventChannel(events.SyncFinishedEvent)
 	certIssue := s.getEventChannel(events.TLSCertIssue)
 	imapCertIssue := s.getEventChannel(events.IMAPTLSBadCert)
 	for {
@@ -225,6 +226,9 @@ func (s *FrontendQt) watchEvents() {
 			s.Qml.NotifyUpdate()
 		case <-newUserCh:
 			s.Qml.LoadAccounts()
+		case <-syncFinishedCh:
+			// Reload to show the new sync report.
+			s.Qml.LoadAccounts()
 		case <-certIssue:
 			s.Qml.ShowCertIssue()
 		case <-imapCertIssue:
@@ -548,6 +552,8 @@ func (s *FrontendQt) setPortsAndSecurity(imapPort, smtpPort string, useSTARTTLSf
 	s.preferences.Set(preferences.IMAPPortKey, imapPort)
 	s.preferences.Set(preferences.SMTPPortKey, smtpPort)
 	s.preferences.SetBool(preferences.SMTPSSLKey, !useSTARTTLSforSMTP)
+	s.eventListener.Emit(events.ListenerSettingsChangedEvent, "")
+	s.loadAccounts()
 }
 
 func (s *FrontendQt) isSMTPSTARTTLS() bool {
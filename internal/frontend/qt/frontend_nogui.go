@@ -31,11 +31,17 @@ import (
 
 var log = logrus.WithField("pkg", "frontend-nogui") //nolint[gochecknoglobals]
 
-type FrontendHeadless struct{}
+type FrontendHeadless struct {
+	bridge types.Bridger
+}
 
 func (s *FrontendHeadless) Loop(credentialsError error) error {
 	log.Info("Check status on localhost:8081")
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if s.bridge.IsWaitingForKeychain() {
+			fmt.Fprintf(w, "Bridge is running, waiting for keychain")
+			return
+		}
 		fmt.Fprintf(w, "Bridge is running")
 	})
 	return http.ListenAndServe(":8081", nil)
@@ -56,5 +62,5 @@ func New(
 	bridge types.Bridger,
 	noEncConfirmator types.NoEncConfirmator,
 ) *FrontendHeadless {
-	return &FrontendHeadless{}
+	return &FrontendHeadless{bridge: bridge}
 }
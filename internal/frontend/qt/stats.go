@@ -0,0 +1,115 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// +build !nogui
+
+package qt
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/stats"
+)
+
+type statsDay struct {
+	Date      string `json:"date"`
+	Synced    int64  `json:"synced"`
+	Sent      int64  `json:"sent"`
+	APIErrors int64  `json:"apiErrors"`
+	CacheSize int64  `json:"cacheSize"`
+	Changes   string `json:"changes"`
+}
+
+// getStats returns daily metrics of the last days as JSON array for the
+// graph in QML.
+func (s *FrontendQt) getStats(days int) string {
+	statsDays := []statsDay{}
+	for _, entry := range stats.List(time.Now().AddDate(0, 0, -days)) {
+		statsDays = append(statsDays, statsDay{
+			Date:      entry.Date,
+			Synced:    entry.Counters[stats.SyncedMessages],
+			Sent:      entry.Counters[stats.SentMessages],
+			APIErrors: entry.Counters[stats.APIErrors],
+			CacheSize: entry.Gauges[stats.CacheSize],
+			Changes:   strings.Join(entry.Changes, ", "),
+		})
+	}
+
+	data, err := json.Marshal(statsDays)
+	if err != nil {
+		log.WithError(err).Error("Cannot encode metrics")
+		return "[]"
+	}
+	return string(data)
+}
+
+type accountUsage struct {
+	UserID              string `json:"userID"`
+	Account             string `json:"account"`
+	DatabaseSize        int64  `json:"databaseSize"`
+	Messages            int    `json:"messages"`
+	MessageCacheSize    int64  `json:"messageCacheSize"`
+	CachedMessages      int    `json:"cachedMessages"`
+	AttachmentCacheSize int64  `json:"attachmentCacheSize"`
+	Error               string `json:"error,omitempty"`
+}
+
+// getAccountUsage returns disk usage of local database and caches of all
+// accounts as JSON array for the settings.
+func (s *FrontendQt) getAccountUsage() string {
+	usage := []accountUsage{}
+	for _, user := range s.bridge.GetUsers() {
+		account := accountUsage{UserID: user.ID(), Account: user.Username()}
+		if storeStats, err := user.GetStoreStatistics(); err != nil {
+			account.Error = err.Error()
+		} else {
+			account.DatabaseSize = storeStats.DatabaseSize
+			account.Messages = storeStats.Messages
+			account.MessageCacheSize = storeStats.MessageCacheSize
+			account.CachedMessages = storeStats.CachedMessages
+			account.AttachmentCacheSize = storeStats.AttachmentCacheSize
+		}
+		usage = append(usage, account)
+	}
+
+	data, err := json.Marshal(usage)
+	if err != nil {
+		log.WithError(err).Error("Cannot encode account usage")
+		return "[]"
+	}
+	return string(data)
+}
+
+// compactAccountCache removes cached messages of the account which are no
+// longer in the local database and returns the freed size in kilobytes, or
+// -1 on error.
+func (s *FrontendQt) compactAccountCache(userID string) int {
+	user, err := s.bridge.GetUser(userID)
+	if err != nil {
+		log.WithError(err).Error("Cannot compact cache of unknown account")
+		return -1
+	}
+
+	freed, err := user.CompactCache()
+	if err != nil {
+		log.WithError(err).Error("Cannot compact cache")
+		return -1
+	}
+	return int(freed >> 10)
+}
@@ -100,6 +100,9 @@ type GoQMLInterface struct {
 	_ func(portStr string) int                                 `slot:"isPortOpen"`
 	_ func(imapPort, smtpPort string, useSTARTTLSforSMTP bool) `slot:"setPortsAndSecurity"`
 	_ func() bool                                              `slot:"isSMTPSTARTTLS"`
+	_ func(days int) string                                    `slot:"getStats"`
+	_ func() string                                            `slot:"getAccountUsage"`
+	_ func(userID string) int                                  `slot:"compactAccountCache"`
 
 	_ func(description, client, address string) bool `slot:"sendBug"`
 
@@ -158,6 +161,9 @@ func (s *GoQMLInterface) SetFrontend(f *FrontendQt) {
 	s.ConnectGetIMAPPort(f.getIMAPPort)
 	s.ConnectGetSMTPPort(f.getSMTPPort)
 	s.ConnectGetLastMailClient(f.getLastMailClient)
+	s.ConnectGetStats(f.getStats)
+	s.ConnectGetAccountUsage(f.getAccountUsage)
+	s.ConnectCompactAccountCache(f.compactAccountCache)
 	s.ConnectIsPortOpen(f.isPortOpen)
 	s.ConnectIsSMTPSTARTTLS(f.isSMTPSTARTTLS)
 
@@ -0,0 +1,212 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package tray provides a lightweight frontend with only the system tray
+// icon. It shows the status and unread messages in Inbox of each account
+// and toasts about errors; accounts and settings are managed by CLI.
+package tray
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("pkg", "frontend-tray") //nolint[gochecknoglobals]
+
+const (
+	programName = "ProtonMail Bridge"
+
+	// refreshInterval is how often unread counts are updated when no event
+	// about new messages arrives, e.g. messages were read in other client.
+	refreshInterval = time.Minute
+)
+
+// Icon states, the same as suffixes of the systray images.
+const (
+	iconNormal  = ""
+	iconWarning = "-warn"
+	iconError   = "-error"
+)
+
+// accountStatus is one line of the tray menu.
+type accountStatus struct {
+	username  string
+	connected bool
+	unread    int
+}
+
+func (a accountStatus) String() string {
+	switch {
+	case !a.connected:
+		return a.username + " (disconnected)"
+	case a.unread == 0:
+		return a.username
+	default:
+		return fmt.Sprintf("%s (%d unread)", a.username, a.unread)
+	}
+}
+
+// status is the content of the tray.
+type status struct {
+	accounts []accountStatus
+	icon     string
+}
+
+// toast is a notification shown next to the tray icon.
+type toast struct {
+	title   string
+	message string
+	isError bool
+}
+
+type frontendTray struct {
+	version       string
+	panicHandler  types.PanicHandler
+	eventListener listener.Listener
+	bridge        types.Bridger
+
+	statusCh chan status
+	toastCh  chan toast
+}
+
+// New returns the tray frontend.
+func New(
+	version string,
+	panicHandler types.PanicHandler,
+	eventListener listener.Listener,
+	bridge types.Bridger,
+) *frontendTray { //nolint[golint]
+	return &frontendTray{
+		version:       version,
+		panicHandler:  panicHandler,
+		eventListener: eventListener,
+		bridge:        bridge,
+
+		statusCh: make(chan status, 10),
+		toastCh:  make(chan toast, 10),
+	}
+}
+
+// IsAppRestarting returns false; the tray does not change anything
+// which needs restart.
+func (f *frontendTray) IsAppRestarting() bool {
+	return false
+}
+
+func (f *frontendTray) getStatus(internetOff bool) status {
+	s := status{icon: iconNormal}
+	if internetOff {
+		s.icon = iconWarning
+	}
+
+	for _, user := range f.bridge.GetUsers() {
+		account := accountStatus{
+			username:  user.Username(),
+			connected: user.IsConnected(),
+		}
+		if !account.connected {
+			s.icon = iconError
+		} else if stats, err := user.GetStoreStatistics(); err != nil {
+			log.WithError(err).Debug("Cannot get unread count")
+		} else {
+			account.unread = stats.InboxUnread
+		}
+		s.accounts = append(s.accounts, account)
+	}
+
+	return s
+}
+
+func (f *frontendTray) getUsername(userID string) string {
+	user, err := f.bridge.GetUser(userID)
+	if err != nil {
+		return userID
+	}
+	return user.Username()
+}
+
+// watchEvents sends the current status after every change and toasts
+// about errors to the tray.
+func (f *frontendTray) watchEvents() {
+	errorCh := f.getEventChannel(events.ErrorEvent)
+	internetOffCh := f.getEventChannel(events.InternetOffEvent)
+	internetOnCh := f.getEventChannel(events.InternetOnEvent)
+	addressChangedLogoutCh := f.getEventChannel(events.AddressChangedLogoutEvent)
+	logoutCh := f.getEventChannel(events.LogoutEvent)
+	certIssueCh := f.getEventChannel(events.TLSCertIssue)
+	sendFailedCh := f.getEventChannel(events.SendFailedEvent)
+	sendPolicyWarningCh := f.getEventChannel(events.SendPolicyWarningEvent)
+	newMessageCh := f.getEventChannel(events.NewMessageEvent)
+	syncFinishedCh := f.getEventChannel(events.SyncFinishedEvent)
+	userRefreshCh := f.getEventChannel(events.UserRefreshEvent)
+
+	refreshTicker := time.NewTicker(refreshInterval)
+	defer refreshTicker.Stop()
+
+	internetOff := false
+	for {
+		f.statusCh <- f.getStatus(internetOff)
+
+		select {
+		case <-refreshTicker.C:
+		case <-newMessageCh:
+		case <-syncFinishedCh:
+		case <-userRefreshCh:
+		case errorDetails := <-errorCh:
+			f.toastCh <- toast{title: "Bridge failed", message: errorDetails, isError: true}
+		case <-internetOffCh:
+			internetOff = true
+			f.toastCh <- toast{title: "No internet connection", message: "Messages are not updated until the connection is back."}
+		case <-internetOnCh:
+			internetOff = false
+		case address := <-addressChangedLogoutCh:
+			f.toastCh <- toast{title: "Account logged out", message: "Address of " + address + " changed. Log in again using CLI.", isError: true}
+		case userID := <-logoutCh:
+			f.toastCh <- toast{title: "Account logged out", message: f.getUsername(userID) + " was logged out. Log in again using CLI.", isError: true}
+		case <-certIssueCh:
+			f.toastCh <- toast{title: "Connection is not secure", message: "Bridge cannot verify the server certificate, the network may be monitored.", isError: true}
+		case data := <-sendFailedCh:
+			f.toastCh <- getSendFailedToast(data, f.getUsername)
+		case data := <-sendPolicyWarningCh:
+			if parts := strings.SplitN(data, ":", 2); len(parts) == 2 {
+				f.toastCh <- toast{title: "Sent outside of your domain", message: parts[1]}
+			}
+		}
+	}
+}
+
+// getSendFailedToast parses the data of the event, i.e. "userID:error".
+func getSendFailedToast(data string, getUsername func(string) string) toast {
+	parts := strings.SplitN(data, ":", 2)
+	message := "Message of " + getUsername(parts[0]) + " was not sent"
+	if len(parts) == 2 {
+		message += ": " + strings.TrimSpace(parts[1])
+	}
+	return toast{title: "Sending failed", message: message, isError: true}
+}
+
+func (f *frontendTray) getEventChannel(event string) <-chan string {
+	ch := make(chan string)
+	f.eventListener.Add(event, ch)
+	return ch
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// +build nogui
+
+package tray
+
+// Loop logs the tray status and toasts as there is no tray without GUI.
+func (f *frontendTray) Loop(credentialsError error) error {
+	if credentialsError != nil && !f.bridge.IsWaitingForKeychain() {
+		return credentialsError
+	}
+
+	go func() {
+		defer f.panicHandler.HandlePanic()
+		f.watchEvents()
+	}()
+
+	for {
+		select {
+		case s := <-f.statusCh:
+			for _, account := range s.accounts {
+				log.WithField("icon", s.icon).Info("Account ", account)
+			}
+		case t := <-f.toastCh:
+			log.WithField("title", t.title).Warn(t.message)
+		}
+	}
+}
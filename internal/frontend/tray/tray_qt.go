@@ -0,0 +1,124 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// +build !nogui
+
+package tray
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	qtcommon "github.com/ProtonMail/proton-bridge/internal/frontend/qt-common"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+const (
+	// Qt widgets can be changed only from the main thread which checks for
+	// updates in this interval.
+	updateIntervalMs = 200
+
+	toastTimeoutMs = 10000
+)
+
+// Loop shows the tray icon and keeps it updated until the user quits.
+func (f *frontendTray) Loop(credentialsError error) error {
+	if credentialsError != nil && !f.bridge.IsWaitingForKeychain() {
+		return credentialsError
+	}
+
+	qtcommon.QtSetupCoreAndControls(programName, "v"+f.version)
+	app := widgets.NewQApplication(len(os.Args), os.Args)
+	app.SetQuitOnLastWindowClosed(false)
+
+	systray := widgets.NewQSystemTrayIcon(nil)
+	systray.SetContextMenu(widgets.NewQMenu(nil))
+	f.updateSystray(app, systray, status{icon: iconNormal})
+	systray.Show()
+
+	if credentialsError != nil {
+		f.toastCh <- toast{title: "Credentials store is not available", message: credentialsError.Error(), isError: true}
+	}
+
+	go func() {
+		defer f.panicHandler.HandlePanic()
+		f.watchEvents()
+	}()
+
+	timer := core.NewQTimer(nil)
+	timer.ConnectTimeout(func() {
+		for {
+			select {
+			case s := <-f.statusCh:
+				f.updateSystray(app, systray, s)
+			case t := <-f.toastCh:
+				showToast(systray, t)
+			default:
+				return
+			}
+		}
+	})
+	timer.Start(updateIntervalMs)
+
+	_ = gui.QGuiApplication_Exec()
+	return nil
+}
+
+func (f *frontendTray) updateSystray(app *widgets.QApplication, systray *widgets.QSystemTrayIcon, s status) {
+	setIcon(systray, s.icon)
+
+	unread := 0
+	menu := systray.ContextMenu()
+	menu.Clear()
+	for _, account := range s.accounts {
+		unread += account.unread
+		menu.AddAction(account.String()).SetEnabled(false)
+	}
+	if len(s.accounts) == 0 {
+		menu.AddAction("No account, add one using CLI").SetEnabled(false)
+	}
+	menu.AddSeparator()
+	menu.AddAction("Quit").ConnectTriggered(func(bool) { app.Quit() })
+
+	if unread == 0 {
+		systray.SetToolTip(programName)
+	} else {
+		systray.SetToolTip(fmt.Sprintf("%s: %d unread", programName, unread))
+	}
+}
+
+func setIcon(systray *widgets.QSystemTrayIcon, state string) {
+	path := ":/ProtonUI/images/systray" + state
+	if runtime.GOOS == "darwin" {
+		path += "-mono"
+	}
+	path += ".png"
+	icon := gui.NewQIcon5(path)
+	icon.SetIsMask(true)
+	systray.SetIcon(icon)
+}
+
+func showToast(systray *widgets.QSystemTrayIcon, t toast) {
+	icon := widgets.QSystemTrayIcon__Information
+	if t.isError {
+		icon = widgets.QSystemTrayIcon__Critical
+	}
+	systray.ShowMessage(t.title, t.message, icon, toastTimeoutMs)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package tray
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBridge struct {
+	types.Bridger
+	users []types.User
+}
+
+func (b *fakeBridge) GetUsers() []types.User {
+	return b.users
+}
+
+func (b *fakeBridge) GetUser(query string) (types.User, error) {
+	for _, user := range b.users {
+		if user.ID() == query {
+			return user, nil
+		}
+	}
+	return nil, errors.New("no such user")
+}
+
+type fakeUser struct {
+	types.User
+	id        string
+	connected bool
+	unread    int
+}
+
+func (u *fakeUser) ID() string        { return u.id }
+func (u *fakeUser) Username() string  { return u.id + "@pm.me" }
+func (u *fakeUser) IsConnected() bool { return u.connected }
+
+func (u *fakeUser) GetStoreStatistics() (store.Statistics, error) {
+	return store.Statistics{InboxUnread: u.unread}, nil
+}
+
+func TestGetStatus(t *testing.T) {
+	f := New("1.0.0", nil, nil, &fakeBridge{users: []types.User{
+		&fakeUser{id: "user", connected: true, unread: 3},
+		&fakeUser{id: "other", connected: true},
+	}})
+
+	s := f.getStatus(false)
+	require.Equal(t, iconNormal, s.icon)
+	require.Equal(t, "user@pm.me (3 unread)", s.accounts[0].String())
+	require.Equal(t, "other@pm.me", s.accounts[1].String())
+
+	require.Equal(t, iconWarning, f.getStatus(true).icon)
+}
+
+func TestGetStatusDisconnected(t *testing.T) {
+	f := New("1.0.0", nil, nil, &fakeBridge{users: []types.User{
+		&fakeUser{id: "user", connected: false, unread: 3},
+	}})
+
+	s := f.getStatus(true)
+	require.Equal(t, iconError, s.icon)
+	require.Equal(t, "user@pm.me (disconnected)", s.accounts[0].String())
+}
+
+func TestGetSendFailedToast(t *testing.T) {
+	f := New("1.0.0", nil, nil, &fakeBridge{users: []types.User{
+		&fakeUser{id: "user", connected: true},
+	}})
+
+	require.Equal(t, "Message of user@pm.me was not sent: 422 recipient does not exist", getSendFailedToast("user:422 recipient does not exist", f.getUsername).message)
+	require.Equal(t, "Message of unknown was not sent", getSendFailedToast("unknown", f.getUsername).message)
+}
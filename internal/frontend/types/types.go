@@ -19,10 +19,17 @@
 package types
 
 import (
+	"time"
+
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/importer"
+	"github.com/ProtonMail/proton-bridge/internal/migration"
 	"github.com/ProtonMail/proton-bridge/internal/importexport"
+	"github.com/ProtonMail/proton-bridge/internal/store"
 	"github.com/ProtonMail/proton-bridge/internal/transfer"
 	"github.com/ProtonMail/proton-bridge/internal/updates"
+	"github.com/ProtonMail/proton-bridge/internal/users"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
@@ -37,6 +44,8 @@ type Updater interface {
 	GetDownloadLink() string
 	GetLocalVersion() updates.VersionInfo
 	StartUpgrade(currentStatus chan<- updates.Progress)
+	GetChannel() string
+	SetChannel(channel string)
 }
 
 type NoEncConfirmator interface {
@@ -63,7 +72,48 @@ type User interface {
 	GetPrimaryAddress() string
 	GetAddresses() []string
 	GetBridgePassword() string
+	GenerateAccessToken() (string, time.Time)
+	GenerateRefreshToken() (string, error)
 	SwitchAddressMode() error
+	GetSearchLanguage() string
+	SetSearchLanguage(language string) error
+	GetSyncExclusions() []string
+	SetSyncExclusions(names []string) error
+	GetSyncMaxAge() store.SyncMaxAge
+	SetSyncMaxAge(window store.SyncMaxAge) error
+	GetNotificationRules() store.NotificationRules
+	SetNotificationRules(rules store.NotificationRules) error
+	GetMailboxMapping() string
+	SetMailboxMapping(mode string) error
+	GetOutgoingMIMEType() string
+	SetOutgoingMIMEType(mode string) error
+	GetAppendSignature() bool
+	SetAppendSignature(enabled bool) error
+	GetRemoteContentFilter() message.RemoteContentFilter
+	SetRemoteContentFilter(filter message.RemoteContentFilter) error
+	GetFooter() (text, html string)
+	SetFooter(text, html string) error
+	GetDefaultExpiration() time.Duration
+	SetDefaultExpiration(expiration time.Duration) error
+	GetAddressSettings() []users.AddressSettings
+	SetAddressSettings(settings users.AddressSettings) error
+	ExportMessages(options store.ExportOptions, progress store.ExportProgress) (exported, failed int, err error)
+	VerifyLocalArchive() (int, error)
+	UndeleteMessages(since time.Time) (restored, missing int, err error)
+	GetScheduledMessages() ([]*store.ScheduledMessage, error)
+	GetStoreStatistics() (store.Statistics, error)
+	CompactCache() (int64, error)
+	CompactDatabase(progress func(float64)) (before, after int64, err error)
+	GetCompactionStatus() (store.CompactionStatus, error)
+	IsSyncing() bool
+	GetSyncReport() (*store.SyncReport, error)
+	ApplyRetention(dryRun bool) ([]*store.RetentionEntry, error)
+	GetRetentionLog() ([]*store.RetentionEntry, error)
+	ApplyBulkAction(query store.BulkQuery, action store.BulkAction, dryRun bool) ([]*pmapi.Message, error)
+	FindDuplicates(mailbox string) ([]*store.DuplicateGroup, error)
+	RemoveDuplicates(groups []*store.DuplicateGroup) error
+	VerifyStore() ([]*store.IntegrityProblem, error)
+	RepairStore(problems []*store.IntegrityProblem) (int, error)
 	Logout() error
 }
 
@@ -76,6 +126,19 @@ type Bridger interface {
 	ReportBug(osType, osVersion, description, accountName, address, emailClient string) error
 	AllowProxy()
 	DisallowProxy()
+	SetDoHProviders(providers []string)
+	SetAPIHost(host string)
+	GetAccountPorts() map[string]bridge.AccountPorts
+	FinishRelogin(userID string, client pmapi.Client, auth *pmapi.Auth, mailboxPassword string) (User, error)
+	IsWaitingForKeychain() bool
+	GetStartupProgress() []users.StartupProgress
+	GetRetryMetrics() pmapi.RetryMetrics
+	GetAPIStatus() pmapi.APIStatus
+	ImportMessages(address, path string, folderMapping map[string]string, progress importer.ProgressFunc) (imported, failed uint, err error)
+	MigrationStores() []migration.Store
+	MigrateMessages(address string, store migration.Store, folderMapping map[string]string, progress importer.ProgressFunc) (imported, failed uint, err error)
+	UploadSettings(query string) error
+	DownloadSettings(query string) error
 }
 
 type bridgeWrap struct {
@@ -93,6 +156,10 @@ func (b *bridgeWrap) FinishLogin(client pmapi.Client, auth *pmapi.Auth, mailboxP
 	return b.Bridge.FinishLogin(client, auth, mailboxPassword)
 }
 
+func (b *bridgeWrap) FinishRelogin(userID string, client pmapi.Client, auth *pmapi.Auth, mailboxPassword string) (User, error) {
+	return b.Bridge.FinishRelogin(userID, client, auth, mailboxPassword)
+}
+
 func (b *bridgeWrap) GetUsers() (users []User) {
 	for _, user := range b.Bridge.GetUsers() {
 		users = append(users, user)
@@ -112,6 +179,7 @@ type ImportExporter interface {
 	GetRemoteImporter(string, string, string, string, string) (*transfer.Transfer, error)
 	GetEMLExporter(string, string) (*transfer.Transfer, error)
 	GetMBOXExporter(string, string) (*transfer.Transfer, error)
+	GetHTMLExporter(string, string) (*transfer.Transfer, error)
 	ReportBug(osType, osVersion, description, accountName, address, emailClient string) error
 	ReportFile(osType, osVersion, accountName, address string, logdata []byte) error
 }
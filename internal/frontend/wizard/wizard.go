@@ -0,0 +1,428 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package wizard provides the onboarding flow of adding an account and
+// configuring the email client independent of any frontend. CLI, GUI and
+// the control API drive the same steps, so validation and error handling
+// are the same everywhere.
+package wizard
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/autoconfig"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("pkg", "frontend/wizard") //nolint[gochecknoglobals]
+
+// Step is the part of the flow which waits for the input.
+type Step string
+
+// Steps of the flow in the order in which they are visited. Two factor
+// and mailbox password steps are skipped when the account does not need them.
+const (
+	StepCredentials     Step = "credentials"
+	StepTwoFactor       Step = "two_factor"
+	StepMailboxPassword Step = "mailbox_password"
+	StepClientConfig    Step = "client_config"
+	StepDone            Step = "done"
+)
+
+// Errors returned by the wizard besides errors of login from the API.
+var (
+	ErrWrongStep     = errors.New("action is not allowed in the current step")
+	ErrEmptyValue    = errors.New("value must not be empty")
+	ErrUnknownClient = errors.New("email client cannot be configured automatically")
+	ErrNoSuchAddress = errors.New("account has no such address")
+
+	ErrSecurityKeyOnly      = errors.New("second factor by security key (U2F/FIDO2) is not supported, enable authenticator app (TOTP) in account settings")
+	ErrWrongMailboxPassword = errors.New("incorrect mailbox password")
+)
+
+// Bridger is the part of the bridge needed to add an account.
+type Bridger interface {
+	Login(username, password string) (pmapi.Client, *pmapi.Auth, error)
+	FinishLogin(client pmapi.Client, auth *pmapi.Auth, mailboxPassword string) (types.User, error)
+	FinishRelogin(userID string, client pmapi.Client, auth *pmapi.Auth, mailboxPassword string) (types.User, error)
+	GetAccountPorts() map[string]bridge.AccountPorts
+}
+
+// ClientConfig is the configuration of email client for one address.
+type ClientConfig struct {
+	Address             string `json:"address"`
+	Host                string `json:"host"`
+	IMAPPort            int    `json:"imap_port"`
+	IMAPSecurity        string `json:"imap_security"`
+	SMTPPort            int    `json:"smtp_port"`
+	SMTPSecurity        string `json:"smtp_security"`
+	SMTPImplicitTLSPort int    `json:"smtp_implicit_tls_port,omitempty"`
+	Username            string `json:"username"`
+	Password            string `json:"password,omitempty"`
+}
+
+// State is what frontends show to the user. Error is the reason why the
+// last action failed; the step stays the same so it can be retried, except
+// for failed adding of the account and rejected two factor code which start
+// again from credentials. SecurityKey is set in two factor step when the
+// account also has a security key which cannot be used instead of the code.
+type State struct {
+	Step        Step           `json:"step"`
+	Username    string         `json:"username,omitempty"`
+	SecurityKey bool           `json:"security_key,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	AccountID   string         `json:"account_id,omitempty"`
+	Account     string         `json:"account,omitempty"`
+	Clients     []string       `json:"clients,omitempty"`
+	Configs     []ClientConfig `json:"configs,omitempty"`
+}
+
+// WithoutSecrets returns the state without bridge passwords so it can be
+// shown to anyone who did not provide the credentials.
+func (s State) WithoutSecrets() State {
+	configs := make([]ClientConfig, len(s.Configs))
+	for i, config := range s.Configs {
+		config.Password = ""
+		configs[i] = config
+	}
+	if len(configs) == 0 {
+		configs = nil
+	}
+	s.Configs = configs
+	return s
+}
+
+// Wizard holds the state of one flow. It is safe to use from multiple
+// goroutines; every action is validated against the current step.
+type Wizard struct {
+	bridge Bridger
+	pref   *config.Preferences
+	lock   sync.Mutex
+
+	// reloginID is the existing account which is logged in again.
+	reloginID string
+
+	step     Step
+	username string
+	password string
+	client   pmapi.Client
+	auth     *pmapi.Auth
+	user     types.User
+	lastErr  error
+}
+
+// New returns wizard waiting for credentials.
+func New(bridge Bridger, pref *config.Preferences) *Wizard {
+	return &Wizard{
+		bridge: bridge,
+		pref:   pref,
+		step:   StepCredentials,
+	}
+}
+
+// NewRelogin returns wizard logging in again the existing account, e.g.
+// after its session expired. The account keeps its cache and settings.
+func NewRelogin(bridge Bridger, pref *config.Preferences, userID string) *Wizard {
+	w := New(bridge, pref)
+	w.reloginID = userID
+	return w
+}
+
+// GetState returns the current state of the flow.
+func (w *Wizard) GetState() State {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	state := State{
+		Step:     w.step,
+		Username: w.username,
+	}
+	if w.step == StepTwoFactor {
+		state.SecurityKey = w.auth.TwoFA.HasU2F()
+	}
+	if w.lastErr != nil {
+		state.Error = w.lastErr.Error()
+	}
+	if w.user != nil {
+		state.AccountID = w.user.ID()
+		state.Account = w.user.Username()
+		state.Configs = w.getClientConfigs()
+		for _, autoConf := range autoconfig.Available() {
+			state.Clients = append(state.Clients, autoConf.Name())
+		}
+	}
+	return state
+}
+
+// Start cancels the flow in progress and starts again from credentials.
+func (w *Wizard) Start() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.reset()
+}
+
+// SubmitCredentials logs in with username and password.
+func (w *Wizard) SubmitCredentials(username, password string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.checkStep(StepCredentials); err != nil {
+		return err
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" || password == "" {
+		return w.setError(ErrEmptyValue)
+	}
+
+	client, auth, err := w.bridge.Login(username, password)
+	if err != nil {
+		return w.setError(err)
+	}
+
+	w.username = username
+	w.password = password
+	w.client = client
+	w.auth = auth
+
+	if auth.HasTwoFactor() {
+		// Only the code can be verified through the API.
+		if !auth.TwoFA.HasTOTP() {
+			w.reset()
+			return w.setError(ErrSecurityKeyOnly)
+		}
+		w.step = StepTwoFactor
+		return w.setError(nil)
+	}
+	return w.afterTwoFactor()
+}
+
+// SubmitTwoFactor verifies the two factor code. The code can be submitted
+// again unless the API closed the session after too many wrong codes.
+func (w *Wizard) SubmitTwoFactor(code string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.checkStep(StepTwoFactor); err != nil {
+		return err
+	}
+
+	if code = strings.TrimSpace(code); code == "" {
+		return w.setError(ErrEmptyValue)
+	}
+
+	if _, err := w.client.Auth2FA(context.Background(), code, w.auth); err != nil {
+		if err == pmapi.ErrBad2FACode {
+			w.reset()
+		}
+		return w.setError(err)
+	}
+
+	return w.afterTwoFactor()
+}
+
+// SubmitMailboxPassword unlocks the account by mailbox password in two
+// password mode. Wrong mailbox password can be submitted again.
+func (w *Wizard) SubmitMailboxPassword(mailboxPassword string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.checkStep(StepMailboxPassword); err != nil {
+		return err
+	}
+
+	if mailboxPassword == "" {
+		return w.setError(ErrEmptyValue)
+	}
+
+	if err := w.checkMailboxPassword(mailboxPassword); err != nil {
+		return w.setError(err)
+	}
+
+	return w.finishLogin(mailboxPassword)
+}
+
+// ConfigureClient configures the email client named as in State.Clients
+// for the address with the given index.
+func (w *Wizard) ConfigureClient(name string, addressIndex int) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.checkStep(StepClientConfig); err != nil {
+		return err
+	}
+
+	if addressIndex < 0 || addressIndex >= len(w.user.GetAddresses()) {
+		return w.setError(ErrNoSuchAddress)
+	}
+
+	for _, autoConf := range autoconfig.Available() {
+		if autoConf.Name() != name {
+			continue
+		}
+		imapPort, smtpPort := w.getPorts()
+		smtpSSL := w.pref.GetBool(preferences.SMTPSSLKey)
+		if err := autoConf.Configure(imapPort, smtpPort, false, smtpSSL, w.user, addressIndex); err != nil {
+			log.WithError(err).WithField("client", name).Warn("Autoconfig failed")
+			return w.setError(err)
+		}
+		return w.setError(nil)
+	}
+
+	return w.setError(ErrUnknownClient)
+}
+
+// Finish ends the flow after the client was configured or skipped.
+func (w *Wizard) Finish() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.checkStep(StepClientConfig); err != nil {
+		return err
+	}
+
+	w.step = StepDone
+	return w.setError(nil)
+}
+
+func (w *Wizard) afterTwoFactor() error {
+	if w.auth.HasMailboxPassword() {
+		w.step = StepMailboxPassword
+		return w.setError(nil)
+	}
+	return w.finishLogin(w.password)
+}
+
+// checkMailboxPassword unlocks keys before the login is finished, because
+// failed finish closes the session and the flow would start again.
+func (w *Wizard) checkMailboxPassword(mailboxPassword string) error {
+	salt, err := w.client.AuthSalt(context.Background())
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := pmapi.HashMailboxPassword(mailboxPassword, salt)
+	if err != nil {
+		return err
+	}
+
+	if err := w.client.Unlock(context.Background(), []byte(hashedPassword)); err != nil {
+		log.WithField("username", w.username).WithError(err).Warn("Wrong mailbox password")
+		return ErrWrongMailboxPassword
+	}
+	return nil
+}
+
+func (w *Wizard) finishLogin(mailboxPassword string) error {
+	var user types.User
+	var err error
+	if w.reloginID != "" {
+		user, err = w.bridge.FinishRelogin(w.reloginID, w.client, w.auth, mailboxPassword)
+	} else {
+		user, err = w.bridge.FinishLogin(w.client, w.auth, mailboxPassword)
+	}
+
+	// Finished login always closes the session; on failure the flow has
+	// to start again with new credentials.
+	w.client = nil
+	w.auth = nil
+	w.password = ""
+
+	if err != nil {
+		log.WithField("username", w.username).WithError(err).Error("Login was unsuccessful")
+		w.step = StepCredentials
+		return w.setError(err)
+	}
+
+	w.user = user
+	w.step = StepClientConfig
+	return w.setError(nil)
+}
+
+func (w *Wizard) reset() {
+	if w.client != nil {
+		if err := w.client.DeleteAuth(context.Background()); err != nil {
+			log.WithError(err).Warn("Failed to clear cancelled login session")
+		}
+		w.client.Logout()
+	}
+
+	w.step = StepCredentials
+	w.username = ""
+	w.password = ""
+	w.client = nil
+	w.auth = nil
+	w.user = nil
+	w.lastErr = nil
+}
+
+func (w *Wizard) checkStep(step Step) error {
+	if w.step != step {
+		return ErrWrongStep
+	}
+	return nil
+}
+
+// setError remembers the result of the last action for GetState.
+func (w *Wizard) setError(err error) error {
+	w.lastErr = err
+	return err
+}
+
+func (w *Wizard) getPorts() (imapPort, smtpPort int) {
+	if accountPorts, ok := w.bridge.GetAccountPorts()[w.user.ID()]; ok {
+		return accountPorts.IMAP, accountPorts.SMTP
+	}
+	return w.pref.GetInt(preferences.IMAPPortKey), w.pref.GetInt(preferences.SMTPPortKey)
+}
+
+func (w *Wizard) getClientConfigs() (configs []ClientConfig) {
+	addresses := w.user.GetAddresses()
+	if w.user.IsCombinedAddressMode() {
+		addresses = []string{w.user.GetPrimaryAddress()}
+	}
+
+	smtpSecurity := "STARTTLS"
+	if w.pref.GetBool(preferences.SMTPSSLKey) {
+		smtpSecurity = "SSL"
+	}
+	imapPort, smtpPort := w.getPorts()
+
+	for _, address := range addresses {
+		configs = append(configs, ClientConfig{
+			Address:             address,
+			Host:                bridge.Host,
+			IMAPPort:            imapPort,
+			IMAPSecurity:        "STARTTLS",
+			SMTPPort:            smtpPort,
+			SMTPSecurity:        smtpSecurity,
+			SMTPImplicitTLSPort: w.pref.GetInt(preferences.SMTPImplicitTLSPortKey),
+			Username:            address,
+			Password:            w.user.GetBridgePassword(),
+		})
+	}
+	return configs
+}
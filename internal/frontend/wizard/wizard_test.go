@@ -0,0 +1,234 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package wizard
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	pmapimocks "github.com/ProtonMail/proton-bridge/pkg/pmapi/mocks"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+type testUser struct {
+	types.User
+}
+
+func (u *testUser) ID() string                  { return "userID" }
+func (u *testUser) Username() string            { return "user" }
+func (u *testUser) GetAddresses() []string      { return []string{"user@pm.me", "alias@pm.me"} }
+func (u *testUser) GetPrimaryAddress() string   { return "user@pm.me" }
+func (u *testUser) IsCombinedAddressMode() bool { return true }
+func (u *testUser) GetBridgePassword() string   { return "bridgepass" }
+
+type testBridge struct {
+	client          pmapi.Client
+	auth            *pmapi.Auth
+	mailboxPassword string
+	reloginID       string
+	finishErr       error
+}
+
+func (b *testBridge) Login(username, password string) (pmapi.Client, *pmapi.Auth, error) {
+	if password != "pass" {
+		return nil, nil, errors.New("incorrect login credentials")
+	}
+	return b.client, b.auth, nil
+}
+
+func (b *testBridge) FinishLogin(client pmapi.Client, auth *pmapi.Auth, mailboxPassword string) (types.User, error) {
+	b.mailboxPassword = mailboxPassword
+	if b.finishErr != nil {
+		return nil, b.finishErr
+	}
+	return &testUser{}, nil
+}
+
+func (b *testBridge) FinishRelogin(userID string, client pmapi.Client, auth *pmapi.Auth, mailboxPassword string) (types.User, error) {
+	b.reloginID = userID
+	return b.FinishLogin(client, auth, mailboxPassword)
+}
+
+func (b *testBridge) GetAccountPorts() map[string]bridge.AccountPorts {
+	return map[string]bridge.AccountPorts{}
+}
+
+func newTestWizard(t *testing.T, auth *pmapi.Auth) (*Wizard, *testBridge, *pmapimocks.MockClient, func()) {
+	dir, err := ioutil.TempDir("", "wizard")
+	require.NoError(t, err)
+
+	pref := config.NewPreferences(filepath.Join(dir, "prefs.json"))
+	pref.SetInt(preferences.IMAPPortKey, 1143)
+	pref.SetInt(preferences.SMTPPortKey, 1025)
+
+	ctrl := gomock.NewController(t)
+	client := pmapimocks.NewMockClient(ctrl)
+	testBridge := &testBridge{client: client, auth: auth}
+
+	return New(testBridge, pref), testBridge, client, func() {
+		ctrl.Finish()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestWizardSinglePassword(t *testing.T) {
+	wizard, testBridge, _, finish := newTestWizard(t, &pmapi.Auth{})
+	defer finish()
+
+	require.Equal(t, ErrEmptyValue, wizard.SubmitCredentials(" ", "pass"))
+	require.Equal(t, StepCredentials, wizard.GetState().Step)
+	require.Equal(t, ErrEmptyValue.Error(), wizard.GetState().Error)
+
+	require.Error(t, wizard.SubmitCredentials("user", "wrong"))
+	require.Equal(t, StepCredentials, wizard.GetState().Step)
+
+	require.NoError(t, wizard.SubmitCredentials(" user ", "pass"))
+	require.Equal(t, "pass", testBridge.mailboxPassword)
+
+	state := wizard.GetState()
+	require.Equal(t, StepClientConfig, state.Step)
+	require.Equal(t, "user", state.Username)
+	require.Equal(t, "userID", state.AccountID)
+	require.Equal(t, "user", state.Account)
+	require.Empty(t, state.Error)
+	require.Equal(t, []ClientConfig{{
+		Address:      "user@pm.me",
+		Host:         bridge.Host,
+		IMAPPort:     1143,
+		IMAPSecurity: "STARTTLS",
+		SMTPPort:     1025,
+		SMTPSecurity: "STARTTLS",
+		Username:     "user@pm.me",
+		Password:     "bridgepass",
+	}}, state.Configs)
+	require.Empty(t, state.WithoutSecrets().Configs[0].Password)
+	require.Equal(t, "bridgepass", state.Configs[0].Password)
+
+	require.Equal(t, ErrWrongStep, wizard.SubmitMailboxPassword("pass"))
+	require.Equal(t, ErrNoSuchAddress, wizard.ConfigureClient("Apple Mail", 2))
+	require.Equal(t, ErrUnknownClient, wizard.ConfigureClient("Unknown", 0))
+
+	require.NoError(t, wizard.Finish())
+	require.Equal(t, StepDone, wizard.GetState().Step)
+}
+
+func TestWizardTwoFactorAndMailboxPassword(t *testing.T) {
+	auth := &pmapi.Auth{PasswordMode: 2, TwoFA: &pmapi.TwoFactorInfo{Enabled: 1}}
+	wizard, testBridge, client, finish := newTestWizard(t, auth)
+	defer finish()
+
+	require.Equal(t, ErrWrongStep, wizard.SubmitTwoFactor("123456"))
+
+	require.NoError(t, wizard.SubmitCredentials("user", "pass"))
+	require.Equal(t, StepTwoFactor, wizard.GetState().Step)
+
+	client.EXPECT().Auth2FA(gomock.Any(), "000000", auth).Return(nil, errors.New("incorrect code"))
+	require.Error(t, wizard.SubmitTwoFactor("000000"))
+	require.Equal(t, StepTwoFactor, wizard.GetState().Step)
+
+	client.EXPECT().Auth2FA(gomock.Any(), "123456", auth).Return(&pmapi.Auth2FA{}, nil)
+	require.NoError(t, wizard.SubmitTwoFactor("123456"))
+	require.Equal(t, StepMailboxPassword, wizard.GetState().Step)
+
+	client.EXPECT().AuthSalt(gomock.Any()).Return("", nil).Times(2)
+	client.EXPECT().Unlock(gomock.Any(), []byte("wrong")).Return(errors.New("cannot unlock"))
+	require.Equal(t, ErrWrongMailboxPassword, wizard.SubmitMailboxPassword("wrong"))
+	require.Equal(t, StepMailboxPassword, wizard.GetState().Step)
+	require.Empty(t, testBridge.mailboxPassword)
+
+	client.EXPECT().Unlock(gomock.Any(), []byte("mbpass")).Return(nil)
+	testBridge.finishErr = errors.New("wrong mailbox password")
+	require.Error(t, wizard.SubmitMailboxPassword("mbpass"))
+	require.Equal(t, StepCredentials, wizard.GetState().Step)
+	require.Equal(t, "wrong mailbox password", wizard.GetState().Error)
+	require.Equal(t, "mbpass", testBridge.mailboxPassword)
+}
+
+func TestWizardTwoFactorSecurityKey(t *testing.T) {
+	auth := &pmapi.Auth{TwoFA: &pmapi.TwoFactorInfo{Enabled: 3}}
+	wizard, _, client, finish := newTestWizard(t, auth)
+	defer finish()
+
+	require.NoError(t, wizard.SubmitCredentials("user", "pass"))
+	require.True(t, wizard.GetState().SecurityKey)
+
+	auth.TwoFA.Enabled = 2
+	client.EXPECT().DeleteAuth(gomock.Any()).Return(nil)
+	client.EXPECT().Logout()
+	wizard.Start()
+
+	client.EXPECT().DeleteAuth(gomock.Any()).Return(nil)
+	client.EXPECT().Logout()
+	require.Equal(t, ErrSecurityKeyOnly, wizard.SubmitCredentials("user", "pass"))
+	require.Equal(t, StepCredentials, wizard.GetState().Step)
+	require.False(t, wizard.GetState().SecurityKey)
+}
+
+func TestWizardTwoFactorSessionClosed(t *testing.T) {
+	auth := &pmapi.Auth{TwoFA: &pmapi.TwoFactorInfo{Enabled: 1}}
+	wizard, _, client, finish := newTestWizard(t, auth)
+	defer finish()
+
+	require.NoError(t, wizard.SubmitCredentials("user", "pass"))
+	require.False(t, wizard.GetState().SecurityKey)
+
+	client.EXPECT().Auth2FA(gomock.Any(), "000000", auth).Return(nil, pmapi.ErrBad2FACodeTryAgain)
+	require.Equal(t, pmapi.ErrBad2FACodeTryAgain, wizard.SubmitTwoFactor("000000"))
+	require.Equal(t, StepTwoFactor, wizard.GetState().Step)
+
+	client.EXPECT().Auth2FA(gomock.Any(), "000000", auth).Return(nil, pmapi.ErrBad2FACode)
+	client.EXPECT().DeleteAuth(gomock.Any()).Return(nil)
+	client.EXPECT().Logout()
+	require.Equal(t, pmapi.ErrBad2FACode, wizard.SubmitTwoFactor("000000"))
+	require.Equal(t, StepCredentials, wizard.GetState().Step)
+	require.Equal(t, pmapi.ErrBad2FACode.Error(), wizard.GetState().Error)
+}
+
+func TestWizardStartCancelsLogin(t *testing.T) {
+	auth := &pmapi.Auth{TwoFA: &pmapi.TwoFactorInfo{Enabled: 1}}
+	wizard, _, client, finish := newTestWizard(t, auth)
+	defer finish()
+
+	require.NoError(t, wizard.SubmitCredentials("user", "pass"))
+
+	client.EXPECT().DeleteAuth(gomock.Any()).Return(nil)
+	client.EXPECT().Logout()
+	wizard.Start()
+
+	require.Equal(t, State{Step: StepCredentials}, wizard.GetState())
+}
+
+func TestWizardRelogin(t *testing.T) {
+	wizard, testBridge, _, finish := newTestWizard(t, &pmapi.Auth{})
+	defer finish()
+
+	wizard = NewRelogin(testBridge, wizard.pref, "userID")
+
+	require.NoError(t, wizard.SubmitCredentials("user", "pass"))
+	require.Equal(t, "userID", testBridge.reloginID)
+	require.Equal(t, StepClientConfig, wizard.GetState().Step)
+}
@@ -0,0 +1,648 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.5.1-go
+// source: bridge.proto
+
+package grpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// BridgeClient is the client API for Bridge service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BridgeClient interface {
+	// Accounts.
+	ListUsers(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*UserList, error)
+	GetUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*User, error)
+	LogoutUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	RemoveUser(ctx context.Context, in *RemoveUserRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	SetAddressMode(ctx context.Context, in *AddressModeRequest, opts ...grpc.CallOption) (*User, error)
+	// Adding of accounts, the same flow as in CLI and GUI.
+	GetLoginState(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*LoginState, error)
+	StartLogin(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*LoginState, error)
+	SubmitCredentials(ctx context.Context, in *CredentialsRequest, opts ...grpc.CallOption) (*LoginState, error)
+	SubmitTwoFactor(ctx context.Context, in *TwoFactorRequest, opts ...grpc.CallOption) (*LoginState, error)
+	SubmitMailboxPassword(ctx context.Context, in *MailboxPasswordRequest, opts ...grpc.CallOption) (*LoginState, error)
+	FinishLogin(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*LoginState, error)
+	// Settings.
+	GetSettings(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*SettingList, error)
+	SetSetting(ctx context.Context, in *Setting, opts ...grpc.CallOption) (*Setting, error)
+	// Sync.
+	GetSyncStatus(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*SyncStatus, error)
+	// Events. The stream is open until the client cancels it.
+	StreamEvents(ctx context.Context, in *EventStreamRequest, opts ...grpc.CallOption) (Bridge_StreamEventsClient, error)
+}
+
+type bridgeClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBridgeClient(cc grpc.ClientConnInterface) BridgeClient {
+	return &bridgeClient{cc}
+}
+
+func (c *bridgeClient) ListUsers(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*UserList, error) {
+	out := new(UserList)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/ListUsers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) GetUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/GetUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) LogoutUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/LogoutUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) RemoveUser(ctx context.Context, in *RemoveUserRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/RemoveUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) SetAddressMode(ctx context.Context, in *AddressModeRequest, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/SetAddressMode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) GetLoginState(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*LoginState, error) {
+	out := new(LoginState)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/GetLoginState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) StartLogin(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*LoginState, error) {
+	out := new(LoginState)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/StartLogin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) SubmitCredentials(ctx context.Context, in *CredentialsRequest, opts ...grpc.CallOption) (*LoginState, error) {
+	out := new(LoginState)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/SubmitCredentials", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) SubmitTwoFactor(ctx context.Context, in *TwoFactorRequest, opts ...grpc.CallOption) (*LoginState, error) {
+	out := new(LoginState)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/SubmitTwoFactor", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) SubmitMailboxPassword(ctx context.Context, in *MailboxPasswordRequest, opts ...grpc.CallOption) (*LoginState, error) {
+	out := new(LoginState)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/SubmitMailboxPassword", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) FinishLogin(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*LoginState, error) {
+	out := new(LoginState)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/FinishLogin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) GetSettings(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*SettingList, error) {
+	out := new(SettingList)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/GetSettings", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) SetSetting(ctx context.Context, in *Setting, opts ...grpc.CallOption) (*Setting, error) {
+	out := new(Setting)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/SetSetting", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) GetSyncStatus(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*SyncStatus, error) {
+	out := new(SyncStatus)
+	err := c.cc.Invoke(ctx, "/grpc.Bridge/GetSyncStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) StreamEvents(ctx context.Context, in *EventStreamRequest, opts ...grpc.CallOption) (Bridge_StreamEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Bridge_ServiceDesc.Streams[0], "/grpc.Bridge/StreamEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &bridgeStreamEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Bridge_StreamEventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type bridgeStreamEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *bridgeStreamEventsClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// BridgeServer is the server API for Bridge service.
+// All implementations must embed UnimplementedBridgeServer
+// for forward compatibility
+type BridgeServer interface {
+	// Accounts.
+	ListUsers(context.Context, *emptypb.Empty) (*UserList, error)
+	GetUser(context.Context, *UserRequest) (*User, error)
+	LogoutUser(context.Context, *UserRequest) (*emptypb.Empty, error)
+	RemoveUser(context.Context, *RemoveUserRequest) (*emptypb.Empty, error)
+	SetAddressMode(context.Context, *AddressModeRequest) (*User, error)
+	// Adding of accounts, the same flow as in CLI and GUI.
+	GetLoginState(context.Context, *emptypb.Empty) (*LoginState, error)
+	StartLogin(context.Context, *emptypb.Empty) (*LoginState, error)
+	SubmitCredentials(context.Context, *CredentialsRequest) (*LoginState, error)
+	SubmitTwoFactor(context.Context, *TwoFactorRequest) (*LoginState, error)
+	SubmitMailboxPassword(context.Context, *MailboxPasswordRequest) (*LoginState, error)
+	FinishLogin(context.Context, *emptypb.Empty) (*LoginState, error)
+	// Settings.
+	GetSettings(context.Context, *emptypb.Empty) (*SettingList, error)
+	SetSetting(context.Context, *Setting) (*Setting, error)
+	// Sync.
+	GetSyncStatus(context.Context, *UserRequest) (*SyncStatus, error)
+	// Events. The stream is open until the client cancels it.
+	StreamEvents(*EventStreamRequest, Bridge_StreamEventsServer) error
+	mustEmbedUnimplementedBridgeServer()
+}
+
+// UnimplementedBridgeServer must be embedded to have forward compatible implementations.
+type UnimplementedBridgeServer struct {
+}
+
+func (UnimplementedBridgeServer) ListUsers(context.Context, *emptypb.Empty) (*UserList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUsers not implemented")
+}
+func (UnimplementedBridgeServer) GetUser(context.Context, *UserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedBridgeServer) LogoutUser(context.Context, *UserRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LogoutUser not implemented")
+}
+func (UnimplementedBridgeServer) RemoveUser(context.Context, *RemoveUserRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveUser not implemented")
+}
+func (UnimplementedBridgeServer) SetAddressMode(context.Context, *AddressModeRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetAddressMode not implemented")
+}
+func (UnimplementedBridgeServer) GetLoginState(context.Context, *emptypb.Empty) (*LoginState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLoginState not implemented")
+}
+func (UnimplementedBridgeServer) StartLogin(context.Context, *emptypb.Empty) (*LoginState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartLogin not implemented")
+}
+func (UnimplementedBridgeServer) SubmitCredentials(context.Context, *CredentialsRequest) (*LoginState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitCredentials not implemented")
+}
+func (UnimplementedBridgeServer) SubmitTwoFactor(context.Context, *TwoFactorRequest) (*LoginState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitTwoFactor not implemented")
+}
+func (UnimplementedBridgeServer) SubmitMailboxPassword(context.Context, *MailboxPasswordRequest) (*LoginState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitMailboxPassword not implemented")
+}
+func (UnimplementedBridgeServer) FinishLogin(context.Context, *emptypb.Empty) (*LoginState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FinishLogin not implemented")
+}
+func (UnimplementedBridgeServer) GetSettings(context.Context, *emptypb.Empty) (*SettingList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSettings not implemented")
+}
+func (UnimplementedBridgeServer) SetSetting(context.Context, *Setting) (*Setting, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetSetting not implemented")
+}
+func (UnimplementedBridgeServer) GetSyncStatus(context.Context, *UserRequest) (*SyncStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSyncStatus not implemented")
+}
+func (UnimplementedBridgeServer) StreamEvents(*EventStreamRequest, Bridge_StreamEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedBridgeServer) mustEmbedUnimplementedBridgeServer() {}
+
+// UnsafeBridgeServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BridgeServer will
+// result in compilation errors.
+type UnsafeBridgeServer interface {
+	mustEmbedUnimplementedBridgeServer()
+}
+
+func RegisterBridgeServer(s grpc.ServiceRegistrar, srv BridgeServer) {
+	s.RegisterService(&Bridge_ServiceDesc, srv)
+}
+
+func _Bridge_ListUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).ListUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/ListUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).ListUsers(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/GetUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).GetUser(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_LogoutUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).LogoutUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/LogoutUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).LogoutUser(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_RemoveUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).RemoveUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/RemoveUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).RemoveUser(ctx, req.(*RemoveUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_SetAddressMode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddressModeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).SetAddressMode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/SetAddressMode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).SetAddressMode(ctx, req.(*AddressModeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_GetLoginState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).GetLoginState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/GetLoginState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).GetLoginState(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_StartLogin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).StartLogin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/StartLogin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).StartLogin(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_SubmitCredentials_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CredentialsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).SubmitCredentials(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/SubmitCredentials",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).SubmitCredentials(ctx, req.(*CredentialsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_SubmitTwoFactor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TwoFactorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).SubmitTwoFactor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/SubmitTwoFactor",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).SubmitTwoFactor(ctx, req.(*TwoFactorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_SubmitMailboxPassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MailboxPasswordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).SubmitMailboxPassword(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/SubmitMailboxPassword",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).SubmitMailboxPassword(ctx, req.(*MailboxPasswordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_FinishLogin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).FinishLogin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/FinishLogin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).FinishLogin(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_GetSettings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).GetSettings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/GetSettings",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).GetSettings(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_SetSetting_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Setting)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).SetSetting(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/SetSetting",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).SetSetting(ctx, req.(*Setting))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_GetSyncStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).GetSyncStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.Bridge/GetSyncStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).GetSyncStatus(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EventStreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BridgeServer).StreamEvents(m, &bridgeStreamEventsServer{stream})
+}
+
+type Bridge_StreamEventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type bridgeStreamEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *bridgeStreamEventsServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Bridge_ServiceDesc is the grpc.ServiceDesc for Bridge service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Bridge_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "grpc.Bridge",
+	HandlerType: (*BridgeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListUsers",
+			Handler:    _Bridge_ListUsers_Handler,
+		},
+		{
+			MethodName: "GetUser",
+			Handler:    _Bridge_GetUser_Handler,
+		},
+		{
+			MethodName: "LogoutUser",
+			Handler:    _Bridge_LogoutUser_Handler,
+		},
+		{
+			MethodName: "RemoveUser",
+			Handler:    _Bridge_RemoveUser_Handler,
+		},
+		{
+			MethodName: "SetAddressMode",
+			Handler:    _Bridge_SetAddressMode_Handler,
+		},
+		{
+			MethodName: "GetLoginState",
+			Handler:    _Bridge_GetLoginState_Handler,
+		},
+		{
+			MethodName: "StartLogin",
+			Handler:    _Bridge_StartLogin_Handler,
+		},
+		{
+			MethodName: "SubmitCredentials",
+			Handler:    _Bridge_SubmitCredentials_Handler,
+		},
+		{
+			MethodName: "SubmitTwoFactor",
+			Handler:    _Bridge_SubmitTwoFactor_Handler,
+		},
+		{
+			MethodName: "SubmitMailboxPassword",
+			Handler:    _Bridge_SubmitMailboxPassword_Handler,
+		},
+		{
+			MethodName: "FinishLogin",
+			Handler:    _Bridge_FinishLogin_Handler,
+		},
+		{
+			MethodName: "GetSettings",
+			Handler:    _Bridge_GetSettings_Handler,
+		},
+		{
+			MethodName: "SetSetting",
+			Handler:    _Bridge_SetSetting_Handler,
+		},
+		{
+			MethodName: "GetSyncStatus",
+			Handler:    _Bridge_GetSyncStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _Bridge_StreamEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "bridge.proto",
+}
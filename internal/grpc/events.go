@@ -0,0 +1,122 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package grpc
+
+import (
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// streamedEvents are the events frontends can receive.
+var streamedEvents = []string{ //nolint[gochecknoglobals]
+	events.ErrorEvent,
+	events.LogoutEvent,
+	events.AddressChangedEvent,
+	events.AddressChangedLogoutEvent,
+	events.UserRefreshEvent,
+	events.RestartBridgeEvent,
+	events.InternetOffEvent,
+	events.InternetOnEvent,
+	events.OutgoingNoEncEvent,
+	events.NoActiveKeyForRecipientEvent,
+	events.UpgradeApplicationEvent,
+	events.TLSCertIssue,
+	events.IMAPTLSBadCert,
+	events.LocalRuleNotificationEvent,
+	events.NewMessageEvent,
+	events.SyncFinishedEvent,
+	events.SendFailedEvent,
+	events.SendPolicyWarningEvent,
+	events.ListenerSettingsChangedEvent,
+}
+
+// drainTimeout is how long events emitted before the stream was closed
+// are read, so the listener does not wait for them forever.
+const drainTimeout = time.Second
+
+// StreamEvents sends events of the bridge until the client cancels the
+// stream or the service is closed.
+func (s *Service) StreamEvents(req *EventStreamRequest, stream Bridge_StreamEventsServer) error {
+	names := req.Names
+	if len(names) == 0 {
+		names = streamedEvents
+	}
+
+	eventCh := make(chan *Event)
+	channels := map[string]chan string{}
+	done := make(chan struct{})
+
+	for _, name := range names {
+		if _, ok := channels[name]; ok {
+			continue
+		}
+		ch := make(chan string)
+		channels[name] = ch
+		s.eventListener.Add(name, ch)
+		go forwardEvents(name, ch, eventCh, done)
+	}
+
+	defer func() {
+		for name, ch := range channels {
+			s.eventListener.Remove(name, ch)
+		}
+		close(done)
+	}()
+
+	for {
+		select {
+		case event := <-eventCh:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func forwardEvents(name string, ch <-chan string, eventCh chan<- *Event, done <-chan struct{}) {
+	for {
+		select {
+		case data := <-ch:
+			event := &Event{Name: name, Data: data, Time: timestamppb.Now()}
+			select {
+			case eventCh <- event:
+			case <-done:
+				drainEvents(ch)
+				return
+			}
+		case <-done:
+			drainEvents(ch)
+			return
+		}
+	}
+}
+
+func drainEvents(ch <-chan string) {
+	timeout := time.After(drainTimeout)
+	for {
+		select {
+		case <-ch:
+		case <-timeout:
+			return
+		}
+	}
+}
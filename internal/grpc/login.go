@@ -0,0 +1,87 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package grpc
+
+import (
+	"context"
+
+	"github.com/ProtonMail/proton-bridge/internal/frontend/wizard"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// GetLoginState returns the state of adding an account.
+func (s *Service) GetLoginState(context.Context, *emptypb.Empty) (*LoginState, error) {
+	return newLoginState(s.wizard.GetState()), nil
+}
+
+// StartLogin cancels adding of an account in progress and starts again.
+func (s *Service) StartLogin(context.Context, *emptypb.Empty) (*LoginState, error) {
+	s.wizard.Start()
+	return newLoginState(s.wizard.GetState()), nil
+}
+
+// SubmitCredentials logs in with username and password.
+func (s *Service) SubmitCredentials(_ context.Context, req *CredentialsRequest) (*LoginState, error) {
+	return s.getLoginState(s.wizard.SubmitCredentials(req.Username, req.Password))
+}
+
+// SubmitTwoFactor sends the code of the second factor.
+func (s *Service) SubmitTwoFactor(_ context.Context, req *TwoFactorRequest) (*LoginState, error) {
+	return s.getLoginState(s.wizard.SubmitTwoFactor(req.Code))
+}
+
+// SubmitMailboxPassword unlocks the keys of the account.
+func (s *Service) SubmitMailboxPassword(_ context.Context, req *MailboxPasswordRequest) (*LoginState, error) {
+	return s.getLoginState(s.wizard.SubmitMailboxPassword(req.Password))
+}
+
+// FinishLogin closes adding of the account after the client was configured.
+func (s *Service) FinishLogin(context.Context, *emptypb.Empty) (*LoginState, error) {
+	return s.getLoginState(s.wizard.Finish())
+}
+
+// getLoginState returns the state after an action. Failed actions are
+// reported in the state the same way as in other frontends, only an action
+// not allowed in the current step is an error of the call.
+func (s *Service) getLoginState(err error) (*LoginState, error) {
+	if err == wizard.ErrWrongStep {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	state := newLoginState(s.wizard.GetState())
+	if err != nil {
+		log.WithError(err).Warn("Login action failed")
+		state.Error = err.Error()
+	}
+	return state, nil
+}
+
+// newLoginState converts the state without client configuration, so bridge
+// passwords are never sent to frontends.
+func newLoginState(state wizard.State) *LoginState {
+	return &LoginState{
+		Step:        string(state.Step),
+		Username:    state.Username,
+		SecurityKey: state.SecurityKey,
+		Error:       state.Error,
+		AccountId:   state.AccountID,
+		Account:     state.Account,
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package grpc provides the local gRPC control API of the Bridge. Frontends
+// other than the built-in one, such as scripts or a web dashboard, drive
+// the same bridge core through it: they manage accounts, change settings,
+// watch sync and receive events.
+//
+// The API is served on a unix socket in a directory accessible only by the
+// user, so no other authentication is needed.
+package grpc
+
+//go:generate goprotoc --go_out=paths=source_relative:. --go-grpc_out=paths=source_relative:. bridge.proto
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/wizard"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+var log = logrus.WithField("pkg", "grpc") //nolint[gochecknoglobals]
+
+// Bridger is the part of the bridge managed by the API.
+type Bridger interface {
+	GetUsers() []types.User
+	GetUser(query string) (types.User, error)
+	DeleteUser(userID string, clearCache bool) error
+}
+
+// onboardingWizard adds accounts by the same flow as CLI and GUI.
+type onboardingWizard interface {
+	GetState() wizard.State
+	Start()
+	SubmitCredentials(username, password string) error
+	SubmitTwoFactor(code string) error
+	SubmitMailboxPassword(mailboxPassword string) error
+	Finish() error
+}
+
+// Service serves the Bridge gRPC service.
+type Service struct {
+	UnimplementedBridgeServer
+
+	pref          *config.Preferences
+	eventListener listener.Listener
+	bridge        Bridger
+	wizard        onboardingWizard
+	path          string
+
+	lock   sync.Mutex
+	server *grpc.Server
+}
+
+// NewService returns service of the bridge on the unix socket at path.
+func NewService(pref *config.Preferences, eventListener listener.Listener, bridge Bridger, wizard onboardingWizard, path string) *Service {
+	return &Service{
+		pref:          pref,
+		eventListener: eventListener,
+		bridge:        bridge,
+		wizard:        wizard,
+		path:          path,
+	}
+}
+
+// ListenAndServe serves clients until the service is closed.
+func (s *Service) ListenAndServe() error {
+	// The socket is reachable by others between listen and chmod, so it is
+	// created in a directory only the user can enter.
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return err
+	}
+
+	// Only one bridge runs at a time, so an existing socket is a leftover.
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	ln, err := net.Listen("unix", s.path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(s.path, 0600); err != nil {
+		_ = ln.Close()
+		return err
+	}
+
+	server := grpc.NewServer()
+	RegisterBridgeServer(server, s)
+
+	s.lock.Lock()
+	s.server = server
+	s.lock.Unlock()
+
+	log.Info("gRPC API listening at ", s.path)
+	return server.Serve(ln)
+}
+
+// Close disconnects clients and stops serving.
+func (s *Service) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.server != nil {
+		s.server.Stop()
+	}
+}
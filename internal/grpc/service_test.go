@@ -0,0 +1,272 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/wizard"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// testBridge has no accounts.
+type testBridge struct{}
+
+func (testBridge) GetUsers() []types.User {
+	return nil
+}
+
+func (testBridge) GetUser(query string) (types.User, error) {
+	return nil, errors.New("user " + query + " not found")
+}
+
+func (testBridge) DeleteUser(userID string, clearCache bool) error {
+	return nil
+}
+
+// testWizard adds the account right after credentials.
+type testWizard struct {
+	step wizard.Step
+}
+
+func (w *testWizard) GetState() wizard.State {
+	return wizard.State{Step: w.step}
+}
+
+func (w *testWizard) Start() {
+	w.step = wizard.StepCredentials
+}
+
+func (w *testWizard) SubmitCredentials(username, password string) error {
+	if w.step != wizard.StepCredentials {
+		return wizard.ErrWrongStep
+	}
+	if username == "" || password == "" {
+		return wizard.ErrEmptyValue
+	}
+	w.step = wizard.StepClientConfig
+	return nil
+}
+
+func (w *testWizard) SubmitTwoFactor(code string) error {
+	return wizard.ErrWrongStep
+}
+
+func (w *testWizard) SubmitMailboxPassword(mailboxPassword string) error {
+	return wizard.ErrWrongStep
+}
+
+func (w *testWizard) Finish() error {
+	if w.step != wizard.StepClientConfig {
+		return wizard.ErrWrongStep
+	}
+	w.step = wizard.StepDone
+	return nil
+}
+
+func startTestService(t *testing.T) (BridgeClient, listener.Listener, *config.Preferences, func()) {
+	dir, err := ioutil.TempDir("", "grpc")
+	require.NoError(t, err)
+
+	pref := config.NewPreferences(filepath.Join(dir, "prefs.json"))
+	eventListener := listener.New()
+	path := filepath.Join(dir, "grpc", "grpc.sock")
+	service := NewService(pref, eventListener, testBridge{}, &testWizard{step: wizard.StepCredentials}, path)
+
+	served := make(chan error)
+	go func() { served <- service.ListenAndServe() }()
+
+	require.Eventually(t, func() bool {
+		service.lock.Lock()
+		defer service.lock.Unlock()
+		return service.server != nil
+	}, time.Second, 10*time.Millisecond)
+
+	conn, err := grpc.Dial(path, grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", addr)
+	}))
+	require.NoError(t, err)
+
+	return NewBridgeClient(conn), eventListener, pref, func() {
+		_ = conn.Close()
+		service.Close()
+		require.NoError(t, <-served)
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestSocketPermissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grpc")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	// Existing folder with loose permissions must be restricted.
+	socketDir := filepath.Join(dir, "grpc")
+	require.NoError(t, os.Mkdir(socketDir, 0755))
+
+	path := filepath.Join(socketDir, "grpc.sock")
+	service := NewService(config.NewPreferences(filepath.Join(dir, "prefs.json")), listener.New(), testBridge{}, &testWizard{}, path)
+
+	served := make(chan error)
+	go func() { served <- service.ListenAndServe() }()
+
+	require.Eventually(t, func() bool {
+		service.lock.Lock()
+		defer service.lock.Unlock()
+		return service.server != nil
+	}, time.Second, 10*time.Millisecond)
+
+	dirInfo, err := os.Stat(socketDir)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), dirInfo.Mode().Perm())
+
+	socketInfo, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), socketInfo.Mode().Perm())
+
+	service.Close()
+	require.NoError(t, <-served)
+}
+
+func TestUsers(t *testing.T) {
+	client, _, _, stop := startTestService(t)
+	defer stop()
+
+	list, err := client.ListUsers(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.Empty(t, list.Users)
+
+	_, err = client.GetUser(context.Background(), &UserRequest{User: "user"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.GetSyncStatus(context.Background(), &UserRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestLogin(t *testing.T) {
+	client, _, _, stop := startTestService(t)
+	defer stop()
+
+	state, err := client.SubmitCredentials(context.Background(), &CredentialsRequest{Username: "user"})
+	require.NoError(t, err)
+	require.Equal(t, string(wizard.StepCredentials), state.Step)
+	require.Equal(t, wizard.ErrEmptyValue.Error(), state.Error)
+
+	_, err = client.FinishLogin(context.Background(), &emptypb.Empty{})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	state, err = client.SubmitCredentials(context.Background(), &CredentialsRequest{Username: "user", Password: "pass"})
+	require.NoError(t, err)
+	require.Equal(t, string(wizard.StepClientConfig), state.Step)
+	require.Empty(t, state.Error)
+
+	state, err = client.FinishLogin(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.Equal(t, string(wizard.StepDone), state.Step)
+}
+
+func TestSettings(t *testing.T) {
+	client, eventListener, pref, stop := startTestService(t)
+	defer stop()
+
+	listenerSettingsCh := make(chan string)
+	eventListener.Add(events.ListenerSettingsChangedEvent, listenerSettingsCh)
+
+	setting, err := client.SetSetting(context.Background(), &Setting{Key: preferences.IMAPPortKey, Value: "1144"})
+	require.NoError(t, err)
+	require.Equal(t, "1144", setting.Value)
+	require.Equal(t, 1144, pref.GetInt(preferences.IMAPPortKey))
+
+	select {
+	case <-listenerSettingsCh:
+	case <-time.After(time.Second):
+		require.Fail(t, "changed port was not applied")
+	}
+
+	_, err = client.SetSetting(context.Background(), &Setting{Key: preferences.SMTPPortKey, Value: "0"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.SetSetting(context.Background(), &Setting{Key: preferences.SMTPImplicitTLSPortKey, Value: "0"})
+	require.NoError(t, err)
+
+	_, err = client.SetSetting(context.Background(), &Setting{Key: preferences.HideSelfSentKey, Value: "maybe"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.SetSetting(context.Background(), &Setting{Key: preferences.AppleMailCompatKey, Value: "true"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.SetSetting(context.Background(), &Setting{Key: preferences.CookiesKey, Value: ""})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	list, err := client.GetSettings(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.Len(t, list.Settings, len(settings))
+}
+
+func TestStreamEvents(t *testing.T) {
+	client, eventListener, _, stop := startTestService(t)
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.StreamEvents(ctx, &EventStreamRequest{Names: []string{events.NewMessageEvent}})
+	require.NoError(t, err)
+
+	// The stream subscribes to events asynchronously after it is opened.
+	received := make(chan *Event)
+	go func() {
+		event, err := stream.Recv()
+		if err == nil {
+			received <- event
+		}
+	}()
+
+	timeout := time.After(time.Second)
+	for {
+		eventListener.Emit(events.NewMessageEvent, "user:msg")
+		select {
+		case event := <-received:
+			require.Equal(t, events.NewMessageEvent, event.Name)
+			require.Equal(t, "user:msg", event.Data)
+			require.NotNil(t, event.Time)
+			return
+		case <-timeout:
+			require.Fail(t, "event was not received")
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package grpc
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/imap"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type settingKind int
+
+const (
+	boolSetting settingKind = iota
+	portSetting
+	intSetting
+	choiceSetting
+)
+
+type setting struct {
+	kind settingKind
+
+	// isListener settings are applied to IMAP and SMTP servers right away.
+	isListener bool
+
+	// isOptional ports are disabled by zero.
+	isOptional bool
+
+	choices []string
+}
+
+// settings are preferences which frontends can read and change. Servers
+// enabled by settings are started or stopped with the next start of the
+// bridge, the same as when changed in CLI or GUI.
+var settings = map[string]setting{ //nolint[gochecknoglobals]
+	preferences.IMAPPortKey:             {kind: portSetting, isListener: true},
+	preferences.SMTPPortKey:             {kind: portSetting, isListener: true},
+	preferences.SMTPImplicitTLSPortKey:  {kind: portSetting, isListener: true, isOptional: true},
+	preferences.SMTPSSLKey:              {kind: boolSetting, isListener: true},
+	preferences.CalDAVEnabledKey:        {kind: boolSetting},
+	preferences.LDAPEnabledKey:          {kind: boolSetting},
+	preferences.EventSocketEnabledKey:   {kind: boolSetting},
+	preferences.NotificationsEnabledKey: {kind: boolSetting},
+	preferences.ReportOutgoingNoEncKey:  {kind: boolSetting},
+	preferences.HideSelfSentKey:         {kind: boolSetting},
+	preferences.AppleMailCompatKey:      {kind: choiceSetting, choices: []string{imap.AppleMailCompatAuto, imap.AppleMailCompatOn, imap.AppleMailCompatOff}},
+	preferences.DeletedRetentionKey:     {kind: intSetting},
+}
+
+// GetSettings returns all settings available to frontends.
+func (s *Service) GetSettings(context.Context, *emptypb.Empty) (*SettingList, error) {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := &SettingList{}
+	for _, key := range keys {
+		list.Settings = append(list.Settings, &Setting{Key: key, Value: s.pref.Get(key)})
+	}
+	return list, nil
+}
+
+// SetSetting changes the setting and returns its new value.
+func (s *Service) SetSetting(_ context.Context, req *Setting) (*Setting, error) {
+	setting, ok := settings[req.Key]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "unknown setting "+req.Key)
+	}
+	if err := setting.validate(req.Value); err != nil {
+		return nil, err
+	}
+
+	s.pref.Set(req.Key, req.Value)
+	if setting.isListener {
+		s.eventListener.Emit(events.ListenerSettingsChangedEvent, "")
+	}
+	return &Setting{Key: req.Key, Value: s.pref.Get(req.Key)}, nil
+}
+
+func (s setting) validate(value string) error {
+	switch s.kind {
+	case boolSetting:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return status.Error(codes.InvalidArgument, "value has to be true or false")
+		}
+	case portSetting:
+		port, err := strconv.Atoi(value)
+		if s.isOptional && err == nil && port == 0 {
+			return nil
+		}
+		if err != nil || port < 1 || port > 65535 {
+			return status.Error(codes.InvalidArgument, "value has to be port number")
+		}
+	case intSetting:
+		if number, err := strconv.Atoi(value); err != nil || number < 0 {
+			return status.Error(codes.InvalidArgument, "value has to be non-negative number")
+		}
+	case choiceSetting:
+		for _, choice := range s.choices {
+			if value == choice {
+				return nil
+			}
+		}
+		return status.Error(codes.InvalidArgument, "value has to be one of "+strings.Join(s.choices, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ListUsers returns all accounts of the bridge.
+func (s *Service) ListUsers(context.Context, *emptypb.Empty) (*UserList, error) {
+	list := &UserList{}
+	for _, user := range s.bridge.GetUsers() {
+		list.Users = append(list.Users, newUser(user))
+	}
+	return list, nil
+}
+
+// GetUser returns the account by ID, username or address.
+func (s *Service) GetUser(_ context.Context, req *UserRequest) (*User, error) {
+	user, err := s.getUser(req.User)
+	if err != nil {
+		return nil, err
+	}
+	return newUser(user), nil
+}
+
+// LogoutUser logs the account out; it stays in the bridge.
+func (s *Service) LogoutUser(_ context.Context, req *UserRequest) (*emptypb.Empty, error) {
+	user, err := s.getUser(req.User)
+	if err != nil {
+		return nil, err
+	}
+	if err := user.Logout(); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// RemoveUser removes the account from the bridge.
+func (s *Service) RemoveUser(_ context.Context, req *RemoveUserRequest) (*emptypb.Empty, error) {
+	user, err := s.getUser(req.User)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.bridge.DeleteUser(user.ID(), req.ClearCache); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// SetAddressMode switches the account to combined or split address mode.
+// Nothing happens when the account is in the mode already.
+func (s *Service) SetAddressMode(_ context.Context, req *AddressModeRequest) (*User, error) {
+	user, err := s.getUser(req.User)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsCombinedAddressMode() != req.Combined {
+		if err := user.SwitchAddressMode(); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	return newUser(user), nil
+}
+
+// GetSyncStatus returns whether the account is being synced and the report
+// of the last sync.
+func (s *Service) GetSyncStatus(_ context.Context, req *UserRequest) (*SyncStatus, error) {
+	user, err := s.getUser(req.User)
+	if err != nil {
+		return nil, err
+	}
+	report, err := user.GetSyncReport()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &SyncStatus{
+		Running: user.IsSyncing(),
+		Last:    newSyncReport(report),
+	}, nil
+}
+
+func (s *Service) getUser(query string) (types.User, error) {
+	if query == "" {
+		return nil, status.Error(codes.InvalidArgument, "user must not be empty")
+	}
+	user, err := s.bridge.GetUser(query)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return user, nil
+}
+
+func newUser(user types.User) *User {
+	return &User{
+		Id:                  user.ID(),
+		Username:            user.Username(),
+		Connected:           user.IsConnected(),
+		CombinedAddressMode: user.IsCombinedAddressMode(),
+		PrimaryAddress:      user.GetPrimaryAddress(),
+		Addresses:           user.GetAddresses(),
+		Syncing:             user.IsSyncing(),
+	}
+}
+
+func newSyncReport(report *store.SyncReport) *SyncReport {
+	if report == nil {
+		return nil
+	}
+	return &SyncReport{
+		Started:  newTimestamp(report.Started),
+		Finished: newTimestamp(report.Finished),
+		Resumed:  report.Resumed,
+		Synced:   int64(report.Synced),
+		Skipped:  int64(report.Skipped),
+		Deleted:  int64(report.Deleted),
+		Failed:   int64(len(report.FailedIDs)),
+		Error:    report.Error,
+	}
+}
+
+func newTimestamp(unix int64) *timestamppb.Timestamp {
+	if unix == 0 {
+		return nil
+	}
+	return timestamppb.New(time.Unix(unix, 0))
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/emersion/go-imap"
+)
+
+var (
+	errListenerClosed     = errors.New("listener closed")
+	errPortOfOtherAccount = errors.New("port is dedicated to another account")
+)
+
+// multiListener accepts connections from the main listener and listeners of
+// ports dedicated to accounts. All connections are served by one go-imap
+// server because the server can have only one channel of IDLE updates.
+type multiListener struct {
+	main  net.Listener
+	conns chan net.Conn
+	errs  chan error
+
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	lock      sync.Mutex
+	listeners map[int]net.Listener
+}
+
+func newMultiListener() *multiListener {
+	return &multiListener{
+		conns:     make(chan net.Conn),
+		errs:      make(chan error, 1),
+		closed:    make(chan struct{}),
+		listeners: map[int]net.Listener{},
+	}
+}
+
+// serveMain starts accepting connections of the main listener. Its failure
+// is returned by Accept so the server is stopped. The previous main
+// listener is closed; connections it accepted stay open.
+func (ml *multiListener) serveMain(l net.Listener) {
+	ml.lock.Lock()
+	previous := ml.main
+	ml.main = l
+	ml.lock.Unlock()
+
+	if previous != nil {
+		_ = previous.Close()
+	}
+
+	go ml.accept(l)
+}
+
+// reopenPorts opens listeners of ports dedicated to accounts again, e.g.
+// on the new bind address. Connections accepted before stay open.
+func (ml *multiListener) reopenPorts() {
+	ml.lock.Lock()
+	ports := []int{}
+	for port, l := range ml.listeners {
+		ports = append(ports, port)
+		_ = l.Close()
+		delete(ml.listeners, port)
+	}
+	ml.lock.Unlock()
+
+	ml.setPorts(ports)
+}
+
+// setPorts opens listeners of new ports and closes listeners of ports
+// which are not dedicated to any account anymore.
+func (ml *multiListener) setPorts(ports []int) {
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+
+	wanted := map[int]bool{}
+	for _, port := range ports {
+		wanted[port] = true
+	}
+
+	for port, l := range ml.listeners {
+		if !wanted[port] {
+			log.WithField("port", port).Info("Closing IMAP port of account")
+			_ = l.Close()
+			delete(ml.listeners, port)
+		}
+	}
+
+	for port := range wanted {
+		if _, ok := ml.listeners[port]; ok {
+			continue
+		}
+
+		l, err := net.Listen("tcp", bridge.GetListenAddress(port))
+		if err != nil {
+			log.WithError(err).WithField("port", port).Error("Cannot listen on IMAP port of account")
+			continue
+		}
+
+		log.WithField("port", port).Info("IMAP server listening on port of account")
+		l = bridge.NewRemoteAccessListener(l)
+		ml.listeners[port] = l
+		go ml.accept(l)
+	}
+}
+
+func (ml *multiListener) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ml.isMain(l) {
+				select {
+				case ml.errs <- err:
+				default:
+				}
+			}
+			return
+		}
+
+		select {
+		case ml.conns <- conn:
+		case <-ml.closed:
+			_ = conn.Close()
+			return
+		}
+	}
+}
+
+// hasMain returns whether the main listener was set, i.e. the server is running.
+func (ml *multiListener) hasMain() bool {
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+
+	return ml.main != nil
+}
+
+func (ml *multiListener) isMain(l net.Listener) bool {
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+
+	return ml.main == l
+}
+
+func (ml *multiListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-ml.conns:
+		return conn, nil
+	case err := <-ml.errs:
+		return nil, err
+	case <-ml.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (ml *multiListener) Close() error {
+	ml.closeOnce.Do(func() { close(ml.closed) })
+
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+
+	for port, l := range ml.listeners {
+		_ = l.Close()
+		delete(ml.listeners, port)
+	}
+
+	if ml.main != nil {
+		return ml.main.Close()
+	}
+	return nil
+}
+
+func (ml *multiListener) Addr() net.Addr {
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+
+	return ml.main.Addr()
+}
+
+// SetAccountPorts changes ports dedicated to accounts. Keys are ports and
+// values are IDs of users to whom the ports are dedicated.
+func (s *imapServer) SetAccountPorts(ports map[int]string) {
+	list := []int{}
+	for port := range ports {
+		list = append(list, port)
+	}
+	s.listener.setPorts(list)
+}
+
+// checkAccountPort returns error when the connection came to the port
+// dedicated to another account than the one of the user.
+func (ib *imapBackend) checkAccountPort(info *imap.ConnInfo, userID string) error {
+	if info == nil {
+		return nil
+	}
+
+	addr, ok := info.LocalAddr.(*net.TCPAddr)
+	if !ok {
+		return nil
+	}
+
+	if portUserID, ok := ib.bridge.GetAccountPortsUserID(addr.Port); ok && portUserID != userID {
+		return errPortOfOtherAccount
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/pkg/ports"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiListener(t *testing.T) {
+	main, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ml := newMultiListener()
+	ml.serveMain(main)
+	defer ml.Close() //nolint[errcheck]
+
+	port := ports.FindFreePortFrom(11143)
+	ml.setPorts([]int{port})
+
+	for _, addr := range []string{main.Addr().String(), fmt.Sprintf("%v:%v", bridge.Host, port)} {
+		client, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+
+		conn, err := ml.Accept()
+		require.NoError(t, err)
+		require.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+
+		_ = client.Close()
+		_ = conn.Close()
+	}
+
+	ml.setPorts(nil)
+	_, err = net.Dial("tcp", fmt.Sprintf("%v:%v", bridge.Host, port))
+	require.Error(t, err)
+
+	require.NoError(t, ml.Close())
+	_, err = ml.Accept()
+	require.Error(t, err)
+}
+
+func TestMultiListenerReplaceMain(t *testing.T) {
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ml := newMultiListener()
+	ml.serveMain(first)
+	defer ml.Close() //nolint[errcheck]
+
+	client, err := net.Dial("tcp", first.Addr().String())
+	require.NoError(t, err)
+	defer client.Close() //nolint[errcheck]
+
+	conn, err := ml.Accept()
+	require.NoError(t, err)
+	defer conn.Close() //nolint[errcheck]
+
+	second, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ml.serveMain(second)
+
+	_, err = net.Dial("tcp", first.Addr().String())
+	require.Error(t, err)
+	require.Equal(t, second.Addr(), ml.Addr())
+
+	newClient, err := net.Dial("tcp", second.Addr().String())
+	require.NoError(t, err)
+	defer newClient.Close() //nolint[errcheck]
+
+	// Closing of the replaced listener is not returned as error.
+	newConn, err := ml.Accept()
+	require.NoError(t, err)
+	defer newConn.Close() //nolint[errcheck]
+
+	// Connection accepted by the replaced listener is still open.
+	_, err = client.Write([]byte("a"))
+	require.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = conn.Read(buf)
+	require.NoError(t, err)
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"strings"
+	"sync"
+
+	imapid "github.com/ProtonMail/go-imap-id"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+	imapserver "github.com/emersion/go-imap/server"
+)
+
+// Modes of Apple Mail compatibility.
+const (
+	// AppleMailCompatAuto enables compatibility for connections which
+	// identified themselves as Apple Mail by the ID command.
+	AppleMailCompatAuto = "auto"
+	// AppleMailCompatOn enables compatibility for all connections.
+	AppleMailCompatOn = "on"
+	// AppleMailCompatOff disables compatibility for all connections.
+	AppleMailCompatOff = "off"
+)
+
+var (
+	appleMailCompat     = AppleMailCompatAuto //nolint[gochecknoglobals]
+	appleMailCompatLock sync.RWMutex          //nolint[gochecknoglobals]
+)
+
+// SetAppleMailCompatibility sets for which connections the quirks expected
+// by Apple Mail are enabled. Unknown mode is the same as auto.
+func SetAppleMailCompatibility(mode string) {
+	appleMailCompatLock.Lock()
+	defer appleMailCompatLock.Unlock()
+
+	switch mode {
+	case AppleMailCompatOn, AppleMailCompatOff:
+		appleMailCompat = mode
+	default:
+		appleMailCompat = AppleMailCompatAuto
+	}
+}
+
+func getAppleMailCompatibility() string {
+	appleMailCompatLock.RLock()
+	defer appleMailCompatLock.RUnlock()
+
+	return appleMailCompat
+}
+
+// isAppleMailID returns whether the client ID belongs to Apple Mail on macOS
+// (`Mac OS X Mail`) or iOS (`iPhone Mail`, `iPad Mail`).
+func isAppleMailID(id imapid.ID) bool {
+	name := id[imapid.FieldName]
+	if name == clientAppleMail {
+		return true
+	}
+	isApple := strings.HasPrefix(name, "iPhone") || strings.HasPrefix(name, "iPad") || strings.Contains(id[imapid.FieldVendor], "Apple")
+	return isApple && strings.HasSuffix(name, "Mail")
+}
+
+func isAppleMailCompatConn(conn imapserver.Conn) bool {
+	switch getAppleMailCompatibility() {
+	case AppleMailCompatOn:
+		return true
+	case AppleMailCompatOff:
+		return false
+	}
+
+	// Apple Mail sends ID right after login, before selecting a mailbox.
+	if idConn, ok := conn.(imapid.Conn); ok {
+		return isAppleMailID(idConn.ID())
+	}
+	return false
+}
+
+// appleMailExtension implements quirks expected by Apple Mail. It polls
+// the selected mailbox by NOOP every few seconds and relies on the EXISTS
+// response to notice new messages, rather than on updates sent between
+// commands. NOOP and CHECK therefore answer right away with EXISTS taken
+// from mailbox counters whenever the count grew since the client last
+// heard about it. Nothing else is done, so polling stays cheap.
+type appleMailExtension struct {
+	lock     sync.Mutex
+	sessions map[*imapserver.Context]*appleMailSession
+}
+
+// appleMailSession is the message count of the selected mailbox known to
+// the client.
+type appleMailSession struct {
+	mailbox string
+	exists  uint32
+}
+
+func newAppleMailExtension() *appleMailExtension {
+	return &appleMailExtension{
+		sessions: make(map[*imapserver.Context]*appleMailSession),
+	}
+}
+
+func (ext *appleMailExtension) Capabilities(c imapserver.Conn) []string {
+	return nil
+}
+
+func (ext *appleMailExtension) Command(name string) imapserver.HandlerFactory {
+	switch name {
+	case "SELECT":
+		return func() imapserver.Handler {
+			return &appleMailSelect{ext: ext}
+		}
+	case "EXAMINE":
+		return func() imapserver.Handler {
+			hdlr := &appleMailSelect{ext: ext}
+			hdlr.ReadOnly = true
+			return hdlr
+		}
+	case "NOOP":
+		return func() imapserver.Handler {
+			return &appleMailPoll{ext: ext, Handler: &imapserver.Noop{}}
+		}
+	case "CHECK":
+		return func() imapserver.Handler {
+			return &appleMailPoll{ext: ext, Handler: &imapserver.Check{}}
+		}
+	}
+	return nil
+}
+
+// session returns the state of the connection. It is forgotten when
+// the client logs out.
+func (ext *appleMailExtension) session(conn imapserver.Conn) *appleMailSession {
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+
+	ctx := conn.Context()
+	if session, ok := ext.sessions[ctx]; ok {
+		return session
+	}
+
+	session := &appleMailSession{}
+	ext.sessions[ctx] = session
+
+	go func() {
+		<-ctx.LoggedOut
+
+		ext.lock.Lock()
+		defer ext.lock.Unlock()
+
+		delete(ext.sessions, ctx)
+	}()
+
+	return session
+}
+
+// countMessages returns name and message count of the selected mailbox.
+// Counts are read from counters, see store.Mailbox.GetCounts.
+func countMessages(conn imapserver.Conn) (string, uint32, bool) {
+	mailbox := conn.Context().Mailbox
+	if mailbox == nil {
+		return "", 0, false
+	}
+
+	status, err := mailbox.Status([]imap.StatusItem{imap.StatusMessages})
+	if err != nil {
+		log.WithError(err).Warn("Cannot count messages of selected mailbox")
+		return "", 0, false
+	}
+	return mailbox.Name(), status.Messages, true
+}
+
+// remember saves the message count which the client knows.
+func (ext *appleMailExtension) remember(conn imapserver.Conn) {
+	name, exists, ok := countMessages(conn)
+	if !ok {
+		return
+	}
+
+	session := ext.session(conn)
+
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+
+	session.mailbox = name
+	session.exists = exists
+}
+
+// reportExists writes EXISTS when the selected mailbox has more messages
+// than the client knows. Less messages are reported by EXPUNGE updates.
+func (ext *appleMailExtension) reportExists(conn imapserver.Conn) error {
+	name, exists, ok := countMessages(conn)
+	if !ok {
+		return nil
+	}
+
+	session := ext.session(conn)
+
+	ext.lock.Lock()
+	isNew := session.mailbox == name && exists > session.exists
+	session.mailbox = name
+	session.exists = exists
+	ext.lock.Unlock()
+
+	if !isNew {
+		return nil
+	}
+
+	status := imap.NewMailboxStatus(name, []imap.StatusItem{imap.StatusMessages})
+	status.Messages = exists
+	return conn.WriteResp(&responses.Select{Mailbox: status})
+}
+
+type appleMailSelect struct {
+	imapserver.Select
+
+	ext *appleMailExtension
+}
+
+// Handle selects the mailbox and remembers its message count. Successful
+// SELECT returns OK status response with READ-WRITE or READ-ONLY code.
+func (cmd *appleMailSelect) Handle(conn imapserver.Conn) error {
+	err := cmd.Select.Handle(conn)
+
+	if conn.Context().Mailbox != nil && isAppleMailCompatConn(conn) {
+		cmd.ext.remember(conn)
+	}
+	return err
+}
+
+// appleMailPoll is NOOP or CHECK reporting new messages to Apple Mail.
+type appleMailPoll struct {
+	imapserver.Handler
+
+	ext *appleMailExtension
+}
+
+func (cmd *appleMailPoll) Handle(conn imapserver.Conn) error {
+	if err := cmd.Handler.Handle(conn); err != nil {
+		return err
+	}
+
+	if isAppleMailCompatConn(conn) {
+		return cmd.ext.reportExists(conn)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	imapid "github.com/ProtonMail/go-imap-id"
+	"github.com/emersion/go-imap/backend/memory"
+	imapserver "github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAppleMailServer(t *testing.T, mode string) (dial func() *textproto.Conn, clear func()) {
+	SetAppleMailCompatibility(mode)
+
+	s := imapserver.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.Enable(imapid.NewExtension(imapid.ID{imapid.FieldName: "ProtonMail"}), newAppleMailExtension())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = s.Serve(l) }()
+
+	conns := []*textproto.Conn{}
+	dial = func() *textproto.Conn {
+		conn, err := textproto.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		_, err = conn.ReadLine()
+		require.NoError(t, err)
+		conns = append(conns, conn)
+		return conn
+	}
+
+	return dial, func() {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+		_ = s.Close()
+		SetAppleMailCompatibility(AppleMailCompatAuto)
+	}
+}
+
+// readUntilTagged returns all responses up to the tagged one.
+func readUntilTagged(t *testing.T, conn *textproto.Conn, tag string) (untagged []string, tagged string) {
+	for {
+		response, err := conn.ReadLine()
+		require.NoError(t, err)
+		if strings.HasPrefix(response, tag+" ") {
+			return untagged, response
+		}
+		untagged = append(untagged, response)
+	}
+}
+
+// pollAfterAppend selects INBOX with one message by the client with the ID,
+// appends one more message by another connection and returns untagged
+// responses to NOOP of the first client.
+func pollAfterAppend(t *testing.T, dial func() *textproto.Conn, id string) []string {
+	client := dial()
+	require.Contains(t, sessionQuotaCmd(t, client, "a", "LOGIN username password"), "a OK")
+	require.Contains(t, sessionQuotaCmd(t, client, "b", "ID "+id), "b OK")
+	require.Contains(t, sessionQuotaCmd(t, client, "c", "SELECT INBOX"), "c OK")
+
+	require.NoError(t, client.PrintfLine("d NOOP"))
+	untagged, tagged := readUntilTagged(t, client, "d")
+	require.Contains(t, tagged, "d OK")
+	require.NotContains(t, untagged, "* 1 EXISTS", "known count is not reported again")
+
+	other := dial()
+	require.Contains(t, sessionQuotaCmd(t, other, "a", "LOGIN username password"), "a OK")
+	require.Contains(t, sessionQuotaAppend(t, other, "b"), "b OK")
+
+	require.NoError(t, client.PrintfLine("e NOOP"))
+	untagged, tagged = readUntilTagged(t, client, "e")
+	require.Contains(t, tagged, "e OK")
+	return untagged
+}
+
+func TestAppleMailNoopReportsNewMessages(t *testing.T) {
+	dial, clear := newTestAppleMailServer(t, AppleMailCompatAuto)
+	defer clear()
+
+	require.Contains(t, pollAfterAppend(t, dial, `("name" "Mac OS X Mail" "version" "16.0")`), "* 2 EXISTS")
+}
+
+func TestAppleMailNoopOtherClients(t *testing.T) {
+	dial, clear := newTestAppleMailServer(t, AppleMailCompatAuto)
+	defer clear()
+
+	require.NotContains(t, pollAfterAppend(t, dial, `("name" "Thunderbird" "version" "78.0")`), "* 2 EXISTS")
+}
+
+func TestAppleMailCompatibilityModes(t *testing.T) {
+	dial, clear := newTestAppleMailServer(t, AppleMailCompatOn)
+	defer clear()
+
+	require.Contains(t, pollAfterAppend(t, dial, `("name" "Thunderbird")`), "* 2 EXISTS")
+
+	SetAppleMailCompatibility(AppleMailCompatOff)
+	require.NotContains(t, pollAfterAppend(t, dial, `("name" "Mac OS X Mail")`), "* 3 EXISTS")
+}
+
+func TestIsAppleMailID(t *testing.T) {
+	require.True(t, isAppleMailID(imapid.ID{imapid.FieldName: "Mac OS X Mail"}))
+	require.True(t, isAppleMailID(imapid.ID{imapid.FieldName: "iPhone Mail"}))
+	require.True(t, isAppleMailID(imapid.ID{imapid.FieldName: "iPad Mail"}))
+	require.True(t, isAppleMailID(imapid.ID{imapid.FieldName: "macOS Mail", imapid.FieldVendor: "Apple Inc"}))
+	require.False(t, isAppleMailID(imapid.ID{imapid.FieldName: "Thunderbird"}))
+	require.False(t, isAppleMailID(nil))
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/imap/cache"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	openpgperrors "golang.org/x/crypto/openpgp/errors"
+)
+
+// placeholderCacheSuffix distinguishes messages built with placeholders
+// instead of large attachments in the in-memory cache.
+const placeholderCacheSuffix = "-placeholder"
+
+var (
+	attachmentPlaceholderSize     int64        //nolint[gochecknoglobals]
+	attachmentPlaceholderSizeLock sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetAttachmentPlaceholderSize sets the size in bytes above which the
+// attachments are not downloaded when the whole message is fetched. Such
+// attachment is sent as an empty part and its content is downloaded only
+// when the client fetches the part itself (BODY[x]). Zero disables it.
+func SetAttachmentPlaceholderSize(size int64) {
+	attachmentPlaceholderSizeLock.Lock()
+	defer attachmentPlaceholderSizeLock.Unlock()
+
+	attachmentPlaceholderSize = size
+}
+
+func getAttachmentPlaceholderSize() int64 {
+	attachmentPlaceholderSizeLock.RLock()
+	defer attachmentPlaceholderSizeLock.RUnlock()
+
+	return attachmentPlaceholderSize
+}
+
+// isPlaceholderAttachment returns whether the attachment is left out of the
+// message fetched as a whole.
+func isPlaceholderAttachment(att *pmapi.Attachment, size int64) bool {
+	return size > 0 && att.Size > size
+}
+
+// getPlaceholderBodyStructure returns the whole message with placeholders
+// instead of large attachments. The complete message is used when it is
+// already built, the mode is disabled or there is no large attachment.
+func (im *imapMailbox) getPlaceholderBodyStructure(ctx context.Context, storeMessage storeMessageProvider) (
+	structure *message.BodyStructure,
+	body messageBody, err error,
+) {
+	m := storeMessage.Message()
+	id := im.storeUser.UserID() + m.ID
+	size := getAttachmentPlaceholderSize()
+
+	if size <= 0 || m.NumAttachments == 0 || isMessageInDraftFolder(m) {
+		return im.getBodyStructure(ctx, storeMessage)
+	}
+	var bodyReader *bytes.Reader
+	if bodyReader, structure = cache.LoadMail(id); bodyReader.Len() != 0 && structure != nil {
+		return structure, bodyReader, nil
+	}
+	if bodyReader, structure = im.loadCachedMessage(storeMessage); bodyReader.Len() != 0 && structure != nil {
+		return structure, bodyReader, nil
+	}
+
+	placeholderID := id + placeholderCacheSuffix
+	cache.BuildLock(placeholderID)
+	defer cache.BuildUnlock(placeholderID)
+
+	if bodyReader, structure = cache.LoadMail(placeholderID); bodyReader.Len() != 0 && structure != nil {
+		return structure, bodyReader, nil
+	}
+
+	built, structure, err := im.buildPlaceholderMessage(ctx, m, size)
+	if err != nil {
+		im.log.WithError(err).WithField("msgID", m.ID).Debug("Cannot build message with attachment placeholders")
+		return im.getBodyStructure(ctx, storeMessage)
+	}
+	if built == nil {
+		return im.getBodyStructure(ctx, storeMessage)
+	}
+
+	if data, ok := built.Bytes(); ok {
+		cache.SaveMail(placeholderID, data, structure)
+	}
+	return structure, built, nil
+}
+
+// buildPlaceholderMessage builds the message with empty parts of attachments
+// larger than size. It returns nil body when there is no such attachment.
+// Any problem is left to the complete build which knows how to handle it.
+func (im *imapMailbox) buildPlaceholderMessage(ctx context.Context, m *pmapi.Message, size int64) (body *spool, structure *message.BodyStructure, err error) {
+	if err = im.fetchMessage(ctx, m); err != nil {
+		return
+	}
+
+	hasPlaceholder := false
+	for _, att := range m.Attachments {
+		hasPlaceholder = hasPlaceholder || isPlaceholderAttachment(att, size)
+	}
+	if !hasPlaceholder {
+		return nil, nil, nil
+	}
+
+	var kr *crypto.KeyRing
+	if kr, err = im.user.client().KeyRingForAddressID(m.AddressID); err != nil {
+		return
+	}
+
+	// Missing keys of the sender only leave out the result of signature check.
+	verifiers, _ := message.VerificationKeyRing(ctx, im.user.client(), m)
+
+	var signature pmapi.SignatureStatus
+	if signature, err = m.DecryptAndVerify(kr, verifiers); err != nil && err != openpgperrors.ErrSignatureExpired {
+		return
+	}
+
+	writeAttachment := func(w io.Writer, m *pmapi.Message, att *pmapi.Attachment) error {
+		if isPlaceholderAttachment(att, size) {
+			return nil
+		}
+		return im.writeAttachmentBody(ctx, w, m, att)
+	}
+
+	structure, body, err = im.buildMessageInner(ctx, m, kr, signature, writeAttachment)
+	return
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPlaceholderAttachment(t *testing.T) {
+	att := &pmapi.Attachment{Size: 2048}
+
+	require.False(t, isPlaceholderAttachment(att, 0), "disabled")
+	require.False(t, isPlaceholderAttachment(att, 2048), "not above the size")
+	require.True(t, isPlaceholderAttachment(att, 1024))
+}
+
+func TestSetAttachmentPlaceholderSize(t *testing.T) {
+	defer SetAttachmentPlaceholderSize(0)
+
+	require.Equal(t, int64(0), getAttachmentPlaceholderSize())
+	SetAttachmentPlaceholderSize(1024)
+	require.Equal(t, int64(1024), getAttachmentPlaceholderSize())
+}
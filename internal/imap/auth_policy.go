@@ -0,0 +1,149 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"github.com/ProtonMail/proton-bridge/pkg/authpolicy"
+	"github.com/emersion/go-imap"
+	imapserver "github.com/emersion/go-imap/server"
+)
+
+// privacyRequired is the response code (RFC 5530) telling the client that
+// the operation requires encrypted connection.
+const privacyRequired imap.StatusRespCode = "PRIVACYREQUIRED"
+
+// unavailable is the response code (RFC 5530) telling the client that the
+// operation can be retried later.
+const unavailable imap.StatusRespCode = "UNAVAILABLE"
+
+// authPolicyExtension overrides LOGIN and AUTHENTICATE commands to enforce
+// the authentication policy. go-imap always offers PLAIN mechanism and
+// returns only generic error when authentication is disabled, so the
+// policy is checked here before the built-in handlers are called.
+// Authenticated sessions are counted against the connection limits.
+type authPolicyExtension struct {
+	policy authpolicy.Policy
+}
+
+func newAuthPolicyExtension(policy authpolicy.Policy) *authPolicyExtension {
+	return &authPolicyExtension{policy: policy}
+}
+
+func (ext *authPolicyExtension) Capabilities(c imapserver.Conn) []string {
+	return nil
+}
+
+func (ext *authPolicyExtension) Command(name string) imapserver.HandlerFactory {
+	switch name {
+	case "LOGIN":
+		return func() imapserver.Handler {
+			return &policyLogin{policy: ext.policy}
+		}
+	case "AUTHENTICATE":
+		return func() imapserver.Handler {
+			return &policyAuthenticate{policy: ext.policy}
+		}
+	}
+	return nil
+}
+
+// checkAuthPolicy returns error for client which cannot authenticate by
+// the mechanism on the connection. Empty mechanism means LOGIN command.
+func checkAuthPolicy(policy authpolicy.Policy, conn imapserver.Conn, mechanism string) error {
+	if conn.Context().State != imap.NotAuthenticatedState {
+		// Built-in handler returns the proper error.
+		return nil
+	}
+
+	if policy.Limiter.IsBlocked(conn.Info().RemoteAddr) {
+		return imapserver.ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespNo,
+			Code: unavailable,
+			Info: authpolicy.TooManyFailuresMessage,
+		})
+	}
+
+	if policy.RequireTLS && !conn.IsTLS() {
+		return imapserver.ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespNo,
+			Code: privacyRequired,
+			Info: authpolicy.TLSRequiredMessage,
+		})
+	}
+
+	allowed := policy.IsAllowed(mechanism)
+	if mechanism == "" {
+		mechanism = authpolicy.Login
+		allowed = policy.IsPasswordAllowed()
+	}
+
+	if !allowed {
+		return imapserver.ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespNo,
+			Info: policy.MechanismDisabledMessage(mechanism),
+		})
+	}
+
+	return nil
+}
+
+// limitAuth records the result of authentication for the limiter of the
+// policy and returns the err unchanged. Built-in handlers return OK status
+// with capabilities as error, so the result is taken from the state.
+func limitAuth(policy authpolicy.Policy, conn imapserver.Conn, err error) error {
+	if conn.Context().State != imap.AuthenticatedState {
+		policy.Limiter.AddFailure(conn.Info().RemoteAddr)
+	} else {
+		policy.Limiter.AddSuccess(conn.Info().RemoteAddr)
+	}
+	return err
+}
+
+type policyLogin struct {
+	imapserver.Login
+
+	policy authpolicy.Policy
+}
+
+func (cmd *policyLogin) Handle(conn imapserver.Conn) error {
+	if err := checkAuthPolicy(cmd.policy, conn, ""); err != nil {
+		return err
+	}
+	err := limitAuth(cmd.policy, conn, cmd.Login.Handle(conn))
+	if limitErr := registerConnection(conn); limitErr != nil {
+		return limitErr
+	}
+	return err
+}
+
+type policyAuthenticate struct {
+	imapserver.Authenticate
+
+	policy authpolicy.Policy
+}
+
+func (cmd *policyAuthenticate) Handle(conn imapserver.Conn) error {
+	if err := checkAuthPolicy(cmd.policy, conn, cmd.Mechanism); err != nil {
+		return err
+	}
+	err := limitAuth(cmd.policy, conn, cmd.Authenticate.Handle(conn))
+	if limitErr := registerConnection(conn); limitErr != nil {
+		return limitErr
+	}
+	return err
+}
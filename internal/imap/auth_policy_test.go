@@ -0,0 +1,88 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"net"
+	"net/textproto"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/authpolicy"
+	"github.com/emersion/go-imap/backend/memory"
+	imapserver "github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAuthPolicyServer(t *testing.T, policy authpolicy.Policy) (*textproto.Conn, func()) {
+	s := imapserver.New(memory.New())
+	s.AllowInsecureAuth = !policy.RequireTLS
+	s.Enable(newAuthPolicyExtension(policy))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = s.Serve(l) }()
+
+	conn, err := textproto.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.ReadLine()
+	require.NoError(t, err)
+
+	return conn, func() {
+		_ = conn.Close()
+		_ = s.Close()
+	}
+}
+
+func authPolicyCmd(t *testing.T, conn *textproto.Conn, line string) string {
+	require.NoError(t, conn.PrintfLine("%s", line))
+	response, err := conn.ReadLine()
+	require.NoError(t, err)
+	return response
+}
+
+func TestAuthPolicyRequiresTLS(t *testing.T) {
+	conn, clear := newTestAuthPolicyServer(t, authpolicy.Policy{RequireTLS: true})
+	defer clear()
+
+	response := authPolicyCmd(t, conn, "a LOGIN username password")
+	require.Contains(t, response, "a NO [PRIVACYREQUIRED]")
+	require.Contains(t, response, "STARTTLS")
+
+	response = authPolicyCmd(t, conn, "b AUTHENTICATE PLAIN AHVzZXJuYW1lAHBhc3N3b3Jk")
+	require.Contains(t, response, "b NO [PRIVACYREQUIRED]")
+}
+
+func TestAuthPolicyDisabledMechanism(t *testing.T) {
+	conn, clear := newTestAuthPolicyServer(t, authpolicy.Policy{Mechanisms: []string{authpolicy.XOAuth2}})
+	defer clear()
+
+	response := authPolicyCmd(t, conn, "a LOGIN username password")
+	require.Contains(t, response, "a NO Authentication mechanism LOGIN is disabled")
+	require.Contains(t, response, "XOAUTH2")
+
+	response = authPolicyCmd(t, conn, "b AUTHENTICATE PLAIN AHVzZXJuYW1lAHBhc3N3b3Jk")
+	require.Contains(t, response, "b NO Authentication mechanism PLAIN is disabled")
+}
+
+func TestAuthPolicyAllowedMechanism(t *testing.T) {
+	conn, clear := newTestAuthPolicyServer(t, authpolicy.Policy{Mechanisms: []string{authpolicy.Plain}})
+	defer clear()
+
+	response := authPolicyCmd(t, conn, "a AUTHENTICATE PLAIN AHVzZXJuYW1lAHBhc3N3b3Jk")
+	require.Contains(t, response, "a OK")
+}
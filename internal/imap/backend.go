@@ -65,7 +65,8 @@ func NewIMAPBackend(
 
 	// We want idle updates coming from bridge's updates channel (which in turn come
 	// from the bridge users' stores) to be sent to the imap backend's update channel.
-	backend.updates = bridge.GetIMAPUpdatesChannel()
+	// Names of mailboxes are translated by the mailbox mapping on the way.
+	go backend.mapUpdates(bridge.GetIMAPUpdatesChannel())
 
 	go backend.monitorDisconnectedUsers()
 
@@ -152,18 +153,35 @@ func (ib *imapBackend) deleteUser(address string) {
 }
 
 // Login authenticates a user.
-func (ib *imapBackend) Login(_ *imap.ConnInfo, username, password string) (goIMAPBackend.User, error) {
+func (ib *imapBackend) Login(info *imap.ConnInfo, username, password string) (goIMAPBackend.User, error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer ib.panicHandler.HandlePanic()
 
+	return ib.login(info, username, func(user bridgeUser) error {
+		return user.CheckBridgeLogin(password)
+	})
+}
+
+// loginWithToken authenticates a user by access token sent by XOAUTH2 or
+// OAUTHBEARER.
+func (ib *imapBackend) loginWithToken(info *imap.ConnInfo, username, token string) (goIMAPBackend.User, error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer ib.panicHandler.HandlePanic()
+
+	return ib.login(info, username, func(user bridgeUser) error {
+		return user.CheckBridgeAccessToken(token)
+	})
+}
+
+func (ib *imapBackend) login(info *imap.ConnInfo, username string, checkCredentials func(bridgeUser) error) (goIMAPBackend.User, error) {
 	imapUser, err := ib.getUser(username)
 	if err != nil {
 		log.WithError(err).Warn("Cannot get user")
 		return nil, err
 	}
 
-	if err := imapUser.user.CheckBridgeLogin(password); err != nil {
-		log.WithError(err).Error("Could not check bridge password")
+	if err := checkCredentials(imapUser.user); err != nil {
+		log.WithError(err).Error("Could not check bridge credentials")
 		_ = imapUser.Logout()
 		// Apple Mail sometimes generates a lot of requests very quickly.
 		// It's therefore good to have a timeout after a bad login so that we can slow
@@ -172,6 +190,12 @@ func (ib *imapBackend) Login(_ *imap.ConnInfo, username, password string) (goIMA
 		return nil, err
 	}
 
+	if err := ib.checkAccountPort(info, imapUser.user.ID()); err != nil {
+		log.WithError(err).Warn("Login refused")
+		_ = imapUser.Logout()
+		return nil, err
+	}
+
 	// The update channel should be nil until we try to login to IMAP for the first time
 	// so that it doesn't make bridge slow for users who are only using bridge for SMTP
 	// (otherwise the store will be locked for 1 sec per email during synchronization).
@@ -0,0 +1,100 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	goIMAPBackend "github.com/emersion/go-imap/backend"
+)
+
+// mappedUpdate is the update with mailbox name translated by the mapping.
+type mappedUpdate struct {
+	goIMAPBackend.Update
+
+	mailbox string
+}
+
+func (u *mappedUpdate) Mailbox() string {
+	return u.mailbox
+}
+
+// mapUpdates passes updates from stores to go-imap. Stores use their own
+// names of mailboxes which have to be translated to names the clients of
+// the account know. Only the mapping built by the client is used because
+// the store can be locked while it sends the update. Every update is sent
+// only once so it is safe to change it.
+func (ib *imapBackend) mapUpdates(updates <-chan goIMAPBackend.Update) {
+	defer ib.panicHandler.HandlePanic()
+
+	for update := range updates {
+		if update, ok := ib.mapUpdate(update); ok {
+			ib.updates <- update
+		}
+	}
+}
+
+// mapUpdate returns the translated update or false when the update is
+// about mailbox which is not listed for the client.
+func (ib *imapBackend) mapUpdate(update goIMAPBackend.Update) (goIMAPBackend.Update, bool) {
+	ib.usersLocker.Lock()
+	user, ok := ib.users[strings.ToLower(update.Username())]
+	ib.usersLocker.Unlock()
+	if !ok {
+		return update, true
+	}
+
+	mapping := user.getMailboxMapping()
+	if mapping == nil || mapping.mode == store.MailboxMappingFolders {
+		return update, true
+	}
+
+	if infoUpdate, ok := update.(*goIMAPBackend.MailboxInfoUpdate); ok {
+		name, ok := mapping.imapName(infoUpdate.MailboxInfo.Name)
+		if !ok {
+			return nil, false
+		}
+		infoUpdate.MailboxInfo.Name = name
+		return infoUpdate, true
+	}
+
+	if update.Mailbox() == "" {
+		return update, true
+	}
+
+	name, ok := mapping.imapName(update.Mailbox())
+	if !ok {
+		return nil, false
+	}
+	mapped := &mappedUpdate{Update: update, mailbox: name}
+
+	switch update := update.(type) {
+	case *goIMAPBackend.MailboxUpdate:
+		update.MailboxStatus.Name = name
+		return &goIMAPBackend.MailboxUpdate{Update: mapped, MailboxStatus: update.MailboxStatus}, true
+	case *goIMAPBackend.MessageUpdate:
+		return &goIMAPBackend.MessageUpdate{Update: mapped, Message: update.Message}, true
+	case *goIMAPBackend.ExpungeUpdate:
+		return &goIMAPBackend.ExpungeUpdate{Update: mapped, SeqNum: update.SeqNum}, true
+	case *goIMAPBackend.StatusUpdate:
+		return &goIMAPBackend.StatusUpdate{Update: mapped, StatusResp: update.StatusResp}, true
+	}
+
+	return update, true
+}
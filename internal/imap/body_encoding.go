@@ -0,0 +1,46 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+)
+
+var (
+	bodyEncoding     = message.QuotedPrintable //nolint[gochecknoglobals]
+	bodyEncodingLock sync.RWMutex              //nolint[gochecknoglobals]
+)
+
+// SetBodyEncoding sets the transfer encoding of text bodies of built
+// messages. With 8bit, bodies which cannot be sent as 8bit are still encoded
+// as quoted-printable. Messages built before the change are not rebuilt.
+func SetBodyEncoding(enc message.BodyEncoding) {
+	bodyEncodingLock.Lock()
+	defer bodyEncodingLock.Unlock()
+
+	bodyEncoding = enc
+}
+
+func getBodyEncoding() message.BodyEncoding {
+	bodyEncodingLock.RLock()
+	defer bodyEncodingLock.RUnlock()
+
+	return bodyEncoding
+}
@@ -32,11 +32,14 @@ type configProvider interface {
 type bridger interface {
 	SetCurrentClient(clientName, clientVersion string)
 	GetUser(query string) (bridgeUser, error)
+	GetAccountPortsUserID(port int) (string, bool)
+	GetAPIStatus() pmapi.APIStatus
 }
 
 type bridgeUser interface {
 	ID() string
 	CheckBridgeLogin(password string) error
+	CheckBridgeAccessToken(token string) error
 	IsCombinedAddressMode() bool
 	GetAddressID(address string) (string, error)
 	GetPrimaryAddress() string
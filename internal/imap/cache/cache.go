@@ -76,6 +76,8 @@ func timestamp() int64 {
 }
 
 func Clear() {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
 	mailCache = make(map[string]cachedMessage)
 }
 
@@ -0,0 +1,189 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package compress implements COMPRESS extension (RFC 4978) with DEFLATE
+// mechanism.
+package compress
+
+import (
+	"compress/flate"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/server"
+)
+
+// Capability extension identifier.
+const Capability = "COMPRESS=DEFLATE"
+
+// Deflate is the only supported compression mechanism.
+const Deflate = "DEFLATE"
+
+// compressionActive is the response code of COMPRESS sent again.
+const compressionActive imap.StatusRespCode = "COMPRESSIONACTIVE"
+
+// Compress is the COMPRESS command.
+type Compress struct {
+	Mechanism string
+
+	ext *extension
+}
+
+func (cmd *Compress) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "COMPRESS",
+		Arguments: []interface{}{imap.RawString(cmd.Mechanism)},
+	}
+}
+
+func (cmd *Compress) Parse(fields []interface{}) (err error) {
+	if len(fields) != 1 {
+		return errors.New("expected compression mechanism")
+	}
+	if cmd.Mechanism, err = imap.ParseString(fields[0]); err != nil {
+		return err
+	}
+	cmd.Mechanism = strings.ToUpper(cmd.Mechanism)
+	return nil
+}
+
+func (cmd *Compress) Handle(conn server.Conn) error {
+	if conn.Context().State&imap.AuthenticatedState == 0 {
+		return server.ErrNotAuthenticated
+	}
+	if cmd.Mechanism != Deflate {
+		return errors.New("unsupported compression mechanism")
+	}
+	if cmd.ext.isActive(conn) {
+		return server.ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespNo,
+			Code: compressionActive,
+			Info: "Compression is already active",
+		})
+	}
+	return nil
+}
+
+// Upgrade starts compression right after the OK response was sent.
+func (cmd *Compress) Upgrade(conn server.Conn) error {
+	err := conn.Upgrade(func(sock net.Conn) (net.Conn, error) {
+		conn.WaitReady()
+		return newDeflateConn(sock)
+	})
+	if err != nil {
+		return err
+	}
+
+	cmd.ext.setActive(conn)
+	return nil
+}
+
+type extension struct {
+	lock   sync.Mutex
+	active map[*server.Context]bool
+}
+
+// NewExtension of COMPRESS.
+func NewExtension() server.Extension {
+	return &extension{
+		active: make(map[*server.Context]bool),
+	}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 && !ext.isActive(c) {
+		return []string{Capability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	if name == "COMPRESS" {
+		return func() server.Handler {
+			return &Compress{ext: ext}
+		}
+	}
+	return nil
+}
+
+func (ext *extension) isActive(conn server.Conn) bool {
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+
+	return ext.active[conn.Context()]
+}
+
+// setActive remembers compressed connection until the client logs out.
+func (ext *extension) setActive(conn server.Conn) {
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+
+	ctx := conn.Context()
+	ext.active[ctx] = true
+
+	go func() {
+		<-ctx.LoggedOut
+
+		ext.lock.Lock()
+		defer ext.lock.Unlock()
+
+		delete(ext.active, ctx)
+	}()
+}
+
+// deflateConn compresses both directions by raw DEFLATE (RFC 1951).
+// Every write is flushed so responses are not delayed.
+type deflateConn struct {
+	net.Conn
+
+	r io.ReadCloser
+	w *flate.Writer
+}
+
+func newDeflateConn(conn net.Conn) (net.Conn, error) {
+	w, err := flate.NewWriter(conn, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	return &deflateConn{
+		Conn: conn,
+		r:    flate.NewReader(conn),
+		w:    w,
+	}, nil
+}
+
+func (c *deflateConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *deflateConn) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, c.w.Flush()
+}
+
+func (c *deflateConn) Close() error {
+	_ = c.r.Close()
+	return c.Conn.Close()
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package compress
+
+import (
+	"bufio"
+	"compress/flate"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) (net.Conn, *textproto.Reader, func()) {
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.Enable(NewExtension())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = s.Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+
+	r := textproto.NewReader(bufio.NewReader(conn))
+	_, err = r.ReadLine()
+	require.NoError(t, err)
+
+	return conn, r, func() {
+		_ = conn.Close()
+		_ = s.Close()
+	}
+}
+
+func command(t *testing.T, w interface{ Write([]byte) (int, error) }, r *textproto.Reader, line string) []string {
+	_, err := w.Write([]byte(line + "\r\n"))
+	require.NoError(t, err)
+
+	tag := strings.Fields(line)[0]
+	lines := []string{}
+	for {
+		response, err := r.ReadLine()
+		require.NoError(t, err)
+		lines = append(lines, response)
+		if strings.HasPrefix(response, tag+" ") {
+			return lines
+		}
+	}
+}
+
+func TestCompressRequiresAuthentication(t *testing.T) {
+	conn, r, clear := newTestServer(t)
+	defer clear()
+
+	lines := command(t, conn, r, "a1 CAPABILITY")
+	require.NotContains(t, lines[0], Capability)
+
+	lines = command(t, conn, r, "a2 COMPRESS DEFLATE")
+	require.True(t, strings.HasPrefix(lines[0], "a2 NO"), lines)
+}
+
+func TestCompressDeflate(t *testing.T) {
+	conn, r, clear := newTestServer(t)
+	defer clear()
+
+	command(t, conn, r, "a1 LOGIN username password")
+
+	lines := command(t, conn, r, "a2 CAPABILITY")
+	require.Contains(t, lines[0], Capability)
+
+	lines = command(t, conn, r, "a3 COMPRESS GZIP")
+	require.True(t, strings.HasPrefix(lines[0], "a3 NO"), lines)
+
+	lines = command(t, conn, r, "a4 COMPRESS DEFLATE")
+	require.True(t, strings.HasPrefix(lines[0], "a4 OK"), lines)
+
+	w, err := flate.NewWriter(conn, flate.DefaultCompression)
+	require.NoError(t, err)
+	cw := &flushWriter{w}
+	cr := textproto.NewReader(bufio.NewReader(flate.NewReader(conn)))
+
+	lines = command(t, cw, cr, "a5 SELECT INBOX")
+	require.True(t, strings.HasPrefix(lines[len(lines)-1], "a5 OK"), lines)
+
+	lines = command(t, cw, cr, "a6 CAPABILITY")
+	require.NotContains(t, lines[0], Capability)
+
+	lines = command(t, cw, cr, "a7 COMPRESS DEFLATE")
+	require.Equal(t, "a7 NO [COMPRESSIONACTIVE] Compression is already active", lines[0])
+}
+
+type flushWriter struct {
+	w *flate.Writer
+}
+
+func (w *flushWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, w.w.Flush()
+}
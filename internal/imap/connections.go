@@ -0,0 +1,85 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"github.com/ProtonMail/proton-bridge/pkg/connlimit"
+	"github.com/emersion/go-imap"
+	goIMAPBackend "github.com/emersion/go-imap/backend"
+	imapserver "github.com/emersion/go-imap/server"
+)
+
+// limit is the response code (RFC 5530) telling the client that it
+// reached a limit of the server.
+const limit imap.StatusRespCode = "LIMIT"
+
+// connections counts authenticated IMAP sessions of accounts.
+var connections = connlimit.NewTracker() //nolint[gochecknoglobals]
+
+// SetConnectionLimits sets how many IMAP sessions an account can have open
+// and after how long idle connections are closed. Clients in IDLE renew it
+// within 29 minutes (RFC 2177), so shorter timeouts disconnect them.
+func SetConnectionLimits(limits connlimit.Limits) {
+	connections.SetLimits(limits)
+}
+
+// ConnectionCounts returns the number of open IMAP sessions per account ID.
+func ConnectionCounts() map[string]int {
+	return connections.Counts()
+}
+
+// registerConnection counts the session which has just authenticated.
+// When the account has too many sessions, the session is logged out and
+// the client gets NO response with LIMIT code.
+func registerConnection(conn imapserver.Conn) error {
+	ctx := conn.Context()
+	if ctx.State != imap.AuthenticatedState || ctx.User == nil {
+		return nil
+	}
+
+	release, err := connections.Acquire(getConnectionAccount(ctx.User))
+	if err != nil {
+		log.WithField("username", ctx.User.Username()).Warn("Too many IMAP connections")
+
+		_ = ctx.User.Logout()
+		ctx.User = nil
+		ctx.State = imap.NotAuthenticatedState
+
+		return imapserver.ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespNo,
+			Code: limit,
+			Info: connlimit.TooManyConnectionsMessage,
+		})
+	}
+
+	go func() {
+		<-ctx.LoggedOut
+		release()
+	}()
+
+	return nil
+}
+
+// getConnectionAccount returns ID of the bridge account so sessions of all
+// its addresses count against the same limit.
+func getConnectionAccount(user goIMAPBackend.User) string {
+	if iu, ok := user.(*imapUser); ok {
+		return iu.user.ID()
+	}
+	return user.Username()
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/authpolicy"
+	"github.com/ProtonMail/proton-bridge/pkg/connlimit"
+	"github.com/emersion/go-imap/backend/memory"
+	imapserver "github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionLimit(t *testing.T) {
+	SetConnectionLimits(connlimit.Limits{MaxPerAccount: 1})
+	defer SetConnectionLimits(connlimit.Limits{})
+
+	s := imapserver.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.Enable(newAuthPolicyExtension(authpolicy.Policy{}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = s.Serve(l) }()
+	defer s.Close() //nolint[errcheck]
+
+	dial := func() *textproto.Conn {
+		conn, err := textproto.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		_, err = conn.ReadLine()
+		require.NoError(t, err)
+		return conn
+	}
+
+	first := dial()
+	require.Contains(t, sessionQuotaCmd(t, first, "a", "LOGIN username password"), "a OK")
+	require.Equal(t, map[string]int{"username": 1}, ConnectionCounts())
+
+	second := dial()
+	defer second.Close() //nolint[errcheck]
+	require.Contains(t, sessionQuotaCmd(t, second, "a", "LOGIN username password"), "a NO [LIMIT]")
+	require.Contains(t, sessionQuotaCmd(t, second, "b", "SELECT INBOX"), "b NO")
+
+	require.NoError(t, first.Close())
+	require.Eventually(t, func() bool { return len(ConnectionCounts()) == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	require.Contains(t, sessionQuotaCmd(t, second, "c", "LOGIN username password"), "c OK")
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+var (
+	decryptionPlaceholder     = message.PlaceholderAttachment //nolint[gochecknoglobals]
+	decryptionPlaceholderLock sync.RWMutex                    //nolint[gochecknoglobals]
+)
+
+// SetDecryptionPlaceholder sets how messages which cannot be decrypted are
+// shown. Such messages are not cached, so the change applies to the next
+// FETCH of the message.
+func SetDecryptionPlaceholder(mode message.PlaceholderMode) {
+	decryptionPlaceholderLock.Lock()
+	defer decryptionPlaceholderLock.Unlock()
+
+	decryptionPlaceholder = mode
+}
+
+func getDecryptionPlaceholder() message.PlaceholderMode {
+	decryptionPlaceholderLock.RLock()
+	defer decryptionPlaceholderLock.RUnlock()
+
+	return decryptionPlaceholder
+}
+
+// buildPlaceholder returns the message with original headers, explanation
+// of the error and the encrypted body as an attachment.
+func buildPlaceholder(m *pmapi.Message, errDecrypt error) (*message.BodyStructure, []byte, error) {
+	body, err := message.BuildPlaceholder(m, errDecrypt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	structure, err := message.NewBodyStructure(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return structure, body, nil
+}
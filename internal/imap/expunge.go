@@ -0,0 +1,98 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"sync"
+
+	"github.com/emersion/go-imap"
+)
+
+var (
+	deferredExpunge     bool         //nolint[gochecknoglobals]
+	deferredExpungeLock sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetDeferredExpunge sets whether messages flagged as \Deleted are kept
+// until they are expunged by EXPUNGE or UID EXPUNGE. Otherwise they are
+// deleted right away when flagged.
+func SetDeferredExpunge(enabled bool) {
+	deferredExpungeLock.Lock()
+	defer deferredExpungeLock.Unlock()
+
+	deferredExpunge = enabled
+}
+
+func isDeferredExpunge() bool {
+	deferredExpungeLock.RLock()
+	defer deferredExpungeLock.RUnlock()
+
+	return deferredExpunge
+}
+
+// markMessagesDeleted adds or removes the \Deleted flag. Messages are
+// deleted right away unless the expunge is deferred.
+func (im *imapMailbox) markMessagesDeleted(messageIDs []string, deleted bool) error {
+	switch {
+	case isDeferredExpunge() && deleted:
+		return im.storeMailbox.MarkMessagesDeleted(messageIDs)
+	case isDeferredExpunge():
+		return im.storeMailbox.MarkMessagesUndeleted(messageIDs)
+	case deleted:
+		return im.storeMailbox.DeleteMessages(messageIDs)
+	default:
+		return nil // Nothing to do, no message has the \Deleted flag.
+	}
+}
+
+// Expunge permanently removes all messages that have the \Deleted flag set
+// from the currently selected mailbox. Unless the expunge is deferred,
+// messages are already deleted and there is nothing to do.
+func (im *imapMailbox) Expunge() (err error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+	defer im.checkAPIAvailability(&err)
+	defer im.startTrace("EXPUNGE", false)(&err)
+
+	if err := im.user.checkWritable(); err != nil {
+		return err
+	}
+
+	return im.storeMailbox.ExpungeMessages(nil)
+}
+
+// UIDExpunge permanently removes only those messages with the \Deleted flag
+// which are in the UID set (RFC 4315). Other messages flagged as \Deleted
+// are kept.
+func (im *imapMailbox) UIDExpunge(seqSet *imap.SeqSet) (err error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+	defer im.checkAPIAvailability(&err)
+	defer im.startTrace("EXPUNGE", true)(&err)
+
+	if err := im.user.checkWritable(); err != nil {
+		return err
+	}
+
+	messageIDs, err := im.apiIDsFromSeqSet(true, seqSet)
+	if err != nil || len(messageIDs) == 0 {
+		return err
+	}
+
+	return im.storeMailbox.ExpungeMessages(messageIDs)
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package fetch pipelines FETCH of message ranges. Messages are downloaded
+// by one pool of workers and built by another one, so building of already
+// downloaded messages overlaps with downloading of the next ones.
+package fetch
+
+import "sync"
+
+// Options configures the pipeline.
+type Options struct {
+	// DownloadWorkers is the number of messages downloaded in parallel.
+	DownloadWorkers int
+	// BuildWorkers is the number of messages built in parallel.
+	BuildWorkers int
+	// Window is the maximum number of messages in the pipeline, i.e. being
+	// downloaded, built or waiting to be collected in order. It bounds
+	// the memory used by prefetched messages.
+	Window int
+}
+
+// DefaultOptions are used unless changed by SetOptions.
+var DefaultOptions = Options{ //nolint[gochecknoglobals]
+	DownloadWorkers: 5,
+	BuildWorkers:    3,
+	Window:          20,
+}
+
+var (
+	options       = DefaultOptions //nolint[gochecknoglobals]
+	optionsLocker sync.RWMutex     //nolint[gochecknoglobals]
+)
+
+// SetOptions changes the options used by IMAP FETCH.
+func SetOptions(opts Options) {
+	optionsLocker.Lock()
+	defer optionsLocker.Unlock()
+
+	options = opts.normalize()
+}
+
+// GetOptions returns the options used by IMAP FETCH.
+func GetOptions() Options {
+	optionsLocker.RLock()
+	defer optionsLocker.RUnlock()
+
+	return options
+}
+
+func (opts Options) normalize() Options {
+	if opts.DownloadWorkers < 1 {
+		opts.DownloadWorkers = 1
+	}
+	if opts.BuildWorkers < 1 {
+		opts.BuildWorkers = 1
+	}
+	// Smaller window than workers would leave some of them idle.
+	if opts.Window < opts.DownloadWorkers+opts.BuildWorkers {
+		opts.Window = opts.DownloadWorkers + opts.BuildWorkers
+	}
+	return opts
+}
+
+// Stage processes one item of the pipeline.
+type Stage func(value interface{}) (interface{}, error)
+
+type job struct {
+	idx   int
+	value interface{}
+}
+
+// Run passes every input through the download and build stages and
+// passes the results to collect in the same order as the input. If any
+// stage or collect fails, the pipeline is stopped and the first error is
+// returned. Run blocks until everything is done.
+func Run(opts Options, input []interface{}, download, build Stage, collect func(int, interface{}) error) error {
+	if len(input) == 0 {
+		return nil
+	}
+
+	opts = opts.normalize()
+
+	var (
+		resultErr error
+		errOnce   sync.Once
+		done      = make(chan struct{})
+	)
+
+	fail := func(err error) {
+		errOnce.Do(func() {
+			resultErr = err
+			close(done)
+		})
+	}
+
+	window := make(chan struct{}, opts.Window)
+	downloadIn := make(chan job)
+
+	go func() {
+		defer close(downloadIn)
+		for idx, value := range input {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case downloadIn <- job{idx, value}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	buildIn := runStage(opts.DownloadWorkers, downloadIn, download, fail, done)
+	buildOut := runStage(opts.BuildWorkers, buildIn, build, fail, done)
+
+	pending := map[int]interface{}{}
+	next := 0
+	for j := range buildOut {
+		if isDone(done) {
+			continue
+		}
+
+		pending[j.idx] = j.value
+		for value, ok := pending[next]; ok; value, ok = pending[next] {
+			delete(pending, next)
+			if err := collect(next, value); err != nil {
+				fail(err)
+				break
+			}
+			next++
+			<-window
+		}
+	}
+
+	return resultErr
+}
+
+// runStage starts workers processing jobs from in and returns the channel
+// with results which is closed once all workers are finished. After the
+// pipeline is stopped, workers only drain the input.
+func runStage(workers int, in <-chan job, process Stage, fail func(error), done <-chan struct{}) <-chan job {
+	out := make(chan job)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range in {
+				if isDone(done) {
+					continue
+				}
+
+				value, err := process(j.value)
+				if err != nil {
+					fail(err)
+					continue
+				}
+
+				select {
+				case out <- job{j.idx, value}:
+				case <-done:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+func isDone(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package fetch
+
+import (
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newInput(n int) []interface{} {
+	input := make([]interface{}, n)
+	for i := range input {
+		input[i] = i
+	}
+	return input
+}
+
+func randomDelay(value interface{}) (interface{}, error) {
+	time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond) //nolint[gosec]
+	return value, nil
+}
+
+func TestRunKeepsOrder(t *testing.T) {
+	opts := Options{DownloadWorkers: 4, BuildWorkers: 2, Window: 8}
+
+	collected := []int{}
+	err := Run(opts, newInput(100), randomDelay, randomDelay, func(idx int, value interface{}) error {
+		require.Equal(t, idx, value)
+		collected = append(collected, value.(int))
+		return nil
+	})
+	require.NoError(t, err)
+
+	for i, value := range collected {
+		require.Equal(t, i, value)
+	}
+	require.Len(t, collected, 100)
+}
+
+func TestRunBoundsWindow(t *testing.T) {
+	opts := Options{DownloadWorkers: 2, BuildWorkers: 2, Window: 6}
+
+	var inPipeline, maxInPipeline int32
+	download := func(value interface{}) (interface{}, error) {
+		current := atomic.AddInt32(&inPipeline, 1)
+		for {
+			max := atomic.LoadInt32(&maxInPipeline)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInPipeline, max, current) {
+				break
+			}
+		}
+		return randomDelay(value)
+	}
+
+	err := Run(opts, newInput(50), download, randomDelay, func(idx int, value interface{}) error {
+		atomic.AddInt32(&inPipeline, -1)
+		return nil
+	})
+	require.NoError(t, err)
+	require.LessOrEqual(t, int(maxInPipeline), opts.Window)
+}
+
+func TestRunStopsOnError(t *testing.T) {
+	opts := Options{DownloadWorkers: 3, BuildWorkers: 3, Window: 6}
+	testErr := errors.New("build failed")
+
+	var built int32
+	build := func(value interface{}) (interface{}, error) {
+		atomic.AddInt32(&built, 1)
+		if value.(int) == 10 {
+			return nil, testErr
+		}
+		return value, nil
+	}
+
+	err := Run(opts, newInput(1000), randomDelay, build, func(idx int, value interface{}) error {
+		return nil
+	})
+	require.Equal(t, testErr, err)
+	require.Less(t, int(built), 1000)
+}
+
+func TestRunCollectError(t *testing.T) {
+	testErr := errors.New("collect failed")
+
+	err := Run(DefaultOptions, newInput(100), randomDelay, randomDelay, func(idx int, value interface{}) error {
+		if idx == 5 {
+			return testErr
+		}
+		return nil
+	})
+	require.Equal(t, testErr, err)
+}
+
+func TestRunEmptyInput(t *testing.T) {
+	err := Run(DefaultOptions, nil, nil, nil, nil)
+	require.NoError(t, err)
+}
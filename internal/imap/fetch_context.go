@@ -0,0 +1,127 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"context"
+	"sync"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+	imapserver "github.com/emersion/go-imap/server"
+)
+
+// contextMailbox is a mailbox which stops listing messages once the context
+// is done.
+type contextMailbox interface {
+	ListMessagesContext(ctx context.Context, isUID bool, seqSet *imap.SeqSet, items []imap.FetchItem, msgResponse chan<- *imap.Message) error
+}
+
+// fetchContexts keeps contexts of running FETCH commands so they can be
+// cancelled before the bridge closes the connection, e.g. on logout.
+// go-imap closes LoggedOut channel only after the command is finished.
+type fetchContexts struct {
+	lock    sync.Mutex
+	cancels map[*imapserver.Context]context.CancelFunc
+}
+
+func newFetchContexts() *fetchContexts {
+	return &fetchContexts{
+		cancels: make(map[*imapserver.Context]context.CancelFunc),
+	}
+}
+
+// start returns the context of FETCH of the connection. Finish must be
+// called when the command is done.
+func (fc *fetchContexts) start(conn imapserver.Conn) (ctx context.Context, finish func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	fc.lock.Lock()
+	fc.cancels[conn.Context()] = cancel
+	fc.lock.Unlock()
+
+	return ctx, func() {
+		fc.lock.Lock()
+		delete(fc.cancels, conn.Context())
+		fc.lock.Unlock()
+
+		cancel()
+	}
+}
+
+// cancel cancels running FETCH of the connection, if any.
+func (fc *fetchContexts) cancel(conn imapserver.Conn) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	if cancel, ok := fc.cancels[conn.Context()]; ok {
+		cancel()
+	}
+}
+
+// handleFetch does the same as FETCH of go-imap but messages are listed
+// with the context. It is also cancelled when the response cannot be
+// written, e.g. because the client disconnected, otherwise all requested
+// messages would be downloaded and built for nobody.
+func handleFetch(ctx context.Context, conn imapserver.Conn, cmd *imapserver.Fetch, isUID bool) error {
+	mailbox, ok := conn.Context().Mailbox.(contextMailbox)
+	if !ok {
+		if isUID {
+			return cmd.UidHandle(conn)
+		}
+		return cmd.Handle(conn)
+	}
+
+	if isUID {
+		cmd.Items = withUIDItem(cmd.Items)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan *imap.Message)
+	done := make(chan error, 1)
+	go func() {
+		err := conn.WriteResp(&responses.Fetch{Messages: ch})
+		if err != nil {
+			cancel()
+		}
+		done <- err
+		// Make sure to drain the message channel.
+		for range ch {
+		}
+	}()
+
+	// Listing closes the channel so the writer always finishes.
+	err := mailbox.ListMessagesContext(ctx, isUID, cmd.SeqSet, cmd.Items, ch)
+	if writeErr := <-done; writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+// withUIDItem appends UID to the FETCH items if it is not present, as
+// required for UID FETCH.
+func withUIDItem(items []imap.FetchItem) []imap.FetchItem {
+	for _, item := range items {
+		if item == imap.FetchUid {
+			return items
+		}
+	}
+	return append(items, imap.FetchUid)
+}
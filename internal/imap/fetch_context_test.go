@@ -0,0 +1,127 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	goIMAPBackend "github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	imapserver "github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingBackend serves mailboxes of the memory backend which list
+// messages only once the context is done.
+type blockingBackend struct {
+	goIMAPBackend.Backend
+
+	started chan struct{}
+	result  chan error
+}
+
+func (b *blockingBackend) Login(info *imap.ConnInfo, username, password string) (goIMAPBackend.User, error) {
+	user, err := b.Backend.Login(info, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &blockingUser{User: user, backend: b}, nil
+}
+
+type blockingUser struct {
+	goIMAPBackend.User
+
+	backend *blockingBackend
+}
+
+func (u *blockingUser) GetMailbox(name string) (goIMAPBackend.Mailbox, error) {
+	mailbox, err := u.User.GetMailbox(name)
+	if err != nil {
+		return nil, err
+	}
+	return &blockingMailbox{Mailbox: mailbox, backend: u.backend}, nil
+}
+
+type blockingMailbox struct {
+	goIMAPBackend.Mailbox
+
+	backend *blockingBackend
+}
+
+func (mb *blockingMailbox) ListMessagesContext(ctx context.Context, _ bool, _ *imap.SeqSet, _ []imap.FetchItem, msgResponse chan<- *imap.Message) error {
+	defer close(msgResponse)
+
+	close(mb.backend.started)
+	<-ctx.Done()
+	mb.backend.result <- ctx.Err()
+	return ctx.Err()
+}
+
+func TestFetchCancelledBeforeClose(t *testing.T) {
+	backend := &blockingBackend{
+		Backend: memory.New(),
+		started: make(chan struct{}),
+		result:  make(chan error, 1),
+	}
+	ext := newSessionQuotaExtension()
+
+	s := imapserver.New(backend)
+	s.AllowInsecureAuth = true
+	s.Enable(ext)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = s.Serve(l) }()
+	defer s.Close() //nolint[errcheck]
+
+	conn, err := textproto.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close() //nolint[errcheck]
+	_, err = conn.ReadLine()
+	require.NoError(t, err)
+
+	require.Contains(t, sessionQuotaCmd(t, conn, "a", "LOGIN username password"), "a OK")
+	require.Contains(t, sessionQuotaCmd(t, conn, "b", "SELECT INBOX"), "b OK")
+	require.NoError(t, conn.PrintfLine("c FETCH 1 BODY.PEEK[]"))
+
+	select {
+	case <-backend.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("FETCH was not started")
+	}
+
+	s.ForEachConn(ext.fetches.cancel)
+
+	select {
+	case err := <-backend.result:
+		require.Equal(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("FETCH was not cancelled")
+	}
+	require.Contains(t, readTagged(t, conn, "c"), "c NO")
+}
+
+func TestWithUIDItem(t *testing.T) {
+	require.Equal(t, []imap.FetchItem{imap.FetchFlags, imap.FetchUid}, withUIDItem([]imap.FetchItem{imap.FetchFlags}))
+	require.Equal(t, []imap.FetchItem{imap.FetchUid, imap.FetchFlags}, withUIDItem([]imap.FetchItem{imap.FetchUid, imap.FetchFlags}))
+}
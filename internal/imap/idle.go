@@ -0,0 +1,57 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	imapidle "github.com/emersion/go-imap-idle"
+	imapserver "github.com/emersion/go-imap/server"
+)
+
+// idleExtension is the IDLE extension which tells the store that a client
+// waits for push, so events of the account are polled often.
+type idleExtension struct {
+	imapserver.Extension
+}
+
+func newIdleExtension() *idleExtension {
+	return &idleExtension{Extension: imapidle.NewExtension()}
+}
+
+func (ext *idleExtension) Command(name string) imapserver.HandlerFactory {
+	newHandler := ext.Extension.Command(name)
+	if newHandler == nil {
+		return nil
+	}
+
+	return func() imapserver.Handler {
+		return &idleHandler{Handler: newHandler()}
+	}
+}
+
+type idleHandler struct {
+	imapserver.Handler
+}
+
+func (h *idleHandler) Handle(conn imapserver.Conn) error {
+	if user, ok := conn.Context().User.(*imapUser); ok {
+		user.storeUser.StartIdle()
+		defer user.storeUser.StopIdle()
+	}
+
+	return h.Handler.Handle(conn)
+}
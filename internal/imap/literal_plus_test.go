@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Clients use non-synchronizing literals (RFC 7888) to send APPEND without
+// waiting for continuation request.
+func TestAppendWithNonSynchronizingLiterals(t *testing.T) {
+	conn, clear := newTestSessionQuotaServer(t, SessionQuota{})
+	defer clear()
+
+	require.NoError(t, conn.PrintfLine("a CAPABILITY"))
+	capabilities, err := conn.ReadLine()
+	require.NoError(t, err)
+	require.Contains(t, capabilities, "LITERAL+")
+	require.Contains(t, readTagged(t, conn, "a"), "a OK")
+
+	require.Contains(t, sessionQuotaCmd(t, conn, "b", "LOGIN username password"), "b OK")
+
+	// Both messages are sent before reading any response.
+	body := "Subject: test\r\n\r\nbody"
+	require.NoError(t, conn.PrintfLine("c APPEND INBOX {%d+}\r\n%s", len(body), body))
+	require.NoError(t, conn.PrintfLine("d APPEND INBOX (\\Seen) {%d+}\r\n%s", len(body), body))
+
+	for _, tag := range []string{"c", "d"} {
+		for {
+			response, err := conn.ReadLine()
+			require.NoError(t, err)
+			require.False(t, strings.HasPrefix(response, "+"), "unexpected continuation request")
+			if strings.HasPrefix(response, tag+" ") {
+				require.Contains(t, response, tag+" OK")
+				break
+			}
+		}
+	}
+	require.Contains(t, sessionQuotaCmd(t, conn, "e", "STATUS INBOX (MESSAGES)"), "e OK")
+}
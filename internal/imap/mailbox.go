@@ -19,6 +19,7 @@ package imap
 
 import (
 	"strings"
+	"sync"
 
 	"github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
@@ -37,14 +38,24 @@ type imapMailbox struct {
 	storeUser    storeUserProvider
 	storeAddress storeAddressProvider
 	storeMailbox storeMailboxProvider
+
+	// prefetched holds messages downloaded ahead by FETCH pipeline
+	// until they are used by building.
+	prefetched     map[string]*pmapi.Message
+	prefetchedLock *sync.Mutex
+
+	// trace measures the command being processed when tracing is enabled.
+	trace     *commandTrace
+	traceLock *sync.Mutex
 }
 
 // newIMAPMailbox returns struct implementing go-imap/mailbox interface.
-func newIMAPMailbox(panicHandler panicHandler, user *imapUser, storeMailbox storeMailboxProvider) *imapMailbox {
+// The name is the IMAP name of the mailbox given by the mailbox mapping.
+func newIMAPMailbox(panicHandler panicHandler, user *imapUser, storeMailbox storeMailboxProvider, name string) *imapMailbox {
 	return &imapMailbox{
 		panicHandler: panicHandler,
 		user:         user,
-		name:         storeMailbox.Name(),
+		name:         name,
 
 		log: log.
 			WithField("addressID", user.storeAddress.AddressID()).
@@ -54,6 +65,11 @@ func newIMAPMailbox(panicHandler panicHandler, user *imapUser, storeMailbox stor
 		storeUser:    user.storeUser,
 		storeAddress: user.storeAddress,
 		storeMailbox: storeMailbox,
+
+		prefetched:     map[string]*pmapi.Message{},
+		prefetchedLock: &sync.Mutex{},
+
+		traceLock: &sync.Mutex{},
 	}
 }
 
@@ -80,23 +96,35 @@ func (im *imapMailbox) Info() (*imap.MailboxInfo, error) {
 }
 
 func (im *imapMailbox) getFlags() []string {
-	flags := []string{imap.NoInferiorsAttr} // Subfolders are not yet supported by API.
-	switch im.storeMailbox.LabelID() {
+	flags := []string{}
+	if !im.storeMailbox.IsFolder() {
+		flags = append(flags, imap.NoInferiorsAttr) // Only folders can be nested.
+	}
+	if attr := getSpecialUseAttribute(im.storeMailbox.LabelID()); attr != "" {
+		flags = append(flags, attr)
+	}
+
+	return flags
+}
+
+// getSpecialUseAttribute returns the special-use attribute of the system
+// label or empty string for other labels.
+func getSpecialUseAttribute(labelID string) string {
+	switch labelID {
 	case pmapi.SentLabel:
-		flags = append(flags, specialuse.Sent)
+		return specialuse.Sent
 	case pmapi.TrashLabel:
-		flags = append(flags, specialuse.Trash)
+		return specialuse.Trash
 	case pmapi.SpamLabel:
-		flags = append(flags, specialuse.Junk)
+		return specialuse.Junk
 	case pmapi.ArchiveLabel:
-		flags = append(flags, specialuse.Archive)
+		return specialuse.Archive
 	case pmapi.AllMailLabel:
-		flags = append(flags, specialuse.All)
+		return specialuse.All
 	case pmapi.DraftLabel:
-		flags = append(flags, specialuse.Drafts)
+		return specialuse.Drafts
 	}
-
-	return flags
+	return ""
 }
 
 // Status returns this mailbox status. The fields Name, Flags and
@@ -123,7 +151,10 @@ func (im *imapMailbox) Status(items []imap.StatusItem) (*imap.MailboxStatus, err
 		message.AppleMailJunkFlag,
 		message.ThunderbirdJunkFlag,
 		message.ThunderbirdNonJunkFlag,
+		message.NotJunkFlag,
+		message.MDNSentFlag,
 	}
+	status.PermanentFlags = append(status.PermanentFlags, im.user.mailboxMapping().allKeywords()...)
 
 	dbTotal, dbUnread, dbUnreadSeqNum, err := im.storeMailbox.GetCounts()
 	l.WithFields(logrus.Fields{
@@ -138,6 +169,10 @@ func (im *imapMailbox) Status(items []imap.StatusItem) (*imap.MailboxStatus, err
 		status.UnseenSeqNum = uint32(dbUnreadSeqNum)
 	}
 
+	if dbRecent, err := im.storeMailbox.GetRecentCount(); err == nil {
+		status.Recent = uint32(dbRecent)
+	}
+
 	if status.UidNext, err = im.storeMailbox.GetNextUID(); err != nil {
 		return nil, err
 	}
@@ -171,13 +206,6 @@ func (im *imapMailbox) Check() error {
 	return nil
 }
 
-// Expunge permanently removes all messages that have the \Deleted flag set
-// from the currently selected mailbox.
-// Our messages do not have \Deleted flag, nothing to do here.
-func (im *imapMailbox) Expunge() error {
-	return nil
-}
-
 func (im *imapMailbox) ListQuotas() ([]string, error) {
 	return []string{""}, nil
 }
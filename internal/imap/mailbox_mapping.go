@@ -0,0 +1,180 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/store"
+)
+
+// mailboxMapping translates names of store mailboxes to IMAP names and back
+// according to the mapping mode chosen for the account:
+//   - folders: names are used as they are, e.g. `Folders/Work` or `Labels/Todo`,
+//   - gmail: labels are not listed, they are keywords of messages instead,
+//   - flat: folders and labels are listed without prefix, e.g. `Work`. When
+//     the name without prefix is already taken, the full name is used.
+type mailboxMapping struct {
+	mode string
+
+	imapNames  map[string]string // Store name to IMAP name.
+	storeNames map[string]string // IMAP name to store name.
+
+	// Labels are keywords only in gmail mode.
+	labelKeywords map[string]string // Label ID to keyword.
+	keywordLabels map[string]string // Keyword to store name of label.
+}
+
+func newMailboxMapping(mode string, mailboxes []storeMailboxProvider) *mailboxMapping {
+	m := &mailboxMapping{
+		mode:          mode,
+		imapNames:     map[string]string{},
+		storeNames:    map[string]string{},
+		labelKeywords: map[string]string{},
+		keywordLabels: map[string]string{},
+	}
+
+	taken := map[string]bool{}
+	for _, mailbox := range mailboxes {
+		taken[mailbox.Name()] = true
+	}
+
+	for _, mailbox := range mailboxes {
+		name := mailbox.Name()
+
+		switch {
+		case mode == store.MailboxMappingGmail && isLabel(mailbox):
+			keyword := labelKeyword(name)
+			m.labelKeywords[mailbox.LabelID()] = keyword
+			m.keywordLabels[keyword] = mailbox.Name()
+			continue
+		case mode == store.MailboxMappingFlat && !mailbox.IsSystem():
+			if flatName := trimMailboxPrefix(name); !taken[flatName] {
+				taken[flatName] = true
+				name = flatName
+			}
+		}
+
+		m.imapNames[mailbox.Name()] = name
+		m.storeNames[name] = mailbox.Name()
+	}
+
+	return m
+}
+
+// isLabel returns whether the mailbox is a label (has "Labels/" prefix).
+func isLabel(mailbox storeMailboxProvider) bool {
+	return !mailbox.IsSystem() && !mailbox.IsFolder()
+}
+
+func trimMailboxPrefix(name string) string {
+	if strings.HasPrefix(name, store.UserFoldersPrefix) {
+		return strings.TrimPrefix(name, store.UserFoldersPrefix)
+	}
+	return strings.TrimPrefix(name, store.UserLabelsPrefix)
+}
+
+// labelKeyword returns the label name usable as IMAP keyword which cannot
+// contain spaces and special characters (RFC 3501 section 9, atom).
+func labelKeyword(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f || strings.ContainsRune(`(){%*"\]`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimPrefix(name, store.UserLabelsPrefix))
+}
+
+// imapName returns the IMAP name of the store mailbox and whether it is
+// listed at all. Mailboxes created after the mapping was built are mapped
+// by their prefix.
+func (m *mailboxMapping) imapName(storeName string) (string, bool) {
+	if name, ok := m.imapNames[storeName]; ok {
+		return name, true
+	}
+
+	switch m.mode {
+	case store.MailboxMappingGmail:
+		return storeName, !strings.HasPrefix(storeName, store.UserLabelsPrefix)
+	case store.MailboxMappingFlat:
+		if flatName := trimMailboxPrefix(storeName); m.storeNames[flatName] == "" {
+			return flatName, true
+		}
+	}
+
+	return storeName, true
+}
+
+// storeName returns the store name of the IMAP mailbox.
+func (m *mailboxMapping) storeName(imapName string) string {
+	if name, ok := m.storeNames[imapName]; ok {
+		return name
+	}
+	return imapName
+}
+
+// newStoreName returns the store name of a mailbox created or renamed by
+// client. In flat mode, names without prefix are folders by default or
+// keep the prefix of the renamed mailbox.
+func (m *mailboxMapping) newStoreName(imapName, prefix string) string {
+	if m.mode != store.MailboxMappingFlat ||
+		strings.HasPrefix(imapName, store.UserFoldersPrefix) ||
+		strings.HasPrefix(imapName, store.UserLabelsPrefix) {
+		return imapName
+	}
+	if prefix == "" {
+		prefix = store.UserFoldersPrefix
+	}
+	return prefix + imapName
+}
+
+// showFoldersRoot returns whether the `Folders` mailbox is listed.
+func (m *mailboxMapping) showFoldersRoot() bool {
+	return m.mode != store.MailboxMappingFlat
+}
+
+// showLabelsRoot returns whether the `Labels` mailbox is listed.
+func (m *mailboxMapping) showLabelsRoot() bool {
+	return m.mode == store.MailboxMappingFolders
+}
+
+// keywords returns keywords representing labels of the message.
+func (m *mailboxMapping) keywords(labelIDs []string) (keywords []string) {
+	for _, labelID := range labelIDs {
+		if keyword, ok := m.labelKeywords[labelID]; ok {
+			keywords = append(keywords, keyword)
+		}
+	}
+	return
+}
+
+// allKeywords returns keywords of all labels.
+func (m *mailboxMapping) allKeywords() (keywords []string) {
+	for keyword := range m.keywordLabels {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	return
+}
+
+// labelName returns the store name of the label represented by the keyword.
+func (m *mailboxMapping) labelName(keyword string) (string, bool) {
+	name, ok := m.keywordLabels[keyword]
+	return name, ok
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	goIMAPBackend "github.com/emersion/go-imap/backend"
+	"github.com/stretchr/testify/require"
+)
+
+type testMappingMailbox struct {
+	storeMailboxProvider
+
+	labelID, name    string
+	isSystem, folder bool
+}
+
+func (m *testMappingMailbox) LabelID() string { return m.labelID }
+func (m *testMappingMailbox) Name() string    { return m.name }
+func (m *testMappingMailbox) IsSystem() bool  { return m.isSystem }
+func (m *testMappingMailbox) IsFolder() bool  { return m.folder }
+
+func newTestMailboxMapping(mode string) *mailboxMapping {
+	return newMailboxMapping(mode, []storeMailboxProvider{
+		&testMappingMailbox{labelID: "0", name: "INBOX", isSystem: true},
+		&testMappingMailbox{labelID: "5", name: "All Mail", isSystem: true},
+		&testMappingMailbox{labelID: "work", name: "Folders/Work", folder: true},
+		&testMappingMailbox{labelID: "inbox", name: "Labels/INBOX"},
+		&testMappingMailbox{labelID: "todo", name: "Labels/To do"},
+	})
+}
+
+func TestMailboxMappingFolders(t *testing.T) {
+	m := newTestMailboxMapping(store.MailboxMappingFolders)
+
+	name, ok := m.imapName("Labels/To do")
+	require.True(t, ok)
+	require.Equal(t, "Labels/To do", name)
+	require.Equal(t, "Folders/Work", m.storeName("Folders/Work"))
+	require.Equal(t, "Work", m.newStoreName("Work", ""))
+	require.True(t, m.showFoldersRoot())
+	require.True(t, m.showLabelsRoot())
+	require.Empty(t, m.keywords([]string{"0", "todo"}))
+}
+
+func TestMailboxMappingGmail(t *testing.T) {
+	m := newTestMailboxMapping(store.MailboxMappingGmail)
+
+	_, ok := m.imapName("Labels/To do")
+	require.False(t, ok)
+	_, ok = m.imapName("Labels/New")
+	require.False(t, ok)
+	name, ok := m.imapName("Folders/Work")
+	require.True(t, ok)
+	require.Equal(t, "Folders/Work", name)
+
+	require.True(t, m.showFoldersRoot())
+	require.False(t, m.showLabelsRoot())
+
+	require.Equal(t, []string{"To_do"}, m.keywords([]string{"0", "todo"}))
+	require.Equal(t, []string{"INBOX", "To_do"}, m.allKeywords())
+	labelName, ok := m.labelName("To_do")
+	require.True(t, ok)
+	require.Equal(t, "Labels/To do", labelName)
+}
+
+func TestMailboxMappingFlat(t *testing.T) {
+	m := newTestMailboxMapping(store.MailboxMappingFlat)
+
+	name, ok := m.imapName("Folders/Work")
+	require.True(t, ok)
+	require.Equal(t, "Work", name)
+	require.Equal(t, "Folders/Work", m.storeName("Work"))
+
+	// Name without prefix is taken by system mailbox.
+	name, _ = m.imapName("Labels/INBOX")
+	require.Equal(t, "Labels/INBOX", name)
+	require.Equal(t, "INBOX", m.storeName("INBOX"))
+
+	// Mailbox created later is mapped by its prefix.
+	name, _ = m.imapName("Labels/New")
+	require.Equal(t, "New", name)
+
+	require.Equal(t, "Folders/Home", m.newStoreName("Home", ""))
+	require.Equal(t, "Labels/Later", m.newStoreName("Later", store.UserLabelsPrefix))
+	require.Equal(t, "Labels/Later", m.newStoreName("Labels/Later", store.UserFoldersPrefix))
+	require.False(t, m.showFoldersRoot())
+	require.False(t, m.showLabelsRoot())
+}
+
+func TestMapUpdate(t *testing.T) {
+	ib := &imapBackend{users: map[string]*imapUser{}, usersLocker: &fakeLocker{}}
+	user := &imapUser{mapping: newTestMailboxMapping(store.MailboxMappingFlat)}
+	ib.users["user@pm.me"] = user
+
+	update, ok := ib.mapUpdate(&goIMAPBackend.ExpungeUpdate{Update: goIMAPBackend.NewUpdate("User@pm.me", "Folders/Work"), SeqNum: 1})
+	require.True(t, ok)
+	require.Equal(t, "Work", update.Mailbox())
+	require.Equal(t, uint32(1), update.(*goIMAPBackend.ExpungeUpdate).SeqNum)
+
+	// Updates of other accounts are not changed.
+	update, ok = ib.mapUpdate(goIMAPBackend.NewUpdate("other@pm.me", "Folders/Work"))
+	require.True(t, ok)
+	require.Equal(t, "Folders/Work", update.Mailbox())
+
+	user.mapping = newTestMailboxMapping(store.MailboxMappingGmail)
+	_, ok = ib.mapUpdate(&goIMAPBackend.ExpungeUpdate{Update: goIMAPBackend.NewUpdate("user@pm.me", "Labels/To do")})
+	require.False(t, ok)
+}
+
+type fakeLocker struct{}
+
+func (*fakeLocker) Lock()   {}
+func (*fakeLocker) Unlock() {}
@@ -19,19 +19,23 @@ package imap
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/mail"
 	"net/textproto"
-	"regexp"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/diagnostics"
 	"github.com/ProtonMail/proton-bridge/internal/imap/cache"
+	"github.com/ProtonMail/proton-bridge/internal/imap/savedate"
 	"github.com/ProtonMail/proton-bridge/internal/imap/uidplus"
+	"github.com/ProtonMail/proton-bridge/internal/incidents"
+	"github.com/ProtonMail/proton-bridge/internal/store"
 	"github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/parallel"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
@@ -64,14 +68,24 @@ func (dnc *doNotCacheError) errorOrNil() error {
 //
 // If the Backend implements Updater, it must notify the client immediately
 // via a mailbox update.
-func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.Literal) error { // nolint[funlen]
+func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.Literal) (err error) { // nolint[funlen]
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
+	defer im.checkAPIAvailability(&err)
+	defer im.startTrace("APPEND", false)(&err)
 
-	m, _, _, readers, err := message.Parse(body, "", "")
+	if err := im.user.checkWritable(); err != nil {
+		return err
+	}
+
+	// Literal is parsed as it is read, without copies of the whole message.
+	m, readers, diag, err := message.ParseForImport(body)
 	if err != nil {
 		return err
 	}
+	if len(diag) > 0 {
+		im.log.WithField("problems", diag).Warn("Appended message is malformed, importing salvaged parts")
+	}
 
 	addr := im.storeAddress.APIAddress()
 	if addr == nil {
@@ -100,9 +114,9 @@ func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.L
 		// Sender address needs to be sanitised (drafts need to match cases exactly).
 		m.Sender.Address = pmapi.ConstructAddress(m.Sender.Address, addr.Email)
 
-		draft, _, err := im.user.storeUser.CreateDraft(kr, m, readers, "", "", "")
+		draft, err := im.saveDraft(kr, m, readers)
 		if err != nil {
-			return errors.Wrap(err, "failed to create draft")
+			return err
 		}
 
 		targetSeq := im.storeMailbox.GetUIDList([]string{draft.ID})
@@ -125,6 +139,13 @@ func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.L
 				return uidplus.AppendResponse(im.storeMailbox.UIDValidity(), &uidplus.OrderedSeq{foundUID})
 			}
 
+			// The event with the sent message might not be processed yet but
+			// the message was sent via Bridge, so we can skip importing it too.
+			if apiID := im.user.storeUser.FindSentMessage(m.Header.Get("Message-Id"), store.MessageFingerprint(m)); apiID != "" {
+				logEntry.WithField("msgID", apiID).Info("Ignoring APPEND of message sent via Bridge to Sent folder")
+				return uidplus.AppendResponse(im.storeMailbox.UIDValidity(), im.storeMailbox.GetUIDList([]string{apiID}))
+			}
+
 			// We didn't find the message in the store, so we are currently sending it.
 			logEntry.WithField("time", date).Info("No matching UID, continuing APPEND to Sent")
 		}
@@ -138,19 +159,9 @@ func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.L
 		m.Time = date.Unix()
 	}
 
+	// References are not used as fallback because they contain placeholder
+	// of the replied message which would be labeled instead of appending.
 	internalID := m.Header.Get("X-Pm-Internal-Id")
-	references := m.Header.Get("References")
-	referenceList := strings.Fields(references)
-
-	if len(referenceList) > 0 {
-		lastReference := referenceList[len(referenceList)-1]
-		// In case we are using a mail client which corrupts headers, try "References" too.
-		re := regexp.MustCompile(pmapi.InternalReferenceFormat)
-		match := re.FindStringSubmatch(lastReference)
-		if len(match) > 0 {
-			internalID = match[0]
-		}
-	}
 
 	// Avoid appending a message which is already on the server. Apply the new
 	// label instead. This sometimes happens which Outlook (it uses APPEND instead of COPY).
@@ -180,6 +191,52 @@ func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.L
 	return uidplus.AppendResponse(im.storeMailbox.UIDValidity(), targetSeq)
 }
 
+// saveDraft updates the draft which the appended message replaces or
+// creates a new one. Updating keeps the ID and the already uploaded
+// attachments of the draft. The old copy gets a new UID once the event
+// with the update is processed, so deleting the old UID afterwards by
+// the client does not remove the draft.
+func (im *imapMailbox) saveDraft(kr *crypto.KeyRing, m *pmapi.Message, readers []io.Reader) (*pmapi.Message, error) {
+	if draftID := im.getReplacedDraftID(m); draftID != "" {
+		draft, err := im.user.storeUser.UpdateDraft(kr, draftID, m, readers)
+		if err == nil {
+			return draft, nil
+		}
+		if errors.Cause(err) != store.ErrNotDraft {
+			return nil, errors.Wrap(err, "failed to update draft")
+		}
+		im.log.WithField("draftID", draftID).Info("Replaced draft is not a draft anymore, creating a new one")
+	}
+
+	draft, _, err := im.user.storeUser.CreateDraft(kr, m, readers, "", "", "", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create draft")
+	}
+	return draft, nil
+}
+
+// getReplacedDraftID returns ID of the draft in this mailbox which has
+// the same X-Pm-Internal-Id or Message-Id as the appended message, i.e.,
+// the appended message is its edited version.
+func (im *imapMailbox) getReplacedDraftID(m *pmapi.Message) string {
+	if internalID := m.Header.Get("X-Pm-Internal-Id"); internalID != "" {
+		if im.storeMailbox.GetUIDList([]string{internalID}).Len() != 0 {
+			return internalID
+		}
+	}
+
+	uid := im.storeMailbox.GetUIDByHeader(&m.Header)
+	if uid == 0 {
+		return ""
+	}
+
+	apiIDs, err := im.storeMailbox.GetAPIIDsFromUIDRange(uid, uid)
+	if err != nil || len(apiIDs) == 0 {
+		return ""
+	}
+	return apiIDs[0]
+}
+
 func (im *imapMailbox) importMessage(m *pmapi.Message, readers []io.Reader, kr *crypto.KeyRing) (err error) { // nolint[funlen]
 	body, err := message.BuildEncrypted(m, readers, kr)
 	if err != nil {
@@ -196,7 +253,7 @@ func (im *imapMailbox) importMessage(m *pmapi.Message, readers []io.Reader, kr *
 	return im.storeMailbox.ImportMessage(m, body, labels)
 }
 
-func (im *imapMailbox) getMessage(storeMessage storeMessageProvider, items []imap.FetchItem) (msg *imap.Message, err error) {
+func (im *imapMailbox) getMessage(ctx context.Context, storeMessage storeMessageProvider, items []imap.FetchItem) (msg *imap.Message, err error) {
 	im.log.WithField("msgID", storeMessage.ID()).Trace("Getting message")
 
 	seqNum, err := storeMessage.SequenceNumber()
@@ -213,25 +270,42 @@ func (im *imapMailbox) getMessage(storeMessage storeMessageProvider, items []ima
 			msg.Envelope = message.GetEnvelope(m)
 		case imap.FetchBody, imap.FetchBodyStructure:
 			var structure *message.BodyStructure
-			if structure, _, err = im.getBodyStructure(storeMessage); err != nil {
+			var body messageBody
+			if structure, body, err = im.getLazyBodyStructure(ctx, storeMessage); err != nil {
 				return
 			}
+			closeMessageBody(body)
 			if msg.BodyStructure, err = structure.IMAPBodyStructure([]int{}); err != nil {
 				return
 			}
 		case imap.FetchFlags:
-			msg.Flags = message.GetFlags(m)
+			msg.Flags = append(message.GetFlags(m), storeMessage.Keywords()...)
+			msg.Flags = append(msg.Flags, im.user.mailboxMapping().keywords(m.LabelIDs)...)
+			if storeMessage.IsMarkedDeleted() {
+				msg.Flags = append(msg.Flags, imap.DeletedFlag)
+			}
+		case savedate.FetchSaveDate:
+			if saveDate := storeMessage.SaveDate(); !saveDate.IsZero() {
+				msg.Items[savedate.FetchSaveDate] = saveDate
+			}
 		case imap.FetchInternalDate:
 			msg.InternalDate = time.Unix(m.Time, 0)
 		case imap.FetchRFC822Size:
 			// Size attribute on the server counts encrypted data. The value is cleared
 			// on our part and we need to compute "real" size of decrypted data.
-			if m.Size <= 0 {
-				if _, _, err = im.getBodyStructure(storeMessage); err != nil {
+			size := m.Size
+			if size <= 0 || isOverSizeLimit(size, im.sizeLimit()) {
+				// Size of the message with attachment placeholders or of the
+				// preview of a large message is not stored because it
+				// differs from the complete message.
+				var body messageBody
+				if _, body, err = im.getLimitedBodyStructure(ctx, storeMessage); err != nil {
 					return
 				}
+				size = body.Size()
+				closeMessageBody(body)
 			}
-			msg.Size = uint32(m.Size)
+			msg.Size = uint32(size)
 		case imap.FetchUid:
 			msg.Uid, err = storeMessage.UID()
 			if err != nil {
@@ -247,7 +321,7 @@ func (im *imapMailbox) getMessage(storeMessage storeMessageProvider, items []ima
 			}
 
 			var literal imap.Literal
-			if literal, err = im.getMessageBodySection(storeMessage, section); err != nil {
+			if literal, err = im.getMessageBodySection(ctx, storeMessage, section); err != nil {
 				return
 			}
 
@@ -258,18 +332,30 @@ func (im *imapMailbox) getMessage(storeMessage storeMessageProvider, items []ima
 	return msg, err
 }
 
-func (im *imapMailbox) getBodyStructure(storeMessage storeMessageProvider) (
+func (im *imapMailbox) getBodyStructure(ctx context.Context, storeMessage storeMessageProvider) (
 	structure *message.BodyStructure,
-	bodyReader *bytes.Reader, err error,
+	body messageBody, err error,
 ) {
 	m := storeMessage.Message()
 	id := im.storeUser.UserID() + m.ID
 	cache.BuildLock(id)
-	if bodyReader, structure = cache.LoadMail(id); bodyReader.Len() == 0 || structure == nil {
-		var body []byte
-		structure, body, err = im.buildMessage(m)
-		if err == nil && structure != nil && len(body) > 0 {
-			m.Size = int64(len(body))
+	endStore := im.getTrace().message(m.ID).begin(phaseStore)
+	var bodyReader *bytes.Reader
+	if bodyReader, structure = cache.LoadMail(id); bodyReader.Len() == 0 || !im.hasCurrentLabels(m, structure) {
+		bodyReader, structure = im.loadCachedMessage(storeMessage)
+	}
+	if structure != nil && !im.hasCurrentLabels(m, structure) {
+		// Labels changed since the message was built, it has to be built
+		// again so the header and the size match the fetched header.
+		bodyReader, structure = &bytes.Reader{}, nil
+	}
+	endStore()
+	body = bodyReader
+	if bodyReader.Len() == 0 || structure == nil {
+		var built *spool
+		structure, built, err = im.buildMessage(ctx, m)
+		if err == nil && structure != nil && built.Size() > 0 {
+			m.Size = built.Size()
 			if err := storeMessage.SetSize(m.Size); err != nil {
 				im.log.WithError(err).
 					WithField("newSize", m.Size).
@@ -281,20 +367,73 @@ func (im *imapMailbox) getBodyStructure(storeMessage storeMessageProvider) (
 					WithField("msgID", m.ID).
 					Warn("Cannot update header while building")
 			}
-			// Drafts can change and we don't want to cache them.
-			if !isMessageInDraftFolder(m) {
-				cache.SaveMail(id, body, structure)
+			// Drafts can change and we don't want to cache them. Messages
+			// spooled to disk are too big to be cached, their attachments
+			// are cached by the store.
+			if data, ok := built.Bytes(); ok && !isMessageInDraftFolder(m) {
+				cache.SaveMail(id, data, structure)
+				im.storeUser.SetCachedMessage(m.ID, data)
 			}
-			bodyReader = bytes.NewReader(body)
-		}
-		if _, ok := err.(*doNotCacheError); ok {
+			body = built
+		} else if _, ok := err.(*doNotCacheError); ok {
 			im.log.WithField("msgID", m.ID).Errorf("do not cache message: %v", err)
 			err = nil
-			bodyReader = bytes.NewReader(body)
+			if built != nil {
+				body = built
+			}
+		} else if built != nil {
+			_ = built.Close()
 		}
 	}
 	cache.BuildUnlock(id)
-	return structure, bodyReader, err
+	return structure, body, err
+}
+
+// loadCachedMessage returns the message from the on-disk cache of the store
+// and puts it also to the in-memory cache. The reader is empty when the
+// message is not cached.
+func (im *imapMailbox) loadCachedMessage(storeMessage storeMessageProvider) (bodyReader *bytes.Reader, structure *message.BodyStructure) {
+	m := storeMessage.Message()
+	body, ok := im.storeUser.GetCachedMessage(m.ID)
+	if !ok || isMessageInDraftFolder(m) {
+		return &bytes.Reader{}, nil
+	}
+
+	structure, err := message.NewBodyStructure(bytes.NewReader(body))
+	if err != nil {
+		im.log.WithError(err).WithField("msgID", m.ID).Warn("Cannot parse cached message")
+		return &bytes.Reader{}, nil
+	}
+
+	cache.SaveMail(im.storeUser.UserID()+m.ID, body, structure)
+	return bytes.NewReader(body), structure
+}
+
+// getMessageHeader returns the header of the message with names of its
+// labels.
+func (im *imapMailbox) getMessageHeader(m *pmapi.Message) textproto.MIMEHeader {
+	header := message.GetHeader(m)
+	message.SetLabelsHeader(header, im.storeUser.GetLabelNames(m.LabelIDs))
+	message.IMAPHeaderPolicy.Apply(header)
+	return header
+}
+
+// hasCurrentLabels returns whether the header of the built message lists
+// the current labels of the message. Built messages are cached and labels
+// can be changed or renamed later.
+func (im *imapMailbox) hasCurrentLabels(m *pmapi.Message, structure *message.BodyStructure) bool {
+	if structure == nil {
+		return false
+	}
+
+	header, err := structure.GetSectionHeader([]int{})
+	if err != nil {
+		return false
+	}
+
+	current := im.getMessageHeader(m).Get(message.LabelsHeaderKey)
+	return strings.Join(strings.Fields(header.Get(message.LabelsHeaderKey)), " ") ==
+		strings.Join(strings.Fields(current), " ")
 }
 
 func isMessageInDraftFolder(m *pmapi.Message) bool {
@@ -307,13 +446,15 @@ func isMessageInDraftFolder(m *pmapi.Message) bool {
 }
 
 // This will download message (or read from cache) and pick up the section,
-// extract data (header,body, both) and trim the output if needed.
-func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider, section *imap.BodySectionName) (literal imap.Literal, err error) { // nolint[funlen]
+// extract data (header,body, both) and trim the output if needed. Sections
+// are read right from the built message, which is removed once the literal
+// is sent.
+func (im *imapMailbox) getMessageBodySection(ctx context.Context, storeMessage storeMessageProvider, section *imap.BodySectionName) (literal imap.Literal, err error) { // nolint[funlen]
 	var (
-		structure  *message.BodyStructure
-		bodyReader *bytes.Reader
-		header     textproto.MIMEHeader
-		response   []byte
+		structure *message.BodyStructure
+		body      messageBody
+		header    textproto.MIMEHeader
+		response  *io.SectionReader
 	)
 
 	im.log.WithField("msgID", storeMessage.ID()).Trace("Getting message body")
@@ -322,11 +463,11 @@ func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider,
 
 	if len(section.Path) == 0 && section.Specifier == imap.HeaderSpecifier {
 		// We can extract message header without decrypting.
-		header = message.GetHeader(m)
+		header = im.getMessageHeader(m)
 		// We need to ensure we use the correct content-type,
 		// otherwise AppleMail expects `text/plain` in HTML mails.
 		if header.Get("Content-Type") == "" {
-			if err = im.fetchMessage(m); err != nil {
+			if err = im.fetchMessage(ctx, m); err != nil {
 				return
 			}
 			if _, err = im.setMessageContentType(m); err != nil {
@@ -335,11 +476,13 @@ func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider,
 			if err = storeMessage.SetContentTypeAndHeader(m.MIMEType, m.Header); err != nil {
 				return
 			}
-			header = message.GetHeader(m)
+			header = im.getMessageHeader(m)
 		}
-	} else {
+	} else if body, err = im.getAttachmentPart(ctx, storeMessage, section); err == nil && body != nil {
+		response = io.NewSectionReader(body, 0, body.Size())
+	} else if err == nil {
 		// The rest of cases need download and decrypt.
-		structure, bodyReader, err = im.getBodyStructure(storeMessage)
+		structure, body, err = im.getSectionBodyStructure(ctx, storeMessage, section)
 		if err != nil {
 			return
 		}
@@ -347,11 +490,11 @@ func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider,
 		switch {
 		case section.Specifier == imap.EntireSpecifier && len(section.Path) == 0:
 			//  An empty section specification refers to the entire message, including the header.
-			response, err = structure.GetSection(bodyReader, section.Path)
+			response, err = structure.GetSectionReader(body, section.Path)
 		case section.Specifier == imap.TextSpecifier || (section.Specifier == imap.EntireSpecifier && len(section.Path) != 0):
 			// The TEXT specifier refers to the content of the message (or section), omitting the [RFC-2822] header.
 			// Non-empty section with no specifier (imap.EntireSpecifier) refers to section content without header.
-			response, err = structure.GetSectionContent(bodyReader, section.Path)
+			response, err = structure.GetSectionContentReader(body, section.Path)
 		case section.Specifier == imap.MIMESpecifier:
 			// The MIME part specifier refers to the [MIME-IMB] header for this part.
 			fallthrough
@@ -363,11 +506,14 @@ func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider,
 	}
 
 	if err != nil {
+		closeMessageBody(body)
 		return
 	}
 
 	// Filter header. Options are: all fields, only selected fields, all fields except selected.
 	if header != nil {
+		closeMessageBody(body)
+
 		// remove fields
 		if len(section.Fields) != 0 && section.NotFields {
 			for _, field := range section.Fields {
@@ -397,18 +543,26 @@ func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider,
 				}
 			}
 		}
-		response = headerBuf.Bytes()
+
+		// Trim any output if requested.
+		return newBytesLiteral(headerBuf.Bytes(), section.Partial), nil
 	}
 
 	// Trim any output if requested.
-	literal = bytes.NewBuffer(section.ExtractPartial(response))
-	return literal, nil
+	return newSectionLiteral(body, response, section.Partial), nil
 }
 
-func (im *imapMailbox) fetchMessage(m *pmapi.Message) (err error) {
+func (im *imapMailbox) fetchMessage(ctx context.Context, m *pmapi.Message) (err error) {
 	im.log.Trace("Fetching message")
 
-	complete, err := im.storeMailbox.FetchMessage(m.ID)
+	if prefetched := im.takePrefetchedMessage(m.ID); prefetched != nil {
+		*m = *prefetched
+		return
+	}
+
+	endAPI := im.getTrace().message(m.ID).begin(phaseAPI)
+	complete, err := im.storeMailbox.FetchMessage(ctx, m.ID)
+	endAPI()
 	if err != nil {
 		im.log.WithError(err).Error("Could not get message from store")
 		return
@@ -419,12 +573,12 @@ func (im *imapMailbox) fetchMessage(m *pmapi.Message) (err error) {
 	return
 }
 
-func (im *imapMailbox) writeMessageBody(w io.Writer, m *pmapi.Message) (err error) {
+func (im *imapMailbox) writeMessageBody(ctx context.Context, w io.Writer, m *pmapi.Message) (err error) {
 	im.log.Trace("Writing message body")
 
 	if m.Body == "" {
 		im.log.Trace("While writing message body, noticed message body is null, need to fetch")
-		if err = im.fetchMessage(m); err != nil {
+		if err = im.fetchMessage(ctx, m); err != nil {
 			return
 		}
 	}
@@ -434,8 +588,9 @@ func (im *imapMailbox) writeMessageBody(w io.Writer, m *pmapi.Message) (err erro
 		return errors.Wrap(err, "failed to get keyring for address ID")
 	}
 
-	err = message.WriteBody(w, kr, m)
+	err = message.WriteBody(w, kr, m, getBodyEncoding())
 	if err != nil {
+		im.saveRepro(m, message.ReproBuildFailed, err)
 		if customMessageErr := message.CustomMessage(m, err, true); customMessageErr != nil {
 			im.log.WithError(customMessageErr).Warn("Failed to make custom message")
 		}
@@ -446,9 +601,9 @@ func (im *imapMailbox) writeMessageBody(w io.Writer, m *pmapi.Message) (err erro
 	return
 }
 
-func (im *imapMailbox) writeAndParseMIMEBody(m *pmapi.Message) (mime *enmime.Envelope, err error) { //nolint[unused]
+func (im *imapMailbox) writeAndParseMIMEBody(ctx context.Context, m *pmapi.Message) (mime *enmime.Envelope, err error) { //nolint[unused]
 	b := &bytes.Buffer{}
-	if err = im.writeMessageBody(b, m); err != nil {
+	if err = im.writeMessageBody(ctx, b, m); err != nil {
 		return
 	}
 
@@ -457,9 +612,21 @@ func (im *imapMailbox) writeAndParseMIMEBody(m *pmapi.Message) (mime *enmime.Env
 	return
 }
 
-func (im *imapMailbox) writeAttachmentBody(w io.Writer, m *pmapi.Message, att *pmapi.Attachment) (err error) {
+func (im *imapMailbox) writeAttachmentBody(ctx context.Context, w io.Writer, m *pmapi.Message, att *pmapi.Attachment) (err error) {
+	timer := im.getTrace().message(m.ID)
+
+	endStore := timer.begin(phaseStore)
+	cached, ok := im.storeUser.GetCachedAttachment(m.ID, att.ID)
+	endStore()
+	if ok {
+		defer cached.Close() //nolint[errcheck]
+		return message.WriteAttachmentData(w, cached)
+	}
+
 	// Retrieve encrypted attachment.
-	r, err := im.user.client().GetAttachment(att.ID)
+	endAPI := timer.begin(phaseAPI)
+	r, err := im.user.client().GetAttachment(ctx, att.ID)
+	endAPI()
 	if err != nil {
 		return
 	}
@@ -470,7 +637,36 @@ func (im *imapMailbox) writeAttachmentBody(w io.Writer, m *pmapi.Message, att *p
 		return errors.Wrap(err, "failed to get keyring for address ID")
 	}
 
-	if err = message.WriteAttachmentBody(w, kr, m, att, r); err != nil {
+	// Only decrypted attachments are cached because the name and type of
+	// attachments which cannot be decrypted are changed. The attachment is
+	// downloaded and decrypted while being written, so the decryption phase
+	// includes writing. It is written to the cache on disk at the same time.
+	endDecrypt := timer.begin(phaseDecrypt)
+	dr, isDecrypted, err := message.DecryptAttachment(kr, att, r)
+	if err == nil {
+		var cacheWriter store.CachedAttachmentWriter
+		if isDecrypted {
+			cacheWriter = im.storeUser.NewCachedAttachmentWriter(m.ID, att)
+		}
+		if cacheWriter != nil {
+			dr = io.TeeReader(dr, cacheWriter)
+		}
+		err = message.WriteAttachmentData(w, dr)
+		if cacheWriter != nil {
+			// Nobody waits for the message anymore, the partial attachment
+			// must not end up in the cache as if it was complete.
+			if err == nil {
+				cacheWriter.Commit()
+			} else {
+				cacheWriter.Discard()
+			}
+		}
+	}
+	endDecrypt()
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		// Returning an error here makes certain mail clients behave badly,
 		// trying to retrieve the message again and again.
 		im.log.Warn("Cannot write attachment body: ", err)
@@ -479,18 +675,21 @@ func (im *imapMailbox) writeAttachmentBody(w io.Writer, m *pmapi.Message, att *p
 	return
 }
 
-func (im *imapMailbox) writeRelatedPart(p io.Writer, m *pmapi.Message, inlines []*pmapi.Attachment) (err error) {
+// attachmentBodyWriter writes the content of the attachment part.
+type attachmentBodyWriter func(w io.Writer, m *pmapi.Message, att *pmapi.Attachment) error
+
+func (im *imapMailbox) writeRelatedPart(ctx context.Context, p io.Writer, m *pmapi.Message, inlines []*pmapi.Attachment, writeAttachment attachmentBodyWriter) (err error) {
 	related := multipart.NewWriter(p)
 
 	_ = related.SetBoundary(message.GetRelatedBoundary(m))
 
 	buf := &bytes.Buffer{}
-	if err = im.writeMessageBody(buf, m); err != nil {
+	if err = im.writeMessageBody(ctx, buf, m); err != nil {
 		return
 	}
 
 	// Write the body part.
-	h := message.GetBodyHeader(m)
+	h := message.GetBodyHeader(m, getBodyEncoding())
 
 	if p, err = related.CreatePart(h); err != nil {
 		return
@@ -498,23 +697,46 @@ func (im *imapMailbox) writeRelatedPart(p io.Writer, m *pmapi.Message, inlines [
 
 	_, _ = buf.WriteTo(p)
 
+	// Inline attachments are written right into their parts.
 	for _, inline := range inlines {
-		buf = &bytes.Buffer{}
-		if err = im.writeAttachmentBody(buf, m, inline); err != nil {
+		part := &attachmentPart{mw: related, att: inline}
+		if err = writeAttachment(part, m, inline); err != nil {
 			return
 		}
-
-		h := message.GetAttachmentHeader(inline)
-		if p, err = related.CreatePart(h); err != nil {
+		if err = part.create(); err != nil {
 			return
 		}
-		_, _ = buf.WriteTo(p)
 	}
 
 	_ = related.Close()
 	return nil
 }
 
+// attachmentPart creates the part of the attachment on the first write,
+// because the name and type of the attachment in the part header change
+// when the attachment cannot be decrypted, which is known only when its
+// body is being written.
+type attachmentPart struct {
+	mw  *multipart.Writer
+	att *pmapi.Attachment
+	w   io.Writer
+}
+
+func (p *attachmentPart) Write(data []byte) (int, error) {
+	if err := p.create(); err != nil {
+		return 0, err
+	}
+	return p.w.Write(data)
+}
+
+// create creates the part unless it is created already.
+func (p *attachmentPart) create() (err error) {
+	if p.w == nil {
+		p.w, err = p.mw.CreatePart(message.GetAttachmentHeader(p.att))
+	}
+	return
+}
+
 const (
 	noMultipart      = iota // only body
 	simpleMultipart         // body + attachment or inline
@@ -540,7 +762,7 @@ func (im *imapMailbox) setMessageContentType(m *pmapi.Message) (multipartType in
 
 	h := textproto.MIMEHeader(m.Header)
 	if multipartType == noMultipart {
-		message.SetBodyContentFields(&h, m)
+		message.SetBodyContentFields(&h, m, getBodyEncoding())
 	} else {
 		h.Set("Content-Type",
 			fmt.Sprintf("%s; boundary=%s", "multipart/mixed", message.GetBoundary(m)),
@@ -552,13 +774,13 @@ func (im *imapMailbox) setMessageContentType(m *pmapi.Message) (multipartType in
 }
 
 // buildMessage from PM to IMAP.
-func (im *imapMailbox) buildMessage(m *pmapi.Message) (structure *message.BodyStructure, msgBody []byte, err error) {
+func (im *imapMailbox) buildMessage(ctx context.Context, m *pmapi.Message) (structure *message.BodyStructure, body *spool, err error) {
 	im.log.Trace("Building message")
 
 	var errNoCache doNotCacheError
 
 	// If fetch or decryption fails we need to change the MIMEType (in customMessage).
-	err = im.fetchMessage(m)
+	err = im.fetchMessage(ctx, m)
 	if err != nil {
 		return
 	}
@@ -569,10 +791,40 @@ func (im *imapMailbox) buildMessage(m *pmapi.Message) (structure *message.BodySt
 		return
 	}
 
-	errDecrypt := m.Decrypt(kr)
+	if originalID, ok := message.GetMDNOriginalID(m); ok {
+		if err := im.storeUser.AddReadReceipt(m.ID, originalID); err != nil {
+			im.log.WithError(err).Warn("Cannot mark read receipt")
+		}
+	}
+
+	writeAttachment := func(w io.Writer, m *pmapi.Message, att *pmapi.Attachment) error {
+		return im.writeAttachmentBody(ctx, w, m, att)
+	}
+
+	// Message without the result of signature check is not cached so it
+	// can be checked next time when keys of the sender are available.
+	verifiers, err := message.VerificationKeyRing(ctx, im.user.client(), m)
+	if err != nil {
+		errNoCache.add(errors.Wrap(err, "failed to get keys of the sender"))
+	}
+
+	endDecrypt := im.getTrace().message(m.ID).begin(phaseDecrypt)
+	signature, errDecrypt := m.DecryptAndVerify(kr, verifiers)
+	endDecrypt()
 
 	if errDecrypt != nil && errDecrypt != openpgperrors.ErrSignatureExpired {
 		errNoCache.add(errDecrypt)
+		incidents.Report(incidents.DecryptFailed, im.storeUser.UserID(), "message "+m.ID+": "+errDecrypt.Error())
+		im.saveRepro(m, message.ReproDecryptFailed, errDecrypt)
+		if getDecryptionPlaceholder() == message.PlaceholderAttachment {
+			var placeholder []byte
+			if structure, placeholder, err = buildPlaceholder(m, errDecrypt); err != nil {
+				return nil, nil, err
+			}
+			body = newSpool()
+			_, _ = body.Write(placeholder)
+			return structure, body, errNoCache.errorOrNil()
+		}
 		if customMessageErr := message.CustomMessage(m, errDecrypt, true); customMessageErr != nil {
 			im.log.WithError(customMessageErr).Warn("Failed to make custom message")
 		}
@@ -584,15 +836,16 @@ func (im *imapMailbox) buildMessage(m *pmapi.Message) (structure *message.BodySt
 	// and that fails. For any building error is better to return custom
 	// message than error because it will not be fixed and users would
 	// get error message all the time and could not see some messages.
-	structure, msgBody, err = im.buildMessageInner(m, kr)
-	if err == pmapi.ErrAPINotReachable || err == pmapi.ErrInvalidToken || err == pmapi.ErrUpgradeApplication {
+	structure, body, err = im.buildMessageInner(ctx, m, kr, signature, writeAttachment)
+	if err == pmapi.ErrAPINotReachable || err == pmapi.ErrInvalidToken || err == pmapi.ErrUpgradeApplication || ctx.Err() != nil {
 		return nil, nil, err
 	} else if err != nil {
 		errNoCache.add(err)
+		im.saveRepro(m, message.ReproBuildFailed, err)
 		if customMessageErr := message.CustomMessage(m, err, true); customMessageErr != nil {
 			im.log.WithError(customMessageErr).Warn("Failed to make custom message")
 		}
-		structure, msgBody, err = im.buildMessageInner(m, kr)
+		structure, body, err = im.buildMessageInner(ctx, m, kr, signature, writeAttachment)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -600,17 +853,43 @@ func (im *imapMailbox) buildMessage(m *pmapi.Message) (structure *message.BodySt
 
 	err = errNoCache.errorOrNil()
 
-	return structure, msgBody, err
+	return structure, body, err
+}
+
+// saveRepro saves the redacted reproduction bundle of the message. It must
+// be called before the message is replaced by the custom message.
+func (im *imapMailbox) saveRepro(m *pmapi.Message, failure string, err error) {
+	if err := diagnostics.SaveRepro(message.NewRepro(m, failure, err, time.Now())); err != nil {
+		im.log.WithError(err).Warn("Failed to save reproduction bundle")
+	}
 }
 
-func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *crypto.KeyRing) (structure *message.BodyStructure, msgBody []byte, err error) { // nolint[funlen]
+func (im *imapMailbox) buildMessageInner(ctx context.Context, m *pmapi.Message, kr *crypto.KeyRing, signature pmapi.SignatureStatus, writeAttachment attachmentBodyWriter) (structure *message.BodyStructure, body *spool, err error) { // nolint[funlen]
 	multipartType, err := im.setMessageContentType(m)
 	if err != nil {
 		return
 	}
 
-	tmpBuf := &bytes.Buffer{}
-	mainHeader := message.GetHeader(m)
+	// Drafts are edited by the client so they must keep their remote content.
+	if m.MIMEType == pmapi.ContentTypeHTML && !m.IsBodyEncrypted() && !isMessageInDraftFolder(m) {
+		m.Body = im.storeUser.GetRemoteContentFilter().Apply(m.Body)
+	}
+
+	// The message is built right into the spool which keeps big messages
+	// in the temporary file. It is closed unless it is returned.
+	tmpBuf := newSpool()
+	defer func() {
+		if err != nil {
+			_ = tmpBuf.Close()
+		}
+	}()
+
+	mainHeader := im.getMessageHeader(m)
+	message.SetSMIMEVerifiedHeader(mainHeader, m, nil)
+	message.SetSignatureValidityHeader(mainHeader, signature)
+	if phishing, ok := im.storeUser.GetPhishingResult(m); ok {
+		message.SetPhishingScoreHeader(mainHeader, phishing)
+	}
 	if err = writeHeader(tmpBuf, mainHeader); err != nil {
 		return
 	}
@@ -618,13 +897,13 @@ func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *crypto.KeyRing) (
 
 	switch multipartType {
 	case noMultipart:
-		err = message.WriteBody(tmpBuf, kr, m)
+		err = message.WriteBody(tmpBuf, kr, m, getBodyEncoding())
 		if err != nil {
 			return
 		}
 	case complexMultipart:
 		_, _ = io.WriteString(tmpBuf, "\r\n--"+message.GetBoundary(m)+"\r\n")
-		err = message.WriteBody(tmpBuf, kr, m)
+		err = message.WriteBody(tmpBuf, kr, m, getBodyEncoding())
 		if err != nil {
 			return
 		}
@@ -641,15 +920,15 @@ func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *crypto.KeyRing) (
 			if partWriter, err = mw.CreatePart(relatedHeader); err != nil {
 				return
 			}
-			_ = im.writeRelatedPart(partWriter, m, inlines)
+			_ = im.writeRelatedPart(ctx, partWriter, m, inlines, writeAttachment)
 		} else {
 			buf := &bytes.Buffer{}
-			if err = im.writeMessageBody(buf, m); err != nil {
+			if err = im.writeMessageBody(ctx, buf, m); err != nil {
 				return
 			}
 
 			// Write the body part.
-			bodyHeader := message.GetBodyHeader(m)
+			bodyHeader := message.GetBodyHeader(m, getBodyEncoding())
 			if partWriter, err = mw.CreatePart(bodyHeader); err != nil {
 				return
 			}
@@ -666,25 +945,27 @@ func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *crypto.KeyRing) (
 		processCallback := func(value interface{}) (interface{}, error) {
 			att := value.(*pmapi.Attachment)
 
-			buf := &bytes.Buffer{}
-			if err = im.writeAttachmentBody(buf, m, att); err != nil {
+			attBody := newSpool()
+			if err := writeAttachment(attBody, m, att); err != nil {
+				_ = attBody.Close()
 				return nil, err
 			}
-			return buf, nil
+			return attBody, nil
 		}
 
 		collectCallback := func(idx int, value interface{}) error {
-			buf := value.(*bytes.Buffer)
-			defer buf.Reset()
+			attBody := value.(*spool)
+			defer attBody.Close() //nolint[errcheck]
 			att := atts[idx]
 
 			attachmentHeader := message.GetAttachmentHeader(att)
-			if partWriter, err = mw.CreatePart(attachmentHeader); err != nil {
+			partWriter, err := mw.CreatePart(attachmentHeader)
+			if err != nil {
 				return err
 			}
 
-			_, _ = buf.WriteTo(partWriter)
-			return nil
+			_, err = io.Copy(partWriter, io.NewSectionReader(attBody, 0, attBody.Size()))
+			return err
 		}
 
 		err = parallel.RunParallel(fetchAttachmentsWorkers, input, processCallback, collectCallback)
@@ -697,14 +978,18 @@ func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *crypto.KeyRing) (
 		fmt.Fprintf(tmpBuf, "\r\n\r\nUknown multipart type: %d\r\n\r\n", multipartType)
 	}
 
-	// We need to copy buffer before building body structure.
-	msgBody = tmpBuf.Bytes()
-	structure, err = message.NewBodyStructure(tmpBuf)
+	// Writes above do not check errors, the spool keeps the first one.
+	if err = tmpBuf.Err(); err != nil {
+		return
+	}
+
+	structure, err = message.NewBodyStructure(io.NewSectionReader(tmpBuf, 0, tmpBuf.Size()))
 	if err != nil {
 		// NOTE: We need to set structure if it fails and is empty.
 		if structure == nil {
 			structure = &message.BodyStructure{}
 		}
+		return structure, nil, err
 	}
-	return structure, msgBody, err
+	return structure, tmpBuf, nil
 }
@@ -0,0 +1,187 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/imap/cache"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/emersion/go-imap"
+	"github.com/pkg/errors"
+	openpgperrors "golang.org/x/crypto/openpgp/errors"
+)
+
+// lazyCacheSuffix distinguishes messages built without attachments from
+// complete messages in the in-memory cache.
+const lazyCacheSuffix = "-lazy"
+
+// getLazyBodyStructure returns the structure of the message built without
+// downloading attachments. Sizes of attachment parts are estimated and the
+// content of such parts is not in the returned body. The complete message
+// is used when it is already built or there is nothing to skip.
+func (im *imapMailbox) getLazyBodyStructure(ctx context.Context, storeMessage storeMessageProvider) (
+	structure *message.BodyStructure,
+	body messageBody, err error,
+) {
+	m := storeMessage.Message()
+	id := im.storeUser.UserID() + m.ID
+
+	if m.NumAttachments == 0 || isMessageInDraftFolder(m) {
+		return im.getBodyStructure(ctx, storeMessage)
+	}
+	var bodyReader *bytes.Reader
+	if bodyReader, structure = cache.LoadMail(id); bodyReader.Len() != 0 && structure != nil {
+		return structure, bodyReader, nil
+	}
+	if bodyReader, structure = im.loadCachedMessage(storeMessage); bodyReader.Len() != 0 && structure != nil {
+		return structure, bodyReader, nil
+	}
+
+	lazyID := id + lazyCacheSuffix
+	cache.BuildLock(lazyID)
+	defer cache.BuildUnlock(lazyID)
+
+	if bodyReader, structure = cache.LoadMail(lazyID); bodyReader.Len() != 0 && structure != nil {
+		return structure, bodyReader, nil
+	}
+
+	lazyBody, structure, err := im.buildLazyMessage(ctx, m)
+	if err != nil {
+		im.log.WithError(err).WithField("msgID", m.ID).Debug("Cannot build message without attachments")
+		return im.getBodyStructure(ctx, storeMessage)
+	}
+
+	cache.SaveMail(lazyID, lazyBody, structure)
+	return structure, bytes.NewReader(lazyBody), nil
+}
+
+// buildLazyMessage builds the message with empty attachment parts. Any
+// problem is left to the complete build which knows how to handle it.
+func (im *imapMailbox) buildLazyMessage(ctx context.Context, m *pmapi.Message) (body []byte, structure *message.BodyStructure, err error) {
+	if err = im.fetchMessage(ctx, m); err != nil {
+		return
+	}
+
+	var kr *crypto.KeyRing
+	if kr, err = im.user.client().KeyRingForAddressID(m.AddressID); err != nil {
+		return
+	}
+
+	// Missing keys of the sender only leave out the result of signature check.
+	verifiers, _ := message.VerificationKeyRing(ctx, im.user.client(), m)
+
+	var signature pmapi.SignatureStatus
+	if signature, err = m.DecryptAndVerify(kr, verifiers); err != nil && err != openpgperrors.ErrSignatureExpired {
+		return
+	}
+
+	skipAttachmentBody := func(io.Writer, *pmapi.Message, *pmapi.Attachment) error { return nil }
+	var built *spool
+	if _, built, err = im.buildMessageInner(ctx, m, kr, signature, skipAttachmentBody); err != nil {
+		return
+	}
+	defer built.Close() //nolint[errcheck]
+
+	// Without attachments the message is small enough to be kept in memory
+	// and cached, otherwise the complete build is used.
+	var ok bool
+	if body, ok = built.Bytes(); !ok {
+		err = errors.New("message without attachments is too big")
+		return
+	}
+
+	structure, err = message.NewLazyBodyStructure(bytes.NewReader(body), m)
+	return
+}
+
+// getSectionBodyStructure returns the structure from which the section can
+// be read. The complete message is needed only for the whole message, unless
+// attachment placeholders or the message size limit are enabled, and for
+// content of sections containing attachments.
+func (im *imapMailbox) getSectionBodyStructure(ctx context.Context, storeMessage storeMessageProvider, section *imap.BodySectionName) (
+	structure *message.BodyStructure,
+	body messageBody, err error,
+) {
+	if len(section.Path) == 0 {
+		return im.getLimitedBodyStructure(ctx, storeMessage)
+	}
+
+	if structure, body, err = im.getLazyBodyStructure(ctx, storeMessage); err != nil {
+		return
+	}
+
+	readsContent := section.Specifier == imap.TextSpecifier || section.Specifier == imap.EntireSpecifier
+	if readsContent && !structure.HasSectionContent(section.Path) {
+		closeMessageBody(body)
+		return im.getBodyStructure(ctx, storeMessage)
+	}
+	return structure, body, nil
+}
+
+// getAttachmentPart returns the content of the attachment part without
+// building the rest of the message. It returns nil for other sections.
+func (im *imapMailbox) getAttachmentPart(ctx context.Context, storeMessage storeMessageProvider, section *imap.BodySectionName) (messageBody, error) {
+	if section.Specifier != imap.EntireSpecifier || len(section.Path) == 0 {
+		return nil, nil
+	}
+
+	structure, body, err := im.getLazyBodyStructure(ctx, storeMessage)
+	if err != nil {
+		return nil, err
+	}
+	closeMessageBody(body)
+	if structure.HasSectionContent(section.Path) {
+		return nil, nil
+	}
+
+	return im.getAttachmentSection(ctx, storeMessage, section.Path)
+}
+
+// getAttachmentSection downloads and decrypts only the attachment in the
+// section. It returns nil when the section is not an attachment.
+func (im *imapMailbox) getAttachmentSection(ctx context.Context, storeMessage storeMessageProvider, sectionPath []int) (messageBody, error) {
+	m := storeMessage.Message()
+
+	// Message from the store has no attachments until it is fetched.
+	if len(m.Attachments) == 0 {
+		if err := im.fetchMessage(ctx, m); err != nil {
+			return nil, err
+		}
+	}
+
+	att := message.GetAttachmentBySection(m, sectionPath)
+	if att == nil {
+		return nil, nil
+	}
+
+	body := newSpool()
+	err := im.writeAttachmentBody(ctx, body, m, att)
+	if err == nil {
+		err = body.Err()
+	}
+	if err != nil {
+		_ = body.Close()
+		return nil, err
+	}
+	return body, nil
+}
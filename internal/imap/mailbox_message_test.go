@@ -18,12 +18,28 @@
 package imap
 
 import (
+	"bytes"
 	"errors"
 	"testing"
 
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/stretchr/testify/require"
 )
 
+// testLabelNamesStore provides only names of labels.
+type testLabelNamesStore struct {
+	storeUserProvider
+	names map[string]string
+}
+
+func (s *testLabelNamesStore) GetLabelNames(labelIDs []string) (names []string) {
+	for _, labelID := range labelIDs {
+		names = append(names, s.names[labelID])
+	}
+	return
+}
+
 func TestDoNotCache(t *testing.T) {
 	var dnc doNotCacheError
 	require.NoError(t, dnc.errorOrNil())
@@ -39,3 +55,27 @@ func TestDoNotCache(t *testing.T) {
 	dnc.add(errors.New("third"))
 	t.Log(dnc.errorOrNil())
 }
+
+func TestHasCurrentLabels(t *testing.T) {
+	storeUser := &testLabelNamesStore{names: map[string]string{pmapi.InboxLabel: "INBOX", "work": "Labels/Work"}}
+	im := &imapMailbox{storeUser: storeUser}
+	m := &pmapi.Message{ID: "msgID", Subject: "Hello", LabelIDs: []string{pmapi.InboxLabel, "work"}}
+
+	b := &bytes.Buffer{}
+	require.NoError(t, writeHeader(b, im.getMessageHeader(m)))
+	b.WriteString("\r\nBody\r\n")
+	structure, err := message.NewBodyStructure(bytes.NewReader(b.Bytes()))
+	require.NoError(t, err)
+
+	require.True(t, im.hasCurrentLabels(m, structure))
+	require.False(t, im.hasCurrentLabels(m, nil))
+
+	// Renamed label.
+	storeUser.names["work"] = "Labels/Job"
+	require.False(t, im.hasCurrentLabels(m, structure))
+	storeUser.names["work"] = "Labels/Work"
+
+	// Removed label.
+	m.LabelIDs = []string{pmapi.InboxLabel}
+	require.False(t, im.hasCurrentLabels(m, structure))
+}
@@ -18,17 +18,23 @@
 package imap
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/mail"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ProtonMail/proton-bridge/internal/imap/cache"
+	"github.com/ProtonMail/proton-bridge/internal/imap/fetch"
+	"github.com/ProtonMail/proton-bridge/internal/imap/savedate"
 	"github.com/ProtonMail/proton-bridge/internal/imap/uidplus"
 	"github.com/ProtonMail/proton-bridge/pkg/message"
-	"github.com/ProtonMail/proton-bridge/pkg/parallel"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/ProtonMail/proton-bridge/pkg/tracing"
 	"github.com/emersion/go-imap"
 	"github.com/sirupsen/logrus"
 )
@@ -37,7 +43,7 @@ import (
 //
 // If the Backend implements Updater, it must notify the client immediately
 // via a message update.
-func (im *imapMailbox) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet, operation imap.FlagsOp, flags []string) error {
+func (im *imapMailbox) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet, operation imap.FlagsOp, flags []string) (err error) {
 	log.WithFields(logrus.Fields{
 		"flags":     flags,
 		"operation": operation,
@@ -45,6 +51,12 @@ func (im *imapMailbox) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet, operat
 
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
+	defer im.checkAPIAvailability(&err)
+	defer im.startTrace("STORE", uid)(&err)
+
+	if err := im.user.checkWritable(); err != nil {
+		return err
+	}
 
 	messageIDs, err := im.apiIDsFromSeqSet(uid, seqSet)
 	if err != nil || len(messageIDs) == 0 {
@@ -62,6 +74,8 @@ func (im *imapMailbox) setFlags(messageIDs, flags []string) error {
 	flagged := false
 	deleted := false
 	spam := false
+	mdnSent := false
+	sendMDN := false
 
 	for _, f := range flags {
 		switch f {
@@ -73,6 +87,10 @@ func (im *imapMailbox) setFlags(messageIDs, flags []string) error {
 			deleted = true
 		case message.AppleMailJunkFlag, message.ThunderbirdJunkFlag:
 			spam = true
+		case message.MDNSentFlag:
+			mdnSent = true
+		case message.SendMDNFlag:
+			sendMDN = true
 		}
 	}
 
@@ -88,10 +106,18 @@ func (im *imapMailbox) setFlags(messageIDs, flags []string) error {
 		_ = im.storeMailbox.MarkMessagesUnstarred(messageIDs)
 	}
 
-	if deleted {
-		_ = im.storeMailbox.DeleteMessages(messageIDs)
+	if mdnSent {
+		_ = im.storeUser.AddKeyword(messageIDs, message.MDNSentFlag)
+	} else {
+		_ = im.storeUser.RemoveKeyword(messageIDs, message.MDNSentFlag)
+	}
+
+	if sendMDN {
+		im.sendReadReceipts(messageIDs)
 	}
 
+	_ = im.markMessagesDeleted(messageIDs, deleted)
+
 	spamMailbox, err := im.storeAddress.GetMailbox("Spam")
 	if err != nil {
 		return err
@@ -102,7 +128,7 @@ func (im *imapMailbox) setFlags(messageIDs, flags []string) error {
 		_ = spamMailbox.UnlabelMessages(messageIDs)
 	}
 
-	return nil
+	return im.updateLabelKeywords(imap.SetFlags, messageIDs, flags)
 }
 
 func (im *imapMailbox) addOrRemoveFlags(operation imap.FlagsOp, messageIDs, flags []string) error {
@@ -123,10 +149,7 @@ func (im *imapMailbox) addOrRemoveFlags(operation imap.FlagsOp, messageIDs, flag
 				_ = im.storeMailbox.MarkMessagesUnstarred(messageIDs)
 			}
 		case imap.DeletedFlag:
-			if operation == imap.RemoveFlags {
-				break // Nothing to do, no message has the \Deleted flag.
-			}
-			_ = im.storeMailbox.DeleteMessages(messageIDs)
+			_ = im.markMessagesDeleted(messageIDs, operation == imap.AddFlags)
 		case imap.AnsweredFlag, imap.DraftFlag, imap.RecentFlag:
 			// Not supported.
 		case message.AppleMailJunkFlag, message.ThunderbirdJunkFlag:
@@ -144,78 +167,211 @@ func (im *imapMailbox) addOrRemoveFlags(operation imap.FlagsOp, messageIDs, flag
 			case imap.RemoveFlags:
 				_ = storeMailbox.UnlabelMessages(messageIDs)
 			}
+		case message.NotJunkFlag:
+			if operation == imap.RemoveFlags {
+				break // Removing the not-junk flag doesn't mean the message is junk.
+			}
+			storeMailbox, err := im.storeAddress.GetMailbox("Spam")
+			if err != nil {
+				return err
+			}
+			_ = storeMailbox.UnlabelMessages(messageIDs)
+		case message.MDNSentFlag:
+			switch operation {
+			case imap.AddFlags:
+				_ = im.storeUser.AddKeyword(messageIDs, message.MDNSentFlag)
+			case imap.RemoveFlags:
+				_ = im.storeUser.RemoveKeyword(messageIDs, message.MDNSentFlag)
+			}
+		case message.SendMDNFlag:
+			if operation == imap.AddFlags {
+				im.sendReadReceipts(messageIDs)
+			}
+		}
+	}
+
+	return im.updateLabelKeywords(operation, messageIDs, flags)
+}
+
+// updateLabelKeywords labels or unlabels messages by keywords which
+// represent labels in gmail mapping mode. Other flags are ignored.
+func (im *imapMailbox) updateLabelKeywords(operation imap.FlagsOp, messageIDs, flags []string) error {
+	mapping := im.user.mailboxMapping()
+
+	keywords := map[string]bool{}
+	for _, flag := range flags {
+		keywords[flag] = true
+	}
+
+	for _, keyword := range mapping.allKeywords() {
+		if operation != imap.SetFlags && !keywords[keyword] {
+			continue
+		}
+
+		name, _ := mapping.labelName(keyword)
+		labelMailbox, err := im.storeAddress.GetMailbox(name)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case operation == imap.AddFlags, operation == imap.SetFlags && keywords[keyword]:
+			err = labelMailbox.LabelMessages(messageIDs)
+		case operation == imap.RemoveFlags:
+			err = labelMailbox.UnlabelMessages(messageIDs)
+		default:
+			// Only messages which have the label are unlabeled to not call
+			// API for every label when flags are replaced.
+			if labeled := im.filterMessagesWithLabel(messageIDs, labelMailbox.LabelID()); len(labeled) > 0 {
+				err = labelMailbox.UnlabelMessages(labeled)
+			}
+		}
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+func (im *imapMailbox) filterMessagesWithLabel(messageIDs []string, labelID string) (filtered []string) {
+	for _, messageID := range messageIDs {
+		storeMessage, err := im.storeMailbox.GetMessage(messageID)
+		if err != nil {
+			continue
+		}
+		if isStringInList(storeMessage.Message().LabelIDs, labelID) {
+			filtered = append(filtered, messageID)
+		}
+	}
+	return
+}
+
 // CopyMessages copies the specified message(s) to the end of the specified
 // destination mailbox. The flags and internal date of the message(s) SHOULD
 // be preserved, and the Recent flag SHOULD be set, in the copy.
-func (im *imapMailbox) CopyMessages(uid bool, seqSet *imap.SeqSet, targetLabel string) error {
+func (im *imapMailbox) CopyMessages(uid bool, seqSet *imap.SeqSet, targetLabel string) (err error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
+	defer im.checkAPIAvailability(&err)
+	defer im.startTrace("COPY", uid)(&err)
 
-	return im.labelMessages(uid, seqSet, targetLabel, false)
+	return im.labelMessages(uid, seqSet, targetLabel, false, nil)
 }
 
-// MoveMessages adds dest's label and removes this mailbox' label from each message.
-//
-// This should not be used until MOVE extension has option to send UIDPLUS
-// responses.
-func (im *imapMailbox) MoveMessages(uid bool, seqSet *imap.SeqSet, targetLabel string) error {
+// MoveMessages adds dest's label and removes this mailbox' label from each
+// message. COPYUID is sent in the tagged response. MOVE command uses
+// MoveMessagesWithCopyUID instead.
+func (im *imapMailbox) MoveMessages(uid bool, seqSet *imap.SeqSet, targetLabel string) (err error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+	defer im.checkAPIAvailability(&err)
+	defer im.startTrace("MOVE", uid)(&err)
+
+	return im.labelMessages(uid, seqSet, targetLabel, true, nil)
+}
+
+// MoveMessagesWithCopyUID moves messages the same way as MoveMessages but
+// passes COPYUID to copyUID before the messages are removed from this
+// mailbox, so the client can match them before it gets EXPUNGE responses.
+func (im *imapMailbox) MoveMessagesWithCopyUID(uid bool, seqSet *imap.SeqSet, targetLabel string, copyUID func(*imap.StatusResp) error) (err error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
+	defer im.checkAPIAvailability(&err)
+	defer im.startTrace("MOVE", uid)(&err)
 
-	return im.labelMessages(uid, seqSet, targetLabel, true)
+	return im.labelMessages(uid, seqSet, targetLabel, true, copyUID)
 }
 
-func (im *imapMailbox) labelMessages(uid bool, seqSet *imap.SeqSet, targetLabel string, move bool) error {
+func (im *imapMailbox) labelMessages(uid bool, seqSet *imap.SeqSet, targetLabel string, move bool, copyUID func(*imap.StatusResp) error) error {
+	if err := im.user.checkWritable(); err != nil {
+		return err
+	}
+
 	messageIDs, err := im.apiIDsFromSeqSet(uid, seqSet)
 	if err != nil || len(messageIDs) == 0 {
 		return err
 	}
 
-	// It is needed to get UID list before LabelingMessages because
-	// messages can be removed from source during labeling (e.g. folder1 -> folder2).
-	sourceSeqSet := im.storeMailbox.GetUIDList(messageIDs)
+	if isSnoozedMailboxPath(targetLabel) {
+		return im.snoozeMessages(messageIDs, targetLabel)
+	}
 
-	targetStoreMailbox, err := im.storeAddress.GetMailbox(targetLabel)
+	targetStoreMailbox, err := im.user.getStoreMailbox(im.user.mailboxMapping(), targetLabel)
 	if err != nil {
 		return err
 	}
 
+	// It is needed to get UID list before LabelingMessages because
+	// messages can be removed from source during labeling (e.g. folder1 -> folder2).
+	sourceSeqSet := im.storeMailbox.GetUIDList(messageIDs)
+
 	// Label messages first to not lose them. If message is only in trash and we unlabel
 	// it, it will be removed completely and we cannot label it back.
 	if err := targetStoreMailbox.LabelMessages(messageIDs); err != nil {
 		return err
 	}
+
+	targetSeqSet := targetStoreMailbox.GetUIDList(messageIDs)
+	if move && copyUID != nil {
+		if res := uidplus.MoveResponse(targetStoreMailbox.UIDValidity(), sourceSeqSet, targetSeqSet); res != nil {
+			if err := copyUID(res); err != nil {
+				return err
+			}
+		}
+	}
+
 	if move {
 		if err := im.storeMailbox.UnlabelMessages(messageIDs); err != nil {
 			return err
 		}
 	}
 
-	targetSeqSet := targetStoreMailbox.GetUIDList(messageIDs)
+	if copyUID != nil {
+		return nil
+	}
 	return uidplus.CopyResponse(targetStoreMailbox.UIDValidity(), sourceSeqSet, targetSeqSet)
 }
 
 // SearchMessages searches messages. The returned list must contain UIDs if
 // uid is set to true, or sequence numbers otherwise.
-func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria) (ids []uint32, err error) { //nolint[gocyclo]
+func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria) (ids []uint32, err error) {
+	return im.SearchMessagesBySaveDate(isUID, criteria, &savedate.SearchCriteria{})
+}
+
+// SearchMessagesBySaveDate searches messages the same way as SearchMessages
+// and additionally filters them by the date when they were saved to this
+// mailbox.
+func (im *imapMailbox) SearchMessagesBySaveDate(isUID bool, criteria *imap.SearchCriteria, saveDateCriteria *savedate.SearchCriteria) (ids []uint32, err error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
+	defer im.checkAPIAvailability(&err)
+	defer im.startTrace("SEARCH", isUID)(&err)
 
-	if criteria.Not != nil || criteria.Or != nil {
-		return nil, errors.New("unsupported search query")
+	storeMessages, err := im.searchStoreMessages(criteria, saveDateCriteria)
+	if err != nil {
+		return nil, err
 	}
 
-	if criteria.Body != nil || criteria.Text != nil {
-		log.Warn("Body and Text criteria not applied.")
+	for _, storeMessage := range storeMessages {
+		id, err := getMessageID(isUID, storeMessage)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// searchStoreMessages returns messages matching the criteria.
+func (im *imapMailbox) searchStoreMessages(criteria *imap.SearchCriteria, saveDateCriteria *savedate.SearchCriteria) (storeMessages []storeMessageProvider, err error) { //nolint[gocyclo,funlen]
+	if criteria.Not != nil || criteria.Or != nil {
+		return nil, errors.New("unsupported search query")
 	}
 
 	var apiIDs []string
+	var notIndexed []storeMessageProvider
 	if criteria.SeqNum != nil {
 		apiIDs, err = im.apiIDsFromSeqSet(false, criteria.SeqNum)
 	} else {
@@ -268,8 +424,18 @@ func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria)
 			}
 		}
 
+		if !saveDateCriteria.IsEmpty() {
+			saveDate := storeMessage.SaveDate()
+			if saveDate.IsZero() {
+				saveDate = time.Unix(m.Time, 0)
+			}
+			if !saveDateCriteria.Match(saveDate) {
+				continue
+			}
+		}
+
 		// Filter by headers.
-		header := message.GetHeader(m)
+		header := im.getMessageHeader(m)
 		headerMatch := true
 		for criteriaKey, criteriaValues := range criteria.Header {
 			for _, criteriaValue := range criteriaValues {
@@ -321,6 +487,22 @@ func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria)
 		if !m.Has(pmapi.FlagOpened) {
 			messageFlagsMap[imap.RecentFlag] = true
 		}
+		if isStringInList(m.LabelIDs, pmapi.SpamLabel) {
+			messageFlagsMap[message.AppleMailJunkFlag] = true
+			messageFlagsMap[message.ThunderbirdJunkFlag] = true
+		} else {
+			messageFlagsMap[message.ThunderbirdNonJunkFlag] = true
+			messageFlagsMap[message.NotJunkFlag] = true
+		}
+		if storeMessage.IsMarkedDeleted() {
+			messageFlagsMap[imap.DeletedFlag] = true
+		}
+		for _, keyword := range storeMessage.Keywords() {
+			messageFlagsMap[keyword] = true
+		}
+		for _, keyword := range im.user.mailboxMapping().keywords(m.LabelIDs) {
+			messageFlagsMap[keyword] = true
+		}
 
 		flagMatch := true
 		for _, flag := range criteria.WithFlags {
@@ -349,23 +531,71 @@ func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria)
 			}
 		}
 
-		// Add the ID to response.
-		var id uint32
-		if isUID {
-			id, err = storeMessage.UID()
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			id, err = storeMessage.SequenceNumber()
-			if err != nil {
-				return nil, err
+		// Filter by full-text index as the last one because messages which
+		// are not indexed yet have to be built first.
+		if len(criteria.Body) > 0 || len(criteria.Text) > 0 {
+			if im.storeUser.IsMessageIndexed(apiID) {
+				if !im.storeUser.MatchMessage(apiID, criteria.Body, criteria.Text) {
+					continue
+				}
+			} else {
+				notIndexed = append(notIndexed, storeMessage)
+				if !im.matchMessageBody(storeMessage, criteria.Body, criteria.Text) {
+					continue
+				}
 			}
 		}
-		ids = append(ids, id)
+
+		storeMessages = append(storeMessages, storeMessage)
 	}
 
-	return ids, nil
+	if len(notIndexed) > 0 {
+		im.user.indexMessagesInBackground(im, notIndexed)
+	}
+
+	return storeMessages, nil
+}
+
+// getMessageID returns UID or sequence number of the message.
+func getMessageID(isUID bool, storeMessage storeMessageProvider) (uint32, error) {
+	if isUID {
+		return storeMessage.UID()
+	}
+	return storeMessage.SequenceNumber()
+}
+
+// matchMessageBody searches the message which is not in the full-text
+// index yet by the substring match of its content.
+func (im *imapMailbox) matchMessageBody(storeMessage storeMessageProvider, body, text []string) bool {
+	msgBody, ok := im.getMessageBody(storeMessage)
+	if !ok {
+		return false
+	}
+	return im.storeUser.MatchMessageBody(msgBody, body, text)
+}
+
+// indexMessage builds the message and adds it to the full-text index.
+func (im *imapMailbox) indexMessage(storeMessage storeMessageProvider) {
+	if body, ok := im.getMessageBody(storeMessage); ok {
+		im.storeUser.IndexMessage(storeMessage.ID(), body)
+	}
+}
+
+func (im *imapMailbox) getMessageBody(storeMessage storeMessageProvider) ([]byte, bool) {
+	_, msgBody, err := im.getBodyStructure(context.Background(), storeMessage)
+	if err != nil || msgBody == nil {
+		im.log.WithError(err).WithField("msgID", storeMessage.ID()).Warn("Cannot build message for search")
+		return nil, false
+	}
+	defer closeMessageBody(msgBody)
+
+	body, err := ioutil.ReadAll(io.NewSectionReader(msgBody, 0, msgBody.Size()))
+	if err != nil {
+		im.log.WithError(err).WithField("msgID", storeMessage.ID()).Warn("Cannot read message for search")
+		return nil, false
+	}
+
+	return body, true
 }
 
 // ListMessages returns a list of messages. seqset must be interpreted as UIDs
@@ -373,20 +603,31 @@ func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria)
 // 3501 section 6.4.5 for a list of items that can be requested.
 //
 // Messages must be sent to msgResponse. When the function returns, msgResponse must be closed.
-func (im *imapMailbox) ListMessages(isUID bool, seqSet *imap.SeqSet, items []imap.FetchItem, msgResponse chan<- *imap.Message) (err error) { //nolint[funlen]
+func (im *imapMailbox) ListMessages(isUID bool, seqSet *imap.SeqSet, items []imap.FetchItem, msgResponse chan<- *imap.Message) error {
+	return im.ListMessagesContext(context.Background(), isUID, seqSet, items, msgResponse)
+}
+
+// ListMessagesContext is like ListMessages but downloading and building of
+// messages stops once ctx is done, e.g. when the client disconnects.
+func (im *imapMailbox) ListMessagesContext(ctx context.Context, isUID bool, seqSet *imap.SeqSet, items []imap.FetchItem, msgResponse chan<- *imap.Message) (err error) { //nolint[funlen]
+	l := tracing.Logger(ctx, log.WithField("cmd", "ListMessages"))
+
 	defer func() {
 		close(msgResponse)
 		if err != nil {
-			log.Errorf("cannot list messages (%v, %v, %v): %v", isUID, seqSet, items, err)
+			l.Errorf("cannot list messages (%v, %v, %v): %v", isUID, seqSet, items, err)
 		}
 		// Called from go-imap in goroutines - we need to handle panics for each function.
 		im.panicHandler.HandlePanic()
 	}()
+	defer im.checkAPIAvailability(&err)
+	defer im.startTraceContext(ctx, "FETCH", isUID)(&err)
 
 	var markAsReadIDs []string
 	markAsReadMutex := &sync.Mutex{}
 
-	l := log.WithField("cmd", "ListMessages")
+	// Messages can be read during maintenance but flags stay untouched.
+	isReadOnly := im.user.checkWritable() != nil
 
 	apiIDs, err := im.apiIDsFromSeqSet(isUID, seqSet)
 	if err != nil {
@@ -412,24 +653,46 @@ func (im *imapMailbox) ListMessages(isUID bool, seqSet *imap.SeqSet, items []ima
 		input[i] = apiID
 	}
 
-	processCallback := func(value interface{}) (interface{}, error) {
+	downloadCallback := func(value interface{}) (interface{}, error) {
 		apiID := value.(string)
 
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		endStore := im.getTrace().message(apiID).begin(phaseStore)
 		storeMessage, err := im.storeMailbox.GetMessage(apiID)
+		endStore()
 		if err != nil {
 			err = fmt.Errorf("list message from db: %v", err)
 			l.WithField("apiID", apiID).Error(err)
 			return nil, err
 		}
 
-		msg, err := im.getMessage(storeMessage, items)
+		if needsMessageBody(items, storeMessage.Message()) {
+			if err := im.prefetchMessage(ctx, storeMessage); err != nil {
+				err = fmt.Errorf("list message prefetch: %v", err)
+				l.WithField("metaID", storeMessage.ID()).Error(err)
+				return nil, err
+			}
+		}
+
+		return storeMessage, nil
+	}
+
+	buildCallback := func(value interface{}) (interface{}, error) {
+		storeMessage := value.(storeMessageProvider)
+		defer im.takePrefetchedMessage(storeMessage.ID())
+		defer im.getTrace().message(storeMessage.ID()).begin(phaseBuild)()
+
+		msg, err := im.getMessage(ctx, storeMessage, items)
 		if err != nil {
 			err = fmt.Errorf("list message build: %v", err)
 			l.WithField("metaID", storeMessage.ID()).Error(err)
 			return nil, err
 		}
 
-		if storeMessage.Message().Unread == 1 {
+		if storeMessage.Message().Unread == 1 && !isReadOnly {
 			for section := range msg.Body {
 				// Peek means get messages without marking them as read.
 				// If client does not only ask for peek, we have to mark them as read.
@@ -448,12 +711,19 @@ func (im *imapMailbox) ListMessages(isUID bool, seqSet *imap.SeqSet, items []ima
 
 	collectCallback := func(idx int, value interface{}) error {
 		msg := value.(*imap.Message)
-		msgResponse <- msg
-		return nil
+		select {
+		case msgResponse <- msg:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 
-	err = parallel.RunParallel(fetchMessagesWorkers, input, processCallback, collectCallback)
+	err = fetch.Run(fetch.GetOptions(), input, downloadCallback, buildCallback, collectCallback)
 	if err != nil {
+		for _, apiID := range apiIDs {
+			im.takePrefetchedMessage(apiID)
+		}
 		return err
 	}
 
@@ -465,6 +735,82 @@ func (im *imapMailbox) ListMessages(isUID bool, seqSet *imap.SeqSet, items []ima
 	return nil
 }
 
+// needsMessageBody returns whether any of the FETCH items requires
+// the whole message to be downloaded and built.
+func needsMessageBody(items []imap.FetchItem, m *pmapi.Message) bool {
+	for _, item := range items {
+		switch item {
+		case imap.FetchBody, imap.FetchBodyStructure:
+			return true
+		case imap.FetchRFC822Size:
+			// Size is known once the message was built.
+			if m.Size <= 0 {
+				return true
+			}
+			continue
+		case imap.FetchEnvelope, imap.FetchFlags, imap.FetchInternalDate, imap.FetchUid, savedate.FetchSaveDate:
+			continue
+		}
+
+		section, err := imap.ParseBodySectionName(item)
+		if err != nil {
+			continue
+		}
+		// Header of the whole message is built from metadata.
+		if len(section.Path) != 0 || section.Specifier != imap.HeaderSpecifier {
+			return true
+		}
+	}
+	return false
+}
+
+// prefetchMessage downloads the message so the building doesn't have to
+// wait for it. Nothing is downloaded when the message is already built in
+// the in-memory cache or stored in the on-disk cache.
+func (im *imapMailbox) prefetchMessage(ctx context.Context, storeMessage storeMessageProvider) error {
+	m := storeMessage.Message()
+
+	timer := im.getTrace().message(m.ID)
+	defer timer.begin(phaseStore)()
+
+	if !isMessageInDraftFolder(m) {
+		if bodyReader, structure := cache.LoadMail(im.storeUser.UserID() + m.ID); bodyReader.Len() != 0 && structure != nil {
+			return nil
+		}
+		if bodyReader, structure := im.loadCachedMessage(storeMessage); bodyReader.Len() != 0 && structure != nil {
+			return nil
+		}
+	}
+
+	endAPI := timer.begin(phaseAPI)
+	complete, err := im.storeMailbox.FetchMessage(ctx, m.ID)
+	endAPI()
+	if err != nil {
+		return err
+	}
+
+	im.prefetchedLock.Lock()
+	defer im.prefetchedLock.Unlock()
+	im.prefetched[m.ID] = complete.Message()
+
+	return nil
+}
+
+// takePrefetchedMessage returns the prefetched message and forgets it, so
+// any following build downloads a fresh copy. It returns nil when the
+// message was not prefetched.
+func (im *imapMailbox) takePrefetchedMessage(apiID string) *pmapi.Message {
+	im.prefetchedLock.Lock()
+	defer im.prefetchedLock.Unlock()
+
+	m, ok := im.prefetched[apiID]
+	if !ok {
+		return nil
+	}
+	delete(im.prefetched, apiID)
+	return m
+}
+
 // apiIDsFromSeqSet takes an IMAP sequence set (which can contain either
 // sequence numbers or UIDs) and returns all known API IDs in this range.
 func (im *imapMailbox) apiIDsFromSeqSet(uid bool, seqSet *imap.SeqSet) ([]string, error) {
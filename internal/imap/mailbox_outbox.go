@@ -0,0 +1,643 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/mail"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/emersion/go-imap"
+	goIMAPBackend "github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/backendutil"
+	gomessage "github.com/emersion/go-message"
+	"github.com/emersion/go-message/textproto"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// scheduledMailboxName lists messages in the outbox which are sent
+	// later. Deleting the message cancels the sending and moving it to
+	// outboxMailboxName sends it right away.
+	scheduledMailboxName = "Scheduled"
+
+	// outboxMailboxName lists messages in the outbox which are due but not
+	// sent yet, e.g. because API is not reachable.
+	outboxMailboxName = "Outbox"
+
+	outboxUIDValidity = 1
+)
+
+// isOutboxMailboxName returns whether the name belongs to a virtual mailbox
+// listing the outbox. Such names cannot be used by custom mailboxes.
+func isOutboxMailboxName(name string) bool {
+	return name == scheduledMailboxName || name == outboxMailboxName
+}
+
+// imapOutboxMailbox lists messages waiting in the outbox of the store to be
+// sent by SMTP backend. Messages are kept only locally, so the mailbox has
+// its own UIDs and flags are not stored.
+type imapOutboxMailbox struct {
+	panicHandler panicHandler
+	user         *imapUser
+	name         string
+
+	log *logrus.Entry
+
+	// deleted holds IDs of messages flagged as \Deleted until they are
+	// expunged, if the expunge is deferred.
+	deleted     map[string]bool
+	deletedLock *sync.Mutex
+}
+
+func newIMAPOutboxMailbox(panicHandler panicHandler, user *imapUser, name string) *imapOutboxMailbox {
+	return &imapOutboxMailbox{
+		panicHandler: panicHandler,
+		user:         user,
+		name:         name,
+
+		log: log.
+			WithField("addressID", user.storeAddress.AddressID()).
+			WithField("userID", user.storeUser.UserID()).
+			WithField("mailbox", name),
+
+		deleted:     map[string]bool{},
+		deletedLock: &sync.Mutex{},
+	}
+}
+
+// outboxEntry is the scheduled message with its sequence number.
+type outboxEntry struct {
+	seqNum uint32
+	msg    *store.ScheduledMessage
+}
+
+// filterOutboxMessages returns messages listed in the mailbox ordered by
+// UID. Empty address means messages of all addresses are listed.
+func filterOutboxMessages(msgs []*store.ScheduledMessage, mailboxName, address string, now time.Time) (entries []outboxEntry) {
+	for _, msg := range msgs {
+		// Messages queued by older versions have no UID. They are sent
+		// without being listed.
+		if msg.UID == 0 {
+			continue
+		}
+		if address != "" && !strings.EqualFold(msg.From, address) {
+			continue
+		}
+		if msg.SendAt.After(now) != (mailboxName == scheduledMailboxName) {
+			continue
+		}
+		entries = append(entries, outboxEntry{msg: msg})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].msg.UID < entries[j].msg.UID
+	})
+	for i := range entries {
+		entries[i].seqNum = uint32(i + 1)
+	}
+	return entries
+}
+
+// selectOutboxEntries returns entries in the sequence set.
+func selectOutboxEntries(entries []outboxEntry, isUID bool, seqSet *imap.SeqSet) (selected []outboxEntry) {
+	ids := make([]uint32, len(entries))
+	for i, entry := range entries {
+		if isUID {
+			ids[i] = entry.msg.UID
+		} else {
+			ids[i] = entry.seqNum
+		}
+	}
+
+	for _, i := range selectSeqSet(ids, seqSet) {
+		selected = append(selected, entries[i])
+	}
+	return selected
+}
+
+// selectSeqSet returns indexes of ascending IDs (UIDs or sequence numbers)
+// of virtual mailbox which are in the sequence set. The star stands for
+// the last ID (RFC 3501, section 9).
+func selectSeqSet(ids []uint32, seqSet *imap.SeqSet) (selected []int) {
+	if len(ids) == 0 || seqSet == nil {
+		return nil
+	}
+
+	last := ids[len(ids)-1]
+
+	for i, id := range ids {
+		for _, seq := range seqSet.Set {
+			start, stop := seq.Start, seq.Stop
+			if start == 0 {
+				start = last
+			}
+			if stop == 0 {
+				stop = last
+			}
+			if start > stop {
+				start, stop = stop, start
+			}
+			if start <= id && id <= stop {
+				selected = append(selected, i)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+func (im *imapOutboxMailbox) getEntries() ([]outboxEntry, error) {
+	msgs, err := im.user.storeUser.GetScheduledMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	address := ""
+	if !im.user.user.IsCombinedAddressMode() {
+		address = im.user.storeAddress.AddressString()
+	}
+
+	return filterOutboxMessages(msgs, im.name, address, time.Now()), nil
+}
+
+func (im *imapOutboxMailbox) getSelectedEntries(isUID bool, seqSet *imap.SeqSet) ([]outboxEntry, error) {
+	entries, err := im.getEntries()
+	if err != nil {
+		return nil, err
+	}
+	return selectOutboxEntries(entries, isUID, seqSet), nil
+}
+
+func (im *imapOutboxMailbox) decrypt(msg *store.ScheduledMessage) ([]byte, error) {
+	addr := im.user.client().Addresses().ByEmail(msg.From)
+	if addr == nil {
+		return nil, errors.New("sender address does not exist anymore")
+	}
+
+	kr, err := im.user.client().KeyRingForAddressID(addr.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg.Decrypt(kr)
+}
+
+func (im *imapOutboxMailbox) getFlags(msg *store.ScheduledMessage) []string {
+	im.deletedLock.Lock()
+	defer im.deletedLock.Unlock()
+
+	flags := []string{imap.SeenFlag}
+	if im.deleted[msg.ID] {
+		flags = append(flags, imap.DeletedFlag)
+	}
+	return flags
+}
+
+// Name returns this mailbox name.
+func (im *imapOutboxMailbox) Name() string {
+	return im.name
+}
+
+// Info returns this mailbox info.
+func (im *imapOutboxMailbox) Info() (*imap.MailboxInfo, error) {
+	return &imap.MailboxInfo{
+		Attributes: []string{imap.NoInferiorsAttr},
+		Delimiter:  store.PathDelimiter,
+		Name:       im.name,
+	}, nil
+}
+
+// Status returns this mailbox status.
+func (im *imapOutboxMailbox) Status(items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	entries, err := im.getEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	status := imap.NewMailboxStatus(im.name, items)
+	status.UidValidity = outboxUIDValidity
+	status.PermanentFlags = []string{imap.DeletedFlag, strings.ToUpper(imap.DeletedFlag)}
+	status.Messages = uint32(len(entries))
+
+	if status.UidNext, err = im.user.storeUser.GetScheduledMessagesNextUID(); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// SetSubscribed does nothing, the mailbox is always listed.
+func (im *imapOutboxMailbox) SetSubscribed(_ bool) error {
+	return nil
+}
+
+// Check is equivalent to NOOP, there is no housekeeping.
+func (im *imapOutboxMailbox) Check() error {
+	return nil
+}
+
+// ListMessages returns messages in the sequence set. Messages are decrypted
+// only when the body is requested.
+func (im *imapOutboxMailbox) ListMessages(isUID bool, seqSet *imap.SeqSet, items []imap.FetchItem, msgResponse chan<- *imap.Message) (err error) {
+	defer func() {
+		close(msgResponse)
+		// Called from go-imap in goroutines - we need to handle panics for each function.
+		im.panicHandler.HandlePanic()
+	}()
+
+	entries, err := im.getSelectedEntries(isUID, seqSet)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		msg, err := im.getMessage(entry, items)
+		if err != nil {
+			im.log.WithError(err).WithField("id", entry.msg.ID).Error("Cannot fetch scheduled message")
+			continue
+		}
+		msgResponse <- msg
+	}
+
+	return nil
+}
+
+func (im *imapOutboxMailbox) getMessage(entry outboxEntry, items []imap.FetchItem) (*imap.Message, error) {
+	var body []byte
+	getHeaderAndBody := func() (textproto.Header, *bufio.Reader, error) {
+		if body == nil {
+			var err error
+			if body, err = im.decrypt(entry.msg); err != nil {
+				return textproto.Header{}, nil, err
+			}
+		}
+		reader := bufio.NewReader(bytes.NewReader(body))
+		header, err := textproto.ReadHeader(reader)
+		return header, reader, err
+	}
+
+	msg := imap.NewMessage(entry.seqNum, items)
+	for _, item := range items {
+		switch item {
+		case imap.FetchUid:
+			msg.Uid = entry.msg.UID
+		case imap.FetchFlags:
+			msg.Flags = im.getFlags(entry.msg)
+		case imap.FetchInternalDate:
+			msg.InternalDate = entry.msg.SendAt
+		case imap.FetchRFC822Size:
+			if _, _, err := getHeaderAndBody(); err != nil {
+				return nil, err
+			}
+			msg.Size = uint32(len(body))
+		case imap.FetchEnvelope:
+			header, _, err := getHeaderAndBody()
+			if err != nil {
+				return nil, err
+			}
+			if msg.Envelope, err = backendutil.FetchEnvelope(header); err != nil {
+				return nil, err
+			}
+		case imap.FetchBody, imap.FetchBodyStructure:
+			header, reader, err := getHeaderAndBody()
+			if err != nil {
+				return nil, err
+			}
+			if msg.BodyStructure, err = backendutil.FetchBodyStructure(header, reader, item == imap.FetchBodyStructure); err != nil {
+				return nil, err
+			}
+		default:
+			section, err := imap.ParseBodySectionName(item)
+			if err != nil {
+				continue
+			}
+			header, reader, err := getHeaderAndBody()
+			if err != nil {
+				return nil, err
+			}
+			if msg.Body[section], err = backendutil.FetchBodySection(header, reader, section); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return msg, nil
+}
+
+// SearchMessages searches messages. Every message is decrypted because the
+// store does not index the outbox.
+func (im *imapOutboxMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria) (ids []uint32, err error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	entries, err := im.getEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		body, err := im.decrypt(entry.msg)
+		if err != nil {
+			return nil, err
+		}
+
+		entity, err := gomessage.Read(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := backendutil.Match(entity, entry.seqNum, entry.msg.UID, entry.msg.SendAt, im.getFlags(entry.msg), criteria)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		if isUID {
+			ids = append(ids, entry.msg.UID)
+		} else {
+			ids = append(ids, entry.seqNum)
+		}
+	}
+
+	return ids, nil
+}
+
+// CreateMessage schedules the message. The time is taken from the header
+// X-Pm-Scheduled-Time or from the internal date. Messages appended to the
+// Outbox are sent right away.
+func (im *imapOutboxMailbox) CreateMessage(_ []string, date time.Time, literal imap.Literal) (err error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	if err := im.user.checkWritable(); err != nil {
+		return err
+	}
+
+	body, err := ioutil.ReadAll(literal)
+	if err != nil {
+		return err
+	}
+
+	header, err := textproto.ReadHeader(bufio.NewReader(bytes.NewReader(body)))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	sendAt := now
+	if im.name == scheduledMailboxName {
+		sendAt = date
+		if scheduledTime, ok := message.ParseScheduledTime(header.Get(message.ScheduledTimeHeader)); ok {
+			sendAt = scheduledTime
+		}
+		if !sendAt.After(now) {
+			return errors.New("scheduled time has to be in the future")
+		}
+	}
+
+	from, err := mail.ParseAddress(header.Get("From"))
+	if err != nil {
+		return errors.Wrap(err, "invalid sender")
+	}
+
+	var to []string
+	for _, key := range []string{"To", "Cc", "Bcc"} {
+		if header.Get(key) == "" {
+			continue
+		}
+		addresses, err := mail.ParseAddressList(header.Get(key))
+		if err != nil {
+			return errors.Wrap(err, "invalid recipients")
+		}
+		for _, address := range addresses {
+			to = append(to, address.Address)
+		}
+	}
+	if len(to) == 0 {
+		return errors.New("message has no recipients")
+	}
+
+	addr := im.user.client().Addresses().ByEmail(from.Address)
+	if addr == nil {
+		return errors.New("invalid email address: not owned by user")
+	}
+
+	kr, err := im.user.client().KeyRingForAddressID(addr.ID)
+	if err != nil {
+		return err
+	}
+
+	id, err := im.user.storeUser.ScheduleMessage(kr, sendAt, addr.Email, to, body)
+	if err != nil {
+		return err
+	}
+
+	im.log.WithField("id", id).WithField("sendAt", sendAt).Info("Message scheduled by IMAP client")
+	return nil
+}
+
+// UpdateMessagesFlags handles only the \Deleted flag which cancels the
+// sending. Other flags are not stored.
+func (im *imapOutboxMailbox) UpdateMessagesFlags(isUID bool, seqSet *imap.SeqSet, operation imap.FlagsOp, flags []string) error {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	if err := im.user.checkWritable(); err != nil {
+		return err
+	}
+
+	hasDeleted := false
+	for _, flag := range flags {
+		if strings.EqualFold(flag, imap.DeletedFlag) {
+			hasDeleted = true
+		}
+	}
+
+	var deleted bool
+	switch {
+	case operation == imap.RemoveFlags && hasDeleted:
+		deleted = false
+	case operation != imap.SetFlags && !hasDeleted:
+		return nil
+	default:
+		deleted = hasDeleted
+	}
+
+	entries, err := im.getSelectedEntries(isUID, seqSet)
+	if err != nil {
+		return err
+	}
+
+	if isDeferredExpunge() {
+		im.deletedLock.Lock()
+		defer im.deletedLock.Unlock()
+
+		for _, entry := range entries {
+			if deleted {
+				im.deleted[entry.msg.ID] = true
+			} else {
+				delete(im.deleted, entry.msg.ID)
+			}
+		}
+		return nil
+	}
+
+	if !deleted {
+		return nil
+	}
+	return im.removeEntries(entries)
+}
+
+// CopyMessages queues the copy of messages to be sent right away when the
+// destination is the Outbox.
+func (im *imapOutboxMailbox) CopyMessages(isUID bool, seqSet *imap.SeqSet, dest string) error {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	return im.sendNow(isUID, seqSet, dest, false)
+}
+
+// MoveMessages sends messages right away when the destination is the Outbox.
+func (im *imapOutboxMailbox) MoveMessages(isUID bool, seqSet *imap.SeqSet, dest string) error {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	return im.sendNow(isUID, seqSet, dest, true)
+}
+
+func (im *imapOutboxMailbox) sendNow(isUID bool, seqSet *imap.SeqSet, dest string, move bool) error {
+	if err := im.user.checkWritable(); err != nil {
+		return err
+	}
+
+	if im.name != scheduledMailboxName || dest != outboxMailboxName {
+		return errors.New("scheduled messages can be only moved or copied to " + outboxMailboxName)
+	}
+
+	entries, err := im.getSelectedEntries(isUID, seqSet)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+
+		if !move {
+			if _, _, err := im.user.storeUser.CopyScheduledMessage(entry.msg.ID, now); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, _, err := im.user.storeUser.RescheduleMessage(entry.msg.ID, now); err != nil {
+			return err
+		}
+		im.sendExpungeUpdate(entry.seqNum)
+	}
+
+	return nil
+}
+
+// Expunge removes messages flagged as \Deleted, if the expunge is deferred.
+func (im *imapOutboxMailbox) Expunge() error {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	return im.expunge(nil)
+}
+
+// UIDExpunge removes only messages flagged as \Deleted in the UID set.
+func (im *imapOutboxMailbox) UIDExpunge(seqSet *imap.SeqSet) error {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	return im.expunge(seqSet)
+}
+
+func (im *imapOutboxMailbox) expunge(uidSet *imap.SeqSet) error {
+	if err := im.user.checkWritable(); err != nil {
+		return err
+	}
+
+	entries, err := im.getEntries()
+	if err != nil {
+		return err
+	}
+	if uidSet != nil {
+		entries = selectOutboxEntries(entries, true, uidSet)
+	}
+
+	im.deletedLock.Lock()
+	deleted := []outboxEntry{}
+	for _, entry := range entries {
+		if im.deleted[entry.msg.ID] {
+			deleted = append(deleted, entry)
+			delete(im.deleted, entry.msg.ID)
+		}
+	}
+	im.deletedLock.Unlock()
+
+	return im.removeEntries(deleted)
+}
+
+// removeEntries cancels sending of the messages. Entries are removed from
+// the last one so the sequence numbers in expunge updates stay valid.
+func (im *imapOutboxMailbox) removeEntries(entries []outboxEntry) error {
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if err := im.user.storeUser.RemoveScheduledMessage(entry.msg.ID); err != nil {
+			return err
+		}
+		im.log.WithField("id", entry.msg.ID).Info("Scheduled message canceled by IMAP client")
+		im.sendExpungeUpdate(entry.seqNum)
+	}
+	return nil
+}
+
+// sendExpungeUpdate notifies clients which selected the mailbox. The store
+// does not know about the mailbox, so the update is sent here directly.
+func (im *imapOutboxMailbox) sendExpungeUpdate(seqNum uint32) {
+	if im.user.backend == nil {
+		return
+	}
+
+	update := new(goIMAPBackend.ExpungeUpdate)
+	update.Update = goIMAPBackend.NewUpdate(im.user.Username(), im.name)
+	update.SeqNum = seqNum
+
+	select {
+	case <-time.After(1 * time.Second):
+		im.log.Error("Could not send IMAP update (timeout)")
+	case im.user.backend.updates <- update:
+	}
+}
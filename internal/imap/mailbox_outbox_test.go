@@ -0,0 +1,82 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/require"
+)
+
+func getOutboxUIDs(entries []outboxEntry) (uids []uint32) {
+	for _, entry := range entries {
+		uids = append(uids, entry.msg.UID)
+	}
+	return
+}
+
+func TestFilterOutboxMessages(t *testing.T) {
+	now := time.Now()
+	msgs := []*store.ScheduledMessage{
+		{ID: "due", UID: 4, From: "user@pm.me", SendAt: now.Add(-time.Minute)},
+		{ID: "legacy", From: "user@pm.me", SendAt: now.Add(time.Minute)},
+		{ID: "soon", UID: 3, From: "User@pm.me", SendAt: now.Add(time.Minute)},
+		{ID: "later", UID: 1, From: "user@pm.me", SendAt: now.Add(time.Hour)},
+		{ID: "alias", UID: 2, From: "alias@pm.me", SendAt: now.Add(time.Hour)},
+	}
+
+	scheduled := filterOutboxMessages(msgs, scheduledMailboxName, "", now)
+	require.Equal(t, []uint32{1, 2, 3}, getOutboxUIDs(scheduled))
+	require.Equal(t, uint32(3), scheduled[2].seqNum)
+
+	require.Equal(t, []uint32{1, 3}, getOutboxUIDs(filterOutboxMessages(msgs, scheduledMailboxName, "user@pm.me", now)))
+	require.Equal(t, []uint32{4}, getOutboxUIDs(filterOutboxMessages(msgs, outboxMailboxName, "user@pm.me", now)))
+	require.Empty(t, filterOutboxMessages(msgs, outboxMailboxName, "alias@pm.me", now))
+}
+
+func TestSelectOutboxEntries(t *testing.T) {
+	entries := []outboxEntry{
+		{seqNum: 1, msg: &store.ScheduledMessage{UID: 3}},
+		{seqNum: 2, msg: &store.ScheduledMessage{UID: 5}},
+		{seqNum: 3, msg: &store.ScheduledMessage{UID: 8}},
+	}
+
+	tests := []struct {
+		isUID  bool
+		seqSet string
+		want   []uint32
+	}{
+		{false, "1:2", []uint32{3, 5}},
+		{false, "*", []uint32{8}},
+		{false, "2:*", []uint32{5, 8}},
+		{true, "4:8", []uint32{5, 8}},
+		{true, "3,8", []uint32{3, 8}},
+		{true, "10:*", []uint32{8}},
+		{true, "10", nil},
+	}
+	for _, tc := range tests {
+		seqSet, err := imap.ParseSeqSet(tc.seqSet)
+		require.NoError(t, err)
+		require.Equal(t, tc.want, getOutboxUIDs(selectOutboxEntries(entries, tc.isUID, seqSet)), tc.seqSet)
+	}
+
+	require.Empty(t, selectOutboxEntries(nil, false, &imap.SeqSet{}))
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/pkg/errors"
+)
+
+// sendReadReceipts queues read receipts requested by the messages in the
+// outbox, from where they are sent by SMTP backend. The messages get the
+// $MDNSent keyword so no other client sends the receipt again.
+func (im *imapMailbox) sendReadReceipts(messageIDs []string) {
+	for _, apiID := range messageIDs {
+		if err := im.sendReadReceipt(apiID); err != nil {
+			im.log.WithError(err).WithField("messageID", apiID).Warn("Cannot send read receipt")
+		}
+	}
+}
+
+func (im *imapMailbox) sendReadReceipt(apiID string) error {
+	storeMessage, err := im.storeMailbox.FetchMessage(context.Background(), apiID)
+	if err != nil {
+		return err
+	}
+	for _, keyword := range storeMessage.Keywords() {
+		if keyword == message.MDNSentFlag {
+			return nil
+		}
+	}
+
+	m := storeMessage.Message()
+	addr := im.user.client().Addresses().ByID(m.AddressID)
+	if addr == nil {
+		return errors.New("address of the message does not exist")
+	}
+
+	to, body, err := message.BuildMDN(m, addr.Email, time.Now())
+	if err != nil {
+		return err
+	}
+
+	kr, err := im.user.client().KeyRingForAddressID(addr.ID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := im.storeUser.ScheduleMessage(kr, time.Now(), addr.Email, []string{to}, body); err != nil {
+		return err
+	}
+	return im.storeUser.AddKeyword([]string{apiID}, message.MDNSentFlag)
+}
@@ -0,0 +1,486 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/imap/savedate"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/emersion/go-imap"
+	goIMAPBackend "github.com/emersion/go-imap/backend"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// snoozedMailboxName lists all snoozed messages. Its children, e.g.
+	// `Snoozed/Tomorrow`, list messages snoozed till the target in the name.
+	// Moving a message to a child snoozes it, moving it out of Snoozed
+	// cancels the snoozing.
+	snoozedMailboxName = "Snoozed"
+
+	snoozedUIDValidity = 1
+)
+
+// isSnoozedMailboxPath returns whether the name is Snoozed or any mailbox
+// in it. Such names cannot be used by custom mailboxes.
+func isSnoozedMailboxPath(name string) bool {
+	return name == snoozedMailboxName || strings.HasPrefix(name, snoozedMailboxName+store.PathDelimiter)
+}
+
+// isSnoozedMailboxName returns whether the name belongs to a virtual mailbox
+// listing snoozed messages, i.e., it is Snoozed or it has a valid target.
+func isSnoozedMailboxName(name string) bool {
+	if name == snoozedMailboxName {
+		return true
+	}
+	if !isSnoozedMailboxPath(name) {
+		return false
+	}
+	_, err := store.ParseSnoozeTarget(getSnoozeTarget(name), time.Now())
+	return err == nil
+}
+
+// getSnoozeTarget returns the target from the name of the mailbox in
+// Snoozed or empty string for Snoozed itself.
+func getSnoozeTarget(name string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(name, snoozedMailboxName), store.PathDelimiter)
+}
+
+// snoozeMessages hides messages until the time of the target in the name
+// of the Snoozed mailbox. Messages are moved out of the mailbox even when
+// they are copied because snoozed messages must not stay in Inbox.
+func (im *imapMailbox) snoozeMessages(messageIDs []string, targetName string) error {
+	target := getSnoozeTarget(targetName)
+	if target == "" {
+		return errors.New("messages can be snoozed only to mailboxes in " + snoozedMailboxName)
+	}
+
+	wakeAt, err := store.ParseSnoozeTarget(target, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return im.storeMailbox.SnoozeMessages(messageIDs, target, wakeAt)
+}
+
+// imapSnoozedMailbox lists snoozed messages. Messages are built from All Mail
+// but the mailbox has its own UIDs. Flags \Seen and \Flagged are changed
+// for the message, \Deleted is ignored as moving the message out of the
+// mailbox is the only way to remove it.
+type imapSnoozedMailbox struct {
+	panicHandler panicHandler
+	user         *imapUser
+	name         string
+	target       string
+
+	log *logrus.Entry
+}
+
+func newIMAPSnoozedMailbox(panicHandler panicHandler, user *imapUser, name string) *imapSnoozedMailbox {
+	return &imapSnoozedMailbox{
+		panicHandler: panicHandler,
+		user:         user,
+		name:         name,
+		target:       getSnoozeTarget(name),
+
+		log: log.
+			WithField("addressID", user.storeAddress.AddressID()).
+			WithField("userID", user.storeUser.UserID()).
+			WithField("mailbox", name),
+	}
+}
+
+// snoozedEntry is the snoozed message with its sequence number.
+type snoozedEntry struct {
+	seqNum uint32
+	msg    *store.SnoozedMessage
+}
+
+// filterSnoozedMessages returns messages listed in the mailbox of the target
+// ordered by UID. Empty target means all messages are listed, empty address
+// ID means messages of all addresses are listed.
+func filterSnoozedMessages(msgs []*store.SnoozedMessage, target, addressID string) (entries []snoozedEntry) {
+	for _, msg := range msgs {
+		if target != "" && !strings.EqualFold(msg.Target, target) {
+			continue
+		}
+		if addressID != "" && msg.AddressID != addressID {
+			continue
+		}
+		entries = append(entries, snoozedEntry{seqNum: uint32(len(entries) + 1), msg: msg})
+	}
+	return entries
+}
+
+func (im *imapSnoozedMailbox) getEntries() ([]snoozedEntry, error) {
+	msgs, err := im.user.storeUser.GetSnoozedMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	addressID := ""
+	if !im.user.user.IsCombinedAddressMode() {
+		addressID = im.user.storeAddress.AddressID()
+	}
+
+	return filterSnoozedMessages(msgs, im.target, addressID), nil
+}
+
+func (im *imapSnoozedMailbox) getSelectedEntries(isUID bool, seqSet *imap.SeqSet) (selected []snoozedEntry, err error) {
+	entries, err := im.getEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint32, len(entries))
+	for i, entry := range entries {
+		if isUID {
+			ids[i] = entry.msg.UID
+		} else {
+			ids[i] = entry.seqNum
+		}
+	}
+
+	for _, i := range selectSeqSet(ids, seqSet) {
+		selected = append(selected, entries[i])
+	}
+	return selected, nil
+}
+
+func getSnoozedMessageIDs(entries []snoozedEntry) (apiIDs []string) {
+	for _, entry := range entries {
+		apiIDs = append(apiIDs, entry.msg.MessageID)
+	}
+	return
+}
+
+// getAllMail returns All Mail which builds the snoozed messages.
+func (im *imapSnoozedMailbox) getAllMail() (*imapMailbox, error) {
+	for _, storeMailbox := range im.user.storeAddress.ListMailboxes() {
+		if storeMailbox.LabelID() == pmapi.AllMailLabel {
+			return newIMAPMailbox(im.panicHandler, im.user, storeMailbox, im.name), nil
+		}
+	}
+	return nil, errors.New("all mail mailbox does not exist")
+}
+
+// Name returns this mailbox name.
+func (im *imapSnoozedMailbox) Name() string {
+	return im.name
+}
+
+// Info returns this mailbox info.
+func (im *imapSnoozedMailbox) Info() (*imap.MailboxInfo, error) {
+	info := &imap.MailboxInfo{
+		Attributes: []string{},
+		Delimiter:  store.PathDelimiter,
+		Name:       im.name,
+	}
+	if im.target != "" {
+		info.Attributes = append(info.Attributes, imap.NoInferiorsAttr)
+	}
+	return info, nil
+}
+
+// Status returns this mailbox status.
+func (im *imapSnoozedMailbox) Status(items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	entries, err := im.getEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	status := imap.NewMailboxStatus(im.name, items)
+	status.UidValidity = snoozedUIDValidity
+	status.PermanentFlags = []string{imap.SeenFlag, imap.FlaggedFlag}
+	status.Messages = uint32(len(entries))
+
+	if status.UidNext, err = im.user.storeUser.GetSnoozedMessagesNextUID(); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// SetSubscribed does nothing, the mailbox is always listed.
+func (im *imapSnoozedMailbox) SetSubscribed(_ bool) error {
+	return nil
+}
+
+// Check is equivalent to NOOP, there is no housekeeping.
+func (im *imapSnoozedMailbox) Check() error {
+	return nil
+}
+
+// ListMessages returns messages in the sequence set.
+func (im *imapSnoozedMailbox) ListMessages(isUID bool, seqSet *imap.SeqSet, items []imap.FetchItem, msgResponse chan<- *imap.Message) (err error) {
+	defer func() {
+		close(msgResponse)
+		// Called from go-imap in goroutines - we need to handle panics for each function.
+		im.panicHandler.HandlePanic()
+	}()
+
+	entries, err := im.getSelectedEntries(isUID, seqSet)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	allMail, err := im.getAllMail()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		storeMessage, err := allMail.storeMailbox.GetMessage(entry.msg.MessageID)
+		if err != nil {
+			im.log.WithError(err).WithField("msgID", entry.msg.MessageID).Warn("Snoozed message does not exist")
+			continue
+		}
+
+		msg, err := allMail.getMessage(context.Background(), storeMessage, items)
+		if err != nil {
+			im.log.WithError(err).WithField("msgID", entry.msg.MessageID).Error("Cannot fetch snoozed message")
+			continue
+		}
+
+		msg.SeqNum = entry.seqNum
+		for _, item := range items {
+			if item == imap.FetchUid {
+				msg.Uid = entry.msg.UID
+			}
+		}
+
+		msgResponse <- msg
+	}
+
+	return nil
+}
+
+// SearchMessages searches messages the same way as All Mail does. Sequence
+// numbers and UIDs of this mailbox are matched here.
+func (im *imapSnoozedMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria) (ids []uint32, err error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	entries, err := im.getEntries()
+	if err != nil {
+		return nil, err
+	}
+	if criteria.SeqNum != nil {
+		if entries, err = im.getSelectedEntries(false, criteria.SeqNum); err != nil {
+			return nil, err
+		}
+	}
+	if criteria.Uid != nil {
+		selected := map[string]bool{}
+		uidEntries, err := im.getSelectedEntries(true, criteria.Uid)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range uidEntries {
+			selected[entry.msg.MessageID] = true
+		}
+		filtered := []snoozedEntry{}
+		for _, entry := range entries {
+			if selected[entry.msg.MessageID] {
+				filtered = append(filtered, entry)
+			}
+		}
+		entries = filtered
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	allMail, err := im.getAllMail()
+	if err != nil {
+		return nil, err
+	}
+
+	allMailCriteria := *criteria
+	allMailCriteria.SeqNum = nil
+	allMailCriteria.Uid = nil
+
+	storeMessages, err := allMail.searchStoreMessages(&allMailCriteria, &savedate.SearchCriteria{})
+	if err != nil {
+		return nil, err
+	}
+
+	matched := map[string]bool{}
+	for _, storeMessage := range storeMessages {
+		matched[storeMessage.ID()] = true
+	}
+
+	for _, entry := range entries {
+		if !matched[entry.msg.MessageID] {
+			continue
+		}
+		if isUID {
+			ids = append(ids, entry.msg.UID)
+		} else {
+			ids = append(ids, entry.seqNum)
+		}
+	}
+
+	return ids, nil
+}
+
+// CreateMessage is not supported, messages are snoozed by moving them here.
+func (im *imapSnoozedMailbox) CreateMessage(_ []string, _ time.Time, _ imap.Literal) error {
+	return errors.New("messages cannot be appended to " + snoozedMailboxName + ", move them there instead")
+}
+
+// UpdateMessagesFlags changes \Seen and \Flagged of snoozed messages.
+func (im *imapSnoozedMailbox) UpdateMessagesFlags(isUID bool, seqSet *imap.SeqSet, operation imap.FlagsOp, flags []string) error {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	if err := im.user.checkWritable(); err != nil {
+		return err
+	}
+
+	entries, err := im.getSelectedEntries(isUID, seqSet)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	allMail, err := im.getAllMail()
+	if err != nil {
+		return err
+	}
+
+	messageIDs := getSnoozedMessageIDs(entries)
+	for _, flag := range []string{imap.SeenFlag, imap.FlaggedFlag} {
+		has := false
+		for _, f := range flags {
+			has = has || strings.EqualFold(f, flag)
+		}
+
+		op := operation
+		if op == imap.SetFlags {
+			op = imap.RemoveFlags
+			if has {
+				op = imap.AddFlags
+			}
+		} else if !has {
+			continue
+		}
+
+		if err := allMail.addOrRemoveFlags(op, messageIDs, []string{flag}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CopyMessages is the same as MoveMessages, the snoozed message cannot be
+// in the destination and still be snoozed.
+func (im *imapSnoozedMailbox) CopyMessages(isUID bool, seqSet *imap.SeqSet, dest string) error {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	return im.moveMessages(isUID, seqSet, dest)
+}
+
+// MoveMessages snoozes messages till another time when the destination
+// is in Snoozed. Otherwise the snoozing is cancelled and messages are moved
+// to the destination.
+func (im *imapSnoozedMailbox) MoveMessages(isUID bool, seqSet *imap.SeqSet, dest string) error {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	return im.moveMessages(isUID, seqSet, dest)
+}
+
+func (im *imapSnoozedMailbox) moveMessages(isUID bool, seqSet *imap.SeqSet, dest string) error {
+	if err := im.user.checkWritable(); err != nil {
+		return err
+	}
+
+	entries, err := im.getSelectedEntries(isUID, seqSet)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	messageIDs := getSnoozedMessageIDs(entries)
+
+	if isSnoozedMailboxPath(dest) {
+		target := getSnoozeTarget(dest)
+		if target == "" {
+			return nil
+		}
+
+		wakeAt, err := store.ParseSnoozeTarget(target, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if err := im.user.storeUser.RescheduleSnoozedMessages(messageIDs, target, wakeAt); err != nil {
+			return err
+		}
+	} else {
+		targetStoreMailbox, err := im.user.getStoreMailbox(im.user.mailboxMapping(), dest)
+		if err != nil {
+			return err
+		}
+
+		if err := im.user.storeUser.RemoveSnoozedMessages(messageIDs); err != nil {
+			return err
+		}
+
+		if err := targetStoreMailbox.LabelMessages(messageIDs); err != nil {
+			return err
+		}
+	}
+
+	// Rescheduled messages get new UIDs and are listed again.
+	for i := len(entries) - 1; i >= 0; i-- {
+		im.sendExpungeUpdate(entries[i].seqNum)
+	}
+	return nil
+}
+
+// Expunge does nothing, \Deleted flag is not stored.
+func (im *imapSnoozedMailbox) Expunge() error {
+	return nil
+}
+
+// sendExpungeUpdate notifies clients which selected the mailbox. The store
+// does not know about the mailbox, so the update is sent here directly.
+func (im *imapSnoozedMailbox) sendExpungeUpdate(seqNum uint32) {
+	if im.user.backend == nil {
+		return
+	}
+
+	update := new(goIMAPBackend.ExpungeUpdate)
+	update.Update = goIMAPBackend.NewUpdate(im.user.Username(), im.name)
+	update.SeqNum = seqNum
+
+	select {
+	case <-time.After(1 * time.Second):
+		im.log.Error("Could not send IMAP update (timeout)")
+	case im.user.backend.updates <- update:
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/stretchr/testify/require"
+)
+
+func getSnoozedUIDs(entries []snoozedEntry) (uids []uint32) {
+	for _, entry := range entries {
+		uids = append(uids, entry.msg.UID)
+	}
+	return
+}
+
+func TestIsSnoozedMailboxName(t *testing.T) {
+	for _, name := range []string{"Snoozed", "Snoozed/Tomorrow", "Snoozed/nextweek", "Snoozed/3d"} {
+		require.True(t, isSnoozedMailboxName(name), name)
+	}
+	for _, name := range []string{"INBOX", "Snoozed/", "Snoozed/Someday", "Folders/Snoozed", "SnoozedTomorrow"} {
+		require.False(t, isSnoozedMailboxName(name), name)
+	}
+
+	require.True(t, isSnoozedMailboxPath("Snoozed/Someday"))
+	require.False(t, isSnoozedMailboxPath("SnoozedTomorrow"))
+}
+
+func TestFilterSnoozedMessages(t *testing.T) {
+	msgs := []*store.SnoozedMessage{
+		{MessageID: "a", UID: 1, AddressID: "addr1", Target: store.SnoozeTomorrow},
+		{MessageID: "b", UID: 2, AddressID: "addr2", Target: store.SnoozeTomorrow},
+		{MessageID: "c", UID: 4, AddressID: "addr1", Target: store.SnoozeNextWeek},
+	}
+
+	all := filterSnoozedMessages(msgs, "", "")
+	require.Equal(t, []uint32{1, 2, 4}, getSnoozedUIDs(all))
+	require.Equal(t, uint32(3), all[2].seqNum)
+
+	require.Equal(t, []uint32{1, 2}, getSnoozedUIDs(filterSnoozedMessages(msgs, "tomorrow", "")))
+	require.Equal(t, []uint32{1, 4}, getSnoozedUIDs(filterSnoozedMessages(msgs, "", "addr1")))
+	require.Empty(t, filterSnoozedMessages(msgs, store.SnoozeNextWeek, "addr2"))
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/imap/savedate"
+	"github.com/ProtonMail/proton-bridge/internal/imap/thread"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/emersion/go-imap"
+)
+
+// GetThreadMessages returns messages matching the criteria with data needed
+// for THREAD command.
+func (im *imapMailbox) GetThreadMessages(isUID bool, criteria *imap.SearchCriteria) ([]*thread.Message, error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	storeMessages, err := im.searchStoreMessages(criteria, &savedate.SearchCriteria{})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []*thread.Message{}
+	for _, storeMessage := range storeMessages {
+		id, err := getMessageID(isUID, storeMessage)
+		if err != nil {
+			return nil, err
+		}
+
+		m := storeMessage.Message()
+		header := message.GetHeader(m)
+
+		date, err := m.Header.Date()
+		if err != nil || date.IsZero() {
+			date = time.Unix(m.Time, 0)
+		}
+
+		messages = append(messages, &thread.Message{
+			ID:         id,
+			MessageID:  header.Get("Message-Id"),
+			References: getThreadReferences(m, header.Get("References"), header.Get("In-Reply-To")),
+			Subject:    m.Subject,
+			Date:       date,
+		})
+	}
+
+	return messages, nil
+}
+
+// getThreadReferences returns references of the message for threading.
+// The header contains also the internal ID of the message which is dropped
+// and the conversation ID which is moved to the beginning, so messages of
+// one conversation have the conversation as their common root.
+func getThreadReferences(m *pmapi.Message, references, inReplyTo string) []string {
+	internalID := message.InternalMessageID(m.ID)
+	conversationID := message.ConversationMessageID(m.ConversationID)
+
+	refs := []string{}
+	for _, ref := range message.ParseMessageIDs(references) {
+		if ref != internalID && ref != conversationID {
+			refs = append(refs, ref)
+		}
+	}
+	if inReplyTo := message.ParseMessageIDs(inReplyTo); len(refs) == 0 && len(inReplyTo) > 0 {
+		refs = inReplyTo[:1]
+	}
+
+	if m.ConversationID != "" {
+		refs = append([]string{conversationID}, refs...)
+	}
+
+	return refs
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/imap/thread"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetThreadReferences(t *testing.T) {
+	first := &pmapi.Message{ID: "msg1", ConversationID: "conv", ExternalID: "first@pm.me", Subject: "Hello"}
+	reply := &pmapi.Message{ID: "msg2", ConversationID: "conv", Subject: "Re: Hello", Header: map[string][]string{
+		"In-Reply-To": {"<first@pm.me>"},
+	}}
+	other := &pmapi.Message{ID: "msg3", ConversationID: "conv", Subject: "Unrelated"}
+
+	messages := []*thread.Message{}
+	for i, m := range []*pmapi.Message{first, reply, other} {
+		header := message.GetHeader(m)
+		messages = append(messages, &thread.Message{
+			ID:         uint32(i + 1),
+			MessageID:  header.Get("Message-Id"),
+			References: getThreadReferences(m, header.Get("References"), header.Get("In-Reply-To")),
+			Subject:    m.Subject,
+		})
+	}
+
+	require.Equal(t, []string{"<conv@" + pmapi.ConversationIDDomain + ">", "<first@pm.me>"}, messages[1].References)
+
+	// Messages of the conversation are in one thread with the reply nested.
+	require.Equal(t, "((1 2)(3))", thread.FormatThreads(thread.ThreadReferences(messages)))
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/ProtonMail/proton-bridge/internal/imap/cache"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	openpgperrors "golang.org/x/crypto/openpgp/errors"
+)
+
+// truncatedCacheSuffix distinguishes previews of messages above the size
+// limit in the in-memory cache.
+const truncatedCacheSuffix = "-truncated-"
+
+// clientSizeLimitField is the IMAP ID field by which the client declares
+// the largest message in bytes it is able to download.
+const clientSizeLimitField = "x-message-size-limit"
+
+var (
+	messageSizeLimit     int64        //nolint[gochecknoglobals]
+	messageSizeLimitLock sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetMessageSizeLimit sets the size in bytes above which the whole message
+// is served only as a truncated preview with a notice how to download it
+// completely. Parts fetched one by one (BODY[x]) are not limited. Zero
+// disables it unless the client declares its own limit.
+func SetMessageSizeLimit(size int64) {
+	messageSizeLimitLock.Lock()
+	defer messageSizeLimitLock.Unlock()
+
+	messageSizeLimit = size
+}
+
+func getMessageSizeLimit() int64 {
+	messageSizeLimitLock.RLock()
+	defer messageSizeLimitLock.RUnlock()
+
+	return messageSizeLimit
+}
+
+// getClientMessageSizeLimit returns the limit declared by the last client
+// in its IMAP ID, or zero.
+func (ib *imapBackend) getClientMessageSizeLimit() int64 {
+	ib.lastMailClientLocker.Lock()
+	defer ib.lastMailClientLocker.Unlock()
+
+	limit, err := strconv.ParseInt(ib.lastMailClient[clientSizeLimitField], 10, 64)
+	if err != nil || limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// sizeLimit returns the lower of the configured limit and the limit
+// declared by the client. Zero means no limit.
+func (im *imapMailbox) sizeLimit() int64 {
+	return lowerSizeLimit(getMessageSizeLimit(), im.user.backend.getClientMessageSizeLimit())
+}
+
+func lowerSizeLimit(a, b int64) int64 {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+func isOverSizeLimit(size, limit int64) bool {
+	return limit > 0 && size > limit
+}
+
+// estimateMessageSize returns the size of the message before it is built.
+// The size reported by API and the encrypted body are larger than the built
+// message, so a message close to the limit rather gets the preview.
+func estimateMessageSize(m *pmapi.Message) int64 {
+	if m.Size > 0 {
+		return m.Size
+	}
+	size := int64(len(m.Body))
+	for _, att := range m.Attachments {
+		size += att.Size
+	}
+	return size
+}
+
+// getLimitedBodyStructure returns the whole message, or its preview when
+// the message is above the size limit. Drafts are never truncated.
+func (im *imapMailbox) getLimitedBodyStructure(ctx context.Context, storeMessage storeMessageProvider) (
+	structure *message.BodyStructure,
+	body messageBody, err error,
+) {
+	m := storeMessage.Message()
+	limit := im.sizeLimit()
+
+	if limit <= 0 || isMessageInDraftFolder(m) || (m.Size > 0 && !isOverSizeLimit(m.Size, limit)) {
+		return im.getPlaceholderBodyStructure(ctx, storeMessage)
+	}
+
+	// The preview depends on the limit which differs between clients.
+	truncatedID := im.storeUser.UserID() + m.ID + truncatedCacheSuffix + strconv.FormatInt(limit, 10)
+	cache.BuildLock(truncatedID)
+	defer cache.BuildUnlock(truncatedID)
+
+	var bodyReader *bytes.Reader
+	if bodyReader, structure = cache.LoadMail(truncatedID); bodyReader.Len() != 0 && structure != nil {
+		return structure, bodyReader, nil
+	}
+
+	truncated, structure, err := im.buildTruncatedMessage(ctx, m, limit)
+	if err != nil {
+		im.log.WithError(err).WithField("msgID", m.ID).Debug("Cannot build preview of large message")
+		return im.getPlaceholderBodyStructure(ctx, storeMessage)
+	}
+	if truncated == nil {
+		return im.getPlaceholderBodyStructure(ctx, storeMessage)
+	}
+
+	im.log.WithField("msgID", m.ID).WithField("limit", limit).Info("Serving preview of message above size limit")
+	cache.SaveMail(truncatedID, truncated, structure)
+	return structure, bytes.NewReader(truncated), nil
+}
+
+// buildTruncatedMessage builds the preview of the message with the notice
+// followed by the beginning of the text. Attachments are only listed in
+// the notice. It returns nil body when the message is within the limit.
+func (im *imapMailbox) buildTruncatedMessage(ctx context.Context, m *pmapi.Message, limit int64) (body []byte, structure *message.BodyStructure, err error) {
+	if err = im.fetchMessage(ctx, m); err != nil {
+		return
+	}
+
+	size := estimateMessageSize(m)
+	if !isOverSizeLimit(size, limit) {
+		return nil, nil, nil
+	}
+
+	kr, err := im.user.client().KeyRingForAddressID(m.AddressID)
+	if err != nil {
+		return
+	}
+	if err = m.Decrypt(kr); err != nil && err != openpgperrors.ErrSignatureExpired {
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	_ = mw.SetBoundary(message.GetBoundary(m))
+
+	header := im.getMessageHeader(m)
+	header.Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	header.Del("Content-Transfer-Encoding")
+	if err = writeHeader(buf, header); err != nil {
+		return
+	}
+
+	noticeHeader := textproto.MIMEHeader{}
+	noticeHeader.Set("Content-Type", "text/plain; charset=utf-8")
+	noticeHeader.Set("Content-Disposition", "inline")
+	noticeHeader.Set("Content-Transfer-Encoding", "quoted-printable")
+	if err = writeQuotedPrintablePart(mw, noticeHeader, im.getTruncatedNotice(m, size, limit)); err != nil {
+		return
+	}
+
+	// Other types are PGP/MIME trees which cannot be cut.
+	if m.MIMEType == pmapi.ContentTypePlainText || m.MIMEType == pmapi.ContentTypeHTML {
+		if err = writeQuotedPrintablePart(mw, message.GetBodyHeader(m, message.QuotedPrintable), truncateText(m.Body, int(limit))); err != nil {
+			return
+		}
+	}
+
+	if err = mw.Close(); err != nil {
+		return
+	}
+
+	body = buf.Bytes()
+	structure, err = message.NewBodyStructure(bytes.NewReader(body))
+	return
+}
+
+func (im *imapMailbox) getTruncatedNotice(m *pmapi.Message, size, limit int64) string {
+	notice := &bytes.Buffer{}
+	fmt.Fprintf(notice, "This message has about %s, which is more than the limit of %s for your mail client. ", formatMessageSize(size), formatMessageSize(limit))
+	_, _ = io.WriteString(notice, "Only the beginning of the text is shown")
+	if len(m.Attachments) == 0 {
+		_, _ = io.WriteString(notice, ".\r\n")
+	} else {
+		_, _ = io.WriteString(notice, " and these attachments are left out:\r\n\r\n")
+		for _, att := range m.Attachments {
+			fmt.Fprintf(notice, " - %s (%s)\r\n", att.Name, formatMessageSize(att.Size))
+		}
+	}
+	fmt.Fprintf(notice, "\r\nDownload the full message from the Bridge API by GET /messages/%s/%s.\r\n", im.user.currentAddressLowercase, m.ID)
+	return notice.String()
+}
+
+func writeQuotedPrintablePart(mw *multipart.Writer, header textproto.MIMEHeader, text string) error {
+	w, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, text); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// truncateText cuts the text to at most size bytes without splitting
+// a UTF-8 character.
+func truncateText(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+	for size > 0 && !utf8.RuneStart(text[size]) {
+		size--
+	}
+	return text[:size]
+}
+
+func formatMessageSize(size int64) string {
+	if size < 1024*1024 {
+		return fmt.Sprintf("%d kB", (size+1023)/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+}
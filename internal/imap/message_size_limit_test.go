@@ -0,0 +1,86 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"sync"
+	"testing"
+
+	imapid "github.com/ProtonMail/go-imap-id"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMessageSizeLimit(t *testing.T) {
+	defer SetMessageSizeLimit(0)
+
+	require.Equal(t, int64(0), getMessageSizeLimit())
+	SetMessageSizeLimit(1024)
+	require.Equal(t, int64(1024), getMessageSizeLimit())
+}
+
+func TestClientMessageSizeLimit(t *testing.T) {
+	ib := &imapBackend{lastMailClientLocker: &sync.Mutex{}}
+
+	ib.lastMailClient = imapid.ID{imapid.FieldName: "client"}
+	require.Equal(t, int64(0), ib.getClientMessageSizeLimit())
+
+	ib.lastMailClient = imapid.ID{imapid.FieldName: "client", clientSizeLimitField: "2048"}
+	require.Equal(t, int64(2048), ib.getClientMessageSizeLimit())
+
+	ib.lastMailClient = imapid.ID{imapid.FieldName: "client", clientSizeLimitField: "big"}
+	require.Equal(t, int64(0), ib.getClientMessageSizeLimit())
+}
+
+func TestLowerSizeLimit(t *testing.T) {
+	require.Equal(t, int64(0), lowerSizeLimit(0, 0))
+	require.Equal(t, int64(10), lowerSizeLimit(10, 0))
+	require.Equal(t, int64(20), lowerSizeLimit(0, 20))
+	require.Equal(t, int64(10), lowerSizeLimit(10, 20))
+	require.Equal(t, int64(10), lowerSizeLimit(20, 10))
+}
+
+func TestIsOverSizeLimit(t *testing.T) {
+	require.False(t, isOverSizeLimit(2048, 0), "disabled")
+	require.False(t, isOverSizeLimit(2048, 2048), "not above the limit")
+	require.True(t, isOverSizeLimit(2048, 1024))
+}
+
+func TestEstimateMessageSize(t *testing.T) {
+	m := &pmapi.Message{
+		Body:        "body",
+		Attachments: []*pmapi.Attachment{{Size: 10}, {Size: 20}},
+	}
+	require.Equal(t, int64(34), estimateMessageSize(m))
+
+	m.Size = 100
+	require.Equal(t, int64(100), estimateMessageSize(m))
+}
+
+func TestTruncateText(t *testing.T) {
+	require.Equal(t, "hello", truncateText("hello", 10))
+	require.Equal(t, "hel", truncateText("hello", 3))
+	require.Equal(t, "a", truncateText("ačb", 2), "does not split a character")
+	require.Equal(t, "ač", truncateText("ačb", 3))
+}
+
+func TestFormatMessageSize(t *testing.T) {
+	require.Equal(t, "1 kB", formatMessageSize(100))
+	require.Equal(t, "512 kB", formatMessageSize(512*1024))
+	require.Equal(t, "2.5 MB", formatMessageSize(5*512*1024))
+}
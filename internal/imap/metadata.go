@@ -0,0 +1,82 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+// Entries of annotations published over METADATA. Special-use is defined by
+// RFC 6154, the rest are vendor entries as described in RFC 5464.
+const (
+	metadataSpecialUse      = "/private/specialuse"
+	metadataVendorPrefix    = "/private/vendor/proton-bridge"
+	metadataIdentityAddress = metadataVendorPrefix + "/identity/address"
+	metadataIdentityName    = metadataVendorPrefix + "/identity/name"
+	metadataSignature       = metadataVendorPrefix + "/signature"
+	metadataColor           = metadataVendorPrefix + "/color"
+	metadataType            = metadataVendorPrefix + "/type"
+)
+
+// GetMetadata returns the default identity and signature of the address as
+// server annotations, and the special use and color of mailboxes.
+func (iu *imapUser) GetMetadata(name string) (map[string]string, error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer iu.panicHandler.HandlePanic()
+
+	iu.storeUser.NotifyClientActivity()
+
+	annotations := map[string]string{}
+
+	if name == "" {
+		address := iu.storeAddress.APIAddress()
+		if address == nil {
+			return annotations, nil
+		}
+		annotations[metadataIdentityAddress] = address.Email
+		if address.DisplayName != "" {
+			annotations[metadataIdentityName] = address.DisplayName
+		}
+		if address.Signature != "" {
+			annotations[metadataSignature] = address.Signature
+		}
+		return annotations, nil
+	}
+
+	if isOutboxMailboxName(name) || isSnoozedMailboxName(name) {
+		return annotations, nil
+	}
+
+	storeMailbox, err := iu.getStoreMailbox(iu.mailboxMapping(), name)
+	if err != nil {
+		return nil, err
+	}
+
+	if attr := getSpecialUseAttribute(storeMailbox.LabelID()); attr != "" {
+		annotations[metadataSpecialUse] = attr
+	}
+	if color := storeMailbox.Color(); color != "" {
+		annotations[metadataColor] = color
+	}
+	switch {
+	case storeMailbox.IsSystem():
+		annotations[metadataType] = "system"
+	case storeMailbox.IsFolder():
+		annotations[metadataType] = "folder"
+	default:
+		annotations[metadataType] = "label"
+	}
+
+	return annotations, nil
+}
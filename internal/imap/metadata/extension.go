@@ -0,0 +1,342 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package metadata implements METADATA extension (RFC 5464).
+//
+// Annotations are published by Bridge from the account settings so they
+// are read-only; SETMETADATA is always refused.
+package metadata
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/server"
+	"github.com/emersion/go-imap/utf7"
+)
+
+// Capability extension identifier.
+const Capability = "METADATA"
+
+const (
+	getCommandName = "GETMETADATA"
+	setCommandName = "SETMETADATA"
+	responseName   = "METADATA"
+)
+
+// Depth of entries below the requested ones returned by GETMETADATA.
+const (
+	DepthZero     = 0
+	DepthOne      = 1
+	DepthInfinity = -1
+)
+
+// ErrReadOnly is returned for any attempt to change annotations.
+var ErrReadOnly = errors.New("annotations are read-only") //nolint[gochecknoglobals]
+
+// User is the user which provides annotations.
+type User interface {
+	// GetMetadata returns all annotations of the mailbox, or annotations of
+	// the server when the mailbox is empty. Keys are entry names in lower
+	// case, e.g. /private/comment.
+	GetMetadata(mailbox string) (map[string]string, error)
+}
+
+// GetMetadata is the command to get annotations.
+type GetMetadata struct {
+	Mailbox string
+	Entries []string
+	// MaxSize of returned values, values longer than it are left out. It is
+	// zero when not limited.
+	MaxSize uint32
+	Depth   int
+}
+
+func (cmd *GetMetadata) Parse(fields []interface{}) error {
+	cmd.Depth = DepthZero
+
+	if len(fields) > 0 {
+		if options, ok := fields[0].([]interface{}); ok {
+			if err := cmd.parseOptions(options); err != nil {
+				return err
+			}
+			fields = fields[1:]
+		}
+	}
+
+	if len(fields) != 2 {
+		return errors.New("mailbox and entries are required")
+	}
+
+	mailbox, err := parseMailbox(fields[0])
+	if err != nil {
+		return err
+	}
+	cmd.Mailbox = mailbox
+
+	var entries []string
+	if list, ok := fields[1].([]interface{}); ok {
+		if entries, err = imap.ParseStringList(list); err != nil {
+			return err
+		}
+	} else {
+		entry, err := imap.ParseString(fields[1])
+		if err != nil {
+			return err
+		}
+		entries = []string{entry}
+	}
+	if len(entries) == 0 {
+		return errors.New("at least one entry is required")
+	}
+
+	for _, entry := range entries {
+		if !IsValidEntry(entry) {
+			return errors.New("invalid entry " + entry)
+		}
+		cmd.Entries = append(cmd.Entries, strings.ToLower(entry))
+	}
+
+	return nil
+}
+
+func (cmd *GetMetadata) parseOptions(options []interface{}) error {
+	if len(options)%2 != 0 {
+		return errors.New("options must have values")
+	}
+
+	for i := 0; i < len(options); i += 2 {
+		name, _ := options[i].(string)
+		switch strings.ToUpper(name) {
+		case "MAXSIZE":
+			maxSize, err := imap.ParseNumber(options[i+1])
+			if err != nil {
+				return err
+			}
+			cmd.MaxSize = maxSize
+		case "DEPTH":
+			depth, _ := options[i+1].(string)
+			switch strings.ToLower(depth) {
+			case "0":
+				cmd.Depth = DepthZero
+			case "1":
+				cmd.Depth = DepthOne
+			case "infinity":
+				cmd.Depth = DepthInfinity
+			default:
+				return errors.New("depth must be 0, 1 or infinity")
+			}
+		default:
+			return errors.New("unknown option " + name)
+		}
+	}
+
+	return nil
+}
+
+func (cmd *GetMetadata) Handle(conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return server.ErrNotAuthenticated
+	}
+
+	user, ok := ctx.User.(User)
+	if !ok {
+		return errors.New("annotations are not supported")
+	}
+
+	annotations, err := user.GetMetadata(cmd.Mailbox)
+	if err != nil {
+		return err
+	}
+
+	entries, longest := SelectEntries(annotations, cmd.Entries, cmd.Depth, cmd.MaxSize)
+	if len(entries) > 0 {
+		if err := conn.WriteResp(&Response{Mailbox: cmd.Mailbox, Entries: entries}); err != nil {
+			return err
+		}
+	}
+
+	if longest == 0 {
+		return nil
+	}
+
+	return server.ErrStatusResp(&imap.StatusResp{
+		Type: imap.StatusRespOk,
+		Code: responseName,
+		Arguments: []interface{}{
+			imap.RawString("LONGENTRIES"),
+			imap.RawString(strconv.Itoa(longest)),
+		},
+		Info: getCommandName + " completed",
+	})
+}
+
+// SetMetadata is the command to set annotations. It is parsed only to be
+// refused properly.
+type SetMetadata struct {
+	Mailbox string
+}
+
+func (cmd *SetMetadata) Parse(fields []interface{}) error {
+	if len(fields) != 2 {
+		return errors.New("mailbox and list of entries are required")
+	}
+
+	mailbox, err := parseMailbox(fields[0])
+	if err != nil {
+		return err
+	}
+	cmd.Mailbox = mailbox
+
+	if _, ok := fields[1].([]interface{}); !ok {
+		return errors.New("entries must be a list")
+	}
+
+	return nil
+}
+
+func (cmd *SetMetadata) Handle(conn server.Conn) error {
+	if conn.Context().User == nil {
+		return server.ErrNotAuthenticated
+	}
+
+	return ErrReadOnly
+}
+
+// Entry is the annotation returned to client.
+type Entry struct {
+	Name  string
+	Value string
+}
+
+// Response is the untagged METADATA response.
+type Response struct {
+	Mailbox string
+	Entries []Entry
+}
+
+func (r *Response) WriteTo(w *imap.Writer) error {
+	mailbox, err := utf7.Encoding.NewEncoder().String(r.Mailbox)
+	if err != nil {
+		return err
+	}
+
+	entries := []interface{}{}
+	for _, entry := range r.Entries {
+		entries = append(entries, imap.RawString(entry.Name), entry.Value)
+	}
+
+	fields := []interface{}{imap.RawString(responseName), imap.FormatMailboxName(mailbox), entries}
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
+
+// SelectEntries returns annotations matching requested entries up to the
+// depth, sorted by name. Values longer than maxSize are left out and the
+// length of the longest of them is returned.
+func SelectEntries(annotations map[string]string, requested []string, depth int, maxSize uint32) (entries []Entry, longest int) {
+	for name, value := range annotations {
+		if !isSelected(name, requested, depth) {
+			continue
+		}
+		if maxSize > 0 && len(value) > int(maxSize) {
+			if len(value) > longest {
+				longest = len(value)
+			}
+			continue
+		}
+		entries = append(entries, Entry{Name: name, Value: value})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries, longest
+}
+
+func isSelected(name string, requested []string, depth int) bool {
+	for _, entry := range requested {
+		if name == entry {
+			return true
+		}
+		if depth == DepthZero || !strings.HasPrefix(name, entry+"/") {
+			continue
+		}
+		if depth == DepthInfinity || !strings.Contains(name[len(entry)+1:], "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidEntry returns whether the entry name is valid, i.e., it is in the
+// private or shared hierarchy and it contains no wildcards or empty parts.
+func IsValidEntry(entry string) bool {
+	entry = strings.ToLower(entry)
+	if strings.HasSuffix(entry, "/") || strings.Contains(entry, "//") || strings.ContainsAny(entry, "*%") {
+		return false
+	}
+	return entry == "/private" || entry == "/shared" ||
+		strings.HasPrefix(entry, "/private/") || strings.HasPrefix(entry, "/shared/")
+}
+
+func parseMailbox(field interface{}) (string, error) {
+	mailbox, err := imap.ParseString(field)
+	if err != nil {
+		return "", err
+	}
+	if mailbox, err = utf7.Encoding.NewDecoder().String(mailbox); err != nil {
+		return "", err
+	}
+	if mailbox == "" {
+		return "", nil
+	}
+	return imap.CanonicalMailboxName(mailbox), nil
+}
+
+type extension struct{}
+
+// NewExtension of METADATA.
+func NewExtension() server.Extension {
+	return &extension{}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{Capability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	switch name {
+	case getCommandName:
+		return func() server.Handler {
+			return &GetMetadata{}
+		}
+	case setCommandName:
+		return func() server.Handler {
+			return &SetMetadata{}
+		}
+	}
+
+	return nil
+}
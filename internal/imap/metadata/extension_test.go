@@ -0,0 +1,125 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package metadata
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGetMetadata(t *testing.T) {
+	testData := []struct {
+		fields []interface{}
+		want   GetMetadata
+	}{
+		{
+			[]interface{}{"", "/private/comment"},
+			GetMetadata{Mailbox: "", Entries: []string{"/private/comment"}},
+		},
+		{
+			[]interface{}{"inbox", []interface{}{"/Private/SpecialUse", "/shared"}},
+			GetMetadata{Mailbox: "INBOX", Entries: []string{"/private/specialuse", "/shared"}},
+		},
+		{
+			[]interface{}{[]interface{}{"DEPTH", "infinity", "MAXSIZE", "1024"}, "Folders/Work", "/private"},
+			GetMetadata{Mailbox: "Folders/Work", Entries: []string{"/private"}, Depth: DepthInfinity, MaxSize: 1024},
+		},
+		{
+			[]interface{}{[]interface{}{"depth", "1"}, "", "/private/vendor"},
+			GetMetadata{Mailbox: "", Entries: []string{"/private/vendor"}, Depth: DepthOne},
+		},
+	}
+
+	for _, tc := range testData {
+		cmd := &GetMetadata{}
+		require.NoError(t, cmd.Parse(tc.fields), tc.fields)
+		require.Equal(t, tc.want, *cmd, tc.fields)
+	}
+}
+
+func TestParseGetMetadataInvalid(t *testing.T) {
+	for _, fields := range [][]interface{}{
+		{""},
+		{"", []interface{}{}},
+		{"", "/comment"},
+		{"", "/private/"},
+		{"", "/private//comment"},
+		{"", "/private/*"},
+		{[]interface{}{"DEPTH", "2"}, "", "/private"},
+		{[]interface{}{"MAXSIZE"}, "", "/private"},
+		{[]interface{}{"SIZE", "10"}, "", "/private"},
+	} {
+		require.Error(t, (&GetMetadata{}).Parse(fields), fields)
+	}
+}
+
+func TestSelectEntries(t *testing.T) {
+	annotations := map[string]string{
+		"/private/comment":                  "comment",
+		"/private/vendor/bridge/name":       "name",
+		"/private/vendor/bridge/identity/a": "address",
+		"/shared/admin":                     "mailto:admin@example.com",
+	}
+
+	testData := []struct {
+		requested   []string
+		depth       int
+		maxSize     uint32
+		wantNames   []string
+		wantLongest int
+	}{
+		{[]string{"/private/comment"}, DepthZero, 0, []string{"/private/comment"}, 0},
+		{[]string{"/private"}, DepthZero, 0, nil, 0},
+		{[]string{"/private"}, DepthOne, 0, []string{"/private/comment"}, 0},
+		{[]string{"/private/vendor/bridge"}, DepthOne, 0, []string{"/private/vendor/bridge/name"}, 0},
+		{[]string{"/private/vendor", "/shared"}, DepthInfinity, 0, []string{"/private/vendor/bridge/identity/a", "/private/vendor/bridge/name", "/shared/admin"}, 0},
+		{[]string{"/private/comment", "/shared/admin"}, DepthZero, 10, []string{"/private/comment"}, 24},
+		{[]string{"/private/comment", "/private/comment"}, DepthZero, 0, []string{"/private/comment"}, 0},
+	}
+
+	for _, tc := range testData {
+		entries, longest := SelectEntries(annotations, tc.requested, tc.depth, tc.maxSize)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name)
+			require.Equal(t, annotations[entry.Name], entry.Value)
+		}
+		require.Equal(t, tc.wantNames, names, tc.requested)
+		require.Equal(t, tc.wantLongest, longest, tc.requested)
+	}
+}
+
+func TestWriteResponse(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := imap.NewWriter(b)
+
+	resp := &Response{
+		Mailbox: "Sent",
+		Entries: []Entry{
+			{Name: "/private/specialuse", Value: `\Sent`},
+			{Name: "/private/vendor/proton-bridge/color", Value: "#7272a7"},
+		},
+	}
+	require.NoError(t, resp.WriteTo(w))
+	require.NoError(t, w.Flush())
+
+	require.Equal(t, "* METADATA \"Sent\" (/private/specialuse \"\\\\Sent\" /private/vendor/proton-bridge/color \"#7272a7\")\r\n", b.String())
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package savedate implements SAVEDATE extension (RFC 8514).
+//
+// Save date search keys are supported only on the top level of the query,
+// i.e., not inside of NOT or OR keys which are not supported by Bridge
+// anyway.
+package savedate
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-imap/server"
+)
+
+// Capability extension identifier.
+const Capability = "SAVEDATE"
+
+// FetchSaveDate is the FETCH item with the date when the message was saved
+// to the mailbox.
+const FetchSaveDate imap.FetchItem = "SAVEDATE"
+
+// searchKeyArgs is the number of arguments of standard search keys.
+var searchKeyArgs = map[string]int{ //nolint[gochecknoglobals]
+	"BCC":        1,
+	"BEFORE":     1,
+	"BODY":       1,
+	"CC":         1,
+	"FROM":       1,
+	"HEADER":     2,
+	"KEYWORD":    1,
+	"LARGER":     1,
+	"ON":         1,
+	"SENTBEFORE": 1,
+	"SENTON":     1,
+	"SENTSINCE":  1,
+	"SINCE":      1,
+	"SMALLER":    1,
+	"SUBJECT":    1,
+	"TEXT":       1,
+	"TO":         1,
+	"UID":        1,
+	"UNKEYWORD":  1,
+}
+
+// SearchCriteria are the save date search keys which go-imap doesn't know.
+type SearchCriteria struct {
+	SavedBefore time.Time // Saved before this date
+	SavedSince  time.Time // Saved since this date
+}
+
+// IsEmpty returns whether no save date criteria are set.
+func (c *SearchCriteria) IsEmpty() bool {
+	return c.SavedBefore.IsZero() && c.SavedSince.IsZero()
+}
+
+// Match returns whether the save date matches the criteria. According to
+// the RFC, the internal date should be used for messages without save date.
+func (c *SearchCriteria) Match(saveDate time.Time) bool {
+	if !c.SavedBefore.IsZero() && !saveDate.Before(c.SavedBefore) {
+		return false
+	}
+	if !c.SavedSince.IsZero() && saveDate.Before(c.SavedSince) {
+		return false
+	}
+	return true
+}
+
+// parseFields takes save date keys from the fields and returns the rest
+// which can be parsed by go-imap.
+func (c *SearchCriteria) parseFields(fields []interface{}) ([]interface{}, error) {
+	rest := []interface{}{}
+
+	if len(fields) >= 2 {
+		if key, ok := fields[0].(string); ok && strings.EqualFold(key, "CHARSET") {
+			rest = append(rest, fields[:2]...)
+			fields = fields[2:]
+		}
+	}
+	charsetLen := len(rest)
+
+	for len(fields) > 0 {
+		field := fields[0]
+		fields = fields[1:]
+
+		key, _ := field.(string)
+		key = strings.ToUpper(key)
+
+		switch key {
+		case "SAVEDBEFORE", "SAVEDON", "SAVEDSINCE":
+			if len(fields) == 0 {
+				return nil, errors.New("missing save date")
+			}
+			value, _ := fields[0].(string)
+			fields = fields[1:]
+
+			date, err := time.Parse(imap.DateLayout, value)
+			if err != nil {
+				return nil, err
+			}
+
+			switch key {
+			case "SAVEDBEFORE":
+				c.SavedBefore = date
+			case "SAVEDON":
+				c.SavedSince = date
+				c.SavedBefore = date.Add(24 * time.Hour)
+			case "SAVEDSINCE":
+				c.SavedSince = date
+			}
+			continue
+		case "SAVEDATESUPPORTED":
+			// All mailboxes support save dates so it matches everything.
+			continue
+		case "NOT", "OR":
+			rest = append(rest, field)
+			rest = append(rest, fields...)
+			fields = nil
+			continue
+		}
+
+		rest = append(rest, field)
+
+		args := searchKeyArgs[key]
+		if args > len(fields) {
+			args = len(fields)
+		}
+		rest = append(rest, fields[:args]...)
+		fields = fields[args:]
+	}
+
+	if len(rest) == charsetLen {
+		rest = append(rest, "ALL")
+	}
+
+	return rest, nil
+}
+
+// Mailbox is the mailbox which can be searched by save date.
+type Mailbox interface {
+	SearchMessagesBySaveDate(uid bool, criteria *imap.SearchCriteria, saveDateCriteria *SearchCriteria) ([]uint32, error)
+}
+
+// Search overrides SEARCH command to support save date search keys.
+type Search struct {
+	commands.Search
+
+	SaveDate *SearchCriteria
+}
+
+func (cmd *Search) Parse(fields []interface{}) (err error) {
+	cmd.SaveDate = &SearchCriteria{}
+	if fields, err = cmd.SaveDate.parseFields(fields); err != nil {
+		return err
+	}
+	return cmd.Search.Parse(fields)
+}
+
+func (cmd *Search) handle(uid bool, conn server.Conn) (err error) {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return server.ErrNoMailboxSelected
+	}
+
+	var ids []uint32
+	if mailbox, ok := ctx.Mailbox.(Mailbox); ok {
+		ids, err = mailbox.SearchMessagesBySaveDate(uid, cmd.Criteria, cmd.SaveDate)
+	} else if cmd.SaveDate.IsEmpty() {
+		ids, err = ctx.Mailbox.SearchMessages(uid, cmd.Criteria)
+	} else {
+		err = errors.New("search by save date is not supported")
+	}
+	if err != nil {
+		return err
+	}
+
+	return conn.WriteResp(&responses.Search{Ids: ids})
+}
+
+func (cmd *Search) Handle(conn server.Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Search) UidHandle(conn server.Conn) error { //nolint[golint]
+	return cmd.handle(true, conn)
+}
+
+type extension struct{}
+
+// NewExtension of SAVEDATE.
+func NewExtension() server.Extension {
+	return &extension{}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{Capability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	if name == "SEARCH" {
+		return func() server.Handler {
+			return &Search{}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package savedate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSearch(t *testing.T) {
+	date := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	testData := []struct {
+		fields        []interface{}
+		wantRest      []interface{}
+		wantSaveDates SearchCriteria
+	}{
+		{
+			[]interface{}{"UNSEEN"},
+			[]interface{}{"UNSEEN"},
+			SearchCriteria{},
+		},
+		{
+			[]interface{}{"SAVEDATESUPPORTED"},
+			[]interface{}{"ALL"},
+			SearchCriteria{},
+		},
+		{
+			[]interface{}{"CHARSET", "UTF-8", "savedsince", "1-Feb-2020"},
+			[]interface{}{"CHARSET", "UTF-8", "ALL"},
+			SearchCriteria{SavedSince: date},
+		},
+		{
+			[]interface{}{"SUBJECT", "SAVEDON", "SAVEDBEFORE", "1-Feb-2020", "HEADER", "X-Saved", "SAVEDON"},
+			[]interface{}{"SUBJECT", "SAVEDON", "HEADER", "X-Saved", "SAVEDON"},
+			SearchCriteria{SavedBefore: date},
+		},
+		{
+			[]interface{}{"1:5", "SAVEDON", "1-Feb-2020", "SEEN"},
+			[]interface{}{"1:5", "SEEN"},
+			SearchCriteria{SavedSince: date, SavedBefore: date.Add(24 * time.Hour)},
+		},
+	}
+
+	for _, tc := range testData {
+		criteria := &SearchCriteria{}
+		rest, err := criteria.parseFields(tc.fields)
+		require.NoError(t, err, tc.fields)
+		require.Equal(t, tc.wantRest, rest, tc.fields)
+		require.Equal(t, tc.wantSaveDates, *criteria, tc.fields)
+	}
+}
+
+func TestParseSearchInvalid(t *testing.T) {
+	for _, fields := range [][]interface{}{
+		{"SAVEDON"},
+		{"SAVEDSINCE", "yesterday"},
+	} {
+		_, err := (&SearchCriteria{}).parseFields(fields)
+		require.Error(t, err, fields)
+	}
+
+	// Not supported inside of NOT, left to fail in go-imap.
+	search := &Search{}
+	require.Error(t, search.Parse([]interface{}{"NOT", "SAVEDON", "1-Feb-2020"}))
+}
+
+func TestSearchCriteriaMatch(t *testing.T) {
+	date := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	onDate := SearchCriteria{SavedSince: date, SavedBefore: date.Add(24 * time.Hour)}
+
+	require.True(t, (&SearchCriteria{}).Match(date))
+	require.True(t, onDate.Match(date.Add(10*time.Hour)))
+	require.False(t, onDate.Match(date.Add(-time.Hour)))
+	require.False(t, onDate.Match(date.Add(24*time.Hour)))
+}
@@ -28,12 +28,19 @@ import (
 	imapid "github.com/ProtonMail/go-imap-id"
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/imap/compress"
+	"github.com/ProtonMail/proton-bridge/internal/imap/metadata"
+	"github.com/ProtonMail/proton-bridge/internal/imap/savedate"
+	"github.com/ProtonMail/proton-bridge/internal/imap/thread"
 	"github.com/ProtonMail/proton-bridge/internal/imap/uidplus"
+	"github.com/ProtonMail/proton-bridge/internal/imap/xlist"
+	"github.com/ProtonMail/proton-bridge/internal/incidents"
+	"github.com/ProtonMail/proton-bridge/pkg/authpolicy"
+	"github.com/ProtonMail/proton-bridge/pkg/connlimit"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/xoauth2"
 	"github.com/emersion/go-imap"
 	imapappendlimit "github.com/emersion/go-imap-appendlimit"
-	imapidle "github.com/emersion/go-imap-idle"
-	imapmove "github.com/emersion/go-imap-move"
 	imapquota "github.com/emersion/go-imap-quota"
 	imapspecialuse "github.com/emersion/go-imap-specialuse"
 	imapunselect "github.com/emersion/go-imap-unselect"
@@ -44,17 +51,20 @@ import (
 
 type imapServer struct {
 	server        *imapserver.Server
+	fetches       *fetchContexts
+	listener      *multiListener
 	eventListener listener.Listener
 	debugClient   bool
 	debugServer   bool
 }
 
 // NewIMAPServer constructs a new IMAP server configured with the given options.
-func NewIMAPServer(debugClient, debugServer bool, port int, tls *tls.Config, imapBackend *imapBackend, eventListener listener.Listener) *imapServer { //nolint[golint]
+// The authPolicy restricts which clients can authenticate.
+func NewIMAPServer(debugClient, debugServer bool, port int, tls *tls.Config, authPolicy authpolicy.Policy, imapBackend *imapBackend, eventListener listener.Listener) *imapServer { //nolint[golint]
 	s := imapserver.New(imapBackend)
-	s.Addr = fmt.Sprintf("%v:%v", bridge.Host, port)
+	s.Addr = bridge.GetListenAddress(port)
 	s.TLSConfig = tls
-	s.AllowInsecureAuth = true
+	s.AllowInsecureAuth = !authPolicy.RequireTLS
 	s.ErrorLog = newServerErrorLogger("server-imap")
 	s.AutoLogout = 30 * time.Minute
 	s.UpgradeError = imapBackend.upgradeError
@@ -65,7 +75,13 @@ func NewIMAPServer(debugClient, debugServer bool, port int, tls *tls.Config, ima
 		imapid.FieldSupportURL: "https://protonmail.com/support",
 	}
 
-	s.EnableAuth(sasl.Login, func(conn imapserver.Conn) sasl.Server {
+	enableAuth := func(name string, f imapserver.SASLServerFactory) {
+		if authPolicy.IsAllowed(name) {
+			s.EnableAuth(name, f)
+		}
+	}
+
+	enableAuth(sasl.Login, func(conn imapserver.Conn) sasl.Server {
 		conn.Server().ForEachConn(func(candidate imapserver.Conn) {
 			if id, ok := candidate.(imapid.Conn); ok {
 				if conn.Context() == candidate.Context() {
@@ -89,7 +105,7 @@ func NewIMAPServer(debugClient, debugServer bool, port int, tls *tls.Config, ima
 		})
 
 		return sasl.NewLoginServer(func(address, password string) error {
-			user, err := conn.Server().Backend.Login(nil, address, password)
+			user, err := conn.Server().Backend.Login(conn.Info(), address, password)
 			if err != nil {
 				return err
 			}
@@ -101,19 +117,52 @@ func NewIMAPServer(debugClient, debugServer bool, port int, tls *tls.Config, ima
 		})
 	})
 
+	loginWithToken := func(conn imapserver.Conn) xoauth2.Authenticator {
+		return func(username, token string) error {
+			user, err := imapBackend.loginWithToken(conn.Info(), username, token)
+			if err != nil {
+				return err
+			}
+
+			ctx := conn.Context()
+			ctx.State = imap.AuthenticatedState
+			ctx.User = user
+			return nil
+		}
+	}
+
+	enableAuth(xoauth2.Mechanism, func(conn imapserver.Conn) sasl.Server {
+		return xoauth2.NewServer(loginWithToken(conn))
+	})
+
+	enableAuth(sasl.OAuthBearer, func(conn imapserver.Conn) sasl.Server {
+		return xoauth2.NewOAuthBearerServer(loginWithToken(conn))
+	})
+
+	quotaExtension := newSessionQuotaExtension()
+
 	s.Enable(
-		imapidle.NewExtension(),
-		imapmove.NewExtension(),
+		newIdleExtension(),
 		imapspecialuse.NewExtension(),
+		xlist.NewExtension(),
 		imapid.NewExtension(serverID),
 		imapquota.NewExtension(),
 		imapappendlimit.NewExtension(),
 		imapunselect.NewExtension(),
 		uidplus.NewExtension(),
+		savedate.NewExtension(),
+		thread.NewExtension(),
+		metadata.NewExtension(),
+		compress.NewExtension(),
+		newAuthPolicyExtension(authPolicy),
+		quotaExtension,
+		newAppleMailExtension(),
 	)
 
 	return &imapServer{
 		server:        s,
+		fetches:       quotaExtension.fetches,
+		listener:      newMultiListener(),
 		eventListener: eventListener,
 		debugClient:   debugClient,
 		debugServer:   debugServer,
@@ -128,16 +177,19 @@ func (s *imapServer) ListenAndServe() {
 	l, err := net.Listen("tcp", s.server.Addr)
 	if err != nil {
 		s.eventListener.Emit(events.ErrorEvent, "IMAP failed: "+err.Error())
+		incidents.Report(incidents.ServerFailed, "", "IMAP failed: "+err.Error())
 		log.Error("IMAP failed: ", err)
 		return
 	}
+	s.listener.serveMain(bridge.NewRemoteAccessListener(l))
 
 	err = s.server.Serve(&debugListener{
-		Listener: l,
+		Listener: connlimit.NewIdleListener(s.listener, connections.IdleTimeout),
 		server:   s,
 	})
 	if err != nil {
 		s.eventListener.Emit(events.ErrorEvent, "IMAP failed: "+err.Error())
+		incidents.Report(incidents.ServerFailed, "", "IMAP failed: "+err.Error())
 		log.Error("IMAP failed: ", err)
 		return
 	}
@@ -146,8 +198,32 @@ func (s *imapServer) ListenAndServe() {
 	log.Info("IMAP server stopped")
 }
 
+// Reload moves the server to the given port on the current bind address
+// without stopping it. Connections accepted before are served until clients
+// close them. The current port is kept when the new one cannot be opened.
+func (s *imapServer) Reload(port int) {
+	if !s.listener.hasMain() {
+		log.Warn("IMAP server is not running, restart is needed to apply the settings")
+		return
+	}
+
+	address := bridge.GetListenAddress(port)
+
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		s.eventListener.Emit(events.ErrorEvent, "IMAP failed: "+err.Error())
+		log.WithError(err).WithField("address", address).Error("Cannot move IMAP server")
+		return
+	}
+
+	log.Info("IMAP server listening at ", address)
+	s.listener.serveMain(bridge.NewRemoteAccessListener(l))
+	s.listener.reopenPorts()
+}
+
 // Stops the server.
 func (s *imapServer) Close() {
+	s.server.ForEachConn(s.fetches.cancel)
 	_ = s.server.Close()
 }
 
@@ -161,6 +237,7 @@ func (s *imapServer) monitorDisconnectedUsers() {
 		disconnectUser := func(conn imapserver.Conn) {
 			connUser := conn.Context().User
 			if connUser != nil && strings.EqualFold(connUser.Username(), address) {
+				s.fetches.cancel(conn)
 				_ = conn.Close()
 			}
 		}
@@ -0,0 +1,306 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/tracing"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+	imapserver "github.com/emersion/go-imap/server"
+)
+
+// throttled is the response code telling the client that the session
+// exceeded its quota and the command can be retried later.
+const throttled imap.StatusRespCode = "THROTTLED"
+
+const (
+	fetchQuotaWindow  = time.Hour
+	appendQuotaWindow = 24 * time.Hour
+)
+
+// SessionQuota limits what a single IMAP session can do, to contain runaway
+// backup tools or misconfigured clients. Zero means no limit.
+type SessionQuota struct {
+	FetchBytesPerHour int64
+	AppendsPerDay     int64
+}
+
+var (
+	sessionQuota     SessionQuota //nolint[gochecknoglobals]
+	sessionQuotaLock sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetSessionQuota sets quotas of IMAP sessions. Quotas apply to commands
+// started after the change, also in already connected sessions.
+func SetSessionQuota(quota SessionQuota) {
+	sessionQuotaLock.Lock()
+	defer sessionQuotaLock.Unlock()
+
+	sessionQuota = quota
+}
+
+func getSessionQuota() SessionQuota {
+	sessionQuotaLock.RLock()
+	defer sessionQuotaLock.RUnlock()
+
+	return sessionQuota
+}
+
+// windowCounter counts usage in fixed windows starting with the first use.
+type windowCounter struct {
+	window time.Duration
+	start  time.Time
+	used   int64
+}
+
+func (c *windowCounter) roll(now time.Time) {
+	if now.Sub(c.start) >= c.window {
+		c.start = now
+		c.used = 0
+	}
+}
+
+func (c *windowCounter) add(now time.Time, n int64) {
+	c.roll(now)
+	c.used += n
+}
+
+// check returns THROTTLED error when the limit was reached in current window.
+func (c *windowCounter) check(now time.Time, limit int64, what string) error {
+	c.roll(now)
+	if limit <= 0 || c.used < limit {
+		return nil
+	}
+
+	retryIn := c.start.Add(c.window).Sub(now).Round(time.Minute)
+	if retryIn < time.Minute {
+		retryIn = time.Minute
+	}
+
+	return imapserver.ErrStatusResp(&imap.StatusResp{
+		Type: imap.StatusRespNo,
+		Code: throttled,
+		Info: fmt.Sprintf("Session quota of %s exceeded, try again in %v", what, retryIn),
+	})
+}
+
+// sessionUsage is what one session used from its quotas.
+type sessionUsage struct {
+	// id correlates logs of commands of the session, see tracing.
+	id string
+
+	lock    sync.Mutex
+	fetched windowCounter
+	appends windowCounter
+}
+
+func newSessionUsage() *sessionUsage {
+	return &sessionUsage{
+		id:      tracing.NewSessionID("imap"),
+		fetched: windowCounter{window: fetchQuotaWindow},
+		appends: windowCounter{window: appendQuotaWindow},
+	}
+}
+
+func (u *sessionUsage) checkFetch(quota SessionQuota) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	return u.fetched.check(time.Now(), quota.FetchBytesPerHour, fmt.Sprintf("%d bytes fetched per hour", quota.FetchBytesPerHour))
+}
+
+func (u *sessionUsage) addFetched(size int64) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.fetched.add(time.Now(), size)
+}
+
+func (u *sessionUsage) checkAppend(quota SessionQuota) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	return u.appends.check(time.Now(), quota.AppendsPerDay, fmt.Sprintf("%d messages appended per day", quota.AppendsPerDay))
+}
+
+func (u *sessionUsage) addAppended() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.appends.add(time.Now(), 1)
+}
+
+// sessionQuotaExtension overrides FETCH and APPEND commands to enforce
+// session quotas. The command which crosses the limit is finished, next
+// ones are refused with THROTTLED response code. FETCH is also run with
+// a context which can be cancelled, see fetchContexts.
+type sessionQuotaExtension struct {
+	lock     sync.Mutex
+	sessions map[*imapserver.Context]*sessionUsage
+
+	fetches *fetchContexts
+}
+
+func newSessionQuotaExtension() *sessionQuotaExtension {
+	return &sessionQuotaExtension{
+		sessions: make(map[*imapserver.Context]*sessionUsage),
+		fetches:  newFetchContexts(),
+	}
+}
+
+func (ext *sessionQuotaExtension) Capabilities(c imapserver.Conn) []string {
+	return nil
+}
+
+func (ext *sessionQuotaExtension) Command(name string) imapserver.HandlerFactory {
+	switch name {
+	case "FETCH":
+		return func() imapserver.Handler {
+			return &quotaFetch{ext: ext}
+		}
+	case "APPEND":
+		return func() imapserver.Handler {
+			return &quotaAppend{ext: ext}
+		}
+	}
+	return nil
+}
+
+// usage returns usage of the connection's session. It is forgotten
+// when the client logs out.
+func (ext *sessionQuotaExtension) usage(conn imapserver.Conn) *sessionUsage {
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+
+	ctx := conn.Context()
+	if usage, ok := ext.sessions[ctx]; ok {
+		return usage
+	}
+
+	usage := newSessionUsage()
+	ext.sessions[ctx] = usage
+
+	l := log.WithField(tracing.LogField, usage.id)
+	if info := conn.Info(); info != nil && info.RemoteAddr != nil {
+		l = l.WithField("rem", info.RemoteAddr.String())
+	}
+	l.Debug("New IMAP session")
+
+	go func() {
+		<-ctx.LoggedOut
+
+		ext.lock.Lock()
+		defer ext.lock.Unlock()
+
+		delete(ext.sessions, ctx)
+	}()
+
+	return usage
+}
+
+type quotaFetch struct {
+	imapserver.Fetch
+
+	ext *sessionQuotaExtension
+}
+
+func (cmd *quotaFetch) Handle(conn imapserver.Conn) error {
+	return cmd.handle(conn, false)
+}
+
+func (cmd *quotaFetch) UidHandle(conn imapserver.Conn) error { //nolint[golint]
+	return cmd.handle(conn, true)
+}
+
+func (cmd *quotaFetch) handle(conn imapserver.Conn, isUID bool) error {
+	usage := cmd.ext.usage(conn)
+	if err := usage.checkFetch(getSessionQuota()); err != nil {
+		return err
+	}
+
+	ctx, finish := cmd.ext.fetches.start(conn)
+	defer finish()
+	ctx = tracing.WithSessionID(ctx, usage.id)
+
+	return handleFetch(ctx, &countingConn{Conn: conn, usage: usage}, &cmd.Fetch, isUID)
+}
+
+// countingConn counts bytes of message literals written in FETCH responses.
+type countingConn struct {
+	imapserver.Conn
+
+	usage *sessionUsage
+}
+
+func (conn *countingConn) WriteResp(res imap.WriterTo) error {
+	if fetch, ok := res.(*responses.Fetch); ok {
+		res = &countingFetch{messages: fetch.Messages, usage: conn.usage}
+	}
+	return conn.Conn.WriteResp(res)
+}
+
+// countingFetch writes messages the same way as responses.Fetch.
+type countingFetch struct {
+	messages <-chan *imap.Message
+	usage    *sessionUsage
+}
+
+func (res *countingFetch) WriteTo(w *imap.Writer) error {
+	for msg := range res.messages {
+		var size int64
+		for _, literal := range msg.Body {
+			if literal != nil {
+				size += int64(literal.Len())
+			}
+		}
+		res.usage.addFetched(size)
+
+		resp := imap.NewUntaggedResp([]interface{}{msg.SeqNum, imap.RawString("FETCH"), msg.Format()})
+		if err := resp.WriteTo(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type quotaAppend struct {
+	imapserver.Append
+
+	ext *sessionQuotaExtension
+}
+
+func (cmd *quotaAppend) Handle(conn imapserver.Conn) error {
+	usage := cmd.ext.usage(conn)
+	if err := usage.checkAppend(getSessionQuota()); err != nil {
+		return err
+	}
+
+	err := cmd.Append.Handle(conn)
+
+	// UIDPLUS reports success as status response with APPENDUID code.
+	if statusErr, ok := err.(*imap.ErrStatusResp); err == nil || (ok && statusErr.Resp.Type == imap.StatusRespOk) {
+		usage.addAppended()
+	}
+
+	return err
+}
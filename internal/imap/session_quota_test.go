@@ -0,0 +1,121 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/backend/memory"
+	imapserver "github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSessionQuotaServer(t *testing.T, quota SessionQuota) (*textproto.Conn, func()) {
+	SetSessionQuota(quota)
+
+	s := imapserver.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.Enable(newSessionQuotaExtension())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = s.Serve(l) }()
+
+	conn, err := textproto.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.ReadLine()
+	require.NoError(t, err)
+
+	return conn, func() {
+		_ = conn.Close()
+		_ = s.Close()
+		SetSessionQuota(SessionQuota{})
+	}
+}
+
+// readTagged skips untagged responses and returns the tagged one.
+func readTagged(t *testing.T, conn *textproto.Conn, tag string) string {
+	for {
+		response, err := conn.ReadLine()
+		require.NoError(t, err)
+		if strings.HasPrefix(response, tag+" ") {
+			return response
+		}
+	}
+}
+
+func sessionQuotaCmd(t *testing.T, conn *textproto.Conn, tag, cmd string) string {
+	require.NoError(t, conn.PrintfLine("%s %s", tag, cmd))
+	return readTagged(t, conn, tag)
+}
+
+func sessionQuotaAppend(t *testing.T, conn *textproto.Conn, tag string) string {
+	body := "Subject: test\r\n\r\nbody"
+	require.NoError(t, conn.PrintfLine("%s APPEND INBOX {%d}", tag, len(body)))
+
+	response, err := conn.ReadLine()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(response, "+"), response)
+
+	require.NoError(t, conn.PrintfLine("%s", body))
+	return readTagged(t, conn, tag)
+}
+
+func TestSessionQuotaFetch(t *testing.T) {
+	conn, clear := newTestSessionQuotaServer(t, SessionQuota{FetchBytesPerHour: 1})
+	defer clear()
+
+	require.Contains(t, sessionQuotaCmd(t, conn, "a", "LOGIN username password"), "a OK")
+	require.Contains(t, sessionQuotaCmd(t, conn, "b", "SELECT INBOX"), "b OK")
+	require.Contains(t, sessionQuotaCmd(t, conn, "c", "FETCH 1 FLAGS"), "c OK", "no bytes fetched yet")
+	require.Contains(t, sessionQuotaCmd(t, conn, "d", "FETCH 1 BODY.PEEK[]"), "d OK", "command crossing the limit is finished")
+	require.Contains(t, sessionQuotaCmd(t, conn, "e", "UID FETCH 1 BODY.PEEK[]"), "e NO [THROTTLED]")
+	require.Contains(t, sessionQuotaCmd(t, conn, "f", "FETCH 1 FLAGS"), "f NO [THROTTLED]")
+}
+
+func TestSessionQuotaAppend(t *testing.T) {
+	conn, clear := newTestSessionQuotaServer(t, SessionQuota{AppendsPerDay: 2})
+	defer clear()
+
+	require.Contains(t, sessionQuotaCmd(t, conn, "a", "LOGIN username password"), "a OK")
+	for i := 0; i < 2; i++ {
+		tag := fmt.Sprintf("b%d", i)
+		require.Contains(t, sessionQuotaAppend(t, conn, tag), tag+" OK")
+	}
+
+	response := sessionQuotaAppend(t, conn, "c")
+	require.Contains(t, response, "c NO [THROTTLED]")
+	require.Contains(t, response, "2 messages appended per day")
+}
+
+func TestSessionQuotaDisabled(t *testing.T) {
+	conn, clear := newTestSessionQuotaServer(t, SessionQuota{})
+	defer clear()
+
+	require.Contains(t, sessionQuotaCmd(t, conn, "a", "LOGIN username password"), "a OK")
+	require.Contains(t, sessionQuotaCmd(t, conn, "b", "SELECT INBOX"), "b OK")
+	for i := 0; i < 3; i++ {
+		tag := fmt.Sprintf("c%d", i)
+		require.Contains(t, sessionQuotaCmd(t, conn, tag, "FETCH 1 BODY.PEEK[]"), tag+" OK")
+		require.Contains(t, sessionQuotaAppend(t, conn, "d"+tag), "d"+tag+" OK")
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/emersion/go-imap"
+)
+
+// spoolMemoryLimit is the size up to which built messages and attachments
+// are kept in memory. Bigger ones are spooled to a temporary file.
+const spoolMemoryLimit = 8 * 1024 * 1024
+
+// spoolChunkSize is the size of chunks in which content is encrypted before
+// it is written to the temporary file.
+const spoolChunkSize = 32 * 1024
+
+// messageBody is the built message from which sections are read. It is
+// either in memory or spooled to a temporary file, see spool.
+type messageBody interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// spool collects the message or the attachment being built in memory until
+// it reaches the limit, then it moves it to a temporary file, so messages
+// with big attachments do not need memory of their size. The file is
+// encrypted by a random key which is held only in memory, so the decrypted
+// content never reaches the disk. The file is removed right away where open
+// files can be removed, otherwise when the spool is closed.
+type spool struct {
+	limit int
+	buf   bytes.Buffer
+
+	file    *os.File
+	w       *bufio.Writer
+	block   cipher.Block
+	iv      []byte
+	stream  cipher.Stream
+	scratch []byte
+	size    int64
+	remove  bool
+	closed  bool
+	err     error
+}
+
+func newSpool() *spool {
+	return &spool{limit: spoolMemoryLimit}
+}
+
+func (s *spool) Write(p []byte) (n int, err error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	defer func() {
+		if err != nil {
+			s.err = err
+		}
+	}()
+
+	if s.file == nil {
+		if s.buf.Len()+len(p) <= s.limit {
+			return s.buf.Write(p)
+		}
+		if err = s.spill(); err != nil {
+			return 0, err
+		}
+	}
+
+	for n < len(p) {
+		chunk := p[n:]
+		if len(chunk) > len(s.scratch) {
+			chunk = chunk[:len(s.scratch)]
+		}
+		encrypted := s.scratch[:len(chunk)]
+		s.stream.XORKeyStream(encrypted, chunk)
+
+		var written int
+		written, err = s.w.Write(encrypted)
+		n += written
+		s.size += int64(written)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// spill moves the content collected in memory to the temporary file.
+func (s *spool) spill() error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	// The second half of IV is the counter of blocks, see keyStream.
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv[:aes.BlockSize/2]); err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile("", "bridge-spool-")
+	if err != nil {
+		return err
+	}
+	s.remove = os.Remove(file.Name()) != nil
+
+	s.file, s.w = file, bufio.NewWriter(file)
+	s.block, s.iv = block, iv
+	s.stream = s.keyStream(0)
+	s.scratch = make([]byte, spoolChunkSize)
+
+	data := s.buf.Bytes()
+	s.buf = bytes.Buffer{}
+	_, err = s.Write(data)
+	return err
+}
+
+// keyStream returns the key stream of CTR mode from the offset, so any part
+// of the file can be decrypted.
+func (s *spool) keyStream(off int64) cipher.Stream {
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, s.iv)
+	binary.BigEndian.PutUint64(iv[aes.BlockSize/2:], uint64(off/aes.BlockSize))
+
+	stream := cipher.NewCTR(s.block, iv)
+	skip := make([]byte, off%aes.BlockSize)
+	stream.XORKeyStream(skip, skip)
+	return stream
+}
+
+// ReadAt reads the content written so far. Reads can run in parallel once
+// writing is done.
+func (s *spool) ReadAt(p []byte, off int64) (int, error) {
+	if s.file == nil {
+		return bytes.NewReader(s.buf.Bytes()).ReadAt(p, off)
+	}
+	if err := s.w.Flush(); err != nil {
+		return 0, err
+	}
+
+	n, err := s.file.ReadAt(p, off)
+	s.keyStream(off).XORKeyStream(p[:n], p[:n])
+	return n, err
+}
+
+// Err returns the first error of writing to the spool.
+func (s *spool) Err() error {
+	return s.err
+}
+
+// Size returns the size of the content written so far.
+func (s *spool) Size() int64 {
+	if s.file == nil {
+		return int64(s.buf.Len())
+	}
+	return s.size
+}
+
+// Bytes returns the content unless it was moved to the temporary file.
+func (s *spool) Bytes() ([]byte, bool) {
+	return s.buf.Bytes(), s.file == nil
+}
+
+// Close removes the temporary file. Content kept in memory can be still
+// read.
+func (s *spool) Close() error {
+	if s.file == nil || s.closed {
+		return nil
+	}
+	s.closed = true
+
+	err := s.file.Close()
+	if s.remove {
+		if rmErr := os.Remove(s.file.Name()); err == nil {
+			err = rmErr
+		}
+	}
+	return err
+}
+
+// closeMessageBody removes the temporary file of the spooled body.
+func closeMessageBody(body messageBody) {
+	if s, ok := body.(*spool); ok {
+		_ = s.Close()
+	}
+}
+
+// sectionLiteral is the literal of the section read right from the built
+// message. The body is closed once the literal is read completely, so the
+// temporary file of the spooled message is removed as soon as the response
+// is sent.
+type sectionLiteral struct {
+	r    *io.SectionReader
+	body messageBody
+}
+
+// newSectionLiteral returns the literal of the section trimmed the same way
+// as by imap.BodySectionName.ExtractPartial.
+func newSectionLiteral(body messageBody, r *io.SectionReader, partial []int) imap.Literal {
+	if len(partial) == 2 {
+		from, length := int64(partial[0]), int64(partial[1])
+		if from > r.Size() {
+			from, length = r.Size(), 0
+		}
+		if from+length > r.Size() {
+			length = r.Size() - from
+		}
+		r = io.NewSectionReader(r, from, length)
+	}
+	return &sectionLiteral{r: r, body: body}
+}
+
+// newBytesLiteral returns the literal of the section which is in memory.
+func newBytesLiteral(b []byte, partial []int) imap.Literal {
+	return newSectionLiteral(nil, io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b))), partial)
+}
+
+func (l *sectionLiteral) Len() int {
+	return int(l.r.Size())
+}
+
+func (l *sectionLiteral) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if err == io.EOF {
+		closeMessageBody(l.body)
+	}
+	return n, err
+}
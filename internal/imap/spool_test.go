@@ -0,0 +1,107 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpoolKeepsSmallContentInMemory(t *testing.T) {
+	s := &spool{limit: 10}
+	_, err := s.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	data, ok := s.Bytes()
+	require.True(t, ok)
+	require.Equal(t, "hello", string(data))
+	require.Nil(t, s.file)
+	require.NoError(t, s.Close())
+}
+
+func TestSpoolMovesBigContentToFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4*spoolChunkSize/16+3)
+
+	s := &spool{limit: 10}
+	for i := 0; i < len(content); i += 7 {
+		end := i + 7
+		if end > len(content) {
+			end = len(content)
+		}
+		_, err := s.Write(content[i:end])
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.Err())
+	require.Equal(t, int64(len(content)), s.Size())
+
+	_, ok := s.Bytes()
+	require.False(t, ok)
+
+	// The content is not written to the file in plain text.
+	require.NoError(t, s.w.Flush())
+	encrypted := make([]byte, len(content))
+	_, err := s.file.ReadAt(encrypted, 0)
+	require.NoError(t, err)
+	require.NotEqual(t, content, encrypted)
+
+	for _, off := range []int{0, 1, 15, 17, spoolChunkSize - 1, spoolChunkSize + 5, len(content) - 3} {
+		got := make([]byte, 33)
+		n, _ := s.ReadAt(got, int64(off))
+		want := content[off:]
+		if len(want) > len(got) {
+			want = want[:len(got)]
+		}
+		require.Equal(t, want, got[:n], "offset %d", off)
+	}
+
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close())
+}
+
+func TestSectionLiteral(t *testing.T) {
+	s := &spool{limit: 4}
+	_, err := s.Write([]byte("header\r\n\r\nbody"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		partial []int
+		want    string
+	}{
+		{nil, "header\r\n\r\nbody"},
+		{[]int{0, 6}, "header"},
+		{[]int{10, 100}, "body"},
+		{[]int{100, 5}, ""},
+	}
+	for _, test := range tests {
+		literal := newSectionLiteral(nil, io.NewSectionReader(s, 0, s.Size()), test.partial)
+		require.Equal(t, len(test.want), literal.Len())
+		got, err := ioutil.ReadAll(literal)
+		require.NoError(t, err)
+		require.Equal(t, test.want, string(got))
+	}
+
+	// The spooled body is closed once the literal is read.
+	literal := newSectionLiteral(s, io.NewSectionReader(s, 0, s.Size()), nil)
+	_, err = ioutil.ReadAll(literal)
+	require.NoError(t, err)
+	require.True(t, s.closed)
+}
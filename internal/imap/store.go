@@ -18,12 +18,15 @@
 package imap
 
 import (
+	"context"
 	"io"
 	"net/mail"
+	"time"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/ProtonMail/proton-bridge/internal/imap/uidplus"
 	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
@@ -31,16 +34,56 @@ type storeUserProvider interface {
 	UserID() string
 	GetSpace() (usedSpace, maxSpace uint, err error)
 	GetMaxUpload() (uint, error)
+	IsInMaintenance() bool
+	StartIdle()
+	StopIdle()
+	NotifyClientActivity()
+	GetMailboxMapping() string
+	GetRemoteContentFilter() message.RemoteContentFilter
+	GetPhishingResult(msg *pmapi.Message) (message.PhishingResult, bool)
+	GetLabelNames(labelIDs []string) []string
 
 	GetAddress(addressID string) (storeAddressProvider, error)
 
+	GetCachedMessage(apiID string) ([]byte, bool)
+	SetCachedMessage(apiID string, body []byte)
+
+	GetCachedAttachment(messageID, attachmentID string) (io.ReadCloser, bool)
+	NewCachedAttachmentWriter(messageID string, att *pmapi.Attachment) store.CachedAttachmentWriter
+
+	IsMessageIndexed(apiID string) bool
+	IndexMessage(apiID string, body []byte)
+	MatchMessage(apiID string, body, text []string) bool
+	MatchMessageBody(body []byte, bodyQueries, textQueries []string) bool
+
+	AddKeyword(apiIDs []string, keyword string) error
+	RemoveKeyword(apiIDs []string, keyword string) error
+	AddReadReceipt(receiptID, originalExternalID string) error
+	ScheduleMessage(kr *crypto.KeyRing, sendAt time.Time, from string, to []string, body []byte) (string, error)
+	GetScheduledMessages() ([]*store.ScheduledMessage, error)
+	GetScheduledMessagesNextUID() (uint32, error)
+	RescheduleMessage(id string, sendAt time.Time) (string, uint32, error)
+	CopyScheduledMessage(id string, sendAt time.Time) (string, uint32, error)
+	RemoveScheduledMessage(id string) error
+	GetSnoozedMessages() ([]*store.SnoozedMessage, error)
+	GetSnoozedMessagesNextUID() (uint32, error)
+	RescheduleSnoozedMessages(apiIDs []string, target string, wakeAt time.Time) error
+	RemoveSnoozedMessages(apiIDs []string) error
+
 	CreateDraft(
 		kr *crypto.KeyRing,
 		message *pmapi.Message,
 		attachmentReaders []io.Reader,
 		attachedPublicKey,
 		attachedPublicKeyName string,
-		parentID string) (*pmapi.Message, []*pmapi.Attachment, error)
+		parentID string,
+		progress store.AttachmentProgress) (*pmapi.Message, []*pmapi.Attachment, error)
+	UpdateDraft(
+		kr *crypto.KeyRing,
+		draftID string,
+		message *pmapi.Message,
+		attachmentReaders []io.Reader) (*pmapi.Message, error)
+	FindSentMessage(externalID, fingerprint string) string
 }
 
 type storeAddressProvider interface {
@@ -49,6 +92,7 @@ type storeAddressProvider interface {
 	APIAddress() *pmapi.Address
 
 	CreateMailbox(name string) error
+	RefreshMailboxes()
 	ListMailboxes() []storeMailboxProvider
 	GetMailbox(name string) (storeMailboxProvider, error)
 }
@@ -69,12 +113,13 @@ type storeMailboxProvider interface {
 	GetLatestAPIID() (string, error)
 	GetNextUID() (uint32, error)
 	GetCounts() (dbTotal, dbUnread, dbUnreadSeqNum uint, err error)
+	GetRecentCount() (uint, error)
 	GetUIDList(apiIDs []string) *uidplus.OrderedSeq
 	GetUIDByHeader(header *mail.Header) uint32
 	GetDelimiter() string
 
 	GetMessage(apiID string) (storeMessageProvider, error)
-	FetchMessage(apiID string) (storeMessageProvider, error)
+	FetchMessage(ctx context.Context, apiID string) (storeMessageProvider, error)
 	LabelMessages(apiID []string) error
 	UnlabelMessages(apiID []string) error
 	MarkMessagesRead(apiID []string) error
@@ -83,6 +128,10 @@ type storeMailboxProvider interface {
 	MarkMessagesUnstarred(apiID []string) error
 	ImportMessage(msg *pmapi.Message, body []byte, labelIDs []string) error
 	DeleteMessages(apiID []string) error
+	MarkMessagesDeleted(apiID []string) error
+	MarkMessagesUndeleted(apiID []string) error
+	ExpungeMessages(apiID []string) error
+	SnoozeMessages(apiID []string, target string, wakeAt time.Time) error
 }
 
 type storeMessageProvider interface {
@@ -90,6 +139,9 @@ type storeMessageProvider interface {
 	UID() (uint32, error)
 	SequenceNumber() (uint32, error)
 	Message() *pmapi.Message
+	SaveDate() time.Time
+	Keywords() []string
+	IsMarkedDeleted() bool
 
 	SetSize(int64) error
 	SetContentTypeAndHeader(string, mail.Header) error
@@ -151,6 +203,6 @@ func (s *storeMailboxWrap) GetMessage(apiID string) (storeMessageProvider, error
 	return s.Mailbox.GetMessage(apiID)
 }
 
-func (s *storeMailboxWrap) FetchMessage(apiID string) (storeMessageProvider, error) {
-	return s.Mailbox.FetchMessage(apiID)
+func (s *storeMailboxWrap) FetchMessage(ctx context.Context, apiID string) (storeMessageProvider, error) {
+	return s.Mailbox.FetchMessage(ctx, apiID)
 }
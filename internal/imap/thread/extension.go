@@ -0,0 +1,185 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package thread implements THREAD=ORDEREDSUBJECT and THREAD=REFERENCES
+// extensions (RFC 5256).
+package thread
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/server"
+)
+
+// Supported threading algorithms.
+const (
+	OrderedSubject = "ORDEREDSUBJECT"
+	References     = "REFERENCES"
+)
+
+const commandName = "THREAD"
+
+// Mailbox is the mailbox which provides data needed for threading.
+type Mailbox interface {
+	// GetThreadMessages returns messages matching the criteria. ID of
+	// messages is UID when uid is set, sequence number otherwise.
+	GetThreadMessages(uid bool, criteria *imap.SearchCriteria) ([]*Message, error)
+}
+
+// Thread is the command to thread messages.
+type Thread struct {
+	Algorithm string
+	commands.Search
+}
+
+func (cmd *Thread) Parse(fields []interface{}) error {
+	if len(fields) < 3 {
+		return errors.New("algorithm, charset and search criteria are required")
+	}
+
+	algorithm, ok := fields[0].(string)
+	if !ok {
+		return errors.New("algorithm must be an atom")
+	}
+	cmd.Algorithm = strings.ToUpper(algorithm)
+	if cmd.Algorithm != OrderedSubject && cmd.Algorithm != References {
+		return errors.New("unsupported threading algorithm")
+	}
+
+	// Charset is mandatory for THREAD but optional for SEARCH.
+	searchFields := append([]interface{}{"CHARSET"}, fields[1:]...)
+	return cmd.Search.Parse(searchFields)
+}
+
+func (cmd *Thread) handle(uid bool, conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return server.ErrNoMailboxSelected
+	}
+
+	mailbox, ok := ctx.Mailbox.(Mailbox)
+	if !ok {
+		return errors.New("threading is not supported")
+	}
+
+	messages, err := mailbox.GetThreadMessages(uid, cmd.Criteria)
+	if err != nil {
+		return err
+	}
+
+	var threads []*Node
+	if cmd.Algorithm == OrderedSubject {
+		threads = ThreadOrderedSubject(messages)
+	} else {
+		threads = ThreadReferences(messages)
+	}
+
+	return conn.WriteResp(&Response{Threads: threads})
+}
+
+func (cmd *Thread) Handle(conn server.Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Thread) UidHandle(conn server.Conn) error { //nolint[golint]
+	return cmd.handle(true, conn)
+}
+
+// Response is the untagged THREAD response.
+type Response struct {
+	Threads []*Node
+}
+
+func (r *Response) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{imap.RawString(commandName)}
+	if len(r.Threads) > 0 {
+		fields = append(fields, imap.RawString(FormatThreads(r.Threads)))
+	}
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
+
+// FormatThreads formats threads as described in RFC 5256 section 4.
+// Chains of single children are written flat and siblings are nested.
+func FormatThreads(threads []*Node) string {
+	b := &strings.Builder{}
+	for _, t := range threads {
+		b.WriteByte('(')
+		writeMembers(b, t)
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+func writeMembers(b *strings.Builder, node *Node) {
+	isFirst := true
+	for ; node != nil; node = onlyChild(node) {
+		if node.ID != 0 {
+			if !isFirst {
+				b.WriteByte(' ')
+			}
+			b.WriteString(strconv.FormatUint(uint64(node.ID), 10))
+			isFirst = false
+		}
+
+		if len(node.Children) > 1 {
+			if !isFirst {
+				b.WriteByte(' ')
+			}
+			for _, child := range node.Children {
+				b.WriteByte('(')
+				writeMembers(b, child)
+				b.WriteByte(')')
+			}
+			return
+		}
+	}
+}
+
+func onlyChild(node *Node) *Node {
+	if len(node.Children) == 1 {
+		return node.Children[0]
+	}
+	return nil
+}
+
+type extension struct{}
+
+// NewExtension of THREAD.
+func NewExtension() server.Extension {
+	return &extension{}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{commandName + "=" + OrderedSubject, commandName + "=" + References}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	if name == commandName {
+		return func() server.Handler {
+			return &Thread{}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package thread
+
+import (
+	"strings"
+)
+
+// BaseSubject extracts the base subject (RFC 5256 section 2.1) which is
+// compared case-insensitively, so it is returned in upper case. It also
+// returns whether the subject indicates a reply or forward.
+func BaseSubject(subject string) (base string, isReplyOrForward bool) {
+	base = strings.ToUpper(strings.Join(strings.Fields(subject), " "))
+
+	for {
+		// Remove trailing "(FWD)".
+		for strings.HasSuffix(base, "(FWD)") {
+			base = strings.TrimSpace(strings.TrimSuffix(base, "(FWD)"))
+			isReplyOrForward = true
+		}
+
+		for {
+			previous := base
+
+			// Remove leading "RE:", "FW:" or "FWD:" with optional blobs.
+			if rest, ok := trimLeader(base); ok {
+				base = rest
+				isReplyOrForward = true
+			}
+
+			// Remove leading blob unless it is the whole subject.
+			if rest, ok := trimBlob(base); ok && rest != "" {
+				base = rest
+			}
+
+			if base == previous {
+				break
+			}
+		}
+
+		// Remove "[FWD: ...]" wrapping.
+		if strings.HasPrefix(base, "[FWD:") && strings.HasSuffix(base, "]") {
+			base = strings.TrimSpace(base[len("[FWD:") : len(base)-1])
+			isReplyOrForward = true
+			continue
+		}
+
+		return base, isReplyOrForward
+	}
+}
+
+// trimLeader removes subj-refwd with preceding blobs.
+func trimLeader(subject string) (string, bool) {
+	rest := subject
+	for {
+		withoutBlob, ok := trimBlob(rest)
+		if !ok {
+			break
+		}
+		rest = withoutBlob
+	}
+
+	switch {
+	case strings.HasPrefix(rest, "RE"):
+		rest = rest[len("RE"):]
+	case strings.HasPrefix(rest, "FWD"):
+		rest = rest[len("FWD"):]
+	case strings.HasPrefix(rest, "FW"):
+		rest = rest[len("FW"):]
+	default:
+		return subject, false
+	}
+
+	rest = strings.TrimLeft(rest, " \t")
+	if withoutBlob, ok := trimBlob(rest); ok {
+		rest = withoutBlob
+	}
+
+	if !strings.HasPrefix(rest, ":") {
+		return subject, false
+	}
+
+	return strings.TrimSpace(rest[1:]), true
+}
+
+// trimBlob removes leading "[...]" which doesn't contain brackets.
+func trimBlob(subject string) (string, bool) {
+	if !strings.HasPrefix(subject, "[") {
+		return subject, false
+	}
+	end := strings.IndexAny(subject[1:], "[]")
+	if end < 0 || subject[1+end] != ']' {
+		return subject, false
+	}
+	return strings.TrimLeft(subject[end+2:], " \t"), true
+}
@@ -0,0 +1,331 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package thread
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message contains the data of the message used for threading.
+type Message struct {
+	ID         uint32 // UID or sequence number.
+	MessageID  string
+	References []string // The oldest first; In-Reply-To when there are no references.
+	Subject    string
+	Date       time.Time // Sent date.
+}
+
+// Node is a message in the thread. Dummy node used to group messages
+// without a common parent message has zero ID.
+type Node struct {
+	ID       uint32
+	Children []*Node
+}
+
+// ThreadOrderedSubject groups messages by their base subject. The first
+// message of each group is the parent of the others (RFC 5256 section 3).
+func ThreadOrderedSubject(messages []*Message) []*Node { //nolint[golint]
+	type subjectMessage struct {
+		*Message
+		subject string
+	}
+
+	sorted := make([]subjectMessage, len(messages))
+	for i, msg := range messages {
+		subject, _ := BaseSubject(msg.Subject)
+		sorted[i] = subjectMessage{Message: msg, subject: subject}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].subject != sorted[j].subject {
+			return sorted[i].subject < sorted[j].subject
+		}
+		return isBefore(sorted[i].Date, sorted[i].ID, sorted[j].Date, sorted[j].ID)
+	})
+
+	threads := []*Node{}
+	firsts := map[*Node]*Message{}
+	for i, msg := range sorted {
+		node := &Node{ID: msg.ID}
+		if i > 0 && msg.subject == sorted[i-1].subject {
+			parent := threads[len(threads)-1]
+			parent.Children = append(parent.Children, node)
+			continue
+		}
+		threads = append(threads, node)
+		firsts[node] = msg.Message
+	}
+
+	sort.SliceStable(threads, func(i, j int) bool {
+		a, b := firsts[threads[i]], firsts[threads[j]]
+		return isBefore(a.Date, a.ID, b.Date, b.ID)
+	})
+
+	return threads
+}
+
+type container struct {
+	message  *Message
+	parent   *container
+	children []*container
+}
+
+func (c *container) isDescendantOf(ancestor *container) bool {
+	for node := c; node != nil; node = node.parent {
+		if node == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *container) addChild(child *container) {
+	if child.parent != nil {
+		child.parent.removeChild(child)
+	}
+	child.parent = c
+	c.children = append(c.children, child)
+}
+
+func (c *container) removeChild(child *container) {
+	for i, candidate := range c.children {
+		if candidate == child {
+			c.children = append(c.children[:i], c.children[i+1:]...)
+			break
+		}
+	}
+	child.parent = nil
+}
+
+// message returns the message of the container or of its first child when
+// the container is dummy.
+func (c *container) firstMessage() *Message {
+	if c.message != nil || len(c.children) == 0 {
+		return c.message
+	}
+	return c.children[0].message
+}
+
+// ThreadReferences builds threads from Message-ID and References of
+// messages (RFC 5256 section 3).
+func ThreadReferences(messages []*Message) []*Node { //nolint[golint]
+	all := []*container{}
+	byID := map[string]*container{}
+	getContainer := func(id string) *container {
+		if c, ok := byID[id]; ok {
+			return c
+		}
+		c := &container{}
+		byID[id] = c
+		all = append(all, c)
+		return c
+	}
+
+	// Link messages with their references.
+	for _, msg := range messages {
+		c := &container{message: msg}
+		if id := normalizeMessageID(msg.MessageID); id != "" && byID[id] == nil {
+			byID[id] = c
+			all = append(all, c)
+		} else if id != "" && byID[id].message == nil {
+			c = byID[id]
+			c.message = msg
+		} else {
+			// Message without or with duplicate ID has its own container.
+			all = append(all, c)
+		}
+
+		var parent *container
+		for _, ref := range msg.References {
+			ref = normalizeMessageID(ref)
+			if ref == "" {
+				continue
+			}
+			refContainer := getContainer(ref)
+			if parent != nil && refContainer.parent == nil && !parent.isDescendantOf(refContainer) {
+				parent.addChild(refContainer)
+			}
+			parent = refContainer
+		}
+
+		if c.parent != nil {
+			c.parent.removeChild(c)
+		}
+		if parent != nil && !parent.isDescendantOf(c) {
+			parent.addChild(c)
+		}
+	}
+
+	roots := []*container{}
+	for _, c := range all {
+		if c.parent == nil {
+			roots = append(roots, c)
+		}
+	}
+
+	roots = pruneContainers(roots, true)
+	sortContainers(roots)
+	roots = groupBySubject(roots)
+	sortContainers(roots)
+
+	threads := make([]*Node, len(roots))
+	for i, root := range roots {
+		threads[i] = toNode(root)
+	}
+	return threads
+}
+
+// pruneContainers removes dummy containers without children and replaces
+// dummy containers by their children, except at the root level when they
+// have more than one child.
+func pruneContainers(containers []*container, isRoot bool) []*container {
+	pruned := []*container{}
+	for _, c := range containers {
+		c.children = pruneContainers(c.children, false)
+		for _, child := range c.children {
+			child.parent = c
+		}
+
+		switch {
+		case c.message != nil:
+			pruned = append(pruned, c)
+		case len(c.children) == 0:
+		case !isRoot || len(c.children) == 1:
+			for _, child := range c.children {
+				child.parent = c.parent
+			}
+			pruned = append(pruned, c.children...)
+		default:
+			pruned = append(pruned, c)
+		}
+	}
+	return pruned
+}
+
+// sortContainers sorts siblings by sent date. Dummy containers use the date
+// of their first child.
+func sortContainers(containers []*container) {
+	for _, c := range containers {
+		sortContainers(c.children)
+	}
+	sort.SliceStable(containers, func(i, j int) bool {
+		a, b := containers[i].firstMessage(), containers[j].firstMessage()
+		return isBefore(a.Date, a.ID, b.Date, b.ID)
+	})
+}
+
+// groupBySubject merges root threads with the same base subject.
+func groupBySubject(roots []*container) []*container { //nolint[funlen]
+	subjectOf := func(c *container) (string, bool) {
+		if msg := c.firstMessage(); msg != nil {
+			return BaseSubject(msg.Subject)
+		}
+		return "", false
+	}
+
+	table := map[string]*container{}
+	for _, c := range roots {
+		subject, isReply := subjectOf(c)
+		if subject == "" {
+			continue
+		}
+		old, ok := table[subject]
+		if !ok {
+			table[subject] = c
+			continue
+		}
+		_, oldIsReply := subjectOf(old)
+		if (old.message != nil && c.message == nil) || (old.message != nil && oldIsReply && c.message != nil && !isReply) {
+			table[subject] = c
+		}
+	}
+
+	grouped := []*container{}
+	merged := map[*container]bool{}
+	replace := func(old, new *container) {
+		for i, c := range grouped {
+			if c == old {
+				grouped[i] = new
+				return
+			}
+		}
+		grouped = append(grouped, new)
+	}
+
+	for _, c := range roots {
+		if merged[c] {
+			continue
+		}
+
+		subject, isReply := subjectOf(c)
+		first, ok := table[subject]
+		if subject == "" || !ok || first == c {
+			grouped = append(grouped, c)
+			continue
+		}
+		_, firstIsReply := subjectOf(first)
+
+		switch {
+		case first.message == nil && c.message == nil:
+			for len(c.children) > 0 {
+				first.addChild(c.children[0])
+			}
+		case first.message == nil:
+			first.addChild(c)
+		case c.message == nil:
+			c.addChild(first)
+			merged[first] = true
+			table[subject] = c
+			replace(first, c)
+		case isReply && !firstIsReply:
+			first.addChild(c)
+		default:
+			dummy := &container{}
+			dummy.addChild(first)
+			dummy.addChild(c)
+			merged[first] = true
+			table[subject] = dummy
+			replace(first, dummy)
+		}
+	}
+
+	return grouped
+}
+
+func toNode(c *container) *Node {
+	node := &Node{}
+	if c.message != nil {
+		node.ID = c.message.ID
+	}
+	for _, child := range c.children {
+		node.Children = append(node.Children, toNode(child))
+	}
+	return node
+}
+
+func isBefore(dateA time.Time, idA uint32, dateB time.Time, idB uint32) bool {
+	if !dateA.Equal(dateB) {
+		return dateA.Before(dateB)
+	}
+	return idA < idB
+}
+
+func normalizeMessageID(id string) string {
+	return strings.TrimSpace(strings.Trim(strings.TrimSpace(id), "<>"))
+}
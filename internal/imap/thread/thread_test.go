@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package thread
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testDate(i int) time.Time {
+	return time.Date(2020, 2, 1, i, 0, 0, 0, time.UTC)
+}
+
+func TestBaseSubject(t *testing.T) {
+	testData := []struct {
+		subject     string
+		wantBase    string
+		wantIsReply bool
+	}{
+		{"Hello   world", "HELLO WORLD", false},
+		{"Re: Hello", "HELLO", true},
+		{"Fwd: RE: Test", "TEST", true},
+		{"Re [x]: Hi", "HI", true},
+		{"[list] Re: [fwd: Hello (fwd)]", "HELLO", true},
+		{"[list] Hello", "HELLO", false},
+		{"[PATCH]", "[PATCH]", false},
+		{"Reply", "REPLY", false},
+		{"", "", false},
+	}
+
+	for _, tc := range testData {
+		base, isReply := BaseSubject(tc.subject)
+		require.Equal(t, tc.wantBase, base, tc.subject)
+		require.Equal(t, tc.wantIsReply, isReply, tc.subject)
+	}
+}
+
+func TestThreadOrderedSubject(t *testing.T) {
+	messages := []*Message{
+		{ID: 1, Subject: "Hello", Date: testDate(0)},
+		{ID: 2, Subject: "Re: hello", Date: testDate(1)},
+		{ID: 3, Subject: "Other", Date: testDate(2)},
+		{ID: 4, Subject: "RE: Hello", Date: testDate(3)},
+		{ID: 5, Subject: "Fwd: other", Date: testDate(4)},
+		{ID: 6, Subject: "Alone", Date: testDate(5)},
+	}
+
+	require.Equal(t, "(1 (2)(4))(3 5)(6)", FormatThreads(ThreadOrderedSubject(messages)))
+}
+
+func TestThreadReferences(t *testing.T) {
+	messages := []*Message{
+		{ID: 1, MessageID: "<a@pm.me>", Subject: "Hello", Date: testDate(0)},
+		{ID: 2, MessageID: "<b@pm.me>", References: []string{"<a@pm.me>"}, Subject: "Re: Hello", Date: testDate(1)},
+		{ID: 3, MessageID: "<c@pm.me>", References: []string{"<a@pm.me>"}, Subject: "Re: Hello", Date: testDate(2)},
+		{ID: 4, MessageID: "<d@pm.me>", References: []string{"<a@pm.me>", "<b@pm.me>"}, Subject: "Re: Hello", Date: testDate(3)},
+		{ID: 5, MessageID: "<e@pm.me>", Subject: "Other", Date: testDate(4)},
+		{ID: 6, MessageID: "<f@pm.me>", References: []string{"<missing@pm.me>"}, Subject: "Lost", Date: testDate(5)},
+		{ID: 7, MessageID: "<g@pm.me>", References: []string{"<missing@pm.me>"}, Subject: "Re: Lost", Date: testDate(6)},
+		{ID: 8, MessageID: "<h@pm.me>", Subject: "Re: Other", Date: testDate(7)},
+		{ID: 9, Subject: "No ID", Date: testDate(8)},
+		{ID: 10, MessageID: "<a@pm.me>", Subject: "Duplicate", Date: testDate(9)},
+	}
+
+	require.Equal(t, "(1 (2 4)(3))(5 8)((6)(7))(9)(10)", FormatThreads(ThreadReferences(messages)))
+}
+
+func TestThreadReferencesLoop(t *testing.T) {
+	messages := []*Message{
+		{ID: 1, MessageID: "<a@pm.me>", References: []string{"<b@pm.me>"}, Subject: "A", Date: testDate(0)},
+		{ID: 2, MessageID: "<b@pm.me>", References: []string{"<a@pm.me>"}, Subject: "B", Date: testDate(1)},
+		{ID: 3, MessageID: "<c@pm.me>", References: []string{"<c@pm.me>"}, Subject: "C", Date: testDate(2)},
+	}
+
+	// The link created first is kept, the one creating a loop is ignored.
+	require.Equal(t, "(2 1)(3)", FormatThreads(ThreadReferences(messages)))
+}
+
+func TestThreadReferencesSameSubject(t *testing.T) {
+	messages := []*Message{
+		{ID: 1, MessageID: "<a@pm.me>", Subject: "Meeting", Date: testDate(0)},
+		{ID: 2, MessageID: "<b@pm.me>", Subject: "Meeting", Date: testDate(1)},
+	}
+
+	require.Equal(t, "((1)(2))", FormatThreads(ThreadReferences(messages)))
+}
+
+func TestParseThread(t *testing.T) {
+	cmd := &Thread{}
+	require.NoError(t, cmd.Parse([]interface{}{"references", "UTF-8", "UNSEEN"}))
+	require.Equal(t, References, cmd.Algorithm)
+	require.Equal(t, []string{"\\Seen"}, cmd.Criteria.WithoutFlags)
+
+	require.Error(t, (&Thread{}).Parse([]interface{}{"REFERENCES", "UTF-8"}))
+	require.Error(t, (&Thread{}).Parse([]interface{}{"UNKNOWN", "UTF-8", "ALL"}))
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/tracing"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	commandTracing     bool         //nolint[gochecknoglobals]
+	commandTracingLock sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetCommandTracing sets whether each IMAP command is logged with the time
+// spent in store lookups, API requests, decryption and building messages.
+func SetCommandTracing(enabled bool) {
+	commandTracingLock.Lock()
+	defer commandTracingLock.Unlock()
+
+	commandTracing = enabled
+}
+
+func isCommandTracing() bool {
+	commandTracingLock.RLock()
+	defer commandTracingLock.RUnlock()
+
+	return commandTracing
+}
+
+// tracePhase is a part of the command processing measured by trace.
+type tracePhase int
+
+const (
+	phaseStore tracePhase = iota
+	phaseAPI
+	phaseDecrypt
+	phaseBuild
+
+	phaseCount
+)
+
+var phaseNames = [phaseCount]string{"store", "api", "decrypt", "build"} //nolint[gochecknoglobals]
+
+// commandTrace collects timing of one IMAP command. Every message is
+// measured by its own phaseTimer because messages are processed in parallel.
+// Nil trace is valid and measures nothing, which is used when tracing is off.
+type commandTrace struct {
+	name  string
+	start time.Time
+
+	lock     sync.Mutex
+	messages map[string]*phaseTimer
+}
+
+// newCommandTrace starts the trace of the command or returns nil when
+// tracing is disabled.
+func newCommandTrace(name string) *commandTrace {
+	if !isCommandTracing() {
+		return nil
+	}
+
+	return &commandTrace{
+		name:     name,
+		start:    time.Now(),
+		messages: map[string]*phaseTimer{},
+	}
+}
+
+// message returns the timer of the message with the given ID.
+func (t *commandTrace) message(id string) *phaseTimer {
+	if t == nil {
+		return nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	timer, ok := t.messages[id]
+	if !ok {
+		timer = &phaseTimer{}
+		t.messages[id] = timer
+	}
+	return timer
+}
+
+// phases returns total time spent in each phase by all measured messages
+// and the count of the messages.
+func (t *commandTrace) phases() (spent [phaseCount]time.Duration, count int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, timer := range t.messages {
+		timer.lock.Lock()
+		for phase, d := range timer.spent {
+			spent[phase] += d
+		}
+		timer.lock.Unlock()
+	}
+	return spent, len(t.messages)
+}
+
+// log writes the trace to the log. Phases are summed over messages, so they
+// can be longer than the whole command when messages were processed in
+// parallel.
+func (t *commandTrace) log(l *logrus.Entry, err error) {
+	if t == nil {
+		return
+	}
+
+	fields := logrus.Fields{
+		"cmd":      t.name,
+		"duration": time.Since(t.start).Round(time.Microsecond).String(),
+	}
+	if spent, count := t.phases(); count > 0 {
+		fields["messages"] = count
+		for phase, d := range spent {
+			fields[phaseNames[phase]] = d.Round(time.Microsecond).String()
+		}
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+
+	l.WithFields(fields).Info("IMAP command trace")
+}
+
+// phaseTimer measures exclusive time of nested phases. When a phase begins
+// inside another one, the outer phase is paused until the inner one ends,
+// e.g. API request done while building a message is not counted as build.
+type phaseTimer struct {
+	lock  sync.Mutex
+	stack []tracePhase
+	since time.Time
+	spent [phaseCount]time.Duration
+}
+
+// begin starts measuring the phase and returns the function ending it.
+func (p *phaseTimer) begin(phase tracePhase) func() {
+	if p == nil {
+		return func() {}
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.pause(time.Now())
+	p.stack = append(p.stack, phase)
+
+	return func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		p.pause(time.Now())
+		p.stack = p.stack[:len(p.stack)-1]
+	}
+}
+
+// pause adds time since the last change to the current phase.
+func (p *phaseTimer) pause(now time.Time) {
+	if len(p.stack) > 0 {
+		p.spent[p.stack[len(p.stack)-1]] += now.Sub(p.since)
+	}
+	p.since = now
+}
+
+// getTrace returns the trace of the command being processed by the mailbox.
+func (im *imapMailbox) getTrace() *commandTrace {
+	im.traceLock.Lock()
+	defer im.traceLock.Unlock()
+
+	return im.trace
+}
+
+// startTrace starts tracing of the command and returns the function which
+// logs the trace with the error the command finished with. It is meant to be
+// deferred right away, e.g. `defer im.startTrace("FETCH", isUID)(&err)`.
+func (im *imapMailbox) startTrace(name string, isUID bool) func(err *error) {
+	return im.startTraceContext(context.Background(), name, isUID)
+}
+
+// startTraceContext is startTrace logging the session ID of the context.
+func (im *imapMailbox) startTraceContext(ctx context.Context, name string, isUID bool) func(err *error) {
+	trace := newCommandTrace(name)
+	if trace == nil {
+		return func(*error) {}
+	}
+	if isUID {
+		trace.name = "UID " + name
+	}
+
+	im.traceLock.Lock()
+	im.trace = trace
+	im.traceLock.Unlock()
+
+	return func(err *error) {
+		im.traceLock.Lock()
+		if im.trace == trace {
+			im.trace = nil
+		}
+		im.traceLock.Unlock()
+
+		trace.log(tracing.Logger(ctx, im.log), *err)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPhaseTimerExcludesNestedPhases(t *testing.T) {
+	timer := &phaseTimer{}
+
+	endBuild := timer.begin(phaseBuild)
+	endAPI := timer.begin(phaseAPI)
+	time.Sleep(20 * time.Millisecond)
+	endAPI()
+	endBuild()
+
+	require.True(t, timer.spent[phaseAPI] >= 20*time.Millisecond)
+	require.True(t, timer.spent[phaseBuild] < 20*time.Millisecond)
+	require.Empty(t, timer.stack)
+}
+
+func TestPhaseTimerPause(t *testing.T) {
+	start := time.Now()
+	timer := &phaseTimer{}
+
+	timer.pause(start)
+	timer.stack = append(timer.stack, phaseBuild)
+	timer.pause(start.Add(10 * time.Millisecond))
+	timer.stack = append(timer.stack, phaseDecrypt)
+	timer.pause(start.Add(30 * time.Millisecond))
+	timer.stack = timer.stack[:1]
+	timer.pause(start.Add(35 * time.Millisecond))
+
+	require.Equal(t, 15*time.Millisecond, timer.spent[phaseBuild])
+	require.Equal(t, 20*time.Millisecond, timer.spent[phaseDecrypt])
+}
+
+func TestCommandTraceDisabled(t *testing.T) {
+	SetCommandTracing(false)
+
+	trace := newCommandTrace("FETCH")
+	require.Nil(t, trace)
+	require.Nil(t, trace.message("id"))
+
+	// Nil timer measures nothing and must not panic.
+	trace.message("id").begin(phaseAPI)()
+	trace.log(logrus.NewEntry(logrus.New()), nil)
+}
+
+func TestMailboxTrace(t *testing.T) {
+	SetCommandTracing(true)
+	defer SetCommandTracing(false)
+
+	out := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.Out = out
+	logger.Formatter = &logrus.JSONFormatter{}
+
+	im := &imapMailbox{log: logrus.NewEntry(logger), traceLock: &sync.Mutex{}}
+
+	err := errors.New("no such message")
+	finish := im.startTrace("FETCH", true)
+	im.getTrace().message("first").begin(phaseStore)()
+	im.getTrace().message("second").begin(phaseAPI)()
+	finish(&err)
+
+	require.Nil(t, im.getTrace())
+
+	fields := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &fields))
+	require.Equal(t, "IMAP command trace", fields["msg"])
+	require.Equal(t, "UID FETCH", fields["cmd"])
+	require.Equal(t, float64(2), fields["messages"])
+	require.Equal(t, "no such message", fields["error"])
+	for _, name := range phaseNames {
+		require.Contains(t, fields, name)
+	}
+}
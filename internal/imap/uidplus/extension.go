@@ -21,13 +21,17 @@
 // * Response `UIDNOTSTICKY`: All mailboxes of Bridge support stable
 //   UIDVALIDITY so it would never return this response
 //
-// Otherwise the standard RFC4315 is followed.
+// Otherwise the standard RFC4315 is followed. The package also handles
+// the MOVE command (RFC6851) to report COPYUID of moved messages before
+// they are expunged from the source mailbox.
 package uidplus
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/emersion/go-imap"
+	move "github.com/emersion/go-imap-move"
 	"github.com/emersion/go-imap/server"
 	"github.com/sirupsen/logrus"
 )
@@ -40,6 +44,7 @@ const (
 	appenduid    = "APPENDUID"
 	copySuccess  = "COPY completed"
 	appendSucess = "APPEND completed"
+	moveSuccess  = "MOVE completed"
 )
 
 var log = logrus.WithField("pkg", "imap/uidplus") //nolint[gochecknoglobals]
@@ -113,55 +118,157 @@ func (os *OrderedSeq) String() string {
 	return out
 }
 
-// UIDExpunge implements server.Handler but has no effect because Bridge is not
-// using EXPUNGE at all. The message is deleted right after it was flagged as
-// \Deleted Bridge should simply ignore this command with empty `OK` response.
-//
-// If not implemented it would cause harmless IMAP error.
+// ExpungeMailbox is a mailbox which can expunge only messages in the UID set.
+type ExpungeMailbox interface {
+	UIDExpunge(seqSet *imap.SeqSet) error
+}
+
+// UIDExpunge implements server.Handler of both EXPUNGE and UID EXPUNGE.
+// EXPUNGE is handled in the standard way. UID EXPUNGE removes only messages
+// with the \Deleted flag in the UID set, if the mailbox implements
+// ExpungeMailbox. Otherwise it has no effect, because messages are deleted
+// right after they are flagged as \Deleted.
 //
 // This overrides the standard EXPUNGE functionality.
-type UIDExpunge struct{}
+type UIDExpunge struct {
+	server.Expunge
+	SeqSet *imap.SeqSet
+}
 
-func (e *UIDExpunge) Parse(fields []interface{}) error { log.Traceln("parse", fields); return nil }
-func (e *UIDExpunge) Handle(conn server.Conn) error    { log.Traceln("handle"); return nil }
-func (e *UIDExpunge) UidHandle(conn server.Conn) error { log.Traceln("uid handle"); return nil } //nolint[golint]
+func (e *UIDExpunge) Parse(fields []interface{}) error {
+	log.Traceln("parse", fields)
+	if len(fields) < 1 {
+		return nil
+	}
+
+	seqSet, ok := fields[0].(string)
+	if !ok {
+		return errors.New("sequence set must be an atom")
+	}
+
+	var err error
+	e.SeqSet, err = imap.ParseSeqSet(seqSet)
+	return err
+}
+
+func (e *UIDExpunge) UidHandle(conn server.Conn) error { //nolint[golint]
+	log.Traceln("uid handle", e.SeqSet)
+	if e.SeqSet == nil {
+		return errors.New("missing sequence set")
+	}
+
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return server.ErrNoMailboxSelected
+	}
+	if ctx.MailboxReadOnly {
+		return server.ErrMailboxReadOnly
+	}
+
+	mailbox, ok := ctx.Mailbox.(ExpungeMailbox)
+	if !ok {
+		return nil
+	}
+	return mailbox.UIDExpunge(e.SeqSet)
+}
+
+// MoveMailbox is a mailbox which reports COPYUID of moved messages. It
+// calls copyUID with the untagged response after messages are added to the
+// destination and before they are removed from the mailbox, so the client
+// gets it before EXPUNGE responses, see RFC6851 section 4.3.
+type MoveMailbox interface {
+	MoveMessagesWithCopyUID(uid bool, seqSet *imap.SeqSet, dest string, copyUID func(*imap.StatusResp) error) error
+}
+
+// Move implements server.Handler of both MOVE and UID MOVE. Mailboxes which
+// are not MoveMailbox are moved by the standard MOVE extension.
+//
+// This overrides the standard MOVE functionality.
+type Move struct {
+	move.Command
+}
+
+func (m *Move) Handle(conn server.Conn) error {
+	return m.handle(false, conn)
+}
+
+func (m *Move) UidHandle(conn server.Conn) error { //nolint[golint]
+	return m.handle(true, conn)
+}
+
+func (m *Move) handle(uid bool, conn server.Conn) error {
+	log.Traceln("move", uid, m.SeqSet, m.Mailbox)
+
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return server.ErrNoMailboxSelected
+	}
+	if ctx.MailboxReadOnly {
+		return server.ErrMailboxReadOnly
+	}
+
+	switch mailbox := ctx.Mailbox.(type) {
+	case MoveMailbox:
+		return mailbox.MoveMessagesWithCopyUID(uid, m.SeqSet, m.Mailbox, func(res *imap.StatusResp) error {
+			return conn.WriteResp(res)
+		})
+	case move.Mailbox:
+		return mailbox.MoveMessages(uid, m.SeqSet, m.Mailbox)
+	}
+	return errors.New("MOVE extension not supported")
+}
 
 type extension struct{}
 
-// NewExtension of UIDPLUS.
+// NewExtension of UIDPLUS. It includes MOVE, so the standard MOVE
+// extension is not needed.
 func NewExtension() server.Extension {
 	return &extension{}
 }
 
 func (ext *extension) Capabilities(c server.Conn) []string {
 	if c.Context().State&imap.AuthenticatedState != 0 {
-		return []string{Capability}
+		return []string{Capability, move.Capability}
 	}
 	return nil
 }
 
 func (ext *extension) Command(name string) server.HandlerFactory {
-	if name == "EXPUNGE" {
+	switch name {
+	case "EXPUNGE":
 		return func() server.Handler {
 			return &UIDExpunge{}
 		}
+	case "MOVE":
+		return func() server.Handler {
+			return &Move{}
+		}
 	}
 
 	return nil
 }
 
+// isCopyUIDValid returns whether every source UID has its target UID.
+func isCopyUIDValid(sourceSeq, targetSeq *OrderedSeq) bool {
+	return sourceSeq.Len() != 0 && targetSeq.Len() != 0 &&
+		sourceSeq.Len() == targetSeq.Len()
+}
+
+func formatCopyUID(uidValidity uint32, sourceSeq, targetSeq *OrderedSeq, info string) string {
+	return fmt.Sprintf("[%s %d %s %s] %s",
+		copyuid,
+		uidValidity,
+		sourceSeq.String(),
+		targetSeq.String(),
+		info,
+	)
+}
+
 func getStatusResponseCopy(uidValidity uint32, sourceSeq, targetSeq *OrderedSeq) *imap.StatusResp {
 	info := copySuccess
 
-	if sourceSeq.Len() != 0 && targetSeq.Len() != 0 &&
-		sourceSeq.Len() == targetSeq.Len() {
-		info = fmt.Sprintf("[%s %d %s %s] %s",
-			copyuid,
-			uidValidity,
-			sourceSeq.String(),
-			targetSeq.String(),
-			copySuccess,
-		)
+	if isCopyUIDValid(sourceSeq, targetSeq) {
+		info = formatCopyUID(uidValidity, sourceSeq, targetSeq, copySuccess)
 	}
 
 	return &imap.StatusResp{
@@ -170,6 +277,20 @@ func getStatusResponseCopy(uidValidity uint32, sourceSeq, targetSeq *OrderedSeq)
 	}
 }
 
+// MoveResponse prepares untagged OK response with extended UID information
+// about moved messages. It returns nil when the UIDs are not known.
+func MoveResponse(uidValidity uint32, sourceSeq, targetSeq *OrderedSeq) *imap.StatusResp {
+	if !isCopyUIDValid(sourceSeq, targetSeq) {
+		return nil
+	}
+
+	return &imap.StatusResp{
+		Tag:  "*",
+		Type: imap.StatusRespOk,
+		Info: formatCopyUID(uidValidity, sourceSeq, targetSeq, moveSuccess),
+	}
+}
+
 // CopyResponse prepares OK response with extended UID information about copied message.
 func CopyResponse(uidValidity uint32, sourceSeq, targetSeq *OrderedSeq) error {
 	return server.ErrStatusResp(getStatusResponseCopy(uidValidity, sourceSeq, targetSeq))
@@ -106,3 +106,34 @@ func TestStatusResponseInfo(t *testing.T) {
 		td.testCopyAndAppendResponses(t)
 	}
 }
+
+func TestUIDExpungeParse(t *testing.T) {
+	expunge := &UIDExpunge{}
+	assert.NoError(t, expunge.Parse(nil))
+	assert.Nil(t, expunge.SeqSet)
+
+	assert.NoError(t, expunge.Parse([]interface{}{"1:3,5"}))
+	assert.Equal(t, "1:3,5", expunge.SeqSet.String())
+
+	assert.Error(t, (&UIDExpunge{}).Parse([]interface{}{"a:b"}))
+}
+
+func TestMoveResponse(t *testing.T) {
+	td := &testResponseData{}
+
+	res := MoveResponse(uidValidity, td.getOrdSeqFromList([]int{4, 5, 6}), td.getOrdSeqFromList([]int{1, 2, 3}))
+	assert.Equal(t, "*", res.Tag, "must be untagged")
+	assert.Equal(t, "["+copyuid+" 66 4:6 1:3] "+moveSuccess, res.Info)
+
+	assert.Nil(t, MoveResponse(uidValidity, td.getOrdSeqFromList([]int{1, 2}), td.getOrdSeqFromList([]int{1})))
+	assert.Nil(t, MoveResponse(uidValidity, td.getOrdSeqFromList([]int{}), td.getOrdSeqFromList([]int{})))
+}
+
+func TestMoveParse(t *testing.T) {
+	move := &Move{}
+	assert.NoError(t, move.Parse([]interface{}{"1:3", "Archive"}))
+	assert.Equal(t, "1:3", move.SeqSet.String())
+	assert.Equal(t, "Archive", move.Mailbox)
+
+	assert.Error(t, (&Move{}).Parse([]interface{}{"1:3"}))
+}
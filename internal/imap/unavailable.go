@@ -0,0 +1,72 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/emersion/go-imap"
+	imapserver "github.com/emersion/go-imap/server"
+	"github.com/pkg/errors"
+)
+
+// apiUnavailableError replaces the error of the command which failed while
+// the API is unavailable by NO response with UNAVAILABLE code (RFC 5530).
+// Clients then retry later instead of reporting the error to the user.
+// Any error is replaced when requests to the API are suspended, because
+// the command could fail on one of many places which wrap the error.
+func (ib *imapBackend) apiUnavailableError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*imap.ErrStatusResp); ok {
+		return err
+	}
+
+	status := ib.bridge.GetAPIStatus()
+	if status.IsAvailable() && errors.Cause(err) != pmapi.ErrAPINotReachable {
+		return err
+	}
+
+	info := "Proton servers cannot be reached, try again later"
+	if retryIn := status.RetryIn(time.Now()).Round(time.Second); retryIn > 0 {
+		info = fmt.Sprintf("Proton servers cannot be reached, try again in %v", retryIn)
+	}
+
+	return imapserver.ErrStatusResp(&imap.StatusResp{
+		Type: imap.StatusRespNo,
+		Code: unavailable,
+		Info: info,
+	})
+}
+
+// checkAPIAvailability replaces the error of the command if the API is
+// unavailable. It is meant to be deferred with the named error result.
+func (iu *imapUser) checkAPIAvailability(err *error) {
+	if *err != nil && iu.backend != nil {
+		*err = iu.backend.apiUnavailableError(*err)
+	}
+}
+
+func (im *imapMailbox) checkAPIAvailability(err *error) {
+	if im.user != nil {
+		im.user.checkAPIAvailability(err)
+	}
+}
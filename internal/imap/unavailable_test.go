@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/emersion/go-imap"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type testStatusBridge struct {
+	bridger
+
+	status pmapi.APIStatus
+}
+
+func (b *testStatusBridge) GetAPIStatus() pmapi.APIStatus {
+	return b.status
+}
+
+func TestAPIUnavailableError(t *testing.T) {
+	bridge := &testStatusBridge{}
+	ib := &imapBackend{bridge: bridge}
+
+	someErr := errors.New("list message build: some error")
+	require.Nil(t, ib.apiUnavailableError(nil))
+	require.Equal(t, someErr, ib.apiUnavailableError(someErr))
+
+	err := ib.apiUnavailableError(pkgErrors.Wrap(pmapi.ErrAPINotReachable, "cannot create mailbox"))
+	requireUnavailable(t, err, "Proton servers cannot be reached, try again later")
+
+	bridge.status = pmapi.APIStatus{State: pmapi.CircuitOpen, NextProbe: time.Now().Add(30 * time.Second)}
+	err = ib.apiUnavailableError(someErr)
+	requireUnavailable(t, err, "Proton servers cannot be reached, try again in 30s")
+
+	// Other status responses are kept.
+	require.Equal(t, err, ib.apiUnavailableError(err))
+}
+
+func TestCheckAPIAvailabilityWithoutUser(t *testing.T) {
+	someErr := errors.New("some error")
+	err := someErr
+
+	im := &imapMailbox{}
+	im.checkAPIAvailability(&err)
+	require.Equal(t, someErr, err)
+}
+
+func requireUnavailable(t *testing.T, err error, info string) {
+	statusErr, ok := err.(*imap.ErrStatusResp)
+	require.True(t, ok, "unexpected error %v", err)
+	require.Equal(t, imap.StatusRespNo, statusErr.Resp.Type)
+	require.Equal(t, unavailable, statusErr.Resp.Code)
+	require.Equal(t, info, statusErr.Resp.Info)
+}
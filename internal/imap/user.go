@@ -20,14 +20,18 @@ package imap
 import (
 	"errors"
 	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/ProtonMail/proton-bridge/internal/store"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	imapquota "github.com/emersion/go-imap-quota"
 	goIMAPBackend "github.com/emersion/go-imap/backend"
 )
 
 var (
-	errNoSuchMailbox = errors.New("no such mailbox") //nolint[gochecknoglobals]
+	errNoSuchMailbox       = errors.New("no such mailbox")          //nolint[gochecknoglobals]
+	errReservedMailboxName = errors.New("mailbox name is reserved") //nolint[gochecknoglobals]
 )
 
 type imapUser struct {
@@ -39,6 +43,15 @@ type imapUser struct {
 	storeAddress storeAddressProvider
 
 	currentAddressLowercase string
+
+	// mapping is built whenever client lists or selects mailboxes and it is
+	// used to translate IDLE updates without touching the store.
+	mapping     *mailboxMapping
+	mappingLock sync.RWMutex
+
+	// isIndexing is set while messages found by full-text search are added
+	// to the index in the background.
+	isIndexing int32
 }
 
 // This method should eventually no longer be necessary. Everything should go via store.
@@ -46,6 +59,15 @@ func (iu *imapUser) client() pmapi.Client {
 	return iu.user.GetTemporaryPMAPIClient()
 }
 
+// checkWritable returns error when the store is in read-only maintenance
+// mode. Messages can be read but not changed until the maintenance ends.
+func (iu *imapUser) checkWritable() error {
+	if iu.storeUser.IsInMaintenance() {
+		return store.ErrMaintenance
+	}
+	return nil
+}
+
 // newIMAPUser returns struct implementing go-imap/user interface.
 func newIMAPUser(
 	panicHandler panicHandler,
@@ -78,6 +100,55 @@ func newIMAPUser(
 	}, err
 }
 
+// refreshMailboxMapping builds the mapping of mailboxes for the current
+// mailboxes and the mapping mode of the account.
+func (iu *imapUser) refreshMailboxMapping() *mailboxMapping {
+	mapping := newMailboxMapping(iu.storeUser.GetMailboxMapping(), iu.storeAddress.ListMailboxes())
+
+	iu.mappingLock.Lock()
+	defer iu.mappingLock.Unlock()
+
+	iu.mapping = mapping
+	return mapping
+}
+
+// getMailboxMapping returns the last built mapping or nil when the client
+// didn't list or select any mailbox yet.
+func (iu *imapUser) getMailboxMapping() *mailboxMapping {
+	iu.mappingLock.RLock()
+	defer iu.mappingLock.RUnlock()
+
+	return iu.mapping
+}
+
+// mailboxMapping returns the last built mapping or builds a new one.
+func (iu *imapUser) mailboxMapping() *mailboxMapping {
+	if mapping := iu.getMailboxMapping(); mapping != nil {
+		return mapping
+	}
+	return iu.refreshMailboxMapping()
+}
+
+// indexMessagesInBackground adds messages to the full-text index so the next
+// search does not have to go through their content. Only one batch is
+// indexed at a time; messages skipped now are indexed after next search.
+func (iu *imapUser) indexMessagesInBackground(im *imapMailbox, storeMessages []storeMessageProvider) {
+	if !atomic.CompareAndSwapInt32(&iu.isIndexing, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer iu.panicHandler.HandlePanic()
+		defer atomic.StoreInt32(&iu.isIndexing, 0)
+
+		for _, storeMessage := range storeMessages {
+			if !iu.storeUser.IsMessageIndexed(storeMessage.ID()) {
+				im.indexMessage(storeMessage)
+			}
+		}
+	}()
+}
+
 func (iu *imapUser) isSubscribed(labelID string) bool {
 	subscriptionExceptions := iu.backend.getCacheList(iu.storeUser.UserID(), SubscriptionException)
 	exceptions := strings.Split(subscriptionExceptions, ";")
@@ -112,17 +183,42 @@ func (iu *imapUser) ListMailboxes(showOnlySubcribed bool) ([]goIMAPBackend.Mailb
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer iu.panicHandler.HandlePanic()
 
+	iu.storeUser.NotifyClientActivity()
+
+	// Mailboxes changed by other clients are listed without waiting for
+	// the next event poll.
+	iu.storeAddress.RefreshMailboxes()
+
+	mapping := iu.refreshMailboxMapping()
+
 	mailboxes := []goIMAPBackend.Mailbox{}
 	for _, storeMailbox := range iu.storeAddress.ListMailboxes() {
 		if showOnlySubcribed && !iu.isSubscribed(storeMailbox.LabelID()) {
 			continue
 		}
-		mailbox := newIMAPMailbox(iu.panicHandler, iu, storeMailbox)
+		name, ok := mapping.imapName(storeMailbox.Name())
+		if !ok {
+			continue
+		}
+		mailbox := newIMAPMailbox(iu.panicHandler, iu, storeMailbox, name)
 		mailboxes = append(mailboxes, mailbox)
 	}
 
-	mailboxes = append(mailboxes, newLabelsRootMailbox())
-	mailboxes = append(mailboxes, newFoldersRootMailbox())
+	mailboxes = append(mailboxes,
+		newIMAPOutboxMailbox(iu.panicHandler, iu, scheduledMailboxName),
+		newIMAPOutboxMailbox(iu.panicHandler, iu, outboxMailboxName),
+		newIMAPSnoozedMailbox(iu.panicHandler, iu, snoozedMailboxName),
+	)
+	for _, target := range store.SnoozeTargets() {
+		mailboxes = append(mailboxes, newIMAPSnoozedMailbox(iu.panicHandler, iu, snoozedMailboxName+store.PathDelimiter+target))
+	}
+
+	if mapping.showLabelsRoot() {
+		mailboxes = append(mailboxes, newLabelsRootMailbox())
+	}
+	if mapping.showFoldersRoot() {
+		mailboxes = append(mailboxes, newFoldersRootMailbox())
+	}
 
 	log.WithField("mailboxes", mailboxes).Trace("Listing mailboxes")
 
@@ -134,29 +230,66 @@ func (iu *imapUser) GetMailbox(name string) (mb goIMAPBackend.Mailbox, err error
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer iu.panicHandler.HandlePanic()
 
-	storeMailbox, err := iu.storeAddress.GetMailbox(name)
+	iu.storeUser.NotifyClientActivity()
+
+	if isOutboxMailboxName(name) {
+		return newIMAPOutboxMailbox(iu.panicHandler, iu, name), nil
+	}
+
+	if isSnoozedMailboxName(name) {
+		return newIMAPSnoozedMailbox(iu.panicHandler, iu, name), nil
+	}
+
+	storeMailbox, err := iu.getStoreMailbox(iu.refreshMailboxMapping(), name)
 	if err != nil {
 		log.WithField("name", name).WithError(err).Error("Could not get mailbox")
 		return
 	}
 
-	return newIMAPMailbox(iu.panicHandler, iu, storeMailbox), nil
+	return newIMAPMailbox(iu.panicHandler, iu, storeMailbox, name), nil
+}
+
+// getStoreMailbox returns the store mailbox with the IMAP name. Mailboxes
+// which are not listed in the current mapping mode don't exist for client.
+func (iu *imapUser) getStoreMailbox(mapping *mailboxMapping, name string) (storeMailboxProvider, error) {
+	storeMailbox, err := iu.storeAddress.GetMailbox(mapping.storeName(name))
+	if err != nil {
+		return nil, err
+	}
+	if imapName, ok := mapping.imapName(storeMailbox.Name()); !ok || imapName != name {
+		return nil, errNoSuchMailbox
+	}
+	return storeMailbox, nil
 }
 
 // CreateMailbox creates a new mailbox.
-func (iu *imapUser) CreateMailbox(name string) error {
+func (iu *imapUser) CreateMailbox(name string) (err error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer iu.panicHandler.HandlePanic()
+	defer iu.checkAPIAvailability(&err)
 
-	return iu.storeAddress.CreateMailbox(name)
+	if err = iu.checkWritable(); err != nil {
+		return
+	}
+
+	if isOutboxMailboxName(name) || isSnoozedMailboxPath(name) {
+		return errReservedMailboxName
+	}
+
+	return iu.storeAddress.CreateMailbox(iu.mailboxMapping().newStoreName(name, ""))
 }
 
 // DeleteMailbox permanently removes the mailbox with the given name.
 func (iu *imapUser) DeleteMailbox(name string) (err error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer iu.panicHandler.HandlePanic()
+	defer iu.checkAPIAvailability(&err)
 
-	storeMailbox, err := iu.storeAddress.GetMailbox(name)
+	if err = iu.checkWritable(); err != nil {
+		return
+	}
+
+	storeMailbox, err := iu.getStoreMailbox(iu.mailboxMapping(), name)
 	if err != nil {
 		log.WithField("name", name).WithError(err).Error("Could not get mailbox")
 		return
@@ -171,14 +304,30 @@ func (iu *imapUser) DeleteMailbox(name string) (err error) {
 func (iu *imapUser) RenameMailbox(oldName, newName string) (err error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer iu.panicHandler.HandlePanic()
+	defer iu.checkAPIAvailability(&err)
+
+	if err = iu.checkWritable(); err != nil {
+		return
+	}
+
+	if isOutboxMailboxName(newName) || isSnoozedMailboxPath(newName) {
+		return errReservedMailboxName
+	}
 
-	storeMailbox, err := iu.storeAddress.GetMailbox(oldName)
+	mapping := iu.mailboxMapping()
+
+	storeMailbox, err := iu.getStoreMailbox(mapping, oldName)
 	if err != nil {
 		log.WithField("name", oldName).WithError(err).Error("Could not get mailbox")
 		return
 	}
 
-	return storeMailbox.Rename(newName)
+	prefix := store.UserLabelsPrefix
+	if storeMailbox.IsFolder() {
+		prefix = store.UserFoldersPrefix
+	}
+
+	return storeMailbox.Rename(mapping.newStoreName(newName, prefix))
 }
 
 // Logout is called when this User will no longer be used, likely because the
@@ -0,0 +1,248 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package xlist implements the legacy XLIST command known from Gmail and
+// the SPECIAL-USE selection and return options of LIST (RFC 6154).
+//
+// XLIST is the same as LIST but the special-use attributes are translated
+// to the names used by Gmail and INBOX is marked with \Inbox attribute.
+// Old clients (e.g., older Outlook or iOS Mail) use it to find out folder
+// roles instead of guessing them by name.
+package xlist
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	specialuse "github.com/emersion/go-imap-specialuse"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/server"
+)
+
+// Capability extension identifier.
+const Capability = "XLIST"
+
+// Legacy attributes used by XLIST which differ from RFC 6154.
+const (
+	InboxAttr   = "\\Inbox"
+	AllMailAttr = "\\AllMail"
+	SpamAttr    = "\\Spam"
+	StarredAttr = "\\Starred"
+)
+
+const specialUseOption = "SPECIAL-USE"
+
+// legacyAttrs maps RFC 6154 attributes to the XLIST ones.
+var legacyAttrs = map[string]string{ //nolint[gochecknoglobals]
+	specialuse.All:     AllMailAttr,
+	specialuse.Junk:    SpamAttr,
+	specialuse.Flagged: StarredAttr,
+}
+
+// specialUseAttrs are all attributes defined by RFC 6154.
+var specialUseAttrs = []string{ //nolint[gochecknoglobals]
+	specialuse.All,
+	specialuse.Archive,
+	specialuse.Drafts,
+	specialuse.Flagged,
+	specialuse.Junk,
+	specialuse.Sent,
+	specialuse.Trash,
+}
+
+// IsSpecialUse returns whether the mailbox has any special-use attribute.
+func IsSpecialUse(info *imap.MailboxInfo) bool {
+	for _, attr := range info.Attributes {
+		for _, specialUseAttr := range specialUseAttrs {
+			if strings.EqualFold(attr, specialUseAttr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LegacyInfo returns the mailbox info with attributes as expected by XLIST.
+func LegacyInfo(info *imap.MailboxInfo) *imap.MailboxInfo {
+	legacy := *info
+	legacy.Attributes = []string{}
+
+	for _, attr := range info.Attributes {
+		if legacyAttr, ok := legacyAttrs[attr]; ok {
+			attr = legacyAttr
+		}
+		legacy.Attributes = append(legacy.Attributes, attr)
+	}
+
+	if strings.EqualFold(info.Name, imap.InboxName) {
+		legacy.Attributes = append(legacy.Attributes, InboxAttr)
+	}
+
+	return &legacy
+}
+
+// List overrides LIST command to support the SPECIAL-USE selection option
+// and RETURN (SPECIAL-USE), and implements XLIST command.
+type List struct {
+	commands.List
+
+	// XList is set for XLIST command.
+	XList bool
+	// SpecialUseOnly is set when only special-use mailboxes are requested.
+	SpecialUseOnly bool
+}
+
+func (cmd *List) Parse(fields []interface{}) error {
+	if len(fields) > 0 && !cmd.XList {
+		if options, ok := fields[0].([]interface{}); ok {
+			if err := cmd.parseOptions(options, true); err != nil {
+				return err
+			}
+			fields = fields[1:]
+		}
+	}
+
+	if len(fields) > 2 {
+		if key, ok := fields[2].(string); !ok || !strings.EqualFold(key, "RETURN") || len(fields) != 4 {
+			return errors.New("invalid LIST return options")
+		}
+		options, ok := fields[3].([]interface{})
+		if !ok {
+			return errors.New("invalid LIST return options")
+		}
+		if err := cmd.parseOptions(options, false); err != nil {
+			return err
+		}
+		fields = fields[:2]
+	}
+
+	return cmd.List.Parse(fields)
+}
+
+// parseOptions accepts only SPECIAL-USE option as no other LIST extension
+// is supported. Special-use attributes are returned always, so the return
+// option doesn't change anything.
+func (cmd *List) parseOptions(options []interface{}, selection bool) error {
+	for _, option := range options {
+		name, ok := option.(string)
+		if !ok || !strings.EqualFold(name, specialUseOption) {
+			return errors.New("unsupported LIST option")
+		}
+		if selection {
+			cmd.SpecialUseOnly = true
+		}
+	}
+	return nil
+}
+
+func (cmd *List) Handle(conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return server.ErrNotAuthenticated
+	}
+
+	mailboxes, err := ctx.User.ListMailboxes(false)
+	if err != nil {
+		return err
+	}
+
+	res := &listResp{xlist: cmd.XList}
+
+	for _, mbox := range mailboxes {
+		info, err := mbox.Info()
+		if err != nil {
+			return err
+		}
+
+		// An empty mailbox name is a special request to return the hierarchy
+		// delimiter, see RFC 3501 section 6.3.8.
+		if cmd.Mailbox == "" {
+			res.mailboxes = append(res.mailboxes, &imap.MailboxInfo{
+				Attributes: []string{imap.NoSelectAttr},
+				Delimiter:  info.Delimiter,
+				Name:       info.Delimiter,
+			})
+			break
+		}
+
+		if !info.Match(cmd.Reference, cmd.Mailbox) {
+			continue
+		}
+		if cmd.SpecialUseOnly && !IsSpecialUse(info) {
+			continue
+		}
+		if cmd.XList {
+			info = LegacyInfo(info)
+		}
+		res.mailboxes = append(res.mailboxes, info)
+	}
+
+	return conn.WriteResp(res)
+}
+
+type listResp struct {
+	xlist     bool
+	mailboxes []*imap.MailboxInfo
+}
+
+func (r *listResp) WriteTo(w *imap.Writer) error {
+	name := "LIST"
+	if r.xlist {
+		name = Capability
+	}
+
+	for _, mbox := range r.mailboxes {
+		fields := []interface{}{imap.RawString(name)}
+		fields = append(fields, mbox.Format()...)
+
+		if err := imap.NewUntaggedResp(fields).WriteTo(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type extension struct{}
+
+// NewExtension of XLIST.
+func NewExtension() server.Extension {
+	return &extension{}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{Capability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	switch name {
+	case "LIST":
+		return func() server.Handler {
+			return &List{}
+		}
+	case Capability:
+		return func() server.Handler {
+			return &List{XList: true}
+		}
+	}
+
+	return nil
+}
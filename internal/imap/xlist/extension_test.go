@@ -0,0 +1,143 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package xlist
+
+import (
+	"net"
+	"net/textproto"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	specialuse "github.com/emersion/go-imap-specialuse"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseList(t *testing.T) {
+	testData := []struct {
+		fields             []interface{}
+		xlist              bool
+		wantSpecialUseOnly bool
+	}{
+		{[]interface{}{"", "*"}, false, false},
+		{[]interface{}{[]interface{}{"SPECIAL-USE"}, "", "*"}, false, true},
+		{[]interface{}{"", "*", "RETURN", []interface{}{"special-use"}}, false, false},
+		{[]interface{}{"", "*"}, true, false},
+	}
+
+	for _, tc := range testData {
+		cmd := &List{XList: tc.xlist}
+		require.NoError(t, cmd.Parse(tc.fields), tc.fields)
+		require.Equal(t, "*", cmd.Mailbox, tc.fields)
+		require.Equal(t, tc.wantSpecialUseOnly, cmd.SpecialUseOnly, tc.fields)
+	}
+}
+
+func TestParseListInvalid(t *testing.T) {
+	for _, fields := range [][]interface{}{
+		{[]interface{}{"SUBSCRIBED"}, "", "*"},
+		{"", "*", "RETURN"},
+		{"", "*", "RETURN", []interface{}{"CHILDREN"}},
+		{"", "*", "SOMETHING", []interface{}{"SPECIAL-USE"}},
+	} {
+		require.Error(t, (&List{}).Parse(fields), fields)
+	}
+}
+
+func TestLegacyInfo(t *testing.T) {
+	testData := []struct {
+		info      imap.MailboxInfo
+		wantAttrs []string
+	}{
+		{imap.MailboxInfo{Name: "INBOX", Attributes: []string{imap.NoInferiorsAttr}}, []string{imap.NoInferiorsAttr, InboxAttr}},
+		{imap.MailboxInfo{Name: "All Mail", Attributes: []string{specialuse.All}}, []string{AllMailAttr}},
+		{imap.MailboxInfo{Name: "Spam", Attributes: []string{specialuse.Junk}}, []string{SpamAttr}},
+		{imap.MailboxInfo{Name: "Sent", Attributes: []string{specialuse.Sent}}, []string{specialuse.Sent}},
+		{imap.MailboxInfo{Name: "Folders/Work", Attributes: []string{}}, []string{}},
+	}
+
+	for _, tc := range testData {
+		info := tc.info
+		require.Equal(t, tc.wantAttrs, LegacyInfo(&info).Attributes, tc.info.Name)
+		require.Equal(t, tc.info, info, "original info must not change")
+	}
+}
+
+func TestIsSpecialUse(t *testing.T) {
+	require.True(t, IsSpecialUse(&imap.MailboxInfo{Attributes: []string{imap.NoInferiorsAttr, specialuse.Trash}}))
+	require.False(t, IsSpecialUse(&imap.MailboxInfo{Attributes: []string{imap.NoInferiorsAttr}}))
+}
+
+func newTestServer(t *testing.T) (*textproto.Conn, func()) {
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.Enable(NewExtension())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = s.Serve(l) }()
+
+	conn, err := textproto.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.ReadLine()
+	require.NoError(t, err)
+
+	require.Contains(t, cmd(t, conn, "a LOGIN username password")[0], "a OK")
+
+	return conn, func() {
+		_ = conn.Close()
+		_ = s.Close()
+	}
+}
+
+func cmd(t *testing.T, conn *textproto.Conn, line string) (lines []string) {
+	require.NoError(t, conn.PrintfLine("%s", line))
+	for {
+		response, err := conn.ReadLine()
+		require.NoError(t, err)
+		lines = append(lines, response)
+		if response[0] != '*' {
+			return
+		}
+	}
+}
+
+func TestXList(t *testing.T) {
+	conn, clear := newTestServer(t)
+	defer clear()
+
+	require.Equal(t, []string{
+		`* XLIST (\Inbox) "/" INBOX`,
+		"b OK XLIST completed",
+	}, cmd(t, conn, `b XLIST "" *`))
+}
+
+func TestListSpecialUse(t *testing.T) {
+	conn, clear := newTestServer(t)
+	defer clear()
+
+	require.Equal(t, []string{
+		`* LIST () "/" INBOX`,
+		"b OK LIST completed",
+	}, cmd(t, conn, `b LIST "" * RETURN (SPECIAL-USE)`))
+
+	require.Equal(t, []string{
+		"c OK LIST completed",
+	}, cmd(t, conn, `c LIST (SPECIAL-USE) "" *`))
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package importer imports local EML and MBOX files into a ProtonMail account.
+//
+// Parsing, encryption with the address keys and upload using the import
+// routes are done by the transfer package; importer only sets up the local
+// source and the PMAPI target, applies the folder mapping and reports progress.
+package importer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/migration"
+	"github.com/ProtonMail/proton-bridge/internal/transfer"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("pkg", "importer") //nolint[gochecknoglobals]
+
+// Configer provides the API configuration and the folders used by the import.
+type Configer interface {
+	GetAPIConfig() *pmapi.ClientConfig
+	GetLogDir() string
+	GetTransferDir() string
+}
+
+// Options describes one import.
+type Options struct {
+	// Path is a folder with EML files in subfolders and MBOX files.
+	Path string
+
+	UserID string
+
+	// AddressID is the address used for encryption. When empty,
+	// messages are imported to all addresses.
+	AddressID string
+
+	// FolderMapping maps names of local folders to names of ProtonMail
+	// folders. Missing target folders are created. Local folders which are
+	// not mapped are imported to the folder with a matching name or to Archive.
+	FolderMapping map[string]string
+
+	// SkipDuplicates skips messages with Message-ID which is already in
+	// the account or which was already imported.
+	SkipDuplicates bool
+}
+
+// ProgressFunc is called every time the import progresses.
+type ProgressFunc func(imported, failed, total uint)
+
+// Importer imports local files to ProtonMail accounts.
+type Importer struct {
+	config        Configer
+	panicHandler  transfer.PanicHandler
+	clientManager transfer.ClientManager
+}
+
+// New returns a new importer.
+func New(config Configer, panicHandler transfer.PanicHandler, clientManager transfer.ClientManager) *Importer {
+	return &Importer{
+		config:        config,
+		panicHandler:  panicHandler,
+		clientManager: clientManager,
+	}
+}
+
+// Import imports messages from options.Path and blocks until the import
+// is finished. It returns the number of imported and failed messages.
+func (i *Importer) Import(options Options, progress ProgressFunc) (imported, failed uint, err error) {
+	t, err := i.newTransfer(options)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	log.WithField("path", options.Path).Info("Starting import")
+
+	p := t.Start()
+	for range p.GetUpdateChannel() {
+		if progress != nil {
+			failed, imported, _, _, total := p.GetCounts()
+			progress(imported, failed, total)
+		}
+	}
+
+	failed, imported, _, _, _ = p.GetCounts()
+	if err := p.GetFatalError(); err != nil {
+		return imported, failed, err
+	}
+
+	for _, status := range p.GetFailedMessages() {
+		log.WithField("source", status.SourceID).WithField("error", status.GetErrorMessage()).Warn("Message not imported")
+	}
+	log.WithField("imported", imported).WithField("failed", failed).Info("Import finished")
+
+	return imported, failed, nil
+}
+
+// Migrate converts the local store of other email client to EML and MBOX
+// files and imports them. Messages already in the account are skipped, so
+// the migration can be repeated when it was interrupted. The Path of options
+// is ignored.
+func (i *Importer) Migrate(store migration.Store, options Options, progress ProgressFunc) (imported, failed uint, err error) {
+	dir, err := ioutil.TempDir(i.config.GetTransferDir(), "migration")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			log.WithError(err).Warn("Cannot remove converted local store")
+		}
+	}()
+
+	if err := migration.Stage(store, dir); err != nil {
+		return 0, 0, errors.Wrap(err, "cannot convert local store")
+	}
+
+	options.Path = dir
+	options.SkipDuplicates = true
+	return i.Import(options, progress)
+}
+
+func (i *Importer) newTransfer(options Options) (*transfer.Transfer, error) {
+	info, err := os.Stat(options.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read import path")
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("import path %s is not a folder", options.Path)
+	}
+
+	source := transfer.NewLocalProvider(options.Path)
+
+	target, err := transfer.NewPMAPIProvider(i.config.GetAPIConfig(), i.clientManager, options.UserID, options.AddressID)
+	if err != nil {
+		return nil, err
+	}
+	target.SetSkipDuplicates(options.SkipDuplicates)
+
+	t, err := transfer.New(i.panicHandler, noMetrics{}, i.config.GetLogDir(), i.config.GetTransferDir(), source, target)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setFolderMapping(t, options.FolderMapping); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// setFolderMapping sets a rule for every mapped source mailbox. Target
+// folders which do not exist yet are created.
+func setFolderMapping(t *transfer.Transfer, mapping map[string]string) error {
+	if len(mapping) == 0 {
+		return nil
+	}
+
+	sourceMailboxes, err := t.SourceMailboxes()
+	if err != nil {
+		return err
+	}
+
+	targetMailboxes, err := t.TargetMailboxes()
+	if err != nil {
+		return err
+	}
+
+	mapped := map[string]bool{}
+	for _, sourceMailbox := range sourceMailboxes {
+		targetName, ok := mapping[sourceMailbox.Name]
+		if !ok {
+			continue
+		}
+		mapped[sourceMailbox.Name] = true
+
+		targetMailbox, ok := findMailbox(targetMailboxes, targetName)
+		if !ok {
+			targetMailbox, err = t.CreateTargetMailbox(transfer.Mailbox{
+				Name:        targetName,
+				Color:       transfer.LeastUsedColor(targetMailboxes),
+				IsExclusive: true,
+			})
+			if err != nil {
+				return err
+			}
+			targetMailboxes = append(targetMailboxes, targetMailbox)
+		}
+
+		if err := t.SetRule(sourceMailbox, []transfer.Mailbox{targetMailbox}, 0, 0); err != nil {
+			return err
+		}
+	}
+
+	for sourceName := range mapping {
+		if !mapped[sourceName] {
+			return fmt.Errorf("local folder %q not found", sourceName)
+		}
+	}
+
+	return nil
+}
+
+// findMailbox returns mailbox with the given name, ignoring case.
+func findMailbox(mailboxes []transfer.Mailbox, name string) (transfer.Mailbox, bool) {
+	for _, mailbox := range mailboxes {
+		if strings.EqualFold(mailbox.Name, name) {
+			return mailbox, true
+		}
+	}
+	return transfer.Mailbox{}, false
+}
+
+// ParseFolderMapping parses items in format `local=ProtonMail`,
+// e.g. `Work=Job`, into folder mapping for Options.
+func ParseFolderMapping(items []string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, item := range items {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid folder mapping %q", item)
+		}
+
+		source, target := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if source == "" || target == "" {
+			return nil, fmt.Errorf("invalid folder mapping %q", item)
+		}
+
+		mapping[source] = target
+	}
+	return mapping, nil
+}
+
+// noMetrics is used because Bridge does not report import metrics.
+type noMetrics struct{}
+
+func (noMetrics) Load(int)  {}
+func (noMetrics) Start()    {}
+func (noMetrics) Complete() {}
+func (noMetrics) Cancel()   {}
+func (noMetrics) Fail()     {}
@@ -0,0 +1,137 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package importer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/migration"
+	transfermocks "github.com/ProtonMail/proton-bridge/internal/transfer/mocks"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	pmapimocks "github.com/ProtonMail/proton-bridge/pkg/pmapi/mocks"
+	gomock "github.com/golang/mock/gomock"
+	r "github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	dir string
+}
+
+func (c *testConfig) GetAPIConfig() *pmapi.ClientConfig { return &pmapi.ClientConfig{} }
+func (c *testConfig) GetLogDir() string                 { return c.dir }
+func (c *testConfig) GetTransferDir() string            { return c.dir }
+
+func newTestImporter(t *testing.T) (importer *Importer, client *pmapimocks.MockClient, root string, finish func()) {
+	ctrl := gomock.NewController(t)
+
+	client = pmapimocks.NewMockClient(ctrl)
+	clientManager := transfermocks.NewMockClientManager(ctrl)
+	clientManager.EXPECT().GetClient("user").Return(client).AnyTimes()
+
+	dir, err := ioutil.TempDir("", "importer")
+	r.NoError(t, err)
+
+	root = filepath.Join(dir, "mail")
+	for _, folder := range []string{"Inbox", "Work"} {
+		r.NoError(t, os.MkdirAll(filepath.Join(root, folder), 0700))
+		r.NoError(t, ioutil.WriteFile(filepath.Join(root, folder, "msg.eml"), []byte("Subject: hello\r\n\r\nHello\r\n"), 0600))
+	}
+
+	importer = New(&testConfig{dir: dir}, transfermocks.NewMockPanicHandler(ctrl), clientManager)
+	finish = func() {
+		ctrl.Finish()
+		_ = os.RemoveAll(dir)
+	}
+	return
+}
+
+func TestParseFolderMapping(t *testing.T) {
+	mapping, err := ParseFolderMapping([]string{"Work=Job", " Old mail = Archive "})
+	r.NoError(t, err)
+	r.Equal(t, map[string]string{"Work": "Job", "Old mail": "Archive"}, mapping)
+
+	for _, item := range []string{"Work", "=Job", "Work="} {
+		_, err := ParseFolderMapping([]string{item})
+		r.Error(t, err, item)
+	}
+}
+
+func TestImportFolderMapping(t *testing.T) {
+	importer, client, root, finish := newTestImporter(t)
+	defer finish()
+
+	client.EXPECT().ListLabels(gomock.Any()).Return([]*pmapi.Label{}, nil).AnyTimes()
+	client.EXPECT().CreateLabel(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, label *pmapi.Label) (*pmapi.Label, error) {
+		r.Equal(t, "Job", label.Name)
+		r.Equal(t, 1, label.Exclusive)
+		label.ID = "jobID"
+		return label, nil
+	})
+
+	transfer, err := importer.newTransfer(Options{
+		Path:          root,
+		UserID:        "user",
+		FolderMapping: map[string]string{"Inbox": "archive", "Work": "Job"},
+	})
+	r.NoError(t, err)
+
+	targets := map[string]string{}
+	for _, rule := range transfer.GetRules() {
+		r.Len(t, rule.TargetMailboxes, 1)
+		targets[rule.SourceMailbox.Name] = rule.TargetMailboxes[0].ID
+	}
+	r.Equal(t, map[string]string{"Inbox": pmapi.ArchiveLabel, "Work": "jobID"}, targets)
+}
+
+func TestImportUnknownFolder(t *testing.T) {
+	importer, client, root, finish := newTestImporter(t)
+	defer finish()
+
+	client.EXPECT().ListLabels(gomock.Any()).Return([]*pmapi.Label{}, nil).AnyTimes()
+
+	_, _, err := importer.Import(Options{
+		Path:          root,
+		UserID:        "user",
+		FolderMapping: map[string]string{"Private": "Job"},
+	}, nil)
+	r.Error(t, err)
+}
+
+func TestImportPathNotFolder(t *testing.T) {
+	importer, _, root, finish := newTestImporter(t)
+	defer finish()
+
+	_, _, err := importer.Import(Options{Path: filepath.Join(root, "Inbox", "msg.eml"), UserID: "user"}, nil)
+	r.Error(t, err)
+}
+
+func TestMigrateRemovesConvertedStore(t *testing.T) {
+	importer, _, root, finish := newTestImporter(t)
+	defer finish()
+
+	_, _, err := importer.Migrate(migration.Store{Kind: migration.Thunderbird, Path: filepath.Join(root, "Missing")}, Options{UserID: "user"}, nil)
+	r.Error(t, err)
+
+	staged, err := filepath.Glob(filepath.Join(filepath.Dir(root), "migration*"))
+	r.NoError(t, err)
+	r.Empty(t, staged)
+}
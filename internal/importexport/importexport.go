@@ -20,6 +20,7 @@ package importexport
 
 import (
 	"bytes"
+	"context"
 
 	"github.com/ProtonMail/proton-bridge/internal/transfer"
 	"github.com/ProtonMail/proton-bridge/internal/users"
@@ -74,7 +75,7 @@ func (ie *ImportExport) ReportBug(osType, osVersion, description, accountName, a
 		Email:       address,
 	}
 
-	if err := c.Report(report); err != nil {
+	if err := c.Report(context.Background(), report); err != nil {
 		log.Error("Reporting bug failed: ", err)
 		return err
 	}
@@ -103,7 +104,7 @@ func (ie *ImportExport) ReportFile(osType, osVersion, accountName, address strin
 
 	report.AddAttachment("log", "report.log", bytes.NewReader(logdata))
 
-	if err := c.Report(report); err != nil {
+	if err := c.Report(context.Background(), report); err != nil {
 		log.Error("Sending report failed: ", err)
 		return err
 	}
@@ -156,6 +157,16 @@ func (ie *ImportExport) GetMBOXExporter(address, path string) (*transfer.Transfe
 	return transfer.New(ie.panicHandler, newExportMetricsManager(ie), ie.config.GetLogDir(), ie.config.GetTransferDir(), source, target)
 }
 
+// GetHTMLExporter returns transferrer from ProtonMail account to static HTML archive.
+func (ie *ImportExport) GetHTMLExporter(address, path string) (*transfer.Transfer, error) {
+	source, err := ie.getPMAPIProvider(address)
+	if err != nil {
+		return nil, err
+	}
+	target := transfer.NewHTMLProvider(path)
+	return transfer.New(ie.panicHandler, newExportMetricsManager(ie), ie.config.GetLogDir(), ie.config.GetTransferDir(), source, target)
+}
+
 func (ie *ImportExport) getPMAPIProvider(address string) (*transfer.PMAPIProvider, error) {
 	user, err := ie.Users.GetUser(address)
 	if err != nil {
@@ -0,0 +1,128 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package incidents keeps a log of recent operational incidents, such as
+// failed syncs, outages of API or messages which could not be decrypted,
+// so users can review them after the notification is gone.
+package incidents
+
+import (
+	"sync"
+	"time"
+)
+
+// Kind is the kind of the incident.
+type Kind string
+
+// Kinds of reported incidents.
+const (
+	SyncFailed     Kind = "sync failed"
+	APIUnreachable Kind = "API not reachable"
+	DecryptFailed  Kind = "decryption failed"
+	ServerFailed   Kind = "server failed"
+)
+
+const (
+	// maxIncidents is how many incidents are kept; the oldest are dropped.
+	maxIncidents = 100
+
+	// mergeWindow is how long the same incident is counted in the previous
+	// entry instead of creating a new one, so repeated failures of event
+	// loop or FETCH do not push everything else out of the log.
+	mergeWindow = 10 * time.Minute
+)
+
+// Incident is one entry of the log. UserID is empty for incidents which
+// do not belong to any account.
+type Incident struct {
+	Kind    Kind
+	UserID  string
+	Message string
+	First   time.Time
+	Last    time.Time
+	Count   int
+}
+
+// Log is a bounded log of incidents safe for concurrent use.
+type Log struct {
+	incidents []Incident
+	lock      sync.RWMutex
+}
+
+var defaultLog = &Log{} //nolint[gochecknoglobals]
+
+// Report adds the incident to the default log.
+func Report(kind Kind, userID, message string) {
+	defaultLog.Report(kind, userID, message, time.Now())
+}
+
+// List returns incidents of the default log, the oldest first.
+func List() []Incident {
+	return defaultLog.List()
+}
+
+// Clear removes all incidents from the default log.
+func Clear() {
+	defaultLog.Clear()
+}
+
+// Report adds the incident to the log or counts it in the existing entry
+// if the same incident happened recently.
+func (l *Log) Report(kind Kind, userID, message string, now time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for i := len(l.incidents) - 1; i >= 0; i-- {
+		incident := &l.incidents[i]
+		if now.Sub(incident.Last) > mergeWindow {
+			break
+		}
+		if incident.Kind == kind && incident.UserID == userID && incident.Message == message {
+			incident.Last = now
+			incident.Count++
+			return
+		}
+	}
+
+	l.incidents = append(l.incidents, Incident{
+		Kind:    kind,
+		UserID:  userID,
+		Message: message,
+		First:   now,
+		Last:    now,
+		Count:   1,
+	})
+	if len(l.incidents) > maxIncidents {
+		l.incidents = l.incidents[len(l.incidents)-maxIncidents:]
+	}
+}
+
+// List returns copy of incidents, the oldest first.
+func (l *Log) List() []Incident {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return append([]Incident{}, l.incidents...)
+}
+
+// Clear removes all incidents.
+func (l *Log) Clear() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.incidents = nil
+}
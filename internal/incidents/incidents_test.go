@@ -0,0 +1,62 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package incidents
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportMergesRepeatedIncidents(t *testing.T) {
+	l := &Log{}
+	now := time.Unix(1600000000, 0)
+
+	l.Report(SyncFailed, "user", "timeout", now)
+	l.Report(DecryptFailed, "user", "message 1", now.Add(time.Minute))
+	l.Report(SyncFailed, "user", "timeout", now.Add(2*time.Minute))
+	l.Report(SyncFailed, "other", "timeout", now.Add(3*time.Minute))
+
+	incidents := l.List()
+	require.Len(t, incidents, 3)
+	require.Equal(t, 2, incidents[0].Count)
+	require.Equal(t, now, incidents[0].First)
+	require.Equal(t, now.Add(2*time.Minute), incidents[0].Last)
+	require.Equal(t, "other", incidents[2].UserID)
+
+	l.Report(SyncFailed, "user", "timeout", now.Add(time.Hour))
+	require.Len(t, l.List(), 4, "incident after the merge window is a new entry")
+
+	l.Clear()
+	require.Empty(t, l.List())
+}
+
+func TestReportDropsOldest(t *testing.T) {
+	l := &Log{}
+	now := time.Unix(1600000000, 0)
+
+	for i := 0; i < maxIncidents+10; i++ {
+		l.Report(ServerFailed, "", strconv.Itoa(i), now)
+	}
+
+	incidents := l.List()
+	require.Len(t, incidents, maxIncidents)
+	require.Equal(t, "10", incidents[0].Message)
+}
@@ -0,0 +1,268 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Classes of BER tags.
+const (
+	classUniversal   = 0x00
+	classApplication = 0x40
+	classContext     = 0x80
+
+	constructedBit = 0x20
+)
+
+// Universal tags used by LDAP.
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagNull        = 0x05
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x10
+	tagSet         = 0x11
+)
+
+// maxPacketSize limits the size of a request; LDAP requests of address book
+// lookups are small.
+const maxPacketSize = 1024 * 1024
+
+var errMalformedPacket = errors.New("malformed BER packet")
+
+// packet is an element of BER encoded data. Primitive elements have value,
+// constructed ones have children.
+type packet struct {
+	class       byte
+	constructed bool
+	tag         byte
+	value       []byte
+	children    []*packet
+}
+
+func newConstructed(class, tag byte, children ...*packet) *packet {
+	return &packet{class: class, constructed: true, tag: tag, children: children}
+}
+
+func newSequence(children ...*packet) *packet {
+	return newConstructed(classUniversal, tagSequence, children...)
+}
+
+func newString(class, tag byte, value string) *packet {
+	return &packet{class: class, tag: tag, value: []byte(value)}
+}
+
+func newOctetString(value string) *packet {
+	return newString(classUniversal, tagOctetString, value)
+}
+
+func newInteger(class, tag byte, value int64) *packet {
+	// Minimal two's complement big-endian encoding.
+	encoded := []byte{}
+	for {
+		encoded = append([]byte{byte(value)}, encoded...)
+		value >>= 8
+		if (value == 0 && encoded[0]&0x80 == 0) || (value == -1 && encoded[0]&0x80 != 0) {
+			break
+		}
+	}
+	return &packet{class: class, tag: tag, value: encoded}
+}
+
+func newEnumerated(value int64) *packet {
+	return newInteger(classUniversal, tagEnumerated, value)
+}
+
+// is returns whether the packet has the given class and tag.
+func (p *packet) is(class, tag byte) bool {
+	return p.class == class && p.tag == tag
+}
+
+func (p *packet) child(i int) (*packet, error) {
+	if i >= len(p.children) {
+		return nil, errMalformedPacket
+	}
+	return p.children[i], nil
+}
+
+func (p *packet) int() (int64, error) {
+	if p.constructed || len(p.value) == 0 || len(p.value) > 8 {
+		return 0, errMalformedPacket
+	}
+
+	value := int64(int8(p.value[0]))
+	for _, b := range p.value[1:] {
+		value = value<<8 | int64(b)
+	}
+
+	return value, nil
+}
+
+func (p *packet) bool() (bool, error) {
+	if p.constructed || len(p.value) != 1 {
+		return false, errMalformedPacket
+	}
+	return p.value[0] != 0, nil
+}
+
+func (p *packet) str() (string, error) {
+	if p.constructed {
+		return "", errMalformedPacket
+	}
+	return string(p.value), nil
+}
+
+// bytes returns BER encoding of the packet.
+func (p *packet) bytes() []byte {
+	content := p.value
+	if p.constructed {
+		buf := &bytes.Buffer{}
+		for _, child := range p.children {
+			buf.Write(child.bytes())
+		}
+		content = buf.Bytes()
+	}
+
+	identifier := p.class | p.tag
+	if p.constructed {
+		identifier |= constructedBit
+	}
+
+	out := []byte{identifier}
+	out = append(out, encodeLength(len(content))...)
+	return append(out, content...)
+}
+
+func encodeLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+
+	encoded := []byte{}
+	for ; length > 0; length >>= 8 {
+		encoded = append([]byte{byte(length)}, encoded...)
+	}
+	return append([]byte{0x80 | byte(len(encoded))}, encoded...)
+}
+
+// readPacket reads one whole packet from r.
+func readPacket(r *bufio.Reader) (*packet, error) {
+	identifier, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+
+	return parsePacket(identifier, content)
+}
+
+func readLength(r io.ByteReader) (int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	if first&0x80 == 0 {
+		return int(first), nil
+	}
+
+	// Indefinite length is not allowed in LDAP.
+	size := int(first & 0x7f)
+	if size == 0 || size > 4 {
+		return 0, errMalformedPacket
+	}
+
+	length := 0
+	for i := 0; i < size; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+
+	if length > maxPacketSize {
+		return 0, errors.New("BER packet is too big")
+	}
+
+	return length, nil
+}
+
+func parsePacket(identifier byte, content []byte) (*packet, error) {
+	// High tag numbers are not used by LDAP.
+	if identifier&0x1f == 0x1f {
+		return nil, errMalformedPacket
+	}
+
+	p := &packet{
+		class:       identifier & 0xc0,
+		constructed: identifier&constructedBit != 0,
+		tag:         identifier & 0x1f,
+	}
+
+	if !p.constructed {
+		p.value = content
+		return p, nil
+	}
+
+	r := bytes.NewReader(content)
+	for r.Len() > 0 {
+		childIdentifier, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := readLength(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if length > r.Len() {
+			return nil, errMalformedPacket
+		}
+
+		childContent := make([]byte, length)
+		if _, err := io.ReadFull(r, childContent); err != nil {
+			return nil, err
+		}
+
+		child, err := parsePacket(childIdentifier, childContent)
+		if err != nil {
+			return nil, err
+		}
+
+		p.children = append(p.children, child)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func roundTrip(t *testing.T, p *packet) *packet {
+	decoded, err := readPacket(bufio.NewReader(bytes.NewReader(p.bytes())))
+	require.NoError(t, err)
+	return decoded
+}
+
+func TestBERInteger(t *testing.T) {
+	for _, value := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 1 << 40} {
+		decoded, err := roundTrip(t, newInteger(classUniversal, tagInteger, value)).int()
+		require.NoError(t, err)
+		require.Equal(t, value, decoded)
+	}
+
+	require.Equal(t, []byte{0x02, 0x02, 0x00, 0x80}, newInteger(classUniversal, tagInteger, 128).bytes())
+}
+
+func TestBERLongLength(t *testing.T) {
+	value := strings.Repeat("x", 300)
+
+	encoded := newOctetString(value).bytes()
+	require.Equal(t, []byte{0x04, 0x82, 0x01, 0x2c}, encoded[:4])
+
+	decoded, err := roundTrip(t, newSequence(newOctetString(value))).children[0].str()
+	require.NoError(t, err)
+	require.Equal(t, value, decoded)
+}
+
+func TestBERMalformed(t *testing.T) {
+	// Child is longer than its parent.
+	_, err := readPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0x03, 0x04, 0x05, 0x61})))
+	require.Error(t, err)
+
+	// Indefinite length.
+	_, err = readPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0x80, 0x00, 0x00})))
+	require.Error(t, err)
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package ldap
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// BaseDN is the distinguished name under which contacts are served. Clients
+// should use it as the search base.
+const BaseDN = "ou=contacts,dc=bridge"
+
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+const (
+	// contactsPageSize is the number of contact emails loaded by one request.
+	contactsPageSize = 1000
+
+	// contactsMaxPages limits loading of huge address books.
+	contactsMaxPages = 50
+
+	// contactsCacheTimeout is how long loaded contacts are reused. Clients
+	// search on every typed character, so contacts must not be loaded for
+	// every search.
+	contactsCacheTimeout = time.Minute
+)
+
+// attribute is one attribute of an entry with its values.
+type attribute struct {
+	name   string
+	values []string
+}
+
+// entry is an object in the directory.
+type entry struct {
+	dn    string
+	attrs []attribute
+}
+
+// get returns values of the attribute. Names are case insensitive.
+func (e *entry) get(name string) []string {
+	for _, attr := range e.attrs {
+		if strings.EqualFold(attr.name, name) {
+			return attr.values
+		}
+	}
+	return nil
+}
+
+func newRootDSE() *entry {
+	return &entry{
+		dn: "",
+		attrs: []attribute{
+			{"objectClass", []string{"top"}},
+			{"namingContexts", []string{BaseDN}},
+			{"supportedLDAPVersion", []string{"3"}},
+			{"supportedExtension", []string{startTLSOID}},
+			{"vendorName", []string{"Proton Technologies AG"}},
+		},
+	}
+}
+
+func newBaseEntry() *entry {
+	return &entry{
+		dn: BaseDN,
+		attrs: []attribute{
+			{"objectClass", []string{"top", "organizationalUnit"}},
+			{"ou", []string{"contacts"}},
+		},
+	}
+}
+
+// newContactEntry returns an entry for one email of a contact. Contacts with
+// more emails are served as more entries so clients offer all of them.
+func newContactEntry(email pmapi.ContactEmail) *entry {
+	name := email.Name
+	if name == "" {
+		name = email.Email
+	}
+
+	attrs := []attribute{
+		{"objectClass", []string{"top", "person", "organizationalPerson", "inetOrgPerson"}},
+		{"cn", []string{name}},
+		{"displayName", []string{name}},
+		{"mail", []string{email.Email}},
+	}
+
+	if i := strings.LastIndex(strings.TrimSpace(name), " "); i > 0 && name != email.Email {
+		attrs = append(attrs,
+			attribute{"givenName", []string{strings.TrimSpace(name[:i])}},
+			attribute{"sn", []string{strings.TrimSpace(name[i+1:])}},
+		)
+	} else {
+		attrs = append(attrs, attribute{"sn", []string{name}})
+	}
+
+	return &entry{
+		dn:    "mail=" + escapeDNValue(email.Email) + "," + BaseDN,
+		attrs: attrs,
+	}
+}
+
+// escapeDNValue escapes characters with special meaning in DN.
+func escapeDNValue(value string) string {
+	escaped := strings.Builder{}
+	for i, r := range value {
+		if strings.ContainsRune(",+\"\\<>;=", r) || (r == '#' && i == 0) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// normalizeDN makes DNs comparable: names and values are case insensitive
+// and spaces around separators are not significant.
+func normalizeDN(dn string) string {
+	parts := strings.Split(strings.ToLower(dn), ",")
+	for i, part := range parts {
+		if j := strings.Index(part, "="); j >= 0 {
+			part = strings.TrimSpace(part[:j]) + "=" + strings.TrimSpace(part[j+1:])
+		}
+		parts[i] = strings.TrimSpace(part)
+	}
+	return strings.Join(parts, ",")
+}
+
+// usernameFromDN returns the username from bind DN. Clients can bind with
+// plain username or with DN such as uid=user@pm.me,ou=contacts,dc=bridge.
+func usernameFromDN(dn string) string {
+	if !strings.Contains(dn, "=") {
+		return dn
+	}
+
+	first := strings.SplitN(dn, ",", 2)[0]
+	return strings.TrimSpace(first[strings.Index(first, "=")+1:])
+}
+
+type cachedContacts struct {
+	entries  []*entry
+	loadedAt time.Time
+}
+
+// contactsCache keeps loaded contacts of users for a short time.
+type contactsCache struct {
+	lock     sync.Mutex
+	contacts map[string]cachedContacts
+}
+
+func newContactsCache() *contactsCache {
+	return &contactsCache{contacts: map[string]cachedContacts{}}
+}
+
+// get returns entries of all contact emails of the user.
+func (c *contactsCache) get(user bridgeUser) ([]*entry, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cached, ok := c.contacts[user.ID()]; ok && time.Since(cached.loadedAt) < contactsCacheTimeout {
+		return cached.entries, nil
+	}
+
+	emails, err := loadContactEmails(context.Background(), user.GetTemporaryPMAPIClient())
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*entry, 0, len(emails))
+	for _, email := range emails {
+		entries = append(entries, newContactEntry(email))
+	}
+
+	c.contacts[user.ID()] = cachedContacts{entries: entries, loadedAt: time.Now()}
+
+	return entries, nil
+}
+
+func loadContactEmails(ctx context.Context, client pmapi.Client) ([]pmapi.ContactEmail, error) {
+	emails := []pmapi.ContactEmail{}
+
+	for page := 0; page < contactsMaxPages; page++ {
+		pageEmails, err := client.GetAllContactsEmails(ctx, page, contactsPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, pageEmails...)
+
+		if len(pageEmails) < contactsPageSize {
+			break
+		}
+	}
+
+	return emails, nil
+}
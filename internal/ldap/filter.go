@@ -0,0 +1,223 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package ldap
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Context tags of search filter choices.
+const (
+	filterAnd             = 0
+	filterOr              = 1
+	filterNot             = 2
+	filterEqualityMatch   = 3
+	filterSubstrings      = 4
+	filterGreaterOrEqual  = 5
+	filterLessOrEqual     = 6
+	filterPresent         = 7
+	filterApproxMatch     = 8
+	filterExtensibleMatch = 9
+)
+
+// Context tags of substring filter parts.
+const (
+	substringInitial = 0
+	substringAny     = 1
+	substringFinal   = 2
+)
+
+// filter matches entries of a search. All served attributes have case
+// insensitive string values, so all comparisons ignore case.
+type filter func(e *entry) bool
+
+// parseFilter builds filter from its BER encoding. Extensible match is not
+// supported by address book clients and never matches.
+func parseFilter(p *packet) (filter, error) { //nolint[funlen]
+	if p.class != classContext {
+		return nil, errMalformedPacket
+	}
+
+	switch p.tag {
+	case filterAnd, filterOr:
+		if !p.constructed {
+			return nil, errMalformedPacket
+		}
+		filters := []filter{}
+		for _, child := range p.children {
+			f, err := parseFilter(child)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, f)
+		}
+		if p.tag == filterAnd {
+			return andFilter(filters), nil
+		}
+		return orFilter(filters), nil
+
+	case filterNot:
+		child, err := p.child(0)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parseFilter(child)
+		if err != nil {
+			return nil, err
+		}
+		return func(e *entry) bool { return !f(e) }, nil
+
+	case filterEqualityMatch, filterGreaterOrEqual, filterLessOrEqual, filterApproxMatch:
+		attr, value, err := parseAssertion(p)
+		if err != nil {
+			return nil, err
+		}
+		return valueFilter(attr, func(v string) bool {
+			switch p.tag {
+			case filterGreaterOrEqual:
+				return v >= value
+			case filterLessOrEqual:
+				return v <= value
+			case filterApproxMatch:
+				return strings.Contains(v, value)
+			default:
+				return v == value
+			}
+		}), nil
+
+	case filterSubstrings:
+		return parseSubstrings(p)
+
+	case filterPresent:
+		attr, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *entry) bool { return len(e.get(attr)) > 0 }, nil
+
+	case filterExtensibleMatch:
+		return func(*entry) bool { return false }, nil
+
+	default:
+		return nil, errors.Errorf("unknown filter %d", p.tag)
+	}
+}
+
+func andFilter(filters []filter) filter {
+	return func(e *entry) bool {
+		for _, f := range filters {
+			if !f(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func orFilter(filters []filter) filter {
+	return func(e *entry) bool {
+		for _, f := range filters {
+			if f(e) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// valueFilter matches entries with any value of attr matching. Values are
+// passed to match in lower case.
+func valueFilter(attr string, match func(string) bool) filter {
+	return func(e *entry) bool {
+		for _, v := range e.get(attr) {
+			if match(strings.ToLower(v)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// parseAssertion returns attribute and lower case value of the assertion.
+func parseAssertion(p *packet) (attr, value string, err error) {
+	if !p.constructed || len(p.children) != 2 {
+		return "", "", errMalformedPacket
+	}
+
+	if attr, err = p.children[0].str(); err != nil {
+		return "", "", err
+	}
+
+	if value, err = p.children[1].str(); err != nil {
+		return "", "", err
+	}
+
+	return attr, strings.ToLower(value), nil
+}
+
+func parseSubstrings(p *packet) (filter, error) {
+	if !p.constructed || len(p.children) != 2 || !p.children[1].constructed {
+		return nil, errMalformedPacket
+	}
+
+	attr, err := p.children[0].str()
+	if err != nil {
+		return nil, err
+	}
+
+	var initial, final string
+	var any []string
+
+	for _, part := range p.children[1].children {
+		value, err := part.str()
+		if err != nil {
+			return nil, err
+		}
+		value = strings.ToLower(value)
+
+		switch part.tag {
+		case substringInitial:
+			initial = value
+		case substringAny:
+			any = append(any, value)
+		case substringFinal:
+			final = value
+		default:
+			return nil, errMalformedPacket
+		}
+	}
+
+	return valueFilter(attr, func(v string) bool {
+		if !strings.HasPrefix(v, initial) {
+			return false
+		}
+		v = v[len(initial):]
+
+		for _, part := range any {
+			i := strings.Index(v, part)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(part):]
+		}
+
+		return strings.HasSuffix(v, final)
+	}), nil
+}
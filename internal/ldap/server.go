@@ -0,0 +1,460 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package ldap provides minimal read-only LDAP server of the Bridge exposing
+// contacts of the user for address autocomplete of mail clients which do
+// not support CardDAV, such as Outlook.
+//
+// Clients bind with Bridge username and password and search under BaseDN.
+// Each email of a contact is an inetOrgPerson entry with cn, displayName,
+// givenName, sn and mail attributes. Connection can be upgraded by StartTLS.
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/incidents"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	log = logrus.WithField("pkg", "ldap") //nolint[gochecknoglobals]
+)
+
+// Application tags of LDAP operations.
+const (
+	opBindRequest      = 0
+	opBindResponse     = 1
+	opUnbindRequest    = 2
+	opSearchRequest    = 3
+	opSearchEntry      = 4
+	opSearchDone       = 5
+	opModifyRequest    = 6
+	opAddRequest       = 8
+	opDelRequest       = 10
+	opModifyDNRequest  = 12
+	opCompareRequest   = 14
+	opAbandonRequest   = 16
+	opExtendedRequest  = 23
+	opExtendedResponse = 24
+)
+
+// LDAP result codes.
+const (
+	resultSuccess                  = 0
+	resultProtocolError            = 2
+	resultSizeLimitExceeded        = 4
+	resultAuthMethodNotSupported   = 7
+	resultNoSuchObject             = 32
+	resultInvalidCredentials       = 49
+	resultInsufficientAccessRights = 50
+	resultUnwillingToPerform       = 53
+	resultOther                    = 80
+)
+
+// Search scopes.
+const (
+	scopeBaseObject  = 0
+	scopeSingleLevel = 1
+)
+
+type ldapServer struct {
+	address       string
+	tlsConfig     *tls.Config
+	bridge        bridger
+	eventListener listener.Listener
+	contacts      *contactsCache
+
+	lock     sync.Mutex
+	listener net.Listener
+}
+
+// NewLDAPServer constructs a new LDAP server configured with the given options.
+func NewLDAPServer(port int, tls *tls.Config, bridge *bridge.Bridge, eventListener listener.Listener) *ldapServer { //nolint[golint]
+	return newLDAPServer(port, tls, newBridgeWrap(bridge), eventListener)
+}
+
+func newLDAPServer(port int, tlsConfig *tls.Config, b bridger, eventListener listener.Listener) *ldapServer {
+	return &ldapServer{
+		address:       fmt.Sprintf("%v:%v", bridge.Host, port),
+		tlsConfig:     tlsConfig,
+		bridge:        b,
+		eventListener: eventListener,
+		contacts:      newContactsCache(),
+	}
+}
+
+// Starts the server.
+func (s *ldapServer) ListenAndServe() {
+	log.Info("LDAP server listening at ", s.address)
+	l, err := net.Listen("tcp", s.address)
+	if err != nil {
+		s.eventListener.Emit(events.ErrorEvent, "LDAP failed: "+err.Error())
+		incidents.Report(incidents.ServerFailed, "", "LDAP failed: "+err.Error())
+		log.Error("LDAP failed: ", err)
+		return
+	}
+
+	s.serve(l)
+
+	log.Info("LDAP server stopped")
+}
+
+// Stops the server.
+func (s *ldapServer) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+}
+
+func (s *ldapServer) serve(l net.Listener) {
+	s.lock.Lock()
+	s.listener = l
+	s.lock.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+// session is one connection of a client.
+type session struct {
+	server *ldapServer
+	conn   net.Conn
+	reader *bufio.Reader
+	isTLS  bool
+
+	// user is nil until the client binds.
+	user bridgeUser
+}
+
+func (s *ldapServer) handleConn(conn net.Conn) {
+	sess := &session{
+		server: s,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+
+	defer func() { _ = sess.conn.Close() }()
+
+	for {
+		req, err := readPacket(sess.reader)
+		if err != nil {
+			if err != io.EOF {
+				log.WithError(err).Warn("Cannot read LDAP request")
+			}
+			return
+		}
+
+		if err := sess.handle(req); err != nil {
+			if err != io.EOF {
+				log.WithError(err).Warn("LDAP request failed")
+			}
+			return
+		}
+	}
+}
+
+// handle processes one LDAPMessage. Returned error closes the connection.
+func (sess *session) handle(req *packet) error {
+	if !req.is(classUniversal, tagSequence) || len(req.children) < 2 {
+		return errMalformedPacket
+	}
+
+	messageID, err := req.children[0].int()
+	if err != nil {
+		return err
+	}
+
+	op := req.children[1]
+	if op.class != classApplication {
+		return errMalformedPacket
+	}
+
+	switch op.tag {
+	case opBindRequest:
+		return sess.bind(messageID, op)
+	case opUnbindRequest:
+		return io.EOF
+	case opSearchRequest:
+		return sess.search(messageID, op)
+	case opExtendedRequest:
+		return sess.extended(messageID, op)
+	case opAbandonRequest:
+		return nil
+	case opModifyRequest, opAddRequest, opDelRequest, opModifyDNRequest, opCompareRequest:
+		return sess.respond(messageID, newResult(op.tag+1, resultUnwillingToPerform, "Contacts are read-only"))
+	default:
+		return errors.Errorf("unknown operation %d", op.tag)
+	}
+}
+
+func (sess *session) respond(messageID int64, op *packet) error {
+	_, err := sess.conn.Write(newSequence(newInteger(classUniversal, tagInteger, messageID), op).bytes())
+	return err
+}
+
+func newResult(tag byte, code int64, diagnostic string, extra ...*packet) *packet {
+	children := append([]*packet{
+		newEnumerated(code),
+		newOctetString(""),
+		newOctetString(diagnostic),
+	}, extra...)
+
+	return newConstructed(classApplication, tag, children...)
+}
+
+// bind authenticates the session by simple bind with Bridge credentials.
+// Anonymous bind is allowed but can read only the root DSE.
+func (sess *session) bind(messageID int64, op *packet) error {
+	if len(op.children) < 3 {
+		return errMalformedPacket
+	}
+
+	name, err := op.children[1].str()
+	if err != nil {
+		return err
+	}
+
+	auth := op.children[2]
+	if !auth.is(classContext, 0) {
+		return sess.respond(messageID, newResult(opBindResponse, resultAuthMethodNotSupported, "Only simple bind is supported"))
+	}
+
+	password, err := auth.str()
+	if err != nil {
+		return err
+	}
+
+	sess.user = nil
+
+	if name == "" && password == "" {
+		return sess.respond(messageID, newResult(opBindResponse, resultSuccess, ""))
+	}
+
+	user, err := sess.server.bridge.GetUser(usernameFromDN(name))
+	if err == nil {
+		err = user.CheckBridgeLogin(password)
+	}
+	if err != nil {
+		log.WithError(err).Warn("LDAP authentication failed")
+		return sess.respond(messageID, newResult(opBindResponse, resultInvalidCredentials, "Invalid credentials"))
+	}
+
+	sess.user = user
+
+	return sess.respond(messageID, newResult(opBindResponse, resultSuccess, ""))
+}
+
+type searchRequest struct {
+	base       string
+	scope      int64
+	sizeLimit  int64
+	typesOnly  bool
+	filter     filter
+	attributes []string
+}
+
+func parseSearchRequest(op *packet) (*searchRequest, error) {
+	if len(op.children) < 8 {
+		return nil, errMalformedPacket
+	}
+
+	req := &searchRequest{}
+
+	var err error
+	if req.base, err = op.children[0].str(); err != nil {
+		return nil, err
+	}
+	if req.scope, err = op.children[1].int(); err != nil {
+		return nil, err
+	}
+	if req.sizeLimit, err = op.children[3].int(); err != nil {
+		return nil, err
+	}
+	if req.typesOnly, err = op.children[5].bool(); err != nil {
+		return nil, err
+	}
+	if req.filter, err = parseFilter(op.children[6]); err != nil {
+		return nil, err
+	}
+
+	for _, attr := range op.children[7].children {
+		name, err := attr.str()
+		if err != nil {
+			return nil, err
+		}
+		req.attributes = append(req.attributes, name)
+	}
+
+	return req, nil
+}
+
+func (sess *session) search(messageID int64, op *packet) error {
+	req, err := parseSearchRequest(op)
+	if err != nil {
+		return sess.respond(messageID, newResult(opSearchDone, resultProtocolError, err.Error()))
+	}
+
+	var candidates []*entry
+	if req.base == "" && req.scope == scopeBaseObject {
+		candidates = []*entry{newRootDSE()}
+	} else {
+		if sess.user == nil {
+			return sess.respond(messageID, newResult(opSearchDone, resultInsufficientAccessRights, "Bind with Bridge credentials is required"))
+		}
+
+		contacts, err := sess.server.contacts.get(sess.user)
+		if err != nil {
+			log.WithError(err).Error("Cannot load contacts")
+			return sess.respond(messageID, newResult(opSearchDone, resultOther, "Cannot load contacts"))
+		}
+
+		var ok bool
+		if candidates, ok = getCandidates(req, contacts); !ok {
+			return sess.respond(messageID, newResult(opSearchDone, resultNoSuchObject, "No such object"))
+		}
+	}
+
+	sent := int64(0)
+	for _, e := range candidates {
+		if !req.filter(e) {
+			continue
+		}
+
+		if req.sizeLimit > 0 && sent >= req.sizeLimit {
+			return sess.respond(messageID, newResult(opSearchDone, resultSizeLimitExceeded, ""))
+		}
+
+		if err := sess.respond(messageID, newSearchEntry(e, req)); err != nil {
+			return err
+		}
+		sent++
+	}
+
+	return sess.respond(messageID, newResult(opSearchDone, resultSuccess, ""))
+}
+
+// getCandidates returns entries in the scope of the search or false if the
+// base does not exist. Empty base is treated as BaseDN so clients work even
+// without configured search base.
+func getCandidates(req *searchRequest, contacts []*entry) ([]*entry, bool) {
+	base := normalizeDN(req.base)
+
+	if base == "" || base == normalizeDN(BaseDN) {
+		switch req.scope {
+		case scopeBaseObject:
+			return []*entry{newBaseEntry()}, true
+		case scopeSingleLevel:
+			return contacts, true
+		default:
+			return append([]*entry{newBaseEntry()}, contacts...), true
+		}
+	}
+
+	for _, e := range contacts {
+		if normalizeDN(e.dn) == base {
+			if req.scope == scopeSingleLevel {
+				return nil, true
+			}
+			return []*entry{e}, true
+		}
+	}
+
+	return nil, false
+}
+
+// newSearchEntry returns the entry with requested attributes. All
+// attributes are returned if none or `*` is requested.
+func newSearchEntry(e *entry, req *searchRequest) *packet {
+	all := len(req.attributes) == 0
+	requested := map[string]bool{}
+	for _, name := range req.attributes {
+		if name == "*" {
+			all = true
+		}
+		requested[strings.ToLower(name)] = true
+	}
+
+	attrs := newSequence()
+	for _, attr := range e.attrs {
+		if !all && !requested[strings.ToLower(attr.name)] {
+			continue
+		}
+
+		values := newConstructed(classUniversal, tagSet)
+		if !req.typesOnly {
+			for _, value := range attr.values {
+				values.children = append(values.children, newOctetString(value))
+			}
+		}
+
+		attrs.children = append(attrs.children, newSequence(newOctetString(attr.name), values))
+	}
+
+	return newConstructed(classApplication, opSearchEntry, newOctetString(e.dn), attrs)
+}
+
+// extended handles StartTLS which is the only supported extended operation.
+func (sess *session) extended(messageID int64, op *packet) error {
+	name := ""
+	if len(op.children) > 0 && op.children[0].is(classContext, 0) {
+		name, _ = op.children[0].str()
+	}
+
+	if name != startTLSOID {
+		return sess.respond(messageID, newResult(opExtendedResponse, resultProtocolError, "Unsupported extended operation "+strconv.Quote(name)))
+	}
+
+	if sess.isTLS || sess.server.tlsConfig == nil {
+		return sess.respond(messageID, newResult(opExtendedResponse, resultUnwillingToPerform, "TLS is not available"))
+	}
+
+	if err := sess.respond(messageID, newResult(opExtendedResponse, resultSuccess, "", newString(classContext, 10, startTLSOID))); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Server(sess.conn, sess.server.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+
+	sess.conn = tlsConn
+	sess.reader = bufio.NewReader(tlsConn)
+	sess.isTLS = true
+
+	return nil
+}
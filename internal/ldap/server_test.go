@@ -0,0 +1,233 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	pmapimocks "github.com/ProtonMail/proton-bridge/pkg/pmapi/mocks"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+type testBridge struct {
+	user *testUser
+}
+
+func (b *testBridge) GetUser(query string) (bridgeUser, error) {
+	if query != "user@pm.me" {
+		return nil, errors.New("no such user")
+	}
+	return b.user, nil
+}
+
+type testUser struct {
+	client pmapi.Client
+}
+
+func (u *testUser) ID() string { return "userID" }
+
+func (u *testUser) CheckBridgeLogin(password string) error {
+	if password != "bridgepass" {
+		return errors.New("wrong password")
+	}
+	return nil
+}
+
+func (u *testUser) GetTemporaryPMAPIClient() pmapi.Client { return u.client }
+
+type testClient struct {
+	t         *testing.T
+	conn      net.Conn
+	reader    *bufio.Reader
+	messageID int64
+}
+
+func newTestClient(t *testing.T) (*testClient, *pmapimocks.MockClient, func()) {
+	ctrl := gomock.NewController(t)
+	client := pmapimocks.NewMockClient(ctrl)
+
+	s := newLDAPServer(0, nil, &testBridge{user: &testUser{client: client}}, nil)
+
+	clientConn, serverConn := net.Pipe()
+	go s.handleConn(serverConn)
+
+	c := &testClient{t: t, conn: clientConn, reader: bufio.NewReader(clientConn)}
+
+	return c, client, func() {
+		_ = clientConn.Close()
+		ctrl.Finish()
+	}
+}
+
+// send sends the operation and returns all responses until the final one.
+func (c *testClient) send(op *packet, finalTag byte) []*packet {
+	c.messageID++
+	_, err := c.conn.Write(newSequence(newInteger(classUniversal, tagInteger, c.messageID), op).bytes())
+	require.NoError(c.t, err)
+
+	responses := []*packet{}
+	for {
+		res, err := readPacket(c.reader)
+		require.NoError(c.t, err)
+
+		messageID, err := res.children[0].int()
+		require.NoError(c.t, err)
+		require.Equal(c.t, c.messageID, messageID)
+
+		responses = append(responses, res.children[1])
+		if res.children[1].tag == finalTag {
+			return responses
+		}
+	}
+}
+
+func (c *testClient) bind(name, password string) int64 {
+	res := c.send(newConstructed(classApplication, opBindRequest,
+		newInteger(classUniversal, tagInteger, 3),
+		newOctetString(name),
+		newString(classContext, 0, password),
+	), opBindResponse)
+	return resultCode(c.t, res[0])
+}
+
+func (c *testClient) search(base string, scope int64, sizeLimit int64, f *packet, attrs ...string) ([]*packet, int64) {
+	attrList := newSequence()
+	for _, attr := range attrs {
+		attrList.children = append(attrList.children, newOctetString(attr))
+	}
+
+	res := c.send(newConstructed(classApplication, opSearchRequest,
+		newOctetString(base),
+		newEnumerated(scope),
+		newEnumerated(0),
+		newInteger(classUniversal, tagInteger, sizeLimit),
+		newInteger(classUniversal, tagInteger, 0),
+		&packet{class: classUniversal, tag: tagBoolean, value: []byte{0}},
+		f,
+		attrList,
+	), opSearchDone)
+
+	return res[:len(res)-1], resultCode(c.t, res[len(res)-1])
+}
+
+func resultCode(t *testing.T, res *packet) int64 {
+	code, err := res.children[0].int()
+	require.NoError(t, err)
+	return code
+}
+
+func presentFilter(attr string) *packet {
+	return newString(classContext, filterPresent, attr)
+}
+
+func substringFilter(attr, any string) *packet {
+	return newConstructed(classContext, filterSubstrings,
+		newOctetString(attr),
+		newSequence(newString(classContext, substringAny, any)),
+	)
+}
+
+func entryAttrs(t *testing.T, e *packet) map[string][]string {
+	attrs := map[string][]string{}
+	for _, attr := range e.children[1].children {
+		name, err := attr.children[0].str()
+		require.NoError(t, err)
+		for _, value := range attr.children[1].children {
+			v, err := value.str()
+			require.NoError(t, err)
+			attrs[name] = append(attrs[name], v)
+		}
+	}
+	return attrs
+}
+
+var testContacts = []pmapi.ContactEmail{ //nolint[gochecknoglobals]
+	{Name: "Alice Smith", Email: "alice@example.com"},
+	{Name: "Bob", Email: "bob@example.com"},
+	{Name: "", Email: "carol@smith.org"},
+}
+
+func TestRootDSEAnonymous(t *testing.T) {
+	c, _, finish := newTestClient(t)
+	defer finish()
+
+	entries, code := c.search("", scopeBaseObject, 0, presentFilter("objectClass"))
+	require.Equal(t, int64(resultSuccess), code)
+	require.Len(t, entries, 1)
+	require.Equal(t, []string{BaseDN}, entryAttrs(t, entries[0])["namingContexts"])
+}
+
+func TestSearchRequiresBind(t *testing.T) {
+	c, _, finish := newTestClient(t)
+	defer finish()
+
+	require.Equal(t, int64(resultInvalidCredentials), c.bind("user@pm.me", "wrong"))
+
+	_, code := c.search(BaseDN, 2, 0, presentFilter("objectClass"))
+	require.Equal(t, int64(resultInsufficientAccessRights), code)
+}
+
+func TestSearchContacts(t *testing.T) {
+	c, client, finish := newTestClient(t)
+	defer finish()
+
+	// Contacts are loaded only once for repeated searches.
+	client.EXPECT().GetAllContactsEmails(gomock.Any(), 0, contactsPageSize).Return(testContacts, nil)
+
+	require.Equal(t, int64(resultSuccess), c.bind("uid=user@pm.me,"+BaseDN, "bridgepass"))
+
+	entries, code := c.search(BaseDN, 2, 0, newConstructed(classContext, filterOr,
+		substringFilter("cn", "SMITH"),
+		substringFilter("mail", "smith"),
+	), "cn", "mail")
+	require.Equal(t, int64(resultSuccess), code)
+	require.Len(t, entries, 2)
+	require.Equal(t, map[string][]string{
+		"cn":   {"Alice Smith"},
+		"mail": {"alice@example.com"},
+	}, entryAttrs(t, entries[0]))
+	require.Equal(t, "carol@smith.org", entryAttrs(t, entries[1])["cn"][0])
+
+	entries, code = c.search("", 2, 0, newConstructed(classContext, filterEqualityMatch,
+		newOctetString("mail"),
+		newOctetString("BOB@example.com"),
+	))
+	require.Equal(t, int64(resultSuccess), code)
+	require.Len(t, entries, 1)
+	require.Equal(t, []string{"Bob"}, entryAttrs(t, entries[0])["displayName"])
+
+	entries, code = c.search(BaseDN, scopeSingleLevel, 2, presentFilter("mail"))
+	require.Equal(t, int64(resultSizeLimitExceeded), code)
+	require.Len(t, entries, 2)
+
+	_, code = c.search("ou=other,dc=bridge", 2, 0, presentFilter("mail"))
+	require.Equal(t, int64(resultNoSuchObject), code)
+}
+
+func TestReadOnly(t *testing.T) {
+	c, _, finish := newTestClient(t)
+	defer finish()
+
+	res := c.send(&packet{class: classApplication, tag: opDelRequest, value: []byte("mail=bob@example.com," + BaseDN)}, opDelRequest+1)
+	require.Equal(t, int64(resultUnwillingToPerform), resultCode(t, res[0]))
+}
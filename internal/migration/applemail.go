@@ -0,0 +1,145 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package migration
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	emlxExtension        = ".emlx"
+	emlxPartialExtension = ".partial.emlx"
+	appleMailboxSuffix   = ".mbox"
+	appleMailDataFolder  = "MailData"
+)
+
+// discoverAppleMail returns accounts of all versions of Apple Mail stores.
+func discoverAppleMail(home string) (stores []Store) {
+	for _, version := range subfolders(filepath.Join(home, "Library", "Mail"), "V*") {
+		for _, account := range subfolders(version, "*") {
+			if filepath.Base(account) == appleMailDataFolder {
+				continue
+			}
+			stores = append(stores, Store{
+				Kind: AppleMail,
+				Name: filepath.Base(account),
+				Path: account,
+			})
+		}
+	}
+	return stores
+}
+
+// stageAppleMail converts EMLX files of Apple Mail account to EML files
+// in folders named after the mailboxes. Partially downloaded messages are
+// converted too, their attachments are missing.
+func stageAppleMail(root, dir string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), emlxExtension) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		folder := appleMailFolder(rel)
+		if folder == "" {
+			return nil
+		}
+
+		name := strings.TrimSuffix(strings.TrimSuffix(info.Name(), emlxPartialExtension), emlxExtension)
+		return convertEMLX(path, filepath.Join(dir, folder, name+".eml"))
+	})
+}
+
+// appleMailFolder returns the mailbox path of the EMLX file, e.g.
+// `INBOX/Work` for `INBOX.mbox/Work.mbox/<ID>/Data/Messages/1.emlx`.
+func appleMailFolder(rel string) string {
+	folders := []string{}
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if strings.HasSuffix(part, appleMailboxSuffix) {
+			folders = append(folders, strings.TrimSuffix(part, appleMailboxSuffix))
+		}
+	}
+	return filepath.Join(folders...)
+}
+
+func hasEMLXFiles(root string) bool {
+	errFound := errors.New("found")
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(info.Name(), emlxExtension) {
+			return errFound
+		}
+		return nil
+	})
+	return err == errFound
+}
+
+func convertEMLX(src, dst string) error {
+	f, err := os.Open(src) //nolint[gosec]
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint[errcheck]
+
+	body, err := readEMLX(f)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %v", src, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, body, 0600)
+}
+
+// readEMLX returns the message from EMLX file. The file starts with a line
+// with the length of the message followed by the message and a property
+// list with flags of the message.
+func readEMLX(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid message length %q", strings.TrimSpace(line))
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(br, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
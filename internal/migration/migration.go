@@ -0,0 +1,137 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package migration moves mail from local stores of other email clients
+// to the account. Stores are converted to EML and MBOX files which are then
+// uploaded by the importer.
+package migration
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("pkg", "migration") //nolint[gochecknoglobals]
+
+// Kind is the email client which created the local store.
+type Kind string
+
+// Supported email clients.
+const (
+	Thunderbird Kind = "Thunderbird"
+	AppleMail   Kind = "Apple Mail"
+	Outlook     Kind = "Outlook"
+)
+
+// Store is a local store of one account of an email client.
+type Store struct {
+	Kind Kind
+	Name string
+	Path string
+}
+
+func (s Store) String() string {
+	return fmt.Sprintf("%s %s (%s)", s.Kind, s.Name, s.Path)
+}
+
+// Discover returns local stores of Thunderbird, Apple Mail and Outlook
+// found in the usual locations in the home folder.
+func Discover(home string) (stores []Store) {
+	stores = append(stores, discoverThunderbird(home)...)
+	stores = append(stores, discoverAppleMail(home)...)
+	stores = append(stores, discoverOutlook(home)...)
+	return stores
+}
+
+// StoreFromPath returns the store at path which was not found by Discover.
+// A file with the .pst extension is an Outlook store, a folder with EMLX
+// files is an Apple Mail store and any other folder is a Thunderbird store.
+func StoreFromPath(path string) (Store, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Store{}, err
+	}
+
+	name := filepath.Base(path)
+	switch {
+	case !info.IsDir() && filepath.Ext(path) == pstExtension:
+		return Store{Kind: Outlook, Name: name, Path: path}, nil
+	case !info.IsDir():
+		return Store{}, fmt.Errorf("%s is neither a folder nor an Outlook data file", path)
+	case hasEMLXFiles(path):
+		return Store{Kind: AppleMail, Name: name, Path: path}, nil
+	default:
+		return Store{Kind: Thunderbird, Name: name, Path: path}, nil
+	}
+}
+
+// Stage converts the store to EML and MBOX files in dir. Each folder of
+// the store becomes an MBOX file or a folder with EML files with the same
+// name, so the folder mapping of the importer can be used.
+func Stage(store Store, dir string) error {
+	log.WithField("store", store).Info("Converting local store")
+
+	switch store.Kind {
+	case Thunderbird:
+		return stageThunderbird(store.Path, dir)
+	case AppleMail:
+		return stageAppleMail(store.Path, dir)
+	case Outlook:
+		return stageOutlook(store.Path, dir)
+	}
+	return fmt.Errorf("unknown store kind %q", store.Kind)
+}
+
+// subfolders returns sorted paths of folders in dir matching the pattern.
+func subfolders(dir, pattern string) (paths []string) {
+	matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			paths = append(paths, match)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src) //nolint[gosec]
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint[errcheck]
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
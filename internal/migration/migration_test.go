@@ -0,0 +1,162 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package migration
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/transfer"
+	r "github.com/stretchr/testify/require"
+)
+
+const testMBOX = "From sender@pm.test Thu Jan  1 00:00:00 2020\nSubject: hello\n\nHello\n"
+
+func newTestHome(t *testing.T) (home string, cleanup func()) {
+	home, err := ioutil.TempDir("", "migration")
+	r.NoError(t, err)
+
+	thunderbird := filepath.Join(home, ".thunderbird", "abc.default", "Mail", "Local Folders")
+	writeTestFile(t, filepath.Join(thunderbird, "Inbox"), testMBOX)
+	writeTestFile(t, filepath.Join(thunderbird, "Inbox.msf"), "index")
+	writeTestFile(t, filepath.Join(thunderbird, "Inbox.sbd", "Work"), testMBOX)
+	writeTestFile(t, filepath.Join(thunderbird, "Project.X"), testMBOX)
+	writeTestFile(t, filepath.Join(thunderbird, "Project.X.msf"), "index")
+	writeTestFile(t, filepath.Join(thunderbird, "msgFilterRules.dat"), "version=\"9\"")
+	writeTestFile(t, filepath.Join(thunderbird, "Trash"), "")
+
+	appleMail := filepath.Join(home, "Library", "Mail", "V8", "ACCOUNT-ID")
+	writeTestFile(t, filepath.Join(appleMail, "INBOX.mbox", "MAILBOX-ID", "Data", "Messages", "1.emlx"), testEMLX("Subject: first\n\nHello\n"))
+	writeTestFile(t, filepath.Join(appleMail, "INBOX.mbox", "Work.mbox", "MAILBOX-ID", "Data", "Messages", "2.partial.emlx"), testEMLX("Subject: second\n\nHello\n"))
+	writeTestFile(t, filepath.Join(home, "Library", "Mail", "V8", "MailData", "Envelope Index"), "")
+
+	writeTestFile(t, filepath.Join(home, "Documents", "Outlook Files", "Outlook.pst"), "pst")
+
+	return home, func() { _ = os.RemoveAll(home) }
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	r.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	r.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+}
+
+// testEMLX returns EMLX file with the message length padded by spaces
+// as written by Apple Mail.
+func testEMLX(msg string) string {
+	return fmt.Sprintf("%-10d\n", len(msg)) + msg +
+		`<?xml version="1.0" encoding="UTF-8"?><plist version="1.0"><dict><key>flags</key><integer>8590195713</integer></dict></plist>`
+}
+
+func stagedFiles(t *testing.T, dir string) (files []string) {
+	r.NoError(t, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		r.NoError(t, err)
+		if !info.IsDir() {
+			rel, err := filepath.Rel(dir, path)
+			r.NoError(t, err)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	}))
+	return files
+}
+
+func TestDiscover(t *testing.T) {
+	home, cleanup := newTestHome(t)
+	defer cleanup()
+
+	r.Equal(t, []Store{
+		{Kind: Thunderbird, Name: "abc.default/Local Folders", Path: filepath.Join(home, ".thunderbird", "abc.default", "Mail", "Local Folders")},
+		{Kind: AppleMail, Name: "ACCOUNT-ID", Path: filepath.Join(home, "Library", "Mail", "V8", "ACCOUNT-ID")},
+		{Kind: Outlook, Name: "Outlook.pst", Path: filepath.Join(home, "Documents", "Outlook Files", "Outlook.pst")},
+	}, Discover(home))
+}
+
+func TestStoreFromPath(t *testing.T) {
+	home, cleanup := newTestHome(t)
+	defer cleanup()
+
+	for _, discovered := range Discover(home) {
+		store, err := StoreFromPath(discovered.Path)
+		r.NoError(t, err)
+		r.Equal(t, discovered.Kind, store.Kind, discovered.Path)
+	}
+
+	_, err := StoreFromPath(filepath.Join(home, "Library", "Mail", "V8", "MailData", "Envelope Index"))
+	r.Error(t, err)
+}
+
+func TestStageThunderbird(t *testing.T) {
+	home, cleanup := newTestHome(t)
+	defer cleanup()
+
+	dir := filepath.Join(home, "staged")
+	r.NoError(t, Stage(Discover(home)[0], dir))
+	r.ElementsMatch(t, []string{"Inbox.mbox", "Inbox/Work.mbox", "Project.X.mbox"}, stagedFiles(t, dir))
+
+	mailboxes, err := transfer.NewLocalProvider(dir).Mailboxes(false, false)
+	r.NoError(t, err)
+	names := []string{}
+	for _, mailbox := range mailboxes {
+		names = append(names, mailbox.Name)
+	}
+	r.ElementsMatch(t, []string{"Inbox", "Work", "Project.X"}, names)
+}
+
+func TestStageAppleMail(t *testing.T) {
+	home, cleanup := newTestHome(t)
+	defer cleanup()
+
+	dir := filepath.Join(home, "staged")
+	r.NoError(t, Stage(Discover(home)[1], dir))
+	r.Equal(t, []string{"INBOX/1.eml", "INBOX/Work/2.eml"}, stagedFiles(t, dir))
+
+	body, err := ioutil.ReadFile(filepath.Join(dir, "INBOX", "1.eml"))
+	r.NoError(t, err)
+	r.Equal(t, "Subject: first\n\nHello\n", string(body))
+}
+
+func TestStageOutlook(t *testing.T) {
+	home, cleanup := newTestHome(t)
+	defer cleanup()
+
+	defer func(old func(string, string) error) { readPST = old }(readPST)
+	readPST = func(path, dir string) error {
+		r.Equal(t, filepath.Join(home, "Documents", "Outlook Files", "Outlook.pst"), path)
+		writeTestFile(t, filepath.Join(dir, "Outlook", "Inbox", "1.eml"), "Subject: hello\n\nHello\n")
+		return nil
+	}
+
+	dir := filepath.Join(home, "staged")
+	r.NoError(t, Stage(Discover(home)[2], dir))
+	r.Equal(t, []string{"Outlook/Inbox/1.eml"}, stagedFiles(t, dir))
+}
+
+func TestReadEMLX(t *testing.T) {
+	body, err := readEMLX(strings.NewReader(testEMLX("Subject: hello\r\n\r\nHello\r\n")))
+	r.NoError(t, err)
+	r.Equal(t, "Subject: hello\r\n\r\nHello\r\n", string(body))
+
+	for _, emlx := range []string{"", "abc\nSubject: hello\n", "100\nSubject: hello\n"} {
+		_, err := readEMLX(strings.NewReader(emlx))
+		r.Error(t, err, emlx)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package migration
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+const pstExtension = ".pst"
+
+// ErrNoPSTReader is returned when Outlook data file cannot be converted
+// because readpst from libpst is not installed.
+var ErrNoPSTReader = errors.New("readpst from libpst is needed to migrate Outlook data files") //nolint[gochecknoglobals]
+
+// readPST converts the Outlook data file to folders with EML files in dir.
+// It is a variable so tests do not need libpst installed.
+var readPST = func(path, dir string) error { //nolint[gochecknoglobals]
+	readpst, err := exec.LookPath("readpst")
+	if err != nil {
+		return ErrNoPSTReader
+	}
+
+	// -e writes every message to a separate EML file and -r keeps
+	// the folder structure of the data file.
+	out, err := exec.Command(readpst, "-q", "-e", "-r", "-o", dir, path).CombinedOutput() //nolint[gosec]
+	if err != nil {
+		log.WithError(err).WithField("output", string(out)).Error("Cannot convert Outlook data file")
+		return err
+	}
+	return nil
+}
+
+// discoverOutlook returns Outlook data files in default locations
+// of Outlook on Windows.
+func discoverOutlook(home string) (stores []Store) {
+	patterns := []string{
+		filepath.Join(home, "Documents", "Outlook Files", "*"+pstExtension),
+		filepath.Join(home, "AppData", "Local", "Microsoft", "Outlook", "*"+pstExtension),
+	}
+
+	for _, pattern := range patterns {
+		paths, _ := filepath.Glob(pattern)
+		sort.Strings(paths)
+		for _, path := range paths {
+			stores = append(stores, Store{
+				Kind: Outlook,
+				Name: filepath.Base(path),
+				Path: path,
+			})
+		}
+	}
+	return stores
+}
+
+func stageOutlook(path, dir string) error {
+	return readPST(path, dir)
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package migration
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// thunderbirdSubfolderSuffix is the suffix of folders with subfolders
+	// of the MBOX file with the same name.
+	thunderbirdSubfolderSuffix = ".sbd"
+
+	// thunderbirdIndexExtension is the extension of the index of MBOX file.
+	thunderbirdIndexExtension = ".msf"
+)
+
+// discoverThunderbird returns local folders and IMAP accounts of all
+// Thunderbird profiles on Linux, macOS and Windows.
+func discoverThunderbird(home string) (stores []Store) {
+	profileRoots := []string{
+		filepath.Join(home, ".thunderbird"),
+		filepath.Join(home, "Library", "Thunderbird", "Profiles"),
+		filepath.Join(home, "AppData", "Roaming", "Thunderbird", "Profiles"),
+	}
+
+	for _, profileRoot := range profileRoots {
+		for _, profile := range subfolders(profileRoot, "*") {
+			for _, mailDir := range []string{"Mail", "ImapMail"} {
+				for _, account := range subfolders(filepath.Join(profile, mailDir), "*") {
+					stores = append(stores, Store{
+						Kind: Thunderbird,
+						Name: filepath.Base(profile) + "/" + filepath.Base(account),
+						Path: account,
+					})
+				}
+			}
+		}
+	}
+
+	return stores
+}
+
+// stageThunderbird copies MBOX files of Thunderbird account to dir.
+// Subfolders are kept in folders with the name of the parent MBOX.
+func stageThunderbird(root, dir string) error {
+	files, err := ioutil.ReadDir(root)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		path := filepath.Join(root, file.Name())
+
+		if file.IsDir() {
+			if !strings.HasSuffix(file.Name(), thunderbirdSubfolderSuffix) {
+				continue
+			}
+			subdir := filepath.Join(dir, strings.TrimSuffix(file.Name(), thunderbirdSubfolderSuffix))
+			if err := stageThunderbird(path, subdir); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !isThunderbirdMBOX(path) {
+			continue
+		}
+
+		log.WithField("folder", file.Name()).Debug("Copying Thunderbird folder")
+		if err := copyFile(path, filepath.Join(dir, file.Name()+".mbox")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isThunderbirdMBOX returns whether the file is a folder of Thunderbird.
+// Thunderbird stores folders in MBOX files without extension, but names
+// of folders can contain dots, so the index file is checked too.
+func isThunderbirdMBOX(path string) bool {
+	if filepath.Ext(path) != "" {
+		if _, err := os.Stat(path + thunderbirdIndexExtension); err != nil {
+			return false
+		}
+	}
+
+	f, err := os.Open(path) //nolint[gosec]
+	if err != nil {
+		return false
+	}
+	defer f.Close() //nolint[errcheck]
+
+	prefix := make([]byte, 5)
+	if _, err := io.ReadFull(f, prefix); err != nil {
+		return false
+	}
+	return bytes.Equal(prefix, []byte("From "))
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package notifications
+
+import (
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/users"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+type preferenceProvider interface {
+	GetBool(key string) bool
+}
+
+type bridger interface {
+	GetUser(query string) (bridgeUser, error)
+}
+
+type bridgeUser interface {
+	GetStore() storeUserProvider
+}
+
+type storeUserProvider interface {
+	GetMessageToNotify(apiID string, now time.Time) (*pmapi.Message, bool)
+}
+
+type bridgeWrap struct {
+	*bridge.Bridge
+}
+
+// newBridgeWrap wraps bridge struct into local bridgeWrap to implement local
+// interface. Bridge returns the users package's User type, so GetUser has to be
+// overridden to fulfill the interface.
+func newBridgeWrap(bridge *bridge.Bridge) *bridgeWrap {
+	return &bridgeWrap{Bridge: bridge}
+}
+
+func (b *bridgeWrap) GetUser(query string) (bridgeUser, error) {
+	user, err := b.Bridge.GetUser(query)
+	if err != nil {
+		return nil, err
+	}
+	return &bridgeUserWrap{User: user}, nil
+}
+
+type bridgeUserWrap struct {
+	*users.User
+}
+
+func (u *bridgeUserWrap) GetStore() storeUserProvider {
+	// Nil store has to be returned as nil interface.
+	if store := u.User.GetStore(); store != nil {
+		return store
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package notifications shows new messages of accounts as notifications of
+// the desktop, so users without any other mail notifier know about them.
+package notifications
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/0xAX/notificator"
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("pkg", "notifications") //nolint[gochecknoglobals]
+
+// maxTextLength is the maximum number of characters of the shown sender
+// and subject; longer ones are shortened.
+const maxTextLength = 100
+
+type pusher interface {
+	Push(title, text, iconPath, urgency string) error
+}
+
+// Notifier shows messages received to selected folders of each account
+// as notifications of the desktop. Which messages are notified and when
+// is decided by notification rules of the account.
+type Notifier struct {
+	pref     preferenceProvider
+	listener listener.Listener
+	bridge   bridger
+	pusher   pusher
+	now      func() time.Time
+
+	done chan struct{}
+}
+
+// New returns notifier of new messages of bridge users.
+func New(pref preferenceProvider, eventListener listener.Listener, bridge *bridge.Bridge, appName string) *Notifier {
+	return newNotifier(pref, eventListener, newBridgeWrap(bridge), notificator.New(notificator.Options{AppName: appName}))
+}
+
+func newNotifier(pref preferenceProvider, eventListener listener.Listener, bridge bridger, pusher pusher) *Notifier {
+	return &Notifier{
+		pref:     pref,
+		listener: eventListener,
+		bridge:   bridge,
+		pusher:   pusher,
+		now:      time.Now,
+		done:     make(chan struct{}),
+	}
+}
+
+// Watch notifies new messages until the notifier is stopped. Notifications
+// can be turned on and off while watching.
+func (n *Notifier) Watch() {
+	newMessageCh := make(chan string)
+	n.listener.Add(events.NewMessageEvent, newMessageCh)
+	defer n.listener.Remove(events.NewMessageEvent, newMessageCh)
+
+	for {
+		select {
+		case data := <-newMessageCh:
+			n.notify(data)
+		case <-n.done:
+			return
+		}
+	}
+}
+
+// Stop stops watching new messages.
+func (n *Notifier) Stop() {
+	close(n.done)
+}
+
+// notify shows the new message from the event data "userID:messageID"
+// when notifications are on and the rules of the account allow it.
+func (n *Notifier) notify(data string) {
+	if !n.pref.GetBool(preferences.NotificationsEnabledKey) {
+		return
+	}
+
+	parts := strings.SplitN(data, ":", 2)
+	if len(parts) != 2 {
+		log.WithField("data", data).Warn("Unexpected new message event")
+		return
+	}
+
+	user, err := n.bridge.GetUser(parts[0])
+	if err != nil {
+		log.WithError(err).Debug("Cannot notify message of unknown user")
+		return
+	}
+	store := user.GetStore()
+	if store == nil {
+		return
+	}
+
+	msg, ok := store.GetMessageToNotify(parts[1], n.now())
+	if !ok {
+		return
+	}
+
+	title, text := formatNotification(msg)
+	if err := n.pusher.Push(title, text, "", notificator.UR_NORMAL); err != nil {
+		log.WithError(err).Warn("Cannot show notification of new message")
+	}
+}
+
+// formatNotification returns title with the sender and text with the
+// subject of the message.
+func formatNotification(msg *pmapi.Message) (title, text string) {
+	sender := ""
+	if msg.Sender != nil {
+		sender = msg.Sender.Name
+		if sender == "" {
+			sender = msg.Sender.Address
+		}
+	}
+	if sender = sanitizeText(sender); sender == "" {
+		sender = "unknown sender"
+	}
+
+	text = sanitizeText(msg.Subject)
+	if text == "" {
+		text = "(No subject)"
+	}
+	return "New message from " + sender, text
+}
+
+// sanitizeText makes the text safe to pass to notification tools: control
+// characters are replaced by spaces, backslashes and leading dashes are
+// removed so the text is not taken as an escape or an option, and it is
+// shortened to maxTextLength characters.
+func sanitizeText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\\':
+			return -1
+		case unicode.IsControl(r):
+			return ' '
+		}
+		return r
+	}, strings.ToValidUTF8(text, ""))
+
+	text = strings.TrimLeft(strings.Join(strings.Fields(text), " "), "- ")
+
+	if runes := []rune(text); len(runes) > maxTextLength {
+		text = string(runes[:maxTextLength-1]) + "…"
+	}
+	return text
+}
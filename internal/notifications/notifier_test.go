@@ -0,0 +1,111 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package notifications
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePreferences map[string]bool
+
+func (p fakePreferences) GetBool(key string) bool { return p[key] }
+
+type fakeBridge map[string]*fakeUser
+
+func (b fakeBridge) GetUser(query string) (bridgeUser, error) {
+	if user, ok := b[query]; ok {
+		return user, nil
+	}
+	return nil, errors.New("no such user")
+}
+
+type fakeUser struct {
+	messages map[string]*pmapi.Message
+	quiet    bool
+}
+
+func (u *fakeUser) GetStore() storeUserProvider { return u }
+
+func (u *fakeUser) GetMessageToNotify(apiID string, now time.Time) (*pmapi.Message, bool) {
+	msg, ok := u.messages[apiID]
+	return msg, ok && !u.quiet
+}
+
+type fakePusher struct {
+	titles, texts []string
+}
+
+func (p *fakePusher) Push(title, text, iconPath, urgency string) error {
+	p.titles = append(p.titles, title)
+	p.texts = append(p.texts, text)
+	return nil
+}
+
+func TestNotifierNotify(t *testing.T) {
+	pref := fakePreferences{preferences.NotificationsEnabledKey: true}
+	user := &fakeUser{messages: map[string]*pmapi.Message{
+		"msg": {ID: "msg", Subject: "Hello", Sender: &mail.Address{Name: "Alice", Address: "alice@example.com"}},
+	}}
+	pusher := &fakePusher{}
+	notifier := newNotifier(pref, listener.New(), fakeBridge{"user": user}, pusher)
+
+	notifier.notify("user:msg")
+	require.Equal(t, []string{"New message from Alice"}, pusher.titles)
+	require.Equal(t, []string{"Hello"}, pusher.texts)
+
+	// Messages which are not allowed by rules, of unknown users or
+	// with invalid data are not notified.
+	notifier.notify("user:other")
+	notifier.notify("unknown:msg")
+	notifier.notify("user")
+	user.quiet = true
+	notifier.notify("user:msg")
+	require.Len(t, pusher.titles, 1)
+
+	// Nothing is notified when notifications are turned off.
+	user.quiet = false
+	pref[preferences.NotificationsEnabledKey] = false
+	notifier.notify("user:msg")
+	require.Len(t, pusher.titles, 1)
+}
+
+func TestFormatNotification(t *testing.T) {
+	title, text := formatNotification(&pmapi.Message{Sender: &mail.Address{Address: "alice@example.com"}})
+	require.Equal(t, "New message from alice@example.com", title)
+	require.Equal(t, "(No subject)", text)
+
+	title, text = formatNotification(&pmapi.Message{Subject: "-u \\\"critical\\\"\r\nnext line"})
+	require.Equal(t, "New message from unknown sender", title)
+	require.Equal(t, `u "critical" next line`, text)
+}
+
+func TestSanitizeTextShortensLongText(t *testing.T) {
+	text := sanitizeText(strings.Repeat("ž", 2*maxTextLength))
+	require.Equal(t, maxTextLength, utf8.RuneCountInString(text))
+	require.True(t, strings.HasSuffix(text, "…"))
+}
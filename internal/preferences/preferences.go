@@ -20,33 +20,142 @@ package preferences
 
 import (
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ProtonMail/proton-bridge/internal/imap/fetch"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/internal/store/archive"
+	"github.com/ProtonMail/proton-bridge/internal/store/scanner"
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/authpolicy"
 	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/connlimit"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/sirupsen/logrus"
 )
 
 // Keys of preferences in JSON file.
 const (
-	FirstStartKey          = "first_time_start"
-	FirstStartGUIKey       = "first_time_start_gui"
-	NextHeartbeatKey       = "next_heartbeat"
-	APIPortKey             = "user_port_api"
-	IMAPPortKey            = "user_port_imap"
-	SMTPPortKey            = "user_port_smtp"
-	SMTPSSLKey             = "user_ssl_smtp"
-	AllowProxyKey          = "allow_proxy"
-	AutostartKey           = "autostart"
-	CookiesKey             = "cookies"
-	ReportOutgoingNoEncKey = "report_outgoing_email_without_encryption"
-	LastVersionKey         = "last_used_version"
+	FirstStartKey            = "first_time_start"
+	FirstStartGUIKey         = "first_time_start_gui"
+	NextHeartbeatKey         = "next_heartbeat"
+	APIPortKey               = "user_port_api"
+	IMAPPortKey              = "user_port_imap"
+	SMTPPortKey              = "user_port_smtp"
+	SMTPSSLKey               = "user_ssl_smtp"
+	CalDAVPortKey            = "user_port_caldav"
+	CalDAVEnabledKey         = "user_enable_caldav"
+	LDAPPortKey              = "user_port_ldap"
+	LDAPEnabledKey           = "user_enable_ldap"
+	EventSocketEnabledKey    = "user_enable_event_socket"
+	GRPCEnabledKey           = "user_enable_grpc"
+	AllowProxyKey            = "allow_proxy"
+	AutostartKey             = "autostart"
+	CookiesKey               = "cookies"
+	ReportOutgoingNoEncKey   = "report_outgoing_email_without_encryption"
+	LastVersionKey           = "last_used_version"
+	HeaderMaxFieldsKey       = "header_max_fields"
+	HeaderMaxFieldSizeKey    = "header_max_field_size"
+	HeaderMaxTotalSizeKey    = "header_max_total_size"
+	MessageCacheSizeKey      = "message_cache_size"
+	FetchDownloadWorkersKey  = "imap_fetch_download_workers"
+	FetchBuildWorkersKey     = "imap_fetch_build_workers"
+	FetchWindowKey           = "imap_fetch_window"
+	HideSelfSentKey          = "hide_self_sent_duplicates"
+	LocalArchiveDirKey       = "local_archive_dir"
+	LocalArchiveFormatKey    = "local_archive_format"
+	LocalArchiveMailboxesKey = "local_archive_mailboxes"
+	AccountPortsKey          = "user_account_ports"
+	AccountPortsMapKey       = "user_account_ports_map"
+	MessageLocaleKey         = "message_locale"
+	SyncMaxBytesKey          = "sync_max_bytes_per_second"
+	SyncMaxRequestsKey       = "sync_max_requests_per_second"
+	SyncWindowKey            = "sync_window"
+	DeletedRetentionKey      = "deleted_retention_days"
+	AuthRequireTLSKey        = "auth_require_tls"
+	AuthMechanismsKey        = "auth_mechanisms"
+	AttPlaceholderSizeKey    = "attachment_placeholder_size"
+	MessageSizeLimitKey      = "imap_message_size_limit"
+	KeychainFileKey          = "keychain_file"
+	DeferredExpungeKey       = "imap_deferred_expunge"
+	UpstreamProxyKey         = "upstream_proxy"
+	DoHProvidersKey          = "doh_providers"
+	APIHostKey               = "api_host"
+	FetchQuotaKey            = "imap_quota_fetch_mb_per_hour"
+	AppendQuotaKey           = "imap_quota_appends_per_day"
+	SMTPImplicitTLSPortKey   = "user_port_smtp_implicit_tls"
+	ScheduleByDateKey        = "smtp_schedule_by_future_date"
+	RequestReadReceiptKey    = "smtp_request_read_receipt"
+	SenderPolicyKey          = "smtp_sender_policy"
+	SendPoliciesKey          = "smtp_send_policies"
+	SMIMEDirKey              = "smtp_smime_certificates_dir"
+	LogLevelsKey             = "log_levels"
+	LogAnonymizeKey          = "log_anonymize"
+	IMAPTraceKey             = "log_imap_trace"
+	RetentionPoliciesKey     = "retention_policies"
+	RetentionArchiveDirKey   = "retention_archive_dir"
+	AttachmentScannerKey     = "attachment_scanner"
+	AttachmentQuarantineKey  = "attachment_quarantine"
+	BindAddressKey           = "bind_address"
+	RemoteAllowedHostsKey    = "remote_allowed_hosts"
+	CacheBackendKey          = "cache_backend"
+	CacheDirKey              = "cache_dir"
+	StartupConcurrencyKey    = "startup_concurrency"
+	EventPollActiveKey       = "event_poll_active_seconds"
+	EventPollBackgroundKey   = "event_poll_background_seconds"
+	StorageBackendKey        = "storage_backend"
+	DBCompactionKey          = "db_compaction"
+	BodyEncodingKey          = "body_encoding"
+	UpdateChannelKey         = "update_channel"
+	MaxConnectionsKey        = "max_connections_per_account"
+	IdleTimeoutKey           = "connection_idle_timeout_minutes"
+	DecryptionPlaceholderKey = "imap_decryption_placeholder"
+	AttachPublicKeyKey       = "smtp_attach_public_key"
+	AutocryptKey             = "smtp_autocrypt"
+	AutocryptImportKey       = "autocrypt_import"
+	AppleMailCompatKey       = "imap_apple_mail_compat"
+	PhishingCheckKey         = "phishing_check"
+	PhishingDomainsKey       = "phishing_protected_domains"
+	MessageIDPolicyKey       = "smtp_message_id_policy"
+	NotificationsEnabledKey  = "user_enable_notifications"
 )
 
+// SyncedKeys are preferences shared between computers of the user by settings
+// sync. Ports, paths and anything related to credentials or the local
+// machine are never synced.
+var SyncedKeys = []string{ //nolint[gochecknoglobals]
+	ReportOutgoingNoEncKey,
+	HideSelfSentKey,
+	MessageLocaleKey,
+	DeletedRetentionKey,
+	RetentionPoliciesKey,
+	AttPlaceholderSizeKey,
+	MessageSizeLimitKey,
+	DeferredExpungeKey,
+	ScheduleByDateKey,
+	RequestReadReceiptKey,
+	SenderPolicyKey,
+	SendPoliciesKey,
+	SyncMaxBytesKey,
+	SyncMaxRequestsKey,
+	SyncWindowKey,
+	AttachPublicKeyKey,
+	AutocryptKey,
+	AutocryptImportKey,
+	MessageIDPolicyKey,
+}
+
+// defaultMessageCacheSize is the size limit of on-disk message cache in bytes.
+const defaultMessageCacheSize = 1024 * 1024 * 1024
+
 type configProvider interface {
 	GetPreferencesPath() string
 	GetDefaultAPIPort() int
 	GetDefaultIMAPPort() int
 	GetDefaultSMTPPort() int
+	GetDefaultCalDAVPort() int
+	GetDefaultLDAPPort() int
 }
 
 var log = logrus.WithField("pkg", "store") //nolint[gochecknoglobals]
@@ -69,11 +178,289 @@ func setDefaults(preferences *config.Preferences, cfg configProvider) {
 	preferences.SetDefault(APIPortKey, strconv.Itoa(cfg.GetDefaultAPIPort()))
 	preferences.SetDefault(IMAPPortKey, strconv.Itoa(cfg.GetDefaultIMAPPort()))
 	preferences.SetDefault(SMTPPortKey, strconv.Itoa(cfg.GetDefaultSMTPPort()))
+	preferences.SetDefault(CalDAVPortKey, strconv.Itoa(cfg.GetDefaultCalDAVPort()))
+	preferences.SetDefault(LDAPPortKey, strconv.Itoa(cfg.GetDefaultLDAPPort()))
 	preferences.SetDefault(AllowProxyKey, "true")
 	preferences.SetDefault(AutostartKey, "true")
 	preferences.SetDefault(ReportOutgoingNoEncKey, "false")
 	preferences.SetDefault(LastVersionKey, "")
+	preferences.SetDefault(HeaderMaxFieldsKey, strconv.Itoa(message.DefaultHeaderLimits.MaxFields))
+	preferences.SetDefault(HeaderMaxFieldSizeKey, strconv.Itoa(message.DefaultHeaderLimits.MaxFieldSize))
+	preferences.SetDefault(HeaderMaxTotalSizeKey, strconv.Itoa(message.DefaultHeaderLimits.MaxTotalSize))
+	preferences.SetDefault(MessageCacheSizeKey, strconv.Itoa(defaultMessageCacheSize))
+	preferences.SetDefault(FetchDownloadWorkersKey, strconv.Itoa(fetch.DefaultOptions.DownloadWorkers))
+	preferences.SetDefault(FetchBuildWorkersKey, strconv.Itoa(fetch.DefaultOptions.BuildWorkers))
+	preferences.SetDefault(FetchWindowKey, strconv.Itoa(fetch.DefaultOptions.Window))
 
 	// By default, stick to STARTTLS. If the user uses catalina+applemail they'll have to change to SSL.
 	preferences.SetDefault(SMTPSSLKey, "false")
+
+	// Calendars are experimental and read-only; the server has to be enabled explicitly.
+	preferences.SetDefault(CalDAVEnabledKey, "false")
+	preferences.SetDefault(HideSelfSentKey, "false")
+
+	// Contacts are served to address books only when the LDAP server is enabled.
+	preferences.SetDefault(LDAPEnabledKey, "false")
+
+	// Events are published to local tools only when the socket is enabled.
+	preferences.SetDefault(EventSocketEnabledKey, "false")
+
+	// Frontends other than the built-in one connect to the gRPC socket only when it is enabled.
+	preferences.SetDefault(GRPCEnabledKey, "false")
+
+	// Archive keeps decrypted messages on disk, so the user has to choose the folder.
+	preferences.SetDefault(LocalArchiveDirKey, "")
+	preferences.SetDefault(LocalArchiveFormatKey, archive.FormatMaildir)
+	preferences.SetDefault(LocalArchiveMailboxesKey, "INBOX")
+
+	// Ports assigned to accounts are stored as JSON map of user ID to ports.
+	preferences.SetDefault(AccountPortsKey, "false")
+	preferences.SetDefault(AccountPortsMapKey, "")
+
+	// Empty locale means the locale of the system.
+	preferences.SetDefault(MessageLocaleKey, "")
+
+	// Sync is not throttled by default. Window is in format HH:MM-HH:MM.
+	preferences.SetDefault(SyncMaxBytesKey, "0")
+	preferences.SetDefault(SyncMaxRequestsKey, "0")
+	preferences.SetDefault(SyncWindowKey, "")
+
+	// Messages deleted via bridge can be restored for a week.
+	preferences.SetDefault(DeletedRetentionKey, "7")
+
+	// Clients can log in by any mechanism even without STARTTLS.
+	preferences.SetDefault(AuthRequireTLSKey, "false")
+	preferences.SetDefault(AuthMechanismsKey, strings.Join(authpolicy.Mechanisms, ","))
+
+	// Attachments are downloaded with the whole message unless a size is set.
+	preferences.SetDefault(AttPlaceholderSizeKey, "0")
+
+	// Messages of any size are served whole unless a limit is set.
+	preferences.SetDefault(MessageSizeLimitKey, "0")
+
+	// Encrypted file is used only when no native keychain is available.
+	preferences.SetDefault(KeychainFileKey, "false")
+
+	// Messages flagged as \Deleted are deleted right away, not on EXPUNGE.
+	preferences.SetDefault(DeferredExpungeKey, "false")
+
+	// Proxy is taken from environment unless set.
+	preferences.SetDefault(UpstreamProxyKey, "")
+
+	// Alternative routing queries default resolvers and API host is not pinned.
+	preferences.SetDefault(DoHProvidersKey, "")
+	preferences.SetDefault(APIHostKey, "")
+
+	// IMAP sessions are not limited unless quotas are set.
+	preferences.SetDefault(FetchQuotaKey, "0")
+	preferences.SetDefault(AppendQuotaKey, "0")
+
+	// SMTP with implicit TLS (port 465 style) is served only if a port is set.
+	preferences.SetDefault(SMTPImplicitTLSPortKey, "0")
+
+	// Only X-Pm-Scheduled-Time header schedules messages; Date in the future is sent right away.
+	preferences.SetDefault(ScheduleByDateKey, "false")
+
+	// Read receipts are requested only when the client adds the header itself.
+	preferences.SetDefault(RequestReadReceiptKey, "false")
+
+	// Messages are sent from the MAIL FROM address and the From header is rewritten to it.
+	preferences.SetDefault(SenderPolicyKey, "rewrite")
+	preferences.SetDefault(SendPoliciesKey, "")
+
+	// Message-ID of sent messages without one is generated in the sender
+	// domain only for custom domains; API generates it for Proton domains.
+	preferences.SetDefault(MessageIDPolicyKey, "custom-domain")
+
+	// Messages are not signed by S/MIME unless a folder with certificates is set.
+	preferences.SetDefault(SMIMEDirKey, "")
+
+	// All subsystems log with the level given by the --log-level flag.
+	preferences.SetDefault(LogLevelsKey, "")
+
+	// Logs contain email addresses, subjects and IDs unless anonymized.
+	preferences.SetDefault(LogAnonymizeKey, "false")
+
+	// IMAP commands are not traced; tracing logs timing of every command.
+	preferences.SetDefault(IMAPTraceKey, "false")
+
+	// No retention policies; messages are never removed automatically.
+	preferences.SetDefault(RetentionPoliciesKey, "")
+	preferences.SetDefault(RetentionArchiveDirKey, "")
+
+	// Attachments are not scanned.
+	preferences.SetDefault(AttachmentScannerKey, "")
+	preferences.SetDefault(AttachmentQuarantineKey, "")
+
+	// IMAP and SMTP listen only on loopback; remote hosts cannot connect.
+	preferences.SetDefault(BindAddressKey, "")
+	preferences.SetDefault(RemoteAllowedHostsKey, "")
+
+	// Message and attachment caches are stored on local disk next to other cache files.
+	preferences.SetDefault(CacheBackendKey, store.LocalCacheBackend)
+	preferences.SetDefault(CacheDirKey, "")
+
+	// Accounts are loaded in background at startup, four at once.
+	preferences.SetDefault(StartupConcurrencyKey, "4")
+
+	// Events are polled every 30 seconds while clients are active, every five minutes otherwise.
+	preferences.SetDefault(EventPollActiveKey, "30")
+	preferences.SetDefault(EventPollBackgroundKey, "300")
+
+	// Store databases use Bolt.
+	preferences.SetDefault(StorageBackendKey, storage.BoltBackend)
+
+	// Store databases are compacted while accounts are idle.
+	preferences.SetDefault(DBCompactionKey, "true")
+
+	// Text bodies of messages are encoded as quoted-printable.
+	preferences.SetDefault(BodyEncodingKey, string(message.QuotedPrintable))
+
+	// Updates are checked in the default channel of the build.
+	preferences.SetDefault(UpdateChannelKey, "")
+
+	// Accounts can have up to 50 IMAP and 50 SMTP sessions; idle connections
+	// are closed only by the IMAP auto-logout after 30 minutes.
+	preferences.SetDefault(MaxConnectionsKey, "50")
+	preferences.SetDefault(IdleTimeoutKey, "0")
+
+	// Messages which cannot be decrypted are shown with the encrypted body attached.
+	preferences.SetDefault(DecryptionPlaceholderKey, string(message.PlaceholderAttachment))
+
+	// Public key is sent to recipients outside of Proton only when the mail
+	// setting asks for it; keys of senders are never added to contacts.
+	preferences.SetDefault(AttachPublicKeyKey, "false")
+	preferences.SetDefault(AutocryptKey, "false")
+	preferences.SetDefault(AutocryptImportKey, "false")
+
+	// Quirks expected by Apple Mail are enabled for connections identified as Apple Mail.
+	preferences.SetDefault(AppleMailCompatKey, "auto")
+
+	// Links are checked only when asked for; the user can protect more domains than the default ones.
+	preferences.SetDefault(PhishingCheckKey, "false")
+	preferences.SetDefault(PhishingDomainsKey, "")
+
+	// New messages are notified by the desktop as set by rules of each account.
+	preferences.SetDefault(NotificationsEnabledKey, "true")
+}
+
+// GetSyncThrottleOptions returns sync limits from preferences. Invalid
+// window is ignored.
+func GetSyncThrottleOptions(preferences *config.Preferences) store.SyncThrottleOptions {
+	requests, _ := strconv.ParseFloat(preferences.Get(SyncMaxRequestsKey), 64)
+
+	start, end, err := store.ParseSyncWindow(preferences.Get(SyncWindowKey))
+	if err != nil {
+		log.WithError(err).Warn("Invalid sync window, syncing at any time")
+	}
+
+	return store.SyncThrottleOptions{
+		BytesPerSecond:    preferences.GetInt(SyncMaxBytesKey),
+		RequestsPerSecond: requests,
+		WindowStart:       start,
+		WindowEnd:         end,
+	}
+}
+
+// GetDeletedRetention returns how long messages deleted via bridge can be
+// restored.
+func GetDeletedRetention(preferences *config.Preferences) time.Duration {
+	return time.Duration(preferences.GetInt(DeletedRetentionKey)) * 24 * time.Hour
+}
+
+// GetRetentionOptions returns retention policies from preferences. Invalid
+// policies are ignored so no message is removed by mistake.
+func GetRetentionOptions(preferences *config.Preferences) store.RetentionOptions {
+	policies, err := store.ParseRetentionPolicies(preferences.Get(RetentionPoliciesKey))
+	if err != nil {
+		log.WithError(err).Warn("Invalid retention policies, none applied")
+		policies = nil
+	}
+
+	return store.RetentionOptions{
+		Policies:   policies,
+		ArchiveDir: preferences.Get(RetentionArchiveDirKey),
+	}
+}
+
+// GetScanOptions returns the scanner of attachments from preferences.
+// Invalid scanner is ignored and attachments are not scanned.
+func GetScanOptions(preferences *config.Preferences) store.ScanOptions {
+	target := preferences.Get(AttachmentScannerKey)
+	if target == "" {
+		return store.ScanOptions{}
+	}
+
+	s, err := scanner.New(target)
+	if err != nil {
+		log.WithError(err).Warn("Invalid attachment scanner, attachments are not scanned")
+		return store.ScanOptions{}
+	}
+
+	return store.ScanOptions{
+		Scanner:    s,
+		Quarantine: preferences.Get(AttachmentQuarantineKey),
+	}
+}
+
+// GetPhishingOptions returns the checker of links of received messages from
+// preferences.
+func GetPhishingOptions(preferences *config.Preferences) store.PhishingOptions {
+	if !preferences.GetBool(PhishingCheckKey) {
+		return store.PhishingOptions{}
+	}
+
+	return store.PhishingOptions{Checker: message.NewLinkChecker(SplitList(preferences.Get(PhishingDomainsKey)))}
+}
+
+// GetPollOptions returns intervals of event polling from preferences.
+// Background interval of zero polls always with the active interval.
+func GetPollOptions(preferences *config.Preferences) store.PollOptions {
+	return store.PollOptions{
+		Active:         time.Duration(preferences.GetInt(EventPollActiveKey)) * time.Second,
+		Background:     time.Duration(preferences.GetInt(EventPollBackgroundKey)) * time.Second,
+		ActivityWindow: store.DefaultActivityWindow,
+	}
+}
+
+// GetCompactionOptions returns when store databases are compacted in
+// background from preferences.
+func GetCompactionOptions(preferences *config.Preferences) store.CompactionOptions {
+	options := store.DefaultCompactionOptions()
+	options.Enabled = preferences.GetBool(DBCompactionKey)
+	return options
+}
+
+// GetAuthPolicy returns the policy of client authentication. Invalid list
+// of mechanisms is ignored so clients are not locked out.
+func GetAuthPolicy(preferences *config.Preferences) authpolicy.Policy {
+	mechanisms, err := authpolicy.ParseMechanisms(preferences.Get(AuthMechanismsKey))
+	if err != nil {
+		log.WithError(err).Warn("Invalid authentication mechanisms, allowing all")
+		mechanisms = nil
+	}
+
+	return authpolicy.Policy{
+		RequireTLS: preferences.GetBool(AuthRequireTLSKey),
+		Mechanisms: mechanisms,
+	}
+}
+
+// GetConnectionLimits returns limits of IMAP and SMTP connections from
+// preferences.
+func GetConnectionLimits(preferences *config.Preferences) connlimit.Limits {
+	return connlimit.Limits{
+		MaxPerAccount: preferences.GetInt(MaxConnectionsKey),
+		IdleTimeout:   time.Duration(preferences.GetInt(IdleTimeoutKey)) * time.Minute,
+	}
+}
+
+// SplitList returns non-empty items of comma-separated preference value.
+func SplitList(value string) (items []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
 }
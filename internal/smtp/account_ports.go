@@ -0,0 +1,116 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"errors"
+	"strings"
+
+	goSMTP "github.com/emersion/go-smtp"
+)
+
+var errPortOfOtherAccount = errors.New("port is dedicated to another account")
+
+type accountServer struct {
+	server   *goSMTP.Server
+	listener *switchableListener
+	port     int
+}
+
+// SetAccountPorts starts servers on ports dedicated to accounts and stops
+// servers of ports which are not dedicated anymore. Keys are ports and
+// values are IDs of users to whom the ports are dedicated.
+func (s *smtpServer) SetAccountPorts(ports map[int]string) {
+	s.accountServersLock.Lock()
+	defer s.accountServersLock.Unlock()
+
+	for port, account := range s.accountServers {
+		if _, ok := ports[port]; !ok {
+			log.WithField("port", port).Info("Closing SMTP port of account")
+			delete(s.accountServers, port)
+			// Server closes its connections once the listener is closed.
+			_ = account.listener.Close()
+		}
+	}
+
+	for port, userID := range ports {
+		if _, ok := s.accountServers[port]; ok {
+			continue
+		}
+
+		backend := &accountBackend{smtpBackend: s.backend, userID: userID}
+		server := newGoSMTPServer(s.debug, port, s.server.TLSConfig, backend)
+
+		l, err := s.listen(server.Addr, s.useSSL)
+		if err != nil {
+			log.WithError(err).WithField("port", port).Error("Cannot listen on SMTP port of account")
+			continue
+		}
+		account := newAccountServer(server, l, port)
+		s.accountServers[port] = account
+
+		go func(port int) {
+			defer s.backend.panicHandler.HandlePanic()
+
+			log.WithField("port", port).Info("SMTP server listening on port of account")
+			if err := server.Serve(account.listener); err != nil {
+				log.WithError(err).WithField("port", port).Info("SMTP server of account stopped")
+			}
+		}(port)
+	}
+}
+
+// accountBackend accepts only logins of the account to which the port is
+// dedicated.
+type accountBackend struct {
+	*smtpBackend
+	userID string
+}
+
+func (ab *accountBackend) Login(username, password string) (goSMTP.User, error) {
+	// Called from go-smtp in goroutines - we need to handle panics for each function.
+	defer ab.panicHandler.HandlePanic()
+
+	if err := ab.checkAccount(username); err != nil {
+		return nil, err
+	}
+	return ab.smtpBackend.Login(username, password)
+}
+
+func (ab *accountBackend) loginWithToken(username, token string) (goSMTP.User, error) {
+	// Called from go-smtp in goroutines - we need to handle panics for each function.
+	defer ab.panicHandler.HandlePanic()
+
+	if err := ab.checkAccount(username); err != nil {
+		return nil, err
+	}
+	return ab.smtpBackend.loginWithToken(username, token)
+}
+
+func (ab *accountBackend) checkAccount(username string) error {
+	user, err := ab.bridge.GetUser(strings.ToLower(username))
+	if err != nil {
+		log.Warn("Cannot get user: ", err)
+		return err
+	}
+	if user.ID() != ab.userID {
+		log.WithError(errPortOfOtherAccount).Warn("Login refused")
+		return errPortOfOtherAccount
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"net/mail"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// hasExternalRecipient returns whether any recipient is not a Proton
+// address. Such recipients get the public key of the sender when enabled.
+func (su *smtpUser) hasExternalRecipient(to []string) (bool, error) {
+	for _, email := range to {
+		if !looksLikeEmail(email) {
+			continue
+		}
+		_, isInternal, err := su.getAPIKeyData(email)
+		if err != nil {
+			return false, err
+		}
+		if !isInternal {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// addAutocryptHeader announces the primary key of the sender by Autocrypt
+// header unless the client already added one.
+func addAutocryptHeader(m *pmapi.Message, email string, kr *crypto.KeyRing) error {
+	if m.Header == nil {
+		m.Header = make(mail.Header)
+	}
+	if m.Header.Get(message.AutocryptHeader) != "" {
+		return nil
+	}
+
+	key, err := kr.GetKey(0)
+	if err != nil {
+		return err
+	}
+
+	keyData, err := key.GetPublicKey()
+	if err != nil {
+		return err
+	}
+
+	autocrypt := &message.Autocrypt{Addr: email, PreferEncrypt: true, KeyData: keyData}
+	m.Header[message.AutocryptHeader] = []string{autocrypt.String()}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"net/mail"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddAutocryptHeader(t *testing.T) {
+	key, err := crypto.GenerateKey("user", "user@pm.me", "x25519", 0)
+	require.NoError(t, err)
+	kr, err := crypto.NewKeyRing(key)
+	require.NoError(t, err)
+
+	m := &pmapi.Message{}
+	require.NoError(t, addAutocryptHeader(m, "user@pm.me", kr))
+
+	autocrypt := message.GetAutocrypt(m.Header, "user@pm.me")
+	require.NotNil(t, autocrypt)
+	require.True(t, autocrypt.PreferEncrypt)
+
+	announced, err := crypto.NewKey(autocrypt.KeyData)
+	require.NoError(t, err)
+	require.False(t, announced.IsPrivate())
+	require.Equal(t, key.GetFingerprint(), announced.GetFingerprint())
+}
+
+func TestAddAutocryptHeaderKeepsClientHeader(t *testing.T) {
+	kr, err := crypto.NewKeyRing(nil)
+	require.NoError(t, err)
+
+	m := &pmapi.Message{Header: mail.Header{message.AutocryptHeader: {"addr=user@pm.me; keydata=AQID"}}}
+	require.NoError(t, addAutocryptHeader(m, "user@pm.me", kr))
+	require.Equal(t, []string{"addr=user@pm.me; keydata=AQID"}, m.Header[message.AutocryptHeader])
+}
@@ -50,7 +50,14 @@ func NewSMTPBackend(
 	preferences *config.Preferences,
 	bridge *bridge.Bridge,
 ) *smtpBackend { //nolint[golint]
-	return newSMTPBackend(panicHandler, eventListener, preferences, newBridgeWrap(bridge))
+	sb := newSMTPBackend(panicHandler, eventListener, preferences, newBridgeWrap(bridge))
+
+	go func() {
+		defer panicHandler.HandlePanic()
+		sb.watchScheduledMessages()
+	}()
+
+	return sb
 }
 
 func newSMTPBackend(
@@ -73,6 +80,24 @@ func newSMTPBackend(
 func (sb *smtpBackend) Login(username, password string) (goSMTPBackend.User, error) {
 	// Called from go-smtp in goroutines - we need to handle panics for each function.
 	defer sb.panicHandler.HandlePanic()
+
+	return sb.login(username, func(user bridgeUser) error {
+		return user.CheckBridgeLogin(password)
+	})
+}
+
+// loginWithToken authenticates a user by access token sent by XOAUTH2 or
+// OAUTHBEARER.
+func (sb *smtpBackend) loginWithToken(username, token string) (goSMTPBackend.User, error) {
+	// Called from go-smtp in goroutines - we need to handle panics for each function.
+	defer sb.panicHandler.HandlePanic()
+
+	return sb.login(username, func(user bridgeUser) error {
+		return user.CheckBridgeAccessToken(token)
+	})
+}
+
+func (sb *smtpBackend) login(username string, checkCredentials func(bridgeUser) error) (goSMTPBackend.User, error) {
 	username = strings.ToLower(username)
 
 	user, err := sb.bridge.GetUser(username)
@@ -80,8 +105,8 @@ func (sb *smtpBackend) Login(username, password string) (goSMTPBackend.User, err
 		log.Warn("Cannot get user: ", err)
 		return nil, err
 	}
-	if err := user.CheckBridgeLogin(password); err != nil {
-		log.WithError(err).Error("Could not check bridge password")
+	if err := checkCredentials(user); err != nil {
+		log.WithError(err).Error("Could not check bridge credentials")
 		// Apple Mail sometimes generates a lot of requests very quickly. It's good practice
 		// to have a timeout after bad logins so that we can slow those requests down a little bit.
 		time.Sleep(10 * time.Second)
@@ -100,6 +125,26 @@ func (sb *smtpBackend) Login(username, password string) (goSMTPBackend.User, err
 	return newSMTPUser(sb.panicHandler, sb.eventListener, sb, user, addressID)
 }
 
+// senderPolicy returns the policy for messages with mismatching sender.
+func (sb *smtpBackend) senderPolicy() string {
+	policy := sb.preferences.Get(preferences.SenderPolicyKey)
+	if !IsValidSenderPolicy(policy) {
+		return SenderPolicyRewrite
+	}
+	return policy
+}
+
+// sendPolicies returns the domain policies of outgoing messages. Invalid
+// policies are validated when set, so they are only logged here.
+func (sb *smtpBackend) sendPolicies() []SendPolicy {
+	policies, err := ParseSendPolicies(sb.preferences.Get(preferences.SendPoliciesKey))
+	if err != nil {
+		log.WithError(err).Warn("Invalid send policies, none applied")
+		return nil
+	}
+	return policies
+}
+
 func (sb *smtpBackend) shouldReportOutgoingNoEnc() bool {
 	return sb.preferences.GetBool(preferences.ReportOutgoingNoEncKey)
 }
@@ -25,10 +25,14 @@ import (
 
 type bridger interface {
 	GetUser(query string) (bridgeUser, error)
+	GetUsers() []bridgeUser
 }
 
 type bridgeUser interface {
+	ID() string
+	IsConnected() bool
 	CheckBridgeLogin(password string) error
+	CheckBridgeAccessToken(token string) error
 	IsCombinedAddressMode() bool
 	GetAddressID(address string) (string, error)
 	GetTemporaryPMAPIClient() pmapi.Client
@@ -54,6 +58,13 @@ func (b *bridgeWrap) GetUser(query string) (bridgeUser, error) {
 	return newBridgeUserWrap(user), nil
 }
 
+func (b *bridgeWrap) GetUsers() (users []bridgeUser) {
+	for _, user := range b.Bridge.GetUsers() {
+		users = append(users, newBridgeUserWrap(user))
+	}
+	return
+}
+
 type bridgeUserWrap struct {
 	*users.User
 }
@@ -63,5 +74,9 @@ func newBridgeUserWrap(bridgeUser *users.User) *bridgeUserWrap {
 }
 
 func (u *bridgeUserWrap) GetStore() storeUserProvider {
-	return u.User.GetStore()
+	// Nil store has to be returned as nil interface.
+	if store := u.User.GetStore(); store != nil {
+		return store
+	}
+	return nil
 }
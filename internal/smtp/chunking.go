@@ -0,0 +1,530 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/authpolicy"
+	"github.com/pkg/errors"
+)
+
+const (
+	chunkingCapability = "CHUNKING"
+	dsnCapability      = "DSN"
+)
+
+// chunkingListener adds CHUNKING extension (RFC 3030) to connections of
+// go-smtp server which does not support it.
+type chunkingListener struct {
+	net.Listener
+
+	tlsConfig  *tls.Config
+	isTLS      bool
+	authPolicy authpolicy.Policy
+}
+
+// newChunkingListener wraps the listener. When isTLS is set, connections
+// are already encrypted by the listener and STARTTLS is not offered.
+// The authPolicy is enforced here as well because only this layer knows
+// whether the connection is encrypted.
+func newChunkingListener(l net.Listener, tlsConfig *tls.Config, isTLS bool, authPolicy authpolicy.Policy) net.Listener {
+	return &chunkingListener{
+		Listener:   l,
+		tlsConfig:  tlsConfig,
+		isTLS:      isTLS,
+		authPolicy: authPolicy,
+	}
+}
+
+func (l *chunkingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newChunkingConn(conn, l.tlsConfig, l.isTLS, l.authPolicy), nil
+}
+
+// chunkingConn sits between the client and go-smtp. BDAT chunks are
+// collected here and the whole message is passed to go-smtp as DATA
+// command, so it is parsed and sent the same way as any other message.
+// The client gets responses to BDAT commands from here and responses to
+// everything else from go-smtp. Because go-smtp would see only encrypted
+// data after STARTTLS, the TLS is also started here.
+type chunkingConn struct {
+	net.Conn
+
+	tlsConfig  *tls.Config
+	isTLS      bool
+	authPolicy authpolicy.Policy
+
+	reader  *bufio.Reader
+	pending []byte // Data waiting to be read by go-smtp.
+
+	inData bool // Client is sending message by DATA.
+	inLine bool // Rest of a long line of the message is being read.
+	inAuth bool // Client is authenticating by AUTH.
+	chunks *bytes.Buffer
+
+	// chunksTooLarge is set when chunks are over the size limit; the rest
+	// of chunks of the message is skipped.
+	chunksTooLarge bool
+
+	// recipients accepted in the current transaction.
+	recipients  int
+	inRecipient bool
+
+	// dsnParams are RET and ENVID parameters of MAIL FROM. go-smtp passes
+	// only the address of MAIL FROM to the backend but the whole argument
+	// of RCPT TO, therefore they are appended to each RCPT TO command.
+	dsnParams string
+
+	// dataBody is the message collected from chunks which is passed to
+	// go-smtp once it accepts the DATA command.
+	dataBody      []byte
+	injectingData bool
+	// skipResponse is set when the response belongs to the command which
+	// client didn't send.
+	skipResponse bool
+
+	response []string // Lines of multi-line response written by go-smtp.
+	partial  []byte   // Incomplete line written by go-smtp.
+}
+
+func newChunkingConn(conn net.Conn, tlsConfig *tls.Config, isTLS bool, authPolicy authpolicy.Policy) *chunkingConn {
+	return &chunkingConn{
+		Conn:       conn,
+		tlsConfig:  tlsConfig,
+		isTLS:      isTLS,
+		authPolicy: authPolicy,
+		reader:     bufio.NewReaderSize(conn, maxLineLength),
+		chunks:     &bytes.Buffer{},
+	}
+}
+
+// Read passes commands from the client to go-smtp. Lines are passed one
+// by one so go-smtp writes the response before the next line is read.
+func (c *chunkingConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		line, err := c.reader.ReadSlice('\n')
+		line = append([]byte(nil), line...)
+
+		switch {
+		case err == bufio.ErrBufferFull && (c.inData || c.inLine):
+			// Long lines of the message are passed in parts.
+			c.pending = line
+			c.inLine = true
+			continue
+		case err == bufio.ErrBufferFull:
+			if err := c.skipLine(); err != nil {
+				return 0, err
+			}
+			if err := c.respond(500, lineTooLongMessage); err != nil {
+				return 0, err
+			}
+			continue
+		case err != nil:
+			if len(line) == 0 {
+				return 0, err
+			}
+			c.pending = line
+		case c.inLine:
+			c.inLine = false
+			c.pending = line
+		default:
+			if err := c.handleLine(line); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// skipLine discards the rest of the line which is over the limit.
+func (c *chunkingConn) skipLine() error {
+	for {
+		if _, err := c.reader.ReadSlice('\n'); err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+}
+
+func (c *chunkingConn) handleLine(line []byte) error {
+	if c.inData {
+		if isDataEnd(line) {
+			c.inData = false
+			c.recipients = 0
+		}
+		c.pending = line
+		return nil
+	}
+
+	fields := strings.SplitN(strings.TrimRight(string(line), "\r\n"), " ", 2)
+	switch strings.ToUpper(fields[0]) {
+	case "BDAT":
+		if len(fields) < 2 || strings.TrimSpace(fields[1]) == "" {
+			return c.respond(501, "BDAT command requires chunk size")
+		}
+		return c.handleBDAT(fields[1])
+	case "STARTTLS":
+		if c.isTLS {
+			return c.respond(502, "Already running in TLS")
+		}
+		if c.tlsConfig != nil {
+			return c.handleStartTLS()
+		}
+	case "AUTH":
+		if c.authPolicy.Limiter.IsBlocked(c.RemoteAddr()) {
+			return c.respond(454, "4.7.0 "+authpolicy.TooManyFailuresMessage)
+		}
+		if c.authPolicy.RequireTLS && !c.isTLS {
+			return c.respond(530, "5.7.0 Must issue a STARTTLS command first. "+authpolicy.TLSRequiredMessage)
+		}
+		if len(fields) > 1 {
+			if args := strings.Fields(fields[1]); len(args) > 0 && !c.authPolicy.IsAllowed(args[0]) {
+				return c.respond(504, "5.7.4 "+c.authPolicy.MechanismDisabledMessage(args[0]))
+			}
+		}
+		c.inAuth = true
+	case "MAIL":
+		if len(fields) > 1 && getMailSize(fields[1]) > maxMessageBytes {
+			return c.respond(552, errMessageTooLarge.Error())
+		}
+		c.resetTransaction()
+		if len(fields) > 1 {
+			arg, dsnParams, err := splitDSNParams(fields[1])
+			if err != nil {
+				return c.respond(501, "5.5.4 "+err.Error())
+			}
+			line = []byte(fields[0] + " " + arg + "\r\n")
+			c.dsnParams = dsnParams
+		}
+	case "RCPT":
+		if c.recipients >= maxRecipients {
+			return c.respond(452, tooManyRecipientsMessage)
+		}
+		c.inRecipient = true
+		if c.dsnParams != "" && bytes.Contains(line, []byte(">")) {
+			line = []byte(strings.TrimRight(string(line), "\r\n") + " " + c.dsnParams + "\r\n")
+		}
+	case "RSET", "HELO", "EHLO":
+		c.resetTransaction()
+	}
+
+	c.pending = line
+	return nil
+}
+
+func (c *chunkingConn) handleBDAT(arg string) error {
+	args := strings.Fields(arg)
+
+	size, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || size < 0 {
+		return c.respond(501, "Unable to parse BDAT chunk size")
+	}
+
+	isLast := false
+	if len(args) > 1 {
+		if len(args) > 2 || !strings.EqualFold(args[1], "LAST") {
+			// The chunk has to be read anyway to not mistake it for commands.
+			if _, err := io.CopyN(ioutil.Discard, c.reader, size); err != nil {
+				return err
+			}
+			return c.respond(501, "Was expecting BDAT arg syntax of <size> [LAST]")
+		}
+		isLast = true
+	}
+
+	// Chunks are not collected before the client can send the message.
+	if c.recipients == 0 {
+		if _, err := io.CopyN(ioutil.Discard, c.reader, size); err != nil {
+			return err
+		}
+		return c.respond(503, noRecipientsMessage)
+	}
+
+	if c.chunksTooLarge || int64(c.chunks.Len())+size > maxMessageBytes {
+		if _, err := io.CopyN(ioutil.Discard, c.reader, size); err != nil {
+			return err
+		}
+		c.chunks.Reset()
+		c.chunksTooLarge = !isLast
+		return c.respond(552, errMessageTooLarge.Error())
+	}
+
+	if _, err := io.CopyN(c.chunks, c.reader, size); err != nil {
+		return err
+	}
+
+	if !isLast {
+		return c.respond(250, fmt.Sprintf("%d octets received", size))
+	}
+
+	c.dataBody = dotStuff(c.chunks.Bytes())
+	c.chunks.Reset()
+	c.recipients = 0
+	c.injectingData = true
+	c.pending = []byte("DATA\r\n")
+	return nil
+}
+
+func (c *chunkingConn) handleStartTLS() error {
+	if err := c.respond(220, "Ready to start TLS"); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Server(c.Conn, c.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+
+	// Anything sent before the handshake is dropped with the old reader.
+	c.Conn = tlsConn
+	c.reader = bufio.NewReaderSize(tlsConn, maxLineLength)
+	c.isTLS = true
+	c.chunks.Reset()
+
+	// go-smtp resets the envelope after its own STARTTLS.
+	c.skipResponse = true
+	c.pending = []byte("RSET\r\n")
+	return nil
+}
+
+// Write passes responses from go-smtp to the client.
+func (c *chunkingConn) Write(p []byte) (int, error) {
+	c.partial = append(c.partial, p...)
+
+	for {
+		idx := bytes.IndexByte(c.partial, '\n')
+		if idx < 0 {
+			break
+		}
+
+		line := string(c.partial[:idx+1])
+		c.partial = c.partial[idx+1:]
+
+		if err := c.handleResponseLine(line); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (c *chunkingConn) handleResponseLine(line string) error {
+	if len(line) > 3 && line[3] == '-' {
+		c.response = append(c.response, line)
+		return nil
+	}
+
+	lines := append(c.response, line)
+	c.response = nil
+
+	code := ""
+	if len(line) >= 3 {
+		code = line[:3]
+	}
+
+	// Authentication continues until other than 334 response is sent.
+	if c.inAuth && code != "334" {
+		c.inAuth = false
+		switch code {
+		case "235":
+			c.authPolicy.Limiter.AddSuccess(c.RemoteAddr())
+		case "454", "535":
+			c.authPolicy.Limiter.AddFailure(c.RemoteAddr())
+		}
+	}
+
+	switch {
+	case c.skipResponse:
+		c.skipResponse = false
+		return nil
+	case c.injectingData:
+		c.injectingData = false
+		if code == "354" {
+			c.pending = c.dataBody
+			c.dataBody = nil
+			return nil
+		}
+		c.dataBody = nil
+	case code == "354":
+		c.inData = true
+	case c.inRecipient:
+		c.inRecipient = false
+		if code == "250" {
+			c.recipients++
+		}
+	case code == "250" && len(lines) > 1:
+		// Only EHLO has multi-line response.
+		lines = c.extendCapabilities(lines)
+	case code == "554" && strings.Contains(line, errAPIUnavailable.Error()):
+		// go-smtp responds to any error of DATA by permanent failure.
+		lines = []string{"451 " + errAPIUnavailable.Error() + "\r\n"}
+	case code == "554" && strings.Contains(line, errMessageTooLarge.Error()):
+		lines = []string{"552 " + errMessageTooLarge.Error() + "\r\n"}
+	}
+
+	_, err := io.WriteString(c.Conn, strings.Join(lines, ""))
+	return err
+}
+
+// extendCapabilities adds CHUNKING to EHLO response. STARTTLS is removed
+// when TLS is already running because go-smtp doesn't know about it.
+// AUTH lists only mechanisms allowed by the policy.
+func (c *chunkingConn) extendCapabilities(lines []string) []string {
+	capabilities := []string{}
+	for _, line := range lines {
+		capability := strings.TrimRight(line[4:], "\r\n")
+		if c.isTLS && strings.EqualFold(capability, "STARTTLS") {
+			continue
+		}
+		if fields := strings.Fields(capability); len(fields) > 0 && strings.EqualFold(fields[0], "AUTH") {
+			if capability = c.filterAuthCapability(fields[1:]); capability == "" {
+				continue
+			}
+		}
+		capabilities = append(capabilities, capability)
+	}
+	capabilities = append(capabilities, chunkingCapability, dsnCapability, "SIZE "+strconv.FormatInt(maxMessageBytes, 10))
+
+	extended := make([]string, len(capabilities))
+	for i, capability := range capabilities {
+		separator := "-"
+		if i == len(capabilities)-1 {
+			separator = " "
+		}
+		extended[i] = "250" + separator + capability + "\r\n"
+	}
+	return extended
+}
+
+// filterAuthCapability returns AUTH capability with allowed mechanisms or
+// empty string when client cannot authenticate yet.
+func (c *chunkingConn) filterAuthCapability(mechanisms []string) string {
+	if c.authPolicy.RequireTLS && !c.isTLS {
+		return ""
+	}
+
+	allowed := []string{}
+	for _, mechanism := range mechanisms {
+		if c.authPolicy.IsAllowed(mechanism) {
+			allowed = append(allowed, mechanism)
+		}
+	}
+	if len(allowed) == 0 {
+		return ""
+	}
+
+	return "AUTH " + strings.Join(allowed, " ")
+}
+
+// resetTransaction forgets chunks and recipients of the previous message.
+func (c *chunkingConn) resetTransaction() {
+	c.chunks.Reset()
+	c.chunksTooLarge = false
+	c.recipients = 0
+	c.dsnParams = ""
+}
+
+// splitDSNParams removes RET and ENVID parameters from the argument of
+// MAIL FROM command. go-smtp accepts only word characters in parameters
+// and ENVID can contain more.
+func splitDSNParams(arg string) (rest, dsnParams string, err error) {
+	idx := strings.Index(arg, ">")
+	if idx < 0 {
+		return arg, "", nil
+	}
+
+	restParams := []string{}
+	dsn := []string{}
+	for _, param := range strings.Fields(arg[idx+1:]) {
+		keyValue := strings.SplitN(param, "=", 2)
+		switch strings.ToUpper(keyValue[0]) {
+		case "RET":
+			if len(keyValue) != 2 {
+				return "", "", errors.New("RET parameter requires value")
+			}
+			if _, err := parseReturn(keyValue[1]); err != nil {
+				return "", "", err
+			}
+			dsn = append(dsn, param)
+		case "ENVID":
+			if len(keyValue) != 2 {
+				return "", "", errors.New("ENVID parameter requires value")
+			}
+			if _, err := parseEnvelopeID(keyValue[1]); err != nil {
+				return "", "", err
+			}
+			dsn = append(dsn, param)
+		default:
+			restParams = append(restParams, param)
+		}
+	}
+
+	rest = arg[:idx+1]
+	if len(restParams) > 0 {
+		rest += " " + strings.Join(restParams, " ")
+	}
+	return rest, strings.Join(dsn, " "), nil
+}
+
+func (c *chunkingConn) respond(code int, text string) error {
+	_, err := fmt.Fprintf(c.Conn, "%d %s\r\n", code, text)
+	return err
+}
+
+func isDataEnd(line []byte) bool {
+	return bytes.Equal(line, []byte(".\r\n")) || bytes.Equal(line, []byte(".\n"))
+}
+
+// dotStuff encodes the message for DATA command (RFC 5321 section 4.5.2).
+func dotStuff(message []byte) []byte {
+	b := &bytes.Buffer{}
+
+	for len(message) > 0 {
+		line := message
+		if idx := bytes.IndexByte(message, '\n'); idx >= 0 {
+			line = message[:idx+1]
+		}
+		message = message[len(line):]
+
+		if len(line) > 0 && line[0] == '.' {
+			b.WriteByte('.')
+		}
+		b.Write(line)
+	}
+
+	if b.Len() > 0 && !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+		b.WriteString("\r\n")
+	}
+	b.WriteString(".\r\n")
+
+	return b.Bytes()
+}
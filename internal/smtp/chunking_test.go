@@ -0,0 +1,384 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/authpolicy"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	goSMTP "github.com/emersion/go-smtp"
+	"github.com/stretchr/testify/require"
+)
+
+type testChunkingBackend struct {
+	messages chan string
+	sendErr  error
+	lastTo   []string
+}
+
+func (b *testChunkingBackend) Login(username, password string) (goSMTP.User, error) {
+	return b, nil
+}
+
+func (b *testChunkingBackend) Send(from string, to []string, r io.Reader) error {
+	body, err := readMessage(r)
+	if err != nil {
+		return err
+	}
+	b.lastTo = to
+	b.messages <- string(body)
+	return b.sendErr
+}
+
+func (b *testChunkingBackend) Logout() error {
+	return nil
+}
+
+func newTestChunkingServer(t *testing.T) (*testChunkingBackend, *tls.Config, string, func()) {
+	return newTestChunkingServerWithPolicy(t, authpolicy.Policy{})
+}
+
+func newTestChunkingServerWithPolicy(t *testing.T, authPolicy authpolicy.Policy) (*testChunkingBackend, *tls.Config, string, func()) {
+	dir, err := ioutil.TempDir("", "chunking")
+	require.NoError(t, err)
+
+	tlsConfig, err := config.GenerateTLSConfig(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	require.NoError(t, err)
+
+	backend := &testChunkingBackend{messages: make(chan string, 1)}
+
+	s := goSMTP.NewServer(backend)
+	s.Domain = "127.0.0.1"
+	s.TLSConfig = tlsConfig
+	s.AllowInsecureAuth = true
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() { _ = s.Serve(newChunkingListener(l, tlsConfig, false, authPolicy)) }()
+
+	return backend, tlsConfig, l.Addr().String(), func() {
+		s.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func dialTestChunkingServer(t *testing.T, addr string) (net.Conn, *textproto.Conn) {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+
+	text := textproto.NewConn(conn)
+	_, _, err = text.ReadResponse(220)
+	require.NoError(t, err)
+
+	return conn, text
+}
+
+func cmd(t *testing.T, text *textproto.Conn, expectCode int, format string, args ...interface{}) string {
+	require.NoError(t, text.PrintfLine(format, args...))
+	_, msg, err := text.ReadResponse(expectCode)
+	require.NoError(t, err, msg)
+	return msg
+}
+
+func login(t *testing.T, text *textproto.Conn) {
+	msg := cmd(t, text, 250, "EHLO localhost")
+	require.Contains(t, msg, chunkingCapability)
+	require.Contains(t, msg, dsnCapability)
+
+	cmd(t, text, 235, "AUTH PLAIN %s", base64.StdEncoding.EncodeToString([]byte("\x00user\x00pass")))
+}
+
+func bdat(t *testing.T, conn net.Conn, text *textproto.Conn, expectCode int, chunk string, isLast bool) {
+	last := ""
+	if isLast {
+		last = " LAST"
+	}
+	_, err := fmt.Fprintf(conn, "BDAT %d%s\r\n%s", len(chunk), last, chunk)
+	require.NoError(t, err)
+
+	_, msg, err := text.ReadResponse(expectCode)
+	require.NoError(t, err, msg)
+}
+
+func TestChunkingSendsMessage(t *testing.T) {
+	backend, _, addr, clear := newTestChunkingServer(t)
+	defer clear()
+
+	conn, text := dialTestChunkingServer(t, addr)
+	defer conn.Close() //nolint[errcheck]
+
+	login(t, text)
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me>")
+	cmd(t, text, 250, "RCPT TO:<other@pm.me>")
+
+	bdat(t, conn, text, 250, "Subject: Chunks\r\n\r\nFirst line\r\n.Dot", false)
+	bdat(t, conn, text, 250, " line\r\nQUIT\r\n", false)
+	bdat(t, conn, text, 250, "", true)
+
+	// Line endings are normalized the same way as for DATA.
+	require.Equal(t, "Subject: Chunks\n\nFirst line\n.Dot line\nQUIT\n", <-backend.messages)
+
+	cmd(t, text, 250, "NOOP")
+}
+
+func TestChunkingDataStillWorks(t *testing.T) {
+	backend, _, addr, clear := newTestChunkingServer(t)
+	defer clear()
+
+	conn, text := dialTestChunkingServer(t, addr)
+	defer conn.Close() //nolint[errcheck]
+
+	login(t, text)
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me>")
+	cmd(t, text, 250, "RCPT TO:<other@pm.me>")
+	cmd(t, text, 354, "DATA")
+	cmd(t, text, 250, "Subject: Data\r\n\r\nBDAT 5\r\nSTARTTLS\r\n..\r\n.")
+
+	require.Equal(t, "Subject: Data\n\nBDAT 5\nSTARTTLS\n.\n", <-backend.messages)
+}
+
+func TestAPIUnavailableIsTemporaryFailure(t *testing.T) {
+	backend, _, addr, clear := newTestChunkingServer(t)
+	defer clear()
+	backend.sendErr = errAPIUnavailable
+
+	conn, text := dialTestChunkingServer(t, addr)
+	defer conn.Close() //nolint[errcheck]
+
+	login(t, text)
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me>")
+	cmd(t, text, 250, "RCPT TO:<other@pm.me>")
+	bdat(t, conn, text, 451, "Subject: Down\r\n\r\nBody\r\n", true)
+	<-backend.messages
+
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me>")
+	cmd(t, text, 250, "RCPT TO:<other@pm.me>")
+	cmd(t, text, 354, "DATA")
+	msg := cmd(t, text, 451, "Subject: Down\r\n\r\nBody\r\n.")
+	require.Equal(t, errAPIUnavailable.Error(), msg)
+	<-backend.messages
+}
+
+func TestChunkingWithoutRecipient(t *testing.T) {
+	_, _, addr, clear := newTestChunkingServer(t)
+	defer clear()
+
+	conn, text := dialTestChunkingServer(t, addr)
+	defer conn.Close() //nolint[errcheck]
+
+	login(t, text)
+	bdat(t, conn, text, 503, "Subject: Nobody\r\n\r\nMAIL FROM:<user@pm.me>\r\n", true)
+
+	// Recipient is required also for the first chunk.
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me>")
+	bdat(t, conn, text, 503, "Subject: Nobody\r\n", false)
+
+	// Chunk with invalid arguments is skipped.
+	_, err := fmt.Fprintf(conn, "BDAT 5 FIRST\r\nHello")
+	require.NoError(t, err)
+	_, _, err = text.ReadResponse(501)
+	require.NoError(t, err)
+
+	cmd(t, text, 250, "NOOP")
+}
+
+func TestChunkingAfterStartTLS(t *testing.T) {
+	backend, tlsConfig, addr, clear := newTestChunkingServer(t)
+	defer clear()
+
+	conn, text := dialTestChunkingServer(t, addr)
+	defer conn.Close() //nolint[errcheck]
+
+	msg := cmd(t, text, 250, "EHLO localhost")
+	require.Contains(t, msg, "STARTTLS")
+
+	cmd(t, text, 220, "STARTTLS")
+
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, Certificates: tlsConfig.Certificates}) //nolint[gosec]
+	require.NoError(t, tlsConn.Handshake())
+	text = textproto.NewConn(tlsConn)
+
+	msg = cmd(t, text, 250, "EHLO localhost")
+	require.NotContains(t, msg, "STARTTLS")
+	require.Contains(t, msg, chunkingCapability)
+	cmd(t, text, 502, "STARTTLS")
+
+	cmd(t, text, 235, "AUTH PLAIN %s", base64.StdEncoding.EncodeToString([]byte("\x00user\x00pass")))
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me>")
+	cmd(t, text, 250, "RCPT TO:<other@pm.me>")
+	bdat(t, tlsConn, text, 250, "Subject: Secure\r\n\r\nHello\r\n", true)
+
+	require.Equal(t, "Subject: Secure\n\nHello\n", <-backend.messages)
+}
+
+func TestAuthRequiresTLS(t *testing.T) {
+	_, tlsConfig, addr, clear := newTestChunkingServerWithPolicy(t, authpolicy.Policy{RequireTLS: true})
+	defer clear()
+
+	conn, text := dialTestChunkingServer(t, addr)
+	defer conn.Close() //nolint[errcheck]
+
+	msg := cmd(t, text, 250, "EHLO localhost")
+	require.NotContains(t, msg, "AUTH")
+	msg = cmd(t, text, 530, "AUTH PLAIN %s", base64.StdEncoding.EncodeToString([]byte("\x00user\x00pass")))
+	require.Contains(t, msg, "STARTTLS")
+
+	cmd(t, text, 220, "STARTTLS")
+
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, Certificates: tlsConfig.Certificates}) //nolint[gosec]
+	require.NoError(t, tlsConn.Handshake())
+	text = textproto.NewConn(tlsConn)
+
+	msg = cmd(t, text, 250, "EHLO localhost")
+	require.Contains(t, msg, "AUTH")
+	cmd(t, text, 235, "AUTH PLAIN %s", base64.StdEncoding.EncodeToString([]byte("\x00user\x00pass")))
+}
+
+func TestAuthDisabledMechanism(t *testing.T) {
+	_, _, addr, clear := newTestChunkingServerWithPolicy(t, authpolicy.Policy{Mechanisms: []string{authpolicy.Login}})
+	defer clear()
+
+	conn, text := dialTestChunkingServer(t, addr)
+	defer conn.Close() //nolint[errcheck]
+
+	msg := cmd(t, text, 250, "EHLO localhost")
+	// Test server supports only PLAIN which is not allowed.
+	require.NotContains(t, msg, "AUTH")
+
+	msg = cmd(t, text, 504, "AUTH plain %s", base64.StdEncoding.EncodeToString([]byte("\x00user\x00pass")))
+	require.Contains(t, msg, "use one of: LOGIN")
+}
+
+func TestSizeLimit(t *testing.T) {
+	defer func(limit int64) { maxMessageBytes = limit }(maxMessageBytes)
+	maxMessageBytes = 20
+
+	backend, _, addr, clear := newTestChunkingServer(t)
+	defer clear()
+
+	conn, text := dialTestChunkingServer(t, addr)
+	defer conn.Close() //nolint[errcheck]
+
+	require.Contains(t, cmd(t, text, 250, "EHLO localhost"), "SIZE 20")
+	login(t, text)
+
+	cmd(t, text, 552, "MAIL FROM:<user@pm.me> SIZE=21")
+
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me> SIZE=20")
+	cmd(t, text, 250, "RCPT TO:<other@pm.me>")
+	bdat(t, conn, text, 250, "Subject: A\r\n", false)
+	bdat(t, conn, text, 552, "\r\nToo long body\r\n", false)
+	bdat(t, conn, text, 552, "", true)
+
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me>")
+	cmd(t, text, 250, "RCPT TO:<other@pm.me>")
+	cmd(t, text, 354, "DATA")
+	msg := cmd(t, text, 552, "Subject: A\r\n\r\nToo long body\r\n.")
+	require.Equal(t, errMessageTooLarge.Error(), msg)
+
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me>")
+	cmd(t, text, 250, "RCPT TO:<other@pm.me>")
+	bdat(t, conn, text, 250, "Subject: A\r\n\r\nOK\r\n", true)
+	require.Equal(t, "Subject: A\n\nOK\n", <-backend.messages)
+}
+
+func TestTooManyRecipients(t *testing.T) {
+	defer func(limit int) { maxRecipients = limit }(maxRecipients)
+	maxRecipients = 2
+
+	backend, _, addr, clear := newTestChunkingServer(t)
+	defer clear()
+
+	conn, text := dialTestChunkingServer(t, addr)
+	defer conn.Close() //nolint[errcheck]
+
+	login(t, text)
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me>")
+	cmd(t, text, 501, "RCPT TO")
+	cmd(t, text, 250, "RCPT TO:<first@pm.me>")
+	cmd(t, text, 250, "RCPT TO:<second@pm.me>")
+	cmd(t, text, 452, "RCPT TO:<third@pm.me>")
+	bdat(t, conn, text, 250, "Subject: Many\r\n\r\nBody\r\n", true)
+	<-backend.messages
+
+	// The rest of recipients is sent in the next transaction.
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me>")
+	cmd(t, text, 250, "RCPT TO:<third@pm.me>")
+}
+
+func TestDSNParameters(t *testing.T) {
+	backend, _, addr, clear := newTestChunkingServer(t)
+	defer clear()
+
+	conn, text := dialTestChunkingServer(t, addr)
+	defer conn.Close() //nolint[errcheck]
+
+	login(t, text)
+	cmd(t, text, 501, "MAIL FROM:<user@pm.me> RET=BODY")
+	cmd(t, text, 501, "MAIL FROM:<user@pm.me> ENVID=QQ+ZZ")
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me> RET=HDRS ENVID=QQ+2B123")
+	cmd(t, text, 250, "RCPT TO:<other@pm.me> NOTIFY=SUCCESS")
+	bdat(t, conn, text, 250, "Subject: DSN\r\n\r\nBody\r\n", true)
+	<-backend.messages
+
+	recipient, err := parseRecipient(backend.lastTo[0])
+	require.NoError(t, err)
+	require.Equal(t, dsnRecipient{Address: "other@pm.me", Notify: []string{dsnNotifySuccess}, Return: dsnReturnHeaders, EnvelopeID: "QQ+2B123"}, recipient)
+
+	// Parameters are forgotten with the transaction.
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me>")
+	cmd(t, text, 250, "RCPT TO:<other@pm.me>")
+	bdat(t, conn, text, 250, "Subject: DSN\r\n\r\nBody\r\n", true)
+	<-backend.messages
+	require.Equal(t, []string{"other@pm.me"}, backend.lastTo)
+}
+
+func TestLineTooLong(t *testing.T) {
+	defer func(limit int) { maxLineLength = limit }(maxLineLength)
+	maxLineLength = 64
+
+	backend, _, addr, clear := newTestChunkingServer(t)
+	defer clear()
+
+	conn, text := dialTestChunkingServer(t, addr)
+	defer conn.Close() //nolint[errcheck]
+
+	login(t, text)
+	cmd(t, text, 500, "MAIL FROM:<%s@pm.me>", strings.Repeat("a", 100))
+	cmd(t, text, 250, "NOOP")
+
+	// Lines of the message are not limited.
+	longLine := strings.Repeat("b", 200)
+	cmd(t, text, 250, "MAIL FROM:<user@pm.me>")
+	cmd(t, text, 250, "RCPT TO:<other@pm.me>")
+	cmd(t, text, 354, "DATA")
+	cmd(t, text, 250, "Subject: Long\r\n\r\n%s\r\n.", longLine)
+	require.Equal(t, "Subject: Long\n\n"+longLine+"\n", <-backend.messages)
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"github.com/ProtonMail/proton-bridge/pkg/connlimit"
+)
+
+// connections counts authenticated SMTP sessions of accounts.
+var connections = connlimit.NewTracker() //nolint[gochecknoglobals]
+
+// SetConnectionLimits sets how many SMTP sessions an account can have open
+// and after how long idle connections are closed.
+func SetConnectionLimits(limits connlimit.Limits) {
+	connections.SetLimits(limits)
+}
+
+// ConnectionCounts returns the number of open SMTP sessions per account ID.
+func ConnectionCounts() map[string]int {
+	return connections.Counts()
+}
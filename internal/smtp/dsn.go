@@ -0,0 +1,369 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// NOTIFY values of RCPT TO command, see RFC 3461 section 4.1.
+const (
+	dsnNotifyNever   = "NEVER"
+	dsnNotifySuccess = "SUCCESS"
+	dsnNotifyFailure = "FAILURE"
+	dsnNotifyDelay   = "DELAY"
+)
+
+// RET values of MAIL FROM command, see RFC 3461 section 4.3.
+const (
+	dsnReturnFull    = "FULL"
+	dsnReturnHeaders = "HDRS"
+)
+
+// dsnEnvelopeIDMaxLength is the maximal length of ENVID, see RFC 3461
+// section 4.4.
+const dsnEnvelopeIDMaxLength = 100
+
+// dsnRecipient is recipient of RCPT TO command with its DSN parameters.
+type dsnRecipient struct {
+	Address string
+	// Notify is empty when client did not ask for anything. In that case
+	// only failures are reported.
+	Notify []string
+	// OriginalRecipient is the value of ORCPT parameter.
+	OriginalRecipient string
+	// Return and EnvelopeID are RET and ENVID parameters of MAIL FROM
+	// which are passed with each recipient (see chunkingConn).
+	Return     string
+	EnvelopeID string
+}
+
+// notifyOnFailure returns whether the sender wants to know about failure.
+func (r dsnRecipient) notifyOnFailure() bool {
+	if len(r.Notify) == 0 {
+		return true
+	}
+	for _, notify := range r.Notify {
+		if notify == dsnNotifyFailure {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyOnSuccess returns whether the sender wants to know that the message
+// was relayed to the API.
+func (r dsnRecipient) notifyOnSuccess() bool {
+	for _, notify := range r.Notify {
+		if notify == dsnNotifySuccess {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRecipient splits the recipient into address and DSN parameters.
+// go-smtp does not parse parameters of RCPT TO command and passes them
+// as part of the address, e.g. `user@example.com> NOTIFY=FAILURE`.
+func parseRecipient(rcpt string) (recipient dsnRecipient, err error) {
+	params := []string{}
+	if idx := strings.Index(rcpt, ">"); idx >= 0 {
+		params = strings.Fields(rcpt[idx+1:])
+		rcpt = rcpt[:idx]
+	}
+	recipient.Address = strings.TrimSpace(rcpt)
+
+	for _, param := range params {
+		keyValue := strings.SplitN(param, "=", 2)
+		if len(keyValue) != 2 {
+			return recipient, fmt.Errorf("invalid RCPT TO parameter %q", param)
+		}
+
+		switch strings.ToUpper(keyValue[0]) {
+		case "NOTIFY":
+			if recipient.Notify, err = parseNotify(keyValue[1]); err != nil {
+				return recipient, err
+			}
+		case "ORCPT":
+			recipient.OriginalRecipient = keyValue[1]
+		case "RET":
+			if recipient.Return, err = parseReturn(keyValue[1]); err != nil {
+				return recipient, err
+			}
+		case "ENVID":
+			if recipient.EnvelopeID, err = parseEnvelopeID(keyValue[1]); err != nil {
+				return recipient, err
+			}
+		default:
+			log.WithField("param", param).Debug("Ignoring unknown RCPT TO parameter")
+		}
+	}
+
+	return recipient, nil
+}
+
+func parseNotify(value string) ([]string, error) {
+	notify := []string{}
+	for _, item := range strings.Split(strings.ToUpper(value), ",") {
+		switch item {
+		case dsnNotifyNever, dsnNotifySuccess, dsnNotifyFailure, dsnNotifyDelay:
+			notify = append(notify, item)
+		default:
+			return nil, fmt.Errorf("invalid NOTIFY value %q", item)
+		}
+	}
+
+	for _, item := range notify {
+		if item == dsnNotifyNever && len(notify) > 1 {
+			return nil, errors.New("NOTIFY=NEVER cannot be combined with other values")
+		}
+	}
+
+	return notify, nil
+}
+
+func parseReturn(value string) (string, error) {
+	switch value = strings.ToUpper(value); value {
+	case dsnReturnFull, dsnReturnHeaders:
+		return value, nil
+	default:
+		return "", fmt.Errorf("invalid RET value %q", value)
+	}
+}
+
+// parseEnvelopeID checks the ENVID value which is kept encoded as xtext
+// (RFC 3461 section 4) until it is written to the report. The decoded
+// value has to be printable US-ASCII.
+func parseEnvelopeID(value string) (string, error) {
+	if value == "" || len(value) > dsnEnvelopeIDMaxLength {
+		return "", errors.New("invalid ENVID length")
+	}
+	decoded, err := decodeXText(value)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range decoded {
+		if c < ' ' || c > '~' {
+			return "", errors.New("invalid ENVID character")
+		}
+	}
+	return value, nil
+}
+
+// decodeXText decodes `+HH` hexadecimal escapes of xtext.
+func decodeXText(value string) (string, error) {
+	b := &strings.Builder{}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < '!' || c > '~' || c == '=' {
+			return "", fmt.Errorf("invalid xtext character %q", c)
+		}
+		if c != '+' {
+			b.WriteByte(c)
+			continue
+		}
+		if i+2 >= len(value) {
+			return "", errors.New("incomplete xtext escape")
+		}
+		decoded, err := strconv.ParseUint(value[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", errors.Wrap(err, "invalid xtext escape")
+		}
+		b.WriteByte(byte(decoded))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// isDeliveryFailure returns whether the API rejected recipients of the
+// message permanently. The API reports invalid or not existing recipients
+// by 422 Unprocessable Entity; other errors, e.g. connection problems,
+// expired authentication or rate limits, are temporary and the message
+// can be sent again later.
+func isDeliveryFailure(err error) bool {
+	_, ok := errors.Cause(err).(*pmapi.ErrUnprocessableEntity)
+	return ok
+}
+
+// deliveryFailure is a recipient to which the message was not delivered.
+type deliveryFailure struct {
+	Recipient dsnRecipient
+	Err       error
+}
+
+// dsnStatus is the status of one recipient in the report.
+type dsnStatus struct {
+	Recipient  dsnRecipient
+	Action     string
+	Status     string
+	Diagnostic string
+}
+
+// buildBounce creates the delivery status notification (RFC 3464) about
+// recipients to which the original message was not delivered. It returns
+// nil if no sender asked for it.
+func buildBounce(addr *pmapi.Address, original *pmapi.Message, body []byte, failures []deliveryFailure, now time.Time) (*pmapi.Message, []io.Reader) {
+	data := message.BounceData{Subject: original.Subject}
+	statuses := []dsnStatus{}
+	for _, failure := range failures {
+		if !failure.Recipient.notifyOnFailure() {
+			continue
+		}
+		data.Failures = append(data.Failures, message.BounceFailure{
+			Address: failure.Recipient.Address,
+			Error:   failure.Err.Error(),
+		})
+		statuses = append(statuses, dsnStatus{
+			Recipient:  failure.Recipient,
+			Action:     "failed",
+			Status:     "5.0.0",
+			Diagnostic: "smtp; " + strings.ReplaceAll(failure.Err.Error(), "\n", " "),
+		})
+	}
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+
+	return buildDSN(addr, original, body, statuses, now,
+		executeBounceTemplate(message.BounceSubjectTemplate, data),
+		executeBounceTemplate(message.BounceBodyTemplate, data),
+	)
+}
+
+// buildRelayNotice creates the delivery status notification about
+// recipients which asked for NOTIFY=SUCCESS. The API does not report
+// the final delivery, therefore the message is reported as relayed
+// (RFC 3461 section 6.2.6). It returns nil if no sender asked for it.
+func buildRelayNotice(addr *pmapi.Address, original *pmapi.Message, body []byte, recipients []dsnRecipient, now time.Time) (*pmapi.Message, []io.Reader) {
+	data := message.RelayData{Subject: original.Subject}
+	statuses := []dsnStatus{}
+	for _, recipient := range recipients {
+		if !recipient.notifyOnSuccess() {
+			continue
+		}
+		data.Recipients = append(data.Recipients, recipient.Address)
+		statuses = append(statuses, dsnStatus{
+			Recipient: recipient,
+			Action:    "relayed",
+			Status:    "2.0.0",
+		})
+	}
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+
+	return buildDSN(addr, original, body, statuses, now,
+		executeRelayTemplate(message.RelaySubjectTemplate, data),
+		executeRelayTemplate(message.RelayBodyTemplate, data),
+	)
+}
+
+// buildDSN creates the report with the `message/delivery-status` part and
+// the original message or only its header, as requested by RET parameter.
+func buildDSN(addr *pmapi.Address, original *pmapi.Message, body []byte, statuses []dsnStatus, now time.Time, subject, text string) (*pmapi.Message, []io.Reader) {
+	// RET and ENVID are the same for all recipients of the transaction.
+	envelope := statuses[0].Recipient
+
+	status := &bytes.Buffer{}
+	if envelope.EnvelopeID != "" {
+		envelopeID, _ := decodeXText(envelope.EnvelopeID)
+		fmt.Fprintf(status, "Original-Envelope-Id: %s\r\n", envelopeID)
+	}
+	fmt.Fprintf(status, "Reporting-MTA: dns; %s\r\n", bridge.Host)
+	fmt.Fprintf(status, "Arrival-Date: %s\r\n", now.Format(time.RFC1123Z))
+	for _, recipientStatus := range statuses {
+		fmt.Fprintf(status, "\r\nFinal-Recipient: rfc822; %s\r\n", recipientStatus.Recipient.Address)
+		if recipientStatus.Recipient.OriginalRecipient != "" {
+			fmt.Fprintf(status, "Original-Recipient: %s\r\n", recipientStatus.Recipient.OriginalRecipient)
+		}
+		fmt.Fprintf(status, "Action: %s\r\nStatus: %s\r\n", recipientStatus.Action, recipientStatus.Status)
+		if recipientStatus.Diagnostic != "" {
+			fmt.Fprintf(status, "Diagnostic-Code: %s\r\n", recipientStatus.Diagnostic)
+		}
+	}
+
+	returned := &pmapi.Attachment{Name: "original-header.txt", MIMEType: "text/rfc822-headers", Header: textproto.MIMEHeader{}}
+	var returnedContent io.Reader
+	if envelope.Return == dsnReturnFull && len(body) > 0 {
+		returned = &pmapi.Attachment{Name: "original-message.eml", MIMEType: "message/rfc822", Header: textproto.MIMEHeader{}}
+		returnedContent = bytes.NewReader(body)
+	} else {
+		originalHeader := &bytes.Buffer{}
+		if err := message.WriteHeader(originalHeader, copyHeader(original.Header)); err != nil {
+			log.WithError(err).Warn("Cannot write original header to report")
+		}
+		returnedContent = originalHeader
+	}
+
+	report := &pmapi.Message{
+		Header:   mail.Header{"Auto-Submitted": {"auto-replied"}},
+		Subject:  subject,
+		Sender:   &mail.Address{Name: executeBounceTemplate(message.BounceSenderTemplate, message.BounceData{Subject: original.Subject}), Address: addr.Email},
+		ToList:   []*mail.Address{{Address: addr.Email}},
+		Time:     now.Unix(),
+		Unread:   1,
+		Flags:    pmapi.FlagReceived,
+		LabelIDs: []string{pmapi.InboxLabel},
+		MIMEType: pmapi.ContentTypePlainText,
+		Body:     text,
+		Attachments: []*pmapi.Attachment{
+			{Name: "delivery-status.txt", MIMEType: "message/delivery-status", Header: textproto.MIMEHeader{}},
+			returned,
+		},
+	}
+
+	return report, []io.Reader{status, returnedContent}
+}
+
+func executeBounceTemplate(name string, data message.BounceData) string {
+	text, err := message.ExecuteTemplate(name, data)
+	if err != nil {
+		log.WithError(err).WithField("template", name).Error("Cannot execute bounce template")
+	}
+	return text
+}
+
+func executeRelayTemplate(name string, data message.RelayData) string {
+	text, err := message.ExecuteTemplate(name, data)
+	if err != nil {
+		log.WithError(err).WithField("template", name).Error("Cannot execute relay template")
+	}
+	return text
+}
+
+// copyHeader returns copy of the header so writing it doesn't change
+// the original message.
+func copyHeader(header mail.Header) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	for key, values := range header {
+		h[key] = append([]string{}, values...)
+	}
+	return h
+}
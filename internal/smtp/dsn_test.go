@@ -0,0 +1,159 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/mail"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRecipient(t *testing.T) {
+	testData := []struct {
+		rcpt    string
+		want    dsnRecipient
+		wantErr bool
+	}{
+		{"user@example.com", dsnRecipient{Address: "user@example.com"}, false},
+		{"user@example.com>", dsnRecipient{Address: "user@example.com"}, false},
+		{"user@example.com> NOTIFY=failure,DELAY", dsnRecipient{Address: "user@example.com", Notify: []string{"FAILURE", "DELAY"}}, false},
+		{"user@example.com> NOTIFY=NEVER ORCPT=rfc822;other@example.com", dsnRecipient{Address: "user@example.com", Notify: []string{"NEVER"}, OriginalRecipient: "rfc822;other@example.com"}, false},
+		{"user@example.com> SOMETHING=else", dsnRecipient{Address: "user@example.com"}, false},
+		{"user@example.com> NOTIFY=NEVER,FAILURE", dsnRecipient{}, true},
+		{"user@example.com> NOTIFY=SOMETIMES", dsnRecipient{}, true},
+		{"user@example.com> NOTIFY", dsnRecipient{}, true},
+		{"user@example.com> NOTIFY=SUCCESS RET=full ENVID=QQ+2B123", dsnRecipient{Address: "user@example.com", Notify: []string{"SUCCESS"}, Return: "FULL", EnvelopeID: "QQ+2B123"}, false},
+		{"user@example.com> RET=BODY", dsnRecipient{}, true},
+		{"user@example.com> ENVID=QQ+ZZ", dsnRecipient{}, true},
+	}
+
+	for _, tc := range testData {
+		tc := tc
+		t.Run(tc.rcpt, func(t *testing.T) {
+			recipient, err := parseRecipient(tc.rcpt)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, recipient)
+		})
+	}
+}
+
+func TestIsDeliveryFailure(t *testing.T) {
+	require.True(t, isDeliveryFailure(&pmapi.ErrUnprocessableEntity{}))
+	require.True(t, isDeliveryFailure(pkgErrors.Wrap(&pmapi.ErrUnprocessableEntity{}, "sending")))
+	require.False(t, isDeliveryFailure(&pmapi.Error{Code: 2001, ErrorMessage: "Invalid recipient"}))
+	require.False(t, isDeliveryFailure(pmapi.ErrAPINotReachable))
+	require.False(t, isDeliveryFailure(errors.New("local error")))
+}
+
+func TestBuildBounce(t *testing.T) {
+	addr := &pmapi.Address{ID: "addressID", Email: "me@pm.me"}
+	original := &pmapi.Message{
+		Subject: "Hello",
+		Header:  mail.Header{"Message-Id": {"<original@pm.me>"}},
+	}
+	failures := []deliveryFailure{
+		{Recipient: dsnRecipient{Address: "bad@example.com", OriginalRecipient: "rfc822;bad@example.com"}, Err: errors.New("address does not exist")},
+		{Recipient: dsnRecipient{Address: "quiet@example.com", Notify: []string{dsnNotifyNever}}, Err: errors.New("address does not exist")},
+		{Recipient: dsnRecipient{Address: "other@example.com", Notify: []string{dsnNotifySuccess, dsnNotifyFailure}}, Err: errors.New("address disabled")},
+	}
+
+	bounce, readers := buildBounce(addr, original, []byte("Message-Id: <original@pm.me>\r\n\r\nHello"), failures, time.Unix(1600000000, 0))
+	require.NotNil(t, bounce)
+	subject, err := message.ExecuteTemplate(message.BounceSubjectTemplate, nil)
+	require.NoError(t, err)
+	require.Equal(t, subject, bounce.Subject)
+	require.Equal(t, []string{pmapi.InboxLabel}, bounce.LabelIDs)
+	require.Equal(t, "me@pm.me", bounce.ToList[0].Address)
+	require.Contains(t, bounce.Body, "<bad@example.com>: address does not exist")
+	require.Contains(t, bounce.Body, "<other@example.com>: address disabled")
+	require.NotContains(t, bounce.Body, "quiet@example.com")
+
+	require.Len(t, readers, len(bounce.Attachments))
+	require.Equal(t, "message/delivery-status", bounce.Attachments[0].MIMEType)
+
+	status, err := ioutil.ReadAll(readers[0])
+	require.NoError(t, err)
+	require.Contains(t, string(status), "Final-Recipient: rfc822; bad@example.com\r\n")
+	require.Contains(t, string(status), "Original-Recipient: rfc822;bad@example.com\r\n")
+	require.Contains(t, string(status), "Action: failed\r\n")
+	require.NotContains(t, string(status), "quiet@example.com")
+
+	header, err := ioutil.ReadAll(readers[1])
+	require.NoError(t, err)
+	require.Equal(t, "Message-Id: <original@pm.me>\r\n\r\n", string(header))
+}
+
+func TestBuildBounceNotRequested(t *testing.T) {
+	failures := []deliveryFailure{
+		{Recipient: dsnRecipient{Address: "quiet@example.com", Notify: []string{dsnNotifyNever}}, Err: errors.New("address does not exist")},
+	}
+
+	bounce, readers := buildBounce(&pmapi.Address{Email: "me@pm.me"}, &pmapi.Message{}, nil, failures, time.Now())
+	require.Nil(t, bounce)
+	require.Nil(t, readers)
+}
+
+func TestBuildBounceReturnFull(t *testing.T) {
+	body := []byte("Message-Id: <original@pm.me>\r\n\r\nHello")
+	failures := []deliveryFailure{
+		{Recipient: dsnRecipient{Address: "bad@example.com", Return: dsnReturnFull, EnvelopeID: "QQ+2B123"}, Err: errors.New("address does not exist")},
+	}
+
+	bounce, readers := buildBounce(&pmapi.Address{Email: "me@pm.me"}, &pmapi.Message{}, body, failures, time.Now())
+	require.NotNil(t, bounce)
+	require.Equal(t, "message/rfc822", bounce.Attachments[1].MIMEType)
+
+	status, err := ioutil.ReadAll(readers[0])
+	require.NoError(t, err)
+	require.Contains(t, string(status), "Original-Envelope-Id: QQ+123\r\n")
+
+	returned, err := ioutil.ReadAll(readers[1])
+	require.NoError(t, err)
+	require.Equal(t, body, returned)
+}
+
+func TestBuildRelayNotice(t *testing.T) {
+	recipients := []dsnRecipient{
+		{Address: "default@example.com"},
+		{Address: "success@example.com", Notify: []string{dsnNotifySuccess}},
+	}
+
+	notice, readers := buildRelayNotice(&pmapi.Address{Email: "me@pm.me"}, &pmapi.Message{Subject: "Hello"}, nil, recipients, time.Now())
+	require.NotNil(t, notice)
+	require.Contains(t, notice.Body, "success@example.com")
+	require.NotContains(t, notice.Body, "default@example.com")
+
+	status, err := ioutil.ReadAll(readers[0])
+	require.NoError(t, err)
+	require.Contains(t, string(status), "Final-Recipient: rfc822; success@example.com\r\nAction: relayed\r\nStatus: 2.0.0\r\n")
+	require.NotContains(t, string(status), "default@example.com")
+
+	notice, _ = buildRelayNotice(&pmapi.Address{Email: "me@pm.me"}, &pmapi.Message{}, nil, recipients[:1], time.Now())
+	require.Nil(t, notice)
+}
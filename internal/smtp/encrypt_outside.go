@@ -0,0 +1,169 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/textproto"
+	"strings"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+const (
+	// encryptOutsidePasswordHeader holds the password used to encrypt the
+	// message to recipients outside of Proton without a public key. The value
+	// is either the password for all such recipients, or `address=password`
+	// for one recipient only. The header can be repeated.
+	encryptOutsidePasswordHeader = "X-Pm-Encrypt-Outside-Password"
+
+	// encryptOutsideHintHeader holds an optional password hint shown to the recipients.
+	encryptOutsideHintHeader = "X-Pm-Encrypt-Outside-Hint"
+
+	// outsideExpiration is used when the message encrypted to outside has
+	// no expiration set, because the API requires one for such messages.
+	outsideExpiration = message.MaxExpiration
+)
+
+// outsidePasswords holds passwords for messages encrypted to outside recipients.
+type outsidePasswords struct {
+	common       string
+	perRecipient map[string]string
+	hint         string
+
+	modulus *pmapi.AuthModulus
+	auths   map[string]*pmapi.PasswordAuth
+}
+
+// getOutsidePasswords reads passwords from encryptOutsidePasswordHeader and
+// returns the body without password headers, so they are not sent to recipients.
+func getOutsidePasswords(body []byte) (*outsidePasswords, []byte) {
+	passwords := &outsidePasswords{
+		perRecipient: map[string]string{},
+		auths:        map[string]*pmapi.PasswordAuth{},
+	}
+
+	header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(body))).ReadMIMEHeader()
+	if err != nil && len(header) == 0 {
+		return passwords, body
+	}
+
+	values, ok := header[textproto.CanonicalMIMEHeaderKey(encryptOutsidePasswordHeader)]
+	if !ok {
+		return passwords, body
+	}
+
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if idx := strings.Index(value, "="); idx > 0 && looksLikeEmail(value[:idx]) {
+			passwords.perRecipient[strings.ToLower(value[:idx])] = value[idx+1:]
+		} else {
+			passwords.common = value
+		}
+	}
+	passwords.hint = strings.TrimSpace(header.Get(encryptOutsideHintHeader))
+
+	body = removeHeaderField(body, encryptOutsidePasswordHeader)
+	body = removeHeaderField(body, encryptOutsideHintHeader)
+	return passwords, body
+}
+
+// get returns the password for the recipient, preferring the one set
+// only for that recipient. Empty string means no encryption to outside.
+func (p *outsidePasswords) get(email string) string {
+	if password, ok := p.perRecipient[strings.ToLower(email)]; ok {
+		return password
+	}
+	return p.common
+}
+
+// auth returns the SRP verifier of the password. Verifiers are generated
+// only once per password to not ask the API for a modulus for each recipient.
+func (p *outsidePasswords) auth(ctx context.Context, client pmapi.Client, password string) (*pmapi.PasswordAuth, error) {
+	if auth, ok := p.auths[password]; ok {
+		return auth, nil
+	}
+
+	if p.modulus == nil {
+		modulus, err := client.AuthModulus(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.modulus = modulus
+	}
+
+	auth, err := pmapi.NewPasswordAuth(password, p.modulus)
+	if err != nil {
+		return nil, err
+	}
+	p.auths[password] = auth
+	return auth, nil
+}
+
+// createOutsideAddress creates the recipient of the package encrypted to
+// outside with the session keys encrypted by the password.
+func createOutsideAddress(
+	password, hint string,
+	auth *pmapi.PasswordAuth,
+	bodyKey *crypto.SessionKey,
+	attkeys map[string]*crypto.SessionKey,
+) (*pmapi.MessageAddress, error) {
+	address := &pmapi.MessageAddress{
+		Type:                 pmapi.EncryptedOutsidePackage,
+		Signature:            pmapi.NoSignature,
+		AttachmentKeyPackets: make(map[string]string),
+		PasswordHint:         hint,
+		Auth:                 auth,
+	}
+
+	packet, err := crypto.EncryptSessionKeyWithPassword(bodyKey, []byte(password))
+	if err != nil {
+		return nil, err
+	}
+	address.BodyKeyPacket = base64.StdEncoding.EncodeToString(packet)
+
+	for id, attkey := range attkeys {
+		if packet, err = crypto.EncryptSessionKeyWithPassword(attkey, []byte(password)); err != nil {
+			return nil, err
+		}
+		address.AttachmentKeyPackets[id] = base64.StdEncoding.EncodeToString(packet)
+	}
+
+	// The token is used by the recipient to prove the knowledge of the password.
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	address.Token = base64.StdEncoding.EncodeToString(token)
+
+	encToken, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessageFromString(address.Token), []byte(password))
+	if err != nil {
+		return nil, err
+	}
+	if address.EncToken, err = encToken.GetArmored(); err != nil {
+		return nil, err
+	}
+
+	return address, nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOutsidePasswords(t *testing.T) {
+	body := []byte("From: a@example.com\r\n" +
+		"X-Pm-Encrypt-Outside-Password: common=secret\r\n" +
+		"X-Pm-Encrypt-Outside-Password: Bob@Example.com=bob=secret\r\n" +
+		"X-Pm-Encrypt-Outside-Hint: our secret\r\n" +
+		"Subject: hello\r\n\r\nbody\r\n")
+
+	passwords, stripped := getOutsidePasswords(body)
+	require.Equal(t, "From: a@example.com\r\nSubject: hello\r\n\r\nbody\r\n", string(stripped))
+	require.Equal(t, "bob=secret", passwords.get("bob@example.com"))
+	require.Equal(t, "common=secret", passwords.get("carol@example.com"))
+	require.Equal(t, "our secret", passwords.hint)
+}
+
+func TestGetOutsidePasswordsNone(t *testing.T) {
+	body := []byte("From: a@example.com\r\nSubject: hello\r\n\r\nbody\r\n")
+
+	passwords, stripped := getOutsidePasswords(body)
+	require.Equal(t, body, stripped)
+	require.Equal(t, "", passwords.get("bob@example.com"))
+}
+
+func TestCreateOutsideAddress(t *testing.T) {
+	bodyKey, err := crypto.GenerateSessionKey()
+	require.NoError(t, err)
+	attKey, err := crypto.GenerateSessionKey()
+	require.NoError(t, err)
+
+	auth := &pmapi.PasswordAuth{Version: 4}
+	address, err := createOutsideAddress("secret", "hint", auth, bodyKey, map[string]*crypto.SessionKey{"att": attKey})
+	require.NoError(t, err)
+	require.Equal(t, pmapi.EncryptedOutsidePackage, address.Type)
+	require.Equal(t, "hint", address.PasswordHint)
+	require.Equal(t, auth, address.Auth)
+
+	requireSessionKey(t, bodyKey, address.BodyKeyPacket, "secret")
+	requireSessionKey(t, attKey, address.AttachmentKeyPackets["att"], "secret")
+
+	encToken, err := crypto.NewPGPMessageFromArmored(address.EncToken)
+	require.NoError(t, err)
+	token, err := crypto.DecryptMessageWithPassword(encToken, []byte("secret"))
+	require.NoError(t, err)
+	require.Equal(t, address.Token, token.GetString())
+}
+
+func requireSessionKey(t *testing.T, want *crypto.SessionKey, packet, password string) {
+	data, err := base64.StdEncoding.DecodeString(packet)
+	require.NoError(t, err)
+	got, err := crypto.DecryptSessionKeyWithPassword(data, []byte(password))
+	require.NoError(t, err)
+	require.Equal(t, want.Key, got.Key)
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bufio"
+	"bytes"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+)
+
+// getExpiration returns after how long the sent message expires, either
+// from ExpiresInHeader or the default of the account, and the body without
+// the header, so it is not sent to recipients.
+func getExpiration(body []byte, defaultExpiration time.Duration) (time.Duration, []byte, error) {
+	header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(body))).ReadMIMEHeader()
+	if err != nil && len(header) == 0 {
+		return defaultExpiration, body, nil
+	}
+
+	values, ok := header[textproto.CanonicalMIMEHeaderKey(message.ExpiresInHeader)]
+	if !ok {
+		return defaultExpiration, body, nil
+	}
+
+	expiration, err := message.ParseExpiresIn(values[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	return expiration, removeHeaderField(body, message.ExpiresInHeader), nil
+}
+
+// removeHeaderField removes all occurrences of the field including their
+// continuation lines from the header of the raw message.
+func removeHeaderField(body []byte, key string) []byte {
+	out := make([]byte, 0, len(body))
+	prefix := strings.ToLower(key) + ":"
+	skipping := false
+
+	for rest := body; len(rest) > 0; {
+		end := bytes.IndexByte(rest, '\n') + 1
+		if end == 0 {
+			end = len(rest)
+		}
+		line := rest[:end]
+		rest = rest[end:]
+
+		// End of the header, the body is copied as it is.
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			out = append(out, line...)
+			return append(out, rest...)
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			if !skipping {
+				out = append(out, line...)
+			}
+			continue
+		}
+
+		skipping = strings.HasPrefix(strings.ToLower(string(line)), prefix)
+		if !skipping {
+			out = append(out, line...)
+		}
+	}
+	return out
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetExpirationFromHeader(t *testing.T) {
+	body := []byte("From: a@example.com\r\nX-Pm-Expires-In: 3600\r\nSubject: hello\r\n\r\nX-Pm-Expires-In: 10\r\n")
+
+	expiration, stripped, err := getExpiration(body, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, expiration)
+	require.Equal(t, "From: a@example.com\r\nSubject: hello\r\n\r\nX-Pm-Expires-In: 10\r\n", string(stripped))
+}
+
+func TestGetExpirationDefault(t *testing.T) {
+	body := []byte("From: a@example.com\r\nSubject: hello\r\n\r\nbody\r\n")
+
+	expiration, stripped, err := getExpiration(body, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, expiration)
+	require.Equal(t, body, stripped)
+}
+
+func TestGetExpirationInvalid(t *testing.T) {
+	for _, value := range []string{"0", "-5", "soon", "2419201"} {
+		_, _, err := getExpiration([]byte("X-Pm-Expires-In: "+value+"\r\n\r\nbody\r\n"), 0)
+		require.Error(t, err, value)
+	}
+}
+
+func TestRemoveHeaderFieldWithContinuation(t *testing.T) {
+	body := []byte("x-pm-expires-in:\r\n 60\r\nTo: b@example.com\r\n\tc@example.com\r\n\r\nbody")
+
+	require.Equal(t, "To: b@example.com\r\n\tc@example.com\r\n\r\nbody", string(removeHeaderField(body, "X-Pm-Expires-In")))
+}
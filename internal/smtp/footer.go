@@ -0,0 +1,194 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	pmmime "github.com/ProtonMail/proton-bridge/pkg/mime"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/emersion/go-message/textproto"
+	"github.com/jaytaylor/html2text"
+)
+
+// footer is the account footer in both variants so that the plain text and
+// HTML parts of a message get the same content.
+type footer struct {
+	text, html string
+}
+
+// newFooter completes the missing variant of the footer set by the user.
+func newFooter(text, html string) footer {
+	text, html = strings.TrimSpace(text), strings.TrimSpace(html)
+	if html == "" && text != "" {
+		html = message.PlaintextToHTML(text)
+	}
+	if text == "" && html != "" {
+		if plain, err := html2text.FromString(html); err == nil {
+			text = plain
+		}
+	}
+	return footer{text: text, html: html}
+}
+
+func (f footer) isEmpty() bool {
+	return f.text == "" && f.html == ""
+}
+
+// appendFooter appends the footer variant matching the MIME type to the body
+// unless it is there already, e.g. when the message is forwarded.
+func appendFooter(f footer, mimeType, body string) string {
+	if f.isEmpty() {
+		return body
+	}
+
+	if mimeType == pmapi.ContentTypePlainText {
+		if f.text == "" || strings.Contains(body, f.text) {
+			return body
+		}
+		return strings.TrimRight(body, "\r\n") + "\n\n" + f.text + "\n"
+	}
+
+	if strings.Contains(body, f.html) {
+		return body
+	}
+	return insertBeforeBodyEnd(body, `<div class="protonmail_footer">`+f.html+`</div>`)
+}
+
+// appendFooterToMIME appends the footer to the text parts forming the body
+// of the raw MIME message: each part of multipart/alternative gets its
+// variant and only the first part of other multiparts is the body. Other
+// parts, including signed and encrypted ones, are kept byte for byte.
+func appendFooterToMIME(f footer, mimeBody string) (string, error) {
+	if f.isEmpty() {
+		return mimeBody, nil
+	}
+
+	br := bufio.NewReader(strings.NewReader(mimeBody))
+	h, err := textproto.ReadHeader(br)
+	if err != nil {
+		return "", err
+	}
+
+	b := &bytes.Buffer{}
+	create := func(h textproto.Header) (io.Writer, error) {
+		if err := textproto.WriteHeader(b, h); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	if err := writeWithFooter(f, create, h, br, true); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// writeWithFooter writes the entity using create, which writes the header and
+// returns the writer for the body.
+func writeWithFooter(f footer, create func(textproto.Header) (io.Writer, error), h textproto.Header, body io.Reader, isBody bool) error {
+	mediaType, params, err := pmmime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = pmapi.ContentTypePlainText, map[string]string{}
+	}
+	disposition, _, _ := pmmime.ParseMediaType(h.Get("Content-Disposition"))
+	if disposition == "attachment" {
+		isBody = false
+	}
+
+	switch {
+	case isBody && (mediaType == pmapi.ContentTypePlainText || mediaType == pmapi.ContentTypeHTML):
+		return writeTextWithFooter(f, create, h, mediaType, params, body)
+
+	case isBody && strings.HasPrefix(mediaType, "multipart/") &&
+		mediaType != "multipart/signed" && mediaType != "multipart/encrypted" &&
+		params["boundary"] != "":
+		w, err := create(h)
+		if err != nil {
+			return err
+		}
+		mw := textproto.NewMultipartWriter(w)
+		if err := mw.SetBoundary(params["boundary"]); err != nil {
+			return err
+		}
+		mr := textproto.NewMultipartReader(body, params["boundary"])
+		for i := 0; ; i++ {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			partIsBody := mediaType == "multipart/alternative" || i == 0
+			if err := writeWithFooter(f, mw.CreatePart, p.Header, p, partIsBody); err != nil {
+				return err
+			}
+		}
+		return mw.Close()
+
+	default:
+		w, err := create(h)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, body)
+		return err
+	}
+}
+
+// writeTextWithFooter decodes the text part, appends the footer and writes it
+// back as quoted-printable UTF-8 which fits any footer. Parts with unknown
+// transfer encoding are kept as they are.
+func writeTextWithFooter(f footer, create func(textproto.Header) (io.Writer, error), h textproto.Header, mediaType string, params map[string]string, body io.Reader) error {
+	decoded := pmmime.DecodeContentEncoding(body, h.Get("Content-Transfer-Encoding"))
+	if decoded == nil {
+		w, err := create(h)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, body)
+		return err
+	}
+	data, err := ioutil.ReadAll(decoded)
+	if err != nil {
+		return err
+	}
+	if data, err = pmmime.DecodeCharset(data, h.Get("Content-Type")); err != nil {
+		return err
+	}
+
+	params["charset"] = "utf-8"
+	h.Set("Content-Type", pmmime.FormatMediaType(mediaType, params))
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	w, err := create(h)
+	if err != nil {
+		return err
+	}
+	qw := quotedprintable.NewWriter(w)
+	if _, err := qw.Write([]byte(appendFooter(f, mediaType, string(data)))); err != nil {
+		return err
+	}
+	return qw.Close()
+}
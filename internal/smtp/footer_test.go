@@ -0,0 +1,125 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFooter(t *testing.T) {
+	require.True(t, newFooter(" ", "").isEmpty())
+	require.Equal(t, footer{text: "Sent via bridge", html: "<div>Sent via bridge</div>"}, newFooter("Sent via bridge", ""))
+	require.Equal(t, footer{text: "Sent via *bridge*", html: "<p>Sent via <b>bridge</b></p>"}, newFooter("", "<p>Sent via <b>bridge</b></p>"))
+}
+
+func TestAppendFooter(t *testing.T) {
+	f := newFooter("Sent via bridge", "<i>Sent via bridge</i>")
+	block := `<div class="protonmail_footer"><i>Sent via bridge</i></div>`
+
+	testData := []struct {
+		mimeType, body, want string
+	}{
+		{pmapi.ContentTypeHTML, "<p>hi</p>", "<p>hi</p>" + block},
+		{pmapi.ContentTypeHTML, "<html><body><p>hi</p></body></html>", "<html><body><p>hi</p>" + block + "</body></html>"},
+		{pmapi.ContentTypeHTML, "<p>hi</p>" + block, "<p>hi</p>" + block},
+		{pmapi.ContentTypePlainText, "hi\r\n", "hi\n\nSent via bridge\n"},
+		{pmapi.ContentTypePlainText, "hi\n\nSent via bridge", "hi\n\nSent via bridge"},
+	}
+
+	for _, td := range testData {
+		require.Equal(t, td.want, appendFooter(f, td.mimeType, td.body), "%s %q", td.mimeType, td.body)
+	}
+}
+
+func TestAppendFooterToMIMEAlternative(t *testing.T) {
+	body := "From: Alice <alice@example.com>\r\n" +
+		"Subject: Hello\r\n" +
+		"Content-Type: multipart/mixed; boundary=mixed\r\n" +
+		"\r\n" +
+		"--mixed\r\n" +
+		"Content-Type: multipart/alternative; boundary=alt\r\n" +
+		"\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Gr=FC=DFe\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"PGh0bWw+PGJvZHk+R3LDvMOfZTwvYm9keT48L2h0bWw+\r\n" +
+		"--alt--\r\n" +
+		"--mixed\r\n" +
+		"Content-Type: text/plain; name=notes.txt\r\n" +
+		"Content-Disposition: attachment; filename=notes.txt\r\n" +
+		"\r\n" +
+		"notes\r\n" +
+		"--mixed--\r\n"
+
+	f := newFooter("Sent via bridge", "<i>Sent via bridge</i>")
+	withFooter, err := appendFooterToMIME(f, body)
+	require.NoError(t, err)
+
+	m, _, plain, atts, err := message.Parse(strings.NewReader(withFooter), "", "")
+	require.NoError(t, err)
+	require.Equal(t, "Hello", m.Subject)
+	require.Equal(t, `<html><head></head><body>Grüße<div class="protonmail_footer"><i>Sent via bridge</i></div></body></html>`, m.Body)
+	require.Equal(t, "Grüße\r\n\r\nSent via bridge\r\n", plain)
+	require.Len(t, atts, 1)
+	require.Contains(t, withFooter, "\r\nnotes\r\n--mixed--\r\n")
+
+	again, err := appendFooterToMIME(f, withFooter)
+	require.NoError(t, err)
+	require.Equal(t, withFooter, again)
+}
+
+func TestAppendFooterToMIMEKeepsSigned(t *testing.T) {
+	body := "From: Alice <alice@example.com>\r\n" +
+		"Content-Type: multipart/signed; boundary=signed; protocol=\"application/pgp-signature\"\r\n" +
+		"\r\n" +
+		"--signed\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"hi\r\n" +
+		"--signed\r\n" +
+		"Content-Type: application/pgp-signature\r\n" +
+		"\r\n" +
+		"signature\r\n" +
+		"--signed--\r\n"
+
+	withFooter, err := appendFooterToMIME(newFooter("Sent via bridge", ""), body)
+	require.NoError(t, err)
+	require.Equal(t, body, withFooter)
+}
+
+func TestAppendFooterToMIMEPlain(t *testing.T) {
+	body := "Subject: Hello\r\n\r\nhi\r\n"
+
+	withFooter, err := appendFooterToMIME(newFooter("Sent via bridge", ""), body)
+	require.NoError(t, err)
+	require.Contains(t, withFooter, "Subject: Hello\r\n")
+	require.Contains(t, withFooter, "Content-Type: text/plain; charset=utf-8\r\n")
+	require.Contains(t, withFooter, "Content-Transfer-Encoding: quoted-printable\r\n")
+	require.True(t, strings.HasSuffix(withFooter, "\r\n\r\nhi\r\n\r\nSent via bridge\r\n"), withFooter)
+}
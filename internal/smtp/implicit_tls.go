@@ -0,0 +1,62 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+// SetImplicitTLSPort starts a server with implicit TLS on the port, as used
+// by clients supporting only port 465 style configuration. It is served in
+// addition to the main port, no matter whether the main port uses SSL or
+// STARTTLS. The previous server is stopped unless it already serves the
+// port. Zero port stops the server.
+func (s *smtpServer) SetImplicitTLSPort(port int) {
+	s.implicitTLSServerLock.Lock()
+	defer s.implicitTLSServerLock.Unlock()
+
+	if s.implicitTLSServer != nil && s.implicitTLSServer.port == port {
+		return
+	}
+
+	if s.implicitTLSServer != nil {
+		log.WithField("address", s.implicitTLSServer.server.Addr).Info("Closing SMTP port with implicit TLS")
+		// Server closes its connections once the listener is closed.
+		_ = s.implicitTLSServer.listener.Close()
+		s.implicitTLSServer = nil
+	}
+
+	if port == 0 {
+		return
+	}
+
+	server := newGoSMTPServer(s.debug, port, s.server.TLSConfig, s.backend)
+
+	l, err := s.listen(server.Addr, true)
+	if err != nil {
+		log.WithError(err).WithField("port", port).Error("Cannot listen on SMTP port with implicit TLS")
+		return
+	}
+	implicitTLSServer := newAccountServer(server, l, port)
+	s.implicitTLSServer = implicitTLSServer
+
+	go func() {
+		defer s.backend.panicHandler.HandlePanic()
+
+		log.WithField("port", port).Info("SMTP server with implicit TLS is starting")
+		if err := server.Serve(implicitTLSServer.listener); err != nil {
+			log.WithError(err).WithField("port", port).Info("SMTP server with implicit TLS stopped")
+		}
+	}()
+}
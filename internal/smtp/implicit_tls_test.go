@@ -0,0 +1,77 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+type testPanicHandler struct{}
+
+func (testPanicHandler) HandlePanic() {}
+
+func getFreeTestPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close() //nolint[errcheck]
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestImplicitTLSPort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "implicit-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	tlsConfig, err := config.GenerateTLSConfig(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	require.NoError(t, err)
+
+	backend := &smtpBackend{panicHandler: testPanicHandler{}}
+	s := &smtpServer{server: newGoSMTPServer(false, getFreeTestPort(t), tlsConfig, backend), backend: backend}
+
+	port := getFreeTestPort(t)
+	s.SetImplicitTLSPort(port)
+	defer s.SetImplicitTLSPort(0)
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true}) //nolint[gosec]
+	require.NoError(t, err)
+	defer conn.Close() //nolint[errcheck]
+
+	text := textproto.NewConn(conn)
+	_, _, err = text.ReadResponse(220)
+	require.NoError(t, err)
+
+	msg := cmd(t, text, 250, "EHLO localhost")
+	require.NotContains(t, msg, "STARTTLS")
+	require.Contains(t, msg, "AUTH")
+
+	s.SetImplicitTLSPort(0)
+	_, err = net.Dial("tcp", addr)
+	require.Error(t, err)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxMessageSize is the limit of Proton API on the size of the message
+// including attachments.
+const maxMessageSize = 25 * 1024 * 1024
+
+var (
+	// maxMessageBytes is the size of MIME message advertised by SIZE.
+	// Attachments are base64 encoded in MIME which adds a third and line
+	// breaks; one megabyte is left for headers.
+	maxMessageBytes int64 = maxMessageSize*4/3*78/76 + 1024*1024 //nolint[gochecknoglobals]
+
+	// maxRecipients is the limit of Proton API on recipients of a message.
+	// More recipients are refused by 452 and clients send the message
+	// to the rest in another transaction (RFC 5321 section 4.5.3.1.10).
+	maxRecipients = 100 //nolint[gochecknoglobals]
+
+	// maxLineLength is the limit on lines of commands. RFC 5321 requires
+	// only 512 octets, more is allowed for long AUTH responses, e.g. OAuth
+	// tokens. Lines of the message sent by DATA are not limited.
+	maxLineLength = 16 * 1024 //nolint[gochecknoglobals]
+)
+
+// errMessageTooLarge is returned for messages over the limit; chunkingConn
+// responds to it by 552 as it is a permanent failure of the message itself.
+var errMessageTooLarge = errors.New("5.3.4 Message exceeds the size limit of 25 MB")
+
+const (
+	tooManyRecipientsMessage = "4.5.3 Too many recipients, send the message to the rest in another transaction"
+	lineTooLongMessage       = "5.5.2 Line too long"
+	noRecipientsMessage      = "5.5.1 Missing MAIL FROM or RCPT TO command"
+)
+
+// readMessage reads the whole message when it is not over the size limit.
+// Otherwise, the rest of the message is skipped so the client gets the
+// response to the DATA command.
+func readMessage(r io.Reader) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r, maxMessageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(body)) > maxMessageBytes {
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			return nil, err
+		}
+		return nil, errMessageTooLarge
+	}
+
+	return body, nil
+}
+
+// getMailSize returns the value of SIZE parameter of MAIL command
+// (RFC 1870) or zero if not present.
+func getMailSize(arg string) int64 {
+	for _, param := range strings.Fields(arg) {
+		if len(param) > 5 && strings.EqualFold(param[:5], "SIZE=") {
+			size, _ := strconv.ParseInt(param[5:], 10, 64)
+			return size
+		}
+	}
+	return 0
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"net/mail"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// Message-ID policies decide who generates Message-ID of sent messages
+// which have none. Message-ID set by the client is always kept, so the
+// client can match the sent message with its own copy.
+const (
+	// MessageIDPolicyCustomDomain generates Message-ID in the domain of the
+	// sender address when it is in a custom domain. Messages from Proton
+	// domains get Message-ID from API.
+	MessageIDPolicyCustomDomain = "custom-domain"
+
+	// MessageIDPolicyAlways generates Message-ID in the domain of any
+	// sender address.
+	MessageIDPolicyAlways = "always"
+
+	// MessageIDPolicyAPI leaves generating of Message-ID to API.
+	MessageIDPolicyAPI = "api"
+)
+
+// IsValidMessageIDPolicy returns whether policy is one of known Message-ID
+// policies.
+func IsValidMessageIDPolicy(policy string) bool {
+	switch policy {
+	case MessageIDPolicyCustomDomain, MessageIDPolicyAlways, MessageIDPolicyAPI:
+		return true
+	}
+	return false
+}
+
+// messageIDPolicy returns the policy of generating Message-ID.
+func (sb *smtpBackend) messageIDPolicy() string {
+	policy := sb.preferences.Get(preferences.MessageIDPolicyKey)
+	if !IsValidMessageIDPolicy(policy) {
+		return MessageIDPolicyCustomDomain
+	}
+	return policy
+}
+
+// normalizeOutgoingHeader unfolds the header of the sent message and sets
+// new unique Message-ID according to the policy.
+func normalizeOutgoingHeader(h mail.Header, policy string, addr *pmapi.Address) error {
+	message.NormalizeOutgoingHeader(h)
+
+	if h.Get("Message-Id") != "" {
+		return nil
+	}
+
+	domain := addressDomain(addr.Email)
+	switch {
+	case policy == MessageIDPolicyAlways && domain != "":
+	case policy == MessageIDPolicyCustomDomain && domain != "" && addr.Type == pmapi.CustomAddress:
+	default:
+		return nil
+	}
+
+	id, err := message.GenerateMessageID(domain)
+	if err != nil {
+		return err
+	}
+	h["Message-Id"] = []string{id}
+	return nil
+}
+
+func addressDomain(address string) string {
+	at := strings.LastIndexByte(address, '@')
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(address[at+1:])
+}
+
+// normalizeOutgoingMIME writes the header of the MIME body in the fixed order
+// and folded, so its signature is not broken by relays rewriting it.
+func normalizeOutgoingMIME(mimeBody string) (string, error) {
+	return message.NormalizeOutgoingMIME(mimeBody)
+}
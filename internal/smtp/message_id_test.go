@@ -0,0 +1,59 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"net/mail"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeOutgoingHeaderMessageID(t *testing.T) {
+	custom := &pmapi.Address{Email: "Alice@Example.com", Type: pmapi.CustomAddress}
+	proton := &pmapi.Address{Email: "alice@pm.me", Type: pmapi.OriginalAddress}
+	tests := []struct {
+		policy string
+		addr   *pmapi.Address
+		header mail.Header
+		domain string
+	}{
+		{MessageIDPolicyCustomDomain, custom, mail.Header{}, "example.com"},
+		{MessageIDPolicyCustomDomain, proton, mail.Header{}, ""},
+		{MessageIDPolicyAlways, proton, mail.Header{}, "pm.me"},
+		{MessageIDPolicyAPI, custom, mail.Header{}, ""},
+		{MessageIDPolicyAlways, custom, mail.Header{"Message-Id": {"<client@localhost>"}}, "localhost"},
+	}
+
+	for _, test := range tests {
+		require.NoError(t, normalizeOutgoingHeader(test.header, test.policy, test.addr))
+		id := test.header.Get("Message-Id")
+		if test.domain == "" {
+			require.Empty(t, id, test.policy)
+		} else {
+			require.Regexp(t, "@"+test.domain+">$", id, test.policy)
+		}
+	}
+
+	// Message sent again gets a new ID.
+	first, second := mail.Header{}, mail.Header{}
+	require.NoError(t, normalizeOutgoingHeader(first, MessageIDPolicyCustomDomain, custom))
+	require.NoError(t, normalizeOutgoingHeader(second, MessageIDPolicyCustomDomain, custom))
+	require.NotEqual(t, first.Get("Message-Id"), second.Get("Message-Id"))
+}
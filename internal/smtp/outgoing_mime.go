@@ -0,0 +1,41 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// forceOutgoingMIMEType returns the composer MIME type and HTML body used for
+// packaging according to the account setting. Plain text is always taken from
+// the plain body which parser converts from HTML when needed.
+func forceOutgoingMIMEType(mode, composerMIMEType, htmlBody string) (string, string) {
+	switch mode {
+	case store.OutgoingMIMEPlain:
+		return pmapi.ContentTypePlainText, htmlBody
+	case store.OutgoingMIMEHTML:
+		if composerMIMEType == pmapi.ContentTypePlainText {
+			htmlBody = message.PlaintextToHTML(htmlBody)
+		}
+		return pmapi.ContentTypeHTML, htmlBody
+	default:
+		return composerMIMEType, htmlBody
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForceOutgoingMIMEType(t *testing.T) {
+	testData := []struct {
+		mode, mimeType, body   string
+		wantMIMEType, wantBody string
+	}{
+		{store.OutgoingMIMEClient, pmapi.ContentTypeHTML, "<b>hi</b>", pmapi.ContentTypeHTML, "<b>hi</b>"},
+		{store.OutgoingMIMEClient, pmapi.ContentTypePlainText, "hi", pmapi.ContentTypePlainText, "hi"},
+		{store.OutgoingMIMEPlain, pmapi.ContentTypeHTML, "<b>hi</b>", pmapi.ContentTypePlainText, "<b>hi</b>"},
+		{store.OutgoingMIMEHTML, pmapi.ContentTypeHTML, "<b>hi</b>", pmapi.ContentTypeHTML, "<b>hi</b>"},
+		{store.OutgoingMIMEHTML, pmapi.ContentTypePlainText, "a < b\nc", pmapi.ContentTypeHTML, "<div>a &lt; b<br>c</div>"},
+	}
+
+	for _, td := range testData {
+		gotMIMEType, gotBody := forceOutgoingMIMEType(td.mode, td.mimeType, td.body)
+		require.Equal(t, td.wantMIMEType, gotMIMEType, "mode %s from %s", td.mode, td.mimeType)
+		require.Equal(t, td.wantBody, gotBody, "mode %s from %s", td.mode, td.mimeType)
+	}
+}
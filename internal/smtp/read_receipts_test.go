@@ -0,0 +1,36 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"net/mail"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestReadReceipt(t *testing.T) {
+	m := &pmapi.Message{}
+	requestReadReceipt(m, "me@pm.me")
+	require.Equal(t, "<me@pm.me>", m.Header.Get("Disposition-Notification-To"))
+
+	m = &pmapi.Message{Header: mail.Header{"Disposition-Notification-To": {"other@pm.me"}}}
+	requestReadReceipt(m, "me@pm.me")
+	require.Equal(t, "other@pm.me", m.Header.Get("Disposition-Notification-To"))
+}
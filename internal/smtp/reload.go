@@ -0,0 +1,188 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	goSMTP "github.com/emersion/go-smtp"
+)
+
+var errListenerClosed = errors.New("listener closed")
+
+// switchableListener passes connections of the current listener to the
+// server. go-smtp server closes all its connections once its listener
+// fails, so the listener is replaced here instead and connections accepted
+// before are served until clients close them.
+type switchableListener struct {
+	conns chan net.Conn
+	errs  chan error
+
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	lock    sync.Mutex
+	current net.Listener
+}
+
+func newSwitchableListener() *switchableListener {
+	return &switchableListener{
+		conns:  make(chan net.Conn),
+		errs:   make(chan error, 1),
+		closed: make(chan struct{}),
+	}
+}
+
+// set starts accepting connections of the listener and closes the previous
+// one. Failure of the current listener is returned by Accept.
+func (sl *switchableListener) set(l net.Listener) {
+	sl.lock.Lock()
+	previous := sl.current
+	sl.current = l
+	sl.lock.Unlock()
+
+	if previous != nil {
+		_ = previous.Close()
+	}
+
+	go sl.accept(l)
+}
+
+func (sl *switchableListener) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if sl.isCurrent(l) {
+				select {
+				case sl.errs <- err:
+				default:
+				}
+			}
+			return
+		}
+
+		select {
+		case sl.conns <- conn:
+		case <-sl.closed:
+			_ = conn.Close()
+			return
+		}
+	}
+}
+
+// isSet returns whether any listener was set, i.e. the server is running.
+func (sl *switchableListener) isSet() bool {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+
+	return sl.current != nil
+}
+
+func (sl *switchableListener) isCurrent(l net.Listener) bool {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+
+	return sl.current == l
+}
+
+func (sl *switchableListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-sl.conns:
+		return conn, nil
+	case err := <-sl.errs:
+		return nil, err
+	case <-sl.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (sl *switchableListener) Close() error {
+	sl.closeOnce.Do(func() { close(sl.closed) })
+
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+
+	if sl.current == nil {
+		return nil
+	}
+	return sl.current.Close()
+}
+
+func (sl *switchableListener) Addr() net.Addr {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+
+	return sl.current.Addr()
+}
+
+// Reload moves the main port to the given port and security and ports
+// dedicated to accounts and the port with implicit TLS to the current bind
+// address without stopping the servers. Connections accepted before are
+// served until clients close them. The current main port is kept when the
+// new one cannot be opened.
+func (s *smtpServer) Reload(port int, useSSL bool) {
+	if !s.listener.isSet() {
+		log.Warn("SMTP server is not running, restart is needed to apply the settings")
+		return
+	}
+
+	address := bridge.GetListenAddress(port)
+
+	l, err := s.listen(address, useSSL)
+	if err != nil {
+		s.eventListener.Emit(events.ErrorEvent, "SMTP failed: "+err.Error())
+		log.WithError(err).WithField("address", address).Error("Cannot move SMTP server")
+		return
+	}
+
+	log.WithField("useSSL", useSSL).WithField("address", address).Info("SMTP server listening")
+	s.listener.set(l)
+
+	s.accountServersLock.Lock()
+	s.useSSL = useSSL
+	for _, account := range s.accountServers {
+		s.reopen(account, useSSL)
+	}
+	s.accountServersLock.Unlock()
+
+	s.implicitTLSServerLock.Lock()
+	if s.implicitTLSServer != nil {
+		s.reopen(s.implicitTLSServer, true)
+	}
+	s.implicitTLSServerLock.Unlock()
+}
+
+// newAccountServer returns server of the listener which can be reopened.
+func newAccountServer(server *goSMTP.Server, l net.Listener, port int) *accountServer {
+	listener := newSwitchableListener()
+	listener.set(l)
+	return &accountServer{server: server, listener: listener, port: port}
+}
+
+func (s *smtpServer) reopen(account *accountServer, useSSL bool) {
+	l, err := s.listen(bridge.GetListenAddress(account.port), useSSL)
+	if err != nil {
+		log.WithError(err).WithField("port", account.port).Error("Cannot reopen SMTP port")
+		return
+	}
+	account.listener.set(l)
+}
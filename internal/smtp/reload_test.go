@@ -0,0 +1,84 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadKeepsOpenConnections(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	tlsConfig, err := config.GenerateTLSConfig(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	require.NoError(t, err)
+
+	port := getFreeTestPort(t)
+	backend := &smtpBackend{panicHandler: testPanicHandler{}}
+	s := &smtpServer{
+		server:         newGoSMTPServer(false, port, tlsConfig, backend),
+		listener:       newSwitchableListener(),
+		backend:        backend,
+		accountServers: map[int]*accountServer{},
+	}
+	go s.listenAndServe() //nolint[errcheck]
+	defer s.Close()
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	require.Eventually(t, func() bool {
+		return s.listener.isSet()
+	}, time.Second, 10*time.Millisecond)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close() //nolint[errcheck]
+
+	text := textproto.NewConn(conn)
+	_, _, err = text.ReadResponse(220)
+	require.NoError(t, err)
+
+	newPort := getFreeTestPort(t)
+	s.Reload(newPort, true)
+
+	_, err = net.Dial("tcp", addr)
+	require.Error(t, err)
+
+	// Connection to the previous port is still served.
+	cmd(t, text, 250, "EHLO localhost")
+
+	newConn, err := tls.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(newPort)), &tls.Config{InsecureSkipVerify: true}) //nolint[gosec]
+	require.NoError(t, err)
+	defer newConn.Close() //nolint[errcheck]
+
+	newText := textproto.NewConn(newConn)
+	_, _, err = newText.ReadResponse(220)
+	require.NoError(t, err)
+	require.NotContains(t, cmd(t, newText, 250, "EHLO localhost"), "STARTTLS")
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bufio"
+	"bytes"
+	"net/textproto"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+const (
+	scheduledTimeHeader = message.ScheduledTimeHeader
+
+	// scheduleMinDelay is how far in the future the time has to be for the
+	// message to be scheduled. It prevents scheduling because of clock skew
+	// of the client.
+	scheduleMinDelay = time.Minute
+
+	scheduledSendInterval    = time.Minute
+	scheduledSendMaxAttempts = 5
+)
+
+// getScheduledTime returns the time when the message should be sent if it is
+// scheduled to be sent later.
+func (sb *smtpBackend) getScheduledTime(body []byte, now time.Time) (time.Time, bool) {
+	header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(body))).ReadMIMEHeader()
+	if err != nil && len(header) == 0 {
+		return time.Time{}, false
+	}
+
+	sendAt, ok := message.ParseScheduledTime(header.Get(scheduledTimeHeader))
+	if !ok && sb.preferences.GetBool(preferences.ScheduleByDateKey) {
+		sendAt, ok = message.ParseScheduledTime(header.Get("Date"))
+	}
+
+	if !ok || !sendAt.After(now.Add(scheduleMinDelay)) {
+		return time.Time{}, false
+	}
+	return sendAt, true
+}
+
+// scheduleMessage queues the message in the outbox of the user.
+func (su *smtpUser) scheduleMessage(sendAt time.Time, from string, to []string, body []byte) error {
+	addr := su.client().Addresses().ByEmail(from)
+	if addr == nil {
+		return errors.New("backend: invalid email address: not owned by user")
+	}
+
+	kr, err := su.client().KeyRingForAddressID(addr.ID)
+	if err != nil {
+		return err
+	}
+
+	id, err := su.storeUser.ScheduleMessage(kr, sendAt, from, to, body)
+	if err != nil {
+		return err
+	}
+
+	log.WithField("id", id).WithField("sendAt", sendAt).Info("Message scheduled to be sent later")
+	return nil
+}
+
+// watchScheduledMessages sends due messages from outboxes of all connected
+// users periodically and as soon as internet connection is back. Messages are
+// kept in the store, so they are sent after restart too.
+func (sb *smtpBackend) watchScheduledMessages() {
+	ticker := time.NewTicker(scheduledSendInterval)
+	defer ticker.Stop()
+
+	internetOnCh := make(chan string)
+	sb.eventListener.Add(events.InternetOnEvent, internetOnCh)
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-internetOnCh:
+		}
+
+		for _, user := range sb.bridge.GetUsers() {
+			if user.IsConnected() {
+				sb.sendDueMessages(user, time.Now())
+			}
+		}
+	}
+}
+
+func (sb *smtpBackend) sendDueMessages(user bridgeUser, now time.Time) {
+	storeUser := user.GetStore()
+	if storeUser == nil {
+		return
+	}
+
+	msgs, err := storeUser.GetDueScheduledMessages(now)
+	if err != nil {
+		log.WithError(err).Error("Cannot get scheduled messages")
+		return
+	}
+
+	for _, msg := range msgs {
+		l := log.WithField("id", msg.ID)
+
+		err := sb.sendScheduledMessage(user, storeUser, msg)
+		if errors.Cause(err) == pmapi.ErrAPINotReachable {
+			// Not counted as an attempt; the rest is retried once API is back.
+			l.Warn("API not reachable, outbox will be retried")
+			if err := storeUser.SetScheduledMessageError(msg.ID, err.Error()); err != nil {
+				l.WithError(err).Error("Cannot update scheduled message")
+			}
+			return
+		}
+
+		if err != nil && isDeliveryFailure(err) {
+			// Rejected recipients were reported by the bounce already.
+			l.WithError(err).Error("Scheduled message rejected, giving up")
+		} else if err != nil {
+			attempts, attemptsErr := storeUser.IncrementScheduledMessageAttempts(msg.ID, err.Error())
+			if attemptsErr == nil && attempts < scheduledSendMaxAttempts {
+				l.WithError(err).Warn("Scheduled message not sent, it will be retried")
+				continue
+			}
+			l.WithError(err).Error("Scheduled message not sent, giving up")
+		} else {
+			l.Info("Scheduled message sent")
+		}
+
+		if err := storeUser.RemoveScheduledMessage(msg.ID); err != nil {
+			l.WithError(err).Error("Cannot remove scheduled message")
+		}
+	}
+}
+
+func (sb *smtpBackend) sendScheduledMessage(user bridgeUser, storeUser storeUserProvider, msg *store.ScheduledMessage) error {
+	client := user.GetTemporaryPMAPIClient()
+
+	addr := client.Addresses().ByEmail(msg.From)
+	if addr == nil {
+		return errors.New("sender address does not exist anymore")
+	}
+
+	kr, err := client.KeyRingForAddressID(addr.ID)
+	if err != nil {
+		return err
+	}
+
+	body, err := msg.Decrypt(kr)
+	if err != nil {
+		return err
+	}
+
+	// AddressID is only for split mode--it has to be empty for combined mode.
+	addressID := ""
+	if !user.IsCombinedAddressMode() {
+		addressID = addr.ID
+	}
+
+	su := &smtpUser{
+		panicHandler:   sb.panicHandler,
+		eventListener:  sb.eventListener,
+		backend:        sb,
+		user:           user,
+		storeUser:      storeUser,
+		addressID:      addressID,
+		bounceFailures: true,
+	}
+	return su.send(msg.From, msg.To, body)
+}
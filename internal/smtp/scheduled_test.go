@@ -0,0 +1,173 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	pmapimocks "github.com/ProtonMail/proton-bridge/pkg/pmapi/mocks"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestScheduleBackend(t *testing.T) (*smtpBackend, func()) {
+	dir, err := ioutil.TempDir("", "schedule")
+	require.NoError(t, err)
+
+	pref := config.NewPreferences(filepath.Join(dir, "prefs.json"))
+	return &smtpBackend{panicHandler: testPanicHandler{}, preferences: pref}, func() { _ = os.RemoveAll(dir) }
+}
+
+func TestGetScheduledTime(t *testing.T) {
+	sb, clear := newTestScheduleBackend(t)
+	defer clear()
+
+	now := time.Unix(1136214245, 0)
+	later := now.Add(time.Hour).UTC().Format(time.RFC1123Z)
+
+	sendAt, ok := sb.getScheduledTime([]byte("X-Pm-Scheduled-Time: "+later+"\r\nSubject: x\r\n\r\nBody\r\n"), now)
+	require.True(t, ok)
+	require.Equal(t, now.Add(time.Hour).Unix(), sendAt.Unix())
+
+	_, ok = sb.getScheduledTime([]byte("X-Pm-Scheduled-Time: "+now.Add(10*time.Second).UTC().Format(time.RFC1123Z)+"\r\n\r\nBody\r\n"), now)
+	require.False(t, ok, "time within the minimal delay is sent right away")
+
+	withDate := []byte("Date: " + later + "\r\nSubject: x\r\n\r\nBody\r\n")
+	_, ok = sb.getScheduledTime(withDate, now)
+	require.False(t, ok, "date is not used unless enabled")
+
+	sb.preferences.SetBool(preferences.ScheduleByDateKey, true)
+	_, ok = sb.getScheduledTime(withDate, now)
+	require.True(t, ok)
+}
+
+type testScheduleStore struct {
+	storeUserProvider
+
+	msgs     []*store.ScheduledMessage
+	attempts map[string]int
+	errors   map[string]string
+	removed  []string
+}
+
+func (s *testScheduleStore) GetDueScheduledMessages(now time.Time) ([]*store.ScheduledMessage, error) {
+	return s.msgs, nil
+}
+
+func (s *testScheduleStore) IncrementScheduledMessageAttempts(id, lastError string) (int, error) {
+	s.attempts[id]++
+	s.errors[id] = lastError
+	return s.attempts[id], nil
+}
+
+func (s *testScheduleStore) SetScheduledMessageError(id, lastError string) error {
+	s.errors[id] = lastError
+	return nil
+}
+
+func (s *testScheduleStore) RemoveScheduledMessage(id string) error {
+	s.removed = append(s.removed, id)
+	return nil
+}
+
+type testScheduleUser struct {
+	bridgeUser
+
+	client pmapi.Client
+	store  *testScheduleStore
+}
+
+func (u *testScheduleUser) GetTemporaryPMAPIClient() pmapi.Client { return u.client }
+func (u *testScheduleUser) GetStore() storeUserProvider           { return u.store }
+
+func TestSendDueMessagesGivesUp(t *testing.T) {
+	sb, clear := newTestScheduleBackend(t)
+	defer clear()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := pmapimocks.NewMockClient(ctrl)
+	client.EXPECT().Addresses().Return(pmapi.AddressList{}).AnyTimes()
+
+	storeUser := &testScheduleStore{
+		msgs:     []*store.ScheduledMessage{{ID: "id", From: "removed@pm.me"}},
+		attempts: map[string]int{},
+		errors:   map[string]string{},
+	}
+	user := &testScheduleUser{client: client, store: storeUser}
+
+	for i := 1; i < scheduledSendMaxAttempts; i++ {
+		sb.sendDueMessages(user, time.Now())
+		require.Equal(t, i, storeUser.attempts["id"])
+		require.Empty(t, storeUser.removed)
+	}
+
+	sb.sendDueMessages(user, time.Now())
+	require.Equal(t, []string{"id"}, storeUser.removed)
+}
+
+func TestSendDueMessagesWaitsForAPI(t *testing.T) {
+	sb, clear := newTestScheduleBackend(t)
+	defer clear()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := pmapimocks.NewMockClient(ctrl)
+	client.EXPECT().Addresses().Return(pmapi.AddressList{{ID: "addressID", Email: "user@pm.me"}})
+	client.EXPECT().KeyRingForAddressID("addressID").Return(nil, pmapi.ErrAPINotReachable)
+
+	storeUser := &testScheduleStore{
+		msgs: []*store.ScheduledMessage{
+			{ID: "first", From: "user@pm.me"},
+			{ID: "second", From: "user@pm.me"},
+		},
+		attempts: map[string]int{},
+		errors:   map[string]string{},
+	}
+
+	sb.sendDueMessages(&testScheduleUser{client: client, store: storeUser}, time.Now())
+	require.Empty(t, storeUser.attempts)
+	require.Empty(t, storeUser.removed)
+	require.Equal(t, map[string]string{"first": pmapi.ErrAPINotReachable.Error()}, storeUser.errors)
+}
+
+func TestSendScheduledMessageRequiresAddress(t *testing.T) {
+	sb, clear := newTestScheduleBackend(t)
+	defer clear()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := pmapimocks.NewMockClient(ctrl)
+	client.EXPECT().Addresses().Return(pmapi.AddressList{{ID: "addressID", Email: "user@pm.me"}})
+	client.EXPECT().KeyRingForAddressID("addressID").Return(nil, errors.New("locked"))
+
+	err := sb.sendScheduledMessage(&testScheduleUser{client: client}, nil, &store.ScheduledMessage{From: "user@pm.me"})
+	require.EqualError(t, err, "locked")
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Send policy actions restricting where messages can be sent.
+const (
+	// SendPolicyBlock rejects messages to recipients in the domain.
+	SendPolicyBlock = "block"
+
+	// SendPolicyEncrypt rejects messages to recipients in the domain which
+	// would not be end-to-end encrypted.
+	SendPolicyEncrypt = "encrypt"
+
+	// SendPolicyWarnExternal warns when a message from an address in the
+	// domain is sent to recipients outside of it. The message is sent.
+	SendPolicyWarnExternal = "warn-external"
+)
+
+// SendPolicy applies the action to messages sent to (or from, in case of
+// SendPolicyWarnExternal) the domain and its subdomains.
+type SendPolicy struct {
+	Action string
+	Domain string
+}
+
+// ParseSendPolicies parses comma-separated policies in the format
+// `action:domain`, e.g. `block:example.com,encrypt:partner.org`.
+func ParseSendPolicies(value string) (policies []SendPolicy, err error) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected action:domain, got %q", item)
+		}
+
+		action := strings.TrimSpace(parts[0])
+		switch action {
+		case SendPolicyBlock, SendPolicyEncrypt, SendPolicyWarnExternal:
+		default:
+			return nil, fmt.Errorf("unknown send policy action %q", action)
+		}
+
+		domain := strings.ToLower(strings.Trim(strings.TrimSpace(parts[1]), "."))
+		if domain == "" || strings.ContainsAny(domain, "@ ") {
+			return nil, fmt.Errorf("invalid domain %q", parts[1])
+		}
+
+		policies = append(policies, SendPolicy{Action: action, Domain: domain})
+	}
+
+	return policies, nil
+}
+
+// FormatSendPolicies returns policies in the format accepted by
+// ParseSendPolicies.
+func FormatSendPolicies(policies []SendPolicy) string {
+	items := []string{}
+	for _, policy := range policies {
+		items = append(items, policy.Action+":"+policy.Domain)
+	}
+	return strings.Join(items, ",")
+}
+
+// isInDomain returns whether the email is in the domain or its subdomain.
+func isInDomain(email, domain string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	emailDomain := strings.ToLower(email[at+1:])
+	return emailDomain == domain || strings.HasSuffix(emailDomain, "."+domain)
+}
+
+// getPolicyDomain returns the domain of the first policy with the action
+// matching the email or empty string.
+func getPolicyDomain(policies []SendPolicy, action, email string) string {
+	for _, policy := range policies {
+		if policy.Action == action && isInDomain(email, policy.Domain) {
+			return policy.Domain
+		}
+	}
+	return ""
+}
+
+// checkBlockedRecipients returns the error for the first recipient in the
+// domain blocked by policies.
+func checkBlockedRecipients(policies []SendPolicy, to []string) error {
+	for _, email := range to {
+		if domain := getPolicyDomain(policies, SendPolicyBlock, email); domain != "" {
+			return fmt.Errorf("5.7.1 Sending to %s is not allowed: domain %s is blocked by send policy", email, domain)
+		}
+	}
+	return nil
+}
+
+// checkRecipientEncryption returns the error when the recipient is in the
+// domain requiring encryption and the message would not be encrypted.
+func checkRecipientEncryption(policies []SendPolicy, email string, encrypted bool) error {
+	if encrypted {
+		return nil
+	}
+	if domain := getPolicyDomain(policies, SendPolicyEncrypt, email); domain != "" {
+		return fmt.Errorf("5.7.1 Sending to %s is not allowed: send policy requires encryption for domain %s, but the recipient has no encryption key", email, domain)
+	}
+	return nil
+}
+
+// getExternalRecipientsWarning returns the warning when the sender is in
+// the domain of warn-external policy and some recipients are not, or empty
+// string when there is nothing to warn about.
+func getExternalRecipientsWarning(policies []SendPolicy, from string, to []string) string {
+	domain := getPolicyDomain(policies, SendPolicyWarnExternal, from)
+	if domain == "" {
+		return ""
+	}
+
+	external := []string{}
+	for _, email := range to {
+		if !isInDomain(email, domain) {
+			external = append(external, email)
+		}
+	}
+	if len(external) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Message from %s was sent outside of %s to %s", from, domain, strings.Join(external, ", "))
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSendPolicies(t *testing.T) {
+	policies, err := ParseSendPolicies(" block:Example.com, encrypt:partner.org ,warn-external:work.com,")
+	require.NoError(t, err)
+	require.Equal(t, []SendPolicy{
+		{Action: SendPolicyBlock, Domain: "example.com"},
+		{Action: SendPolicyEncrypt, Domain: "partner.org"},
+		{Action: SendPolicyWarnExternal, Domain: "work.com"},
+	}, policies)
+	require.Equal(t, "block:example.com,encrypt:partner.org,warn-external:work.com", FormatSendPolicies(policies))
+
+	policies, err = ParseSendPolicies("")
+	require.NoError(t, err)
+	require.Empty(t, policies)
+
+	for _, invalid := range []string{"example.com", "drop:example.com", "block:", "block:user@example.com"} {
+		_, err := ParseSendPolicies(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestIsInDomain(t *testing.T) {
+	require.True(t, isInDomain("user@example.com", "example.com"))
+	require.True(t, isInDomain("user@Mail.Example.com", "example.com"))
+	require.False(t, isInDomain("user@notexample.com", "example.com"))
+	require.False(t, isInDomain("example.com", "example.com"))
+}
+
+func TestCheckBlockedRecipients(t *testing.T) {
+	policies := []SendPolicy{{Action: SendPolicyBlock, Domain: "example.com"}}
+
+	require.NoError(t, checkBlockedRecipients(policies, []string{"user@pm.me", "user@example.org"}))
+
+	err := checkBlockedRecipients(policies, []string{"user@pm.me", "user@sub.example.com"})
+	require.EqualError(t, err, "5.7.1 Sending to user@sub.example.com is not allowed: domain example.com is blocked by send policy")
+}
+
+func TestCheckRecipientEncryption(t *testing.T) {
+	policies := []SendPolicy{{Action: SendPolicyEncrypt, Domain: "partner.org"}}
+
+	require.NoError(t, checkRecipientEncryption(policies, "user@partner.org", true))
+	require.NoError(t, checkRecipientEncryption(policies, "user@example.com", false))
+	require.Error(t, checkRecipientEncryption(policies, "user@partner.org", false))
+}
+
+func TestGetExternalRecipientsWarning(t *testing.T) {
+	policies := []SendPolicy{{Action: SendPolicyWarnExternal, Domain: "work.com"}}
+
+	require.Empty(t, getExternalRecipientsWarning(policies, "me@pm.me", []string{"user@example.com"}))
+	require.Empty(t, getExternalRecipientsWarning(policies, "me@work.com", []string{"colleague@work.com"}))
+	require.Equal(t,
+		"Message from me@work.com was sent outside of work.com to user@example.com, other@example.org",
+		getExternalRecipientsWarning(policies, "me@work.com", []string{"colleague@work.com", "user@example.com", "other@example.org"}),
+	)
+}
@@ -18,6 +18,7 @@
 package smtp
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"sync"
@@ -27,7 +28,7 @@ import (
 )
 
 type messageGetter interface {
-	GetMessage(string) (*pmapi.Message, error)
+	GetMessage(context.Context, string) (*pmapi.Message, error)
 }
 
 type sendRecorderValue struct {
@@ -97,7 +98,7 @@ func (q *sendRecorder) setMessageID(hash, messageID string) {
 	}
 }
 
-func (q *sendRecorder) isSendingOrSent(client messageGetter, hash string) (isSending bool, wasSent bool) {
+func (q *sendRecorder) isSendingOrSent(ctx context.Context, client messageGetter, hash string) (isSending bool, wasSent bool) {
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
@@ -112,7 +113,7 @@ func (q *sendRecorder) isSendingOrSent(client messageGetter, hash string) (isSen
 		return true, false
 	}
 
-	message, err := client.GetMessage(value.messageID)
+	message, err := client.GetMessage(ctx, value.messageID)
 	// Message could be deleted or there could be an internet issue or whatever,
 	// so let's assume the message was not sent.
 	if err != nil {
@@ -18,6 +18,7 @@
 package smtp
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/mail"
@@ -33,7 +34,7 @@ type testSendRecorderGetMessageMock struct {
 	err     error
 }
 
-func (m *testSendRecorderGetMessageMock) GetMessage(messageID string) (*pmapi.Message, error) {
+func (m *testSendRecorderGetMessageMock) GetMessage(_ context.Context, messageID string) (*pmapi.Message, error) {
 	return m.message, m.err
 }
 
@@ -387,7 +388,7 @@ func TestSendRecorder_isSendingOrSent(t *testing.T) {
 		tc := tc // bind
 		t.Run(fmt.Sprintf("%d / %v / %v / %v", i, tc.hash, tc.message, tc.err), func(t *testing.T) {
 			messageGetter := &testSendRecorderGetMessageMock{message: tc.message, err: tc.err}
-			isSending, wasSent := q.isSendingOrSent(messageGetter, "hash")
+			isSending, wasSent := q.isSendingOrSent(context.Background(), messageGetter, "hash")
 			assert.Equal(t, tc.wantIsSending, isSending, "isSending does not match")
 			assert.Equal(t, tc.wantWasSent, wasSent, "wasSent does not match")
 		})
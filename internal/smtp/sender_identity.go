@@ -0,0 +1,114 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bytes"
+	"net/mail"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// Sender policies decide what happens when the From header or the address
+// used to log in does not match the MAIL FROM address.
+const (
+	// SenderPolicyStrict rejects the message.
+	SenderPolicyStrict = "strict"
+
+	// SenderPolicyRewrite sends from the MAIL FROM address and rewrites
+	// the From header to it.
+	SenderPolicyRewrite = "rewrite"
+
+	// SenderPolicyAllow sends from the From header address when it is owned
+	// by the user, otherwise from the MAIL FROM address.
+	SenderPolicyAllow = "allow"
+)
+
+var (
+	errSenderNotOwned     = errors.New("backend: invalid email address: not owned by user")
+	errSenderMismatch     = errors.New("backend: From header does not match MAIL FROM address")
+	errSenderOtherAddress = errors.New("backend: MAIL FROM address does not match the logged in address")
+)
+
+// IsValidSenderPolicy returns whether policy is one of known sender policies.
+func IsValidSenderPolicy(policy string) bool {
+	switch policy {
+	case SenderPolicyStrict, SenderPolicyRewrite, SenderPolicyAllow:
+		return true
+	}
+	return false
+}
+
+// readHeaderFrom returns the first address of the From header of the raw
+// message or nil if it is missing or cannot be parsed.
+func readHeaderFrom(body []byte) *mail.Address {
+	msg, err := mail.ReadMessage(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	from, err := msg.Header.AddressList("From")
+	if err != nil || len(from) == 0 {
+		return nil
+	}
+	return from[0]
+}
+
+// selectSender returns the address to send from and the email to use in
+// the From header according to the policy. The email can differ from the
+// address by a +alias part. sessionAddressID is set only in split mode.
+func selectSender(
+	policy string,
+	addresses pmapi.AddressList,
+	sessionAddressID, envelopeFrom string,
+	headerFrom *mail.Address,
+) (*pmapi.Address, string, error) {
+	envelopeAddr := addresses.ByEmail(envelopeFrom)
+
+	var headerAddr *pmapi.Address
+	if headerFrom != nil {
+		headerAddr = addresses.ByEmail(headerFrom.Address)
+	}
+
+	switch policy {
+	case SenderPolicyStrict:
+		if envelopeAddr == nil {
+			return nil, "", errSenderNotOwned
+		}
+		if headerFrom != nil && headerAddr != envelopeAddr {
+			return nil, "", errSenderMismatch
+		}
+		if sessionAddressID != "" && envelopeAddr.ID != sessionAddressID {
+			return nil, "", errSenderOtherAddress
+		}
+		return envelopeAddr, envelopeFrom, nil
+
+	case SenderPolicyAllow:
+		if headerAddr != nil {
+			return headerAddr, headerFrom.Address, nil
+		}
+	}
+
+	if envelopeAddr == nil {
+		return nil, "", errSenderNotOwned
+	}
+	if headerFrom != nil && headerAddr != envelopeAddr {
+		log.WithField("address", envelopeAddr.ID).Warn("Rewriting From header to MAIL FROM address")
+	}
+	return envelopeAddr, envelopeFrom, nil
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"net/mail"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadHeaderFrom(t *testing.T) {
+	from := readHeaderFrom([]byte("From: Alias <alias@pm.me>\r\nSubject: Hello\r\n\r\nBody"))
+	require.Equal(t, &mail.Address{Name: "Alias", Address: "alias@pm.me"}, from)
+
+	require.Nil(t, readHeaderFrom([]byte("Subject: Hello\r\n\r\nBody")))
+	require.Nil(t, readHeaderFrom([]byte("From: not an address\r\n\r\nBody")))
+}
+
+func TestSelectSender(t *testing.T) {
+	main := &pmapi.Address{ID: "main", Email: "main@pm.me"}
+	alias := &pmapi.Address{ID: "alias", Email: "alias@pm.me"}
+	addresses := pmapi.AddressList{main, alias}
+
+	aliasHeader := &mail.Address{Name: "Alias", Address: "alias@pm.me"}
+	plusHeader := &mail.Address{Address: "main+tag@pm.me"}
+	otherHeader := &mail.Address{Address: "other@example.com"}
+
+	tests := []struct {
+		name     string
+		policy   string
+		session  string
+		envelope string
+		header   *mail.Address
+		wantAddr *pmapi.Address
+		wantFrom string
+		wantErr  error
+	}{
+		{"strict matching", SenderPolicyStrict, "", "main@pm.me", &mail.Address{Address: "main@pm.me"}, main, "main@pm.me", nil},
+		{"strict plus alias", SenderPolicyStrict, "", "main@pm.me", plusHeader, main, "main@pm.me", nil},
+		{"strict without header", SenderPolicyStrict, "", "alias@pm.me", nil, alias, "alias@pm.me", nil},
+		{"strict mismatch", SenderPolicyStrict, "", "main@pm.me", aliasHeader, nil, "", errSenderMismatch},
+		{"strict foreign header", SenderPolicyStrict, "", "main@pm.me", otherHeader, nil, "", errSenderMismatch},
+		{"strict not owned", SenderPolicyStrict, "", "other@example.com", nil, nil, "", errSenderNotOwned},
+		{"strict split session", SenderPolicyStrict, "main", "main@pm.me", nil, main, "main@pm.me", nil},
+		{"strict split other address", SenderPolicyStrict, "main", "alias@pm.me", aliasHeader, nil, "", errSenderOtherAddress},
+
+		{"rewrite mismatch", SenderPolicyRewrite, "", "main@pm.me", aliasHeader, main, "main@pm.me", nil},
+		{"rewrite foreign header", SenderPolicyRewrite, "", "main@pm.me", otherHeader, main, "main@pm.me", nil},
+		{"rewrite not owned", SenderPolicyRewrite, "", "other@example.com", aliasHeader, nil, "", errSenderNotOwned},
+		{"rewrite split other address", SenderPolicyRewrite, "main", "alias@pm.me", nil, alias, "alias@pm.me", nil},
+
+		{"allow header alias", SenderPolicyAllow, "", "main@pm.me", aliasHeader, alias, "alias@pm.me", nil},
+		{"allow header plus alias", SenderPolicyAllow, "", "alias@pm.me", plusHeader, main, "main+tag@pm.me", nil},
+		{"allow header not owned", SenderPolicyAllow, "", "main@pm.me", otherHeader, main, "main@pm.me", nil},
+		{"allow envelope not owned", SenderPolicyAllow, "", "other@example.com", aliasHeader, alias, "alias@pm.me", nil},
+		{"allow nothing owned", SenderPolicyAllow, "", "other@example.com", otherHeader, nil, "", errSenderNotOwned},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			addr, from, err := selectSender(test.policy, addresses, test.session, test.envelope, test.header)
+			require.Equal(t, test.wantErr, err)
+			require.Equal(t, test.wantAddr, addr)
+			require.Equal(t, test.wantFrom, from)
+		})
+	}
+}
+
+func TestIsValidSenderPolicy(t *testing.T) {
+	require.True(t, IsValidSenderPolicy(SenderPolicyStrict))
+	require.True(t, IsValidSenderPolicy(SenderPolicyRewrite))
+	require.True(t, IsValidSenderPolicy(SenderPolicyAllow))
+	require.False(t, IsValidSenderPolicy(""))
+	require.False(t, IsValidSenderPolicy("reject"))
+}
@@ -19,11 +19,16 @@ package smtp
 
 import (
 	"crypto/tls"
-	"fmt"
+	"net"
+	"sync"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/incidents"
+	"github.com/ProtonMail/proton-bridge/pkg/authpolicy"
+	"github.com/ProtonMail/proton-bridge/pkg/connlimit"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/xoauth2"
 	"github.com/emersion/go-sasl"
 	goSMTP "github.com/emersion/go-smtp"
 	"github.com/sirupsen/logrus"
@@ -31,14 +36,47 @@ import (
 
 type smtpServer struct {
 	server        *goSMTP.Server
+	listener      *switchableListener
+	backend       *smtpBackend
 	eventListener listener.Listener
-	useSSL        bool
+	useSSL        bool // Guarded by accountServersLock once started.
+	authPolicy    authpolicy.Policy
+	debug         bool
+
+	// accountServers serve ports dedicated to accounts.
+	accountServers     map[int]*accountServer
+	accountServersLock sync.Mutex
+
+	// implicitTLSServer serves SMTP with implicit TLS next to the main port.
+	implicitTLSServer     *accountServer
+	implicitTLSServerLock sync.Mutex
 }
 
 // NewSMTPServer returns an SMTP server configured with the given options.
-func NewSMTPServer(debug bool, port int, useSSL bool, tls *tls.Config, smtpBackend goSMTP.Backend, eventListener listener.Listener) *smtpServer { //nolint[golint]
+// The authPolicy restricts which clients can authenticate.
+func NewSMTPServer(debug bool, port int, useSSL bool, tls *tls.Config, authPolicy authpolicy.Policy, smtpBackend *smtpBackend, eventListener listener.Listener) *smtpServer { //nolint[golint]
+	return &smtpServer{
+		server:         newGoSMTPServer(debug, port, tls, smtpBackend),
+		listener:       newSwitchableListener(),
+		backend:        smtpBackend,
+		eventListener:  eventListener,
+		useSSL:         useSSL,
+		authPolicy:     authPolicy,
+		debug:          debug,
+		accountServers: map[int]*accountServer{},
+	}
+}
+
+// tokenBackend is go-smtp backend which can also authenticate by XOAUTH2
+// or OAUTHBEARER.
+type tokenBackend interface {
+	goSMTP.Backend
+	loginWithToken(username, token string) (goSMTP.User, error)
+}
+
+func newGoSMTPServer(debug bool, port int, tls *tls.Config, smtpBackend tokenBackend) *goSMTP.Server {
 	s := goSMTP.NewServer(smtpBackend)
-	s.Addr = fmt.Sprintf("%v:%v", bridge.Host, port)
+	s.Addr = bridge.GetListenAddress(port)
 	s.TLSConfig = tls
 	s.Domain = bridge.Host
 	s.AllowInsecureAuth = true
@@ -61,11 +99,27 @@ func NewSMTPServer(debug bool, port int, useSSL bool, tls *tls.Config, smtpBacke
 		})
 	})
 
-	return &smtpServer{
-		server:        s,
-		eventListener: eventListener,
-		useSSL:        useSSL,
+	loginWithToken := func(conn *goSMTP.Conn) xoauth2.Authenticator {
+		return func(username, token string) error {
+			user, err := smtpBackend.loginWithToken(username, token)
+			if err != nil {
+				return err
+			}
+
+			conn.SetUser(user)
+			return nil
+		}
 	}
+
+	s.EnableAuth(xoauth2.Mechanism, func(conn *goSMTP.Conn) sasl.Server {
+		return xoauth2.NewServer(loginWithToken(conn))
+	})
+
+	s.EnableAuth(sasl.OAuthBearer, func(conn *goSMTP.Conn) sasl.Server {
+		return xoauth2.NewOAuthBearerServer(loginWithToken(conn))
+	})
+
+	return s
 }
 
 // Starts the server.
@@ -74,14 +128,10 @@ func (s *smtpServer) ListenAndServe() {
 	l := log.WithField("useSSL", s.useSSL).WithField("address", s.server.Addr)
 
 	l.Info("SMTP server is starting")
-	var err error
-	if s.useSSL {
-		err = s.server.ListenAndServeTLS()
-	} else {
-		err = s.server.ListenAndServe()
-	}
+	err := s.listenAndServe()
 	if err != nil {
 		s.eventListener.Emit(events.ErrorEvent, "SMTP failed: "+err.Error())
+		incidents.Report(incidents.ServerFailed, "", "SMTP failed: "+err.Error())
 		l.Error("SMTP failed: ", err)
 		return
 	}
@@ -90,9 +140,36 @@ func (s *smtpServer) ListenAndServe() {
 	l.Info("SMTP server stopped")
 }
 
+// listenAndServe serves connections wrapped by chunkingListener which adds
+// CHUNKING extension not supported by go-smtp.
+func (s *smtpServer) listenAndServe() error {
+	l, err := s.listen(s.server.Addr, s.useSSL)
+	if err != nil {
+		return err
+	}
+	s.listener.set(l)
+	return s.server.Serve(s.listener)
+}
+
+func (s *smtpServer) listen(address string, useSSL bool) (net.Listener, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	l = connlimit.NewIdleListener(bridge.NewRemoteAccessListener(l), connections.IdleTimeout)
+
+	if useSSL {
+		l = tls.NewListener(l, s.server.TLSConfig)
+	}
+
+	return newChunkingListener(l, s.server.TLSConfig, useSSL, s.authPolicy), nil
+}
+
 // Stops the server.
 func (s *smtpServer) Close() {
 	s.server.Close()
+	s.SetAccountPorts(nil)
+	s.SetImplicitTLSPort(0)
 }
 
 func (s *smtpServer) monitorDisconnectedUsers() {
@@ -108,5 +185,17 @@ func (s *smtpServer) monitorDisconnectedUsers() {
 			}
 		}
 		s.server.ForEachConn(disconnectUser)
+
+		s.accountServersLock.Lock()
+		for _, account := range s.accountServers {
+			account.server.ForEachConn(disconnectUser)
+		}
+		s.accountServersLock.Unlock()
+
+		s.implicitTLSServerLock.Lock()
+		if s.implicitTLSServer != nil {
+			s.implicitTLSServer.server.ForEachConn(disconnectUser)
+		}
+		s.implicitTLSServerLock.Unlock()
 	}
 }
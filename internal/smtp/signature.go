@@ -0,0 +1,55 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/jaytaylor/html2text"
+)
+
+// appendSignature appends the HTML signature of the sending address to the
+// body of the given MIME type unless the client has already added it.
+func appendSignature(signature, mimeType, body string) string {
+	if strings.TrimSpace(signature) == "" {
+		return body
+	}
+
+	if mimeType == pmapi.ContentTypePlainText {
+		plain, err := html2text.FromString(signature)
+		if err != nil || plain == "" || strings.Contains(body, plain) {
+			return body
+		}
+		return strings.TrimRight(body, "\r\n") + "\n\n" + plain + "\n"
+	}
+
+	if strings.Contains(body, signature) {
+		return body
+	}
+	return insertBeforeBodyEnd(body, `<div class="protonmail_signature_block">`+signature+`</div>`)
+}
+
+// insertBeforeBodyEnd inserts the HTML block at the end of the body element
+// or at the end of the HTML fragment without one.
+func insertBeforeBodyEnd(body, block string) string {
+	if i := strings.LastIndex(strings.ToLower(body), "</body>"); i >= 0 {
+		return body[:i] + block + body[i:]
+	}
+	return body + block
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendSignature(t *testing.T) {
+	signature := "<div>Jane <b>Doe</b></div>"
+	block := `<div class="protonmail_signature_block">` + signature + `</div>`
+
+	testData := []struct {
+		mimeType, body, want string
+	}{
+		{pmapi.ContentTypeHTML, "<p>hi</p>", "<p>hi</p>" + block},
+		{pmapi.ContentTypeHTML, "<html><body><p>hi</p></BODY></html>", "<html><body><p>hi</p>" + block + "</BODY></html>"},
+		{pmapi.ContentTypeHTML, "<p>hi</p>" + signature, "<p>hi</p>" + signature},
+		{pmapi.ContentTypePlainText, "hi\r\n", "hi\n\nJane *Doe*\n"},
+		{pmapi.ContentTypePlainText, "hi\n\nJane *Doe*", "hi\n\nJane *Doe*"},
+	}
+
+	for _, td := range testData {
+		require.Equal(t, td.want, appendSignature(signature, td.mimeType, td.body), "%s %q", td.mimeType, td.body)
+	}
+
+	require.Equal(t, "hi", appendSignature(" ", pmapi.ContentTypePlainText, "hi"))
+}
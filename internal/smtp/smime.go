@@ -0,0 +1,62 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/smime"
+)
+
+// smimeSigner returns the signer of the address from the folder with S/MIME
+// certificates or nil when there is no usable certificate. The certificate
+// with the private key is read from the PEM file named by the address,
+// e.g. alice@example.com.pem.
+func (sb *smtpBackend) smimeSigner(email string) *smime.Signer {
+	dir := sb.preferences.Get(preferences.SMIMEDirKey)
+	if dir == "" {
+		return nil
+	}
+
+	signer, err := smime.LoadSigner(filepath.Join(dir, strings.ToLower(email)+".pem"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		log.WithError(err).Warn("Cannot load S/MIME certificate, message is not signed")
+		return nil
+	}
+
+	if !signer.CanSign(email, time.Now()) {
+		log.Warn("S/MIME certificate is expired or not issued for the address, message is not signed")
+		return nil
+	}
+
+	return signer
+}
+
+// needsSMIMESignature returns whether the recipient gets the message signed
+// by S/MIME. Only recipients without PGP, i.e. those who get the message
+// neither encrypted nor signed by PGP, are signed by S/MIME.
+func needsSMIMESignature(sendPreferences SendPreferences) bool {
+	return !sendPreferences.Encrypt && !sendPreferences.Sign
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMIMESigner(t *testing.T) {
+	sb, clean := newTestScheduleBackend(t)
+	defer clean()
+
+	require.Nil(t, sb.smimeSigner("alice@example.com"), "no folder set")
+
+	dir, err := ioutil.TempDir("", "smime")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+	sb.preferences.Set(preferences.SMIMEDirKey, dir)
+
+	require.Nil(t, sb.smimeSigner("alice@example.com"), "no certificate")
+
+	certificate, err := ioutil.ReadFile("../../pkg/smime/testdata/signer.pem")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "alice@example.com.pem"), certificate, 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "bob@example.com.pem"), certificate, 0600))
+
+	signer := sb.smimeSigner("Alice@Example.com")
+	require.NotNil(t, signer)
+	require.Equal(t, []string{"alice@example.com"}, signer.Certificate.EmailAddresses)
+
+	require.Nil(t, sb.smimeSigner("bob@example.com"), "certificate of other address")
+}
+
+func TestNeedsSMIMESignature(t *testing.T) {
+	require.True(t, needsSMIMESignature(SendPreferences{}))
+	require.False(t, needsSMIMESignature(SendPreferences{Sign: true}))
+	require.False(t, needsSMIMESignature(SendPreferences{Encrypt: true, Sign: true}))
+}
@@ -19,8 +19,10 @@ package smtp
 
 import (
 	"io"
+	"time"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/store"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
@@ -31,6 +33,17 @@ type storeUserProvider interface {
 		attachmentReaders []io.Reader,
 		attachedPublicKey,
 		attachedPublicKeyName string,
-		parentID string) (*pmapi.Message, []*pmapi.Attachment, error)
+		parentID string,
+		progress store.AttachmentProgress) (*pmapi.Message, []*pmapi.Attachment, error)
 	SendMessage(messageID string, req *pmapi.SendMessageReq) error
+	AddSentMessage(externalID, fingerprint, apiID string) error
+	GetOutgoingMIMEType() string
+	GetAppendSignature() bool
+	GetFooter() (text, html string)
+	GetDefaultExpiration() time.Duration
+	ScheduleMessage(kr *crypto.KeyRing, sendAt time.Time, from string, to []string, body []byte) (string, error)
+	GetDueScheduledMessages(now time.Time) ([]*store.ScheduledMessage, error)
+	IncrementScheduledMessageAttempts(id, lastError string) (int, error)
+	SetScheduledMessageError(id, lastError string) error
+	RemoveScheduledMessage(id string) error
 }
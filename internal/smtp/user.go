@@ -20,24 +20,33 @@
 package smtp
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"io"
 	"mime"
 	"net/mail"
-	"regexp"
 	"strings"
 	"time"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/stats"
+	"github.com/ProtonMail/proton-bridge/internal/store"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
 	"github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/ProtonMail/proton-bridge/pkg/tracing"
 	goSMTPBackend "github.com/emersion/go-smtp"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// errAPIUnavailable is returned when the message can be neither sent nor
+// queued in the outbox; chunkingConn responds to it by 451 so clients retry.
+var errAPIUnavailable = errors.New("4.4.1 Proton servers cannot be reached, try again later")
+
 type smtpUser struct {
 	panicHandler  panicHandler
 	eventListener listener.Listener
@@ -45,9 +54,22 @@ type smtpUser struct {
 	user          bridgeUser
 	storeUser     storeUserProvider
 	addressID     string
+
+	// sessionID correlates logs and API requests of the SMTP session.
+	sessionID string
+
+	// release ends the session in connection limits.
+	release func()
+
+	// bounceFailures is set for messages sent from the outbox. Nobody waits
+	// for the SMTP response anymore, therefore permanent failures are
+	// reported by a bounce imported to the Inbox instead.
+	bounceFailures bool
 }
 
 // newSMTPUser returns struct implementing go-smtp/session interface.
+// The session counts against connection limits of the account until
+// the client logs out.
 func newSMTPUser(
 	panicHandler panicHandler,
 	eventListener listener.Listener,
@@ -60,6 +82,12 @@ func newSMTPUser(
 		return nil, errors.New("user database is not initialized")
 	}
 
+	release, err := connections.Acquire(user.ID())
+	if err != nil {
+		log.WithField("userID", user.ID()).Warn("Too many SMTP connections")
+		return nil, err
+	}
+
 	return &smtpUser{
 		panicHandler:  panicHandler,
 		eventListener: eventListener,
@@ -67,9 +95,16 @@ func newSMTPUser(
 		user:          user,
 		storeUser:     storeUser,
 		addressID:     addressID,
+		sessionID:     tracing.NewSessionID("smtp"),
+		release:       release,
 	}, nil
 }
 
+// context returns context carrying the session ID for API requests.
+func (su *smtpUser) context() context.Context {
+	return tracing.WithSessionID(context.Background(), su.sessionID)
+}
+
 // This method should eventually no longer be necessary. Everything should go via store.
 func (su *smtpUser) client() pmapi.Client {
 	return su.user.GetTemporaryPMAPIClient()
@@ -114,7 +149,7 @@ func (su *smtpUser) getSendPreferences(
 }
 
 func (su *smtpUser) getContactVCardData(recipient string) (meta *ContactMetadata, err error) {
-	emails, err := su.client().GetContactEmailByEmail(recipient, 0, 1000)
+	emails, err := su.client().GetContactEmailByEmail(su.context(), recipient, 0, 1000)
 	if err != nil {
 		return
 	}
@@ -126,7 +161,7 @@ func (su *smtpUser) getContactVCardData(recipient string) (meta *ContactMetadata
 		}
 
 		var contact pmapi.Contact
-		if contact, err = su.client().GetContactByID(email.ContactID); err != nil {
+		if contact, err = su.client().GetContactByID(su.context(), email.ContactID); err != nil {
 			return
 		}
 
@@ -142,23 +177,79 @@ func (su *smtpUser) getContactVCardData(recipient string) (meta *ContactMetadata
 }
 
 func (su *smtpUser) getAPIKeyData(recipient string) (apiKeys []pmapi.PublicKey, isInternal bool, err error) {
-	return su.client().GetPublicKeysForEmail(recipient)
+	return su.client().GetPublicKeysForEmail(su.context(), recipient)
 }
 
 // Send sends an email from the given address to the given addresses with the given body.
-func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err error) { //nolint[funlen]
+// Messages scheduled to be sent later are queued in the outbox instead, and
+// so are messages which could not be sent because API was not reachable.
+// If not even that is possible, the client gets temporary failure.
+func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) error {
 	// Called from go-smtp in goroutines - we need to handle panics for each function.
 	defer su.panicHandler.HandlePanic()
 
-	mailSettings, err := su.client().GetMailSettings()
+	log := tracing.Logger(su.context(), log)
+
+	body, err := readMessage(messageReader)
 	if err != nil {
 		return err
 	}
 
-	var addr *pmapi.Address = su.client().Addresses().ByEmail(from)
-	if addr == nil {
-		err = errors.New("backend: invalid email address: not owned by user")
-		return
+	if sendAt, ok := su.backend.getScheduledTime(body, time.Now()); ok {
+		return su.scheduleMessage(sendAt, from, to, body)
+	}
+
+	err = su.send(from, to, body)
+	if errors.Cause(err) == pmapi.ErrAPINotReachable {
+		if queueErr := su.scheduleMessage(time.Now(), from, to, body); queueErr != nil {
+			log.WithError(queueErr).Error("Cannot queue message in outbox")
+			return errAPIUnavailable
+		}
+		log.Info("API not reachable, message queued in outbox")
+		return nil
+	}
+	if err != nil {
+		su.eventListener.Emit(events.SendFailedEvent, su.user.ID()+":"+err.Error())
+	}
+	return err
+}
+
+func (su *smtpUser) send(from string, to []string, body []byte) (err error) { //nolint[funlen]
+	log := tracing.Logger(su.context(), log)
+
+	// The original message is attached to notifications as received.
+	originalBody := body
+
+	recipients := make([]dsnRecipient, len(to))
+	addresses := make([]string, len(to))
+	for i, rcpt := range to {
+		if recipients[i], err = parseRecipient(rcpt); err != nil {
+			return err
+		}
+		addresses[i] = recipients[i].Address
+	}
+	to = addresses
+
+	expiration, body, err := getExpiration(body, su.storeUser.GetDefaultExpiration())
+	if err != nil {
+		return err
+	}
+
+	outsidePasswords, body := getOutsidePasswords(body)
+
+	mailSettings, err := su.client().GetMailSettings(su.context())
+	if err != nil {
+		return err
+	}
+
+	addr, from, err := selectSender(su.backend.senderPolicy(), su.client().Addresses(), su.addressID, from, readHeaderFrom(body))
+	if err != nil {
+		return err
+	}
+
+	sendPolicies := su.backend.sendPolicies()
+	if err := checkBlockedRecipients(sendPolicies, to); err != nil {
+		return err
 	}
 
 	kr, err := su.client().KeyRingForAddressID(addr.ID)
@@ -166,9 +257,21 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 		return
 	}
 
+	attachPublicKey := su.backend.preferences.GetBool(preferences.AttachPublicKeyKey)
+	sendAutocrypt := su.backend.preferences.GetBool(preferences.AutocryptKey)
+
+	// Public key is offered only to recipients outside of Proton, who cannot
+	// get it from API, unless the mail setting attaches it to every message.
+	var toExternal bool
+	if attachPublicKey || sendAutocrypt {
+		if toExternal, err = su.hasExternalRecipient(to); err != nil {
+			return err
+		}
+	}
+
 	var attachedPublicKey string
 	var attachedPublicKeyName string
-	if mailSettings.AttachPublicKey > 0 {
+	if mailSettings.AttachPublicKey > 0 || (attachPublicKey && toExternal) {
 		firstKey, err := kr.GetKey(0)
 		if err != nil {
 			return err
@@ -182,11 +285,15 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 		attachedPublicKeyName = "publickey - " + kr.GetIdentities()[0].Name
 	}
 
-	message, mimeBody, plainBody, attReaders, err := message.Parse(messageReader, attachedPublicKey, attachedPublicKeyName)
+	message, mimeBody, plainBody, attReaders, err := message.Parse(bytes.NewReader(body), attachedPublicKey, attachedPublicKeyName)
 	if err != nil {
 		return
 	}
-	clearBody := message.Body
+	delete(message.Header, scheduledTimeHeader)
+	if err = normalizeOutgoingHeader(message.Header, su.backend.messageIDPolicy(), addr); err != nil {
+		return
+	}
+	composerMIMEType, clearBody := forceOutgoingMIMEType(su.storeUser.GetOutgoingMIMEType(), message.MIMEType, message.Body)
 
 	externalID := message.Header.Get("Message-Id")
 	externalID = strings.Trim(externalID, "<>")
@@ -199,6 +306,36 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 
 	message.AddressID = addr.ID
 
+	// MIME body for PGP/MIME recipients is sent as composed by the client.
+	if su.storeUser.GetAppendSignature() {
+		message.Body = appendSignature(addr.Signature, message.MIMEType, message.Body)
+		clearBody = appendSignature(addr.Signature, composerMIMEType, clearBody)
+		plainBody = appendSignature(addr.Signature, pmapi.ContentTypePlainText, plainBody)
+	}
+
+	if footer := newFooter(su.storeUser.GetFooter()); !footer.isEmpty() {
+		message.Body = appendFooter(footer, message.MIMEType, message.Body)
+		clearBody = appendFooter(footer, composerMIMEType, clearBody)
+		plainBody = appendFooter(footer, pmapi.ContentTypePlainText, plainBody)
+		if mimeBody, err = appendFooterToMIME(footer, mimeBody); err != nil {
+			return errors.Wrap(err, "failed to append footer")
+		}
+	}
+
+	if mimeBody, err = normalizeOutgoingMIME(mimeBody); err != nil {
+		return errors.Wrap(err, "failed to normalize MIME header")
+	}
+
+	if su.backend.preferences.GetBool(preferences.RequestReadReceiptKey) {
+		requestReadReceipt(message, addr.Email)
+	}
+
+	if sendAutocrypt && toExternal {
+		if err := addAutocryptHeader(message, addr.Email, kr); err != nil {
+			return errors.Wrap(err, "failed to add Autocrypt header")
+		}
+	}
+
 	// Apple Mail Message-Id has to be stored to avoid recovered message after each send.
 	// Before it was done only for Apple Mail, but it should work for any client. Also, the client
 	// is set up from IMAP and no one can be sure that the same client is used for SMTP as well.
@@ -215,13 +352,13 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 	// but it's better than sending the message many times. If the message was sent, we simply return
 	// nil to indicate it's OK.
 	sendRecorderMessageHash := su.backend.sendRecorder.getMessageHash(message)
-	isSending, wasSent := su.backend.sendRecorder.isSendingOrSent(su.client(), sendRecorderMessageHash)
+	isSending, wasSent := su.backend.sendRecorder.isSendingOrSent(su.context(), su.client(), sendRecorderMessageHash)
 
 	startTime := time.Now()
 	for isSending && time.Since(startTime) < 90*time.Second {
 		log.Debug("Message is still in send queue, waiting for a bit")
 		time.Sleep(15 * time.Second)
-		isSending, wasSent = su.backend.sendRecorder.isSendingOrSent(su.client(), sendRecorderMessageHash)
+		isSending, wasSent = su.backend.sendRecorder.isSendingOrSent(su.context(), su.client(), sendRecorderMessageHash)
 	}
 	if isSending {
 		log.Debug("Message is still in send queue, returning error to prevent client from adding it to the sent folder prematurely")
@@ -232,8 +369,10 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 		return nil
 	}
 
+	fingerprint := store.MessageFingerprint(message)
+
 	su.backend.sendRecorder.addMessage(sendRecorderMessageHash)
-	message, atts, err := su.storeUser.CreateDraft(kr, message, attReaders, attachedPublicKey, attachedPublicKeyName, parentID)
+	message, atts, err := su.storeUser.CreateDraft(kr, message, attReaders, attachedPublicKey, attachedPublicKeyName, parentID, logAttachmentProgress())
 	if err != nil {
 		su.backend.sendRecorder.removeMessage(sendRecorderMessageHash)
 		log.WithError(err).Error("Draft could not be created")
@@ -247,7 +386,7 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 	// can lead to sending the wrong message. Also clients do not necessarily
 	// delete the old draft.
 	if draftID != "" {
-		if err := su.client().DeleteMessages([]string{draftID}); err != nil {
+		if err := su.client().DeleteMessages(su.context(), []string{draftID}); err != nil {
 			log.WithError(err).WithField("draftID", draftID).Warn("Original draft cannot be deleted")
 		}
 	}
@@ -278,22 +417,85 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 	plainAddressMap := make(map[string]*pmapi.MessageAddress)
 	htmlAddressMap := make(map[string]*pmapi.MessageAddress)
 	mimeAddressMap := make(map[string]*pmapi.MessageAddress)
+	smimeAddressMap := make(map[string]*pmapi.MessageAddress)
+
+	var plainKey, htmlKey, mimeKey, smimeKey *crypto.SessionKey
+	var plainData, htmlData, mimeData, smimeData []byte
 
-	var plainKey, htmlKey, mimeKey *crypto.SessionKey
-	var plainData, htmlData, mimeData []byte
+	smimeSigner := su.backend.smimeSigner(addr.Email)
 
 	containsUnencryptedRecipients := false
+	containsOutsideRecipients := false
 
-	for _, email := range to {
+	for i, email := range to {
 		if !looksLikeEmail(email) {
 			return errors.New(`"` + email + `" is not a valid recipient.`)
 		}
 
-		sendPreferences, err := su.getSendPreferences(email, message.MIMEType, mailSettings)
+		sendPreferences, err := su.getSendPreferences(email, composerMIMEType, mailSettings)
 		if err != nil {
+			if su.bounceFailures && isDeliveryFailure(err) {
+				su.reportDeliveryFailures(addr, kr, message, originalBody, []deliveryFailure{{Recipient: recipients[i], Err: err}})
+			}
+			return err
+		}
+
+		// Recipients without a public key get the message encrypted by the password, if any.
+		password := outsidePasswords.get(email)
+		encryptOutside := password != "" && !sendPreferences.Encrypt
+
+		if err := checkRecipientEncryption(sendPolicies, email, sendPreferences.Encrypt || encryptOutside); err != nil {
+			_ = su.client().DeleteMessages(su.context(), []string{message.ID})
+			su.backend.sendRecorder.removeMessage(sendRecorderMessageHash)
 			return err
 		}
 
+		if encryptOutside {
+			auth, err := outsidePasswords.auth(su.context(), su.client(), password)
+			if err != nil {
+				return errors.Wrap(err, "generating password verifier")
+			}
+			// Package encrypted to outside cannot be MIME, so the body as composed is used.
+			if composerMIMEType == pmapi.ContentTypePlainText {
+				if plainKey == nil {
+					if plainKey, plainData, err = encryptSymmetric(kr, plainBody, true); err != nil {
+						return err
+					}
+				}
+				if plainAddressMap[email], err = createOutsideAddress(password, outsidePasswords.hint, auth, plainKey, attkeys); err != nil {
+					return err
+				}
+				plainSharedScheme |= pmapi.EncryptedOutsidePackage
+			} else {
+				if htmlKey == nil {
+					if htmlKey, htmlData, err = encryptSymmetric(kr, clearBody, true); err != nil {
+						return err
+					}
+				}
+				if htmlAddressMap[email], err = createOutsideAddress(password, outsidePasswords.hint, auth, htmlKey, attkeys); err != nil {
+					return err
+				}
+				htmlSharedScheme |= pmapi.EncryptedOutsidePackage
+			}
+			containsOutsideRecipients = true
+			continue
+		}
+
+		if smimeSigner != nil && needsSMIMESignature(sendPreferences) {
+			if smimeKey == nil {
+				signedBody, err := smimeSigner.SignMessage([]byte(mimeBody), time.Now())
+				if err != nil {
+					return errors.Wrap(err, "signing by S/MIME")
+				}
+				if smimeKey, smimeData, err = encryptSymmetric(kr, string(signedBody), true); err != nil {
+					return err
+				}
+			}
+			// The message is already signed, it must not be changed by PGP signature.
+			smimeAddressMap[email] = &pmapi.MessageAddress{Type: pmapi.ClearMIMEPackage, Signature: pmapi.NoSignature}
+			continue
+		}
+
 		var signature int
 		if sendPreferences.Sign {
 			signature = pmapi.YesSignature
@@ -359,12 +561,16 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 			return errors.New("error decoding subject message " + message.Header.Get("Subject"))
 		}
 		if !su.continueSendingUnencryptedMail(subject) {
-			_ = su.client().DeleteMessages([]string{message.ID})
+			_ = su.client().DeleteMessages(su.context(), []string{message.ID})
 			return errors.New("sending was canceled by user")
 		}
 	}
 
-	req := &pmapi.SendMessageReq{}
+	if containsOutsideRecipients && expiration == 0 {
+		expiration = outsideExpiration
+	}
+
+	req := &pmapi.SendMessageReq{ExpirationTime: int64(expiration / time.Second)}
 
 	plainPkg := buildPackage(plainAddressMap, plainSharedScheme, pmapi.ContentTypePlainText, plainData, plainKey, attkeysEncoded)
 	if plainPkg != nil {
@@ -376,51 +582,124 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 		req.Packages = append(req.Packages, htmlPkg)
 	}
 
-	if len(mimeAddressMap) > 0 {
-		pkg := &pmapi.MessagePackage{
-			Body:      base64.StdEncoding.EncodeToString(mimeData),
-			Addresses: mimeAddressMap,
-			MIMEType:  pmapi.ContentTypeMultipartMixed,
-			Type:      mimeSharedType,
-			BodyKey: pmapi.AlgoKey{
-				Key:       mimeKey.GetBase64Key(),
-				Algorithm: mimeKey.Algo,
-			},
+	mimePkg := buildMIMEPackage(mimeAddressMap, mimeSharedType, mimeData, mimeKey)
+	if mimePkg != nil {
+		req.Packages = append(req.Packages, mimePkg)
+	}
+
+	smimePkg := buildMIMEPackage(smimeAddressMap, pmapi.ClearMIMEPackage, smimeData, smimeKey)
+	if smimePkg != nil {
+		req.Packages = append(req.Packages, smimePkg)
+	}
+
+	if err := su.storeUser.SendMessage(message.ID, req); err != nil {
+		if su.bounceFailures && isDeliveryFailure(err) {
+			failures := make([]deliveryFailure, len(recipients))
+			for i, recipient := range recipients {
+				failures[i] = deliveryFailure{Recipient: recipient, Err: err}
+			}
+			su.reportDeliveryFailures(addr, kr, message, originalBody, failures)
+		}
+		if errors.Cause(err) == pmapi.ErrAPINotReachable {
+			// Message was not sent, so the retry must not wait for it.
+			su.backend.sendRecorder.removeMessage(sendRecorderMessageHash)
 		}
-		req.Packages = append(req.Packages, pkg)
+		return err
+	}
+
+	// Remember the message so the copy appended by the client to Sent
+	// is not imported as a duplicate.
+	if err := su.storeUser.AddSentMessage(externalID, fingerprint, message.ID); err != nil {
+		log.WithError(err).Warn("Sent message cannot be remembered")
+	}
+
+	if warning := getExternalRecipientsWarning(sendPolicies, addr.Email, to); warning != "" {
+		log.WithField("messageID", message.ID).Warn("Message was sent to recipients outside of the sender domain")
+		su.eventListener.Emit(events.SendPolicyWarningEvent, su.user.ID()+":"+warning)
 	}
 
-	return su.storeUser.SendMessage(message.ID, req)
+	stats.Add(stats.SentMessages, 1)
+
+	su.reportRelayed(addr, kr, message, originalBody, recipients)
+
+	return nil
+}
+
+// reportDeliveryFailures imports the bounce message about failed recipients
+// of the message sent from the outbox to the Inbox of the sender.
+func (su *smtpUser) reportDeliveryFailures(addr *pmapi.Address, kr *crypto.KeyRing, original *pmapi.Message, body []byte, failures []deliveryFailure) {
+	bounce, readers := buildBounce(addr, original, body, failures, time.Now())
+	if bounce == nil {
+		return
+	}
+
+	if err := su.importReport(addr, kr, bounce, readers); err != nil {
+		log.WithError(err).Error("Cannot import bounce message")
+	}
+}
+
+// reportRelayed imports the notification about the sent message for
+// recipients which asked for NOTIFY=SUCCESS.
+func (su *smtpUser) reportRelayed(addr *pmapi.Address, kr *crypto.KeyRing, original *pmapi.Message, body []byte, recipients []dsnRecipient) {
+	notice, readers := buildRelayNotice(addr, original, body, recipients, time.Now())
+	if notice == nil {
+		return
+	}
+
+	if err := su.importReport(addr, kr, notice, readers); err != nil {
+		log.WithError(err).Error("Cannot import delivery status notification")
+	}
+}
+
+func (su *smtpUser) importReport(addr *pmapi.Address, kr *crypto.KeyRing, report *pmapi.Message, readers []io.Reader) error {
+	body, err := message.BuildEncrypted(report, readers, kr)
+	if err != nil {
+		return err
+	}
+
+	res, err := su.client().Import(su.context(), []*pmapi.ImportMsgReq{{
+		AddressID: addr.ID,
+		Body:      body,
+		Unread:    report.Unread,
+		Time:      report.Time,
+		Flags:     report.Flags,
+		LabelIDs:  report.LabelIDs,
+	}})
+	if err == nil && len(res) > 0 {
+		err = res[0].Error
+	}
+	return err
 }
 
 func (su *smtpUser) handleReferencesHeader(m *pmapi.Message) (draftID, parentID string) {
-	// Remove the internal IDs from the references header before sending to avoid confusion.
-	references := m.Header.Get("References")
-	newReferences := []string{}
-	for _, reference := range strings.Fields(references) {
-		if !strings.Contains(reference, "@"+pmapi.InternalIDDomain) {
-			newReferences = append(newReferences, reference)
-		} else { // internalid is the parentID.
-			idMatch := regexp.MustCompile(pmapi.InternalReferenceFormat).FindStringSubmatch(reference)
-			if len(idMatch) > 0 {
-				lastID := strings.TrimSuffix(strings.Trim(idMatch[0], "<>"), "@protonmail.internalid")
-				filter := &pmapi.MessagesFilter{ID: []string{lastID}}
-				if su.addressID != "" {
-					filter.AddressID = su.addressID
-				}
-				metadata, _, _ := su.client().ListMessages(filter)
-				for _, m := range metadata {
-					if m.IsDraft() {
-						draftID = m.ID
-					} else {
-						parentID = m.ID
-					}
-				}
+	// Placeholders of internal IDs are rewritten to external IDs before
+	// sending to avoid confusion; the internal ID is the draft or parentID.
+	externalIDs := map[string]string{}
+	resolve := func(apiID string) string {
+		if externalID, ok := externalIDs[apiID]; ok {
+			return externalID
+		}
+		filter := &pmapi.MessagesFilter{ID: []string{apiID}}
+		if su.addressID != "" {
+			filter.AddressID = su.addressID
+		}
+		metadata, _, _ := su.client().ListMessages(su.context(), filter)
+		for _, msg := range metadata {
+			if msg.IsDraft() {
+				draftID = msg.ID
+			} else {
+				parentID = msg.ID
+				externalIDs[apiID] = msg.ExternalID
 			}
 		}
+		return externalIDs[apiID]
 	}
 
-	m.Header["References"] = newReferences
+	newReferences := message.RewriteInternalMessageIDs(message.ParseMessageIDs(m.Header.Get("References")), resolve)
+	setMessageIDsHeader(m.Header, "References", newReferences)
+
+	inReplyTo := message.RewriteInternalMessageIDs(message.ParseMessageIDs(m.Header.Get("In-Reply-To")), resolve)
+	setMessageIDsHeader(m.Header, "In-Reply-To", inReplyTo)
 
 	if parentID == "" && len(newReferences) > 0 {
 		externalID := strings.Trim(newReferences[len(newReferences)-1], "<>")
@@ -428,7 +707,7 @@ func (su *smtpUser) handleReferencesHeader(m *pmapi.Message) (draftID, parentID
 		if su.addressID != "" {
 			filter.AddressID = su.addressID
 		}
-		metadata, _, _ := su.client().ListMessages(filter)
+		metadata, _, _ := su.client().ListMessages(su.context(), filter)
 		// There can be two or messages with the same external ID and then we cannot
 		// be sure which message should be parent. Better to not choose any.
 		if len(metadata) == 1 {
@@ -439,6 +718,14 @@ func (su *smtpUser) handleReferencesHeader(m *pmapi.Message) (draftID, parentID
 	return draftID, parentID
 }
 
+func setMessageIDsHeader(h mail.Header, key string, ids []string) {
+	if len(ids) == 0 {
+		delete(h, key)
+		return
+	}
+	h[key] = []string{message.FormatMessageIDs(ids)}
+}
+
 func (su *smtpUser) handleSenderAndRecipients(m *pmapi.Message, addr *pmapi.Address, from string, to []string) (err error) {
 	from = pmapi.ConstructAddress(from, addr.Email)
 
@@ -517,6 +804,32 @@ func (su *smtpUser) continueSendingUnencryptedMail(subject string) bool {
 
 // Logout is called when this User will no longer be used.
 func (su *smtpUser) Logout() error {
-	log.Debug("SMTP client logged out user ", su.addressID)
+	tracing.Logger(su.context(), log).Debug("SMTP client logged out user ", su.addressID)
+	if su.release != nil {
+		su.release()
+	}
 	return nil
 }
+
+// bigAttachmentSize is the size from which upload of attachments is logged.
+const bigAttachmentSize = 5 * 1024 * 1024
+
+// logAttachmentProgress returns the callback logging upload of big
+// attachments after every tenth of their size.
+func logAttachmentProgress() store.AttachmentProgress {
+	lastStep := map[*pmapi.Attachment]int64{}
+
+	return func(att *pmapi.Attachment, uploaded, size int64) {
+		if size < bigAttachmentSize {
+			return
+		}
+
+		step := uploaded * 10 / size
+		if step == lastStep[att] {
+			return
+		}
+		lastStep[att] = step
+
+		log.WithField("size", size).Debugf("Uploaded %d%% of attachment", step*10)
+	}
+}
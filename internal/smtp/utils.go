@@ -110,10 +110,34 @@ func buildPackage(
 		Type:      sharedScheme,
 	}
 
-	if sharedScheme|pmapi.ClearPackage > 0 {
+	// Session keys are sent only for cleartext recipients, never for encrypted ones.
+	if sharedScheme&pmapi.ClearPackage > 0 {
 		pkg.BodyKey.Key = bodyKey.GetBase64Key()
 		pkg.BodyKey.Algorithm = bodyKey.Algo
 		pkg.AttachmentKeys = attKeys
 	}
 	return pkg
 }
+
+// buildMIMEPackage returns the package with the whole MIME message as body.
+func buildMIMEPackage(
+	addressMap map[string]*pmapi.MessageAddress,
+	sharedType int,
+	bodyData []byte,
+	bodyKey *crypto.SessionKey,
+) *pmapi.MessagePackage {
+	if len(addressMap) == 0 {
+		return nil
+	}
+
+	return &pmapi.MessagePackage{
+		Body:      base64.StdEncoding.EncodeToString(bodyData),
+		Addresses: addressMap,
+		MIMEType:  pmapi.ContentTypeMultipartMixed,
+		Type:      sharedType,
+		BodyKey: pmapi.AlgoKey{
+			Key:       bodyKey.GetBase64Key(),
+			Algorithm: bodyKey.Algo,
+		},
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package stats keeps a local history of daily metrics, such as synced and
+// sent messages or API errors, so users can see when the behaviour of bridge
+// changed relative to upgrades or configuration edits.
+package stats
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Counter is a metric summed over the day.
+type Counter string
+
+// Gauge is a metric of which only the last value of the day is kept.
+type Gauge string
+
+// Recorded metrics.
+const (
+	SyncedMessages Counter = "synced_messages"
+	SentMessages   Counter = "sent_messages"
+	APIErrors      Counter = "api_errors"
+
+	CacheSize Gauge = "cache_size"
+)
+
+const (
+	// maxDays is how many days are kept; the oldest are dropped.
+	maxDays = 400
+
+	dateFormat = "2006-01-02"
+)
+
+// Day holds the metrics of one day. Version and Settings are the last
+// version of bridge and fingerprint of its settings seen that day.
+type Day struct {
+	Date     string            `json:"date"`
+	Version  string            `json:"version,omitempty"`
+	Settings string            `json:"settings,omitempty"`
+	Counters map[Counter]int64 `json:"counters,omitempty"`
+	Gauges   map[Gauge]int64   `json:"gauges,omitempty"`
+}
+
+// Entry is a day in the history with changes compared to the previous
+// recorded day, such as an upgrade.
+type Entry struct {
+	Day
+	Changes []string
+}
+
+// History is a bounded history of days safe for concurrent use. History
+// without path is kept only in memory.
+type History struct {
+	path string
+	days []*Day
+	lock sync.Mutex
+}
+
+var defaultHistory = &History{} //nolint[gochecknoglobals]
+
+// Load replaces the default history by the one saved in path. Missing file
+// means empty history.
+func Load(path string) error {
+	history, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defaultHistory = history
+	return nil
+}
+
+// Save writes the default history to its file.
+func Save() error {
+	return defaultHistory.Save()
+}
+
+// Add adds n to the counter of today in the default history.
+func Add(counter Counter, n int64) {
+	defaultHistory.Add(counter, n, time.Now())
+}
+
+// SetGauge sets the gauge of today in the default history.
+func SetGauge(gauge Gauge, value int64) {
+	defaultHistory.SetGauge(gauge, value, time.Now())
+}
+
+// SetInfo sets the version and settings fingerprint of today in the default
+// history.
+func SetInfo(version, settings string) {
+	defaultHistory.SetInfo(version, settings, time.Now())
+}
+
+// List returns entries of the default history since the given time, the
+// oldest first.
+func List(since time.Time) []Entry {
+	return defaultHistory.List(since)
+}
+
+// ParsePeriod parses the length of the listed period given in days, e.g.
+// "30d", or as Go duration, e.g. "12h".
+func ParsePeriod(value string) (time.Duration, error) {
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		number, err := strconv.Atoi(days)
+		if err != nil || number < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", value)
+		}
+		return time.Duration(number) * 24 * time.Hour, nil
+	}
+
+	period, err := time.ParseDuration(value)
+	if err != nil || period < 0 {
+		return 0, fmt.Errorf("invalid period %q, use e.g. 30d or 12h", value)
+	}
+	return period, nil
+}
+
+// Fingerprint returns a short hash of the values, so changed settings can
+// be detected without storing them.
+func Fingerprint(values ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(values, "\x00")))
+	return hex.EncodeToString(hash[:8])
+}
+
+// Open loads the history from path.
+func Open(path string) (*History, error) {
+	h := &History{path: path}
+
+	data, err := ioutil.ReadFile(filepath.Clean(path))
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &h.days); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Save writes the history to its file.
+func (h *History) Save() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(h.days)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(h.path, data, 0600)
+}
+
+// Add adds n to the counter of the day of now.
+func (h *History) Add(counter Counter, n int64, now time.Time) {
+	if n == 0 {
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	day := h.getDay(now)
+	if day.Counters == nil {
+		day.Counters = map[Counter]int64{}
+	}
+	day.Counters[counter] += n
+}
+
+// SetGauge sets the gauge of the day of now.
+func (h *History) SetGauge(gauge Gauge, value int64, now time.Time) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	day := h.getDay(now)
+	if day.Gauges == nil {
+		day.Gauges = map[Gauge]int64{}
+	}
+	day.Gauges[gauge] = value
+}
+
+// SetInfo sets the version and settings fingerprint of the day of now.
+func (h *History) SetInfo(version, settings string, now time.Time) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	day := h.getDay(now)
+	day.Version = version
+	day.Settings = settings
+}
+
+// List returns copy of entries since the given time, the oldest first.
+func (h *History) List(since time.Time) []Entry {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	sinceDate := since.Format(dateFormat)
+
+	entries := []Entry{}
+	for i, day := range h.days {
+		if day.Date < sinceDate {
+			continue
+		}
+
+		entry := Entry{Day: copyDay(day)}
+		if i > 0 {
+			entry.Changes = getChanges(h.days[i-1], day)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// getDay returns the day of now, which is created when it does not exist.
+// Days are expected to come in order, so only the last day is checked.
+func (h *History) getDay(now time.Time) *Day {
+	date := now.Format(dateFormat)
+
+	if len(h.days) > 0 && h.days[len(h.days)-1].Date == date {
+		return h.days[len(h.days)-1]
+	}
+
+	day := &Day{Date: date}
+	h.days = append(h.days, day)
+	if len(h.days) > maxDays {
+		h.days = h.days[len(h.days)-maxDays:]
+	}
+	return day
+}
+
+func getChanges(previous, day *Day) (changes []string) {
+	if previous.Version != "" && day.Version != "" && previous.Version != day.Version {
+		changes = append(changes, "version changed from "+previous.Version+" to "+day.Version)
+	}
+	if previous.Settings != "" && day.Settings != "" && previous.Settings != day.Settings {
+		changes = append(changes, "settings changed")
+	}
+	return changes
+}
+
+func copyDay(day *Day) Day {
+	c := *day
+
+	c.Counters = map[Counter]int64{}
+	for counter, value := range day.Counters {
+		c.Counters[counter] = value
+	}
+
+	c.Gauges = map[Gauge]int64{}
+	for gauge, value := range day.Gauges {
+		c.Gauges[gauge] = value
+	}
+
+	return c
+}
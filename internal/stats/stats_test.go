@@ -0,0 +1,112 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package stats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryCountsPerDay(t *testing.T) {
+	h := &History{}
+	day := time.Date(2020, 10, 1, 12, 0, 0, 0, time.Local)
+
+	h.Add(SyncedMessages, 10, day)
+	h.Add(SyncedMessages, 5, day.Add(time.Hour))
+	h.SetGauge(CacheSize, 100, day)
+	h.SetGauge(CacheSize, 200, day.Add(time.Hour))
+	h.SetInfo("1.5.0", "a", day)
+
+	h.Add(SentMessages, 1, day.Add(24*time.Hour))
+	h.SetInfo("1.5.1", "a", day.Add(24*time.Hour))
+
+	h.SetInfo("1.5.1", "b", day.Add(48*time.Hour))
+
+	entries := h.List(day.Add(-24 * time.Hour))
+	require.Len(t, entries, 3)
+
+	require.Equal(t, "2020-10-01", entries[0].Date)
+	require.Equal(t, int64(15), entries[0].Counters[SyncedMessages])
+	require.Equal(t, int64(200), entries[0].Gauges[CacheSize])
+	require.Empty(t, entries[0].Changes)
+
+	require.Equal(t, int64(1), entries[1].Counters[SentMessages])
+	require.Equal(t, []string{"version changed from 1.5.0 to 1.5.1"}, entries[1].Changes)
+	require.Equal(t, []string{"settings changed"}, entries[2].Changes)
+
+	entries = h.List(day.Add(48 * time.Hour))
+	require.Len(t, entries, 1)
+	require.Equal(t, []string{"settings changed"}, entries[0].Changes, "changes are compared with days before since")
+}
+
+func TestHistoryDropsOldest(t *testing.T) {
+	h := &History{}
+	day := time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local)
+
+	for i := 0; i < maxDays+10; i++ {
+		h.Add(APIErrors, 1, day.AddDate(0, 0, i))
+	}
+
+	entries := h.List(time.Time{})
+	require.Len(t, entries, maxDays)
+	require.Equal(t, day.AddDate(0, 0, 10).Format(dateFormat), entries[0].Date)
+}
+
+func TestHistorySaveAndOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stats")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "stats.json")
+
+	h, err := Open(path)
+	require.NoError(t, err)
+	require.Empty(t, h.List(time.Time{}))
+
+	now := time.Now()
+	h.Add(SentMessages, 3, now)
+	require.NoError(t, h.Save())
+
+	h, err = Open(path)
+	require.NoError(t, err)
+	entries := h.List(now)
+	require.Len(t, entries, 1)
+	require.Equal(t, int64(3), entries[0].Counters[SentMessages])
+}
+
+func TestParsePeriod(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"0d":  0,
+		"12h": 12 * time.Hour,
+	} {
+		period, err := ParsePeriod(value)
+		require.NoError(t, err, value)
+		require.Equal(t, want, period, value)
+	}
+
+	for _, value := range []string{"", "d", "-1d", "month", "-5h"} {
+		_, err := ParsePeriod(value)
+		require.Error(t, err, value)
+	}
+}
@@ -18,9 +18,9 @@
 package store
 
 import (
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/sirupsen/logrus"
-	bolt "go.etcd.io/bbolt"
 )
 
 // Address holds mailboxes for IMAP user (login address). In combined mode
@@ -64,12 +64,14 @@ func (storeAddress *Address) init(foldersAndLabels []*pmapi.Label) (err error) {
 
 	storeAddress.mailboxes = make(map[string]*Mailbox)
 
-	err = storeAddress.store.db.Update(func(tx *bolt.Tx) error {
+	paths := getLabelPaths(foldersAndLabels)
+
+	err = storeAddress.store.db.Update(func(tx storage.Tx) error {
 		for _, label := range foldersAndLabels {
 			prefix := getLabelPrefix(label)
 
 			var mailbox *Mailbox
-			if mailbox, err = txNewMailbox(tx, storeAddress, label.ID, prefix, label.Name, label.Color); err != nil {
+			if mailbox, err = txNewMailbox(tx, storeAddress, label.ID, prefix, paths[label.ID], label.Color); err != nil {
 				storeAddress.log.
 					WithError(err).
 					WithField("labelID", label.ID).
@@ -97,6 +99,34 @@ func getLabelPrefix(l *pmapi.Label) string {
 	}
 }
 
+// maxFolderDepth stops resolving parents of folders with broken hierarchy.
+const maxFolderDepth = 16
+
+// getLabelPaths returns names of labels including names of all parent
+// folders separated by PathDelimiter, e.g. `Parent/Child` for nested folders.
+func getLabelPaths(labels []*pmapi.Label) map[string]string {
+	byID := map[string]*pmapi.Label{}
+	for _, label := range labels {
+		byID[label.ID] = label
+	}
+
+	paths := map[string]string{}
+	for _, label := range labels {
+		path := label.Name
+		parentID := label.ParentID
+		for depth := 0; parentID != "" && depth < maxFolderDepth; depth++ {
+			parent, ok := byID[parentID]
+			if !ok {
+				break
+			}
+			path = parent.Name + PathDelimiter + path
+			parentID = parent.ParentID
+		}
+		paths[label.ID] = path
+	}
+	return paths
+}
+
 // AddressString returns the address.
 func (storeAddress *Address) AddressString() string {
 	return storeAddress.address
@@ -57,8 +57,8 @@ func (storeAddress *Address) CreateMailbox(name string) error {
 
 // updateMailbox updates the mailbox by calling an API.
 // Mailbox is updated in the structure by processing event.
-func (storeAddress *Address) updateMailbox(labelID, newName, color string) error {
-	return storeAddress.store.updateMailbox(labelID, newName, color)
+func (storeAddress *Address) updateMailbox(labelID, newName, parentID, color string) error {
+	return storeAddress.store.updateMailbox(labelID, newName, parentID, color)
 }
 
 // deleteMailbox deletes the mailbox by calling an API.
@@ -67,25 +67,58 @@ func (storeAddress *Address) deleteMailbox(labelID string) error {
 	return storeAddress.store.deleteMailbox(labelID, storeAddress.addressID)
 }
 
+// RefreshMailboxes processes pending events so mailboxes created, renamed
+// or deleted by other clients are listed without waiting for the next poll.
+func (storeAddress *Address) RefreshMailboxes() {
+	storeAddress.store.refreshMailboxes()
+}
+
 // createOrUpdateMailboxEvent creates or updates the mailbox in the structure.
+// Paths are names of all labels including their parent folders; renaming
+// or moving a folder changes names of its subfolders too.
 // This is called from the event loop.
-func (storeAddress *Address) createOrUpdateMailboxEvent(label *pmapi.Label) error {
+func (storeAddress *Address) createOrUpdateMailboxEvent(label *pmapi.Label, paths map[string]string) error {
+	path, ok := paths[label.ID]
+	if !ok {
+		path = label.Name
+	}
+
 	prefix := getLabelPrefix(label)
 	mailbox, ok := storeAddress.mailboxes[label.ID]
 	if !ok {
-		mailbox, err := newMailbox(storeAddress, label.ID, prefix, label.Name, label.Color)
+		mailbox, err := newMailbox(storeAddress, label.ID, prefix, path, label.Color)
 		if err != nil {
 			return err
 		}
 		storeAddress.mailboxes[label.ID] = mailbox
 		mailbox.store.imapMailboxCreated(storeAddress.address, mailbox.labelName)
 	} else {
-		mailbox.labelName = prefix + label.Name
 		mailbox.color = label.Color
+		storeAddress.renameMailboxEvent(mailbox, prefix+path)
+	}
+
+	for _, mailbox := range storeAddress.mailboxes {
+		if path, ok := paths[mailbox.labelID]; ok && mailbox.labelID != label.ID {
+			storeAddress.renameMailboxEvent(mailbox, mailbox.labelPrefix+path)
+		}
 	}
 	return nil
 }
 
+// renameMailboxEvent changes the name of the mailbox. Rename is announced
+// as deletion of the old mailbox and creation of the new one because
+// clients don't support OLDNAME without NOTIFY.
+func (storeAddress *Address) renameMailboxEvent(mailbox *Mailbox, newName string) {
+	oldName := mailbox.labelName
+	if oldName == newName {
+		return
+	}
+
+	mailbox.labelName = newName
+	mailbox.store.imapMailboxDeleted(storeAddress.address, oldName)
+	mailbox.store.imapMailboxCreated(storeAddress.address, newName)
+}
+
 // deleteMailboxEvent deletes the mailbox in the structure.
 // This is called from the event loop.
 func (storeAddress *Address) deleteMailboxEvent(labelID string) error {
@@ -95,7 +128,11 @@ func (storeAddress *Address) deleteMailboxEvent(labelID string) error {
 		return nil
 	}
 	delete(storeAddress.mailboxes, labelID)
-	return storeMailbox.deleteMailboxEvent()
+	if err := storeMailbox.deleteMailboxEvent(); err != nil {
+		return err
+	}
+	storeMailbox.store.imapMailboxDeleted(storeAddress.address, storeMailbox.labelName)
+	return nil
 }
 
 func (storeAddress *Address) getMailboxByID(labelID string) (*Mailbox, error) {
@@ -18,11 +18,11 @@
 package store
 
 import (
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
-	bolt "go.etcd.io/bbolt"
 )
 
-func (storeAddress *Address) txCreateOrUpdateMessages(tx *bolt.Tx, msgs []*pmapi.Message) error {
+func (storeAddress *Address) txCreateOrUpdateMessages(tx storage.Tx, msgs []*pmapi.Message) error {
 	for _, m := range storeAddress.mailboxes {
 		if err := m.txCreateOrUpdateMessages(tx, msgs); err != nil {
 			return err
@@ -32,7 +32,7 @@ func (storeAddress *Address) txCreateOrUpdateMessages(tx *bolt.Tx, msgs []*pmapi
 }
 
 // txDeleteMessage deletes the message from the mailbox buckets for this address.
-func (storeAddress *Address) txDeleteMessage(tx *bolt.Tx, apiID string) error {
+func (storeAddress *Address) txDeleteMessage(tx storage.Tx, apiID string) error {
 	for _, m := range storeAddress.mailboxes {
 		if err := m.txDeleteMessage(tx, apiID); err != nil {
 			return err
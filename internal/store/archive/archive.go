@@ -0,0 +1,378 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package archive provides local plaintext archive of messages in Maildir,
+// mbox or EML format with manifest to check integrity of archived messages.
+package archive
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-mbox"
+	"github.com/pkg/errors"
+)
+
+// Supported formats of the archive.
+const (
+	FormatMaildir = "maildir"
+	FormatMBOX    = "mbox"
+	FormatEML     = "eml"
+)
+
+// manifestName is the file with one JSON entry per archived message.
+const manifestName = "manifest.jsonl"
+
+// Entry is the record in the manifest about one archived message. Offset
+// and Size locate the message in the file, which is needed for mbox files
+// containing many messages.
+type Entry struct {
+	ID       string
+	Mailbox  string
+	Path     string // Relative to the archive root.
+	Offset   int64
+	Size     int64
+	SHA256   string
+	Archived time.Time
+}
+
+// Message is the message to be archived. Body is read only once, while
+// the message is written.
+type Message struct {
+	ID     string
+	From   string
+	Date   time.Time
+	IsRead bool
+	Body   io.Reader
+}
+
+// Archive appends messages to local files. It is safe for concurrent use.
+type Archive struct {
+	root   string
+	format string
+	lock   *sync.Mutex
+}
+
+// New returns archive stored in root folder in the given format.
+func New(root, format string) (*Archive, error) {
+	if format != FormatMaildir && format != FormatMBOX && format != FormatEML {
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Archive{root: root, format: format, lock: &sync.Mutex{}}, nil
+}
+
+// Append writes the message to the mailbox and records it in the manifest.
+func (a *Archive) Append(mailbox string, msg *Message) (err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var entry *Entry
+	switch a.format {
+	case FormatMBOX:
+		entry, err = a.appendMBOX(mailbox, msg)
+	case FormatEML:
+		entry, err = a.appendEML(mailbox, msg)
+	default:
+		entry, err = a.appendMaildir(mailbox, msg)
+	}
+	if err != nil {
+		return
+	}
+
+	return a.appendManifest(entry)
+}
+
+func (a *Archive) appendMaildir(mailbox string, msg *Message) (*Entry, error) {
+	dir := filepath.Join(a.root, mailboxFileName(mailbox))
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	// Unique name is time, hash of the ID (it can contain any characters) and
+	// the name of the host, see https://cr.yp.to/proto/maildir.html.
+	name := fmt.Sprintf("%d.%s.bridge", time.Now().UnixNano(), idHash(msg.ID))
+	info := ":2,"
+	if msg.IsRead {
+		info += "S"
+	}
+
+	tmpPath := filepath.Join(dir, "tmp", name)
+	hw, err := writeMessageFile(tmpPath, msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(mailboxFileName(mailbox), "cur", name+info)
+	if err := os.Rename(tmpPath, filepath.Join(a.root, path)); err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, err
+	}
+
+	return &Entry{
+		ID:       msg.ID,
+		Mailbox:  mailbox,
+		Path:     filepath.ToSlash(path),
+		Size:     hw.n,
+		SHA256:   hex.EncodeToString(hw.hash.Sum(nil)),
+		Archived: time.Now(),
+	}, nil
+}
+
+// appendEML writes the message to its own file named by the date of the
+// message, so files are sorted chronologically.
+func (a *Archive) appendEML(mailbox string, msg *Message) (*Entry, error) {
+	dir := mailboxFileName(mailbox)
+	if err := os.MkdirAll(filepath.Join(a.root, dir), 0700); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, msg.Date.UTC().Format("20060102-150405")+"."+idHash(msg.ID)+".eml")
+	hw, err := writeMessageFile(filepath.Join(a.root, path), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Entry{
+		ID:       msg.ID,
+		Mailbox:  mailbox,
+		Path:     filepath.ToSlash(path),
+		Size:     hw.n,
+		SHA256:   hex.EncodeToString(hw.hash.Sum(nil)),
+		Archived: time.Now(),
+	}, nil
+}
+
+// writeMessageFile writes the body to a new file at path. Partially written
+// file is removed, so failed message does not end up in the archive.
+func writeMessageFile(path string, body io.Reader) (hw *hashWriter, err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(path)
+		}
+	}()
+
+	hw = &hashWriter{w: f, hash: sha256.New()}
+	_, err = io.Copy(hw, body)
+	return hw, err
+}
+
+func (a *Archive) appendMBOX(mailbox string, msg *Message) (*Entry, error) {
+	path := mailboxFileName(mailbox) + ".mbox"
+
+	f, err := os.OpenFile(filepath.Join(a.root, path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint[errcheck]
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// The message is escaped in mbox, so the hash is computed from the
+	// written data instead of the message body.
+	w := &hashWriter{w: f, hash: sha256.New()}
+	mboxWriter := mbox.NewWriter(w)
+	mw, err := mboxWriter.CreateMessage(msg.From, msg.Date)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(mw, msg.Body)
+	if err == nil {
+		// Closing writes the rest of the last line and the message separator.
+		err = mboxWriter.Close()
+	}
+	if err != nil {
+		// Partially written message would break the following ones.
+		_ = f.Truncate(info.Size())
+		return nil, err
+	}
+
+	return &Entry{
+		ID:       msg.ID,
+		Mailbox:  mailbox,
+		Path:     path,
+		Offset:   info.Size(),
+		Size:     w.n,
+		SHA256:   hex.EncodeToString(w.hash.Sum(nil)),
+		Archived: time.Now(),
+	}, f.Sync()
+}
+
+// TempFile creates a temporary file in the archive, e.g. to build a message
+// once and append it to more mailboxes. The caller has to remove it.
+func (a *Archive) TempFile() (*os.File, error) {
+	dir := filepath.Join(a.root, ".tmp")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return ioutil.TempFile(dir, "message")
+}
+
+// WriteAttachment writes the attachment of the message to its own file in
+// the attachments folder. Attachments are not recorded in the manifest.
+func (a *Archive) WriteAttachment(mailbox, messageID, name string, r io.Reader) (path string, err error) {
+	dir := filepath.Join("attachments", mailboxFileName(mailbox), idHash(messageID))
+	if err := os.MkdirAll(filepath.Join(a.root, dir), 0700); err != nil {
+		return "", err
+	}
+
+	// Name comes from the message, it must not escape the folder.
+	name = filepath.Base(filepath.Clean("/" + strings.ReplaceAll(name, "\\", "/")))
+	if name == "." || name == string(filepath.Separator) {
+		name = "attachment"
+	}
+
+	// Message can have more attachments with the same name.
+	var f *os.File
+	for i := 0; f == nil; i++ {
+		path = filepath.Join(dir, name)
+		if i > 0 {
+			path = filepath.Join(dir, fmt.Sprintf("%d-%s", i, name))
+		}
+		if f, err = os.OpenFile(filepath.Join(a.root, path), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600); err != nil && !os.IsExist(err) {
+			return "", err
+		}
+	}
+	defer f.Close() //nolint[errcheck]
+
+	if _, err := io.Copy(f, r); err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(path), f.Sync()
+}
+
+func (a *Archive) appendManifest(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(a.root, manifestName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint[errcheck]
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Verify checks all messages in the manifest and returns entries of those
+// which are missing or were changed.
+func (a *Archive) Verify() (broken []*Entry, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	f, err := os.Open(filepath.Join(a.root, manifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint[errcheck]
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, errors.Wrap(err, "corrupted manifest")
+		}
+		if !a.verifyEntry(entry) {
+			broken = append(broken, entry)
+		}
+	}
+
+	return broken, scanner.Err()
+}
+
+func (a *Archive) verifyEntry(entry *Entry) bool {
+	f, err := os.Open(filepath.Join(a.root, filepath.FromSlash(entry.Path)))
+	if err != nil {
+		return false
+	}
+	defer f.Close() //nolint[errcheck]
+
+	hash := sha256.New()
+	if n, err := io.Copy(hash, io.NewSectionReader(f, entry.Offset, entry.Size)); err != nil || n != entry.Size {
+		return false
+	}
+	return hex.EncodeToString(hash.Sum(nil)) == entry.SHA256
+}
+
+// mailboxFileName flattens mailbox hierarchy to one file name the same way
+// as Maildir++ does, e.g. `Folders/Work` is `Folders.Work`.
+func mailboxFileName(mailbox string) string {
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\':
+			return '.'
+		case 0:
+			return -1
+		}
+		return r
+	}, mailbox)
+	return strings.TrimLeft(name, ".")
+}
+
+// idHash is used in file names instead of the message ID which can
+// contain any characters.
+func idHash(id string) string {
+	hash := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(hash[:8])
+}
+
+type hashWriter struct {
+	w    io.Writer
+	hash hash.Hash
+	n    int64
+}
+
+func (w *hashWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	_, _ = w.hash.Write(p[:n])
+	w.n += int64(n)
+	return n, err
+}
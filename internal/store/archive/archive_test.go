@@ -0,0 +1,165 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestArchive(t *testing.T, format string) (*Archive, string, func()) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+
+	a, err := New(dir, format)
+	require.NoError(t, err)
+
+	return a, dir, func() { _ = os.RemoveAll(dir) }
+}
+
+func testBody(id string) []byte {
+	return []byte("Subject: " + id + "\r\n\r\nFrom the start\r\nlast line")
+}
+
+func testMessage(id string, isRead bool) *Message {
+	return &Message{
+		ID:     id,
+		From:   "alice@example.com",
+		Date:   time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC),
+		IsRead: isRead,
+		Body:   bytes.NewReader(testBody(id)),
+	}
+}
+
+// failingMessage fails while its body is being read.
+func failingMessage(id string) *Message {
+	msg := testMessage(id, false)
+	msg.Body = io.MultiReader(msg.Body, failingReader{})
+	return msg
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("cannot build message")
+}
+
+func TestArchiveMaildir(t *testing.T) {
+	a, dir, clear := newTestArchive(t, FormatMaildir)
+	defer clear()
+
+	require.NoError(t, a.Append("Folders/Work", testMessage("unread", false)))
+	require.NoError(t, a.Append("Folders/Work", testMessage("read", true)))
+
+	files, err := filepath.Glob(filepath.Join(dir, "Folders.Work", "cur", "*"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	require.Regexp(t, `:2,$`, files[0])
+	require.Regexp(t, `:2,S$`, files[1])
+
+	body, err := ioutil.ReadFile(files[1])
+	require.NoError(t, err)
+	require.Equal(t, testBody("read"), body)
+
+	broken, err := a.Verify()
+	require.NoError(t, err)
+	require.Empty(t, broken)
+
+	require.NoError(t, ioutil.WriteFile(files[0], []byte("changed"), 0600))
+	broken, err = a.Verify()
+	require.NoError(t, err)
+	require.Len(t, broken, 1)
+	require.Equal(t, "unread", broken[0].ID)
+}
+
+func TestArchiveMBOX(t *testing.T) {
+	a, dir, clear := newTestArchive(t, FormatMBOX)
+	defer clear()
+
+	require.NoError(t, a.Append("INBOX", testMessage("first", false)))
+	require.Error(t, a.Append("INBOX", failingMessage("failed")))
+	require.NoError(t, a.Append("INBOX", testMessage("second", false)))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "INBOX.mbox"))
+	require.NoError(t, err)
+	require.Equal(t, "From alice@example.com Thu Oct  1 12:00:00 2020\nSubject: first\n\n>From the start\nlast line\n\n"+
+		"From alice@example.com Thu Oct  1 12:00:00 2020\nSubject: second\n\n>From the start\nlast line\n\n", string(data))
+
+	broken, err := a.Verify()
+	require.NoError(t, err)
+	require.Empty(t, broken)
+
+	// Truncated file breaks only the last message.
+	require.NoError(t, os.Truncate(filepath.Join(dir, "INBOX.mbox"), int64(len(data)-1)))
+	broken, err = a.Verify()
+	require.NoError(t, err)
+	require.Len(t, broken, 1)
+	require.Equal(t, "second", broken[0].ID)
+}
+
+func TestArchiveEML(t *testing.T) {
+	a, dir, clear := newTestArchive(t, FormatEML)
+	defer clear()
+
+	require.NoError(t, a.Append("Folders/Work", testMessage("first", false)))
+	require.Error(t, a.Append("Folders/Work", failingMessage("failed")))
+
+	files, err := filepath.Glob(filepath.Join(dir, "Folders.Work", "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Regexp(t, `20201001-120000\.[0-9a-f]{16}\.eml$`, files[0])
+
+	body, err := ioutil.ReadFile(files[0])
+	require.NoError(t, err)
+	require.Equal(t, testBody("first"), body)
+
+	broken, err := a.Verify()
+	require.NoError(t, err)
+	require.Empty(t, broken)
+}
+
+func TestArchiveWriteAttachment(t *testing.T) {
+	a, dir, clear := newTestArchive(t, FormatEML)
+	defer clear()
+
+	first, err := a.WriteAttachment("INBOX", "msg", "../../report.pdf", strings.NewReader("first"))
+	require.NoError(t, err)
+	second, err := a.WriteAttachment("INBOX", "msg", "report.pdf", strings.NewReader("second"))
+	require.NoError(t, err)
+
+	require.Regexp(t, `^attachments/INBOX/[0-9a-f]{16}/report\.pdf$`, first)
+	require.Regexp(t, `^attachments/INBOX/[0-9a-f]{16}/1-report\.pdf$`, second)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(second)))
+	require.NoError(t, err)
+	require.Equal(t, "second", string(data))
+}
+
+func TestArchiveUnknownFormat(t *testing.T) {
+	_, err := New(os.TempDir(), "zip")
+	require.Error(t, err)
+}
@@ -0,0 +1,586 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// errAttachmentTooBig is returned when the attachment does not fit into the
+// cache at all.
+var errAttachmentTooBig = errors.New("attachment is bigger than the cache") //nolint[gochecknoglobals]
+
+// AttachmentCache persists decrypted attachments on disk. Content is stored
+// only once no matter how many messages contain the same attachment, e.g.
+// logos in signatures. Each attachment of a message is a reference to the
+// stored content which is removed when the last reference is removed.
+// When the total size exceeds the limit, the least recently used content
+// is removed together with all its references. Content is encrypted and
+// named by the key of the user (see SetUserKey), therefore it is shared only
+// by messages of the same user. There should be only one instance shared by
+// all users.
+type AttachmentCache struct {
+	backend   CacheBackend
+	sizeLimit int64
+	ciphers   cacheCiphers
+
+	lock      *sync.Mutex
+	refs      map[string]string // Name of reference to name of content.
+	blobs     map[string]*attachmentBlob
+	totalSize int64
+}
+
+type attachmentBlob struct {
+	name     string
+	size     int64
+	lastUsed time.Time
+	refs     map[string]struct{}
+}
+
+// NewAttachmentCache opens the attachment cache in local dir.
+func NewAttachmentCache(dir string, sizeLimit int64) (*AttachmentCache, error) {
+	backend, err := NewLocalCacheBackend(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAttachmentCacheWithBackend(backend, sizeLimit)
+}
+
+// NewAttachmentCacheWithBackend opens the attachment cache stored in backend.
+func NewAttachmentCacheWithBackend(backend CacheBackend, sizeLimit int64) (*AttachmentCache, error) {
+	c := &AttachmentCache{
+		backend:   backend,
+		sizeLimit: sizeLimit,
+		ciphers:   newCacheCiphers(),
+		lock:      &sync.Mutex{},
+		refs:      map[string]string{},
+		blobs:     map[string]*attachmentBlob{},
+	}
+
+	if err := c.load(); err != nil {
+		return nil, errors.Wrap(err, "failed to load attachment cache")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.evict()
+
+	return c, nil
+}
+
+// Close releases the backend, e.g. the lock of a shared folder.
+func (c *AttachmentCache) Close() error {
+	return c.backend.Close()
+}
+
+// load builds the index from the files in the backend. Modification time
+// of the content file is used as the last time the content was used.
+// References to missing content and content without references are removed
+// as well as content which was not written completely.
+func (c *AttachmentCache) load() error {
+	if err := c.backend.RemoveAll(c.getTmpDir()); err != nil {
+		return err
+	}
+
+	if err := c.backend.Walk(c.getBlobsDir(), func(blobPath string, size int64, lastUsed time.Time) error {
+		name := filepath.Base(blobPath)
+
+		c.blobs[name] = &attachmentBlob{
+			name:     name,
+			size:     size,
+			lastUsed: lastUsed,
+			refs:     map[string]struct{}{},
+		}
+		c.totalSize += size
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := c.backend.Walk(c.getRefsDir(), func(refPath string, _ int64, _ time.Time) error {
+		name, err := c.backend.ReadFile(refPath)
+		if err != nil {
+			return err
+		}
+
+		blob, ok := c.blobs[string(name)]
+		if !ok {
+			return c.backend.Remove(refPath)
+		}
+
+		c.refs[refPath] = blob.name
+		blob.refs[refPath] = struct{}{}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, blob := range c.blobs {
+		if len(blob.refs) == 0 {
+			c.removeBlob(blob)
+		}
+	}
+
+	return nil
+}
+
+// SetUserKey sets the key encrypting attachments of the user. Attachments
+// of users without the key are neither returned nor stored.
+func (c *AttachmentCache) SetUserKey(userID string, key []byte) error {
+	return c.ciphers.SetUserKey(userID, key)
+}
+
+// Get returns the reader of the cached attachment or false if it is not
+// cached. The reader must be closed.
+func (c *AttachmentCache) Get(userID, messageID, attachmentID string) (io.ReadCloser, bool) {
+	userCipher, err := c.ciphers.get(userID)
+	if err != nil {
+		return nil, false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	blob, ok := c.blobs[c.refs[c.getRefPath(userID, messageID, attachmentID)]]
+	if !ok {
+		return nil, false
+	}
+
+	file, err := c.backend.Open(c.getBlobPath(blob.name))
+	if err != nil {
+		log.WithError(err).Warn("Cannot read cached attachment")
+		c.removeBlob(blob)
+		return nil, false
+	}
+
+	r, err := newCacheStreamReader(userCipher.gcm, file)
+	if err != nil {
+		_ = file.Close()
+		// Most probably encrypted by a different key.
+		log.WithError(err).Warn("Cannot decrypt cached attachment")
+		c.removeBlob(blob)
+		return nil, false
+	}
+
+	blob.lastUsed = time.Now()
+	_ = c.backend.Touch(c.getBlobPath(blob.name), blob.lastUsed)
+
+	return &cachedAttachmentReader{Reader: r, Closer: file}, true
+}
+
+type cachedAttachmentReader struct {
+	io.Reader
+	io.Closer
+}
+
+// Set stores the attachment to the cache. Content which is cached already
+// is only referenced. The least recently used content is evicted if the
+// cache is too big.
+func (c *AttachmentCache) Set(userID, messageID, attachmentID string, data []byte) error {
+	w, err := c.NewWriter(userID)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Discard()
+		return err
+	}
+	if err := w.Commit(messageID, attachmentID); err != errAttachmentTooBig {
+		return err
+	}
+	w.Discard()
+	return nil
+}
+
+// NewWriter returns the writer storing the attachment to the cache while
+// it is written, so the attachment does not have to be held in memory.
+// The attachment is stored by Commit the same way as by Set.
+func (c *AttachmentCache) NewWriter(userID string) (*AttachmentWriter, error) {
+	userCipher, err := c.ciphers.get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	tmpPath := filepath.Join(c.getTmpDir(), hex.EncodeToString(random))
+
+	file, err := c.backend.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &AttachmentWriter{
+		cache:   c,
+		userID:  userID,
+		tmpPath: tmpPath,
+		file:    file,
+		counter: &countingWriter{w: file},
+		mac:     hmac.New(sha256.New, userCipher.hashKey),
+	}
+	if w.enc, err = newCacheStreamWriter(userCipher.gcm, w.counter); err != nil {
+		w.Discard()
+		return nil, err
+	}
+	return w, nil
+}
+
+// AttachmentWriter encrypts the attachment into a temporary file of the
+// cache while it is written. The content is named by its hash once it is
+// complete.
+type AttachmentWriter struct {
+	cache   *AttachmentCache
+	userID  string
+	tmpPath string
+	file    io.WriteCloser
+	counter *countingWriter
+	enc     *cacheStreamWriter
+	mac     hash.Hash
+
+	size   int64
+	closed bool
+}
+
+func (w *AttachmentWriter) Write(p []byte) (int, error) {
+	_, _ = w.mac.Write(p)
+	n, err := w.enc.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// countingWriter counts bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Size returns the size of the written attachment.
+func (w *AttachmentWriter) Size() int64 {
+	return w.size
+}
+
+// Commit stores the written attachment as the attachment of the message.
+// The writer must not be used afterwards, unless errAttachmentTooBig is
+// returned; then the attachment is not stored and the writer has to be
+// discarded.
+func (w *AttachmentWriter) Commit(messageID, attachmentID string) error {
+	if err := w.close(); err != nil {
+		w.Discard()
+		return err
+	}
+
+	c := w.cache
+	name := hex.EncodeToString(w.mac.Sum(nil))
+	refPath := c.getRefPath(w.userID, messageID, attachmentID)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.refs[refPath] == name {
+		w.Discard()
+		return nil
+	}
+	if _, ok := c.refs[refPath]; ok {
+		c.removeRef(refPath)
+	}
+
+	blob, ok := c.blobs[name]
+	if ok {
+		w.Discard()
+	} else {
+		if w.counter.n > c.sizeLimit {
+			return errAttachmentTooBig
+		}
+
+		if err := c.backend.Rename(w.tmpPath, c.getBlobPath(name)); err != nil {
+			w.Discard()
+			return err
+		}
+
+		blob = &attachmentBlob{
+			name: name,
+			size: w.counter.n,
+			refs: map[string]struct{}{},
+		}
+		c.blobs[name] = blob
+		c.totalSize += blob.size
+	}
+	blob.lastUsed = time.Now()
+
+	if err := c.backend.WriteFile(refPath, []byte(name)); err != nil {
+		if len(blob.refs) == 0 {
+			c.removeBlob(blob)
+		}
+		return err
+	}
+
+	c.refs[refPath] = name
+	blob.refs[refPath] = struct{}{}
+
+	c.evict()
+
+	return nil
+}
+
+// Open returns the reader of the written attachment which is neither
+// committed nor discarded yet. The reader must be closed.
+func (w *AttachmentWriter) Open() (io.ReadCloser, error) {
+	if err := w.close(); err != nil {
+		return nil, err
+	}
+
+	userCipher, err := w.cache.ciphers.get(w.userID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := w.cache.backend.Open(w.tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newCacheStreamReader(userCipher.gcm, file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &cachedAttachmentReader{Reader: r, Closer: file}, nil
+}
+
+// Discard removes the written content. The writer must not be used
+// afterwards.
+func (w *AttachmentWriter) Discard() {
+	if !w.closed {
+		w.closed = true
+		_ = w.file.Close()
+	}
+	if err := w.cache.backend.Remove(w.tmpPath); err != nil {
+		log.WithError(err).Warn("Cannot remove incomplete cached attachment")
+	}
+}
+
+func (w *AttachmentWriter) close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if err := w.enc.Close(); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// DeleteMessage removes references of all attachments of the message.
+func (c *AttachmentCache) DeleteMessage(userID, messageID string) {
+	if err := c.removeDir(c.getMessageDir(userID, messageID)); err != nil {
+		log.WithError(err).Warn("Cannot remove cached attachments of message")
+	}
+}
+
+// Size returns the total size of cached attachments.
+func (c *AttachmentCache) Size() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.totalSize
+}
+
+// UserSize returns the size of content referenced by attachments of the
+// user.
+func (c *AttachmentCache) UserSize(userID string) (size int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	prefix := c.getUserDir(userID) + string(filepath.Separator)
+	counted := map[string]struct{}{}
+	for refPath, name := range c.refs {
+		if _, ok := counted[name]; ok || !strings.HasPrefix(refPath, prefix) {
+			continue
+		}
+		counted[name] = struct{}{}
+		if blob, ok := c.blobs[name]; ok {
+			size += blob.size
+		}
+	}
+	return
+}
+
+// Compact removes references of attachments of the user's messages other
+// than the given ones and returns the size of content removed with them.
+func (c *AttachmentCache) Compact(userID string, messageIDs []string) int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	keep := map[string]struct{}{}
+	for _, messageID := range messageIDs {
+		keep[c.getMessageDir(userID, messageID)] = struct{}{}
+	}
+
+	sizeBefore := c.totalSize
+	prefix := c.getUserDir(userID) + string(filepath.Separator)
+	removedDirs := map[string]struct{}{}
+	for refPath := range c.refs {
+		messageDir := filepath.Dir(refPath)
+		if _, ok := keep[messageDir]; ok || !strings.HasPrefix(refPath, prefix) {
+			continue
+		}
+		c.removeRef(refPath)
+		removedDirs[messageDir] = struct{}{}
+	}
+	for dir := range removedDirs {
+		if err := c.backend.RemoveAll(dir); err != nil {
+			log.WithError(err).Warn("Cannot remove cached attachments of message")
+		}
+	}
+	return sizeBefore - c.totalSize
+}
+
+// RemoveUser removes references of all attachments of the user.
+func (c *AttachmentCache) RemoveUser(userID string) error {
+	return c.removeDir(c.getUserDir(userID))
+}
+
+func (c *AttachmentCache) removeDir(dir string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	prefix := dir + string(filepath.Separator)
+	for refPath := range c.refs {
+		if strings.HasPrefix(refPath, prefix) {
+			c.removeRef(refPath)
+		}
+	}
+
+	return c.backend.RemoveAll(dir)
+}
+
+// evict removes the least recently used content until the total size is
+// within the limit.
+func (c *AttachmentCache) evict() {
+	if c.totalSize <= c.sizeLimit {
+		return
+	}
+
+	blobs := make([]*attachmentBlob, 0, len(c.blobs))
+	for _, blob := range c.blobs {
+		blobs = append(blobs, blob)
+	}
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].lastUsed.Before(blobs[j].lastUsed)
+	})
+
+	for _, blob := range blobs {
+		if c.totalSize <= c.sizeLimit {
+			break
+		}
+		c.removeBlob(blob)
+	}
+}
+
+// removeRef removes the reference and the content if it was the last one.
+func (c *AttachmentCache) removeRef(refPath string) {
+	if err := c.backend.Remove(refPath); err != nil {
+		log.WithError(err).Warn("Cannot remove cached attachment reference")
+	}
+
+	blob, ok := c.blobs[c.refs[refPath]]
+	delete(c.refs, refPath)
+	if !ok {
+		return
+	}
+
+	delete(blob.refs, refPath)
+	if len(blob.refs) == 0 {
+		c.removeBlob(blob)
+	}
+}
+
+// removeBlob removes the content together with all its references.
+func (c *AttachmentCache) removeBlob(blob *attachmentBlob) {
+	for refPath := range blob.refs {
+		if err := c.backend.Remove(refPath); err != nil {
+			log.WithError(err).Warn("Cannot remove cached attachment reference")
+		}
+		delete(c.refs, refPath)
+	}
+
+	if err := c.backend.Remove(c.getBlobPath(blob.name)); err != nil {
+		log.WithError(err).Warn("Cannot remove cached attachment")
+	}
+	c.totalSize -= blob.size
+	delete(c.blobs, blob.name)
+}
+
+func (c *AttachmentCache) getBlobsDir() string {
+	return "blobs"
+}
+
+func (c *AttachmentCache) getBlobPath(name string) string {
+	return filepath.Join(c.getBlobsDir(), name)
+}
+
+// getTmpDir returns the folder of content being written.
+func (c *AttachmentCache) getTmpDir() string {
+	return "tmp"
+}
+
+func (c *AttachmentCache) getRefsDir() string {
+	return "refs"
+}
+
+// getRefPath hashes IDs to not leak them in file names and to avoid
+// problems with characters not allowed in paths.
+func (c *AttachmentCache) getRefPath(userID, messageID, attachmentID string) string {
+	hash := sha256.Sum256([]byte(attachmentID))
+	return filepath.Join(c.getMessageDir(userID, messageID), hex.EncodeToString(hash[:]))
+}
+
+func (c *AttachmentCache) getMessageDir(userID, messageID string) string {
+	hash := sha256.Sum256([]byte(messageID))
+	return filepath.Join(c.getUserDir(userID), hex.EncodeToString(hash[:]))
+}
+
+func (c *AttachmentCache) getUserDir(userID string) string {
+	hash := sha256.Sum256([]byte(userID))
+	return filepath.Join(c.getRefsDir(), hex.EncodeToString(hash[:]))
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAttachmentCache(t *testing.T, sizeLimit int64) (*AttachmentCache, string, func()) {
+	dir, err := ioutil.TempDir("", "attachment-cache")
+	require.NoError(t, err)
+
+	c, err := NewAttachmentCache(filepath.Join(dir, "attachments"), sizeLimit)
+	require.NoError(t, err)
+	setTestCacheKeys(t, c, 1)
+
+	return c, dir, func() { _ = os.RemoveAll(dir) }
+}
+
+func countAttachmentBlobs(t *testing.T, dir string) int {
+	files, err := ioutil.ReadDir(filepath.Join(dir, "attachments", "blobs"))
+	require.NoError(t, err)
+	return len(files)
+}
+
+// getCachedAttachment returns the content of the cached attachment.
+func getCachedAttachment(t *testing.T, c *AttachmentCache, userID, messageID, attachmentID string) (string, bool) {
+	r, ok := c.Get(userID, messageID, attachmentID)
+	if !ok {
+		return "", false
+	}
+	defer r.Close() //nolint[errcheck]
+
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return string(data), true
+}
+
+func TestAttachmentCacheStoresSameContentOnce(t *testing.T) {
+	c, dir, clear := newTestAttachmentCache(t, 1000)
+	defer clear()
+
+	_, ok := getCachedAttachment(t, c, "userID", "msg1", "att1")
+	require.False(t, ok)
+
+	require.NoError(t, c.Set("userID", "msg1", "att1", []byte("logo")))
+	require.NoError(t, c.Set("userID", "msg2", "att2", []byte("logo")))
+	require.NoError(t, c.Set("otherUserID", "msg3", "att3", []byte("logo")))
+	require.NoError(t, c.Set("userID", "msg2", "att4", []byte("document")))
+
+	// Content is shared only by the same user, each user has a different key.
+	require.Equal(t, 3, countAttachmentBlobs(t, dir))
+
+	data, ok := getCachedAttachment(t, c, "otherUserID", "msg3", "att3")
+	require.True(t, ok)
+	require.Equal(t, "logo", data)
+
+	// Cache survives restart.
+	c, err := NewAttachmentCache(filepath.Join(dir, "attachments"), 1000)
+	require.NoError(t, err)
+	setTestCacheKeys(t, c, 1)
+	data, ok = getCachedAttachment(t, c, "userID", "msg1", "att1")
+	require.True(t, ok)
+	require.Equal(t, "logo", data)
+
+	// Content is removed with the last reference.
+	c.DeleteMessage("userID", "msg1")
+	require.NoError(t, c.RemoveUser("otherUserID"))
+	_, ok = getCachedAttachment(t, c, "userID", "msg1", "att1")
+	require.False(t, ok)
+	require.Equal(t, 2, countAttachmentBlobs(t, dir))
+
+	c.DeleteMessage("userID", "msg2")
+	require.Equal(t, 0, countAttachmentBlobs(t, dir))
+}
+
+func TestAttachmentCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	// Each encrypted attachment has 100 bytes plus 23 bytes of nonce and tag.
+	c, _, clear := newTestAttachmentCache(t, 300)
+	defer clear()
+
+	require.NoError(t, c.Set("userID", "msg1", "att1", []byte(strings.Repeat("a", 100))))
+	require.NoError(t, c.Set("userID", "msg2", "att2", []byte(strings.Repeat("a", 100))))
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, c.Set("userID", "msg3", "att3", []byte(strings.Repeat("b", 100))))
+	time.Sleep(10 * time.Millisecond)
+
+	// Using att3 makes the shared content the least recently used one.
+	_, ok := getCachedAttachment(t, c, "userID", "msg3", "att3")
+	require.True(t, ok)
+
+	require.NoError(t, c.Set("userID", "msg4", "att4", []byte(strings.Repeat("c", 100))))
+
+	_, ok = getCachedAttachment(t, c, "userID", "msg1", "att1")
+	require.False(t, ok)
+	_, ok = getCachedAttachment(t, c, "userID", "msg2", "att2")
+	require.False(t, ok)
+	_, ok = getCachedAttachment(t, c, "userID", "msg3", "att3")
+	require.True(t, ok)
+	_, ok = getCachedAttachment(t, c, "userID", "msg4", "att4")
+	require.True(t, ok)
+}
+
+func TestAttachmentCacheWithDifferentKey(t *testing.T) {
+	c, dir, clear := newTestAttachmentCache(t, 1000)
+	defer clear()
+
+	require.NoError(t, c.Set("userID", "msgID", "attID", []byte("secret")))
+
+	c, err := NewAttachmentCache(filepath.Join(dir, "attachments"), 1000)
+	require.NoError(t, err)
+	setTestCacheKeys(t, c, 3)
+
+	_, ok := getCachedAttachment(t, c, "userID", "msgID", "attID")
+	require.False(t, ok)
+}
+
+func TestAttachmentCacheWriterStreamsBigAttachment(t *testing.T) {
+	c, dir, clear := newTestAttachmentCache(t, 10*cacheChunkSize)
+	defer clear()
+
+	content := strings.Repeat("0123456789", cacheChunkSize/4)
+
+	w, err := c.NewWriter("userID")
+	require.NoError(t, err)
+	for i := 0; i < len(content); i += 1000 {
+		end := i + 1000
+		if end > len(content) {
+			end = len(content)
+		}
+		_, err := w.Write([]byte(content[i:end]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Commit("msg1", "att1"))
+
+	data, ok := getCachedAttachment(t, c, "userID", "msg1", "att1")
+	require.True(t, ok)
+	require.Equal(t, content, data)
+
+	// Discarded attachment leaves nothing behind.
+	w, err = c.NewWriter("userID")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("incomplete"))
+	require.NoError(t, err)
+	w.Discard()
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "attachments", "tmp"))
+	require.NoError(t, err)
+	require.Empty(t, files)
+	require.Equal(t, 1, countAttachmentBlobs(t, dir))
+}
+
+func TestAttachmentCacheDetectsTruncatedAttachment(t *testing.T) {
+	c, dir, clear := newTestAttachmentCache(t, 10*cacheChunkSize)
+	defer clear()
+
+	require.NoError(t, c.Set("userID", "msg1", "att1", []byte(strings.Repeat("a", 2*cacheChunkSize+1))))
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "attachments", "blobs"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	// The last chunk is cut off, the first one can be still decrypted.
+	blobPath := filepath.Join(dir, "attachments", "blobs", files[0].Name())
+	require.NoError(t, os.Truncate(blobPath, cacheNoncePrefixSize+2*(cacheChunkSize+16)))
+
+	r, ok := c.Get("userID", "msg1", "att1")
+	require.True(t, ok)
+	defer r.Close() //nolint[errcheck]
+
+	_, err = ioutil.ReadAll(r)
+	require.Error(t, err)
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/go-vcard"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/google/uuid"
+)
+
+// Fields of contact cards with PGP settings of the email.
+const (
+	vCardFieldPMEncrypt = "X-PM-ENCRYPT"
+	vCardFieldPMScheme  = "X-PM-SCHEME"
+	vCardPGPMIMEScheme  = "pgp-mime"
+	vCardKeyPrefix      = "data:application/pgp-keys;base64,"
+)
+
+var (
+	autocryptImport     bool         //nolint[gochecknoglobals]
+	autocryptImportLock sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetAutocryptImport sets whether keys from Autocrypt headers of received
+// messages are added to contacts of senders which have no key yet.
+func SetAutocryptImport(enabled bool) {
+	autocryptImportLock.Lock()
+	defer autocryptImportLock.Unlock()
+
+	autocryptImport = enabled
+}
+
+func isAutocryptImportEnabled() bool {
+	autocryptImportLock.RLock()
+	defer autocryptImportLock.RUnlock()
+
+	return autocryptImport
+}
+
+func (loop *eventLoop) importAutocrypt(msg *pmapi.Message) {
+	if !isAutocryptImportEnabled() || !isReceivedMessage(msg) || msg.Sender == nil {
+		return
+	}
+
+	go func() {
+		defer loop.store.panicHandler.HandlePanic()
+		loop.store.importAutocrypt(msg)
+	}()
+}
+
+// importAutocrypt adds the key from the Autocrypt header of the message to
+// the contact of the sender. Keys set by the user are never replaced.
+func (store *Store) importAutocrypt(msg *pmapi.Message) {
+	log := store.log.WithField("msgID", msg.ID)
+
+	header := msg.Header
+	if len(header) == 0 {
+		fullMsg, err := store.client().GetMessage(store.ctx, msg.ID)
+		if err != nil {
+			log.WithError(err).Warn("Cannot get header for Autocrypt")
+			return
+		}
+		header = fullMsg.Header
+	}
+
+	autocrypt := message.GetAutocrypt(header, msg.Sender.Address)
+	if autocrypt == nil {
+		return
+	}
+
+	key, err := crypto.NewKey(autocrypt.KeyData)
+	if err != nil || key.IsPrivate() || key.IsExpired() {
+		log.WithError(err).Warn("Ignoring invalid Autocrypt key")
+		return
+	}
+
+	// Senders send the same key with every message.
+	seenKey := strings.ToLower(autocrypt.Addr) + ":" + key.GetFingerprint()
+	if _, seen := store.autocryptSeen.LoadOrStore(seenKey, true); seen {
+		return
+	}
+
+	if err := store.addContactKey(msg.Sender.Name, autocrypt); err != nil {
+		store.autocryptSeen.Delete(seenKey)
+		log.WithError(err).Warn("Cannot add Autocrypt key to contact")
+	}
+}
+
+// addContactKey adds the key to the contact with the address. New contact
+// is created when there is none.
+func (store *Store) addContactKey(name string, autocrypt *message.Autocrypt) error {
+	contactEmails, err := store.client().GetContactEmailByEmail(store.ctx, autocrypt.Addr, 0, 1000)
+	if err != nil {
+		return err
+	}
+
+	if len(contactEmails) == 0 {
+		if name == "" {
+			name = autocrypt.Addr
+		}
+		cards, err := store.client().EncryptAndSignCards([]pmapi.Card{{
+			Type: pmapi.CardSigned,
+			Data: newAutocryptCard(name, autocrypt),
+		}})
+		if err != nil {
+			return err
+		}
+		store.log.Info("Adding contact with Autocrypt key")
+		_, err = store.client().AddContacts(store.ctx, pmapi.ContactsCards{Contacts: []pmapi.CardsList{{Cards: cards}}}, 0, 1, 0)
+		return err
+	}
+
+	contact, err := store.client().GetContactByID(store.ctx, contactEmails[0].ContactID)
+	if err != nil {
+		return err
+	}
+
+	for i, card := range contact.Cards {
+		if card.Type != pmapi.CardSigned {
+			continue
+		}
+
+		data, changed, err := addAutocryptKeyToCard(card.Data, autocrypt)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+
+		signed, err := store.client().EncryptAndSignCards([]pmapi.Card{{Type: pmapi.CardSigned, Data: data}})
+		if err != nil {
+			return err
+		}
+
+		// Other cards are sent back unchanged, still encrypted.
+		cards := append([]pmapi.Card{}, contact.Cards...)
+		cards[i] = signed[0]
+
+		store.log.Info("Adding Autocrypt key to contact")
+		_, err = store.client().UpdateContact(store.ctx, contact.ID, cards)
+		return err
+	}
+
+	return nil
+}
+
+// newAutocryptCard returns signed part of the new contact with the key.
+func newAutocryptCard(name string, autocrypt *message.Autocrypt) string {
+	card := make(vcard.Card)
+	card.SetValue(vcard.FieldVersion, "4.0")
+	card.SetValue(vcard.FieldFormattedName, name)
+	card.SetValue(vcard.FieldUID, "proton-autocrypt-"+uuid.New().String())
+	card.Add(vcard.FieldEmail, &vcard.Field{Value: autocrypt.Addr, Group: "item1"})
+	addAutocryptFields(card, "item1", autocrypt)
+
+	b := &bytes.Buffer{}
+	// Card always has VERSION which is the only reason to fail.
+	_ = vcard.NewEncoder(b).Encode(card)
+	return b.String()
+}
+
+// addAutocryptKeyToCard adds the key to the email in the signed card unless
+// the email has a key already. It returns whether the card was changed.
+func addAutocryptKeyToCard(data string, autocrypt *message.Autocrypt) (string, bool, error) {
+	card, err := vcard.NewDecoder(strings.NewReader(data)).Decode()
+	if err != nil {
+		return "", false, err
+	}
+
+	var email *vcard.Field
+	for _, field := range card[vcard.FieldEmail] {
+		if strings.EqualFold(field.Value, autocrypt.Addr) {
+			email = field
+			break
+		}
+	}
+	if email == nil {
+		return data, false, nil
+	}
+
+	if email.Group == "" {
+		email.Group = newCardGroup(card)
+	} else if len(card.GetAllValueByGroup(vcard.FieldKey, email.Group)) > 0 {
+		return data, false, nil
+	}
+
+	addAutocryptFields(card, email.Group, autocrypt)
+
+	b := &bytes.Buffer{}
+	if err := vcard.NewEncoder(b).Encode(card); err != nil {
+		return "", false, err
+	}
+	return b.String(), true, nil
+}
+
+// addAutocryptFields sets the key and PGP/MIME scheme to the group. Messages
+// are encrypted by default only when the sender prefers so.
+func addAutocryptFields(card vcard.Card, group string, autocrypt *message.Autocrypt) {
+	card.Add(vcard.FieldKey, &vcard.Field{
+		Value:  vCardKeyPrefix + base64.StdEncoding.EncodeToString(autocrypt.KeyData),
+		Params: vcard.Params{vcard.ParamPreferred: {"1"}},
+		Group:  group,
+	})
+	if card.GetValueByGroup(vCardFieldPMScheme, group) == "" {
+		card.Add(vCardFieldPMScheme, &vcard.Field{Value: vCardPGPMIMEScheme, Group: group})
+	}
+	if autocrypt.PreferEncrypt && card.GetValueByGroup(vCardFieldPMEncrypt, group) == "" {
+		card.Add(vCardFieldPMEncrypt, &vcard.Field{Value: "true", Group: group})
+	}
+}
+
+// newCardGroup returns the first unused itemN group of the card.
+func newCardGroup(card vcard.Card) string {
+	used := map[string]bool{}
+	for _, fields := range card {
+		for _, field := range fields {
+			used[field.Group] = true
+		}
+	}
+
+	for i := 1; ; i++ {
+		if group := fmt.Sprintf("item%d", i); !used[group] {
+			return group
+		}
+	}
+}
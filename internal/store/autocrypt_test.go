@@ -0,0 +1,115 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-vcard"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAutocrypt(t *testing.T, preferEncrypt bool) *message.Autocrypt {
+	key, err := crypto.GenerateKey("sender", "sender@example.com", "x25519", 0)
+	require.NoError(t, err)
+	keyData, err := key.GetPublicKey()
+	require.NoError(t, err)
+
+	return &message.Autocrypt{Addr: "sender@example.com", PreferEncrypt: preferEncrypt, KeyData: keyData}
+}
+
+func decodeTestCard(t *testing.T, data string) vcard.Card {
+	card, err := vcard.NewDecoder(strings.NewReader(data)).Decode()
+	require.NoError(t, err)
+	return card
+}
+
+func TestNewAutocryptCard(t *testing.T) {
+	autocrypt := newTestAutocrypt(t, true)
+
+	card := decodeTestCard(t, newAutocryptCard("Sender", autocrypt))
+	require.Equal(t, "Sender", card.Value(vcard.FieldFormattedName))
+
+	group := card.GetGroupByValue(vcard.FieldEmail, "sender@example.com")
+	require.Equal(t, "item1", group)
+	require.Len(t, card.GetAllValueByGroup(vcard.FieldKey, group), 1)
+	require.True(t, strings.HasPrefix(card.GetValueByGroup(vcard.FieldKey, group), vCardKeyPrefix))
+	require.Equal(t, vCardPGPMIMEScheme, card.GetValueByGroup(vCardFieldPMScheme, group))
+	require.Equal(t, "true", card.GetValueByGroup(vCardFieldPMEncrypt, group))
+}
+
+func TestAddAutocryptKeyToCard(t *testing.T) {
+	autocrypt := newTestAutocrypt(t, false)
+
+	data := "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Sender\r\nitem1.EMAIL:other@example.com\r\nEMAIL:Sender@Example.com\r\nEND:VCARD\r\n"
+	updated, changed, err := addAutocryptKeyToCard(data, autocrypt)
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	card := decodeTestCard(t, updated)
+	group := card.GetGroupByValue(vcard.FieldEmail, "Sender@Example.com")
+	require.Equal(t, "item2", group)
+	require.Len(t, card.GetAllValueByGroup(vcard.FieldKey, group), 1)
+	require.Equal(t, "", card.GetValueByGroup(vCardFieldPMEncrypt, group))
+	require.Empty(t, card.GetAllValueByGroup(vcard.FieldKey, "item1"))
+
+	// Key of the user is never replaced.
+	_, changed, err = addAutocryptKeyToCard(updated, newTestAutocrypt(t, false))
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	_, changed, err = addAutocryptKeyToCard("BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Other\r\nEND:VCARD\r\n", autocrypt)
+	require.NoError(t, err)
+	require.False(t, changed)
+}
+
+func TestImportAutocryptAddsContactOnce(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	autocrypt := newTestAutocrypt(t, true)
+	msg := &pmapi.Message{
+		ID:     "msg1",
+		Sender: &mail.Address{Name: "Sender", Address: "sender@example.com"},
+		Header: mail.Header{message.AutocryptHeader: {autocrypt.String()}},
+	}
+
+	m.client.EXPECT().GetContactEmailByEmail(gomock.Any(), "sender@example.com", 0, 1000).Return(nil, nil)
+	m.client.EXPECT().EncryptAndSignCards(gomock.Any()).DoAndReturn(func(cards []pmapi.Card) ([]pmapi.Card, error) {
+		return cards, nil
+	})
+	m.client.EXPECT().AddContacts(gomock.Any(), gomock.Any(), 0, 1, 0).DoAndReturn(func(_ context.Context, cards pmapi.ContactsCards, _, _, _ int) (*pmapi.AddContactsResponse, error) {
+		require.Len(t, cards.Contacts, 1)
+		require.Len(t, cards.Contacts[0].Cards, 1)
+		card := decodeTestCard(t, cards.Contacts[0].Cards[0].Data)
+		require.Len(t, card.GetAllValueByGroup(vcard.FieldKey, "item1"), 1)
+		return &pmapi.AddContactsResponse{}, nil
+	})
+
+	m.store.importAutocrypt(msg)
+	m.store.importAutocrypt(msg)
+}
@@ -0,0 +1,306 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// Actions of bulk operations.
+const (
+	BulkRead   = "read"
+	BulkUnread = "unread"
+
+	// BulkTrash moves messages to Trash.
+	BulkTrash = "trash"
+
+	// BulkDelete deletes messages permanently.
+	BulkDelete = "delete"
+
+	// BulkLabel adds the mailbox given as `label:<mailbox>`. Adding a folder
+	// moves messages to it.
+	BulkLabel = "label"
+
+	// BulkUnlabel removes the mailbox given as `unlabel:<mailbox>`.
+	BulkUnlabel = "unlabel"
+)
+
+// bulkDateLayouts are accepted by `before:` and `after:` terms of queries.
+var bulkDateLayouts = []string{"2006-01-02", "2006-01", "2006"} //nolint[gochecknoglobals]
+
+// BulkQuery selects messages of bulk operations. Empty fields match all
+// messages.
+type BulkQuery struct {
+	Mailbox string // IMAP name or short name of custom mailbox, e.g. `Newsletters`.
+	From    string // Part of the sender address or name.
+	Before  time.Time
+	After   time.Time
+}
+
+// BulkAction is applied to all messages selected by the query.
+type BulkAction struct {
+	Name    string
+	Mailbox string // Only for BulkLabel and BulkUnlabel.
+}
+
+// ParseBulkQuery parses space-separated terms `label:<mailbox>`,
+// `from:<sender>`, `before:<date>` and `after:<date>`, e.g.
+// `label:Newsletters before:2022`. Values with spaces are quoted. Dates are
+// in the local time and can be only year or month; `before` excludes the
+// date and `after` includes it.
+func ParseBulkQuery(value string) (query BulkQuery, err error) {
+	terms, err := splitBulkQuery(value)
+	if err != nil {
+		return query, err
+	}
+	if len(terms) == 0 {
+		return query, errors.New("query is empty, at least one term is required")
+	}
+
+	for _, term := range terms {
+		sep := strings.Index(term, ":")
+		if sep <= 0 || sep == len(term)-1 {
+			return query, fmt.Errorf("expected key:value, got %q", term)
+		}
+
+		key, val := strings.ToLower(term[:sep]), term[sep+1:]
+		switch key {
+		case "label", "in":
+			query.Mailbox = val
+		case "from":
+			query.From = val
+		case "before":
+			query.Before, err = parseBulkDate(val)
+		case "after":
+			query.After, err = parseBulkDate(val)
+		default:
+			return query, fmt.Errorf("unknown query term %q", key)
+		}
+		if err != nil {
+			return query, err
+		}
+	}
+
+	return query, nil
+}
+
+// splitBulkQuery splits the query by spaces which are not quoted. Quotes
+// are removed.
+func splitBulkQuery(value string) (terms []string, err error) {
+	var term strings.Builder
+	quoted := false
+
+	for _, r := range value {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+
+	if quoted {
+		return nil, errors.New("query has unclosed quote")
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return terms, nil
+}
+
+func parseBulkDate(value string) (time.Time, error) {
+	for _, layout := range bulkDateLayouts {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD, YYYY-MM or YYYY", value)
+}
+
+// ParseBulkAction parses one of the actions, `label` and `unlabel` are
+// followed by the mailbox, e.g. `label:Folders/Receipts`.
+func ParseBulkAction(value string) (action BulkAction, err error) {
+	parts := strings.SplitN(strings.TrimSpace(value), ":", 2)
+	action.Name = strings.ToLower(parts[0])
+
+	switch action.Name {
+	case BulkRead, BulkUnread, BulkTrash, BulkDelete:
+		if len(parts) == 2 {
+			return action, fmt.Errorf("action %s has no mailbox", action.Name)
+		}
+	case BulkLabel, BulkUnlabel:
+		if len(parts) != 2 || parts[1] == "" {
+			return action, fmt.Errorf("expected %s:<mailbox>", action.Name)
+		}
+		action.Mailbox = parts[1]
+	default:
+		return action, fmt.Errorf("unknown action %q", value)
+	}
+
+	return action, nil
+}
+
+// ApplyBulkAction applies the action to all messages matching the query in
+// batched API calls. With dryRun it only returns the matching messages.
+// Messages are changed by API and the store is updated by events.
+func (store *Store) ApplyBulkAction(query BulkQuery, action BulkAction, dryRun bool) ([]*pmapi.Message, error) {
+	msgs, err := store.getBulkMessages(query)
+	if err != nil || dryRun || len(msgs) == 0 {
+		return msgs, err
+	}
+
+	apiIDs := []string{}
+	for _, msg := range msgs {
+		apiIDs = append(apiIDs, msg.ID)
+	}
+
+	switch action.Name {
+	case BulkRead:
+		err = store.client().MarkMessagesRead(store.ctx, apiIDs)
+	case BulkUnread:
+		err = store.client().MarkMessagesUnread(store.ctx, apiIDs)
+	case BulkTrash:
+		err = store.client().LabelMessages(store.ctx, apiIDs, pmapi.TrashLabel)
+	case BulkDelete:
+		if err = store.client().DeleteMessages(store.ctx, apiIDs); err == nil {
+			store.addTombstones(apiIDs)
+		}
+	case BulkLabel, BulkUnlabel:
+		err = store.applyBulkLabel(apiIDs, action)
+	default:
+		err = fmt.Errorf("unknown action %q", action.Name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	store.log.WithField("action", action.Name).WithField("messages", len(apiIDs)).Info("Bulk action applied")
+	return msgs, nil
+}
+
+func (store *Store) applyBulkLabel(apiIDs []string, action BulkAction) error {
+	mailboxes := store.getBulkMailboxes(action.Mailbox)
+	if len(mailboxes) == 0 {
+		return fmt.Errorf("mailbox %s does not exist", action.Mailbox)
+	}
+
+	labelID := mailboxes[0].labelID
+	if labelID == pmapi.AllMailLabel {
+		return ErrAllMailOpNotAllowed
+	}
+
+	if action.Name == BulkLabel {
+		return store.client().LabelMessages(store.ctx, apiIDs, labelID)
+	}
+	return store.client().UnlabelMessages(store.ctx, apiIDs, labelID)
+}
+
+// getBulkMessages returns messages matching the query from the local
+// database.
+func (store *Store) getBulkMessages(query BulkQuery) (msgs []*pmapi.Message, err error) {
+	var apiIDs []string
+
+	if query.Mailbox == "" {
+		if apiIDs, err = store.getAllMessageIDs(); err != nil {
+			return nil, err
+		}
+	} else {
+		mailboxes := store.getBulkMailboxes(query.Mailbox)
+		if len(mailboxes) == 0 {
+			return nil, fmt.Errorf("mailbox %s does not exist", query.Mailbox)
+		}
+
+		seen := map[string]bool{}
+		for _, mailbox := range mailboxes {
+			mailboxIDs, err := mailbox.GetAPIIDsFromUIDRange(1, 0)
+			if err != nil {
+				return nil, err
+			}
+			for _, apiID := range mailboxIDs {
+				if !seen[apiID] {
+					seen[apiID] = true
+					apiIDs = append(apiIDs, apiID)
+				}
+			}
+		}
+	}
+
+	for _, apiID := range apiIDs {
+		msg, err := store.getMessageFromDB(apiID)
+		if err != nil {
+			return nil, err
+		}
+		if query.matches(msg) {
+			msgs = append(msgs, msg)
+		}
+	}
+
+	return msgs, nil
+}
+
+func (query BulkQuery) matches(msg *pmapi.Message) bool {
+	if !query.Before.IsZero() && msg.Time >= query.Before.Unix() {
+		return false
+	}
+	if !query.After.IsZero() && msg.Time < query.After.Unix() {
+		return false
+	}
+	if query.From != "" {
+		if msg.Sender == nil {
+			return false
+		}
+		from := strings.ToLower(query.From)
+		if !strings.Contains(strings.ToLower(msg.Sender.Address), from) && !strings.Contains(strings.ToLower(msg.Sender.Name), from) {
+			return false
+		}
+	}
+	return true
+}
+
+// getBulkMailboxes returns the mailbox of all addresses. Custom mailboxes
+// can be given without the `Folders/` or `Labels/` prefix.
+func (store *Store) getBulkMailboxes(name string) (mailboxes []*Mailbox) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	for _, candidate := range []string{name, UserFoldersPrefix + name, UserLabelsPrefix + name} {
+		for _, address := range store.addresses {
+			for _, mailbox := range address.mailboxes {
+				if mailbox.labelName == candidate {
+					mailboxes = append(mailboxes, mailbox)
+				}
+			}
+		}
+		if len(mailboxes) != 0 {
+			return mailboxes
+		}
+	}
+
+	return nil
+}
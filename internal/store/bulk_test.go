@@ -0,0 +1,104 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBulkQuery(t *testing.T) {
+	query, err := ParseBulkQuery(`label:"My Newsletters" from:news@pm.me before:2022 after:2021-06-15`)
+	require.NoError(t, err)
+	require.Equal(t, BulkQuery{
+		Mailbox: "My Newsletters",
+		From:    "news@pm.me",
+		Before:  time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local),
+		After:   time.Date(2021, 6, 15, 0, 0, 0, 0, time.Local),
+	}, query)
+
+	for _, value := range []string{"", "  ", "label:", "newsletters", "size:10", "before:yesterday", `label:"Open`} {
+		_, err := ParseBulkQuery(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestParseBulkAction(t *testing.T) {
+	action, err := ParseBulkAction("trash")
+	require.NoError(t, err)
+	require.Equal(t, BulkAction{Name: BulkTrash}, action)
+
+	action, err = ParseBulkAction("label:Folders/Receipts")
+	require.NoError(t, err)
+	require.Equal(t, BulkAction{Name: BulkLabel, Mailbox: "Folders/Receipts"}, action)
+
+	for _, value := range []string{"", "archive", "read:INBOX", "label", "unlabel:"} {
+		_, err := ParseBulkAction(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestApplyBulkAction(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	oldMsg := getTestMessage("msg1", "Old", "news@pm.me", 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	oldMsg.Time = time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local).Unix()
+	require.NoError(t, m.store.createOrUpdateMessageEvent(oldMsg))
+
+	newMsg := getTestMessage("msg2", "New", "news@pm.me", 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	newMsg.Time = time.Date(2022, 5, 1, 0, 0, 0, 0, time.Local).Unix()
+	require.NoError(t, m.store.createOrUpdateMessageEvent(newMsg))
+
+	otherMsg := getTestMessage("msg3", "Other", "friend@pm.me", 1, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	otherMsg.Time = oldMsg.Time
+	require.NoError(t, m.store.createOrUpdateMessageEvent(otherMsg))
+
+	query, err := ParseBulkQuery("label:INBOX before:2022")
+	require.NoError(t, err)
+
+	msgs, err := m.store.ApplyBulkAction(query, BulkAction{Name: BulkTrash}, true)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, "msg1", msgs[0].ID)
+
+	m.client.EXPECT().LabelMessages(gomock.Any(), []string{"msg1"}, pmapi.TrashLabel).Return(nil)
+	_, err = m.store.ApplyBulkAction(query, BulkAction{Name: BulkTrash}, false)
+	require.NoError(t, err)
+
+	query, err = ParseBulkQuery("from:NEWS")
+	require.NoError(t, err)
+	m.client.EXPECT().MarkMessagesRead(gomock.Any(), []string{"msg1", "msg2"}).Return(nil)
+	msgs, err = m.store.ApplyBulkAction(query, BulkAction{Name: BulkRead}, false)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+
+	query, err = ParseBulkQuery("label:Archive")
+	require.NoError(t, err)
+	_, err = m.store.ApplyBulkAction(query, BulkAction{Name: BulkLabel, Mailbox: "All Mail"}, false)
+	require.Equal(t, ErrAllMailOpNotAllowed, err)
+
+	_, err = m.store.ApplyBulkAction(BulkQuery{Mailbox: "Newsletters"}, BulkAction{Name: BulkTrash}, true)
+	require.EqualError(t, err, "mailbox Newsletters does not exist")
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/allan-simon/go-singleinstance"
+	"github.com/pkg/errors"
+)
+
+// Supported types of cache backends.
+const (
+	LocalCacheBackend  = "local"
+	SharedCacheBackend = "shared"
+)
+
+const (
+	sharedCacheLockName = "cache.lock"
+	sharedCacheTmpExt   = ".tmp"
+)
+
+// CacheBackend stores files of the on-disk caches. Names are relative to the
+// root of the backend. Content is encrypted by the caches before it is
+// stored, so backends do not have to protect it.
+type CacheBackend interface {
+	// ReadFile returns the content of the file.
+	ReadFile(name string) ([]byte, error)
+
+	// WriteFile creates or replaces the file including missing folders.
+	WriteFile(name string, data []byte) error
+
+	// Open returns the reader of the file, so big files do not have to be
+	// read whole into memory.
+	Open(name string) (io.ReadCloser, error)
+
+	// Create returns the writer of the file which is created or replaced
+	// including missing folders. The file is complete once it is closed.
+	Create(name string) (io.WriteCloser, error)
+
+	// Rename moves the file including missing folders. The file at the new
+	// name is replaced.
+	Rename(oldName, newName string) error
+
+	// Touch sets the last time the file was used.
+	Touch(name string, lastUsed time.Time) error
+
+	// Remove removes the file. Missing file is not an error.
+	Remove(name string) error
+
+	// RemoveAll removes the folder with all its content.
+	RemoveAll(name string) error
+
+	// Walk calls fn for every file in the folder and its subfolders.
+	// Missing folder is treated as empty.
+	Walk(dir string, fn CacheWalkFunc) error
+
+	// Close releases the backend. It must not be used afterwards.
+	Close() error
+}
+
+// CacheWalkFunc is called by CacheBackend.Walk for every file.
+type CacheWalkFunc func(name string, size int64, lastUsed time.Time) error
+
+// NewCacheBackend opens the backend of the given type in dir.
+func NewCacheBackend(backendType, dir string) (CacheBackend, error) {
+	switch backendType {
+	case LocalCacheBackend, "":
+		return NewLocalCacheBackend(dir)
+	case SharedCacheBackend:
+		return NewSharedCacheBackend(dir)
+	default:
+		return nil, errors.Errorf("unknown cache backend %q", backendType)
+	}
+}
+
+// localCacheBackend stores files directly in a folder on local disk.
+type localCacheBackend struct {
+	root string
+}
+
+// NewLocalCacheBackend returns the backend storing files in dir.
+func NewLocalCacheBackend(dir string) (CacheBackend, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &localCacheBackend{root: dir}, nil
+}
+
+func (b *localCacheBackend) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(b.path(name)) //nolint[gosec]
+}
+
+func (b *localCacheBackend) WriteFile(name string, data []byte) error {
+	path := b.path(name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+func (b *localCacheBackend) Open(name string) (io.ReadCloser, error) {
+	return os.Open(b.path(name))
+}
+
+func (b *localCacheBackend) Create(name string) (io.WriteCloser, error) {
+	path := b.path(name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) //nolint[gosec]
+}
+
+func (b *localCacheBackend) Rename(oldName, newName string) error {
+	newPath := b.path(newName)
+
+	if err := os.MkdirAll(filepath.Dir(newPath), 0700); err != nil {
+		return err
+	}
+
+	return os.Rename(b.path(oldName), newPath)
+}
+
+func (b *localCacheBackend) Touch(name string, lastUsed time.Time) error {
+	return os.Chtimes(b.path(name), lastUsed, lastUsed)
+}
+
+func (b *localCacheBackend) Remove(name string) error {
+	if err := os.Remove(b.path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (b *localCacheBackend) RemoveAll(name string) error {
+	return os.RemoveAll(b.path(name))
+}
+
+func (b *localCacheBackend) Walk(dir string, fn CacheWalkFunc) error {
+	root := b.path(dir)
+
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		name, err := filepath.Rel(b.root, path)
+		if err != nil {
+			return err
+		}
+
+		return fn(name, info.Size(), info.ModTime())
+	})
+}
+
+func (b *localCacheBackend) Close() error {
+	return nil
+}
+
+func (b *localCacheBackend) path(name string) string {
+	return filepath.Join(b.root, name)
+}
+
+// sharedCacheBackend stores files in a folder which can be on a different
+// volume, e.g. network storage. The folder is locked so no other instance
+// uses it at the same time, and files are replaced atomically so a file
+// which was not written completely is never read.
+type sharedCacheBackend struct {
+	localCacheBackend
+
+	lock *os.File
+}
+
+// NewSharedCacheBackend returns the backend storing files in dir. It fails
+// when the folder is used by another instance.
+func NewSharedCacheBackend(dir string) (CacheBackend, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	lock, err := singleinstance.CreateLockFile(filepath.Join(dir, sharedCacheLockName))
+	if err != nil {
+		return nil, errors.Wrap(err, "cache folder is used by another instance")
+	}
+
+	return &sharedCacheBackend{
+		localCacheBackend: localCacheBackend{root: dir},
+		lock:              lock,
+	}, nil
+}
+
+func (b *sharedCacheBackend) WriteFile(name string, data []byte) error {
+	path := b.path(name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmpPath := path + sharedCacheTmpExt
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+func (b *sharedCacheBackend) Create(name string) (io.WriteCloser, error) {
+	path := b.path(name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path+sharedCacheTmpExt, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) //nolint[gosec]
+	if err != nil {
+		return nil, err
+	}
+	return &sharedCacheFile{File: file, path: path}, nil
+}
+
+// sharedCacheFile is written under the temporary name and renamed when it
+// is closed, so a file which was not written completely is never read.
+type sharedCacheFile struct {
+	*os.File
+
+	path string
+}
+
+func (f *sharedCacheFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), f.path)
+}
+
+// Walk skips the lock file and removes files left over from interrupted
+// writes.
+func (b *sharedCacheBackend) Walk(dir string, fn CacheWalkFunc) error {
+	return b.localCacheBackend.Walk(dir, func(name string, size int64, lastUsed time.Time) error {
+		if name == sharedCacheLockName {
+			return nil
+		}
+
+		if strings.HasSuffix(name, sharedCacheTmpExt) {
+			return b.Remove(name)
+		}
+
+		return fn(name, size, lastUsed)
+	})
+}
+
+func (b *sharedCacheBackend) Close() error {
+	if b.lock == nil {
+		return nil
+	}
+
+	err := b.lock.Close()
+	_ = os.Remove(b.lock.Name())
+	b.lock = nil
+
+	return err
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func walkCacheBackend(t *testing.T, backend CacheBackend, dir string) []string {
+	names := []string{}
+	require.NoError(t, backend.Walk(dir, func(name string, _ int64, _ time.Time) error {
+		names = append(names, name)
+		return nil
+	}))
+	sort.Strings(names)
+	return names
+}
+
+func TestLocalCacheBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-backend")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	backend, err := NewCacheBackend(LocalCacheBackend, dir)
+	require.NoError(t, err)
+	defer backend.Close() //nolint[errcheck]
+
+	require.Empty(t, walkCacheBackend(t, backend, "missing"))
+
+	require.NoError(t, backend.WriteFile(filepath.Join("a", "one"), []byte("one")))
+	require.NoError(t, backend.WriteFile(filepath.Join("a", "b", "two"), []byte("two")))
+
+	data, err := backend.ReadFile(filepath.Join("a", "one"))
+	require.NoError(t, err)
+	require.Equal(t, "one", string(data))
+
+	require.Equal(t, []string{filepath.Join("a", "b", "two"), filepath.Join("a", "one")}, walkCacheBackend(t, backend, "a"))
+
+	w, err := backend.Create(filepath.Join("c", "three"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("three"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, backend.Rename(filepath.Join("c", "three"), filepath.Join("a", "c", "three")))
+
+	r, err := backend.Open(filepath.Join("a", "c", "three"))
+	require.NoError(t, err)
+	data, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, "three", string(data))
+	require.NoError(t, backend.RemoveAll(filepath.Join("a", "c")))
+	require.NoError(t, backend.RemoveAll("c"))
+
+	require.NoError(t, backend.Remove(filepath.Join("a", "one")))
+	require.NoError(t, backend.Remove(filepath.Join("a", "one")))
+	require.NoError(t, backend.RemoveAll(filepath.Join("a", "b")))
+	require.Empty(t, walkCacheBackend(t, backend, ""))
+}
+
+func TestSharedCacheBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-backend")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	backend, err := NewCacheBackend(SharedCacheBackend, dir)
+	require.NoError(t, err)
+
+	// The folder cannot be used by another instance at the same time.
+	_, err = NewSharedCacheBackend(dir)
+	require.Error(t, err)
+
+	require.NoError(t, backend.WriteFile("one", []byte("one")))
+
+	// Created file appears only once it is closed.
+	w, err := backend.Create("three")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("three"))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "three"))
+	require.True(t, os.IsNotExist(err))
+	require.NoError(t, w.Close())
+	require.NoError(t, backend.Remove("three"))
+
+	// Left over from an interrupted write.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "two"+sharedCacheTmpExt), []byte("tw"), 0600))
+
+	require.Equal(t, []string{"one"}, walkCacheBackend(t, backend, ""))
+	_, err = os.Stat(filepath.Join(dir, "two"+sharedCacheTmpExt))
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, backend.Close())
+
+	backend, err = NewSharedCacheBackend(dir)
+	require.NoError(t, err)
+	defer backend.Close() //nolint[errcheck]
+
+	data, err := backend.ReadFile("one")
+	require.NoError(t, err)
+	require.Equal(t, "one", string(data))
+}
+
+func TestUnknownCacheBackend(t *testing.T) {
+	_, err := NewCacheBackend("nas", "")
+	require.Error(t, err)
+}
+
+func TestMessageCacheWithSharedBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-backend")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	backend, err := NewSharedCacheBackend(filepath.Join(dir, "messages"))
+	require.NoError(t, err)
+	defer backend.Close() //nolint[errcheck]
+
+	c, err := NewMessageCacheWithBackend(backend, 1000)
+	require.NoError(t, err)
+	setTestCacheKeys(t, c, 1)
+
+	require.NoError(t, c.Set("userID", "msgID", []byte("Subject: secret")))
+
+	c, err = NewMessageCacheWithBackend(backend, 1000)
+	require.NoError(t, err)
+	setTestCacheKeys(t, c, 1)
+
+	body, ok := c.Get("userID", "msgID")
+	require.True(t, ok)
+	require.Equal(t, "Subject: secret", string(body))
+}
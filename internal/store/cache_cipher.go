@@ -0,0 +1,285 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CacheKeySize is the size of the key encrypting local caches of one user.
+const CacheKeySize = 32
+
+// errNoCacheKey is returned when the cache is used for a user whose key
+// was not set yet.
+var errNoCacheKey = errors.New("no cache key for user") //nolint[gochecknoglobals]
+
+// cacheCipher encrypts local caches with decrypted content of one user.
+type cacheCipher struct {
+	gcm     cipher.AEAD
+	hashKey []byte // Names content without revealing it.
+}
+
+func newCacheCipher(key []byte) (*cacheCipher, error) {
+	if len(key) != CacheKeySize {
+		return nil, errors.New("wrong size of cache key")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte("attachment cache"))
+
+	return &cacheCipher{gcm: gcm, hashKey: mac.Sum(nil)}, nil
+}
+
+// cacheCiphers holds ciphers of users of a cache shared by all users. Keys
+// are not stored next to the cache but in the keychain together with the
+// credentials of each user; the store sets them when it is opened.
+type cacheCiphers struct {
+	lock    *sync.RWMutex
+	ciphers map[string]*cacheCipher
+}
+
+func newCacheCiphers() cacheCiphers {
+	return cacheCiphers{
+		lock:    &sync.RWMutex{},
+		ciphers: map[string]*cacheCipher{},
+	}
+}
+
+// SetUserKey sets the key encrypting cached content of the user.
+func (c cacheCiphers) SetUserKey(userID string, key []byte) error {
+	userCipher, err := newCacheCipher(key)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.ciphers[userID] = userCipher
+	return nil
+}
+
+func (c cacheCiphers) get(userID string) (*cacheCipher, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	userCipher, ok := c.ciphers[userID]
+	if !ok {
+		return nil, errNoCacheKey
+	}
+	return userCipher, nil
+}
+
+const (
+	// cacheChunkSize is the size of chunks in which streamed content is
+	// encrypted, so neither writing nor reading needs it whole in memory.
+	cacheChunkSize = 64 * 1024
+
+	// cacheNoncePrefixSize is the size of the random part of the nonce of
+	// streamed content. The rest is the number of the chunk and the flag of
+	// the last chunk.
+	cacheNoncePrefixSize = 7
+)
+
+// cacheStreamWriter encrypts content chunk by chunk. The random prefix of
+// nonces is written first. Chunks cannot be reordered and the content
+// cannot be truncated without noticing, because the nonce of each chunk
+// contains its number and whether it is the last one.
+type cacheStreamWriter struct {
+	gcm    cipher.AEAD
+	w      io.Writer
+	nonce  []byte
+	chunk  []byte
+	sealed []byte
+	count  uint32
+}
+
+func newCacheStreamWriter(gcm cipher.AEAD, w io.Writer) (*cacheStreamWriter, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce[:cacheNoncePrefixSize]); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(nonce[:cacheNoncePrefixSize]); err != nil {
+		return nil, err
+	}
+
+	return &cacheStreamWriter{
+		gcm:    gcm,
+		w:      w,
+		nonce:  nonce,
+		chunk:  make([]byte, 0, cacheChunkSize),
+		sealed: make([]byte, 0, cacheChunkSize+gcm.Overhead()),
+	}, nil
+}
+
+func (cw *cacheStreamWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		// The full chunk is sealed only when more data comes, because
+		// the last chunk is sealed differently.
+		if len(cw.chunk) == cacheChunkSize {
+			if err = cw.seal(false); err != nil {
+				return
+			}
+		}
+		copied := copy(cw.chunk[len(cw.chunk):cacheChunkSize], p)
+		cw.chunk = cw.chunk[:len(cw.chunk)+copied]
+		p = p[copied:]
+		n += copied
+	}
+	return
+}
+
+// Close seals the last chunk. It does not close the underlying writer.
+func (cw *cacheStreamWriter) Close() error {
+	return cw.seal(true)
+}
+
+func (cw *cacheStreamWriter) seal(last bool) error {
+	setCacheChunkNonce(cw.nonce, cw.count, last)
+	cw.sealed = cw.gcm.Seal(cw.sealed[:0], cw.nonce, cw.chunk, nil)
+	cw.chunk = cw.chunk[:0]
+	cw.count++
+
+	_, err := cw.w.Write(cw.sealed)
+	return err
+}
+
+// cacheStreamReader decrypts content written by cacheStreamWriter.
+type cacheStreamReader struct {
+	gcm    cipher.AEAD
+	r      *bufio.Reader
+	nonce  []byte
+	sealed []byte
+	chunk  []byte
+	plain  []byte
+	count  uint32
+	last   bool
+}
+
+// newCacheStreamReader decrypts the first chunk right away, so content
+// encrypted by a different key is detected before anything is read.
+func newCacheStreamReader(gcm cipher.AEAD, r io.Reader) (*cacheStreamReader, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(r, nonce[:cacheNoncePrefixSize]); err != nil {
+		return nil, errors.New("cached data is too short")
+	}
+
+	cr := &cacheStreamReader{
+		gcm:    gcm,
+		r:      bufio.NewReader(r),
+		nonce:  nonce,
+		sealed: make([]byte, cacheChunkSize+gcm.Overhead()),
+		plain:  make([]byte, 0, cacheChunkSize),
+	}
+	if err := cr.open(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (cr *cacheStreamReader) Read(p []byte) (int, error) {
+	for len(cr.chunk) == 0 {
+		if cr.last {
+			return 0, io.EOF
+		}
+		if err := cr.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, cr.chunk)
+	cr.chunk = cr.chunk[n:]
+	return n, nil
+}
+
+func (cr *cacheStreamReader) open() error {
+	n, err := io.ReadFull(cr.r, cr.sealed)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return errors.New("cached data is truncated")
+		}
+		return err
+	}
+
+	last := err == io.ErrUnexpectedEOF
+	if !last {
+		_, err := cr.r.Peek(1)
+		last = err == io.EOF
+	}
+
+	setCacheChunkNonce(cr.nonce, cr.count, last)
+	if cr.chunk, err = cr.gcm.Open(cr.plain[:0], cr.nonce, cr.sealed[:n], nil); err != nil {
+		return err
+	}
+	cr.count++
+	cr.last = last
+	return nil
+}
+
+func setCacheChunkNonce(nonce []byte, count uint32, last bool) {
+	binary.BigEndian.PutUint32(nonce[cacheNoncePrefixSize:], count)
+	nonce[len(nonce)-1] = 0
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+}
+
+// initCacheKeys sets the key of the user to the local caches. The store
+// does not use the caches when the key cannot be loaded from the keychain.
+func (store *Store) initCacheKeys() {
+	if store.messageCache == nil && store.attachmentCache == nil && store.searchIndexStorage == nil {
+		return
+	}
+
+	key, err := store.user.GetCacheKey()
+	if err == nil && store.messageCache != nil {
+		err = store.messageCache.SetUserKey(store.UserID(), key)
+	}
+	if err == nil && store.attachmentCache != nil {
+		err = store.attachmentCache.SetUserKey(store.UserID(), key)
+	}
+	if err == nil && store.searchIndexStorage != nil {
+		err = store.searchIndexStorage.SetUserKey(store.UserID(), key)
+	}
+	if err != nil {
+		store.log.WithError(err).Error("Cannot set cache key, continuing without local caches")
+		store.messageCache = nil
+		store.attachmentCache = nil
+		store.searchIndexStorage = nil
+	}
+}
@@ -18,6 +18,7 @@
 package store
 
 import (
+	"strings"
 	"time"
 
 	"github.com/ProtonMail/proton-bridge/pkg/message"
@@ -27,6 +28,9 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// nonExistentAttr is the mailbox attribute of deleted mailboxes (RFC 5258).
+const nonExistentAttr = "\\NonExistent"
+
 // SetIMAPUpdateChannel sets the channel on which imap update messages will be sent. This should be the channel
 // on which the imap backend listens for imap updates.
 func (store *Store) SetIMAPUpdateChannel(updates chan imapBackend.Update) {
@@ -48,18 +52,19 @@ func (store *Store) imapNotice(address, notice string) {
 	store.imapSendUpdate(update)
 }
 
-func (store *Store) imapUpdateMessage(address, mailboxName string, uid, sequenceNumber uint32, msg *pmapi.Message) {
+func (store *Store) imapUpdateMessage(address, mailboxName string, uid, sequenceNumber uint32, msg *pmapi.Message, keywords []string) {
+	flags := append(message.GetFlags(msg), keywords...)
 	store.log.WithFields(logrus.Fields{
 		"address": address,
 		"mailbox": mailboxName,
 		"seqNum":  sequenceNumber,
 		"uid":     uid,
-		"flags":   message.GetFlags(msg),
+		"flags":   flags,
 	}).Trace("IDLE update")
 	update := new(imapBackend.MessageUpdate)
 	update.Update = imapBackend.NewUpdate(address, mailboxName)
 	update.Message = imap.NewMessage(sequenceNumber, []imap.FetchItem{imap.FetchFlags, imap.FetchUid})
-	update.Message.Flags = message.GetFlags(msg)
+	update.Message.Flags = flags
 	update.Message.Uid = uid
 	store.imapSendUpdate(update)
 }
@@ -83,8 +88,29 @@ func (store *Store) imapMailboxCreated(address, mailboxName string) {
 	}).Trace("IDLE mailbox info")
 	update := new(imapBackend.MailboxInfoUpdate)
 	update.Update = imapBackend.NewUpdate(address, "")
+	attributes := []string{}
+	if !strings.HasPrefix(mailboxName, UserFoldersPrefix) {
+		attributes = append(attributes, imap.NoInferiorsAttr) // Only folders can be nested.
+	}
+	update.MailboxInfo = &imap.MailboxInfo{
+		Attributes: attributes,
+		Delimiter:  PathDelimiter,
+		Name:       mailboxName,
+	}
+	store.imapSendUpdate(update)
+}
+
+// imapMailboxDeleted notifies clients that the mailbox does not exist
+// anymore by LIST response with \NonExistent attribute (RFC 5258).
+func (store *Store) imapMailboxDeleted(address, mailboxName string) {
+	store.log.WithFields(logrus.Fields{
+		"address": address,
+		"mailbox": mailboxName,
+	}).Trace("IDLE mailbox deleted")
+	update := new(imapBackend.MailboxInfoUpdate)
+	update.Update = imapBackend.NewUpdate(address, "")
 	update.MailboxInfo = &imap.MailboxInfo{
-		Attributes: []string{imap.NoInferiorsAttr},
+		Attributes: []string{nonExistentAttr, imap.NoSelectAttr},
 		Delimiter:  PathDelimiter,
 		Name:       mailboxName,
 	}
@@ -87,6 +87,36 @@ func TestDeleteMessageIMAPUpdate(t *testing.T) {
 	close(updates)
 }
 
+func TestMailboxIMAPUpdates(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	updates := make(chan imapBackend.Update, 10)
+	m.store.SetIMAPUpdateChannel(updates)
+
+	label := &pmapi.Label{ID: "folder", Name: "Work", Type: pmapi.LabelTypeMailbox, Exclusive: 1}
+	require.Nil(t, m.store.createOrUpdateMailboxEvent(label))
+
+	// Only color is changed, clients are not notified.
+	label.Color = "#000000"
+	require.Nil(t, m.store.createOrUpdateMailboxEvent(label))
+
+	label.Name = "Projects"
+	require.Nil(t, m.store.createOrUpdateMailboxEvent(label))
+
+	require.Nil(t, m.store.deleteMailboxEvent("folder"))
+	close(updates)
+
+	checkIMAPUpdates(t, updates, []func(interface{}) bool{
+		checkMailboxInfo(addr1, "Folders/Work", false),
+		checkMailboxInfo(addr1, "Folders/Work", true),
+		checkMailboxInfo(addr1, "Folders/Projects", false),
+		checkMailboxInfo(addr1, "Folders/Projects", true),
+	})
+}
+
 func checkIMAPUpdates(t *testing.T, updates chan imapBackend.Update, checkFunctions []func(interface{}) bool) {
 	idx := 0
 	for update := range updates {
@@ -127,3 +157,20 @@ func checkMessageDelete(username, mailbox string, seqNum int) func(interface{})
 		}
 	}
 }
+
+func checkMailboxInfo(username, mailbox string, isDeleted bool) func(interface{}) bool {
+	return func(update interface{}) bool {
+		switch u := update.(type) {
+		case *imapBackend.MailboxInfoUpdate:
+			hasNonExistent := false
+			for _, attr := range u.MailboxInfo.Attributes {
+				hasNonExistent = hasNonExistent || attr == nonExistentAttr
+			}
+			return (u.Update.Username() == username &&
+				u.MailboxInfo.Name == mailbox &&
+				hasNonExistent == isDeleted)
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// CompactionOptions configures background compaction of store databases.
+// Bolt never shrinks its file, so the database is rewritten once it grew
+// enough since the last compaction. It runs only while the account is idle,
+// i.e., no client was active for IdleTime and the last event was empty.
+type CompactionOptions struct {
+	Enabled     bool
+	IdleTime    time.Duration
+	MinInterval time.Duration // Between two compactions of one database.
+	MinGrowth   float64       // Since the last compaction, e.g. 0.25 for 25 %.
+	MinSize     int64         // Smaller databases are never compacted.
+}
+
+// DefaultCompactionOptions returns options used unless changed by preferences.
+func DefaultCompactionOptions() CompactionOptions {
+	return CompactionOptions{
+		Enabled:     true,
+		IdleTime:    30 * time.Minute,
+		MinInterval: 7 * 24 * time.Hour,
+		MinGrowth:   0.25,
+		MinSize:     16 * 1024 * 1024,
+	}
+}
+
+var (
+	compactionOptions     = DefaultCompactionOptions() //nolint[gochecknoglobals]
+	compactionOptionsLock sync.RWMutex                 //nolint[gochecknoglobals]
+
+	// ErrCompactionRunning when compaction is requested while one is running.
+	ErrCompactionRunning = errors.New("database compaction is already running") //nolint[gochecknoglobals]
+	// ErrCompactionNotSupported when the database cannot be compacted.
+	ErrCompactionNotSupported = errors.New("database cannot be compacted") //nolint[gochecknoglobals]
+
+	compactionKey = []byte("last") //nolint[gochecknoglobals]
+)
+
+// SetCompactionOptions sets when databases of all stores are compacted.
+func SetCompactionOptions(options CompactionOptions) {
+	compactionOptionsLock.Lock()
+	defer compactionOptionsLock.Unlock()
+
+	compactionOptions = options
+}
+
+func getCompactionOptions() CompactionOptions {
+	compactionOptionsLock.RLock()
+	defer compactionOptionsLock.RUnlock()
+
+	return compactionOptions
+}
+
+// CompactionStatus describes the running and the last finished compaction
+// of the database. Progress goes from 0 to 1 while compaction is running.
+type CompactionStatus struct {
+	Running    bool
+	Progress   float64
+	LastTime   time.Time
+	SizeBefore int64
+	SizeAfter  int64
+	LastError  string
+}
+
+// compactionRecord is the last compaction saved in the database.
+type compactionRecord struct {
+	Time       int64
+	SizeBefore int64
+	SizeAfter  int64
+	Error      string `json:",omitempty"`
+}
+
+// CompactDatabase rewrites the database file so space of removed data is
+// returned to the system. The store is in read-only maintenance mode
+// meanwhile. Progress can be nil.
+func (store *Store) CompactDatabase(progress func(float64)) (before, after int64, err error) {
+	compacter, ok := store.db.(storage.Compacter)
+	if !ok {
+		return 0, 0, ErrCompactionNotSupported
+	}
+
+	store.compactionLock.Lock()
+	if store.isCompactionRunning {
+		store.compactionLock.Unlock()
+		return 0, 0, ErrCompactionRunning
+	}
+	store.isCompactionRunning = true
+	store.compactionProgress = 0
+	store.compactionLock.Unlock()
+
+	defer func() {
+		store.compactionLock.Lock()
+		store.isCompactionRunning = false
+		store.compactionLock.Unlock()
+	}()
+
+	store.StartMaintenance(MaintenanceCompaction)
+	defer store.EndMaintenance(MaintenanceCompaction)
+
+	start := time.Now()
+	store.log.Info("Compacting database")
+
+	before, after, err = compacter.Compact(func(done, total int) {
+		value := 1.0
+		if total > 0 {
+			value = float64(done) / float64(total)
+		}
+
+		store.compactionLock.Lock()
+		store.compactionProgress = value
+		store.compactionLock.Unlock()
+
+		if progress != nil {
+			progress(value)
+		}
+	})
+
+	record := compactionRecord{Time: start.Unix(), SizeBefore: before, SizeAfter: after}
+	if err != nil {
+		store.log.WithError(err).Error("Could not compact database")
+		record.Error = err.Error()
+	} else {
+		store.log.
+			WithField("before", before).
+			WithField("after", after).
+			WithField("duration", time.Since(start)).
+			Info("Database compacted")
+	}
+
+	if errSave := store.saveCompactionRecord(record); errSave != nil {
+		store.log.WithError(errSave).Warn("Could not save compaction record")
+	}
+
+	return before, after, err
+}
+
+// GetCompactionStatus returns the progress of the running compaction and
+// the result of the last one.
+func (store *Store) GetCompactionStatus() (status CompactionStatus, err error) {
+	store.compactionLock.Lock()
+	status.Running = store.isCompactionRunning
+	status.Progress = store.compactionProgress
+	store.compactionLock.Unlock()
+
+	record, err := store.getCompactionRecord()
+	if err != nil || record == nil {
+		return status, err
+	}
+
+	status.LastTime = time.Unix(record.Time, 0)
+	status.SizeBefore = record.SizeBefore
+	status.SizeAfter = record.SizeAfter
+	status.LastError = record.Error
+	return status, nil
+}
+
+func (store *Store) getCompactionRecord() (record *compactionRecord, err error) {
+	err = store.db.View(func(tx storage.Tx) error {
+		value := tx.Bucket(compactionBucket).Get(compactionKey)
+		if value == nil {
+			return nil
+		}
+		record = &compactionRecord{}
+		return json.Unmarshal(value, record)
+	})
+	return
+}
+
+func (store *Store) saveCompactionRecord(record compactionRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(compactionBucket).Put(compactionKey, value)
+	})
+}
+
+func (store *Store) getDatabaseSize() (size int64, err error) {
+	err = store.db.View(func(tx storage.Tx) error {
+		size = tx.Size()
+		return nil
+	})
+	return
+}
+
+// isCompactionDue returns whether the account is idle and the database
+// grew enough since the last compaction.
+func (store *Store) isCompactionDue(now time.Time) bool {
+	options := getCompactionOptions()
+	if !options.Enabled || store.IsInMaintenance() || store.IsSyncRunning() || store.presence.isActive(now, options.IdleTime) {
+		return false
+	}
+
+	status, err := store.GetCompactionStatus()
+	if err != nil || status.Running || now.Sub(status.LastTime) < options.MinInterval {
+		return false
+	}
+
+	size, err := store.getDatabaseSize()
+	if err != nil || size < options.MinSize {
+		return false
+	}
+
+	return status.SizeAfter == 0 || float64(size) >= float64(status.SizeAfter)*(1+options.MinGrowth)
+}
+
+// runCompactionIfDue compacts the database when it is due. It is called by
+// the event loop after an empty event so no changes are waiting meanwhile.
+func (store *Store) runCompactionIfDue(now time.Time) {
+	if !store.isCompactionDue(now) {
+		return
+	}
+
+	if _, _, err := store.CompactDatabase(nil); err != nil && err != ErrCompactionRunning {
+		store.log.WithError(err).Warn("Background compaction failed")
+	}
+}
+
+// isEmptyEvent returns whether the event brought no changes.
+func isEmptyEvent(event *pmapi.Event) bool {
+	return event != nil &&
+		event.Refresh == 0 &&
+		event.More == 0 &&
+		len(event.Messages) == 0 &&
+		len(event.Labels) == 0 &&
+		len(event.Addresses) == 0
+}
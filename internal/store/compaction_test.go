@@ -0,0 +1,107 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactDatabase(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	var progress []float64
+	before, after, err := m.store.CompactDatabase(func(value float64) {
+		require.True(t, m.store.IsInMaintenance())
+		progress = append(progress, value)
+	})
+	require.NoError(t, err)
+	require.NotZero(t, before)
+	require.NotZero(t, after)
+	require.NotEmpty(t, progress)
+	require.Equal(t, 1.0, progress[len(progress)-1])
+	require.False(t, m.store.IsInMaintenance())
+
+	status, err := m.store.GetCompactionStatus()
+	require.NoError(t, err)
+	require.False(t, status.Running)
+	require.Equal(t, after, status.SizeAfter)
+	require.Empty(t, status.LastError)
+	require.WithinDuration(t, time.Now(), status.LastTime, time.Minute)
+
+	msg, err := m.store.getMessageFromDB("msg1")
+	require.NoError(t, err)
+	require.Equal(t, "Test message 1", msg.Subject)
+}
+
+func TestIsCompactionDue(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	defaultOptions := getCompactionOptions()
+	defer SetCompactionOptions(defaultOptions)
+
+	options := DefaultCompactionOptions()
+	options.MinSize = 0
+	SetCompactionOptions(options)
+
+	// The first sync keeps the store in maintenance for a while.
+	require.Eventually(t, func() bool { return !m.store.IsInMaintenance() }, 5*time.Second, 10*time.Millisecond)
+
+	now := time.Now()
+	require.True(t, m.store.isCompactionDue(now))
+
+	m.store.presence.lastActivity = now.Add(-time.Minute)
+	require.False(t, m.store.isCompactionDue(now), "client was active")
+	m.store.presence.lastActivity = now.Add(-time.Hour)
+
+	m.store.StartMaintenance(MaintenanceSafeMode)
+	require.False(t, m.store.isCompactionDue(now), "store is in maintenance")
+	m.store.EndMaintenance(MaintenanceSafeMode)
+
+	_, _, err := m.store.CompactDatabase(nil)
+	require.NoError(t, err)
+	require.False(t, m.store.isCompactionDue(now.Add(time.Hour)), "compacted recently")
+	require.False(t, m.store.isCompactionDue(now.Add(options.MinInterval+time.Hour)), "database did not grow")
+
+	options.MinGrowth = 0
+	SetCompactionOptions(options)
+	require.True(t, m.store.isCompactionDue(now.Add(options.MinInterval+time.Hour)))
+
+	options.Enabled = false
+	SetCompactionOptions(options)
+	require.False(t, m.store.isCompactionDue(now.Add(options.MinInterval+time.Hour)), "compaction is disabled")
+}
+
+func TestIsEmptyEvent(t *testing.T) {
+	require.True(t, isEmptyEvent(&pmapi.Event{EventID: "event"}))
+	require.False(t, isEmptyEvent(nil))
+	require.False(t, isEmptyEvent(&pmapi.Event{More: 1}))
+	require.False(t, isEmptyEvent(&pmapi.Event{Refresh: pmapi.EventRefreshMail}))
+	require.False(t, isEmptyEvent(&pmapi.Event{Messages: []*pmapi.EventMessage{{}}}))
+}
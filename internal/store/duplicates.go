@@ -0,0 +1,201 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/mail"
+	"sort"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// DuplicateGroup is a set of messages in a mailbox with the same Message-Id
+// and content, usually created by importing the same messages twice.
+type DuplicateGroup struct {
+	ExternalID string
+	Subject    string
+	Time       int64    // Unix time of the message.
+	Keep       string   // API ID of the message which is kept.
+	Extras     []string // API IDs of the copies which are removed.
+}
+
+// FindDuplicates returns groups of duplicate messages in the mailbox. Only
+// messages with the same Message-Id are downloaded to compare their content.
+func (store *Store) FindDuplicates(mailboxName string) (groups []*DuplicateGroup, err error) {
+	msgs, err := store.getBulkMessages(BulkQuery{Mailbox: mailboxName})
+	if err != nil {
+		return nil, err
+	}
+
+	byExternalID := map[string][]*pmapi.Message{}
+	externalIDs := []string{}
+	for _, msg := range msgs {
+		if msg.ExternalID == "" {
+			continue
+		}
+		if _, ok := byExternalID[msg.ExternalID]; !ok {
+			externalIDs = append(externalIDs, msg.ExternalID)
+		}
+		byExternalID[msg.ExternalID] = append(byExternalID[msg.ExternalID], msg)
+	}
+
+	for _, externalID := range externalIDs {
+		candidates := byExternalID[externalID]
+		if len(candidates) < 2 {
+			continue
+		}
+
+		// The first imported message is kept.
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Order < candidates[j].Order
+		})
+
+		byHash := map[string]*DuplicateGroup{}
+		for _, msg := range candidates {
+			hash, err := store.getContentHash(msg.ID)
+			if err != nil {
+				return groups, errors.Wrap(err, "cannot compare message "+msg.ID)
+			}
+
+			group, ok := byHash[hash]
+			if !ok {
+				byHash[hash] = &DuplicateGroup{
+					ExternalID: externalID,
+					Subject:    msg.Subject,
+					Time:       msg.Time,
+					Keep:       msg.ID,
+				}
+				continue
+			}
+			if len(group.Extras) == 0 {
+				groups = append(groups, group)
+			}
+			group.Extras = append(group.Extras, msg.ID)
+		}
+	}
+
+	return groups, nil
+}
+
+// getContentHash returns the hash of the decrypted body, the attachments and
+// the basic header fields of the message.
+func (store *Store) getContentHash(apiID string) (string, error) {
+	msg, err := store.client().GetMessage(store.ctx, apiID)
+	if err != nil {
+		return "", err
+	}
+
+	kr, err := store.client().KeyRingForAddressID(msg.AddressID)
+	if err != nil {
+		return "", err
+	}
+	if err := msg.Decrypt(kr); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%d\n%s\n", msg.Time, msg.Subject)
+	if msg.Sender != nil {
+		_, _ = fmt.Fprintln(h, msg.Sender.Address)
+	}
+	for _, list := range [][]*mail.Address{msg.ToList, msg.CCList, msg.BCCList} {
+		for _, address := range list {
+			_, _ = fmt.Fprintln(h, address.Address)
+		}
+	}
+	_, _ = fmt.Fprintf(h, "%s\n%s\n", msg.MIMEType, msg.Body)
+	for _, att := range msg.Attachments {
+		_, _ = fmt.Fprintf(h, "%s\n%s\n%d\n", att.Name, att.MIMEType, att.Size)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// RemoveDuplicates moves the extra copies of groups to Trash. Labels and the
+// star of the copies are added to the kept message first, so no label is lost.
+// Folders are not merged because adding a folder would move the kept message.
+func (store *Store) RemoveDuplicates(groups []*DuplicateGroup) error {
+	keepByLabel := map[string][]string{}
+	labelIDs := []string{}
+	extras := []string{}
+
+	for _, group := range groups {
+		keep, err := store.getMessageFromDB(group.Keep)
+		if err != nil {
+			return err
+		}
+
+		added := map[string]bool{}
+		for _, apiID := range group.Extras {
+			extra, err := store.getMessageFromDB(apiID)
+			if err != nil {
+				return err
+			}
+			for _, labelID := range extra.LabelIDs {
+				if added[labelID] || keep.HasLabelID(labelID) || !store.isMergeableLabel(labelID) {
+					continue
+				}
+				added[labelID] = true
+				if _, ok := keepByLabel[labelID]; !ok {
+					labelIDs = append(labelIDs, labelID)
+				}
+				keepByLabel[labelID] = append(keepByLabel[labelID], keep.ID)
+			}
+		}
+		extras = append(extras, group.Extras...)
+	}
+
+	// One call per label; the client splits long lists to pages.
+	for _, labelID := range labelIDs {
+		if err := store.client().LabelMessages(store.ctx, keepByLabel[labelID], labelID); err != nil {
+			return errors.Wrap(err, "cannot merge labels of duplicates")
+		}
+	}
+
+	if len(extras) == 0 {
+		return nil
+	}
+	if err := store.client().LabelMessages(store.ctx, extras, pmapi.TrashLabel); err != nil {
+		return errors.Wrap(err, "cannot move duplicates to Trash")
+	}
+
+	store.log.WithField("messages", len(extras)).Info("Duplicate messages moved to Trash")
+	return nil
+}
+
+// isMergeableLabel returns whether the label can be added to a message
+// without moving it, i.e. whether it is Starred or a custom label.
+func (store *Store) isMergeableLabel(labelID string) bool {
+	if labelID == pmapi.StarredLabel {
+		return true
+	}
+
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	for _, address := range store.addresses {
+		for _, mailbox := range address.mailboxes {
+			if mailbox.labelID == labelID {
+				return mailbox.IsLabel()
+			}
+		}
+	}
+	return false
+}
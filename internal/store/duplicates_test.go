@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindAndRemoveDuplicates(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	msgs := []*pmapi.Message{
+		getTestMessage("msg1", "Hello", "a@pm.me", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel}),
+		getTestMessage("msg2", "Hello", "a@pm.me", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel, pmapi.StarredLabel}),
+		getTestMessage("msg3", "Hello", "a@pm.me", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel}),
+		getTestMessage("msg4", "Other", "a@pm.me", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel}),
+	}
+	msgs[2].Body = "edited body"
+	for i, msg := range msgs {
+		msg.Order = int64(i)
+		msg.AddressID = addrID1
+		if msg.Subject == "Hello" {
+			msg.ExternalID = "hello@pm.me"
+		} else {
+			msg.ExternalID = "other@pm.me"
+		}
+		// Only metadata are kept in the store, the full message is returned by API.
+		full := *msg
+		m.client.EXPECT().GetMessage(gomock.Any(), msg.ID).Return(&full, nil).MaxTimes(1)
+		require.NoError(t, m.store.createOrUpdateMessageEvent(msg))
+	}
+
+	m.client.EXPECT().KeyRingForAddressID(addrID1).Return(nil, nil).Times(3)
+
+	groups, err := m.store.FindDuplicates("INBOX")
+	require.NoError(t, err)
+	require.Equal(t, []*DuplicateGroup{{
+		ExternalID: "hello@pm.me",
+		Subject:    "Hello",
+		Keep:       "msg1",
+		Extras:     []string{"msg2"},
+	}}, groups)
+
+	gomock.InOrder(
+		m.client.EXPECT().LabelMessages(gomock.Any(), []string{"msg1"}, pmapi.StarredLabel).Return(nil),
+		m.client.EXPECT().LabelMessages(gomock.Any(), []string{"msg2"}, pmapi.TrashLabel).Return(nil),
+	)
+	require.NoError(t, m.store.RemoveDuplicates(groups))
+}
+
+func TestFindDuplicatesUnknownMailbox(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	_, err := m.store.FindDuplicates("Unknown")
+	require.Error(t, err)
+}
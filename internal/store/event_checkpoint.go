@@ -0,0 +1,44 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import "github.com/ProtonMail/proton-bridge/internal/store/storage"
+
+// eventCheckpointKey keeps the ID of the last processed event in the store
+// database itself, so the database restored from a backup resumes the delta
+// sync from it even without the shared cache.
+const eventCheckpointKey = "event_checkpoint"
+
+// loadEventCheckpoint returns the event ID stored in database or empty
+// string if there is none.
+func (store *Store) loadEventCheckpoint() (eventID string) {
+	err := store.db.View(func(tx storage.Tx) error {
+		eventID = string(tx.Bucket(syncStateBucket).Get([]byte(eventCheckpointKey)))
+		return nil
+	})
+	if err != nil {
+		store.log.WithError(err).Error("Failed to load event checkpoint")
+	}
+	return
+}
+
+func (store *Store) saveEventCheckpoint(eventID string) error {
+	return store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(syncStateBucket).Put([]byte(eventCheckpointKey), []byte(eventID))
+	})
+}
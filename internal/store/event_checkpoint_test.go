@@ -0,0 +1,55 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventCheckpointSavedByEventLoop(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	m.client.EXPECT().ListMessages(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{}, 0, nil).AnyTimes()
+	m.store.eventLoop.pollNow()
+
+	require.Equal(t, "latestEventID", m.store.loadEventCheckpoint())
+}
+
+func TestEventLoopResumesFromStoreCheckpoint(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	m.client.EXPECT().ListMessages(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{}, 0, nil).AnyTimes()
+	m.store.eventLoop.pollNow()
+	require.NoError(t, m.store.saveEventCheckpoint("event42"))
+
+	// Simulate the store database restored from backup without the shared cache.
+	emptyCache := NewCache(filepath.Join(m.tmpDir, "restored-cache.json"))
+	loop := newEventLoop(emptyCache, m.store, m.user, m.events)
+
+	require.Equal(t, "event42", loop.currentEventID)
+	require.Equal(t, "event42", emptyCache.getEventID("userID"))
+}
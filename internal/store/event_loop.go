@@ -22,6 +22,7 @@ import (
 	"time"
 
 	bridgeEvents "github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/incidents"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
@@ -54,9 +55,22 @@ func newEventLoop(cache *Cache, store *Store, user BridgeUser, events listener.L
 	eventLog := log.WithField("userID", user.ID())
 	eventLog.Trace("Creating new event loop")
 
+	// Shared cache does not have to be part of a backup of the store database.
+	// In such case use the checkpoint stored in the database itself to resume
+	// from the last processed event instead of skipping the missed ones.
+	currentEventID := cache.getEventID(user.ID())
+	if currentEventID == "" {
+		if currentEventID = store.loadEventCheckpoint(); currentEventID != "" {
+			eventLog.WithField("eventID", currentEventID).Info("Restoring event ID from store checkpoint")
+			if err := cache.setEventID(user.ID(), currentEventID); err != nil {
+				eventLog.WithError(err).Warn("Could not save restored event ID to cache")
+			}
+		}
+	}
+
 	return &eventLoop{
 		cache:          cache,
-		currentEventID: cache.getEventID(user.ID()),
+		currentEventID: currentEventID,
 		pollCh:         make(chan chan struct{}),
 		isRunning:      false,
 
@@ -79,7 +93,7 @@ func (loop *eventLoop) client() pmapi.Client {
 func (loop *eventLoop) setFirstEventID() (err error) {
 	loop.log.Info("Setting first event ID")
 
-	event, err := loop.client().GetEvent("")
+	event, err := loop.client().GetEvent(loop.store.ctx, "")
 	if err != nil {
 		loop.log.WithError(err).Error("Could not get latest event ID")
 		return
@@ -87,7 +101,7 @@ func (loop *eventLoop) setFirstEventID() (err error) {
 
 	loop.currentEventID = event.EventID
 
-	if err = loop.cache.setEventID(loop.user.ID(), loop.currentEventID); err != nil {
+	if err = loop.saveEventID(loop.currentEventID); err != nil {
 		loop.log.WithError(err).Error("Could not set latest event ID in user cache")
 		return
 	}
@@ -95,6 +109,15 @@ func (loop *eventLoop) setFirstEventID() (err error) {
 	return
 }
 
+// saveEventID persists the event ID both to the shared cache and to the store
+// database checkpoint.
+func (loop *eventLoop) saveEventID(eventID string) error {
+	if err := loop.cache.setEventID(loop.user.ID(), eventID); err != nil {
+		return err
+	}
+	return loop.store.saveEventCheckpoint(eventID)
+}
+
 // pollNow starts polling events right away and waits till the events are
 // processed so we are sure updates are propagated to the database.
 func (loop *eventLoop) pollNow() {
@@ -104,6 +127,28 @@ func (loop *eventLoop) pollNow() {
 	close(eventProcessedCh)
 }
 
+// pollNowWithTimeout is like pollNow but gives up waiting after timeout,
+// e.g. when the loop is stopped or busy. It returns whether the events
+// were processed.
+func (loop *eventLoop) pollNowWithTimeout(timeout time.Duration) bool {
+	// Buffered so the loop does not block when nobody waits anymore.
+	eventProcessedCh := make(chan struct{}, 1)
+	deadline := time.After(timeout)
+
+	select {
+	case loop.pollCh <- eventProcessedCh:
+	case <-deadline:
+		return false
+	}
+
+	select {
+	case <-eventProcessedCh:
+		return true
+	case <-deadline:
+		return false
+	}
+}
+
 func (loop *eventLoop) stop() {
 	if loop.isRunning {
 		loop.isRunning = false
@@ -144,9 +189,11 @@ func (loop *eventLoop) start() {
 	loop.loop()
 }
 
-// loop is the main body of the event loop.
-func (loop *eventLoop) loop() {
-	t := time.NewTicker(pollInterval - pollIntervalSpread)
+// loop is the main body of the event loop. The interval between polls
+// depends on presence of clients, see getPollInterval.
+func (loop *eventLoop) loop() { //nolint[funlen]
+	lastPoll := time.Now()
+	t := time.NewTimer(loop.store.getPollInterval(lastPoll) - pollIntervalSpread)
 	defer t.Stop()
 
 	for {
@@ -158,9 +205,16 @@ func (loop *eventLoop) loop() {
 		case <-t.C:
 			// Randomise periodic calls within range pollInterval ± pollSpread to reduces potential load spikes on API.
 			time.Sleep(time.Duration(rand.Intn(2*int(pollIntervalSpread.Milliseconds()))) * time.Millisecond)
+		case <-loop.store.presence.changeCh:
+			// Client became active; poll now unless the last poll is recent enough.
+			if wait := loop.store.getPollInterval(time.Now()) - pollIntervalSpread - time.Since(lastPoll); wait > 0 {
+				resetTimer(t, wait)
+				continue
+			}
 		case eventProcessedCh = <-loop.pollCh:
 			// We don't want to wait here. Polling should happen instantly.
 		}
+		lastPoll = time.Now()
 
 		// Before we fetch the first event, check whether this is the first time we've
 		// started the event loop, and if so, trigger a full sync.
@@ -173,14 +227,20 @@ func (loop *eventLoop) loop() {
 		}
 
 		// If the sync is not finished then a new sync is triggered.
+		// Retention policies are applied and snoozed messages moved back
+		// only in synced store.
 		if !loop.store.isSyncFinished() {
 			loop.store.triggerSync()
+		} else {
+			loop.store.runRetentionIfDue(time.Now())
+			loop.store.wakeSnoozedMessages(time.Now())
 		}
 
 		more, err := loop.processNextEvent()
 		if eventProcessedCh != nil {
 			eventProcessedCh <- struct{}{}
 		}
+		resetTimer(t, loop.store.getPollInterval(time.Now())-pollIntervalSpread-time.Since(lastPoll))
 		if err != nil {
 			loop.log.WithError(err).Error("Cannot process event, stopping event loop")
 			// When event loop stops, the only way to start it again is by login.
@@ -196,10 +256,23 @@ func (loop *eventLoop) loop() {
 
 		if more {
 			go loop.pollNow()
+		} else if loop.store.isSyncFinished() && isEmptyEvent(loop.currentEvent) {
+			loop.store.runCompactionIfDue(time.Now())
 		}
 	}
 }
 
+// resetTimer changes the timer which may have already fired.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
 // isBeforeFirstStart returns whether the initial event ID was already set or not.
 func (loop *eventLoop) isBeforeFirstStart() bool {
 	return loop.currentEventID == ""
@@ -218,6 +291,7 @@ func (loop *eventLoop) processNextEvent() (more bool, err error) { // nolint[fun
 	defer func() {
 		if errors.Cause(err) == pmapi.ErrAPINotReachable {
 			l.Warn("Internet unavailable")
+			incidents.Report(incidents.APIUnreachable, loop.store.UserID(), err.Error())
 			loop.events.Emit(bridgeEvents.InternetOffEvent, "")
 			loop.hasInternet = false
 			err = nil
@@ -253,7 +327,7 @@ func (loop *eventLoop) processNextEvent() (more bool, err error) { // nolint[fun
 	loop.pollCounter++
 
 	var event *pmapi.Event
-	if event, err = loop.client().GetEvent(loop.currentEventID); err != nil {
+	if event, err = loop.client().GetEvent(loop.store.ctx, loop.currentEventID); err != nil {
 		return false, errors.Wrap(err, "failed to get event")
 	}
 
@@ -282,7 +356,7 @@ func (loop *eventLoop) processNextEvent() (more bool, err error) { // nolint[fun
 		// This allows the event loop to continue to function (unless the cache was broken
 		// and bridge stopped, in which case it will start from the old event ID anyway).
 		loop.currentEventID = event.EventID
-		if err = loop.cache.setEventID(loop.user.ID(), event.EventID); err != nil {
+		if err = loop.saveEventID(event.EventID); err != nil {
 			return false, errors.Wrap(err, "failed to save event ID to cache")
 		}
 	}
@@ -432,6 +506,21 @@ func (loop *eventLoop) processMessages(eventLog *logrus.Entry, messages []*pmapi
 				return errors.Wrap(err, "failed to put message into DB")
 			}
 
+			// Local rules change messages by API which waits for the event loop.
+			if shouldApplyLocalRules(message.Created) {
+				go func(msg *pmapi.Message) {
+					defer loop.store.panicHandler.HandlePanic()
+					loop.store.applyLocalRules(msg, loop.events)
+				}(message.Created)
+			}
+			loop.archiveLocally(message.Created)
+			loop.importAutocrypt(message.Created)
+			loop.checkPhishing(message.Created)
+
+			if isReceivedMessage(message.Created) {
+				loop.events.Emit(bridgeEvents.NewMessageEvent, loop.store.UserID()+":"+message.Created.ID)
+			}
+
 		case pmapi.EventUpdate, pmapi.EventUpdateFlags:
 			msgLog.Debug("Processing EventUpdate(Flags) for message")
 
@@ -449,7 +538,7 @@ func (loop *eventLoop) processMessages(eventLog *logrus.Entry, messages []*pmapi
 
 				msgLog.WithError(err).Warning("Message was not present in DB. Trying fetch...")
 
-				if msg, err = loop.client().GetMessage(message.ID); err != nil {
+				if msg, err = loop.client().GetMessage(loop.store.ctx, message.ID); err != nil {
 					if _, ok := err.(*pmapi.ErrUnprocessableEntity); ok {
 						msgLog.WithError(err).Warn("Skipping message update because message exists neither in local DB nor on API")
 						err = nil
@@ -465,6 +554,7 @@ func (loop *eventLoop) processMessages(eventLog *logrus.Entry, messages []*pmapi
 			if err = loop.store.createOrUpdateMessageEvent(msg); err != nil {
 				return errors.Wrap(err, "failed to update message in DB")
 			}
+			loop.archiveLocally(msg)
 
 		case pmapi.EventDelete:
 			msgLog.Debug("Processing EventDelete for message")
@@ -478,6 +568,19 @@ func (loop *eventLoop) processMessages(eventLog *logrus.Entry, messages []*pmapi
 	return err
 }
 
+// archiveLocally writes the message to the local archive in the background
+// when it arrived to any archived mailbox.
+func (loop *eventLoop) archiveLocally(msg *pmapi.Message) {
+	if !loop.store.shouldArchiveLocally(msg) {
+		return
+	}
+
+	go func() {
+		defer loop.store.panicHandler.HandlePanic()
+		loop.store.archiveLocally(msg)
+	}()
+}
+
 func updateMessage(msgLog *logrus.Entry, message *pmapi.Message, updates *pmapi.EventMessageUpdated) { //nolint[funlen]
 	msgLog.Debug("Updating message")
 
@@ -0,0 +1,160 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// PollOptions configure how often all stores poll events. Events are polled
+// every Active interval while a client waits for push by IDLE or used the
+// account within ActivityWindow, and every Background interval otherwise.
+// Background not longer than Active turns adaptive polling off.
+type PollOptions struct {
+	Active         time.Duration
+	Background     time.Duration
+	ActivityWindow time.Duration
+}
+
+// DefaultActivityWindow is how long the account counts as active after
+// the last client activity.
+const DefaultActivityWindow = 5 * time.Minute
+
+// minPollInterval keeps the random spread of polls positive.
+const minPollInterval = 2 * pollIntervalSpread
+
+var (
+	pollOptions = PollOptions{ //nolint[gochecknoglobals]
+		Active:         pollInterval,
+		Background:     5 * time.Minute,
+		ActivityWindow: DefaultActivityWindow,
+	}
+	pollOptionsLock sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetPollOptions sets intervals of event polling of all stores.
+func SetPollOptions(options PollOptions) {
+	pollOptionsLock.Lock()
+	defer pollOptionsLock.Unlock()
+
+	if options.Active < minPollInterval {
+		options.Active = minPollInterval
+	}
+	pollOptions = options
+}
+
+func getPollOptions() PollOptions {
+	pollOptionsLock.RLock()
+	defer pollOptionsLock.RUnlock()
+
+	return pollOptions
+}
+
+// clientPresence tracks whether IMAP clients of the account wait for push
+// or were active recently. Becoming active is signalled to the event loop
+// so waiting clients do not wait for the slow background poll.
+type clientPresence struct {
+	lock         sync.Mutex
+	idling       int
+	lastActivity time.Time
+	changeCh     chan struct{}
+}
+
+func newClientPresence() *clientPresence {
+	return &clientPresence{
+		changeCh: make(chan struct{}, 1),
+	}
+}
+
+func (presence *clientPresence) isActive(now time.Time, window time.Duration) bool {
+	presence.lock.Lock()
+	defer presence.lock.Unlock()
+
+	return presence.idling > 0 || now.Sub(presence.lastActivity) < window
+}
+
+// startIdle counts the client waiting for push and returns whether the
+// account was not active before.
+func (presence *clientPresence) startIdle(now time.Time, window time.Duration) (becameActive bool) {
+	presence.lock.Lock()
+	defer presence.lock.Unlock()
+
+	becameActive = presence.idling == 0 && now.Sub(presence.lastActivity) >= window
+	presence.idling++
+	return
+}
+
+func (presence *clientPresence) stopIdle(now time.Time) {
+	presence.lock.Lock()
+	defer presence.lock.Unlock()
+
+	if presence.idling > 0 {
+		presence.idling--
+	}
+	presence.lastActivity = now
+}
+
+// notifyActivity returns whether the account was not active before.
+func (presence *clientPresence) notifyActivity(now time.Time, window time.Duration) (becameActive bool) {
+	presence.lock.Lock()
+	defer presence.lock.Unlock()
+
+	becameActive = presence.idling == 0 && now.Sub(presence.lastActivity) >= window
+	presence.lastActivity = now
+	return
+}
+
+func (presence *clientPresence) signalChange() {
+	select {
+	case presence.changeCh <- struct{}{}:
+	default:
+	}
+}
+
+// StartIdle is called when an IMAP client starts waiting for push by IDLE.
+// Every call must be followed by StopIdle.
+func (store *Store) StartIdle() {
+	if store.presence.startIdle(time.Now(), getPollOptions().ActivityWindow) {
+		store.log.Debug("Client is waiting for push, polling events often")
+		store.presence.signalChange()
+	}
+}
+
+// StopIdle is called when the IMAP client stops waiting for push.
+func (store *Store) StopIdle() {
+	store.presence.stopIdle(time.Now())
+}
+
+// NotifyClientActivity is called when an IMAP client uses the account, e.g.
+// selects a mailbox.
+func (store *Store) NotifyClientActivity() {
+	if store.presence.notifyActivity(time.Now(), getPollOptions().ActivityWindow) {
+		store.log.Debug("Client is active, polling events often")
+		store.presence.signalChange()
+	}
+}
+
+// getPollInterval returns the interval between polls of events.
+func (store *Store) getPollInterval(now time.Time) time.Duration {
+	options := getPollOptions()
+	if options.Background <= options.Active || store.presence.isActive(now, options.ActivityWindow) {
+		return options.Active
+	}
+	return options.Background
+}
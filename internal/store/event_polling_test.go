@@ -0,0 +1,62 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPollInterval(t *testing.T) {
+	defer SetPollOptions(getPollOptions())
+	SetPollOptions(PollOptions{Active: time.Second, Background: time.Hour, ActivityWindow: time.Minute})
+	require.Equal(t, minPollInterval, getPollOptions().Active)
+
+	store := &Store{presence: newClientPresence(), log: log}
+	now := time.Now()
+
+	// Without clients events are polled slowly.
+	require.Equal(t, time.Hour, store.getPollInterval(now))
+
+	// Client waiting for push wakes up the event loop once.
+	store.StartIdle()
+	require.Len(t, store.presence.changeCh, 1)
+	store.StartIdle()
+	require.Len(t, store.presence.changeCh, 1)
+	<-store.presence.changeCh
+	require.Equal(t, minPollInterval, store.getPollInterval(now))
+
+	// Recent activity keeps polling often after IDLE finished.
+	store.StopIdle()
+	store.StopIdle()
+	require.Equal(t, minPollInterval, store.getPollInterval(time.Now()))
+	require.Equal(t, time.Hour, store.getPollInterval(time.Now().Add(time.Minute)))
+
+	store.NotifyClientActivity()
+	require.Len(t, store.presence.changeCh, 0)
+
+	store.presence.lastActivity = now.Add(-time.Hour)
+	store.NotifyClientActivity()
+	require.Len(t, store.presence.changeCh, 1)
+
+	// Adaptive polling is off when background is not longer.
+	SetPollOptions(PollOptions{Active: time.Minute, Background: time.Minute})
+	require.Equal(t, time.Minute, store.getPollInterval(now.Add(time.Hour)))
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+)
+
+const defaultExpirationKey = "default"
+
+// GetDefaultExpiration returns after how long messages sent without own
+// expiration expire. Zero means they don't expire.
+func (store *Store) GetDefaultExpiration() (expiration time.Duration) {
+	_ = store.db.View(func(tx storage.Tx) error {
+		seconds, _ := strconv.ParseInt(string(tx.Bucket(expirationBucket).Get([]byte(defaultExpirationKey))), 10, 64)
+		expiration = time.Duration(seconds) * time.Second
+		return nil
+	})
+	return
+}
+
+// SetDefaultExpiration sets after how long messages sent without own
+// expiration expire. Zero disables the expiration.
+func (store *Store) SetDefaultExpiration(expiration time.Duration) error {
+	if expiration < 0 || expiration > message.MaxExpiration {
+		return fmt.Errorf("expiration must be between 0 and %v", message.MaxExpiration)
+	}
+
+	seconds := int64(expiration / time.Second)
+	return store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(expirationBucket).Put([]byte(defaultExpirationKey), []byte(strconv.FormatInt(seconds, 10)))
+	})
+}
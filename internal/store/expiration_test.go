@@ -0,0 +1,44 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultExpiration(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.Equal(t, time.Duration(0), m.store.GetDefaultExpiration())
+
+	require.NoError(t, m.store.SetDefaultExpiration(7*24*time.Hour))
+	require.Equal(t, 7*24*time.Hour, m.store.GetDefaultExpiration())
+
+	require.Error(t, m.store.SetDefaultExpiration(29*24*time.Hour))
+	require.Error(t, m.store.SetDefaultExpiration(-time.Hour))
+	require.Equal(t, 7*24*time.Hour, m.store.GetDefaultExpiration())
+
+	require.NoError(t, m.store.SetDefaultExpiration(0))
+	require.Equal(t, time.Duration(0), m.store.GetDefaultExpiration())
+}
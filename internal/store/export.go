@@ -0,0 +1,230 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/archive"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// ExportOptions configures one-time export of messages to local files.
+type ExportOptions struct {
+	Dir               string   // Each address has own folder in it.
+	Format            string   // One of archive.FormatEML or archive.FormatMBOX.
+	Mailboxes         []string // IMAP names of exported mailboxes, all but All Mail when empty.
+	InlineAttachments bool     // Attachments are written as separate files when false.
+	AttachmentStubs   bool     // Separated attachments are replaced by stub parts and listed in a manifest.
+	ForSharing        bool     // Bcc, internal and trace header fields are removed when true.
+}
+
+// strippedPartsName is the file listing attachments stripped from the
+// message, written next to the attachments of the message.
+const strippedPartsName = "stripped.json"
+
+// exportedPart is the record about an attachment stripped from the exported
+// message with the path of the file it was written to.
+type exportedPart struct {
+	message.StrippedPart
+	Path string // Relative to the archive root.
+}
+
+func (options ExportOptions) headerPolicy() message.HeaderPolicy {
+	if options.ForSharing {
+		return message.ForwardHeaderPolicy
+	}
+	return message.ExportHeaderPolicy
+}
+
+// ExportProgress is called after each exported message.
+type ExportProgress func(mailbox string, done, total int)
+
+// Export decrypts messages of the mailboxes and writes them to local files.
+// Messages which cannot be exported are skipped and counted as failed.
+func (store *Store) Export(options ExportOptions, progress ExportProgress) (exported, failed int, err error) {
+	store.lock.RLock()
+	addresses := make([]*Address, 0, len(store.addresses))
+	for _, address := range store.addresses {
+		addresses = append(addresses, address)
+	}
+	store.lock.RUnlock()
+
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i].address < addresses[j].address })
+
+	for _, address := range addresses {
+		a, err := archive.New(filepath.Join(options.Dir, filepath.Base(address.address)), options.Format)
+		if err != nil {
+			return exported, failed, err
+		}
+
+		for _, mailbox := range getExportedMailboxes(address, options.Mailboxes) {
+			apiIDs, err := mailbox.GetAPIIDsFromUIDRange(1, 0)
+			if err != nil {
+				return exported, failed, err
+			}
+
+			for i, apiID := range apiIDs {
+				if err := store.exportMessage(a, mailbox.Name(), apiID, options); err != nil {
+					store.log.WithError(err).WithField("msgID", apiID).Warn("Cannot export message")
+					failed++
+				} else {
+					exported++
+				}
+
+				if progress != nil {
+					progress(mailbox.Name(), i+1, len(apiIDs))
+				}
+			}
+		}
+	}
+
+	return exported, failed, nil
+}
+
+func getExportedMailboxes(address *Address, names []string) (mailboxes []*Mailbox) {
+	if len(names) == 0 {
+		for _, mailbox := range address.ListMailboxes() {
+			if mailbox.LabelID() != pmapi.AllMailLabel {
+				mailboxes = append(mailboxes, mailbox)
+			}
+		}
+		sort.Slice(mailboxes, func(i, j int) bool { return mailboxes[i].Name() < mailboxes[j].Name() })
+		return
+	}
+
+	for _, name := range names {
+		if mailbox, err := address.GetMailbox(name); err == nil {
+			mailboxes = append(mailboxes, mailbox)
+		}
+	}
+	return
+}
+
+func (store *Store) exportMessage(a *archive.Archive, mailbox, apiID string, options ExportOptions) error {
+	complete, err := store.client().GetMessage(store.ctx, apiID)
+	if err != nil {
+		return err
+	}
+
+	// Inline attachments, e.g. images, are part of the body and always
+	// stay in the message.
+	var attachments []*pmapi.Attachment
+	if !options.InlineAttachments && !options.AttachmentStubs {
+		attachments, complete.Attachments = message.SeparateInlineAttachments(complete)
+		complete.NumAttachments = len(complete.Attachments)
+	}
+
+	builder := message.NewBuilder(store.client(), complete)
+	builder.EncryptedToHTML = false
+	builder.Context = store.ctx
+	builder.LabelNames = store.GetLabelNames(complete.LabelIDs)
+	builder.HeaderPolicy = options.headerPolicy()
+
+	// The message is built while being written to the archive, unless its
+	// attachments are replaced by stubs which needs the whole message.
+	body := builder.NewReader()
+	defer body.Close() //nolint[errcheck]
+
+	var stripped []exportedPart
+	if !options.InlineAttachments && options.AttachmentStubs {
+		literal, err := ioutil.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		if literal, stripped, err = stripExportedAttachments(a, mailbox, complete.ID, literal); err != nil {
+			return err
+		}
+		body = ioutil.NopCloser(bytes.NewReader(literal))
+	}
+
+	exported := &archive.Message{
+		ID:     complete.ID,
+		Date:   time.Unix(complete.Time, 0),
+		IsRead: complete.Unread == 0,
+		Body:   body,
+	}
+	if complete.Sender != nil {
+		exported.From = complete.Sender.Address
+	}
+
+	if err := a.Append(mailbox, exported); err != nil {
+		return err
+	}
+
+	for _, att := range attachments {
+		if err := store.exportAttachment(a, builder, mailbox, complete.ID, att); err != nil {
+			return err
+		}
+	}
+
+	if len(stripped) > 0 {
+		data, err := json.MarshalIndent(stripped, "", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := a.WriteAttachment(mailbox, complete.ID, strippedPartsName, bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stripExportedAttachments replaces attachments of the built message by
+// stubs and writes them to separate files. Inline attachments stay.
+func stripExportedAttachments(a *archive.Archive, mailbox, messageID string, body []byte) ([]byte, []exportedPart, error) {
+	paths := map[string]string{}
+	body, manifest, err := message.StripAttachments(body, message.StripStub, func(part message.StrippedPart, content io.Reader) error {
+		path, err := a.WriteAttachment(mailbox, messageID, part.Filename, content)
+		paths[part.Section] = path
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parts := make([]exportedPart, 0, len(manifest))
+	for _, part := range manifest {
+		parts = append(parts, exportedPart{StrippedPart: part, Path: paths[part.Section]})
+	}
+	return body, parts, nil
+}
+
+func (store *Store) exportAttachment(a *archive.Archive, builder *message.Builder, mailbox, messageID string, att *pmapi.Attachment) error {
+	r, err := store.client().GetAttachment(store.ctx, att.ID)
+	if err != nil {
+		return err
+	}
+	defer r.Close() //nolint[errcheck]
+
+	dr, err := builder.DecryptAttachment(att, r)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.WriteAttachment(mailbox, messageID, att.Name, dr)
+	return err
+}
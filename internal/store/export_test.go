@@ -0,0 +1,112 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/archive"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetExportedMailboxes(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	address := m.store.addresses[addrID1]
+
+	names := []string{}
+	for _, mailbox := range getExportedMailboxes(address, nil) {
+		names = append(names, mailbox.Name())
+	}
+	require.NotContains(t, names, "All Mail")
+	require.Contains(t, names, "INBOX")
+
+	mailboxes := getExportedMailboxes(address, []string{"All Mail", "Folders/Missing"})
+	require.Len(t, mailboxes, 1)
+	require.Equal(t, pmapi.AllMailLabel, mailboxes[0].LabelID())
+}
+
+func TestExportSkipsFailedMessages(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	m.client.EXPECT().GetMessage(gomock.Any(), "msg1").Return(nil, errors.New("offline"))
+	m.client.EXPECT().GetMessage(gomock.Any(), "msg2").Return(nil, errors.New("offline"))
+
+	var progress []int
+	exported, failed, err := m.store.Export(ExportOptions{
+		Dir:       filepath.Join(m.tmpDir, "export"),
+		Format:    archive.FormatEML,
+		Mailboxes: []string{"INBOX"},
+	}, func(mailbox string, done, total int) {
+		require.Equal(t, "INBOX", mailbox)
+		require.Equal(t, 2, total)
+		progress = append(progress, done)
+	})
+	require.NoError(t, err)
+	require.Equal(t, 0, exported)
+	require.Equal(t, 2, failed)
+	require.Equal(t, []int{1, 2}, progress)
+}
+
+func TestExportHeaderPolicy(t *testing.T) {
+	require.Equal(t, message.ExportHeaderPolicy, ExportOptions{}.headerPolicy())
+	require.Equal(t, message.ForwardHeaderPolicy, ExportOptions{ForSharing: true}.headerPolicy())
+}
+
+func TestStripExportedAttachments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	a, err := archive.New(dir, archive.FormatEML)
+	require.NoError(t, err)
+
+	body := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nbody\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=doc.pdf\r\n\r\npdf\r\n" +
+		"--b--\r\n"
+
+	stripped, parts, err := stripExportedAttachments(a, "INBOX", "msg1", []byte(body))
+	require.NoError(t, err)
+	require.Contains(t, string(stripped), "Attachment removed: doc.pdf")
+	require.NotContains(t, string(stripped), "\r\npdf\r\n")
+
+	require.Len(t, parts, 1)
+	require.Equal(t, "2", parts[0].Section)
+	require.NotEmpty(t, parts[0].Path)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, parts[0].Path))
+	require.NoError(t, err)
+	require.Equal(t, "pdf\r\n", string(content))
+}
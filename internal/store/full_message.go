@@ -0,0 +1,43 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+)
+
+// BuildFullMessage returns the complete message with all attachments as
+// IMAP would serve it without any size limit. It is used to download
+// messages which IMAP clients get only as a truncated preview. The message
+// is built while being read, so attachments are never kept in memory; the
+// reader has to be closed.
+func (store *Store) BuildFullMessage(apiID string) (io.ReadCloser, error) {
+	complete, err := store.client().GetMessage(store.ctx, apiID)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := message.NewBuilder(store.client(), complete)
+	builder.Context = store.ctx
+	builder.LabelNames = store.GetLabelNames(complete.LabelIDs)
+	builder.HeaderPolicy = message.IMAPHeaderPolicy
+	builder.RemoteContent = store.GetRemoteContentFilter()
+	return builder.NewReader(), nil
+}
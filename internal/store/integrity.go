@@ -0,0 +1,295 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// Kinds of IntegrityProblem.
+const (
+	// IntegrityMissingMetadata is UID of message without stored metadata,
+	// so its body cannot be fetched by IMAP clients.
+	IntegrityMissingMetadata = "missing metadata"
+	// IntegrityBrokenMapping is UID and API ID which do not point to each other.
+	IntegrityBrokenMapping = "broken UID mapping"
+	// IntegrityWrongCounters is mailbox whose stored counts differ from its messages.
+	IntegrityWrongCounters = "wrong counters"
+)
+
+// integrityRefetchPageSize is the number of messages asked by one request
+// when metadata are fetched again.
+const integrityRefetchPageSize = 150
+
+// IntegrityProblem is one inconsistency of the store database.
+type IntegrityProblem struct {
+	Mailbox string
+	Kind    string
+	APIID   string `json:",omitempty"`
+	UID     uint32 `json:",omitempty"`
+	Details string `json:",omitempty"`
+
+	mailbox *Mailbox
+}
+
+func (problem *IntegrityProblem) String() string {
+	desc := problem.Mailbox + ": " + problem.Kind
+	if problem.UID != 0 {
+		desc += fmt.Sprintf(" (UID %d, ID %s)", problem.UID, problem.APIID)
+	}
+	if problem.Details != "" {
+		desc += " " + problem.Details
+	}
+	return desc
+}
+
+// VerifyIntegrity scans mailboxes of all addresses for UIDs pointing to
+// missing messages, UID mappings which do not match and counts which do not
+// match the messages in the mailbox. The database is not changed.
+func (store *Store) VerifyIntegrity() (problems []*IntegrityProblem, err error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	// Mailboxes are sorted to report problems always in the same order.
+	mailboxes := []*Mailbox{}
+	for _, address := range store.addresses {
+		for _, mailbox := range address.mailboxes {
+			mailboxes = append(mailboxes, mailbox)
+		}
+	}
+	sort.SliceStable(mailboxes, func(i, j int) bool {
+		return mailboxes[i].labelName < mailboxes[j].labelName
+	})
+
+	err = store.db.View(func(tx storage.Tx) error {
+		metaBucket := tx.Bucket(metadataBucket)
+		for _, mailbox := range mailboxes {
+			mailboxProblems, err := mailbox.txVerifyIntegrity(tx, metaBucket)
+			if err != nil {
+				return errors.Wrap(err, "cannot verify "+mailbox.labelName)
+			}
+			problems = append(problems, mailboxProblems...)
+		}
+		return nil
+	})
+	return problems, err
+}
+
+func (storeMailbox *Mailbox) txVerifyIntegrity(tx storage.Tx, metaBucket storage.Bucket) (problems []*IntegrityProblem, err error) {
+	newProblem := func(kind string, uidb, apiID []byte) *IntegrityProblem {
+		problem := &IntegrityProblem{
+			Mailbox: storeMailbox.labelName,
+			Kind:    kind,
+			APIID:   string(apiID),
+			mailbox: storeMailbox,
+		}
+		if uidb != nil {
+			problem.UID = btoi(uidb)
+		}
+		return problem
+	}
+
+	imapBucket := storeMailbox.txGetIMAPIDsBucket(tx)
+	apiBucket := storeMailbox.txGetAPIIDsBucket(tx)
+	unreadBucket := storeMailbox.txGetBucket(tx).Bucket(unreadIDsBucket)
+
+	counted := mailboxCounters{}
+	unreadSetMatches := true
+	err = imapBucket.ForEach(func(uidb, apiID []byte) error {
+		counted.total++
+
+		if !bytes.Equal(apiBucket.Get(apiID), uidb) {
+			problems = append(problems, newProblem(IntegrityBrokenMapping, uidb, apiID))
+			return nil
+		}
+
+		rawMsg := metaBucket.Get(apiID)
+		if rawMsg == nil {
+			problems = append(problems, newProblem(IntegrityMissingMetadata, uidb, apiID))
+			return nil
+		}
+
+		msg := &pmapi.Message{}
+		if err := json.Unmarshal(rawMsg, msg); err != nil {
+			return err
+		}
+		if isMessageUnread(msg) {
+			counted.unread++
+		}
+		if isMessageUnread(msg) != (unreadBucket.Get(apiID) != nil) {
+			unreadSetMatches = false
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = apiBucket.ForEach(func(apiID, uidb []byte) error {
+		if !bytes.Equal(imapBucket.Get(uidb), apiID) {
+			problems = append(problems, newProblem(IntegrityBrokenMapping, uidb, apiID))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stored := storeMailbox.txGetCounters(tx)
+	if stored.total != counted.total || stored.unread != counted.unread || !unreadSetMatches {
+		problem := newProblem(IntegrityWrongCounters, nil, nil)
+		problem.Details = fmt.Sprintf("(stored %d messages and %d unread, counted %d and %d)", stored.total, stored.unread, counted.total, counted.unread)
+		problems = append(problems, problem)
+	}
+
+	return problems, nil
+}
+
+// RepairIntegrity fixes the problems found by VerifyIntegrity. Broken UIDs
+// are removed and metadata of their messages are fetched from the API again,
+// so messages which still exist get a new UID. Counters of the affected
+// mailboxes are counted again. It returns the number of repaired problems.
+func (store *Store) RepairIntegrity(problems []*IntegrityProblem) (repaired int, err error) {
+	affected := map[*Mailbox]bool{}
+	refetchIDs := []string{}
+	isRefetched := map[string]bool{}
+
+	for _, problem := range problems {
+		if problem.mailbox == nil {
+			continue
+		}
+		affected[problem.mailbox] = true
+		if problem.Kind == IntegrityWrongCounters {
+			continue
+		}
+
+		err := store.db.Update(func(tx storage.Tx) error {
+			return problem.mailbox.txRemoveUID(tx, problem.UID, problem.APIID)
+		})
+		if err != nil {
+			return repaired, errors.Wrap(err, "cannot remove "+problem.String())
+		}
+		if !isRefetched[problem.APIID] {
+			isRefetched[problem.APIID] = true
+			refetchIDs = append(refetchIDs, problem.APIID)
+		}
+	}
+
+	if err := store.refetchMetadata(refetchIDs); err != nil {
+		return repaired, err
+	}
+
+	for mailbox := range affected {
+		err := store.db.Update(func(tx storage.Tx) error {
+			if err := txRebuildMailboxCounters(tx.Bucket(metadataBucket), mailbox.txGetBucket(tx)); err != nil {
+				return err
+			}
+			return mailbox.txMailboxStatusUpdate(tx)
+		})
+		if err != nil {
+			return repaired, errors.Wrap(err, "cannot count messages of "+mailbox.labelName)
+		}
+	}
+
+	for _, problem := range problems {
+		if problem.mailbox != nil {
+			repaired++
+		}
+	}
+	return repaired, nil
+}
+
+// txRemoveUID removes the UID and the API ID if it points to the UID.
+// Connected clients are told the message was expunged.
+func (storeMailbox *Mailbox) txRemoveUID(tx storage.Tx, uid uint32, apiID string) error {
+	imapBucket := storeMailbox.txGetIMAPIDsBucket(tx)
+	apiBucket := storeMailbox.txGetAPIIDsBucket(tx)
+	uidb := itob(uid)
+	apiIDb := []byte(apiID)
+
+	if bytes.Equal(imapBucket.Get(uidb), apiIDb) {
+		seqNum, err := storeMailbox.txGetSequenceNumberOfUID(imapBucket, uidb)
+		if err == nil {
+			storeMailbox.store.imapDeleteMessage(storeMailbox.storeAddress.address, storeMailbox.labelName, seqNum)
+		}
+		if err := imapBucket.Delete(uidb); err != nil {
+			return errors.Wrap(err, "cannot delete from IMAP bucket")
+		}
+	}
+
+	if bytes.Equal(apiBucket.Get(apiIDb), uidb) {
+		if err := apiBucket.Delete(apiIDb); err != nil {
+			return errors.Wrap(err, "cannot delete from API bucket")
+		}
+		if err := storeMailbox.txGetSaveDatesBucket(tx).Delete(apiIDb); err != nil {
+			return errors.Wrap(err, "cannot delete from save dates bucket")
+		}
+		if err := storeMailbox.txGetDeletedFlagsBucket(tx).Delete(apiIDb); err != nil {
+			return errors.Wrap(err, "cannot delete from deleted flags bucket")
+		}
+	}
+	return nil
+}
+
+// refetchMetadata stores metadata of messages from the API again. Messages
+// which do not exist anymore are removed.
+func (store *Store) refetchMetadata(apiIDs []string) error {
+	for start := 0; start < len(apiIDs); start += integrityRefetchPageSize {
+		end := start + integrityRefetchPageSize
+		if end > len(apiIDs) {
+			end = len(apiIDs)
+		}
+		page := apiIDs[start:end]
+
+		msgs, _, err := store.client().ListMessages(store.ctx, &pmapi.MessagesFilter{
+			ID:       page,
+			PageSize: len(page),
+		})
+		if err != nil {
+			return errors.Wrap(err, "cannot fetch metadata")
+		}
+
+		found := map[string]bool{}
+		for _, msg := range msgs {
+			found[msg.ID] = true
+		}
+		missing := []string{}
+		for _, apiID := range page {
+			if !found[apiID] {
+				missing = append(missing, apiID)
+			}
+		}
+
+		if err := store.createOrUpdateMessagesEvent(msgs); err != nil {
+			return err
+		}
+		if len(missing) > 0 {
+			if err := store.deleteMessagesEvent(missing); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
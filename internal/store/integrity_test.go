@@ -0,0 +1,130 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyAndRepairIntegrity(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	msgs := []*pmapi.Message{
+		getTestMessage("msg1", "Test1", "a@pm.me", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel}),
+		getTestMessage("msg2", "Test2", "a@pm.me", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel}),
+		getTestMessage("msg3", "Test3", "a@pm.me", 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel}),
+	}
+	for _, msg := range msgs {
+		msg.AddressID = addrID1
+		require.NoError(t, m.store.createOrUpdateMessageEvent(msg))
+	}
+
+	problems, err := m.store.VerifyIntegrity()
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	inbox, err := m.store.getMailbox("INBOX")
+	require.NoError(t, err)
+
+	require.NoError(t, m.store.db.Update(func(tx storage.Tx) error {
+		if err := tx.Bucket(metadataBucket).Delete([]byte("msg2")); err != nil {
+			return err
+		}
+		if err := inbox.txGetIMAPIDsBucket(tx).Put(itob(100), []byte("msg3")); err != nil {
+			return err
+		}
+		return txWriteCounters(inbox.txGetBucket(tx).Bucket(countersBucket), mailboxCounters{total: 10})
+	}))
+
+	problems, err = m.store.VerifyIntegrity()
+	require.NoError(t, err)
+
+	kinds := map[string][]string{}
+	for _, problem := range problems {
+		kinds[problem.Mailbox] = append(kinds[problem.Mailbox], problem.Kind+" "+problem.APIID)
+	}
+	require.Equal(t, []string{IntegrityMissingMetadata + " msg2"}, kinds["All Mail"])
+	require.Equal(t, []string{
+		IntegrityMissingMetadata + " msg2",
+		IntegrityBrokenMapping + " msg3",
+		IntegrityWrongCounters + " ",
+	}, kinds["INBOX"])
+
+	msg2 := *msgs[1]
+	msg3 := *msgs[2]
+	m.client.EXPECT().ListMessages(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+		require.ElementsMatch(t, []string{"msg2", "msg3"}, filter.ID)
+		return []*pmapi.Message{&msg2, &msg3}, 2, nil
+	})
+
+	repaired, err := m.store.RepairIntegrity(problems)
+	require.NoError(t, err)
+	require.Equal(t, len(problems), repaired)
+
+	problems, err = m.store.VerifyIntegrity()
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	total, unread, _, err := inbox.GetCounts()
+	require.NoError(t, err)
+	require.Equal(t, uint(3), total)
+	require.Equal(t, uint(1), unread)
+}
+
+func TestRepairIntegrityRemovesDeletedMessages(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	msg := getTestMessage("msg1", "Test1", "a@pm.me", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg.AddressID = addrID1
+	require.NoError(t, m.store.createOrUpdateMessageEvent(msg))
+
+	require.NoError(t, m.store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(metadataBucket).Delete([]byte("msg1"))
+	}))
+
+	problems, err := m.store.VerifyIntegrity()
+	require.NoError(t, err)
+	require.Len(t, problems, 2)
+
+	m.client.EXPECT().ListMessages(gomock.Any(), gomock.Any()).Return(nil, 0, nil)
+
+	_, err = m.store.RepairIntegrity(problems)
+	require.NoError(t, err)
+
+	problems, err = m.store.VerifyIntegrity()
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	inbox, err := m.store.getMailbox("INBOX")
+	require.NoError(t, err)
+	total, _, _, err := inbox.GetCounts()
+	require.NoError(t, err)
+	require.Equal(t, uint(0), total)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+)
+
+// GetKeywords returns IMAP keywords of the message which are not supported
+// by API and therefore are stored only locally.
+func (store *Store) GetKeywords(apiID string) (keywords []string) {
+	_ = store.db.View(func(tx storage.Tx) error {
+		keywords = txGetKeywords(tx, apiID)
+		return nil
+	})
+	return
+}
+
+// AddKeyword adds the locally stored IMAP keyword to the messages.
+func (store *Store) AddKeyword(apiIDs []string, keyword string) error {
+	return store.updateKeyword(apiIDs, keyword, true)
+}
+
+// RemoveKeyword removes the locally stored IMAP keyword from the messages.
+func (store *Store) RemoveKeyword(apiIDs []string, keyword string) error {
+	return store.updateKeyword(apiIDs, keyword, false)
+}
+
+func (store *Store) updateKeyword(apiIDs []string, keyword string, add bool) error {
+	return store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(keywordsBucket)
+
+		for _, apiID := range apiIDs {
+			keywords := []string{}
+			for _, k := range txGetKeywords(tx, apiID) {
+				if k != keyword {
+					keywords = append(keywords, k)
+				}
+			}
+			if add {
+				keywords = append(keywords, keyword)
+			}
+
+			if len(keywords) == 0 {
+				if err := b.Delete([]byte(apiID)); err != nil {
+					return err
+				}
+				continue
+			}
+
+			data, err := json.Marshal(keywords)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(apiID), data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func txGetKeywords(tx storage.Tx, apiID string) (keywords []string) {
+	data := tx.Bucket(keywordsBucket).Get([]byte(apiID))
+	if data == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, &keywords); err != nil {
+		log.WithError(err).WithField("msgID", apiID).Warn("Cannot unmarshal keywords")
+		return nil
+	}
+	return keywords
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeywords(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel})
+
+	require.NoError(t, m.store.AddKeyword([]string{"msg1", "msg2"}, "$mdnsent"))
+	require.NoError(t, m.store.AddKeyword([]string{"msg1"}, "$mdnsent"))
+	require.Equal(t, []string{"$mdnsent"}, m.store.GetKeywords("msg1"))
+	require.Equal(t, []string{"$mdnsent"}, m.store.GetKeywords("msg2"))
+
+	require.NoError(t, m.store.RemoveKeyword([]string{"msg2"}, "$mdnsent"))
+	require.Nil(t, m.store.GetKeywords("msg2"))
+
+	require.NoError(t, m.store.deleteMessagesEvent([]string{"msg1"}))
+	require.Nil(t, m.store.GetKeywords("msg1"))
+}
+
+func TestSaveDate(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	before := time.Now().Add(-time.Second)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel})
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	allMail := m.store.addresses[addrID1].mailboxes[pmapi.AllMailLabel]
+
+	saveDate := allMail.getSaveDate("msg1")
+	require.False(t, saveDate.Before(before))
+	require.True(t, inbox.getSaveDate("msg1").IsZero())
+
+	// Update of the message doesn't change the save date.
+	require.NoError(t, m.store.createOrUpdateMessageEvent(getTestMessage("msg1", "Updated", addrID1, 0, []string{pmapi.AllMailLabel})))
+	require.Equal(t, saveDate, allMail.getSaveDate("msg1"))
+
+	require.NoError(t, m.store.deleteMessagesEvent([]string{"msg1"}))
+	require.True(t, allMail.getSaveDate("msg1").IsZero())
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/archive"
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// LocalArchiveOptions configures continuous archiving of messages to local
+// plaintext files.
+type LocalArchiveOptions struct {
+	Dir       string   // Archiving is disabled when empty.
+	Format    string   // One of archive.FormatMaildir or archive.FormatMBOX.
+	Mailboxes []string // IMAP names of archived mailboxes, e.g. `INBOX` or `Folders/Work`.
+}
+
+var (
+	localArchiveOptions     LocalArchiveOptions //nolint[gochecknoglobals]
+	localArchiveOptionsLock sync.RWMutex        //nolint[gochecknoglobals]
+)
+
+// SetLocalArchiveOptions sets the archiving for stores opened afterwards.
+// Each user has own folder in the archive folder.
+func SetLocalArchiveOptions(options LocalArchiveOptions) {
+	localArchiveOptionsLock.Lock()
+	defer localArchiveOptionsLock.Unlock()
+
+	localArchiveOptions = options
+}
+
+func getLocalArchiveOptions() LocalArchiveOptions {
+	localArchiveOptionsLock.RLock()
+	defer localArchiveOptionsLock.RUnlock()
+
+	return localArchiveOptions
+}
+
+func (store *Store) initLocalArchive() (err error) {
+	options := getLocalArchiveOptions()
+	if options.Dir == "" || len(options.Mailboxes) == 0 {
+		return nil
+	}
+
+	root := filepath.Join(options.Dir, filepath.Base(store.user.GetPrimaryAddress()))
+	store.localArchive, err = archive.New(root, options.Format)
+	return err
+}
+
+// VerifyLocalArchive returns the number of archived messages which are
+// missing or were changed since they were archived.
+func (store *Store) VerifyLocalArchive() (int, error) {
+	if store.localArchive == nil {
+		return 0, nil
+	}
+
+	broken, err := store.localArchive.Verify()
+	return len(broken), err
+}
+
+// shouldArchiveLocally returns whether the message is in any archived
+// mailbox. It does not check whether it was archived already.
+func (store *Store) shouldArchiveLocally(msg *pmapi.Message) bool {
+	return store.localArchive != nil && len(store.getLocalArchiveMailboxes(msg)) > 0
+}
+
+func (store *Store) getLocalArchiveMailboxes(msg *pmapi.Message) (mailboxes []string) {
+	for _, name := range getLocalArchiveOptions().Mailboxes {
+		if mailbox, err := store.getMailbox(name); err == nil && msg.HasLabelID(mailbox.labelID) {
+			mailboxes = append(mailboxes, name)
+		}
+	}
+	return
+}
+
+// archiveLocally writes the message to all archived mailboxes it is in and
+// was not written to yet. Message is built by API, so it must not be called
+// from the event loop itself.
+func (store *Store) archiveLocally(msg *pmapi.Message) {
+	store.localArchiveLock.Lock()
+	defer store.localArchiveLock.Unlock()
+
+	log := store.log.WithField("msgID", msg.ID)
+
+	var mailboxes []string
+	if err := store.db.View(func(tx storage.Tx) error {
+		b := tx.Bucket(localArchiveBucket)
+		for _, name := range store.getLocalArchiveMailboxes(msg) {
+			if mb := b.Bucket([]byte(name)); mb == nil || mb.Get([]byte(msg.ID)) == nil {
+				mailboxes = append(mailboxes, name)
+			}
+		}
+		return nil
+	}); err != nil || len(mailboxes) == 0 {
+		return
+	}
+
+	// Builder fetches the whole message into the given struct.
+	complete := *msg
+	complete.Body = ""
+	builder := message.NewBuilder(store.client(), &complete)
+	builder.EncryptedToHTML = false
+	builder.LabelNames = store.GetLabelNames(msg.LabelIDs)
+
+	// The message is built only once into the archive, which is plaintext
+	// anyway, and appended from there to all its mailboxes.
+	body, err := store.localArchive.TempFile()
+	if err != nil {
+		log.WithError(err).Warn("Cannot create file for local archive")
+		return
+	}
+	defer os.Remove(body.Name()) //nolint[errcheck]
+	defer body.Close()           //nolint[errcheck]
+
+	if _, err := builder.WriteTo(body); err != nil {
+		log.WithError(err).Warn("Cannot build message for local archive")
+		return
+	}
+
+	archived := &archive.Message{
+		ID:     msg.ID,
+		Date:   time.Unix(msg.Time, 0),
+		IsRead: msg.Unread == 0,
+		Body:   body,
+	}
+	if msg.Sender != nil {
+		archived.From = msg.Sender.Address
+	}
+
+	for _, name := range mailboxes {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			log.WithError(err).Warn("Cannot read built message for local archive")
+			return
+		}
+		if err := store.localArchive.Append(name, archived); err != nil {
+			log.WithError(err).WithField("mailbox", name).Error("Cannot write message to local archive")
+			continue
+		}
+
+		if err := store.db.Update(func(tx storage.Tx) error {
+			mb, err := tx.Bucket(localArchiveBucket).CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+			return mb.Put([]byte(msg.ID), []byte(strconv.FormatInt(time.Now().Unix(), 10)))
+		}); err != nil {
+			log.WithError(err).Warn("Cannot remember archived message")
+		}
+	}
+}
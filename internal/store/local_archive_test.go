@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/archive"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldArchiveLocally(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	SetLocalArchiveOptions(LocalArchiveOptions{
+		Dir:       filepath.Join(m.tmpDir, "archive"),
+		Format:    archive.FormatMaildir,
+		Mailboxes: []string{"INBOX", "Folders/Missing"},
+	})
+	defer SetLocalArchiveOptions(LocalArchiveOptions{})
+
+	m.user.EXPECT().GetPrimaryAddress().Return(addr1)
+	m.newStoreNoEvents(true)
+
+	require.DirExists(t, filepath.Join(m.tmpDir, "archive", addr1))
+
+	inbox := getTestMessage("inbox", "Inbox", addr1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	require.True(t, m.store.shouldArchiveLocally(inbox))
+	require.Equal(t, []string{"INBOX"}, m.store.getLocalArchiveMailboxes(inbox))
+
+	archived := getTestMessage("archived", "Archived", addr1, 1, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	require.False(t, m.store.shouldArchiveLocally(archived))
+
+	broken, err := m.store.VerifyLocalArchive()
+	require.NoError(t, err)
+	require.Equal(t, 0, broken)
+}
+
+func TestLocalArchiveDisabled(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	inbox := getTestMessage("inbox", "Inbox", addr1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	require.False(t, m.store.shouldArchiveLocally(inbox))
+}
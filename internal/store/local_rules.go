@@ -0,0 +1,156 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	bridgeEvents "github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/store/rules"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// localRuleHookTimeout is the time after which the hook is killed.
+const localRuleHookTimeout = time.Minute
+
+var (
+	localRules     []*rules.Rule //nolint[gochecknoglobals]
+	localRulesLock sync.RWMutex  //nolint[gochecknoglobals]
+)
+
+// SetLocalRules sets the rules applied to messages received by all users.
+func SetLocalRules(newRules []*rules.Rule) {
+	localRulesLock.Lock()
+	defer localRulesLock.Unlock()
+
+	localRules = newRules
+}
+
+func getLocalRules() []*rules.Rule {
+	localRulesLock.RLock()
+	defer localRulesLock.RUnlock()
+
+	return localRules
+}
+
+// shouldApplyLocalRules returns whether the new message is received mail
+// which should be checked by local rules.
+func shouldApplyLocalRules(msg *pmapi.Message) bool {
+	if len(getLocalRules()) == 0 {
+		return false
+	}
+	return isReceivedMessage(msg)
+}
+
+// isReceivedMessage returns whether the new message is received mail
+// outside of spam, i.e. not a draft, sent or imported message.
+func isReceivedMessage(msg *pmapi.Message) bool {
+	if msg.Flags&pmapi.FlagReceived == 0 || msg.IsDraft() {
+		return false
+	}
+	return !msg.HasLabelID(pmapi.SpamLabel)
+}
+
+// applyLocalRules applies actions of matching rules to the message. Changes
+// are done by API and propagated back by the event loop, so it must not be
+// called from the event loop itself.
+func (store *Store) applyLocalRules(msg *pmapi.Message, events listener.Listener) {
+	localRules := getLocalRules()
+
+	if len(msg.Header) == 0 && rules.NeedHeader(localRules) {
+		if fullMsg, err := store.client().GetMessage(store.ctx, msg.ID); err != nil {
+			store.log.WithError(err).WithField("msgID", msg.ID).Warn("Cannot get header for local rules")
+		} else {
+			// The message is shared with other event processing.
+			withHeader := *msg
+			withHeader.Header = fullMsg.Header
+			msg = &withHeader
+		}
+	}
+
+	for _, rule := range rules.Evaluate(localRules, msg) {
+		log := store.log.WithField("rule", rule.Name).WithField("msgID", msg.ID)
+		log.Debug("Applying local rule")
+
+		if rule.Label != "" {
+			if err := store.applyLocalRuleLabel(msg, rule.Label); err != nil {
+				log.WithError(err).Warn("Cannot apply label of local rule")
+			}
+		}
+
+		if rule.MarkRead && msg.Unread == 1 {
+			if err := store.client().MarkMessagesRead(store.ctx, []string{msg.ID}); err != nil {
+				log.WithError(err).Warn("Cannot mark message read by local rule")
+			}
+		}
+
+		if rule.Flag && !msg.HasLabelID(pmapi.StarredLabel) {
+			if err := store.client().LabelMessages(store.ctx, []string{msg.ID}, pmapi.StarredLabel); err != nil {
+				log.WithError(err).Warn("Cannot flag message by local rule")
+			}
+		}
+
+		if rule.Notify {
+			events.Emit(bridgeEvents.LocalRuleNotificationEvent, fmt.Sprintf("%s: %s", rule.Name, msg.Subject))
+		}
+
+		if rule.Hook != "" {
+			if err := runLocalRuleHook(rule, msg); err != nil {
+				log.WithError(err).Warn("Hook of local rule failed")
+			}
+		}
+	}
+}
+
+func (store *Store) applyLocalRuleLabel(msg *pmapi.Message, name string) error {
+	mailbox, err := store.getMailbox(name)
+	if err != nil {
+		return err
+	}
+	if mailbox.labelID == pmapi.AllMailLabel || msg.HasLabelID(mailbox.labelID) {
+		return nil
+	}
+	return store.client().LabelMessages(store.ctx, []string{msg.ID}, mailbox.labelID)
+}
+
+// runLocalRuleHook runs the executable with details about the message in
+// environment variables. Message content is not passed to the hook.
+func runLocalRuleHook(rule *rules.Rule, msg *pmapi.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), localRuleHookTimeout)
+	defer cancel()
+
+	from := ""
+	if msg.Sender != nil {
+		from = msg.Sender.Address
+	}
+
+	cmd := exec.CommandContext(ctx, rule.Hook) //nolint[gosec]
+	cmd.Env = append(os.Environ(),
+		"BRIDGE_RULE="+rule.Name,
+		"BRIDGE_MESSAGE_ID="+msg.ID,
+		"BRIDGE_MESSAGE_FROM="+from,
+		"BRIDGE_MESSAGE_SUBJECT="+msg.Subject,
+	)
+	return cmd.Run()
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"net/mail"
+	"testing"
+
+	bridgeEvents "github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/store/rules"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyLocalRules(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	SetLocalRules([]*rules.Rule{
+		{Name: "archive", Subject: "report", Label: "Archive", MarkRead: true, Flag: true},
+		{Name: "notify", From: addr1, Notify: true, Stop: true},
+		{Name: "never", From: addr1, Label: "Trash"},
+	})
+	defer SetLocalRules(nil)
+
+	msg := getTestMessage("msg1", "Weekly report", addr1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg.Flags = pmapi.FlagReceived
+	require.True(t, shouldApplyLocalRules(msg))
+
+	m.client.EXPECT().LabelMessages(gomock.Any(), []string{"msg1"}, pmapi.ArchiveLabel)
+	m.client.EXPECT().MarkMessagesRead(gomock.Any(), []string{"msg1"})
+	m.client.EXPECT().LabelMessages(gomock.Any(), []string{"msg1"}, pmapi.StarredLabel)
+	m.events.EXPECT().Emit(bridgeEvents.LocalRuleNotificationEvent, "notify: Weekly report")
+
+	m.store.applyLocalRules(msg, m.events)
+}
+
+func TestShouldNotApplyLocalRules(t *testing.T) {
+	SetLocalRules(nil)
+	received := &pmapi.Message{Flags: pmapi.FlagReceived, LabelIDs: []string{pmapi.InboxLabel}}
+	require.False(t, shouldApplyLocalRules(received))
+
+	SetLocalRules([]*rules.Rule{{Name: "any", Subject: "a", Notify: true}})
+	defer SetLocalRules(nil)
+
+	require.True(t, shouldApplyLocalRules(received))
+	require.False(t, shouldApplyLocalRules(&pmapi.Message{Flags: pmapi.FlagSent}))
+	require.False(t, shouldApplyLocalRules(&pmapi.Message{Flags: pmapi.FlagReceived, LabelIDs: []string{pmapi.SpamLabel}}))
+}
+
+func TestApplyLocalRulesFetchesHeader(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	SetLocalRules([]*rules.Rule{{Name: "list", ListID: "announce.example.com", Flag: true}})
+	defer SetLocalRules(nil)
+
+	msg := getTestMessage("msg1", "Release", addr1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg.Flags = pmapi.FlagReceived
+
+	fullMsg := getTestMessage("msg1", "Release", addr1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	fullMsg.Header = mail.Header{"List-Id": {"<announce.example.com>"}}
+
+	m.client.EXPECT().GetMessage(gomock.Any(), "msg1").Return(fullMsg, nil)
+	m.client.EXPECT().LabelMessages(gomock.Any(), []string{"msg1"}, pmapi.StarredLabel)
+
+	m.store.applyLocalRules(msg, m.events)
+}
@@ -22,9 +22,9 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/sirupsen/logrus"
-	bolt "go.etcd.io/bbolt"
 )
 
 // Mailbox is mailbox for specific address and mailbox.
@@ -41,14 +41,14 @@ type Mailbox struct {
 }
 
 func newMailbox(storeAddress *Address, labelID, labelPrefix, labelName, color string) (mb *Mailbox, err error) {
-	_ = storeAddress.store.db.Update(func(tx *bolt.Tx) error {
+	_ = storeAddress.store.db.Update(func(tx storage.Tx) error {
 		mb, err = txNewMailbox(tx, storeAddress, labelID, labelPrefix, labelName, color)
 		return err
 	})
 	return
 }
 
-func txNewMailbox(tx *bolt.Tx, storeAddress *Address, labelID, labelPrefix, labelName, color string) (*Mailbox, error) {
+func txNewMailbox(tx storage.Tx, storeAddress *Address, labelID, labelPrefix, labelName, color string) (*Mailbox, error) {
 	l := log.WithField("addrID", storeAddress.addressID).WithField("labelID", labelID)
 	mb := &Mailbox{
 		store:        storeAddress.store,
@@ -70,7 +70,7 @@ func txNewMailbox(tx *bolt.Tx, storeAddress *Address, labelID, labelPrefix, labe
 	return mb, err
 }
 
-func syncDraftsIfNecssary(tx *bolt.Tx, mb *Mailbox) { //nolint[funlen]
+func syncDraftsIfNecssary(tx storage.Tx, mb *Mailbox) { //nolint[funlen]
 	// We didn't support drafts before v1.2.6 and therefore if we now created
 	// Drafts mailbox we need to check whether counts match (drafts are synced).
 	// If not, sync them from local metadata without need to do full resync,
@@ -130,7 +130,7 @@ func syncDraftsIfNecssary(tx *bolt.Tx, mb *Mailbox) { //nolint[funlen]
 	}
 }
 
-func initMailboxBucket(tx *bolt.Tx, bucketName []byte) error {
+func initMailboxBucket(tx storage.Tx, bucketName []byte) error {
 	bucket, err := tx.Bucket(mailboxesBucket).CreateBucketIfNotExists(bucketName)
 	if err != nil {
 		return err
@@ -142,8 +142,14 @@ func initMailboxBucket(tx *bolt.Tx, bucketName []byte) error {
 	if _, err := bucket.CreateBucketIfNotExists(apiIDsBucket); err != nil {
 		return err
 	}
+	if _, err := bucket.CreateBucketIfNotExists(saveDatesBucket); err != nil {
+		return err
+	}
+	if _, err := bucket.CreateBucketIfNotExists(deletedFlagsBucket); err != nil {
+		return err
+	}
 
-	return nil
+	return initMailboxCountersBuckets(bucket)
 }
 
 // LabelID returns ID of mailbox.
@@ -194,7 +200,7 @@ func (storeMailbox *Mailbox) Rename(newName string) error {
 			return fmt.Errorf("cannot rename folder to non-folder")
 		}
 
-		newName = strings.TrimPrefix(newName, UserFoldersPrefix)
+		return storeMailbox.renameFolder(strings.TrimPrefix(newName, UserFoldersPrefix))
 	}
 
 	if storeMailbox.IsLabel() {
@@ -203,9 +209,33 @@ func (storeMailbox *Mailbox) Rename(newName string) error {
 		}
 
 		newName = strings.TrimPrefix(newName, UserLabelsPrefix)
+		if strings.Contains(newName, PathDelimiter) {
+			return fmt.Errorf("labels cannot be nested")
+		}
 	}
 
-	return storeMailbox.storeAddress.updateMailbox(storeMailbox.labelID, newName, storeMailbox.color)
+	return storeMailbox.storeAddress.updateMailbox(storeMailbox.labelID, newName, "", storeMailbox.color)
+}
+
+// renameFolder renames the folder and moves it under the parent folder
+// given by the new path. Missing parent folders are created.
+func (storeMailbox *Mailbox) renameFolder(newPath string) error {
+	parentPath, newName := splitFolderPath(newPath)
+	if newName == "" {
+		return fmt.Errorf("folder name cannot be empty")
+	}
+
+	oldPath := strings.TrimPrefix(storeMailbox.labelName, UserFoldersPrefix)
+	if parentPath == oldPath || strings.HasPrefix(parentPath, oldPath+PathDelimiter) {
+		return fmt.Errorf("cannot move folder into itself")
+	}
+
+	parentID, err := storeMailbox.store.getOrCreateFolderID(parentPath, storeMailbox.color)
+	if err != nil {
+		return err
+	}
+
+	return storeMailbox.storeAddress.updateMailbox(storeMailbox.labelID, newName, parentID, storeMailbox.color)
 }
 
 // Delete deletes the mailbox by calling an API.
@@ -223,23 +253,35 @@ func (storeMailbox *Mailbox) GetDelimiter() string {
 // deleteMailboxEvent deletes the mailbox bucket.
 // This is called from the event loop.
 func (storeMailbox *Mailbox) deleteMailboxEvent() error {
-	return storeMailbox.db().Update(func(tx *bolt.Tx) error {
+	return storeMailbox.db().Update(func(tx storage.Tx) error {
 		return tx.Bucket(mailboxesBucket).DeleteBucket(storeMailbox.getBucketName())
 	})
 }
 
 // txGetIMAPIDsBucket returns the bucket mapping IMAP ID to API ID.
-func (storeMailbox *Mailbox) txGetIMAPIDsBucket(tx *bolt.Tx) *bolt.Bucket {
+func (storeMailbox *Mailbox) txGetIMAPIDsBucket(tx storage.Tx) storage.Bucket {
 	return storeMailbox.txGetBucket(tx).Bucket(imapIDsBucket)
 }
 
 // txGetAPIIDsBucket returns the bucket mapping API ID to IMAP ID.
-func (storeMailbox *Mailbox) txGetAPIIDsBucket(tx *bolt.Tx) *bolt.Bucket {
+func (storeMailbox *Mailbox) txGetAPIIDsBucket(tx storage.Tx) storage.Bucket {
 	return storeMailbox.txGetBucket(tx).Bucket(apiIDsBucket)
 }
 
+// txGetSaveDatesBucket returns the bucket mapping API ID to the time when
+// the message was added to the mailbox.
+func (storeMailbox *Mailbox) txGetSaveDatesBucket(tx storage.Tx) storage.Bucket {
+	return storeMailbox.txGetBucket(tx).Bucket(saveDatesBucket)
+}
+
+// txGetDeletedFlagsBucket returns the bucket of messages with the \Deleted
+// flag in the mailbox.
+func (storeMailbox *Mailbox) txGetDeletedFlagsBucket(tx storage.Tx) storage.Bucket {
+	return storeMailbox.txGetBucket(tx).Bucket(deletedFlagsBucket)
+}
+
 // txGetBucket returns the bucket of mailbox containing mapping buckets.
-func (storeMailbox *Mailbox) txGetBucket(tx *bolt.Tx) *bolt.Bucket {
+func (storeMailbox *Mailbox) txGetBucket(tx storage.Tx) storage.Bucket {
 	return tx.Bucket(mailboxesBucket).Bucket(storeMailbox.getBucketName())
 }
 
@@ -263,6 +305,6 @@ func (storeMailbox *Mailbox) client() pmapi.Client {
 }
 
 // update is a proxy for the store's db's `Update`.
-func (storeMailbox *Mailbox) db() *bolt.DB {
+func (storeMailbox *Mailbox) db() storage.DB {
 	return storeMailbox.store.db
 }
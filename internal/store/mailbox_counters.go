@@ -0,0 +1,213 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// Counters of the mailbox are kept up to date with every change of messages
+// in the mailbox, so STATUS and SELECT do not need to read the metadata of
+// all messages. Unread and recent IDs are kept to know whether the counter
+// has to change when an already stored message is updated.
+const (
+	counterTotalKey  = "total"
+	counterUnreadKey = "unread"
+	counterRecentKey = "recent"
+)
+
+// mailboxCounters are counts of messages in the mailbox. Recent messages are
+// those which were not opened yet, see `\Recent` flag in IMAP.
+type mailboxCounters struct {
+	total, unread, recent uint
+}
+
+func isMessageUnread(msg *pmapi.Message) bool {
+	return msg.Unread == 1
+}
+
+func isMessageRecent(msg *pmapi.Message) bool {
+	return !msg.Has(pmapi.FlagOpened)
+}
+
+// txGetCounters returns the stored counters of the mailbox.
+func (storeMailbox *Mailbox) txGetCounters(tx storage.Tx) mailboxCounters {
+	return txReadCounters(storeMailbox.txGetBucket(tx).Bucket(countersBucket))
+}
+
+func txReadCounters(b storage.Bucket) (counters mailboxCounters) {
+	if raw := b.Get([]byte(counterTotalKey)); raw != nil {
+		counters.total = uint(btoi(raw))
+	}
+	if raw := b.Get([]byte(counterUnreadKey)); raw != nil {
+		counters.unread = uint(btoi(raw))
+	}
+	if raw := b.Get([]byte(counterRecentKey)); raw != nil {
+		counters.recent = uint(btoi(raw))
+	}
+	return
+}
+
+func txWriteCounters(b storage.Bucket, counters mailboxCounters) error {
+	if err := b.Put([]byte(counterTotalKey), itob(uint32(counters.total))); err != nil {
+		return err
+	}
+	if err := b.Put([]byte(counterUnreadKey), itob(uint32(counters.unread))); err != nil {
+		return err
+	}
+	return b.Put([]byte(counterRecentKey), itob(uint32(counters.recent)))
+}
+
+// txCountMessage updates counters by the message which was added to the
+// mailbox (isNew) or which is already in the mailbox and was updated.
+func (storeMailbox *Mailbox) txCountMessage(tx storage.Tx, msg *pmapi.Message, isNew bool) error {
+	mbBucket := storeMailbox.txGetBucket(tx)
+	counters := txReadCounters(mbBucket.Bucket(countersBucket))
+
+	if isNew {
+		counters.total++
+	}
+
+	var err error
+	if counters.unread, err = txUpdateIDSet(mbBucket.Bucket(unreadIDsBucket), msg.ID, isMessageUnread(msg), counters.unread); err != nil {
+		return errors.Wrap(err, "cannot update unread IDs")
+	}
+	if counters.recent, err = txUpdateIDSet(mbBucket.Bucket(recentIDsBucket), msg.ID, isMessageRecent(msg), counters.recent); err != nil {
+		return errors.Wrap(err, "cannot update recent IDs")
+	}
+
+	return txWriteCounters(mbBucket.Bucket(countersBucket), counters)
+}
+
+// txUncountMessage updates counters by the message removed from the mailbox.
+func (storeMailbox *Mailbox) txUncountMessage(tx storage.Tx, apiID string) error {
+	mbBucket := storeMailbox.txGetBucket(tx)
+	counters := txReadCounters(mbBucket.Bucket(countersBucket))
+
+	if counters.total > 0 {
+		counters.total--
+	}
+
+	var err error
+	if counters.unread, err = txUpdateIDSet(mbBucket.Bucket(unreadIDsBucket), apiID, false, counters.unread); err != nil {
+		return errors.Wrap(err, "cannot update unread IDs")
+	}
+	if counters.recent, err = txUpdateIDSet(mbBucket.Bucket(recentIDsBucket), apiID, false, counters.recent); err != nil {
+		return errors.Wrap(err, "cannot update recent IDs")
+	}
+
+	return txWriteCounters(mbBucket.Bucket(countersBucket), counters)
+}
+
+// txUpdateIDSet adds or removes the ID from the set and returns the count
+// of the set changed accordingly.
+func txUpdateIDSet(b storage.Bucket, apiID string, isMember bool, count uint) (uint, error) {
+	wasMember := b.Get([]byte(apiID)) != nil
+
+	switch {
+	case isMember && !wasMember:
+		return count + 1, b.Put([]byte(apiID), []byte{})
+	case !isMember && wasMember:
+		if count > 0 {
+			count--
+		}
+		return count, b.Delete([]byte(apiID))
+	}
+
+	return count, nil
+}
+
+// txGetFirstUnreadSeqNum returns the sequence number of the first unread
+// message. It reads only IDs up to the first unread message.
+func (storeMailbox *Mailbox) txGetFirstUnreadSeqNum(tx storage.Tx) (seqNum uint) {
+	mbBucket := storeMailbox.txGetBucket(tx)
+	unreadBucket := mbBucket.Bucket(unreadIDsBucket)
+
+	c := mbBucket.Bucket(imapIDsBucket).Cursor()
+	for imapID, apiID := c.First(); imapID != nil; imapID, apiID = c.Next() {
+		seqNum++
+		if unreadBucket.Get(apiID) != nil {
+			return seqNum
+		}
+	}
+
+	return 0
+}
+
+// txRebuildMailboxCounters counts all messages of the mailbox bucket from
+// their metadata. It is needed only for mailboxes created before counters.
+func txRebuildMailboxCounters(metaBucket, mbBucket storage.Bucket) error {
+	for _, name := range [][]byte{unreadIDsBucket, recentIDsBucket, countersBucket} {
+		if err := mbBucket.DeleteBucket(name); err != nil && err != storage.ErrBucketNotFound {
+			return err
+		}
+	}
+
+	if err := initMailboxCountersBuckets(mbBucket); err != nil {
+		return err
+	}
+
+	unreadBucket := mbBucket.Bucket(unreadIDsBucket)
+	recentBucket := mbBucket.Bucket(recentIDsBucket)
+	counters := mailboxCounters{}
+
+	err := mbBucket.Bucket(imapIDsBucket).ForEach(func(imapID, apiID []byte) error {
+		counters.total++
+
+		rawMsg := metaBucket.Get(apiID)
+		if rawMsg == nil {
+			return nil
+		}
+
+		msg := &pmapi.Message{}
+		if err := json.Unmarshal(rawMsg, msg); err != nil {
+			return err
+		}
+		if isMessageUnread(msg) {
+			counters.unread++
+			if err := unreadBucket.Put(apiID, []byte{}); err != nil {
+				return err
+			}
+		}
+		if isMessageRecent(msg) {
+			counters.recent++
+			if err := recentBucket.Put(apiID, []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return txWriteCounters(mbBucket.Bucket(countersBucket), counters)
+}
+
+func initMailboxCountersBuckets(mbBucket storage.Bucket) error {
+	for _, name := range [][]byte{unreadIDsBucket, recentIDsBucket, countersBucket} {
+		if _, err := mbBucket.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
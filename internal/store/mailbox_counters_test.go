@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func requireCounts(t *testing.T, mailbox *Mailbox, wantTotal, wantUnread, wantUnseenSeqNum, wantRecent uint) {
+	total, unread, unseenSeqNum, err := mailbox.GetCounts()
+	require.NoError(t, err)
+	require.Equal(t, wantTotal, total, "total")
+	require.Equal(t, wantUnread, unread, "unread")
+	require.Equal(t, wantUnseenSeqNum, unseenSeqNum, "unseen sequence number")
+
+	recent, err := mailbox.GetRecentCount()
+	require.NoError(t, err)
+	require.Equal(t, wantRecent, recent, "recent")
+}
+
+func TestMailboxCountersFollowChanges(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	requireCounts(t, inbox, 3, 2, 2, 3)
+
+	// Updating the same state again does not count the message twice.
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	requireCounts(t, inbox, 3, 2, 2, 3)
+
+	opened := getTestMessage("msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	opened.Flags = pmapi.FlagOpened
+	require.NoError(t, m.store.createOrUpdateMessageEvent(opened))
+	requireCounts(t, inbox, 3, 1, 3, 2)
+
+	// Moving the message out of the mailbox removes it from counters.
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	requireCounts(t, inbox, 2, 0, 0, 1)
+
+	require.NoError(t, m.store.deleteMessagesEvent([]string{"msg1"}))
+	requireCounts(t, inbox, 1, 0, 0, 0)
+}
+
+func TestMigrateSchemaToV2CountsMessages(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	// Mailbox as created before counters were introduced.
+	require.NoError(t, m.store.db.Update(func(tx storage.Tx) error {
+		mbBucket := inbox.txGetBucket(tx)
+		for _, name := range [][]byte{unreadIDsBucket, recentIDsBucket, countersBucket} {
+			if err := mbBucket.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return migrateSchemaToV2(tx)
+	}))
+
+	requireCounts(t, inbox, 2, 1, 2, 2)
+}
@@ -18,49 +18,40 @@
 package store
 
 import (
-	"bytes"
 	"encoding/json"
 	"sort"
 
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
-	bolt "go.etcd.io/bbolt"
 )
 
 // GetCounts returns numbers of total and unread messages in this mailbox bucket.
 func (storeMailbox *Mailbox) GetCounts() (total, unread, unseenSeqNum uint, err error) {
-	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+	err = storeMailbox.db().View(func(tx storage.Tx) error {
 		total, unread, unseenSeqNum, err = storeMailbox.txGetCounts(tx)
 		return err
 	})
 	return
 }
 
-func (storeMailbox *Mailbox) txGetCounts(tx *bolt.Tx) (total, unread, unseenSeqNum uint, err error) {
-	// For total it would be enough to use `bolt.Bucket.Stats().KeyN` but
-	// we also need to retrieve the count of unread emails therefore we are
-	// looping all messages in this mailbox by `bolt.Cursor`
-	metaBucket := tx.Bucket(metadataBucket)
-	b := storeMailbox.txGetIMAPIDsBucket(tx)
-	c := b.Cursor()
-	imapID, apiID := c.First()
-	for ; imapID != nil; imapID, apiID = c.Next() {
-		total++
-		rawMsg := metaBucket.Get(apiID)
-		if rawMsg == nil {
-			return 0, 0, 0, ErrNoSuchAPIID
-		}
-		// Do not unmarshal whole JSON to speed up the looping.
-		// Instead, we assume it will contain JSON int field `Unread`
-		// where `1` means true (i.e. message is unread)
-		if bytes.Contains(rawMsg, []byte(`"Unread":1`)) {
-			if unseenSeqNum == 0 {
-				unseenSeqNum = total
-			}
-			unread++
-		}
+func (storeMailbox *Mailbox) txGetCounts(tx storage.Tx) (total, unread, unseenSeqNum uint, err error) {
+	// Counters are updated with every change, see mailbox_counters.go.
+	counters := storeMailbox.txGetCounters(tx)
+	if counters.unread > 0 {
+		unseenSeqNum = storeMailbox.txGetFirstUnreadSeqNum(tx)
 	}
-	return total, unread, unseenSeqNum, err
+	return counters.total, counters.unread, unseenSeqNum, nil
+}
+
+// GetRecentCount returns the number of messages in the mailbox which were
+// not opened yet.
+func (storeMailbox *Mailbox) GetRecentCount() (recent uint, err error) {
+	err = storeMailbox.db().View(func(tx storage.Tx) error {
+		recent = storeMailbox.txGetCounters(tx).recent
+		return nil
+	})
+	return
 }
 
 type mailboxCounts struct {
@@ -71,9 +62,10 @@ type mailboxCounts struct {
 	IsFolder    bool
 	TotalOnAPI  uint
 	UnreadOnAPI uint
+	ParentID    string `json:",omitempty"`
 }
 
-func txGetCountsFromBucketOrNew(bkt *bolt.Bucket, labelID string) (*mailboxCounts, error) {
+func txGetCountsFromBucketOrNew(bkt storage.Bucket, labelID string) (*mailboxCounts, error) {
 	mc := &mailboxCounts{}
 	if mcJSON := bkt.Get([]byte(labelID)); mcJSON != nil {
 		if err := json.Unmarshal(mcJSON, mc); err != nil {
@@ -85,7 +77,7 @@ func txGetCountsFromBucketOrNew(bkt *bolt.Bucket, labelID string) (*mailboxCount
 	return mc, nil
 }
 
-func (mc *mailboxCounts) txWriteToBucket(bucket *bolt.Bucket) error {
+func (mc *mailboxCounts) txWriteToBucket(bucket storage.Bucket) error {
 	mcJSON, err := json.Marshal(mc)
 	if err != nil {
 		return err
@@ -95,13 +87,13 @@ func (mc *mailboxCounts) txWriteToBucket(bucket *bolt.Bucket) error {
 
 func getSystemFolders() []*mailboxCounts {
 	return []*mailboxCounts{
-		{pmapi.InboxLabel, "INBOX", "#000", -1000, true, 0, 0},
-		{pmapi.SentLabel, "Sent", "#000", -9, true, 0, 0},
-		{pmapi.ArchiveLabel, "Archive", "#000", -8, true, 0, 0},
-		{pmapi.SpamLabel, "Spam", "#000", -7, true, 0, 0},
-		{pmapi.TrashLabel, "Trash", "#000", -6, true, 0, 0},
-		{pmapi.AllMailLabel, "All Mail", "#000", -5, true, 0, 0},
-		{pmapi.DraftLabel, "Drafts", "#000", -4, true, 0, 0},
+		{pmapi.InboxLabel, "INBOX", "#000", -1000, true, 0, 0, ""},
+		{pmapi.SentLabel, "Sent", "#000", -9, true, 0, 0, ""},
+		{pmapi.ArchiveLabel, "Archive", "#000", -8, true, 0, 0, ""},
+		{pmapi.SpamLabel, "Spam", "#000", -7, true, 0, 0, ""},
+		{pmapi.TrashLabel, "Trash", "#000", -6, true, 0, 0, ""},
+		{pmapi.AllMailLabel, "All Mail", "#000", -5, true, 0, 0, ""},
+		{pmapi.DraftLabel, "Drafts", "#000", -4, true, 0, 0, ""},
 	}
 }
 
@@ -129,6 +121,7 @@ func (mc *mailboxCounts) getPMLabel() *pmapi.Label {
 		Order:     mc.Order,
 		Type:      pmapi.LabelTypeMailbox,
 		Exclusive: mc.isExclusive(),
+		ParentID:  mc.ParentID,
 	}
 }
 
@@ -143,7 +136,7 @@ func (mc *mailboxCounts) isExclusive() int {
 func (store *Store) createOrUpdateMailboxCountsBuckets(labels []*pmapi.Label) error {
 	// Don't forget about system folders.
 	// It should set label id, name, color, isFolder, total, unread.
-	tx := func(tx *bolt.Tx) error {
+	tx := func(tx storage.Tx) error {
 		countsBkt := tx.Bucket(countsBucket)
 		for _, label := range labels {
 			// Skipping is probably not necessary.
@@ -162,6 +155,7 @@ func (store *Store) createOrUpdateMailboxCountsBuckets(labels []*pmapi.Label) er
 			mailbox.Color = label.Color
 			mailbox.Order = label.Order
 			mailbox.IsFolder = label.Exclusive == 1
+			mailbox.ParentID = label.ParentID
 
 			// Write.
 			if err = mailbox.txWriteToBucket(countsBkt); err != nil {
@@ -189,14 +183,14 @@ func (store *Store) getLabelsFromLocalStorage() ([]*pmapi.Label, error) {
 }
 
 func (store *Store) getOnAPICounts() (counts []*mailboxCounts, err error) {
-	err = store.db.View(func(tx *bolt.Tx) error {
+	err = store.db.View(func(tx storage.Tx) error {
 		counts, err = store.txGetOnAPICounts(tx)
 		return err
 	})
 	return
 }
 
-func (store *Store) txGetOnAPICounts(tx *bolt.Tx) ([]*mailboxCounts, error) {
+func (store *Store) txGetOnAPICounts(tx storage.Tx) ([]*mailboxCounts, error) {
 	counts := []*mailboxCounts{}
 	c := tx.Bucket(countsBucket).Cursor()
 	for k, countsB := c.First(); k != nil; k, countsB = c.Next() {
@@ -222,7 +216,7 @@ func (store *Store) txGetOnAPICounts(tx *bolt.Tx) ([]*mailboxCounts, error) {
 func (store *Store) createOrUpdateOnAPICounts(mailboxCountsOnAPI []*pmapi.MessagesCount) error {
 	store.log.Debug("Updating API counts")
 
-	tx := func(tx *bolt.Tx) error {
+	tx := func(tx storage.Tx) error {
 		countsBkt := tx.Bucket(countsBucket)
 		for _, countsOnAPI := range mailboxCountsOnAPI {
 			if skipThisLabel(countsOnAPI.LabelID) {
@@ -251,7 +245,7 @@ func (store *Store) createOrUpdateOnAPICounts(mailboxCountsOnAPI []*pmapi.Messag
 }
 
 func (store *Store) removeMailboxCount(labelID string) error {
-	err := store.db.Update(func(tx *bolt.Tx) error {
+	err := store.db.Update(func(tx storage.Tx) error {
 		return tx.Bucket(countsBucket).Delete([]byte(labelID))
 	})
 	if err != nil {
@@ -0,0 +1,139 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	imap "github.com/emersion/go-imap"
+)
+
+// MarkMessagesDeleted sets the IMAP \Deleted flag of messages in this
+// mailbox. The flag is stored only locally and messages are deleted once
+// they are expunged.
+func (storeMailbox *Mailbox) MarkMessagesDeleted(apiIDs []string) error {
+	return storeMailbox.updateDeletedFlags(apiIDs, true)
+}
+
+// MarkMessagesUndeleted removes the IMAP \Deleted flag of messages in this
+// mailbox.
+func (storeMailbox *Mailbox) MarkMessagesUndeleted(apiIDs []string) error {
+	return storeMailbox.updateDeletedFlags(apiIDs, false)
+}
+
+func (storeMailbox *Mailbox) updateDeletedFlags(apiIDs []string, deleted bool) error {
+	return storeMailbox.db().Update(func(tx storage.Tx) error {
+		deletedBucket := storeMailbox.txGetDeletedFlagsBucket(tx)
+		apiBucket := storeMailbox.txGetAPIIDsBucket(tx)
+		imapBucket := storeMailbox.txGetIMAPIDsBucket(tx)
+
+		for _, apiID := range apiIDs {
+			uidb := apiBucket.Get([]byte(apiID))
+			if uidb == nil || (deletedBucket.Get([]byte(apiID)) != nil) == deleted {
+				continue
+			}
+
+			var err error
+			if deleted {
+				err = deletedBucket.Put([]byte(apiID), []byte{})
+			} else {
+				err = deletedBucket.Delete([]byte(apiID))
+			}
+			if err != nil {
+				return err
+			}
+
+			msg, err := storeMailbox.store.txGetMessage(tx, apiID)
+			if err != nil {
+				return err
+			}
+			seqNum, err := storeMailbox.txGetSequenceNumberOfUID(imapBucket, uidb)
+			if err != nil {
+				return err
+			}
+			storeMailbox.store.imapUpdateMessage(
+				storeMailbox.storeAddress.address,
+				storeMailbox.labelName,
+				btoi(uidb),
+				seqNum,
+				msg,
+				storeMailbox.txGetLocalFlags(tx, apiID),
+			)
+		}
+
+		return nil
+	})
+}
+
+// ExpungeMessages deletes those of the messages which have the \Deleted flag
+// in this mailbox. When apiIDs is nil, all such messages are deleted.
+func (storeMailbox *Mailbox) ExpungeMessages(apiIDs []string) error {
+	var toDelete []string
+	err := storeMailbox.db().View(func(tx storage.Tx) error {
+		deletedBucket := storeMailbox.txGetDeletedFlagsBucket(tx)
+		if apiIDs == nil {
+			return deletedBucket.ForEach(func(apiID, _ []byte) error {
+				toDelete = append(toDelete, string(apiID))
+				return nil
+			})
+		}
+		for _, apiID := range apiIDs {
+			if deletedBucket.Get([]byte(apiID)) != nil {
+				toDelete = append(toDelete, apiID)
+			}
+		}
+		return nil
+	})
+	if err != nil || len(toDelete) == 0 {
+		return err
+	}
+
+	if err := storeMailbox.DeleteMessages(toDelete); err != nil {
+		return err
+	}
+
+	// Messages may stay in the mailbox, e.g. in All Mail.
+	return storeMailbox.db().Update(func(tx storage.Tx) error {
+		deletedBucket := storeMailbox.txGetDeletedFlagsBucket(tx)
+		for _, apiID := range toDelete {
+			if err := deletedBucket.Delete([]byte(apiID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// isMarkedDeleted returns whether the message has the \Deleted flag in this
+// mailbox.
+func (storeMailbox *Mailbox) isMarkedDeleted(apiID string) (deleted bool) {
+	_ = storeMailbox.db().View(func(tx storage.Tx) error {
+		deleted = storeMailbox.txGetDeletedFlagsBucket(tx).Get([]byte(apiID)) != nil
+		return nil
+	})
+	return
+}
+
+// txGetLocalFlags returns keywords and flags of the message which are stored
+// only locally.
+func (storeMailbox *Mailbox) txGetLocalFlags(tx storage.Tx, apiID string) []string {
+	flags := txGetKeywords(tx, apiID)
+	if storeMailbox.txGetDeletedFlagsBucket(tx).Get([]byte(apiID)) != nil {
+		flags = append(flags, imap.DeletedFlag)
+	}
+	return flags
+}
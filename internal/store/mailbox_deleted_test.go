@@ -0,0 +1,63 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpungeMessages(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	allMail := m.store.addresses[addrID1].mailboxes[pmapi.AllMailLabel]
+
+	require.NoError(t, inbox.MarkMessagesDeleted([]string{"msg1", "msg2", "msg3"}))
+	require.NoError(t, inbox.MarkMessagesUndeleted([]string{"msg3"}))
+	require.True(t, inbox.isMarkedDeleted("msg1"))
+	require.False(t, inbox.isMarkedDeleted("msg3"))
+	require.False(t, allMail.isMarkedDeleted("msg1"), "flag is per mailbox")
+
+	// Only flagged messages in the set are expunged.
+	m.client.EXPECT().UnlabelMessages(gomock.Any(), []string{"msg1"}, pmapi.InboxLabel)
+	require.NoError(t, inbox.ExpungeMessages([]string{"msg1", "msg3"}))
+	require.False(t, inbox.isMarkedDeleted("msg1"))
+	require.True(t, inbox.isMarkedDeleted("msg2"))
+
+	m.client.EXPECT().UnlabelMessages(gomock.Any(), []string{"msg2"}, pmapi.InboxLabel)
+	require.NoError(t, inbox.ExpungeMessages(nil))
+	require.False(t, inbox.isMarkedDeleted("msg2"))
+
+	// Nothing is flagged anymore.
+	require.NoError(t, inbox.ExpungeMessages(nil))
+
+	// Flag is removed together with the message.
+	require.NoError(t, inbox.MarkMessagesDeleted([]string{"msg3"}))
+	require.NoError(t, m.store.deleteMessagesEvent([]string{"msg3"}))
+	require.False(t, inbox.isMarkedDeleted("msg3"))
+}
@@ -25,8 +25,8 @@ import (
 	"strings"
 
 	"github.com/ProtonMail/proton-bridge/internal/imap/uidplus"
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/pkg/errors"
-	bolt "go.etcd.io/bbolt"
 )
 
 // GetAPIIDsFromUIDRange returns API IDs by IMAP UID range.
@@ -34,7 +34,7 @@ import (
 // API IDs are the long base64 strings that the API uses to identify messages.
 // UIDs are unique increasing integers that must be unique within a mailbox.
 func (storeMailbox *Mailbox) GetAPIIDsFromUIDRange(start, stop uint32) (apiIDs []string, err error) {
-	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+	err = storeMailbox.db().View(func(tx storage.Tx) error {
 		b := storeMailbox.txGetIMAPIDsBucket(tx)
 
 		if stop == 0 {
@@ -57,7 +57,7 @@ func (storeMailbox *Mailbox) GetAPIIDsFromUIDRange(start, stop uint32) (apiIDs [
 
 // GetAPIIDsFromSequenceRange returns API IDs by IMAP sequence number range.
 func (storeMailbox *Mailbox) GetAPIIDsFromSequenceRange(start, stop uint32) (apiIDs []string, err error) {
-	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+	err = storeMailbox.db().View(func(tx storage.Tx) error {
 		b := storeMailbox.txGetIMAPIDsBucket(tx)
 		c := b.Cursor()
 		var i uint32
@@ -79,7 +79,7 @@ func (storeMailbox *Mailbox) GetAPIIDsFromSequenceRange(start, stop uint32) (api
 // GetLatestAPIID returns the latest message API ID which still exists.
 // Info: not the latest IMAP UID which can be already removed.
 func (storeMailbox *Mailbox) GetLatestAPIID() (apiID string, err error) {
-	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+	err = storeMailbox.db().View(func(tx storage.Tx) error {
 		b := storeMailbox.txGetAPIIDsBucket(tx)
 		c := b.Cursor()
 		lastAPIID, _ := c.Last()
@@ -94,7 +94,7 @@ func (storeMailbox *Mailbox) GetLatestAPIID() (apiID string, err error) {
 
 // GetNextUID returns the next IMAP UID.
 func (storeMailbox *Mailbox) GetNextUID() (uid uint32, err error) {
-	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+	err = storeMailbox.db().View(func(tx storage.Tx) error {
 		b := storeMailbox.txGetIMAPIDsBucket(tx)
 		uid, err = storeMailbox.txGetNextUID(b, false)
 		return err
@@ -102,7 +102,7 @@ func (storeMailbox *Mailbox) GetNextUID() (uid uint32, err error) {
 	return
 }
 
-func (storeMailbox *Mailbox) txGetNextUID(imapIDBucket *bolt.Bucket, write bool) (uint32, error) {
+func (storeMailbox *Mailbox) txGetNextUID(imapIDBucket storage.Bucket, write bool) (uint32, error) {
 	var uid uint64
 	var err error
 	if write {
@@ -121,14 +121,14 @@ func (storeMailbox *Mailbox) txGetNextUID(imapIDBucket *bolt.Bucket, write bool)
 
 // getUID returns IMAP UID in this mailbox for message ID.
 func (storeMailbox *Mailbox) getUID(apiID string) (uid uint32, err error) {
-	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+	err = storeMailbox.db().View(func(tx storage.Tx) error {
 		uid, err = storeMailbox.txGetUID(tx, apiID)
 		return err
 	})
 	return
 }
 
-func (storeMailbox *Mailbox) txGetUID(tx *bolt.Tx, apiID string) (uint32, error) {
+func (storeMailbox *Mailbox) txGetUID(tx storage.Tx, apiID string) (uint32, error) {
 	b := storeMailbox.txGetAPIIDsBucket(tx)
 	v := b.Get([]byte(apiID))
 	if v == nil {
@@ -139,7 +139,7 @@ func (storeMailbox *Mailbox) txGetUID(tx *bolt.Tx, apiID string) (uint32, error)
 
 // getSequenceNumber returns IMAP sequence number in the mailbox for the message with the given API ID `apiID`.
 func (storeMailbox *Mailbox) getSequenceNumber(apiID string) (seqNum uint32, err error) {
-	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+	err = storeMailbox.db().View(func(tx storage.Tx) error {
 		b := storeMailbox.txGetIMAPIDsBucket(tx)
 		uid, err := storeMailbox.txGetUID(tx, apiID)
 		if err != nil {
@@ -154,11 +154,11 @@ func (storeMailbox *Mailbox) getSequenceNumber(apiID string) (seqNum uint32, err
 // txGetSequenceNumberOfUID returns the IMAP sequence number of the message
 // with the given IMAP UID bytes `uidb`.
 //
-// NOTE: The `bolt.Cursor.Next()` loops in order of ascending key bytes. The
+// NOTE: The `storage.Cursor.Next()` loops in order of ascending key bytes. The
 // IMAP UID bucket is ordered by increasing UID because it's using BigEndian to
 // encode uint into byte. Hence the sequence number (IMAP ID) corresponds to
 // position of uid key in this order.
-func (storeMailbox *Mailbox) txGetSequenceNumberOfUID(bucket *bolt.Bucket, uidb []byte) (uint32, error) {
+func (storeMailbox *Mailbox) txGetSequenceNumberOfUID(bucket storage.Bucket, uidb []byte) (uint32, error) {
 	seqNum := uint32(0)
 	c := bucket.Cursor()
 
@@ -191,7 +191,7 @@ func (storeMailbox *Mailbox) txGetSequenceNumberOfUID(bucket *bolt.Bucket, uidb
 // GetUIDList returns UID list corresponding to messageIDs in a requested order.
 func (storeMailbox *Mailbox) GetUIDList(apiIDs []string) *uidplus.OrderedSeq {
 	seqSet := &uidplus.OrderedSeq{}
-	_ = storeMailbox.db().View(func(tx *bolt.Tx) error {
+	_ = storeMailbox.db().View(func(tx storage.Tx) error {
 		b := storeMailbox.txGetAPIIDsBucket(tx)
 		for _, apiID := range apiIDs {
 			v := b.Get([]byte(apiID))
@@ -209,6 +209,17 @@ func (storeMailbox *Mailbox) GetUIDList(apiIDs []string) *uidplus.OrderedSeq {
 	return seqSet
 }
 
+// externalIDMatcher returns regexp matching the external ID in raw JSON
+// metadata of the message. The ID must be without '<>'.
+func externalIDMatcher(externalID string) *regexp.Regexp {
+	return regexp.MustCompile(`"ExternalID":"` +
+		` *(\\u003c)? *` + // \u003c is equivalent to `<`
+		regexp.QuoteMeta(externalID) +
+		` *(\\u003e)? *` + // \u0033 is equivalent to `>`
+		`"`,
+	)
+}
+
 // GetUIDByHeader returns UID of message existing in mailbox or zero if no match found.
 func (storeMailbox *Mailbox) GetUIDByHeader(header *mail.Header) (foundUID uint32) {
 	if header == nil {
@@ -227,19 +238,14 @@ func (storeMailbox *Mailbox) GetUIDByHeader(header *mail.Header) (foundUID uint3
 	// The most often situation is that message is APPENDed after it was sent so the
 	// Message-ID will be reflected by ExternalID in API message meta-data.
 	externalID := strings.Trim(messageID, "<> ") // remove '<>' to improve match
-	matchExternalID := regexp.MustCompile(`"ExternalID":"` +
-		` *(\\u003c)? *` + // \u003c is equivalent to `<`
-		regexp.QuoteMeta(externalID) +
-		` *(\\u003e)? *` + // \u0033 is equivalent to `>`
-		`"`,
-	)
+	matchExternalID := externalIDMatcher(externalID)
 
 	// It is possible that client will try to COPY existing message to Sent
 	// using APPEND command. In that case the Message-Id from header will
 	// be internal message ID and we need to check whether it's already there.
 	matchInternalID := bytes.Split([]byte(externalID), []byte("@"))[0]
 
-	_ = storeMailbox.db().View(func(tx *bolt.Tx) error {
+	_ = storeMailbox.db().View(func(tx storage.Tx) error {
 		metaBucket := tx.Bucket(metadataBucket)
 		b := storeMailbox.txGetIMAPIDsBucket(tx)
 		c := b.Cursor()
@@ -0,0 +1,72 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+)
+
+// Modes of presenting mailboxes over IMAP. The store keeps mailboxes the
+// same way in all modes, only IMAP names are mapped differently.
+const (
+	// MailboxMappingFolders lists folders under `Folders/` and labels under `Labels/`.
+	MailboxMappingFolders = "folders"
+	// MailboxMappingGmail hides labels which are keywords of messages instead.
+	MailboxMappingGmail = "gmail"
+	// MailboxMappingFlat lists folders and labels without prefixes.
+	MailboxMappingFlat = "flat"
+)
+
+// MailboxMappings lists all supported modes of mailbox mapping.
+var MailboxMappings = []string{MailboxMappingFolders, MailboxMappingGmail, MailboxMappingFlat} //nolint[gochecknoglobals]
+
+// GetMailboxMapping returns how mailboxes are presented over IMAP.
+func (store *Store) GetMailboxMapping() (mode string) {
+	mode = MailboxMappingFolders
+	_ = store.db.View(func(tx storage.Tx) error {
+		if dbMode := tx.Bucket(mailboxMappingBucket).Get([]byte(modeKey)); dbMode != nil {
+			mode = string(dbMode)
+		}
+		return nil
+	})
+	return
+}
+
+// SetMailboxMapping sets how mailboxes are presented over IMAP. Clients
+// have to reconnect to see mailboxes in the new mode.
+func (store *Store) SetMailboxMapping(mode string) error {
+	if !isMailboxMapping(mode) {
+		return fmt.Errorf("unknown mailbox mapping %q, use one of: %v", mode, strings.Join(MailboxMappings, ", "))
+	}
+
+	return store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(mailboxMappingBucket).Put([]byte(modeKey), []byte(mode))
+	})
+}
+
+func isMailboxMapping(mode string) bool {
+	for _, supported := range MailboxMappings {
+		if mode == supported {
+			return true
+		}
+	}
+	return false
+}
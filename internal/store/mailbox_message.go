@@ -18,10 +18,15 @@
 package store
 
 import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/ProtonMail/proton-bridge/pkg/tracing"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	bolt "go.etcd.io/bbolt"
 )
 
 var ErrAllMailOpNotAllowed = errors.New("operation not allowed for 'All Mail' folder")
@@ -37,10 +42,14 @@ func (storeMailbox *Mailbox) GetMessage(apiID string) (*Message, error) {
 }
 
 // FetchMessage fetches the message with the given `apiID`, stores it in the database, and returns a new store message
-// wrapping it.
-func (storeMailbox *Mailbox) FetchMessage(apiID string) (*Message, error) {
-	msg, err := storeMailbox.client().GetMessage(apiID)
+// wrapping it. The request is cancelled when ctx is done.
+func (storeMailbox *Mailbox) FetchMessage(ctx context.Context, apiID string) (*Message, error) {
+	l := tracing.Logger(ctx, storeMailbox.log).WithField("messageID", apiID)
+	l.Debug("Fetching message")
+
+	msg, err := storeMailbox.client().GetMessage(ctx, apiID)
 	if err != nil {
+		l.WithError(err).Debug("Cannot fetch message")
 		return nil, err
 	}
 	return newStoreMessage(storeMailbox, msg), nil
@@ -64,7 +73,7 @@ func (storeMailbox *Mailbox) ImportMessage(msg *pmapi.Message, body []byte, labe
 		LabelIDs:  labelIDs,
 	}
 
-	res, err := storeMailbox.client().Import([]*pmapi.ImportMsgReq{importReqs})
+	res, err := storeMailbox.client().Import(storeMailbox.store.ctx, []*pmapi.ImportMsgReq{importReqs})
 	if err == nil && len(res) > 0 {
 		msg.ID = res[0].MessageID
 	}
@@ -89,7 +98,18 @@ func (storeMailbox *Mailbox) LabelMessages(apiIDs []string) error {
 		return ErrAllMailOpNotAllowed
 	}
 	defer storeMailbox.pollNow()
-	return storeMailbox.client().LabelMessages(apiIDs, storeMailbox.labelID)
+
+	var hamIDs []string
+	if storeMailbox.isHamFolder() {
+		hamIDs = storeMailbox.store.getMessageIDsInSpam(apiIDs)
+	}
+
+	if err := storeMailbox.client().LabelMessages(storeMailbox.store.ctx, apiIDs, storeMailbox.labelID); err != nil {
+		return err
+	}
+
+	storeMailbox.store.reportHam(hamIDs)
+	return nil
 }
 
 // UnlabelMessages removes the label by calling an API.
@@ -105,7 +125,28 @@ func (storeMailbox *Mailbox) UnlabelMessages(apiIDs []string) error {
 		return ErrAllMailOpNotAllowed
 	}
 	defer storeMailbox.pollNow()
-	return storeMailbox.client().UnlabelMessages(apiIDs, storeMailbox.labelID)
+
+	var hamIDs []string
+	if storeMailbox.labelID == pmapi.SpamLabel {
+		hamIDs = storeMailbox.store.getMessageIDsInSpam(apiIDs)
+	}
+
+	if err := storeMailbox.client().UnlabelMessages(storeMailbox.store.ctx, apiIDs, storeMailbox.labelID); err != nil {
+		return err
+	}
+
+	storeMailbox.store.reportHam(hamIDs)
+	return nil
+}
+
+// isHamFolder returns whether moving a message from Spam to this mailbox
+// means the user considers it not spam. Moves to Trash, for example, don't.
+func (storeMailbox *Mailbox) isHamFolder() bool {
+	switch storeMailbox.labelID {
+	case pmapi.InboxLabel, pmapi.ArchiveLabel:
+		return true
+	}
+	return storeMailbox.IsFolder()
 }
 
 // MarkMessagesRead marks the message read by calling an API.
@@ -129,7 +170,7 @@ func (storeMailbox *Mailbox) MarkMessagesRead(apiIDs []string) error {
 			ids = append(ids, apiID)
 		}
 	}
-	return storeMailbox.client().MarkMessagesRead(ids)
+	return storeMailbox.client().MarkMessagesRead(storeMailbox.store.ctx, ids)
 }
 
 // MarkMessagesUnread marks the message unread by calling an API.
@@ -141,7 +182,7 @@ func (storeMailbox *Mailbox) MarkMessagesUnread(apiIDs []string) error {
 		"mailbox":  storeMailbox.Name,
 	}).Trace("Marking messages as unread")
 	defer storeMailbox.pollNow()
-	return storeMailbox.client().MarkMessagesUnread(apiIDs)
+	return storeMailbox.client().MarkMessagesUnread(storeMailbox.store.ctx, apiIDs)
 }
 
 // MarkMessagesStarred adds the Starred label by calling an API.
@@ -154,7 +195,7 @@ func (storeMailbox *Mailbox) MarkMessagesStarred(apiIDs []string) error {
 		"mailbox":  storeMailbox.Name,
 	}).Trace("Marking messages as starred")
 	defer storeMailbox.pollNow()
-	return storeMailbox.client().LabelMessages(apiIDs, pmapi.StarredLabel)
+	return storeMailbox.client().LabelMessages(storeMailbox.store.ctx, apiIDs, pmapi.StarredLabel)
 }
 
 // MarkMessagesUnstarred removes the Starred label by calling an API.
@@ -167,13 +208,14 @@ func (storeMailbox *Mailbox) MarkMessagesUnstarred(apiIDs []string) error {
 		"mailbox":  storeMailbox.Name,
 	}).Trace("Marking messages as unstarred")
 	defer storeMailbox.pollNow()
-	return storeMailbox.client().UnlabelMessages(apiIDs, pmapi.StarredLabel)
+	return storeMailbox.client().UnlabelMessages(storeMailbox.store.ctx, apiIDs, pmapi.StarredLabel)
 }
 
 // DeleteMessages deletes messages.
 // If the mailbox is All Mail or All Sent, it does nothing.
 // If the mailbox is Trash or Spam and message is not in any other mailbox, messages is deleted.
 // In all other cases the message is only removed from the mailbox.
+// Deleted messages get tombstones, see UndeleteMessages.
 func (storeMailbox *Mailbox) DeleteMessages(apiIDs []string) error {
 	log.WithFields(logrus.Fields{
 		"messages": apiIDs,
@@ -210,28 +252,29 @@ func (storeMailbox *Mailbox) DeleteMessages(apiIDs []string) error {
 			}
 		}
 		if len(messageIDsToUnlabel) > 0 {
-			if err := storeMailbox.client().UnlabelMessages(messageIDsToUnlabel, storeMailbox.labelID); err != nil {
+			if err := storeMailbox.client().UnlabelMessages(storeMailbox.store.ctx, messageIDsToUnlabel, storeMailbox.labelID); err != nil {
 				log.WithError(err).Warning("Cannot unlabel before deleting")
 			}
 		}
 		if len(messageIDsToDelete) > 0 {
-			if err := storeMailbox.client().DeleteMessages(messageIDsToDelete); err != nil {
+			if err := storeMailbox.client().DeleteMessages(storeMailbox.store.ctx, messageIDsToDelete); err != nil {
 				return err
 			}
+			storeMailbox.store.addTombstones(messageIDsToDelete)
 		}
 	case pmapi.DraftLabel:
-		if err := storeMailbox.client().DeleteMessages(apiIDs); err != nil {
+		if err := storeMailbox.client().DeleteMessages(storeMailbox.store.ctx, apiIDs); err != nil {
 			return err
 		}
 	default:
-		if err := storeMailbox.client().UnlabelMessages(apiIDs, storeMailbox.labelID); err != nil {
+		if err := storeMailbox.client().UnlabelMessages(storeMailbox.store.ctx, apiIDs, storeMailbox.labelID); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (storeMailbox *Mailbox) txSkipAndRemoveFromMailbox(tx *bolt.Tx, msg *pmapi.Message) (skipAndRemove bool) {
+func (storeMailbox *Mailbox) txSkipAndRemoveFromMailbox(tx storage.Tx, msg *pmapi.Message) (skipAndRemove bool) {
 	defer func() {
 		if skipAndRemove {
 			if err := storeMailbox.txDeleteMessage(tx, msg.ID); err != nil {
@@ -248,11 +291,20 @@ func (storeMailbox *Mailbox) txSkipAndRemoveFromMailbox(tx *bolt.Tx, msg *pmapi.
 
 	skipAndRemove = true
 
+	if txIsExcludedFromSync(tx, storeMailbox.labelID) {
+		return
+	}
+
 	// If it's split mode and it shouldn't be under this address, it should be skipped and removed.
 	if mode == splitMode && storeMailbox.storeAddress.addressID != msg.AddressID {
 		return
 	}
 
+	// Received copy of message sent to own address is shown only once in All Mail.
+	if storeMailbox.labelID == pmapi.AllMailLabel && shouldHideSelfSentDuplicates() && storeMailbox.store.txIsSelfSentDuplicate(tx, msg) {
+		return
+	}
+
 	// If the message belongs in this mailbox, don't skip/remove it.
 	for _, labelID := range msg.LabelIDs {
 		if labelID == storeMailbox.labelID {
@@ -265,12 +317,12 @@ func (storeMailbox *Mailbox) txSkipAndRemoveFromMailbox(tx *bolt.Tx, msg *pmapi.
 }
 
 // txCreateOrUpdateMessages will delete, create or update message from mailbox.
-func (storeMailbox *Mailbox) txCreateOrUpdateMessages(tx *bolt.Tx, msgs []*pmapi.Message) error { //nolint[funlen]
+func (storeMailbox *Mailbox) txCreateOrUpdateMessages(tx storage.Tx, msgs []*pmapi.Message) error { //nolint[funlen]
 	shouldSendMailboxUpdate := false
 
 	// Buckets are not initialized right away because it's a heavy operation.
 	// The best option is to get the same bucket only once and only when needed.
-	var apiBucket, imapBucket *bolt.Bucket
+	var apiBucket, imapBucket storage.Bucket
 	for _, msg := range msgs {
 		if storeMailbox.txSkipAndRemoveFromMailbox(tx, msg) {
 			continue
@@ -294,6 +346,9 @@ func (storeMailbox *Mailbox) txCreateOrUpdateMessages(tx *bolt.Tx, msgs []*pmapi
 				if imapBucket == nil {
 					imapBucket = storeMailbox.txGetIMAPIDsBucket(tx)
 				}
+				if err := storeMailbox.txCountMessage(tx, msg, false); err != nil {
+					return errors.Wrap(err, "cannot update counters")
+				}
 				seqNum, seqErr := storeMailbox.txGetSequenceNumberOfUID(imapBucket, uidb)
 				if seqErr == nil {
 					storeMailbox.store.imapUpdateMessage(
@@ -302,6 +357,7 @@ func (storeMailbox *Mailbox) txCreateOrUpdateMessages(tx *bolt.Tx, msgs []*pmapi
 						btoi(uidb),
 						seqNum,
 						msg,
+						storeMailbox.txGetLocalFlags(tx, msg.ID),
 					)
 				}
 				continue
@@ -324,6 +380,12 @@ func (storeMailbox *Mailbox) txCreateOrUpdateMessages(tx *bolt.Tx, msgs []*pmapi
 		if err = apiBucket.Put([]byte(msg.ID), uidb); err != nil {
 			return errors.Wrap(err, "cannot add to API bucket")
 		}
+		if err = storeMailbox.txPutSaveDate(tx, msg.ID, time.Now()); err != nil {
+			return errors.Wrap(err, "cannot add to save dates bucket")
+		}
+		if err = storeMailbox.txCountMessage(tx, msg, true); err != nil {
+			return errors.Wrap(err, "cannot update counters")
+		}
 
 		seqNum, err := storeMailbox.txGetSequenceNumberOfUID(imapBucket, uidb)
 		if err != nil {
@@ -335,6 +397,7 @@ func (storeMailbox *Mailbox) txCreateOrUpdateMessages(tx *bolt.Tx, msgs []*pmapi
 			uid,
 			seqNum,
 			msg,
+			storeMailbox.txGetLocalFlags(tx, msg.ID),
 		)
 		shouldSendMailboxUpdate = true
 	}
@@ -350,7 +413,7 @@ func (storeMailbox *Mailbox) txCreateOrUpdateMessages(tx *bolt.Tx, msgs []*pmapi
 
 // txDeleteMessage deletes the message from the mailbox bucket.
 // and issues message delete and mailbox update changes to updates channel.
-func (storeMailbox *Mailbox) txDeleteMessage(tx *bolt.Tx, apiID string) error {
+func (storeMailbox *Mailbox) txDeleteMessage(tx storage.Tx, apiID string) error {
 	apiBucket := storeMailbox.txGetAPIIDsBucket(tx)
 	apiIDb := []byte(apiID)
 	uidb := apiBucket.Get(apiIDb)
@@ -373,6 +436,18 @@ func (storeMailbox *Mailbox) txDeleteMessage(tx *bolt.Tx, apiID string) error {
 		return errors.Wrap(err, "cannot delete from API bucket")
 	}
 
+	if err := storeMailbox.txGetSaveDatesBucket(tx).Delete(apiIDb); err != nil {
+		return errors.Wrap(err, "cannot delete from save dates bucket")
+	}
+
+	if err := storeMailbox.txGetDeletedFlagsBucket(tx).Delete(apiIDb); err != nil {
+		return errors.Wrap(err, "cannot delete from deleted flags bucket")
+	}
+
+	if err := storeMailbox.txUncountMessage(tx, apiID); err != nil {
+		return errors.Wrap(err, "cannot update counters")
+	}
+
 	if seqNumErr == nil {
 		storeMailbox.store.imapDeleteMessage(
 			storeMailbox.storeAddress.address,
@@ -387,7 +462,7 @@ func (storeMailbox *Mailbox) txDeleteMessage(tx *bolt.Tx, apiID string) error {
 	return nil
 }
 
-func (storeMailbox *Mailbox) txMailboxStatusUpdate(tx *bolt.Tx) error {
+func (storeMailbox *Mailbox) txMailboxStatusUpdate(tx storage.Tx) error {
 	total, unread, unreadSeqNum, err := storeMailbox.txGetCounts(tx)
 	if err != nil {
 		return errors.Wrap(err, "cannot get counts for mailbox status update")
@@ -401,3 +476,25 @@ func (storeMailbox *Mailbox) txMailboxStatusUpdate(tx *bolt.Tx) error {
 	)
 	return nil
 }
+
+func (storeMailbox *Mailbox) txPutSaveDate(tx storage.Tx, apiID string, saveDate time.Time) error {
+	return storeMailbox.txGetSaveDatesBucket(tx).Put([]byte(apiID), []byte(strconv.FormatInt(saveDate.Unix(), 10)))
+}
+
+// getSaveDate returns when the message was added to the mailbox. Zero time
+// is returned for messages added before the save date was tracked.
+func (storeMailbox *Mailbox) getSaveDate(apiID string) (saveDate time.Time) {
+	_ = storeMailbox.db().View(func(tx storage.Tx) error {
+		value := storeMailbox.txGetSaveDatesBucket(tx).Get([]byte(apiID))
+		if value == nil {
+			return nil
+		}
+		timestamp, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return err
+		}
+		saveDate = time.Unix(timestamp, 0)
+		return nil
+	})
+	return
+}
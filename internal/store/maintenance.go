@@ -0,0 +1,90 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import "sync"
+
+// Maintenance reasons.
+const (
+	MaintenanceSafeMode   = "safe_mode"
+	MaintenanceCompaction = "compaction"
+)
+
+var (
+	safeMode     bool         //nolint[gochecknoglobals]
+	safeModeLock sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetSafeMode sets whether stores are opened in read-only maintenance mode
+// for the whole run, used when the app starts in safe mode after crashes.
+func SetSafeMode(enabled bool) {
+	safeModeLock.Lock()
+	defer safeModeLock.Unlock()
+
+	safeMode = enabled
+}
+
+func isSafeMode() bool {
+	safeModeLock.RLock()
+	defer safeModeLock.RUnlock()
+
+	return safeMode
+}
+
+// StartMaintenance switches the store to read-only maintenance mode while
+// an operation which cannot handle changes is running, e.g. compaction of
+// the database. Sync is not such operation, it merges changes from clients. The existing data is still served but
+// clients should not change it until the operation is finished. Several
+// operations can overlap; the store leaves the maintenance mode once all
+// of them called EndMaintenance with the same reason.
+func (store *Store) StartMaintenance(reason string) {
+	store.maintenanceLock.Lock()
+	defer store.maintenanceLock.Unlock()
+
+	if len(store.maintenance) == 0 {
+		store.log.WithField("reason", reason).Info("Entering read-only maintenance mode")
+	}
+	store.maintenance[reason]++
+}
+
+// EndMaintenance finishes the operation started by StartMaintenance.
+func (store *Store) EndMaintenance(reason string) {
+	store.maintenanceLock.Lock()
+	defer store.maintenanceLock.Unlock()
+
+	if store.maintenance[reason] == 0 {
+		store.log.WithField("reason", reason).Warn("Ending maintenance which was not started")
+		return
+	}
+
+	store.maintenance[reason]--
+	if store.maintenance[reason] == 0 {
+		delete(store.maintenance, reason)
+	}
+	if len(store.maintenance) == 0 {
+		store.log.WithField("reason", reason).Info("Leaving read-only maintenance mode")
+	}
+}
+
+// IsInMaintenance returns whether the store is in read-only maintenance mode.
+func (store *Store) IsInMaintenance() bool {
+	store.maintenanceLock.RLock()
+	defer store.maintenanceLock.RUnlock()
+
+	return len(store.maintenance) != 0
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceOverlappingOperations(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	// Sync does not block changes of clients.
+	require.False(t, m.store.IsInMaintenance())
+
+	m.store.StartMaintenance(MaintenanceCompaction)
+	m.store.StartMaintenance("repair")
+	require.True(t, m.store.IsInMaintenance())
+
+	m.store.EndMaintenance(MaintenanceCompaction)
+	require.True(t, m.store.IsInMaintenance())
+
+	// Ending not started maintenance does not break the counting.
+	m.store.EndMaintenance(MaintenanceCompaction)
+	require.True(t, m.store.IsInMaintenance())
+
+	m.store.EndMaintenance("repair")
+	require.False(t, m.store.IsInMaintenance())
+}
+
+func TestMaintenanceSafeMode(t *testing.T) {
+	SetSafeMode(true)
+	defer SetSafeMode(false)
+
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	// Safe mode is kept during and after the first sync.
+	require.Never(t, func() bool {
+		return !m.store.IsInMaintenance()
+	}, 200*time.Millisecond, 10*time.Millisecond)
+}
@@ -19,9 +19,10 @@ package store
 
 import (
 	"net/mail"
+	"time"
 
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
-	bolt "go.etcd.io/bbolt"
 )
 
 // Message is wrapper around `pmapi.Message` with connection to
@@ -62,6 +63,23 @@ func (message *Message) Message() *pmapi.Message {
 	return message.msg
 }
 
+// SaveDate returns when the message was added to the used mailbox or zero
+// time when it is not known.
+func (message *Message) SaveDate() time.Time {
+	return message.storeMailbox.getSaveDate(message.ID())
+}
+
+// Keywords returns IMAP keywords stored locally for the message.
+func (message *Message) Keywords() []string {
+	return message.store.GetKeywords(message.ID())
+}
+
+// IsMarkedDeleted returns whether the message has the IMAP \Deleted flag in
+// the used mailbox.
+func (message *Message) IsMarkedDeleted() bool {
+	return message.storeMailbox.isMarkedDeleted(message.ID())
+}
+
 // SetSize updates the information about size of decrypted message which can be
 // used for IMAP. This should not trigger any IMAP update.
 // NOTE: The size from the server corresponds to pure body bytes. Hence it
@@ -69,7 +87,7 @@ func (message *Message) Message() *pmapi.Message {
 // built message.
 func (message *Message) SetSize(size int64) error {
 	message.msg.Size = size
-	txUpdate := func(tx *bolt.Tx) error {
+	txUpdate := func(tx storage.Tx) error {
 		stored, err := message.store.txGetMessage(tx, message.msg.ID)
 		if err != nil {
 			return err
@@ -90,7 +108,7 @@ func (message *Message) SetSize(size int64) error {
 func (message *Message) SetContentTypeAndHeader(mimeType string, header mail.Header) error {
 	message.msg.MIMEType = mimeType
 	message.msg.Header = header
-	txUpdate := func(tx *bolt.Tx) error {
+	txUpdate := func(tx storage.Tx) error {
 		stored, err := message.store.txGetMessage(tx, message.msg.ID)
 		if err != nil {
 			return err
@@ -0,0 +1,318 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MessageCache persists built (decrypted) messages on disk so they don't
+// have to be downloaded and decrypted again. Messages are encrypted by
+// the key of each user which is stored in the keychain (see SetUserKey).
+// When the total size exceeds the limit, the least recently used messages
+// are removed. There should be only one instance shared by all users.
+type MessageCache struct {
+	backend   CacheBackend
+	sizeLimit int64
+	ciphers   cacheCiphers
+
+	lock      *sync.Mutex
+	entries   map[string]*messageCacheEntry
+	totalSize int64
+}
+
+type messageCacheEntry struct {
+	name     string
+	size     int64
+	lastUsed time.Time
+}
+
+// NewMessageCache opens the message cache in local dir.
+func NewMessageCache(dir string, sizeLimit int64) (*MessageCache, error) {
+	backend, err := NewLocalCacheBackend(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMessageCacheWithBackend(backend, sizeLimit)
+}
+
+// NewMessageCacheWithBackend opens the message cache stored in backend.
+func NewMessageCacheWithBackend(backend CacheBackend, sizeLimit int64) (*MessageCache, error) {
+	c := &MessageCache{
+		backend:   backend,
+		sizeLimit: sizeLimit,
+		ciphers:   newCacheCiphers(),
+		lock:      &sync.Mutex{},
+		entries:   map[string]*messageCacheEntry{},
+	}
+
+	if err := c.loadEntries(); err != nil {
+		return nil, errors.Wrap(err, "failed to load message cache")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.evict()
+
+	return c, nil
+}
+
+// Close releases the backend, e.g. the lock of a shared folder.
+func (c *MessageCache) Close() error {
+	return c.backend.Close()
+}
+
+// loadEntries builds the index from the files in the backend. Modification
+// time of the file is used as the last time the message was used.
+func (c *MessageCache) loadEntries() error {
+	return c.backend.Walk("", func(name string, size int64, lastUsed time.Time) error {
+		c.entries[name] = &messageCacheEntry{
+			name:     name,
+			size:     size,
+			lastUsed: lastUsed,
+		}
+		c.totalSize += size
+
+		return nil
+	})
+}
+
+// SetUserKey sets the key encrypting messages of the user. Messages of
+// users without the key are neither returned nor stored.
+func (c *MessageCache) SetUserKey(userID string, key []byte) error {
+	return c.ciphers.SetUserKey(userID, key)
+}
+
+// Get returns the cached message or false if it is not cached.
+func (c *MessageCache) Get(userID, messageID string) ([]byte, bool) {
+	userCipher, err := c.ciphers.get(userID)
+	if err != nil {
+		return nil, false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	name := c.getName(userID, messageID)
+	entry, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+
+	encrypted, err := c.backend.ReadFile(name)
+	if err != nil {
+		log.WithError(err).Warn("Cannot read cached message")
+		c.remove(entry)
+		return nil, false
+	}
+
+	message, err := decryptCache(userCipher.gcm, encrypted)
+	if err != nil {
+		// Most probably encrypted by a different key.
+		log.WithError(err).Warn("Cannot decrypt cached message")
+		c.remove(entry)
+		return nil, false
+	}
+
+	entry.lastUsed = time.Now()
+	_ = c.backend.Touch(name, entry.lastUsed)
+
+	return message, true
+}
+
+// Set stores the message to the cache and evicts the least recently used
+// messages if the cache is too big.
+func (c *MessageCache) Set(userID, messageID string, message []byte) error {
+	userCipher, err := c.ciphers.get(userID)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := encryptCache(userCipher.gcm, message)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if int64(len(encrypted)) > c.sizeLimit {
+		return nil
+	}
+
+	name := c.getName(userID, messageID)
+	if entry, ok := c.entries[name]; ok {
+		c.remove(entry)
+	}
+
+	if err := c.backend.WriteFile(name, encrypted); err != nil {
+		return err
+	}
+
+	c.entries[name] = &messageCacheEntry{
+		name:     name,
+		size:     int64(len(encrypted)),
+		lastUsed: time.Now(),
+	}
+	c.totalSize += int64(len(encrypted))
+
+	c.evict()
+
+	return nil
+}
+
+// Delete removes the message from the cache.
+func (c *MessageCache) Delete(userID, messageID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if entry, ok := c.entries[c.getName(userID, messageID)]; ok {
+		c.remove(entry)
+	}
+}
+
+// Size returns the total size of cached messages.
+func (c *MessageCache) Size() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.totalSize
+}
+
+// UserUsage returns the count and total size of cached messages of the user.
+func (c *MessageCache) UserUsage(userID string) (count int, size int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	userDir := c.getUserDir(userID)
+	for name, entry := range c.entries {
+		if filepath.Dir(name) == userDir {
+			count++
+			size += entry.size
+		}
+	}
+	return
+}
+
+// Compact removes cached messages of the user other than the given ones,
+// e.g. messages deleted while Bridge was not running, and returns the size
+// of removed messages.
+func (c *MessageCache) Compact(userID string, messageIDs []string) int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	keep := map[string]struct{}{}
+	for _, messageID := range messageIDs {
+		keep[c.getName(userID, messageID)] = struct{}{}
+	}
+
+	sizeBefore := c.totalSize
+	userDir := c.getUserDir(userID)
+	for name, entry := range c.entries {
+		if _, ok := keep[name]; !ok && filepath.Dir(name) == userDir {
+			c.remove(entry)
+		}
+	}
+	return sizeBefore - c.totalSize
+}
+
+// RemoveUser removes all messages of the user from the cache.
+func (c *MessageCache) RemoveUser(userID string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	userDir := c.getUserDir(userID)
+	for name, entry := range c.entries {
+		if filepath.Dir(name) == userDir {
+			c.totalSize -= entry.size
+			delete(c.entries, name)
+		}
+	}
+
+	return c.backend.RemoveAll(userDir)
+}
+
+// evict removes the least recently used messages until the total size is
+// within the limit.
+func (c *MessageCache) evict() {
+	if c.totalSize <= c.sizeLimit {
+		return
+	}
+
+	entries := make([]*messageCacheEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+
+	for _, entry := range entries {
+		if c.totalSize <= c.sizeLimit {
+			break
+		}
+		c.remove(entry)
+	}
+}
+
+func (c *MessageCache) remove(entry *messageCacheEntry) {
+	if err := c.backend.Remove(entry.name); err != nil {
+		log.WithError(err).Warn("Cannot remove cached message")
+	}
+	c.totalSize -= entry.size
+	delete(c.entries, entry.name)
+}
+
+// getName hashes IDs to not leak them in file names and to avoid problems
+// with characters not allowed in paths.
+func (c *MessageCache) getName(userID, messageID string) string {
+	hash := sha256.Sum256([]byte(messageID))
+	return filepath.Join(c.getUserDir(userID), hex.EncodeToString(hash[:]))
+}
+
+func (c *MessageCache) getUserDir(userID string) string {
+	hash := sha256.Sum256([]byte(userID))
+	return hex.EncodeToString(hash[:])
+}
+
+func encryptCache(gcm cipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func decryptCache(gcm cipher.AEAD, encrypted []byte) ([]byte, error) {
+	nonceSize := gcm.NonceSize()
+	if len(encrypted) < nonceSize {
+		return nil, errors.New("cached data is too short")
+	}
+	return gcm.Open(nil, encrypted[:nonceSize], encrypted[nonceSize:], nil)
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type cacheWithUserKeys interface {
+	SetUserKey(userID string, key []byte) error
+}
+
+// setTestCacheKeys sets different keys for userID and otherUserID. Keys
+// differ for each value of seed.
+func setTestCacheKeys(t *testing.T, c cacheWithUserKeys, seed byte) {
+	require.NoError(t, c.SetUserKey("userID", bytes.Repeat([]byte{seed}, CacheKeySize)))
+	require.NoError(t, c.SetUserKey("otherUserID", bytes.Repeat([]byte{seed + 1}, CacheKeySize)))
+}
+
+func newTestMessageCache(t *testing.T, sizeLimit int64) (*MessageCache, string, func()) {
+	dir, err := ioutil.TempDir("", "message-cache")
+	require.NoError(t, err)
+
+	c, err := NewMessageCache(filepath.Join(dir, "messages"), sizeLimit)
+	require.NoError(t, err)
+	setTestCacheKeys(t, c, 1)
+
+	return c, dir, func() { _ = os.RemoveAll(dir) }
+}
+
+func TestMessageCacheSetGet(t *testing.T) {
+	c, dir, clear := newTestMessageCache(t, 1000)
+	defer clear()
+
+	_, ok := c.Get("userID", "msgID")
+	require.False(t, ok)
+
+	require.NoError(t, c.Set("userID", "msgID", []byte("Subject: secret")))
+
+	body, ok := c.Get("userID", "msgID")
+	require.True(t, ok)
+	require.Equal(t, "Subject: secret", string(body))
+
+	_, ok = c.Get("otherUserID", "msgID")
+	require.False(t, ok)
+
+	// Content is encrypted on disk.
+	require.NoError(t, filepath.Walk(filepath.Join(dir, "messages"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path) //nolint[gosec]
+		require.NoError(t, err)
+		require.False(t, bytes.Contains(data, []byte("secret")))
+		return nil
+	}))
+
+	// Cache survives restart.
+	c, err := NewMessageCache(filepath.Join(dir, "messages"), 1000)
+	require.NoError(t, err)
+
+	// Messages are not available without the key of the user.
+	_, ok = c.Get("userID", "msgID")
+	require.False(t, ok)
+	require.Equal(t, errNoCacheKey, c.Set("userID", "msgID", []byte("Subject: secret")))
+
+	setTestCacheKeys(t, c, 1)
+	body, ok = c.Get("userID", "msgID")
+	require.True(t, ok)
+	require.Equal(t, "Subject: secret", string(body))
+
+	c.Delete("userID", "msgID")
+	_, ok = c.Get("userID", "msgID")
+	require.False(t, ok)
+}
+
+func TestMessageCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	// Each encrypted message has 100 bytes plus 28 bytes of nonce and tag.
+	c, _, clear := newTestMessageCache(t, 300)
+	defer clear()
+
+	message := []byte(strings.Repeat("a", 100))
+
+	require.NoError(t, c.Set("userID", "msg1", message))
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, c.Set("userID", "msg2", message))
+	time.Sleep(10 * time.Millisecond)
+
+	// Using msg1 makes msg2 the least recently used one.
+	_, ok := c.Get("userID", "msg1")
+	require.True(t, ok)
+
+	require.NoError(t, c.Set("userID", "msg3", message))
+
+	_, ok = c.Get("userID", "msg1")
+	require.True(t, ok)
+	_, ok = c.Get("userID", "msg2")
+	require.False(t, ok)
+	_, ok = c.Get("userID", "msg3")
+	require.True(t, ok)
+
+	// Too big message is not cached at all.
+	require.NoError(t, c.Set("userID", "msg4", []byte(strings.Repeat("a", 300))))
+	_, ok = c.Get("userID", "msg4")
+	require.False(t, ok)
+}
+
+func TestMessageCacheWithDifferentKey(t *testing.T) {
+	c, dir, clear := newTestMessageCache(t, 1000)
+	defer clear()
+
+	require.NoError(t, c.Set("userID", "msgID", []byte("Subject: secret")))
+
+	c, err := NewMessageCache(filepath.Join(dir, "messages"), 1000)
+	require.NoError(t, err)
+	setTestCacheKeys(t, c, 3)
+
+	_, ok := c.Get("userID", "msgID")
+	require.False(t, ok)
+}
+
+func TestMessageCacheRemoveUser(t *testing.T) {
+	c, _, clear := newTestMessageCache(t, 1000)
+	defer clear()
+
+	require.NoError(t, c.Set("userID", "msgID", []byte("message")))
+	require.NoError(t, c.Set("otherUserID", "msgID", []byte("other message")))
+
+	require.NoError(t, c.RemoveUser("userID"))
+
+	_, ok := c.Get("userID", "msgID")
+	require.False(t, ok)
+	body, ok := c.Get("otherUserID", "msgID")
+	require.True(t, ok)
+	require.Equal(t, "other message", string(body))
+}
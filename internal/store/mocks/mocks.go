@@ -132,6 +132,21 @@ func (mr *MockBridgeUserMockRecorder) GetAddressID(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAddressID", reflect.TypeOf((*MockBridgeUser)(nil).GetAddressID), arg0)
 }
 
+// GetCacheKey mocks base method
+func (m *MockBridgeUser) GetCacheKey() ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCacheKey")
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCacheKey indicates an expected call of GetCacheKey
+func (mr *MockBridgeUserMockRecorder) GetCacheKey() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCacheKey", reflect.TypeOf((*MockBridgeUser)(nil).GetCacheKey))
+}
+
 // GetPrimaryAddress mocks base method
 func (m *MockBridgeUser) GetPrimaryAddress() string {
 	m.ctrl.T.Helper()
@@ -0,0 +1,193 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// QuietHours is the part of the day without notifications. Start and End
+// are minutes after midnight in local time; the hours can span midnight.
+// Equal Start and End means there are no quiet hours.
+type QuietHours struct {
+	Start int
+	End   int
+}
+
+// ParseQuietHours parses quiet hours in the format "22:00-07:00". Empty
+// value means there are no quiet hours.
+func ParseQuietHours(value string) (quiet QuietHours, err error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return quiet, fmt.Errorf("quiet hours %q must be in format HH:MM-HH:MM", value)
+	}
+	if quiet.Start, err = parseMinuteOfDay(parts[0]); err != nil {
+		return
+	}
+	quiet.End, err = parseMinuteOfDay(parts[1])
+	return
+}
+
+func parseMinuteOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("time %q must be in format HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// IsEnabled returns whether there are any quiet hours.
+func (quiet QuietHours) IsEnabled() bool {
+	return quiet.Start != quiet.End
+}
+
+// Contains returns whether t in its location falls into the quiet hours.
+func (quiet QuietHours) Contains(t time.Time) bool {
+	if !quiet.IsEnabled() {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if quiet.Start < quiet.End {
+		return quiet.Start <= minute && minute < quiet.End
+	}
+	return quiet.Start <= minute || minute < quiet.End
+}
+
+// String returns quiet hours in the format accepted by ParseQuietHours.
+func (quiet QuietHours) String() string {
+	if !quiet.IsEnabled() {
+		return ""
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", quiet.Start/60, quiet.Start%60, quiet.End/60, quiet.End%60)
+}
+
+// NotificationRules decide which new messages of the account are notified.
+// Folders are IMAP names of mailboxes; messages received to any of them
+// are notified unless it is during the quiet hours.
+type NotificationRules struct {
+	Disabled   bool
+	Folders    []string
+	QuietHours QuietHours
+}
+
+// storedNotificationRules keeps label IDs instead of names, so renamed
+// mailboxes are still notified.
+type storedNotificationRules struct {
+	Disabled   bool
+	LabelIDs   []string
+	QuietHours QuietHours
+}
+
+var notificationRulesKey = []byte("rules") //nolint[gochecknoglobals]
+
+// defaultNotificationRules notify messages received to inbox at any time.
+func defaultNotificationRules() storedNotificationRules {
+	return storedNotificationRules{LabelIDs: []string{pmapi.InboxLabel}}
+}
+
+// GetNotificationRules returns which new messages are notified.
+func (store *Store) GetNotificationRules() NotificationRules {
+	stored := store.getNotificationRules()
+
+	rules := NotificationRules{
+		Disabled:   stored.Disabled,
+		Folders:    []string{},
+		QuietHours: stored.QuietHours,
+	}
+	for _, labelID := range stored.LabelIDs {
+		if name := store.getMailboxNameByLabelID(labelID); name != "" {
+			rules.Folders = append(rules.Folders, name)
+		}
+	}
+	sort.Strings(rules.Folders)
+	return rules
+}
+
+func (store *Store) getNotificationRules() storedNotificationRules {
+	stored := defaultNotificationRules()
+	_ = store.db.View(func(tx storage.Tx) error {
+		if data := tx.Bucket(notificationsBucket).Get(notificationRulesKey); data != nil {
+			stored = storedNotificationRules{}
+			_ = json.Unmarshal(data, &stored)
+		}
+		return nil
+	})
+	return stored
+}
+
+// SetNotificationRules sets which new messages are notified. All folders
+// must exist.
+func (store *Store) SetNotificationRules(rules NotificationRules) error {
+	stored := storedNotificationRules{
+		Disabled:   rules.Disabled,
+		LabelIDs:   []string{},
+		QuietHours: rules.QuietHours,
+	}
+	if stored.QuietHours.Start < 0 || stored.QuietHours.Start >= 24*60 || stored.QuietHours.End < 0 || stored.QuietHours.End >= 24*60 {
+		return errors.New("quiet hours must be within one day")
+	}
+	for _, name := range rules.Folders {
+		mailbox, err := store.getMailbox(name)
+		if err != nil {
+			return err
+		}
+		stored.LabelIDs = append(stored.LabelIDs, mailbox.labelID)
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(notificationsBucket).Put(notificationRulesKey, data)
+	})
+}
+
+// GetMessageToNotify returns the stored message when the rules allow to
+// notify it at now, i.e., it is received to one of the folders and it is
+// not during the quiet hours.
+func (store *Store) GetMessageToNotify(apiID string, now time.Time) (*pmapi.Message, bool) {
+	rules := store.getNotificationRules()
+	if rules.Disabled || rules.QuietHours.Contains(now) {
+		return nil, false
+	}
+
+	msg, err := store.getMessageFromDB(apiID)
+	if err != nil || !isReceivedMessage(msg) {
+		return nil, false
+	}
+
+	for _, labelID := range rules.LabelIDs {
+		if msg.HasLabelID(labelID) {
+			return msg, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	quiet, err := ParseQuietHours("22:00-07:30")
+	require.NoError(t, err)
+	require.Equal(t, QuietHours{Start: 22 * 60, End: 7*60 + 30}, quiet)
+	require.Equal(t, "22:00-07:30", quiet.String())
+
+	quiet, err = ParseQuietHours("")
+	require.NoError(t, err)
+	require.False(t, quiet.IsEnabled())
+
+	for _, value := range []string{"22:00", "22-07", "25:00-07:00", "22:00-07:00-08:00"} {
+		_, err := ParseQuietHours(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2020, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	overnight := QuietHours{Start: 22 * 60, End: 7 * 60}
+	require.True(t, overnight.Contains(at(23, 0)))
+	require.True(t, overnight.Contains(at(0, 0)))
+	require.True(t, overnight.Contains(at(6, 59)))
+	require.False(t, overnight.Contains(at(7, 0)))
+	require.False(t, overnight.Contains(at(12, 0)))
+
+	lunch := QuietHours{Start: 12 * 60, End: 13 * 60}
+	require.True(t, lunch.Contains(at(12, 30)))
+	require.False(t, lunch.Contains(at(13, 0)))
+
+	require.False(t, QuietHours{}.Contains(at(0, 0)))
+}
+
+func insertReceivedMessage(t *testing.T, m *mocksForStore, id string, labelIDs []string) {
+	msg := getTestMessage(id, "Test message", addrID1, 1, labelIDs)
+	msg.Flags = pmapi.FlagReceived
+	require.NoError(t, m.store.createOrUpdateMessageEvent(msg))
+}
+
+func TestNotificationRules(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertReceivedMessage(t, m, "inbox", []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertReceivedMessage(t, m, "archive", []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	insertMessage(t, m, "sent", "Test message", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	noon := time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local)
+	midnight := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+
+	// Only inbox is notified by default.
+	require.Equal(t, NotificationRules{Folders: []string{"INBOX"}}, m.store.GetNotificationRules())
+	_, ok := m.store.GetMessageToNotify("inbox", noon)
+	require.True(t, ok)
+	_, ok = m.store.GetMessageToNotify("archive", noon)
+	require.False(t, ok)
+	_, ok = m.store.GetMessageToNotify("sent", noon)
+	require.False(t, ok)
+
+	require.EqualError(t, m.store.SetNotificationRules(NotificationRules{Folders: []string{"Unknown"}}), "mailbox Unknown does not exist")
+
+	rules := NotificationRules{Folders: []string{"Archive"}, QuietHours: QuietHours{Start: 22 * 60, End: 7 * 60}}
+	require.NoError(t, m.store.SetNotificationRules(rules))
+	require.Equal(t, rules, m.store.GetNotificationRules())
+
+	msg, ok := m.store.GetMessageToNotify("archive", noon)
+	require.True(t, ok)
+	require.Equal(t, "archive", msg.ID)
+	_, ok = m.store.GetMessageToNotify("archive", midnight)
+	require.False(t, ok)
+	_, ok = m.store.GetMessageToNotify("inbox", noon)
+	require.False(t, ok)
+
+	require.NoError(t, m.store.SetNotificationRules(NotificationRules{Disabled: true, Folders: []string{"Archive"}}))
+	_, ok = m.store.GetMessageToNotify("archive", noon)
+	require.False(t, ok)
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// ChangeType is the kind of change of the store reported to observers.
+type ChangeType int
+
+// Types of changes reported to observers.
+const (
+	MessageCreated ChangeType = iota
+	MessageUpdated
+	MessageDeleted
+	MailboxUpdated
+	MailboxDeleted
+	SyncStarted
+	SyncFinished
+	SyncFailed
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case MessageCreated:
+		return "message created"
+	case MessageUpdated:
+		return "message updated"
+	case MessageDeleted:
+		return "message deleted"
+	case MailboxUpdated:
+		return "mailbox updated"
+	case MailboxDeleted:
+		return "mailbox deleted"
+	case SyncStarted:
+		return "sync started"
+	case SyncFinished:
+		return "sync finished"
+	case SyncFailed:
+		return "sync failed"
+	}
+	return "unknown"
+}
+
+// Change describes one change of the store of the user. Only the fields
+// relevant for the type are set:
+// * Message for MessageCreated and MessageUpdated (metadata only, no body),
+// * MessageID for all message changes,
+// * Label for MailboxUpdated,
+// * LabelID for all mailbox changes,
+// * Err for SyncFailed.
+type Change struct {
+	Type      ChangeType
+	UserID    string
+	MessageID string
+	Message   *pmapi.Message
+	LabelID   string
+	Label     *pmapi.Label
+	Err       error
+}
+
+// Observer is notified about changes of stores of all users after they are
+// saved in the database. It is called synchronously from the event loop or
+// sync, therefore it must not block; any longer work has to be done in its
+// own goroutine.
+type Observer interface {
+	StoreChanged(change Change)
+}
+
+// ObserverFunc is an adapter to use an ordinary function as Observer.
+type ObserverFunc func(change Change)
+
+// StoreChanged calls f(change).
+func (f ObserverFunc) StoreChanged(change Change) {
+	f(change)
+}
+
+var (
+	observers     = map[int]Observer{} //nolint[gochecknoglobals]
+	observersNext int                  //nolint[gochecknoglobals]
+	observersLock sync.RWMutex         //nolint[gochecknoglobals]
+)
+
+// AddObserver registers the observer of changes of all stores. The returned
+// function unregisters it.
+func AddObserver(observer Observer) (remove func()) {
+	observersLock.Lock()
+	defer observersLock.Unlock()
+
+	id := observersNext
+	observersNext++
+	observers[id] = observer
+
+	return func() {
+		observersLock.Lock()
+		defer observersLock.Unlock()
+
+		delete(observers, id)
+	}
+}
+
+// notifyObservers sends the change of this store to all observers.
+// Observers are called without the lock so they can unregister themselves.
+func (store *Store) notifyObservers(change Change) {
+	observersLock.RLock()
+	current := make([]Observer, 0, len(observers))
+	for _, observer := range observers {
+		current = append(current, observer)
+	}
+	observersLock.RUnlock()
+
+	if len(current) == 0 {
+		return
+	}
+
+	change.UserID = store.UserID()
+	for _, observer := range current {
+		observer.StoreChanged(change)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserver(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	// Sync of the new store reports asynchronously, only message and
+	// mailbox changes are checked here.
+	var lock sync.Mutex
+	var changes []Change
+	remove := AddObserver(ObserverFunc(func(change Change) {
+		if change.Type >= SyncStarted {
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		changes = append(changes, change)
+	}))
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel})
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel})
+	require.NoError(t, m.store.deleteMessagesEvent([]string{"msg1", "unknown"}))
+
+	label := &pmapi.Label{ID: "folder", Name: "Work", Type: pmapi.LabelTypeMailbox, Exclusive: 1}
+	require.NoError(t, m.store.createOrUpdateMailboxEvent(label))
+	require.NoError(t, m.store.deleteMailboxEvent("folder"))
+
+	remove()
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel})
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	types := []ChangeType{}
+	for _, change := range changes {
+		require.Equal(t, "userID", change.UserID)
+		types = append(types, change.Type)
+	}
+	require.Equal(t, []ChangeType{MessageCreated, MessageUpdated, MessageDeleted, MailboxUpdated, MailboxDeleted}, types)
+
+	require.Equal(t, "msg1", changes[0].Message.ID)
+	require.Empty(t, changes[0].Message.Body, "observers get only metadata")
+	require.Equal(t, "msg1", changes[2].MessageID)
+	require.Equal(t, label, changes[3].Label)
+	require.Equal(t, "folder", changes[4].LabelID)
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+)
+
+// ErrNoSuchScheduledMessage when outbox does not have the message.
+var ErrNoSuchScheduledMessage = errors.New("no such scheduled message") //nolint[gochecknoglobals]
+
+// ScheduledMessage is a message submitted over SMTP to be sent later,
+// either because it was scheduled or because API was not reachable.
+type ScheduledMessage struct {
+	ID        string
+	SendAt    time.Time
+	From      string
+	To        []string
+	Attempts  int
+	LastError string
+
+	// UID identifies the message in the virtual IMAP mailboxes listing the
+	// outbox. Every scheduling, including rescheduling, gets a new UID.
+	UID uint32
+
+	// Body is the MIME message encrypted by the key ring of the sender.
+	Body []byte
+}
+
+// Decrypt returns the MIME message.
+func (msg *ScheduledMessage) Decrypt(kr *crypto.KeyRing) ([]byte, error) {
+	plain, err := kr.Decrypt(crypto.NewPGPMessage(msg.Body), nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return plain.GetBinary(), nil
+}
+
+// ScheduleMessage queues the MIME message in the outbox to be sent at sendAt.
+// The message is kept encrypted by the key ring of the sender.
+func (store *Store) ScheduleMessage(kr *crypto.KeyRing, sendAt time.Time, from string, to []string, body []byte) (string, error) {
+	encrypted, err := kr.Encrypt(crypto.NewPlainMessage(body), nil)
+	if err != nil {
+		return "", err
+	}
+
+	msg := &ScheduledMessage{
+		SendAt: sendAt,
+		From:   from,
+		To:     to,
+		Body:   encrypted.GetBinary(),
+	}
+
+	err = store.db.Update(func(tx storage.Tx) error {
+		return txPutScheduledMessage(tx.Bucket(outboxBucket), msg)
+	})
+	if err != nil {
+		return "", err
+	}
+	return msg.ID, nil
+}
+
+// RescheduleMessage changes the time the message is sent at. The message
+// gets new ID and UID which are returned.
+func (store *Store) RescheduleMessage(id string, sendAt time.Time) (newID string, uid uint32, err error) {
+	return store.copyScheduledMessage(id, sendAt, true)
+}
+
+// CopyScheduledMessage queues the copy of the message to be sent at sendAt.
+// The original message is kept in the outbox.
+func (store *Store) CopyScheduledMessage(id string, sendAt time.Time) (newID string, uid uint32, err error) {
+	return store.copyScheduledMessage(id, sendAt, false)
+}
+
+func (store *Store) copyScheduledMessage(id string, sendAt time.Time, removeOriginal bool) (newID string, uid uint32, err error) {
+	err = store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(outboxBucket)
+
+		data := b.Get([]byte(id))
+		if data == nil {
+			return ErrNoSuchScheduledMessage
+		}
+
+		msg := &ScheduledMessage{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			return err
+		}
+		msg.SendAt = sendAt
+		msg.Attempts = 0
+		msg.LastError = ""
+
+		if err := txPutScheduledMessage(b, msg); err != nil {
+			return err
+		}
+		newID, uid = msg.ID, msg.UID
+
+		if removeOriginal {
+			return b.Delete([]byte(id))
+		}
+		return nil
+	})
+	return
+}
+
+// txPutScheduledMessage stores the message under new ID and UID.
+func txPutScheduledMessage(b storage.Bucket, msg *ScheduledMessage) error {
+	id, err := newScheduledMessageID(msg.SendAt)
+	if err != nil {
+		return err
+	}
+
+	uid, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	msg.ID = id
+	msg.UID = uint32(uid)
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(id), data)
+}
+
+// GetScheduledMessagesNextUID returns the UID the next message scheduled to
+// be sent gets.
+func (store *Store) GetScheduledMessagesNextUID() (uid uint32, err error) {
+	err = store.db.View(func(tx storage.Tx) error {
+		uid = uint32(tx.Bucket(outboxBucket).Sequence()) + 1
+		return nil
+	})
+	return
+}
+
+// GetScheduledMessages returns all messages in the outbox sorted by the time
+// they are sent at.
+func (store *Store) GetScheduledMessages() ([]*ScheduledMessage, error) {
+	return store.getScheduledMessages(time.Time{})
+}
+
+// GetDueScheduledMessages returns messages in the outbox which should be sent
+// at the given time or sooner.
+func (store *Store) GetDueScheduledMessages(now time.Time) ([]*ScheduledMessage, error) {
+	return store.getScheduledMessages(now)
+}
+
+func (store *Store) getScheduledMessages(until time.Time) (msgs []*ScheduledMessage, err error) {
+	err = store.db.View(func(tx storage.Tx) error {
+		return tx.Bucket(outboxBucket).ForEach(func(k, v []byte) error {
+			msg := &ScheduledMessage{}
+			if err := json.Unmarshal(v, msg); err != nil {
+				return err
+			}
+			if !until.IsZero() && msg.SendAt.After(until) {
+				return nil
+			}
+			msgs = append(msgs, msg)
+			return nil
+		})
+	})
+	return
+}
+
+// IncrementScheduledMessageAttempts records failed attempt to send the message
+// and returns the number of attempts so far.
+func (store *Store) IncrementScheduledMessageAttempts(id, lastError string) (attempts int, err error) {
+	err = store.updateScheduledMessage(id, func(msg *ScheduledMessage) {
+		msg.Attempts++
+		msg.LastError = lastError
+		attempts = msg.Attempts
+	})
+	return
+}
+
+// SetScheduledMessageError records why the message was not sent without
+// counting it as an attempt, e.g. when API is not reachable.
+func (store *Store) SetScheduledMessageError(id, lastError string) error {
+	return store.updateScheduledMessage(id, func(msg *ScheduledMessage) {
+		msg.LastError = lastError
+	})
+}
+
+func (store *Store) updateScheduledMessage(id string, update func(*ScheduledMessage)) error {
+	return store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(outboxBucket)
+
+		data := b.Get([]byte(id))
+		if data == nil {
+			return ErrNoSuchScheduledMessage
+		}
+
+		msg := &ScheduledMessage{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			return err
+		}
+		update(msg)
+
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), data)
+	})
+}
+
+// RemoveScheduledMessage removes the message from the outbox.
+func (store *Store) RemoveScheduledMessage(id string) error {
+	return store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(outboxBucket).Delete([]byte(id))
+	})
+}
+
+// newScheduledMessageID returns random ID starting with the time so messages
+// in the outbox are ordered by the time they are sent at.
+func newScheduledMessageID(sendAt time.Time) (string, error) {
+	id := make([]byte, 16)
+	binary.BigEndian.PutUint64(id, uint64(sendAt.Unix()))
+	if _, err := rand.Read(id[8:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
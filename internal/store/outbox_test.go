@@ -0,0 +1,128 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	key, err := crypto.GenerateKey("user", "user@pm.me", "x25519", 0)
+	require.NoError(t, err)
+	kr, err := crypto.NewKeyRing(key)
+	require.NoError(t, err)
+
+	now := time.Now()
+	laterID, err := m.store.ScheduleMessage(kr, now.Add(time.Hour), "user@pm.me", []string{"a@pm.me"}, []byte("Subject: later\r\n\r\nLater\r\n"))
+	require.NoError(t, err)
+	soonID, err := m.store.ScheduleMessage(kr, now.Add(time.Minute), "user@pm.me", []string{"b@pm.me"}, []byte("Subject: soon\r\n\r\nSoon\r\n"))
+	require.NoError(t, err)
+
+	msgs, err := m.store.GetScheduledMessages()
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	require.Equal(t, soonID, msgs[0].ID)
+	require.Equal(t, laterID, msgs[1].ID)
+	require.NotContains(t, string(msgs[0].Body), "Soon")
+
+	body, err := msgs[0].Decrypt(kr)
+	require.NoError(t, err)
+	require.Equal(t, "Subject: soon\r\n\r\nSoon\r\n", string(body))
+
+	due, err := m.store.GetDueScheduledMessages(now.Add(10 * time.Minute))
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	require.Equal(t, soonID, due[0].ID)
+	require.Equal(t, []string{"b@pm.me"}, due[0].To)
+
+	attempts, err := m.store.IncrementScheduledMessageAttempts(soonID, "first")
+	require.NoError(t, err)
+	require.Equal(t, 1, attempts)
+	require.NoError(t, m.store.SetScheduledMessageError(soonID, "offline"))
+	attempts, err = m.store.IncrementScheduledMessageAttempts(soonID, "second")
+	require.NoError(t, err)
+	require.Equal(t, 2, attempts)
+
+	due, err = m.store.GetDueScheduledMessages(now.Add(10 * time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 2, due[0].Attempts)
+	require.Equal(t, "second", due[0].LastError)
+
+	require.NoError(t, m.store.RemoveScheduledMessage(soonID))
+	_, err = m.store.IncrementScheduledMessageAttempts(soonID, "third")
+	require.Equal(t, ErrNoSuchScheduledMessage, err)
+	require.Equal(t, ErrNoSuchScheduledMessage, m.store.SetScheduledMessageError(soonID, "offline"))
+
+	msgs, err = m.store.GetScheduledMessages()
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, laterID, msgs[0].ID)
+}
+
+func TestOutboxReschedule(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	key, err := crypto.GenerateKey("user", "user@pm.me", "x25519", 0)
+	require.NoError(t, err)
+	kr, err := crypto.NewKeyRing(key)
+	require.NoError(t, err)
+
+	now := time.Now()
+	id, err := m.store.ScheduleMessage(kr, now.Add(time.Hour), "user@pm.me", []string{"a@pm.me"}, []byte("Subject: later\r\n\r\nLater\r\n"))
+	require.NoError(t, err)
+	require.NoError(t, m.store.SetScheduledMessageError(id, "offline"))
+
+	nextUID, err := m.store.GetScheduledMessagesNextUID()
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), nextUID)
+
+	copyID, copyUID, err := m.store.CopyScheduledMessage(id, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), copyUID)
+
+	newID, newUID, err := m.store.RescheduleMessage(id, now)
+	require.NoError(t, err)
+	require.NotEqual(t, id, newID)
+	require.Equal(t, uint32(3), newUID)
+
+	_, _, err = m.store.RescheduleMessage(id, now)
+	require.Equal(t, ErrNoSuchScheduledMessage, err)
+
+	msgs, err := m.store.GetScheduledMessages()
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	require.Equal(t, newID, msgs[0].ID)
+	require.Equal(t, "", msgs[0].LastError)
+	require.Equal(t, copyID, msgs[1].ID)
+
+	body, err := msgs[0].Decrypt(kr)
+	require.NoError(t, err)
+	require.Equal(t, "Subject: later\r\n\r\nLater\r\n", string(body))
+}
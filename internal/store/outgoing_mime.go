@@ -0,0 +1,71 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+)
+
+// MIME types forced for outgoing messages when they are packaged for sending.
+const (
+	// OutgoingMIMEClient keeps the MIME type the client composed the message with.
+	OutgoingMIMEClient = "client"
+	// OutgoingMIMEPlain sends all messages as plain text.
+	OutgoingMIMEPlain = "plain"
+	// OutgoingMIMEHTML sends all messages as HTML.
+	OutgoingMIMEHTML = "html"
+)
+
+// OutgoingMIMETypes lists all supported MIME types of outgoing messages.
+var OutgoingMIMETypes = []string{OutgoingMIMEClient, OutgoingMIMEPlain, OutgoingMIMEHTML} //nolint[gochecknoglobals]
+
+// GetOutgoingMIMEType returns which MIME type is used for outgoing messages.
+func (store *Store) GetOutgoingMIMEType() (mode string) {
+	mode = OutgoingMIMEClient
+	_ = store.db.View(func(tx storage.Tx) error {
+		if dbMode := tx.Bucket(outgoingMIMEBucket).Get([]byte(modeKey)); dbMode != nil {
+			mode = string(dbMode)
+		}
+		return nil
+	})
+	return
+}
+
+// SetOutgoingMIMEType sets which MIME type is used for outgoing messages.
+// It applies to messages sent from now on.
+func (store *Store) SetOutgoingMIMEType(mode string) error {
+	if !isOutgoingMIMEType(mode) {
+		return fmt.Errorf("unknown outgoing MIME type %q, use one of: %v", mode, strings.Join(OutgoingMIMETypes, ", "))
+	}
+
+	return store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(outgoingMIMEBucket).Put([]byte(modeKey), []byte(mode))
+	})
+}
+
+func isOutgoingMIMEType(mode string) bool {
+	for _, supported := range OutgoingMIMETypes {
+		if mode == supported {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// PhishingOptions configures checking of links of received messages of all
+// stores.
+type PhishingOptions struct {
+	Checker *message.LinkChecker // Nil disables checking.
+}
+
+var (
+	phishingOptions     PhishingOptions //nolint[gochecknoglobals]
+	phishingOptionsLock sync.RWMutex    //nolint[gochecknoglobals]
+)
+
+// SetPhishingOptions sets the checker of links used by all stores.
+func SetPhishingOptions(options PhishingOptions) {
+	phishingOptionsLock.Lock()
+	defer phishingOptionsLock.Unlock()
+
+	phishingOptions = options
+}
+
+func getPhishingOptions() PhishingOptions {
+	phishingOptionsLock.RLock()
+	defer phishingOptionsLock.RUnlock()
+
+	return phishingOptions
+}
+
+// checkPhishing checks links of the received message in the background, so
+// the score is ready before clients fetch the message.
+func (loop *eventLoop) checkPhishing(msg *pmapi.Message) {
+	if getPhishingOptions().Checker == nil || !shouldCheckPhishing(msg) {
+		return
+	}
+
+	go func() {
+		defer loop.store.panicHandler.HandlePanic()
+		loop.store.checkPhishing(msg.ID)
+	}()
+}
+
+// checkPhishing fetches and decrypts the message and saves the score of its
+// links. Message is fetched by API, so it must not be called from the event
+// loop itself.
+func (store *Store) checkPhishing(apiID string) {
+	if _, ok := store.loadPhishingResult(apiID); ok {
+		return
+	}
+
+	log := store.log.WithField("msgID", apiID)
+
+	msg, err := store.client().GetMessage(store.ctx, apiID)
+	if err != nil {
+		log.WithError(err).Warn("Cannot get message to check links")
+		return
+	}
+	kr, err := store.client().KeyRingForAddressID(msg.AddressID)
+	if err != nil {
+		log.WithError(err).Warn("Cannot get keys to check links")
+		return
+	}
+	if err := msg.Decrypt(kr); err != nil {
+		log.WithError(err).Warn("Cannot decrypt message to check links")
+		return
+	}
+
+	store.GetPhishingResult(msg)
+}
+
+// GetPhishingResult returns the score of links of the message. The saved
+// score is returned when the message was checked already, otherwise links
+// of the decrypted body are checked and the score is saved. False is
+// returned when checking is disabled, the message was not received or the
+// body is still encrypted.
+func (store *Store) GetPhishingResult(msg *pmapi.Message) (message.PhishingResult, bool) {
+	checker := getPhishingOptions().Checker
+	if checker == nil || !shouldCheckPhishing(msg) {
+		return message.PhishingResult{}, false
+	}
+	if result, ok := store.loadPhishingResult(msg.ID); ok {
+		return result, true
+	}
+	if msg.IsBodyEncrypted() {
+		return message.PhishingResult{}, false
+	}
+
+	result := checker.Check(msg.Body, msg.MIMEType == pmapi.ContentTypeHTML)
+	if result.IsSuspect() {
+		store.log.WithField("msgID", msg.ID).WithField("score", result.Score).WithField("reasons", result.Reasons).Warn("Message has suspect links")
+	}
+
+	if err := store.savePhishingResult(msg.ID, result); err != nil {
+		store.log.WithError(err).WithField("msgID", msg.ID).Warn("Cannot save score of links")
+	}
+	return result, true
+}
+
+// shouldCheckPhishing returns whether the message was received. Unlike local
+// rules, messages in Spam are checked as well.
+func shouldCheckPhishing(msg *pmapi.Message) bool {
+	return msg.Flags&pmapi.FlagReceived != 0 && !msg.IsDraft()
+}
+
+func (store *Store) loadPhishingResult(apiID string) (result message.PhishingResult, ok bool) {
+	_ = store.db.View(func(tx storage.Tx) error {
+		data := tx.Bucket(phishingBucket).Get([]byte(apiID))
+		ok = data != nil && json.Unmarshal(data, &result) == nil
+		return nil
+	})
+	return
+}
+
+func (store *Store) savePhishingResult(apiID string, result message.PhishingResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(phishingBucket).Put([]byte(apiID), data)
+	})
+}
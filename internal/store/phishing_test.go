@@ -0,0 +1,61 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPhishingResult(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	msg := &pmapi.Message{
+		ID:       "msg1",
+		Flags:    pmapi.FlagReceived,
+		MIMEType: pmapi.ContentTypeHTML,
+		Body:     `<a href="https://evil.net/">https://www.paypal.com</a>`,
+	}
+
+	_, ok := m.store.GetPhishingResult(msg)
+	require.False(t, ok, "checking is disabled")
+
+	SetPhishingOptions(PhishingOptions{Checker: message.NewLinkChecker(nil)})
+	defer SetPhishingOptions(PhishingOptions{})
+
+	want := message.PhishingResult{Score: 50, Reasons: []string{message.PhishingLinkText}}
+	result, ok := m.store.GetPhishingResult(msg)
+	require.True(t, ok)
+	require.Equal(t, want, result)
+
+	// The saved score is used even when the body is encrypted again.
+	msg.Body = "-----BEGIN PGP MESSAGE-----"
+	result, ok = m.store.GetPhishingResult(msg)
+	require.True(t, ok)
+	require.Equal(t, want, result)
+
+	sent := &pmapi.Message{ID: "msg2", Flags: pmapi.FlagSent, Body: "https://paypa1.com"}
+	_, ok = m.store.GetPhishingResult(sent)
+	require.False(t, ok, "sent messages are not checked")
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+)
+
+// Limits of the plugin storage. It is meant for small state of companion
+// tools, not for data which should be in messages.
+const (
+	maxPluginNameLength = 128
+	maxPluginKeyLength  = 256
+	maxPluginValueSize  = 64 * 1024
+	maxPluginKeys       = 1024
+)
+
+var (
+	// ErrNoSuchPluginValue when plugin did not store the key.
+	ErrNoSuchPluginValue = errors.New("no such plugin value") //nolint[gochecknoglobals]
+
+	// ErrInvalidPluginKey when plugin name or key is empty or too long.
+	ErrInvalidPluginKey = errors.New("invalid plugin name or key") //nolint[gochecknoglobals]
+
+	// ErrPluginLimitReached when value is too big or plugin has too many keys.
+	ErrPluginLimitReached = errors.New("plugin storage limit reached") //nolint[gochecknoglobals]
+)
+
+// GetPluginValue returns decrypted value stored by the plugin under the key.
+func (store *Store) GetPluginValue(kr *crypto.KeyRing, plugin, key string) ([]byte, error) {
+	if err := checkPluginKey(plugin, key); err != nil {
+		return nil, err
+	}
+
+	var encrypted []byte
+	err := store.db.View(func(tx storage.Tx) error {
+		b := tx.Bucket(pluginsBucket).Bucket([]byte(plugin))
+		if b == nil {
+			return ErrNoSuchPluginValue
+		}
+		if data := b.Get([]byte(key)); data != nil {
+			encrypted = append([]byte{}, data...)
+			return nil
+		}
+		return ErrNoSuchPluginValue
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := kr.Decrypt(crypto.NewPGPMessage(encrypted), nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return plain.GetBinary(), nil
+}
+
+// SetPluginValue stores the value of the plugin under the key. The value is
+// kept encrypted by the key ring.
+func (store *Store) SetPluginValue(kr *crypto.KeyRing, plugin, key string, value []byte) error {
+	if err := checkPluginKey(plugin, key); err != nil {
+		return err
+	}
+	if len(value) > maxPluginValueSize {
+		return ErrPluginLimitReached
+	}
+
+	encrypted, err := kr.Encrypt(crypto.NewPlainMessage(value), nil)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(tx storage.Tx) error {
+		b, err := tx.Bucket(pluginsBucket).CreateBucketIfNotExists([]byte(plugin))
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(key)) == nil && b.KeyN() >= maxPluginKeys {
+			return ErrPluginLimitReached
+		}
+		return b.Put([]byte(key), encrypted.GetBinary())
+	})
+}
+
+// DeletePluginValue removes the key of the plugin.
+func (store *Store) DeletePluginValue(plugin, key string) error {
+	if err := checkPluginKey(plugin, key); err != nil {
+		return err
+	}
+
+	return store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(pluginsBucket).Bucket([]byte(plugin))
+		if b == nil || b.Get([]byte(key)) == nil {
+			return ErrNoSuchPluginValue
+		}
+		if err := b.Delete([]byte(key)); err != nil {
+			return err
+		}
+		if b.KeyN() == 0 {
+			return tx.Bucket(pluginsBucket).DeleteBucket([]byte(plugin))
+		}
+		return nil
+	})
+}
+
+// GetPluginKeys returns sorted keys stored by the plugin.
+func (store *Store) GetPluginKeys(plugin string) (keys []string, err error) {
+	if err := checkPluginKey(plugin, "-"); err != nil {
+		return nil, err
+	}
+
+	err = store.db.View(func(tx storage.Tx) error {
+		b := tx.Bucket(pluginsBucket).Bucket([]byte(plugin))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	sort.Strings(keys)
+	return
+}
+
+func checkPluginKey(plugin, key string) error {
+	if plugin == "" || len(plugin) > maxPluginNameLength || key == "" || len(key) > maxPluginKeyLength {
+		return ErrInvalidPluginKey
+	}
+	return nil
+}
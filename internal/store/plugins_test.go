@@ -0,0 +1,80 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginValues(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	key, err := crypto.GenerateKey("user", "user@pm.me", "x25519", 0)
+	require.NoError(t, err)
+	kr, err := crypto.NewKeyRing(key)
+	require.NoError(t, err)
+
+	_, err = m.store.GetPluginValue(kr, "notifier", "last")
+	require.Equal(t, ErrNoSuchPluginValue, err)
+
+	require.NoError(t, m.store.SetPluginValue(kr, "notifier", "last", []byte("msg1")))
+	require.NoError(t, m.store.SetPluginValue(kr, "notifier", "cursor", []byte("10")))
+	require.NoError(t, m.store.SetPluginValue(kr, "crm", "last", []byte("other")))
+
+	value, err := m.store.GetPluginValue(kr, "notifier", "last")
+	require.NoError(t, err)
+	require.Equal(t, []byte("msg1"), value)
+
+	keys, err := m.store.GetPluginKeys("notifier")
+	require.NoError(t, err)
+	require.Equal(t, []string{"cursor", "last"}, keys)
+
+	require.NoError(t, m.store.DeletePluginValue("notifier", "last"))
+	require.Equal(t, ErrNoSuchPluginValue, m.store.DeletePluginValue("notifier", "last"))
+	require.NoError(t, m.store.DeletePluginValue("notifier", "cursor"))
+	keys, err = m.store.GetPluginKeys("notifier")
+	require.NoError(t, err)
+	require.Empty(t, keys)
+
+	value, err = m.store.GetPluginValue(kr, "crm", "last")
+	require.NoError(t, err)
+	require.Equal(t, []byte("other"), value)
+}
+
+func TestPluginValueLimits(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	key, err := crypto.GenerateKey("user", "user@pm.me", "x25519", 0)
+	require.NoError(t, err)
+	kr, err := crypto.NewKeyRing(key)
+	require.NoError(t, err)
+
+	require.Equal(t, ErrInvalidPluginKey, m.store.SetPluginValue(kr, "", "key", nil))
+	require.Equal(t, ErrInvalidPluginKey, m.store.SetPluginValue(kr, "plugin", strings.Repeat("k", maxPluginKeyLength+1), nil))
+	require.Equal(t, ErrPluginLimitReached, m.store.SetPluginValue(kr, "plugin", "key", make([]byte, maxPluginValueSize+1)))
+}
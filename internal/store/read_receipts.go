@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+)
+
+// AddReadReceipt marks the message `receiptID` as read receipt and the
+// message it is for, identified by its Message-Id, as read by the recipient.
+// Both are marked by keywords so clients can show the read state.
+func (store *Store) AddReadReceipt(receiptID, originalExternalID string) error {
+	for _, keyword := range store.GetKeywords(receiptID) {
+		if keyword == message.ReadReceiptFlag {
+			return nil
+		}
+	}
+
+	if err := store.AddKeyword([]string{receiptID}, message.ReadReceiptFlag); err != nil {
+		return err
+	}
+	store.notifyLocalFlagsChanged(receiptID)
+
+	originalExternalID = normalizeExternalID(originalExternalID)
+	originalID := store.FindSentMessage(originalExternalID, "")
+	if originalID == "" {
+		originalID = store.findMessageByExternalID(originalExternalID)
+	}
+	if originalID == "" {
+		store.log.WithField("externalID", originalExternalID).Debug("Message of read receipt not found")
+		return nil
+	}
+
+	if err := store.AddKeyword([]string{originalID}, message.MDNReceivedFlag); err != nil {
+		return err
+	}
+	store.notifyLocalFlagsChanged(originalID)
+	return nil
+}
+
+// findMessageByExternalID returns API ID of the message with the external ID
+// (without '<>') or empty string.
+func (store *Store) findMessageByExternalID(externalID string) (apiID string) {
+	if externalID == "" {
+		return ""
+	}
+	matchExternalID := externalIDMatcher(externalID)
+
+	_ = store.db.View(func(tx storage.Tx) error {
+		c := tx.Bucket(metadataBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if matchExternalID.Match(v) {
+				apiID = string(k)
+				break
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// notifyLocalFlagsChanged sends IMAP update with flags of the message to
+// all mailboxes which contain it.
+func (store *Store) notifyLocalFlagsChanged(apiID string) {
+	store.lock.RLock()
+	addresses := make([]*Address, 0, len(store.addresses))
+	for _, address := range store.addresses {
+		addresses = append(addresses, address)
+	}
+	store.lock.RUnlock()
+
+	_ = store.db.View(func(tx storage.Tx) error {
+		msg, err := store.txGetMessage(tx, apiID)
+		if err != nil {
+			return nil
+		}
+
+		for _, address := range addresses {
+			for _, labelID := range msg.LabelIDs {
+				mailbox, err := address.getMailboxByID(labelID)
+				if err != nil {
+					continue
+				}
+				uidb := mailbox.txGetAPIIDsBucket(tx).Get([]byte(apiID))
+				if uidb == nil {
+					continue
+				}
+				seqNum, err := mailbox.txGetSequenceNumberOfUID(mailbox.txGetIMAPIDsBucket(tx), uidb)
+				if err != nil {
+					continue
+				}
+				store.imapUpdateMessage(address.address, mailbox.labelName, btoi(uidb), seqNum, msg, mailbox.txGetLocalFlags(tx, apiID))
+			}
+		}
+		return nil
+	})
+}
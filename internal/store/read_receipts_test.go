@@ -0,0 +1,56 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddReadReceipt(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	original := getTestMessage("original", "Hello", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.SentLabel})
+	original.ExternalID = "<hello@example.com>"
+	require.NoError(t, m.store.createOrUpdateMessageEvent(original))
+	insertMessage(t, m, "sent", "Sent via bridge", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.SentLabel})
+	require.NoError(t, m.store.AddSentMessage("<sent@example.com>", "fingerprint", "sent"))
+	insertMessage(t, m, "receipt1", "Read: Hello", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "receipt2", "Read: Sent", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "receipt3", "Read: Unknown", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	require.NoError(t, m.store.AddReadReceipt("receipt1", "<hello@example.com>"))
+	require.NoError(t, m.store.AddReadReceipt("receipt2", "<sent@example.com>"))
+	require.NoError(t, m.store.AddReadReceipt("receipt3", "<unknown@example.com>"))
+
+	require.Equal(t, []string{message.ReadReceiptFlag}, m.store.GetKeywords("receipt1"))
+	require.Equal(t, []string{message.ReadReceiptFlag}, m.store.GetKeywords("receipt3"))
+	require.Equal(t, []string{message.MDNReceivedFlag}, m.store.GetKeywords("original"))
+	require.Equal(t, []string{message.MDNReceivedFlag}, m.store.GetKeywords("sent"))
+
+	// Receipt already processed is not processed again.
+	require.NoError(t, m.store.RemoveKeyword([]string{"original"}, message.MDNReceivedFlag))
+	require.NoError(t, m.store.AddReadReceipt("receipt1", "<hello@example.com>"))
+	require.Nil(t, m.store.GetKeywords("original"))
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+)
+
+const proxyURLKey = "proxy_url"
+
+// GetRemoteContentFilter returns how remote content of HTML bodies of built
+// messages is filtered. Remote content is allowed by default.
+func (store *Store) GetRemoteContentFilter() (filter message.RemoteContentFilter) {
+	filter.Mode = message.RemoteContentAllow
+	_ = store.db.View(func(tx storage.Tx) error {
+		b := tx.Bucket(remoteContentBucket)
+		if mode := b.Get([]byte(modeKey)); mode != nil {
+			filter.Mode = message.RemoteContentMode(mode)
+		}
+		filter.ProxyURL = string(b.Get([]byte(proxyURLKey)))
+		return nil
+	})
+	return
+}
+
+// SetRemoteContentFilter sets how remote content of HTML bodies is filtered.
+// Built messages in the cache are removed so the filter applies to messages
+// fetched from now on.
+func (store *Store) SetRemoteContentFilter(filter message.RemoteContentFilter) error {
+	if err := validateRemoteContentFilter(filter); err != nil {
+		return err
+	}
+
+	if err := store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(remoteContentBucket)
+		if err := b.Put([]byte(modeKey), []byte(filter.Mode)); err != nil {
+			return err
+		}
+		return b.Put([]byte(proxyURLKey), []byte(filter.ProxyURL))
+	}); err != nil {
+		return err
+	}
+
+	if store.messageCache != nil {
+		if err := store.messageCache.RemoveUser(store.UserID()); err != nil {
+			store.log.WithError(err).Warn("Cannot remove cached messages")
+		}
+	}
+	return nil
+}
+
+func validateRemoteContentFilter(filter message.RemoteContentFilter) error {
+	known := false
+	for _, mode := range message.RemoteContentModes {
+		known = known || filter.Mode == mode
+	}
+	if !known {
+		return fmt.Errorf("unknown remote content mode %q", filter.Mode)
+	}
+
+	if filter.Mode != message.RemoteContentProxy {
+		return nil
+	}
+	proxyURL, err := url.Parse(filter.ProxyURL)
+	if err != nil || (proxyURL.Scheme != "https" && proxyURL.Scheme != "http") || proxyURL.Host == "" {
+		return fmt.Errorf("proxy URL %q must be an absolute http or https URL", filter.ProxyURL)
+	}
+	return nil
+}
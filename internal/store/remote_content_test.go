@@ -0,0 +1,47 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteContentFilter(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.Equal(t, message.RemoteContentFilter{Mode: message.RemoteContentAllow}, m.store.GetRemoteContentFilter())
+
+	block := message.RemoteContentFilter{Mode: message.RemoteContentBlock}
+	require.NoError(t, m.store.SetRemoteContentFilter(block))
+	require.Equal(t, block, m.store.GetRemoteContentFilter())
+
+	proxy := message.RemoteContentFilter{Mode: message.RemoteContentProxy, ProxyURL: "https://proxy.example.com/?url="}
+	require.NoError(t, m.store.SetRemoteContentFilter(proxy))
+	require.Equal(t, proxy, m.store.GetRemoteContentFilter())
+
+	require.Error(t, m.store.SetRemoteContentFilter(message.RemoteContentFilter{Mode: "strip"}))
+	require.Error(t, m.store.SetRemoteContentFilter(message.RemoteContentFilter{Mode: message.RemoteContentProxy}))
+	require.Error(t, m.store.SetRemoteContentFilter(message.RemoteContentFilter{Mode: message.RemoteContentProxy, ProxyURL: "ftp://proxy.example.com/"}))
+	require.Equal(t, proxy, m.store.GetRemoteContentFilter())
+}
@@ -0,0 +1,385 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/archive"
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// Actions of retention policies.
+const (
+	// RetentionDelete moves old messages to Trash. Messages in Trash and
+	// Spam are deleted permanently.
+	RetentionDelete = "delete"
+
+	// RetentionArchive writes old messages to the local Maildir archive
+	// first and then deletes them the same way as RetentionDelete.
+	RetentionArchive = "archive"
+)
+
+const (
+	// retentionInterval is how often policies are applied.
+	retentionInterval = 6 * time.Hour
+
+	// maxRetentionLogEntries is how many entries of the audit log are kept.
+	maxRetentionLogEntries = 1000
+)
+
+// RetentionPolicy removes messages older than MaxAge from the mailbox.
+type RetentionPolicy struct {
+	Mailbox string // IMAP name, e.g. `Labels/Newsletters`.
+	Action  string
+	MaxAge  time.Duration
+}
+
+// RetentionOptions configures retention policies of all stores.
+type RetentionOptions struct {
+	Policies   []RetentionPolicy
+	ArchiveDir string // Each user has own Maildir in it.
+}
+
+// RetentionEntry is a record about one message removed by the policy.
+// Error is set when the message could not be removed.
+type RetentionEntry struct {
+	MessageID string
+	Mailbox   string
+	Action    string
+	Subject   string
+	Time      int64  // Unix time of the message.
+	AppliedAt int64  // Unix time when the policy was applied.
+	Error     string `json:",omitempty"`
+}
+
+var (
+	retentionOptions     RetentionOptions //nolint[gochecknoglobals]
+	retentionOptionsLock sync.RWMutex     //nolint[gochecknoglobals]
+)
+
+// SetRetentionOptions sets retention policies applied by all stores.
+func SetRetentionOptions(options RetentionOptions) {
+	retentionOptionsLock.Lock()
+	defer retentionOptionsLock.Unlock()
+
+	retentionOptions = options
+}
+
+func getRetentionOptions() RetentionOptions {
+	retentionOptionsLock.RLock()
+	defer retentionOptionsLock.RUnlock()
+
+	return retentionOptions
+}
+
+// ParseRetentionPolicies parses comma-separated policies in the format
+// `mailbox=action:days`, e.g. `Labels/Newsletters=delete:90`.
+func ParseRetentionPolicies(value string) (policies []RetentionPolicy, err error) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		sep := strings.LastIndex(item, "=")
+		if sep <= 0 {
+			return nil, fmt.Errorf("expected mailbox=action:days, got %q", item)
+		}
+
+		parts := strings.SplitN(item[sep+1:], ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected mailbox=action:days, got %q", item)
+		}
+
+		action := strings.TrimSpace(parts[0])
+		if action != RetentionDelete && action != RetentionArchive {
+			return nil, fmt.Errorf("unknown retention action %q", action)
+		}
+
+		days, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || days <= 0 {
+			return nil, fmt.Errorf("invalid number of days %q", parts[1])
+		}
+
+		policies = append(policies, RetentionPolicy{
+			Mailbox: strings.TrimSpace(item[:sep]),
+			Action:  action,
+			MaxAge:  time.Duration(days) * 24 * time.Hour,
+		})
+	}
+
+	return policies, nil
+}
+
+// FormatRetentionPolicies returns policies in the format accepted by
+// ParseRetentionPolicies.
+func FormatRetentionPolicies(policies []RetentionPolicy) string {
+	items := []string{}
+	for _, policy := range policies {
+		days := int(policy.MaxAge / (24 * time.Hour))
+		items = append(items, fmt.Sprintf("%s=%s:%d", policy.Mailbox, policy.Action, days))
+	}
+	return strings.Join(items, ",")
+}
+
+// ApplyRetention removes messages older than allowed by retention policies.
+// With dryRun it only returns messages which would be removed. Otherwise
+// the result is also written to the audit log, see GetRetentionLog.
+func (store *Store) ApplyRetention(now time.Time, dryRun bool) (entries []*RetentionEntry, err error) {
+	options := getRetentionOptions()
+
+	for _, policy := range options.Policies {
+		msgs, err := store.getRetentionCandidates(policy, now)
+		if err != nil {
+			return entries, err
+		}
+		if len(msgs) == 0 {
+			continue
+		}
+
+		policyEntries := []*RetentionEntry{}
+		for _, msg := range msgs {
+			policyEntries = append(policyEntries, &RetentionEntry{
+				MessageID: msg.ID,
+				Mailbox:   policy.Mailbox,
+				Action:    policy.Action,
+				Subject:   msg.Subject,
+				Time:      msg.Time,
+				AppliedAt: now.Unix(),
+			})
+		}
+
+		if !dryRun {
+			store.applyRetentionPolicy(policy, options.ArchiveDir, policyEntries)
+			if err := store.addRetentionLogEntries(policyEntries); err != nil {
+				store.log.WithError(err).Warn("Cannot write retention audit log")
+			}
+		}
+
+		entries = append(entries, policyEntries...)
+	}
+
+	return entries, nil
+}
+
+// getRetentionCandidates returns messages of the policy mailbox in all
+// addresses which are older than allowed. Policies of mailboxes which do
+// not exist in this account are skipped.
+func (store *Store) getRetentionCandidates(policy RetentionPolicy, now time.Time) (msgs []*pmapi.Message, err error) {
+	store.lock.RLock()
+	mailboxes := []*Mailbox{}
+	for _, address := range store.addresses {
+		for _, mailbox := range address.mailboxes {
+			if mailbox.labelName == policy.Mailbox {
+				mailboxes = append(mailboxes, mailbox)
+			}
+		}
+	}
+	store.lock.RUnlock()
+
+	if len(mailboxes) == 0 {
+		store.log.WithField("mailbox", policy.Mailbox).Debug("Skipping retention policy of missing mailbox")
+		return nil, nil
+	}
+
+	if mailboxes[0].labelID == pmapi.AllMailLabel {
+		return nil, ErrAllMailOpNotAllowed
+	}
+
+	before := now.Add(-policy.MaxAge).Unix()
+	seen := map[string]bool{}
+
+	for _, mailbox := range mailboxes {
+		apiIDs, err := mailbox.GetAPIIDsFromUIDRange(1, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, apiID := range apiIDs {
+			if seen[apiID] {
+				continue
+			}
+			seen[apiID] = true
+
+			msg, err := store.getMessageFromDB(apiID)
+			if err != nil {
+				return nil, err
+			}
+			if msg.Time < before {
+				msgs = append(msgs, msg)
+			}
+		}
+	}
+
+	return msgs, nil
+}
+
+// applyRetentionPolicy archives and deletes messages of entries. Errors are
+// recorded in the entries, so the rest of messages is still processed.
+func (store *Store) applyRetentionPolicy(policy RetentionPolicy, archiveDir string, entries []*RetentionEntry) {
+	if policy.Action == RetentionArchive {
+		store.archiveRetentionEntries(archiveDir, entries)
+	}
+
+	apiIDs := []string{}
+	for _, entry := range entries {
+		if entry.Error == "" {
+			apiIDs = append(apiIDs, entry.MessageID)
+		}
+	}
+	if len(apiIDs) == 0 {
+		return
+	}
+
+	var err error
+	if mailbox, mailboxErr := store.getMailbox(policy.Mailbox); mailboxErr != nil {
+		err = mailboxErr
+	} else if mailbox.labelID == pmapi.TrashLabel || mailbox.labelID == pmapi.SpamLabel {
+		if err = store.client().DeleteMessages(store.ctx, apiIDs); err == nil {
+			store.addTombstones(apiIDs)
+		}
+	} else {
+		err = store.client().LabelMessages(store.ctx, apiIDs, pmapi.TrashLabel)
+	}
+
+	if err != nil {
+		store.log.WithError(err).WithField("mailbox", policy.Mailbox).Error("Cannot apply retention policy")
+		for _, entry := range entries {
+			if entry.Error == "" {
+				entry.Error = err.Error()
+			}
+		}
+	}
+}
+
+func (store *Store) archiveRetentionEntries(archiveDir string, entries []*RetentionEntry) {
+	var a *archive.Archive
+	var err error
+
+	if archiveDir == "" {
+		err = errors.New("retention archive folder is not set")
+	} else {
+		a, err = archive.New(filepath.Join(archiveDir, filepath.Base(store.user.GetPrimaryAddress())), archive.FormatMaildir)
+	}
+
+	for _, entry := range entries {
+		if err == nil {
+			if exportErr := store.exportMessage(a, entry.Mailbox, entry.MessageID, ExportOptions{InlineAttachments: true}); exportErr != nil {
+				entry.Error = errors.Wrap(exportErr, "cannot archive message").Error()
+			}
+		} else {
+			entry.Error = err.Error()
+		}
+	}
+}
+
+// runRetentionIfDue applies retention policies in the background when they
+// were not applied for retentionInterval.
+func (store *Store) runRetentionIfDue(now time.Time) {
+	if len(getRetentionOptions().Policies) == 0 {
+		return
+	}
+
+	store.retentionLock.Lock()
+	defer store.retentionLock.Unlock()
+
+	if store.isRetentionRunning || now.Sub(store.lastRetention) < retentionInterval {
+		return
+	}
+	store.isRetentionRunning = true
+	store.lastRetention = now
+
+	go func() {
+		defer store.panicHandler.HandlePanic()
+		defer func() {
+			store.retentionLock.Lock()
+			store.isRetentionRunning = false
+			store.retentionLock.Unlock()
+		}()
+
+		entries, err := store.ApplyRetention(now, false)
+		if err != nil {
+			store.log.WithError(err).Error("Cannot apply retention policies")
+		}
+		if len(entries) > 0 {
+			store.log.WithField("messages", len(entries)).Info("Retention policies applied")
+		}
+	}()
+}
+
+func (store *Store) addRetentionLogEntries(entries []*RetentionEntry) error {
+	return store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(retentionLogBucket)
+
+		for _, entry := range entries {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+
+			// Keys are sorted by time of application.
+			key := fmt.Sprintf("%020d-%s", entry.AppliedAt, entry.MessageID)
+			if err := b.Put([]byte(key), data); err != nil {
+				return err
+			}
+		}
+
+		keys := [][]byte{}
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys = append(keys, k)
+		}
+
+		for i := 0; i < len(keys)-maxRetentionLogEntries; i++ {
+			if err := b.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetRetentionLog returns messages removed by retention policies, the most
+// recent first.
+func (store *Store) GetRetentionLog() (entries []*RetentionEntry, err error) {
+	err = store.db.View(func(tx storage.Tx) error {
+		return tx.Bucket(retentionLogBucket).ForEach(func(k, v []byte) error {
+			entry := &RetentionEntry{}
+			if err := json.Unmarshal(v, entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].AppliedAt > entries[j].AppliedAt
+	})
+	return
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetentionPolicies(t *testing.T) {
+	policies, err := ParseRetentionPolicies("Labels/Newsletters=delete:90, Folders/Receipts=archive:365,")
+	require.NoError(t, err)
+	require.Equal(t, []RetentionPolicy{
+		{Mailbox: "Labels/Newsletters", Action: RetentionDelete, MaxAge: 90 * 24 * time.Hour},
+		{Mailbox: "Folders/Receipts", Action: RetentionArchive, MaxAge: 365 * 24 * time.Hour},
+	}, policies)
+	require.Equal(t, "Labels/Newsletters=delete:90,Folders/Receipts=archive:365", FormatRetentionPolicies(policies))
+
+	for _, value := range []string{"INBOX", "INBOX=delete", "INBOX=move:10", "INBOX=delete:0", "=delete:10"} {
+		_, err := ParseRetentionPolicies(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	SetRetentionOptions(RetentionOptions{Policies: []RetentionPolicy{
+		{Mailbox: "Folders/Missing", Action: RetentionDelete, MaxAge: time.Hour},
+		{Mailbox: "INBOX", Action: RetentionDelete, MaxAge: 30 * 24 * time.Hour},
+	}})
+	defer SetRetentionOptions(RetentionOptions{})
+
+	now := time.Now()
+
+	oldMsg := getTestMessage("msg1", "Old", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	oldMsg.Time = now.Add(-40 * 24 * time.Hour).Unix()
+	require.NoError(t, m.store.createOrUpdateMessageEvent(oldMsg))
+
+	newMsg := getTestMessage("msg2", "New", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	newMsg.Time = now.Add(-10 * 24 * time.Hour).Unix()
+	require.NoError(t, m.store.createOrUpdateMessageEvent(newMsg))
+
+	entries, err := m.store.ApplyRetention(now, true)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "msg1", entries[0].MessageID)
+
+	log, err := m.store.GetRetentionLog()
+	require.NoError(t, err)
+	require.Empty(t, log)
+
+	m.client.EXPECT().LabelMessages(gomock.Any(), []string{"msg1"}, pmapi.TrashLabel).Return(nil)
+
+	_, err = m.store.ApplyRetention(now, false)
+	require.NoError(t, err)
+
+	log, err = m.store.GetRetentionLog()
+	require.NoError(t, err)
+	require.Len(t, log, 1)
+	require.Equal(t, "msg1", log[0].MessageID)
+	require.Equal(t, "Old", log[0].Subject)
+	require.Empty(t, log[0].Error)
+}
+
+func TestApplyRetentionArchiveWithoutFolder(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	SetRetentionOptions(RetentionOptions{Policies: []RetentionPolicy{
+		{Mailbox: "INBOX", Action: RetentionArchive, MaxAge: time.Hour},
+	}})
+	defer SetRetentionOptions(RetentionOptions{})
+
+	insertMessage(t, m, "msg1", "Old", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	// Message which could not be archived is not deleted.
+	entries, err := m.store.ApplyRetention(time.Now(), false)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "retention archive folder is not set", entries[0].Error)
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package rules provides local filter rules which bridge evaluates on
+// incoming messages. They are meant for filtering which cannot be done by
+// server-side filters or which users want to keep local.
+package rules
+
+import (
+	"encoding/json"
+	"io"
+	"net/mail"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// Rule applies its actions to messages matching all its conditions.
+// Conditions are case-insensitive substrings, except of the subject regular
+// expression; empty condition is ignored.
+type Rule struct {
+	Name string `json:"name"`
+
+	// Conditions.
+	From         string `json:"from,omitempty"`
+	To           string `json:"to,omitempty"`
+	Subject      string `json:"subject,omitempty"`
+	SubjectRegex string `json:"subjectRegex,omitempty"`
+	ListID       string `json:"listId,omitempty"` // Value of the List-Id header.
+
+	// Actions.
+	Label    string `json:"label,omitempty"` // Name of the IMAP mailbox, e.g. `Folders/News`.
+	MarkRead bool   `json:"markRead,omitempty"`
+	Flag     bool   `json:"flag,omitempty"` // Star the message.
+	Notify   bool   `json:"notify,omitempty"`
+	Hook     string `json:"hook,omitempty"` // Path of the executable to run.
+
+	// Stop prevents evaluation of the following rules.
+	Stop bool `json:"stop,omitempty"`
+
+	subjectRegex *regexp.Regexp
+}
+
+// Load reads the rules from the JSON file. No rules are returned when the
+// file does not exist.
+func Load(path string) ([]*Rule, error) {
+	f, err := os.Open(path) //nolint[gosec]
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint[errcheck]
+
+	return Parse(f)
+}
+
+// Parse reads the rules from JSON array.
+func Parse(r io.Reader) (rules []*Rule, err error) {
+	if err = json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, errors.Wrap(err, "failed to parse rules")
+	}
+
+	for i, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid rule %d", i+1)
+		}
+	}
+
+	return rules, nil
+}
+
+func (rule *Rule) validate() error {
+	if rule == nil {
+		return errors.New("rule is empty")
+	}
+	if rule.Name == "" {
+		return errors.New("rule has no name")
+	}
+	// Rule without conditions would apply to every message.
+	if rule.From == "" && rule.To == "" && rule.Subject == "" && rule.SubjectRegex == "" && rule.ListID == "" {
+		return errors.New("rule has no condition")
+	}
+	if rule.Label == "" && !rule.MarkRead && !rule.Flag && !rule.Notify && rule.Hook == "" {
+		return errors.New("rule has no action")
+	}
+	if rule.SubjectRegex != "" {
+		var err error
+		if rule.subjectRegex, err = regexp.Compile(rule.SubjectRegex); err != nil {
+			return errors.Wrap(err, "invalid subject regular expression")
+		}
+	}
+	return nil
+}
+
+// Match returns whether the message matches all conditions of the rule.
+func (rule *Rule) Match(msg *pmapi.Message) bool {
+	if rule.From != "" && !matchAddresses(rule.From, []*mail.Address{msg.Sender}) {
+		return false
+	}
+	if rule.To != "" && !matchAddresses(rule.To, append(append([]*mail.Address{}, msg.ToList...), msg.CCList...)) {
+		return false
+	}
+	if rule.Subject != "" && !contains(msg.Subject, rule.Subject) {
+		return false
+	}
+	if rule.subjectRegex != nil && !rule.subjectRegex.MatchString(msg.Subject) {
+		return false
+	}
+	if rule.ListID != "" && (msg.Header == nil || !contains(msg.Header.Get("List-Id"), rule.ListID)) {
+		return false
+	}
+	return true
+}
+
+// Evaluate returns rules matching the message in the order they should be
+// applied.
+func Evaluate(rules []*Rule, msg *pmapi.Message) (matched []*Rule) {
+	for _, rule := range rules {
+		if !rule.Match(msg) {
+			continue
+		}
+		matched = append(matched, rule)
+		if rule.Stop {
+			break
+		}
+	}
+	return
+}
+
+// NeedHeader returns whether any of the rules matches message headers which
+// are not always part of the message metadata.
+func NeedHeader(rules []*Rule) bool {
+	for _, rule := range rules {
+		if rule.ListID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAddresses(query string, addresses []*mail.Address) bool {
+	for _, address := range addresses {
+		if address == nil {
+			continue
+		}
+		if contains(address.Address, query) || contains(address.Name, query) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := Parse(strings.NewReader(`[
+		{"name": "News", "from": "news@example.com", "label": "Folders/News", "markRead": true, "stop": true},
+		{"name": "Boss", "subject": "urgent", "notify": true, "hook": "/usr/bin/true"}
+	]`))
+	require.NoError(t, err)
+	require.Equal(t, []*Rule{
+		{Name: "News", From: "news@example.com", Label: "Folders/News", MarkRead: true, Stop: true},
+		{Name: "Boss", Subject: "urgent", Notify: true, Hook: "/usr/bin/true"},
+	}, rules)
+}
+
+func TestParseInvalidRules(t *testing.T) {
+	testData := []string{
+		`{"name": "Not array"}`,
+		`[null]`,
+		`[{"from": "a@example.com", "notify": true}]`,
+		`[{"name": "No condition", "notify": true}]`,
+		`[{"name": "No action", "from": "a@example.com"}]`,
+		`[{"name": "Bad regex", "subjectRegex": "(", "flag": true}]`,
+	}
+
+	for _, data := range testData {
+		_, err := Parse(strings.NewReader(data))
+		require.Error(t, err, data)
+	}
+}
+
+func TestLoadMissingRules(t *testing.T) {
+	rules, err := Load("/does/not/exist/rules.json")
+	require.NoError(t, err)
+	require.Empty(t, rules)
+}
+
+func TestEvaluateRules(t *testing.T) {
+	msg := &pmapi.Message{
+		Subject: "URGENT: Quarterly reports",
+		Sender:  &mail.Address{Name: "Alice", Address: "alice@example.com"},
+		ToList:  []*mail.Address{{Address: "bob@pm.me"}},
+		CCList:  []*mail.Address{{Address: "team@pm.me"}},
+	}
+
+	sender := &Rule{Name: "sender", From: "ALICE", Notify: true}
+	recipient := &Rule{Name: "recipient", To: "team@", Notify: true}
+	both := &Rule{Name: "both", From: "alice", Subject: "invoice", Notify: true}
+	stop := &Rule{Name: "stop", Subject: "urgent", Notify: true, Stop: true}
+	afterStop := &Rule{Name: "after stop", From: "alice", Notify: true}
+
+	require.Equal(t, []*Rule{sender, recipient, stop}, Evaluate([]*Rule{sender, recipient, both, stop, afterStop}, msg))
+	require.Empty(t, Evaluate([]*Rule{both}, &pmapi.Message{}))
+}
+
+func TestEvaluateSubjectRegexAndListID(t *testing.T) {
+	rules, err := Parse(strings.NewReader(`[
+		{"name": "ticket", "subjectRegex": "^\\[#[0-9]+\\]", "flag": true},
+		{"name": "list", "listId": "golang-nuts.googlegroups.com", "label": "Folders/Go"}
+	]`))
+	require.NoError(t, err)
+
+	ticket := &pmapi.Message{Subject: "[#123] Printer is broken"}
+	require.Equal(t, rules[:1], Evaluate(rules, ticket))
+
+	list := &pmapi.Message{Subject: "Re: [#123] generics", Header: mail.Header{"List-Id": {"<Golang-Nuts.googlegroups.com>"}}}
+	require.Equal(t, rules[1:], Evaluate(rules, list))
+
+	require.Empty(t, Evaluate(rules, &pmapi.Message{Subject: "Hello"}))
+}
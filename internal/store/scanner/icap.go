@@ -0,0 +1,156 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultICAPPort is used when the URL has no port.
+const defaultICAPPort = "1344"
+
+// icapScanner sends the attachment as a response body to the RESPMOD
+// service of the ICAP server (RFC 3507).
+type icapScanner struct {
+	url  *url.URL
+	addr string
+}
+
+func newICAPScanner(target string) (*icapScanner, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid ICAP URL")
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("ICAP URL has no host")
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), defaultICAPPort)
+	}
+	return &icapScanner{url: u, addr: addr}, nil
+}
+
+func (s *icapScanner) Scan(name string, r io.Reader, size int64) (Result, error) {
+	conn, err := net.DialTimeout("tcp", s.addr, Timeout)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close() //nolint[errcheck]
+
+	if err := conn.SetDeadline(time.Now().Add(Timeout)); err != nil {
+		return Result{}, err
+	}
+
+	if err := s.writeRequest(conn, name, r, size); err != nil {
+		return Result{}, err
+	}
+
+	return readICAPResponse(bufio.NewReader(conn))
+}
+
+// writeRequest sends the whole attachment as one chunk read right from r.
+func (s *icapScanner) writeRequest(conn net.Conn, name string, r io.Reader, size int64) error {
+	resHeader := "HTTP/1.1 200 OK\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		fmt.Sprintf("Content-Disposition: attachment; filename=%q\r\n", name) +
+		fmt.Sprintf("Content-Length: %d\r\n\r\n", size)
+
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "RESPMOD %s ICAP/1.0\r\n", s.url.String())
+	fmt.Fprintf(w, "Host: %s\r\n", s.url.Host)
+	fmt.Fprintf(w, "Allow: 204\r\n")
+	fmt.Fprintf(w, "Encapsulated: res-hdr=0, res-body=%d\r\n\r\n", len(resHeader))
+	fmt.Fprint(w, resHeader)
+	if size > 0 {
+		fmt.Fprintf(w, "%x\r\n", size)
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return err
+		}
+		fmt.Fprint(w, "\r\n")
+	}
+	fmt.Fprint(w, "0\r\n\r\n")
+	return w.Flush()
+}
+
+// readICAPResponse reads the status and header of the response. 204 means
+// the content was not modified, i.e. it is clean. 200 with a header about
+// found infection means it is infected.
+func readICAPResponse(r *bufio.Reader) (Result, error) {
+	tp := textproto.NewReader(r)
+
+	line, err := tp.ReadLine()
+	if err != nil {
+		return Result{}, err
+	}
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "ICAP/") {
+		return Result{}, fmt.Errorf("invalid ICAP response %q", line)
+	}
+	code, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid ICAP response %q", line)
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return Result{}, err
+	}
+
+	switch code {
+	case 204:
+		return Result{}, nil
+	case 200:
+		return getICAPThreat(header), nil
+	default:
+		return Result{}, fmt.Errorf("ICAP server returned %q", line)
+	}
+}
+
+func getICAPThreat(header textproto.MIMEHeader) Result {
+	if threat := header.Get("X-Virus-ID"); threat != "" {
+		return Result{Infected: true, Threat: threat}
+	}
+
+	for _, key := range []string{"X-Infection-Found", "X-Violations-Found"} {
+		value := header.Get(key)
+		if value == "" {
+			continue
+		}
+		// E.g. `Type=0; Resolution=2; Threat=Eicar-Signature;`.
+		for _, field := range strings.Split(value, ";") {
+			if kv := strings.SplitN(strings.TrimSpace(field), "=", 2); len(kv) == 2 && kv[0] == "Threat" {
+				return Result{Infected: true, Threat: kv[1]}
+			}
+		}
+		return Result{Infected: true}
+	}
+
+	return Result{}
+}
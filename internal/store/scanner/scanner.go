@@ -0,0 +1,96 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package scanner provides scanning of decrypted attachments by an external
+// virus or content scanner, either a command or an ICAP server.
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Timeout is the time after which the scan is cancelled.
+const Timeout = 2 * time.Minute
+
+// Result of the scan. Threat is the name of the found threat if the scanner
+// reported it.
+type Result struct {
+	Infected bool
+	Threat   string
+}
+
+// Scanner scans the content of one attachment. The content of the size is
+// read from the reader, so big attachments are not held in memory.
+type Scanner interface {
+	Scan(name string, r io.Reader, size int64) (Result, error)
+}
+
+// New returns the scanner for the target, which is either an ICAP service
+// URL, e.g. `icap://localhost:1344/avscan`, or a command line, e.g.
+// `clamdscan --no-summary -`.
+func New(target string) (Scanner, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return nil, errors.New("scanner is not set")
+	}
+	if strings.HasPrefix(target, "icap://") {
+		return newICAPScanner(target)
+	}
+	return &commandScanner{args: strings.Fields(target)}, nil
+}
+
+// commandScanner runs the command with the attachment on its standard input
+// and its name in BRIDGE_ATTACHMENT_NAME. Exit code 0 means the attachment
+// is clean and 1 that it is infected, the same as ClamAV uses. The first
+// line of the output is taken as the name of the threat.
+type commandScanner struct {
+	args []string
+}
+
+func (s *commandScanner) Scan(name string, r io.Reader, _ int64) (Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.args[0], s.args[1:]...) //nolint[gosec]
+	cmd.Env = append(os.Environ(), "BRIDGE_ATTACHMENT_NAME="+name)
+	cmd.Stdin = r
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return Result{}, nil
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		threat, _ := bufio.NewReader(&stdout).ReadString('\n')
+		return Result{Infected: true, Threat: strings.TrimSpace(threat)}, nil
+	}
+
+	return Result{}, fmt.Errorf("scanner failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package scanner
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandScanner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "scanner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	script := filepath.Join(dir, "scan.sh")
+	require.NoError(t, ioutil.WriteFile(script, []byte(`#!/bin/sh
+if grep -q EICAR; then echo "Eicar-Test $BRIDGE_ATTACHMENT_NAME"; exit 1; fi
+if [ "$1" = "--fail" ]; then echo "no database" >&2; exit 2; fi
+exit 0
+`), 0700))
+
+	s, err := New(script)
+	require.NoError(t, err)
+
+	result, err := scanString(s, "clean.txt", "hello")
+	require.NoError(t, err)
+	require.Equal(t, Result{}, result)
+
+	result, err = scanString(s, "virus.com", "X5O...EICAR")
+	require.NoError(t, err)
+	require.Equal(t, Result{Infected: true, Threat: "Eicar-Test virus.com"}, result)
+
+	s, err = New(script + " --fail")
+	require.NoError(t, err)
+
+	_, err = scanString(s, "clean.txt", "hello")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no database")
+}
+
+func TestICAPScanner(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close() //nolint[errcheck]
+
+	go serveTestICAP(l)
+
+	s, err := New("icap://" + l.Addr().String() + "/avscan")
+	require.NoError(t, err)
+
+	result, err := scanString(s, "clean.txt", "hello")
+	require.NoError(t, err)
+	require.Equal(t, Result{}, result)
+
+	result, err = scanString(s, "virus.com", "X5O...EICAR")
+	require.NoError(t, err)
+	require.Equal(t, Result{Infected: true, Threat: "Eicar-Signature"}, result)
+}
+
+func scanString(s Scanner, name, data string) (Result, error) {
+	return s.Scan(name, strings.NewReader(data), int64(len(data)))
+}
+
+func TestNewScannerInvalid(t *testing.T) {
+	for _, target := range []string{"", "  ", "icap:///avscan"} {
+		_, err := New(target)
+		require.Error(t, err, target)
+	}
+}
+
+// serveTestICAP reports an infection when the body contains EICAR.
+func serveTestICAP(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		tp := textproto.NewReader(bufio.NewReader(conn))
+		line, _ := tp.ReadLine()
+		header, _ := tp.ReadMIMEHeader()
+		if !strings.HasPrefix(line, "RESPMOD icap://") || header.Get("Encapsulated") == "" {
+			_, _ = conn.Write([]byte("ICAP/1.0 400 Bad Request\r\n\r\n"))
+			_ = conn.Close()
+			continue
+		}
+
+		// Encapsulated HTTP header and chunked body up to the last chunk.
+		_, _ = tp.ReadMIMEHeader()
+		infected := false
+		for {
+			line, err := tp.ReadLine()
+			if err != nil || line == "0" {
+				break
+			}
+			if strings.Contains(line, "EICAR") {
+				infected = true
+			}
+		}
+
+		if infected {
+			_, _ = conn.Write([]byte("ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Signature;\r\n\r\n"))
+		} else {
+			_, _ = conn.Write([]byte("ICAP/1.0 204 No Content\r\n\r\n"))
+		}
+		_ = conn.Close()
+	}
+}
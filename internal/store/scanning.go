@@ -0,0 +1,110 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/scanner"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// ScanOptions configures scanning of attachments of all stores.
+type ScanOptions struct {
+	Scanner    scanner.Scanner // Nil disables scanning.
+	Quarantine string          // IMAP name of mailbox for infected messages, e.g. `Folders/Quarantine`.
+}
+
+var (
+	scanOptions     ScanOptions  //nolint[gochecknoglobals]
+	scanOptionsLock sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetScanOptions sets the scanner of attachments used by all stores.
+func SetScanOptions(options ScanOptions) {
+	scanOptionsLock.Lock()
+	defer scanOptionsLock.Unlock()
+
+	scanOptions = options
+}
+
+func getScanOptions() ScanOptions {
+	scanOptionsLock.RLock()
+	defer scanOptionsLock.RUnlock()
+
+	return scanOptions
+}
+
+// scanAttachment scans the decrypted attachment in the background. Infected
+// message gets InfectedFlag keyword and is moved to the quarantine mailbox.
+// The attachment of the size is read from the reader returned by open and
+// done is called once it is not needed anymore.
+func (store *Store) scanAttachment(messageID string, att *pmapi.Attachment, size int64, open func() (io.ReadCloser, error), done func()) {
+	options := getScanOptions()
+	if options.Scanner == nil {
+		done()
+		return
+	}
+
+	go func() {
+		defer store.panicHandler.HandlePanic()
+		defer done()
+
+		log := store.log.WithField("msgID", messageID).WithField("attID", att.ID)
+
+		r, err := open()
+		if err != nil {
+			log.WithError(err).Warn("Attachment cannot be scanned")
+			return
+		}
+		result, err := options.Scanner.Scan(att.Name, r, size)
+		_ = r.Close()
+		if err != nil {
+			log.WithError(err).Warn("Attachment cannot be scanned")
+			return
+		}
+		if !result.Infected {
+			return
+		}
+
+		log.WithField("threat", result.Threat).Warn("Scanner reported infected attachment")
+		if err := store.AddKeyword([]string{messageID}, message.InfectedFlag); err != nil {
+			log.WithError(err).Error("Cannot mark message as infected")
+		}
+		store.notifyLocalFlagsChanged(messageID)
+
+		if options.Quarantine != "" {
+			if err := store.quarantineMessage(messageID, options.Quarantine); err != nil {
+				log.WithError(err).Error("Cannot move infected message to quarantine")
+			}
+		}
+	}()
+}
+
+func (store *Store) quarantineMessage(messageID, quarantine string) error {
+	mailbox, err := store.getMailbox(quarantine)
+	if err != nil {
+		return err
+	}
+	if mailbox.labelID == pmapi.AllMailLabel {
+		return ErrAllMailOpNotAllowed
+	}
+	return store.client().LabelMessages(store.ctx, []string{messageID}, mailbox.labelID)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/scanner"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+type testScanner struct {
+	names chan string
+}
+
+func (s *testScanner) Scan(name string, r io.Reader, _ int64) (scanner.Result, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return scanner.Result{}, err
+	}
+	s.names <- name
+	if bytes.Contains(data, []byte("EICAR")) {
+		return scanner.Result{Infected: true, Threat: "Eicar"}, nil
+	}
+	return scanner.Result{}, nil
+}
+
+func TestScanAttachment(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Clean", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Infected", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	s := &testScanner{names: make(chan string, 2)}
+	SetScanOptions(ScanOptions{Scanner: s, Quarantine: "Spam"})
+	defer SetScanOptions(ScanOptions{})
+
+	moved := make(chan struct{})
+	m.client.EXPECT().LabelMessages(gomock.Any(), []string{"msg2"}, pmapi.SpamLabel).DoAndReturn(func(context.Context, []string, string) error {
+		close(moved)
+		return nil
+	})
+
+	done := make(chan struct{}, 2)
+	scan := func(messageID string, att *pmapi.Attachment, data string) {
+		open := func() (io.ReadCloser, error) { return ioutil.NopCloser(strings.NewReader(data)), nil }
+		m.store.scanAttachment(messageID, att, int64(len(data)), open, func() { done <- struct{}{} })
+	}
+	scan("msg1", &pmapi.Attachment{ID: "att1", Name: "hello.txt"}, "hello")
+	scan("msg2", &pmapi.Attachment{ID: "att2", Name: "virus.com"}, "X5O...EICAR")
+
+	names := []string{<-s.names, <-s.names}
+	require.ElementsMatch(t, []string{"hello.txt", "virus.com"}, names)
+	<-done
+	<-done
+
+	select {
+	case <-moved:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "infected message was not moved to quarantine")
+	}
+
+	require.Empty(t, m.store.GetKeywords("msg1"))
+	require.Equal(t, []string{message.InfectedFlag}, m.store.GetKeywords("msg2"))
+}
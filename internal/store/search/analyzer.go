@@ -0,0 +1,173 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package search provides full-text index of messages with analyzers
+// splitting text to terms according to the language of the mailbox.
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Languages of analyzers.
+const (
+	// LanguageDefault splits text to words without stemming.
+	LanguageDefault = "default"
+	// LanguageCJK indexes Chinese, Japanese and Korean text by bigrams.
+	LanguageCJK = "cjk"
+
+	LanguageEnglish = "english"
+	LanguageGerman  = "german"
+	LanguageFrench  = "french"
+	LanguageSpanish = "spanish"
+	LanguageItalian = "italian"
+)
+
+// Languages returns all supported languages of analyzers.
+func Languages() []string {
+	return []string{
+		LanguageDefault,
+		LanguageCJK,
+		LanguageEnglish,
+		LanguageGerman,
+		LanguageFrench,
+		LanguageSpanish,
+		LanguageItalian,
+	}
+}
+
+// Analyzer splits text to terms. The same analyzer has to be used for
+// indexing and for queries.
+type Analyzer struct {
+	language string
+	stemmer  func(string) string
+	bigrams  bool
+}
+
+// NewAnalyzer returns the analyzer for the language.
+func NewAnalyzer(language string) (*Analyzer, error) {
+	a := &Analyzer{language: language}
+
+	switch language {
+	case LanguageDefault:
+	case LanguageCJK:
+		a.bigrams = true
+	case LanguageEnglish:
+		a.stemmer = stemEnglish
+	case LanguageGerman:
+		a.stemmer = stemGerman
+	case LanguageFrench, LanguageSpanish, LanguageItalian:
+		a.stemmer = newSuffixStemmer(suffixes[language])
+	default:
+		return nil, fmt.Errorf("unknown search language %q", language)
+	}
+
+	return a, nil
+}
+
+// Language returns the language of the analyzer.
+func (a *Analyzer) Language() string {
+	return a.language
+}
+
+// Terms returns terms of the text. Words are lower-cased, diacritics are
+// removed and words are stemmed. Runs of CJK characters, which are not
+// separated by spaces, are split to overlapping bigrams by CJK analyzer
+// and to single characters by the others.
+func (a *Analyzer) Terms(text string) []string {
+	terms := []string{}
+
+	var word, cjk []rune
+
+	flush := func() {
+		if len(word) > 0 {
+			if term := a.normalizeWord(string(word)); term != "" {
+				terms = append(terms, term)
+			}
+			word = word[:0]
+		}
+		if len(cjk) > 0 {
+			terms = append(terms, a.splitCJK(cjk)...)
+			cjk = cjk[:0]
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			if len(word) > 0 {
+				flush()
+			}
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r):
+			if len(cjk) > 0 {
+				flush()
+			}
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return terms
+}
+
+func (a *Analyzer) normalizeWord(word string) string {
+	word = removeDiacritics(strings.ToLower(word))
+	if a.stemmer != nil {
+		word = a.stemmer(word)
+	}
+	return word
+}
+
+func (a *Analyzer) splitCJK(chars []rune) []string {
+	if !a.bigrams || len(chars) == 1 {
+		terms := make([]string, 0, len(chars))
+		for _, r := range chars {
+			terms = append(terms, string(r))
+		}
+		return terms
+	}
+
+	terms := make([]string, 0, len(chars)-1)
+	for i := 0; i < len(chars)-1; i++ {
+		terms = append(terms, string(chars[i:i+2]))
+	}
+	return terms
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// removeDiacritics is used only for non-CJK words because it would change
+// meaning of Japanese kana with voicing marks.
+func removeDiacritics(word string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	result, _, err := transform.String(t, word)
+	if err != nil {
+		return word
+	}
+	return strings.ReplaceAll(result, "ß", "ss")
+}
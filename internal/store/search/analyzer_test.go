@@ -0,0 +1,67 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzerTerms(t *testing.T) {
+	testData := []struct {
+		language string
+		text     string
+		want     []string
+	}{
+		{LanguageDefault, "Hello, World! Résumé 2020", []string{"hello", "world", "resume", "2020"}},
+		{LanguageDefault, "東京都", []string{"東", "京", "都"}},
+		{LanguageCJK, "東京都に住む", []string{"東京", "京都", "都に", "に住", "住む"}},
+		{LanguageCJK, "Meeting 会 today", []string{"meeting", "会", "today"}},
+		{LanguageCJK, "がぎ", []string{"がぎ"}},
+		{LanguageCJK, "한국어abc", []string{"한국", "국어", "abc"}},
+		{LanguageEnglish, "Meetings running stopped flies class", []string{"meet", "run", "stop", "fly", "class"}},
+		{LanguageEnglish, "thing sing falling", []string{"thing", "sing", "fall"}},
+		{LanguageGerman, "Häuser Kindern Straßen Straße", []string{"haus", "kind", "strass", "strass"}},
+		{LanguageFrench, "Réunions générales", []string{"reunion", "general"}},
+		{LanguageSpanish, "Las reuniones semanales", []string{"las", "reunion", "semanal"}},
+		{LanguageItalian, "Le riunioni settimanali", []string{"le", "riunion", "settimanal"}},
+	}
+
+	for _, tc := range testData {
+		tc := tc
+		t.Run(tc.language+" "+tc.text, func(t *testing.T) {
+			analyzer, err := NewAnalyzer(tc.language)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, analyzer.Terms(tc.text))
+		})
+	}
+}
+
+func TestAnalyzerUnknownLanguage(t *testing.T) {
+	_, err := NewAnalyzer("klingon")
+	require.Error(t, err)
+}
+
+func TestAnalyzerLanguages(t *testing.T) {
+	for _, language := range Languages() {
+		analyzer, err := NewAnalyzer(language)
+		require.NoError(t, err)
+		require.Equal(t, language, analyzer.Language())
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package search
+
+import (
+	"encoding/gob"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// indexVersion has to be increased when the format or analyzers change so
+// old indexes are dropped and messages are indexed again.
+const indexVersion = 1
+
+// Field is part of the message where the term was found.
+type Field uint8
+
+// Indexed fields of messages.
+const (
+	FieldHeader Field = 1 << iota
+	FieldBody
+
+	FieldAll = FieldHeader | FieldBody
+)
+
+// Index is in-memory inverted index of message terms. It is safe for
+// concurrent use.
+type Index struct {
+	analyzer *Analyzer
+
+	lock      *sync.RWMutex
+	postings  map[string]map[string]Field
+	documents map[string][]string
+	changes   int
+}
+
+// indexData is the persisted form of the index.
+type indexData struct {
+	Version   int
+	Language  string
+	Postings  map[string]map[string]Field
+	Documents map[string][]string
+}
+
+// NewIndex returns empty index using analyzer for the language.
+func NewIndex(language string) (*Index, error) {
+	analyzer, err := NewAnalyzer(language)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Index{
+		analyzer:  analyzer,
+		lock:      &sync.RWMutex{},
+		postings:  map[string]map[string]Field{},
+		documents: map[string][]string{},
+	}, nil
+}
+
+// LoadIndex reads the index written by Save.
+func LoadIndex(r io.Reader) (*Index, error) {
+	data := indexData{}
+	if err := gob.NewDecoder(r).Decode(&data); err != nil {
+		return nil, errors.Wrap(err, "failed to decode index")
+	}
+
+	if data.Version != indexVersion {
+		return nil, errors.Errorf("unsupported index version %d", data.Version)
+	}
+
+	idx, err := NewIndex(data.Language)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Postings != nil {
+		idx.postings = data.Postings
+	}
+	if data.Documents != nil {
+		idx.documents = data.Documents
+	}
+
+	return idx, nil
+}
+
+// Save writes the index and resets the number of unsaved changes.
+func (idx *Index) Save(w io.Writer) error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	data := indexData{
+		Version:   indexVersion,
+		Language:  idx.analyzer.Language(),
+		Postings:  idx.postings,
+		Documents: idx.documents,
+	}
+
+	if err := gob.NewEncoder(w).Encode(&data); err != nil {
+		return errors.Wrap(err, "failed to encode index")
+	}
+
+	idx.changes = 0
+	return nil
+}
+
+// Language returns the language of the analyzer used by the index.
+func (idx *Index) Language() string {
+	return idx.analyzer.Language()
+}
+
+// Changes returns the number of documents added or removed since the index
+// was created or saved.
+func (idx *Index) Changes() int {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	return idx.changes
+}
+
+// Has returns whether the document is indexed.
+func (idx *Index) Has(id string) bool {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	_, ok := idx.documents[id]
+	return ok
+}
+
+// Add indexes the document. Previously indexed document with the same ID
+// is replaced.
+func (idx *Index) Add(id, header, body string) {
+	fields := map[string]Field{}
+	for _, term := range idx.analyzer.Terms(header) {
+		fields[term] |= FieldHeader
+	}
+	for _, term := range idx.analyzer.Terms(body) {
+		fields[term] |= FieldBody
+	}
+
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	idx.remove(id)
+
+	terms := make([]string, 0, len(fields))
+	for term, field := range fields {
+		if idx.postings[term] == nil {
+			idx.postings[term] = map[string]Field{}
+		}
+		idx.postings[term][id] = field
+		terms = append(terms, term)
+	}
+
+	idx.documents[id] = terms
+	idx.changes++
+}
+
+// Remove removes the document from the index.
+func (idx *Index) Remove(id string) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	if _, ok := idx.documents[id]; ok {
+		idx.remove(id)
+		idx.changes++
+	}
+}
+
+func (idx *Index) remove(id string) {
+	for _, term := range idx.documents[id] {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.documents, id)
+}
+
+// Match returns whether the document contains all terms of the query in
+// any of the fields. IMAP SEARCH matches substrings (RFC 3501 section
+// 6.4.4), therefore a term matches also when it is part of any term of
+// the document, e.g. "invoic" matches "invoices". Query without any term
+// matches every document.
+func (idx *Index) Match(id, query string, fields Field) bool {
+	terms := idx.analyzer.Terms(query)
+
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	for _, term := range terms {
+		if idx.postings[term][id]&fields == 0 && !idx.matchSubstring(id, term, fields) {
+			return false
+		}
+	}
+	return true
+}
+
+func (idx *Index) matchSubstring(id, term string, fields Field) bool {
+	for _, documentTerm := range idx.documents[id] {
+		if strings.Contains(documentTerm, term) && idx.postings[documentTerm][id]&fields != 0 {
+			return true
+		}
+	}
+	return false
+}
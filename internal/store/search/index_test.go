@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package search
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexMatch(t *testing.T) {
+	idx, err := NewIndex(LanguageEnglish)
+	require.NoError(t, err)
+
+	idx.Add("msg1", "Weekly meetings", "We are running late with the reports.")
+	idx.Add("msg2", "Lunch", "Meeting room is booked.")
+
+	require.True(t, idx.Has("msg1"))
+	require.False(t, idx.Has("msg3"))
+
+	require.True(t, idx.Match("msg1", "meeting", FieldAll))
+	require.True(t, idx.Match("msg1", "meeting", FieldHeader))
+	require.False(t, idx.Match("msg1", "meeting", FieldBody))
+	require.True(t, idx.Match("msg2", "meeting", FieldBody))
+
+	require.True(t, idx.Match("msg1", "run late", FieldBody))
+	require.False(t, idx.Match("msg1", "run early", FieldBody))
+	require.True(t, idx.Match("msg1", "", FieldBody))
+
+	// Parts of words match as IMAP SEARCH requires.
+	require.True(t, idx.Match("msg1", "repo", FieldBody))
+	require.True(t, idx.Match("msg1", "eekl", FieldHeader))
+	require.False(t, idx.Match("msg1", "eekl", FieldBody))
+
+	idx.Add("msg1", "Replaced", "")
+	require.False(t, idx.Match("msg1", "meeting", FieldAll))
+	require.True(t, idx.Match("msg1", "replaced", FieldAll))
+
+	idx.Remove("msg1")
+	require.False(t, idx.Has("msg1"))
+	require.False(t, idx.Match("msg1", "replaced", FieldAll))
+	require.Equal(t, 4, idx.Changes())
+}
+
+func TestIndexCJK(t *testing.T) {
+	idx, err := NewIndex(LanguageCJK)
+	require.NoError(t, err)
+
+	idx.Add("msg", "", "明日は東京都で会議があります。")
+
+	require.True(t, idx.Match("msg", "東京都", FieldBody))
+	require.True(t, idx.Match("msg", "会議", FieldBody))
+	require.False(t, idx.Match("msg", "京都府", FieldBody))
+}
+
+func TestIndexSaveAndLoad(t *testing.T) {
+	idx, err := NewIndex(LanguageGerman)
+	require.NoError(t, err)
+
+	idx.Add("msg", "Rechnungen", "Bitte bezahlen Sie die Rechnung.")
+
+	b := &bytes.Buffer{}
+	require.NoError(t, idx.Save(b))
+	require.Equal(t, 0, idx.Changes())
+
+	loaded, err := LoadIndex(b)
+	require.NoError(t, err)
+	require.Equal(t, LanguageGerman, loaded.Language())
+	require.True(t, loaded.Has("msg"))
+	require.True(t, loaded.Match("msg", "rechnung", FieldHeader))
+	require.True(t, loaded.Match("msg", "bezahlen", FieldBody))
+
+	_, err = LoadIndex(bytes.NewBufferString("garbage"))
+	require.Error(t, err)
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Stemmers are light, i.e. they remove only the most common inflectional
+// suffixes. They are run on lower-cased words without diacritics and they
+// never shorten the word below minStemLength characters.
+const minStemLength = 3
+
+// suffixes for languages handled by the generic suffix stemmer.
+var suffixes = map[string][]string{ //nolint[gochecknoglobals]
+	LanguageFrench: {
+		"issements", "issement", "atrices", "ateurs", "ations", "atrice", "ateur", "ation",
+		"ements", "ement", "euses", "euse", "ives", "eux", "ive", "ifs", "if",
+		"es", "e", "s", "x",
+	},
+	LanguageSpanish: {
+		"amientos", "imientos", "amiento", "imiento", "aciones", "adoras", "adores", "acion",
+		"adora", "ador", "mente", "es", "os", "as", "a", "o", "e", "s",
+	},
+	LanguageItalian: {
+		"amenti", "imenti", "amento", "imento", "azioni", "azione", "atrici", "atrice",
+		"atori", "atore", "mente", "i", "e", "a", "o",
+	},
+}
+
+// newSuffixStemmer returns stemmer removing the longest matching suffix.
+func newSuffixStemmer(suffixes []string) func(string) string {
+	sorted := append([]string{}, suffixes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+
+	return func(word string) string {
+		for _, suffix := range sorted {
+			if stem, ok := trimSuffix(word, suffix, minStemLength); ok {
+				return stem
+			}
+		}
+		return word
+	}
+}
+
+// stemEnglish removes plurals and -ing and -ed endings.
+func stemEnglish(word string) string {
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		word = word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+	case strings.HasSuffix(word, "s"):
+		if stem, ok := trimSuffix(word, "s", minStemLength); ok {
+			word = stem
+		}
+	}
+
+	for _, suffix := range []string{"ingly", "edly", "ing", "ed"} {
+		stem, ok := trimSuffix(word, suffix, minStemLength)
+		if !ok || !strings.ContainsAny(stem, "aeiouy") {
+			continue
+		}
+		return undouble(stem)
+	}
+
+	return word
+}
+
+// undouble removes doubled final consonant, e.g. `runn` of `running`.
+func undouble(stem string) string {
+	n := len(stem)
+	if n < 2 || stem[n-1] != stem[n-2] {
+		return stem
+	}
+	if strings.IndexByte("aeiouylsz", stem[n-1]) >= 0 {
+		return stem
+	}
+	return stem[:n-1]
+}
+
+// stemGerman is based on the light stemmer by J. Savoy. Umlauts are
+// already replaced by base vowels and ß by ss.
+func stemGerman(word string) string {
+	word = trimFirst(word, 5, "ern")
+	if w := trimFirst(word, 4, "em", "er", "en", "es"); w != word {
+		word = w
+	} else if w := trimFirst(word, 3, "e"); w != word {
+		word = w
+	} else if strings.HasSuffix(word, "s") && len(word) > 3 && isGermanSEnding(word[len(word)-2]) {
+		word = word[:len(word)-1]
+	}
+
+	if w := trimFirst(word, 5, "est"); w != word {
+		return w
+	}
+	if w := trimFirst(word, 4, "er", "en"); w != word {
+		return w
+	}
+	if strings.HasSuffix(word, "st") && len(word) > 5 && isGermanSEnding(word[len(word)-3]) && word[len(word)-3] != 'r' {
+		return word[:len(word)-2]
+	}
+	return word
+}
+
+func isGermanSEnding(c byte) bool {
+	return strings.IndexByte("bdfghklmnrt", c) >= 0
+}
+
+// trimFirst removes the first matching suffix if the word is longer than
+// minLength bytes.
+func trimFirst(word string, minLength int, suffixes ...string) string {
+	if len(word) <= minLength {
+		return word
+	}
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(word, suffix) {
+			return word[:len(word)-len(suffix)]
+		}
+	}
+	return word
+}
+
+// trimSuffix removes the suffix if at least minLength characters remain.
+func trimSuffix(word, suffix string, minLength int) (string, bool) {
+	if !strings.HasSuffix(word, suffix) {
+		return word, false
+	}
+	stem := word[:len(word)-len(suffix)]
+	if utf8.RuneCountInString(stem) < minLength {
+		return word, false
+	}
+	return stem, true
+}
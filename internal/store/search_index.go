@@ -0,0 +1,307 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/search"
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	searchLanguageKey = "language"
+
+	// searchIndexSaveThreshold is the number of changes after which the index
+	// is saved, so not everything is lost when bridge is not closed properly.
+	searchIndexSaveThreshold = 100
+)
+
+// SearchIndexStorage persists full-text search indexes of users. Indexes
+// contain terms of decrypted messages, so they are encrypted by the same
+// key of the user as the message cache. There should be only one instance
+// shared by all users.
+type SearchIndexStorage struct {
+	dir     string
+	ciphers cacheCiphers
+}
+
+// NewSearchIndexStorage opens the index storage in dir.
+func NewSearchIndexStorage(dir string) (*SearchIndexStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &SearchIndexStorage{dir: dir, ciphers: newCacheCiphers()}, nil
+}
+
+// SetUserKey sets the key encrypting the index of the user. Index of users
+// without the key is kept only in memory.
+func (s *SearchIndexStorage) SetUserKey(userID string, key []byte) error {
+	return s.ciphers.SetUserKey(userID, key)
+}
+
+// load returns the index of the user. New index is returned when there is
+// none or it was built for another language.
+func (s *SearchIndexStorage) load(userID, language string) (*search.Index, error) {
+	if s != nil {
+		if idx, err := s.read(userID); err == nil && idx.Language() == language {
+			return idx, nil
+		} else if err != nil && !os.IsNotExist(errors.Cause(err)) {
+			log.WithError(err).Warn("Cannot load search index, creating new one")
+		}
+	}
+
+	return search.NewIndex(language)
+}
+
+func (s *SearchIndexStorage) read(userID string) (*search.Index, error) {
+	userCipher, err := s.ciphers.get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := ioutil.ReadFile(s.getPath(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decryptCache(userCipher.gcm, encrypted)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt search index")
+	}
+
+	return search.LoadIndex(bytes.NewReader(data))
+}
+
+// save writes the index to a temporary file first so the previous index
+// is kept if writing fails.
+func (s *SearchIndexStorage) save(userID string, idx *search.Index) error {
+	if s == nil {
+		return nil
+	}
+
+	userCipher, err := s.ciphers.get(userID)
+	if err != nil {
+		return err
+	}
+
+	b := &bytes.Buffer{}
+	if err := idx.Save(b); err != nil {
+		return err
+	}
+
+	encrypted, err := encryptCache(userCipher.gcm, b.Bytes())
+	if err != nil {
+		return err
+	}
+
+	path := s.getPath(userID)
+	if err := ioutil.WriteFile(path+".tmp", encrypted, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// RemoveUser removes the index of the user.
+func (s *SearchIndexStorage) RemoveUser(userID string) error {
+	if err := os.Remove(s.getPath(userID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// getPath hashes the ID to not leak it in the file name.
+func (s *SearchIndexStorage) getPath(userID string) string {
+	hash := sha256.Sum256([]byte(userID))
+	return filepath.Join(s.dir, hex.EncodeToString(hash[:]))
+}
+
+// initSearchIndex loads the index for the language set for the account.
+func (store *Store) initSearchIndex() error {
+	language := search.LanguageDefault
+
+	if err := store.db.View(func(tx storage.Tx) error {
+		if value := tx.Bucket(searchBucket).Get([]byte(searchLanguageKey)); value != nil {
+			language = string(value)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	idx, err := store.searchIndexStorage.load(store.UserID(), language)
+	if err != nil {
+		return err
+	}
+
+	store.searchIndexLock.Lock()
+	defer store.searchIndexLock.Unlock()
+
+	store.searchIndex = idx
+	return nil
+}
+
+func (store *Store) getSearchIndex() *search.Index {
+	store.searchIndexLock.RLock()
+	defer store.searchIndexLock.RUnlock()
+
+	return store.searchIndex
+}
+
+// GetSearchLanguage returns the language of the analyzer of the full-text
+// search index.
+func (store *Store) GetSearchLanguage() string {
+	return store.getSearchIndex().Language()
+}
+
+// SetSearchLanguage changes the language of the analyzer of the full-text
+// search index. All messages are indexed again when they are searched.
+func (store *Store) SetSearchLanguage(language string) error {
+	if language == store.GetSearchLanguage() {
+		return nil
+	}
+
+	idx, err := search.NewIndex(language)
+	if err != nil {
+		return err
+	}
+
+	if err := store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(searchBucket).Put([]byte(searchLanguageKey), []byte(language))
+	}); err != nil {
+		return err
+	}
+
+	store.searchIndexLock.Lock()
+	store.searchIndex = idx
+	store.searchIndexLock.Unlock()
+
+	store.saveSearchIndex()
+	return nil
+}
+
+// IsMessageIndexed returns whether the message is in the full-text index.
+func (store *Store) IsMessageIndexed(apiID string) bool {
+	return store.getSearchIndex().Has(apiID)
+}
+
+// IndexMessage adds the built message to the full-text index.
+func (store *Store) IndexMessage(apiID string, body []byte) {
+	header, plainContents, err := getSearchableText(body)
+	if err != nil {
+		store.log.WithError(err).WithField("msgID", apiID).Warn("Cannot parse message for search index")
+		return
+	}
+
+	idx := store.getSearchIndex()
+	idx.Add(apiID, header, plainContents)
+
+	if idx.Changes() >= searchIndexSaveThreshold {
+		store.saveSearchIndex()
+	}
+}
+
+// MatchMessage returns whether the message contains all body queries in
+// its body and all text queries in its header or body.
+func (store *Store) MatchMessage(apiID string, body, text []string) bool {
+	idx := store.getSearchIndex()
+
+	for _, query := range body {
+		if !idx.Match(apiID, query, search.FieldBody) {
+			return false
+		}
+	}
+	for _, query := range text {
+		if !idx.Match(apiID, query, search.FieldAll) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchMessageBody returns whether the built message contains all body
+// queries in its body and all text queries in its header or body. It is
+// used for messages which are not indexed yet and matches substrings
+// case-insensitively as described in RFC 3501 section 6.4.4.
+func (store *Store) MatchMessageBody(body []byte, bodyQueries, textQueries []string) bool {
+	header, plainContents, err := getSearchableText(body)
+	if err != nil {
+		store.log.WithError(err).Warn("Cannot parse message for search")
+		return false
+	}
+
+	header = strings.ToLower(header)
+	plainContents = strings.ToLower(plainContents)
+
+	for _, query := range bodyQueries {
+		if !strings.Contains(plainContents, strings.ToLower(query)) {
+			return false
+		}
+	}
+	for _, query := range textQueries {
+		query = strings.ToLower(query)
+		if !strings.Contains(header, query) && !strings.Contains(plainContents, query) {
+			return false
+		}
+	}
+	return true
+}
+
+// getSearchableText returns addresses and subject of the message and its
+// plain text content.
+func getSearchableText(body []byte) (header, plainContents string, err error) {
+	m, _, plainContents, _, err := message.Parse(bytes.NewReader(body), "", "")
+	if err != nil {
+		return "", "", err
+	}
+
+	fields := []string{m.Subject}
+	for _, addresses := range [][]*mail.Address{{m.Sender}, m.ToList, m.CCList, m.BCCList} {
+		for _, address := range addresses {
+			if address != nil {
+				fields = append(fields, address.Name, address.Address)
+			}
+		}
+	}
+
+	return strings.Join(fields, " "), plainContents, nil
+}
+
+func (store *Store) removeFromSearchIndex(apiIDs []string) {
+	idx := store.getSearchIndex()
+	for _, apiID := range apiIDs {
+		idx.Remove(apiID)
+	}
+}
+
+func (store *Store) saveSearchIndex() {
+	if err := store.searchIndexStorage.save(store.UserID(), store.getSearchIndex()); err != nil {
+		store.log.WithError(err).Warn("Cannot save search index")
+	}
+}
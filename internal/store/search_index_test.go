@@ -0,0 +1,122 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/search"
+	"github.com/stretchr/testify/require"
+)
+
+const testIndexedMessage = "Subject: Quarterly reports\r\n" +
+	"From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.com\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"The reports are running late.\r\n"
+
+func TestSearchIndexStorageSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search-index")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	s, err := NewSearchIndexStorage(filepath.Join(dir, "search"))
+	require.NoError(t, err)
+	setTestCacheKeys(t, s, 1)
+
+	idx, err := s.load("userID", search.LanguageEnglish)
+	require.NoError(t, err)
+	idx.Add("msgID", "secret subject", "secret body")
+	require.NoError(t, s.save("userID", idx))
+
+	// Index is encrypted on disk.
+	data, err := ioutil.ReadFile(s.getPath("userID"))
+	require.NoError(t, err)
+	require.False(t, strings.Contains(string(data), "secret"))
+
+	loaded, err := s.load("userID", search.LanguageEnglish)
+	require.NoError(t, err)
+	require.True(t, loaded.Match("msgID", "secret", search.FieldBody))
+
+	// Index of a different language is not used.
+	loaded, err = s.load("userID", search.LanguageGerman)
+	require.NoError(t, err)
+	require.False(t, loaded.Has("msgID"))
+
+	// Index cannot be decrypted by a different key.
+	other, err := NewSearchIndexStorage(filepath.Join(dir, "search"))
+	require.NoError(t, err)
+	setTestCacheKeys(t, other, 3)
+	loaded, err = other.load("userID", search.LanguageEnglish)
+	require.NoError(t, err)
+	require.False(t, loaded.Has("msgID"))
+
+	require.NoError(t, s.RemoveUser("userID"))
+	_, err = os.Stat(s.getPath("userID"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestStoreIndexMessage(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.Equal(t, search.LanguageDefault, m.store.GetSearchLanguage())
+	require.False(t, m.store.IsMessageIndexed("msgID"))
+
+	m.store.IndexMessage("msgID", []byte(testIndexedMessage))
+	require.True(t, m.store.IsMessageIndexed("msgID"))
+
+	require.True(t, m.store.MatchMessage("msgID", []string{"running late"}, nil))
+	require.False(t, m.store.MatchMessage("msgID", []string{"quarterly"}, nil))
+	require.True(t, m.store.MatchMessage("msgID", nil, []string{"quarterly", "alice"}))
+	require.True(t, m.store.MatchMessage("msgID", []string{"run"}, nil))
+	require.False(t, m.store.MatchMessage("msgID", []string{"runs"}, nil))
+
+	// Changing language drops the index built by the previous analyzer.
+	require.NoError(t, m.store.SetSearchLanguage(search.LanguageEnglish))
+	require.Equal(t, search.LanguageEnglish, m.store.GetSearchLanguage())
+	require.False(t, m.store.IsMessageIndexed("msgID"))
+
+	m.store.IndexMessage("msgID", []byte(testIndexedMessage))
+	require.True(t, m.store.MatchMessage("msgID", []string{"runs"}, nil))
+
+	require.Error(t, m.store.SetSearchLanguage("klingon"))
+
+	require.NoError(t, m.store.deleteMessagesEvent([]string{"msgID"}))
+	require.False(t, m.store.IsMessageIndexed("msgID"))
+}
+
+func TestStoreMatchMessageBody(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	body := []byte(testIndexedMessage)
+	require.True(t, m.store.MatchMessageBody(body, []string{"RUNNING LA"}, nil))
+	require.True(t, m.store.MatchMessageBody(body, []string{"repo"}, []string{"quarter", "alice@"}))
+	require.False(t, m.store.MatchMessageBody(body, []string{"quarterly"}, nil))
+	require.False(t, m.store.MatchMessageBody(body, nil, []string{"invoice"}))
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"net/mail"
+	"strconv"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+const selfSentHideDuplicatesKey = "hide_duplicates"
+
+var (
+	hideSelfSentDuplicates     bool         //nolint[gochecknoglobals]
+	hideSelfSentDuplicatesLock sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetHideSelfSentDuplicates sets whether received copies of messages sent
+// to own addresses are hidden in All Mail where the sent copy is already
+// shown. Stores opened with different value are fully resynced.
+func SetHideSelfSentDuplicates(hide bool) {
+	hideSelfSentDuplicatesLock.Lock()
+	defer hideSelfSentDuplicatesLock.Unlock()
+
+	hideSelfSentDuplicates = hide
+}
+
+func shouldHideSelfSentDuplicates() bool {
+	hideSelfSentDuplicatesLock.RLock()
+	defer hideSelfSentDuplicatesLock.RUnlock()
+
+	return hideSelfSentDuplicates
+}
+
+// selfSentCopies are messages with the same external ID sent by the user
+// to own addresses. The user's account has one sent copy and one received
+// copy for each own recipient address.
+type selfSentCopies struct {
+	SentID      string
+	ReceivedIDs []string
+}
+
+func (copies *selfSentCopies) hasReceivedID(apiID string) bool {
+	for _, receivedID := range copies.ReceivedIDs {
+		if receivedID == apiID {
+			return true
+		}
+	}
+	return false
+}
+
+func isSentCopy(msg *pmapi.Message) bool {
+	return msg.Flags&pmapi.FlagSent != 0 && msg.Flags&pmapi.FlagReceived == 0
+}
+
+func isReceivedCopy(msg *pmapi.Message) bool {
+	return msg.Flags&pmapi.FlagReceived != 0 && msg.Flags&pmapi.FlagSent == 0
+}
+
+// checkSelfSentSetting makes sure mailboxes are built with the current
+// value of the setting. When it was changed, the sync is cleared so
+// the event loop starts a full sync which rebuilds the mailboxes.
+func (store *Store) checkSelfSentSetting() error {
+	hide := strconv.FormatBool(shouldHideSelfSentDuplicates())
+
+	return store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(selfSentBucket)
+
+		if applied := b.Get([]byte(selfSentHideDuplicatesKey)); applied != nil && string(applied) != hide {
+			store.log.WithField("hide", hide).Info("Self-sent duplicates setting changed, full sync is needed")
+			if err := tx.Bucket(syncStateBucket).Delete([]byte(syncFinishTimeKey)); err != nil {
+				return err
+			}
+		}
+
+		return b.Put([]byte(selfSentHideDuplicatesKey), []byte(hide))
+	})
+}
+
+// txIndexSelfSent remembers sent and received copies of messages sent to
+// own addresses. It returns IDs of received copies indexed before their
+// sent copy, so their presence in mailboxes can be checked again.
+func (store *Store) txIndexSelfSent(tx storage.Tx, msgs []*pmapi.Message) (receivedIDs []string, err error) {
+	b := tx.Bucket(selfSentBucket).Bucket(selfSentIDsBucket)
+
+	for _, msg := range msgs {
+		if msg.ExternalID == "" {
+			continue
+		}
+
+		isSent := isSentCopy(msg)
+		if !isSent && !(isReceivedCopy(msg) && store.isOwnAddress(msg.Sender)) {
+			continue
+		}
+
+		copies := txGetSelfSentCopies(b, msg.ExternalID)
+		if copies == nil {
+			copies = &selfSentCopies{}
+		}
+
+		switch {
+		case isSent && copies.SentID != msg.ID:
+			copies.SentID = msg.ID
+			receivedIDs = append(receivedIDs, copies.ReceivedIDs...)
+		case !isSent && !copies.hasReceivedID(msg.ID):
+			copies.ReceivedIDs = append(copies.ReceivedIDs, msg.ID)
+		default:
+			continue
+		}
+
+		data, err := json.Marshal(copies)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.Put([]byte(msg.ExternalID), data); err != nil {
+			return nil, err
+		}
+	}
+
+	return receivedIDs, nil
+}
+
+// txGetSelfSentReceivedIDs returns IDs of received copies of the message
+// if it is the sent copy of a self-sent message.
+func (store *Store) txGetSelfSentReceivedIDs(tx storage.Tx, msg *pmapi.Message) []string {
+	if msg.ExternalID == "" || !isSentCopy(msg) {
+		return nil
+	}
+
+	copies := txGetSelfSentCopies(tx.Bucket(selfSentBucket).Bucket(selfSentIDsBucket), msg.ExternalID)
+	if copies == nil || copies.SentID != msg.ID {
+		return nil
+	}
+	return copies.ReceivedIDs
+}
+
+// txIsSelfSentDuplicate returns whether the message is a received copy of
+// a self-sent message whose sent copy is in the store as well.
+func (store *Store) txIsSelfSentDuplicate(tx storage.Tx, msg *pmapi.Message) bool {
+	if msg.ExternalID == "" || !isReceivedCopy(msg) {
+		return false
+	}
+
+	copies := txGetSelfSentCopies(tx.Bucket(selfSentBucket).Bucket(selfSentIDsBucket), msg.ExternalID)
+	if copies == nil || copies.SentID == "" || !copies.hasReceivedID(msg.ID) {
+		return false
+	}
+
+	// The sent copy might be already deleted.
+	return tx.Bucket(metadataBucket).Get([]byte(copies.SentID)) != nil
+}
+
+func txGetSelfSentCopies(b storage.Bucket, externalID string) *selfSentCopies {
+	data := b.Get([]byte(externalID))
+	if data == nil {
+		return nil
+	}
+
+	copies := &selfSentCopies{}
+	if err := json.Unmarshal(data, copies); err != nil {
+		log.WithError(err).Warn("Cannot unmarshal self-sent copies")
+		return nil
+	}
+	return copies
+}
+
+// isOwnAddress returns whether the address belongs to the user.
+func (store *Store) isOwnAddress(address *mail.Address) bool {
+	return address != nil && store.client().Addresses().ByEmail(address.Address) != nil
+}
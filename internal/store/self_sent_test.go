@@ -0,0 +1,119 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func newSelfSentStore(t *testing.T, hide bool) (*mocksForStore, func()) {
+	SetHideSelfSentDuplicates(hide)
+
+	m, clear := initMocks(t)
+	m.newStoreNoEvents(true)
+	m.client.EXPECT().Addresses().Return(pmapi.AddressList{
+		{ID: addrID1, Email: addr1, Type: pmapi.OriginalAddress, Receive: pmapi.CanReceive},
+	}).AnyTimes()
+
+	return m, func() {
+		clear()
+		SetHideSelfSentDuplicates(false)
+	}
+}
+
+func insertSelfSentCopy(t *testing.T, m *mocksForStore, id string, flags int64, labelIDs []string) {
+	msg := getTestMessage(id, "Note to self", addr1, 0, labelIDs)
+	msg.ExternalID = "self@pm.me"
+	msg.Flags = flags
+	require.NoError(t, m.store.createOrUpdateMessageEvent(msg))
+}
+
+func checkAllMailIDs(t *testing.T, m *mocksForStore, wantIDs []string) {
+	ids, err := m.store.addresses[addrID1].mailboxes[pmapi.AllMailLabel].GetAPIIDsFromSequenceRange(1, 100)
+	require.NoError(t, err)
+	require.Equal(t, wantIDs, ids)
+}
+
+func TestSelfSentDuplicateHidden(t *testing.T) {
+	m, clear := newSelfSentStore(t, true)
+	defer clear()
+
+	insertSelfSentCopy(t, m, "sent", pmapi.FlagSent, []string{pmapi.AllMailLabel, pmapi.SentLabel})
+	insertSelfSentCopy(t, m, "received", pmapi.FlagReceived, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	checkAllMailIDs(t, m, []string{"sent"})
+	checkMailboxMessageIDs(t, m, pmapi.InboxLabel, []wantID{{"received", 1}})
+	checkMailboxMessageIDs(t, m, pmapi.SentLabel, []wantID{{"sent", 1}})
+}
+
+func TestSelfSentDuplicateHiddenWhenSentCopyArrivesLater(t *testing.T) {
+	m, clear := newSelfSentStore(t, true)
+	defer clear()
+
+	insertSelfSentCopy(t, m, "received", pmapi.FlagReceived, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	checkAllMailIDs(t, m, []string{"received"})
+
+	insertSelfSentCopy(t, m, "sent", pmapi.FlagSent, []string{pmapi.AllMailLabel, pmapi.SentLabel})
+	checkAllMailIDs(t, m, []string{"sent"})
+
+	// Received copy is shown again when the sent copy is deleted.
+	require.NoError(t, m.store.deleteMessagesEvent([]string{"sent"}))
+	checkAllMailIDs(t, m, []string{"received"})
+}
+
+func TestSelfSentDuplicateShownByDefault(t *testing.T) {
+	m, clear := newSelfSentStore(t, false)
+	defer clear()
+
+	insertSelfSentCopy(t, m, "sent", pmapi.FlagSent, []string{pmapi.AllMailLabel, pmapi.SentLabel})
+	insertSelfSentCopy(t, m, "received", pmapi.FlagReceived, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	checkAllMailIDs(t, m, []string{"sent", "received"})
+}
+
+func TestSelfSentFromOtherSenderNotHidden(t *testing.T) {
+	m, clear := newSelfSentStore(t, true)
+	defer clear()
+
+	insertSelfSentCopy(t, m, "sent", pmapi.FlagSent, []string{pmapi.AllMailLabel, pmapi.SentLabel})
+
+	msg := getTestMessage("received", "Note to self", "someone@example.com", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg.ExternalID = "self@pm.me"
+	msg.Flags = pmapi.FlagReceived
+	require.NoError(t, m.store.createOrUpdateMessageEvent(msg))
+
+	checkAllMailIDs(t, m, []string{"sent", "received"})
+}
+
+func TestSelfSentSettingChangeClearsSync(t *testing.T) {
+	m, clear := newSelfSentStore(t, false)
+	defer clear()
+
+	m.store.loadSyncState().setFinishTime()
+	require.True(t, m.store.isSyncFinished())
+
+	require.NoError(t, m.store.checkSelfSentSetting())
+	require.True(t, m.store.isSyncFinished())
+
+	SetHideSelfSentDuplicates(true)
+	require.NoError(t, m.store.checkSelfSentSetting())
+	require.False(t, m.store.isSyncFinished())
+}
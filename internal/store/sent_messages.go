@@ -0,0 +1,143 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// sentMessageLifetime is how long sent messages are remembered. Clients
+// usually append the sent message right after sending, but clients which
+// were offline do it once they are connected again.
+const sentMessageLifetime = 7 * 24 * time.Hour
+
+// publicKeyMIMEType is the type of public key attached by Bridge when sending.
+const publicKeyMIMEType = "application/pgp-key"
+
+type sentMessage struct {
+	ID   string
+	Time int64
+}
+
+// MessageFingerprint returns hash of the message content which is the same
+// for the message sent over SMTP and the copy appended by the client to Sent.
+// Sender and address are not used as the appended copy can be assigned to
+// a different address and public keys attached by Bridge are skipped.
+func MessageFingerprint(msg *pmapi.Message) string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(msg.Subject))
+	for _, to := range msg.ToList {
+		_, _ = h.Write([]byte(to.Address))
+	}
+	for _, cc := range msg.CCList {
+		_, _ = h.Write([]byte(cc.Address))
+	}
+	_, _ = h.Write([]byte(msg.Body))
+	for _, att := range msg.Attachments {
+		if att.MIMEType == publicKeyMIMEType {
+			continue
+		}
+		_, _ = h.Write([]byte(att.Name + att.MIMEType))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// AddSentMessage remembers the message sent via Bridge by its external ID
+// (Message-Id header) and content fingerprint, so the copy appended later by
+// the client to Sent is matched to it instead of being imported again.
+func (store *Store) AddSentMessage(externalID, fingerprint, apiID string) error {
+	data, err := json.Marshal(&sentMessage{ID: apiID, Time: time.Now().Unix()})
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(sentMessagesBucket)
+
+		if err := txDeleteExpiredSentMessages(b.Bucket(sentExtIDsBucket)); err != nil {
+			return err
+		}
+		if err := txDeleteExpiredSentMessages(b.Bucket(sentHashesBucket)); err != nil {
+			return err
+		}
+
+		if externalID = normalizeExternalID(externalID); externalID != "" {
+			if err := b.Bucket(sentExtIDsBucket).Put([]byte(externalID), data); err != nil {
+				return err
+			}
+		}
+		return b.Bucket(sentHashesBucket).Put([]byte(fingerprint), data)
+	})
+}
+
+// FindSentMessage returns API ID of the message sent via Bridge matching
+// the external ID or the content fingerprint, or empty string.
+func (store *Store) FindSentMessage(externalID, fingerprint string) (apiID string) {
+	_ = store.db.View(func(tx storage.Tx) error {
+		b := tx.Bucket(sentMessagesBucket)
+
+		if externalID = normalizeExternalID(externalID); externalID != "" {
+			if apiID = txGetSentMessageID(b.Bucket(sentExtIDsBucket), externalID); apiID != "" {
+				return nil
+			}
+		}
+		apiID = txGetSentMessageID(b.Bucket(sentHashesBucket), fingerprint)
+		return nil
+	})
+	return
+}
+
+func normalizeExternalID(externalID string) string {
+	return strings.Trim(externalID, "<> ")
+}
+
+func txGetSentMessageID(b storage.Bucket, key string) string {
+	msg := &sentMessage{}
+	if data := b.Get([]byte(key)); data == nil || json.Unmarshal(data, msg) != nil {
+		return ""
+	}
+	if time.Since(time.Unix(msg.Time, 0)) > sentMessageLifetime {
+		return ""
+	}
+	return msg.ID
+}
+
+func txDeleteExpiredSentMessages(b storage.Bucket) error {
+	expired := [][]byte{}
+	_ = b.ForEach(func(k, v []byte) error {
+		msg := &sentMessage{}
+		if json.Unmarshal(v, msg) != nil || time.Since(time.Unix(msg.Time, 0)) > sentMessageLifetime {
+			expired = append(expired, k)
+		}
+		return nil
+	})
+
+	for _, k := range expired {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"net/mail"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageFingerprint(t *testing.T) {
+	sent := &pmapi.Message{
+		AddressID:   addrID1,
+		Subject:     "Hello",
+		ToList:      []*mail.Address{{Address: "bob@pm.me"}},
+		Body:        "Hi Bob",
+		Attachments: []*pmapi.Attachment{{Name: "publickey - Alice.asc.pgp", MIMEType: publicKeyMIMEType}},
+	}
+	appended := &pmapi.Message{
+		AddressID: addrID2,
+		Subject:   "Hello",
+		ToList:    []*mail.Address{{Address: "bob@pm.me"}},
+		Body:      "Hi Bob",
+	}
+	require.Equal(t, MessageFingerprint(sent), MessageFingerprint(appended))
+
+	appended.Body = "Hi Bob!"
+	require.NotEqual(t, MessageFingerprint(sent), MessageFingerprint(appended))
+}
+
+func TestFindSentMessage(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.NoError(t, m.store.AddSentMessage("<msg@pm.me>", "hash1", "msg1"))
+	require.NoError(t, m.store.AddSentMessage("", "hash2", "msg2"))
+
+	require.Equal(t, "msg1", m.store.FindSentMessage("msg@pm.me", "other"))
+	require.Equal(t, "msg1", m.store.FindSentMessage("", "hash1"))
+	require.Equal(t, "msg2", m.store.FindSentMessage("<other@pm.me>", "hash2"))
+	require.Equal(t, "", m.store.FindSentMessage("<other@pm.me>", "other"))
+}
+
+func TestFindSentMessageExpired(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	data, err := json.Marshal(&sentMessage{ID: "old", Time: time.Now().Add(-sentMessageLifetime - time.Hour).Unix()})
+	require.NoError(t, err)
+	require.NoError(t, m.store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(sentMessagesBucket).Bucket(sentHashesBucket).Put([]byte("old"), data)
+	}))
+	require.Equal(t, "", m.store.FindSentMessage("", "old"))
+
+	// Expired messages are deleted when a new one is added.
+	require.NoError(t, m.store.AddSentMessage("", "new", "new"))
+	require.NoError(t, m.store.db.View(func(tx storage.Tx) error {
+		require.Nil(t, tx.Bucket(sentMessagesBucket).Bucket(sentHashesBucket).Get([]byte("old")))
+		return nil
+	}))
+}
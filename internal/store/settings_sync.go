@@ -0,0 +1,178 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+const (
+	// settingsSyncExternalID is the Message-Id of the message in the
+	// account which carries the settings shared by bridges of the user.
+	settingsSyncExternalID = "bridge-settings@proton-bridge.local"
+	settingsSyncSubject    = "Proton Bridge settings"
+	settingsSyncIntro      = "This message keeps settings of Proton Bridge shared between your computers. " +
+		"It is end-to-end encrypted like your other messages. Do not edit it.\n\n"
+
+	syncedSettingsVersion = 1
+)
+
+// ErrNoSyncedSettings when no bridge of the user uploaded settings yet.
+var ErrNoSyncedSettings = errors.New("no settings uploaded to the account") //nolint[gochecknoglobals]
+
+// SyncedSettings are settings shared by bridges of the user on different
+// computers. They must never contain credentials.
+type SyncedSettings struct {
+	Version   int
+	UpdatedAt int64 // Unix time
+
+	// Preferences are bridge-wide preferences by their keys.
+	Preferences map[string]string
+
+	// Account settings.
+	SyncExclusions   []string
+	MailboxMapping   string
+	OutgoingMIMEType string
+	AppendSignature  bool
+	FooterText       string
+	FooterHTML       string
+	RemoteContent    message.RemoteContentFilter
+	SearchLanguage   string
+}
+
+// UploadSyncedSettings stores the settings in the account as a message in
+// Archive encrypted by the key ring, replacing previously uploaded settings.
+func (store *Store) UploadSyncedSettings(kr *crypto.KeyRing, settings *SyncedSettings) error {
+	addr := store.client().Addresses().Main()
+	if addr == nil {
+		return errors.New("user has no address")
+	}
+
+	settings.Version = syncedSettingsVersion
+	settings.UpdatedAt = time.Now().Unix()
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	previous, err := store.listSyncedSettingsMessages()
+	if err != nil {
+		return err
+	}
+
+	msg := pmapi.NewMessage()
+	msg.AddressID = addr.ID
+	msg.Subject = settingsSyncSubject
+	msg.Sender = &mail.Address{Name: addr.DisplayName, Address: addr.Email}
+	msg.ToList = []*mail.Address{msg.Sender}
+	msg.ExternalID = settingsSyncExternalID
+	msg.MIMEType = "text/plain"
+	msg.Body = settingsSyncIntro + string(data)
+	msg.Time = settings.UpdatedAt
+
+	body, err := message.BuildEncrypted(msg, nil, kr)
+	if err != nil {
+		return errors.Wrap(err, "failed to build settings message")
+	}
+
+	res, err := store.client().Import(store.ctx, []*pmapi.ImportMsgReq{{
+		AddressID: addr.ID,
+		Body:      body,
+		Flags:     pmapi.FlagReceived,
+		Time:      msg.Time,
+		LabelIDs:  []string{pmapi.ArchiveLabel},
+	}})
+	if err == nil && len(res) > 0 {
+		err = res[0].Error
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to import settings message")
+	}
+
+	previousIDs := []string{}
+	for _, previousMsg := range previous {
+		previousIDs = append(previousIDs, previousMsg.ID)
+	}
+	if len(previousIDs) > 0 {
+		if err := store.client().DeleteMessages(store.ctx, previousIDs); err != nil {
+			store.log.WithError(err).Warn("Cannot delete previously uploaded settings")
+		}
+	}
+	return nil
+}
+
+// DownloadSyncedSettings returns the most recent settings uploaded to the
+// account by any bridge of the user.
+func (store *Store) DownloadSyncedSettings(kr *crypto.KeyRing) (*SyncedSettings, error) {
+	msgs, err := store.listSyncedSettingsMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *pmapi.Message
+	for _, msg := range msgs {
+		if latest == nil || msg.Time > latest.Time {
+			latest = msg
+		}
+	}
+	if latest == nil {
+		return nil, ErrNoSyncedSettings
+	}
+
+	msg, err := store.client().GetMessage(store.ctx, latest.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := msg.Decrypt(kr); err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt settings message")
+	}
+
+	return parseSyncedSettings(msg.Body)
+}
+
+func (store *Store) listSyncedSettingsMessages() ([]*pmapi.Message, error) {
+	msgs, _, err := store.client().ListMessages(store.ctx, &pmapi.MessagesFilter{ExternalID: settingsSyncExternalID})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list settings messages")
+	}
+	return msgs, nil
+}
+
+func parseSyncedSettings(body string) (*SyncedSettings, error) {
+	start := strings.Index(body, "{")
+	if start == -1 {
+		return nil, errors.New("settings message has no settings")
+	}
+
+	settings := &SyncedSettings{}
+	if err := json.Unmarshal([]byte(body[start:]), settings); err != nil {
+		return nil, errors.Wrap(err, "failed to parse settings message")
+	}
+	if settings.Version > syncedSettingsVersion {
+		return nil, errors.New("settings were uploaded by newer version of bridge")
+	}
+	return settings, nil
+}
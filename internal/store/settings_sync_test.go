@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncedSettings(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	key, err := crypto.GenerateKey("user", "user@pm.me", "x25519", 0)
+	require.NoError(t, err)
+	kr, err := crypto.NewKeyRing(key)
+	require.NoError(t, err)
+
+	settingsFilter := &pmapi.MessagesFilter{ExternalID: settingsSyncExternalID}
+
+	m.client.EXPECT().ListMessages(gomock.Any(), settingsFilter).Return(nil, 0, nil)
+	_, err = m.store.DownloadSyncedSettings(kr)
+	require.Equal(t, ErrNoSyncedSettings, err)
+
+	var imported []byte
+	m.client.EXPECT().Addresses().Return(pmapi.AddressList{{ID: addrID1, Email: addr1, Type: pmapi.OriginalAddress, Order: 1}})
+	m.client.EXPECT().ListMessages(gomock.Any(), settingsFilter).Return([]*pmapi.Message{{ID: "old", Time: 1}}, 1, nil)
+	m.client.EXPECT().Import(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, reqs []*pmapi.ImportMsgReq) ([]*pmapi.ImportMsgRes, error) {
+		require.Len(t, reqs, 1)
+		require.Equal(t, []string{pmapi.ArchiveLabel}, reqs[0].LabelIDs)
+		imported = reqs[0].Body
+		return []*pmapi.ImportMsgRes{{MessageID: "new"}}, nil
+	})
+	m.client.EXPECT().DeleteMessages(gomock.Any(), []string{"old"})
+
+	require.NoError(t, m.store.UploadSyncedSettings(kr, &SyncedSettings{
+		Preferences:    map[string]string{"hide_self_sent_duplicates": "true"},
+		SyncExclusions: []string{"All Mail"},
+		MailboxMapping: MailboxMappingGmail,
+	}))
+	require.Contains(t, string(imported), "Message-Id: <"+settingsSyncExternalID+">")
+	require.NotContains(t, string(imported), "hide_self_sent_duplicates")
+
+	start := strings.Index(string(imported), "-----BEGIN PGP MESSAGE-----")
+	end := strings.Index(string(imported), "-----END PGP MESSAGE-----")
+	require.True(t, start != -1 && end > start)
+	encryptedBody := string(imported[start : end+len("-----END PGP MESSAGE-----")])
+
+	m.client.EXPECT().ListMessages(gomock.Any(), settingsFilter).Return([]*pmapi.Message{{ID: "old", Time: 1}, {ID: "new", Time: 2}}, 2, nil)
+	m.client.EXPECT().GetMessage(gomock.Any(), "new").Return(&pmapi.Message{ID: "new", Body: encryptedBody, MIMEType: "text/plain"}, nil)
+
+	settings, err := m.store.DownloadSyncedSettings(kr)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"hide_self_sent_duplicates": "true"}, settings.Preferences)
+	require.Equal(t, []string{"All Mail"}, settings.SyncExclusions)
+	require.Equal(t, MailboxMappingGmail, settings.MailboxMapping)
+}
+
+func TestParseSyncedSettings(t *testing.T) {
+	settings, err := parseSyncedSettings(settingsSyncIntro + `{"Version": 1, "MailboxMapping": "flat"}`)
+	require.NoError(t, err)
+	require.Equal(t, MailboxMappingFlat, settings.MailboxMapping)
+
+	for _, body := range []string{"", settingsSyncIntro, `{"Version": 2}`, "{broken"} {
+		_, err := parseSyncedSettings(body)
+		require.Error(t, err, body)
+	}
+}
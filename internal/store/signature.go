@@ -0,0 +1,82 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"strconv"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+)
+
+const (
+	appendSignatureKey = "append"
+	footerTextKey      = "footer_text"
+	footerHTMLKey      = "footer_html"
+)
+
+// GetAppendSignature returns whether the signature of the sending address
+// is appended to outgoing messages.
+func (store *Store) GetAppendSignature() (enabled bool) {
+	_ = store.db.View(func(tx storage.Tx) error {
+		enabled, _ = strconv.ParseBool(string(tx.Bucket(signatureBucket).Get([]byte(appendSignatureKey))))
+		return nil
+	})
+	return
+}
+
+// SetAppendSignature sets whether the signature of the sending address is
+// appended to outgoing messages. It is meant for clients which are not
+// configured with their own signature.
+func (store *Store) SetAppendSignature(enabled bool) error {
+	return store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(signatureBucket).Put([]byte(appendSignatureKey), []byte(strconv.FormatBool(enabled)))
+	})
+}
+
+// GetFooter returns the plain text and HTML footer appended to outgoing
+// messages. Both are empty when no footer is set.
+func (store *Store) GetFooter() (text, html string) {
+	_ = store.db.View(func(tx storage.Tx) error {
+		b := tx.Bucket(signatureBucket)
+		text = string(b.Get([]byte(footerTextKey)))
+		html = string(b.Get([]byte(footerHTMLKey)))
+		return nil
+	})
+	return
+}
+
+// SetFooter sets the plain text and HTML footer appended to outgoing
+// messages. The missing variant is generated from the other one when sending,
+// empty both removes the footer.
+func (store *Store) SetFooter(text, html string) error {
+	return store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(signatureBucket)
+		for key, value := range map[string]string{footerTextKey: text, footerHTMLKey: html} {
+			var err error
+			if value == "" {
+				err = b.Delete([]byte(key))
+			} else {
+				err = b.Put([]byte(key), []byte(value))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendSignature(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.False(t, m.store.GetAppendSignature())
+
+	require.NoError(t, m.store.SetAppendSignature(true))
+	require.True(t, m.store.GetAppendSignature())
+
+	require.NoError(t, m.store.SetAppendSignature(false))
+	require.False(t, m.store.GetAppendSignature())
+}
+
+func TestFooter(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	text, html := m.store.GetFooter()
+	require.Equal(t, "", text)
+	require.Equal(t, "", html)
+
+	require.NoError(t, m.store.SetFooter("Sent via bridge", "<i>Sent via bridge</i>"))
+	text, html = m.store.GetFooter()
+	require.Equal(t, "Sent via bridge", text)
+	require.Equal(t, "<i>Sent via bridge</i>", html)
+
+	require.NoError(t, m.store.SetFooter("Sent via bridge", ""))
+	text, html = m.store.GetFooter()
+	require.Equal(t, "Sent via bridge", text)
+	require.Equal(t, "", html)
+
+	require.NoError(t, m.store.SetFooter("", ""))
+	text, html = m.store.GetFooter()
+	require.Equal(t, "", text)
+	require.Equal(t, "", html)
+}
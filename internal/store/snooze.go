@@ -0,0 +1,319 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// Targets of snoozing which are always offered to clients. Other targets
+// are durations, e.g. `3h`, `2d` or `1w`, or dates, e.g. `2021-01-31`.
+const (
+	SnoozeLaterToday = "LaterToday"
+	SnoozeTomorrow   = "Tomorrow"
+	SnoozeWeekend    = "Weekend"
+	SnoozeNextWeek   = "NextWeek"
+	SnoozeNextMonth  = "NextMonth"
+)
+
+const (
+	// snoozeWakeHour is the local hour when messages snoozed till a day
+	// are moved back.
+	snoozeWakeHour = 8
+
+	// snoozeLaterToday is how long messages are snoozed by LaterToday.
+	snoozeLaterToday = 3 * time.Hour
+)
+
+var (
+	// ErrSnoozeNotAllowed when messages are snoozed from a mailbox which
+	// cannot hide them, e.g. Archive or All Mail.
+	ErrSnoozeNotAllowed = errors.New("only messages in Inbox, folders and labels can be snoozed") //nolint[gochecknoglobals]
+
+	// ErrNoSuchSnoozedMessage when the message is not snoozed.
+	ErrNoSuchSnoozedMessage = errors.New("no such snoozed message") //nolint[gochecknoglobals]
+)
+
+// SnoozeTargets returns targets listed as mailboxes in Snoozed.
+func SnoozeTargets() []string {
+	return []string{SnoozeLaterToday, SnoozeTomorrow, SnoozeWeekend, SnoozeNextWeek, SnoozeNextMonth}
+}
+
+// ParseSnoozeTarget returns when the message snoozed till the target at now
+// is moved back. Target is case-insensitive.
+func ParseSnoozeTarget(target string, now time.Time) (time.Time, error) {
+	morning := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), snoozeWakeHour, 0, 0, 0, t.Location())
+	}
+
+	switch strings.ToLower(target) {
+	case strings.ToLower(SnoozeLaterToday):
+		return now.Add(snoozeLaterToday), nil
+	case strings.ToLower(SnoozeTomorrow):
+		return morning(now.AddDate(0, 0, 1)), nil
+	case strings.ToLower(SnoozeWeekend):
+		days := (int(time.Saturday) - int(now.Weekday()) + 7) % 7
+		if days == 0 || now.Weekday() == time.Sunday {
+			days += 7
+		}
+		return morning(now.AddDate(0, 0, days)), nil
+	case strings.ToLower(SnoozeNextWeek):
+		days := (int(time.Monday) - int(now.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return morning(now.AddDate(0, 0, days)), nil
+	case strings.ToLower(SnoozeNextMonth):
+		return morning(time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())), nil
+	}
+
+	if date, err := time.ParseInLocation("2006-01-02", target, now.Location()); err == nil {
+		if wakeAt := morning(date); wakeAt.After(now) {
+			return wakeAt, nil
+		}
+		return time.Time{}, fmt.Errorf("snooze date %s is in the past", target)
+	}
+
+	if len(target) < 2 {
+		return time.Time{}, fmt.Errorf("unknown snooze target %q", target)
+	}
+	count, err := strconv.Atoi(target[:len(target)-1])
+	if err != nil || count <= 0 {
+		return time.Time{}, fmt.Errorf("unknown snooze target %q", target)
+	}
+	switch strings.ToLower(target[len(target)-1:]) {
+	case "h":
+		return now.Add(time.Duration(count) * time.Hour), nil
+	case "d":
+		return now.AddDate(0, 0, count), nil
+	case "w":
+		return now.AddDate(0, 0, 7*count), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown snooze target %q", target)
+}
+
+// SnoozedMessage is a message hidden from its mailbox until WakeAt when it
+// is moved back to the mailbox and marked as unread.
+type SnoozedMessage struct {
+	MessageID string
+	AddressID string
+	LabelID   string // Mailbox the message is moved back to.
+	Target    string
+	WakeAt    time.Time
+
+	// UID identifies the message in the virtual IMAP mailboxes listing
+	// snoozed messages. Every snoozing, including rescheduling, gets a new UID.
+	UID uint32
+}
+
+// SnoozeMessages hides messages from the mailbox until wakeAt. Messages
+// in a label are unlabeled, messages in a folder are moved to Archive.
+func (storeMailbox *Mailbox) SnoozeMessages(apiIDs []string, target string, wakeAt time.Time) error {
+	if storeMailbox.labelID != pmapi.InboxLabel && !storeMailbox.IsFolder() && !storeMailbox.IsLabel() {
+		return ErrSnoozeNotAllowed
+	}
+
+	msgs := []*SnoozedMessage{}
+	for _, apiID := range apiIDs {
+		msg, err := storeMailbox.store.getMessageFromDB(apiID)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, &SnoozedMessage{
+			MessageID: apiID,
+			AddressID: msg.AddressID,
+			LabelID:   storeMailbox.labelID,
+			Target:    target,
+			WakeAt:    wakeAt,
+		})
+	}
+
+	if err := storeMailbox.store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(snoozedBucket)
+		for _, msg := range msgs {
+			if err := txPutSnoozedMessage(b, msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	storeMailbox.log.WithField("messages", len(apiIDs)).WithField("wakeAt", wakeAt).Info("Snoozing messages")
+
+	if storeMailbox.IsLabel() {
+		return storeMailbox.UnlabelMessages(apiIDs)
+	}
+
+	defer storeMailbox.pollNow()
+	return storeMailbox.client().LabelMessages(storeMailbox.store.ctx, apiIDs, pmapi.ArchiveLabel)
+}
+
+// RescheduleSnoozedMessages changes when the snoozed messages are moved
+// back. Messages get new UIDs.
+func (store *Store) RescheduleSnoozedMessages(apiIDs []string, target string, wakeAt time.Time) error {
+	return store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(snoozedBucket)
+		for _, apiID := range apiIDs {
+			msg, err := txGetSnoozedMessage(b, apiID)
+			if err != nil {
+				return err
+			}
+			msg.Target = target
+			msg.WakeAt = wakeAt
+			if err := txPutSnoozedMessage(b, msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveSnoozedMessages cancels snoozing of messages. They are not moved
+// back, the caller moves them where the client wants them.
+func (store *Store) RemoveSnoozedMessages(apiIDs []string) error {
+	return store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(snoozedBucket)
+		for _, apiID := range apiIDs {
+			if err := b.Delete([]byte(apiID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetSnoozedMessages returns all snoozed messages ordered by UID.
+func (store *Store) GetSnoozedMessages() (msgs []*SnoozedMessage, err error) {
+	err = store.db.View(func(tx storage.Tx) error {
+		return tx.Bucket(snoozedBucket).ForEach(func(k, v []byte) error {
+			msg := &SnoozedMessage{}
+			if err := json.Unmarshal(v, msg); err != nil {
+				return err
+			}
+			msgs = append(msgs, msg)
+			return nil
+		})
+	})
+
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].UID < msgs[j].UID
+	})
+	return
+}
+
+// GetSnoozedMessagesNextUID returns the UID of the next snoozed message.
+func (store *Store) GetSnoozedMessagesNextUID() (uid uint32, err error) {
+	err = store.db.View(func(tx storage.Tx) error {
+		uid = uint32(tx.Bucket(snoozedBucket).Sequence()) + 1
+		return nil
+	})
+	return
+}
+
+// wakeSnoozedMessages moves snoozed messages which are due back to their
+// mailbox and marks them as unread. Messages which could not be moved stay
+// snoozed and are tried again the next time. It is called by the event
+// loop, so messages are moved back with the precision of the polling.
+func (store *Store) wakeSnoozedMessages(now time.Time) {
+	msgs, err := store.GetSnoozedMessages()
+	if err != nil {
+		store.log.WithError(err).Error("Cannot load snoozed messages")
+		return
+	}
+
+	labelIDs := map[string][]string{}
+	removed := []string{}
+	for _, msg := range msgs {
+		if msg.WakeAt.After(now) {
+			continue
+		}
+
+		if _, err := store.getMessageFromDB(msg.MessageID); err == ErrNoSuchAPIID {
+			removed = append(removed, msg.MessageID)
+			continue
+		}
+
+		labelID := msg.LabelID
+		if labelID != pmapi.InboxLabel && store.getMailboxNameByLabelID(labelID) == "" {
+			labelID = pmapi.InboxLabel
+		}
+		labelIDs[labelID] = append(labelIDs[labelID], msg.MessageID)
+	}
+
+	for labelID, apiIDs := range labelIDs {
+		if err := store.wakeMessages(labelID, apiIDs); err != nil {
+			store.log.WithError(err).WithField("labelID", labelID).Warn("Cannot move snoozed messages back")
+			continue
+		}
+		store.log.WithField("messages", len(apiIDs)).WithField("labelID", labelID).Info("Snoozed messages moved back")
+		removed = append(removed, apiIDs...)
+	}
+
+	if len(removed) == 0 {
+		return
+	}
+	if err := store.RemoveSnoozedMessages(removed); err != nil {
+		store.log.WithError(err).Error("Cannot remove woken snoozed messages")
+	}
+}
+
+func (store *Store) wakeMessages(labelID string, apiIDs []string) error {
+	if err := store.client().LabelMessages(store.ctx, apiIDs, labelID); err != nil {
+		return err
+	}
+	return store.client().MarkMessagesUnread(store.ctx, apiIDs)
+}
+
+func txGetSnoozedMessage(b storage.Bucket, apiID string) (*SnoozedMessage, error) {
+	data := b.Get([]byte(apiID))
+	if data == nil {
+		return nil, ErrNoSuchSnoozedMessage
+	}
+
+	msg := &SnoozedMessage{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// txPutSnoozedMessage stores the message under new UID.
+func txPutSnoozedMessage(b storage.Bucket, msg *SnoozedMessage) error {
+	uid, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	msg.UID = uint32(uid)
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(msg.MessageID), data)
+}
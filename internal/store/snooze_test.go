@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSnoozeTarget(t *testing.T) {
+	// Wednesday.
+	now := time.Date(2020, 9, 16, 14, 30, 0, 0, time.UTC)
+
+	for target, want := range map[string]time.Time{
+		"LaterToday": time.Date(2020, 9, 16, 17, 30, 0, 0, time.UTC),
+		"tomorrow":   time.Date(2020, 9, 17, 8, 0, 0, 0, time.UTC),
+		"Weekend":    time.Date(2020, 9, 19, 8, 0, 0, 0, time.UTC),
+		"NextWeek":   time.Date(2020, 9, 21, 8, 0, 0, 0, time.UTC),
+		"NextMonth":  time.Date(2020, 10, 1, 8, 0, 0, 0, time.UTC),
+		"5h":         time.Date(2020, 9, 16, 19, 30, 0, 0, time.UTC),
+		"2d":         time.Date(2020, 9, 18, 14, 30, 0, 0, time.UTC),
+		"1w":         time.Date(2020, 9, 23, 14, 30, 0, 0, time.UTC),
+		"2020-12-24": time.Date(2020, 12, 24, 8, 0, 0, 0, time.UTC),
+	} {
+		wakeAt, err := ParseSnoozeTarget(target, now)
+		require.NoError(t, err, target)
+		require.Equal(t, want, wakeAt, target)
+	}
+
+	for _, target := range []string{"", "Later", "0d", "-1h", "3m", "2020-01-01"} {
+		_, err := ParseSnoozeTarget(target, now)
+		require.Error(t, err, target)
+	}
+}
+
+func TestWakeSnoozedMessages(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	now := time.Now()
+
+	insertMessage(t, m, "msg1", "Due", addr1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	insertMessage(t, m, "msg2", "Not due", addr1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+
+	require.NoError(t, m.store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(snoozedBucket)
+		for _, msg := range []*SnoozedMessage{
+			{MessageID: "msg1", AddressID: addrID1, LabelID: pmapi.InboxLabel, Target: SnoozeTomorrow, WakeAt: now.Add(-time.Minute)},
+			{MessageID: "msg2", AddressID: addrID1, LabelID: pmapi.InboxLabel, Target: SnoozeNextWeek, WakeAt: now.Add(time.Hour)},
+			{MessageID: "deleted", AddressID: addrID1, LabelID: pmapi.InboxLabel, Target: SnoozeTomorrow, WakeAt: now.Add(-time.Hour)},
+		} {
+			if err := txPutSnoozedMessage(b, msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	m.client.EXPECT().LabelMessages(gomock.Any(), []string{"msg1"}, pmapi.InboxLabel).Return(nil)
+	m.client.EXPECT().MarkMessagesUnread(gomock.Any(), []string{"msg1"}).Return(nil)
+
+	m.store.wakeSnoozedMessages(now)
+
+	msgs, err := m.store.GetSnoozedMessages()
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, "msg2", msgs[0].MessageID)
+	require.Equal(t, uint32(2), msgs[0].UID)
+}
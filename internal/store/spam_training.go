@@ -0,0 +1,48 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// getMessageIDsInSpam returns IDs of the messages which are in Spam
+// according to the local database.
+func (store *Store) getMessageIDsInSpam(apiIDs []string) []string {
+	ids := []string{}
+	for _, apiID := range apiIDs {
+		if msg, err := store.getMessageFromDB(apiID); err == nil && msg.HasLabelID(pmapi.SpamLabel) {
+			ids = append(ids, apiID)
+		}
+	}
+	return ids
+}
+
+// reportHam reports messages moved out of Spam by the user to train the
+// spam filter. The move already happened, so a failed report is only logged.
+func (store *Store) reportHam(apiIDs []string) {
+	if len(apiIDs) == 0 {
+		return
+	}
+
+	if err := store.client().MarkMessagesHam(store.ctx, apiIDs); err != nil {
+		store.log.WithError(err).WithField("messages", len(apiIDs)).Warn("Cannot report messages as not spam")
+		return
+	}
+	store.log.WithField("messages", len(apiIDs)).Debug("Messages were reported as not spam")
+}
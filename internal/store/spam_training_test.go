@@ -0,0 +1,76 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoveFromSpamReportsHam(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.SpamLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	inbox, err := m.store.addresses[addrID1].GetMailbox("INBOX")
+	require.NoError(t, err)
+
+	m.client.EXPECT().LabelMessages(gomock.Any(), []string{"msg1", "msg2"}, pmapi.InboxLabel).Return(nil)
+	m.client.EXPECT().MarkMessagesHam(gomock.Any(), []string{"msg1"}).Return(nil)
+	require.NoError(t, inbox.LabelMessages([]string{"msg1", "msg2"}))
+}
+
+func TestMoveFromSpamToTrashDoesNotReportHam(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.SpamLabel})
+
+	trash, err := m.store.addresses[addrID1].GetMailbox("Trash")
+	require.NoError(t, err)
+
+	m.client.EXPECT().LabelMessages(gomock.Any(), []string{"msg1"}, pmapi.TrashLabel).Return(nil)
+	require.NoError(t, trash.LabelMessages([]string{"msg1"}))
+}
+
+func TestUnlabelSpamReportsHam(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.SpamLabel})
+
+	spam, err := m.store.addresses[addrID1].GetMailbox("Spam")
+	require.NoError(t, err)
+
+	// Failed report does not fail the move.
+	m.client.EXPECT().UnlabelMessages(gomock.Any(), []string{"msg1"}, pmapi.SpamLabel).Return(nil)
+	m.client.EXPECT().MarkMessagesHam(gomock.Any(), []string{"msg1"}).Return(errors.New("offline"))
+	require.NoError(t, spam.UnlabelMessages([]string{"msg1"}))
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// Statistics describes the content of the local database. It contains only
+// counts and sizes so it can be shared in diagnostics.
+type Statistics struct {
+	Messages          int
+	Mailboxes         int
+	ScheduledMessages int
+	Tombstones        int
+	DatabaseSize      int64
+	SyncFinished      bool
+	InboxUnread       int
+
+	CachedMessages      int
+	MessageCacheSize    int64
+	AttachmentCacheSize int64
+}
+
+// GetStatistics returns counts of items stored in the local database.
+func (store *Store) GetStatistics() (stats Statistics, err error) {
+	inboxes := []*Mailbox{}
+
+	store.lock.RLock()
+	for _, address := range store.addresses {
+		stats.Mailboxes += len(address.mailboxes)
+		if inbox, err := address.getMailboxByID(pmapi.InboxLabel); err == nil {
+			inboxes = append(inboxes, inbox)
+		}
+	}
+	store.lock.RUnlock()
+
+	stats.SyncFinished = store.isSyncFinished()
+
+	err = store.db.View(func(tx storage.Tx) error {
+		stats.Messages = tx.Bucket(metadataBucket).KeyN()
+		stats.ScheduledMessages = tx.Bucket(outboxBucket).KeyN()
+		stats.Tombstones = tx.Bucket(tombstonesBucket).KeyN()
+		stats.DatabaseSize = tx.Size()
+
+		// In split mode every address has own Inbox.
+		for _, inbox := range inboxes {
+			_, unread, _, err := inbox.txGetCounts(tx)
+			if err != nil {
+				return err
+			}
+			stats.InboxUnread += int(unread)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	if store.messageCache != nil {
+		stats.CachedMessages, stats.MessageCacheSize = store.messageCache.UserUsage(store.UserID())
+	}
+	if store.attachmentCache != nil {
+		stats.AttachmentCacheSize = store.attachmentCache.UserSize(store.UserID())
+	}
+	return
+}
+
+// CompactCache removes cached messages and attachments of messages which
+// are no longer in the local database and returns the freed size in bytes.
+// Copies of deleted messages which can still be restored are kept.
+func (store *Store) CompactCache() (freed int64, err error) {
+	if store.messageCache == nil && store.attachmentCache == nil {
+		return 0, nil
+	}
+
+	messageIDs := []string{}
+	if err = store.db.View(func(tx storage.Tx) error {
+		for _, bucket := range [][]byte{metadataBucket, tombstonesBucket} {
+			if err := tx.Bucket(bucket).ForEach(func(k, _ []byte) error {
+				messageIDs = append(messageIDs, string(k))
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return
+	}
+
+	if store.messageCache != nil {
+		freed += store.messageCache.Compact(store.UserID(), messageIDs)
+	}
+	if store.attachmentCache != nil {
+		freed += store.attachmentCache.Compact(store.UserID(), messageIDs)
+	}
+
+	store.log.WithField("freed", freed).Info("Cache compacted")
+	return
+}
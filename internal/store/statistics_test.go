@@ -0,0 +1,87 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetStatistics(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	stats, err := m.store.GetStatistics()
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.Messages)
+	require.NotZero(t, stats.Mailboxes)
+	require.Zero(t, stats.ScheduledMessages)
+	require.NotZero(t, stats.DatabaseSize)
+	require.Equal(t, 1, stats.InboxUnread)
+}
+
+func TestCompactCache(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	messageCache, _, clearMessageCache := newTestMessageCache(t, 1000)
+	defer clearMessageCache()
+	m.store.messageCache = messageCache
+	attachmentCache, _, clearAttachmentCache := newTestAttachmentCache(t, 1000)
+	defer clearAttachmentCache()
+	m.store.attachmentCache = attachmentCache
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	m.store.SetCachedMessage("msg1", []byte("body1"))
+	m.store.SetCachedMessage("gone", []byte("body of removed message"))
+	require.NoError(t, attachmentCache.Set(m.store.UserID(), "msg1", "att1", []byte("logo")))
+	require.NoError(t, attachmentCache.Set(m.store.UserID(), "gone", "att2", []byte("document")))
+	require.NoError(t, messageCache.Set("otherUserID", "other", []byte("body of other user")))
+
+	stats, err := m.store.GetStatistics()
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.CachedMessages)
+	require.NotZero(t, stats.MessageCacheSize)
+	require.NotZero(t, stats.AttachmentCacheSize)
+
+	freed, err := m.store.CompactCache()
+	require.NoError(t, err)
+	require.NotZero(t, freed)
+
+	after, err := m.store.GetStatistics()
+	require.NoError(t, err)
+	require.Equal(t, 1, after.CachedMessages)
+	require.Equal(t, stats.MessageCacheSize+stats.AttachmentCacheSize-freed, after.MessageCacheSize+after.AttachmentCacheSize)
+
+	_, ok := m.store.GetCachedMessage("msg1")
+	require.True(t, ok)
+	_, ok = getCachedAttachment(t, attachmentCache, m.store.UserID(), "msg1", "att1")
+	require.True(t, ok)
+	_, ok = getCachedAttachment(t, attachmentCache, m.store.UserID(), "gone", "att2")
+	require.False(t, ok)
+	_, ok = messageCache.Get("otherUserID", "other")
+	require.True(t, ok, "other users must not be compacted")
+}
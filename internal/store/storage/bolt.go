@@ -0,0 +1,196 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltDB struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens the Bolt database at path, creating it when it does not exist.
+func OpenBolt(path string) (DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if val, set := os.LookupEnv("BRIDGESTRICTMODE"); set && val == "1" {
+		db.StrictMode = true
+	}
+
+	return &boltDB{db: db}, nil
+}
+
+func (db *boltDB) View(fn func(Tx) error) error {
+	return db.db.View(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (db *boltDB) Update(fn func(Tx) error) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (db *boltDB) Path() string {
+	return db.db.Path()
+}
+
+func (db *boltDB) Close() error {
+	return db.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (tx *boltTx) Bucket(name []byte) Bucket {
+	return newBoltBucket(tx.tx.Bucket(name))
+}
+
+func (tx *boltTx) CreateBucket(name []byte) (Bucket, error) {
+	b, err := tx.tx.CreateBucket(name)
+	if err != nil {
+		return nil, boltError(err)
+	}
+	return newBoltBucket(b), nil
+}
+
+func (tx *boltTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	b, err := tx.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, boltError(err)
+	}
+	return newBoltBucket(b), nil
+}
+
+func (tx *boltTx) DeleteBucket(name []byte) error {
+	return boltError(tx.tx.DeleteBucket(name))
+}
+
+func (tx *boltTx) ForEach(fn func(name []byte, b Bucket) error) error {
+	return tx.tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		return fn(name, newBoltBucket(b))
+	})
+}
+
+func (tx *boltTx) Size() int64 {
+	return tx.tx.Size()
+}
+
+type boltBucket struct {
+	b *bolt.Bucket
+}
+
+// newBoltBucket returns nil interface for missing bucket so callers
+// can compare the result with nil.
+func newBoltBucket(b *bolt.Bucket) Bucket {
+	if b == nil {
+		return nil
+	}
+	return &boltBucket{b: b}
+}
+
+func (b *boltBucket) Get(key []byte) []byte {
+	return b.b.Get(key)
+}
+
+func (b *boltBucket) Put(key, value []byte) error {
+	return boltError(b.b.Put(key, value))
+}
+
+func (b *boltBucket) Delete(key []byte) error {
+	return boltError(b.b.Delete(key))
+}
+
+func (b *boltBucket) Bucket(name []byte) Bucket {
+	return newBoltBucket(b.b.Bucket(name))
+}
+
+func (b *boltBucket) CreateBucket(name []byte) (Bucket, error) {
+	nested, err := b.b.CreateBucket(name)
+	if err != nil {
+		return nil, boltError(err)
+	}
+	return newBoltBucket(nested), nil
+}
+
+func (b *boltBucket) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	nested, err := b.b.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, boltError(err)
+	}
+	return newBoltBucket(nested), nil
+}
+
+func (b *boltBucket) DeleteBucket(name []byte) error {
+	return boltError(b.b.DeleteBucket(name))
+}
+
+func (b *boltBucket) Cursor() Cursor {
+	return b.b.Cursor()
+}
+
+func (b *boltBucket) ForEach(fn func(k, v []byte) error) error {
+	return b.b.ForEach(fn)
+}
+
+func (b *boltBucket) KeyN() int {
+	return b.b.Stats().KeyN
+}
+
+func (b *boltBucket) Sequence() uint64 {
+	return b.b.Sequence()
+}
+
+func (b *boltBucket) SetSequence(v uint64) error {
+	return boltError(b.b.SetSequence(v))
+}
+
+func (b *boltBucket) NextSequence() (uint64, error) {
+	seq, err := b.b.NextSequence()
+	return seq, boltError(err)
+}
+
+// boltError translates Bolt errors to errors of this package so they can be
+// compared the same way for all backends.
+func boltError(err error) error {
+	switch err {
+	case bolt.ErrBucketNotFound:
+		return ErrBucketNotFound
+	case bolt.ErrBucketExists:
+		return ErrBucketExists
+	case bolt.ErrBucketNameRequired:
+		return ErrBucketNameRequired
+	case bolt.ErrKeyRequired:
+		return ErrKeyRequired
+	case bolt.ErrIncompatibleValue:
+		return ErrIncompatibleValue
+	case bolt.ErrTxNotWritable:
+		return ErrTxNotWritable
+	default:
+		return err
+	}
+}
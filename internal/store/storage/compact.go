@@ -0,0 +1,321 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Suffixes of files created next to the database during compaction.
+const (
+	compactSuffix = ".compact"
+	backupSuffix  = ".backup"
+)
+
+// swapTimeout is how long the compaction waits for running transactions
+// before the compacted file replaces the database.
+var swapTimeout = 30 * time.Second //nolint[gochecknoglobals]
+
+// ErrSwapTimeout is returned when the database was in use for too long to
+// be replaced by the compacted copy. The database is left as it was.
+var ErrSwapTimeout = errors.New("database is still in use, compaction aborted") //nolint[gochecknoglobals]
+
+// Compacter is a database which can be compacted while it is open.
+type Compacter interface {
+	// Compact rewrites the database into a new file which replaces the
+	// current one. Progress is called with the number of copied and all
+	// top-level keys. Sizes of the database before and after are returned.
+	Compact(progress func(done, total int)) (before, after int64, err error)
+}
+
+// CompactableDB is a database which can be compacted while it is used.
+// The data is copied to a new file first, then writes are blocked until
+// all running transactions finish and the new file replaces the old one.
+// The old file is kept as a backup until the new one is opened.
+type CompactableDB struct {
+	backend string
+
+	// writeLock allows only one writer or the compaction at a time.
+	writeLock sync.Mutex
+
+	lock     sync.Mutex
+	cond     *sync.Cond
+	db       DB
+	active   int
+	swapping bool
+}
+
+// NewCompactable wraps the database opened with the backend.
+func NewCompactable(db DB, backend string) *CompactableDB {
+	c := &CompactableDB{backend: backend, db: db}
+	c.cond = sync.NewCond(&c.lock)
+	return c
+}
+
+// OpenCompactable opens the database of the given backend at path which
+// can be compacted.
+func OpenCompactable(backend, path string) (*CompactableDB, error) {
+	db, err := Open(backend, path)
+	if err != nil {
+		return nil, err
+	}
+	return NewCompactable(db, backend), nil
+}
+
+// acquire returns the current database and marks it as used so it is not
+// replaced until release is called.
+func (c *CompactableDB) acquire() DB {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for c.swapping {
+		c.cond.Wait()
+	}
+	c.active++
+	return c.db
+}
+
+func (c *CompactableDB) release() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.active--
+	c.cond.Broadcast()
+}
+
+func (c *CompactableDB) View(fn func(Tx) error) error {
+	db := c.acquire()
+	defer c.release()
+
+	return db.View(fn)
+}
+
+func (c *CompactableDB) Update(fn func(Tx) error) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	db := c.acquire()
+	defer c.release()
+
+	return db.Update(fn)
+}
+
+func (c *CompactableDB) Path() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.db.Path()
+}
+
+func (c *CompactableDB) Close() error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.db.Close()
+}
+
+// Compact implements Compacter. Reads are served during the whole
+// compaction, writes wait until it is finished.
+func (c *CompactableDB) Compact(progress func(done, total int)) (before, after int64, err error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	db := c.acquire()
+	path := db.Path()
+	tmpPath := path + compactSuffix
+
+	removeFiles(tmpPath)
+	err = c.copyToFile(db, tmpPath, progress)
+	if err == nil {
+		before, err = dbSize(db)
+	}
+	c.release()
+	if err != nil {
+		removeFiles(tmpPath)
+		return 0, 0, err
+	}
+
+	if err = c.swap(path, tmpPath); err != nil {
+		removeFiles(tmpPath)
+		return before, 0, err
+	}
+
+	after, err = dbSize(c)
+	return before, after, err
+}
+
+// copyToFile writes all data of db to a new database at path and syncs
+// it to the disk.
+func (c *CompactableDB) copyToFile(db DB, path string, progress func(done, total int)) error {
+	dst, err := Open(c.backend, path)
+	if err != nil {
+		return errors.Wrap(err, "failed to create compacted database")
+	}
+
+	if err := CopyWithProgress(dst, db, progress); err != nil {
+		_ = dst.Close()
+		return errors.Wrap(err, "failed to copy database")
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return syncFile(path)
+}
+
+// swap waits for running transactions and replaces the database by
+// the compacted file. When the compacted file cannot be opened, the old
+// database is restored from the backup.
+func (c *CompactableDB) swap(path, tmpPath string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.swapping = true
+	defer func() {
+		c.swapping = false
+		c.cond.Broadcast()
+	}()
+
+	timedOut := false
+	timer := time.AfterFunc(swapTimeout, func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		timedOut = true
+		c.cond.Broadcast()
+	})
+	defer timer.Stop()
+
+	for c.active > 0 && !timedOut {
+		c.cond.Wait()
+	}
+	if c.active > 0 {
+		return ErrSwapTimeout
+	}
+
+	if err := c.db.Close(); err != nil {
+		return errors.Wrap(err, "failed to close database")
+	}
+
+	backupPath := path + backupSuffix
+	removeFiles(backupPath)
+
+	restore := func(cause error) error {
+		if _, err := os.Stat(backupPath); err == nil {
+			if err := os.Rename(backupPath, path); err != nil {
+				return errors.Wrapf(cause, "and failed to restore backup %s", backupPath)
+			}
+		}
+		db, err := Open(c.backend, path)
+		if err != nil {
+			return errors.Wrapf(cause, "and failed to reopen database")
+		}
+		c.db = db
+		return cause
+	}
+
+	if err := os.Rename(path, backupPath); err != nil {
+		return restore(errors.Wrap(err, "failed to back up database"))
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return restore(errors.Wrap(err, "failed to replace database"))
+	}
+	// Directories cannot be synced on Windows, the rename is durable there.
+	_ = syncFile(filepath.Dir(path))
+
+	db, err := Open(c.backend, path)
+	if err != nil {
+		return restore(errors.Wrap(err, "failed to open compacted database"))
+	}
+	c.db = db
+
+	removeFiles(backupPath)
+	return nil
+}
+
+// CopyWithProgress copies all buckets from src to dst. Each top-level
+// bucket is copied in its own transaction of dst, so dst should not be
+// used until the copy is finished. Progress can be nil.
+func CopyWithProgress(dst, src DB, progress func(done, total int)) error {
+	return src.View(func(srcTx Tx) error {
+		total := 0
+		if err := srcTx.ForEach(func(_ []byte, b Bucket) error {
+			total += b.KeyN()
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		done := 0
+		return srcTx.ForEach(func(name []byte, srcBucket Bucket) error {
+			if err := dst.Update(func(dstTx Tx) error {
+				dstBucket, err := dstTx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(dstBucket, srcBucket)
+			}); err != nil {
+				return err
+			}
+
+			done += srcBucket.KeyN()
+			if progress != nil {
+				progress(done, total)
+			}
+			return nil
+		})
+	})
+}
+
+func dbSize(db DB) (size int64, err error) {
+	err = db.View(func(tx Tx) error {
+		size = tx.Size()
+		return nil
+	})
+	return
+}
+
+// syncFile flushes the file or directory to the disk.
+func syncFile(path string) error {
+	f, err := os.Open(path) //nolint[gosec]
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// removeFiles removes the database file and journal files SQLite could
+// leave next to it.
+func removeFiles(path string) {
+	for _, filePath := range []string{path, path + "-wal", path + "-shm"} {
+		_ = os.Remove(filePath)
+	}
+}
@@ -0,0 +1,451 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite" // Registers the pure Go SQLite driver.
+)
+
+// sqliteDriverName is the name under which the SQLite driver registers
+// itself in database/sql.
+const sqliteDriverName = "sqlite"
+
+// sqlitePragmas are set on every connection. The busy timeout is per
+// connection; WAL is stored in the database so readers do not wait for
+// the writer.
+var sqlitePragmas = []string{ //nolint[gochecknoglobals]
+	"PRAGMA busy_timeout = 5000",
+	"PRAGMA journal_mode = WAL",
+}
+
+// sqliteSchema stores buckets as a tree. Top-level buckets have parent 0.
+// Keys are compared as bytes, the same way as in Bolt.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS buckets (
+	id       INTEGER PRIMARY KEY,
+	parent   INTEGER NOT NULL,
+	name     BLOB NOT NULL,
+	sequence INTEGER NOT NULL DEFAULT 0,
+	UNIQUE (parent, name)
+);
+CREATE TABLE IF NOT EXISTS entries (
+	bucket INTEGER NOT NULL,
+	key    BLOB NOT NULL,
+	value  BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+) WITHOUT ROWID;
+`
+
+type sqliteDB struct {
+	db   *sql.DB
+	path string
+
+	// writeLock allows only one Update at a time, like in Bolt, so writers
+	// never fail on a locked database. Readers are not blocked thanks to WAL.
+	writeLock sync.Mutex
+}
+
+// OpenSQLite opens the SQLite database at path, creating it when it does
+// not exist.
+func OpenSQLite(path string) (DB, error) {
+	sqlDB, err := sql.Open(sqliteDriverName, "")
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(&sqliteConnector{driver: sqlDB.Driver(), path: path})
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "failed to create schema")
+	}
+
+	return &sqliteDB{db: db, path: path}, nil
+}
+
+// sqliteConnector opens connections to the database and sets pragmas on
+// each of them, because the driver does not accept them in the path.
+type sqliteConnector struct {
+	driver driver.Driver
+	path   string
+}
+
+func (c *sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		_ = conn.Close()
+		return nil, errors.New("SQLite connection cannot execute statements")
+	}
+	for _, pragma := range sqlitePragmas {
+		if _, err := execer.ExecContext(ctx, pragma, nil); err != nil {
+			_ = conn.Close()
+			return nil, errors.Wrap(err, "failed to set pragma")
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *sqliteConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func (db *sqliteDB) View(fn func(Tx) error) error {
+	return db.run(false, fn)
+}
+
+func (db *sqliteDB) Update(fn func(Tx) error) error {
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+
+	return db.run(true, fn)
+}
+
+func (db *sqliteDB) run(writable bool, fn func(Tx) error) error {
+	sqlTx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	// Rollback after commit does nothing; it is here for panics and errors.
+	defer sqlTx.Rollback() //nolint[errcheck]
+
+	tx := &sqliteTx{tx: sqlTx, writable: writable}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if tx.err != nil {
+		return tx.err
+	}
+
+	if !writable {
+		return nil
+	}
+	return sqlTx.Commit()
+}
+
+func (db *sqliteDB) Path() string {
+	return db.path
+}
+
+func (db *sqliteDB) Close() error {
+	return db.db.Close()
+}
+
+// sqliteTx remembers the first failed query of methods which cannot return
+// an error, e.g. Get. Such transaction is never committed.
+type sqliteTx struct {
+	tx       *sql.Tx
+	writable bool
+	err      error
+}
+
+func (tx *sqliteTx) fail(err error) {
+	if tx.err == nil {
+		tx.err = err
+	}
+}
+
+func (tx *sqliteTx) root() *sqliteBucket {
+	return &sqliteBucket{tx: tx, id: 0}
+}
+
+func (tx *sqliteTx) Bucket(name []byte) Bucket {
+	return tx.root().Bucket(name)
+}
+
+func (tx *sqliteTx) CreateBucket(name []byte) (Bucket, error) {
+	return tx.root().CreateBucket(name)
+}
+
+func (tx *sqliteTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	return tx.root().CreateBucketIfNotExists(name)
+}
+
+func (tx *sqliteTx) DeleteBucket(name []byte) error {
+	return tx.root().DeleteBucket(name)
+}
+
+func (tx *sqliteTx) ForEach(fn func(name []byte, b Bucket) error) error {
+	root := tx.root()
+	return root.ForEach(func(name, _ []byte) error {
+		return fn(name, root.Bucket(name))
+	})
+}
+
+func (tx *sqliteTx) Size() int64 {
+	var pageCount, pageSize int64
+	if err := tx.tx.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		tx.fail(err)
+		return 0
+	}
+	if err := tx.tx.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		tx.fail(err)
+		return 0
+	}
+	return pageCount * pageSize
+}
+
+type sqliteBucket struct {
+	tx *sqliteTx
+	id int64
+}
+
+func (b *sqliteBucket) bucketID(name []byte) (id int64, ok bool) {
+	err := b.tx.tx.QueryRow("SELECT id FROM buckets WHERE parent = ? AND name = ?", b.id, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false
+	}
+	if err != nil {
+		b.tx.fail(err)
+		return 0, false
+	}
+	return id, true
+}
+
+func (b *sqliteBucket) Get(key []byte) []byte {
+	var value []byte
+	err := b.tx.tx.QueryRow("SELECT value FROM entries WHERE bucket = ? AND key = ?", b.id, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		b.tx.fail(err)
+		return nil
+	}
+	// Empty value must be distinguishable from missing key.
+	if value == nil {
+		value = []byte{}
+	}
+	return value
+}
+
+func (b *sqliteBucket) Put(key, value []byte) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+	if len(key) == 0 {
+		return ErrKeyRequired
+	}
+	if _, ok := b.bucketID(key); ok {
+		return ErrIncompatibleValue
+	}
+
+	// The driver binds an empty slice as NULL.
+	_, err := b.tx.tx.Exec("INSERT OR REPLACE INTO entries (bucket, key, value) VALUES (?, ?, COALESCE(?, X''))", b.id, key, value)
+	return err
+}
+
+func (b *sqliteBucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+
+	_, err := b.tx.tx.Exec("DELETE FROM entries WHERE bucket = ? AND key = ?", b.id, key)
+	return err
+}
+
+func (b *sqliteBucket) Bucket(name []byte) Bucket {
+	id, ok := b.bucketID(name)
+	if !ok {
+		return nil
+	}
+	return &sqliteBucket{tx: b.tx, id: id}
+}
+
+func (b *sqliteBucket) CreateBucket(name []byte) (Bucket, error) {
+	if !b.tx.writable {
+		return nil, ErrTxNotWritable
+	}
+	if len(name) == 0 {
+		return nil, ErrBucketNameRequired
+	}
+	if _, ok := b.bucketID(name); ok {
+		return nil, ErrBucketExists
+	}
+	if b.Get(name) != nil {
+		return nil, ErrIncompatibleValue
+	}
+
+	res, err := b.tx.tx.Exec("INSERT INTO buckets (parent, name) VALUES (?, ?)", b.id, name)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteBucket{tx: b.tx, id: id}, nil
+}
+
+func (b *sqliteBucket) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	if nested := b.Bucket(name); nested != nil {
+		return nested, nil
+	}
+	return b.CreateBucket(name)
+}
+
+// sqliteSubtree selects the bucket and all buckets nested in it.
+const sqliteSubtree = `WITH RECURSIVE subtree (id) AS (
+	SELECT ? UNION ALL SELECT buckets.id FROM buckets JOIN subtree ON buckets.parent = subtree.id
+) `
+
+func (b *sqliteBucket) DeleteBucket(name []byte) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+	id, ok := b.bucketID(name)
+	if !ok {
+		return ErrBucketNotFound
+	}
+
+	if _, err := b.tx.tx.Exec(sqliteSubtree+"DELETE FROM entries WHERE bucket IN subtree", id); err != nil {
+		return err
+	}
+	_, err := b.tx.tx.Exec(sqliteSubtree+"DELETE FROM buckets WHERE id IN subtree", id)
+	return err
+}
+
+func (b *sqliteBucket) Cursor() Cursor {
+	return &sqliteCursor{b: b}
+}
+
+func (b *sqliteBucket) ForEach(fn func(k, v []byte) error) error {
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return b.tx.err
+}
+
+func (b *sqliteBucket) KeyN() int {
+	var n int
+	if err := b.tx.tx.QueryRow(
+		"SELECT (SELECT COUNT(*) FROM entries WHERE bucket = ?1) + (SELECT COUNT(*) FROM buckets WHERE parent = ?1)",
+		b.id,
+	).Scan(&n); err != nil {
+		b.tx.fail(err)
+	}
+	return n
+}
+
+func (b *sqliteBucket) Sequence() uint64 {
+	var seq int64
+	err := b.tx.tx.QueryRow("SELECT sequence FROM buckets WHERE id = ?", b.id).Scan(&seq)
+	if err != nil && err != sql.ErrNoRows {
+		b.tx.fail(err)
+	}
+	return uint64(seq)
+}
+
+func (b *sqliteBucket) SetSequence(v uint64) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+
+	_, err := b.tx.tx.Exec("UPDATE buckets SET sequence = ? WHERE id = ?", int64(v), b.id)
+	return err
+}
+
+func (b *sqliteBucket) NextSequence() (uint64, error) {
+	if !b.tx.writable {
+		return 0, ErrTxNotWritable
+	}
+
+	if _, err := b.tx.tx.Exec("UPDATE buckets SET sequence = sequence + 1 WHERE id = ?", b.id); err != nil {
+		return 0, err
+	}
+	return b.Sequence(), b.tx.err
+}
+
+// sqliteEntries lists keys of the bucket together with names of nested
+// buckets which have no value.
+const sqliteEntries = `SELECT key, value, nested FROM (
+	SELECT key, value, 0 AS nested FROM entries WHERE bucket = ?1
+	UNION ALL SELECT name, NULL, 1 FROM buckets WHERE parent = ?1
+) `
+
+// sqliteCursor queries the next key every time it moves so the bucket can be
+// read by other queries in the meantime.
+type sqliteCursor struct {
+	b   *sqliteBucket
+	key []byte
+}
+
+func (c *sqliteCursor) query(condition string, args ...interface{}) (key, value []byte) {
+	var nested bool
+	err := c.b.tx.tx.QueryRow(sqliteEntries+condition, append([]interface{}{c.b.id}, args...)...).Scan(&key, &value, &nested)
+	if err == sql.ErrNoRows {
+		c.key = nil
+		return nil, nil
+	}
+	if err != nil {
+		c.b.tx.fail(err)
+		c.key = nil
+		return nil, nil
+	}
+
+	c.key = key
+	if nested {
+		return key, nil
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return key, value
+}
+
+func (c *sqliteCursor) First() (key, value []byte) {
+	return c.query("ORDER BY key LIMIT 1")
+}
+
+func (c *sqliteCursor) Last() (key, value []byte) {
+	return c.query("ORDER BY key DESC LIMIT 1")
+}
+
+func (c *sqliteCursor) Next() (key, value []byte) {
+	if c.key == nil {
+		return nil, nil
+	}
+	return c.query("WHERE key > ?2 ORDER BY key LIMIT 1", c.key)
+}
+
+func (c *sqliteCursor) Prev() (key, value []byte) {
+	if c.key == nil {
+		return nil, nil
+	}
+	return c.query("WHERE key < ?2 ORDER BY key DESC LIMIT 1", c.key)
+}
+
+func (c *sqliteCursor) Seek(seek []byte) (key, value []byte) {
+	if len(seek) == 0 {
+		return c.First()
+	}
+	return c.query("WHERE key >= ?2 ORDER BY key LIMIT 1", seek)
+}
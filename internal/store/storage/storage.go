@@ -0,0 +1,158 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package storage provides the key-value database of the store with nested
+// buckets. Bolt is the default backend, SQLite can be used instead so reads
+// are not blocked by long writes during sync.
+package storage
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Supported storage backends.
+const (
+	BoltBackend   = "bolt"
+	SQLiteBackend = "sqlite"
+)
+
+var (
+	ErrBucketNotFound     = errors.New("bucket not found")
+	ErrBucketExists       = errors.New("bucket already exists")
+	ErrBucketNameRequired = errors.New("bucket name required")
+	ErrKeyRequired        = errors.New("key required")
+	ErrIncompatibleValue  = errors.New("incompatible value")
+	ErrTxNotWritable      = errors.New("tx not writable")
+)
+
+// DB is a database of buckets with sorted keys. Only one Update runs at
+// a time, View can run concurrently.
+type DB interface {
+	// View runs fn in a read-only transaction.
+	View(fn func(Tx) error) error
+
+	// Update runs fn in a read-write transaction which is committed when
+	// fn returns no error.
+	Update(fn func(Tx) error) error
+
+	// Path returns the path of the database file.
+	Path() string
+
+	Close() error
+}
+
+// Tx is a transaction. Values returned by it are valid only until
+// the end of the transaction.
+type Tx interface {
+	// Bucket returns the top-level bucket or nil when it does not exist.
+	Bucket(name []byte) Bucket
+	CreateBucket(name []byte) (Bucket, error)
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+	DeleteBucket(name []byte) error
+
+	// ForEach calls fn for every top-level bucket.
+	ForEach(fn func(name []byte, b Bucket) error) error
+
+	// Size returns the size of the database in bytes.
+	Size() int64
+}
+
+// Bucket is a collection of keys and nested buckets sorted by bytes.
+type Bucket interface {
+	// Get returns the value of the key or nil when the key does not exist
+	// or is a nested bucket.
+	Get(key []byte) []byte
+	Put(key, value []byte) error
+	Delete(key []byte) error
+
+	// Bucket returns the nested bucket or nil when it does not exist.
+	Bucket(name []byte) Bucket
+	CreateBucket(name []byte) (Bucket, error)
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+	DeleteBucket(name []byte) error
+
+	Cursor() Cursor
+
+	// ForEach calls fn for every key in order. Value of nested bucket is nil.
+	// The bucket must not be changed by fn.
+	ForEach(fn func(k, v []byte) error) error
+
+	// KeyN returns the number of keys and nested buckets. Changes made in
+	// the same transaction are not counted by Bolt.
+	KeyN() int
+
+	Sequence() uint64
+	SetSequence(v uint64) error
+	NextSequence() (uint64, error)
+}
+
+// Cursor iterates keys of the bucket in order. Value of nested bucket is nil,
+// key is nil when there is nothing more.
+type Cursor interface {
+	First() (key, value []byte)
+	Last() (key, value []byte)
+	Next() (key, value []byte)
+	Prev() (key, value []byte)
+
+	// Seek moves to the key or the next one after it.
+	Seek(seek []byte) (key, value []byte)
+}
+
+// Open opens the database of the given backend at path.
+func Open(backend, path string) (DB, error) {
+	switch backend {
+	case BoltBackend, "":
+		return OpenBolt(path)
+	case SQLiteBackend:
+		return OpenSQLite(path)
+	default:
+		return nil, errors.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// Copy copies all buckets from src to dst in one transaction.
+func Copy(dst, src DB) error {
+	return src.View(func(srcTx Tx) error {
+		return dst.Update(func(dstTx Tx) error {
+			return srcTx.ForEach(func(name []byte, srcBucket Bucket) error {
+				dstBucket, err := dstTx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(dstBucket, srcBucket)
+			})
+		})
+	})
+}
+
+func copyBucket(dst, src Bucket) error {
+	if err := src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+
+		dstNested, err := dst.CreateBucketIfNotExists(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(dstNested, src.Bucket(k))
+	}); err != nil {
+		return err
+	}
+
+	return dst.SetSequence(src.Sequence())
+}
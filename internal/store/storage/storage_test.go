@@ -0,0 +1,307 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func openTestDB(t *testing.T, backend string) (DB, func()) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+
+	db, err := Open(backend, filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+
+	return db, func() {
+		_ = db.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func forEachBackend(t *testing.T, test func(t *testing.T, db DB)) {
+	for _, backend := range []string{BoltBackend, SQLiteBackend} {
+		backend := backend
+		t.Run(backend, func(t *testing.T) {
+			db, clear := openTestDB(t, backend)
+			defer clear()
+
+			test(t, db)
+		})
+	}
+}
+
+func TestBucketsAndKeys(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db DB) {
+		require.NoError(t, db.Update(func(tx Tx) error {
+			b, err := tx.CreateBucket([]byte("b"))
+			require.NoError(t, err)
+			require.NoError(t, b.Put([]byte("k2"), []byte("v2")))
+			require.NoError(t, b.Put([]byte("k1"), []byte{}))
+			require.NoError(t, b.Put([]byte("k3"), []byte("v3")))
+
+			_, err = b.CreateBucket([]byte("k2-nested"))
+			require.NoError(t, err)
+
+			_, err = tx.CreateBucket([]byte("b"))
+			require.Equal(t, ErrBucketExists, err)
+			require.Equal(t, ErrIncompatibleValue, b.Put([]byte("k2-nested"), []byte("v")))
+			return nil
+		}))
+
+		require.NoError(t, db.View(func(tx Tx) error {
+			require.Nil(t, tx.Bucket([]byte("missing")))
+
+			b := tx.Bucket([]byte("b"))
+			require.NotNil(t, b)
+			require.Equal(t, []byte("v2"), b.Get([]byte("k2")))
+			require.Equal(t, []byte{}, b.Get([]byte("k1")))
+			require.Nil(t, b.Get([]byte("missing")))
+			require.Nil(t, b.Get([]byte("k2-nested")))
+			require.NotNil(t, b.Bucket([]byte("k2-nested")))
+			require.Equal(t, 4, b.KeyN())
+
+			var keys []string
+			require.NoError(t, b.ForEach(func(k, v []byte) error {
+				keys = append(keys, string(k))
+				return nil
+			}))
+			require.Equal(t, []string{"k1", "k2", "k2-nested", "k3"}, keys)
+
+			require.Equal(t, ErrTxNotWritable, b.Put([]byte("k4"), []byte("v4")))
+			return nil
+		}))
+
+		require.NoError(t, db.Update(func(tx Tx) error {
+			b := tx.Bucket([]byte("b"))
+			require.NoError(t, b.Delete([]byte("k2")))
+			require.NoError(t, b.DeleteBucket([]byte("k2-nested")))
+			require.Equal(t, ErrBucketNotFound, b.DeleteBucket([]byte("k2-nested")))
+			return nil
+		}))
+
+		require.NoError(t, db.View(func(tx Tx) error {
+			require.Equal(t, 2, tx.Bucket([]byte("b")).KeyN())
+			return nil
+		}))
+	})
+}
+
+func TestCursor(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db DB) {
+		require.NoError(t, db.Update(func(tx Tx) error {
+			b, err := tx.CreateBucket([]byte("b"))
+			require.NoError(t, err)
+			for _, key := range []string{"a", "c", "e"} {
+				require.NoError(t, b.Put([]byte(key), []byte("value-"+key)))
+			}
+			return nil
+		}))
+
+		require.NoError(t, db.View(func(tx Tx) error {
+			c := tx.Bucket([]byte("b")).Cursor()
+
+			k, v := c.First()
+			require.Equal(t, "a", string(k))
+			require.Equal(t, "value-a", string(v))
+
+			k, _ = c.Next()
+			require.Equal(t, "c", string(k))
+
+			k, _ = c.Seek([]byte("d"))
+			require.Equal(t, "e", string(k))
+
+			k, _ = c.Next()
+			require.Nil(t, k)
+
+			k, _ = c.Last()
+			require.Equal(t, "e", string(k))
+
+			k, _ = c.Prev()
+			require.Equal(t, "c", string(k))
+
+			k, _ = c.Seek([]byte{})
+			require.Equal(t, "a", string(k))
+			return nil
+		}))
+	})
+}
+
+func TestSequence(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db DB) {
+		require.NoError(t, db.Update(func(tx Tx) error {
+			b, err := tx.CreateBucket([]byte("b"))
+			require.NoError(t, err)
+			require.Equal(t, uint64(0), b.Sequence())
+
+			seq, err := b.NextSequence()
+			require.NoError(t, err)
+			require.Equal(t, uint64(1), seq)
+
+			require.NoError(t, b.SetSequence(10))
+			seq, err = b.NextSequence()
+			require.NoError(t, err)
+			require.Equal(t, uint64(11), seq)
+			return nil
+		}))
+	})
+}
+
+func TestUpdateRollsBackOnError(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db DB) {
+		require.Error(t, db.Update(func(tx Tx) error {
+			_, err := tx.CreateBucket([]byte("b"))
+			require.NoError(t, err)
+			return ErrKeyRequired
+		}))
+
+		require.NoError(t, db.View(func(tx Tx) error {
+			require.Nil(t, tx.Bucket([]byte("b")))
+			return nil
+		}))
+	})
+}
+
+func TestCopy(t *testing.T) {
+	src, clearSrc := openTestDB(t, BoltBackend)
+	defer clearSrc()
+	dst, clearDst := openTestDB(t, BoltBackend)
+	defer clearDst()
+
+	require.NoError(t, src.Update(func(tx Tx) error {
+		b, err := tx.CreateBucket([]byte("b"))
+		require.NoError(t, err)
+		require.NoError(t, b.Put([]byte("k"), []byte("v")))
+		require.NoError(t, b.SetSequence(5))
+
+		nested, err := b.CreateBucket([]byte("nested"))
+		require.NoError(t, err)
+		return nested.Put([]byte("nk"), []byte("nv"))
+	}))
+
+	require.NoError(t, Copy(dst, src))
+
+	require.NoError(t, dst.View(func(tx Tx) error {
+		b := tx.Bucket([]byte("b"))
+		require.NotNil(t, b)
+		require.Equal(t, []byte("v"), b.Get([]byte("k")))
+		require.Equal(t, uint64(5), b.Sequence())
+		require.Equal(t, []byte("nv"), b.Bucket([]byte("nested")).Get([]byte("nk")))
+		return nil
+	}))
+}
+
+func TestCompact(t *testing.T) {
+	for _, backend := range []string{BoltBackend, SQLiteBackend} {
+		backend := backend
+		t.Run(backend, func(t *testing.T) {
+			db, clear := openTestDB(t, backend)
+			defer clear()
+			c := NewCompactable(db, backend)
+
+			value := make([]byte, 1024)
+			require.NoError(t, c.Update(func(tx Tx) error {
+				b, err := tx.CreateBucket([]byte("b"))
+				require.NoError(t, err)
+				for i := 0; i < 1000; i++ {
+					require.NoError(t, b.Put([]byte(fmt.Sprintf("k%04d", i)), value))
+				}
+				_, err = tx.CreateBucket([]byte("empty"))
+				return err
+			}))
+			require.NoError(t, c.Update(func(tx Tx) error {
+				b := tx.Bucket([]byte("b"))
+				for i := 1; i < 1000; i++ {
+					require.NoError(t, b.Delete([]byte(fmt.Sprintf("k%04d", i))))
+				}
+				return nil
+			}))
+
+			var lastDone, lastTotal int
+			before, after, err := c.Compact(func(done, total int) {
+				lastDone, lastTotal = done, total
+			})
+			require.NoError(t, err)
+			require.Equal(t, 1, lastDone)
+			require.Equal(t, 1, lastTotal)
+			require.True(t, after < before, "%d < %d", after, before)
+
+			require.NoError(t, c.Update(func(tx Tx) error {
+				require.NotNil(t, tx.Bucket([]byte("empty")))
+				return tx.Bucket([]byte("b")).Put([]byte("new"), []byte("v"))
+			}))
+			require.NoError(t, c.View(func(tx Tx) error {
+				b := tx.Bucket([]byte("b"))
+				require.Equal(t, value, b.Get([]byte("k0000")))
+				require.Nil(t, b.Get([]byte("k0001")))
+				require.Equal(t, []byte("v"), b.Get([]byte("new")))
+				return nil
+			}))
+
+			for _, suffix := range []string{compactSuffix, backupSuffix} {
+				_, err := os.Stat(c.Path() + suffix)
+				require.True(t, os.IsNotExist(err), suffix)
+			}
+		})
+	}
+}
+
+func TestCompactAbortsWhenDatabaseIsInUse(t *testing.T) {
+	db, clear := openTestDB(t, BoltBackend)
+	defer clear()
+	c := NewCompactable(db, BoltBackend)
+
+	defaultTimeout := swapTimeout
+	swapTimeout = 100 * time.Millisecond
+	defer func() { swapTimeout = defaultTimeout }()
+
+	require.NoError(t, c.Update(func(tx Tx) error {
+		b, err := tx.CreateBucket([]byte("b"))
+		require.NoError(t, err)
+		return b.Put([]byte("k"), []byte("v"))
+	}))
+
+	inView := make(chan struct{})
+	finish := make(chan struct{})
+	go func() {
+		_ = c.View(func(tx Tx) error {
+			close(inView)
+			<-finish
+			return nil
+		})
+	}()
+	<-inView
+
+	_, _, err := c.Compact(nil)
+	close(finish)
+	require.Equal(t, ErrSwapTimeout, err)
+
+	_, err = os.Stat(c.Path() + compactSuffix)
+	require.True(t, os.IsNotExist(err))
+	require.NoError(t, c.View(func(tx Tx) error {
+		require.Equal(t, []byte("v"), tx.Bucket([]byte("b")).Get([]byte("k")))
+		return nil
+	}))
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/pkg/errors"
+)
+
+const sqliteDatabaseExt = ".sqlite"
+
+var (
+	storageBackend     = storage.BoltBackend //nolint[gochecknoglobals]
+	storageBackendLock sync.RWMutex          //nolint[gochecknoglobals]
+)
+
+// SetStorageBackend sets the backend of databases of stores opened after
+// the change. Existing database of other backend is converted when the
+// store is opened.
+func SetStorageBackend(backend string) {
+	storageBackendLock.Lock()
+	defer storageBackendLock.Unlock()
+
+	storageBackend = backend
+}
+
+func getStorageBackend() string {
+	storageBackendLock.RLock()
+	defer storageBackendLock.RUnlock()
+
+	return storageBackend
+}
+
+// databasePath returns the path of the database file of the backend. Path
+// of the store is the path of Bolt database.
+func databasePath(path, backend string) string {
+	if backend == storage.SQLiteBackend {
+		return strings.TrimSuffix(path, filepath.Ext(path)) + sqliteDatabaseExt
+	}
+	return path
+}
+
+// databaseFiles returns all files which can belong to the database of
+// the store with any backend.
+func databaseFiles(path string) []string {
+	sqlitePath := databasePath(path, storage.SQLiteBackend)
+	return []string{path, sqlitePath, sqlitePath + "-wal", sqlitePath + "-shm"}
+}
+
+func databaseExists(path string) bool {
+	for _, backend := range []string{storage.BoltBackend, storage.SQLiteBackend} {
+		if _, err := os.Stat(databasePath(path, backend)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// openStorage opens the database with the configured backend. When only
+// the database of the other backend exists, it is copied to the new one
+// and removed so the account does not have to be synced again. When the
+// conversion fails, the new database is removed and the old one is kept,
+// so the conversion is tried again on the next start.
+func openStorage(path string) (storage.DB, error) {
+	backend := getStorageBackend()
+
+	dbPath := databasePath(path, backend)
+	l := log.WithField("path", dbPath).WithField("backend", backend)
+	l.Debug("Opening store database")
+
+	_, statErr := os.Stat(dbPath)
+	isNew := os.IsNotExist(statErr)
+
+	db, err := storage.Open(backend, dbPath)
+	if err != nil {
+		l.WithError(err).Error("Could not open store database")
+		return nil, err
+	}
+
+	if !isNew {
+		return storage.NewCompactable(db, backend), nil
+	}
+
+	for _, other := range []string{storage.BoltBackend, storage.SQLiteBackend} {
+		if other == backend {
+			continue
+		}
+		if err := convertStorage(db, other, databasePath(path, other)); err != nil {
+			l.WithError(err).Error("Could not convert store database")
+			_ = db.Close()
+			if removeErr := removeDatabase(dbPath); removeErr != nil {
+				l.WithError(removeErr).Error("Could not remove partially converted store database")
+			}
+			return nil, err
+		}
+	}
+
+	return storage.NewCompactable(db, backend), nil
+}
+
+// convertStorage copies the database of the other backend to db and removes it.
+// Nothing is done when the other database does not exist.
+func convertStorage(db storage.DB, backend, path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	log.WithField("from", backend).WithField("path", db.Path()).Info("Converting store database")
+
+	src, err := storage.Open(backend, path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open database of previous backend")
+	}
+
+	if err := storage.Copy(db, src); err != nil {
+		_ = src.Close()
+		return errors.Wrap(err, "failed to copy database")
+	}
+
+	if err := src.Close(); err != nil {
+		return err
+	}
+
+	if err := removeDatabase(path); err != nil {
+		return errors.Wrap(err, "failed to remove database of previous backend")
+	}
+
+	return nil
+}
+
+// removeDatabase removes the database file at path of any backend.
+func removeDatabase(path string) error {
+	// SQLite can leave its journal files next to the database.
+	for _, filePath := range []string{path, path + "-wal", path + "-shm"} {
+		if err := os.RemoveAll(filePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenStorageConvertsOtherBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage-backend")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "mailbox.db")
+
+	bolt, err := storage.Open(storage.BoltBackend, path)
+	require.NoError(t, err)
+	require.NoError(t, bolt.Update(func(tx storage.Tx) error {
+		b, err := tx.CreateBucket([]byte("bucket"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("value"))
+	}))
+	require.NoError(t, bolt.Close())
+
+	SetStorageBackend(storage.SQLiteBackend)
+	defer SetStorageBackend(storage.BoltBackend)
+
+	db, err := openStorage(path)
+	require.NoError(t, err)
+	defer db.Close() //nolint[errcheck]
+
+	require.NoError(t, db.View(func(tx storage.Tx) error {
+		require.Equal(t, []byte("value"), tx.Bucket([]byte("bucket")).Get([]byte("key")))
+		return nil
+	}))
+
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestOpenStorageRemovesNewDatabaseWhenConversionFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage-backend")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "mailbox.db")
+	require.NoError(t, ioutil.WriteFile(path, []byte("not a database"), 0600))
+
+	SetStorageBackend(storage.SQLiteBackend)
+	defer SetStorageBackend(storage.BoltBackend)
+
+	_, err = openStorage(path)
+	require.Error(t, err)
+
+	// Old database is kept and the conversion is tried again next time.
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+	_, err = os.Stat(databasePath(path, storage.SQLiteBackend))
+	require.True(t, os.IsNotExist(err))
+
+	_, err = openStorage(path)
+	require.Error(t, err)
+}
@@ -19,18 +19,21 @@
 package store
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/ProtonMail/proton-bridge/internal/store/archive"
+	"github.com/ProtonMail/proton-bridge/internal/store/search"
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	imapBackend "github.com/emersion/go-imap/backend"
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	bolt "go.etcd.io/bbolt"
 )
 
 const (
@@ -60,25 +63,110 @@ var (
 	//   * mode -> string split or combined
 	// * mailboxes_version
 	//     * version -> uint32 value
+	// * schema
+	//   * version -> uint32 version of this layout (see schemaVersion)
 	// * sync_state
 	//   * sync_state -> string timestamp when it was last synced (when missing, sync should be ongoing)
 	//   * ids_ranges -> json array of groups with start and end message ID (when missing, there is no ongoing sync)
 	//   * ids_to_be_deleted -> json array of message IDs to be deleted after sync (when missing, there is no ongoing sync)
+	//   * event_checkpoint -> string ID of the last processed event
+	// * self_sent
+	//   * hide_duplicates -> string bool value of the setting used to build mailboxes
+	//   * external_ids
+	//     * {externalID} -> json with IDs of sent and received copies of self-sent message
+	// * search
+	//   * language -> string language of the full-text search analyzer
+	// * keywords
+	//   * {messageID} -> json array of IMAP keywords stored only locally
+	// * local_archive
+	//   * {mailboxName}
+	//     * {messageID} -> string timestamp when the message was written to the local archive
+	// * tombstones
+	//   * {messageID} -> json with metadata of message deleted via bridge
+	// * sync_exclusions
+	//   * {mailboxID} -> mailbox excluded from sync
+	// * mailbox_mapping
+	//   * mode -> string how mailboxes are presented over IMAP (folders, gmail or flat)
+	// * sent_messages
+	//   * external_ids
+	//     * {externalID} -> json with ID and time of message sent via bridge
+	//   * hashes
+	//     * {contentHash} -> json with ID and time of message sent via bridge
+	// * outgoing_mime
+	//   * mode -> string MIME type forced for outgoing messages (client, plain or html)
+	// * expiration
+	//   * default -> string number of seconds after which sent messages expire (0 when they don't)
+	// * outbox
+	//   * {sendTime+randomID} -> json with encrypted message scheduled to be sent later
+	// * plugins
+	//   * {pluginName}
+	//     * {key} -> value stored by the plugin encrypted by the primary address key
+	// * retention_log
+	//   * {appliedAt-messageID} -> json with message removed by retention policy
+	// * compaction
+	//   * last -> json with time and sizes of the last compaction of this database
+	// * snoozed
+	//   * {messageID} -> json with the mailbox and time the snoozed message is moved back at
+	// * sync_max_age
+	//   * max_age -> json with number of days of synced messages and mode of older ones
+	// * phishing
+	//   * {messageID} -> json with score of links of the received message
+	// * notifications
+	//   * rules -> json with notified mailboxes and quiet hours of new messages
 	// * mailboxes
 	//   * {addressID+mailboxID}
 	//     * imap_ids
 	//       * {imapUID} -> string messageID
 	//     * api_ids
 	//       * {messageID} -> uint32 imapUID
-	metadataBucket    = []byte("metadata")          //nolint[gochecknoglobals]
-	countsBucket      = []byte("counts")            //nolint[gochecknoglobals]
-	addressInfoBucket = []byte("address_info")      //nolint[gochecknoglobals]
-	addressModeBucket = []byte("address_mode")      //nolint[gochecknoglobals]
-	syncStateBucket   = []byte("sync_state")        //nolint[gochecknoglobals]
-	mailboxesBucket   = []byte("mailboxes")         //nolint[gochecknoglobals]
-	imapIDsBucket     = []byte("imap_ids")          //nolint[gochecknoglobals]
-	apiIDsBucket      = []byte("api_ids")           //nolint[gochecknoglobals]
-	mboxVersionBucket = []byte("mailboxes_version") //nolint[gochecknoglobals]
+	//     * save_dates
+	//       * {messageID} -> string timestamp when the message was added to the mailbox
+	//     * deleted_flags
+	//       * {messageID} -> empty value when the message has the IMAP \Deleted flag
+	//     * unread_ids
+	//       * {messageID} -> empty value when the message is unread
+	//     * recent_ids
+	//       * {messageID} -> empty value when the message was not opened yet
+	//     * counters
+	//       * total, unread, recent -> uint32 count of messages in the mailbox
+	metadataBucket       = []byte("metadata")          //nolint[gochecknoglobals]
+	countsBucket         = []byte("counts")            //nolint[gochecknoglobals]
+	addressInfoBucket    = []byte("address_info")      //nolint[gochecknoglobals]
+	addressModeBucket    = []byte("address_mode")      //nolint[gochecknoglobals]
+	syncStateBucket      = []byte("sync_state")        //nolint[gochecknoglobals]
+	mailboxesBucket      = []byte("mailboxes")         //nolint[gochecknoglobals]
+	imapIDsBucket        = []byte("imap_ids")          //nolint[gochecknoglobals]
+	apiIDsBucket         = []byte("api_ids")           //nolint[gochecknoglobals]
+	mboxVersionBucket    = []byte("mailboxes_version") //nolint[gochecknoglobals]
+	schemaBucket         = []byte("schema")            //nolint[gochecknoglobals]
+	selfSentBucket       = []byte("self_sent")         //nolint[gochecknoglobals]
+	selfSentIDsBucket    = []byte("external_ids")      //nolint[gochecknoglobals]
+	searchBucket         = []byte("search")            //nolint[gochecknoglobals]
+	keywordsBucket       = []byte("keywords")          //nolint[gochecknoglobals]
+	localArchiveBucket   = []byte("local_archive")     //nolint[gochecknoglobals]
+	saveDatesBucket      = []byte("save_dates")        //nolint[gochecknoglobals]
+	deletedFlagsBucket   = []byte("deleted_flags")     //nolint[gochecknoglobals]
+	unreadIDsBucket      = []byte("unread_ids")        //nolint[gochecknoglobals]
+	recentIDsBucket      = []byte("recent_ids")        //nolint[gochecknoglobals]
+	countersBucket       = []byte("counters")          //nolint[gochecknoglobals]
+	tombstonesBucket     = []byte("tombstones")        //nolint[gochecknoglobals]
+	syncExclusionsBucket = []byte("sync_exclusions")   //nolint[gochecknoglobals]
+	mailboxMappingBucket = []byte("mailbox_mapping")   //nolint[gochecknoglobals]
+	sentMessagesBucket   = []byte("sent_messages")     //nolint[gochecknoglobals]
+	sentExtIDsBucket     = []byte("external_ids")      //nolint[gochecknoglobals]
+	sentHashesBucket     = []byte("hashes")            //nolint[gochecknoglobals]
+	outgoingMIMEBucket   = []byte("outgoing_mime")     //nolint[gochecknoglobals]
+	outboxBucket         = []byte("outbox")            //nolint[gochecknoglobals]
+	pluginsBucket        = []byte("plugins")           //nolint[gochecknoglobals]
+	retentionLogBucket   = []byte("retention_log")     //nolint[gochecknoglobals]
+	signatureBucket      = []byte("signature")         //nolint[gochecknoglobals]
+	expirationBucket     = []byte("expiration")        //nolint[gochecknoglobals]
+	remoteContentBucket  = []byte("remote_content")    //nolint[gochecknoglobals]
+	compactionBucket     = []byte("compaction")        //nolint[gochecknoglobals]
+	snoozedBucket        = []byte("snoozed")           //nolint[gochecknoglobals]
+	syncMaxAgeBucket     = []byte("sync_max_age")      //nolint[gochecknoglobals]
+	phishingBucket       = []byte("phishing")          //nolint[gochecknoglobals]
+	notificationsBucket  = []byte("notifications")     //nolint[gochecknoglobals]
 
 	// ErrNoSuchAPIID when mailbox does not have API ID.
 	ErrNoSuchAPIID = errors.New("no such api id") //nolint[gochecknoglobals]
@@ -86,27 +174,64 @@ var (
 	ErrNoSuchUID = errors.New("no such uid") //nolint[gochecknoglobals]
 	// ErrNoSuchSeqNum when mailbox does not have IMAP ID.
 	ErrNoSuchSeqNum = errors.New("no such sequence number") //nolint[gochecknoglobals]
+	// ErrMaintenance when change is requested during read-only maintenance.
+	ErrMaintenance = errors.New("account is in read-only maintenance mode, try again later") //nolint[gochecknoglobals]
 )
 
 // Store is local user storage, which handles the synchronization between IMAP and PM API.
 type Store struct {
 	panicHandler  PanicHandler
 	eventLoop     *eventLoop
+	events        listener.Listener
 	user          BridgeUser
 	clientManager ClientManager
 
 	log *logrus.Entry
 
-	cache       *Cache
-	filePath    string
-	db          *bolt.DB
-	lock        *sync.RWMutex
-	addresses   map[string]*Address
-	imapUpdates chan imapBackend.Update
+	// ctx of API requests of the store, e.g. of the sync. It is cancelled
+	// when the store or its event loop is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	cache              *Cache
+	messageCache       *MessageCache
+	attachmentCache    *AttachmentCache
+	searchIndexStorage *SearchIndexStorage
+	filePath           string
+	db                 storage.DB
+	lock               *sync.RWMutex
+	addresses          map[string]*Address
+	imapUpdates        chan imapBackend.Update
+
+	searchIndex     *search.Index
+	searchIndexLock *sync.RWMutex
 
 	isSyncRunning bool
 	syncCooldown  cooldown
 	addressMode   addressMode
+
+	maintenance     map[string]int
+	maintenanceLock *sync.RWMutex
+
+	localArchive     *archive.Archive
+	localArchiveLock *sync.Mutex
+
+	lastMailboxRefresh     time.Time
+	lastMailboxRefreshLock *sync.Mutex
+
+	// autocryptSeen are addresses with keys from Autocrypt headers which
+	// were already added to contacts.
+	autocryptSeen sync.Map
+
+	lastRetention      time.Time
+	isRetentionRunning bool
+	retentionLock      *sync.Mutex
+
+	isCompactionRunning bool
+	compactionProgress  float64
+	compactionLock      *sync.Mutex
+
+	presence *clientPresence
 }
 
 // New creates or opens a store for the given `user`.
@@ -117,6 +242,9 @@ func New(
 	events listener.Listener,
 	path string,
 	cache *Cache,
+	messageCache *MessageCache,
+	attachmentCache *AttachmentCache,
+	searchIndexStorage *SearchIndexStorage,
 ) (store *Store, err error) {
 	if user == nil || clientManager == nil || events == nil || cache == nil {
 		return nil, fmt.Errorf("missing parameters - user: %v, api: %v, events: %v, cache: %v", user, clientManager, events, cache)
@@ -125,7 +253,7 @@ func New(
 	l := log.WithField("user", user.ID())
 
 	var firstInit bool
-	if _, existErr := os.Stat(path); os.IsNotExist(existErr) {
+	if !databaseExists(path) {
 		l.Info("Creating new store database file with address mode from user's credentials store")
 		firstInit = true
 	} else {
@@ -133,23 +261,52 @@ func New(
 		firstInit = false
 	}
 
-	bdb, err := openBoltDatabase(path)
+	db, err := openDatabase(path)
 	if err != nil {
 		err = errors.Wrap(err, "failed to open store database")
 		return
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+
 	store = &Store{
-		panicHandler:  panicHandler,
-		clientManager: clientManager,
-		user:          user,
-		cache:         cache,
-		filePath:      path,
-		db:            bdb,
-		lock:          &sync.RWMutex{},
-		log:           l,
+		ctx:                ctx,
+		cancel:             cancel,
+		panicHandler:       panicHandler,
+		clientManager:      clientManager,
+		events:             events,
+		user:               user,
+		cache:              cache,
+		messageCache:       messageCache,
+		attachmentCache:    attachmentCache,
+		searchIndexStorage: searchIndexStorage,
+		filePath:           path,
+		db:                 db,
+		lock:               &sync.RWMutex{},
+		log:                l,
+
+		searchIndexLock: &sync.RWMutex{},
+
+		maintenance:     map[string]int{},
+		maintenanceLock: &sync.RWMutex{},
+
+		localArchiveLock: &sync.Mutex{},
+
+		lastMailboxRefreshLock: &sync.Mutex{},
+
+		retentionLock: &sync.Mutex{},
+
+		compactionLock: &sync.Mutex{},
+
+		presence: newClientPresence(),
 	}
 
+	if isSafeMode() {
+		store.StartMaintenance(MaintenanceSafeMode)
+	}
+
+	store.initCacheKeys()
+
 	// Minimal increase is event pollInterval, doubles every failed retry up to 5 minutes.
 	store.syncCooldown.setExponentialWait(pollInterval, 2, 5*time.Minute)
 
@@ -162,6 +319,12 @@ func New(
 		return
 	}
 
+	if err := store.initLocalArchive(); err != nil {
+		l.WithError(err).Error("Could not open local archive, messages will not be archived")
+	}
+
+	store.purgeTombstones()
+
 	if user.IsConnected() {
 		store.eventLoop = newEventLoop(cache, store, user, events)
 		go func() {
@@ -173,20 +336,14 @@ func New(
 	return store, err
 }
 
-func openBoltDatabase(filePath string) (db *bolt.DB, err error) {
-	l := log.WithField("path", filePath)
-	l.Debug("Opening bolt database")
-
-	if db, err = bolt.Open(filePath, 0600, &bolt.Options{Timeout: 1 * time.Second}); err != nil {
-		l.WithError(err).Error("Could not open bolt database")
+// openDatabase opens the database of the store with the configured storage
+// backend and makes sure all buckets exist.
+func openDatabase(filePath string) (db storage.DB, err error) {
+	if db, err = openStorage(filePath); err != nil {
 		return
 	}
 
-	if val, set := os.LookupEnv("BRIDGESTRICTMODE"); set && val == "1" {
-		db.StrictMode = true
-	}
-
-	tx := func(tx *bolt.Tx) (err error) {
+	tx := func(tx storage.Tx) (err error) {
 		if _, err = tx.CreateBucketIfNotExists(metadataBucket); err != nil {
 			return
 		}
@@ -215,6 +372,100 @@ func openBoltDatabase(filePath string) (db *bolt.DB, err error) {
 			return
 		}
 
+		var selfSent storage.Bucket
+		if selfSent, err = tx.CreateBucketIfNotExists(selfSentBucket); err != nil {
+			return
+		}
+
+		if _, err = selfSent.CreateBucketIfNotExists(selfSentIDsBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(searchBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(keywordsBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(localArchiveBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(tombstonesBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(syncExclusionsBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(mailboxMappingBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(syncMaxAgeBucket); err != nil {
+			return
+		}
+
+		var sentMessages storage.Bucket
+		if sentMessages, err = tx.CreateBucketIfNotExists(sentMessagesBucket); err != nil {
+			return
+		}
+
+		if _, err = sentMessages.CreateBucketIfNotExists(sentExtIDsBucket); err != nil {
+			return
+		}
+
+		if _, err = sentMessages.CreateBucketIfNotExists(sentHashesBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(outgoingMIMEBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(outboxBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(pluginsBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(retentionLogBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(signatureBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(expirationBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(remoteContentBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(compactionBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(snoozedBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(phishingBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(notificationsBucket); err != nil {
+			return
+		}
+
 		return
 	}
 
@@ -222,6 +473,12 @@ func openBoltDatabase(filePath string) (db *bolt.DB, err error) {
 		return
 	}
 
+	if err = migrateSchema(db); err != nil {
+		log.WithField("path", db.Path()).WithError(err).Error("Could not migrate store database")
+		_ = db.Close()
+		return nil, err
+	}
+
 	return db, err
 }
 
@@ -252,6 +509,14 @@ func (store *Store) init(firstInit bool) (err error) {
 
 	store.log.WithField("mode", store.addressMode).Debug("Initialising store")
 
+	if err = store.checkSelfSentSetting(); err != nil {
+		return errors.Wrap(err, "checking self-sent duplicates setting")
+	}
+
+	if err = store.initSearchIndex(); err != nil {
+		return errors.Wrap(err, "initialising search index")
+	}
+
 	labels, err := store.initCounts()
 	if err != nil {
 		store.log.WithError(err).Error("Could not initialise label counts")
@@ -273,7 +538,7 @@ func (store *Store) client() pmapi.Client {
 // initCounts initialises the counts for each label. It tries to use the API first to fetch the labels but if
 // the API is unavailable for whatever reason it tries to fetch the labels locally.
 func (store *Store) initCounts() (labels []*pmapi.Label, err error) {
-	if labels, err = store.client().ListLabels(); err != nil {
+	if labels, err = store.client().ListLabels(store.ctx); err != nil {
 		store.log.WithError(err).Warn("Could not list API labels. Trying with local labels.")
 		if labels, err = store.getLabelsFromLocalStorage(); err != nil {
 			store.log.WithError(err).Error("Cannot list local labels")
@@ -350,14 +615,19 @@ func (store *Store) addAddress(address, addressID string, labels []*pmapi.Label)
 
 // Close stops the event loop and closes the database to free the file.
 func (store *Store) Close() error {
+	store.cancel()
+
 	store.lock.Lock()
 	defer store.lock.Unlock()
 
 	return store.close()
 }
 
-// CloseEventLoop stops the eventloop (if it is present).
+// CloseEventLoop stops the eventloop (if it is present) and cancels running
+// API requests of the store. The store is kept for offline data only.
 func (store *Store) CloseEventLoop() {
+	store.cancel()
+
 	if store.eventLoop != nil {
 		store.eventLoop.stop()
 	}
@@ -365,6 +635,9 @@ func (store *Store) CloseEventLoop() {
 
 func (store *Store) close() error {
 	store.CloseEventLoop()
+	if store.getSearchIndex() != nil {
+		store.saveSearchIndex()
+	}
 	return store.db.Close()
 }
 
@@ -375,6 +648,8 @@ func (store *Store) Remove() (err error) {
 
 	store.log.Trace("Removing store")
 
+	store.cancel()
+
 	var result *multierror.Error
 
 	if err = store.close(); err != nil {
@@ -385,6 +660,12 @@ func (store *Store) Remove() (err error) {
 		result = multierror.Append(result, errors.Wrap(err, "failed to remove store"))
 	}
 
+	if store.searchIndexStorage != nil {
+		if err = store.searchIndexStorage.RemoveUser(store.user.ID()); err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "failed to remove search index"))
+		}
+	}
+
 	return result.ErrorOrNil()
 }
 
@@ -397,8 +678,10 @@ func RemoveStore(cache *Cache, path, userID string) error {
 	}
 
 	// RemoveAll will not return an error if the path does not exist.
-	if err := os.RemoveAll(path); err != nil {
-		result = multierror.Append(result, errors.Wrap(err, "failed to remove database file"))
+	for _, filePath := range databaseFiles(path) {
+		if err := os.RemoveAll(filePath); err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "failed to remove database file"))
+		}
 	}
 
 	return result.ErrorOrNil()
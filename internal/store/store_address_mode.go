@@ -18,8 +18,8 @@
 package store
 
 import (
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/pkg/errors"
-	bolt "go.etcd.io/bbolt"
 )
 
 type addressMode string
@@ -38,7 +38,7 @@ func (store *Store) getAddressMode() (mode addressMode, err error) {
 		return
 	}
 
-	tx := func(tx *bolt.Tx) (err error) {
+	tx := func(tx storage.Tx) (err error) {
 		b := tx.Bucket(addressModeBucket)
 
 		dbMode := b.Get([]byte(modeKey))
@@ -97,7 +97,7 @@ func (store *Store) switchAddressMode(mode addressMode) (err error) {
 func (store *Store) setAddressMode(mode addressMode) (err error) {
 	store.log.WithField("mode", string(mode)).Info("Setting store address mode")
 
-	tx := func(tx *bolt.Tx) (err error) {
+	tx := func(tx storage.Tx) (err error) {
 		b := tx.Bucket(addressModeBucket)
 		return b.Put([]byte(modeKey), []byte(mode))
 	}
@@ -0,0 +1,107 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/pkg/errors"
+)
+
+// schemaVersion is the version of the database layout described in store.go.
+// Any change of the layout has to increase it and add a migration to
+// schemaMigrations so existing databases are upgraded in place instead of
+// being thrown away.
+const schemaVersion = uint32(2)
+
+const schemaVersionKey = "version"
+
+// schemaMigration upgrades the database from one version to the next one.
+type schemaMigration func(tx storage.Tx) error
+
+// schemaMigrations[i] migrates the database from version i to version i+1.
+var schemaMigrations = []schemaMigration{ //nolint[gochecknoglobals]
+	migrateSchemaToV1,
+	migrateSchemaToV2,
+}
+
+// migrateSchema runs all migrations needed to bring the database to the
+// current schemaVersion. All of them run in one transaction, therefore the
+// database is never left half-migrated.
+func migrateSchema(db storage.DB) error {
+	return db.Update(func(tx storage.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(schemaBucket)
+		if err != nil {
+			return err
+		}
+
+		version := uint32(0)
+		if raw := b.Get([]byte(schemaVersionKey)); raw != nil {
+			version = btoi(raw)
+		}
+
+		l := log.WithField("from", version).WithField("to", schemaVersion)
+
+		if version > schemaVersion {
+			// Database was created by newer bridge. Keep it as is, newer versions
+			// should not remove anything older versions rely on.
+			l.Warn("Store database schema is newer than supported")
+			return nil
+		}
+
+		if version == schemaVersion {
+			return nil
+		}
+
+		l.Info("Migrating store database schema")
+
+		for ; version < schemaVersion; version++ {
+			if err := schemaMigrations[version](tx); err != nil {
+				return errors.Wrapf(err, "failed to migrate store schema to version %d", version+1)
+			}
+		}
+
+		return b.Put([]byte(schemaVersionKey), itob(schemaVersion))
+	})
+}
+
+// migrateSchemaToV1 handles databases created before the schema was versioned.
+// Only databases of the current cache version are ever opened (older cache
+// folders are removed by ClearOldData and synced again), so their layout is
+// the same as the version 1 and all buckets are created when the database
+// is opened.
+func migrateSchemaToV1(tx storage.Tx) error {
+	return nil
+}
+
+// migrateSchemaToV2 counts messages of existing mailboxes which are since
+// then kept in counters of each mailbox.
+func migrateSchemaToV2(tx storage.Tx) error {
+	metaBucket := tx.Bucket(metadataBucket)
+	mbs := tx.Bucket(mailboxesBucket)
+	if metaBucket == nil || mbs == nil {
+		return nil
+	}
+
+	return mbs.ForEach(func(name, _ []byte) error {
+		mbBucket := mbs.Bucket(name)
+		if mbBucket == nil || mbBucket.Bucket(imapIDsBucket) == nil {
+			return nil
+		}
+		return txRebuildMailboxCounters(metaBucket, mbBucket)
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func readSchemaVersion(t *testing.T, db storage.DB) (version uint32) {
+	require.NoError(t, db.View(func(tx storage.Tx) error {
+		version = btoi(tx.Bucket(schemaBucket).Get([]byte(schemaVersionKey)))
+		return nil
+	}))
+	return
+}
+
+func TestSchemaMigrationsCoverAllVersions(t *testing.T) {
+	require.Equal(t, int(schemaVersion), len(schemaMigrations))
+}
+
+func TestMigrateUnversionedDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store-schema")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "mailbox.db")
+
+	// Database from bridge before versioning, with some data.
+	db, err := storage.OpenBolt(path)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx storage.Tx) error {
+		b, err := tx.CreateBucket(metadataBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("msgID"), []byte("data"))
+	}))
+	require.NoError(t, db.Close())
+
+	db, err = openDatabase(path)
+	require.NoError(t, err)
+	defer db.Close() //nolint[errcheck]
+
+	require.Equal(t, schemaVersion, readSchemaVersion(t, db))
+	require.NoError(t, db.View(func(tx storage.Tx) error {
+		require.Equal(t, []byte("data"), tx.Bucket(metadataBucket).Get([]byte("msgID")))
+		return nil
+	}))
+}
+
+func TestMigrateKeepsNewerDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store-schema")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "mailbox.db")
+
+	db, err := openDatabase(path)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(schemaBucket).Put([]byte(schemaVersionKey), itob(schemaVersion+1))
+	}))
+	require.NoError(t, db.Close())
+
+	db, err = openDatabase(path)
+	require.NoError(t, err)
+	defer db.Close() //nolint[errcheck]
+
+	require.Equal(t, schemaVersion+1, readSchemaVersion(t, db))
+}
@@ -17,7 +17,7 @@
 
 package store
 
-import bolt "go.etcd.io/bbolt"
+import "github.com/ProtonMail/proton-bridge/internal/store/storage"
 
 const (
 	versionKey = "version"
@@ -49,7 +49,7 @@ func (store *Store) increaseMailboxesVersion() error {
 }
 
 func (store *Store) readMailboxesVersion() (version uint32) {
-	_ = store.db.View(func(tx *bolt.Tx) (err error) {
+	_ = store.db.View(func(tx storage.Tx) (err error) {
 		b := tx.Bucket(mboxVersionBucket)
 		verRaw := b.Get([]byte(versionKey))
 		if verRaw != nil {
@@ -61,7 +61,7 @@ func (store *Store) readMailboxesVersion() (version uint32) {
 }
 
 func (store *Store) writeMailboxesVersion(ver uint32) error {
-	return store.db.Update(func(tx *bolt.Tx) (err error) {
+	return store.db.Update(func(tx storage.Tx) (err error) {
 		b := tx.Bucket(mboxVersionBucket)
 		return b.Put([]byte(versionKey), itob(ver))
 	})
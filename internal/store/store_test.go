@@ -18,12 +18,14 @@
 package store
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
 
+	bridgeEvents "github.com/ProtonMail/proton-bridge/internal/events"
 	storemocks "github.com/ProtonMail/proton-bridge/internal/store/mocks"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	pmapimocks "github.com/ProtonMail/proton-bridge/pkg/pmapi/mocks"
@@ -92,6 +94,7 @@ func initMocks(tb testing.TB) (*mocksForStore, func()) {
 func (mocks *mocksForStore) newStoreNoEvents(combinedMode bool) { //nolint[unparam]
 	mocks.user.EXPECT().ID().Return("userID").AnyTimes()
 	mocks.user.EXPECT().IsConnected().Return(true)
+	mocks.events.EXPECT().Emit(bridgeEvents.SyncFinishedEvent, "userID").AnyTimes()
 	mocks.user.EXPECT().IsCombinedAddressMode().Return(combinedMode)
 
 	mocks.clientManager.EXPECT().GetClient("userID").AnyTimes().Return(mocks.client)
@@ -100,9 +103,9 @@ func (mocks *mocksForStore) newStoreNoEvents(combinedMode bool) { //nolint[unpar
 		{ID: addrID1, Email: addr1, Type: pmapi.OriginalAddress, Receive: pmapi.CanReceive},
 		{ID: addrID2, Email: addr2, Type: pmapi.AliasAddress, Receive: pmapi.CanReceive},
 	})
-	mocks.client.EXPECT().ListLabels()
-	mocks.client.EXPECT().CountMessages("")
-	mocks.client.EXPECT().GetEvent(gomock.Any()).
+	mocks.client.EXPECT().ListLabels(gomock.Any())
+	mocks.client.EXPECT().CountMessages(gomock.Any(), "")
+	mocks.client.EXPECT().GetEvent(gomock.Any(), gomock.Any()).
 		Return(&pmapi.Event{
 			EventID: "latestEventID",
 		}, nil).AnyTimes()
@@ -111,8 +114,8 @@ func (mocks *mocksForStore) newStoreNoEvents(combinedMode bool) { //nolint[unpar
 	firstSyncWaiter := sync.WaitGroup{}
 	firstSyncWaiter.Add(1)
 	mocks.client.EXPECT().
-		ListMessages(gomock.Any()).
-		DoAndReturn(func(*pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+		ListMessages(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(context.Context, *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
 			firstSyncWaiter.Done()
 			return []*pmapi.Message{}, 0, nil
 		})
@@ -125,6 +128,9 @@ func (mocks *mocksForStore) newStoreNoEvents(combinedMode bool) { //nolint[unpar
 		mocks.events,
 		filepath.Join(mocks.tmpDir, "mailbox-test.db"),
 		mocks.cache,
+		nil,
+		nil,
+		nil,
 	)
 	require.NoError(mocks.tb, err)
 
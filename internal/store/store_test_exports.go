@@ -21,9 +21,9 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/stretchr/testify/assert"
-	bolt "go.etcd.io/bbolt"
 )
 
 // TestSync triggers a sync of the store.
@@ -80,7 +80,7 @@ func (store *Store) TestDumpDB(tb assert.TestingT) {
 
 	txMails := txDumpMailsFactory(tb)
 
-	txDump := func(tx *bolt.Tx) error {
+	txDump := func(tx storage.Tx) error {
 		if dumpCounts {
 			if err := txDumpCounts(tx); err != nil {
 				return err
@@ -95,8 +95,8 @@ func (store *Store) TestDumpDB(tb assert.TestingT) {
 	assert.NoError(tb, store.db.View(txDump))
 }
 
-func txDumpMailsFactory(tb assert.TestingT) func(tx *bolt.Tx) error {
-	return func(tx *bolt.Tx) error {
+func txDumpMailsFactory(tb assert.TestingT) func(tx storage.Tx) error {
+	return func(tx storage.Tx) error {
 		mailboxes := tx.Bucket(mailboxesBucket)
 		metadata := tx.Bucket(metadataBucket)
 		err := mailboxes.ForEach(func(mboxName, mboxData []byte) error {
@@ -122,7 +122,7 @@ func txDumpMailsFactory(tb assert.TestingT) func(tx *bolt.Tx) error {
 	}
 }
 
-func txDumpCounts(tx *bolt.Tx) error {
+func txDumpCounts(tx storage.Tx) error {
 	counts := tx.Bucket(countsBucket)
 	err := counts.ForEach(func(labelID, countsB []byte) error {
 		defer fmt.Println()
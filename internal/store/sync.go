@@ -18,9 +18,11 @@
 package store
 
 import (
+	"context"
 	"math"
 	"sync"
 
+	"github.com/ProtonMail/proton-bridge/internal/stats"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
 )
@@ -34,17 +36,20 @@ const (
 type storeSynchronizer interface {
 	getAllMessageIDs() ([]string, error)
 	createOrUpdateMessagesEvent([]*pmapi.Message) error
+	filterMessagesExcludedFromSync([]*pmapi.Message) ([]*pmapi.Message, []string)
 	deleteMessagesEvent([]string) error
 	saveSyncState(finishTime int64, idRanges []*syncIDRange, idsToBeDeleted []string)
 }
 
 type messageLister interface {
-	ListMessages(*pmapi.MessagesFilter) ([]*pmapi.Message, int, error)
+	ListMessages(context.Context, *pmapi.MessagesFilter) ([]*pmapi.Message, int, error)
 }
 
-func syncAllMail(panicHandler PanicHandler, store storeSynchronizer, api func() messageLister, syncState *syncState) error {
+func syncAllMail(ctx context.Context, panicHandler PanicHandler, store storeSynchronizer, api func() messageLister, syncState *syncState) error {
 	labelID := pmapi.AllMailLabel
 
+	syncState.startReport(syncState.isIncomplete())
+
 	// When the full sync starts (i.e. is not already in progress), we need to load
 	//  - all message IDs in database, so we can see which messages we need to remove at the end of the sync
 	//  - ID ranges which indicate how to split work into multiple workers
@@ -53,10 +58,14 @@ func syncAllMail(panicHandler PanicHandler, store storeSynchronizer, api func()
 			return errors.Wrap(err, "failed to load message IDs")
 		}
 
-		if err := findIDRanges(labelID, api(), syncState); err != nil {
+		if err := findIDRanges(ctx, labelID, api(), syncState); err != nil {
 			return errors.Wrap(err, "failed to load IDs ranges")
 		}
 		syncState.save()
+	} else {
+		log.WithField("ranges", len(syncState.idRanges)).
+			WithField("finished", syncState.countFinishedIDRanges()).
+			Info("Resuming interrupted sync")
 	}
 
 	wg := &sync.WaitGroup{}
@@ -71,7 +80,7 @@ func syncAllMail(panicHandler PanicHandler, store storeSynchronizer, api func()
 			defer panicHandler.HandlePanic()
 			defer wg.Done()
 
-			err := syncBatch(labelID, store, api(), syncState, idRange, &shouldStop)
+			err := syncBatch(ctx, labelID, store, api(), syncState, idRange, &shouldStop)
 			if err != nil {
 				shouldStop = 1
 				resultError = errors.Wrap(err, "failed to sync group")
@@ -90,8 +99,8 @@ func syncAllMail(panicHandler PanicHandler, store storeSynchronizer, api func()
 	return resultError
 }
 
-func findIDRanges(labelID string, api messageLister, syncState *syncState) error {
-	_, count, err := getSplitIDAndCount(labelID, api, 0)
+func findIDRanges(ctx context.Context, labelID string, api messageLister, syncState *syncState) error {
+	_, count, err := getSplitIDAndCount(ctx, labelID, api, syncState.begin, 0)
 	if err != nil {
 		return errors.Wrap(err, "failed to get first ID and count")
 	}
@@ -119,7 +128,7 @@ func findIDRanges(labelID string, api messageLister, syncState *syncState) error
 	}
 
 	for page := step; page < pages; page += step {
-		splitID, _, err := getSplitIDAndCount(labelID, api, page)
+		splitID, _, err := getSplitIDAndCount(ctx, labelID, api, syncState.begin, page)
 		if err != nil {
 			return errors.Wrap(err, "failed to get IDs range")
 		}
@@ -135,7 +144,7 @@ func findIDRanges(labelID string, api messageLister, syncState *syncState) error
 	return nil
 }
 
-func getSplitIDAndCount(labelID string, api messageLister, page int) (string, int, error) {
+func getSplitIDAndCount(ctx context.Context, labelID string, api messageLister, begin int64, page int) (string, int, error) {
 	sort := "ID"
 	desc := false
 	filter := &pmapi.MessagesFilter{
@@ -145,9 +154,11 @@ func getSplitIDAndCount(labelID string, api messageLister, page int) (string, in
 		PageSize: maxFilterPageSize,
 		Page:     page,
 		Limit:    1,
+		Begin:    begin,
 	}
 	// If the page does not exist, an empty page instead of an error is returned.
-	messages, total, err := api.ListMessages(filter)
+	globalSyncThrottle.wait()
+	messages, total, err := api.ListMessages(ctx, filter)
 	if err != nil {
 		return "", 0, errors.Wrap(err, "failed to list messages")
 	}
@@ -158,6 +169,7 @@ func getSplitIDAndCount(labelID string, api messageLister, page int) (string, in
 }
 
 func syncBatch( //nolint[funlen]
+	ctx context.Context,
 	labelID string,
 	store storeSynchronizer,
 	api messageLister,
@@ -171,6 +183,12 @@ func syncBatch( //nolint[funlen]
 			break
 		}
 
+		// Progress is saved after each page so the sync continues from
+		// here once it is started again.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		sort := "ID"
 		desc := true
 		filter := &pmapi.MessagesFilter{
@@ -185,16 +203,23 @@ func syncBatch( //nolint[funlen]
 			// When message is completely removed, it still works as expected.
 			BeginID: idRange.StartID,
 			EndID:   idRange.StopID,
+
+			// Messages older than the maximum age are not listed at all.
+			Begin: syncState.begin,
 		}
 
 		log.WithField("begin", filter.BeginID).WithField("end", filter.EndID).Debug("Fetching page")
 
-		messages, _, err := api.ListMessages(filter)
+		globalSyncThrottle.wait()
+		messages, _, err := api.ListMessages(ctx, filter)
 		if err != nil {
 			return errors.Wrap(err, "failed to list messages")
 		}
+		size := estimateMessagesSize(messages)
+		globalSyncThrottle.consume(size)
 
 		if len(messages) == 0 {
+			idRange.setFinished()
 			break
 		}
 
@@ -203,9 +228,13 @@ func syncBatch( //nolint[funlen]
 		}
 		syncState.save()
 
-		if err := store.createOrUpdateMessagesEvent(messages); err != nil {
+		included, _ := store.filterMessagesExcludedFromSync(messages)
+		failedIDs, err := storeSyncedMessages(store, messages)
+		if err != nil {
 			return errors.Wrap(err, "failed to create or update messages")
 		}
+		syncState.addPageToReport(messages, included, failedIDs, size, filter.EndID)
+		stats.Add(stats.SyncedMessages, int64(len(included)-len(failedIDs)))
 
 		pageLastMessageID := messages[len(messages)-1].ID
 		if !desc {
@@ -215,6 +244,7 @@ func syncBatch( //nolint[funlen]
 		}
 
 		if len(messages) < maxFilterPageSize {
+			idRange.setFinished()
 			break
 		}
 	}
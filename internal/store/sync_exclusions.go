@@ -0,0 +1,140 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// GetSyncExclusions returns IMAP names of mailboxes which are not synced.
+func (store *Store) GetSyncExclusions() (names []string) {
+	for labelID := range store.getSyncExclusionLabels() {
+		if name := store.getMailboxNameByLabelID(labelID); name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+func (store *Store) getSyncExclusionLabels() map[string]bool {
+	labelIDs := map[string]bool{}
+	_ = store.db.View(func(tx storage.Tx) error {
+		return tx.Bucket(syncExclusionsBucket).ForEach(func(labelID, _ []byte) error {
+			labelIDs[string(labelID)] = true
+			return nil
+		})
+	})
+	return labelIDs
+}
+
+// SetSyncExclusions sets mailboxes, by IMAP names, which are not synced.
+// Messages of newly excluded mailboxes are removed from them and messages
+// of newly included mailboxes are synced by triggered sync.
+func (store *Store) SetSyncExclusions(names []string) error {
+	labelIDs := []string{}
+	for _, name := range names {
+		mailbox, err := store.getMailbox(name)
+		if err != nil {
+			return err
+		}
+		labelIDs = append(labelIDs, mailbox.labelID)
+	}
+
+	if err := store.setSyncExclusionLabels(labelIDs); err != nil {
+		return err
+	}
+
+	store.triggerSync()
+	return nil
+}
+
+func (store *Store) setSyncExclusionLabels(labelIDs []string) error {
+	return store.db.Update(func(tx storage.Tx) error {
+		if err := tx.DeleteBucket(syncExclusionsBucket); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucket(syncExclusionsBucket)
+		if err != nil {
+			return err
+		}
+		for _, labelID := range labelIDs {
+			if err := b.Put([]byte(labelID), []byte{1}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (store *Store) getMailboxNameByLabelID(labelID string) string {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	for _, a := range store.addresses {
+		if mailbox, ok := a.mailboxes[labelID]; ok {
+			return mailbox.labelName
+		}
+	}
+	return ""
+}
+
+func txIsExcludedFromSync(tx storage.Tx, labelID string) bool {
+	return tx.Bucket(syncExclusionsBucket).Get([]byte(labelID)) != nil
+}
+
+// txIsMessageExcludedFromSync returns whether the message is only in
+// excluded mailboxes. Such message is not stored at all.
+func txIsMessageExcludedFromSync(tx storage.Tx, msg *pmapi.Message) bool {
+	b := tx.Bucket(syncExclusionsBucket)
+	if k, _ := b.Cursor().First(); k == nil {
+		return false
+	}
+
+	for _, labelID := range msg.LabelIDs {
+		if b.Get([]byte(labelID)) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// filterMessagesExcludedFromSync splits messages to those which should be
+// stored and IDs of already stored messages which should be removed.
+// Messages older than the maximum age are excluded too, if it says so.
+func (store *Store) filterMessagesExcludedFromSync(msgs []*pmapi.Message) (included []*pmapi.Message, excludedIDs []string) {
+	now := time.Now()
+	_ = store.db.View(func(tx storage.Tx) error {
+		maxAge := txGetSyncMaxAge(tx)
+		metaBucket := tx.Bucket(metadataBucket)
+		for _, msg := range msgs {
+			isOld := maxAge.excludes() && maxAge.isOlder(msg, now)
+			if !isOld && !txIsMessageExcludedFromSync(tx, msg) {
+				included = append(included, msg)
+			} else if metaBucket.Get([]byte(msg.ID)) != nil {
+				excludedIDs = append(excludedIDs, msg.ID)
+			}
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncExclusions(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+
+	require.EqualError(t, m.store.SetSyncExclusions([]string{"Unknown"}), "mailbox Unknown does not exist")
+
+	// Exclusions are set directly to not trigger sync.
+	require.NoError(t, m.store.setSyncExclusionLabels([]string{pmapi.ArchiveLabel}))
+	require.Equal(t, []string{"Archive"}, m.store.GetSyncExclusions())
+
+	// Updated message is removed from excluded mailbox.
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	checkMailboxMessageIDs(t, m, pmapi.ArchiveLabel, []wantID{})
+	checkMailboxMessageIDs(t, m, pmapi.AllMailLabel, []wantID{{"msg1", 1}, {"msg2", 2}, {"msg3", 3}})
+
+	// Message only in excluded mailboxes is not stored at all.
+	require.NoError(t, m.store.setSyncExclusionLabels([]string{pmapi.AllMailLabel, pmapi.ArchiveLabel}))
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	insertMessage(t, m, "msg4", "Test message 4", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	checkAllMessageIDs(t, m, []string{"msg1", "msg3"})
+	checkMailboxMessageIDs(t, m, pmapi.InboxLabel, []wantID{{"msg1", 1}})
+
+	require.NoError(t, m.store.setSyncExclusionLabels(nil))
+	require.Empty(t, m.store.GetSyncExclusions())
+}
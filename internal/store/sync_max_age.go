@@ -0,0 +1,181 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SyncMaxAgeExclude does not store messages older than the maximum age.
+	SyncMaxAgeExclude = "exclude"
+	// SyncMaxAgeHeaders stores messages older than the maximum age, but
+	// their bodies are downloaded only when a client asks and are not cached.
+	SyncMaxAgeHeaders = "headers"
+)
+
+// SyncMaxAgeModes lists all supported modes of older messages.
+var SyncMaxAgeModes = []string{SyncMaxAgeExclude, SyncMaxAgeHeaders} //nolint[gochecknoglobals]
+
+// SyncMaxAge limits the local copy of the account to messages received
+// in the last Days. Zero Days means all messages are synced.
+type SyncMaxAge struct {
+	Days int
+	Mode string
+}
+
+// IsEnabled returns whether the maximum age limits synced messages.
+func (maxAge SyncMaxAge) IsEnabled() bool {
+	return maxAge.Days > 0
+}
+
+// String returns human readable description of the maximum age.
+func (maxAge SyncMaxAge) String() string {
+	if !maxAge.IsEnabled() {
+		return "all messages"
+	}
+	return fmt.Sprintf("last %d days (%s)", maxAge.Days, maxAge.Mode)
+}
+
+// begin returns unix time of the oldest synced message at now.
+// It is zero when the maximum age is not set.
+func (maxAge SyncMaxAge) begin(now time.Time) int64 {
+	if !maxAge.IsEnabled() {
+		return 0
+	}
+	return now.AddDate(0, 0, -maxAge.Days).Unix()
+}
+
+// excludes returns whether older messages are not stored at all.
+func (maxAge SyncMaxAge) excludes() bool {
+	return maxAge.IsEnabled() && maxAge.Mode == SyncMaxAgeExclude
+}
+
+// isOlder returns whether the message is older than the maximum age at now.
+func (maxAge SyncMaxAge) isOlder(msg *pmapi.Message, now time.Time) bool {
+	return maxAge.IsEnabled() && msg.Time < maxAge.begin(now)
+}
+
+var syncMaxAgeKey = []byte("max_age") //nolint[gochecknoglobals]
+
+// GetSyncMaxAge returns which messages are synced.
+func (store *Store) GetSyncMaxAge() (maxAge SyncMaxAge) {
+	_ = store.db.View(func(tx storage.Tx) error {
+		maxAge = txGetSyncMaxAge(tx)
+		return nil
+	})
+	return
+}
+
+func txGetSyncMaxAge(tx storage.Tx) (maxAge SyncMaxAge) {
+	if data := tx.Bucket(syncMaxAgeBucket).Get(syncMaxAgeKey); data != nil {
+		_ = json.Unmarshal(data, &maxAge)
+	}
+	return
+}
+
+// SetSyncMaxAge sets which messages are synced. When older messages are
+// excluded, they are removed by triggered sync. When only their headers
+// are kept, their cached bodies are removed.
+func (store *Store) SetSyncMaxAge(maxAge SyncMaxAge) error {
+	if maxAge.Days < 0 {
+		return errors.New("maximum age of synced messages must not be negative")
+	}
+	if !maxAge.IsEnabled() {
+		maxAge = SyncMaxAge{}
+	} else if !isSyncMaxAgeMode(maxAge.Mode) {
+		return fmt.Errorf("unknown mode of older messages %q, use one of: %v", maxAge.Mode, strings.Join(SyncMaxAgeModes, ", "))
+	}
+
+	old := store.GetSyncMaxAge()
+	if err := store.saveSyncMaxAge(maxAge); err != nil {
+		return err
+	}
+
+	if maxAge.IsEnabled() && !maxAge.excludes() {
+		store.removeCachedMessagesOlderThan(maxAge)
+	}
+
+	// Messages are removed or downloaded again by full sync.
+	if old.excludes() || maxAge.excludes() {
+		store.triggerSync()
+	}
+	return nil
+}
+
+func (store *Store) saveSyncMaxAge(maxAge SyncMaxAge) error {
+	data, err := json.Marshal(maxAge)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(syncMaxAgeBucket).Put(syncMaxAgeKey, data)
+	})
+}
+
+func isSyncMaxAgeMode(mode string) bool {
+	for _, supported := range SyncMaxAgeModes {
+		if mode == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// isMessageOlderThanSyncMaxAge returns whether the stored message is older
+// than the maximum age. Bodies of such messages are not cached.
+func (store *Store) isMessageOlderThanSyncMaxAge(apiID string) bool {
+	maxAge := store.GetSyncMaxAge()
+	if !maxAge.IsEnabled() {
+		return false
+	}
+	msg, err := store.getMessageFromDB(apiID)
+	if err != nil {
+		return false
+	}
+	return maxAge.isOlder(msg, time.Now())
+}
+
+func (store *Store) removeCachedMessagesOlderThan(maxAge SyncMaxAge) {
+	if store.messageCache == nil {
+		return
+	}
+
+	now := time.Now()
+	keep := []string{}
+	_ = store.db.View(func(tx storage.Tx) error {
+		return tx.Bucket(metadataBucket).ForEach(func(k, v []byte) error {
+			msg := &pmapi.Message{}
+			if err := json.Unmarshal(v, msg); err == nil && !maxAge.isOlder(msg, now) {
+				keep = append(keep, string(k))
+			}
+			return nil
+		})
+	})
+
+	if size := store.messageCache.Compact(store.UserID(), keep); size > 0 {
+		store.log.WithField("size", size).Info("Removed cached messages older than maximum age")
+	}
+}
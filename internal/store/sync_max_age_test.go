@@ -0,0 +1,126 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func insertMessageAt(t *testing.T, m *mocksForStore, id string, at time.Time) {
+	msg := getTestMessage(id, "Test message", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg.Time = at.Unix()
+	require.NoError(t, m.store.createOrUpdateMessageEvent(msg))
+}
+
+func TestSyncMaxAgeExcludesOldMessages(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	now := time.Now()
+	insertMessageAt(t, m, "old", now.AddDate(0, 0, -100))
+	insertMessageAt(t, m, "new", now.AddDate(0, 0, -10))
+	checkAllMessageIDs(t, m, []string{"new", "old"})
+
+	// Maximum age is saved directly to not trigger sync.
+	require.NoError(t, m.store.saveSyncMaxAge(SyncMaxAge{Days: 90, Mode: SyncMaxAgeExclude}))
+
+	// Updated old message is removed and new old message is not stored.
+	insertMessageAt(t, m, "old", now.AddDate(0, 0, -100))
+	insertMessageAt(t, m, "older", now.AddDate(0, 0, -200))
+	insertMessageAt(t, m, "newer", now.AddDate(0, 0, -1))
+	checkAllMessageIDs(t, m, []string{"new", "newer"})
+
+	// Counts on API include old messages, so they cannot be compared.
+	isSynced, err := m.store.isSynced([]*pmapi.MessagesCount{{LabelID: pmapi.InboxLabel, Total: 4}})
+	require.NoError(t, err)
+	require.True(t, isSynced)
+}
+
+func TestSyncMaxAgeKeepsHeadersOfOldMessages(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	now := time.Now()
+	insertMessageAt(t, m, "old", now.AddDate(0, 0, -100))
+	insertMessageAt(t, m, "new", now.AddDate(0, 0, -10))
+
+	require.NoError(t, m.store.SetSyncMaxAge(SyncMaxAge{Days: 90, Mode: SyncMaxAgeHeaders}))
+	require.Equal(t, SyncMaxAge{Days: 90, Mode: SyncMaxAgeHeaders}, m.store.GetSyncMaxAge())
+
+	insertMessageAt(t, m, "older", now.AddDate(0, 0, -200))
+	checkAllMessageIDs(t, m, []string{"new", "old", "older"})
+
+	require.True(t, m.store.isMessageOlderThanSyncMaxAge("old"))
+	require.True(t, m.store.isMessageOlderThanSyncMaxAge("older"))
+	require.False(t, m.store.isMessageOlderThanSyncMaxAge("new"))
+}
+
+func TestSetSyncMaxAge(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.Error(t, m.store.SetSyncMaxAge(SyncMaxAge{Days: -1}))
+	require.Error(t, m.store.SetSyncMaxAge(SyncMaxAge{Days: 30, Mode: "unknown"}))
+	require.Equal(t, SyncMaxAge{}, m.store.GetSyncMaxAge())
+
+	require.NoError(t, m.store.SetSyncMaxAge(SyncMaxAge{Days: 30, Mode: SyncMaxAgeHeaders}))
+	require.Equal(t, "last 30 days (headers)", m.store.GetSyncMaxAge().String())
+
+	// Disabled maximum age forgets the mode.
+	require.NoError(t, m.store.SetSyncMaxAge(SyncMaxAge{Days: 0, Mode: SyncMaxAgeHeaders}))
+	require.Equal(t, SyncMaxAge{}, m.store.GetSyncMaxAge())
+	require.Equal(t, "all messages", m.store.GetSyncMaxAge().String())
+}
+
+type beginRecordingLister struct {
+	mockLister
+	begins []int64
+}
+
+func (m *beginRecordingLister) ListMessages(ctx context.Context, filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+	m.begins = append(m.begins, filter.Begin)
+	return m.mockLister.ListMessages(ctx, filter)
+}
+
+func TestSyncListsOnlyMessagesYoungerThanSyncMaxAge(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	store := newSyncer()
+	api := &beginRecordingLister{mockLister: mockLister{messageIDs: generateIDs(1, 2000)}}
+
+	syncState := newSyncState(store, 0, []*syncIDRange{}, []string{})
+	syncState.begin = 1234
+
+	require.NoError(t, syncAllMail(context.Background(), m.panicHandler, store, func() messageLister { return api }, syncState))
+	require.NotEmpty(t, api.begins)
+	for _, begin := range api.begins {
+		require.Equal(t, int64(1234), begin)
+	}
+}
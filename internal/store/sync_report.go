@@ -0,0 +1,161 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+const syncReportKey = "sync_report"
+
+// SyncReport summarises the last sync of the account, so users can verify
+// all messages were synced. Sync downloads only metadata of messages; bodies
+// are downloaded and built when requested by a client.
+type SyncReport struct {
+	Started  int64 // Unix time when the sync started.
+	Finished int64 // Unix time when the sync finished or failed.
+	Elapsed  time.Duration
+	Resumed  bool // The sync continued where the interrupted one left off.
+
+	Synced    int      // Messages stored in the local database.
+	Skipped   int      // Messages only in mailboxes excluded from sync.
+	Deleted   int      // Stored messages which are not on the server anymore.
+	FailedIDs []string `json:",omitempty"` // Messages which could not be stored.
+	Bytes     int64    // Estimated size of downloaded message lists.
+
+	Error string `json:",omitempty"`
+}
+
+// GetSyncReport returns the report of the last sync or nil if the account
+// has not been synced since the report was introduced.
+func (store *Store) GetSyncReport() (report *SyncReport, err error) {
+	err = store.db.View(func(tx storage.Tx) error {
+		data := tx.Bucket(syncStateBucket).Get([]byte(syncReportKey))
+		if data == nil {
+			return nil
+		}
+		report = &SyncReport{}
+		return json.Unmarshal(data, report)
+	})
+	return
+}
+
+func (store *Store) saveSyncReport(report *SyncReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(tx storage.Tx) error {
+		return tx.Bucket(syncStateBucket).Put([]byte(syncReportKey), data)
+	})
+}
+
+// startReport clears counts of the previous sync.
+func (s *syncState) startReport(resumed bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.report = &SyncReport{
+		Started: time.Now().Unix(),
+		Resumed: resumed,
+	}
+	s.reportStart = time.Now()
+}
+
+// addPageToReport counts one page of synced messages. Pages of one ID range
+// overlap by one message which is not counted again. The size is counted
+// for every page because the message was downloaded again.
+func (s *syncState) addPageToReport(messages, included []*pmapi.Message, failedIDs []string, size int, overlapID string) {
+	isIncluded := map[string]bool{}
+	for _, msg := range included {
+		isIncluded[msg.ID] = true
+	}
+
+	isFailed := map[string]bool{}
+	for _, id := range failedIDs {
+		isFailed[id] = true
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.report.Bytes += int64(size)
+
+	for _, msg := range messages {
+		switch {
+		case msg.ID == overlapID:
+		case !isIncluded[msg.ID]:
+			s.report.Skipped++
+		case isFailed[msg.ID]:
+			s.report.FailedIDs = append(s.report.FailedIDs, msg.ID)
+		default:
+			s.report.Synced++
+		}
+	}
+}
+
+// finishReport returns the report of the sync which ended with err.
+func (s *syncState) finishReport(err error) *SyncReport {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	report := *s.report
+	report.Finished = time.Now().Unix()
+	report.Elapsed = time.Since(s.reportStart)
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return &report
+}
+
+// storeSyncedMessages stores the page of synced messages. When the page
+// cannot be stored, messages are stored one by one so one broken message
+// does not stop the whole sync. It fails only when no message can be stored.
+func storeSyncedMessages(store storeSynchronizer, messages []*pmapi.Message) (failedIDs []string, err error) {
+	if err = store.createOrUpdateMessagesEvent(messages); err == nil || len(messages) == 1 {
+		return nil, err
+	}
+
+	for _, msg := range messages {
+		if msgErr := store.createOrUpdateMessagesEvent([]*pmapi.Message{msg}); msgErr != nil {
+			log.WithError(msgErr).WithField("messageID", msg.ID).Warn("Cannot store synced message")
+			failedIDs = append(failedIDs, msg.ID)
+		}
+	}
+
+	if len(failedIDs) == len(messages) {
+		return nil, err
+	}
+	return failedIDs, nil
+}
+
+// logSyncReport logs the summary of the sync.
+func logSyncReport(report *SyncReport) {
+	log.WithField("synced", report.Synced).
+		WithField("skipped", report.Skipped).
+		WithField("deleted", report.Deleted).
+		WithField("failed", len(report.FailedIDs)).
+		WithField("bytes", report.Bytes).
+		WithField("elapsed", report.Elapsed).
+		Info("Sync report")
+}
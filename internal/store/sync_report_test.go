@@ -0,0 +1,68 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncReportSaveAndLoad(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	report := &SyncReport{
+		Started:   1600000000,
+		Finished:  1600000060,
+		Elapsed:   time.Minute,
+		Synced:    10,
+		Skipped:   2,
+		FailedIDs: []string{"msg1"},
+		Bytes:     1234,
+	}
+	require.NoError(t, m.store.saveSyncReport(report))
+
+	loaded, err := m.store.GetSyncReport()
+	require.NoError(t, err)
+	require.Equal(t, report, loaded)
+}
+
+func TestSyncReportCountsPages(t *testing.T) {
+	syncState := newTestSyncState(newSyncer())
+	syncState.startReport(false)
+
+	page1 := []*pmapi.Message{{ID: "5"}, {ID: "4"}, {ID: "3"}}
+	page2 := []*pmapi.Message{{ID: "3"}, {ID: "2"}, {ID: "1"}}
+
+	syncState.addPageToReport(page1, page1, nil, 100, "")
+	syncState.addPageToReport(page2, page2[:2], []string{"2"}, 50, "3")
+
+	report := syncState.finishReport(errors.New("error"))
+	require.Equal(t, 3, report.Synced)
+	require.Equal(t, 1, report.Skipped)
+	require.Equal(t, []string{"2"}, report.FailedIDs)
+	require.Equal(t, int64(150), report.Bytes)
+	require.Equal(t, "error", report.Error)
+	require.NotZero(t, report.Finished)
+}
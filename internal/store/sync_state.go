@@ -46,6 +46,15 @@ type syncState struct {
 	// again. We do that because we don't want to remove everything on the
 	// beginning of the sync to keep client synced.
 	idsToBeDeletedMap map[string]bool
+
+	// begin is unix time of the oldest synced message when older messages
+	// are excluded by the maximum age. Zero means all messages are synced.
+	begin int64
+
+	// report counts messages of the running sync. It is not persisted
+	// until the sync ends, so a resumed sync reports only its own part.
+	report      *SyncReport
+	reportStart time.Time
 }
 
 func newSyncState(store storeSynchronizer, finishTime int64, idRanges []*syncIDRange, idsToBeDeleted []string) *syncState {
@@ -61,6 +70,9 @@ func newSyncState(store storeSynchronizer, finishTime int64, idRanges []*syncIDR
 		finishTime:        finishTime,
 		idRanges:          idRanges,
 		idsToBeDeletedMap: idsToBeDeletedMap,
+
+		report:      &SyncReport{},
+		reportStart: time.Now(),
 	}
 
 	for _, idRange := range idRanges {
@@ -141,6 +153,19 @@ func (s *syncState) addIDRange(splitID string) {
 	})
 }
 
+// countFinishedIDRanges returns how many ranges are already synced.
+func (s *syncState) countFinishedIDRanges() (count int) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, idRange := range s.idRanges {
+		if idRange.isFinished() {
+			count++
+		}
+	}
+	return
+}
+
 // loadMessageIDsToBeDeleted loads all message IDs from database
 // and by default all IDs are meant for deletion. During sync for
 // each ID `doNotDeleteMessageID` has to be called to remove that
@@ -179,6 +204,7 @@ func (s *syncState) deleteMessagesToBeDeleted() error {
 	if err := s.store.deleteMessagesEvent(idsToBeDeleted); err != nil {
 		return errors.Wrap(err, "failed to delete messages")
 	}
+	s.report.Deleted = len(idsToBeDeleted)
 	return nil
 }
 
@@ -192,11 +218,16 @@ func (s *syncState) getIDsToBeDeleted() []string {
 	return keys
 }
 
-// syncIDRange holds range which IDs need to be synced.
+// syncIDRange holds range which IDs need to be synced. It is saved after
+// every synced page so interrupted sync continues from the last page.
 type syncIDRange struct {
 	syncState *syncState
 	StartID   string
 	StopID    string
+
+	// Finished is set once the last page of the range is synced, so resumed
+	// sync does not fetch the range again.
+	Finished bool
 }
 
 func (r *syncIDRange) setStartID(startID string) {
@@ -209,9 +240,14 @@ func (r *syncIDRange) setStopID(stopID string) {
 	r.syncState.save()
 }
 
-// isFinished returns syncIDRange is finished when StartID and StopID
-// are the same. But it cannot be full range, full range cannot be
-// determined in other way than asking API.
+func (r *syncIDRange) setFinished() {
+	r.Finished = true
+	r.syncState.save()
+}
+
+// isFinished returns syncIDRange is finished when its last page was synced
+// or when StartID and StopID are the same. But it cannot be full range,
+// full range cannot be determined in other way than asking API.
 func (r *syncIDRange) isFinished() bool {
-	return r.StartID == r.StopID && r.StartID != ""
+	return r.Finished || (r.StartID == r.StopID && r.StartID != "")
 }
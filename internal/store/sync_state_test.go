@@ -56,6 +56,27 @@ func TestSyncState_IDRangesLoaded(t *testing.T) {
 	assert.Equal(t, "", r[1].StopID)
 }
 
+func TestSyncState_IDRangesSavedAndResumed(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	m.store.saveSyncState(0, []*syncIDRange{
+		{StartID: "", StopID: "100", Finished: true},
+		{StartID: "100", StopID: "150"},
+	}, []string{"1"})
+
+	syncState := m.store.loadSyncState()
+	require.True(t, syncState.isIncomplete())
+
+	r := syncState.idRanges
+	require.Len(t, r, 2)
+	assert.True(t, r[0].isFinished())
+	assert.False(t, r[1].isFinished())
+	assert.Equal(t, "150", r[1].StopID)
+}
+
 func TestSyncState_IDsToBeDeleted(t *testing.T) {
 	store := newSyncer()
 	store.allMessageIDs = generateIDs(1, 9)
@@ -18,6 +18,7 @@
 package store
 
 import (
+	"context"
 	"sort"
 	"strconv"
 	"sync"
@@ -34,7 +35,7 @@ type mockLister struct {
 	messageIDs []string
 }
 
-func (m *mockLister) ListMessages(filter *pmapi.MessagesFilter) (msgs []*pmapi.Message, total int, err error) {
+func (m *mockLister) ListMessages(_ context.Context, filter *pmapi.MessagesFilter) (msgs []*pmapi.Message, total int, err error) {
 	if m.err != nil {
 		return nil, 0, m.err
 	}
@@ -83,6 +84,7 @@ type mockStoreSynchronizer struct {
 	locker                         sync.Locker
 	allMessageIDs                  []string
 	errCreateOrUpdateMessagesEvent error
+	failingMessageIDs              map[string]bool
 	createdMessageIDsByBatch       [][]string
 }
 
@@ -106,6 +108,11 @@ func (m *mockStoreSynchronizer) createOrUpdateMessagesEvent(messages []*pmapi.Me
 	if m.errCreateOrUpdateMessagesEvent != nil {
 		return m.errCreateOrUpdateMessagesEvent
 	}
+	for _, message := range messages {
+		if m.failingMessageIDs[message.ID] {
+			return errors.New("broken message")
+		}
+	}
 	createdMessageIDs := []string{}
 	for _, message := range messages {
 		createdMessageIDs = append(createdMessageIDs, message.ID)
@@ -114,6 +121,10 @@ func (m *mockStoreSynchronizer) createOrUpdateMessagesEvent(messages []*pmapi.Me
 	return nil
 }
 
+func (m *mockStoreSynchronizer) filterMessagesExcludedFromSync(messages []*pmapi.Message) ([]*pmapi.Message, []string) {
+	return messages, nil
+}
+
 func (m *mockStoreSynchronizer) deleteMessagesEvent([]string) error {
 	m.locker.Lock()
 	defer m.locker.Unlock()
@@ -197,7 +208,7 @@ func TestSyncAllMail(t *testing.T) { //nolint[funlen]
 
 			syncState := newSyncState(store, 0, tc.idRanges, tc.idsToBeDeleted)
 
-			err := syncAllMail(m.panicHandler, store, func() messageLister { return api }, syncState)
+			err := syncAllMail(context.Background(), m.panicHandler, store, func() messageLister { return api }, syncState)
 			require.Nil(t, err)
 
 			// Check all messages were created or updated.
@@ -245,7 +256,7 @@ func TestSyncAllMail_FailedListing(t *testing.T) {
 	}
 	syncState := newTestSyncState(store)
 
-	err := syncAllMail(m.panicHandler, store, func() messageLister { return api }, syncState)
+	err := syncAllMail(context.Background(), m.panicHandler, store, func() messageLister { return api }, syncState)
 	require.EqualError(t, err, "failed to sync group: failed to list messages: error")
 }
 
@@ -264,10 +275,36 @@ func TestSyncAllMail_FailedCreateOrUpdateMessage(t *testing.T) {
 	}
 	syncState := newTestSyncState(store)
 
-	err := syncAllMail(m.panicHandler, store, func() messageLister { return api }, syncState)
+	err := syncAllMail(context.Background(), m.panicHandler, store, func() messageLister { return api }, syncState)
 	require.EqualError(t, err, "failed to sync group: failed to create or update messages: error")
 }
 
+func TestSyncAllMail_Report(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	numberOfMessages := 10000
+
+	store := newSyncer()
+	store.allMessageIDs = generateIDs(1, numberOfMessages+10)
+	store.failingMessageIDs = map[string]bool{"42": true, "4242": true}
+
+	api := &mockLister{
+		messageIDs: generateIDs(1, numberOfMessages),
+	}
+	syncState := newSyncState(store, 0, []*syncIDRange{}, []string{})
+
+	err := syncAllMail(context.Background(), m.panicHandler, store, func() messageLister { return api }, syncState)
+	require.NoError(t, err)
+
+	report := syncState.finishReport(err)
+	require.False(t, report.Resumed)
+	require.Equal(t, numberOfMessages-2, report.Synced)
+	require.ElementsMatch(t, []string{"42", "4242"}, report.FailedIDs)
+	require.Equal(t, 10, report.Deleted)
+	require.NotZero(t, report.Bytes)
+}
+
 func TestFindIDRanges(t *testing.T) { //nolint[funlen]
 	store := newSyncer()
 	syncState := newTestSyncState(store)
@@ -348,7 +385,7 @@ func TestFindIDRanges(t *testing.T) { //nolint[funlen]
 				messageIDs: tc.messageIDs,
 			}
 
-			err := findIDRanges(pmapi.AllMailLabel, api, syncState)
+			err := findIDRanges(context.Background(), pmapi.AllMailLabel, api, syncState)
 
 			require.Nil(t, err)
 			require.Equal(t, len(tc.wantBatches), len(syncState.idRanges))
@@ -369,7 +406,7 @@ func TestFindIDRanges_FailedListing(t *testing.T) {
 
 	syncState := newTestSyncState(store)
 
-	err := findIDRanges(pmapi.AllMailLabel, api, syncState)
+	err := findIDRanges(context.Background(), pmapi.AllMailLabel, api, syncState)
 	require.EqualError(t, err, "failed to get first ID and count: failed to list messages: error")
 }
 
@@ -437,7 +474,7 @@ func TestGetSplitIDAndCount(t *testing.T) { //nolint[funlen]
 				messageIDs: tc.messageIDs,
 			}
 
-			id, total, err := getSplitIDAndCount(pmapi.AllMailLabel, api, tc.page)
+			id, total, err := getSplitIDAndCount(context.Background(), pmapi.AllMailLabel, api, 0, tc.page)
 
 			if tc.wantErr == "" {
 				require.Nil(t, err)
@@ -497,6 +534,26 @@ func TestSyncBatch(t *testing.T) {
 	}
 }
 
+func TestSyncBatch_SkipsFinishedRange(t *testing.T) {
+	store := newSyncer()
+	api := &mockLister{
+		messageIDs: generateIDs(1, 1000),
+	}
+
+	syncState := newTestSyncState(store, "200", "400")
+	idRange := syncState.idRanges[1]
+	shouldStop := 0
+
+	require.NoError(t, syncBatch(context.Background(), pmapi.AllMailLabel, store, api, syncState, idRange, &shouldStop))
+	require.True(t, idRange.Finished)
+	require.Len(t, store.createdMessageIDsByBatch, 2)
+
+	// Resumed sync does not fetch the range again.
+	require.NoError(t, syncBatch(context.Background(), pmapi.AllMailLabel, store, api, syncState, idRange, &shouldStop))
+	require.Len(t, store.createdMessageIDsByBatch, 2)
+	require.Equal(t, 1, syncState.countFinishedIDRanges())
+}
+
 func TestSyncBatch_FailedListing(t *testing.T) {
 	store := newSyncer()
 	api := &mockLister{
@@ -508,6 +565,25 @@ func TestSyncBatch_FailedListing(t *testing.T) {
 	require.EqualError(t, err, "failed to list messages: error")
 }
 
+func TestSyncBatch_Cancelled(t *testing.T) {
+	store := newSyncer()
+	api := &mockLister{
+		messageIDs: generateIDs(1, 1000),
+	}
+
+	syncState := newTestSyncState(store, "200", "400")
+	idRange := syncState.idRanges[1]
+	shouldStop := 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := syncBatch(ctx, pmapi.AllMailLabel, store, api, syncState, idRange, &shouldStop)
+	require.Equal(t, context.Canceled, err)
+	require.False(t, idRange.Finished, "range is synced when the sync is started again")
+	require.Len(t, store.createdMessageIDsByBatch, 0)
+}
+
 func TestSyncBatch_FailedCreateOrUpdateMessage(t *testing.T) {
 	store := newSyncer()
 	store.errCreateOrUpdateMessagesEvent = errors.New("error")
@@ -523,5 +599,5 @@ func testSyncBatch(t *testing.T, store storeSynchronizer, api messageLister, ran
 	syncState := newTestSyncState(store, splitIDs...)
 	idRange := syncState.idRanges[rangeIdx]
 	shouldStop := 0
-	return syncBatch(pmapi.AllMailLabel, store, api, syncState, idRange, &shouldStop)
+	return syncBatch(context.Background(), pmapi.AllMailLabel, store, api, syncState, idRange, &shouldStop)
 }
@@ -0,0 +1,196 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// syncThrottleMaxSleep limits one sleep so changed options are applied
+// soon even when sync waits for its window.
+const syncThrottleMaxSleep = time.Minute
+
+// SyncThrottleOptions limits the initial sync so it does not saturate the
+// connection. Zero values mean no limit.
+type SyncThrottleOptions struct {
+	BytesPerSecond    int
+	RequestsPerSecond float64
+
+	// Sync runs only between WindowStart and WindowEnd (local time since
+	// midnight) when they differ. The window can span midnight.
+	WindowStart, WindowEnd time.Duration
+}
+
+// ParseSyncWindow parses window in format `HH:MM-HH:MM`. Empty window
+// means sync can run at any time.
+func ParseSyncWindow(window string) (start, end time.Duration, err error) {
+	if window = strings.TrimSpace(window); window == "" {
+		return 0, 0, nil
+	}
+
+	parts := strings.Split(window, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("window %q is not in format HH:MM-HH:MM", window)
+	}
+
+	if start, err = parseClock(parts[0]); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseClock(parts[1]); err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("time %q is not in format HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// syncThrottle is shared by syncs of all users because they share the
+// connection.
+type syncThrottle struct {
+	lock    sync.Mutex
+	options SyncThrottleOptions
+
+	nextRequest time.Time // Time when the next request is allowed.
+	bytesFreeAt time.Time // Time when downloaded bytes are paid off.
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+var globalSyncThrottle = newSyncThrottle() //nolint[gochecknoglobals]
+
+func newSyncThrottle() *syncThrottle {
+	return &syncThrottle{now: time.Now, sleep: time.Sleep}
+}
+
+// SetSyncThrottleOptions sets limits of the sync. It applies also to syncs
+// which are already running.
+func SetSyncThrottleOptions(options SyncThrottleOptions) {
+	globalSyncThrottle.setOptions(options)
+}
+
+func (t *syncThrottle) setOptions(options SyncThrottleOptions) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.options = options
+	t.nextRequest = time.Time{}
+	t.bytesFreeAt = time.Time{}
+}
+
+// wait blocks until the next request is allowed.
+func (t *syncThrottle) wait() {
+	for {
+		delay := t.reserve()
+		if delay <= 0 {
+			return
+		}
+		if delay > syncThrottleMaxSleep {
+			delay = syncThrottleMaxSleep
+		}
+		log.WithField("delay", delay).Debug("Sync is throttled")
+		t.sleep(delay)
+	}
+}
+
+// reserve returns how long to wait before the request or reserves the
+// request and returns zero.
+func (t *syncThrottle) reserve() time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+
+	if delay := t.untilWindow(now); delay > 0 {
+		return delay
+	}
+	if t.nextRequest.After(now) {
+		return t.nextRequest.Sub(now)
+	}
+	if t.bytesFreeAt.After(now) {
+		return t.bytesFreeAt.Sub(now)
+	}
+
+	if t.options.RequestsPerSecond > 0 {
+		t.nextRequest = now.Add(time.Duration(float64(time.Second) / t.options.RequestsPerSecond))
+	}
+	return 0
+}
+
+// untilWindow returns how long it takes till the sync window opens.
+func (t *syncThrottle) untilWindow(now time.Time) time.Duration {
+	start, end := t.options.WindowStart, t.options.WindowEnd
+	if start == end {
+		return 0
+	}
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	sinceMidnight := now.Sub(midnight)
+
+	isInWindow := sinceMidnight >= start && sinceMidnight < end
+	if start > end {
+		isInWindow = sinceMidnight >= start || sinceMidnight < end
+	}
+	if isInWindow {
+		return 0
+	}
+
+	if sinceMidnight < start {
+		return start - sinceMidnight
+	}
+	return 24*time.Hour - sinceMidnight + start
+}
+
+// consume accounts downloaded bytes, so the next request waits until the
+// average speed drops under the limit.
+func (t *syncThrottle) consume(bytes int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.options.BytesPerSecond <= 0 {
+		return
+	}
+
+	start := t.now()
+	if t.bytesFreeAt.After(start) {
+		start = t.bytesFreeAt
+	}
+	t.bytesFreeAt = start.Add(time.Duration(float64(bytes) / float64(t.options.BytesPerSecond) * float64(time.Second)))
+}
+
+// estimateMessagesSize returns the size of the message list response which
+// is estimated from the messages because the client doesn't expose it.
+func estimateMessagesSize(messages []*pmapi.Message) int {
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSyncThrottle(now time.Time, options SyncThrottleOptions) (*syncThrottle, *time.Time, *[]time.Duration) {
+	sleeps := []time.Duration{}
+	t := newSyncThrottle()
+	t.now = func() time.Time { return now }
+	t.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+	}
+	t.setOptions(options)
+	return t, &now, &sleeps
+}
+
+func TestParseSyncWindow(t *testing.T) {
+	start, end, err := ParseSyncWindow("22:30-06:00")
+	require.NoError(t, err)
+	require.Equal(t, 22*time.Hour+30*time.Minute, start)
+	require.Equal(t, 6*time.Hour, end)
+
+	start, end, err = ParseSyncWindow("")
+	require.NoError(t, err)
+	require.Equal(t, start, end)
+
+	for _, window := range []string{"22:00", "22:00-25:00", "10-12", "a-b-c"} {
+		_, _, err := ParseSyncWindow(window)
+		require.Error(t, err, window)
+	}
+}
+
+func TestSyncThrottleRequests(t *testing.T) {
+	now := time.Date(2020, 2, 1, 12, 0, 0, 0, time.Local)
+	throttle, _, sleeps := newTestSyncThrottle(now, SyncThrottleOptions{RequestsPerSecond: 2})
+
+	throttle.wait()
+	throttle.wait()
+	throttle.wait()
+	require.Equal(t, []time.Duration{500 * time.Millisecond, 500 * time.Millisecond}, *sleeps)
+}
+
+func TestSyncThrottleBytes(t *testing.T) {
+	now := time.Date(2020, 2, 1, 12, 0, 0, 0, time.Local)
+	throttle, _, sleeps := newTestSyncThrottle(now, SyncThrottleOptions{BytesPerSecond: 100})
+
+	throttle.wait()
+	throttle.consume(150)
+	throttle.consume(50)
+	throttle.wait()
+	require.Equal(t, []time.Duration{2 * time.Second}, *sleeps)
+
+	// Without limit nothing is accounted.
+	throttle.setOptions(SyncThrottleOptions{})
+	throttle.consume(1000)
+	require.Zero(t, throttle.reserve())
+}
+
+func TestSyncThrottleWindow(t *testing.T) {
+	day := time.Date(2020, 2, 1, 0, 0, 0, 0, time.Local)
+
+	testData := []struct {
+		start, end, now time.Duration
+		want            time.Duration
+	}{
+		{0, 0, 12 * time.Hour, 0},
+		{9 * time.Hour, 17 * time.Hour, 12 * time.Hour, 0},
+		{9 * time.Hour, 17 * time.Hour, 8 * time.Hour, time.Hour},
+		{9 * time.Hour, 17 * time.Hour, 17 * time.Hour, 16 * time.Hour},
+		{22 * time.Hour, 6 * time.Hour, 23 * time.Hour, 0},
+		{22 * time.Hour, 6 * time.Hour, 5 * time.Hour, 0},
+		{22 * time.Hour, 6 * time.Hour, 12 * time.Hour, 10 * time.Hour},
+	}
+
+	for _, tc := range testData {
+		throttle, _, _ := newTestSyncThrottle(day.Add(tc.now), SyncThrottleOptions{WindowStart: tc.start, WindowEnd: tc.end})
+		require.Equal(t, tc.want, throttle.reserve(), "%v-%v at %v", tc.start, tc.end, tc.now)
+	}
+}
+
+func TestSyncThrottleWaitsForWindow(t *testing.T) {
+	now := time.Date(2020, 2, 1, 21, 58, 30, 0, time.Local)
+	throttle, clock, sleeps := newTestSyncThrottle(now, SyncThrottleOptions{WindowStart: 22 * time.Hour, WindowEnd: 6 * time.Hour})
+
+	throttle.wait()
+	require.Equal(t, []time.Duration{time.Minute, 30 * time.Second}, *sleeps)
+	require.Equal(t, 22, clock.Hour())
+}
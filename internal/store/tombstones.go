@@ -0,0 +1,247 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// Tombstone is a record of a message deleted via bridge. The message can be
+// restored from its message cache copy until the retention window passes.
+type Tombstone struct {
+	ID        string
+	AddressID string
+	Subject   string
+	LabelIDs  []string
+	Unread    int
+	Flags     int64
+	Time      int64
+	DeletedAt int64 // Unix time
+}
+
+var (
+	deletedRetention     time.Duration //nolint[gochecknoglobals]
+	deletedRetentionLock sync.RWMutex  //nolint[gochecknoglobals]
+)
+
+// SetDeletedRetention sets how long messages deleted via bridge can be
+// restored. Zero disables keeping of tombstones.
+func SetDeletedRetention(retention time.Duration) {
+	deletedRetentionLock.Lock()
+	defer deletedRetentionLock.Unlock()
+
+	deletedRetention = retention
+}
+
+func getDeletedRetention() time.Duration {
+	deletedRetentionLock.RLock()
+	defer deletedRetentionLock.RUnlock()
+
+	return deletedRetention
+}
+
+// addTombstones remembers messages deleted via bridge. The cached copies of
+// those messages are kept by deleteMessagesEvent until tombstones expire.
+func (store *Store) addTombstones(apiIDs []string) {
+	if getDeletedRetention() == 0 || store.messageCache == nil {
+		return
+	}
+
+	deletedAt := time.Now().Unix()
+	if err := store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(tombstonesBucket)
+		for _, apiID := range apiIDs {
+			msg, err := store.txGetMessage(tx, apiID)
+			if err != nil {
+				continue
+			}
+
+			data, err := json.Marshal(&Tombstone{
+				ID:        msg.ID,
+				AddressID: msg.AddressID,
+				Subject:   msg.Subject,
+				LabelIDs:  msg.LabelIDs,
+				Unread:    msg.Unread,
+				Flags:     msg.Flags,
+				Time:      msg.Time,
+				DeletedAt: deletedAt,
+			})
+			if err != nil {
+				return err
+			}
+
+			if err := b.Put([]byte(apiID), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		store.log.WithError(err).Warn("Cannot save tombstones of deleted messages")
+	}
+
+	store.purgeTombstones()
+}
+
+func (store *Store) hasTombstone(apiID string) (has bool) {
+	_ = store.db.View(func(tx storage.Tx) error {
+		has = tx.Bucket(tombstonesBucket).Get([]byte(apiID)) != nil
+		return nil
+	})
+	return
+}
+
+// GetTombstones returns tombstones of messages deleted via bridge within
+// the retention window, the most recently deleted first.
+func (store *Store) GetTombstones() (tombstones []*Tombstone, err error) {
+	store.purgeTombstones()
+
+	err = store.db.View(func(tx storage.Tx) error {
+		return tx.Bucket(tombstonesBucket).ForEach(func(k, v []byte) error {
+			tombstone := &Tombstone{}
+			if err := json.Unmarshal(v, tombstone); err != nil {
+				return err
+			}
+			tombstones = append(tombstones, tombstone)
+			return nil
+		})
+	})
+
+	sort.SliceStable(tombstones, func(i, j int) bool {
+		return tombstones[i].DeletedAt > tombstones[j].DeletedAt
+	})
+	return
+}
+
+// purgeTombstones removes tombstones older than the retention window
+// together with the cached copies of their messages.
+func (store *Store) purgeTombstones() {
+	retention := getDeletedRetention()
+	deadline := time.Now().Add(-retention).Unix()
+
+	var expired []string
+	if err := store.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(tombstonesBucket)
+		if err := b.ForEach(func(k, v []byte) error {
+			tombstone := &Tombstone{}
+			if err := json.Unmarshal(v, tombstone); err != nil || retention == 0 || tombstone.DeletedAt < deadline {
+				expired = append(expired, string(k))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, apiID := range expired {
+			if err := b.Delete([]byte(apiID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		store.log.WithError(err).Warn("Cannot purge expired tombstones")
+		return
+	}
+
+	if store.messageCache != nil {
+		for _, apiID := range expired {
+			store.messageCache.Delete(store.UserID(), apiID)
+		}
+	}
+}
+
+// UndeleteMessages re-imports messages deleted via bridge since the given
+// time from their message cache copies. It returns the number of restored
+// messages and the number of messages without cached copy.
+func (store *Store) UndeleteMessages(since time.Time) (restored, missing int, err error) {
+	tombstones, err := store.GetTombstones()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer func() {
+		if restored > 0 && store.eventLoop != nil {
+			store.eventLoop.pollNow()
+		}
+	}()
+
+	for _, tombstone := range tombstones {
+		if tombstone.DeletedAt < since.Unix() {
+			continue
+		}
+
+		body, ok := store.GetCachedMessage(tombstone.ID)
+		if !ok {
+			missing++
+			continue
+		}
+
+		res, err := store.client().Import(store.ctx, []*pmapi.ImportMsgReq{tombstone.getImportRequest(body)})
+		if err == nil && len(res) > 0 {
+			err = res[0].Error
+		}
+		if err != nil {
+			return restored, missing, errors.Wrap(err, "failed to import deleted message")
+		}
+
+		if err := store.db.Update(func(tx storage.Tx) error {
+			return tx.Bucket(tombstonesBucket).Delete([]byte(tombstone.ID))
+		}); err != nil {
+			store.log.WithError(err).Warn("Cannot remove tombstone of restored message")
+		}
+		store.messageCache.Delete(store.UserID(), tombstone.ID)
+
+		restored++
+	}
+
+	return restored, missing, nil
+}
+
+// getImportRequest returns the request to import the message back with the
+// labels it had. Labels computed by API cannot be imported and the message
+// has to have at least one system label.
+func (tombstone *Tombstone) getImportRequest(body []byte) *pmapi.ImportMsgReq {
+	labelIDs := []string{}
+	hasSystemLabel := false
+	for _, labelID := range tombstone.LabelIDs {
+		switch labelID {
+		case pmapi.AllMailLabel, pmapi.AllSentLabel, pmapi.AllDraftsLabel:
+			continue
+		}
+		hasSystemLabel = hasSystemLabel || pmapi.IsSystemLabel(labelID)
+		labelIDs = append(labelIDs, labelID)
+	}
+	if !hasSystemLabel {
+		labelIDs = append(labelIDs, pmapi.InboxLabel)
+	}
+
+	return &pmapi.ImportMsgReq{
+		AddressID: tombstone.AddressID,
+		Body:      body,
+		Unread:    tombstone.Unread,
+		Flags:     tombstone.Flags,
+		Time:      tombstone.Time,
+		LabelIDs:  labelIDs,
+	}
+}
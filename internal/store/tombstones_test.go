@@ -0,0 +1,116 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUndeleteMessages(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	SetDeletedRetention(24 * time.Hour)
+	defer SetDeletedRetention(0)
+
+	m.newStoreNoEvents(true)
+	messageCache, _, clearCache := newTestMessageCache(t, 1000)
+	defer clearCache()
+	m.store.messageCache = messageCache
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.TrashLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.TrashLabel})
+	m.store.SetCachedMessage("msg1", []byte("body1"))
+
+	m.client.EXPECT().DeleteMessages(gomock.Any(), []string{"msg1", "msg2"})
+	require.NoError(t, m.store.addresses[addrID1].mailboxes[pmapi.TrashLabel].DeleteMessages([]string{"msg1", "msg2"}))
+	require.NoError(t, m.store.deleteMessagesEvent([]string{"msg1", "msg2"}))
+
+	tombstones, err := m.store.GetTombstones()
+	require.NoError(t, err)
+	require.Len(t, tombstones, 2)
+
+	_, ok := m.store.GetCachedMessage("msg1")
+	require.True(t, ok, "cached copy of deleted message must be kept")
+
+	m.client.EXPECT().Import(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, reqs []*pmapi.ImportMsgReq) ([]*pmapi.ImportMsgRes, error) {
+		require.Len(t, reqs, 1)
+		require.Equal(t, []byte("body1"), reqs[0].Body)
+		require.Equal(t, 1, reqs[0].Unread)
+		require.Equal(t, []string{pmapi.TrashLabel}, reqs[0].LabelIDs)
+		return []*pmapi.ImportMsgRes{{MessageID: "msg3"}}, nil
+	})
+
+	restored, missing, err := m.store.UndeleteMessages(time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 1, restored)
+	require.Equal(t, 1, missing)
+
+	tombstones, err = m.store.GetTombstones()
+	require.NoError(t, err)
+	require.Len(t, tombstones, 1)
+	require.Equal(t, "msg2", tombstones[0].ID)
+}
+
+func TestPurgeTombstones(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	SetDeletedRetention(24 * time.Hour)
+	defer SetDeletedRetention(0)
+
+	m.newStoreNoEvents(true)
+	messageCache, _, clearCache := newTestMessageCache(t, 1000)
+	defer clearCache()
+	m.store.messageCache = messageCache
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.TrashLabel})
+	m.store.SetCachedMessage("msg1", []byte("body1"))
+	m.store.addTombstones([]string{"msg1"})
+	require.NoError(t, m.store.deleteMessageEvent("msg1"))
+
+	// Disabling the retention removes all tombstones and their copies.
+	SetDeletedRetention(0)
+	tombstones, err := m.store.GetTombstones()
+	require.NoError(t, err)
+	require.Empty(t, tombstones)
+
+	_, ok := m.store.GetCachedMessage("msg1")
+	require.False(t, ok)
+}
+
+func TestTombstoneImportRequestLabels(t *testing.T) {
+	tests := []struct {
+		labelIDs, want []string
+	}{
+		{[]string{pmapi.AllMailLabel, pmapi.TrashLabel}, []string{pmapi.TrashLabel}},
+		{[]string{pmapi.AllMailLabel, pmapi.SpamLabel, "custom"}, []string{pmapi.SpamLabel, "custom"}},
+		{[]string{pmapi.AllMailLabel, "custom"}, []string{"custom", pmapi.InboxLabel}},
+		{[]string{}, []string{pmapi.InboxLabel}},
+	}
+	for _, tc := range tests {
+		tombstone := &Tombstone{LabelIDs: tc.labelIDs}
+		require.Equal(t, tc.want, tombstone.getImportRequest(nil).LabelIDs)
+	}
+}
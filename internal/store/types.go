@@ -35,6 +35,7 @@ type BridgeUser interface {
 	IsCombinedAddressMode() bool
 	GetPrimaryAddress() string
 	GetStoreAddresses() []string
+	GetCacheKey() ([]byte, error)
 	UpdateUser() error
 	CloseConnection(string)
 	Logout() error
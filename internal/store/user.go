@@ -17,6 +17,13 @@
 
 package store
 
+import (
+	"io"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
 // UserID returns user ID.
 func (store *Store) UserID() string {
 	return store.user.ID()
@@ -24,7 +31,7 @@ func (store *Store) UserID() string {
 
 // GetSpace returns used and total space in bytes.
 func (store *Store) GetSpace() (usedSpace, maxSpace uint, err error) {
-	apiUser, err := store.client().CurrentUser()
+	apiUser, err := store.client().CurrentUser(store.ctx)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -33,9 +40,128 @@ func (store *Store) GetSpace() (usedSpace, maxSpace uint, err error) {
 
 // GetMaxUpload returns max size of attachment in bytes.
 func (store *Store) GetMaxUpload() (uint, error) {
-	apiUser, err := store.client().CurrentUser()
+	apiUser, err := store.client().CurrentUser(store.ctx)
 	if err != nil {
 		return 0, err
 	}
 	return uint(apiUser.MaxUpload), nil
 }
+
+// GetCachedMessage returns the built message from the on-disk message cache.
+func (store *Store) GetCachedMessage(apiID string) ([]byte, bool) {
+	if store.messageCache == nil {
+		return nil, false
+	}
+	return store.messageCache.Get(store.UserID(), apiID)
+}
+
+// SetCachedMessage saves the built message to the on-disk message cache.
+// Messages older than the maximum age of synced messages are not saved.
+func (store *Store) SetCachedMessage(apiID string, body []byte) {
+	if store.messageCache == nil || store.isMessageOlderThanSyncMaxAge(apiID) {
+		return
+	}
+	if err := store.messageCache.Set(store.UserID(), apiID, body); err != nil {
+		store.log.WithError(err).WithField("msgID", apiID).Warn("Cannot save message to cache")
+	}
+}
+
+// GetCachedAttachment returns the reader of the decrypted attachment from
+// the on-disk attachment cache. The reader must be closed.
+func (store *Store) GetCachedAttachment(messageID, attachmentID string) (io.ReadCloser, bool) {
+	if store.attachmentCache == nil {
+		return nil, false
+	}
+	return store.attachmentCache.Get(store.UserID(), messageID, attachmentID)
+}
+
+// CachedAttachmentWriter saves the decrypted attachment to the on-disk
+// attachment cache while the attachment is written.
+type CachedAttachmentWriter interface {
+	io.Writer
+
+	// Commit saves the completely written attachment and scans it if
+	// scanner is set.
+	Commit()
+
+	// Discard drops the incomplete attachment.
+	Discard()
+}
+
+// NewCachedAttachmentWriter returns the writer saving the decrypted
+// attachment to the on-disk attachment cache. Attachments of messages older
+// than the maximum age are only scanned. It returns nil when the attachment
+// is neither cached nor scanned.
+func (store *Store) NewCachedAttachmentWriter(messageID string, att *pmapi.Attachment) CachedAttachmentWriter {
+	if store.attachmentCache == nil {
+		return nil
+	}
+
+	onlyScan := store.isMessageOlderThanSyncMaxAge(messageID)
+	if onlyScan && getScanOptions().Scanner == nil {
+		return nil
+	}
+
+	w, err := store.attachmentCache.NewWriter(store.UserID())
+	if err != nil {
+		store.log.WithError(err).WithField("msgID", messageID).Warn("Cannot save attachment to cache")
+		return nil
+	}
+
+	return &cachedAttachmentWriter{store: store, messageID: messageID, att: att, w: w, onlyScan: onlyScan}
+}
+
+type cachedAttachmentWriter struct {
+	store     *Store
+	messageID string
+	att       *pmapi.Attachment
+	w         *AttachmentWriter
+	onlyScan  bool
+	err       error
+}
+
+// Write never fails so the problem of the cache does not fail the fetch
+// which writes the attachment at the same time. The first error is kept
+// and the attachment is dropped on commit.
+func (cw *cachedAttachmentWriter) Write(p []byte) (int, error) {
+	if cw.err == nil {
+		_, cw.err = cw.w.Write(p)
+	}
+	return len(p), nil
+}
+
+func (cw *cachedAttachmentWriter) Discard() {
+	cw.w.Discard()
+}
+
+// Commit scans the attachment which is not saved right from the written
+// file and the saved one from the cache.
+func (cw *cachedAttachmentWriter) Commit() {
+	if cw.err != nil {
+		cw.store.log.WithError(cw.err).WithField("msgID", cw.messageID).Warn("Cannot save attachment to cache")
+		cw.w.Discard()
+		return
+	}
+
+	if !cw.onlyScan {
+		err := cw.w.Commit(cw.messageID, cw.att.ID)
+		if err == nil {
+			cw.store.scanAttachment(cw.messageID, cw.att, cw.w.Size(), cw.openCached, func() {})
+			return
+		}
+		if err != errAttachmentTooBig {
+			cw.store.log.WithError(err).WithField("msgID", cw.messageID).Warn("Cannot save attachment to cache")
+			return
+		}
+	}
+
+	cw.store.scanAttachment(cw.messageID, cw.att, cw.w.Size(), cw.w.Open, cw.w.Discard)
+}
+
+func (cw *cachedAttachmentWriter) openCached() (io.ReadCloser, error) {
+	r, ok := cw.store.GetCachedAttachment(cw.messageID, cw.att.ID)
+	if !ok {
+		return nil, errors.New("attachment is not cached anymore")
+	}
+	return r, nil
+}
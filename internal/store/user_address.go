@@ -21,9 +21,9 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
-	bolt "go.etcd.io/bbolt"
 )
 
 // GetAddress returns the store address by given ID.
@@ -141,7 +141,7 @@ func (store *Store) createOrDeleteAddressesEvent() (err error) {
 func (store *Store) truncateAddressInfoBucket() (err error) {
 	log.Trace("Truncating address info bucket")
 
-	tx := func(tx *bolt.Tx) (err error) {
+	tx := func(tx storage.Tx) (err error) {
 		if err = tx.DeleteBucket(addressInfoBucket); err != nil {
 			return
 		}
@@ -160,7 +160,7 @@ func (store *Store) truncateAddressInfoBucket() (err error) {
 func (store *Store) truncateMailboxesBucket() (err error) {
 	log.Trace("Truncating mailboxes bucket")
 
-	tx := func(tx *bolt.Tx) (err error) {
+	tx := func(tx storage.Tx) (err error) {
 		mbs := tx.Bucket(mailboxesBucket)
 
 		return mbs.ForEach(func(addrIDMailbox, _ []byte) (err error) {
@@ -182,6 +182,32 @@ func (store *Store) truncateMailboxesBucket() (err error) {
 				return
 			}
 
+			if err = addr.DeleteBucket(saveDatesBucket); err != nil && err != storage.ErrBucketNotFound {
+				return
+			}
+
+			if _, err = addr.CreateBucketIfNotExists(saveDatesBucket); err != nil {
+				return
+			}
+
+			if err = addr.DeleteBucket(deletedFlagsBucket); err != nil && err != storage.ErrBucketNotFound {
+				return
+			}
+
+			if _, err = addr.CreateBucketIfNotExists(deletedFlagsBucket); err != nil {
+				return
+			}
+
+			for _, name := range [][]byte{unreadIDsBucket, recentIDsBucket, countersBucket} {
+				if err = addr.DeleteBucket(name); err != nil && err != storage.ErrBucketNotFound {
+					return
+				}
+			}
+
+			if err = initMailboxCountersBuckets(addr); err != nil {
+				return
+			}
+
 			return
 		})
 	}
@@ -191,7 +217,7 @@ func (store *Store) truncateMailboxesBucket() (err error) {
 
 // initMailboxesBucket recreates the mailboxes bucket from the metadata bucket.
 func (store *Store) initMailboxesBucket() error {
-	return store.db.Update(func(tx *bolt.Tx) error {
+	return store.db.Update(func(tx storage.Tx) error {
 		i := 0
 		msgs := []*pmapi.Message{}
 
@@ -21,9 +21,9 @@ import (
 	"encoding/json"
 	"strings"
 
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
-	bolt "go.etcd.io/bbolt"
 )
 
 // AddressInfo is the format of the data held in the addresses bucket in the store.
@@ -80,7 +80,7 @@ func (store *Store) GetAddressInfo() (addrs []AddressInfo, err error) {
 func (store *Store) getAddressInfoFromStore() (addrs []AddressInfo, err error) {
 	store.log.Debug("Retrieving address info from store")
 
-	tx := func(tx *bolt.Tx) (err error) {
+	tx := func(tx storage.Tx) (err error) {
 		c := tx.Bucket(addressInfoBucket).Cursor()
 		for index, addrInfoBytes := c.First(); index != nil; index, addrInfoBytes = c.Next() {
 			var addrInfo AddressInfo
@@ -107,7 +107,7 @@ func (store *Store) getAddressInfoFromStore() (addrs []AddressInfo, err error) {
 // This is because a user might delete an address and we don't want old addresses lying around (and finding the
 // specific ones to delete is likely not much more efficient than just rebuilding from scratch).
 func (store *Store) createOrUpdateAddressInfo(addressList pmapi.AddressList) (err error) {
-	tx := func(tx *bolt.Tx) error {
+	tx := func(tx storage.Tx) error {
 		if err := tx.DeleteBucket(addressInfoBucket); err != nil {
 			store.log.WithError(err).Error("Could not delete addressIDs bucket")
 			return err
@@ -20,11 +20,37 @@ package store
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
 )
 
+const (
+	mailboxRefreshInterval = 10 * time.Second
+	mailboxRefreshTimeout  = 5 * time.Second
+)
+
+// refreshMailboxes polls events at most once per mailboxRefreshInterval.
+// It doesn't wait longer than mailboxRefreshTimeout to not block clients.
+func (store *Store) refreshMailboxes() {
+	store.lastMailboxRefreshLock.Lock()
+	if time.Since(store.lastMailboxRefresh) < mailboxRefreshInterval {
+		store.lastMailboxRefreshLock.Unlock()
+		return
+	}
+	store.lastMailboxRefresh = time.Now()
+	store.lastMailboxRefreshLock.Unlock()
+
+	if store.eventLoop == nil || !store.eventLoop.IsRunning() {
+		return
+	}
+
+	if !store.eventLoop.pollNowWithTimeout(mailboxRefreshTimeout) {
+		store.log.Warn("Timed out refreshing mailboxes")
+	}
+}
+
 // createMailbox creates the mailbox via the API.
 // The store mailbox is created later by processing an event.
 func (store *Store) createMailbox(name string) error {
@@ -38,14 +64,22 @@ func (store *Store) createMailbox(name string) error {
 
 	color := store.leastUsedColor()
 
-	var exclusive int
 	switch {
 	case strings.HasPrefix(name, UserLabelsPrefix):
 		name = strings.TrimPrefix(name, UserLabelsPrefix)
-		exclusive = 0
+		if strings.Contains(name, PathDelimiter) {
+			return fmt.Errorf("labels cannot be nested")
+		}
+		_, err := store.client().CreateLabel(store.ctx, &pmapi.Label{
+			Name:      name,
+			Color:     color,
+			Exclusive: 0,
+			Type:      pmapi.LabelTypeMailbox,
+		})
+		return err
 	case strings.HasPrefix(name, UserFoldersPrefix):
-		name = strings.TrimPrefix(name, UserFoldersPrefix)
-		exclusive = 1
+		_, err := store.createFolder(strings.TrimPrefix(name, UserFoldersPrefix), color)
+		return err
 	default:
 		// Ideally we would throw an error here, but then Outlook for
 		// macOS keeps trying to make an IMAP Drafts folder and popping
@@ -54,14 +88,56 @@ func (store *Store) createMailbox(name string) error {
 			Warn("Ignoring creation of new mailbox in IMAP root")
 		return nil
 	}
+}
+
+// createFolder creates the folder with the given path (without the folders
+// prefix) via the API including all missing parent folders.
+// It returns the label ID of the created folder.
+func (store *Store) createFolder(path, color string) (string, error) {
+	parentPath, name := splitFolderPath(path)
+	if name == "" {
+		return "", fmt.Errorf("folder name cannot be empty")
+	}
 
-	_, err := store.client().CreateLabel(&pmapi.Label{
+	parentID, err := store.getOrCreateFolderID(parentPath, color)
+	if err != nil {
+		return "", err
+	}
+
+	label, err := store.client().CreateLabel(store.ctx, &pmapi.Label{
 		Name:      name,
 		Color:     color,
-		Exclusive: exclusive,
+		Exclusive: 1,
 		Type:      pmapi.LabelTypeMailbox,
+		ParentID:  parentID,
 	})
-	return err
+	if err != nil {
+		return "", err
+	}
+	return label.ID, nil
+}
+
+// getOrCreateFolderID returns the label ID of the folder with the given path
+// (without the folders prefix). Missing folders are created via the API.
+// Empty path means top level and has no ID.
+func (store *Store) getOrCreateFolderID(path, color string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	if mailbox, err := store.getMailbox(UserFoldersPrefix + path); err == nil {
+		return mailbox.labelID, nil
+	}
+	return store.createFolder(path, color)
+}
+
+// splitFolderPath splits the folder path to the path of the parent folder
+// and the name of the folder itself.
+func splitFolderPath(path string) (parentPath, name string) {
+	i := strings.LastIndex(path, PathDelimiter)
+	if i < 0 {
+		return "", path
+	}
+	return path[:i], path[i+len(PathDelimiter):]
 }
 
 // allAddressesHaveMailbox returns whether each address has a mailbox with the given labelID.
@@ -105,6 +181,22 @@ func (store *Store) getMailbox(name string) (*Mailbox, error) {
 	return nil, fmt.Errorf("mailbox %s does not exist", name)
 }
 
+// GetLabelNames returns names of mailboxes of the labels. All Mail is
+// skipped because every message is there and so are labels which are not
+// mailboxes, e.g. Starred.
+func (store *Store) GetLabelNames(labelIDs []string) (names []string) {
+	names = []string{}
+	for _, labelID := range labelIDs {
+		if labelID == pmapi.AllMailLabel {
+			continue
+		}
+		if name := store.getMailboxNameByLabelID(labelID); name != "" {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
 // leastUsedColor returns the least used color to be used for a newly created folder or label.
 func (store *Store) leastUsedColor() string {
 	store.lock.RLock()
@@ -122,13 +214,14 @@ func (store *Store) leastUsedColor() string {
 
 // updateMailbox updates the mailbox via the API.
 // The store mailbox is updated later by processing an event.
-func (store *Store) updateMailbox(labelID, newName, color string) error {
+func (store *Store) updateMailbox(labelID, newName, parentID, color string) error {
 	defer store.eventLoop.pollNow()
 
-	_, err := store.client().UpdateLabel(&pmapi.Label{
-		ID:    labelID,
-		Name:  newName,
-		Color: color,
+	_, err := store.client().UpdateLabel(store.ctx, &pmapi.Label{
+		ID:       labelID,
+		Name:     newName,
+		Color:    color,
+		ParentID: parentID,
 	})
 	return err
 }
@@ -142,15 +235,15 @@ func (store *Store) deleteMailbox(labelID, addressID string) error {
 		var err error
 		switch labelID {
 		case pmapi.SpamLabel:
-			err = store.client().EmptyFolder(pmapi.SpamLabel, addressID)
+			err = store.client().EmptyFolder(store.ctx, pmapi.SpamLabel, addressID)
 		case pmapi.TrashLabel:
-			err = store.client().EmptyFolder(pmapi.TrashLabel, addressID)
+			err = store.client().EmptyFolder(store.ctx, pmapi.TrashLabel, addressID)
 		default:
 			err = fmt.Errorf("cannot empty mailbox %v", labelID)
 		}
 		return err
 	}
-	return store.client().DeleteLabel(labelID)
+	return store.client().DeleteLabel(store.ctx, labelID)
 }
 
 func (store *Store) createLabelsIfMissing(affectedLabelIDs map[string]bool) error {
@@ -165,7 +258,7 @@ func (store *Store) createLabelsIfMissing(affectedLabelIDs map[string]bool) erro
 		return nil
 	}
 
-	labels, err := store.client().ListLabels()
+	labels, err := store.client().ListLabels(store.ctx)
 	if err != nil {
 		return err
 	}
@@ -196,11 +289,19 @@ func (store *Store) createOrUpdateMailboxEvent(label *pmapi.Label) error {
 		return errors.Wrap(err, "cannot update counts")
 	}
 
+	labels, err := store.getLabelsFromLocalStorage()
+	if err != nil {
+		return errors.Wrap(err, "cannot load labels")
+	}
+	paths := getLabelPaths(labels)
+
 	for _, a := range store.addresses {
-		if err := a.createOrUpdateMailboxEvent(label); err != nil {
+		if err := a.createOrUpdateMailboxEvent(label, paths); err != nil {
 			return err
 		}
 	}
+
+	store.notifyObservers(Change{Type: MailboxUpdated, LabelID: label.ID, Label: label})
 	return nil
 }
 
@@ -217,5 +318,7 @@ func (store *Store) deleteMailboxEvent(labelID string) error {
 			return err
 		}
 	}
+
+	store.notifyObservers(Change{Type: MailboxDeleted, LabelID: labelID})
 	return nil
 }
@@ -0,0 +1,156 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLabelNames(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.Equal(t, []string{}, m.store.GetLabelNames(nil))
+	require.Equal(t, []string{"INBOX", "Sent"}, m.store.GetLabelNames([]string{
+		pmapi.AllMailLabel, pmapi.InboxLabel, pmapi.StarredLabel, pmapi.SentLabel, "unknown",
+	}))
+}
+
+func TestGetLabelPaths(t *testing.T) {
+	paths := getLabelPaths([]*pmapi.Label{
+		{ID: "folderA", Name: "A", Exclusive: 1},
+		{ID: "folderB", Name: "B", Exclusive: 1, ParentID: "folderA"},
+		{ID: "folderC", Name: "C", Exclusive: 1, ParentID: "folderB"},
+		{ID: "folderD", Name: "D", Exclusive: 1, ParentID: "missing"},
+		{ID: "label", Name: "L"},
+	})
+
+	require.Equal(t, map[string]string{
+		"folderA": "A",
+		"folderB": "A/B",
+		"folderC": "A/B/C",
+		"folderD": "D",
+		"label":   "L",
+	}, paths)
+}
+
+func TestGetLabelPathsCycle(t *testing.T) {
+	paths := getLabelPaths([]*pmapi.Label{
+		{ID: "folderA", Name: "A", Exclusive: 1, ParentID: "folderB"},
+		{ID: "folderB", Name: "B", Exclusive: 1, ParentID: "folderA"},
+	})
+
+	require.Len(t, paths, 2)
+}
+
+func TestCreateNestedFolder(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	m.client.EXPECT().CreateLabel(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, label *pmapi.Label) (*pmapi.Label, error) {
+		require.Equal(t, "A", label.Name)
+		require.Equal(t, "", label.ParentID)
+		require.Equal(t, 1, label.Exclusive)
+		return &pmapi.Label{ID: "folderA"}, nil
+	})
+	m.client.EXPECT().CreateLabel(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, label *pmapi.Label) (*pmapi.Label, error) {
+		require.Equal(t, "B", label.Name)
+		require.Equal(t, "folderA", label.ParentID)
+		require.Equal(t, 1, label.Exclusive)
+		return &pmapi.Label{ID: "folderB"}, nil
+	})
+
+	require.NoError(t, m.store.createMailbox(UserFoldersPrefix+"A/B"))
+}
+
+func TestCreateNestedLabel(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.Error(t, m.store.createMailbox(UserLabelsPrefix+"A/B"))
+}
+
+func TestNestedFolderEvents(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	parent := &pmapi.Label{ID: "folderA", Name: "A", Exclusive: 1, Type: pmapi.LabelTypeMailbox}
+	child := &pmapi.Label{ID: "folderB", Name: "B", Exclusive: 1, Type: pmapi.LabelTypeMailbox, ParentID: "folderA"}
+	require.NoError(t, m.store.createOrUpdateMailboxEvent(parent))
+	require.NoError(t, m.store.createOrUpdateMailboxEvent(child))
+
+	checkMailboxName(t, m.store, "folderA", UserFoldersPrefix+"A")
+	checkMailboxName(t, m.store, "folderB", UserFoldersPrefix+"A/B")
+
+	// Renaming the parent renames the subfolder too.
+	require.NoError(t, m.store.createOrUpdateMailboxEvent(&pmapi.Label{ID: "folderA", Name: "X", Exclusive: 1, Type: pmapi.LabelTypeMailbox}))
+
+	checkMailboxName(t, m.store, "folderA", UserFoldersPrefix+"X")
+	checkMailboxName(t, m.store, "folderB", UserFoldersPrefix+"X/B")
+
+	// Moving the subfolder to the top level.
+	require.NoError(t, m.store.createOrUpdateMailboxEvent(&pmapi.Label{ID: "folderB", Name: "B", Exclusive: 1, Type: pmapi.LabelTypeMailbox}))
+
+	checkMailboxName(t, m.store, "folderB", UserFoldersPrefix+"B")
+}
+
+func TestRenameNestedFolder(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.NoError(t, m.store.createOrUpdateMailboxEvent(&pmapi.Label{ID: "folderA", Name: "A", Exclusive: 1, Type: pmapi.LabelTypeMailbox}))
+	require.NoError(t, m.store.createOrUpdateMailboxEvent(&pmapi.Label{ID: "folderB", Name: "B", Exclusive: 1, Type: pmapi.LabelTypeMailbox}))
+
+	mailbox, err := m.store.getMailbox(UserFoldersPrefix + "B")
+	require.NoError(t, err)
+
+	m.client.EXPECT().UpdateLabel(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, label *pmapi.Label) (*pmapi.Label, error) {
+		require.Equal(t, "folderB", label.ID)
+		require.Equal(t, "C", label.Name)
+		require.Equal(t, "folderA", label.ParentID)
+		return label, nil
+	})
+	require.NoError(t, mailbox.Rename(UserFoldersPrefix+"A/C"))
+
+	parent, err := m.store.getMailbox(UserFoldersPrefix + "A")
+	require.NoError(t, err)
+	require.Error(t, parent.Rename(UserFoldersPrefix+"A/X/A"))
+}
+
+func checkMailboxName(t *testing.T, store *Store, labelID, wantName string) {
+	for _, a := range store.addresses {
+		mailbox, err := a.getMailboxByID(labelID)
+		require.NoError(t, err)
+		require.Equal(t, wantName, mailbox.Name())
+	}
+}
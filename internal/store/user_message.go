@@ -27,22 +27,31 @@ import (
 	"strings"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	bolt "go.etcd.io/bbolt"
 )
 
+// ErrNotDraft is returned when the draft to be updated was sent meanwhile.
+var ErrNotDraft = errors.New("message is not a draft") //nolint[gochecknoglobals]
+
+// AttachmentProgress is called while the attachment is uploaded with the
+// number of bytes of the attachment uploaded so far and its size.
+type AttachmentProgress func(attachment *pmapi.Attachment, uploaded, size int64)
+
 // CreateDraft creates draft with attachments.
 // If `attachedPublicKey` is passed, it's added to attachments.
 // Both draft and attachments are encrypted with passed `kr` key.
+// Upload of attachments is reported to `progress` if set.
 func (store *Store) CreateDraft(
 	kr *crypto.KeyRing,
 	message *pmapi.Message,
 	attachmentReaders []io.Reader,
 	attachedPublicKey,
 	attachedPublicKeyName string,
-	parentID string) (*pmapi.Message, []*pmapi.Attachment, error) {
+	parentID string,
+	progress AttachmentProgress) (*pmapi.Message, []*pmapi.Attachment, error) {
 	defer store.eventLoop.pollNow()
 
 	// Since this is a draft, we don't need to sign it.
@@ -54,7 +63,7 @@ func (store *Store) CreateDraft(
 	message.Attachments = nil
 
 	draftAction := store.getDraftAction(message)
-	draft, err := store.client().CreateDraft(message, parentID, draftAction)
+	draft, err := store.client().CreateDraft(store.ctx, message, parentID, draftAction)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "failed to create draft")
 	}
@@ -73,7 +82,7 @@ func (store *Store) CreateDraft(
 		attachment.MessageID = draft.ID
 		attachmentBody, _ := ioutil.ReadAll(attachmentReaders[idx])
 
-		createdAttachment, err := store.createAttachment(kr, attachment, attachmentBody)
+		createdAttachment, err := store.createAttachment(kr, attachment, attachmentBody, progress)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "failed to create attachment for draft")
 		}
@@ -84,6 +93,146 @@ func (store *Store) CreateDraft(
 	return draft, attachments, nil
 }
 
+// UpdateDraft replaces content of the existing draft by message, e.g. when
+// a client saves the edited draft. Attachments which are still in message
+// keep their references, only new ones are uploaded and removed ones are
+// deleted. Both draft and new attachments are encrypted with passed `kr`
+// key. ErrNotDraft is returned when the message is no longer a draft.
+func (store *Store) UpdateDraft(
+	kr *crypto.KeyRing,
+	draftID string,
+	message *pmapi.Message,
+	attachmentReaders []io.Reader) (*pmapi.Message, error) {
+	defer store.eventLoop.pollNow()
+
+	current, err := store.client().GetMessage(store.ctx, draftID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get draft")
+	}
+	if !current.IsDraft() {
+		return nil, ErrNotDraft
+	}
+
+	// Since this is a draft, we don't need to sign it.
+	if err := message.Encrypt(kr, nil); err != nil {
+		return nil, errors.Wrap(err, "failed to encrypt draft")
+	}
+
+	attachments := message.Attachments
+	message.Attachments = nil
+
+	attachmentBodies := make([][]byte, len(attachments))
+	for idx := range attachments {
+		if attachmentBodies[idx], err = ioutil.ReadAll(attachmentReaders[idx]); err != nil {
+			return nil, errors.Wrap(err, "failed to read attachment")
+		}
+	}
+
+	kept, removed := store.matchDraftAttachments(kr, current, attachments, attachmentBodies)
+
+	draft, err := store.client().UpdateDraft(store.ctx, draftID, message)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to update draft")
+	}
+
+	for _, attachment := range removed {
+		if err := store.client().DeleteAttachment(store.ctx, attachment.ID); err != nil {
+			return nil, errors.Wrap(err, "failed to delete attachment of draft")
+		}
+	}
+
+	for idx, attachment := range attachments {
+		if kept[idx] {
+			continue
+		}
+
+		attachment.MessageID = draftID
+		if _, err := store.createAttachment(kr, attachment, attachmentBodies[idx], nil); err != nil {
+			return nil, errors.Wrap(err, "failed to create attachment for draft")
+		}
+	}
+
+	store.log.
+		WithField("draftID", draftID).
+		WithField("kept", len(current.Attachments)-len(removed)).
+		WithField("removed", len(removed)).
+		Info("Draft updated")
+
+	return draft, nil
+}
+
+// matchDraftAttachments pairs attachments of the edited draft with those
+// already uploaded to the draft. They match when the name, type, content ID
+// and the content are the same. It returns which new attachments are
+// already uploaded and which uploaded attachments are no longer used.
+func (store *Store) matchDraftAttachments(
+	kr *crypto.KeyRing,
+	draft *pmapi.Message,
+	attachments []*pmapi.Attachment,
+	attachmentBodies [][]byte,
+) (kept []bool, removed []*pmapi.Attachment) {
+	kept = make([]bool, len(attachments))
+
+	for _, uploaded := range draft.Attachments {
+		var uploadedBody []byte
+		matched := false
+
+		for idx, attachment := range attachments {
+			if kept[idx] || !isSameAttachmentInfo(uploaded, attachment) {
+				continue
+			}
+
+			if uploadedBody == nil {
+				body, err := store.getDraftAttachment(kr, draft.ID, uploaded)
+				if err != nil {
+					store.log.WithError(err).WithField("attID", uploaded.ID).Warn("Cannot compare attachment of draft, uploading it again")
+					break
+				}
+				uploadedBody = body
+			}
+
+			if bytes.Equal(uploadedBody, attachmentBodies[idx]) {
+				kept[idx], matched = true, true
+				break
+			}
+		}
+
+		if !matched {
+			removed = append(removed, uploaded)
+		}
+	}
+
+	return kept, removed
+}
+
+func isSameAttachmentInfo(a, b *pmapi.Attachment) bool {
+	return a.Name == b.Name &&
+		a.MIMEType == b.MIMEType &&
+		strings.Trim(a.ContentID, "<>") == strings.Trim(b.ContentID, "<>")
+}
+
+// getDraftAttachment returns the decrypted attachment of the draft from
+// the attachment cache or the API.
+func (store *Store) getDraftAttachment(kr *crypto.KeyRing, draftID string, att *pmapi.Attachment) ([]byte, error) {
+	if cached, ok := store.GetCachedAttachment(draftID, att.ID); ok {
+		defer cached.Close() //nolint[errcheck]
+		return ioutil.ReadAll(cached)
+	}
+
+	rc, err := store.client().GetAttachment(store.ctx, att.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close() //nolint[errcheck]
+
+	r, err := att.Decrypt(rc, kr)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(r)
+}
+
 func (store *Store) getDraftAction(message *pmapi.Message) int {
 	// If not a reply, must be a forward.
 	if len(message.Header["In-Reply-To"]) == 0 {
@@ -92,20 +241,27 @@ func (store *Store) getDraftAction(message *pmapi.Message) int {
 	return pmapi.DraftActionReply
 }
 
-func (store *Store) createAttachment(kr *crypto.KeyRing, attachment *pmapi.Attachment, attachmentBody []byte) (*pmapi.Attachment, error) {
-	r := bytes.NewReader(attachmentBody)
-	sigReader, err := attachment.DetachedSign(kr, r)
+// createAttachment signs the attachment and uploads it while it is being
+// encrypted, so the encrypted attachment is never kept in memory.
+func (store *Store) createAttachment(kr *crypto.KeyRing, attachment *pmapi.Attachment, attachmentBody []byte, progress AttachmentProgress) (*pmapi.Attachment, error) {
+	sigReader, err := attachment.DetachedSign(kr, bytes.NewReader(attachmentBody))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to sign attachment")
 	}
 
-	r = bytes.NewReader(attachmentBody)
+	var r io.Reader = bytes.NewReader(attachmentBody)
+	if progress != nil {
+		r = &progressReader{r: r, report: func(uploaded int64) {
+			progress(attachment, uploaded, int64(len(attachmentBody)))
+		}}
+	}
+
 	encReader, err := attachment.Encrypt(kr, r)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to encrypt attachment")
 	}
 
-	createdAttachment, err := store.client().CreateAttachment(attachment, encReader, sigReader)
+	createdAttachment, err := store.client().CreateAttachment(store.ctx, attachment, encReader, sigReader)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create attachment")
 	}
@@ -116,13 +272,13 @@ func (store *Store) createAttachment(kr *crypto.KeyRing, attachment *pmapi.Attac
 // SendMessage sends the message.
 func (store *Store) SendMessage(messageID string, req *pmapi.SendMessageReq) error {
 	defer store.eventLoop.pollNow()
-	_, _, err := store.client().SendMessage(messageID, req)
+	_, _, err := store.client().SendMessage(store.ctx, messageID, req)
 	return err
 }
 
 // getAllMessageIDs returns all API IDs of messages in the local database.
 func (store *Store) getAllMessageIDs() (apiIDs []string, err error) {
-	err = store.db.View(func(tx *bolt.Tx) error {
+	err = store.db.View(func(tx storage.Tx) error {
 		b := tx.Bucket(metadataBucket)
 		return b.ForEach(func(k, v []byte) error {
 			apiIDs = append(apiIDs, string(k))
@@ -134,7 +290,7 @@ func (store *Store) getAllMessageIDs() (apiIDs []string, err error) {
 
 // getMessageFromDB returns pmapi struct of message by API ID.
 func (store *Store) getMessageFromDB(apiID string) (msg *pmapi.Message, err error) {
-	err = store.db.View(func(tx *bolt.Tx) error {
+	err = store.db.View(func(tx storage.Tx) error {
 		msg, err = store.txGetMessage(tx, apiID)
 		return err
 	})
@@ -142,7 +298,7 @@ func (store *Store) getMessageFromDB(apiID string) (msg *pmapi.Message, err erro
 	return
 }
 
-func (store *Store) txGetMessage(tx *bolt.Tx, apiID string) (*pmapi.Message, error) {
+func (store *Store) txGetMessage(tx storage.Tx, apiID string) (*pmapi.Message, error) {
 	b := tx.Bucket(metadataBucket)
 
 	msgb := b.Get([]byte(apiID))
@@ -156,7 +312,7 @@ func (store *Store) txGetMessage(tx *bolt.Tx, apiID string) (*pmapi.Message, err
 	return msg, nil
 }
 
-func (store *Store) txPutMessage(metaBucket *bolt.Bucket, onlyMeta *pmapi.Message) error {
+func (store *Store) txPutMessage(metaBucket storage.Bucket, onlyMeta *pmapi.Message) error {
 	b, err := json.Marshal(onlyMeta)
 	if err != nil {
 		return errors.Wrap(err, "cannot marshall metadata")
@@ -180,10 +336,25 @@ func (store *Store) createOrUpdateMessageEvent(msg *pmapi.Message) error {
 func (store *Store) createOrUpdateMessagesEvent(msgs []*pmapi.Message) error { //nolint[funlen]
 	store.log.WithField("msgs", msgs).Trace("Creating or updating messages in the store")
 
+	// Messages only in mailboxes excluded from sync are not stored and
+	// already stored ones are removed.
+	var excludedIDs []string
+	msgs, excludedIDs = store.filterMessagesExcludedFromSync(msgs)
+	if len(excludedIDs) > 0 {
+		if err := store.deleteMessagesEvent(excludedIDs); err != nil {
+			return err
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
 	// Strip non meta first to reduce memory (no need to keep all old msg ID data during update).
-	err := store.db.View(func(tx *bolt.Tx) error {
+	existingIDs := map[string]bool{}
+	err := store.db.View(func(tx storage.Tx) error {
 		b := tx.Bucket(metadataBucket)
 		for _, msg := range msgs {
+			existingIDs[msg.ID] = b.Get([]byte(msg.ID)) != nil
 			clearNonMetadata(msg)
 			txUpdateMetadaFromDB(b, msg, store.log)
 		}
@@ -211,7 +382,8 @@ func (store *Store) createOrUpdateMessagesEvent(msgs []*pmapi.Message) error { /
 	// The reason to split is efficiency--it's more memory efficient.
 
 	// Update metadata.
-	err = store.db.Update(func(tx *bolt.Tx) error {
+	var selfSentReceivedIDs []string
+	err = store.db.Update(func(tx storage.Tx) error {
 		metaBucket := tx.Bucket(metadataBucket)
 		for _, msg := range msgs {
 			err := store.txPutMessage(metaBucket, msg)
@@ -219,16 +391,28 @@ func (store *Store) createOrUpdateMessagesEvent(msgs []*pmapi.Message) error { /
 				return err
 			}
 		}
-		return nil
+		selfSentReceivedIDs, err = store.txIndexSelfSent(tx, msgs)
+		return err
 	})
 	if err != nil {
 		return err
 	}
 
+	// Drafts can change, so they are indexed again when searched.
+	for _, msg := range msgs {
+		if msg.IsDraft() {
+			store.removeFromSearchIndex([]string{msg.ID})
+		}
+	}
+
 	// Update mailboxes.
-	err = store.db.Update(func(tx *bolt.Tx) error {
+	err = store.db.Update(func(tx storage.Tx) error {
+		// Received copies of self-sent messages can be hidden now when
+		// their sent copy arrived.
+		updatedMsgs := append(append([]*pmapi.Message{}, msgs...), store.txGetMessagesNotInList(tx, selfSentReceivedIDs, msgs)...)
+
 		for _, a := range store.addresses {
-			if err := a.txCreateOrUpdateMessages(tx, msgs); err != nil {
+			if err := a.txCreateOrUpdateMessages(tx, updatedMsgs); err != nil {
 				store.log.WithError(err).Error("cannot update maiboxes")
 				return errors.Wrap(err, "cannot add to mailboxes bucket")
 			}
@@ -239,6 +423,14 @@ func (store *Store) createOrUpdateMessagesEvent(msgs []*pmapi.Message) error { /
 		return err
 	}
 
+	for _, msg := range msgs {
+		changeType := MessageCreated
+		if existingIDs[msg.ID] {
+			changeType = MessageUpdated
+		}
+		store.notifyObservers(Change{Type: changeType, MessageID: msg.ID, Message: msg})
+	}
+
 	return nil
 }
 
@@ -254,7 +446,7 @@ func clearNonMetadata(onlyMeta *pmapi.Message) {
 // not changed if already set. To change these:
 // * size must be updated by Message.SetSize
 // * contentType and header must be updated by Message.SetContentTypeAndHeader
-func txUpdateMetadaFromDB(metaBucket *bolt.Bucket, onlyMeta *pmapi.Message, log *logrus.Entry) {
+func txUpdateMetadaFromDB(metaBucket storage.Bucket, onlyMeta *pmapi.Message, log *logrus.Entry) {
 	// Size attribute on the server is counting encrypted data. We need to compute
 	// "real" size of decrypted data. Negative values will be processed during fetch.
 	onlyMeta.Size = -1
@@ -299,18 +491,105 @@ func (store *Store) deleteMessageEvent(apiID string) error {
 
 // deleteMessagesEvent deletes the message from metadata and all mailbox buckets.
 func (store *Store) deleteMessagesEvent(apiIDs []string) error {
-	return store.db.Update(func(tx *bolt.Tx) error {
+	if store.messageCache != nil {
+		for _, apiID := range apiIDs {
+			// Cached copy is needed to restore message deleted via bridge.
+			if !store.hasTombstone(apiID) {
+				store.messageCache.Delete(store.UserID(), apiID)
+			}
+		}
+	}
+	if store.attachmentCache != nil {
 		for _, apiID := range apiIDs {
+			store.attachmentCache.DeleteMessage(store.UserID(), apiID)
+		}
+	}
+	store.removeFromSearchIndex(apiIDs)
+
+	var deletedIDs []string
+	err := store.db.Update(func(tx storage.Tx) error {
+		// Received copies of self-sent messages hidden because of deleted
+		// sent copy have to be shown again.
+		var selfSentReceivedIDs []string
+
+		for _, apiID := range apiIDs {
+			if msg, err := store.txGetMessage(tx, apiID); err == nil {
+				selfSentReceivedIDs = append(selfSentReceivedIDs, store.txGetSelfSentReceivedIDs(tx, msg)...)
+				deletedIDs = append(deletedIDs, apiID)
+			}
+
 			if err := tx.Bucket(metadataBucket).Delete([]byte(apiID)); err != nil {
 				return err
 			}
 
+			if err := tx.Bucket(keywordsBucket).Delete([]byte(apiID)); err != nil {
+				return err
+			}
+
+			if err := tx.Bucket(phishingBucket).Delete([]byte(apiID)); err != nil {
+				return err
+			}
+
 			for _, a := range store.addresses {
 				if err := a.txDeleteMessage(tx, apiID); err != nil {
 					return err
 				}
 			}
 		}
+
+		if receivedMsgs := store.txGetMessagesNotInList(tx, selfSentReceivedIDs, nil); len(receivedMsgs) > 0 {
+			for _, a := range store.addresses {
+				if err := a.txCreateOrUpdateMessages(tx, receivedMsgs); err != nil {
+					return err
+				}
+			}
+		}
+
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	for _, apiID := range deletedIDs {
+		store.notifyObservers(Change{Type: MessageDeleted, MessageID: apiID})
+	}
+	return nil
+}
+
+// txGetMessagesNotInList returns messages from the database with given IDs
+// which are not in the list already. Unknown IDs are skipped.
+func (store *Store) txGetMessagesNotInList(tx storage.Tx, apiIDs []string, list []*pmapi.Message) (msgs []*pmapi.Message) {
+	inList := map[string]bool{}
+	for _, msg := range list {
+		inList[msg.ID] = true
+	}
+
+	for _, apiID := range apiIDs {
+		if inList[apiID] {
+			continue
+		}
+		inList[apiID] = true
+
+		if msg, err := store.txGetMessage(tx, apiID); err == nil {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// progressReader reports how many bytes were read so far.
+type progressReader struct {
+	r      io.Reader
+	read   int64
+	report func(read int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.read += int64(n)
+		r.report(r.read)
+	}
+	return n, err
 }
@@ -18,10 +18,17 @@
 package store
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
 	"net/mail"
 	"testing"
 
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
 	a "github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -125,6 +132,82 @@ func TestDeleteMessage(t *testing.T) {
 	checkMailboxMessageIDs(t, m, pmapi.AllMailLabel, []wantID{{"msg2", 2}})
 }
 
+func TestCreateAttachmentReportsProgress(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	key, err := crypto.GenerateKey("name", "name@pm.me", "x25519", 0)
+	require.NoError(t, err)
+	kr, err := crypto.NewKeyRing(key)
+	require.NoError(t, err)
+
+	body := make([]byte, 200*1024)
+	attachment := &pmapi.Attachment{Name: "file.bin", MessageID: "draftID"}
+
+	var reported []int64
+	progress := func(att *pmapi.Attachment, uploaded, size int64) {
+		require.Equal(t, attachment, att)
+		require.Equal(t, int64(len(body)), size)
+		reported = append(reported, uploaded)
+	}
+
+	m.client.EXPECT().CreateAttachment(gomock.Any(), attachment, gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, att *pmapi.Attachment, r io.Reader, sig io.Reader) (*pmapi.Attachment, error) {
+			// Nothing is encrypted before the upload reads it.
+			require.Empty(t, reported)
+			_, err := ioutil.ReadAll(r)
+			return &pmapi.Attachment{ID: "attID"}, err
+		},
+	)
+
+	created, err := m.store.createAttachment(kr, attachment, body, progress)
+	require.NoError(t, err)
+	require.Equal(t, "attID", created.ID)
+	require.True(t, len(reported) > 1)
+	require.Equal(t, int64(len(body)), reported[len(reported)-1])
+}
+
+func TestMatchDraftAttachments(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	key, err := crypto.GenerateKey("name", "name@pm.me", "x25519", 0)
+	require.NoError(t, err)
+	kr, err := crypto.NewKeyRing(key)
+	require.NoError(t, err)
+
+	uploadAttachment := func(id, name, body string) *pmapi.Attachment {
+		split, err := kr.EncryptAttachment(crypto.NewPlainMessageFromString(body), name)
+		require.NoError(t, err)
+		m.client.EXPECT().GetAttachment(gomock.Any(), id).Return(ioutil.NopCloser(bytes.NewReader(split.GetBinaryDataPacket())), nil)
+		return &pmapi.Attachment{
+			ID:         id,
+			Name:       name,
+			MIMEType:   "text/plain",
+			KeyPackets: base64.StdEncoding.EncodeToString(split.GetBinaryKeyPacket()),
+		}
+	}
+
+	unchanged := uploadAttachment("att1", "unchanged.txt", "same content")
+	changed := uploadAttachment("att2", "changed.txt", "old content")
+	draft := &pmapi.Message{ID: "draftID", Attachments: []*pmapi.Attachment{unchanged, changed}}
+
+	attachments := []*pmapi.Attachment{
+		{Name: "changed.txt", MIMEType: "text/plain"},
+		{Name: "unchanged.txt", MIMEType: "text/plain"},
+		{Name: "new.txt", MIMEType: "text/plain"},
+	}
+	bodies := [][]byte{[]byte("new content"), []byte("same content"), []byte("same content")}
+
+	kept, removed := m.store.matchDraftAttachments(kr, draft, attachments, bodies)
+	require.Equal(t, []bool{false, true, false}, kept)
+	require.Equal(t, []*pmapi.Attachment{changed}, removed)
+}
+
 func insertMessage(t *testing.T, m *mocksForStore, id, subject, sender string, unread int, labelIDs []string) { //nolint[unparam]
 	msg := getTestMessage(id, subject, sender, unread, labelIDs)
 	require.Nil(t, m.store.createOrUpdateMessageEvent(msg))
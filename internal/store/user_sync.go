@@ -18,14 +18,18 @@
 package store
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 
+	bridgeEvents "github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/incidents"
+	"github.com/ProtonMail/proton-bridge/internal/store/storage"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	bolt "go.etcd.io/bbolt"
 )
 
 const syncFinishTimeKey = "sync_state" // The original key was sync_state and we want to keep compatibility.
@@ -34,7 +38,7 @@ const syncIDsToBeDeletedKey = "ids_to_be_deleted"
 
 // updateCountsFromServer will download and set the counts.
 func (store *Store) updateCountsFromServer() error {
-	counts, err := store.client().CountMessages("")
+	counts, err := store.client().CountMessages(store.ctx, "")
 	if err != nil {
 		return errors.Wrap(err, "cannot update counts from server")
 	}
@@ -59,11 +63,24 @@ func (store *Store) isSynced(countsOnAPI []*pmapi.MessagesCount) (bool, error) {
 		return false, err
 	}
 
+	// Messages older than the maximum age are missing on purpose,
+	// so counts cannot be compared.
+	if store.GetSyncMaxAge().excludes() {
+		return true, nil
+	}
+
+	excludedLabels := store.getSyncExclusionLabels()
+
 	store.lock.Lock()
 	defer store.lock.Unlock()
 
 	countsAreOK := true
 	for _, counts := range allCounts {
+		// Mailboxes excluded from sync are empty on purpose.
+		if excludedLabels[counts.LabelID] {
+			continue
+		}
+
 		total, unread := uint(0), uint(0)
 		for _, address := range store.addresses {
 			mbox, err := address.getMailboxByID(counts.LabelID)
@@ -151,19 +168,45 @@ func (store *Store) triggerSync() {
 		}()
 
 		store.log.WithField("isIncomplete", syncState.isIncomplete()).Info("Store sync started")
+		store.notifyObservers(Change{Type: SyncStarted})
+
+		err := syncAllMail(store.ctx, store.panicHandler, store, func() messageLister { return store.client() }, syncState)
+
+		report := syncState.finishReport(err)
+		logSyncReport(report)
+		if err := store.saveSyncReport(report); err != nil {
+			store.log.WithError(err).Error("Failed to save sync report")
+		}
+
+		if errors.Cause(err) == context.Canceled {
+			store.log.Info("Store sync cancelled")
+			store.notifyObservers(Change{Type: SyncFailed, Err: err})
+			return
+		}
 
-		err := syncAllMail(store.panicHandler, store, func() messageLister { return store.client() }, syncState)
 		if err != nil {
 			log.WithError(err).Error("Store sync failed")
+			incidents.Report(incidents.SyncFailed, store.UserID(), err.Error())
 			store.syncCooldown.increaseWaitTime()
+			store.notifyObservers(Change{Type: SyncFailed, Err: err})
 			return
 		}
 
 		store.syncCooldown.reset()
 		syncState.setFinishTime()
+		store.notifyObservers(Change{Type: SyncFinished})
+		store.events.Emit(bridgeEvents.SyncFinishedEvent, store.UserID())
 	}()
 }
 
+// IsSyncRunning returns whether the sync is running right now.
+func (store *Store) IsSyncRunning() bool {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	return store.isSyncRunning
+}
+
 // isSyncFinished returns whether the database has finished a sync.
 func (store *Store) isSyncFinished() (isSynced bool) {
 	return store.loadSyncState().isFinished()
@@ -176,7 +219,7 @@ func (store *Store) loadSyncState() *syncState {
 	idRanges := []*syncIDRange{}
 	idsToBeDeleted := []string{}
 
-	err := store.db.View(func(tx *bolt.Tx) (err error) {
+	err := store.db.View(func(tx storage.Tx) (err error) {
 		b := tx.Bucket(syncStateBucket)
 
 		finishTimeByte := b.Get([]byte(syncFinishTimeKey))
@@ -208,7 +251,11 @@ func (store *Store) loadSyncState() *syncState {
 		store.log.WithError(err).Error("Failed to load sync state")
 	}
 
-	return newSyncState(store, finishTime, idRanges, idsToBeDeleted)
+	syncState := newSyncState(store, finishTime, idRanges, idsToBeDeleted)
+	if maxAge := store.GetSyncMaxAge(); maxAge.excludes() {
+		syncState.begin = maxAge.begin(time.Now())
+	}
+	return syncState
 }
 
 // saveSyncState saves information about sync to database.
@@ -224,7 +271,7 @@ func (store *Store) saveSyncState(finishTime int64, idRanges []*syncIDRange, ids
 		store.log.WithError(err).Error("Failed to marshall sync IDs to be deleted")
 	}
 
-	err = store.db.Update(func(tx *bolt.Tx) (err error) {
+	err = store.db.Update(func(tx storage.Tx) (err error) {
 		b := tx.Bucket(syncStateBucket)
 		if finishTime != 0 {
 			curTime := []byte(fmt.Sprintf("%v", finishTime))
@@ -0,0 +1,117 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package transfer
+
+import (
+	"html/template"
+)
+
+// HTMLProvider implements export to static HTML archive which can be
+// browsed or published without an email client. Every target mailbox is
+// a folder with threaded index.html, page per message and attachments.
+// Bodies are shown as text only so the archive never contains active
+// content from messages.
+type HTMLProvider struct {
+	root string
+
+	archives map[string]*htmlArchive
+}
+
+// NewHTMLProvider creates HTMLProvider.
+func NewHTMLProvider(root string) *HTMLProvider {
+	return &HTMLProvider{
+		root:     root,
+		archives: map[string]*htmlArchive{},
+	}
+}
+
+// ID is used for generating transfer ID by combining source and target ID.
+// We want to keep the same rules for import from or export to local files
+// no matter exact path, therefore it returns constant. The same as EML.
+func (p *HTMLProvider) ID() string {
+	return "local" //nolint[goconst]
+}
+
+// Mailboxes returns all folders with archive index under the root.
+func (p *HTMLProvider) Mailboxes(includeEmpty, includeAllMail bool) ([]Mailbox, error) {
+	folderNames, err := getFolderNamesWithFileSuffix(p.root, htmlIndexName)
+	if err != nil {
+		return nil, err
+	}
+
+	mailboxes := []Mailbox{}
+	for _, folderName := range folderNames {
+		mailboxes = append(mailboxes, Mailbox{
+			Name: folderName,
+		})
+	}
+	return mailboxes, nil
+}
+
+const htmlIndexName = "index.html"
+
+//nolint[gochecknoglobals]
+var htmlTemplates = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: auto; }
+ul.thread { list-style: none; padding-left: 1.5em; }
+.date, .from { color: #666; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>{{len .Entries}} messages</p>
+{{template "thread" .Threads}}
+</body>
+</html>
+{{define "thread"}}<ul class="thread">
+{{range .}}<li id="{{.File}}"><a href="{{.File}}.html">{{if .Subject}}{{.Subject}}{{else}}(no subject){{end}}</a> <span class="from">{{.From}}</span> <span class="date">{{.FormattedTime}}</span>{{if .Replies}}
+{{template "thread" .Replies}}{{end}}</li>
+{{end}}</ul>{{end}}
+{{define "message"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Subject}}</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: auto; }
+th { text-align: left; padding-right: 1em; }
+pre { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<p><a href="index.html#{{.File}}">Thread index</a></p>
+<h1>{{if .Subject}}{{.Subject}}{{else}}(no subject){{end}}</h1>
+<table>
+<tr><th>From</th><td>{{.From}}</td></tr>
+{{if .To}}<tr><th>To</th><td>{{.To}}</td></tr>
+{{end}}{{if .Cc}}<tr><th>Cc</th><td>{{.Cc}}</td></tr>
+{{end}}<tr><th>Date</th><td>{{.FormattedTime}}</td></tr>
+</table>
+<pre>{{.Body}}</pre>
+{{if .Attachments}}<h2>Attachments</h2>
+<ul>
+{{range .Attachments}}<li><a href="{{.Path}}">{{.Name}}</a></li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+{{end}}`))
@@ -0,0 +1,337 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package transfer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	pkgMessage "github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/hashicorp/go-multierror"
+	"github.com/jaytaylor/html2text"
+)
+
+// htmlArchive collects the index of one exported mailbox. Pages are written
+// while messages come, the index when the transfer ends.
+type htmlArchive struct {
+	name    string
+	entries []*htmlEntry
+}
+
+type htmlEntry struct {
+	File          string
+	Subject       string
+	From          string
+	To            string
+	Cc            string
+	FormattedTime string
+	Body          string
+	Attachments   []htmlAttachment
+	Replies       []*htmlEntry
+
+	time       time.Time
+	messageID  string
+	parentIDs  []string
+	latestTime time.Time
+}
+
+type htmlAttachment struct {
+	Name string
+	Path string
+}
+
+// DefaultMailboxes returns the default mailboxes for default rules if no other is found.
+func (p *HTMLProvider) DefaultMailboxes(sourceMailbox Mailbox) []Mailbox {
+	return []Mailbox{{
+		Name: sourceMailbox.Name,
+	}}
+}
+
+// CreateMailbox does nothing. Folders are created dynamically during the export.
+func (p *HTMLProvider) CreateMailbox(mailbox Mailbox) (Mailbox, error) {
+	return mailbox, nil
+}
+
+// TransferFrom exports messages from channel and writes indexes at the end.
+func (p *HTMLProvider) TransferFrom(rules transferRules, progress *Progress, ch <-chan Message) {
+	log.Info("Started transfer from channel to HTML")
+	defer log.Info("Finished transfer from channel to HTML")
+
+	for msg := range ch {
+		if progress.shouldStop() {
+			break
+		}
+
+		err := p.writeMessage(msg)
+		progress.messageImported(msg.ID, "", err)
+	}
+
+	for _, archive := range p.archives {
+		if err := p.writeIndex(archive); err != nil {
+			progress.fatal(err)
+			return
+		}
+	}
+}
+
+func (p *HTMLProvider) writeMessage(msg Message) error {
+	entry, attachments, err := newHTMLEntry(msg)
+	if err != nil {
+		return err
+	}
+
+	var multiErr error
+	for _, mailbox := range msg.Targets {
+		archive := p.getArchive(mailbox.Name)
+		if err := p.writePage(archive, entry, attachments); err != nil {
+			multiErr = multierror.Append(multiErr, err)
+			continue
+		}
+		archive.entries = append(archive.entries, entry)
+	}
+	return multiErr
+}
+
+func (p *HTMLProvider) getArchive(name string) *htmlArchive {
+	if archive, ok := p.archives[name]; ok {
+		return archive
+	}
+	archive := &htmlArchive{name: name}
+	p.archives[name] = archive
+	return archive
+}
+
+func (p *HTMLProvider) writePage(archive *htmlArchive, entry *htmlEntry, attachments [][]byte) error {
+	dir := filepath.Join(p.root, archive.name)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	if len(attachments) > 0 {
+		attDir := filepath.Join(dir, "attachments", entry.File)
+		if err := os.MkdirAll(attDir, os.ModePerm); err != nil {
+			return err
+		}
+		for i, data := range attachments {
+			if err := writeHTMLFile(filepath.Join(dir, filepath.FromSlash(entry.Attachments[i].Path)), data); err != nil {
+				return err
+			}
+		}
+	}
+
+	var page bytes.Buffer
+	if err := htmlTemplates.ExecuteTemplate(&page, "message", entry); err != nil {
+		return err
+	}
+	return writeHTMLFile(filepath.Join(dir, entry.File+".html"), page.Bytes())
+}
+
+func (p *HTMLProvider) writeIndex(archive *htmlArchive) error {
+	var index bytes.Buffer
+	err := htmlTemplates.ExecuteTemplate(&index, "index", struct {
+		Name    string
+		Entries []*htmlEntry
+		Threads []*htmlEntry
+	}{
+		Name:    archive.name,
+		Entries: archive.entries,
+		Threads: buildHTMLThreads(archive.entries),
+	})
+	if err != nil {
+		return err
+	}
+	return writeHTMLFile(filepath.Join(p.root, archive.name, htmlIndexName), index.Bytes())
+}
+
+func writeHTMLFile(path string, data []byte) error {
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// newHTMLEntry parses the message for its page. Attachments are returned
+// in the order of entry.Attachments.
+func newHTMLEntry(msg Message) (*htmlEntry, [][]byte, error) {
+	m, _, _, attReaders, err := pkgMessage.Parse(bytes.NewReader(msg.Body), "", "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hash := sha256.Sum256([]byte(msg.ID))
+	entry := &htmlEntry{
+		File:      hex.EncodeToString(hash[:8]),
+		Subject:   m.Subject,
+		From:      formatHTMLAddresses([]*mail.Address{m.Sender}),
+		To:        formatHTMLAddresses(m.ToList),
+		Cc:        formatHTMLAddresses(m.CCList),
+		Body:      m.Body,
+		time:      time.Unix(m.Time, 0),
+		messageID: firstMessageID(m.Header.Get("Message-Id")),
+	}
+	if m.Time != 0 {
+		entry.FormattedTime = entry.time.UTC().Format("2006-01-02 15:04 MST")
+	}
+
+	// Parent is the nearest ancestor found in the archive.
+	entry.parentIDs = pkgMessage.ParseMessageIDs(m.Header.Get("In-Reply-To"))
+	references := pkgMessage.ParseMessageIDs(m.Header.Get("References"))
+	for i := len(references) - 1; i >= 0; i-- {
+		entry.parentIDs = append(entry.parentIDs, references[i])
+	}
+
+	if m.MIMEType == "text/html" {
+		if entry.Body, err = html2text.FromString(m.Body); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	attachments := make([][]byte, 0, len(attReaders))
+	for i, attReader := range attReaders {
+		data, err := ioutil.ReadAll(attReader)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		name := fmt.Sprintf("attachment%d", i+1)
+		if i < len(m.Attachments) && m.Attachments[i].Name != "" {
+			name = m.Attachments[i].Name
+		}
+		fileName := fmt.Sprintf("%d_%s", i+1, sanitizeHTMLFileName(name))
+
+		entry.Attachments = append(entry.Attachments, htmlAttachment{
+			Name: name,
+			Path: path.Join("attachments", entry.File, fileName),
+		})
+		attachments = append(attachments, data)
+	}
+
+	return entry, attachments, nil
+}
+
+func firstMessageID(value string) string {
+	if ids := pkgMessage.ParseMessageIDs(value); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
+func formatHTMLAddresses(addresses []*mail.Address) string {
+	formatted := []string{}
+	for _, address := range addresses {
+		if address == nil {
+			continue
+		}
+		if address.Name != "" {
+			formatted = append(formatted, address.Name+" <"+address.Address+">")
+		} else {
+			formatted = append(formatted, address.Address)
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// sanitizeHTMLFileName keeps the name usable as file name and as part of
+// URL on every system.
+func sanitizeHTMLFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	return url.PathEscape(name)
+}
+
+// buildHTMLThreads returns the roots of threads with newest thread first.
+// Replies are nested under their parent from oldest.
+func buildHTMLThreads(entries []*htmlEntry) []*htmlEntry {
+	byMessageID := map[string]*htmlEntry{}
+	for _, entry := range entries {
+		entry.Replies = nil
+		if entry.messageID != "" {
+			byMessageID[entry.messageID] = entry
+		}
+	}
+
+	// Parents are assigned in order and a candidate under the entry would
+	// make a cycle from broken references.
+	parents := map[*htmlEntry]*htmlEntry{}
+	roots := []*htmlEntry{}
+	for _, entry := range entries {
+		if parent := findHTMLParent(entry, byMessageID, parents); parent != nil {
+			parents[entry] = parent
+		}
+	}
+	for _, entry := range entries {
+		if parent, ok := parents[entry]; ok {
+			parent.Replies = append(parent.Replies, entry)
+		} else {
+			roots = append(roots, entry)
+		}
+	}
+
+	for _, root := range roots {
+		sortHTMLThread(root)
+	}
+	sort.SliceStable(roots, func(i, j int) bool {
+		return roots[i].latestTime.After(roots[j].latestTime)
+	})
+	return roots
+}
+
+func findHTMLParent(entry *htmlEntry, byMessageID map[string]*htmlEntry, parents map[*htmlEntry]*htmlEntry) *htmlEntry {
+	for _, parentID := range entry.parentIDs {
+		parent, ok := byMessageID[parentID]
+		if !ok || isHTMLAncestor(entry, parent, parents) {
+			continue
+		}
+		return parent
+	}
+	return nil
+}
+
+func isHTMLAncestor(entry, candidate *htmlEntry, parents map[*htmlEntry]*htmlEntry) bool {
+	for current := candidate; current != nil; current = parents[current] {
+		if current == entry {
+			return true
+		}
+	}
+	return false
+}
+
+func sortHTMLThread(entry *htmlEntry) {
+	entry.latestTime = entry.time
+	for _, reply := range entry.Replies {
+		sortHTMLThread(reply)
+		if reply.latestTime.After(entry.latestTime) {
+			entry.latestTime = reply.latestTime
+		}
+	}
+	sort.SliceStable(entry.Replies, func(i, j int) bool {
+		return entry.Replies[i].time.Before(entry.Replies[j].time)
+	})
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package transfer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	r "github.com/stretchr/testify/require"
+)
+
+func getTestHTMLMsgBody(messageID, inReplyTo, date, subject string) []byte {
+	body := "Subject: " + subject + "\r\n" +
+		"From: Bridge Test <bridgetest@pm.test>\r\n" +
+		"To: list@pm.test\r\n" +
+		"Date: " + date + "\r\n" +
+		"Message-Id: " + messageID + "\r\n"
+	if inReplyTo != "" {
+		body += "In-Reply-To: " + inReplyTo + "\r\n"
+	}
+	return []byte(body + `Content-Type: multipart/mixed; boundary=b1
+
+--b1
+Content-Type: text/html; charset=utf-8
+
+<p>hello <b>` + subject + `</b></p><script>alert(1)</script>
+--b1
+Content-Type: text/plain; name="notes/a.txt"
+Content-Disposition: attachment; filename="notes/a.txt"
+
+attached
+--b1--
+`)
+}
+
+func TestHTMLProviderTransferFrom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "html")
+	r.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	provider := NewHTMLProvider(dir)
+
+	rules, rulesClose := newTestRules(t)
+	defer rulesClose()
+	_ = rules.setRule(Mailbox{Name: "List"}, []Mailbox{{Name: "List"}}, 0, 0)
+
+	target := []Mailbox{{Name: "List"}}
+	testTransferFrom(t, rules, provider, []Message{
+		{ID: "reply", Targets: target, Body: getTestHTMLMsgBody("<2@pm.test>", "<1@pm.test>", "Tue, 2 Jun 2020 10:00:00 +0000", "Re: first")},
+		{ID: "first", Targets: target, Body: getTestHTMLMsgBody("<1@pm.test>", "", "Mon, 1 Jun 2020 10:00:00 +0000", "first")},
+		{ID: "other", Targets: target, Body: getTestHTMLMsgBody("<3@pm.test>", "<missing@pm.test>", "Mon, 1 Jun 2020 12:00:00 +0000", "other")},
+	})
+
+	mailboxes, err := provider.Mailboxes(true, false)
+	r.NoError(t, err)
+	r.Equal(t, []Mailbox{{Name: "List"}}, mailboxes)
+
+	index, err := ioutil.ReadFile(filepath.Join(dir, "List", "index.html"))
+	r.NoError(t, err)
+
+	// Thread with the newest reply goes first and the reply is nested.
+	first := strings.Index(string(index), ">first</a>")
+	reply := strings.Index(string(index), ">Re: first</a>")
+	other := strings.Index(string(index), ">other</a>")
+	r.True(t, first >= 0 && reply > first && other > reply, string(index))
+	r.Contains(t, string(index[first:reply]), `<ul class="thread">`)
+
+	entry, attachments, err := newHTMLEntry(Message{ID: "first", Body: getTestHTMLMsgBody("<1@pm.test>", "", "Mon, 1 Jun 2020 10:00:00 +0000", "first")})
+	r.NoError(t, err)
+	r.Len(t, attachments, 1)
+	r.Equal(t, "attachments/"+entry.File+"/1_notes_a.txt", entry.Attachments[0].Path)
+
+	page, err := ioutil.ReadFile(filepath.Join(dir, "List", entry.File+".html"))
+	r.NoError(t, err)
+	r.Contains(t, string(page), "hello *first*")
+	r.NotContains(t, string(page), "<script>")
+	r.Contains(t, string(page), `<a href="index.html#`+entry.File+`">`)
+
+	attachment, err := ioutil.ReadFile(filepath.Join(dir, "List", filepath.FromSlash(entry.Attachments[0].Path)))
+	r.NoError(t, err)
+	r.Equal(t, "attached", strings.TrimSpace(string(attachment)))
+}
+
+func TestBuildHTMLThreadsIgnoresCycles(t *testing.T) {
+	first := &htmlEntry{File: "1", messageID: "<1@pm.test>", parentIDs: []string{"<2@pm.test>"}}
+	second := &htmlEntry{File: "2", messageID: "<2@pm.test>", parentIDs: []string{"<1@pm.test>"}}
+
+	roots := buildHTMLThreads([]*htmlEntry{first, second})
+	r.Equal(t, []*htmlEntry{second}, roots)
+	r.Equal(t, []*htmlEntry{first}, second.Replies)
+}
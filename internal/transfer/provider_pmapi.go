@@ -18,6 +18,7 @@
 package transfer
 
 import (
+	"context"
 	"sort"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
@@ -35,6 +36,10 @@ type PMAPIProvider struct {
 
 	importMsgReqMap  map[string]*pmapi.ImportMsgReq // Key is msg transfer ID.
 	importMsgReqSize int
+	importTuner      *importTuner
+
+	skipDuplicates  bool
+	seenExternalIDs map[string]bool
 }
 
 // NewPMAPIProvider returns new PMAPIProvider.
@@ -47,6 +52,7 @@ func NewPMAPIProvider(config *pmapi.ClientConfig, clientManager ClientManager, u
 
 		importMsgReqMap:  map[string]*pmapi.ImportMsgReq{},
 		importMsgReqSize: 0,
+		importTuner:      newImportTuner(),
 	}
 
 	if addressID != "" {
@@ -60,6 +66,12 @@ func NewPMAPIProvider(config *pmapi.ClientConfig, clientManager ClientManager, u
 	return provider, nil
 }
 
+// SetSkipDuplicates sets whether messages with Message-ID which is already
+// in the account, or was already imported by this transfer, are skipped.
+func (p *PMAPIProvider) SetSkipDuplicates(skip bool) {
+	p.skipDuplicates = skip
+}
+
 func (p *PMAPIProvider) client() pmapi.Client {
 	return p.clientManager.GetClient(p.userID)
 }
@@ -72,7 +84,7 @@ func (p *PMAPIProvider) ID() string {
 
 // Mailboxes returns all available labels in ProtonMail account.
 func (p *PMAPIProvider) Mailboxes(includeEmpty, includeAllMail bool) ([]Mailbox, error) {
-	labels, err := p.client().ListLabels()
+	labels, err := p.client().ListLabels(context.Background())
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +93,7 @@ func (p *PMAPIProvider) Mailboxes(includeEmpty, includeAllMail bool) ([]Mailbox,
 
 	emptyLabelsMap := map[string]bool{}
 	if !includeEmpty {
-		messagesCounts, err := p.client().CountMessages(p.addressID)
+		messagesCounts, err := p.client().CountMessages(context.Background(), p.addressID)
 		if err != nil {
 			return nil, err
 		}
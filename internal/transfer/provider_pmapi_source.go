@@ -18,6 +18,7 @@
 package transfer
 
 import (
+	"bytes"
 	"fmt"
 	"sync"
 
@@ -149,7 +150,11 @@ func (p *PMAPIProvider) exportMessage(rule *Rule, progress *Progress, pmapiMsgID
 
 	msgBuilder := pkgMessage.NewBuilder(p.client(), msg)
 	msgBuilder.EncryptedToHTML = false
-	_, body, err := msgBuilder.BuildMessage()
+	// Targets import the whole message, so it is written to memory, but its
+	// body structure is not needed.
+	buf := &bytes.Buffer{}
+	_, err := msgBuilder.WriteTo(buf)
+	body := buf.Bytes()
 	if err != nil {
 		return Message{
 			Body: body, // Keep body to show details about the message to user.
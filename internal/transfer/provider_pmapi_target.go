@@ -19,13 +19,15 @@ package transfer
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
+	"time"
 
 	pkgMessage "github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
-	"github.com/ProtonMail/proton-bridge/pkg/sentry"
 	"github.com/pkg/errors"
 )
 
@@ -54,7 +56,7 @@ func (p *PMAPIProvider) CreateMailbox(mailbox Mailbox) (Mailbox, error) {
 		exclusive = 1
 	}
 
-	label, err := p.client().CreateLabel(&pmapi.Label{
+	label, err := p.client().CreateLabel(context.Background(), &pmapi.Label{
 		Name:      mailbox.Name,
 		Color:     mailbox.Color,
 		Exclusive: exclusive,
@@ -76,6 +78,8 @@ func (p *PMAPIProvider) TransferFrom(rules transferRules, progress *Progress, ch
 	// old stuff from previous cancelled run.
 	p.importMsgReqMap = map[string]*pmapi.ImportMsgReq{}
 	p.importMsgReqSize = 0
+	p.importTuner = newImportTuner()
+	p.seenExternalIDs = map[string]bool{}
 
 	for msg := range ch {
 		if progress.shouldStop() {
@@ -90,8 +94,9 @@ func (p *PMAPIProvider) TransferFrom(rules transferRules, progress *Progress, ch
 	}
 
 	if len(p.importMsgReqMap) > 0 {
-		p.importMessages(progress)
+		p.startImportMessages(progress)
 	}
+	p.importTuner.wait()
 }
 
 func (p *PMAPIProvider) isMessageDraft(msg Message) bool {
@@ -156,6 +161,19 @@ func (p *PMAPIProvider) importDraft(msg Message, globalMailbox *Mailbox) (string
 }
 
 func (p *PMAPIProvider) transferMessage(rules transferRules, progress *Progress, msg Message) {
+	if p.skipDuplicates {
+		duplicateID, isDuplicate, err := p.findDuplicate(msg)
+		if err != nil {
+			progress.messageImported(msg.ID, "", err)
+			return
+		}
+		if isDuplicate {
+			log.WithField("msg", msg.ID).WithField("duplicateID", duplicateID).Debug("Skipping duplicate message")
+			progress.messageImported(msg.ID, duplicateID, nil)
+			return
+		}
+	}
+
 	importMsgReq, err := p.generateImportMsgReq(msg, rules.globalMailbox)
 	if err != nil {
 		progress.messageImported(msg.ID, "", err)
@@ -163,8 +181,8 @@ func (p *PMAPIProvider) transferMessage(rules transferRules, progress *Progress,
 	}
 
 	importMsgReqSize := len(importMsgReq.Body)
-	if p.importMsgReqSize+importMsgReqSize > pmapiImportBatchMaxSize || len(p.importMsgReqMap) == pmapiImportBatchMaxItems {
-		p.importMessages(progress)
+	if p.importMsgReqSize+importMsgReqSize > pmapiImportBatchMaxSize || len(p.importMsgReqMap) >= p.importTuner.getBatchItems() {
+		p.startImportMessages(progress)
 	}
 	p.importMsgReqMap[msg.ID] = importMsgReq
 	p.importMsgReqSize += importMsgReqSize
@@ -213,14 +231,7 @@ func (p *PMAPIProvider) parseMessage(msg Message) (m *pmapi.Message, r []io.Read
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("panic while parse: %v", r)
-			if sentryErr := sentry.ReportSentryCrash(
-				p.clientConfig.ClientID,
-				p.clientConfig.AppVersion,
-				p.clientConfig.UserAgent,
-				err,
-			); sentryErr != nil {
-				log.Error("Sentry crash report failed: ", sentryErr)
-			}
+			saveCrashReport(err)
 		}
 	}()
 	message, _, _, attachmentReaders, err := pkgMessage.Parse(bytes.NewBuffer(msg.Body), "", "")
@@ -254,25 +265,74 @@ func computeMessageFlags(labels []string) (flag int64) {
 	return flag
 }
 
-func (p *PMAPIProvider) importMessages(progress *Progress) {
+// startImportMessages imports the collected batch in the background once
+// the tuner allows another request to run, and starts a new batch.
+// findDuplicate returns whether the message with the same Message-ID is
+// already in the account, with its ID, or was already seen by this transfer.
+// Messages without Message-ID are never duplicates.
+func (p *PMAPIProvider) findDuplicate(msg Message) (string, bool, error) {
+	header, err := getMessageHeader(msg.Body)
+	if err != nil {
+		// Import reports the broken message.
+		return "", false, nil
+	}
+
+	externalID := strings.Trim(strings.TrimSpace(header.Get("Message-Id")), "<>")
+	if externalID == "" {
+		return "", false, nil
+	}
+	if p.seenExternalIDs[externalID] {
+		return "", true, nil
+	}
+	p.seenExternalIDs[externalID] = true
+
+	messages, _, err := p.listMessages(&pmapi.MessagesFilter{
+		ExternalID: externalID,
+		AddressID:  p.addressID,
+		Limit:      1,
+	})
+	if err != nil {
+		return "", false, errors.Wrap(err, "failed to check duplicate")
+	}
+	if len(messages) > 0 {
+		return messages[0].ID, true, nil
+	}
+	return "", false, nil
+}
+
+func (p *PMAPIProvider) startImportMessages(progress *Progress) {
+	importMsgReqMap, importMsgReqSize := p.importMsgReqMap, p.importMsgReqSize
+	p.importMsgReqMap = map[string]*pmapi.ImportMsgReq{}
+	p.importMsgReqSize = 0
+
+	p.importTuner.acquire()
+	go func() {
+		defer p.importTuner.release()
+		p.importMessages(progress, importMsgReqMap, importMsgReqSize)
+	}()
+}
+
+func (p *PMAPIProvider) importMessages(progress *Progress, importMsgReqMap map[string]*pmapi.ImportMsgReq, importMsgReqSize int) {
 	if progress.shouldStop() {
 		return
 	}
 
 	importMsgIDs := []string{}
 	importMsgRequests := []*pmapi.ImportMsgReq{}
-	for msgID, req := range p.importMsgReqMap {
+	for msgID, req := range importMsgReqMap {
 		importMsgIDs = append(importMsgIDs, msgID)
 		importMsgRequests = append(importMsgRequests, req)
 	}
 
-	log.WithField("msgIDs", importMsgIDs).WithField("size", p.importMsgReqSize).Debug("Importing messages")
+	log.WithField("msgIDs", importMsgIDs).WithField("size", importMsgReqSize).Debug("Importing messages")
+	start := time.Now()
 	results, err := p.importRequest(importMsgRequests)
+	p.importTuner.observe(len(importMsgRequests), time.Since(start), err)
 
 	// In case the whole request failed, try to import every message one by one.
 	if err != nil || len(results) == 0 {
 		log.WithError(err).Warning("Importing messages failed, trying one by one")
-		for msgID, req := range p.importMsgReqMap {
+		for msgID, req := range importMsgReqMap {
 			importedID, err := p.importMessage(progress, req)
 			progress.messageImported(msgID, importedID, err)
 		}
@@ -291,9 +351,6 @@ func (p *PMAPIProvider) importMessages(progress *Progress) {
 			progress.messageImported(msgID, result.MessageID, nil)
 		}
 	}
-
-	p.importMsgReqMap = map[string]*pmapi.ImportMsgReq{}
-	p.importMsgReqSize = 0
 }
 
 func (p *PMAPIProvider) importMessage(progress *Progress, req *pmapi.ImportMsgReq) (importedID string, importedErr error) {
@@ -19,6 +19,7 @@ package transfer
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -109,6 +110,42 @@ func TestPMAPIProviderTransferFrom(t *testing.T) {
 	})
 }
 
+func TestPMAPIProviderTransferFromSkipsDuplicates(t *testing.T) {
+	m := initMocks(t)
+	defer m.ctrl.Finish()
+
+	m.pmapiClient.EXPECT().KeyRingForAddressID(gomock.Any()).Return(m.keyring, nil).AnyTimes()
+	m.pmapiClient.EXPECT().ListMessages(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+		if filter.ExternalID == "existing@pm.test" {
+			return []*pmapi.Message{{ID: "existingID"}}, 1, nil
+		}
+		return []*pmapi.Message{}, 0, nil
+	}).Times(2)
+	m.pmapiClient.EXPECT().Import(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, requests []*pmapi.ImportMsgReq) ([]*pmapi.ImportMsgRes, error) {
+		r.Len(t, requests, 1)
+		r.True(t, bytes.Contains(requests[0].Body, []byte("msg2")))
+		return []*pmapi.ImportMsgRes{{MessageID: "msg2"}}, nil
+	})
+
+	provider, err := NewPMAPIProvider(m.pmapiConfig, m.clientManager, "user", "addressID")
+	r.NoError(t, err)
+	provider.SetSkipDuplicates(true)
+
+	rules, rulesClose := newTestRules(t)
+	defer rulesClose()
+	setupPMAPIRules(rules)
+
+	withMessageID := func(subject, messageID string) []byte {
+		return append([]byte("Message-Id: <"+messageID+">\n"), getTestMsgBody(subject)...)
+	}
+
+	testTransferFrom(t, rules, provider, []Message{
+		{ID: "msg1", Body: withMessageID("msg1", "existing@pm.test"), Targets: []Mailbox{{ID: pmapi.InboxLabel}}},
+		{ID: "msg2", Body: withMessageID("msg2", "new@pm.test"), Targets: []Mailbox{{ID: pmapi.InboxLabel}}},
+		{ID: "msg3", Body: withMessageID("msg3", "new@pm.test"), Targets: []Mailbox{{ID: pmapi.InboxLabel}}},
+	})
+}
+
 func TestPMAPIProviderTransferFromDraft(t *testing.T) {
 	m := initMocks(t)
 	defer m.ctrl.Finish()
@@ -151,22 +188,22 @@ func setupPMAPIRules(rules transferRules) {
 
 func setupPMAPIClientExpectationForExport(m *mocks) {
 	m.pmapiClient.EXPECT().KeyRingForAddressID(gomock.Any()).Return(m.keyring, nil).AnyTimes()
-	m.pmapiClient.EXPECT().ListLabels().Return([]*pmapi.Label{
+	m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return([]*pmapi.Label{
 		{ID: "label1", Name: "Foo", Color: "blue", Exclusive: 0, Order: 2},
 		{ID: "label2", Name: "Bar", Color: "green", Exclusive: 0, Order: 1},
 		{ID: "folder1", Name: "One", Color: "red", Exclusive: 1, Order: 1},
 		{ID: "folder2", Name: "Two", Color: "orange", Exclusive: 1, Order: 2},
 	}, nil).AnyTimes()
-	m.pmapiClient.EXPECT().CountMessages(gomock.Any()).Return([]*pmapi.MessagesCount{
+	m.pmapiClient.EXPECT().CountMessages(gomock.Any(), gomock.Any()).Return([]*pmapi.MessagesCount{
 		{LabelID: "label1", Total: 10},
 		{LabelID: "label2", Total: 0},
 		{LabelID: "folder1", Total: 20},
 	}, nil).AnyTimes()
-	m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{
+	m.pmapiClient.EXPECT().ListMessages(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{
 		{ID: "msg1"},
 		{ID: "msg2"},
 	}, 2, nil).AnyTimes()
-	m.pmapiClient.EXPECT().GetMessage(gomock.Any()).DoAndReturn(func(msgID string) (*pmapi.Message, error) {
+	m.pmapiClient.EXPECT().GetMessage(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msgID string) (*pmapi.Message, error) {
 		return &pmapi.Message{
 			ID:       msgID,
 			Body:     string(getTestMsgBody(msgID)),
@@ -177,7 +214,7 @@ func setupPMAPIClientExpectationForExport(m *mocks) {
 
 func setupPMAPIClientExpectationForImport(m *mocks) {
 	m.pmapiClient.EXPECT().KeyRingForAddressID(gomock.Any()).Return(m.keyring, nil).AnyTimes()
-	m.pmapiClient.EXPECT().Import(gomock.Any()).DoAndReturn(func(requests []*pmapi.ImportMsgReq) ([]*pmapi.ImportMsgRes, error) {
+	m.pmapiClient.EXPECT().Import(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, requests []*pmapi.ImportMsgReq) ([]*pmapi.ImportMsgRes, error) {
 		results := []*pmapi.ImportMsgRes{}
 		for _, request := range requests {
 			for _, msgID := range []string{"msg1", "msg2"} {
@@ -192,7 +229,7 @@ func setupPMAPIClientExpectationForImport(m *mocks) {
 
 func setupPMAPIClientExpectationForImportDraft(m *mocks) {
 	m.pmapiClient.EXPECT().KeyRingForAddressID(gomock.Any()).Return(m.keyring, nil).AnyTimes()
-	m.pmapiClient.EXPECT().CreateDraft(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(msg *pmapi.Message, parentID string, action int) (*pmapi.Message, error) {
+	m.pmapiClient.EXPECT().CreateDraft(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msg *pmapi.Message, parentID string, action int) (*pmapi.Message, error) {
 		r.Equal(m.t, msg.Subject, "draft1")
 		msg.ID = "draft1"
 		return msg, nil
@@ -0,0 +1,157 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package transfer
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	pmapiImportMaxWorkers = 4
+
+	// pmapiImportSlowLatency is the duration of the import request which
+	// is considered too slow no matter how fast previous requests were.
+	pmapiImportSlowLatency = 30 * time.Second
+
+	// pmapiImportSlowFactor is how many times slower than usual one message
+	// of the import request can be before the request is considered slow.
+	pmapiImportSlowFactor = 3
+)
+
+// importTuner controls how many import requests run in parallel and how
+// many messages are sent in one request. Limits are tuned AIMD-style from
+// the API feedback: every fast successful request increases them by one
+// (the batch first, then the number of workers) and every failed or slow
+// request halves them. Throttled requests are retried by pmapi with backoff,
+// so throttling is observed as a slow request.
+type importTuner struct {
+	lock *sync.Cond
+
+	workers    int
+	batchItems int
+	running    int
+
+	// messageLatency is the moving average of time needed for one message.
+	messageLatency time.Duration
+}
+
+func newImportTuner() *importTuner {
+	return &importTuner{
+		lock:       sync.NewCond(&sync.Mutex{}),
+		workers:    1,
+		batchItems: pmapiImportBatchMaxItems,
+	}
+}
+
+// getBatchItems returns the current maximum number of messages in one request.
+func (t *importTuner) getBatchItems() int {
+	t.lock.L.Lock()
+	defer t.lock.L.Unlock()
+
+	return t.batchItems
+}
+
+// getWorkers returns the current maximum number of parallel requests.
+func (t *importTuner) getWorkers() int {
+	t.lock.L.Lock()
+	defer t.lock.L.Unlock()
+
+	return t.workers
+}
+
+// acquire blocks until another request can be started.
+func (t *importTuner) acquire() {
+	t.lock.L.Lock()
+	defer t.lock.L.Unlock()
+
+	for t.running >= t.workers {
+		t.lock.Wait()
+	}
+	t.running++
+}
+
+// release marks the request started by acquire as finished.
+func (t *importTuner) release() {
+	t.lock.L.Lock()
+	defer t.lock.L.Unlock()
+
+	t.running--
+	t.lock.Broadcast()
+}
+
+// wait blocks until all started requests are finished.
+func (t *importTuner) wait() {
+	t.lock.L.Lock()
+	defer t.lock.L.Unlock()
+
+	for t.running > 0 {
+		t.lock.Wait()
+	}
+}
+
+// observe updates limits based on the result of the import request
+// with count messages which took latency.
+func (t *importTuner) observe(count int, latency time.Duration, err error) {
+	t.lock.L.Lock()
+	defer t.lock.L.Unlock()
+	defer t.lock.Broadcast()
+
+	if count <= 0 {
+		count = 1
+	}
+	messageLatency := latency / time.Duration(count)
+
+	slow := latency > pmapiImportSlowLatency ||
+		(t.messageLatency > 0 && messageLatency > pmapiImportSlowFactor*t.messageLatency)
+
+	if t.messageLatency == 0 {
+		t.messageLatency = messageLatency
+	} else {
+		t.messageLatency = (4*t.messageLatency + messageLatency) / 5
+	}
+
+	if err != nil || slow {
+		t.decrease()
+		log.WithError(err).
+			WithField("latency", latency).
+			WithField("workers", t.workers).
+			WithField("batch", t.batchItems).
+			Debug("Import slowed down")
+		return
+	}
+
+	t.increase()
+}
+
+func (t *importTuner) increase() {
+	if t.batchItems < pmapiImportBatchMaxItems {
+		t.batchItems++
+	} else if t.workers < pmapiImportMaxWorkers {
+		t.workers++
+	}
+}
+
+func (t *importTuner) decrease() {
+	if t.workers > 1 {
+		t.workers /= 2
+	}
+	if t.batchItems > 1 {
+		t.batchItems /= 2
+	}
+}
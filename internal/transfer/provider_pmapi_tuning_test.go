@@ -0,0 +1,87 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package transfer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	r "github.com/stretchr/testify/require"
+)
+
+func TestImportTunerIncreasesBatchThenWorkers(t *testing.T) {
+	tuner := newImportTuner()
+	tuner.batchItems = pmapiImportBatchMaxItems - 1
+
+	tuner.observe(5, time.Second, nil)
+	r.Equal(t, pmapiImportBatchMaxItems, tuner.getBatchItems())
+	r.Equal(t, 1, tuner.getWorkers())
+
+	for i := 0; i < 2*pmapiImportMaxWorkers; i++ {
+		tuner.observe(5, time.Second, nil)
+	}
+	r.Equal(t, pmapiImportBatchMaxItems, tuner.getBatchItems())
+	r.Equal(t, pmapiImportMaxWorkers, tuner.getWorkers())
+}
+
+func TestImportTunerDecreasesOnError(t *testing.T) {
+	tuner := newImportTuner()
+	tuner.workers = 4
+
+	tuner.observe(10, time.Second, errors.New("failed"))
+	r.Equal(t, pmapiImportBatchMaxItems/2, tuner.getBatchItems())
+	r.Equal(t, 2, tuner.getWorkers())
+}
+
+func TestImportTunerDecreasesOnSlowRequest(t *testing.T) {
+	tuner := newImportTuner()
+	tuner.workers = 4
+
+	tuner.observe(10, 10*time.Second, nil)
+	r.Equal(t, 4, tuner.getWorkers())
+
+	tuner.observe(10, 40*time.Second, nil)
+	r.Equal(t, 2, tuner.getWorkers())
+
+	tuner.observe(1, 5*time.Second, nil)
+	r.Equal(t, 1, tuner.getWorkers())
+	r.Equal(t, pmapiImportBatchMaxItems/4, tuner.getBatchItems())
+}
+
+func TestImportTunerLimitsRunningRequests(t *testing.T) {
+	tuner := newImportTuner()
+
+	tuner.acquire()
+	acquired := make(chan struct{})
+	go func() {
+		tuner.acquire()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second request should wait for the first one")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	tuner.release()
+	<-acquired
+	tuner.release()
+	tuner.wait()
+}
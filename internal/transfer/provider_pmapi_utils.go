@@ -18,6 +18,7 @@
 package transfer
 
 import (
+	"context"
 	"io"
 	"time"
 
@@ -71,7 +72,7 @@ func (p *PMAPIProvider) tryReconnect() error {
 
 func (p *PMAPIProvider) listMessages(filter *pmapi.MessagesFilter) (messages []*pmapi.Message, count int, err error) {
 	err = p.ensureConnection(func() error {
-		messages, count, err = p.client().ListMessages(filter)
+		messages, count, err = p.client().ListMessages(context.Background(), filter)
 		return err
 	})
 	return
@@ -79,7 +80,7 @@ func (p *PMAPIProvider) listMessages(filter *pmapi.MessagesFilter) (messages []*
 
 func (p *PMAPIProvider) getMessage(msgID string) (message *pmapi.Message, err error) {
 	err = p.ensureConnection(func() error {
-		message, err = p.client().GetMessage(msgID)
+		message, err = p.client().GetMessage(context.Background(), msgID)
 		return err
 	})
 	return
@@ -87,7 +88,7 @@ func (p *PMAPIProvider) getMessage(msgID string) (message *pmapi.Message, err er
 
 func (p *PMAPIProvider) importRequest(req []*pmapi.ImportMsgReq) (res []*pmapi.ImportMsgRes, err error) {
 	err = p.ensureConnection(func() error {
-		res, err = p.client().Import(req)
+		res, err = p.client().Import(context.Background(), req)
 		return err
 	})
 	return
@@ -95,7 +96,7 @@ func (p *PMAPIProvider) importRequest(req []*pmapi.ImportMsgReq) (res []*pmapi.I
 
 func (p *PMAPIProvider) createDraft(message *pmapi.Message, parent string, action int) (draft *pmapi.Message, err error) {
 	err = p.ensureConnection(func() error {
-		draft, err = p.client().CreateDraft(message, parent, action)
+		draft, err = p.client().CreateDraft(context.Background(), message, parent, action)
 		return err
 	})
 	return
@@ -103,7 +104,7 @@ func (p *PMAPIProvider) createDraft(message *pmapi.Message, parent string, actio
 
 func (p *PMAPIProvider) createAttachment(att *pmapi.Attachment, r io.Reader, sig io.Reader) (created *pmapi.Attachment, err error) {
 	err = p.ensureConnection(func() error {
-		created, err = p.client().CreateAttachment(att, r, sig)
+		created, err = p.client().CreateAttachment(context.Background(), att, r, sig)
 		return err
 	})
 	return
@@ -28,6 +28,22 @@ import (
 
 var log = logrus.WithField("pkg", "transfer") //nolint[gochecknoglobals]
 
+// crashReportSaver saves report of recovered panic, see SetCrashReportSaver.
+var crashReportSaver func(reason interface{}) //nolint[gochecknoglobals]
+
+// SetCrashReportSaver sets the function saving crash reports of panics
+// recovered during transfer, e.g. in the old message parser. The report has
+// to be saved, not sent, as it can be sent only after the user agrees.
+func SetCrashReportSaver(saver func(reason interface{})) {
+	crashReportSaver = saver
+}
+
+func saveCrashReport(reason interface{}) {
+	if crashReportSaver != nil {
+		crashReportSaver(reason)
+	}
+}
+
 // Transfer is facade on top of import rules, progress manager and source
 // and target providers. This is the main object which should be used.
 type Transfer struct {
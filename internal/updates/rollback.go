@@ -0,0 +1,117 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package updates
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	rollbackInfoFile = "rollback.json"
+	previousAppDir   = "previous"
+)
+
+// rollbackInfo describes the update applied in place and where the previous
+// version is kept.
+type rollbackInfo struct {
+	Version         string
+	PreviousVersion string
+	AppPath         string
+}
+
+func (u *Updates) backupDir() string {
+	if u.rollbackDir == "" {
+		return filepath.Join(u.updateTempDir, "backup")
+	}
+	return filepath.Join(u.rollbackDir, previousAppDir)
+}
+
+func writeRollbackInfo(rollbackDir string, info rollbackInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(rollbackDir, rollbackInfoFile), data, 0600)
+}
+
+func readRollbackInfo(rollbackDir string) (info rollbackInfo, err error) {
+	data, err := ioutil.ReadFile(filepath.Clean(filepath.Join(rollbackDir, rollbackInfoFile)))
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &info); err != nil {
+		return
+	}
+	if _, err = os.Stat(filepath.Join(rollbackDir, previousAppDir)); err != nil {
+		return
+	}
+	return info, nil
+}
+
+// clearRollback forgets the previous version, e.g. before it is replaced
+// by the version being updated.
+func clearRollback(rollbackDir string) error {
+	if err := os.Remove(filepath.Join(rollbackDir, rollbackInfoFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(rollbackDir, previousAppDir))
+}
+
+// GetRollbackVersion returns the version kept after the last in-place update
+// or empty string if there is no version to roll back to.
+func GetRollbackVersion(rollbackDir string) string {
+	info, err := readRollbackInfo(rollbackDir)
+	if err != nil {
+		return ""
+	}
+	return info.PreviousVersion
+}
+
+// Rollback replaces the app updated in place with the previous version.
+// The previous version is removed afterwards so it is not possible to roll
+// back twice.
+func Rollback(rollbackDir string) (version string, err error) {
+	info, err := readRollbackInfo(rollbackDir)
+	if os.IsNotExist(err) {
+		return "", errors.New("no previous version is kept")
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read previous version")
+	}
+
+	previousPath := filepath.Join(rollbackDir, previousAppDir)
+	log.WithField("version", info.PreviousVersion).Warn("Rolling back update in ", info.AppPath)
+
+	if err := removeMissing(info.AppPath, previousPath); err != nil {
+		return "", errors.Wrap(err, "failed to remove files of updated version")
+	}
+	if err := copyRecursively(previousPath, info.AppPath); err != nil {
+		return "", errors.Wrap(err, "failed to restore previous version")
+	}
+
+	if err := clearRollback(rollbackDir); err != nil {
+		log.WithError(err).Warn("Cannot remove previous version")
+	}
+
+	return info.PreviousVersion, nil
+}
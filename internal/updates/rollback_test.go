@@ -0,0 +1,69 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package updates
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rollback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	appDir := filepath.Join(dir, "app")
+	originalDir := filepath.Join(dir, "original")
+	updateDir := filepath.Join(dir, "update")
+	rollbackDir := filepath.Join(dir, "rollback")
+	require.NoError(t, os.MkdirAll(rollbackDir, 0700))
+
+	require.NoError(t, createTestFolder(appDir, FileType))
+	require.NoError(t, createTestFolder(originalDir, FileType))
+	require.NoError(t, createTestFolder(updateDir, DirType))
+
+	u := NewBridge(filepath.Join(dir, "updates"))
+	u.SetRollbackDir(rollbackDir)
+	require.NoError(t, syncFolders(appDir, updateDir, u.backupDir()))
+	require.NoError(t, writeRollbackInfo(rollbackDir, rollbackInfo{Version: "2.0.0", PreviousVersion: "1.0.0", AppPath: appDir}))
+	require.NoError(t, checkThatFilesAreSame(updateDir, appDir))
+	require.Equal(t, "1.0.0", GetRollbackVersion(rollbackDir))
+
+	version, err := Rollback(rollbackDir)
+	require.NoError(t, err)
+	require.Equal(t, "1.0.0", version)
+	require.NoError(t, checkThatFilesAreSame(originalDir, appDir))
+
+	require.Equal(t, "", GetRollbackVersion(rollbackDir))
+	_, err = Rollback(rollbackDir)
+	require.Error(t, err)
+}
+
+func TestRollbackWithoutPreviousVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rollback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	require.Equal(t, "", GetRollbackVersion(dir))
+	_, err = Rollback(dir)
+	require.Error(t, err)
+}
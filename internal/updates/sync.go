@@ -25,8 +25,7 @@ import (
 	"path/filepath"
 )
 
-func syncFolders(localPath, updatePath string) (err error) {
-	backupDir := filepath.Join(filepath.Dir(updatePath), "backup")
+func syncFolders(localPath, updatePath, backupDir string) (err error) {
 	if err = createBackup(localPath, backupDir); err != nil {
 		return
 	}
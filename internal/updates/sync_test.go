@@ -77,7 +77,7 @@ func checkCopyWorks(srcType, dstType string) error {
 
 	// copy
 	log.Info("Sync from ", srcDir, " to ", destDir)
-	err = syncFolders(destDir, srcDir)
+	err = syncFolders(destDir, srcDir, filepath.Join(filepath.Dir(srcDir), "backup"))
 	if err != nil {
 		return err
 	}
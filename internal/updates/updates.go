@@ -38,9 +38,19 @@ const (
 	sigExtension = ".sig"
 )
 
+// Update channels selectable in settings.
+const (
+	StableChannel = "stable"
+	BetaChannel   = "beta"
+)
+
 var (
-	Host         = "https://protonmail.com" //nolint[gochecknoglobals]
-	DownloadPath = "download"               //nolint[gochecknoglobals]
+	Host             = "https://protonmail.com" //nolint[gochecknoglobals]
+	DownloadPath     = "download"               //nolint[gochecknoglobals]
+	BetaDownloadPath = "download/beta"          //nolint[gochecknoglobals]
+
+	// DefaultChannel is used when no channel is selected in settings.
+	DefaultChannel = StableChannel //nolint[gochecknoglobals]
 
 	// BuildType specifies type of build (e.g. QA or beta).
 	BuildType = "" //nolint[gochecknoglobals]
@@ -69,6 +79,8 @@ type Updates struct {
 	linuxFileBaseName   string       // Prefix of linux package names.
 	macAppBundleName    string       // Name of Mac app file in the bundle for update procedure.
 	cachedNewerVersion  *VersionInfo // To have info about latest version even when the internet connection drops.
+	channel             string       // Channel of the release feed, stable or beta.
+	rollbackDir         string       // Folder keeping the previous version after in-place update.
 }
 
 // NewBridge inits Updates struct for bridge.
@@ -88,6 +100,7 @@ func NewBridge(updateTempDir string) *Updates {
 		updateFileBaseName:  "bridge_upgrade",
 		linuxFileBaseName:   "protonmail-bridge",
 		macAppBundleName:    "ProtonMail Bridge.app",
+		channel:             DefaultChannel,
 	}
 }
 
@@ -108,9 +121,41 @@ func NewImportExport(updateTempDir string) *Updates {
 		updateFileBaseName:  "ie/ie_upgrade",
 		linuxFileBaseName:   "ie/protonmail-import-export-app",
 		macAppBundleName:    "Import-Export app.app",
+		channel:             DefaultChannel,
 	}
 }
 
+// SetChannel selects the release feed used to check for updates. Empty or
+// unknown channel means the default channel of the build.
+func (u *Updates) SetChannel(channel string) {
+	if channel != StableChannel && channel != BetaChannel {
+		channel = DefaultChannel
+	}
+	if channel != u.channel {
+		u.cachedNewerVersion = nil
+	}
+	u.channel = channel
+}
+
+// GetChannel returns the release feed used to check for updates.
+func (u *Updates) GetChannel() string {
+	return u.channel
+}
+
+// SetRollbackDir sets the folder where the previous version is kept after
+// in-place update. Without it, the previous version is removed once the
+// update is applied.
+func (u *Updates) SetRollbackDir(dir string) {
+	u.rollbackDir = dir
+}
+
+func (u *Updates) downloadPath() string {
+	if u.channel == BetaChannel {
+		return BetaDownloadPath
+	}
+	return DownloadPath
+}
+
 func (u *Updates) CreateJSONAndSign(deployDir, goos string) error {
 	versionInfo := u.getLocalVersion(goos)
 	versionInfo.Version = sanitizeVersion(versionInfo.Version)
@@ -187,9 +232,10 @@ func (u *Updates) getLocalVersion(goos string) VersionInfo {
 	if goos == "linux" {
 		pkgName := u.linuxFileBaseName
 		pkgRel := "1"
-		pkgBaseFile := strings.Join([]string{Host, DownloadPath, pkgName}, "/")
+		downloadPath := u.downloadPath()
+		pkgBaseFile := strings.Join([]string{Host, downloadPath, pkgName}, "/")
 
-		pkgBasePath := DownloadPath + "/" + pkgName // add at least one dir
+		pkgBasePath := downloadPath + "/" + pkgName // add at least one dir
 		pkgBasePath = filepath.Dir(pkgBasePath)     // keep only last dir
 		pkgBasePath = Host + "/" + pkgBasePath      // add host in the end to not strip off double slash in URL
 
@@ -240,7 +286,7 @@ func (u *Updates) signatureFileURL(goos string) string {
 }
 
 func (u *Updates) versionFileURL(goos string) string {
-	return strings.Join([]string{Host, DownloadPath, u.versionFileBaseName + "_" + goos + ".json"}, "/")
+	return strings.Join([]string{Host, u.downloadPath(), u.versionFileBaseName + "_" + goos + ".json"}, "/")
 }
 
 func (u *Updates) installerFileURL(goos string) string {
@@ -251,11 +297,11 @@ func (u *Updates) installerFileURL(goos string) string {
 	case "windows": //nolint[goconst]
 		installerFile = u.winInstallerFile
 	}
-	return strings.Join([]string{Host, DownloadPath, installerFile}, "/")
+	return strings.Join([]string{Host, u.downloadPath(), installerFile}, "/")
 }
 
 func (u *Updates) updateFileURL(goos string) string {
-	return strings.Join([]string{Host, DownloadPath, u.updateFileBaseName + "_" + goos + ".tgz"}, "/")
+	return strings.Join([]string{Host, u.downloadPath(), u.updateFileBaseName + "_" + goos + ".tgz"}, "/")
 }
 
 func (u *Updates) StartUpgrade(currentStatus chan<- Progress) { // nolint[funlen]
@@ -328,10 +374,24 @@ func (u *Updates) StartUpgrade(currentStatus chan<- Progress) { // nolint[funlen
 		updatePath := filepath.Join(u.updateTempDir, u.macAppBundleName)
 		log.Warn("localPath ", localPath)
 		log.Warn("updatePath ", updatePath)
-		status.Err = syncFolders(localPath, updatePath)
+		if u.rollbackDir != "" {
+			if status.Err = clearRollback(u.rollbackDir); status.Err != nil {
+				return
+			}
+		}
+		status.Err = syncFolders(localPath, updatePath, u.backupDir())
 		if status.Err != nil {
 			return
 		}
+		if u.rollbackDir != "" {
+			if err := writeRollbackInfo(u.rollbackDir, rollbackInfo{
+				Version:         verInfo.Version,
+				PreviousVersion: u.version,
+				AppPath:         localPath,
+			}); err != nil {
+				log.WithError(err).Warn("Cannot keep previous version for rollback")
+			}
+		}
 		status.UpdateDescription(InfoRestartApp)
 		return
 	default:
@@ -20,6 +20,6 @@
 package updates
 
 func init() {
-	DownloadPath = "download/beta"
+	DefaultChannel = BetaChannel
 	BuildType = "beta"
 }
@@ -22,5 +22,6 @@ package updates
 func init() {
 	Host = "https://bridgeteam.protontech.ch"
 	DownloadPath = "download/qa"
+	BetaDownloadPath = "download/qa"
 	BuildType = "QA"
 }
@@ -66,6 +66,12 @@ func startServer() {
 	http.HandleFunc("/download/current_version_darwin.json.sig", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "./testdata/current_version_linux.json.sig")
 	})
+	http.HandleFunc("/download/beta/current_version_linux.json", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./testdata/current_version_linux.json")
+	})
+	http.HandleFunc("/download/beta/current_version_linux.json.sig", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./testdata/current_version_linux.json.sig")
+	})
 	panic(http.ListenAndServe(":"+testServerPort, nil))
 }
 
@@ -83,6 +89,29 @@ func TestCheckBridgeIsNotUpToDate(t *testing.T) {
 	require.True(t, !isUpToDate, "Bridge should not be up to date")
 }
 
+func TestUpdateChannel(t *testing.T) {
+	updates := newTestUpdates("1.1.5")
+	require.Equal(t, DefaultChannel, updates.GetChannel())
+
+	updates.SetChannel(BetaChannel)
+	require.Equal(t, BetaChannel, updates.GetChannel())
+	require.Equal(t, Host+"/"+BetaDownloadPath+"/current_version_linux.json", updates.versionFileURL("linux"))
+	require.Equal(t, Host+"/"+BetaDownloadPath+"/bridge_upgrade_linux.tgz", updates.updateFileURL("linux"))
+
+	if runtime.GOOS == "linux" {
+		isUpToDate, _, err := updates.CheckIsUpToDate()
+		require.NoError(t, err)
+		require.False(t, isUpToDate, "Bridge should not be up to date")
+	}
+
+	updates.SetChannel(StableChannel)
+	require.Equal(t, Host+"/"+DownloadPath+"/current_version_linux.json", updates.versionFileURL("linux"))
+	require.Nil(t, updates.cachedNewerVersion)
+
+	updates.SetChannel("")
+	require.Equal(t, DefaultChannel, updates.GetChannel())
+}
+
 func TestGetLocalVersion(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("skipping test because local version for windows is currently not supported by tests.")
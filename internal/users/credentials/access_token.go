@@ -0,0 +1,130 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package credentials
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidAccessToken = errors.New("invalid access token")
+	ErrExpiredAccessToken = errors.New("access token expired")
+)
+
+// Purposes of tokens. Token of one purpose cannot be used as another one.
+const (
+	accessTokenPurpose  = "access-token"
+	refreshTokenPurpose = "refresh-token"
+)
+
+// GenerateAccessToken returns a token which can be used instead of the bridge
+// password until it expires. Token is signed by the bridge password, so all
+// tokens are revoked when the password changes, e.g. after logout.
+func (s *Credentials) GenerateAccessToken(expires time.Time) string {
+	return s.generateToken(accessTokenPurpose, expires)
+}
+
+// CheckAccessToken returns error when the token was not generated for these
+// credentials or it is expired.
+func (s *Credentials) CheckAccessToken(token string, now time.Time) error {
+	return s.checkToken(accessTokenPurpose, token, now)
+}
+
+// GenerateRefreshToken returns a long-lived token which can be exchanged for
+// new access tokens by OAuth clients. Token contains the user ID so it can
+// be checked without trying all accounts. Besides the bridge password, it
+// is signed by the refresh token nonce, so it is revoked when the nonce
+// changes, i.e. when the token is refreshed or the user logs out.
+func (s *Credentials) GenerateRefreshToken(expires time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s.UserID)) + "." +
+		s.generateToken(refreshTokenPurpose+sep+s.RefreshTokenNonce, expires)
+}
+
+// CheckRefreshToken returns error when the refresh token was not generated
+// for these credentials, it was revoked or it is expired.
+func (s *Credentials) CheckRefreshToken(token string, now time.Time) error {
+	if s.RefreshTokenNonce == "" {
+		return ErrInvalidAccessToken
+	}
+
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return ErrInvalidAccessToken
+	}
+
+	if userID, err := GetRefreshTokenUserID(token); err != nil || userID != s.UserID {
+		return ErrInvalidAccessToken
+	}
+
+	return s.checkToken(refreshTokenPurpose+sep+s.RefreshTokenNonce, parts[1], now)
+}
+
+// GetRefreshTokenUserID returns the ID of the user to whom the refresh
+// token was issued. The token still has to be checked by CheckRefreshToken.
+func GetRefreshTokenUserID(token string) (string, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return "", ErrInvalidAccessToken
+	}
+
+	userID, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(userID) == 0 {
+		return "", ErrInvalidAccessToken
+	}
+
+	return string(userID), nil
+}
+
+func (s *Credentials) generateToken(purpose string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return expiry + "." + s.signToken(purpose, expiry)
+}
+
+func (s *Credentials) checkToken(purpose, token string, now time.Time) error {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return ErrInvalidAccessToken
+	}
+
+	if !hmac.Equal([]byte(parts[1]), []byte(s.signToken(purpose, parts[0]))) {
+		log.WithField("userID", s.UserID).Debug("Incorrect access token")
+		return ErrInvalidAccessToken
+	}
+
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return ErrInvalidAccessToken
+	}
+	if now.After(time.Unix(expiry, 0)) {
+		return ErrExpiredAccessToken
+	}
+	return nil
+}
+
+func (s *Credentials) signToken(purpose, expiry string) string {
+	mac := hmac.New(sha256.New, []byte(s.BridgePassword))
+	_, _ = mac.Write([]byte(purpose + sep + s.UserID + sep + expiry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
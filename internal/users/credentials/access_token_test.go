@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package credentials
+
+import (
+	"testing"
+	"time"
+
+	r "github.com/stretchr/testify/require"
+)
+
+func TestAccessToken(t *testing.T) {
+	now := time.Now()
+	creds := &Credentials{UserID: "1", BridgePassword: "bridge pass"}
+
+	token := creds.GenerateAccessToken(now.Add(time.Hour))
+	r.NoError(t, creds.CheckAccessToken(token, now))
+	r.Equal(t, ErrExpiredAccessToken, creds.CheckAccessToken(token, now.Add(2*time.Hour)))
+
+	// Token cannot be used for another account or after password change.
+	other := &Credentials{UserID: "2", BridgePassword: "bridge pass"}
+	r.Equal(t, ErrInvalidAccessToken, other.CheckAccessToken(token, now))
+	changed := &Credentials{UserID: "1", BridgePassword: "new pass"}
+	r.Equal(t, ErrInvalidAccessToken, changed.CheckAccessToken(token, now))
+
+	// Expiry cannot be changed.
+	forged := "9" + token
+	r.Equal(t, ErrInvalidAccessToken, creds.CheckAccessToken(forged, now))
+	r.Equal(t, ErrInvalidAccessToken, creds.CheckAccessToken("garbage", now))
+}
+
+func TestRefreshToken(t *testing.T) {
+	now := time.Now()
+	creds := &Credentials{UserID: "user/1==", BridgePassword: "bridge pass", RefreshTokenNonce: "nonce"}
+
+	refresh := creds.GenerateRefreshToken(now.Add(time.Hour))
+	r.NoError(t, creds.CheckRefreshToken(refresh, now))
+	r.Equal(t, ErrExpiredAccessToken, creds.CheckRefreshToken(refresh, now.Add(2*time.Hour)))
+
+	userID, err := GetRefreshTokenUserID(refresh)
+	r.NoError(t, err)
+	r.Equal(t, "user/1==", userID)
+	_, err = GetRefreshTokenUserID("garbage")
+	r.Error(t, err)
+
+	// Token is revoked by rotation of the nonce and by logout.
+	rotated := &Credentials{UserID: "user/1==", BridgePassword: "bridge pass", RefreshTokenNonce: "other"}
+	r.Equal(t, ErrInvalidAccessToken, rotated.CheckRefreshToken(refresh, now))
+	creds.Logout()
+	r.Equal(t, ErrInvalidAccessToken, creds.CheckRefreshToken(refresh, now))
+	creds.RefreshTokenNonce = "nonce"
+
+	// Token cannot be used for another account with the same secrets.
+	other := &Credentials{UserID: "2", BridgePassword: "bridge pass", RefreshTokenNonce: "nonce"}
+	r.Equal(t, ErrInvalidAccessToken, other.CheckRefreshToken(refresh, now))
+
+	// Refresh token cannot be used as access token and vice versa.
+	r.Equal(t, ErrInvalidAccessToken, creds.CheckAccessToken(refresh, now))
+	r.Equal(t, ErrInvalidAccessToken, creds.CheckRefreshToken(creds.GenerateAccessToken(now.Add(time.Hour)), now))
+}
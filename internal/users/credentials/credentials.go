@@ -21,10 +21,13 @@
 package credentials
 
 import (
+	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -33,8 +36,13 @@ import (
 const (
 	sep = "\x00"
 
-	itemLengthBridge       = 9
-	itemLengthImportExport = 6 // Old format for Import-Export.
+	itemLengthBridge          = 11
+	itemLengthBridgeNoRefresh = 10 // Old format without refresh token nonce.
+	itemLengthBridgeOld       = 9  // Old format without cache key.
+	itemLengthImportExport    = 6  // Old format for Import-Export.
+
+	cacheKeySize          = 32
+	refreshTokenNonceSize = 16
 )
 
 var (
@@ -50,7 +58,9 @@ type Credentials struct {
 	APIToken,
 	MailboxPassword,
 	BridgePassword,
-	Version string
+	Version,
+	CacheKey, // Hex encoded key of local caches.
+	RefreshTokenNonce string // Changed to revoke all refresh tokens.
 	Timestamp int64
 	IsHidden, // Deprecated.
 	IsCombinedAddressMode bool
@@ -58,15 +68,17 @@ type Credentials struct {
 
 func (s *Credentials) Marshal() string {
 	items := []string{
-		s.Name,            // 0
-		s.Emails,          // 1
-		s.APIToken,        // 2
-		s.MailboxPassword, // 3
-		s.BridgePassword,  // 4
-		s.Version,         // 5
-		"",                // 6
-		"",                // 7
-		"",                // 8
+		s.Name,              // 0
+		s.Emails,            // 1
+		s.APIToken,          // 2
+		s.MailboxPassword,   // 3
+		s.BridgePassword,    // 4
+		s.Version,           // 5
+		"",                  // 6
+		"",                  // 7
+		"",                  // 8
+		s.CacheKey,          // 9
+		s.RefreshTokenNonce, // 10
 	}
 
 	items[6] = fmt.Sprint(s.Timestamp)
@@ -90,7 +102,7 @@ func (s *Credentials) Unmarshal(secret string) error {
 	}
 	items := strings.Split(string(b), sep)
 
-	if len(items) != itemLengthBridge && len(items) != itemLengthImportExport {
+	if len(items) != itemLengthBridge && len(items) != itemLengthBridgeNoRefresh && len(items) != itemLengthBridgeOld && len(items) != itemLengthImportExport {
 		return ErrWrongFormat
 	}
 
@@ -100,7 +112,7 @@ func (s *Credentials) Unmarshal(secret string) error {
 	s.MailboxPassword = items[3]
 
 	switch len(items) {
-	case itemLengthBridge:
+	case itemLengthBridge, itemLengthBridgeNoRefresh, itemLengthBridgeOld:
 		s.BridgePassword = items[4]
 		s.Version = items[5]
 		if _, err = fmt.Sscan(items[6], &s.Timestamp); err != nil {
@@ -112,6 +124,12 @@ func (s *Credentials) Unmarshal(secret string) error {
 		if s.IsCombinedAddressMode = false; items[8] == "1" {
 			s.IsCombinedAddressMode = true
 		}
+		if len(items) >= itemLengthBridgeNoRefresh {
+			s.CacheKey = items[9]
+		}
+		if len(items) == itemLengthBridge {
+			s.RefreshTokenNonce = items[10]
+		}
 
 	case itemLengthImportExport:
 		s.Version = items[4]
@@ -122,6 +140,15 @@ func (s *Credentials) Unmarshal(secret string) error {
 	return nil
 }
 
+// GetCacheKey returns the key encrypting local caches of the user.
+func (s *Credentials) GetCacheKey() ([]byte, error) {
+	key, err := hex.DecodeString(s.CacheKey)
+	if err != nil || len(key) != cacheKeySize {
+		return nil, errors.New("malformed cache key")
+	}
+	return key, nil
+}
+
 func (s *Credentials) SetEmailList(list []string) {
 	s.Emails = strings.Join(list, ";")
 }
@@ -141,11 +168,31 @@ func (s *Credentials) CheckPassword(password string) error {
 	return nil
 }
 
+// Logout forgets the session and revokes refresh tokens of OAuth clients.
 func (s *Credentials) Logout() {
 	s.APIToken = ""
 	s.MailboxPassword = ""
+	s.RefreshTokenNonce = ""
 }
 
 func (s *Credentials) IsConnected() bool {
 	return s.APIToken != "" && s.MailboxPassword != ""
 }
+
+// generateCacheKey returns a new hex encoded key of local caches.
+func generateCacheKey() string {
+	key := make([]byte, cacheKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(key)
+}
+
+// generateRefreshTokenNonce returns a new hex encoded nonce of refresh tokens.
+func generateRefreshTokenNonce() string {
+	nonce := make([]byte, refreshTokenNonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(nonce)
+}
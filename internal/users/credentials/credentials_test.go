@@ -35,6 +35,8 @@ var wantCredentials = Credentials{
 	MailboxPassword:       "mailbox pass",
 	BridgePassword:        "bridge pass",
 	Version:               "k11",
+	CacheKey:              strings.Repeat("ab", cacheKeySize),
+	RefreshTokenNonce:     strings.Repeat("cd", refreshTokenNonceSize),
 	Timestamp:             time.Now().Unix(),
 	IsHidden:              false,
 	IsCombinedAddressMode: false,
@@ -47,6 +49,65 @@ func TestUnmarshallBridge(t *testing.T) {
 	r.Equal(t, wantCredentials, haveCredentials)
 }
 
+func TestUnmarshallBridgeWithoutCacheKey(t *testing.T) {
+	items := []string{
+		wantCredentials.Name,
+		wantCredentials.Emails,
+		wantCredentials.APIToken,
+		wantCredentials.MailboxPassword,
+		wantCredentials.BridgePassword,
+		wantCredentials.Version,
+		fmt.Sprint(wantCredentials.Timestamp),
+		"",
+		"",
+	}
+
+	str := strings.Join(items, sep)
+	encoded := base64.StdEncoding.EncodeToString([]byte(str))
+
+	haveCredentials := Credentials{UserID: "1"}
+	r.NoError(t, haveCredentials.Unmarshal(encoded))
+	r.Equal(t, "", haveCredentials.CacheKey)
+
+	haveCredentials.CacheKey = wantCredentials.CacheKey
+	haveCredentials.RefreshTokenNonce = wantCredentials.RefreshTokenNonce
+	r.Equal(t, wantCredentials, haveCredentials)
+}
+
+func TestUnmarshallBridgeWithoutRefreshTokenNonce(t *testing.T) {
+	items := []string{
+		wantCredentials.Name,
+		wantCredentials.Emails,
+		wantCredentials.APIToken,
+		wantCredentials.MailboxPassword,
+		wantCredentials.BridgePassword,
+		wantCredentials.Version,
+		fmt.Sprint(wantCredentials.Timestamp),
+		"",
+		"",
+		wantCredentials.CacheKey,
+	}
+
+	str := strings.Join(items, sep)
+	encoded := base64.StdEncoding.EncodeToString([]byte(str))
+
+	haveCredentials := Credentials{UserID: "1"}
+	r.NoError(t, haveCredentials.Unmarshal(encoded))
+	r.Equal(t, "", haveCredentials.RefreshTokenNonce)
+
+	haveCredentials.RefreshTokenNonce = wantCredentials.RefreshTokenNonce
+	r.Equal(t, wantCredentials, haveCredentials)
+}
+
+func TestGetCacheKey(t *testing.T) {
+	key, err := wantCredentials.GetCacheKey()
+	r.NoError(t, err)
+	r.Len(t, key, cacheKeySize)
+
+	_, err = (&Credentials{}).GetCacheKey()
+	r.Error(t, err)
+}
+
 func TestUnmarshallImportExport(t *testing.T) {
 	items := []string{
 		wantCredentials.Name,
@@ -62,6 +123,8 @@ func TestUnmarshallImportExport(t *testing.T) {
 
 	haveCredentials := Credentials{UserID: "1"}
 	haveCredentials.BridgePassword = wantCredentials.BridgePassword // This one is not used.
+	haveCredentials.CacheKey = wantCredentials.CacheKey             // This one is not used.
+	haveCredentials.RefreshTokenNonce = wantCredentials.RefreshTokenNonce
 	r.NoError(t, haveCredentials.Unmarshal(encoded))
 	r.Equal(t, wantCredentials, haveCredentials)
 }
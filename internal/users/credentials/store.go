@@ -31,13 +31,19 @@ var storeLocker = sync.RWMutex{} //nolint[gochecknoglobals]
 
 // Store is an encrypted credentials store.
 type Store struct {
-	secrets *keychain.Access
+	appName string
+
+	secrets     *keychain.Access
+	secretsLock sync.Mutex
 }
 
-// NewStore creates a new encrypted credentials store.
+// NewStore creates a new encrypted credentials store. When the keychain is
+// not available, the error is returned together with the store which tries
+// to access the keychain again on every use, e.g. until it is unlocked.
 func NewStore(appName string) (*Store, error) {
 	secrets, err := keychain.NewAccess(appName)
 	return &Store{
+		appName: appName,
 		secrets: secrets,
 	}, err
 }
@@ -52,10 +58,6 @@ func (s *Store) Add(userID, userName, apiToken, mailboxPassword string, emails [
 		"emails":   emails,
 	}).Trace("Adding new credentials")
 
-	if err = s.checkKeychain(); err != nil {
-		return
-	}
-
 	creds = &Credentials{
 		UserID:          userID,
 		Name:            userName,
@@ -72,6 +74,7 @@ func (s *Store) Add(userID, userName, apiToken, mailboxPassword string, emails [
 		creds.BridgePassword = currentCredentials.BridgePassword
 		creds.IsCombinedAddressMode = currentCredentials.IsCombinedAddressMode
 		creds.Timestamp = currentCredentials.Timestamp
+		creds.CacheKey = currentCredentials.CacheKey
 	} else {
 		log.Info("Generating credentials for new user")
 		creds.BridgePassword = generatePassword()
@@ -79,6 +82,10 @@ func (s *Store) Add(userID, userName, apiToken, mailboxPassword string, emails [
 		creds.Timestamp = time.Now().Unix()
 	}
 
+	if creds.CacheKey == "" {
+		creds.CacheKey = generateCacheKey()
+	}
+
 	if err = s.saveCredentials(creds); err != nil {
 		return
 	}
@@ -143,6 +150,48 @@ func (s *Store) UpdateToken(userID, apiToken string) error {
 	return s.saveCredentials(credentials)
 }
 
+// GetCacheKey returns the key encrypting local caches of the user. The key is
+// generated when the credentials do not have one yet, e.g. they were saved
+// by an older version. Logout keeps the key so the caches can be used after
+// the next login.
+func (s *Store) GetCacheKey(userID string) ([]byte, error) {
+	storeLocker.Lock()
+	defer storeLocker.Unlock()
+
+	credentials, err := s.get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if credentials.CacheKey == "" {
+		credentials.CacheKey = generateCacheKey()
+		if err := s.saveCredentials(credentials); err != nil {
+			return nil, err
+		}
+	}
+
+	return credentials.GetCacheKey()
+}
+
+// RotateRefreshTokenNonce sets a new nonce of refresh tokens, which revokes
+// all refresh tokens issued before, and returns the updated credentials.
+func (s *Store) RotateRefreshTokenNonce(userID string) (*Credentials, error) {
+	storeLocker.Lock()
+	defer storeLocker.Unlock()
+
+	credentials, err := s.get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials.RefreshTokenNonce = generateRefreshTokenNonce()
+	if err := s.saveCredentials(credentials); err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
 func (s *Store) Logout(userID string) error {
 	storeLocker.Lock()
 	defer storeLocker.Unlock()
@@ -164,12 +213,13 @@ func (s *Store) List() (userIDs []string, err error) {
 
 	log.Trace("Listing credentials in credentials store")
 
-	if err = s.checkKeychain(); err != nil {
+	secrets, err := s.getSecrets()
+	if err != nil {
 		return
 	}
 
 	var allUserIDs []string
-	if allUserIDs, err = s.secrets.List(); err != nil {
+	if allUserIDs, err = secrets.List(); err != nil {
 		log.WithError(err).Error("Could not list credentials")
 		return
 	}
@@ -242,11 +292,12 @@ func (s *Store) Get(userID string) (creds *Credentials, err error) {
 func (s *Store) get(userID string) (creds *Credentials, err error) {
 	log := log.WithField("user", userID)
 
-	if err = s.checkKeychain(); err != nil {
+	secrets, err := s.getSecrets()
+	if err != nil {
 		return
 	}
 
-	secret, err := s.secrets.Get(userID)
+	secret, err := secrets.Get(userID)
 	if err != nil {
 		log.WithError(err).Error("Could not get credentials from native keychain")
 		return
@@ -255,7 +306,7 @@ func (s *Store) get(userID string) (creds *Credentials, err error) {
 	credentials := &Credentials{UserID: userID}
 	if err = credentials.Unmarshal(secret); err != nil {
 		err = fmt.Errorf("backend/credentials: malformed secret: %v", err)
-		_ = s.secrets.Delete(userID)
+		_ = secrets.Delete(userID)
 		log.WithError(err).Error("Could not unmarshal secret")
 		return
 	}
@@ -265,22 +316,35 @@ func (s *Store) get(userID string) (creds *Credentials, err error) {
 
 // saveCredentials encrypts and saves password to the keychain store.
 func (s *Store) saveCredentials(credentials *Credentials) (err error) {
-	if err = s.checkKeychain(); err != nil {
+	secrets, err := s.getSecrets()
+	if err != nil {
 		return
 	}
 
 	credentials.Version = keychain.KeychainVersion
 
-	return s.secrets.Put(credentials.UserID, credentials.Marshal())
+	return secrets.Put(credentials.UserID, credentials.Marshal())
 }
 
-func (s *Store) checkKeychain() (err error) {
-	if s.secrets == nil {
-		err = keychain.ErrNoKeychainInstalled
+// getSecrets returns access to the keychain. When the keychain was not
+// available before, it is tried again.
+func (s *Store) getSecrets() (*keychain.Access, error) {
+	s.secretsLock.Lock()
+	defer s.secretsLock.Unlock()
+
+	if s.secrets != nil {
+		return s.secrets, nil
+	}
+
+	secrets, err := keychain.NewAccess(s.appName)
+	if err != nil {
 		log.WithError(err).Error("Store is unusable")
+		return nil, err
 	}
 
-	return
+	log.Info("Keychain is available")
+	s.secrets = secrets
+	return secrets, nil
 }
 
 // Delete removes credentials from the store.
@@ -288,9 +352,10 @@ func (s *Store) Delete(userID string) (err error) {
 	storeLocker.Lock()
 	defer storeLocker.Unlock()
 
-	if err = s.checkKeychain(); err != nil {
+	secrets, err := s.getSecrets()
+	if err != nil {
 		return
 	}
 
-	return s.secrets.Delete(userID)
+	return secrets.Delete(userID)
 }
@@ -147,6 +147,30 @@ func (mr *MockClientManagerMockRecorder) AllowProxy() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AllowProxy", reflect.TypeOf((*MockClientManager)(nil).AllowProxy))
 }
 
+// SetAPIHost mocks base method
+func (m *MockClientManager) SetAPIHost(arg0 string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetAPIHost", arg0)
+}
+
+// SetAPIHost indicates an expected call of SetAPIHost
+func (mr *MockClientManagerMockRecorder) SetAPIHost(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAPIHost", reflect.TypeOf((*MockClientManager)(nil).SetAPIHost), arg0)
+}
+
+// SetDoHProviders mocks base method
+func (m *MockClientManager) SetDoHProviders(arg0 []string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetDoHProviders", arg0)
+}
+
+// SetDoHProviders indicates an expected call of SetDoHProviders
+func (mr *MockClientManagerMockRecorder) SetDoHProviders(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDoHProviders", reflect.TypeOf((*MockClientManager)(nil).SetDoHProviders), arg0)
+}
+
 // CheckConnection mocks base method
 func (m *MockClientManager) CheckConnection() error {
 	m.ctrl.T.Helper()
@@ -173,6 +197,20 @@ func (mr *MockClientManagerMockRecorder) DisallowProxy() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisallowProxy", reflect.TypeOf((*MockClientManager)(nil).DisallowProxy))
 }
 
+// GetAPIStatus mocks base method
+func (m *MockClientManager) GetAPIStatus() pmapi.APIStatus {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIStatus")
+	ret0, _ := ret[0].(pmapi.APIStatus)
+	return ret0
+}
+
+// GetAPIStatus indicates an expected call of GetAPIStatus
+func (mr *MockClientManagerMockRecorder) GetAPIStatus() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIStatus", reflect.TypeOf((*MockClientManager)(nil).GetAPIStatus))
+}
+
 // GetAnonymousClient mocks base method
 func (m *MockClientManager) GetAnonymousClient() pmapi.Client {
 	m.ctrl.T.Helper()
@@ -215,6 +253,20 @@ func (mr *MockClientManagerMockRecorder) GetClient(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClient", reflect.TypeOf((*MockClientManager)(nil).GetClient), arg0)
 }
 
+// GetRetryMetrics mocks base method
+func (m *MockClientManager) GetRetryMetrics() pmapi.RetryMetrics {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRetryMetrics")
+	ret0, _ := ret[0].(pmapi.RetryMetrics)
+	return ret0
+}
+
+// GetRetryMetrics indicates an expected call of GetRetryMetrics
+func (mr *MockClientManagerMockRecorder) GetRetryMetrics() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRetryMetrics", reflect.TypeOf((*MockClientManager)(nil).GetRetryMetrics))
+}
+
 // SetUserAgent mocks base method
 func (m *MockClientManager) SetUserAgent(arg0, arg1, arg2 string) {
 	m.ctrl.T.Helper()
@@ -294,6 +346,21 @@ func (mr *MockCredentialsStorerMockRecorder) Get(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCredentialsStorer)(nil).Get), arg0)
 }
 
+// GetCacheKey mocks base method
+func (m *MockCredentialsStorer) GetCacheKey(arg0 string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCacheKey", arg0)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCacheKey indicates an expected call of GetCacheKey
+func (mr *MockCredentialsStorerMockRecorder) GetCacheKey(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCacheKey", reflect.TypeOf((*MockCredentialsStorer)(nil).GetCacheKey), arg0)
+}
+
 // List mocks base method
 func (m *MockCredentialsStorer) List() ([]string, error) {
 	m.ctrl.T.Helper()
@@ -323,6 +390,21 @@ func (mr *MockCredentialsStorerMockRecorder) Logout(arg0 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logout", reflect.TypeOf((*MockCredentialsStorer)(nil).Logout), arg0)
 }
 
+// RotateRefreshTokenNonce mocks base method
+func (m *MockCredentialsStorer) RotateRefreshTokenNonce(arg0 string) (*credentials.Credentials, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateRefreshTokenNonce", arg0)
+	ret0, _ := ret[0].(*credentials.Credentials)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateRefreshTokenNonce indicates an expected call of RotateRefreshTokenNonce
+func (mr *MockCredentialsStorerMockRecorder) RotateRefreshTokenNonce(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateRefreshTokenNonce", reflect.TypeOf((*MockCredentialsStorer)(nil).RotateRefreshTokenNonce), arg0)
+}
+
 // SwitchAddressMode mocks base method
 func (m *MockCredentialsStorer) SwitchAddressMode(arg0 string) error {
 	m.ctrl.T.Helper()
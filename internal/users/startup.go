@@ -0,0 +1,280 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package users
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/events"
+)
+
+// States of accounts loaded in background at startup.
+const (
+	StartupWaiting = "waiting"
+	StartupLoading = "loading"
+	StartupReady   = "ready"
+	StartupFailed  = "failed"
+)
+
+var (
+	startupConcurrency     = 0              //nolint[gochecknoglobals]
+	startupConcurrencyLock = sync.RWMutex{} //nolint[gochecknoglobals]
+)
+
+// SetStartupConcurrency sets how many accounts are loaded at once at
+// startup. Loading includes unlocking of keys and initial fetch of the
+// store. Zero loads accounts one by one before New returns; otherwise
+// accounts are loaded in background and each is served as soon as it is
+// ready, so accounts listed later do not wait for the previous ones.
+func SetStartupConcurrency(concurrency int) {
+	startupConcurrencyLock.Lock()
+	defer startupConcurrencyLock.Unlock()
+
+	startupConcurrency = concurrency
+}
+
+func getStartupConcurrency() int {
+	startupConcurrencyLock.RLock()
+	defer startupConcurrencyLock.RUnlock()
+
+	return startupConcurrency
+}
+
+// StartupProgress describes loading of one account at startup.
+type StartupProgress struct {
+	UserID   string
+	Username string
+	State    string
+	Error    string
+
+	// Duration is how long the loading took or takes so far.
+	Duration time.Duration
+
+	startedAt time.Time
+}
+
+// GetStartupProgress returns the state of accounts loaded in background in
+// the order of the credentials store. It is empty when accounts were loaded
+// before the app started.
+func (u *Users) GetStartupProgress() []StartupProgress {
+	u.startupLock.RLock()
+	defer u.startupLock.RUnlock()
+
+	progress := make([]StartupProgress, 0, len(u.startup))
+	for _, p := range u.startup {
+		item := *p
+		if item.State == StartupLoading {
+			item.Duration = time.Since(item.startedAt)
+		}
+		progress = append(progress, item)
+	}
+
+	return progress
+}
+
+// IsStarting returns whether some accounts are still being loaded.
+func (u *Users) IsStarting() bool {
+	for _, progress := range u.GetStartupProgress() {
+		if progress.State == StartupWaiting || progress.State == StartupLoading {
+			return true
+		}
+	}
+	return false
+}
+
+// startLoadingUsers lists accounts and loads them in background with the
+// given concurrency. Accounts whose credentials cannot be read are loaded
+// later by watchKeychain.
+func (u *Users) startLoadingUsers(concurrency int) error {
+	userIDs, err := u.credStorer.List()
+	if err != nil {
+		return err
+	}
+
+	u.startupLock.Lock()
+	u.startup = make([]*StartupProgress, 0, len(userIDs))
+	u.loadingUsers = map[string]*User{}
+	for _, userID := range userIDs {
+		u.startup = append(u.startup, &StartupProgress{UserID: userID, State: StartupWaiting})
+	}
+	u.startupLock.Unlock()
+
+	go func() {
+		defer u.panicHandler.HandlePanic()
+		u.loadUsersConcurrently(userIDs, concurrency)
+	}()
+
+	return nil
+}
+
+func (u *Users) loadUsersConcurrently(userIDs []string, concurrency int) {
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, concurrency)
+
+	failedLock := sync.Mutex{}
+	failed := false
+
+	for _, userID := range userIDs {
+		slots <- struct{}{}
+		wg.Add(1)
+
+		go func(userID string) {
+			defer u.panicHandler.HandlePanic()
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			if err := u.loadUser(userID, userIDs); err != nil {
+				failedLock.Lock()
+				failed = true
+				failedLock.Unlock()
+			}
+		}(userID)
+	}
+
+	wg.Wait()
+
+	if !failed {
+		log.Info("All users were loaded")
+		return
+	}
+
+	log.Warn("Could not load all users, waiting for keychain")
+	u.setWaitingForKeychain(true)
+	u.watchKeychain()
+}
+
+// loadUser loads and initialises one user and adds it to the users in the
+// order of the credentials store. Error is returned only when credentials
+// cannot be read; user which cannot be initialised is added as before.
+func (u *Users) loadUser(userID string, order []string) error {
+	l := log.WithField("user", userID)
+
+	u.updateStartupProgress(userID, StartupLoading, "", nil)
+
+	user, err := newUser(u.panicHandler, userID, u.events, u.credStorer, u.clientManager, u.storeFactory)
+	if err != nil {
+		l.WithError(err).Warn("Could not load user, skipping")
+		u.updateStartupProgress(userID, StartupFailed, "", err)
+		return err
+	}
+
+	// Auths refreshed during init have to reach the user.
+	u.startupLock.Lock()
+	u.loadingUsers[userID] = user
+	u.startupLock.Unlock()
+
+	initErr := user.init(u.idleUpdates)
+	if initErr != nil {
+		l.WithError(initErr).Warn("Could not initialise user")
+	}
+
+	if !u.insertUser(user, order) {
+		l.Info("User was added while loading, dropping loaded instance")
+		if err := user.closeStore(); err != nil {
+			l.WithError(err).Warn("Could not close store of dropped user")
+		}
+	}
+
+	u.startupLock.Lock()
+	delete(u.loadingUsers, userID)
+	u.startupLock.Unlock()
+
+	if initErr != nil {
+		u.updateStartupProgress(userID, StartupFailed, user.Username(), initErr)
+	} else {
+		u.updateStartupProgress(userID, StartupReady, user.Username(), nil)
+	}
+
+	u.events.Emit(events.UserRefreshEvent, userID)
+
+	return nil
+}
+
+// insertUser adds the user to the position given by order. Users not in
+// order, e.g. added by login during startup, stay at the end. It returns
+// false if the user is present already.
+func (u *Users) insertUser(user *User, order []string) bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if _, ok := u.hasUser(user.ID()); ok {
+		return false
+	}
+
+	position := func(userID string) int {
+		for i, id := range order {
+			if id == userID {
+				return i
+			}
+		}
+		return len(order)
+	}
+
+	idx := len(u.users)
+	for i, other := range u.users {
+		if position(other.ID()) > position(user.ID()) {
+			idx = i
+			break
+		}
+	}
+
+	u.users = append(u.users, nil)
+	copy(u.users[idx+1:], u.users[idx:])
+	u.users[idx] = user
+
+	return true
+}
+
+func (u *Users) updateStartupProgress(userID, state, username string, err error) {
+	u.startupLock.Lock()
+	defer u.startupLock.Unlock()
+
+	for _, progress := range u.startup {
+		if progress.UserID != userID {
+			continue
+		}
+
+		progress.State = state
+		if username != "" {
+			progress.Username = username
+		}
+		if err != nil {
+			progress.Error = err.Error()
+		} else {
+			progress.Error = ""
+		}
+
+		if state == StartupLoading {
+			progress.startedAt = time.Now()
+		} else {
+			progress.Duration = time.Since(progress.startedAt)
+		}
+	}
+}
+
+// getLoadingUser returns user which is being loaded in background.
+func (u *Users) getLoadingUser(userID string) (*User, bool) {
+	u.startupLock.RLock()
+	defer u.startupLock.RUnlock()
+
+	user, ok := u.loadingUsers[userID]
+	return user, ok
+}
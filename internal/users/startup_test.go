@@ -0,0 +1,112 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package users
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/users/credentials"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUsersConcurrentStartup(t *testing.T) {
+	m := initMocks(t)
+	defer m.ctrl.Finish()
+
+	SetStartupConcurrency(2)
+	defer SetStartupConcurrency(0)
+
+	m.clientManager.EXPECT().GetClient(gomock.Any()).Return(m.pmapiClient).AnyTimes()
+	m.credentialsStore.EXPECT().List().Return([]string{"slow", "fast"}, nil)
+
+	// The first account is loaded slowly so the second one is ready first.
+	m.credentialsStore.EXPECT().Get("slow").DoAndReturn(func(string) (*credentials.Credentials, error) {
+		time.Sleep(200 * time.Millisecond)
+		return testCredentialsDisconnected, nil
+	})
+	m.credentialsStore.EXPECT().Get("slow").Return(testCredentialsDisconnected, nil)
+	m.credentialsStore.EXPECT().Get("fast").Return(testCredentialsDisconnected, nil).Times(2)
+
+	m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return(nil, errors.New("ErrUnauthorized")).Times(2)
+	m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress}).Times(2)
+
+	fastReady := make(chan struct{})
+	m.eventListener.EXPECT().Emit(events.UserRefreshEvent, "fast").Do(func(string, string) { close(fastReady) })
+	m.eventListener.EXPECT().Emit(events.UserRefreshEvent, "slow")
+
+	users := testNewUsers(t, m)
+	defer cleanUpUsersData(users)
+
+	<-fastReady
+	progress := users.GetStartupProgress()
+	require.Len(t, progress, 2)
+	require.Equal(t, "slow", progress[0].UserID)
+	require.Equal(t, StartupLoading, progress[0].State)
+	require.Equal(t, StartupReady, progress[1].State)
+	require.Equal(t, "username", progress[1].Username)
+	require.True(t, users.IsStarting())
+	require.Equal(t, 1, len(users.GetUsers()))
+
+	assert.Eventually(t, func() bool { return !users.IsStarting() }, time.Second, 10*time.Millisecond)
+
+	// Order of the credentials store is kept.
+	require.Equal(t, 2, len(users.GetUsers()))
+	require.Equal(t, "slow", users.GetUsers()[0].ID())
+	require.Equal(t, "fast", users.GetUsers()[1].ID())
+	require.Equal(t, StartupReady, users.GetStartupProgress()[0].State)
+}
+
+func TestNewUsersConcurrentStartupLockedKeychain(t *testing.T) {
+	m := initMocks(t)
+	defer m.ctrl.Finish()
+
+	SetStartupConcurrency(2)
+	defer SetStartupConcurrency(0)
+
+	defer func(minDelay, maxDelay time.Duration) {
+		keychainRetryMinDelay, keychainRetryMaxDelay = minDelay, maxDelay
+	}(keychainRetryMinDelay, keychainRetryMaxDelay)
+	keychainRetryMinDelay, keychainRetryMaxDelay = 10*time.Millisecond, 20*time.Millisecond
+
+	m.clientManager.EXPECT().GetClient("user").Return(m.pmapiClient).MinTimes(1)
+
+	gomock.InOrder(
+		m.credentialsStore.EXPECT().List().Return([]string{"user"}, nil),
+		m.credentialsStore.EXPECT().Get("user").Return(nil, errors.New("keychain is locked")),
+		m.credentialsStore.EXPECT().List().Return([]string{"user"}, nil),
+		m.credentialsStore.EXPECT().Get("user").Return(testCredentialsDisconnected, nil),
+		m.credentialsStore.EXPECT().Get("user").Return(testCredentialsDisconnected, nil),
+		m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return(nil, errors.New("ErrUnauthorized")),
+		m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress}),
+		m.eventListener.EXPECT().Emit(events.UserRefreshEvent, "user"),
+	)
+
+	users := testNewUsers(t, m)
+	defer cleanUpUsersData(users)
+	defer users.StopWatchers()
+
+	assert.Eventually(t, func() bool { return len(users.GetUsers()) == 1 }, time.Second, 10*time.Millisecond)
+	require.False(t, users.IsWaitingForKeychain())
+	require.Equal(t, StartupReady, users.GetStartupProgress()[0].State)
+}
@@ -41,6 +41,8 @@ type CredentialsStorer interface {
 	UpdateEmails(userID string, emails []string) error
 	UpdatePassword(userID, password string) error
 	UpdateToken(userID, apiToken string) error
+	GetCacheKey(userID string) ([]byte, error)
+	RotateRefreshTokenNonce(userID string) (*credentials.Credentials, error)
 	Logout(userID string) error
 	Delete(userID string) error
 }
@@ -50,9 +52,13 @@ type ClientManager interface {
 	GetAnonymousClient() pmapi.Client
 	AllowProxy()
 	DisallowProxy()
+	SetDoHProviders(providers []string)
+	SetAPIHost(host string)
 	GetAuthUpdateChannel() chan pmapi.ClientAuth
 	CheckConnection() error
 	SetUserAgent(clientName, clientVersion, os string)
+	GetRetryMetrics() pmapi.RetryMetrics
+	GetAPIStatus() pmapi.APIStatus
 }
 
 type StoreMaker interface {
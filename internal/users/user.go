@@ -18,20 +18,33 @@
 package users
 
 import (
+	"context"
+	"io"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/internal/store/search"
 	"github.com/ProtonMail/proton-bridge/internal/users/credentials"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	imapBackend "github.com/emersion/go-imap/backend"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// AccessTokenLifetime is the time after which access tokens expire.
+const AccessTokenLifetime = time.Hour
+
+// RefreshTokenLifetime is the time after which refresh tokens of OAuth
+// clients expire.
+const RefreshTokenLifetime = 30 * 24 * time.Hour
+
 // ErrLoggedOutUser is sent to IMAP and SMTP if user exists, password is OK but user is logged out from the app.
 var ErrLoggedOutUser = errors.New("account is logged out, use the app to login again")
 
@@ -194,7 +207,7 @@ func (u *User) unlockIfNecessary() error {
 		return nil
 	}
 
-	if err := u.client().Unlock([]byte(u.creds.MailboxPassword)); err != nil {
+	if err := u.client().Unlock(context.Background(), []byte(u.creds.MailboxPassword)); err != nil {
 		return errors.Wrap(err, "failed to unlock user")
 	}
 
@@ -209,11 +222,11 @@ func (u *User) authorizeAndUnlock() (err error) {
 		return nil
 	}
 
-	if _, err := u.client().AuthRefresh(u.creds.APIToken); err != nil {
+	if _, err := u.client().AuthRefresh(context.Background(), u.creds.APIToken); err != nil {
 		return errors.Wrap(err, "failed to refresh API auth")
 	}
 
-	if err := u.client().Unlock([]byte(u.creds.MailboxPassword)); err != nil {
+	if err := u.client().Unlock(context.Background(), []byte(u.creds.MailboxPassword)); err != nil {
 		return errors.Wrap(err, "failed to unlock user")
 	}
 
@@ -303,6 +316,679 @@ func (u *User) IsCombinedAddressMode() bool {
 	return u.creds.IsCombinedAddressMode
 }
 
+// GetSearchLanguage returns the language of the full-text search analyzer.
+func (u *User) GetSearchLanguage() string {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return search.LanguageDefault
+	}
+
+	return u.store.GetSearchLanguage()
+}
+
+// SetSearchLanguage changes the language of the full-text search analyzer.
+// Messages are indexed again with the new analyzer.
+func (u *User) SetSearchLanguage(language string) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	return u.store.SetSearchLanguage(language)
+}
+
+// GetSyncExclusions returns IMAP names of mailboxes which are not synced.
+func (u *User) GetSyncExclusions() []string {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil
+	}
+
+	return u.store.GetSyncExclusions()
+}
+
+// SetSyncExclusions sets mailboxes, by IMAP names, which are not synced.
+func (u *User) SetSyncExclusions(names []string) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	return u.store.SetSyncExclusions(names)
+}
+
+// GetSyncMaxAge returns which messages are synced.
+func (u *User) GetSyncMaxAge() store.SyncMaxAge {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return store.SyncMaxAge{}
+	}
+
+	return u.store.GetSyncMaxAge()
+}
+
+// SetSyncMaxAge sets which messages are synced.
+func (u *User) SetSyncMaxAge(maxAge store.SyncMaxAge) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	return u.store.SetSyncMaxAge(maxAge)
+}
+
+// GetNotificationRules returns which new messages are notified.
+func (u *User) GetNotificationRules() store.NotificationRules {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return store.NotificationRules{}
+	}
+
+	return u.store.GetNotificationRules()
+}
+
+// SetNotificationRules sets which new messages are notified.
+func (u *User) SetNotificationRules(rules store.NotificationRules) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	return u.store.SetNotificationRules(rules)
+}
+
+// GetMailboxMapping returns how mailboxes are presented over IMAP.
+func (u *User) GetMailboxMapping() string {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return store.MailboxMappingFolders
+	}
+
+	return u.store.GetMailboxMapping()
+}
+
+// SetMailboxMapping sets how mailboxes are presented over IMAP and closes
+// connections so clients list mailboxes again in the new mode.
+func (u *User) SetMailboxMapping(mode string) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	if err := u.store.SetMailboxMapping(mode); err != nil {
+		return err
+	}
+
+	u.closeAllConnections()
+	return nil
+}
+
+// GetOutgoingMIMEType returns which MIME type is used for outgoing messages.
+func (u *User) GetOutgoingMIMEType() string {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return store.OutgoingMIMEClient
+	}
+
+	return u.store.GetOutgoingMIMEType()
+}
+
+// SetOutgoingMIMEType sets which MIME type is used for outgoing messages.
+func (u *User) SetOutgoingMIMEType(mode string) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	return u.store.SetOutgoingMIMEType(mode)
+}
+
+// GetAppendSignature returns whether the signature of the sending address is
+// appended to outgoing messages.
+func (u *User) GetAppendSignature() bool {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return false
+	}
+
+	return u.store.GetAppendSignature()
+}
+
+// SetAppendSignature sets whether the signature of the sending address is
+// appended to outgoing messages.
+func (u *User) SetAppendSignature(enabled bool) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	return u.store.SetAppendSignature(enabled)
+}
+
+// GetRemoteContentFilter returns how remote content of HTML bodies of
+// fetched messages is filtered.
+func (u *User) GetRemoteContentFilter() message.RemoteContentFilter {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return message.RemoteContentFilter{Mode: message.RemoteContentAllow}
+	}
+
+	return u.store.GetRemoteContentFilter()
+}
+
+// SetRemoteContentFilter sets how remote content of HTML bodies of fetched
+// messages is filtered.
+func (u *User) SetRemoteContentFilter(filter message.RemoteContentFilter) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	return u.store.SetRemoteContentFilter(filter)
+}
+
+// GetFooter returns the plain text and HTML footer appended to outgoing
+// messages.
+func (u *User) GetFooter() (text, html string) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return "", ""
+	}
+
+	return u.store.GetFooter()
+}
+
+// SetFooter sets the plain text and HTML footer appended to outgoing messages.
+func (u *User) SetFooter(text, html string) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	return u.store.SetFooter(text, html)
+}
+
+// GetDefaultExpiration returns after how long messages sent without own
+// expiration expire. Zero means they don't expire.
+func (u *User) GetDefaultExpiration() time.Duration {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return 0
+	}
+
+	return u.store.GetDefaultExpiration()
+}
+
+// SetDefaultExpiration sets after how long messages sent without own
+// expiration expire.
+func (u *User) SetDefaultExpiration(expiration time.Duration) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	return u.store.SetDefaultExpiration(expiration)
+}
+
+// AddressSettings are settings of the address shown to recipients.
+type AddressSettings struct {
+	Address     string
+	DisplayName string
+	Signature   string
+}
+
+// GetAddressSettings returns settings of all addresses of the user.
+func (u *User) GetAddressSettings() []AddressSettings {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	settings := []AddressSettings{}
+	for _, address := range u.client().Addresses() {
+		settings = append(settings, AddressSettings{
+			Address:     address.Email,
+			DisplayName: address.DisplayName,
+			Signature:   address.Signature,
+		})
+	}
+	return settings
+}
+
+// SetAddressSettings changes the display name and the signature of the
+// address on the server.
+func (u *User) SetAddressSettings(settings AddressSettings) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	address := u.client().Addresses().ByEmail(settings.Address)
+	if address == nil {
+		return errors.New("address not found")
+	}
+
+	return u.client().UpdateAddress(context.Background(), address.ID, &pmapi.UpdateAddressReq{
+		DisplayName: settings.DisplayName,
+		Signature:   settings.Signature,
+	})
+}
+
+// ExportMessages writes decrypted messages to local files.
+func (u *User) ExportMessages(options store.ExportOptions, progress store.ExportProgress) (exported, failed int, err error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return 0, 0, errors.New("store is not initialised")
+	}
+
+	return u.store.Export(options, progress)
+}
+
+// VerifyLocalArchive returns the number of messages in the local archive
+// which are missing or were changed since they were archived.
+func (u *User) VerifyLocalArchive() (int, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return 0, errors.New("store is not initialised")
+	}
+
+	return u.store.VerifyLocalArchive()
+}
+
+// UndeleteMessages restores messages deleted via bridge since the given
+// time. It returns the number of restored messages and the number of
+// messages which could not be restored because their local copy is missing.
+func (u *User) UndeleteMessages(since time.Time) (restored, missing int, err error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return 0, 0, errors.New("store is not initialised")
+	}
+
+	return u.store.UndeleteMessages(since)
+}
+
+// GetScheduledMessages returns messages waiting in the outbox to be sent.
+func (u *User) GetScheduledMessages() ([]*store.ScheduledMessage, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil, errors.New("store is not initialised")
+	}
+
+	return u.store.GetScheduledMessages()
+}
+
+// GetStoreStatistics returns counts of items in the local database.
+func (u *User) GetStoreStatistics() (store.Statistics, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return store.Statistics{}, errors.New("store is not initialised")
+	}
+
+	return u.store.GetStatistics()
+}
+
+// CompactCache removes cached messages and attachments of messages which
+// are no longer in the local database, see store.CompactCache.
+func (u *User) CompactCache() (int64, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return 0, errors.New("store is not initialised")
+	}
+
+	return u.store.CompactCache()
+}
+
+// CompactDatabase rewrites the local database so it does not keep space of
+// removed data, see store.CompactDatabase.
+func (u *User) CompactDatabase(progress func(float64)) (before, after int64, err error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return 0, 0, errors.New("store is not initialised")
+	}
+
+	return u.store.CompactDatabase(progress)
+}
+
+// GetCompactionStatus returns the running and the last compaction of
+// the local database.
+func (u *User) GetCompactionStatus() (store.CompactionStatus, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return store.CompactionStatus{}, errors.New("store is not initialised")
+	}
+
+	return u.store.GetCompactionStatus()
+}
+
+// IsSyncing returns whether the account is being synced right now.
+func (u *User) IsSyncing() bool {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	return u.store != nil && u.store.IsSyncRunning()
+}
+
+// GetSyncReport returns the report of the last sync of the account or nil
+// if there is none yet.
+func (u *User) GetSyncReport() (*store.SyncReport, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil, errors.New("store is not initialised")
+	}
+
+	return u.store.GetSyncReport()
+}
+
+// ApplyRetention applies retention policies to old messages of the account.
+// With dryRun set, it only returns messages which would be removed.
+func (u *User) ApplyRetention(dryRun bool) ([]*store.RetentionEntry, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil, errors.New("store is not initialised")
+	}
+
+	return u.store.ApplyRetention(time.Now(), dryRun)
+}
+
+// ApplyBulkAction applies the action to messages of the account matching
+// the query. With dryRun set, it only returns the matching messages.
+func (u *User) ApplyBulkAction(query store.BulkQuery, action store.BulkAction, dryRun bool) ([]*pmapi.Message, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil, errors.New("store is not initialised")
+	}
+
+	return u.store.ApplyBulkAction(query, action, dryRun)
+}
+
+// FindDuplicates returns groups of duplicate messages in the mailbox.
+func (u *User) FindDuplicates(mailbox string) ([]*store.DuplicateGroup, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil, errors.New("store is not initialised")
+	}
+
+	return u.store.FindDuplicates(mailbox)
+}
+
+// RemoveDuplicates moves the extra copies of groups to Trash after merging
+// their labels to the kept message.
+func (u *User) RemoveDuplicates(groups []*store.DuplicateGroup) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	return u.store.RemoveDuplicates(groups)
+}
+
+// VerifyStore returns inconsistencies of the local database of the account.
+func (u *User) VerifyStore() ([]*store.IntegrityProblem, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil, errors.New("store is not initialised")
+	}
+
+	return u.store.VerifyIntegrity()
+}
+
+// RepairStore fixes the problems found by VerifyStore by fetching metadata
+// of the affected messages again.
+func (u *User) RepairStore(problems []*store.IntegrityProblem) (int, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return 0, errors.New("store is not initialised")
+	}
+
+	return u.store.RepairIntegrity(problems)
+}
+
+// BuildFullMessage returns the complete message of the account, see
+// store.BuildFullMessage.
+func (u *User) BuildFullMessage(apiID string) (io.ReadCloser, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil, errors.New("store is not initialised")
+	}
+
+	return u.store.BuildFullMessage(apiID)
+}
+
+// UploadSettings uploads settings of the account together with the given
+// bridge-wide preferences to the account, so bridges of the user on other
+// computers can download them.
+func (u *User) UploadSettings(preferences map[string]string) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	kr, err := u.mainKeyRing()
+	if err != nil {
+		return err
+	}
+
+	footerText, footerHTML := u.store.GetFooter()
+	return u.store.UploadSyncedSettings(kr, &store.SyncedSettings{
+		Preferences:      preferences,
+		SyncExclusions:   u.store.GetSyncExclusions(),
+		MailboxMapping:   u.store.GetMailboxMapping(),
+		OutgoingMIMEType: u.store.GetOutgoingMIMEType(),
+		AppendSignature:  u.store.GetAppendSignature(),
+		FooterText:       footerText,
+		FooterHTML:       footerHTML,
+		RemoteContent:    u.store.GetRemoteContentFilter(),
+		SearchLanguage:   u.store.GetSearchLanguage(),
+	})
+}
+
+// DownloadSettings applies account settings uploaded by a bridge of the user
+// and returns the uploaded bridge-wide preferences for the caller to apply.
+func (u *User) DownloadSettings() (map[string]string, error) {
+	settings, err := u.downloadSyncedSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.SetSyncExclusions(settings.SyncExclusions); err != nil {
+		return nil, err
+	}
+	if settings.MailboxMapping != "" && settings.MailboxMapping != u.GetMailboxMapping() {
+		if err := u.SetMailboxMapping(settings.MailboxMapping); err != nil {
+			return nil, err
+		}
+	}
+	if settings.OutgoingMIMEType != "" {
+		if err := u.SetOutgoingMIMEType(settings.OutgoingMIMEType); err != nil {
+			return nil, err
+		}
+	}
+	if err := u.SetAppendSignature(settings.AppendSignature); err != nil {
+		return nil, err
+	}
+	if err := u.SetFooter(settings.FooterText, settings.FooterHTML); err != nil {
+		return nil, err
+	}
+	if settings.RemoteContent.Mode != "" {
+		if err := u.SetRemoteContentFilter(settings.RemoteContent); err != nil {
+			return nil, err
+		}
+	}
+	if settings.SearchLanguage != "" {
+		if err := u.SetSearchLanguage(settings.SearchLanguage); err != nil {
+			return nil, err
+		}
+	}
+
+	return settings.Preferences, nil
+}
+
+func (u *User) downloadSyncedSettings() (*store.SyncedSettings, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil, errors.New("store is not initialised")
+	}
+
+	kr, err := u.mainKeyRing()
+	if err != nil {
+		return nil, err
+	}
+
+	return u.store.DownloadSyncedSettings(kr)
+}
+
+// GetRetentionLog returns messages removed by retention policies.
+func (u *User) GetRetentionLog() ([]*store.RetentionEntry, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil, errors.New("store is not initialised")
+	}
+
+	return u.store.GetRetentionLog()
+}
+
+// GetPluginValue returns the value stored by the plugin for the account.
+func (u *User) GetPluginValue(plugin, key string) ([]byte, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil, errors.New("store is not initialised")
+	}
+
+	kr, err := u.mainKeyRing()
+	if err != nil {
+		return nil, err
+	}
+
+	return u.store.GetPluginValue(kr, plugin, key)
+}
+
+// SetPluginValue stores the value of the plugin for the account.
+func (u *User) SetPluginValue(plugin, key string, value []byte) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	kr, err := u.mainKeyRing()
+	if err != nil {
+		return err
+	}
+
+	return u.store.SetPluginValue(kr, plugin, key, value)
+}
+
+// DeletePluginValue removes the value stored by the plugin for the account.
+func (u *User) DeletePluginValue(plugin, key string) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	return u.store.DeletePluginValue(plugin, key)
+}
+
+// GetPluginKeys returns keys stored by the plugin for the account.
+func (u *User) GetPluginKeys(plugin string) ([]string, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil, errors.New("store is not initialised")
+	}
+
+	return u.store.GetPluginKeys(plugin)
+}
+
+// mainKeyRing returns the key ring of the primary address which encrypts
+// values of plugins and synced settings.
+func (u *User) mainKeyRing() (*crypto.KeyRing, error) {
+	addr := u.client().Addresses().Main()
+	if addr == nil {
+		return nil, errors.New("user has no address")
+	}
+	return u.client().KeyRingForAddressID(addr.ID)
+}
+
 // GetPrimaryAddress returns the user's original address (which is
 // not necessarily the same as the primary address, because a primary address
 // might be an alias and be in position one).
@@ -326,6 +1012,12 @@ func (u *User) GetStoreAddresses() []string {
 	return u.creds.EmailList()
 }
 
+// GetCacheKey returns the key encrypting local caches of the user. It is
+// stored in the keychain together with the credentials.
+func (u *User) GetCacheKey() ([]byte, error) {
+	return u.credStorer.GetCacheKey(u.userID)
+}
+
 // getStoreAddresses returns a user's used addresses (with the original address in first place).
 func (u *User) getStoreAddresses() []string { // nolint[unused]
 	addrInfo, err := u.store.GetAddressInfo()
@@ -402,6 +1094,78 @@ func (u *User) CheckBridgeLogin(password string) error {
 	return u.creds.CheckPassword(password)
 }
 
+// GenerateAccessToken returns a short-lived token which can be used by
+// IMAP/SMTP clients authenticating by XOAUTH2 instead of the bridge password.
+func (u *User) GenerateAccessToken() (token string, expires time.Time) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	expires = time.Now().Add(AccessTokenLifetime)
+	return u.creds.GenerateAccessToken(expires), expires
+}
+
+// CheckBridgeAccessToken checks whether the user is logged in and the access
+// token is valid.
+func (u *User) CheckBridgeAccessToken(token string) error {
+	if isApplicationOutdated {
+		u.listener.Emit(events.UpgradeApplicationEvent, "")
+		return pmapi.ErrUpgradeApplication
+	}
+
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if err := u.authorizeIfNecessary(true); err != nil {
+		u.log.WithError(err).Error("Failed to authorize user")
+		return err
+	}
+
+	return u.creds.CheckAccessToken(token, time.Now())
+}
+
+// GenerateRefreshToken returns a long-lived token which OAuth clients can
+// exchange for new access tokens. Tokens issued before stay valid until
+// one of them is exchanged.
+func (u *User) GenerateRefreshToken() (string, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.creds.RefreshTokenNonce == "" {
+		return u.rotateRefreshToken()
+	}
+
+	return u.creds.GenerateRefreshToken(time.Now().Add(RefreshTokenLifetime)), nil
+}
+
+// RefreshToken exchanges the refresh token for a new one. All refresh
+// tokens issued before are revoked.
+func (u *User) RefreshToken(token string) (string, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	// Token is checked first so invalid tokens don't cause API requests.
+	if err := u.creds.CheckRefreshToken(token, time.Now()); err != nil {
+		return "", err
+	}
+
+	if err := u.authorizeIfNecessary(true); err != nil {
+		u.log.WithError(err).Error("Failed to authorize user")
+		return "", err
+	}
+
+	return u.rotateRefreshToken()
+}
+
+func (u *User) rotateRefreshToken() (string, error) {
+	creds, err := u.credStorer.RotateRefreshTokenNonce(u.userID)
+	if err != nil {
+		return "", err
+	}
+	u.creds = creds
+
+	return u.creds.GenerateRefreshToken(time.Now().Add(RefreshTokenLifetime)), nil
+}
+
 // UpdateUser updates user details from API and saves to the credentials.
 func (u *User) UpdateUser() error {
 	u.lock.Lock()
@@ -411,12 +1175,12 @@ func (u *User) UpdateUser() error {
 		return errors.Wrap(err, "cannot update user")
 	}
 
-	_, err := u.client().UpdateUser()
+	_, err := u.client().UpdateUser(context.Background())
 	if err != nil {
 		return err
 	}
 
-	if err = u.client().ReloadKeys([]byte(u.creds.MailboxPassword)); err != nil {
+	if err = u.client().ReloadKeys(context.Background(), []byte(u.creds.MailboxPassword)); err != nil {
 		return errors.Wrap(err, "failed to reload keys")
 	}
 
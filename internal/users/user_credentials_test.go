@@ -36,10 +36,10 @@ func TestUpdateUser(t *testing.T) {
 
 	gomock.InOrder(
 		m.pmapiClient.EXPECT().IsUnlocked().Return(false),
-		m.pmapiClient.EXPECT().Unlock([]byte("pass")).Return(nil),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte("pass")).Return(nil),
 
-		m.pmapiClient.EXPECT().UpdateUser().Return(nil, nil),
-		m.pmapiClient.EXPECT().ReloadKeys([]byte(testCredentials.MailboxPassword)).Return(nil),
+		m.pmapiClient.EXPECT().UpdateUser(gomock.Any()).Return(nil, nil),
+		m.pmapiClient.EXPECT().ReloadKeys(gomock.Any(), []byte(testCredentials.MailboxPassword)).Return(nil),
 		m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress}),
 
 		m.credentialsStore.EXPECT().UpdateEmails("user", []string{testPMAPIAddress.Email}),
@@ -47,8 +47,8 @@ func TestUpdateUser(t *testing.T) {
 	)
 
 	gomock.InOrder(
-		m.pmapiClient.EXPECT().GetEvent(testPMAPIEvent.EventID).Return(testPMAPIEvent, nil).MaxTimes(1),
-		m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil).MaxTimes(1),
+		m.pmapiClient.EXPECT().GetEvent(gomock.Any(), testPMAPIEvent.EventID).Return(testPMAPIEvent, nil).MaxTimes(1),
+		m.pmapiClient.EXPECT().ListMessages(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{}, 0, nil).MaxTimes(1),
 	)
 
 	assert.NoError(t, user.UpdateUser())
@@ -70,8 +70,8 @@ func TestUserSwitchAddressMode(t *testing.T) {
 
 	gomock.InOrder(
 		m.eventListener.EXPECT().Emit(events.CloseConnectionEvent, "user@pm.me"),
-		m.pmapiClient.EXPECT().ListLabels().Return([]*pmapi.Label{}, nil),
-		m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil),
+		m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return([]*pmapi.Label{}, nil),
+		m.pmapiClient.EXPECT().CountMessages(gomock.Any(), "").Return([]*pmapi.MessagesCount{}, nil),
 		m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress}),
 
 		m.credentialsStore.EXPECT().SwitchAddressMode("user").Return(nil),
@@ -87,14 +87,14 @@ func TestUserSwitchAddressMode(t *testing.T) {
 		m.eventListener.EXPECT().Emit(events.CloseConnectionEvent, "users@pm.me"),
 		m.eventListener.EXPECT().Emit(events.CloseConnectionEvent, "anotheruser@pm.me"),
 		m.eventListener.EXPECT().Emit(events.CloseConnectionEvent, "alsouser@pm.me"),
-		m.pmapiClient.EXPECT().ListLabels().Return([]*pmapi.Label{}, nil),
-		m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil),
+		m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return([]*pmapi.Label{}, nil),
+		m.pmapiClient.EXPECT().CountMessages(gomock.Any(), "").Return([]*pmapi.MessagesCount{}, nil),
 		m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress}),
 
 		m.credentialsStore.EXPECT().SwitchAddressMode("user").Return(nil),
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil),
 	)
-	m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil).AnyTimes()
+	m.pmapiClient.EXPECT().ListMessages(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{}, 0, nil).AnyTimes()
 
 	assert.NoError(t, user.SwitchAddressMode())
 	assert.True(t, user.store.IsCombinedMode())
@@ -155,7 +155,7 @@ func TestCheckBridgeLoginOK(t *testing.T) {
 
 	gomock.InOrder(
 		m.pmapiClient.EXPECT().IsUnlocked().Return(false),
-		m.pmapiClient.EXPECT().Unlock([]byte("pass")).Return(nil),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte("pass")).Return(nil),
 	)
 
 	err := user.CheckBridgeLogin(testCredentials.BridgePassword)
@@ -174,7 +174,7 @@ func TestCheckBridgeLoginTwiceOK(t *testing.T) {
 
 	gomock.InOrder(
 		m.pmapiClient.EXPECT().IsUnlocked().Return(false),
-		m.pmapiClient.EXPECT().Unlock([]byte("pass")).Return(nil),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte("pass")).Return(nil),
 		m.pmapiClient.EXPECT().IsUnlocked().Return(true),
 	)
 
@@ -217,7 +217,7 @@ func TestCheckBridgeLoginLoggedOut(t *testing.T) {
 	m.clientManager.EXPECT().GetClient(gomock.Any()).Return(m.pmapiClient).MinTimes(1)
 	gomock.InOrder(
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentialsDisconnected, nil),
-		m.pmapiClient.EXPECT().ListLabels().Return(nil, errors.New("ErrUnauthorized")),
+		m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return(nil, errors.New("ErrUnauthorized")),
 		m.pmapiClient.EXPECT().Addresses().Return(nil),
 	)
 
@@ -242,10 +242,46 @@ func TestCheckBridgeLoginBadPassword(t *testing.T) {
 
 	gomock.InOrder(
 		m.pmapiClient.EXPECT().IsUnlocked().Return(false),
-		m.pmapiClient.EXPECT().Unlock([]byte("pass")).Return(nil),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte("pass")).Return(nil),
 	)
 
 	err := user.CheckBridgeLogin("wrong!")
 	waitForEvents()
 	assert.Equal(t, "backend/credentials: incorrect password", err.Error())
 }
+
+func TestUserRefreshToken(t *testing.T) {
+	m := initMocks(t)
+	defer m.ctrl.Finish()
+
+	user := testNewUser(m)
+	defer cleanUpUserData(user)
+
+	first := *testCredentials
+	first.RefreshTokenNonce = "first"
+	second := *testCredentials
+	second.RefreshTokenNonce = "second"
+
+	m.credentialsStore.EXPECT().RotateRefreshTokenNonce("user").Return(&first, nil)
+	token, err := user.GenerateRefreshToken()
+	assert.NoError(t, err)
+
+	// Invalid token is refused without authorizing the user.
+	_, err = user.RefreshToken("garbage")
+	assert.Error(t, err)
+
+	gomock.InOrder(
+		m.pmapiClient.EXPECT().IsUnlocked().Return(false),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte("pass")).Return(nil),
+		m.credentialsStore.EXPECT().RotateRefreshTokenNonce("user").Return(&second, nil),
+	)
+	newToken, err := user.RefreshToken(token)
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, newToken)
+
+	// Exchanged token is revoked.
+	_, err = user.RefreshToken(token)
+	assert.Error(t, err)
+
+	waitForEvents()
+}
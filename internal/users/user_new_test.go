@@ -47,9 +47,9 @@ func TestNewUserAppOutdated(t *testing.T) {
 	gomock.InOrder(
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil),
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil),
-		m.pmapiClient.EXPECT().AuthRefresh("token").Return(nil, pmapi.ErrUpgradeApplication),
+		m.pmapiClient.EXPECT().AuthRefresh(gomock.Any(), "token").Return(nil, pmapi.ErrUpgradeApplication),
 		m.eventListener.EXPECT().Emit(events.UpgradeApplicationEvent, ""),
-		m.pmapiClient.EXPECT().ListLabels().Return(nil, pmapi.ErrUpgradeApplication),
+		m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return(nil, pmapi.ErrUpgradeApplication),
 		m.pmapiClient.EXPECT().Addresses().Return(nil),
 	)
 
@@ -65,12 +65,12 @@ func TestNewUserNoInternetConnection(t *testing.T) {
 	gomock.InOrder(
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil),
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil),
-		m.pmapiClient.EXPECT().AuthRefresh("token").Return(nil, pmapi.ErrAPINotReachable),
+		m.pmapiClient.EXPECT().AuthRefresh(gomock.Any(), "token").Return(nil, pmapi.ErrAPINotReachable),
 		m.eventListener.EXPECT().Emit(events.InternetOffEvent, ""),
 
-		m.pmapiClient.EXPECT().ListLabels().Return(nil, pmapi.ErrAPINotReachable),
+		m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return(nil, pmapi.ErrAPINotReachable),
 		m.pmapiClient.EXPECT().Addresses().Return(nil),
-		m.pmapiClient.EXPECT().GetEvent("").Return(nil, pmapi.ErrAPINotReachable).AnyTimes(),
+		m.pmapiClient.EXPECT().GetEvent(gomock.Any(), "").Return(nil, pmapi.ErrAPINotReachable).AnyTimes(),
 	)
 
 	checkNewUserHasCredentials(testCredentials, m)
@@ -88,7 +88,7 @@ func TestNewUserAuthRefreshFails(t *testing.T) {
 	gomock.InOrder(
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil),
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil),
-		m.pmapiClient.EXPECT().AuthRefresh("token").Return(nil, errors.New("bad token")),
+		m.pmapiClient.EXPECT().AuthRefresh(gomock.Any(), "token").Return(nil, errors.New("bad token")),
 		m.credentialsStore.EXPECT().Logout("user").Return(nil),
 
 		m.pmapiClient.EXPECT().Logout(),
@@ -112,9 +112,9 @@ func TestNewUserUnlockFails(t *testing.T) {
 	gomock.InOrder(
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil),
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil),
-		m.pmapiClient.EXPECT().AuthRefresh("token").Return(testAuthRefresh, nil),
+		m.pmapiClient.EXPECT().AuthRefresh(gomock.Any(), "token").Return(testAuthRefresh, nil),
 
-		m.pmapiClient.EXPECT().Unlock([]byte("pass")).Return(errors.New("bad password")),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte("pass")).Return(errors.New("bad password")),
 		m.credentialsStore.EXPECT().Logout("user").Return(nil),
 		m.pmapiClient.EXPECT().Logout(),
 		m.credentialsStore.EXPECT().Logout("user").Return(nil),
@@ -19,8 +19,10 @@
 package users
 
 import (
+	"context"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/internal/metrics"
@@ -35,6 +37,17 @@ import (
 var (
 	log                   = logrus.WithField("pkg", "users") //nolint[gochecknoglobals]
 	isApplicationOutdated = false                            //nolint[gochecknoglobals]
+
+	// Loading of users is retried with delay doubling from min to max
+	// while the keychain is not available.
+	keychainRetryMinDelay = time.Second //nolint[gochecknoglobals]
+	keychainRetryMaxDelay = time.Minute //nolint[gochecknoglobals]
+)
+
+// Errors of FinishRelogin.
+var (
+	ErrUnknownUser  = errors.New("account does not exist, add it instead")
+	ErrWrongAccount = errors.New("credentials are for another account")
 )
 
 // Users is a struct handling users.
@@ -65,6 +78,16 @@ type Users struct {
 
 	lock sync.RWMutex
 
+	// isWaitingForKeychain is set while some credentials could not be read
+	// from the keychain, e.g. because it is locked, and loading is retried.
+	isWaitingForKeychain bool
+
+	// startup is the progress of accounts loaded in background at startup
+	// and loadingUsers are those being initialised right now.
+	startup      []*StartupProgress
+	loadingUsers map[string]*User
+	startupLock  sync.RWMutex
+
 	// stopAll can be closed to stop all goroutines from looping (watchAppOutdated, watchAPIAuths, heartbeat etc).
 	stopAll chan struct{}
 }
@@ -105,14 +128,33 @@ func New(
 
 	if u.credStorer == nil {
 		log.Error("No credentials store is available")
-	} else if err := u.loadUsersFromCredentialsStore(); err != nil {
+	} else if concurrency := getStartupConcurrency(); concurrency > 0 {
+		if err := u.startLoadingUsers(concurrency); err != nil {
+			log.WithError(err).Error("Could not list users in credentials store")
+
+			u.isWaitingForKeychain = true
+			go func() {
+				defer panicHandler.HandlePanic()
+				u.watchKeychain()
+			}()
+		}
+	} else if _, err := u.loadUsersFromCredentialsStore(); err != nil {
 		log.WithError(err).Error("Could not load all users from credentials store")
+
+		u.isWaitingForKeychain = true
+		go func() {
+			defer panicHandler.HandlePanic()
+			u.watchKeychain()
+		}()
 	}
 
 	return u
 }
 
-func (u *Users) loadUsersFromCredentialsStore() (err error) {
+// loadUsersFromCredentialsStore loads users which are not loaded yet and
+// returns their IDs. Error is returned when the list of users or some of
+// their credentials cannot be read.
+func (u *Users) loadUsersFromCredentialsStore() (loadedUserIDs []string, err error) {
 	u.lock.Lock()
 	defer u.lock.Unlock()
 
@@ -124,9 +166,14 @@ func (u *Users) loadUsersFromCredentialsStore() (err error) {
 	for _, userID := range userIDs {
 		l := log.WithField("user", userID)
 
+		if _, ok := u.hasUser(userID); ok {
+			continue
+		}
+
 		user, newUserErr := newUser(u.panicHandler, userID, u.events, u.credStorer, u.clientManager, u.storeFactory)
 		if newUserErr != nil {
 			l.WithField("user", userID).WithError(newUserErr).Warn("Could not load user, skipping")
+			err = newUserErr
 			continue
 		}
 
@@ -134,10 +181,62 @@ func (u *Users) loadUsersFromCredentialsStore() (err error) {
 
 		if initUserErr := user.init(u.idleUpdates); initUserErr != nil {
 			l.WithField("user", userID).WithError(initUserErr).Warn("Could not initialise user")
+			u.updateStartupProgress(userID, StartupFailed, user.Username(), initUserErr)
+		} else {
+			u.updateStartupProgress(userID, StartupReady, user.Username(), nil)
 		}
+
+		loadedUserIDs = append(loadedUserIDs, userID)
 	}
 
-	return err
+	return loadedUserIDs, err
+}
+
+// watchKeychain retries loading users with increasing delay until all
+// credentials are readable. Accounts are served as soon as they are loaded.
+func (u *Users) watchKeychain() {
+	delay := keychainRetryMinDelay
+
+	for {
+		select {
+		case <-time.After(delay):
+		case <-u.stopAll:
+			return
+		}
+
+		loadedUserIDs, err := u.loadUsersFromCredentialsStore()
+		for _, userID := range loadedUserIDs {
+			u.events.Emit(events.UserRefreshEvent, userID)
+		}
+
+		if err == nil {
+			log.Info("All users were loaded from credentials store")
+			u.setWaitingForKeychain(false)
+			return
+		}
+
+		log.WithError(err).WithField("delay", delay).Debug("Keychain is still not available")
+
+		if delay *= 2; delay > keychainRetryMaxDelay {
+			delay = keychainRetryMaxDelay
+		}
+	}
+}
+
+// IsWaitingForKeychain returns whether some accounts are not loaded yet
+// because their credentials could not be read from the keychain.
+func (u *Users) IsWaitingForKeychain() bool {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	return u.isWaitingForKeychain
+}
+
+func (u *Users) setWaitingForKeychain(isWaiting bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.isWaitingForKeychain = isWaiting
 }
 
 func (u *Users) watchAppOutdated() {
@@ -165,6 +264,9 @@ func (u *Users) watchAPIAuths() {
 			log.Debug("Users received auth from ClientManager")
 
 			user, ok := u.hasUser(auth.UserID)
+			if !ok {
+				user, ok = u.getLoadingUser(auth.UserID)
+			}
 			if !ok {
 				log.WithField("userID", auth.UserID).Info("User not available for auth update")
 				continue
@@ -198,13 +300,13 @@ func (u *Users) Login(username, password string) (authClient pmapi.Client, auth
 	// We need to use anonymous client because we don't yet have userID and so can't save auth tokens yet.
 	authClient = u.clientManager.GetAnonymousClient()
 
-	authInfo, err := authClient.AuthInfo(username)
+	authInfo, err := authClient.AuthInfo(context.Background(), username)
 	if err != nil {
 		log.WithField("username", username).WithError(err).Error("Could not get auth info for user")
 		return
 	}
 
-	if auth, err = authClient.Auth(username, password, authInfo); err != nil {
+	if auth, err = authClient.Auth(context.Background(), username, password, authInfo); err != nil {
 		log.WithField("username", username).WithError(err).Error("Could not get auth for user")
 		return
 	}
@@ -213,14 +315,31 @@ func (u *Users) Login(username, password string) (authClient pmapi.Client, auth
 }
 
 // FinishLogin finishes the login procedure and adds the user into the credentials store.
-func (u *Users) FinishLogin(authClient pmapi.Client, auth *pmapi.Auth, mbPassphrase string) (user *User, err error) { //nolint[funlen]
+func (u *Users) FinishLogin(authClient pmapi.Client, auth *pmapi.Auth, mbPassphrase string) (user *User, err error) {
+	return u.finishLogin(authClient, auth, mbPassphrase, "")
+}
+
+// FinishRelogin finishes the login of the existing user with fresh credentials,
+// e.g. after the refresh token expired. The user keeps its store and keychain
+// entry, so messages are not synced again. The login has to be for the same
+// account; the session of the user is replaced even if it is still connected.
+func (u *Users) FinishRelogin(userID string, authClient pmapi.Client, auth *pmapi.Auth, mbPassphrase string) (user *User, err error) {
+	if _, ok := u.hasUser(userID); !ok {
+		return nil, ErrUnknownUser
+	}
+	return u.finishLogin(authClient, auth, mbPassphrase, userID)
+}
+
+// finishLogin adds a new user or connects the existing one. With reloginID
+// set, only the user with that ID can be connected.
+func (u *Users) finishLogin(authClient pmapi.Client, auth *pmapi.Auth, mbPassphrase, reloginID string) (user *User, err error) { //nolint[funlen]
 	defer func() {
 		if err == pmapi.ErrUpgradeApplication {
 			u.events.Emit(events.UpgradeApplicationEvent, "")
 		}
 		if err != nil {
 			log.WithError(err).Debug("Login not finished; removing auth session")
-			if delAuthErr := authClient.DeleteAuth(); delAuthErr != nil {
+			if delAuthErr := authClient.DeleteAuth(context.Background()); delAuthErr != nil {
 				log.WithError(delAuthErr).Error("Failed to clear login session after unlock")
 			}
 		}
@@ -236,8 +355,20 @@ func (u *Users) FinishLogin(authClient pmapi.Client, auth *pmapi.Auth, mbPassphr
 
 	log.Info("Got API user")
 
+	if reloginID != "" && reloginID != apiUser.ID && reloginID != apiUser.Name {
+		err = ErrWrongAccount
+		return
+	}
+
 	var ok bool
 	if user, ok = u.hasUser(apiUser.ID); ok {
+		if reloginID != "" && user.IsConnected() {
+			log.Info("Replacing session of connected user")
+			if err = user.Logout(); err != nil {
+				log.WithError(err).Error("Failed to logout user before relogin")
+				return
+			}
+		}
 		if err = u.connectExistingUser(user, auth, hashedPassphrase); err != nil {
 			log.WithError(err).Error("Failed to connect existing user")
 			return
@@ -277,7 +408,7 @@ func (u *Users) connectExistingUser(user *User, auth *pmapi.Auth, hashedPassphra
 
 	client := u.clientManager.GetClient(user.ID())
 
-	if auth, err = client.AuthRefresh(auth.GenToken()); err != nil {
+	if auth, err = client.AuthRefresh(context.Background(), auth.GenToken()); err != nil {
 		return errors.Wrap(err, "failed to refresh auth token of new client")
 	}
 
@@ -299,11 +430,11 @@ func (u *Users) addNewUser(apiUser *pmapi.User, auth *pmapi.Auth, hashedPassphra
 
 	client := u.clientManager.GetClient(apiUser.ID)
 
-	if auth, err = client.AuthRefresh(auth.GenToken()); err != nil {
+	if auth, err = client.AuthRefresh(context.Background(), auth.GenToken()); err != nil {
 		return errors.Wrap(err, "failed to refresh token in new client")
 	}
 
-	if apiUser, err = client.CurrentUser(); err != nil {
+	if apiUser, err = client.CurrentUser(context.Background()); err != nil {
 		return errors.Wrap(err, "failed to update API user")
 	}
 
@@ -337,7 +468,7 @@ func (u *Users) addNewUser(apiUser *pmapi.User, auth *pmapi.Auth, hashedPassphra
 }
 
 func getAPIUser(client pmapi.Client, mbPassphrase string) (user *pmapi.User, hashedPassphrase string, err error) {
-	salt, err := client.AuthSalt()
+	salt, err := client.AuthSalt(context.Background())
 	if err != nil {
 		log.WithError(err).Error("Could not get salt")
 		return
@@ -350,12 +481,12 @@ func getAPIUser(client pmapi.Client, mbPassphrase string) (user *pmapi.User, has
 	}
 
 	// We unlock the user's PGP key here to detect if the user's mailbox password is wrong.
-	if err = client.Unlock([]byte(hashedPassphrase)); err != nil {
+	if err = client.Unlock(context.Background(), []byte(hashedPassphrase)); err != nil {
 		log.WithError(err).Error("Wrong mailbox password")
 		return
 	}
 
-	if user, err = client.CurrentUser(); err != nil {
+	if user, err = client.CurrentUser(context.Background()); err != nil {
 		log.WithError(err).Error("Could not load user data")
 		return
 	}
@@ -409,6 +540,21 @@ func (u *Users) ClearData() error {
 	return result.ErrorOrNil()
 }
 
+// CloseStores closes stores of all users to release db files, e.g. for
+// another instance. Users stay logged in.
+func (u *Users) CloseStores() error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	var result *multierror.Error
+	for _, user := range u.users {
+		if err := user.closeStore(); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result.ErrorOrNil()
+}
+
 // DeleteUser deletes user completely; it logs user out from the API, stops any
 // active connection, deletes from credentials store and removes from the Bridge struct.
 func (u *Users) DeleteUser(userID string, clearStore bool) error {
@@ -453,7 +599,7 @@ func (u *Users) SendMetric(m metrics.Metric) {
 	defer c.Logout()
 
 	cat, act, lab := m.Get()
-	if err := c.SendSimpleMetric(string(cat), string(act), string(lab)); err != nil {
+	if err := c.SendSimpleMetric(context.Background(), string(cat), string(act), string(lab)); err != nil {
 		log.Error("Sending metric failed: ", err)
 	}
 
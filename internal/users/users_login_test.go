@@ -39,9 +39,9 @@ func TestUsersFinishLoginBadMailboxPassword(t *testing.T) {
 		m.credentialsStore.EXPECT().List().Return([]string{}, nil),
 
 		// Set up mocks for FinishLogin.
-		m.pmapiClient.EXPECT().AuthSalt().Return("", nil),
-		m.pmapiClient.EXPECT().Unlock([]byte(testCredentials.MailboxPassword)).Return(err),
-		m.pmapiClient.EXPECT().DeleteAuth(),
+		m.pmapiClient.EXPECT().AuthSalt(gomock.Any()).Return("", nil),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte(testCredentials.MailboxPassword)).Return(err),
+		m.pmapiClient.EXPECT().DeleteAuth(gomock.Any()),
 		m.pmapiClient.EXPECT().Logout(),
 	)
 
@@ -58,11 +58,11 @@ func TestUsersFinishLoginUpgradeApplication(t *testing.T) {
 		m.credentialsStore.EXPECT().List().Return([]string{}, nil),
 
 		// Set up mocks for FinishLogin.
-		m.pmapiClient.EXPECT().AuthSalt().Return("", nil),
-		m.pmapiClient.EXPECT().Unlock([]byte(testCredentials.MailboxPassword)).Return(pmapi.ErrUpgradeApplication),
+		m.pmapiClient.EXPECT().AuthSalt(gomock.Any()).Return("", nil),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte(testCredentials.MailboxPassword)).Return(pmapi.ErrUpgradeApplication),
 
 		m.eventListener.EXPECT().Emit(events.UpgradeApplicationEvent, ""),
-		m.pmapiClient.EXPECT().DeleteAuth().Return(err),
+		m.pmapiClient.EXPECT().DeleteAuth(gomock.Any()).Return(err),
 		m.pmapiClient.EXPECT().Logout(),
 	)
 
@@ -94,30 +94,30 @@ func TestUsersFinishLoginNewUser(t *testing.T) {
 		m.credentialsStore.EXPECT().List().Return([]string{}, nil),
 
 		// getAPIUser() loads user info from API (e.g. userID).
-		m.pmapiClient.EXPECT().AuthSalt().Return("", nil),
-		m.pmapiClient.EXPECT().Unlock([]byte(testCredentials.MailboxPassword)).Return(nil),
-		m.pmapiClient.EXPECT().CurrentUser().Return(testPMAPIUser, nil),
+		m.pmapiClient.EXPECT().AuthSalt(gomock.Any()).Return("", nil),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte(testCredentials.MailboxPassword)).Return(nil),
+		m.pmapiClient.EXPECT().CurrentUser(gomock.Any()).Return(testPMAPIUser, nil),
 
 		// addNewUser()
-		m.pmapiClient.EXPECT().AuthRefresh(":tok").Return(refreshWithToken("afterLogin"), nil),
-		m.pmapiClient.EXPECT().CurrentUser().Return(testPMAPIUser, nil),
+		m.pmapiClient.EXPECT().AuthRefresh(gomock.Any(), ":tok").Return(refreshWithToken("afterLogin"), nil),
+		m.pmapiClient.EXPECT().CurrentUser(gomock.Any()).Return(testPMAPIUser, nil),
 		m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress}),
 		m.credentialsStore.EXPECT().Add("user", "username", ":afterLogin", testCredentials.MailboxPassword, []string{testPMAPIAddress.Email}),
 		m.credentialsStore.EXPECT().Get("user").Return(credentialsWithToken(":afterLogin"), nil),
 
 		// user.init() in addNewUser
 		m.credentialsStore.EXPECT().Get("user").Return(credentialsWithToken(":afterLogin"), nil),
-		m.pmapiClient.EXPECT().AuthRefresh(":afterLogin").Return(refreshWithToken("afterCredentials"), nil),
-		m.pmapiClient.EXPECT().Unlock([]byte(testCredentials.MailboxPassword)).Return(nil),
+		m.pmapiClient.EXPECT().AuthRefresh(gomock.Any(), ":afterLogin").Return(refreshWithToken("afterCredentials"), nil),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte(testCredentials.MailboxPassword)).Return(nil),
 
 		// store.New() in user.init
-		m.pmapiClient.EXPECT().ListLabels().Return([]*pmapi.Label{}, nil),
-		m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil),
+		m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return([]*pmapi.Label{}, nil),
+		m.pmapiClient.EXPECT().CountMessages(gomock.Any(), "").Return([]*pmapi.MessagesCount{}, nil),
 		m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress}),
 
 		// Emit event for new user and send metrics.
 		m.clientManager.EXPECT().GetAnonymousClient().Return(m.pmapiClient),
-		m.pmapiClient.EXPECT().SendSimpleMetric(string(metrics.Setup), string(metrics.NewUser), string(metrics.NoLabel)),
+		m.pmapiClient.EXPECT().SendSimpleMetric(gomock.Any(), string(metrics.Setup), string(metrics.NewUser), string(metrics.NoLabel)),
 		m.pmapiClient.EXPECT().Logout(),
 
 		// Reload account list in GUI.
@@ -155,27 +155,27 @@ func TestUsersFinishLoginExistingDisconnectedUser(t *testing.T) {
 		m.credentialsStore.EXPECT().Get("user").Return(&loggedOutCreds, nil),
 
 		// store.New() in user.init
-		m.pmapiClient.EXPECT().ListLabels().Return(nil, pmapi.ErrInvalidToken),
+		m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return(nil, pmapi.ErrInvalidToken),
 		m.pmapiClient.EXPECT().Addresses().Return(nil),
 
 		// getAPIUser() loads user info from API (e.g. userID).
-		m.pmapiClient.EXPECT().AuthSalt().Return("", nil),
-		m.pmapiClient.EXPECT().Unlock([]byte(testCredentials.MailboxPassword)).Return(nil),
-		m.pmapiClient.EXPECT().CurrentUser().Return(testPMAPIUser, nil),
+		m.pmapiClient.EXPECT().AuthSalt(gomock.Any()).Return("", nil),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte(testCredentials.MailboxPassword)).Return(nil),
+		m.pmapiClient.EXPECT().CurrentUser(gomock.Any()).Return(testPMAPIUser, nil),
 
 		// connectExistingUser()
 		m.credentialsStore.EXPECT().UpdatePassword("user", testCredentials.MailboxPassword).Return(nil),
-		m.pmapiClient.EXPECT().AuthRefresh(":tok").Return(refreshWithToken("afterLogin"), nil),
+		m.pmapiClient.EXPECT().AuthRefresh(gomock.Any(), ":tok").Return(refreshWithToken("afterLogin"), nil),
 		m.credentialsStore.EXPECT().UpdateToken("user", ":afterLogin").Return(nil),
 
 		// user.init() in connectExistingUser
 		m.credentialsStore.EXPECT().Get("user").Return(credentialsWithToken(":afterLogin"), nil),
-		m.pmapiClient.EXPECT().AuthRefresh(":afterLogin").Return(refreshWithToken("afterCredentials"), nil),
-		m.pmapiClient.EXPECT().Unlock([]byte(testCredentials.MailboxPassword)).Return(nil),
+		m.pmapiClient.EXPECT().AuthRefresh(gomock.Any(), ":afterLogin").Return(refreshWithToken("afterCredentials"), nil),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte(testCredentials.MailboxPassword)).Return(nil),
 
 		// store.New() in user.init
-		m.pmapiClient.EXPECT().ListLabels().Return([]*pmapi.Label{}, nil),
-		m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil),
+		m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return([]*pmapi.Label{}, nil),
+		m.pmapiClient.EXPECT().CountMessages(gomock.Any(), "").Return([]*pmapi.MessagesCount{}, nil),
 		m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress}),
 
 		// Reload account list in GUI.
@@ -207,10 +207,10 @@ func TestUsersFinishLoginConnectedUser(t *testing.T) {
 
 	// Then, try to log in again...
 	gomock.InOrder(
-		m.pmapiClient.EXPECT().AuthSalt().Return("", nil),
-		m.pmapiClient.EXPECT().Unlock([]byte(testCredentials.MailboxPassword)).Return(nil),
-		m.pmapiClient.EXPECT().CurrentUser().Return(testPMAPIUser, nil),
-		m.pmapiClient.EXPECT().DeleteAuth(),
+		m.pmapiClient.EXPECT().AuthSalt(gomock.Any()).Return("", nil),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte(testCredentials.MailboxPassword)).Return(nil),
+		m.pmapiClient.EXPECT().CurrentUser(gomock.Any()).Return(testPMAPIUser, nil),
+		m.pmapiClient.EXPECT().DeleteAuth(gomock.Any()),
 		m.pmapiClient.EXPECT().Logout(),
 	)
 
@@ -218,6 +218,50 @@ func TestUsersFinishLoginConnectedUser(t *testing.T) {
 	assert.Equal(t, "user is already connected", err.Error())
 }
 
+func TestUsersFinishReloginUnknownUser(t *testing.T) {
+	m := initMocks(t)
+	defer m.ctrl.Finish()
+
+	m.credentialsStore.EXPECT().List().Return([]string{}, nil)
+
+	users := testNewUsers(t, m)
+	defer cleanUpUsersData(users)
+
+	_, err := users.FinishRelogin("user", m.pmapiClient, testAuth, testCredentials.MailboxPassword)
+	assert.Equal(t, ErrUnknownUser, err)
+}
+
+func TestUsersFinishReloginWrongAccount(t *testing.T) {
+	m := initMocks(t)
+	defer m.ctrl.Finish()
+
+	m.clientManager.EXPECT().GetClient("user").Return(m.pmapiClient).MinTimes(1)
+	m.credentialsStore.EXPECT().List().Return([]string{"user"}, nil)
+
+	mockConnectedUser(m)
+	mockEventLoopNoAction(m)
+
+	users := testNewUsers(t, m)
+	defer cleanUpUsersData(users)
+
+	otherUser := *testPMAPIUser
+	otherUser.ID = "other"
+	otherUser.Name = "other"
+
+	// Credentials of another account must not replace the session.
+	gomock.InOrder(
+		m.pmapiClient.EXPECT().AuthSalt(gomock.Any()).Return("", nil),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte(testCredentials.MailboxPassword)).Return(nil),
+		m.pmapiClient.EXPECT().CurrentUser(gomock.Any()).Return(&otherUser, nil),
+		m.pmapiClient.EXPECT().DeleteAuth(gomock.Any()),
+		m.pmapiClient.EXPECT().Logout(),
+	)
+
+	_, err := users.FinishRelogin("user", m.pmapiClient, testAuth, testCredentials.MailboxPassword)
+	assert.Equal(t, ErrWrongAccount, err)
+	assert.True(t, users.users[0].IsConnected())
+}
+
 func checkUsersFinishLogin(t *testing.T, m mocks, auth *pmapi.Auth, mailboxPassword string, expectedUserID string, expectedErr error) *User {
 	users := testNewUsers(t, m)
 	defer cleanUpUsersData(users)
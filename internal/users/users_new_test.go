@@ -20,6 +20,7 @@ package users
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/internal/users/credentials"
@@ -37,6 +38,37 @@ func TestNewUsersNoKeychain(t *testing.T) {
 	checkUsersNew(t, m, []*credentials.Credentials{})
 }
 
+func TestNewUsersLockedKeychain(t *testing.T) {
+	m := initMocks(t)
+	defer m.ctrl.Finish()
+
+	defer func(minDelay, maxDelay time.Duration) {
+		keychainRetryMinDelay, keychainRetryMaxDelay = minDelay, maxDelay
+	}(keychainRetryMinDelay, keychainRetryMaxDelay)
+	keychainRetryMinDelay, keychainRetryMaxDelay = 10*time.Millisecond, 20*time.Millisecond
+
+	m.clientManager.EXPECT().GetClient("user").Return(m.pmapiClient).MinTimes(1)
+
+	gomock.InOrder(
+		m.credentialsStore.EXPECT().List().Return([]string{}, errors.New("keychain is locked")),
+		m.credentialsStore.EXPECT().List().Return([]string{"user"}, nil),
+		m.credentialsStore.EXPECT().Get("user").Return(nil, errors.New("keychain is locked")),
+		m.credentialsStore.EXPECT().List().Return([]string{"user"}, nil),
+		m.credentialsStore.EXPECT().Get("user").Return(testCredentialsDisconnected, nil),
+		m.credentialsStore.EXPECT().Get("user").Return(testCredentialsDisconnected, nil),
+		m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return(nil, errors.New("ErrUnauthorized")),
+		m.pmapiClient.EXPECT().Addresses().Return(nil),
+		m.eventListener.EXPECT().Emit(events.UserRefreshEvent, "user"),
+	)
+
+	users := testNewUsers(t, m)
+	defer cleanUpUsersData(users)
+	defer users.StopWatchers()
+
+	assert.Eventually(t, func() bool { return !users.IsWaitingForKeychain() }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, len(users.GetUsers()))
+}
+
 func TestNewUsersWithoutUsersInCredentialsStore(t *testing.T) {
 	m := initMocks(t)
 	defer m.ctrl.Finish()
@@ -57,7 +89,7 @@ func TestNewUsersWithDisconnectedUser(t *testing.T) {
 		m.credentialsStore.EXPECT().List().Return([]string{"user"}, nil),
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentialsDisconnected, nil),
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentialsDisconnected, nil),
-		m.pmapiClient.EXPECT().ListLabels().Return(nil, errors.New("ErrUnauthorized")),
+		m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return(nil, errors.New("ErrUnauthorized")),
 		m.pmapiClient.EXPECT().Addresses().Return(nil),
 	)
 
@@ -74,7 +106,7 @@ func TestNewUsersWithConnectedUserWithBadToken(t *testing.T) {
 	m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil).Times(2)
 
 	m.credentialsStore.EXPECT().Logout("user").Return(nil)
-	m.pmapiClient.EXPECT().AuthRefresh("token").Return(nil, errors.New("bad token"))
+	m.pmapiClient.EXPECT().AuthRefresh(gomock.Any(), "token").Return(nil, errors.New("bad token"))
 
 	m.eventListener.EXPECT().Emit(events.LogoutEvent, "user")
 	m.eventListener.EXPECT().Emit(events.UserRefreshEvent, "user")
@@ -91,13 +123,13 @@ func mockConnectedUser(m mocks) {
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil),
 
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil),
-		m.pmapiClient.EXPECT().AuthRefresh("token").Return(testAuthRefresh, nil),
+		m.pmapiClient.EXPECT().AuthRefresh(gomock.Any(), "token").Return(testAuthRefresh, nil),
 
-		m.pmapiClient.EXPECT().Unlock([]byte(testCredentials.MailboxPassword)).Return(nil),
+		m.pmapiClient.EXPECT().Unlock(gomock.Any(), []byte(testCredentials.MailboxPassword)).Return(nil),
 
 		// Set up mocks for store initialisation for the authorized user.
-		m.pmapiClient.EXPECT().ListLabels().Return([]*pmapi.Label{}, nil),
-		m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil),
+		m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return([]*pmapi.Label{}, nil),
+		m.pmapiClient.EXPECT().CountMessages(gomock.Any(), "").Return([]*pmapi.MessagesCount{}, nil),
 		m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress}),
 	)
 }
@@ -143,7 +175,7 @@ func TestNewUsersWithUsers(t *testing.T) {
 		m.credentialsStore.EXPECT().Get("userDisconnected").Return(testCredentialsDisconnected, nil),
 		// Set up mocks for store initialisation for the unauth user.
 		m.clientManager.EXPECT().GetClient("userDisconnected").Return(m.pmapiClient),
-		m.pmapiClient.EXPECT().ListLabels().Return(nil, errors.New("ErrUnauthorized")),
+		m.pmapiClient.EXPECT().ListLabels(gomock.Any()).Return(nil, errors.New("ErrUnauthorized")),
 		m.clientManager.EXPECT().GetClient("userDisconnected").Return(m.pmapiClient),
 		m.pmapiClient.EXPECT().Addresses().Return(nil),
 	)
@@ -167,6 +199,7 @@ func TestNewUsersFirstStart(t *testing.T) {
 func checkUsersNew(t *testing.T, m mocks, expectedCredentials []*credentials.Credentials) {
 	users := testNewUsers(t, m)
 	defer cleanUpUsersData(users)
+	defer users.StopWatchers()
 
 	assert.Equal(m.t, len(expectedCredentials), len(users.GetUsers()))
 
@@ -0,0 +1,119 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package authpolicy describes how clients are allowed to authenticate to
+// the local IMAP and SMTP servers.
+package authpolicy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Supported SASL mechanisms.
+const (
+	Plain       = "PLAIN"
+	Login       = "LOGIN"
+	XOAuth2     = "XOAUTH2"
+	OAuthBearer = "OAUTHBEARER"
+)
+
+// TLSRequiredMessage is the message for clients which try to authenticate
+// over unencrypted connection.
+const TLSRequiredMessage = "Bridge requires encrypted connection for login, " +
+	"please set connection security to STARTTLS in your client"
+
+// Mechanisms is the list of all supported mechanisms in preferred order.
+var Mechanisms = []string{Plain, Login, XOAuth2, OAuthBearer} //nolint[gochecknoglobals]
+
+// Policy restricts authentication of local clients.
+type Policy struct {
+	// RequireTLS rejects authentication on connections which are not
+	// encrypted by SSL or STARTTLS.
+	RequireTLS bool
+
+	// Mechanisms allowed for authentication. All are allowed when empty.
+	Mechanisms []string
+
+	// Limiter blocks hosts with too many failed authentications. Nobody
+	// is blocked when nil.
+	Limiter *Limiter
+}
+
+// IsAllowed returns whether the mechanism can be used for authentication.
+func (p Policy) IsAllowed(mechanism string) bool {
+	if len(p.Mechanisms) == 0 {
+		return isSupported(mechanism)
+	}
+	for _, allowed := range p.Mechanisms {
+		if strings.EqualFold(allowed, mechanism) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPasswordAllowed returns whether any mechanism using plain password
+// (used also by IMAP LOGIN command) is allowed.
+func (p Policy) IsPasswordAllowed() bool {
+	return p.IsAllowed(Plain) || p.IsAllowed(Login)
+}
+
+// Allowed returns the list of allowed mechanisms.
+func (p Policy) Allowed() (allowed []string) {
+	for _, mechanism := range Mechanisms {
+		if p.IsAllowed(mechanism) {
+			allowed = append(allowed, mechanism)
+		}
+	}
+	return
+}
+
+// MechanismDisabledMessage is the message for clients which use mechanism
+// not allowed by the policy.
+func (p Policy) MechanismDisabledMessage(mechanism string) string {
+	return fmt.Sprintf(
+		"Authentication mechanism %v is disabled in Bridge, please set your client to use one of: %v",
+		strings.ToUpper(mechanism), strings.Join(p.Allowed(), ", "),
+	)
+}
+
+// ParseMechanisms parses comma-separated list of mechanisms. Empty value
+// means all mechanisms.
+func ParseMechanisms(value string) ([]string, error) {
+	mechanisms := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToUpper(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if !isSupported(item) {
+			return nil, fmt.Errorf("unsupported mechanism %q, supported are %v", item, strings.Join(Mechanisms, ", "))
+		}
+		mechanisms = append(mechanisms, item)
+	}
+	return mechanisms, nil
+}
+
+func isSupported(mechanism string) bool {
+	for _, supported := range Mechanisms {
+		if strings.EqualFold(supported, mechanism) {
+			return true
+		}
+	}
+	return false
+}
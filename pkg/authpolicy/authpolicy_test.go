@@ -0,0 +1,57 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package authpolicy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmptyPolicyAllowsAll(t *testing.T) {
+	p := Policy{}
+
+	require.Equal(t, Mechanisms, p.Allowed())
+	require.True(t, p.IsAllowed("plain"))
+	require.True(t, p.IsPasswordAllowed())
+	require.False(t, p.IsAllowed("CRAM-MD5"))
+}
+
+func TestPolicyRestrictsMechanisms(t *testing.T) {
+	p := Policy{Mechanisms: []string{XOAuth2, OAuthBearer}}
+
+	require.Equal(t, []string{XOAuth2, OAuthBearer}, p.Allowed())
+	require.True(t, p.IsAllowed("xoauth2"))
+	require.False(t, p.IsAllowed(Plain))
+	require.False(t, p.IsPasswordAllowed())
+	require.Contains(t, p.MechanismDisabledMessage("plain"), "PLAIN is disabled")
+	require.Contains(t, p.MechanismDisabledMessage("plain"), "XOAUTH2, OAUTHBEARER")
+}
+
+func TestParseMechanisms(t *testing.T) {
+	mechanisms, err := ParseMechanisms(" plain, LOGIN ,,")
+	require.NoError(t, err)
+	require.Equal(t, []string{Plain, Login}, mechanisms)
+
+	mechanisms, err = ParseMechanisms("")
+	require.NoError(t, err)
+	require.Empty(t, mechanisms)
+
+	_, err = ParseMechanisms("PLAIN,CRAM-MD5")
+	require.Error(t, err)
+}
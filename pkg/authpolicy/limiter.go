@@ -0,0 +1,132 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package authpolicy
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// TooManyFailuresMessage is the message for clients of hosts blocked by
+// the limiter.
+const TooManyFailuresMessage = "Too many failed authentications from your host, please try again later"
+
+// Limiter blocks hosts after too many failed authentications so passwords
+// cannot be guessed by remote clients. Clients on loopback are never
+// blocked. Nil limiter does not block anyone.
+type Limiter struct {
+	maxFailures int
+	window      time.Duration
+
+	lock  sync.Mutex
+	hosts map[string]*hostFailures
+	now   func() time.Time
+}
+
+// hostFailures counts failures since the first one in the window.
+type hostFailures struct {
+	count int
+	first time.Time
+}
+
+// NewLimiter returns limiter which blocks the host for the window once it
+// failed maxFailures times within the window.
+func NewLimiter(maxFailures int, window time.Duration) *Limiter {
+	return &Limiter{
+		maxFailures: maxFailures,
+		window:      window,
+		hosts:       make(map[string]*hostFailures),
+		now:         time.Now,
+	}
+}
+
+// IsBlocked returns whether the host of the address cannot authenticate.
+func (l *Limiter) IsBlocked(addr net.Addr) bool {
+	host, ok := l.getHost(addr)
+	if !ok {
+		return false
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	failures := l.getFailures(host)
+	return failures != nil && failures.count >= l.maxFailures
+}
+
+// AddFailure records failed authentication from the address.
+func (l *Limiter) AddFailure(addr net.Addr) {
+	host, ok := l.getHost(addr)
+	if !ok {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	failures := l.getFailures(host)
+	if failures == nil {
+		failures = &hostFailures{first: l.now()}
+		l.hosts[host] = failures
+	}
+	failures.count++
+}
+
+// AddSuccess forgets failures of the address.
+func (l *Limiter) AddSuccess(addr net.Addr) {
+	host, ok := l.getHost(addr)
+	if !ok {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	delete(l.hosts, host)
+}
+
+// getFailures returns failures of the host in the current window.
+func (l *Limiter) getFailures(host string) *hostFailures {
+	failures, ok := l.hosts[host]
+	if !ok {
+		return nil
+	}
+	if l.now().Sub(failures.first) >= l.window {
+		delete(l.hosts, host)
+		return nil
+	}
+	return failures
+}
+
+// getHost returns IP of the address unless it is loopback.
+func (l *Limiter) getHost(addr net.Addr) (string, bool) {
+	if l == nil || addr == nil {
+		return "", false
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return "", false
+	}
+	return host, true
+}
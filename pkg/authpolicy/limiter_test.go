@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package authpolicy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterBlocksHost(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(3, time.Minute)
+	l.now = func() time.Time { return now }
+
+	remote := &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 50000}
+	otherPort := &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 50001}
+	other := &net.TCPAddr{IP: net.ParseIP("192.168.1.11"), Port: 50000}
+
+	for i := 0; i < 3; i++ {
+		require.False(t, l.IsBlocked(remote))
+		l.AddFailure(remote)
+	}
+	require.True(t, l.IsBlocked(otherPort))
+	require.False(t, l.IsBlocked(other))
+
+	now = now.Add(time.Minute)
+	require.False(t, l.IsBlocked(remote))
+
+	l.AddFailure(remote)
+	l.AddFailure(remote)
+	l.AddSuccess(remote)
+	l.AddFailure(remote)
+	require.False(t, l.IsBlocked(remote))
+}
+
+func TestLimiterIgnoresLoopback(t *testing.T) {
+	l := NewLimiter(1, time.Minute)
+
+	local := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 50000}
+	l.AddFailure(local)
+	l.AddFailure(local)
+	require.False(t, l.IsBlocked(local))
+
+	var nilLimiter *Limiter
+	nilLimiter.AddFailure(&net.TCPAddr{IP: net.ParseIP("192.168.1.10")})
+	require.False(t, nilLimiter.IsBlocked(&net.TCPAddr{IP: net.ParseIP("192.168.1.10")}))
+}
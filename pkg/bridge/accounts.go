@@ -0,0 +1,171 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"context"
+
+	"github.com/ProtonMail/proton-bridge/internal/users"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNoTwoFactor      = errors.New("account does not use two factor authentication")
+	ErrLoginFinished    = errors.New("login is already finished")
+	ErrTwoFactorPending = errors.New("two factor code was not submitted")
+)
+
+// Account is a logged in account. IMAP and SMTP clients use one of the
+// addresses, or the username, with BridgePassword.
+type Account struct {
+	ID             string
+	Username       string
+	Addresses      []string
+	Connected      bool
+	BridgePassword string
+}
+
+func newAccount(user *users.User) Account {
+	return Account{
+		ID:             user.ID(),
+		Username:       user.Username(),
+		Addresses:      user.GetAddresses(),
+		Connected:      user.IsConnected(),
+		BridgePassword: user.GetBridgePassword(),
+	}
+}
+
+// Accounts returns all accounts known to bridge including those which are
+// logged out.
+func (b *Bridge) Accounts() []Account {
+	accounts := []Account{}
+	for _, user := range b.bridge.GetUsers() {
+		accounts = append(accounts, newAccount(user))
+	}
+	return accounts
+}
+
+// GetAccount returns the account with the given ID, username or address.
+func (b *Bridge) GetAccount(query string) (Account, error) {
+	user, err := b.bridge.GetUser(query)
+	if err != nil {
+		return Account{}, err
+	}
+	return newAccount(user), nil
+}
+
+// Logout logs the account out but keeps it in the list of accounts.
+func (b *Bridge) Logout(query string) error {
+	user, err := b.bridge.GetUser(query)
+	if err != nil {
+		return err
+	}
+	return user.Logout()
+}
+
+// DeleteAccount logs the account out and removes it. Local data such as
+// the message store are removed too when clearStore is true.
+func (b *Bridge) DeleteAccount(query string, clearStore bool) error {
+	user, err := b.bridge.GetUser(query)
+	if err != nil {
+		return err
+	}
+	return b.bridge.DeleteUser(user.ID(), clearStore)
+}
+
+// LoginSession is a login in progress started by Login.
+type LoginSession struct {
+	bridge   *Bridge
+	client   pmapi.Client
+	auth     *pmapi.Auth
+	password string
+
+	twoFactorDone bool
+	finished      bool
+}
+
+// Login authenticates the account by username and password. The login is
+// added to bridge by Finish, after the two factor code is submitted when
+// NeedsTwoFactor.
+func (b *Bridge) Login(username, password string) (*LoginSession, error) {
+	client, auth, err := b.bridge.Login(username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginSession{
+		bridge:   b,
+		client:   client,
+		auth:     auth,
+		password: password,
+	}, nil
+}
+
+// NeedsTwoFactor returns whether SubmitTwoFactor must be called before Finish.
+func (s *LoginSession) NeedsTwoFactor() bool {
+	return s.auth.HasTwoFactor() && !s.twoFactorDone
+}
+
+// NeedsMailboxPassword returns whether the account uses two password mode
+// and Finish must get the mailbox password.
+func (s *LoginSession) NeedsMailboxPassword() bool {
+	return s.auth.HasMailboxPassword()
+}
+
+// SubmitTwoFactor verifies the two factor code.
+func (s *LoginSession) SubmitTwoFactor(code string) error {
+	if s.finished {
+		return ErrLoginFinished
+	}
+	if !s.NeedsTwoFactor() {
+		return ErrNoTwoFactor
+	}
+
+	if _, err := s.client.Auth2FA(context.Background(), code, s.auth); err != nil {
+		return err
+	}
+
+	s.twoFactorDone = true
+	return nil
+}
+
+// Finish adds the account to bridge. The mailbox password is used only in
+// two password mode. The session cannot be used afterwards; on failure the
+// login has to start again.
+func (s *LoginSession) Finish(mailboxPassword string) (Account, error) {
+	if s.finished {
+		return Account{}, ErrLoginFinished
+	}
+	if s.NeedsTwoFactor() {
+		return Account{}, ErrTwoFactorPending
+	}
+
+	if !s.NeedsMailboxPassword() {
+		mailboxPassword = s.password
+	}
+
+	s.finished = true
+	s.password = ""
+
+	user, err := s.bridge.bridge.FinishLogin(s.client, s.auth, mailboxPassword)
+	if err != nil {
+		return Account{}, err
+	}
+	return newAccount(user), nil
+}
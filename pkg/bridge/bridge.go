@@ -0,0 +1,225 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package bridge provides a stable API to embed Bridge into other Go
+// applications. It manages accounts and their local stores and serves them
+// over IMAP and SMTP the same way the Bridge app does, without the frontends.
+//
+// A minimal embedding looks like:
+//
+//	b, err := bridge.New(bridge.Options{AppName: "myapp", Version: "1.0.0"})
+//	if err != nil { ... }
+//	defer b.Close()
+//
+//	b.OnEvent(bridge.EventSyncFinished, func(e bridge.Event) { ... })
+//
+//	if err := b.Start(); err != nil { ... }
+package bridge
+
+import (
+	"crypto/tls"
+	"sync"
+
+	core "github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/imap"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/smtp"
+	"github.com/ProtonMail/proton-bridge/internal/stats"
+	"github.com/ProtonMail/proton-bridge/internal/users/credentials"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/constants"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	log = logrus.WithField("pkg", "bridge-sdk") //nolint[gochecknoglobals]
+
+	ErrNoAppName      = errors.New("app name must be set")
+	ErrReservedName   = errors.New("app name is used by the Bridge app")
+	ErrAlreadyStarted = errors.New("bridge is already started")
+	ErrClosed         = errors.New("bridge is closed")
+)
+
+// Options configures the embedded bridge.
+type Options struct {
+	// AppName names the folders of settings, cache and logs and the keychain
+	// entries, so the data of the embedding application is kept apart from
+	// the Bridge app. It is also sent to the API as the client ID.
+	AppName string
+
+	// Version of the embedding application reported to the API.
+	Version string
+
+	// IMAPPort and SMTPPort are the local ports of the servers. Zero means
+	// the port stored in preferences, i.e. the default one on first start.
+	IMAPPort int
+	SMTPPort int
+
+	// SMTPSSL serves SMTP over implicit TLS instead of STARTTLS.
+	SMTPSSL bool
+
+	// PanicHandler is called with the value recovered from a panic in any
+	// goroutine started by bridge. By default the panic is logged and raised
+	// again, i.e. it crashes the application as if it was not recovered.
+	PanicHandler func(recovered interface{})
+}
+
+// server is the common part of the IMAP and SMTP servers.
+type server interface {
+	ListenAndServe()
+	Close()
+}
+
+// Bridge is an embedded bridge. It is safe for concurrent use.
+type Bridge struct {
+	options       Options
+	cfg           *config.Config
+	pref          *config.Preferences
+	tls           *tls.Config
+	panicHandler  *panicHandler
+	eventListener listener.Listener
+	bridge        *core.Bridge
+
+	lock    sync.Mutex
+	servers []server
+	hooks   []*hook
+	closed  bool
+}
+
+// New loads settings and accounts of the application and connects them to
+// the API. Servers are not started until Start is called.
+func New(options Options) (*Bridge, error) {
+	switch options.AppName {
+	case "":
+		return nil, ErrNoAppName
+	case "bridge", "importExport":
+		return nil, ErrReservedName
+	}
+
+	cfg := config.New(options.AppName, options.Version, constants.Revision, "")
+	if err := cfg.CreateDirs(); err != nil {
+		return nil, errors.Wrap(err, "cannot create folders")
+	}
+
+	certManager, err := config.NewCertManager(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get TLS certificate")
+	}
+
+	credentialsStore, err := credentials.NewStore(options.AppName)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open credentials store")
+	}
+
+	if err := stats.Load(cfg.GetStatsPath()); err != nil {
+		log.WithError(err).Error("Cannot load history of metrics, it is kept only in memory")
+	}
+
+	b := &Bridge{
+		options:       options,
+		cfg:           cfg,
+		pref:          preferences.New(cfg),
+		tls:           certManager.TLSConfig(),
+		panicHandler:  &panicHandler{handler: options.PanicHandler},
+		eventListener: listener.New(),
+	}
+	events.SetupEvents(b.eventListener)
+
+	cm := pmapi.NewClientManager(cfg.GetAPIConfig())
+	cm.SetRoundTripper(cfg.GetRoundTripper(cm, b.eventListener))
+
+	b.bridge = core.New(cfg, b.pref, b.panicHandler, b.eventListener, cm, credentialsStore)
+
+	return b, nil
+}
+
+// Start starts IMAP and SMTP servers for all accounts. Servers which cannot
+// listen report it by EventError.
+func (b *Bridge) Start() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if b.servers != nil {
+		return ErrAlreadyStarted
+	}
+
+	remoteAccess := core.LoadRemoteAccess(b.pref)
+	core.SetRemoteAccess(remoteAccess)
+	authPolicy := remoteAccess.HardenAuthPolicy(preferences.GetAuthPolicy(b.pref))
+
+	imapBackend := imap.NewIMAPBackend(b.panicHandler, b.eventListener, b.cfg, b.bridge)
+	smtpBackend := smtp.NewSMTPBackend(b.panicHandler, b.eventListener, b.pref, b.bridge)
+
+	b.servers = []server{
+		imap.NewIMAPServer(false, false, b.GetIMAPPort(), b.tls, authPolicy, imapBackend, b.eventListener),
+		smtp.NewSMTPServer(false, b.GetSMTPPort(), b.options.SMTPSSL, b.tls, authPolicy, smtpBackend, b.eventListener),
+	}
+
+	for _, s := range b.servers {
+		go func(s server) {
+			defer b.panicHandler.HandlePanic()
+			s.ListenAndServe()
+		}(s)
+	}
+
+	return nil
+}
+
+// Close stops the servers and event hooks. Accounts stay logged in and are
+// loaded again by the next New.
+func (b *Bridge) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+
+	for _, s := range b.servers {
+		s.Close()
+	}
+	b.bridge.StopWatchers()
+
+	for _, h := range b.hooks {
+		h.stop(b.eventListener)
+	}
+	b.hooks = nil
+}
+
+// GetIMAPPort returns the port of the IMAP server.
+func (b *Bridge) GetIMAPPort() int {
+	if b.options.IMAPPort != 0 {
+		return b.options.IMAPPort
+	}
+	return b.pref.GetInt(preferences.IMAPPortKey)
+}
+
+// GetSMTPPort returns the port of the SMTP server.
+func (b *Bridge) GetSMTPPort() int {
+	if b.options.SMTPPort != 0 {
+		return b.options.SMTPPort
+	}
+	return b.pref.GetInt(preferences.SMTPPortKey)
+}
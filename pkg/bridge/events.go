@@ -0,0 +1,106 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+)
+
+// hookDrainTimeout is how long events emitted before the hook was stopped
+// are waited for.
+const hookDrainTimeout = time.Second
+
+// EventType is the kind of change reported by Event.
+type EventType string
+
+// Data of the events are described next to each type.
+const (
+	EventError          EventType = events.ErrorEvent          // Error message, e.g. a server cannot listen.
+	EventLogout         EventType = events.LogoutEvent         // ID of the account logged out by the API.
+	EventAccountChanged EventType = events.UserRefreshEvent    // ID of the added, removed or changed account.
+	EventAddressChanged EventType = events.AddressChangedEvent // Address which changed.
+	EventInternetOff    EventType = events.InternetOffEvent    // No data.
+	EventInternetOn     EventType = events.InternetOnEvent     // No data.
+	EventNewMessage     EventType = events.NewMessageEvent     // Description of the new message.
+	EventSyncFinished   EventType = events.SyncFinishedEvent   // ID of the synced account.
+	EventSendFailed     EventType = events.SendFailedEvent     // Reason why sending failed.
+)
+
+// Event is a change in bridge reported to hooks added by OnEvent.
+type Event struct {
+	Type EventType
+	Data string
+}
+
+type hook struct {
+	eventType EventType
+	ch        chan string
+	done      chan struct{}
+}
+
+// OnEvent calls the handler for each event of the type until Close. Each
+// hook is called from its own goroutine, one event at a time.
+func (b *Bridge) OnEvent(eventType EventType, handler func(Event)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	h := &hook{
+		eventType: eventType,
+		ch:        make(chan string),
+		done:      make(chan struct{}),
+	}
+	b.eventListener.Add(string(eventType), h.ch)
+	b.hooks = append(b.hooks, h)
+
+	go func() {
+		defer b.panicHandler.HandlePanic()
+
+		for {
+			select {
+			case data := <-h.ch:
+				handler(Event{Type: eventType, Data: data})
+			case <-h.done:
+				return
+			}
+		}
+	}()
+}
+
+// stop removes the hook from the listener. Events emitted just before are
+// dropped so that the emitters are not blocked.
+func (h *hook) stop(eventListener listener.Listener) {
+	eventListener.Remove(string(h.eventType), h.ch)
+	close(h.done)
+
+	go func() {
+		for {
+			select {
+			case <-h.ch:
+			case <-time.After(hookDrainTimeout):
+				return
+			}
+		}
+	}()
+}
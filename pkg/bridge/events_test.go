@@ -0,0 +1,71 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBridge() *Bridge {
+	return &Bridge{
+		panicHandler:  &panicHandler{},
+		eventListener: listener.New(),
+	}
+}
+
+func TestOnEvent(t *testing.T) {
+	b := newTestBridge()
+
+	received := make(chan Event)
+	b.OnEvent(EventSyncFinished, func(e Event) { received <- e })
+
+	b.eventListener.Emit(string(EventSyncFinished), "userID")
+
+	select {
+	case e := <-received:
+		require.Equal(t, Event{Type: EventSyncFinished, Data: "userID"}, e)
+	case <-time.After(time.Second):
+		require.Fail(t, "event was not received")
+	}
+}
+
+func TestOnEventStopped(t *testing.T) {
+	b := newTestBridge()
+
+	received := make(chan Event, 1)
+	b.OnEvent(EventError, func(e Event) { received <- e })
+
+	for _, h := range b.hooks {
+		h.stop(b.eventListener)
+	}
+	b.closed = true
+
+	b.eventListener.Emit(string(EventError), "error")
+	b.OnEvent(EventError, func(e Event) { received <- e })
+	require.Len(t, b.hooks, 1)
+
+	select {
+	case e := <-received:
+		require.Fail(t, "stopped hook was called", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"runtime/debug"
+)
+
+type panicHandler struct {
+	handler func(recovered interface{})
+}
+
+// HandlePanic makes the panicHandler implement the panicHandler interface for bridge.
+func (ph *panicHandler) HandlePanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	if ph.handler != nil {
+		ph.handler(r)
+		return
+	}
+
+	log.WithField("stack", string(debug.Stack())).Error("Recovered from panic: ", r)
+	panic(r)
+}
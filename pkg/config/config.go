@@ -99,6 +99,29 @@ func (c *Config) ClearData() error {
 	return c.removeAllExcept(dirs, shouldRemove)
 }
 
+// ClearCache removes the local cache of the current version, i.e. databases,
+// event and IMAP info files and on-disk caches of messages, attachments and
+// search indexes, so it is rebuilt from the server. Preferences, lock and
+// update files are kept.
+func (c *Config) ClearCache() error {
+	cacheDirs := []string{
+		c.GetMessageCacheDir(),
+		c.GetAttachmentCacheDir(),
+		c.GetSearchIndexDir(),
+	}
+	for _, dir := range cacheDirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+
+	return c.removeExcept(c.GetDBDir(), func(filePath string) bool {
+		return isStoreDatabaseFile(filePath) ||
+			filePath == c.GetEventsPath() ||
+			filePath == c.GetIMAPCachePath()
+	})
+}
+
 // ClearOldData removes all old files, such as old log files or old versions of cache and so on.
 func (c *Config) ClearOldData() error {
 	// `appDirs` is parent for `appDirsVersion`.
@@ -116,10 +139,21 @@ func (c *Config) ClearOldData() error {
 			filePath != c.GetEventsPath() &&
 			filePath != c.GetIMAPCachePath() &&
 			filePath != c.GetLockPath() &&
+			filePath != c.GetRollbackDir() &&
 			filePath != c.GetPreferencesPath())
 	})
 }
 
+// isStoreDatabaseFile returns whether the file belongs to a store database,
+// either Bolt or SQLite including its journal.
+func isStoreDatabaseFile(fileName string) bool {
+	switch filepath.Ext(fileName) {
+	case ".db", ".sqlite", ".sqlite-wal", ".sqlite-shm":
+		return true
+	}
+	return false
+}
+
 func (c *Config) removeAllExcept(dirs []string, shouldRemove func(string) bool) error {
 	var result *multierror.Error
 	for _, dir := range dirs {
@@ -183,6 +217,19 @@ func (c *Config) GetLogDir() string {
 	return c.appDirs.UserLogs()
 }
 
+// GetReproDir returns folder for redacted reproduction bundles of messages
+// which failed to build. It is inside the log folder so it is included
+// in diagnostics but kept when old logs are removed.
+func (c *Config) GetReproDir() string {
+	return filepath.Join(c.appDirs.UserLogs(), "repro")
+}
+
+// GetCrashReportDir returns folder for crash reports waiting for the user
+// to send or discard them.
+func (c *Config) GetCrashReportDir() string {
+	return filepath.Join(c.appDirs.UserLogs(), "crash")
+}
+
 // GetLogPrefix returns prefix for log files. Bridge uses format vVERSION.
 func (c *Config) GetLogPrefix() string {
 	return "v" + c.version + "_" + c.revision
@@ -213,16 +260,105 @@ func (c *Config) GetIMAPCachePath() string {
 	return filepath.Join(c.appDirsVersion.UserCache(), "user_info.json")
 }
 
+// GetMessageCacheDir returns folder for on-disk cache of built messages.
+func (c *Config) GetMessageCacheDir() string {
+	return filepath.Join(c.appDirsVersion.UserCache(), "messages")
+}
+
+// GetMessageCacheKeyPath returns path to the key which encrypted caches
+// before each user got own key stored in the keychain. It is only removed.
+func (c *Config) GetMessageCacheKeyPath() string {
+	return filepath.Join(c.appDirs.UserConfig(), "message_cache.key")
+}
+
+// GetAttachmentCacheDir returns folder for on-disk cache of decrypted
+// attachments. It uses the message cache key.
+func (c *Config) GetAttachmentCacheDir() string {
+	return filepath.Join(c.appDirsVersion.UserCache(), "attachments")
+}
+
+// GetSearchIndexDir returns folder for encrypted full-text search indexes.
+func (c *Config) GetSearchIndexDir() string {
+	return filepath.Join(c.appDirsVersion.UserCache(), "search")
+}
+
+// GetKeychainPath returns path to the encrypted file used as keychain when
+// native one is not available.
+func (c *Config) GetKeychainPath() string {
+	return filepath.Join(c.appDirs.UserConfig(), "keychain.enc")
+}
+
+// GetLocalRulesPath returns path to user-editable file with local filter rules.
+func (c *Config) GetLocalRulesPath() string {
+	return filepath.Join(c.appDirs.UserConfig(), "rules.json")
+}
+
+// GetTemplatesDir returns folder with user-editable templates of messages
+// synthesized by bridge.
+func (c *Config) GetTemplatesDir() string {
+	return filepath.Join(c.appDirs.UserConfig(), "templates")
+}
+
+// GetCLIHistoryPath returns path to the history of commands of the CLI shell.
+func (c *Config) GetCLIHistoryPath() string {
+	return filepath.Join(c.appDirs.UserConfig(), "cli_history")
+}
+
+// GetLogAnonymizationKeyPath returns path to key of pseudonyms used in
+// anonymized logs. It is kept outside of the log folder.
+func (c *Config) GetLogAnonymizationKeyPath() string {
+	return filepath.Join(c.appDirs.UserConfig(), "log_anonymization.key")
+}
+
+// GetStatsPath returns path to the history of daily metrics. It is kept
+// outside of the cache folder so it survives upgrades which drop the cache.
+func (c *Config) GetStatsPath() string {
+	return filepath.Join(c.appDirs.UserConfig(), "stats.json")
+}
+
 // GetLockPath returns path to lock file to check if bridge is already running.
 func (c *Config) GetLockPath() string {
 	return filepath.Join(c.appDirsVersion.UserCache(), c.appName+".lock")
 }
 
+// GetInstanceSocketPath returns path to unix socket on which the running
+// bridge accepts requests of instances started later. The socket is in its
+// own folder accessible only by the user.
+func (c *Config) GetInstanceSocketPath() string {
+	return filepath.Join(c.appDirsVersion.UserCache(), "instance", "instance.sock")
+}
+
+// GetEventSocketPath returns path to unix socket publishing bridge events
+// to local automation tools. The socket is in its own folder accessible
+// only by the user.
+func (c *Config) GetEventSocketPath() string {
+	return filepath.Join(c.appDirsVersion.UserCache(), "events", "events.sock")
+}
+
+// GetGRPCSocketPath returns path to unix socket of the local gRPC control
+// API used by frontends. The socket has its own folder so that only the user
+// can reach it.
+func (c *Config) GetGRPCSocketPath() string {
+	return filepath.Join(c.appDirsVersion.UserCache(), "grpc", "grpc.sock")
+}
+
+// GetStartupAttemptsPath returns path to file counting starts which did not
+// finish yet, used to detect crash loops.
+func (c *Config) GetStartupAttemptsPath() string {
+	return filepath.Join(c.appDirsVersion.UserCache(), "startup_attempts")
+}
+
 // GetUpdateDir returns folder for update files; such as new binary.
 func (c *Config) GetUpdateDir() string {
 	return filepath.Join(c.appDirsVersion.UserCache(), "updates")
 }
 
+// GetRollbackDir returns folder keeping the previous version of the app after
+// in-place update. It is not versioned to survive the update.
+func (c *Config) GetRollbackDir() string {
+	return filepath.Join(c.appDirs.UserCache(), "rollback")
+}
+
 // GetPreferencesPath returns path to preference file.
 func (c *Config) GetPreferencesPath() string {
 	return filepath.Join(c.appDirsVersion.UserCache(), "prefs.json")
@@ -247,3 +383,13 @@ func (c *Config) GetDefaultIMAPPort() int {
 func (c *Config) GetDefaultSMTPPort() int {
 	return 1025
 }
+
+// GetDefaultCalDAVPort returns default Bridge CalDAV port.
+func (c *Config) GetDefaultCalDAVPort() int {
+	return 1080
+}
+
+// GetDefaultLDAPPort returns default Bridge LDAP port.
+func (c *Config) GetDefaultLDAPPort() int {
+	return 1389
+}
@@ -103,6 +103,27 @@ func TestClearDataWindows(t *testing.T) {
 	})
 }
 
+func TestClearCache(t *testing.T) {
+	m := initMocks(t)
+	defer m.ctrl.Finish()
+
+	createTestStructureLinux(m, testConfigDir)
+	versionedCacheDir := filepath.Join(testConfigDir, "cache", "c2")
+	require.NoError(t, os.MkdirAll(filepath.Join(versionedCacheDir, "messages", "userID"), 0700))
+	require.NoError(t, os.MkdirAll(filepath.Join(versionedCacheDir, "search"), 0700))
+	for _, name := range []string{"mailbox-userID.sqlite", "mailbox-userID.sqlite-wal"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(versionedCacheDir, name), []byte{}, 0600))
+	}
+
+	cfg := newConfig(testAppName, "v1", "rev123", "c2", m.appDir, m.appDirVersion)
+	require.NoError(t, cfg.ClearCache())
+	checkFileNames(t, versionedCacheDir, []string{
+		"bridge-test.lock",
+		"prefs.json",
+		"updates",
+	})
+}
+
 // OldData touches only cache folder.
 // Removes only c1 folder as nothing else is part of cache folder on Linux/Mac.
 func TestClearOldDataLinux(t *testing.T) {
@@ -133,6 +154,27 @@ func TestClearOldDataLinux(t *testing.T) {
 	})
 }
 
+// Previous version kept after in-place update has to survive the update.
+func TestClearOldDataKeepsRollback(t *testing.T) {
+	m := initMocks(t)
+	defer m.ctrl.Finish()
+
+	createTestStructureLinux(m, testConfigDir)
+	cfg := newConfig(testAppName, "v1", "rev123", "c2", m.appDir, m.appDirVersion)
+	require.NoError(t, os.MkdirAll(cfg.GetRollbackDir(), 0700))
+	require.NoError(t, cfg.ClearOldData())
+	checkFileNames(t, filepath.Join(testConfigDir, "cache"), []string{
+		"c2",
+		"c2/bridge-test.lock",
+		"c2/events.json",
+		"c2/mailbox-user@pm.me.db",
+		"c2/prefs.json",
+		"c2/updates",
+		"c2/user_info.json",
+		"rollback",
+	})
+}
+
 // OldData touches only cache folder. Removes everything except c2 folder
 // and bridge log files which are part of cache folder on Windows.
 func TestClearOldDataWindows(t *testing.T) {
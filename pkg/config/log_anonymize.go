@@ -0,0 +1,196 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	logAnonymizationKeySize = 32
+
+	// pseudonymSize is the number of hex characters of pseudonyms; enough
+	// to not collide within one log.
+	pseudonymSize = 12
+)
+
+var (
+	logAnonymizer     *anonymizer  //nolint[gochecknoglobals]
+	logAnonymizerLock sync.RWMutex //nolint[gochecknoglobals]
+
+	anonEmailRgx = regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9\-]+(\.[a-zA-Z0-9\-]+)+`) //nolint[gochecknoglobals]
+
+	// IDs of API objects are base64 encoded and usually end with `==`.
+	anonAPIIDRgx = regexp.MustCompile(`[a-zA-Z0-9_\-]{40,}={0,2}`) //nolint[gochecknoglobals]
+
+	// Subject as JSON field, logrus text field or message header.
+	anonSubjectJSONRgx   = regexp.MustCompile(`(?i)("subject"\s*:\s*)"(\\.|[^"\\])*"`) //nolint[gochecknoglobals]
+	anonSubjectFieldRgx  = regexp.MustCompile(`(?i)(\bsubject=)("(\\.|[^"\\])*"|\S*)`) //nolint[gochecknoglobals]
+	anonSubjectHeaderRgx = regexp.MustCompile(`(?i)(subject:)[^\r\n\\"]*`)             //nolint[gochecknoglobals]
+)
+
+// anonymizer replaces personal data in log entries by pseudonyms. The same
+// value always gets the same pseudonym, so entries about the same message
+// or account can be correlated without revealing the value. Pseudonyms are
+// keyed hashes so they cannot be reversed by hashing guessed values without
+// the key which never leaves the computer.
+type anonymizer struct {
+	key []byte
+}
+
+// SetLogAnonymization turns on replacing of email addresses, subjects and
+// IDs in all log entries by pseudonyms derived from key. Nil key turns it
+// off.
+func SetLogAnonymization(key []byte) {
+	logAnonymizerLock.Lock()
+	defer logAnonymizerLock.Unlock()
+
+	if key == nil {
+		logAnonymizer = nil
+		return
+	}
+
+	logAnonymizer = &anonymizer{key: key}
+}
+
+// IsLogAnonymized returns whether log entries are anonymized.
+func IsLogAnonymized() bool {
+	return getLogAnonymizer() != nil
+}
+
+func getLogAnonymizer() *anonymizer {
+	logAnonymizerLock.RLock()
+	defer logAnonymizerLock.RUnlock()
+
+	return logAnonymizer
+}
+
+// LoadLogAnonymizationKey returns the key for pseudonyms from keyPath. The
+// key is generated when it does not exist yet so pseudonyms are stable
+// across restarts.
+func LoadLogAnonymizationKey(keyPath string) ([]byte, error) {
+	key, err := ioutil.ReadFile(keyPath) //nolint[gosec]
+	if err == nil && len(key) == logAnonymizationKeySize {
+		return key, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key = make([]byte, logAnonymizationKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(keyPath, key, 0600); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// pseudonym returns stable replacement of the value of the given kind.
+func (a *anonymizer) pseudonym(kind, value string) string {
+	mac := hmac.New(sha256.New, a.key)
+	_, _ = mac.Write([]byte(kind + ":" + value))
+	return kind + "-" + hex.EncodeToString(mac.Sum(nil))[:pseudonymSize]
+}
+
+func (a *anonymizer) email(value string) string {
+	return a.pseudonym("email", strings.ToLower(value))
+}
+
+// text replaces subjects, email addresses and API IDs in free text.
+func (a *anonymizer) text(text string) string {
+	text = anonSubjectJSONRgx.ReplaceAllStringFunc(text, func(match string) string {
+		parts := anonSubjectJSONRgx.FindStringSubmatch(match)
+		return parts[1] + `"` + a.pseudonym("subject", strings.Trim(strings.TrimPrefix(match, parts[1]), `"`)) + `"`
+	})
+	text = anonSubjectFieldRgx.ReplaceAllStringFunc(text, func(match string) string {
+		parts := anonSubjectFieldRgx.FindStringSubmatch(match)
+		return parts[1] + a.pseudonym("subject", strings.Trim(parts[2], `"`))
+	})
+	text = anonSubjectHeaderRgx.ReplaceAllStringFunc(text, func(match string) string {
+		parts := anonSubjectHeaderRgx.FindStringSubmatch(match)
+		return parts[1] + " " + a.pseudonym("subject", strings.TrimSpace(strings.TrimPrefix(match, parts[1])))
+	})
+	text = anonEmailRgx.ReplaceAllStringFunc(text, a.email)
+	return anonAPIIDRgx.ReplaceAllStringFunc(text, func(id string) string {
+		return a.pseudonym("id", id)
+	})
+}
+
+// field anonymizes value of the log field. Fields named as IDs, addresses
+// or subjects are replaced as a whole; other text values are searched for
+// personal data.
+func (a *anonymizer) field(name string, value interface{}) interface{} {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case error:
+		text = v.Error()
+	default:
+		return value
+	}
+
+	name = strings.ToLower(name)
+	switch {
+	case name == "subject":
+		return a.pseudonym("subject", text)
+	case strings.HasSuffix(name, "id") && text != "" && !strings.ContainsAny(text, " \t"):
+		return a.pseudonym("id", text)
+	case anonEmailRgx.MatchString(text) && anonEmailRgx.FindString(text) == text:
+		return a.email(text)
+	default:
+		return a.text(text)
+	}
+}
+
+// entry returns a copy of the log entry with personal data replaced.
+func (a *anonymizer) entry(entry *logrus.Entry) *logrus.Entry {
+	anonymized := *entry
+	anonymized.Message = a.text(entry.Message)
+	anonymized.Data = make(logrus.Fields, len(entry.Data))
+
+	for name, value := range entry.Data {
+		if name == "pkg" {
+			anonymized.Data[name] = value
+			continue
+		}
+		anonymized.Data[name] = a.field(name, value)
+	}
+
+	return &anonymized
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+const testAPIID = "Fh8zTqjF9xjRMD3fdnnQlGCAOBHdbyABM1vqZK9fjtuMiSbXQvQwAvwMRlHRklzaDjM0xkmkUvXpB14nzrnZSA=="
+
+func TestLogAnonymization(t *testing.T) {
+	defer SetLogAnonymization(nil)
+
+	out := &bytes.Buffer{}
+	logrus.SetOutput(out)
+	defer logrus.SetOutput(os.Stderr)
+
+	logLevels.setup(&logrus.JSONFormatter{}, logrus.InfoLevel)
+	SetLogAnonymization([]byte("key"))
+	require.True(t, IsLogAnonymized())
+
+	logrus.WithField("pkg", "smtp").
+		WithField("messageID", testAPIID).
+		WithField("from", "Alice@Example.com").
+		WithField("subject", "Secret plans").
+		WithError(errors.New("cannot send to bob@example.com")).
+		Info("Sending message " + testAPIID + " from alice@example.com")
+
+	log := out.String()
+	for _, secret := range []string{testAPIID, "alice@example.com", "Alice@Example.com", "Secret plans", "bob@example.com"} {
+		require.NotContains(t, log, secret)
+	}
+	require.Contains(t, log, `"pkg":"smtp"`)
+
+	// The same values have the same pseudonyms.
+	a := getLogAnonymizer()
+	require.Contains(t, log, `"messageID":"`+a.pseudonym("id", testAPIID)+`"`)
+	require.Contains(t, log, "Sending message "+a.pseudonym("id", testAPIID)+" from "+a.email("alice@example.com"))
+	require.Contains(t, log, `"from":"`+a.email("alice@example.com")+`"`)
+	require.Contains(t, log, "cannot send to "+a.email("bob@example.com"))
+
+	SetLogAnonymization(nil)
+	require.False(t, IsLogAnonymized())
+
+	out.Reset()
+	logrus.WithField("from", "alice@example.com").Info("Plain")
+	require.Contains(t, out.String(), "alice@example.com")
+}
+
+func TestLogAnonymizationPseudonymsDependOnKey(t *testing.T) {
+	a := &anonymizer{key: []byte("key")}
+	b := &anonymizer{key: []byte("other key")}
+
+	require.Equal(t, a.email("alice@example.com"), a.email("ALICE@example.com"))
+	require.NotEqual(t, a.email("alice@example.com"), b.email("alice@example.com"))
+	require.NotEqual(t, a.email("alice@example.com"), a.email("bob@example.com"))
+
+	require.Equal(t, "Subject: "+a.pseudonym("subject", "Hello"), a.text("Subject: Hello"))
+	require.Equal(t, `{"Subject":"`+a.pseudonym("subject", "Hello")+`"}`, a.text(`{"Subject":"Hello"}`))
+	require.Equal(t, "subject="+a.pseudonym("subject", "Hello there"), a.text(`subject="Hello there"`))
+}
+
+func TestLoadLogAnonymizationKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log-anonymization")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "config", "log.key")
+
+	key, err := LoadLogAnonymizationKey(path)
+	require.NoError(t, err)
+	require.Len(t, key, logAnonymizationKeySize)
+
+	again, err := LoadLogAnonymizationKey(path)
+	require.NoError(t, err)
+	require.Equal(t, key, again)
+}
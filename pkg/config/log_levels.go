@@ -0,0 +1,174 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logLevels filters log entries by level configured for their subsystem.
+// Subsystem is the first part of the pkg field, e.g. imap for imap/uidplus.
+var logLevels = &levelFormatter{overrides: map[string]logrus.Level{}} //nolint[gochecknoglobals]
+
+type levelFormatter struct {
+	formatter    logrus.Formatter
+	lock         sync.RWMutex
+	defaultLevel logrus.Level
+	overrides    map[string]logrus.Level
+}
+
+// Format drops the entry when its subsystem is configured to log less.
+// Logrus itself checks only the most verbose configured level. Personal
+// data are replaced when the log is anonymized.
+func (f *levelFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if !f.isEnabled(entry) {
+		return nil, nil
+	}
+	if anonymizer := getLogAnonymizer(); anonymizer != nil {
+		entry = anonymizer.entry(entry)
+	}
+	return f.formatter.Format(entry)
+}
+
+func (f *levelFormatter) isEnabled(entry *logrus.Entry) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	level := f.defaultLevel
+	if pkg, ok := entry.Data["pkg"].(string); ok {
+		if override, ok := f.overrides[getSubsystem(pkg)]; ok {
+			level = override
+		}
+	}
+
+	return entry.Level <= level
+}
+
+func (f *levelFormatter) setup(formatter logrus.Formatter, level logrus.Level) {
+	f.lock.Lock()
+	f.formatter = formatter
+	f.defaultLevel = level
+	f.lock.Unlock()
+
+	logrus.SetFormatter(f)
+	f.updateLoggerLevel()
+}
+
+func (f *levelFormatter) updateLoggerLevel() {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	level := f.defaultLevel
+	for _, override := range f.overrides {
+		if override > level {
+			level = override
+		}
+	}
+	logrus.SetLevel(level)
+}
+
+func getSubsystem(pkg string) string {
+	if i := strings.IndexAny(pkg, "/-"); i >= 0 {
+		return pkg[:i]
+	}
+	return pkg
+}
+
+// ParseLogLevels parses comma-separated list of subsystem levels,
+// e.g. `imap=debug,pmapi=warn`.
+func ParseLogLevels(value string) (map[string]logrus.Level, error) {
+	levels := map[string]logrus.Level{}
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, "=", 2)
+		subsystem := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || subsystem == "" {
+			return nil, fmt.Errorf("expected subsystem=level, got %q", item)
+		}
+
+		level, err := logrus.ParseLevel(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+
+		levels[subsystem] = level
+	}
+
+	return levels, nil
+}
+
+// FormatLogLevels returns levels in the format accepted by ParseLogLevels.
+func FormatLogLevels(levels map[string]logrus.Level) string {
+	items := []string{}
+	for subsystem, level := range levels {
+		items = append(items, subsystem+"="+level.String())
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// SetLogLevels replaces levels of subsystems which should log differently
+// than the level set by SetupLog.
+func SetLogLevels(levels map[string]logrus.Level) {
+	logLevels.lock.Lock()
+	logLevels.overrides = map[string]logrus.Level{}
+	for subsystem, level := range levels {
+		logLevels.overrides[subsystem] = level
+	}
+	logLevels.lock.Unlock()
+
+	logLevels.updateLoggerLevel()
+}
+
+// RaiseLogLevel makes the log of all subsystems at least as verbose as
+// the given level, e.g. to record more details in safe mode.
+func RaiseLogLevel(level logrus.Level) {
+	logLevels.lock.Lock()
+	if level > logLevels.defaultLevel {
+		logLevels.defaultLevel = level
+	}
+	for subsystem, override := range logLevels.overrides {
+		if level > override {
+			logLevels.overrides[subsystem] = level
+		}
+	}
+	logLevels.lock.Unlock()
+
+	logLevels.updateLoggerLevel()
+}
+
+// GetLogLevels returns levels of subsystems set by SetLogLevels.
+func GetLogLevels() map[string]logrus.Level {
+	logLevels.lock.RLock()
+	defer logLevels.lock.RUnlock()
+
+	levels := map[string]logrus.Level{}
+	for subsystem, level := range logLevels.overrides {
+		levels[subsystem] = level
+	}
+	return levels
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLogLevels(t *testing.T) {
+	levels, err := ParseLogLevels("imap=debug, pmapi = warn,")
+	require.NoError(t, err)
+	require.Equal(t, map[string]logrus.Level{
+		"imap":  logrus.DebugLevel,
+		"pmapi": logrus.WarnLevel,
+	}, levels)
+	require.Equal(t, "imap=debug,pmapi=warning", FormatLogLevels(levels))
+
+	_, err = ParseLogLevels("imap")
+	require.Error(t, err)
+
+	_, err = ParseLogLevels("imap=loud")
+	require.Error(t, err)
+}
+
+func TestLogLevelsPerSubsystem(t *testing.T) {
+	defer SetLogLevels(nil)
+
+	out := &bytes.Buffer{}
+	logrus.SetOutput(out)
+	defer logrus.SetOutput(os.Stderr)
+
+	logLevels.setup(&logrus.JSONFormatter{}, logrus.InfoLevel)
+	SetLogLevels(map[string]logrus.Level{
+		"imap":  logrus.DebugLevel,
+		"pmapi": logrus.ErrorLevel,
+	})
+	require.Equal(t, logrus.DebugLevel, logrus.GetLevel())
+
+	logrus.WithField("pkg", "imap/uidplus").Debug("imap debug")
+	logrus.WithField("pkg", "smtp").Debug("smtp debug")
+	logrus.WithField("pkg", "smtp").Info("smtp info")
+	logrus.WithField("pkg", "pmapi").Warn("pmapi warn")
+
+	require.Contains(t, out.String(), "imap debug")
+	require.NotContains(t, out.String(), "smtp debug")
+	require.Contains(t, out.String(), "smtp info")
+	require.NotContains(t, out.String(), "pmapi warn")
+
+	SetLogLevels(nil)
+	require.Equal(t, logrus.InfoLevel, logrus.GetLevel())
+}
+
+func TestRaiseLogLevel(t *testing.T) {
+	defer SetLogLevels(nil)
+
+	logLevels.setup(&logrus.JSONFormatter{}, logrus.InfoLevel)
+	defer logLevels.setup(&logrus.JSONFormatter{}, logrus.InfoLevel)
+
+	SetLogLevels(map[string]logrus.Level{
+		"imap":  logrus.TraceLevel,
+		"pmapi": logrus.ErrorLevel,
+	})
+	RaiseLogLevel(logrus.DebugLevel)
+
+	require.Equal(t, map[string]logrus.Level{
+		"imap":  logrus.TraceLevel,
+		"pmapi": logrus.DebugLevel,
+	}, GetLogLevels())
+
+	entry := logrus.WithField("pkg", "smtp")
+	entry.Level = logrus.DebugLevel
+	require.True(t, logLevels.isEnabled(entry))
+}
@@ -19,7 +19,6 @@ package config
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -31,7 +30,6 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/ProtonMail/proton-bridge/pkg/sentry"
 	"github.com/sirupsen/logrus"
 )
 
@@ -55,15 +53,9 @@ var logFile *os.File //nolint[gochecknoglobals]
 var logFileRgx = regexp.MustCompile("^v.*\\.log$")           //nolint[gochecknoglobals]
 var logCrashRgx = regexp.MustCompile("^v.*_crash_.*\\.log$") //nolint[gochecknoglobals]
 
-// HandlePanic reports the crash to sentry or local file when sentry fails.
+// HandlePanic saves the crash to local file next to logs. It is not sent
+// anywhere; crash reports are sent only when the user agrees.
 func HandlePanic(cfg *Config, output string) {
-	if !cfg.IsDevMode() {
-		apiCfg := cfg.GetAPIConfig()
-		if err := sentry.ReportSentryCrash(apiCfg.ClientID, apiCfg.AppVersion, apiCfg.UserAgent, errors.New(output)); err != nil {
-			log.Error("Sentry crash report failed: ", err)
-		}
-	}
-
 	filename := getLogFilename(cfg.GetLogPrefix() + "_crash_")
 	filepath := filepath.Join(cfg.GetLogDir(), filename)
 	f, err := os.OpenFile(filepath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
@@ -95,18 +87,16 @@ func GetGID() uint64 {
 func SetupLog(cfg logConfiger, levelFlag string) (debugClient, debugServer bool) {
 	level, useFile := getLogLevelAndFile(levelFlag)
 
-	logrus.SetLevel(level)
-
 	if useFile {
-		logrus.SetFormatter(&logrus.JSONFormatter{})
+		logLevels.setup(&logrus.JSONFormatter{}, level)
 		setLogFile(cfg.GetLogDir(), cfg.GetLogPrefix())
 		watchLogFileSize(cfg.GetLogDir(), cfg.GetLogPrefix())
 	} else {
-		logrus.SetFormatter(&logrus.TextFormatter{
+		logLevels.setup(&logrus.TextFormatter{
 			ForceColors:     true,
 			FullTimestamp:   true,
 			TimestampFormat: time.StampMilli,
-		})
+		}, level)
 		logrus.SetOutput(os.Stdout)
 	}
 
@@ -28,7 +28,6 @@ import (
 	"math/big"
 	"net"
 	"os"
-	"os/exec"
 	"runtime"
 	"time"
 )
@@ -70,17 +69,7 @@ func GetTLSConfig(cfg tlsConfiger) (tlsConfig *tls.Config, err error) {
 		}
 
 		if runtime.GOOS == "darwin" {
-			if err := exec.Command( // nolint[gosec]
-				"/usr/bin/security",
-				"execute-with-privileges",
-				"/usr/bin/security",
-				"add-trusted-cert",
-				"-d",
-				"-r", "trustRoot",
-				"-p", "ssl",
-				"-k", "/Library/Keychains/System.keychain",
-				certPath,
-			).Run(); err != nil {
+			if err := InstallCert(certPath); err != nil {
 				log.WithError(err).Error("Failed to add cert to system keychain")
 			}
 		}
@@ -0,0 +1,80 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"runtime"
+)
+
+// linuxTrustStores are commands updating the trust store of Linux
+// distributions and folders from which they take certificates.
+var linuxTrustStores = []struct{ command, certPath string }{ //nolint[gochecknoglobals]
+	{"update-ca-certificates", "/usr/local/share/ca-certificates/protonmail-bridge.crt"},
+	{"update-ca-trust", "/etc/pki/ca-trust/source/anchors/protonmail-bridge.pem"},
+}
+
+// InstallCert adds the certificate to the trust store of the system so
+// clients verifying certificates accept it. It usually needs permissions
+// of the administrator.
+func InstallCert(certPath string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command( // nolint[gosec]
+			"/usr/bin/security",
+			"execute-with-privileges",
+			"/usr/bin/security",
+			"add-trusted-cert",
+			"-d",
+			"-r", "trustRoot",
+			"-p", "ssl",
+			"-k", "/Library/Keychains/System.keychain",
+			certPath,
+		).Run()
+
+	case "windows":
+		return exec.Command("certutil", "-addstore", "-user", "Root", certPath).Run() // nolint[gosec]
+
+	case "linux":
+		for _, store := range linuxTrustStores {
+			if _, err := exec.LookPath(store.command); err != nil {
+				continue
+			}
+			if err := ExportCert(certPath, store.certPath); err != nil {
+				return err
+			}
+			return exec.Command(store.command).Run() // nolint[gosec]
+		}
+		return errors.New("no supported trust store found")
+
+	default:
+		return fmt.Errorf("installing certificate is not supported on %s", runtime.GOOS)
+	}
+}
+
+// ExportCert copies the certificate in PEM format to the path.
+func ExportCert(certPath, path string) error {
+	cert, err := ioutil.ReadFile(certPath) //nolint[gosec]
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, cert, 0644) //nolint[gosec]
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// certRotateBefore is how long before the expiry the certificate is rotated.
+	certRotateBefore = 31 * 24 * time.Hour
+
+	// certGracePeriod is how long the previous certificate is trusted after
+	// rotation, e.g. by other running instance using it as client certificate.
+	certGracePeriod = 7 * 24 * time.Hour
+
+	certCheckInterval = 24 * time.Hour
+
+	previousCertSuffix = ".prev"
+)
+
+// CertManager provides TLS config with the bridge certificate and rotates
+// the certificate before it expires. The config picks up the new certificate
+// for new connections, so servers don't have to be restarted.
+type CertManager struct {
+	certPath, keyPath string
+
+	lock     sync.RWMutex
+	current  *tls.Certificate
+	previous *tls.Certificate
+	config   *tls.Config
+}
+
+// NewCertManager loads the certificate, generating or rotating it when needed.
+func NewCertManager(cfg tlsConfiger) (*CertManager, error) {
+	m := &CertManager{
+		certPath: cfg.GetTLSCertPath(),
+		keyPath:  cfg.GetTLSKeyPath(),
+	}
+
+	current, err := loadCertificate(m.certPath, m.keyPath)
+	if err != nil {
+		log.WithError(err).Warn("Cannot load cert, generating a new one")
+		if current, err = m.generate(); err != nil {
+			return nil, err
+		}
+	}
+	m.current = current
+
+	if previous, err := loadCertificate(m.certPath+previousCertSuffix, m.keyPath+previousCertSuffix); err == nil {
+		m.previous = previous
+	}
+
+	if _, err := m.CheckRotation(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// TLSConfig returns config for servers and clients of bridge. Servers get
+// the current certificate for each connection.
+func (m *CertManager) TLSConfig() *tls.Config {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	tlsConfig := m.config.Clone()
+	tlsConfig.GetConfigForClient = m.getConfigForClient
+	return tlsConfig
+}
+
+func (m *CertManager) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.config, nil
+}
+
+// NotAfter returns expiry of the current certificate.
+func (m *CertManager) NotAfter() time.Time {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.current.Leaf.NotAfter
+}
+
+// Watch checks every day whether the certificate should be rotated.
+func (m *CertManager) Watch() {
+	ticker := time.NewTicker(certCheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if _, err := m.CheckRotation(now); err != nil {
+			log.WithError(err).Error("Cannot rotate TLS certificate")
+		}
+	}
+}
+
+// CheckRotation rotates the certificate when it is about to expire and
+// forgets the previous one when its grace period is over.
+func (m *CertManager) CheckRotation(now time.Time) (rotated bool, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.previous != nil && !m.isPreviousValid(now) {
+		log.Info("Removing previous TLS certificate")
+		m.previous = nil
+		_ = os.Remove(m.certPath + previousCertSuffix)
+		_ = os.Remove(m.keyPath + previousCertSuffix)
+	}
+
+	if now.Add(certRotateBefore).After(m.current.Leaf.NotAfter) {
+		if err := m.rotate(); err != nil {
+			return false, err
+		}
+		rotated = true
+	}
+
+	m.config = m.buildConfig()
+	return rotated, nil
+}
+
+// isPreviousValid returns whether the previous certificate is still in its
+// grace period. The time of rotation is the time it was moved aside.
+func (m *CertManager) isPreviousValid(now time.Time) bool {
+	if now.After(m.previous.Leaf.NotAfter) {
+		return false
+	}
+
+	info, err := os.Stat(m.certPath + previousCertSuffix)
+	if err != nil {
+		return false
+	}
+	return now.Before(info.ModTime().Add(certGracePeriod))
+}
+
+// rotate keeps the current certificate as the previous one and generates
+// a new one.
+func (m *CertManager) rotate() error {
+	log.WithField("notAfter", m.current.Leaf.NotAfter).Info("Rotating TLS certificate")
+
+	if err := os.Rename(m.certPath, m.certPath+previousCertSuffix); err != nil {
+		return err
+	}
+	if err := os.Rename(m.keyPath, m.keyPath+previousCertSuffix); err != nil {
+		return err
+	}
+
+	// Rename sets no time, the modification time marks start of grace period.
+	now := time.Now()
+	_ = os.Chtimes(m.certPath+previousCertSuffix, now, now)
+
+	current, err := m.generate()
+	if err != nil {
+		_ = os.Rename(m.certPath+previousCertSuffix, m.certPath)
+		_ = os.Rename(m.keyPath+previousCertSuffix, m.keyPath)
+		return errors.Wrap(err, "failed to generate new certificate")
+	}
+
+	m.previous = m.current
+	m.current = current
+	return nil
+}
+
+func (m *CertManager) generate() (*tls.Certificate, error) {
+	tlsConfig, err := GenerateTLSConfig(m.certPath, m.keyPath)
+	if err != nil && err != ErrTLSCertExpireSoon {
+		return nil, err
+	}
+
+	if runtime.GOOS == "darwin" {
+		if err := InstallCert(m.certPath); err != nil {
+			log.WithError(err).Error("Failed to add cert to system keychain")
+		}
+	}
+
+	return &tlsConfig.Certificates[0], nil
+}
+
+func (m *CertManager) buildConfig() *tls.Config {
+	caCertPool := x509.NewCertPool()
+	caCertPool.AddCert(m.current.Leaf)
+	if m.previous != nil {
+		caCertPool.AddCert(m.previous.Leaf)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{*m.current},
+		ServerName:   "127.0.0.1",
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		RootCAs:      caCertPool,
+		ClientCAs:    caCertPool,
+	}
+}
+
+func loadCertificate(certPath, keyPath string) (*tls.Certificate, error) {
+	tlsConfig, err := loadTLSConfig(certPath, keyPath)
+	if err != nil && err != ErrTLSCertExpireSoon {
+		return nil, err
+	}
+	return &tlsConfig.Certificates[0], nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertManagerRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manager")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	cfg := &testTLSConfig{filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")}
+
+	defer func(notBefore, notAfter time.Time) {
+		tlsTemplate.NotBefore, tlsTemplate.NotAfter = notBefore, notAfter
+	}(tlsTemplate.NotBefore, tlsTemplate.NotAfter)
+
+	// Certificate valid for 60 days is not rotated yet.
+	tlsTemplate.NotBefore = time.Now()
+	tlsTemplate.NotAfter = time.Now().Add(60 * 24 * time.Hour)
+
+	m, err := NewCertManager(cfg)
+	require.NoError(t, err)
+	oldNotAfter := m.NotAfter()
+
+	serverConfig, err := m.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	oldCert := serverConfig.Certificates[0].Leaf
+
+	// Certificate is rotated 31 days before expiry.
+	tlsTemplate.NotAfter = time.Now().Add(2 * 365 * 24 * time.Hour)
+	rotated, err := m.CheckRotation(time.Now().Add(30 * 24 * time.Hour))
+	require.NoError(t, err)
+	require.True(t, rotated)
+	require.True(t, m.NotAfter().After(oldNotAfter))
+	require.FileExists(t, cfg.certPath+previousCertSuffix)
+
+	// New connections get the new certificate, the previous one is still trusted.
+	serverConfig, err = m.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	require.Equal(t, m.NotAfter(), serverConfig.Certificates[0].Leaf.NotAfter)
+	_, err = oldCert.Verify(x509VerifyOptions(serverConfig))
+	require.NoError(t, err)
+
+	// Manager started during the grace period keeps the previous certificate.
+	m, err = NewCertManager(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, m.previous)
+
+	// Previous certificate is removed after the grace period.
+	rotated, err = m.CheckRotation(time.Now().Add(certGracePeriod + time.Hour))
+	require.NoError(t, err)
+	require.False(t, rotated)
+	require.Nil(t, m.previous)
+	_, err = os.Stat(cfg.certPath + previousCertSuffix)
+	require.True(t, os.IsNotExist(err))
+
+	serverConfig, err = m.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	_, err = oldCert.Verify(x509VerifyOptions(serverConfig))
+	require.Error(t, err)
+}
+
+func TestExportCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-export")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	cfg := &testTLSConfig{filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")}
+	_, err = NewCertManager(cfg)
+	require.NoError(t, err)
+
+	exported := filepath.Join(dir, "exported.pem")
+	require.NoError(t, ExportCert(cfg.certPath, exported))
+
+	want, err := ioutil.ReadFile(cfg.certPath)
+	require.NoError(t, err)
+	got, err := ioutil.ReadFile(exported)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
+func x509VerifyOptions(tlsConfig *tls.Config) x509.VerifyOptions {
+	return x509.VerifyOptions{
+		Roots:     tlsConfig.ClientCAs,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package connlimit protects the local IMAP and SMTP servers from clients
+// which open too many connections, e.g. misconfigured clients reconnecting
+// in a loop, so they cannot exhaust file descriptors or API rate limits.
+package connlimit
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TooManyConnectionsMessage is the message for clients whose account has
+// all allowed sessions open already.
+const TooManyConnectionsMessage = "Too many simultaneous connections of the account, " +
+	"close other connections or check that your client does not reconnect in a loop"
+
+// ErrTooManyConnections is returned when the account reached its limit.
+var ErrTooManyConnections = errors.New(TooManyConnectionsMessage) //nolint[gochecknoglobals]
+
+// Limits of connections. Zero means no limit.
+type Limits struct {
+	// MaxPerAccount is how many authenticated sessions one account can
+	// have open at the same time.
+	MaxPerAccount int
+
+	// IdleTimeout closes connections which neither sent nor received
+	// anything for the duration.
+	IdleTimeout time.Duration
+}
+
+// Tracker counts open sessions of accounts and refuses new ones over
+// the limit.
+type Tracker struct {
+	lock   sync.Mutex
+	limits Limits
+	counts map[string]int
+}
+
+// NewTracker returns tracker without limits.
+func NewTracker() *Tracker {
+	return &Tracker{counts: map[string]int{}}
+}
+
+// SetLimits changes limits. Sessions over the new limit are not closed,
+// new sessions are refused until enough of them end.
+func (t *Tracker) SetLimits(limits Limits) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.limits = limits
+}
+
+// Limits returns current limits.
+func (t *Tracker) Limits() Limits {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.limits
+}
+
+// IdleTimeout returns current idle timeout. It can be passed to
+// NewIdleListener so changes apply also to open connections.
+func (t *Tracker) IdleTimeout() time.Duration {
+	return t.Limits().IdleTimeout
+}
+
+// Acquire registers a new session of the account. The returned release
+// must be called when the session ends; calling it more times is safe.
+func (t *Tracker) Acquire(account string) (release func(), err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.limits.MaxPerAccount > 0 && t.counts[account] >= t.limits.MaxPerAccount {
+		return nil, ErrTooManyConnections
+	}
+	t.counts[account]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { t.release(account) })
+	}, nil
+}
+
+func (t *Tracker) release(account string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.counts[account]--; t.counts[account] <= 0 {
+		delete(t.counts, account)
+	}
+}
+
+// Count returns the number of open sessions of the account.
+func (t *Tracker) Count(account string) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.counts[account]
+}
+
+// Counts returns the number of open sessions of every account with at
+// least one session.
+func (t *Tracker) Counts() map[string]int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	counts := make(map[string]int, len(t.counts))
+	for account, count := range t.counts {
+		counts[account] = count
+	}
+	return counts
+}
+
+// Accounts returns accounts with open sessions in alphabetical order.
+func (t *Tracker) Accounts() []string {
+	counts := t.Counts()
+
+	accounts := make([]string, 0, len(counts))
+	for account := range counts {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	return accounts
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package connlimit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker()
+	tracker.SetLimits(Limits{MaxPerAccount: 2})
+
+	release1, err := tracker.Acquire("user1")
+	require.NoError(t, err)
+	release2, err := tracker.Acquire("user1")
+	require.NoError(t, err)
+	_, err = tracker.Acquire("user2")
+	require.NoError(t, err)
+
+	_, err = tracker.Acquire("user1")
+	require.Equal(t, ErrTooManyConnections, err)
+	require.Equal(t, map[string]int{"user1": 2, "user2": 1}, tracker.Counts())
+	require.Equal(t, []string{"user1", "user2"}, tracker.Accounts())
+
+	release1()
+	release1()
+	require.Equal(t, 1, tracker.Count("user1"))
+
+	_, err = tracker.Acquire("user1")
+	require.NoError(t, err)
+
+	tracker.SetLimits(Limits{})
+	_, err = tracker.Acquire("user1")
+	require.NoError(t, err)
+	require.Equal(t, 3, tracker.Count("user1"))
+
+	release2()
+	require.Equal(t, 2, tracker.Count("user1"))
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package connlimit
+
+import (
+	"net"
+	"time"
+)
+
+// NewIdleListener wraps the listener so accepted connections are closed
+// when they are idle for the timeout. Servers set deadlines after every
+// command and response; the wrapper replaces them by the idle timeout.
+// The timeout is read every time, so changes apply to open connections
+// after their next command. Deadlines are kept as requested when the
+// timeout is zero.
+func NewIdleListener(l net.Listener, timeout func() time.Duration) net.Listener {
+	return &idleListener{Listener: l, timeout: timeout}
+}
+
+type idleListener struct {
+	net.Listener
+
+	timeout func() time.Duration
+}
+
+func (l *idleListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &idleConn{Conn: conn, timeout: l.timeout}, nil
+}
+
+type idleConn struct {
+	net.Conn
+
+	timeout func() time.Duration
+}
+
+func (c *idleConn) deadline(t time.Time) time.Time {
+	if timeout := c.timeout(); timeout > 0 {
+		return time.Now().Add(timeout)
+	}
+	return t
+}
+
+func (c *idleConn) SetDeadline(t time.Time) error {
+	return c.Conn.SetDeadline(c.deadline(t))
+}
+
+func (c *idleConn) SetReadDeadline(t time.Time) error {
+	return c.Conn.SetReadDeadline(c.deadline(t))
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package connlimit
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	timeout := time.Duration(0)
+	idle := NewIdleListener(l, func() time.Duration { return timeout })
+	defer idle.Close() //nolint[errcheck]
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close() //nolint[errcheck]
+
+	conn, err := idle.Accept()
+	require.NoError(t, err)
+	defer conn.Close() //nolint[errcheck]
+
+	// Requested deadline is kept without timeout.
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(-time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.True(t, err.(net.Error).Timeout())
+
+	// Timeout replaces the requested deadline.
+	timeout = 50 * time.Millisecond
+	require.NoError(t, conn.SetReadDeadline(time.Time{}))
+	start := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.True(t, err.(net.Error).Timeout())
+	require.True(t, time.Since(start) < 5*time.Second)
+}
@@ -41,9 +41,10 @@ var (
 	accessLocker           = &sync.Mutex{} //nolint[gochecknoglobals]
 )
 
-// NewAccess creates a new native keychain.
+// NewAccess creates a new native keychain, or file keychain if configured
+// by SetFileOptions.
 func NewAccess(appName string) (*Access, error) {
-	newHelper, err := newKeychain()
+	newHelper, err := newHelper()
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +108,10 @@ func (s *osxkeychain) Get(serverURL string) (userID string, secret string, err e
 
 // ListKeychain lists items in our services.
 func (s *Access) ListKeychain() (userIDByURL map[string]string, err error) {
+	if _, ok := s.helper.(*FileHelper); ok {
+		return s.helper.List()
+	}
+
 	// Pick up correct service name and trim '/'.
 	serviceName, _, err := splitServiceAndID(s.KeychainOldName("not-id"))
 	if err != nil {
@@ -0,0 +1,260 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package keychain
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"golang.org/x/crypto/argon2"
+)
+
+// Parameters of key derivation; recommended values of argon2id.
+const (
+	fileSaltLength = 16
+	fileKeyTime    = 1
+	fileKeyMemory  = 64 * 1024
+	fileKeyThreads = 4
+	fileKeyLength  = 32
+)
+
+// FilePassphraseEnv is the environment variable with passphrase of the file
+// keychain. GUI cannot ask for the passphrase, so it has to be set there.
+const FilePassphraseEnv = "BRIDGE_KEYCHAIN_PASSPHRASE"
+
+var (
+	ErrNoPassphrase    = errors.New("passphrase of file keychain is not set")
+	ErrWrongPassphrase = errors.New("wrong passphrase of file keychain or corrupted file")
+)
+
+// FileOptions configures the keychain stored in an encrypted file.
+type FileOptions struct {
+	Path       string
+	Passphrase string
+
+	// Force makes the file keychain used even when native one is available.
+	// Otherwise it is used only as a fallback.
+	Force bool
+}
+
+var (
+	fileOptions       FileOptions  //nolint[gochecknoglobals]
+	fileOptionsLocker sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetFileOptions configures the file keychain used by NewAccess.
+func SetFileOptions(opts FileOptions) {
+	fileOptionsLocker.Lock()
+	defer fileOptionsLocker.Unlock()
+	fileOptions = opts
+}
+
+func getFileOptions() FileOptions {
+	fileOptionsLocker.RLock()
+	defer fileOptionsLocker.RUnlock()
+	return fileOptions
+}
+
+// newHelper returns the native keychain or, when it is not available or
+// the file is forced, the file keychain.
+func newHelper() (credentials.Helper, error) {
+	opts := getFileOptions()
+	if !opts.Force {
+		helper, err := newKeychain()
+		if err == nil || opts.Path == "" || opts.Passphrase == "" {
+			return helper, err
+		}
+		log.WithError(err).Warn("Native keychain is not available, using encrypted file")
+	}
+	return NewFileHelper(opts.Path, opts.Passphrase)
+}
+
+type fileItem struct {
+	Username string
+	Secret   string
+}
+
+// FileHelper stores credentials in a file encrypted by AES-GCM with a key
+// derived from the passphrase by argon2id. The file consists of the salt,
+// the nonce and the sealed JSON map of items by server URL.
+type FileHelper struct {
+	path string
+	salt []byte
+	gcm  cipher.AEAD
+	lock sync.Mutex
+}
+
+// NewFileHelper opens the file keychain at path. The file does not have to
+// exist yet; when it does, the passphrase is checked by decrypting it.
+func NewFileHelper(path, passphrase string) (*FileHelper, error) {
+	if passphrase == "" {
+		return nil, ErrNoPassphrase
+	}
+
+	salt := make([]byte, fileSaltLength)
+	data, err := ioutil.ReadFile(path) //nolint[gosec]
+	switch {
+	case os.IsNotExist(err):
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case len(data) < fileSaltLength:
+		return nil, ErrWrongPassphrase
+	default:
+		copy(salt, data)
+	}
+
+	key := argon2.IDKey([]byte(passphrase), salt, fileKeyTime, fileKeyMemory, fileKeyThreads, fileKeyLength)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &FileHelper{path: path, salt: salt, gcm: gcm}
+	if _, err := h.load(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *FileHelper) load() (map[string]fileItem, error) {
+	items := map[string]fileItem{}
+
+	data, err := ioutil.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := h.gcm.NonceSize()
+	if len(data) < fileSaltLength+nonceSize {
+		return nil, ErrWrongPassphrase
+	}
+	nonce := data[fileSaltLength : fileSaltLength+nonceSize]
+	plain, err := h.gcm.Open(nil, nonce, data[fileSaltLength+nonceSize:], h.salt)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	if err := json.Unmarshal(plain, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (h *FileHelper) save(items map[string]fileItem) error {
+	plain, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, h.gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	data := append(append([]byte{}, h.salt...), nonce...)
+	data = h.gcm.Seal(data, nonce, plain, h.salt)
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+	tmpPath := h.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, h.path)
+}
+
+// Add stores the credentials, replacing existing ones with the same URL.
+func (h *FileHelper) Add(cred *credentials.Credentials) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	items, err := h.load()
+	if err != nil {
+		return err
+	}
+	items[cred.ServerURL] = fileItem{Username: cred.Username, Secret: cred.Secret}
+	return h.save(items)
+}
+
+// Delete removes the credentials from the file.
+func (h *FileHelper) Delete(serverURL string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	items, err := h.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := items[serverURL]; !ok {
+		return credentials.NewErrCredentialsNotFound()
+	}
+	delete(items, serverURL)
+	return h.save(items)
+}
+
+// Get returns username and secret stored for the URL.
+func (h *FileHelper) Get(serverURL string) (string, string, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	items, err := h.load()
+	if err != nil {
+		return "", "", err
+	}
+	item, ok := items[serverURL]
+	if !ok {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+	return item.Username, item.Secret, nil
+}
+
+// List returns usernames by all stored URLs.
+func (h *FileHelper) List() (map[string]string, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	items, err := h.load()
+	if err != nil {
+		return nil, err
+	}
+	userIDByURL := make(map[string]string, len(items))
+	for url, item := range items {
+		userIDByURL[url] = item.Username
+	}
+	return userIDByURL, nil
+}
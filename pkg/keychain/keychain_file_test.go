@@ -0,0 +1,92 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package keychain
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileHelper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keychain")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+	path := filepath.Join(dir, "keychain.enc")
+
+	_, err = NewFileHelper(path, "")
+	require.Equal(t, ErrNoPassphrase, err)
+
+	helper, err := NewFileHelper(path, "passphrase")
+	require.NoError(t, err)
+
+	for id, secret := range testData {
+		require.NoError(t, helper.Add(&credentials.Credentials{ServerURL: "url/" + id, Username: id, Secret: secret}))
+	}
+	require.NoError(t, helper.Delete("url/user2"))
+	require.True(t, credentials.IsErrCredentialsNotFound(helper.Delete("url/user2")))
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), testData["user1"])
+
+	_, err = NewFileHelper(path, "wrong")
+	require.Equal(t, ErrWrongPassphrase, err)
+
+	reopened, err := NewFileHelper(path, "passphrase")
+	require.NoError(t, err)
+
+	list, err := reopened.List()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"url/user1": "user1"}, list)
+
+	userID, secret, err := reopened.Get("url/user1")
+	require.NoError(t, err)
+	require.Equal(t, "user1", userID)
+	require.Equal(t, testData["user1"], secret)
+
+	_, _, err = reopened.Get("url/user2")
+	require.True(t, credentials.IsErrCredentialsNotFound(err))
+}
+
+func TestFileAccessFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keychain")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	SetFileOptions(FileOptions{Path: filepath.Join(dir, "keychain.enc"), Passphrase: "passphrase", Force: true})
+	defer SetFileOptions(FileOptions{})
+
+	access, err := NewAccess("bridge")
+	require.NoError(t, err)
+
+	require.NoError(t, access.Put("user1", "secret"))
+	require.NoError(t, access.Put("user1", "edited"))
+
+	userIDs, err := access.List()
+	require.NoError(t, err)
+	require.Equal(t, []string{"user1"}, userIDs)
+
+	secret, err := access.Get("user1")
+	require.NoError(t, err)
+	require.Equal(t, "edited", secret)
+}
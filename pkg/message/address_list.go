@@ -0,0 +1,619 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	pmmime "github.com/ProtonMail/proton-bridge/pkg/mime"
+)
+
+// AddressList is a parsed address header field. Unlike mail.ParseAddressList
+// it keeps groups, e.g. "undisclosed-recipients:;", and comments, so the
+// field can be formatted again without losing them. Obsolete syntaxes
+// of RFC 5322 section 4.4 which are still common are accepted: unquoted
+// dots in display names, routes in angle brackets, comments anywhere and
+// empty list items.
+type AddressList []*AddressEntry
+
+// AddressEntry is one item of the address list, either a mailbox or a group.
+type AddressEntry struct {
+	Mailbox *Mailbox
+	Group   *AddressGroup
+}
+
+// Mailbox is an address with its display name and comments.
+type Mailbox struct {
+	Name     string
+	Address  string
+	Comments []string
+}
+
+// AddressGroup is a named group of mailboxes which can be empty.
+type AddressGroup struct {
+	Name     string
+	Members  []*Mailbox
+	Comments []string
+}
+
+// ParseAddressList parses the value of an address header field. Display
+// names and comments are decoded.
+func ParseAddressList(field string) (AddressList, error) {
+	tokens, err := lexAddressList(field)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &addressParser{tokens: tokens}
+	return p.parseList()
+}
+
+// Addresses returns all mailboxes of the list including members of groups.
+func (l AddressList) Addresses() []*mail.Address {
+	addrs := []*mail.Address{}
+	for _, mailbox := range l.mailboxes() {
+		addrs = append(addrs, &mail.Address{Name: mailbox.Name, Address: mailbox.Address})
+	}
+	return addrs
+}
+
+// String formats the list as a header field value. Names and comments
+// which are not printable ASCII are encoded.
+func (l AddressList) String() string {
+	entries := make([]string, 0, len(l))
+	for _, entry := range l {
+		if entry.Group != nil {
+			entries = append(entries, entry.Group.String())
+		} else {
+			entries = append(entries, entry.Mailbox.String())
+		}
+	}
+	return strings.Join(entries, ", ")
+}
+
+// setAddresses replaces names of the mailboxes by names of addrs and returns
+// true when addrs are the same addresses in the same order. Otherwise the
+// list is not changed.
+func (l AddressList) setAddresses(addrs []*mail.Address) bool {
+	mailboxes := l.mailboxes()
+	if len(mailboxes) != len(addrs) {
+		return false
+	}
+	for i, mailbox := range mailboxes {
+		if addrs[i] == nil || !strings.EqualFold(mailbox.Address, addrs[i].Address) {
+			return false
+		}
+	}
+	for i, mailbox := range mailboxes {
+		mailbox.Name = addrs[i].Name
+	}
+	return true
+}
+
+func (l AddressList) mailboxes() (mailboxes []*Mailbox) {
+	for _, entry := range l {
+		if entry.Group != nil {
+			mailboxes = append(mailboxes, entry.Group.Members...)
+		} else {
+			mailboxes = append(mailboxes, entry.Mailbox)
+		}
+	}
+	return
+}
+
+func (m *Mailbox) String() string {
+	addr := &mail.Address{Address: m.Address}
+	if m.Name != "" {
+		if isPrintableASCII(m.Name) {
+			addr.Name = m.Name
+		} else {
+			return encodeAddressText(m.Name) + " " + addr.String() + formatComments(m.Comments)
+		}
+	}
+	return addr.String() + formatComments(m.Comments)
+}
+
+func (g *AddressGroup) String() string {
+	members := make([]string, len(g.Members))
+	for i, member := range g.Members {
+		members[i] = member.String()
+	}
+
+	s := formatPhrase(g.Name) + formatComments(g.Comments) + ":"
+	if len(members) > 0 {
+		s += " " + strings.Join(members, ", ")
+	}
+	return s + ";"
+}
+
+// formatPhrase returns the name as atoms when possible, otherwise quoted
+// or encoded.
+func formatPhrase(name string) string {
+	if !isPrintableASCII(name) {
+		return encodeAddressText(name)
+	}
+
+	for _, word := range strings.Split(name, " ") {
+		if word == "" || strings.IndexFunc(word, func(r rune) bool { return !isAtext(byte(r)) }) >= 0 {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+		}
+	}
+	return name
+}
+
+func formatComments(comments []string) (s string) {
+	escaper := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`)
+	for _, comment := range comments {
+		if isPrintableASCII(comment) {
+			s += " (" + escaper.Replace(comment) + ")"
+		} else {
+			s += " (" + encodeAddressText(comment) + ")"
+		}
+	}
+	return
+}
+
+// encodeAddressText returns encoded words which can be used in phrases and
+// comments. Q encoding leaves characters like comma or colon as they are,
+// so B encoding is used for such texts.
+func encodeAddressText(s string) string {
+	encoded := mime.QEncoding.Encode("utf-8", s)
+	for i := 0; i < len(encoded); i++ {
+		if encoded[i] != ' ' && !isAtext(encoded[i]) {
+			return mime.BEncoding.Encode("utf-8", s)
+		}
+	}
+	return encoded
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// isAtext returns whether the character can be part of an atom.
+func isAtext(c byte) bool {
+	return c > ' ' && c <= '~' && !strings.ContainsRune(`()<>[]:;@\,."`, rune(c))
+}
+
+// ========= Address list lexer =========
+
+type addressTokenKind int
+
+const (
+	atomToken addressTokenKind = iota
+	quotedToken
+	commentToken
+	domainLiteralToken
+	specialToken // One of `<>@,;:.`.
+)
+
+type addressToken struct {
+	kind addressTokenKind
+	text string // Content of quoted strings and comments is unescaped.
+
+	// space is set when the token follows white space or a comment.
+	space bool
+}
+
+func (t addressToken) is(special string) bool {
+	return t.kind == specialToken && t.text == special
+}
+
+// isAtomChar returns whether the byte is part of an atom. The lexer is
+// lenient: stray closing brackets, backslashes and 8-bit bytes are
+// accepted in atoms, only syntactically significant characters are not.
+func isAtomChar(c byte) bool {
+	return c > ' ' && c != 0x7f && !strings.ContainsRune(`(<>[:;@,."`, rune(c))
+}
+
+func lexAddressList(s string) (tokens []addressToken, err error) {
+	space := false
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			space = true
+			i++
+			continue
+		case c == '(':
+			var text string
+			if text, i, err = lexComment(s, i); err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, addressToken{kind: commentToken, text: text, space: space})
+			space = true
+			continue
+		case c == '"':
+			var text string
+			if text, i, err = lexQuoted(s, i); err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, addressToken{kind: quotedToken, text: text, space: space})
+		case c == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, errors.New("unterminated domain literal")
+			}
+			tokens = append(tokens, addressToken{kind: domainLiteralToken, text: s[i : i+end+1], space: space})
+			i += end + 1
+		case strings.IndexByte("<>@,;:.", c) >= 0:
+			tokens = append(tokens, addressToken{kind: specialToken, text: string(c), space: space})
+			i++
+		case isAtomChar(c):
+			start := i
+			for i < len(s) && isAtomChar(s[i]) {
+				i++
+			}
+			tokens = append(tokens, addressToken{kind: atomToken, text: s[start:i], space: space})
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+		space = false
+	}
+	return tokens, nil
+}
+
+// lexComment returns the content of the possibly nested comment starting
+// at i and the index after it.
+func lexComment(s string, i int) (string, int, error) {
+	b := &strings.Builder{}
+	depth := 0
+	for ; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '(':
+			if depth > 0 {
+				b.WriteByte(c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b.String(), i + 1, nil
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", i, errors.New("unterminated comment")
+}
+
+// lexQuoted returns the content of the quoted string starting at i and the
+// index after it.
+func lexQuoted(s string, i int) (string, int, error) {
+	b := &strings.Builder{}
+	for i++; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), i + 1, nil
+		case '\r', '\n':
+			// Folding white space is not part of the content.
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", i, errors.New("unterminated quoted string")
+}
+
+// ========= Address list parser =========
+
+type addressParser struct {
+	tokens []addressToken
+	pos    int
+
+	// comments collects comments skipped since the current entry started.
+	comments []string
+}
+
+// peek returns the next token which is not a comment.
+func (p *addressParser) peek() (addressToken, bool) {
+	for p.pos < len(p.tokens) && p.tokens[p.pos].kind == commentToken {
+		p.comments = append(p.comments, decodeAddressText(p.tokens[p.pos].text))
+		p.pos++
+	}
+	if p.pos == len(p.tokens) {
+		return addressToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *addressParser) peekIs(special string) bool {
+	tok, ok := p.peek()
+	return ok && tok.is(special)
+}
+
+func (p *addressParser) takeComments() []string {
+	comments := p.comments
+	p.comments = nil
+	return comments
+}
+
+func (p *addressParser) parseList() (AddressList, error) {
+	list := AddressList{}
+	for {
+		// Empty items are allowed by the obsolete syntax.
+		for p.peekIs(",") {
+			p.pos++
+			p.takeComments()
+		}
+		if _, ok := p.peek(); !ok {
+			return list, nil
+		}
+
+		entry, err := p.parseEntry()
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			list = append(list, entry)
+		}
+
+		if tok, ok := p.peek(); ok && !tok.is(",") {
+			return nil, fmt.Errorf("unexpected %q after address", tok.text)
+		}
+		if entry != nil && len(p.comments) > 0 {
+			entry.comments(p.takeComments())
+		}
+	}
+}
+
+// comments adds trailing comments to the last mailbox of the entry.
+func (e *AddressEntry) comments(comments []string) {
+	if e.Group != nil {
+		e.Group.Comments = append(e.Group.Comments, comments...)
+	} else {
+		e.Mailbox.Comments = append(e.Mailbox.Comments, comments...)
+	}
+}
+
+func (p *addressParser) parseEntry() (*AddressEntry, error) {
+	if p.isGroup() {
+		group, err := p.parseGroup()
+		if err != nil {
+			return nil, err
+		}
+		return &AddressEntry{Group: group}, nil
+	}
+
+	mailbox, err := p.parseMailbox()
+	if err != nil || mailbox == nil {
+		return nil, err
+	}
+	return &AddressEntry{Mailbox: mailbox}, nil
+}
+
+// isGroup returns whether the next phrase is followed by a colon.
+func (p *addressParser) isGroup() bool {
+	for _, tok := range p.tokens[p.pos:] {
+		switch {
+		case tok.kind == commentToken, tok.kind == atomToken, tok.kind == quotedToken, tok.is("."):
+			continue
+		default:
+			return tok.is(":")
+		}
+	}
+	return false
+}
+
+func (p *addressParser) parseGroup() (*AddressGroup, error) {
+	group := &AddressGroup{Name: phraseText(p.parseWords())}
+	p.pos++ // Colon checked by isGroup.
+	group.Comments = p.takeComments()
+
+	for {
+		tok, ok := p.peek()
+		switch {
+		case !ok:
+			// Missing semicolon at the end of the field is tolerated.
+			return group, nil
+		case tok.is(";"):
+			p.pos++
+			group.Comments = append(group.Comments, p.takeComments()...)
+			return group, nil
+		case tok.is(","):
+			p.pos++
+			continue
+		}
+
+		mailbox, err := p.parseMailbox()
+		if err != nil {
+			return nil, err
+		}
+		if mailbox == nil {
+			continue
+		}
+		if tok, ok := p.peek(); ok && !tok.is(",") && !tok.is(";") {
+			return nil, fmt.Errorf("unexpected %q after address in group", tok.text)
+		}
+		mailbox.Comments = append(mailbox.Comments, p.takeComments()...)
+		group.Members = append(group.Members, mailbox)
+	}
+}
+
+// parseMailbox parses name-addr or addr-spec. Empty angle brackets "<>"
+// return no mailbox.
+func (p *addressParser) parseMailbox() (*Mailbox, error) {
+	words := p.parseWords()
+
+	tok, ok := p.peek()
+	switch {
+	case ok && tok.is("<"):
+		p.pos++
+		name := phraseText(words)
+		if p.peekIs(">") {
+			p.pos++
+			p.takeComments()
+			return nil, nil
+		}
+		if err := p.skipRoute(); err != nil {
+			return nil, err
+		}
+		address, err := p.parseAddrSpec(p.parseWords())
+		if err != nil {
+			return nil, err
+		}
+		if !p.peekIs(">") {
+			return nil, errors.New("missing > after address")
+		}
+		p.pos++
+		return &Mailbox{Name: name, Address: address, Comments: p.takeComments()}, nil
+
+	case ok && tok.is("@"):
+		address, err := p.parseAddrSpec(words)
+		if err != nil {
+			return nil, err
+		}
+		p.peek() // Collect comments after the domain.
+		return &Mailbox{Address: address, Comments: p.takeComments()}, nil
+
+	case !ok && len(words) == 0:
+		return nil, errors.New("missing address")
+
+	default:
+		return nil, errors.New("missing @ or < in address")
+	}
+}
+
+// skipRoute skips the obsolete route, e.g. "@relay.example.org:", in front
+// of the address in angle brackets.
+func (p *addressParser) skipRoute() error {
+	if !p.peekIs("@") {
+		return nil
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.is(">") {
+			return errors.New("unterminated route")
+		}
+		p.pos++
+		if tok.is(":") {
+			return nil
+		}
+	}
+}
+
+// parseWords returns the following atoms, quoted strings and dots.
+func (p *addressParser) parseWords() (words []addressToken) {
+	for {
+		tok, ok := p.peek()
+		if !ok || (tok.kind != atomToken && tok.kind != quotedToken && !tok.is(".")) {
+			return
+		}
+		words = append(words, tok)
+		p.pos++
+	}
+}
+
+// parseAddrSpec parses the domain after the local part given by words.
+func (p *addressParser) parseAddrSpec(words []addressToken) (string, error) {
+	local, err := localPartText(words)
+	if err != nil {
+		return "", err
+	}
+	if !p.peekIs("@") {
+		return "", errors.New("missing @ in address")
+	}
+	p.pos++
+
+	domain := ""
+	for {
+		tok, ok := p.peek()
+		if !ok {
+			break
+		}
+		if tok.kind == domainLiteralToken && domain == "" {
+			domain = tok.text
+			p.pos++
+			break
+		}
+		if tok.kind != atomToken && !tok.is(".") {
+			break
+		}
+		domain += tok.text
+		p.pos++
+	}
+	if strings.Trim(domain, ".") == "" {
+		return "", errors.New("missing domain in address")
+	}
+
+	address := local + "@" + domain
+	if !utf8.ValidString(address) || strings.IndexFunc(address, unicode.IsControl) >= 0 {
+		return "", errors.New("invalid characters in address")
+	}
+	return address, nil
+}
+
+// phraseText returns the decoded display name. Words are separated by one
+// space where the original had white space.
+func phraseText(words []addressToken) string {
+	b := &strings.Builder{}
+	for i, word := range words {
+		if i > 0 && word.space {
+			b.WriteByte(' ')
+		}
+		b.WriteString(word.text)
+	}
+	return decodeAddressText(b.String())
+}
+
+// localPartText returns the local part given by words. Two words must be
+// separated by dot, so a name without angle brackets is not taken as
+// a part of the address.
+func localPartText(words []addressToken) (string, error) {
+	b := &strings.Builder{}
+	for i, word := range words {
+		if i > 0 && !word.is(".") && !words[i-1].is(".") {
+			return "", errors.New("unexpected word in address")
+		}
+		b.WriteString(word.text)
+	}
+	if strings.Trim(b.String(), ".") == "" {
+		return "", errors.New("missing local part in address")
+	}
+	return b.String(), nil
+}
+
+// decodeAddressText decodes encoded words and 8-bit charsets. Invalid
+// characters are replaced, so the text can be encoded again.
+func decodeAddressText(s string) string {
+	if decoded, err := pmmime.DecodeHeader(s); err == nil {
+		s = decoded
+	}
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
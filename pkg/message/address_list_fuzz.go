@@ -0,0 +1,48 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// +build gofuzz
+
+package message
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// FuzzAddressList is the go-fuzz target of the address list parser:
+//
+//     go-fuzz-build -func FuzzAddressList ./pkg/message
+//
+// It panics when a parsed list is not formatted so that it is parsed to the
+// same list again.
+func FuzzAddressList(data []byte) int {
+	list, err := ParseAddressList(string(data))
+	if err != nil {
+		return 0
+	}
+
+	formatted := list.String()
+	again, err := ParseAddressList(formatted)
+	if err != nil {
+		panic(fmt.Sprintf("%q formatted as %q cannot be parsed: %v", data, formatted, err))
+	}
+	if again.String() != formatted || !reflect.DeepEqual(list.Addresses(), again.Addresses()) {
+		panic(fmt.Sprintf("%q formatted as %q is parsed differently", data, formatted))
+	}
+	return 1
+}
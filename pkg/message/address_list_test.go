@@ -0,0 +1,149 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"math/rand"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddressList(t *testing.T) {
+	tests := []struct {
+		field     string
+		formatted string
+		addresses []*mail.Address
+	}{
+		{"undisclosed-recipients:;", "undisclosed-recipients:;", []*mail.Address{}},
+		{"undisclosed-recipients: ;, bob@example.com", "undisclosed-recipients:;, <bob@example.com>", []*mail.Address{{Address: "bob@example.com"}}},
+		{
+			`Team: "Alice A." <alice@example.com>, bob@example.com;, carol@example.com`,
+			`Team: "Alice A." <alice@example.com>, <bob@example.com>;, <carol@example.com>`,
+			[]*mail.Address{{Name: "Alice A.", Address: "alice@example.com"}, {Address: "bob@example.com"}, {Address: "carol@example.com"}},
+		},
+		{"Team: alice@example.com", "Team: <alice@example.com>;", []*mail.Address{{Address: "alice@example.com"}}},
+		{`"Joe Q. Public" <john.q.public@example.com>`, `"Joe Q. Public" <john.q.public@example.com>`, []*mail.Address{{Name: "Joe Q. Public", Address: "john.q.public@example.com"}}},
+		{"Joe Q. Public <john.q.public@example.com>", `"Joe Q. Public" <john.q.public@example.com>`, []*mail.Address{{Name: "Joe Q. Public", Address: "john.q.public@example.com"}}},
+		{"john@example.com (John Doe)", "<john@example.com> (John Doe)", []*mail.Address{{Address: "john@example.com"}}},
+		{"John (the (real) one) <john@example.com>", `"John" <john@example.com> (the \(real\) one)`, []*mail.Address{{Name: "John", Address: "john@example.com"}}},
+		{"(comment)All.(around)address@(the)server.com", "<All.address@server.com> (comment) (around) (the)", []*mail.Address{{Address: "All.address@server.com"}}},
+		{"<@relay.example.org,@other.example.org:john@example.com>", "<john@example.com>", []*mail.Address{{Address: "john@example.com"}}},
+		{"alice@example.com,, ,bob@example.com", "<alice@example.com>, <bob@example.com>", []*mail.Address{{Address: "alice@example.com"}, {Address: "bob@example.com"}}},
+		{`"john smith"@example.com`, `<"john smith"@example.com>`, []*mail.Address{{Address: "john smith@example.com"}}},
+		{"john@[192.168.0.1]", "<john@[192.168.0.1]>", []*mail.Address{{Address: "john@[192.168.0.1]"}}},
+		{"Mailer Daemon <>, bob@example.com", "<bob@example.com>", []*mail.Address{{Address: "bob@example.com"}}},
+		{"=?utf-8?q?Doe=2C_J=C3=B6rg?= <jorg@example.com>", "=?utf-8?b?RG9lLCBKw7ZyZw==?= <jorg@example.com>", []*mail.Address{{Name: "Doe, Jörg", Address: "jorg@example.com"}}},
+		{"=?utf-8?q?=C4=8Cesk=C3=A1?= =?utf-8?q?_skupina?=: john@example.com;", "=?utf-8?q?=C4=8Cesk=C3=A1_skupina?=: <john@example.com>;", []*mail.Address{{Address: "john@example.com"}}},
+	}
+
+	for _, test := range tests {
+		list, err := ParseAddressList(test.field)
+		require.NoError(t, err, test.field)
+		require.Equal(t, test.formatted, list.String(), test.field)
+
+		require.Equal(t, test.addresses, list.Addresses(), test.field)
+
+		again, err := ParseAddressList(list.String())
+		require.NoError(t, err, test.field)
+		require.Equal(t, list, again, test.field)
+	}
+}
+
+func TestParseAddressListInvalid(t *testing.T) {
+	for _, field := range []string{
+		"John Smith",
+		"John Smith john@example.com",
+		"john@",
+		"@example.com",
+		"<john@example.com",
+		"john@example.com <bob@example.com>",
+		`"john@example.com`,
+		"(john@example.com",
+		"Team: Other: john@example.com;;",
+	} {
+		_, err := ParseAddressList(field)
+		require.Error(t, err, field)
+	}
+}
+
+// TestParseAddressListRandom checks that any parsed list is formatted so
+// that it is parsed to the same list again.
+func TestParseAddressListRandom(t *testing.T) {
+	pieces := []string{
+		"a", "bob", "example.com", "@", "<", ">", ",", ";", ":", ".", " ", "\t", "\r\n ",
+		`"`, `\`, "(", ")", "[", "]", "=?utf-8?q?=C4=8C?=", "=?utf-8?b?w6k=?=", "Čeština", "\x01", "\xff",
+	}
+
+	r := rand.New(rand.NewSource(1)) //nolint[gosec]
+	for i := 0; i < 100000; i++ {
+		b := &strings.Builder{}
+		for n := r.Intn(20); n > 0; n-- {
+			b.WriteString(pieces[r.Intn(len(pieces))])
+		}
+		requireAddressListRoundTrip(t, b.String())
+	}
+}
+
+func requireAddressListRoundTrip(t *testing.T, field string) {
+	list, err := ParseAddressList(field)
+	if err != nil {
+		return
+	}
+
+	formatted := list.String()
+	again, err := ParseAddressList(formatted)
+	require.NoError(t, err, "%q formatted as %q", field, formatted)
+	require.Equal(t, formatted, again.String(), "%q formatted as %q", field, formatted)
+	require.Equal(t, list.Addresses(), again.Addresses(), "%q formatted as %q", field, formatted)
+}
+
+func TestGetHeaderKeepsAddressGroupsAndComments(t *testing.T) {
+	msg := pmapi.NewMessage()
+	msg.Header = mail.Header(textproto.MIMEHeader{
+		"To": {"undisclosed-recipients:;"},
+		"Cc": {"Team: alice@example.com (Sales), Bob <bob@example.com>;"},
+	})
+	msg.Sender = &mail.Address{Address: "john@example.com"}
+	msg.CCList = []*mail.Address{{Address: "alice@example.com"}, {Name: "Bob", Address: "bob@example.com"}}
+
+	h := GetHeader(msg)
+	require.Equal(t, "undisclosed-recipients:;", h.Get("To"))
+	require.Equal(t, `Team: <alice@example.com> (Sales), "Bob" <bob@example.com>;`, h.Get("Cc"))
+
+	// The group is dropped when the addresses differ.
+	msg.CCList = []*mail.Address{{Address: "carol@example.com"}}
+	h = GetHeader(msg)
+	require.Equal(t, `<carol@example.com>`, h.Get("Cc"))
+}
+
+func TestParseHeaderAddressGroups(t *testing.T) {
+	m, err := parseHeader(mail.Header(textproto.MIMEHeader{
+		"From": {"john@example.com (John)"},
+		"To":   {"undisclosed-recipients:;"},
+		"Cc":   {"Team: alice@example.com, bob@example.com;"},
+	}))
+	require.NoError(t, err)
+	require.Equal(t, "john@example.com", m.Sender.Address)
+	require.Empty(t, m.ToList)
+	require.Len(t, m.CCList, 2)
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/mail"
+	"strings"
+	"unicode"
+)
+
+// AutocryptHeader carries the public key of the sender, see
+// https://autocrypt.org/level1.html.
+const AutocryptHeader = "Autocrypt"
+
+// autocryptLineLength is the length of key data chunks separated by spaces,
+// so the header can be folded.
+const autocryptLineLength = 76
+
+var (
+	errAutocryptNoAddr    = errors.New("autocrypt header has no addr")    //nolint[gochecknoglobals]
+	errAutocryptNoKeyData = errors.New("autocrypt header has no keydata") //nolint[gochecknoglobals]
+)
+
+// Autocrypt is the content of the Autocrypt header.
+type Autocrypt struct {
+	Addr string
+
+	// PreferEncrypt is whether the sender asks for encryption by default,
+	// i.e. prefer-encrypt=mutual.
+	PreferEncrypt bool
+
+	// KeyData is the binary OpenPGP public key.
+	KeyData []byte
+}
+
+// String returns the value of the Autocrypt header.
+func (a *Autocrypt) String() string {
+	var b strings.Builder
+
+	b.WriteString("addr=")
+	b.WriteString(a.Addr)
+	if a.PreferEncrypt {
+		b.WriteString("; prefer-encrypt=mutual")
+	}
+	b.WriteString("; keydata=")
+
+	keyData := base64.StdEncoding.EncodeToString(a.KeyData)
+	for len(keyData) > autocryptLineLength {
+		b.WriteString(keyData[:autocryptLineLength])
+		b.WriteString(" ")
+		keyData = keyData[autocryptLineLength:]
+	}
+	b.WriteString(keyData)
+
+	return b.String()
+}
+
+// ParseAutocrypt parses the value of the Autocrypt header. Headers with
+// unknown attributes, which do not start with underscore, are invalid.
+func ParseAutocrypt(value string) (*Autocrypt, error) {
+	a := &Autocrypt{}
+	var keyData string
+
+	for _, attr := range strings.Split(value, ";") {
+		attr = strings.TrimSpace(attr)
+		if attr == "" {
+			continue
+		}
+
+		parts := strings.SplitN(attr, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("autocrypt attribute " + attr + " has no value")
+		}
+		name, val := strings.ToLower(strings.TrimSpace(parts[0])), strings.TrimSpace(parts[1])
+
+		switch {
+		case name == "addr":
+			a.Addr = val
+		case name == "prefer-encrypt":
+			a.PreferEncrypt = val == "mutual"
+		case name == "keydata":
+			keyData = val
+		case strings.HasPrefix(name, "_"):
+		default:
+			return nil, errors.New("unknown autocrypt attribute " + name)
+		}
+	}
+
+	if a.Addr == "" {
+		return nil, errAutocryptNoAddr
+	}
+	if keyData == "" {
+		return nil, errAutocryptNoKeyData
+	}
+
+	keyData = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, keyData)
+
+	var err error
+	if a.KeyData, err = base64.StdEncoding.DecodeString(keyData); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// GetAutocrypt returns the Autocrypt header of the sender from the message
+// header. Invalid headers and headers of other addresses are ignored. When
+// the sender has more than one header, none is used as the spec requires.
+func GetAutocrypt(h mail.Header, from string) *Autocrypt {
+	var found *Autocrypt
+
+	for _, value := range h[AutocryptHeader] {
+		a, err := ParseAutocrypt(value)
+		if err != nil || !strings.EqualFold(a.Addr, from) {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = a
+	}
+
+	return found
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"bytes"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutocryptRoundTrip(t *testing.T) {
+	a := &Autocrypt{
+		Addr:          "alice@example.com",
+		PreferEncrypt: true,
+		KeyData:       bytes.Repeat([]byte{0x99, 0x01, 0x0d}, 100),
+	}
+
+	value := a.String()
+	require.True(t, strings.HasPrefix(value, "addr=alice@example.com; prefer-encrypt=mutual; keydata="))
+	keyData := value[strings.Index(value, "keydata=")+len("keydata="):]
+	for _, chunk := range strings.Split(keyData, " ") {
+		require.LessOrEqual(t, len(chunk), autocryptLineLength)
+	}
+
+	parsed, err := ParseAutocrypt(value)
+	require.NoError(t, err)
+	require.Equal(t, a, parsed)
+}
+
+func TestParseAutocrypt(t *testing.T) {
+	a, err := ParseAutocrypt("addr=bob@example.com; _ignored=1; keydata=AQID\r\n BAU=")
+	require.NoError(t, err)
+	require.Equal(t, &Autocrypt{Addr: "bob@example.com", KeyData: []byte{1, 2, 3, 4, 5}}, a)
+
+	for _, value := range []string{
+		"keydata=AQID",
+		"addr=bob@example.com",
+		"addr=bob@example.com; keydata=AQID; critical=1",
+		"addr=bob@example.com; keydata=!!!",
+		"addr=bob@example.com; keydata",
+	} {
+		_, err := ParseAutocrypt(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestGetAutocrypt(t *testing.T) {
+	header := mail.Header{AutocryptHeader: {
+		"addr=other@example.com; keydata=AQID",
+		"addr=Bob@Example.com; keydata=BAU=",
+		"addr=bob@example.com; keydata=!!!",
+	}}
+
+	a := GetAutocrypt(header, "bob@example.com")
+	require.NotNil(t, a)
+	require.Equal(t, []byte{4, 5}, a.KeyData)
+
+	require.Nil(t, GetAutocrypt(header, "nobody@example.com"))
+	require.Nil(t, GetAutocrypt(mail.Header{}, "bob@example.com"))
+
+	header[AutocryptHeader] = append(header[AutocryptHeader], "addr=bob@example.com; keydata=AQID")
+	require.Nil(t, GetAutocrypt(header, "bob@example.com"))
+}
@@ -18,58 +18,122 @@
 package message
 
 import (
-	"encoding/base64"
 	"fmt"
 	"io"
 	"mime/quotedprintable"
+	"strings"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
-	"github.com/emersion/go-textwrapper"
 	openpgperrors "golang.org/x/crypto/openpgp/errors"
 )
 
-func WriteBody(w io.Writer, kr *crypto.KeyRing, m *pmapi.Message) error {
+// BodyEncoding is the transfer encoding of text bodies of built messages.
+type BodyEncoding string
+
+// Supported body encodings.
+const (
+	QuotedPrintable BodyEncoding = "quoted-printable"
+	EightBit        BodyEncoding = "8bit"
+)
+
+// max8BitLineLength is the longest line allowed in 8bit body by RFC 5322
+// and SMTP, without the line break.
+const max8BitLineLength = 998
+
+// ParseBodyEncoding returns the encoding with the name. Unknown names,
+// including empty one, mean quoted-printable.
+func ParseBodyEncoding(name string) BodyEncoding {
+	if BodyEncoding(strings.ToLower(name)) == EightBit {
+		return EightBit
+	}
+	return QuotedPrintable
+}
+
+// For returns the encoding which can be used for the body. 8bit falls back
+// to quoted-printable when the body has too long lines, NUL or bare CR,
+// which cannot be transferred without encoding.
+func (enc BodyEncoding) For(body string) BodyEncoding {
+	if enc != EightBit || strings.Contains(body, "\x00") {
+		return QuotedPrintable
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if len(line) > max8BitLineLength || strings.Contains(line, "\r") {
+			return QuotedPrintable
+		}
+	}
+
+	return EightBit
+}
+
+// WriteBody decrypts the body and writes it encoded by enc, or as is when
+// it is a whole MIME message.
+func WriteBody(w io.Writer, kr *crypto.KeyRing, m *pmapi.Message, enc BodyEncoding) error {
 	// Decrypt body.
 	if err := m.Decrypt(kr); err != nil && err != openpgperrors.ErrSignatureExpired {
 		return err
 	}
 	if m.MIMEType != pmapi.ContentTypeMultipartMixed {
-		// Encode it.
-		qp := quotedprintable.NewWriter(w)
-		if _, err := io.WriteString(qp, m.Body); err != nil {
-			return err
-		}
-		return qp.Close()
+		return writeTextBody(w, m.Body, enc)
 	}
 	_, err := io.WriteString(w, m.Body)
 	return err
 }
 
+// writeTextBody encodes the body by encoding chosen by enc.For with CRLF
+// line breaks.
+func writeTextBody(w io.Writer, body string, enc BodyEncoding) error {
+	if enc.For(body) == EightBit {
+		body = strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n")
+		_, err := io.WriteString(w, body)
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, body); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
 func WriteAttachmentBody(w io.Writer, kr *crypto.KeyRing, m *pmapi.Message, att *pmapi.Attachment, r io.Reader) (err error) {
-	// Decrypt it
-	var dr io.Reader
-	dr, err = att.Decrypt(r, kr)
-	if err == openpgperrors.ErrKeyIncorrect {
-		// Do not fail if attachment is encrypted with a different key.
-		dr = r
-		err = nil
-		att.Name += ".gpg"
-		att.MIMEType = "application/pgp-encrypted" //nolint
-	} else if err != nil && err != openpgperrors.ErrSignatureExpired {
-		err = fmt.Errorf("cannot decrypt attachment: %v", err)
+	dr, _, err := DecryptAttachment(kr, att, r)
+	if err != nil {
 		return
 	}
 
 	// Encode it.
-	ww := textwrapper.NewRFC822(w)
-	bw := base64.NewEncoder(base64.StdEncoding, ww)
+	return WriteAttachmentData(w, dr)
+}
 
-	var n int64
-	if n, err = io.Copy(bw, dr); err != nil {
-		err = fmt.Errorf("cannot write attachment: %v (wrote %v bytes)", err, n)
+// DecryptAttachment returns reader of the decrypted attachment. Attachment
+// encrypted with a different key is not decrypted, it is renamed and the
+// returned reader contains the original encrypted data. Expired signature
+// is not an error, the same as for the body.
+func DecryptAttachment(kr *crypto.KeyRing, att *pmapi.Attachment, r io.Reader) (dr io.Reader, isDecrypted bool, err error) {
+	dr, err = att.DecryptStream(r, kr)
+	if err == openpgperrors.ErrKeyIncorrect {
+		att.Name += ".gpg"
+		att.MIMEType = "application/pgp-encrypted" //nolint
+		return dr, false, nil
+	} else if err != nil && (err != openpgperrors.ErrSignatureExpired || dr == nil) {
+		return nil, false, fmt.Errorf("cannot decrypt attachment: %v", err)
 	}
+	return expiredSignatureReader{Reader: dr}, true, nil
+}
+
+// expiredSignatureReader ends the attachment normally when its expired
+// signature is reported only after the data is read.
+type expiredSignatureReader struct {
+	io.Reader
+}
 
-	_ = bw.Close()
-	return
+func (r expiredSignatureReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == openpgperrors.ErrSignatureExpired {
+		err = io.EOF
+	}
+	return n, err
 }
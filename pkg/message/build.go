@@ -19,12 +19,12 @@ package message
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
-	"mime/quotedprintable"
 	"net/textproto"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
@@ -39,13 +39,32 @@ type Builder struct {
 	cl  pmapi.Client
 	msg *pmapi.Message
 
-	EncryptedToHTML       bool
+	EncryptedToHTML bool
+	// LabelNames are listed in the labels header field when set.
+	LabelNames []string
+	// HeaderPolicy chooses which header fields are kept, everything by default.
+	HeaderPolicy HeaderPolicy
+	// BodyEncoding of text body, quoted-printable by default.
+	BodyEncoding BodyEncoding
+	// RemoteContent filter of HTML body, remote content is kept by default.
+	RemoteContent RemoteContentFilter
+	// Context of requests fetching the body and attachments, the background
+	// context by default.
+	Context context.Context
+
 	successfullyDecrypted bool
 }
 
 // NewBuilder initiated with client and message meta info.
 func NewBuilder(client pmapi.Client, message *pmapi.Message) *Builder {
-	return &Builder{cl: client, msg: message, EncryptedToHTML: true, successfullyDecrypted: false}
+	return &Builder{cl: client, msg: message, EncryptedToHTML: true, HeaderPolicy: ExportHeaderPolicy, successfullyDecrypted: false}
+}
+
+func (bld *Builder) context() context.Context {
+	if bld.Context == nil {
+		return context.Background()
+	}
+	return bld.Context
 }
 
 // fetchMessage will update original PM message if successful
@@ -54,7 +73,7 @@ func (bld *Builder) fetchMessage() (err error) {
 		return nil
 	}
 
-	complete, err := bld.cl.GetMessage(bld.msg.ID)
+	complete, err := bld.cl.GetMessage(bld.context(), bld.msg.ID)
 	if err != nil {
 		return
 	}
@@ -82,15 +101,29 @@ func (bld *Builder) writeMessageBody(w io.Writer) error {
 	return err
 }
 
-func (bld *Builder) writeAttachmentBody(w io.Writer, att *pmapi.Attachment) error {
+// writeAttachmentPart creates a new part of mw and streams the decrypted
+// attachment into it.
+func (bld *Builder) writeAttachmentPart(mw *multipart.Writer, att *pmapi.Attachment) error {
 	// Retrieve encrypted attachment
-	r, err := bld.cl.GetAttachment(att.ID)
+	r, err := bld.cl.GetAttachment(bld.context(), att.ID)
 	if err != nil {
 		return err
 	}
 	defer r.Close() //nolint[errcheck]
 
-	if err := bld.WriteAttachmentBody(w, att, r); err != nil {
+	// Decryption has to be prepared before writing the header because
+	// the name and type of the attachment changes when it cannot be decrypted.
+	dr, err := bld.DecryptAttachment(att, r)
+
+	p, partErr := mw.CreatePart(GetAttachmentHeader(att))
+	if partErr != nil {
+		return partErr
+	}
+
+	if err == nil {
+		err = WriteAttachmentData(p, dr)
+	}
+	if err != nil {
 		// Returning an error here makes e-mail clients like Thunderbird behave
 		// badly, trying to retrieve the message again and again
 		log.Warnln("Cannot write attachment body:", err)
@@ -103,32 +136,20 @@ func (bld *Builder) writeRelatedPart(p io.Writer, inlines []*pmapi.Attachment) e
 
 	_ = related.SetBoundary(GetRelatedBoundary(bld.msg))
 
-	buf := &bytes.Buffer{}
-	if err := bld.writeMessageBody(buf); err != nil {
-		return err
-	}
-
 	// Write the body part
-	h := GetBodyHeader(bld.msg)
-
 	var err error
-	if p, err = related.CreatePart(h); err != nil {
+	if p, err = related.CreatePart(GetBodyHeader(bld.msg, bld.BodyEncoding)); err != nil {
 		return err
 	}
 
-	_, _ = buf.WriteTo(p)
+	if err = bld.writeMessageBody(p); err != nil {
+		return err
+	}
 
 	for _, inline := range inlines {
-		buf = &bytes.Buffer{}
-		if err = bld.writeAttachmentBody(buf, inline); err != nil {
+		if err = bld.writeAttachmentPart(related, inline); err != nil {
 			return err
 		}
-
-		h := GetAttachmentHeader(inline)
-		if p, err = related.CreatePart(h); err != nil {
-			return err
-		}
-		_, _ = buf.WriteTo(p)
 	}
 
 	_ = related.Close()
@@ -137,78 +158,126 @@ func (bld *Builder) writeRelatedPart(p io.Writer, inlines []*pmapi.Attachment) e
 
 // BuildMessage converts PM message to body structure (not RFC3501) and bytes
 // of RC822 message. If successful the original PM message will contain decrypted body.
-func (bld *Builder) BuildMessage() (structure *BodyStructure, message []byte, err error) { //nolint[funlen]
-	if err = bld.fetchMessage(); err != nil {
+// Prefer WriteTo or NewReader when the structure is not needed.
+func (bld *Builder) BuildMessage() (structure *BodyStructure, message []byte, err error) {
+	bodyBuf := &bytes.Buffer{}
+	if _, err = bld.WriteTo(bodyBuf); err != nil {
 		return nil, nil, err
 	}
 
-	bodyBuf := &bytes.Buffer{}
+	// wee need to copy buffer before building body structure
+	message = bodyBuf.Bytes()
+	structure, err = NewBodyStructure(bodyBuf)
+	return structure, message, err
+}
+
+// NewReader returns reader of RFC822 message which is built while being read.
+// The reader has to be closed to release the resources if it is not read
+// till the end.
+func (bld *Builder) NewReader() io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		_, err := bld.WriteTo(pw)
+		_ = pw.CloseWithError(err)
+	}()
+
+	return pr
+}
+
+// WriteTo writes RFC822 message to w. Body and attachments are decrypted and
+// encoded on the fly so the whole message is never kept in memory.
+// If successful the original PM message will contain decrypted body.
+func (bld *Builder) WriteTo(w io.Writer) (n int64, err error) {
+	cw := &countingWriter{w: w}
+	err = bld.writeMessage(cw)
+	return cw.n, err
+}
+
+func (bld *Builder) writeMessage(w io.Writer) (err error) {
+	if err = bld.fetchMessage(); err != nil {
+		return err
+	}
 
 	mainHeader := GetHeader(bld.msg)
+	SetSignatureValidityHeader(mainHeader, bld.decryptAndVerify())
+	if bld.LabelNames != nil {
+		SetLabelsHeader(mainHeader, bld.LabelNames)
+	}
+	bld.HeaderPolicy.Apply(mainHeader)
 	mainHeader.Set("Content-Type", "multipart/mixed; boundary="+GetBoundary(bld.msg))
-	if err = WriteHeader(bodyBuf, mainHeader); err != nil {
-		return nil, nil, err
+	if err = WriteHeader(w, mainHeader); err != nil {
+		return err
+	}
+	if _, err = io.WriteString(w, "\r\n"); err != nil {
+		return err
 	}
-	_, _ = io.WriteString(bodyBuf, "\r\n")
 
 	// NOTE: Do we really need extra encapsulation? i.e. Bridge-IMAP message is always multipart/mixed
 
 	if bld.msg.MIMEType == pmapi.ContentTypeMultipartMixed {
-		_, _ = io.WriteString(bodyBuf, "\r\n--"+GetBoundary(bld.msg)+"\r\n")
-		if err = bld.writeMessageBody(bodyBuf); err != nil {
-			return nil, nil, err
+		if _, err = io.WriteString(w, "\r\n--"+GetBoundary(bld.msg)+"\r\n"); err != nil {
+			return err
 		}
-		_, _ = io.WriteString(bodyBuf, "\r\n--"+GetBoundary(bld.msg)+"--\r\n")
-	} else {
-		mw := multipart.NewWriter(bodyBuf)
-		_ = mw.SetBoundary(GetBoundary(bld.msg))
-
-		var partWriter io.Writer
-		atts, inlines := SeparateInlineAttachments(bld.msg)
-
-		if len(inlines) > 0 {
-			relatedHeader := GetRelatedHeader(bld.msg)
-			if partWriter, err = mw.CreatePart(relatedHeader); err != nil {
-				return nil, nil, err
-			}
-			_ = bld.writeRelatedPart(partWriter, inlines)
-		} else {
-			buf := &bytes.Buffer{}
-			if err = bld.writeMessageBody(buf); err != nil {
-				return nil, nil, err
-			}
-
-			// Write the body part
-			bodyHeader := GetBodyHeader(bld.msg)
-			if partWriter, err = mw.CreatePart(bodyHeader); err != nil {
-				return nil, nil, err
-			}
-
-			_, _ = buf.WriteTo(partWriter)
+		if err = bld.writeMessageBody(w); err != nil {
+			return err
 		}
+		_, err = io.WriteString(w, "\r\n--"+GetBoundary(bld.msg)+"--\r\n")
+		return err
+	}
 
-		// Write the attachments parts
-		for _, att := range atts {
-			buf := &bytes.Buffer{}
-			if err = bld.writeAttachmentBody(buf, att); err != nil {
-				return nil, nil, err
-			}
+	mw := multipart.NewWriter(w)
+	_ = mw.SetBoundary(GetBoundary(bld.msg))
 
-			attachmentHeader := GetAttachmentHeader(att)
-			if partWriter, err = mw.CreatePart(attachmentHeader); err != nil {
-				return nil, nil, err
-			}
+	var partWriter io.Writer
+	atts, inlines := SeparateInlineAttachments(bld.msg)
 
-			_, _ = buf.WriteTo(partWriter)
+	if len(inlines) > 0 {
+		relatedHeader := GetRelatedHeader(bld.msg)
+		if partWriter, err = mw.CreatePart(relatedHeader); err != nil {
+			return err
 		}
+		_ = bld.writeRelatedPart(partWriter, inlines)
+	} else {
+		// Write the body part
+		bodyHeader := GetBodyHeader(bld.msg, bld.BodyEncoding)
+		if partWriter, err = mw.CreatePart(bodyHeader); err != nil {
+			return err
+		}
+		if err = bld.writeMessageBody(partWriter); err != nil {
+			return err
+		}
+	}
 
-		_ = mw.Close()
+	// Write the attachments parts
+	for _, att := range atts {
+		if err = bld.writeAttachmentPart(mw, att); err != nil {
+			return err
+		}
 	}
 
-	// wee need to copy buffer before building body structure
-	message = bodyBuf.Bytes()
-	structure, err = NewBodyStructure(bodyBuf)
-	return structure, message, err
+	return mw.Close()
+}
+
+// decryptAndVerify decrypts the body in advance because the signature can be
+// checked only during decryption and its result belongs to the header.
+// Failures are left to writing of the body which knows how to handle them.
+func (bld *Builder) decryptAndVerify() pmapi.SignatureStatus {
+	kr, err := bld.cl.KeyRingForAddressID(bld.msg.AddressID)
+	if err != nil {
+		return pmapi.SignatureNotChecked
+	}
+
+	verifiers, err := VerificationKeyRing(bld.context(), bld.cl, bld.msg)
+	if err != nil {
+		log.WithError(err).WithField("msgID", bld.msg.ID).Warn("Cannot get keys of the sender")
+	}
+
+	status, err := bld.msg.DecryptAndVerify(kr, verifiers)
+	if err != nil {
+		return pmapi.SignatureNotChecked
+	}
+	return status
 }
 
 // SuccessfullyDecrypted is true when message was fetched and decrypted successfully
@@ -226,13 +295,11 @@ func (bld *Builder) WriteBody(w io.Writer) error {
 		return err
 	}
 	bld.successfullyDecrypted = true
+	if bld.msg.MIMEType == pmapi.ContentTypeHTML {
+		bld.msg.Body = bld.RemoteContent.Apply(bld.msg.Body)
+	}
 	if bld.msg.MIMEType != pmapi.ContentTypeMultipartMixed {
-		// transfer encoding
-		qp := quotedprintable.NewWriter(w)
-		if _, err := io.WriteString(qp, bld.msg.Body); err != nil {
-			return err
-		}
-		return qp.Close()
+		return writeTextBody(w, bld.msg.Body, bld.BodyEncoding)
 	}
 	_, err = io.WriteString(w, bld.msg.Body)
 	return err
@@ -240,30 +307,32 @@ func (bld *Builder) WriteBody(w io.Writer) error {
 
 // WriteAttachmentBody decrypts and writes the attachments
 func (bld *Builder) WriteAttachmentBody(w io.Writer, att *pmapi.Attachment, attReader io.Reader) (err error) {
-	kr, err := bld.cl.KeyRingForAddressID(bld.msg.AddressID)
+	dr, err := bld.DecryptAttachment(att, attReader)
 	if err != nil {
 		return err
 	}
-	// Decrypt it
-	var dr io.Reader
-	dr, err = att.Decrypt(attReader, kr)
-	if err == openpgperrors.ErrKeyIncorrect {
-		// Do not fail if attachment is encrypted with a different key
-		dr = attReader
-		err = nil
-		att.Name += ".gpg"
-		att.MIMEType = "application/pgp-encrypted"
-	} else if err != nil && err != openpgperrors.ErrSignatureExpired {
-		err = fmt.Errorf("cannot decrypt attachment: %v", err)
-		return err
+	return WriteAttachmentData(w, dr)
+}
+
+// DecryptAttachment returns reader decrypting the attachment while being read.
+// Attachment encrypted with other key is returned as is with `.gpg` suffix.
+func (bld *Builder) DecryptAttachment(att *pmapi.Attachment, attReader io.Reader) (io.Reader, error) {
+	kr, err := bld.cl.KeyRingForAddressID(bld.msg.AddressID)
+	if err != nil {
+		return nil, err
 	}
 
-	// transfer encoding
+	dr, _, err := DecryptAttachment(kr, att, attReader)
+	return dr, err
+}
+
+// WriteAttachmentData writes data with base64 transfer encoding.
+func WriteAttachmentData(w io.Writer, r io.Reader) (err error) {
 	ww := textwrapper.NewRFC822(w)
 	bw := base64.NewEncoder(base64.StdEncoding, ww)
 
 	var n int64
-	if n, err = io.Copy(bw, dr); err != nil {
+	if n, err = io.Copy(bw, r); err != nil {
 		err = fmt.Errorf("cannot write attachment: %v (wrote %v bytes)", err, n)
 	}
 
@@ -271,6 +340,18 @@ func (bld *Builder) WriteAttachmentBody(w io.Writer, att *pmapi.Attachment, attR
 	return err
 }
 
+// countingWriter counts bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
 func BuildEncrypted(m *pmapi.Message, readers []io.Reader, kr *crypto.KeyRing) ([]byte, error) { //nolint[funlen]
 	b := &bytes.Buffer{}
 
@@ -0,0 +1,159 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	pmapimocks "github.com/ProtonMail/proton-bridge/pkg/pmapi/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	openpgperrors "golang.org/x/crypto/openpgp/errors"
+)
+
+func newTestKeyRing(t *testing.T, name string) *crypto.KeyRing {
+	key, err := crypto.GenerateKey(name, name+"@pm.me", "x25519", 0)
+	require.NoError(t, err)
+	kr, err := crypto.NewKeyRing(key)
+	require.NoError(t, err)
+	return kr
+}
+
+func newTestAttachment(t *testing.T, kr *crypto.KeyRing, id, content string) (*pmapi.Attachment, []byte) {
+	split, err := kr.EncryptAttachment(crypto.NewPlainMessageFromString(content), id+".txt")
+	require.NoError(t, err)
+
+	return &pmapi.Attachment{
+		ID:         id,
+		Name:       id + ".txt",
+		MIMEType:   "text/plain",
+		KeyPackets: base64.StdEncoding.EncodeToString(split.GetBinaryKeyPacket()),
+	}, split.GetBinaryDataPacket()
+}
+
+func TestBuilderStreamsMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	kr := newTestKeyRing(t, "user")
+	otherKR := newTestKeyRing(t, "other")
+
+	att, attData := newTestAttachment(t, kr, "att1", "attachment content")
+	foreignAtt, foreignAttData := newTestAttachment(t, otherKR, "att2", "foreign content")
+
+	newMessage := func() *pmapi.Message {
+		return &pmapi.Message{
+			ID:          "msgID",
+			AddressID:   "addressID",
+			MIMEType:    "text/plain",
+			Subject:     "Hello",
+			Body:        "body content",
+			Attachments: []*pmapi.Attachment{att, foreignAtt},
+		}
+	}
+
+	client := pmapimocks.NewMockClient(ctrl)
+	client.EXPECT().KeyRingForAddressID("addressID").Return(kr, nil).AnyTimes()
+	client.EXPECT().GetAttachment(gomock.Any(), "att1").Return(ioutil.NopCloser(bytes.NewReader(attData)), nil)
+	client.EXPECT().GetAttachment(gomock.Any(), "att2").Return(ioutil.NopCloser(bytes.NewReader(foreignAttData)), nil)
+
+	_, built, err := NewBuilder(client, newMessage()).BuildMessage()
+	require.NoError(t, err)
+
+	require.Contains(t, string(built), "Subject: Hello")
+	require.Contains(t, string(built), base64.StdEncoding.EncodeToString([]byte("attachment content")))
+	require.Contains(t, string(built), "att2.txt.gpg")
+	require.NotContains(t, string(built), base64.StdEncoding.EncodeToString([]byte("foreign content")))
+
+	// The reader has to produce the very same message as the whole build.
+	att.Name, foreignAtt.Name, foreignAtt.MIMEType = "att1.txt", "att2.txt", "text/plain"
+	client.EXPECT().GetAttachment(gomock.Any(), "att1").Return(ioutil.NopCloser(bytes.NewReader(attData)), nil)
+	client.EXPECT().GetAttachment(gomock.Any(), "att2").Return(ioutil.NopCloser(bytes.NewReader(foreignAttData)), nil)
+
+	r := NewBuilder(client, newMessage()).NewReader()
+	defer r.Close() //nolint[errcheck]
+	streamed, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, string(built), string(streamed))
+}
+
+func TestBodyEncodingFor(t *testing.T) {
+	require.Equal(t, QuotedPrintable, QuotedPrintable.For("plain"))
+	require.Equal(t, QuotedPrintable, BodyEncoding("").For("plain"))
+	require.Equal(t, EightBit, EightBit.For("Příliš žluťoučký\r\nkůň\n"))
+	require.Equal(t, EightBit, EightBit.For(strings.Repeat("a", 998)))
+	require.Equal(t, QuotedPrintable, EightBit.For(strings.Repeat("a", 999)))
+	require.Equal(t, QuotedPrintable, EightBit.For("bare\rCR"))
+	require.Equal(t, QuotedPrintable, EightBit.For("NUL\x00"))
+
+	require.Equal(t, EightBit, ParseBodyEncoding("8BIT"))
+	require.Equal(t, QuotedPrintable, ParseBodyEncoding(""))
+}
+
+func TestBuilderEightBitBody(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := pmapimocks.NewMockClient(ctrl)
+	client.EXPECT().KeyRingForAddressID("addressID").Return(newTestKeyRing(t, "user"), nil).AnyTimes()
+
+	newMessage := func(body string) *pmapi.Message {
+		return &pmapi.Message{ID: "msgID", AddressID: "addressID", MIMEType: "text/plain", Body: body}
+	}
+
+	bld := NewBuilder(client, newMessage("Příliš žluťoučký\nkůň"))
+	bld.BodyEncoding = EightBit
+	_, built, err := bld.BuildMessage()
+	require.NoError(t, err)
+	require.Contains(t, string(built), "Content-Transfer-Encoding: 8bit")
+	require.Contains(t, string(built), "Příliš žluťoučký\r\nkůň")
+
+	bld = NewBuilder(client, newMessage(strings.Repeat("ř", 500)))
+	bld.BodyEncoding = EightBit
+	_, built, err = bld.BuildMessage()
+	require.NoError(t, err)
+	require.Contains(t, string(built), "Content-Transfer-Encoding: quoted-printable")
+	require.NotContains(t, string(built), "ř")
+}
+
+func TestExpiredSignatureReaderEndsAttachment(t *testing.T) {
+	r := expiredSignatureReader{Reader: io.MultiReader(strings.NewReader("data"), &errReader{err: openpgperrors.ErrSignatureExpired})}
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "data", string(data))
+
+	r = expiredSignatureReader{Reader: &errReader{err: errors.New("corrupted")}}
+	_, err = ioutil.ReadAll(r)
+	require.EqualError(t, err, "corrupted")
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExpiresInHeader sets after how many seconds from sending the message
+// expires. It is removed before sending.
+const ExpiresInHeader = "X-Pm-Expires-In"
+
+// MaxExpiration is the longest time after which a sent message can expire.
+const MaxExpiration = 28 * 24 * time.Hour
+
+// ParseExpiresIn returns the expiration from the value of ExpiresInHeader.
+func ParseExpiresIn(value string) (time.Duration, error) {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || seconds <= 0 || seconds > int64(MaxExpiration/time.Second) {
+		return 0, fmt.Errorf("%s must be a number of seconds between 1 and %d", ExpiresInHeader, int64(MaxExpiration/time.Second))
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpiresIn(t *testing.T) {
+	expiration, err := ParseExpiresIn(" 3600 ")
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, expiration)
+
+	expiration, err = ParseExpiresIn("2419200")
+	require.NoError(t, err)
+	require.Equal(t, MaxExpiration, expiration)
+
+	for _, invalid := range []string{"", "0", "-1", "2419201", "1h"} {
+		_, err := ParseExpiresIn(invalid)
+		require.Error(t, err, invalid)
+	}
+}
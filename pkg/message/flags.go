@@ -27,6 +27,19 @@ var (
 	AppleMailJunkFlag      = imap.CanonicalFlag("$Junk")
 	ThunderbirdJunkFlag    = imap.CanonicalFlag("Junk")
 	ThunderbirdNonJunkFlag = imap.CanonicalFlag("NonJunk")
+
+	// Standard keywords registered by RFC 5788.
+	NotJunkFlag = imap.CanonicalFlag("$NotJunk")
+	MDNSentFlag = imap.CanonicalFlag("$MDNSent")
+
+	// Keywords of read receipts handled by Bridge. Setting SendMDNFlag sends
+	// the read receipt requested by the message; it is not stored.
+	SendMDNFlag     = imap.CanonicalFlag("$SendMDN")
+	ReadReceiptFlag = imap.CanonicalFlag("$ReadReceipt")
+	MDNReceivedFlag = imap.CanonicalFlag("$MDNReceived")
+
+	// Keyword of messages with an attachment reported by the attachment scanner.
+	InfectedFlag = imap.CanonicalFlag("$Infected")
 )
 
 func GetFlags(m *pmapi.Message) (flags []string) {
@@ -53,7 +66,7 @@ func GetFlags(m *pmapi.Message) (flags []string) {
 	}
 
 	if !hasSpam {
-		flags = append(flags, ThunderbirdNonJunkFlag)
+		flags = append(flags, ThunderbirdNonJunkFlag, NotJunkFlag)
 	}
 
 	return
@@ -18,7 +18,7 @@
 package message
 
 import (
-	"mime"
+	"errors"
 	"net/mail"
 	"net/textproto"
 	"strings"
@@ -28,6 +28,10 @@ import (
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
+// LabelsHeaderKey is the header field listing names of labels applied to
+// the message, so client filters can act on them.
+const LabelsHeaderKey = "X-Pm-Labels"
+
 // GetHeader builds the header for the message.
 func GetHeader(msg *pmapi.Message) textproto.MIMEHeader { //nolint[funlen]
 	h := make(textproto.MIMEHeader)
@@ -37,22 +41,28 @@ func GetHeader(msg *pmapi.Message) textproto.MIMEHeader { //nolint[funlen]
 		h = textproto.MIMEHeader(msg.Header)
 	}
 
+	// The results of signature and link checks are set only when the message is built.
+	h.Del(SMIMEVerifiedHeaderKey)
+	h.Del(SignatureValidityHeaderKey)
+	h.Del(PhishingScoreHeaderKey)
+	h.Set(EncryptionHeaderKey, getEncryption(msg))
+
 	// Add or rewrite fields.
 	h.Set("Subject", pmmime.EncodeHeader(msg.Subject))
 	if msg.Sender != nil {
-		h.Set("From", pmmime.EncodeHeader(msg.Sender.String()))
+		setAddressField(h, "From", []*mail.Address{msg.Sender})
 	}
 	if len(msg.ReplyTos) > 0 {
-		h.Set("Reply-To", pmmime.EncodeHeader(formatAddressList(msg.ReplyTos)))
+		setAddressField(h, "Reply-To", msg.ReplyTos)
 	}
 	if len(msg.ToList) > 0 {
-		h.Set("To", pmmime.EncodeHeader(formatAddressList(msg.ToList)))
+		setAddressField(h, "To", msg.ToList)
 	}
 	if len(msg.CCList) > 0 {
-		h.Set("Cc", pmmime.EncodeHeader(formatAddressList(msg.CCList)))
+		setAddressField(h, "Cc", msg.CCList)
 	}
 	if len(msg.BCCList) > 0 {
-		h.Set("Bcc", pmmime.EncodeHeader(formatAddressList(msg.BCCList)))
+		setAddressField(h, "Bcc", msg.BCCList)
 	}
 
 	// Add or rewrite date related fields.
@@ -74,35 +84,63 @@ func GetHeader(msg *pmapi.Message) textproto.MIMEHeader { //nolint[funlen]
 	}
 	if msg.ID != "" {
 		if h.Get("Message-Id") == "" {
-			h.Set("Message-Id", "<"+msg.ID+"@"+pmapi.InternalIDDomain+">")
+			h.Set("Message-Id", InternalMessageID(msg.ID))
 		}
 		h.Set("X-Pm-Internal-Id", msg.ID)
 		// Forward References, and include the message ID here (to improve outlook support).
-		if references := h.Get("References"); !strings.Contains(references, msg.ID) {
-			references += " <" + msg.ID + "@" + pmapi.InternalIDDomain + ">"
-			h.Set("References", references)
-		}
+		h.Set("References", AppendMessageIDs(h.Get("References"), InternalMessageID(msg.ID)))
 	}
 	if msg.ConversationID != "" {
 		h.Set("X-Pm-ConversationID-Id", msg.ConversationID)
-		if references := h.Get("References"); !strings.Contains(references, msg.ConversationID) {
-			references += " <" + msg.ConversationID + "@" + pmapi.ConversationIDDomain + ">"
-			h.Set("References", references)
-		}
+		h.Set("References", AppendMessageIDs(h.Get("References"), ConversationMessageID(msg.ConversationID)))
 	}
 
+	LimitHeader(h, getHeaderLimits())
+
 	return h
 }
 
-func SetBodyContentFields(h *textproto.MIMEHeader, m *pmapi.Message) {
+// setAddressField sets the address field to addrs. When the current field
+// lists the same addresses, its groups and comments are kept.
+func setAddressField(h textproto.MIMEHeader, key string, addrs []*mail.Address) {
+	if list, err := ParseAddressList(h.Get(key)); err == nil && list.setAddresses(addrs) {
+		h.Set(key, list.String())
+		return
+	}
+	h.Set(key, pmmime.EncodeHeader(formatAddressList(addrs)))
+}
+
+// SetLabelsHeader sets the field listing names of the labels separated by
+// comma. Names containing comma or quotes are quoted. The field is removed
+// when there is no label.
+func SetLabelsHeader(h textproto.MIMEHeader, names []string) {
+	if len(names) == 0 {
+		h.Del(LabelsHeaderKey)
+		return
+	}
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		if strings.ContainsAny(name, `,"`) {
+			name = `"` + strings.ReplaceAll(name, `"`, `\"`) + `"`
+		}
+		quoted[i] = name
+	}
+
+	h.Set(LabelsHeaderKey, pmmime.EncodeHeader(strings.Join(quoted, ", ")))
+}
+
+// SetBodyContentFields sets fields of the body part. The transfer encoding
+// is the one enc allows for the body, so the body must be decrypted already.
+func SetBodyContentFields(h *textproto.MIMEHeader, m *pmapi.Message, enc BodyEncoding) {
 	h.Set("Content-Type", m.MIMEType+"; charset=utf-8")
 	h.Set("Content-Disposition", "inline")
-	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	h.Set("Content-Transfer-Encoding", string(enc.For(m.Body)))
 }
 
-func GetBodyHeader(m *pmapi.Message) textproto.MIMEHeader {
+func GetBodyHeader(m *pmapi.Message, enc BodyEncoding) textproto.MIMEHeader {
 	h := make(textproto.MIMEHeader)
-	SetBodyContentFields(&h, m)
+	SetBodyContentFields(&h, m, enc)
 	return h
 }
 
@@ -118,16 +156,15 @@ func GetAttachmentHeader(att *pmapi.Attachment) textproto.MIMEHeader {
 		mediaType = "application/octet-stream"
 	}
 
-	encodedName := pmmime.EncodeHeader(att.Name)
 	disposition := "attachment" //nolint[goconst]
 	if strings.Contains(att.Header.Get("Content-Disposition"), "inline") {
 		disposition = "inline"
 	}
 
 	h := make(textproto.MIMEHeader)
-	h.Set("Content-Type", mime.FormatMediaType(mediaType, map[string]string{"name": encodedName}))
+	h.Set("Content-Type", pmmime.FormatMediaType(mediaType, map[string]string{"name": att.Name}))
 	h.Set("Content-Transfer-Encoding", "base64")
-	h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": encodedName}))
+	h.Set("Content-Disposition", pmmime.FormatMediaType(disposition, map[string]string{"filename": att.Name}))
 
 	// Forward some original header lines.
 	forward := []string{"Content-Id", "Content-Description", "Content-Location"}
@@ -149,19 +186,19 @@ func parseHeader(h mail.Header) (m *pmapi.Message, err error) { //nolint[unparam
 	if subject, err := pmmime.DecodeHeader(h.Get("Subject")); err == nil {
 		m.Subject = subject
 	}
-	if addrs, err := sanitizeAddressList(h, "From"); err == nil && len(addrs) > 0 {
+	if addrs, err := parseAddressField(h, "From"); err == nil && len(addrs) > 0 {
 		m.Sender = addrs[0]
 	}
-	if addrs, err := sanitizeAddressList(h, "Reply-To"); err == nil && len(addrs) > 0 {
+	if addrs, err := parseAddressField(h, "Reply-To"); err == nil && len(addrs) > 0 {
 		m.ReplyTos = addrs
 	}
-	if addrs, err := sanitizeAddressList(h, "To"); err == nil {
+	if addrs, err := parseAddressField(h, "To"); err == nil {
 		m.ToList = addrs
 	}
-	if addrs, err := sanitizeAddressList(h, "Cc"); err == nil {
+	if addrs, err := parseAddressField(h, "Cc"); err == nil {
 		m.CCList = addrs
 	}
-	if addrs, err := sanitizeAddressList(h, "Bcc"); err == nil {
+	if addrs, err := parseAddressField(h, "Bcc"); err == nil {
 		m.BCCList = addrs
 	}
 	m.Time = 0
@@ -173,30 +210,30 @@ func parseHeader(h mail.Header) (m *pmapi.Message, err error) { //nolint[unparam
 	return
 }
 
-func sanitizeAddressList(h mail.Header, field string) (addrs []*mail.Address, err error) {
+// parseAddressField returns addresses of the field including members of
+// groups. Fields which cannot be parsed are usually not encoded properly,
+// then at least the addresses in angle brackets are returned.
+func parseAddressField(h mail.Header, field string) (addrs []*mail.Address, err error) {
 	raw := h.Get(field)
 	if raw == "" {
 		err = mail.ErrHeaderNotPresent
 		return
 	}
-	var decoded string
-	decoded, err = pmmime.DecodeHeader(raw)
-	if err != nil {
-		return
+	if list, err := ParseAddressList(raw); err == nil {
+		return list.Addresses(), nil
 	}
-	addrs, err = mail.ParseAddressList(parseAddressComment(decoded))
-	if err == nil {
-		if addrs == nil {
-			addrs = []*mail.Address{}
+	// Some clients encode the whole field instead of display names only.
+	if decoded, err := pmmime.DecodeHeader(raw); err == nil && decoded != raw {
+		if list, err := ParseAddressList(decoded); err == nil {
+			return list.Addresses(), nil
 		}
-		return
 	}
 	// Probably missing encoding error -- try to at least parse addresses in brackets.
-	addrStr := h.Get(field)
+	addrStr := raw
 	first := strings.Index(addrStr, "<")
 	last := strings.LastIndex(addrStr, ">")
 	if first < 0 || last < 0 || first >= last {
-		return
+		return nil, errors.New("cannot parse address list")
 	}
 	var addrList []string
 	open := first
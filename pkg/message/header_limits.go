@@ -0,0 +1,185 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"fmt"
+	"net/textproto"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// TruncatedHeaderKey is added to headers which were shortened because of HeaderLimits.
+const TruncatedHeaderKey = "X-Pm-Truncated"
+
+// truncatedMarkerReserve is the space kept free for the TruncatedHeaderKey
+// field so that the marked header still fits in the limits.
+const truncatedMarkerReserve = 64
+
+// HeaderLimits restricts the size of the message header served to clients.
+// Zero value of any limit means no limit.
+type HeaderLimits struct {
+	MaxFields    int // Maximum number of header fields.
+	MaxFieldSize int // Maximum size of one field value in bytes.
+	MaxTotalSize int // Maximum size of the whole header in bytes.
+}
+
+// DefaultHeaderLimits are generous enough for any sane message.
+var DefaultHeaderLimits = HeaderLimits{ //nolint[gochecknoglobals]
+	MaxFields:    1000,
+	MaxFieldSize: 64 * 1024,
+	MaxTotalSize: 512 * 1024,
+}
+
+var (
+	headerLimits       = DefaultHeaderLimits //nolint[gochecknoglobals]
+	headerLimitsLocker sync.RWMutex          //nolint[gochecknoglobals]
+)
+
+// SetHeaderLimits changes the limits applied by GetHeader.
+func SetHeaderLimits(limits HeaderLimits) {
+	headerLimitsLocker.Lock()
+	defer headerLimitsLocker.Unlock()
+
+	headerLimits = limits
+}
+
+func getHeaderLimits() HeaderLimits {
+	headerLimitsLocker.RLock()
+	defer headerLimitsLocker.RUnlock()
+
+	return headerLimits
+}
+
+// essentialHeaderFields are never dropped, only shortened when too long.
+// The order sets the priority in which they consume the size budget.
+var essentialHeaderFields = []string{ //nolint[gochecknoglobals]
+	TruncatedHeaderKey,
+	"Content-Type",
+	"Content-Transfer-Encoding",
+	"Content-Disposition",
+	"Mime-Version",
+	"Date",
+	"Subject",
+	"From",
+	"Reply-To",
+	"To",
+	"Cc",
+	"Bcc",
+	"Message-Id",
+	"In-Reply-To",
+	"References",
+	"X-Pm-Date",
+	"X-Pm-External-Id",
+	"X-Pm-Internal-Id",
+	"X-Pm-Conversationid-Id",
+	"X-Pm-Labels",
+}
+
+// LimitHeader shortens too long field values and drops the least important
+// fields of the header h so it fits in limits. When anything was changed,
+// the TruncatedHeaderKey field is set and true is returned. Applying it
+// to an already limited header is a no-op.
+func LimitHeader(h textproto.MIMEHeader, limits HeaderLimits) (truncated bool) {
+	maxFields, maxTotalSize := limits.MaxFields, limits.MaxTotalSize
+	if _, ok := h[TruncatedHeaderKey]; !ok {
+		if maxFields > 0 {
+			maxFields--
+		}
+		if maxTotalSize > 0 {
+			maxTotalSize -= truncatedMarkerReserve
+		}
+	}
+
+	var fields, totalSize, dropped, shortened int
+
+	isEssential := map[string]bool{}
+	for _, key := range essentialHeaderFields {
+		isEssential[key] = true
+		values, ok := h[key]
+		if !ok {
+			continue
+		}
+		for i := range values {
+			if shortValue, ok := shortenHeaderValue(values[i], limits.MaxFieldSize); ok {
+				values[i] = shortValue
+				shortened++
+			}
+			fields++
+			totalSize += headerFieldSize(key, values[i])
+		}
+	}
+
+	others := []string{}
+	for key := range h {
+		if !isEssential[key] {
+			others = append(others, key)
+		}
+	}
+	sort.Strings(others)
+
+	for _, key := range others {
+		kept := h[key][:0]
+		for _, value := range h[key] {
+			if shortValue, ok := shortenHeaderValue(value, limits.MaxFieldSize); ok {
+				value = shortValue
+				shortened++
+			}
+			size := headerFieldSize(key, value)
+			if (maxFields > 0 && fields+1 > maxFields) || (maxTotalSize > 0 && totalSize+size > maxTotalSize) {
+				dropped++
+				continue
+			}
+			fields++
+			totalSize += size
+			kept = append(kept, value)
+		}
+		if len(kept) == 0 {
+			delete(h, key)
+		} else {
+			h[key] = kept
+		}
+	}
+
+	if dropped == 0 && shortened == 0 {
+		return false
+	}
+
+	log.WithField("dropped", dropped).WithField("shortened", shortened).Warn("Message header exceeds limits, truncating")
+	h.Set(TruncatedHeaderKey, fmt.Sprintf("dropped=%d; shortened=%d", dropped, shortened))
+	return true
+}
+
+// shortenHeaderValue cuts the value to at most maxSize bytes without
+// splitting UTF-8 characters.
+func shortenHeaderValue(value string, maxSize int) (string, bool) {
+	if maxSize <= 0 || len(value) <= maxSize {
+		return value, false
+	}
+	cut := maxSize
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	return value[:cut], true
+}
+
+// headerFieldSize is the size of the written field including ": " and CRLF.
+func headerFieldSize(key, value string) int {
+	return len(key) + len(value) + 4
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"fmt"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitHeaderWithinLimits(t *testing.T) {
+	h := textproto.MIMEHeader{}
+	h.Set("Subject", "Hello")
+	h.Set("X-Custom", "value")
+
+	require.False(t, LimitHeader(h, DefaultHeaderLimits))
+	require.Equal(t, "", h.Get(TruncatedHeaderKey))
+	require.Equal(t, "value", h.Get("X-Custom"))
+}
+
+func TestLimitHeaderTooManyFields(t *testing.T) {
+	h := textproto.MIMEHeader{}
+	h.Set("Subject", "Hello")
+	for i := 0; i < 100; i++ {
+		h.Add("X-Spam", fmt.Sprintf("spam %d", i))
+	}
+
+	limits := HeaderLimits{MaxFields: 10}
+	require.True(t, LimitHeader(h, limits))
+	require.Equal(t, "Hello", h.Get("Subject"))
+	require.Len(t, h["X-Spam"], 8)
+	require.Equal(t, "dropped=92; shortened=0", h.Get(TruncatedHeaderKey))
+
+	require.False(t, LimitHeader(h, limits))
+	require.Equal(t, "dropped=92; shortened=0", h.Get(TruncatedHeaderKey))
+}
+
+func TestLimitHeaderTooLongValue(t *testing.T) {
+	h := textproto.MIMEHeader{}
+	h.Set("Subject", strings.Repeat("č", 100))
+	h.Set("X-Huge", strings.Repeat("a", 1000))
+
+	require.True(t, LimitHeader(h, HeaderLimits{MaxFieldSize: 51}))
+	require.Equal(t, strings.Repeat("č", 25), h.Get("Subject"))
+	require.Equal(t, strings.Repeat("a", 51), h.Get("X-Huge"))
+	require.Equal(t, "dropped=0; shortened=2", h.Get(TruncatedHeaderKey))
+}
+
+func TestLimitHeaderTotalSize(t *testing.T) {
+	h := textproto.MIMEHeader{}
+	h.Set("Subject", "Hello")
+	h.Set("X-A", strings.Repeat("a", 100))
+	h.Set("X-B", strings.Repeat("b", 100))
+
+	limits := HeaderLimits{MaxTotalSize: 200}
+	require.True(t, LimitHeader(h, limits))
+	require.Equal(t, "Hello", h.Get("Subject"))
+	require.NotEmpty(t, h.Get("X-A"))
+	require.Empty(t, h.Get("X-B"))
+	require.Equal(t, "dropped=1; shortened=0", h.Get(TruncatedHeaderKey))
+
+	require.False(t, LimitHeader(h, limits))
+}
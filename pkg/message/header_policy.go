@@ -0,0 +1,79 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"net/textproto"
+	"strings"
+)
+
+// HeaderPolicy chooses which header fields not needed to display the message
+// are kept in built messages.
+type HeaderPolicy struct {
+	Bcc      bool // Bcc of sent messages.
+	Internal bool // X-Pm-* fields added by Bridge and the server.
+	Received bool // Received chain and other trace fields added on delivery.
+}
+
+// Header policies of consumers of built messages.
+var (
+	// IMAPHeaderPolicy keeps everything because clients show Bcc of sent
+	// messages and filters rely on the internal fields.
+	IMAPHeaderPolicy = HeaderPolicy{Bcc: true, Internal: true, Received: true} //nolint[gochecknoglobals]
+
+	// ExportHeaderPolicy keeps everything for complete backups.
+	ExportHeaderPolicy = HeaderPolicy{Bcc: true, Internal: true, Received: true} //nolint[gochecknoglobals]
+
+	// ForwardHeaderPolicy keeps only fields which can be shown to others.
+	ForwardHeaderPolicy = HeaderPolicy{} //nolint[gochecknoglobals]
+)
+
+// traceHeaderKeys are fields added by servers during delivery.
+var traceHeaderKeys = []string{ //nolint[gochecknoglobals]
+	"Received",
+	"X-Received",
+	"Received-Spf",
+	"Return-Path",
+	"Delivered-To",
+	"X-Original-To",
+	"Authentication-Results",
+	"Arc-Seal",
+	"Arc-Message-Signature",
+	"Arc-Authentication-Results",
+}
+
+// Apply removes fields which are not allowed by the policy.
+func (p HeaderPolicy) Apply(h textproto.MIMEHeader) {
+	if !p.Bcc {
+		h.Del("Bcc")
+	}
+
+	if !p.Internal {
+		for key := range h {
+			if strings.HasPrefix(strings.ToLower(key), "x-pm-") {
+				delete(h, key)
+			}
+		}
+	}
+
+	if !p.Received {
+		for _, key := range traceHeaderKeys {
+			h.Del(key)
+		}
+	}
+}
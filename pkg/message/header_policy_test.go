@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"net/mail"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func newHeaderPolicyTestMessage() *pmapi.Message {
+	return &pmapi.Message{
+		ID:      "msgID",
+		Subject: "Hello",
+		Flags:   pmapi.FlagSent,
+		Header: mail.Header{
+			"Received":               {"from a by b", "from c by d"},
+			"Authentication-Results": {"pm.me; dkim=pass"},
+			"X-Mailer":               {"client"},
+		},
+		ToList:  []*mail.Address{{Address: "to@pm.me"}},
+		BCCList: []*mail.Address{{Address: "bcc@pm.me"}},
+	}
+}
+
+func TestHeaderPolicyKeepsEverything(t *testing.T) {
+	h := GetHeader(newHeaderPolicyTestMessage())
+	IMAPHeaderPolicy.Apply(h)
+
+	require.Equal(t, "<bcc@pm.me>", h.Get("Bcc"))
+	require.Equal(t, "msgID", h.Get("X-Pm-Internal-Id"))
+	require.Len(t, h["Received"], 2)
+}
+
+func TestHeaderPolicyForward(t *testing.T) {
+	h := GetHeader(newHeaderPolicyTestMessage())
+	ForwardHeaderPolicy.Apply(h)
+
+	require.NotContains(t, h, "Bcc")
+	require.NotContains(t, h, "X-Pm-Internal-Id")
+	require.NotContains(t, h, EncryptionHeaderKey)
+	require.NotContains(t, h, "Received")
+	require.NotContains(t, h, "Authentication-Results")
+
+	require.Equal(t, "Hello", h.Get("Subject"))
+	require.Equal(t, "<to@pm.me>", h.Get("To"))
+	require.Equal(t, "client", h.Get("X-Mailer"))
+	require.Contains(t, h.Get("Message-Id"), "msgID")
+}
+
+func TestHeaderPolicyOnlyBcc(t *testing.T) {
+	h := GetHeader(newHeaderPolicyTestMessage())
+	HeaderPolicy{Internal: true, Received: true}.Apply(h)
+
+	require.NotContains(t, h, "Bcc")
+	require.Equal(t, "msgID", h.Get("X-Pm-Internal-Id"))
+	require.Len(t, h["Received"], 2)
+}
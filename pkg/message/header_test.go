@@ -0,0 +1,62 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"net/textproto"
+	"testing"
+
+	pmmime "github.com/ProtonMail/proton-bridge/pkg/mime"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLabelsHeader(t *testing.T) {
+	h := textproto.MIMEHeader{}
+
+	SetLabelsHeader(h, []string{"INBOX", "Labels/Work, important", `Folders/"Quoted"`})
+	require.Equal(t, `INBOX, "Labels/Work, important", "Folders/\"Quoted\""`, h.Get(LabelsHeaderKey))
+
+	SetLabelsHeader(h, []string{"Labels/Čeština"})
+	require.Equal(t, "=?utf-8?q?Labels/=C4=8Ce=C5=A1tina?=", h.Get(LabelsHeaderKey))
+
+	SetLabelsHeader(h, nil)
+	require.NotContains(t, h, LabelsHeaderKey)
+}
+
+func TestGetAttachmentHeaderEncodesFilename(t *testing.T) {
+	att := &pmapi.Attachment{
+		Name:     "Přehled výdajů za první čtvrtletí roku dvacet dvacet.xlsx",
+		MIMEType: "application/vnd.ms-excel",
+		Header:   textproto.MIMEHeader{},
+	}
+
+	h := GetAttachmentHeader(att)
+	require.Contains(t, h.Get("Content-Disposition"), "filename*0*=utf-8''P%C5%99ehled")
+	require.NotContains(t, h.Get("Content-Disposition"), "=?")
+
+	disposition, params, err := pmmime.ParseMediaType(h.Get("Content-Disposition"))
+	require.NoError(t, err)
+	require.Equal(t, "attachment", disposition)
+	require.Equal(t, att.Name, params["filename"])
+
+	mediaType, params, err := pmmime.ParseMediaType(h.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, att.MIMEType, mediaType)
+	require.Equal(t, att.Name, params["name"])
+}
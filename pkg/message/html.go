@@ -27,7 +27,8 @@ import (
 	"golang.org/x/net/html"
 )
 
-func plaintextToHTML(text string) (output string) {
+// PlaintextToHTML escapes the text and converts its line breaks to HTML.
+func PlaintextToHTML(text string) (output string) {
 	text = escape.EscapeString(text)
 	text = strings.Replace(text, "\n\r", "<br>", -1)
 	text = strings.Replace(text, "\r\n", "<br>", -1)
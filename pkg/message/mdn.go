@@ -0,0 +1,146 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// Headers and types of message disposition notifications, i.e. read
+// receipts, see RFC 8098.
+const (
+	DispositionNotificationToHeader = "Disposition-Notification-To"
+	dispositionNotificationMIMEType = "message/disposition-notification"
+	dispositionNotificationReport   = "disposition-notification"
+)
+
+// ErrMDNNotRequested is returned when the message does not ask for receipt.
+var ErrMDNNotRequested = errors.New("message does not request read receipt") //nolint[gochecknoglobals]
+
+// BuildMDN returns the notification that the original message was displayed
+// by `from`. The address to which it should be sent is taken from the
+// Disposition-Notification-To header of the original message.
+func BuildMDN(original *pmapi.Message, from string, now time.Time) (to string, body []byte, err error) {
+	if original.Header == nil {
+		return "", nil, ErrMDNNotRequested
+	}
+	addresses, err := mail.ParseAddressList(original.Header.Get(DispositionNotificationToHeader))
+	if err != nil || len(addresses) == 0 {
+		return "", nil, ErrMDNNotRequested
+	}
+	to = addresses[0].Address
+
+	data := MDNData{Subject: original.Subject, Recipient: from}
+	subject, err := ExecuteTemplate(MDNSubjectTemplate, data)
+	if err != nil {
+		return "", nil, err
+	}
+	text, err := ExecuteTemplate(MDNBodyTemplate, data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	b := &bytes.Buffer{}
+	w := multipart.NewWriter(b)
+
+	h := textproto.MIMEHeader{}
+	h.Set("From", from)
+	h.Set("To", to)
+	h.Set("Subject", mime.QEncoding.Encode("utf-8", subject))
+	h.Set("Date", now.Format(time.RFC1123Z))
+	h.Set("Auto-Submitted", "auto-replied")
+	originalID := original.Header.Get("Message-Id")
+	if originalID != "" {
+		h.Set("In-Reply-To", originalID)
+		h.Set("References", originalID)
+	}
+	h.Set("Mime-Version", "1.0")
+	h.Set("Content-Type", fmt.Sprintf("multipart/report; report-type=%s; boundary=%s", dispositionNotificationReport, w.Boundary()))
+	if err := WriteHeader(b, h); err != nil {
+		return "", nil, err
+	}
+
+	textPart, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"8bit"},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	fmt.Fprintf(textPart, "%s\r\n", text)
+
+	reportPart, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {dispositionNotificationMIMEType}})
+	if err != nil {
+		return "", nil, err
+	}
+	fmt.Fprintf(reportPart, "Reporting-UA: ProtonMail Bridge\r\n")
+	fmt.Fprintf(reportPart, "Final-Recipient: rfc822; %s\r\n", from)
+	if originalID != "" {
+		fmt.Fprintf(reportPart, "Original-Message-ID: %s\r\n", originalID)
+	}
+	fmt.Fprintf(reportPart, "Disposition: manual-action/MDN-sent-manually; displayed\r\n")
+
+	if err := w.Close(); err != nil {
+		return "", nil, err
+	}
+	return to, b.Bytes(), nil
+}
+
+// GetMDNOriginalID returns Message-Id of the message to which the given
+// message is the read receipt. It returns false if the message is not a read
+// receipt or the original message cannot be identified.
+func GetMDNOriginalID(m *pmapi.Message) (originalID string, ok bool) {
+	if !isMDN(m) {
+		return "", false
+	}
+
+	if inReplyTo := ParseMessageIDs(m.Header.Get("In-Reply-To")); len(inReplyTo) > 0 {
+		return inReplyTo[0], true
+	}
+	if references := ParseMessageIDs(m.Header.Get("References")); len(references) > 0 {
+		return references[len(references)-1], true
+	}
+	return "", false
+}
+
+func isMDN(m *pmapi.Message) bool {
+	if m.Header == nil {
+		return false
+	}
+
+	if mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type")); err == nil &&
+		mediaType == "multipart/report" && params["report-type"] == dispositionNotificationReport {
+		return true
+	}
+
+	for _, att := range m.Attachments {
+		if att.MIMEType == dispositionNotificationMIMEType {
+			return true
+		}
+	}
+	return false
+}
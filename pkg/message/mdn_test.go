@@ -0,0 +1,94 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildMDN(t *testing.T) {
+	defer SetTemplateOptions(TemplateOptions{})
+	SetTemplateOptions(TemplateOptions{Locale: "en"})
+
+	original := &pmapi.Message{
+		Subject: "Hello",
+		Header: mail.Header{
+			"Message-Id":                  {"<original@example.com>"},
+			"Disposition-Notification-To": {"Sender <sender@example.com>"},
+		},
+	}
+
+	to, body, err := BuildMDN(original, "me@pm.me", time.Unix(1600000000, 0))
+	require.NoError(t, err)
+	require.Equal(t, "sender@example.com", to)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(body))
+	require.NoError(t, err)
+	require.Equal(t, "Read: Hello", msg.Header.Get("Subject"))
+	require.Equal(t, "<original@example.com>", msg.Header.Get("In-Reply-To"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/report", mediaType)
+	require.Equal(t, "disposition-notification", params["report-type"])
+
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	_, err = r.NextPart()
+	require.NoError(t, err)
+	report, err := r.NextPart()
+	require.NoError(t, err)
+	require.Equal(t, "message/disposition-notification", report.Header.Get("Content-Type"))
+	reportBody, err := ioutil.ReadAll(report)
+	require.NoError(t, err)
+	require.True(t, strings.Contains(string(reportBody), "Original-Message-ID: <original@example.com>"))
+
+	receipt := &pmapi.Message{Header: mail.Header{
+		"Content-Type": {msg.Header.Get("Content-Type")},
+		"In-Reply-To":  {msg.Header.Get("In-Reply-To")},
+	}}
+	originalID, ok := GetMDNOriginalID(receipt)
+	require.True(t, ok)
+	require.Equal(t, "<original@example.com>", originalID)
+}
+
+func TestBuildMDNNotRequested(t *testing.T) {
+	_, _, err := BuildMDN(&pmapi.Message{Header: mail.Header{}}, "me@pm.me", time.Now())
+	require.Equal(t, ErrMDNNotRequested, err)
+}
+
+func TestGetMDNOriginalID(t *testing.T) {
+	_, ok := GetMDNOriginalID(&pmapi.Message{Header: mail.Header{"In-Reply-To": {"<a@b>"}}})
+	require.False(t, ok, "reply is not a receipt")
+
+	originalID, ok := GetMDNOriginalID(&pmapi.Message{
+		Header:      mail.Header{"References": {"<first@b> <second@b>"}},
+		Attachments: []*pmapi.Attachment{{MIMEType: "message/disposition-notification"}},
+	})
+	require.True(t, ok)
+	require.Equal(t, "<second@b>", originalID)
+}
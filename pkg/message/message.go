@@ -50,3 +50,27 @@ func SeparateInlineAttachments(m *pmapi.Message) (atts, inlines []*pmapi.Attachm
 	}
 	return
 }
+
+// GetAttachmentBySection returns the attachment which is in the section of
+// the message built by bridge or nil if the section is not an attachment.
+// Inline attachments follow the body in the related part and the other
+// attachments follow the body (or the related part) in the main part.
+func GetAttachmentBySection(m *pmapi.Message, sectionPath []int) *pmapi.Attachment {
+	return getAttachmentSections(m)[stringPathFromInts(sectionPath)]
+}
+
+func getAttachmentSections(m *pmapi.Message) map[string]*pmapi.Attachment {
+	sections := map[string]*pmapi.Attachment{}
+	if m.MIMEType == pmapi.ContentTypeMultipartMixed {
+		return sections
+	}
+
+	atts, inlines := SeparateInlineAttachments(m)
+	for i, inline := range inlines {
+		sections[fmt.Sprintf("1.%d", i+2)] = inline
+	}
+	for i, att := range atts {
+		sections[fmt.Sprintf("%d", i+2)] = att
+	}
+	return sections
+}
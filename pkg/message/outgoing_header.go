@@ -0,0 +1,167 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/binary"
+	"io"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Outgoing messages are normalized before they are signed and sent, so
+// that relays have no reason to rewrite them and break DKIM or ARC
+// signatures of the final message: header values are unfolded, written in
+// a fixed order and folded again to lines of at most 78 characters.
+
+// maxHeaderLineLength is the line length recommended by RFC 5322 section 2.1.1.
+const maxHeaderLineLength = 78
+
+// outgoingHeaderOrder lists fields written first, in the order suggested by
+// RFC 5322 section 3.6. Other fields follow sorted by name.
+var outgoingHeaderOrder = []string{ //nolint[gochecknoglobals]
+	"Date",
+	"From",
+	"Sender",
+	"Reply-To",
+	"To",
+	"Cc",
+	"Bcc",
+	"Message-Id",
+	"In-Reply-To",
+	"References",
+	"Subject",
+	"Mime-Version",
+	"Content-Type",
+	"Content-Transfer-Encoding",
+	"Content-Disposition",
+	"Content-Id",
+	"Content-Description",
+}
+
+// GenerateMessageID returns unique message ID in the domain. The left part
+// is made of the current time and random bytes, so the same message sent
+// twice gets different IDs.
+func GenerateMessageID(domain string) (string, error) {
+	b := make([]byte, 20)
+	binary.BigEndian.PutUint64(b, uint64(time.Now().UnixNano()))
+	if _, err := rand.Read(b[8:]); err != nil {
+		return "", err
+	}
+	id := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+	return "<" + id + "@" + domain + ">", nil
+}
+
+// NormalizeOutgoingHeader unfolds values of the header fields and removes
+// white space around them.
+func NormalizeOutgoingHeader(h mail.Header) {
+	for key, values := range h {
+		for i, value := range values {
+			values[i] = unfoldHeaderValue(value)
+		}
+		h[key] = values
+	}
+}
+
+func unfoldHeaderValue(value string) string {
+	value = strings.NewReplacer("\r\n", "", "\r", "", "\n", "").Replace(value)
+	return strings.TrimSpace(value)
+}
+
+// FoldHeaderField returns the field with CRLF line endings. Lines are
+// folded at white space to at most 78 characters where possible, so the
+// field is unfolded to the same value.
+func FoldHeaderField(key, value string) string {
+	value = unfoldHeaderValue(value)
+	if value == "" {
+		return key + ":\r\n"
+	}
+
+	b := &strings.Builder{}
+	line := key + ":"
+	for _, word := range strings.Split(value, " ") {
+		// Lines must not consist of white space only.
+		if word != "" && len(line) > len(key)+1 && len(line)+1+len(word) > maxHeaderLineLength {
+			b.WriteString(line + "\r\n")
+			line = ""
+		}
+		line += " " + word
+	}
+	b.WriteString(line + "\r\n")
+	return b.String()
+}
+
+// WriteOutgoingHeader writes the header with folded fields in the fixed
+// order followed by the empty line.
+func WriteOutgoingHeader(w io.Writer, h textproto.MIMEHeader) error {
+	for _, key := range outgoingHeaderKeys(h) {
+		for _, value := range h[key] {
+			if _, err := io.WriteString(w, FoldHeaderField(key, value)); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := io.WriteString(w, "\r\n")
+	return err
+}
+
+func outgoingHeaderKeys(h textproto.MIMEHeader) []string {
+	keys := []string{}
+	ordered := map[string]bool{}
+	for _, key := range outgoingHeaderOrder {
+		ordered[key] = true
+		if _, ok := h[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+
+	others := []string{}
+	for key := range h {
+		if !ordered[key] {
+			others = append(others, key)
+		}
+	}
+	sort.Strings(others)
+
+	return append(keys, others...)
+}
+
+// NormalizeOutgoingMIME returns the MIME entity with the header written by
+// WriteOutgoingHeader. The body is not changed.
+func NormalizeOutgoingMIME(entity string) (string, error) {
+	br := bufio.NewReader(strings.NewReader(entity))
+	h, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		return "", err
+	}
+
+	b := &strings.Builder{}
+	if err := WriteOutgoingHeader(b, h); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(b, br); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateMessageID(t *testing.T) {
+	id, err := GenerateMessageID("example.com")
+	require.NoError(t, err)
+	require.Regexp(t, `^<[a-z2-7]{32}@example\.com>$`, id)
+
+	other, err := GenerateMessageID("example.com")
+	require.NoError(t, err)
+	require.NotEqual(t, id, other)
+}
+
+func TestNormalizeOutgoingHeader(t *testing.T) {
+	h := mail.Header{
+		"Subject": {" Long\r\n subject\r\n\tfolded "},
+		"To":      {"alice@example.com,\r\n bob@example.com"},
+	}
+	NormalizeOutgoingHeader(h)
+	require.Equal(t, "Long subject\tfolded", h.Get("Subject"))
+	require.Equal(t, "alice@example.com, bob@example.com", h.Get("To"))
+}
+
+func TestFoldHeaderField(t *testing.T) {
+	require.Equal(t, "Subject: Hello\r\n", FoldHeaderField("Subject", "Hello"))
+	require.Equal(t, "Subject:\r\n", FoldHeaderField("Subject", ""))
+
+	value := strings.Repeat("word ", 40) + strings.Repeat("x", 100)
+	folded := FoldHeaderField("Subject", value)
+	lines := strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n")
+	require.True(t, len(lines) > 1)
+	for i, line := range lines {
+		if i > 0 {
+			require.True(t, strings.HasPrefix(line, " "), line)
+			require.NotEmpty(t, strings.TrimSpace(line))
+		}
+		if !strings.Contains(line, "xxx") {
+			require.True(t, len(line) <= maxHeaderLineLength, line)
+		}
+	}
+
+	// Unfolding returns the value.
+	require.Equal(t, "Subject: "+strings.TrimSpace(value), strings.ReplaceAll(strings.TrimSuffix(folded, "\r\n"), "\r\n", ""))
+
+	// Multiple spaces are kept and never make a line of white space.
+	require.Equal(t, "Subject: a   b\r\n", FoldHeaderField("Subject", "a   b"))
+}
+
+func TestWriteOutgoingHeader(t *testing.T) {
+	h := textproto.MIMEHeader{
+		"X-Custom":     {"2", "1"},
+		"Subject":      {"Hello"},
+		"Content-Type": {"text/plain"},
+		"From":         {"alice@example.com"},
+		"Date":         {"Mon, 1 Feb 2021 10:00:00 +0000"},
+		"Message-Id":   {"<id@example.com>"},
+		"Autocrypt":    {"addr=alice@example.com"},
+	}
+
+	b := &strings.Builder{}
+	require.NoError(t, WriteOutgoingHeader(b, h))
+	require.Equal(t, "Date: Mon, 1 Feb 2021 10:00:00 +0000\r\n"+
+		"From: alice@example.com\r\n"+
+		"Message-Id: <id@example.com>\r\n"+
+		"Subject: Hello\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Autocrypt: addr=alice@example.com\r\n"+
+		"X-Custom: 2\r\n"+
+		"X-Custom: 1\r\n"+
+		"\r\n", b.String())
+}
+
+func TestNormalizeOutgoingMIME(t *testing.T) {
+	entity := "Content-Transfer-Encoding: 7bit\r\nContent-Type: multipart/mixed;\r\n boundary=abc\r\n\r\n--abc\r\nContent-Type: text/plain\r\n\r\nHello\r\n--abc--\r\n"
+
+	normalized, err := NormalizeOutgoingMIME(entity)
+	require.NoError(t, err)
+	require.Equal(t, "Content-Type: multipart/mixed; boundary=abc\r\nContent-Transfer-Encoding: 7bit\r\n\r\n--abc\r\nContent-Type: text/plain\r\n\r\nHello\r\n--abc--\r\n", normalized)
+}
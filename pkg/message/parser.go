@@ -18,6 +18,7 @@
 package message
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
@@ -30,7 +31,6 @@ import (
 	"mime/quotedprintable"
 	"net/mail"
 	"net/textproto"
-	"regexp"
 	"strconv"
 	"strings"
 
@@ -65,19 +65,36 @@ func parseAttachment(filename string, mediaType string, h textproto.MIMEHeader)
 	return
 }
 
-var reEmailComment = regexp.MustCompile("[(][^)]*[)]") //nolint[gochecknoglobals]
+// readMessageLenient reads the message with normalized line endings and
+// lenient header. Content type which cannot be parsed is replaced by plain
+// text so the body is not lost.
+func readMessageLenient(body []byte, diag *pmmime.Diagnostics) (*mail.Message, error) {
+	r := bufio.NewReader(bytes.NewReader(pmmime.NormalizeLineEndings(body, diag)))
 
-// parseAddressComment removes the comments completely even though they should be allowed
-// http://tools.wordtothewise.com/rfc/822
-// NOTE: This should be supported in go>1.10 but it seems it's not ¯\_(ツ)_/¯
-func parseAddressComment(raw string) string {
-	return reEmailComment.ReplaceAllString(raw, "")
+	h, err := pmmime.ReadHeader(r, diag)
+	if err != nil {
+		return nil, err
+	}
+
+	fixContentType(h, diag)
+
+	return &mail.Message{Header: mail.Header(h), Body: r}, nil
+}
+
+// fixContentType replaces invalid content type of the message by text/plain.
+func fixContentType(h textproto.MIMEHeader, diag *pmmime.Diagnostics) {
+	if contentType := h.Get("Content-Type"); contentType != "" {
+		if _, _, err := pmmime.ParseMediaType(contentType); err != nil {
+			diag.Add("invalid content type %q used as text/plain", contentType)
+			h.Set("Content-Type", "text/plain")
+		}
+	}
 }
 
 // Some clients incorrectly format messages with embedded attachments to have a format like
 // I. text/plain II. attachment III. text/plain
 // which we need to convert to a single HTML part with an embedded attachment.
-func combineParts(m *pmapi.Message, parts []io.Reader, headers []textproto.MIMEHeader, convertPlainToHTML bool, atts *[]io.Reader) (isHTML bool, err error) { //nolint[funlen]
+func combineParts(m *pmapi.Message, parts []io.Reader, headers []textproto.MIMEHeader, convertPlainToHTML bool, atts *[]io.Reader, diag *pmmime.Diagnostics) (isHTML bool, err error) { //nolint[funlen]
 	isHTML = true
 	foundText := false
 
@@ -105,8 +122,13 @@ func combineParts(m *pmapi.Message, parts []io.Reader, headers []textproto.MIMEH
 			if b, err = ioutil.ReadAll(d); err != nil {
 				continue
 			}
-			b, err = pmmime.DecodeCharset(b, contentType)
-			if err != nil {
+			var decoded []byte
+			if decoded, err = pmmime.DecodeCharset(b, contentType); err == nil {
+				b = decoded
+			} else if diag != nil {
+				diag.Add("text part with undecodable charset used as is: %v", err)
+				err = nil
+			} else {
 				log.Warn("Decode charset error: ", err)
 				return false, err
 			}
@@ -115,7 +137,7 @@ func combineParts(m *pmapi.Message, parts []io.Reader, headers []textproto.MIMEH
 				if !convertPlainToHTML {
 					isHTML = false
 				} else {
-					contents = plaintextToHTML(contents)
+					contents = PlaintextToHTML(contents)
 				}
 			} else if strings.Contains(mediaType, "text/html") && len(contents) > 0 {
 				contents, err = stripHTML(contents)
@@ -413,12 +435,68 @@ func (pka *PublicKeyAttacher) Accept(partReader io.Reader, header textproto.MIME
 // ======= Parser ==========
 
 func Parse(r io.Reader, attachedPublicKey, attachedPublicKeyName string) (m *pmapi.Message, mimeBody string, plainContents string, atts []io.Reader, err error) {
+	return parse(r, attachedPublicKey, attachedPublicKeyName, nil)
+}
+
+// ParseLenient parses the message as Parse but recovers from malformed
+// messages: bare CR or LF line endings, invalid header lines, 8-bit header
+// values, invalid content types and missing or broken multipart boundaries.
+// It returns the salvaged message with the list of recovered problems.
+func ParseLenient(r io.Reader, attachedPublicKey, attachedPublicKeyName string) (m *pmapi.Message, mimeBody string, plainContents string, atts []io.Reader, diag pmmime.Diagnostics, err error) {
+	diag = pmmime.Diagnostics{}
+	m, mimeBody, plainContents, atts, err = parse(r, attachedPublicKey, attachedPublicKeyName, &diag)
+	return
+}
+
+// ParseForImport parses the message leniently as ParseLenient but reads r
+// only once, as the parts are needed, without keeping a copy of the whole
+// message. Imported messages need neither the MIME body nor the plain text
+// contents. Attachment readers may read the rest of r, so r must stay
+// readable until the attachments are read.
+func ParseForImport(r io.Reader) (m *pmapi.Message, atts []io.Reader, diag pmmime.Diagnostics, err error) {
+	diag = pmmime.Diagnostics{}
+
+	br := bufio.NewReader(pmmime.NewLineEndingReader(r, &diag))
+	h, err := pmmime.ReadHeader(br, &diag)
+	if err != nil {
+		return
+	}
+	fixContentType(h, &diag)
+
+	if m, err = parseHeader(mail.Header(h)); err != nil {
+		return
+	}
+
+	parts, headers, err := pmmime.GetAllChildPartsLenient(br, textproto.MIMEHeader(m.Header), &diag)
+	if err != nil {
+		return
+	}
+
+	convertPlainToHTML := checkHeaders(headers)
+	isHTML, err := combineParts(m, parts, headers, convertPlainToHTML, &atts, &diag)
+
+	if isHTML {
+		m.MIMEType = "text/html"
+	} else {
+		m.MIMEType = "text/plain"
+	}
+
+	return m, atts, diag, err
+}
+
+// parse is lenient when diag is set.
+func parse(r io.Reader, attachedPublicKey, attachedPublicKeyName string, diag *pmmime.Diagnostics) (m *pmapi.Message, mimeBody string, plainContents string, atts []io.Reader, err error) { //nolint[funlen]
 	secondReader := new(bytes.Buffer)
 	_, _ = secondReader.ReadFrom(r)
 
 	mimeBody = secondReader.String()
 
-	mm, err := mail.ReadMessage(secondReader)
+	var mm *mail.Message
+	if diag != nil {
+		mm, err = readMessageLenient(secondReader.Bytes(), diag)
+	} else {
+		mm, err = mail.ReadMessage(secondReader)
+	}
 	if err != nil {
 		return
 	}
@@ -442,6 +520,9 @@ func Parse(r io.Reader, attachedPublicKey, attachedPublicKeyName string) (m *pma
 	htmlOnlyConvertor := NewHTMLOnlyConvertor(plainTextCollector)
 
 	visitor := pmmime.NewMimeVisitor(htmlOnlyConvertor)
+	if diag != nil {
+		visitor = pmmime.NewLenientMimeVisitor(htmlOnlyConvertor, diag)
+	}
 	err = pmmime.VisitAll(bytes.NewReader(mmBodyData), h, visitor)
 	/*
 		err = visitor.VisitAll(h, bytes.NewReader(mmBodyData))
@@ -454,14 +535,14 @@ func Parse(r io.Reader, attachedPublicKey, attachedPublicKeyName string) (m *pma
 
 	plainContents = plainTextCollector.GetPlainText()
 
-	parts, headers, err := pmmime.GetAllChildParts(bytes.NewReader(mmBodyData), h)
+	parts, headers, err := pmmime.GetAllChildPartsLenient(bytes.NewReader(mmBodyData), h, diag)
 
 	if err != nil {
 		return
 	}
 
 	convertPlainToHTML := checkHeaders(headers)
-	isHTML, err := combineParts(m, parts, headers, convertPlainToHTML, &atts)
+	isHTML, err := combineParts(m, parts, headers, convertPlainToHTML, &atts, diag)
 
 	if isHTML {
 		m.MIMEType = "text/html"
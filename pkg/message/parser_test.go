@@ -22,99 +22,17 @@ import (
 	"io"
 	"io/ioutil"
 	"math/rand"
-	"net/mail"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/text/encoding/charmap"
 )
 
-func TestRFC822AddressFormat(t *testing.T) { //nolint[funlen]
-	tests := []struct {
-		address  string
-		expected []string
-	}{
-		{
-			" normal name  <username@server.com>",
-			[]string{
-				"\"normal name\" <username@server.com>",
-			},
-		},
-		{
-			" \"comma, name\"  <username@server.com>",
-			[]string{
-				"\"comma, name\" <username@server.com>",
-			},
-		},
-		{
-			" name  <username@server.com> (ignore comment)",
-			[]string{
-				"\"name\" <username@server.com>",
-			},
-		},
-		{
-			" name (ignore comment)  <username@server.com>,  (Comment as name) username2@server.com",
-			[]string{
-				"\"name\" <username@server.com>",
-				"<username2@server.com>",
-			},
-		},
-		{
-			" normal name  <username@server.com>, (comment)All.(around)address@(the)server.com",
-			[]string{
-				"\"normal name\" <username@server.com>",
-				"<All.address@server.com>",
-			},
-		},
-		{
-			" normal name  <username@server.com>, All.(\"comma, in comment\")address@(the)server.com",
-			[]string{
-				"\"normal name\" <username@server.com>",
-				"<All.address@server.com>",
-			},
-		},
-		{
-			" \"normal name\"  <username@server.com>, \"comma, name\" <address@server.com>",
-			[]string{
-				"\"normal name\" <username@server.com>",
-				"\"comma, name\" <address@server.com>",
-			},
-		},
-		{
-			" \"comma, one\"  <username@server.com>, \"comma, two\" <address@server.com>",
-			[]string{
-				"\"comma, one\" <username@server.com>",
-				"\"comma, two\" <address@server.com>",
-			},
-		},
-		{
-			" \"comma, name\"  <username@server.com>, another, name <address@server.com>",
-			[]string{
-				"\"comma, name\" <username@server.com>",
-				"\"another, name\" <address@server.com>",
-			},
-		},
-	}
-
-	for _, data := range tests {
-		uncommented := parseAddressComment(data.address)
-		result, err := mail.ParseAddressList(uncommented)
-		if err != nil {
-			t.Errorf("Can not parse '%s' created from '%s': %v", uncommented, data.address, err)
-		}
-		if len(result) != len(data.expected) {
-			t.Errorf("Wrong parsing of '%s' created from '%s': expected '%s' but have '%+v'", uncommented, data.address, data.expected, result)
-		}
-		for i, result := range result {
-			if data.expected[i] != result.String() {
-				t.Errorf("Wrong parsing\nof %q\ncreated from %q:\nexpected %q\nbut have %q", uncommented, data.address, data.expected, result.String())
-			}
-		}
-	}
-}
-
 func f(filename string) io.ReadCloser {
 	f, err := os.Open(filepath.Join("testdata", filename))
 
@@ -490,6 +408,93 @@ func _TestParseMessageWithAttachedPublicKey(t *testing.T) { // nolint[deadcode]
 	assert.Len(t, atts, 1)
 }
 
+func TestParseLenientMalformedMultipart(t *testing.T) {
+	raw := "From: Sender <sender@pm.me>\n" +
+		"To: Receiver <receiver@pm.me>\n" +
+		"this is not a header\n" +
+		"Subject: Malformed\n" +
+		"Content-Type: multipart/mixed; boundary=longrandomstring\n" +
+		"\n" +
+		"--longrandomstring\n" +
+		"Content-Type: text/plain\n" +
+		"\n" +
+		"body\n" +
+		"--longrandomstring\n" +
+		"Content-Type: text/plain\n" +
+		"Content-Disposition: attachment; filename=att.txt\n" +
+		"\n" +
+		"attachment\n"
+
+	_, _, _, _, err := Parse(strings.NewReader(raw), "", "") //nolint[dogsled]
+	assert.Error(t, err)
+
+	m, _, plainContents, atts, diag, err := ParseLenient(strings.NewReader(raw), "", "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, diag)
+
+	assert.Equal(t, "Malformed", m.Subject)
+	assert.Equal(t, `"Sender" <sender@pm.me>`, m.Sender.String())
+	assert.Equal(t, "body", plainContents)
+
+	assert.Len(t, atts, 1)
+	assert.Equal(t, "attachment", readerToString(atts[0]))
+}
+
+func TestParseForImportMatchesParseLenient(t *testing.T) {
+	for _, name := range []string{
+		"text_plain.eml",
+		"text_plain_latin1.eml",
+		"text_plain_octet_attachment.eml",
+		"text_plain_plain_attachment.eml",
+		"text_plain_image_inline.eml",
+		"text_html.eml",
+		"text_html_octet_attachment.eml",
+		"text_html_image_inline.eml",
+		"multiple_text_parts.eml",
+	} {
+		expected, _, _, expectedAtts, _, err := ParseLenient(f(name), "", "")
+		require.NoError(t, err, name)
+
+		m, atts, _, err := ParseForImport(iotest.OneByteReader(f(name)))
+		require.NoError(t, err, name)
+
+		require.Equal(t, expected.Subject, m.Subject, name)
+		require.Equal(t, expected.MIMEType, m.MIMEType, name)
+		require.Equal(t, expected.Body, m.Body, name)
+		require.Equal(t, len(expected.Attachments), len(m.Attachments), name)
+		require.Equal(t, len(expectedAtts), len(atts), name)
+		for i := range atts {
+			require.Equal(t, expected.Attachments[i].Name, m.Attachments[i].Name, name)
+			require.Equal(t, readerToString(expectedAtts[i]), readerToString(atts[i]), name)
+		}
+	}
+}
+
+func TestParseForImportMalformed(t *testing.T) {
+	raw := "From: Sender <sender@pm.me>\n" +
+		"Subject: Malformed\n" +
+		"Content-Type: multipart/mixed; boundary=longrandomstring\n" +
+		"\n" +
+		"--longrandomstring\n" +
+		"Content-Type: text/plain\n" +
+		"\n" +
+		"body\n" +
+		"--longrandomstring\n" +
+		"Content-Type: text/plain\n" +
+		"Content-Disposition: attachment; filename=att.txt\n" +
+		"\n" +
+		"attachment\n"
+
+	m, atts, diag, err := ParseForImport(strings.NewReader(raw))
+	require.NoError(t, err)
+	require.NotEmpty(t, diag)
+
+	require.Equal(t, "Malformed", m.Subject)
+	require.Equal(t, "body", m.Body)
+	require.Len(t, atts, 1)
+	require.Equal(t, "attachment", readerToString(atts[0]))
+}
+
 // NOTE: Enable when bug is fixed.
 func _TestParseMessageTextHTMLWithEmbeddedForeignEncoding(t *testing.T) { // nolint[deadcode]
 	rand.Seed(0)
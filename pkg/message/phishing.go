@@ -0,0 +1,303 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"net"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// PhishingScoreHeaderKey is the header field with the score of links of
+// the message from 0 (nothing suspect) to 100, followed by the reasons,
+// e.g. `70; link-text, punycode`.
+const PhishingScoreHeaderKey = "X-Pm-Phishing-Score"
+
+// Reasons why links of the message are suspect.
+const (
+	PhishingPunycode  = "punycode"   // Host is internationalized, e.g. xn--pypal-4ve.com.
+	PhishingLinkText  = "link-text"  // Text of the link shows a different domain than the link goes to.
+	PhishingLookalike = "lookalike"  // Host imitates a protected domain, e.g. paypa1.com or paypal.com.evil.net.
+	PhishingUserInfo  = "userinfo"   // URL hides the host behind user info, e.g. https://paypal.com@evil.net.
+	PhishingIPAddress = "ip-address" // Host is an IP address.
+)
+
+// phishingWeights are scores of reasons; the score of the message is the
+// sum of scores of all found reasons.
+var phishingWeights = map[string]int{ //nolint[gochecknoglobals]
+	PhishingPunycode:  40,
+	PhishingLinkText:  50,
+	PhishingLookalike: 50,
+	PhishingUserInfo:  40,
+	PhishingIPAddress: 30,
+}
+
+// DefaultProtectedDomains are domains often imitated by phishing.
+var DefaultProtectedDomains = []string{ //nolint[gochecknoglobals]
+	"protonmail.com",
+	"proton.me",
+	"paypal.com",
+	"apple.com",
+	"icloud.com",
+	"google.com",
+	"microsoft.com",
+	"office.com",
+	"outlook.com",
+	"amazon.com",
+	"facebook.com",
+	"netflix.com",
+	"dhl.com",
+}
+
+// nolint[gochecknoglobals]
+var (
+	rePlainURL = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"']+`)
+
+	// lookalikeReplacer maps characters commonly swapped in lookalike
+	// domains to the ones they imitate.
+	lookalikeReplacer = strings.NewReplacer("0", "o", "1", "l", "3", "e", "5", "s", "rn", "m", "vv", "w")
+)
+
+// PhishingResult is the score of links of the message.
+type PhishingResult struct {
+	Score   int
+	Reasons []string `json:",omitempty"`
+}
+
+// IsSuspect returns whether any link is suspect.
+func (r PhishingResult) IsSuspect() bool {
+	return r.Score > 0
+}
+
+// LinkChecker scores links of message bodies by local heuristics: punycode
+// hosts, link text showing another domain than the link, lookalikes of
+// protected domains, user info in URL and IP addresses instead of hosts.
+// Nothing is sent anywhere.
+type LinkChecker struct {
+	protected map[string]bool // Registrable domains.
+	labels    []string        // Registrable domains without suffix, e.g. `paypal`.
+}
+
+// NewLinkChecker returns the checker protecting default and given domains.
+func NewLinkChecker(domains []string) *LinkChecker {
+	c := &LinkChecker{protected: map[string]bool{}}
+	for _, domain := range append(append([]string{}, DefaultProtectedDomains...), domains...) {
+		domain = registrableDomain(strings.ToLower(strings.TrimSpace(domain)))
+		if domain == "" || c.protected[domain] {
+			continue
+		}
+		c.protected[domain] = true
+		c.labels = append(c.labels, strings.SplitN(domain, ".", 2)[0])
+	}
+	return c
+}
+
+// Check scores links of the decrypted body. Links of HTML bodies are taken
+// from anchors together with their text, links of other bodies are found
+// in the text.
+func (c *LinkChecker) Check(body string, isHTML bool) PhishingResult {
+	reasons := map[string]bool{}
+
+	if isHTML {
+		if doc, err := html.Parse(strings.NewReader(body)); err == nil {
+			c.checkNode(doc, reasons)
+		}
+	} else {
+		for _, link := range rePlainURL.FindAllString(body, -1) {
+			c.checkLink(strings.TrimRight(link, ".,;:!?)]"), "", reasons)
+		}
+	}
+
+	result := PhishingResult{}
+	for reason := range reasons {
+		result.Score += phishingWeights[reason]
+		result.Reasons = append(result.Reasons, reason)
+	}
+	if result.Score > 100 {
+		result.Score = 100
+	}
+	sort.Strings(result.Reasons)
+	return result
+}
+
+func (c *LinkChecker) checkNode(n *html.Node, reasons map[string]bool) {
+	if n.Type == html.ElementNode && n.Data == "a" {
+		for _, attr := range n.Attr {
+			if attr.Key == "href" {
+				c.checkLink(strings.TrimSpace(attr.Val), nodeText(n), reasons)
+			}
+		}
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.checkNode(child, reasons)
+	}
+}
+
+func (c *LinkChecker) checkLink(link, text string, reasons map[string]bool) {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return
+	}
+
+	if u.User != nil {
+		reasons[PhishingUserInfo] = true
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if net.ParseIP(host) != nil {
+		reasons[PhishingIPAddress] = true
+		if linkTextDomain(text) != "" {
+			reasons[PhishingLinkText] = true
+		}
+		return
+	}
+
+	if asciiHost, err := idna.ToASCII(host); err == nil && asciiHost != host {
+		host = asciiHost
+	}
+	if strings.HasPrefix(host, "xn--") || strings.Contains(host, ".xn--") {
+		reasons[PhishingPunycode] = true
+	}
+
+	domain := registrableDomain(host)
+	if c.isLookalike(host, domain) {
+		reasons[PhishingLookalike] = true
+	}
+	if textDomain := linkTextDomain(text); textDomain != "" && textDomain != domain {
+		reasons[PhishingLinkText] = true
+	}
+}
+
+// isLookalike returns whether the host imitates a protected domain by
+// swapped characters or by having it as a subdomain of another domain.
+func (c *LinkChecker) isLookalike(host, domain string) bool {
+	if domain == "" || c.protected[domain] {
+		return false
+	}
+
+	for protected := range c.protected {
+		if strings.HasPrefix(host, protected+".") || strings.Contains(host, "."+protected+".") {
+			return true
+		}
+	}
+
+	label := strings.SplitN(domain, ".", 2)[0]
+	normalized := lookalikeReplacer.Replace(label)
+	for _, protected := range c.labels {
+		if normalized == protected || (len(protected) >= 5 && editDistance(label, protected) == 1) {
+			return true
+		}
+		for _, part := range strings.Split(label, "-") {
+			if part == protected && label != protected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// linkTextDomain returns the registrable domain shown by the text of the
+// link or empty string when the text does not look like a URL.
+func linkTextDomain(text string) string {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" || strings.ContainsAny(text, " \t\r\n") {
+		return ""
+	}
+	if !strings.Contains(text, "://") {
+		if !strings.HasPrefix(text, "www.") {
+			return ""
+		}
+		text = "http://" + text
+	}
+	u, err := url.Parse(text)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	host := strings.TrimSuffix(u.Hostname(), ".")
+	if asciiHost, err := idna.ToASCII(host); err == nil {
+		host = asciiHost
+	}
+	return registrableDomain(host)
+}
+
+func registrableDomain(host string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return ""
+	}
+	return domain
+}
+
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var text strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		text.WriteString(nodeText(child))
+	}
+	return text.String()
+}
+
+// editDistance returns the Levenshtein distance of the strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// SetPhishingScoreHeader sets the score of links of the message to the
+// header. Any field of the same name sent by the sender is removed.
+func SetPhishingScoreHeader(h textproto.MIMEHeader, result PhishingResult) {
+	h.Del(PhishingScoreHeaderKey)
+
+	value := strconv.Itoa(result.Score)
+	if len(result.Reasons) > 0 {
+		value += "; " + strings.Join(result.Reasons, ", ")
+	}
+	h.Set(PhishingScoreHeaderKey, value)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"net/textproto"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkCheckerClean(t *testing.T) {
+	c := NewLinkChecker(nil)
+
+	html := `<p>Log in at <a href="https://www.paypal.com/signin">www.paypal.com</a> or <a href="https://example.com/x">here</a>.</p>`
+	require.Equal(t, PhishingResult{}, c.Check(html, true))
+
+	plain := "See https://github.com/ProtonMail/proton-bridge, or mailto:user@example.com."
+	require.Equal(t, PhishingResult{}, c.Check(plain, false))
+}
+
+func TestLinkCheckerReasons(t *testing.T) {
+	c := NewLinkChecker([]string{"bank.example.org"})
+
+	tests := []struct {
+		body   string
+		isHTML bool
+		want   PhishingResult
+	}{
+		{`<a href="https://evil.net/login">https://www.paypal.com/login</a>`, true, PhishingResult{Score: 50, Reasons: []string{PhishingLinkText}}},
+		{`<a href="https://xn--pypal-4ve.com/">Log in</a>`, true, PhishingResult{Score: 40, Reasons: []string{PhishingPunycode}}},
+		{`<a href="https://pаypal.com/">Log in</a>`, true, PhishingResult{Score: 40, Reasons: []string{PhishingPunycode}}},
+		{"Visit https://paypa1.com/login now", false, PhishingResult{Score: 50, Reasons: []string{PhishingLookalike}}},
+		{"Visit https://paypal.com.evil.net/login now", false, PhishingResult{Score: 50, Reasons: []string{PhishingLookalike}}},
+		{"Visit https://secure-paypal.net/ now", false, PhishingResult{Score: 50, Reasons: []string{PhishingLookalike}}},
+		{"Visit https://bank.example.org.evil.net/ now", false, PhishingResult{Score: 50, Reasons: []string{PhishingLookalike}}},
+		{"Visit https://www.paypal.com@evil.net/ now", false, PhishingResult{Score: 40, Reasons: []string{PhishingUserInfo}}},
+		{"Visit http://192.0.2.1/login now", false, PhishingResult{Score: 30, Reasons: []string{PhishingIPAddress}}},
+		{`<a href="https://paypa1.com@192.0.2.1/">www.paypal.com</a>`, true, PhishingResult{Score: 100, Reasons: []string{PhishingIPAddress, PhishingLinkText, PhishingUserInfo}}},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.want, c.Check(test.body, test.isHTML), test.body)
+	}
+}
+
+func TestSetPhishingScoreHeader(t *testing.T) {
+	h := textproto.MIMEHeader{}
+	h.Set(PhishingScoreHeaderKey, "0")
+
+	SetPhishingScoreHeader(h, PhishingResult{Score: 90, Reasons: []string{PhishingLinkText, PhishingPunycode}})
+	require.Equal(t, []string{"90; link-text, punycode"}, h[PhishingScoreHeaderKey])
+
+	SetPhishingScoreHeader(h, PhishingResult{})
+	require.Equal(t, []string{"0"}, h[PhishingScoreHeaderKey])
+}
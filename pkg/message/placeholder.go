@@ -0,0 +1,120 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// PlaceholderMode is how messages which cannot be decrypted are shown.
+type PlaceholderMode string
+
+// Supported placeholder modes.
+const (
+	// PlaceholderAttachment replaces the message by explanation with
+	// the encrypted body as an attachment, see BuildPlaceholder.
+	PlaceholderAttachment PlaceholderMode = "attachment"
+
+	// PlaceholderInline replaces the body by HTML with the error and
+	// the encrypted body, see CustomMessage.
+	PlaceholderInline PlaceholderMode = "inline"
+)
+
+// PlaceholderAttachmentName is the name of the attachment with the body
+// which could not be decrypted.
+const PlaceholderAttachmentName = "encrypted.asc"
+
+// ParsePlaceholderMode returns the mode with the name. Unknown names,
+// including empty one, mean attachment.
+func ParsePlaceholderMode(name string) PlaceholderMode {
+	if PlaceholderMode(strings.ToLower(name)) == PlaceholderInline {
+		return PlaceholderInline
+	}
+	return PlaceholderAttachment
+}
+
+// PlaceholderData is passed to the decryption placeholder template.
+type PlaceholderData struct {
+	Subject        string
+	Error          string
+	AttachmentName string
+}
+
+// BuildPlaceholder returns RFC822 message shown instead of the message
+// whose body cannot be decrypted. It keeps the original headers, so clients
+// can still file and search the message, and has a text part explaining
+// the error and the encrypted body as an attachment.
+func BuildPlaceholder(m *pmapi.Message, decryptErr error) ([]byte, error) {
+	text, err := ExecuteTemplate(DecryptionPlaceholderTemplate, PlaceholderData{
+		Subject:        m.Subject,
+		Error:          decryptErr.Error(),
+		AttachmentName: PlaceholderAttachmentName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bytes.Buffer{}
+	w := multipart.NewWriter(b)
+
+	h := textproto.MIMEHeader{}
+	for key, values := range GetHeader(m) {
+		h[key] = append([]string{}, values...)
+	}
+	h.Del("Content-Transfer-Encoding")
+	h.Del("Content-Disposition")
+	h.Set("Mime-Version", "1.0")
+	h.Set("Content-Type", "multipart/mixed; boundary="+w.Boundary())
+	if err := WriteHeader(b, h); err != nil {
+		return nil, err
+	}
+
+	textPart, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeTextBody(textPart, text+"\r\n", QuotedPrintable); err != nil {
+		return nil, err
+	}
+
+	attPart, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {fmt.Sprintf("application/octet-stream; name=%q", PlaceholderAttachmentName)},
+		"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", PlaceholderAttachmentName)},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := WriteAttachmentData(attPart, strings.NewReader(m.Body)); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePlaceholderMode(t *testing.T) {
+	require.Equal(t, PlaceholderInline, ParsePlaceholderMode("Inline"))
+	require.Equal(t, PlaceholderAttachment, ParsePlaceholderMode("attachment"))
+	require.Equal(t, PlaceholderAttachment, ParsePlaceholderMode(""))
+}
+
+func TestBuildPlaceholder(t *testing.T) {
+	defer SetTemplateOptions(TemplateOptions{})
+	SetTemplateOptions(TemplateOptions{Locale: "en"})
+
+	encrypted := "-----BEGIN PGP MESSAGE-----\n\nwcBMA0fcZ7XLgmf2AQ\n-----END PGP MESSAGE-----\n"
+	m := &pmapi.Message{
+		Subject:  "Hello",
+		Sender:   &mail.Address{Address: "sender@example.com"},
+		ToList:   []*mail.Address{{Address: "me@pm.me"}},
+		Time:     1600000000,
+		MIMEType: pmapi.ContentTypeHTML,
+		Body:     encrypted,
+		Header: mail.Header{
+			"Message-Id":   {"<original@example.com>"},
+			"Content-Type": {"text/html"},
+		},
+	}
+
+	body, err := BuildPlaceholder(m, errors.New("no key"))
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(body))
+	require.NoError(t, err)
+	require.Equal(t, "Hello", msg.Header.Get("Subject"))
+	require.Equal(t, "<sender@example.com>", msg.Header.Get("From"))
+	require.Equal(t, "<original@example.com>", msg.Header.Get("Message-Id"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/mixed", mediaType)
+
+	r := multipart.NewReader(msg.Body, params["boundary"])
+
+	textPart, err := r.NextPart()
+	require.NoError(t, err)
+	text, err := ioutil.ReadAll(textPart)
+	require.NoError(t, err)
+	require.Contains(t, string(text), "could not be decrypted")
+	require.Contains(t, string(text), "no key")
+
+	attPart, err := r.NextPart()
+	require.NoError(t, err)
+	require.Equal(t, PlaceholderAttachmentName, attPart.FileName())
+	data, err := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, attPart))
+	require.NoError(t, err)
+	require.Equal(t, encrypted, string(data))
+
+	_, err = r.NextPart()
+	require.Error(t, err)
+}
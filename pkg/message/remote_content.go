@@ -0,0 +1,250 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// RemoteContentMode says what happens with remote content of HTML bodies.
+type RemoteContentMode string
+
+const (
+	// RemoteContentAllow keeps remote content as it is.
+	RemoteContentAllow RemoteContentMode = "allow"
+
+	// RemoteContentBlock removes tracking pixels and replaces remote images
+	// by a placeholder.
+	RemoteContentBlock RemoteContentMode = "block"
+
+	// RemoteContentProxy removes tracking pixels and rewrites URLs of remote
+	// images to be loaded through the proxy.
+	RemoteContentProxy RemoteContentMode = "proxy"
+)
+
+// RemoteContentModes lists all supported modes of remote content filter.
+var RemoteContentModes = []RemoteContentMode{RemoteContentAllow, RemoteContentBlock, RemoteContentProxy} //nolint[gochecknoglobals]
+
+// BlockedImagePlaceholder is the source of blocked remote images.
+const BlockedImagePlaceholder = "data:image/svg+xml;base64,PHN2ZyB4bWxucz0iaHR0cDovL3d3dy53My5vcmcvMjAwMC9zdmciIHdpZHRoPSIxNiIgaGVpZ2h0PSIxNiI+PHJlY3Qgd2lkdGg9IjE2IiBoZWlnaHQ9IjE2IiBmaWxsPSIjZGRkIi8+PC9zdmc+"
+
+// nolint[gochecknoglobals]
+var (
+	reCSSRemoteURL = regexp.MustCompile(`(?i)url\(\s*['"]?((?:https?:)?//[^'")\s]+)['"]?\s*\)`)
+	reCSSHidden    = regexp.MustCompile(`(?i)(?:^|;)\s*(?:display\s*:\s*none|visibility\s*:\s*hidden)`)
+)
+
+// remoteSourceAttributes are attributes of elements loading remote content
+// automatically when the message is displayed.
+var remoteSourceAttributes = map[string]string{ //nolint[gochecknoglobals]
+	"img":   "src",
+	"input": "src",
+	"video": "poster",
+}
+
+// RemoteContentFilter removes tracking pixels from HTML bodies and blocks or
+// proxies remote images for clients which load them without asking. The zero
+// value keeps bodies as they are.
+type RemoteContentFilter struct {
+	Mode RemoteContentMode
+
+	// ProxyURL is the prefix of proxied URLs, the escaped original URL is
+	// appended to it, e.g. https://proxy.example.com/?url=.
+	ProxyURL string
+}
+
+// IsEnabled returns whether the filter changes bodies.
+func (f RemoteContentFilter) IsEnabled() bool {
+	return f.Mode == RemoteContentBlock || (f.Mode == RemoteContentProxy && f.ProxyURL != "")
+}
+
+// Apply returns the HTML body with remote content filtered. The body is
+// returned untouched when there is no remote content or it cannot be parsed.
+func (f RemoteContentFilter) Apply(body string) string {
+	if !f.IsEnabled() {
+		return body
+	}
+
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return body
+	}
+	if !f.filterNode(doc) {
+		return body
+	}
+
+	b := &bytes.Buffer{}
+	if err := html.Render(b, doc); err != nil {
+		return body
+	}
+	return b.String()
+}
+
+// filterNode filters the node and its children and returns whether anything
+// was changed.
+func (f RemoteContentFilter) filterNode(n *html.Node) (changed bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && isRemoteElementToRemove(c) {
+			n.RemoveChild(c)
+			changed = true
+		} else if f.filterNode(c) {
+			changed = true
+		}
+		c = next
+	}
+
+	switch n.Type {
+	case html.ElementNode:
+		for i := range n.Attr {
+			attr := &n.Attr[i]
+			switch {
+			case attr.Key == remoteSourceAttributes[n.Data] || attr.Key == "background":
+				if isRemoteURL(attr.Val) {
+					attr.Val = f.rewriteURL(attr.Val)
+					changed = true
+				}
+			case attr.Key == "srcset":
+				if srcset, ok := f.rewriteSrcset(attr.Val); ok {
+					attr.Val = srcset
+					changed = true
+				}
+			case attr.Key == "style":
+				if style, ok := f.rewriteCSS(attr.Val); ok {
+					attr.Val = style
+					changed = true
+				}
+			}
+		}
+	case html.TextNode:
+		if n.Parent != nil && n.Parent.Type == html.ElementNode && n.Parent.Data == "style" {
+			if style, ok := f.rewriteCSS(n.Data); ok {
+				n.Data = style
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+// rewriteURL returns the placeholder or the proxied URL of the remote URL.
+func (f RemoteContentFilter) rewriteURL(remote string) string {
+	if f.Mode != RemoteContentProxy {
+		return BlockedImagePlaceholder
+	}
+	remote = strings.TrimSpace(remote)
+	if strings.HasPrefix(remote, "//") {
+		remote = "https:" + remote
+	}
+	return f.ProxyURL + url.QueryEscape(remote)
+}
+
+// rewriteSrcset rewrites remote URLs of the image candidates. Blocked
+// candidates are left out so the client uses the placeholder of src.
+func (f RemoteContentFilter) rewriteSrcset(srcset string) (string, bool) {
+	candidates := strings.Split(srcset, ",")
+	kept := []string{}
+	changed := false
+	for _, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 || !isRemoteURL(fields[0]) {
+			kept = append(kept, strings.TrimSpace(candidate))
+			continue
+		}
+		changed = true
+		if f.Mode == RemoteContentProxy {
+			fields[0] = f.rewriteURL(fields[0])
+			kept = append(kept, strings.Join(fields, " "))
+		}
+	}
+	return strings.Join(kept, ", "), changed
+}
+
+// rewriteCSS rewrites remote URLs of style sheet or style attribute.
+func (f RemoteContentFilter) rewriteCSS(css string) (string, bool) {
+	if !reCSSRemoteURL.MatchString(css) {
+		return css, false
+	}
+	return reCSSRemoteURL.ReplaceAllStringFunc(css, func(match string) string {
+		if f.Mode != RemoteContentProxy {
+			return "none"
+		}
+		remote := reCSSRemoteURL.FindStringSubmatch(match)[1]
+		return `url("` + f.rewriteURL(remote) + `")`
+	}), true
+}
+
+// isRemoteElementToRemove returns whether the element is a tracking pixel or
+// remote style sheet which cannot be replaced by a placeholder.
+func isRemoteElementToRemove(n *html.Node) bool {
+	switch n.Data {
+	case "img":
+		return isRemoteURL(getAttr(n, "src")) && isTrackingPixel(n)
+	case "link":
+		return isRemoteURL(getAttr(n, "href"))
+	default:
+		return false
+	}
+}
+
+// isTrackingPixel returns whether the image is hidden or at most one pixel
+// large so it can be there only to report the message was opened.
+func isTrackingPixel(n *html.Node) bool {
+	style := getAttr(n, "style")
+	if reCSSHidden.MatchString(style) {
+		return true
+	}
+
+	size := map[string]string{"width": getAttr(n, "width"), "height": getAttr(n, "height")}
+	for _, declaration := range strings.Split(style, ";") {
+		if i := strings.Index(declaration, ":"); i > 0 {
+			property := strings.ToLower(strings.TrimSpace(declaration[:i]))
+			if _, ok := size[property]; ok {
+				size[property] = declaration[i+1:]
+			}
+		}
+	}
+	for _, value := range size {
+		pixels, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "px"))
+		if err != nil || pixels > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+func isRemoteURL(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	return strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") || strings.HasPrefix(value, "//")
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteContentFilterDisabled(t *testing.T) {
+	body := `<p><img src="https://example.com/a.png"></p>`
+
+	require.Equal(t, body, RemoteContentFilter{}.Apply(body))
+	require.Equal(t, body, RemoteContentFilter{Mode: RemoteContentAllow}.Apply(body))
+	require.Equal(t, body, RemoteContentFilter{Mode: RemoteContentProxy}.Apply(body))
+}
+
+func TestRemoteContentFilterKeepsLocalContent(t *testing.T) {
+	body := `<p><img src="cid:logo@example.com"><img src="data:image/png;base64,AAAA"></p>`
+
+	require.Equal(t, body, RemoteContentFilter{Mode: RemoteContentBlock}.Apply(body))
+}
+
+func TestRemoteContentFilterBlock(t *testing.T) {
+	body := `<html><head><link rel="stylesheet" href="https://example.com/a.css"><style>p { background: url('https://example.com/bg.png'); }</style></head>` +
+		`<body background="http://example.com/body.png">` +
+		`<p style="background-image: url(//example.com/p.png)">hi</p>` +
+		`<img src="https://example.com/photo.png" srcset="https://example.com/photo@2x.png 2x, cid:photo 3x" alt="photo">` +
+		`<img src="https://tracker.example.com/open.gif" width="1" height="1">` +
+		`<img src="https://tracker.example.com/open2.gif" style="width: 0px; height: 0px">` +
+		`<img src="https://tracker.example.com/open3.gif" style="display:none">` +
+		`</body></html>`
+
+	want := `<html><head><style>p { background: none; }</style></head>` +
+		`<body background="` + BlockedImagePlaceholder + `">` +
+		`<p style="background-image: none">hi</p>` +
+		`<img src="` + BlockedImagePlaceholder + `" srcset="cid:photo 3x" alt="photo"/>` +
+		`</body></html>`
+
+	require.Equal(t, want, RemoteContentFilter{Mode: RemoteContentBlock}.Apply(body))
+}
+
+func TestRemoteContentFilterProxy(t *testing.T) {
+	filter := RemoteContentFilter{Mode: RemoteContentProxy, ProxyURL: "https://proxy.example.net/?url="}
+	body := `<html><head></head><body>` +
+		`<img src="//example.com/a.png?x=1&amp;y=2" srcset="https://example.com/a@2x.png 2x">` +
+		`<div style="background: url(&#34;http://example.com/bg.png&#34;)">hi</div>` +
+		`<img src="https://tracker.example.com/open.gif" width="1px" height="1">` +
+		`</body></html>`
+
+	want := `<html><head></head><body>` +
+		`<img src="https://proxy.example.net/?url=https%3A%2F%2Fexample.com%2Fa.png%3Fx%3D1%26y%3D2" srcset="https://proxy.example.net/?url=https%3A%2F%2Fexample.com%2Fa%402x.png 2x"/>` +
+		`<div style="background: url(&#34;https://proxy.example.net/?url=http%3A%2F%2Fexample.com%2Fbg.png&#34;)">hi</div>` +
+		`</body></html>`
+
+	require.Equal(t, want, filter.Apply(body))
+}
+
+func TestIsTrackingPixel(t *testing.T) {
+	testData := map[string]bool{
+		`<img src="https://t.example.com/a.gif" width="1" height="1">`:            true,
+		`<img src="https://t.example.com/a.gif" style="width:1px;height:1px">`:    true,
+		`<img src="https://t.example.com/a.gif" style="visibility: hidden">`:      true,
+		`<img src="https://t.example.com/a.gif" width="1">`:                       false,
+		`<img src="https://t.example.com/a.gif" width="1" style="height: 100px">`: false,
+		`<img src="https://t.example.com/a.gif">`:                                 false,
+	}
+
+	for body, want := range testData {
+		got := RemoteContentFilter{Mode: RemoteContentBlock}.Apply(body)
+		require.Equal(t, want, !strings.Contains(got, "<img"), body)
+	}
+}
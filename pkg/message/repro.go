@@ -0,0 +1,280 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/textproto"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// Failures recorded in reproduction bundles.
+const (
+	ReproDecryptFailed = "decrypt"
+	ReproBuildFailed   = "build"
+)
+
+// reproHashedDomain is the domain of hashed addresses and IDs so they stay
+// syntactically valid for parsers.
+const reproHashedDomain = "hashed.invalid"
+
+var (
+	reproEmailRgx = regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9\-]+(\.[a-zA-Z0-9\-]+)+`)          //nolint[gochecknoglobals]
+	reproIDRgx    = regexp.MustCompile(`<[^<>]*>`)                                                      //nolint[gochecknoglobals]
+	reproNameRgx  = regexp.MustCompile(`(?i)(\b(?:file)?name\*?(?:\*\d+\*?)?\s*=\s*)("[^"]*"|[^;\s]*)`) //nolint[gochecknoglobals]
+
+	// reproKeptHeaders are headers whose values are needed to reproduce
+	// problems of parsers; IDs and file names in them are hashed. Values of
+	// other headers are replaced by their length.
+	reproKeptHeaders = map[string]bool{ //nolint[gochecknoglobals]
+		"Content-Type":              true,
+		"Content-Transfer-Encoding": true,
+		"Content-Disposition":       true,
+		"Content-Id":                true,
+		"Mime-Version":              true,
+		"Date":                      true,
+		"Message-Id":                true,
+		"In-Reply-To":               true,
+		"References":                true,
+	}
+
+	// reproAddressHeaders are reduced to hashed addresses without names.
+	reproAddressHeaders = map[string]bool{ //nolint[gochecknoglobals]
+		"From":                        true,
+		"To":                          true,
+		"Cc":                          true,
+		"Bcc":                         true,
+		"Reply-To":                    true,
+		"Sender":                      true,
+		"Return-Path":                 true,
+		"Delivered-To":                true,
+		"Disposition-Notification-To": true,
+	}
+)
+
+// Repro describes the message which failed to decrypt or build without any
+// private content: email addresses, message IDs and file names are hashed
+// and display names and values of other headers, e.g. subject, are left out. Users can attach
+// it to bug reports so parser problems can be fixed without the message.
+type Repro struct {
+	MessageID string
+	Created   time.Time
+	Failure   string
+
+	// Errors is the chain of errors starting with the outermost one.
+	Errors []string
+
+	MIMEType    string
+	Flags       int64
+	BodySize    int
+	Header      []ReproHeader
+	Attachments []ReproAttachment
+
+	// Parts describe the MIME structure of the decrypted body.
+	Parts      []ReproPart `json:",omitempty"`
+	PartsError string      `json:",omitempty"`
+}
+
+// ReproHeader is one redacted header field.
+type ReproHeader struct {
+	Name  string
+	Value string
+}
+
+// ReproAttachment is the metadata of the attachment reported by API.
+type ReproAttachment struct {
+	MIMEType  string
+	Size      int64
+	Extension string `json:",omitempty"`
+	Header    []ReproHeader
+}
+
+// ReproPart is one section of the MIME structure, e.g. "1.2".
+type ReproPart struct {
+	Path   string
+	Header []ReproHeader
+	Size   int
+	Lines  int
+}
+
+// NewRepro returns the reproduction bundle of the message which failed
+// with err. It must be called before the message is replaced by the custom
+// error message.
+func NewRepro(m *pmapi.Message, failure string, err error, now time.Time) *Repro {
+	repro := &Repro{
+		MessageID: m.ID,
+		Created:   now,
+		Failure:   failure,
+		Errors:    reproErrorChain(err),
+		MIMEType:  m.MIMEType,
+		Flags:     m.Flags,
+		BodySize:  len(m.Body),
+		Header:    reproHeader(textproto.MIMEHeader(m.Header)),
+	}
+
+	for _, att := range m.Attachments {
+		repro.Attachments = append(repro.Attachments, ReproAttachment{
+			MIMEType:  att.MIMEType,
+			Size:      att.Size,
+			Extension: filepath.Ext(att.Name),
+			Header:    reproHeader(att.Header),
+		})
+	}
+
+	// Only decrypted body has a structure; PGP/MIME body is a whole MIME message.
+	if failure == ReproBuildFailed && m.MIMEType == pmapi.ContentTypeMultipartMixed {
+		repro.Parts, err = reproParts(m.Body)
+		if err != nil {
+			repro.PartsError = reproRedact(err.Error())
+		}
+	}
+
+	return repro
+}
+
+func reproParts(body string) ([]ReproPart, error) {
+	structure, err := NewBodyStructure(strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(*structure))
+	for path := range *structure {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return lessSectionPath(paths[i], paths[j])
+	})
+
+	parts := []ReproPart{}
+	for _, path := range paths {
+		info := (*structure)[path]
+		parts = append(parts, ReproPart{
+			Path:   path,
+			Header: reproHeader(info.header),
+			Size:   info.size,
+			Lines:  info.lines,
+		})
+	}
+	return parts, nil
+}
+
+// lessSectionPath orders section paths numerically, e.g. "1.2" before "1.10".
+func lessSectionPath(a, b string) bool {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNum, _ := strconv.Atoi(aParts[i])
+		bNum, _ := strconv.Atoi(bParts[i])
+		if aNum != bNum {
+			return aNum < bNum
+		}
+	}
+	return len(aParts) < len(bParts)
+}
+
+func reproHeader(header textproto.MIMEHeader) []ReproHeader {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := []ReproHeader{}
+	for _, name := range names {
+		for _, value := range header[name] {
+			fields = append(fields, ReproHeader{Name: name, Value: reproHeaderValue(name, value)})
+		}
+	}
+	return fields
+}
+
+func reproHeaderValue(name, value string) string {
+	name = textproto.CanonicalMIMEHeaderKey(name)
+
+	if reproAddressHeaders[name] {
+		addresses := reproEmailRgx.FindAllString(value, -1)
+		for i, address := range addresses {
+			addresses[i] = reproHashAddress(address)
+		}
+		return strings.Join(addresses, ", ")
+	}
+
+	if !reproKeptHeaders[name] {
+		return fmt.Sprintf("[%d bytes]", len(value))
+	}
+
+	value = reproNameRgx.ReplaceAllStringFunc(value, func(param string) string {
+		match := reproNameRgx.FindStringSubmatch(param)
+		fileName := strings.Trim(match[2], `"`)
+		return match[1] + `"` + reproHash(fileName) + filepath.Ext(fileName) + `"`
+	})
+	return reproRedact(value)
+}
+
+// reproRedact hashes message IDs and email addresses in the text. The same
+// address or ID gets always the same hash so relations between headers of
+// the message stay visible.
+func reproRedact(text string) string {
+	text = reproIDRgx.ReplaceAllStringFunc(text, func(id string) string {
+		return "<" + reproHash(strings.Trim(id, "<>")) + "@" + reproHashedDomain + ">"
+	})
+	return reproEmailRgx.ReplaceAllStringFunc(text, func(address string) string {
+		if strings.HasSuffix(address, "@"+reproHashedDomain) {
+			return address
+		}
+		return reproHashAddress(address)
+	})
+}
+
+// reproHashAddress hashes the address case-insensitively.
+func reproHashAddress(address string) string {
+	return reproHash(strings.ToLower(address)) + "@" + reproHashedDomain
+}
+
+func reproHash(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:6])
+}
+
+// reproErrorChain returns redacted messages of the error and all errors it wraps.
+func reproErrorChain(err error) (chain []string) {
+	for err != nil {
+		if text := reproRedact(err.Error()); len(chain) == 0 || chain[len(chain)-1] != text {
+			chain = append(chain, text)
+		}
+
+		switch wrapper := err.(type) {
+		case interface{ Cause() error }:
+			err = wrapper.Cause()
+		case interface{ Unwrap() error }:
+			err = wrapper.Unwrap()
+		default:
+			err = nil
+		}
+	}
+	return chain
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"encoding/json"
+	"net/mail"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewReproRedactsPrivateContent(t *testing.T) {
+	m := &pmapi.Message{
+		ID:       "messageID",
+		MIMEType: pmapi.ContentTypeMultipartMixed,
+		Header: mail.Header{
+			"From":       {"Alice <alice@example.com>"},
+			"To":         {"bob@example.com, Alice <ALICE@example.com>"},
+			"Subject":    {"Secret plans"},
+			"Message-Id": {"<unique@example.com>"},
+		},
+		Body: sampleMail,
+		Attachments: []*pmapi.Attachment{{
+			Name:     "secret plans.pdf",
+			MIMEType: "application/pdf",
+			Size:     42,
+			Header: map[string][]string{
+				"Content-Disposition": {`attachment; filename="secret plans.pdf"`},
+			},
+		}},
+	}
+
+	cause := errors.New("unexpected EOF from alice@example.com")
+	repro := NewRepro(m, ReproBuildFailed, errors.Wrap(cause, "failed to build"), time.Unix(0, 0))
+
+	raw, err := json.Marshal(repro)
+	require.NoError(t, err)
+	for _, private := range []string{"alice", "Alice", "bob", "Secret", "secret", "unique"} {
+		require.NotContains(t, string(raw), private)
+	}
+
+	from, to := repro.Header[0], repro.Header[3]
+	require.Equal(t, "From", from.Name)
+	require.Equal(t, "To", to.Name)
+	require.Regexp(t, `^[0-9a-f]{12}@hashed\.invalid$`, from.Value)
+	require.Contains(t, to.Value, ", "+from.Value, "same address should have same hash")
+	require.Equal(t, ReproHeader{Name: "Subject", Value: "[12 bytes]"}, repro.Header[2])
+
+	require.Len(t, repro.Errors, 2)
+	require.Contains(t, repro.Errors[0], "failed to build")
+	require.Equal(t, ".pdf", repro.Attachments[0].Extension)
+	require.Contains(t, repro.Attachments[0].Header[0].Value, `.pdf"`)
+
+	require.Empty(t, repro.PartsError)
+	require.Equal(t, "", repro.Parts[0].Path)
+	require.Equal(t, "4.2.2.2", repro.Parts[len(repro.Parts)-1].Path)
+}
+
+func TestNewReproDecryptFailureSkipsParts(t *testing.T) {
+	m := &pmapi.Message{ID: "messageID", MIMEType: pmapi.ContentTypeMultipartMixed, Body: "-----BEGIN PGP MESSAGE-----"}
+
+	repro := NewRepro(m, ReproDecryptFailed, errors.New("gopenpgp: error in reading message"), time.Unix(0, 0))
+
+	require.Equal(t, ReproDecryptFailed, repro.Failure)
+	require.Equal(t, 27, repro.BodySize)
+	require.Nil(t, repro.Parts)
+	require.Empty(t, repro.PartsError)
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduledTimeHeader sets when the message should be sent, either as
+// RFC 5322 date or as Unix timestamp. It is removed before sending.
+const ScheduledTimeHeader = "X-Pm-Scheduled-Time"
+
+// ParseScheduledTime returns the time from the value of ScheduledTimeHeader.
+func ParseScheduledTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	if date, err := mail.ParseDate(value); err == nil {
+		return date, true
+	}
+	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(timestamp, 0), true
+	}
+	return time.Time{}, false
+}
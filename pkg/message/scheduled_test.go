@@ -0,0 +1,39 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScheduledTime(t *testing.T) {
+	date, ok := ParseScheduledTime("Mon, 02 Jan 2006 15:04:05 +0000")
+	require.True(t, ok)
+	require.Equal(t, int64(1136214245), date.Unix())
+
+	date, ok = ParseScheduledTime(" 1136214245 ")
+	require.True(t, ok)
+	require.Equal(t, int64(1136214245), date.Unix())
+
+	_, ok = ParseScheduledTime("tomorrow")
+	require.False(t, ok)
+	_, ok = ParseScheduledTime("")
+	require.False(t, ok)
+}
@@ -28,6 +28,7 @@ import (
 	"strings"
 
 	pmmime "github.com/ProtonMail/proton-bridge/pkg/mime"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/emersion/go-imap"
 )
 
@@ -35,13 +36,17 @@ type sectionInfo struct {
 	header                    textproto.MIMEHeader
 	start, bsize, size, lines int
 	reader                    io.Reader
+
+	// estimated is set when the section (or its subsection) is not in the
+	// parsed message and its size was only estimated.
+	estimated bool
 }
 
 // Count and read.
 func (si *sectionInfo) Read(p []byte) (n int, err error) {
 	n, err = si.reader.Read(p)
 	si.size += n
-	si.lines += bytes.Count(p, []byte("\n"))
+	si.lines += bytes.Count(p[:n], []byte("\n"))
 	return
 }
 
@@ -125,6 +130,11 @@ func (br *boundaryReader) WriteNextPartTo(part io.Writer) (err error) {
 			return
 		}
 
+		if err == io.EOF && part != nil && !br.isBoundaryDelimiterLine(line) {
+			// Keep the last line of the part without closing boundary.
+			_, _ = part.Write(line)
+		}
+
 		if err != nil {
 			return
 		}
@@ -157,11 +167,68 @@ func NewBodyStructure(reader io.Reader) (structure *BodyStructure, err error) {
 	return
 }
 
+// NewLazyBodyStructure parses the message built with empty attachment parts.
+// Sizes of the attachment parts are estimated from sizes reported by API,
+// so the structure can be provided without downloading attachments. Only
+// sections without attachments can be read from the parsed message.
+func NewLazyBodyStructure(reader io.Reader, m *pmapi.Message) (structure *BodyStructure, err error) {
+	if structure, err = NewBodyStructure(reader); err != nil {
+		return
+	}
+
+	for path, att := range getAttachmentSections(m) {
+		if _, ok := (*structure)[path]; ok {
+			structure.estimateSectionSize(path, att.Size)
+		}
+	}
+	return
+}
+
+// estimateSectionSize adds the size of base64 encoded data to the empty
+// section and all sections containing it. Following sections are moved.
+func (bs *BodyStructure) estimateSectionSize(path string, size int64) {
+	encoded := 4 * ((int(size) + 2) / 3)
+	separators := 0
+	if encoded > 0 {
+		separators = (encoded - 1) / 76
+	}
+	delta := encoded + 2*separators
+
+	start := (*bs)[path].start
+	for otherPath, info := range *bs {
+		switch {
+		case otherPath == path, otherPath == "", strings.HasPrefix(path, otherPath+"."):
+			info.bsize += delta
+			info.size += delta
+			info.lines += separators
+			info.estimated = true
+		case info.start > start:
+			info.start += delta
+		}
+	}
+}
+
+// HasSectionContent returns whether the content of the section can be read
+// from the message the structure was parsed from.
+func (bs *BodyStructure) HasSectionContent(sectionPath []int) bool {
+	info, err := bs.getInfo(sectionPath)
+	return err == nil && !info.estimated
+}
+
+// Parse reads the structure of the message. It recovers from invalid header
+// lines and missing closing boundaries, so the message can be still served.
 func (bs *BodyStructure) Parse(r io.Reader) error {
-	return bs.parseAllChildSections(r, []int{}, 0)
+	diag := pmmime.Diagnostics{}
+	if err := bs.parseAllChildSections(r, []int{}, 0, &diag); err != nil {
+		return err
+	}
+	if len(diag) > 0 {
+		log.WithField("problems", diag).Warn("Message structure is malformed")
+	}
+	return nil
 }
 
-func (bs *BodyStructure) parseAllChildSections(r io.Reader, currentPath []int, start int) (err error) { //nolint[funlen]
+func (bs *BodyStructure) parseAllChildSections(r io.Reader, currentPath []int, start int, diag *pmmime.Diagnostics) (err error) { //nolint[funlen]
 	info := &sectionInfo{
 		start:  start,
 		size:   0,
@@ -171,20 +238,19 @@ func (bs *BodyStructure) parseAllChildSections(r io.Reader, currentPath []int, s
 	}
 
 	bufInfo := bufio.NewReader(info)
-	tp := textproto.NewReader(bufInfo)
 
-	if info.header, err = tp.ReadMIMEHeader(); err != nil {
+	if info.header, err = pmmime.ReadHeader(bufInfo, diag); err != nil {
 		return
 	}
 
-	bodyInfo := &sectionInfo{reader: tp.R}
+	bodyInfo := &sectionInfo{reader: bufInfo}
 	bodyReader := bufio.NewReader(bodyInfo)
 
 	mediaType, params, _ := pmmime.ParseMediaType(info.header.Get("Content-Type"))
 
 	// If multipart, call getAllParts, else read to count lines.
 	if (strings.HasPrefix(mediaType, "multipart/") || mediaType == "message/rfc822") && params["boundary"] != "" {
-		newPath := append(currentPath, 1)
+		newPath := firstSubsectionPath(currentPath)
 
 		var br *boundaryReader
 		br, err = newBoundaryReader(bodyReader, params["boundary"])
@@ -196,13 +262,19 @@ func (bs *BodyStructure) parseAllChildSections(r io.Reader, currentPath []int, s
 
 		for err == nil {
 			start += br.skipped
-			part := &bytes.Buffer{}
+			part := &partParser{bs: bs, path: newPath, start: start, diag: diag}
 			err = br.WriteNextPartTo(part)
+			if err == io.EOF && part.written > 0 {
+				if err = part.wait(); err == nil {
+					err = io.EOF
+				}
+				diag.Add("closing multipart boundary is missing")
+			}
 			if err != nil {
+				part.abort(err)
 				break
 			}
-			err = bs.parseAllChildSections(part, newPath, start)
-			part.Reset()
+			err = part.wait()
 			newPath[len(newPath)-1]++
 		}
 		br.reader = nil
@@ -221,18 +293,17 @@ func (bs *BodyStructure) parseAllChildSections(r io.Reader, currentPath []int, s
 	// Clear all buffers.
 	bodyReader = nil
 	bodyInfo.reader = nil
-	tp.R = nil
-	tp = nil
 	bufInfo = nil // nolint
 	info.reader = nil
 
 	// Store boundaries.
 	info.bsize = bodyInfo.size
+	info.lines = bodyInfo.lines
 	path := stringPathFromInts(currentPath)
 	(*bs)[path] = info
 
 	// Fix start of subsections.
-	newPath := append(currentPath, 1)
+	newPath := firstSubsectionPath(currentPath)
 	shift := info.size - info.bsize
 	subInfo, err := bs.getInfo(newPath)
 
@@ -277,6 +348,69 @@ func (bs *BodyStructure) parseAllChildSections(r io.Reader, currentPath []int, s
 	return nil
 }
 
+// partParser parses the part in the background while the part is being
+// written to it, so big parts, e.g. attachments, are not held in memory.
+type partParser struct {
+	bs    *BodyStructure
+	path  []int
+	start int
+	diag  *pmmime.Diagnostics
+
+	pw      *io.PipeWriter
+	w       *bufio.Writer
+	done    chan error
+	written int
+}
+
+func (p *partParser) Write(b []byte) (int, error) {
+	if p.pw == nil {
+		pr, pw := io.Pipe()
+		p.pw, p.w, p.done = pw, bufio.NewWriter(pw), make(chan error, 1)
+		go func() {
+			err := p.bs.parseAllChildSections(pr, p.path, p.start, p.diag)
+			// Read the rest so writing of the part is not blocked.
+			_, _ = io.Copy(ioutil.Discard, pr)
+			p.done <- err
+		}()
+	}
+	n, err := p.w.Write(b)
+	p.written += n
+	return n, err
+}
+
+// wait finishes the part and returns the result of its parsing. The part
+// is parsed also when nothing was written to it.
+func (p *partParser) wait() error {
+	if p.pw == nil {
+		return p.bs.parseAllChildSections(&bytes.Buffer{}, p.path, p.start, p.diag)
+	}
+	if p.done == nil {
+		return nil
+	}
+	_ = p.pw.CloseWithError(p.w.Flush())
+	err := <-p.done
+	p.done = nil
+	return err
+}
+
+// abort stops parsing of the part which is not complete.
+func (p *partParser) abort(err error) {
+	if p.done == nil {
+		return
+	}
+	_ = p.pw.CloseWithError(err)
+	<-p.done
+	p.done = nil
+}
+
+// firstSubsectionPath returns a new path which doesn't share the array with
+// the parent path, so changing it cannot renumber the parent's sections.
+func firstSubsectionPath(path []int) []int {
+	newPath := make([]int, len(path), len(path)+1)
+	copy(newPath, path)
+	return append(newPath, 1)
+}
+
 func stringPathFromInts(ints []int) (ret string) {
 	for i, n := range ints {
 		if i != 0 {
@@ -338,6 +472,27 @@ func (bs *BodyStructure) GetSectionContent(wholeMail io.ReadSeeker, sectionPath
 	*/
 }
 
+// GetSectionReader returns the reader of the section including its header.
+// It reads the section right from the whole message without copying it.
+func (bs *BodyStructure) GetSectionReader(wholeMail io.ReaderAt, sectionPath []int) (*io.SectionReader, error) {
+	info, err := bs.getInfo(sectionPath)
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(wholeMail, int64(info.start), int64(info.size)), nil
+}
+
+// GetSectionContentReader returns the reader of the section without its
+// header. It reads the section right from the whole message without
+// copying it.
+func (bs *BodyStructure) GetSectionContentReader(wholeMail io.ReaderAt, sectionPath []int) (*io.SectionReader, error) {
+	info, err := bs.getInfo(sectionPath)
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(wholeMail, int64(info.start+info.size-info.bsize), int64(info.bsize)), nil
+}
+
 func (bs *BodyStructure) GetSectionHeader(sectionPath []int) (header textproto.MIMEHeader, err error) {
 	info, err := bs.getInfo(sectionPath)
 	if err != nil {
@@ -18,13 +18,19 @@
 package message
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
 	"testing"
 
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/stretchr/testify/require"
 )
 
@@ -98,6 +104,130 @@ func TestGetSection(t *testing.T) {
 
 		require.True(t, string(section) == try.expectedBody, "not same as expected:\n___\n%s\n‾‾‾", try.expectedBody)
 	}
+	// Readers of sections.
+	for _, try := range testPaths {
+		mailReader := strings.NewReader(sampleMail)
+		sectionReader, err := bs.GetSectionReader(mailReader, try.path)
+		require.NoError(t, err)
+		section, err := ioutil.ReadAll(sectionReader)
+		require.NoError(t, err)
+		require.Equal(t, try.expectedSection, string(section))
+
+		contentReader, err := bs.GetSectionContentReader(mailReader, try.path)
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(contentReader)
+		require.NoError(t, err)
+		require.Equal(t, try.expectedBody, string(content))
+	}
+}
+
+func TestMissingClosingBoundary(t *testing.T) {
+	mail := "Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"first\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"last\r\n"
+
+	bs, err := NewBodyStructure(strings.NewReader(mail))
+	require.NoError(t, err)
+
+	section, err := bs.GetSectionContent(strings.NewReader(mail), []int{2})
+	require.NoError(t, err)
+	require.Equal(t, "last\r\n", string(section))
+}
+
+// writeTestBuiltMessage writes the message with the same layout as bridge
+// builds messages. Attachment parts are empty when data is nil.
+func writeTestBuiltMessage(t *testing.T, m *pmapi.Message, data map[string][]byte) []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "Subject: Lazy\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n", GetBoundary(m))
+
+	mw := multipart.NewWriter(b)
+	require.NoError(t, mw.SetBoundary(GetBoundary(m)))
+
+	writeAttachment := func(mw *multipart.Writer, att *pmapi.Attachment) {
+		p, err := mw.CreatePart(GetAttachmentHeader(att))
+		require.NoError(t, err)
+		if data != nil {
+			require.NoError(t, WriteAttachmentData(p, bytes.NewReader(data[att.ID])))
+		}
+	}
+
+	atts, inlines := SeparateInlineAttachments(m)
+
+	p, err := mw.CreatePart(GetRelatedHeader(m))
+	require.NoError(t, err)
+	related := multipart.NewWriter(p)
+	require.NoError(t, related.SetBoundary(GetRelatedBoundary(m)))
+	p, err = related.CreatePart(GetBodyHeader(m, QuotedPrintable))
+	require.NoError(t, err)
+	_, _ = io.WriteString(p, "Hello\r\nworld")
+	for _, inline := range inlines {
+		writeAttachment(related, inline)
+	}
+	require.NoError(t, related.Close())
+
+	for _, att := range atts {
+		writeAttachment(mw, att)
+	}
+	require.NoError(t, mw.Close())
+
+	return b.Bytes()
+}
+
+func TestLazyBodyStructure(t *testing.T) {
+	inlineHeader := textproto.MIMEHeader{"Content-Disposition": {"inline"}}
+	m := &pmapi.Message{
+		ID:       "lazy",
+		MIMEType: "text/plain",
+		Attachments: []*pmapi.Attachment{
+			{ID: "att1", Name: "a.bin", MIMEType: "application/octet-stream", Size: 1000},
+			{ID: "inline", Name: "i.png", MIMEType: "image/png", Size: 57, Header: inlineHeader},
+			{ID: "att2", Name: "b.bin", MIMEType: "application/octet-stream", Size: 0},
+			{ID: "att3", Name: "c.bin", MIMEType: "application/octet-stream", Size: 114},
+		},
+	}
+	data := map[string][]byte{}
+	for _, att := range m.Attachments {
+		data[att.ID] = bytes.Repeat([]byte{'x'}, int(att.Size))
+		if att.Header == nil {
+			att.Header = textproto.MIMEHeader{}
+		}
+	}
+
+	full, err := NewBodyStructure(bytes.NewReader(writeTestBuiltMessage(t, m, data)))
+	require.NoError(t, err)
+
+	lazyMessage := writeTestBuiltMessage(t, m, nil)
+	lazy, err := NewLazyBodyStructure(bytes.NewReader(lazyMessage), m)
+	require.NoError(t, err)
+
+	require.Equal(t, len(*full), len(*lazy))
+	for path, info := range *full {
+		lazyInfo := (*lazy)[path]
+		require.NotNil(t, lazyInfo, path)
+		require.Equal(t, info.header, lazyInfo.header, path)
+		require.Equal(t, []int{info.start, info.size, info.bsize, info.lines}, []int{lazyInfo.start, lazyInfo.size, lazyInfo.bsize, lazyInfo.lines}, path)
+	}
+
+	require.Equal(t, "att1", GetAttachmentBySection(m, []int{2}).ID)
+	require.Equal(t, "att3", GetAttachmentBySection(m, []int{4}).ID)
+	require.Equal(t, "inline", GetAttachmentBySection(m, []int{1, 2}).ID)
+	require.Nil(t, GetAttachmentBySection(m, []int{1, 1}))
+
+	// Only the body can be read from the message without attachments.
+	require.True(t, lazy.HasSectionContent([]int{1, 1}))
+	for _, path := range [][]int{{}, {1}, {1, 2}, {2}, {5}} {
+		require.False(t, lazy.HasSectionContent(path), path)
+	}
+	body, err := lazy.GetSectionContent(bytes.NewReader(lazyMessage), []int{1, 1})
+	require.NoError(t, err)
+	require.Equal(t, "Hello\r\nworld\r\n", string(body))
 }
 
 /* Structure example:
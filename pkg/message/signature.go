@@ -0,0 +1,66 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"context"
+	"net/textproto"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// SignatureValidityHeaderKey is the header field with the result of checking
+// the PGP signature of the message by keys of the sender.
+const SignatureValidityHeaderKey = "X-Pm-Signature-Validity"
+
+// EncryptionHeaderKey is the header field telling how the message was
+// encrypted on the way to the mailbox.
+const EncryptionHeaderKey = "X-Pm-Encryption"
+
+// Values of the encryption header field.
+const (
+	EncryptionEndToEnd   = "end-to-end"  // Sent encrypted by the sender.
+	EncryptionZeroAccess = "zero-access" // Encrypted by the server on arrival.
+)
+
+// VerificationKeyRing returns keys of the sender of the encrypted message.
+// Nil is returned when there is nothing to verify.
+func VerificationKeyRing(ctx context.Context, c pmapi.Client, m *pmapi.Message) (*crypto.KeyRing, error) {
+	if m.Sender == nil || m.Sender.Address == "" || m.IsLegacyMessage() || !m.IsBodyEncrypted() {
+		return nil, nil
+	}
+	return c.GetVerificationKeyRing(ctx, m.Sender.Address)
+}
+
+// SetSignatureValidityHeader sets the result of checking the PGP signature
+// to the header. Any field of the same name sent by the sender is removed.
+func SetSignatureValidityHeader(h textproto.MIMEHeader, status pmapi.SignatureStatus) {
+	h.Del(SignatureValidityHeaderKey)
+
+	if status != pmapi.SignatureNotChecked {
+		h.Set(SignatureValidityHeaderKey, status.String())
+	}
+}
+
+func getEncryption(m *pmapi.Message) string {
+	if m.Flags&pmapi.FlagE2E == pmapi.FlagE2E {
+		return EncryptionEndToEnd
+	}
+	return EncryptionZeroAccess
+}
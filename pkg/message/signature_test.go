@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"context"
+	"net/mail"
+	"net/textproto"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetHeaderEncryption(t *testing.T) {
+	spoofed := mail.Header{
+		SignatureValidityHeaderKey: {"valid"},
+		EncryptionHeaderKey:        {EncryptionEndToEnd},
+	}
+
+	h := GetHeader(&pmapi.Message{Header: spoofed})
+	require.Equal(t, EncryptionZeroAccess, h.Get(EncryptionHeaderKey))
+	require.NotContains(t, h, SignatureValidityHeaderKey)
+
+	h = GetHeader(&pmapi.Message{Flags: pmapi.FlagReceived | pmapi.FlagE2E})
+	require.Equal(t, EncryptionEndToEnd, h.Get(EncryptionHeaderKey))
+}
+
+func TestSetSignatureValidityHeader(t *testing.T) {
+	h := textproto.MIMEHeader{}
+
+	SetSignatureValidityHeader(h, pmapi.SignatureValid)
+	require.Equal(t, "valid", h.Get(SignatureValidityHeaderKey))
+
+	SetSignatureValidityHeader(h, pmapi.SignatureUnknownKey)
+	require.Equal(t, "unknown-key", h.Get(SignatureValidityHeaderKey))
+
+	SetSignatureValidityHeader(h, pmapi.SignatureNotChecked)
+	require.NotContains(t, h, SignatureValidityHeaderKey)
+}
+
+func TestVerificationKeyRingNotEncrypted(t *testing.T) {
+	// Nothing to verify so the client is not asked for keys of the sender.
+	kr, err := VerificationKeyRing(context.Background(), nil, &pmapi.Message{
+		Sender: &mail.Address{Address: "sender@pm.me"},
+		Body:   "plain body",
+	})
+	require.NoError(t, err)
+	require.Nil(t, kr)
+}
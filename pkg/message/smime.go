@@ -0,0 +1,70 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"crypto/x509"
+	"net/textproto"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/ProtonMail/proton-bridge/pkg/smime"
+)
+
+// SMIMEVerifiedHeaderKey is the header field with the result of checking
+// the S/MIME signature of the message.
+const SMIMEVerifiedHeaderKey = "X-Pm-Smime-Verified"
+
+// Results of S/MIME signature check.
+const (
+	SMIMEPass      = "pass"      // Signature is valid and the certificate is trusted.
+	SMIMEUntrusted = "untrusted" // Signature is valid but the certificate is not trusted.
+	SMIMEFail      = "fail"      // Signature does not match the content.
+)
+
+// SetSMIMEVerifiedHeader checks the S/MIME signature of the decrypted
+// message and sets the result to the header. Any field of the same name
+// sent by the sender is removed. Only messages with multipart structure
+// keep the signed content. Nil roots means the system roots.
+func SetSMIMEVerifiedHeader(h textproto.MIMEHeader, m *pmapi.Message, roots *x509.CertPool) {
+	h.Del(SMIMEVerifiedHeaderKey)
+
+	if m.MIMEType != pmapi.ContentTypeMultipartMixed {
+		return
+	}
+
+	verification, err := smime.VerifyEntity([]byte(m.Body), x509.VerifyOptions{Roots: roots})
+	switch {
+	case err == smime.ErrNotSigned:
+		return
+	case err != nil:
+		log.WithError(err).WithField("msgID", m.ID).Warn("Invalid S/MIME signature")
+		h.Set(SMIMEVerifiedHeaderKey, SMIMEFail)
+	case !verification.IsTrusted():
+		h.Set(SMIMEVerifiedHeaderKey, SMIMEUntrusted+"; "+signerInfo(verification.Signer))
+	default:
+		h.Set(SMIMEVerifiedHeaderKey, SMIMEPass+"; "+signerInfo(verification.Signer))
+	}
+}
+
+func signerInfo(cert *x509.Certificate) string {
+	if len(cert.EmailAddresses) > 0 {
+		return "signer=" + cert.EmailAddresses[0]
+	}
+	return "signer=\"" + strings.ReplaceAll(cert.Subject.CommonName, "\"", "") + "\""
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"bytes"
+	"crypto/x509"
+	"io/ioutil"
+	"net/mail"
+	"net/textproto"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetSMIMEVerifiedHeader(t *testing.T) {
+	signed, err := ioutil.ReadFile("testdata/smime_signed.eml")
+	require.NoError(t, err)
+
+	certificate, err := ioutil.ReadFile("testdata/smime_signer.crt")
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(certificate))
+
+	m := &pmapi.Message{MIMEType: pmapi.ContentTypeMultipartMixed, Body: string(signed)}
+
+	h := textproto.MIMEHeader{}
+	SetSMIMEVerifiedHeader(h, m, roots)
+	require.Equal(t, "pass; signer=alice@example.com", h.Get(SMIMEVerifiedHeaderKey))
+
+	SetSMIMEVerifiedHeader(h, m, x509.NewCertPool())
+	require.Equal(t, "untrusted; signer=alice@example.com", h.Get(SMIMEVerifiedHeaderKey))
+
+	m.Body = string(bytes.Replace(signed, []byte("Hello Bob"), []byte("Hello Eve"), 1))
+	SetSMIMEVerifiedHeader(h, m, roots)
+	require.Equal(t, "fail", h.Get(SMIMEVerifiedHeaderKey))
+
+	// Fields sent by the sender are removed from messages without S/MIME.
+	m = &pmapi.Message{MIMEType: pmapi.ContentTypeMultipartMixed, Body: "Content-Type: text/plain\r\n\r\nHello"}
+	h.Set(SMIMEVerifiedHeaderKey, SMIMEPass)
+	SetSMIMEVerifiedHeader(h, m, roots)
+	require.Empty(t, h.Get(SMIMEVerifiedHeaderKey))
+
+	m = &pmapi.Message{MIMEType: "text/plain", Body: string(signed)}
+	h.Set(SMIMEVerifiedHeaderKey, SMIMEPass)
+	SetSMIMEVerifiedHeader(h, m, roots)
+	require.Empty(t, h.Get(SMIMEVerifiedHeaderKey))
+}
+
+func TestGetHeaderRemovesSMIMEVerified(t *testing.T) {
+	m := &pmapi.Message{Header: mail.Header{"X-Pm-Smime-Verified": {"pass; signer=ceo@example.com"}}}
+	require.Empty(t, GetHeader(m).Get(SMIMEVerifiedHeaderKey))
+}
@@ -0,0 +1,283 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+
+	pmmime "github.com/ProtonMail/proton-bridge/pkg/mime"
+)
+
+// StripMode says what happens with attachment parts stripped from a message.
+type StripMode int
+
+const (
+	// StripRemove leaves attachment parts out of the message.
+	StripRemove StripMode = iota
+
+	// StripStub replaces attachment parts by short text parts describing
+	// the removed attachment.
+	StripStub
+)
+
+// StrippedPart describes one attachment part stripped from a message.
+type StrippedPart struct {
+	Section     string // Section path in the original message, e.g. "2" or "1.3".
+	Filename    string
+	ContentType string
+	Size        int64  // Size of the decoded content.
+	SHA256      string // Hex encoded hash of the decoded content.
+}
+
+// StrippedPartHandler receives the decoded content of each stripped part,
+// e.g. to store attachments separately.
+type StrippedPartHandler func(part StrippedPart, content io.Reader) error
+
+// strippedSection is the stripped part with its location in the message.
+type strippedSection struct {
+	StrippedPart
+	info   *sectionInfo
+	header textproto.MIMEHeader
+	parent string
+}
+
+// StripAttachments rewrites the message with attachment parts removed or
+// replaced by stubs and returns the manifest of stripped parts. The header
+// of the message and all other parts are copied byte by byte. Inline parts,
+// e.g. images of HTML body, are kept. When all parts of a multipart are
+// attachments, the last one is replaced by a stub even in StripRemove mode
+// so the multipart is not empty. The handler can be nil.
+func StripAttachments(literal []byte, mode StripMode, handler StrippedPartHandler) (stripped []byte, manifest []StrippedPart, err error) {
+	bs, err := NewBodyStructure(bytes.NewReader(literal))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sections := getStrippedSections(bs)
+	if len(sections) == 0 {
+		return literal, []StrippedPart{}, nil
+	}
+
+	nl := "\n"
+	if bytes.Contains(literal, []byte("\r\n")) {
+		nl = "\r\n"
+	}
+
+	out := &bytes.Buffer{}
+	last := 0
+	for i, section := range sections {
+		content := literal[section.info.start+section.info.size-section.info.bsize : section.info.start+section.info.size]
+		if err := section.readContent(content, handler); err != nil {
+			return nil, nil, err
+		}
+		manifest = append(manifest, section.StrippedPart)
+
+		from, to := section.info.start, section.info.start+section.info.size
+		replacement := section.stub(nl)
+		if mode == StripRemove && !isLastOfParent(sections, i, bs) {
+			if start, ok := findDelimiterStart(literal, bs, section); ok {
+				from, replacement = start, nil
+			}
+		}
+
+		out.Write(literal[last:from])
+		out.Write(replacement)
+		last = to
+	}
+	out.Write(literal[last:])
+
+	return out.Bytes(), manifest, nil
+}
+
+// getStrippedSections returns attachment sections sorted by their position
+// in the message. Sections inside stripped sections are skipped.
+func getStrippedSections(bs *BodyStructure) (sections []*strippedSection) {
+	paths := make([]string, 0, len(*bs))
+	for path := range *bs {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool { return (*bs)[paths[i]].start < (*bs)[paths[j]].start })
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if len(sections) > 0 && strings.HasPrefix(path, sections[len(sections)-1].Section+".") {
+			continue
+		}
+
+		info := (*bs)[path]
+		filename, mediaType, ok := getAttachmentPartInfo(info.header)
+		if !ok {
+			continue
+		}
+
+		parent := ""
+		if i := strings.LastIndex(path, "."); i >= 0 {
+			parent = path[:i]
+		}
+
+		sections = append(sections, &strippedSection{
+			StrippedPart: StrippedPart{
+				Section:     path,
+				Filename:    filename,
+				ContentType: mediaType,
+			},
+			info:   info,
+			header: info.header,
+			parent: parent,
+		})
+	}
+	return sections
+}
+
+// getAttachmentPartInfo returns the file name and media type of the part
+// if it is an attachment. Parts with inline disposition are not.
+func getAttachmentPartInfo(h textproto.MIMEHeader) (filename, mediaType string, ok bool) {
+	mediaType, params, _ := pmmime.ParseMediaType(h.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		return "", "", false
+	}
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+
+	disp, dispParams, _ := pmmime.ParseMediaType(h.Get("Content-Disposition"))
+	filename = dispParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+
+	switch {
+	case disp == "attachment":
+	case disp == "inline", filename == "":
+		return "", "", false
+	}
+
+	return parseAttachment(filename, mediaType, h).Name, mediaType, true
+}
+
+// readContent decodes the content to count its size and hash and passes
+// it to the handler.
+func (section *strippedSection) readContent(content []byte, handler StrippedPartHandler) error {
+	hash := sha256.New()
+	counter := &countWriter{}
+	decoded := io.TeeReader(decodePart(bytes.NewReader(content), section.header), io.MultiWriter(hash, counter))
+
+	if handler != nil {
+		if err := handler(section.StrippedPart, decoded); err != nil {
+			return err
+		}
+	}
+	if _, err := io.Copy(ioutil.Discard, decoded); err != nil {
+		return err
+	}
+
+	section.Size = counter.n
+	section.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+// stub returns the text part replacing the stripped part. It keeps the
+// original content type and disposition in X-Stripped header fields.
+func (section *strippedSection) stub(nl string) []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "Content-Type: text/plain; charset=utf-8%s", nl)
+	fmt.Fprintf(b, "Content-Transfer-Encoding: 8bit%s", nl)
+	fmt.Fprintf(b, "Content-Disposition: inline%s", nl)
+	if contentType := section.header.Get("Content-Type"); contentType != "" {
+		fmt.Fprintf(b, "X-Stripped-Content-Type: %s%s", contentType, nl)
+	}
+	if disposition := section.header.Get("Content-Disposition"); disposition != "" {
+		fmt.Fprintf(b, "X-Stripped-Content-Disposition: %s%s", disposition, nl)
+	}
+	fmt.Fprintf(b, "X-Stripped-Sha256: %s%s", section.SHA256, nl)
+	fmt.Fprintf(b, "%s", nl)
+	fmt.Fprintf(b, "Attachment removed: %s (%s, %s bytes)%s", section.Filename, section.ContentType, strconv.FormatInt(section.Size, 10), nl)
+	return b.Bytes()
+}
+
+// isLastOfParent returns whether all other parts of the parent multipart
+// of the i-th section are stripped and it is the last one of them.
+func isLastOfParent(sections []*strippedSection, i int, bs *BodyStructure) bool {
+	parent := sections[i].parent
+
+	count := 0
+	for _, section := range sections {
+		if section.parent == parent {
+			count++
+		}
+	}
+
+	children := 0
+	for path := range *bs {
+		if path != "" && !strings.Contains(strings.TrimPrefix(path, parent+"."), ".") && (parent == "" || strings.HasPrefix(path, parent+".")) {
+			children++
+		}
+	}
+	if count < children {
+		return false
+	}
+
+	for _, section := range sections[i+1:] {
+		if section.parent == parent {
+			return false
+		}
+	}
+	return true
+}
+
+// findDelimiterStart returns the position of the boundary delimiter line
+// before the section. The part itself ends with the new line before the
+// next delimiter, so removing both leaves the multipart well formed.
+func findDelimiterStart(literal []byte, bs *BodyStructure, section *strippedSection) (int, bool) {
+	parent, ok := (*bs)[section.parent]
+	if !ok {
+		return 0, false
+	}
+
+	_, params, _ := pmmime.ParseMediaType(parent.header.Get("Content-Type"))
+	if params["boundary"] == "" {
+		return 0, false
+	}
+
+	bodyStart := parent.start + parent.size - parent.bsize
+	i := bytes.LastIndex(literal[bodyStart:section.info.start], []byte("--"+params["boundary"]))
+	if i < 0 {
+		return 0, false
+	}
+	return bodyStart + i, true
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const stripTestMail = `From: Sender <sender@pm.me>
+To: Receiver <receiver@pm.me>
+Content-Type: multipart/mixed; boundary=longrandomstring
+
+--longrandomstring
+
+body
+--longrandomstring
+Content-Type: application/octet-stream; name="hi.txt"
+Content-Transfer-Encoding: base64
+
+aWYgeW91IGFyZSByZWFkaW5nIHRoaXMsIGhpIQ==
+--longrandomstring
+Content-Type: image/png
+Content-Disposition: inline
+Content-Transfer-Encoding: base64
+
+aW1hZ2U=
+--longrandomstring
+Content-Type: application/pdf
+Content-Disposition: attachment; filename="doc.pdf"
+
+pdf
+--longrandomstring--
+`
+
+func sha256Hex(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestStripAttachmentsRemove(t *testing.T) {
+	stripped, manifest, err := StripAttachments([]byte(stripTestMail), StripRemove, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, `From: Sender <sender@pm.me>
+To: Receiver <receiver@pm.me>
+Content-Type: multipart/mixed; boundary=longrandomstring
+
+--longrandomstring
+
+body
+--longrandomstring
+Content-Type: image/png
+Content-Disposition: inline
+Content-Transfer-Encoding: base64
+
+aW1hZ2U=
+--longrandomstring--
+`, string(stripped))
+
+	require.Equal(t, []StrippedPart{
+		{Section: "2", Filename: "hi.txt", ContentType: "application/octet-stream", Size: 28, SHA256: sha256Hex("if you are reading this, hi!")},
+		{Section: "4", Filename: "doc.pdf", ContentType: "application/pdf", Size: 4, SHA256: sha256Hex("pdf\n")},
+	}, manifest)
+
+	bs, err := NewBodyStructure(strings.NewReader(string(stripped)))
+	require.NoError(t, err)
+	require.Len(t, *bs, 3)
+}
+
+func TestStripAttachmentsStub(t *testing.T) {
+	stripped, manifest, err := StripAttachments([]byte(stripTestMail), StripStub, nil)
+	require.NoError(t, err)
+	require.Len(t, manifest, 2)
+
+	require.Contains(t, string(stripped), `--longrandomstring
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: 8bit
+Content-Disposition: inline
+X-Stripped-Content-Type: application/pdf
+X-Stripped-Content-Disposition: attachment; filename="doc.pdf"
+X-Stripped-Sha256: `+sha256Hex("pdf\n")+`
+
+Attachment removed: doc.pdf (application/pdf, 4 bytes)
+--longrandomstring--
+`)
+	require.Contains(t, string(stripped), "Attachment removed: hi.txt (application/octet-stream, 28 bytes)\n")
+	require.NotContains(t, string(stripped), "aWYgeW91IGFyZSByZWFkaW5nIHRoaXMsIGhpIQ==")
+	require.Contains(t, string(stripped), "aW1hZ2U=")
+
+	bs, err := NewBodyStructure(strings.NewReader(string(stripped)))
+	require.NoError(t, err)
+	require.Len(t, *bs, 5)
+}
+
+func TestStripAttachmentsKeepsNonEmptyMultipart(t *testing.T) {
+	literal := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Disposition: attachment; filename=a.bin\r\n\r\na\r\n" +
+		"--b\r\nContent-Disposition: attachment; filename=b.bin\r\n\r\nb\r\n" +
+		"--b--\r\n"
+
+	stripped, manifest, err := StripAttachments([]byte(literal), StripRemove, nil)
+	require.NoError(t, err)
+	require.Len(t, manifest, 2)
+
+	require.NotContains(t, string(stripped), "a.bin")
+	require.Contains(t, string(stripped), "\r\nAttachment removed: b.bin (text/plain, 3 bytes)\r\n--b--\r\n")
+}
+
+func TestStripAttachmentsHandler(t *testing.T) {
+	contents := map[string]string{}
+	_, _, err := StripAttachments([]byte(stripTestMail), StripRemove, func(part StrippedPart, content io.Reader) error {
+		b, err := ioutil.ReadAll(content)
+		contents[part.Filename] = string(b)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"hi.txt":  "if you are reading this, hi!",
+		"doc.pdf": "pdf\n",
+	}, contents)
+}
+
+func TestStripAttachmentsWithoutAttachments(t *testing.T) {
+	literal := "Content-Type: text/plain\r\n\r\nbody\r\n"
+
+	stripped, manifest, err := StripAttachments([]byte(literal), StripRemove, nil)
+	require.NoError(t, err)
+	require.Equal(t, literal, string(stripped))
+	require.Empty(t, manifest)
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"bytes"
+	"fmt"
+	htmlTemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	textTemplate "text/template"
+)
+
+// Names of templates of messages synthesized by bridge. The name is also
+// the name of the file which overrides the built-in template. Templates
+// ending with `.html` are escaped as HTML.
+const (
+	DecryptionErrorTemplate       = "decryption_error.html"
+	DecryptionPlaceholderTemplate = "decryption_placeholder.txt"
+	BounceSubjectTemplate         = "bounce_subject.txt"
+	BounceSenderTemplate          = "bounce_sender.txt"
+	BounceBodyTemplate            = "bounce_body.txt"
+	RelaySubjectTemplate          = "relay_subject.txt"
+	RelayBodyTemplate             = "relay_body.txt"
+	MDNSubjectTemplate            = "mdn_subject.txt"
+	MDNBodyTemplate               = "mdn_body.txt"
+)
+
+// defaultLocale is used when there is no template for the chosen locale.
+const defaultLocale = "en"
+
+// TemplateOptions configures texts of synthesized messages.
+type TemplateOptions struct {
+	// Locale is e.g. `de` or `de_DE`. Empty locale means locale of the system.
+	Locale string
+
+	// Dir contains files overriding the built-in templates. Files in
+	// a subfolder named by the locale, e.g. `templates/de/bounce_body.txt`,
+	// take precedence over files directly in the folder.
+	Dir string
+}
+
+var (
+	templateOptions       TemplateOptions //nolint[gochecknoglobals]
+	templateOptionsLocker sync.RWMutex    //nolint[gochecknoglobals]
+)
+
+// SetTemplateOptions changes locale and overrides of synthesized messages.
+func SetTemplateOptions(opts TemplateOptions) {
+	templateOptionsLocker.Lock()
+	defer templateOptionsLocker.Unlock()
+
+	templateOptions = opts
+}
+
+func getTemplateOptions() TemplateOptions {
+	templateOptionsLocker.RLock()
+	defer templateOptionsLocker.RUnlock()
+
+	return templateOptions
+}
+
+// BounceData is passed to bounce templates.
+type BounceData struct {
+	Subject  string // Subject of the undelivered message.
+	Failures []BounceFailure
+}
+
+// BounceFailure describes why the message was not delivered to a recipient.
+type BounceFailure struct {
+	Address string
+	Error   string
+}
+
+// RelayData is passed to templates of notifications about messages relayed
+// to the API.
+type RelayData struct {
+	Subject    string // Subject of the relayed message.
+	Recipients []string
+}
+
+// MDNData is passed to read receipt templates.
+type MDNData struct {
+	Subject   string // Subject of the displayed message.
+	Recipient string // Address which displayed the message.
+}
+
+// Locales returns locales with built-in templates.
+func Locales() (locales []string) {
+	for locale := range builtinTemplates {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return
+}
+
+// ExecuteTemplate returns the text of the template in the configured locale.
+// Template overriding the built-in one is read every time so changes apply
+// without restart. An invalid override is ignored.
+func ExecuteTemplate(name string, data interface{}) (string, error) {
+	opts := getTemplateOptions()
+
+	locale := opts.Locale
+	if locale == "" {
+		locale = DetectLocale()
+	}
+	locales := localeCandidates(locale)
+
+	if opts.Dir != "" {
+		paths := []string{}
+		for _, locale := range locales {
+			paths = append(paths, filepath.Join(opts.Dir, locale, name))
+		}
+		paths = append(paths, filepath.Join(opts.Dir, name))
+
+		for _, path := range paths {
+			text, err := ioutil.ReadFile(path) //nolint[gosec]
+			if err != nil {
+				continue
+			}
+			result, err := executeTemplate(name, string(text), data)
+			if err != nil {
+				log.WithError(err).WithField("path", path).Warn("Ignoring invalid template override")
+				break
+			}
+			return result, nil
+		}
+	}
+
+	for _, locale := range append(locales, defaultLocale) {
+		if text, ok := builtinTemplates[locale][name]; ok {
+			return executeTemplate(name, text, data)
+		}
+	}
+
+	return "", fmt.Errorf("unknown template %q", name)
+}
+
+func executeTemplate(name, text string, data interface{}) (string, error) {
+	b := &bytes.Buffer{}
+
+	if strings.HasSuffix(name, ".html") {
+		t, err := htmlTemplate.New(name).Parse(text)
+		if err != nil {
+			return "", err
+		}
+		if err := t.Execute(b, data); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+
+	t, err := textTemplate.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// DetectLocale returns locale of the system from environment variables,
+// or empty string if it is not set.
+func DetectLocale() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(key); value != "" && value != "C" && value != "POSIX" {
+			return value
+		}
+	}
+	return ""
+}
+
+// localeCandidates returns the locale without encoding followed by its
+// language, e.g. `de_DE` and `de` for `de_DE.UTF-8`.
+func localeCandidates(locale string) (locales []string) {
+	if idx := strings.IndexAny(locale, ".@"); idx >= 0 {
+		locale = locale[:idx]
+	}
+	locale = strings.ReplaceAll(locale, "-", "_")
+	if locale == "" {
+		return nil
+	}
+
+	locales = append(locales, locale)
+	if idx := strings.Index(locale, "_"); idx > 0 {
+		locales = append(locales, locale[:idx])
+	}
+	return locales
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import "fmt"
+
+// decryptionErrorLayout is shared by all locales, only texts are translated.
+const decryptionErrorLayout = `
+<html>
+	<head></head>
+	<body style="font-family: Arial,'Helvetica Neue',Helvetica,sans-serif; font-size: 14px;">
+		<div style="color:#555; background-color:#cf9696; padding:20px; border-radius: 4px;">
+			<strong>%s</strong><br/>
+			%s
+			<pre>{{.Error}}</pre>
+		</div>
+
+		{{if .AttachBody}}
+		<div style="color:#333; background-color:#f4f4f4;  border: 1px solid #acb0bf; border-radius: 2px; padding:1rem; margin:1rem 0; font-family:monospace; font-size: 1em;">
+			<pre>{{.Body}}</pre>
+		</div>
+		{{- end}}
+	</body>
+</html>
+`
+
+const bounceFailuresList = "\r\n\r\n{{range .Failures}}<{{.Address}}>: {{.Error}}\r\n{{end}}"
+
+const relayRecipientsList = "\r\n\r\n{{range .Recipients}}<{{.}}>\r\n{{end}}"
+
+// builtinTemplates are templates of synthesized messages by locale and name.
+var builtinTemplates = map[string]map[string]string{ //nolint[gochecknoglobals]
+	"en": {
+		DecryptionErrorTemplate: fmt.Sprintf(decryptionErrorLayout,
+			"Decryption error",
+			"Decryption of this message's encrypted content failed.",
+		),
+		DecryptionPlaceholderTemplate: "This message could not be decrypted, so it is shown as it is stored by Proton: the original headers are kept and the encrypted content is attached as {{.AttachmentName}}. The message can still be moved and searched by its headers; it may be readable by PGP software with the right private key.\r\n\r\nError: {{.Error}}",
+		BounceSubjectTemplate:         "Undelivered Mail Returned to Sender",
+		BounceSenderTemplate:          "Mail Delivery System",
+		BounceBodyTemplate:            `Your message "{{.Subject}}" could not be delivered to the following recipients:` + bounceFailuresList,
+		RelaySubjectTemplate:          "Message Relayed",
+		RelayBodyTemplate:             `Your message "{{.Subject}}" was passed to Proton servers for the following recipients. Further delivery is not reported:` + relayRecipientsList,
+		MDNSubjectTemplate:            "Read: {{.Subject}}",
+		MDNBodyTemplate:               `Your message "{{.Subject}}" sent to {{.Recipient}} was displayed. This is no guarantee that the message has been read or understood.`,
+	},
+	"de": {
+		DecryptionErrorTemplate: fmt.Sprintf(decryptionErrorLayout,
+			"Entschlüsselungsfehler",
+			"Der verschlüsselte Inhalt dieser Nachricht konnte nicht entschlüsselt werden.",
+		),
+		DecryptionPlaceholderTemplate: "Diese Nachricht konnte nicht entschlüsselt werden und wird daher so angezeigt, wie sie bei Proton gespeichert ist: Die ursprünglichen Kopfzeilen bleiben erhalten und der verschlüsselte Inhalt ist als {{.AttachmentName}} angehängt. Die Nachricht kann weiterhin verschoben und anhand ihrer Kopfzeilen durchsucht werden; mit dem richtigen privaten Schlüssel kann sie eventuell mit PGP-Software gelesen werden.\r\n\r\nFehler: {{.Error}}",
+		BounceSubjectTemplate:         "Unzustellbare Nachricht an Absender zurückgeschickt",
+		BounceSenderTemplate:          "Mail-Zustellsystem",
+		BounceBodyTemplate:            "Ihre Nachricht „{{.Subject}}“ konnte an folgende Empfänger nicht zugestellt werden:" + bounceFailuresList,
+		RelaySubjectTemplate:          "Nachricht weitergegeben",
+		RelayBodyTemplate:             "Ihre Nachricht „{{.Subject}}“ wurde für folgende Empfänger an die Proton-Server übergeben. Über die weitere Zustellung wird nicht berichtet:" + relayRecipientsList,
+		MDNSubjectTemplate:            "Gelesen: {{.Subject}}",
+		MDNBodyTemplate:               "Ihre Nachricht „{{.Subject}}“ an {{.Recipient}} wurde angezeigt. Das ist keine Garantie, dass die Nachricht gelesen oder verstanden wurde.",
+	},
+	"fr": {
+		DecryptionErrorTemplate: fmt.Sprintf(decryptionErrorLayout,
+			"Erreur de déchiffrement",
+			"Le déchiffrement du contenu chiffré de ce message a échoué.",
+		),
+		DecryptionPlaceholderTemplate: "Ce message n'a pas pu être déchiffré, il est donc affiché tel qu'il est stocké par Proton : les en-têtes d'origine sont conservés et le contenu chiffré est joint en tant que {{.AttachmentName}}. Le message peut toujours être déplacé et recherché par ses en-têtes ; il peut être lisible par un logiciel PGP avec la bonne clé privée.\r\n\r\nErreur : {{.Error}}",
+		BounceSubjectTemplate:         "Message non distribué retourné à l'expéditeur",
+		BounceSenderTemplate:          "Système de distribution du courrier",
+		BounceBodyTemplate:            "Votre message « {{.Subject}} » n'a pas pu être remis aux destinataires suivants :" + bounceFailuresList,
+		RelaySubjectTemplate:          "Message relayé",
+		RelayBodyTemplate:             "Votre message « {{.Subject}} » a été transmis aux serveurs Proton pour les destinataires suivants. La suite de la distribution n'est pas signalée :" + relayRecipientsList,
+		MDNSubjectTemplate:            "Lu : {{.Subject}}",
+		MDNBodyTemplate:               "Votre message « {{.Subject}} » envoyé à {{.Recipient}} a été affiché. Cela ne garantit pas que le message a été lu ou compris.",
+	},
+	"es": {
+		DecryptionErrorTemplate: fmt.Sprintf(decryptionErrorLayout,
+			"Error de descifrado",
+			"No se ha podido descifrar el contenido cifrado de este mensaje.",
+		),
+		DecryptionPlaceholderTemplate: "No se ha podido descifrar este mensaje, por lo que se muestra tal como lo almacena Proton: se conservan los encabezados originales y el contenido cifrado se adjunta como {{.AttachmentName}}. El mensaje todavía se puede mover y buscar por sus encabezados; puede que sea legible con software PGP y la clave privada correcta.\r\n\r\nError: {{.Error}}",
+		BounceSubjectTemplate:         "Correo no entregado devuelto al remitente",
+		BounceSenderTemplate:          "Sistema de entrega de correo",
+		BounceBodyTemplate:            "No se ha podido entregar su mensaje «{{.Subject}}» a los siguientes destinatarios:" + bounceFailuresList,
+		RelaySubjectTemplate:          "Mensaje retransmitido",
+		RelayBodyTemplate:             "Su mensaje «{{.Subject}}» se ha entregado a los servidores de Proton para los siguientes destinatarios. No se informa del resto de la entrega:" + relayRecipientsList,
+		MDNSubjectTemplate:            "Leído: {{.Subject}}",
+		MDNBodyTemplate:               "Su mensaje «{{.Subject}}» enviado a {{.Recipient}} se ha mostrado. Esto no garantiza que el mensaje se haya leído o comprendido.",
+	},
+}
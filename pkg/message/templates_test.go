@@ -0,0 +1,95 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocaleCandidates(t *testing.T) {
+	require.Equal(t, []string{"de_DE", "de"}, localeCandidates("de_DE.UTF-8"))
+	require.Equal(t, []string{"fr_CA", "fr"}, localeCandidates("fr-CA"))
+	require.Equal(t, []string{"es"}, localeCandidates("es"))
+	require.Empty(t, localeCandidates(""))
+}
+
+func TestExecuteBuiltinTemplate(t *testing.T) {
+	defer SetTemplateOptions(TemplateOptions{})
+
+	data := BounceData{
+		Subject:  "Hello",
+		Failures: []BounceFailure{{Address: "bad@example.com", Error: "address does not exist"}},
+	}
+
+	SetTemplateOptions(TemplateOptions{Locale: "de_AT.UTF-8"})
+	body, err := ExecuteTemplate(BounceBodyTemplate, data)
+	require.NoError(t, err)
+	require.Equal(t, "Ihre Nachricht „Hello“ konnte an folgende Empfänger nicht zugestellt werden:\r\n\r\n<bad@example.com>: address does not exist\r\n", body)
+
+	// Unknown locale falls back to English.
+	SetTemplateOptions(TemplateOptions{Locale: "xx"})
+	subject, err := ExecuteTemplate(BounceSubjectTemplate, data)
+	require.NoError(t, err)
+	require.Equal(t, "Undelivered Mail Returned to Sender", subject)
+
+	_, err = ExecuteTemplate("unknown.txt", data)
+	require.Error(t, err)
+}
+
+func TestExecuteTemplateOverride(t *testing.T) {
+	defer SetTemplateOptions(TemplateOptions{})
+
+	dir, err := ioutil.TempDir("", "templates")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "fr"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, BounceSubjectTemplate), []byte("Bounced: {{.Subject}}"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "fr", BounceSubjectTemplate), []byte("Rejeté : {{.Subject}}"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, BounceSenderTemplate), []byte("{{.Invalid"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, DecryptionErrorTemplate), []byte("<p>{{.Error}}</p>"), 0600))
+
+	data := BounceData{Subject: "Hello"}
+
+	SetTemplateOptions(TemplateOptions{Locale: "fr_FR", Dir: dir})
+	subject, err := ExecuteTemplate(BounceSubjectTemplate, data)
+	require.NoError(t, err)
+	require.Equal(t, "Rejeté : Hello", subject)
+
+	// Invalid override is ignored.
+	sender, err := ExecuteTemplate(BounceSenderTemplate, data)
+	require.NoError(t, err)
+	require.Equal(t, "Système de distribution du courrier", sender)
+
+	SetTemplateOptions(TemplateOptions{Locale: "en", Dir: dir})
+	subject, err = ExecuteTemplate(BounceSubjectTemplate, data)
+	require.NoError(t, err)
+	require.Equal(t, "Bounced: Hello", subject)
+
+	// HTML templates are escaped.
+	m := &pmapi.Message{}
+	require.NoError(t, CustomMessage(m, errors.New("<script>"), false))
+	require.Equal(t, "<p>&lt;script&gt;</p>", m.Body)
+}
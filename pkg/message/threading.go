@@ -0,0 +1,141 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// Threads are kept by Message-Id, In-Reply-To and References fields. IDs of
+// Proton messages and conversations are exposed to clients as placeholder
+// message IDs in internal domains and have to be rewritten back to external
+// IDs before the message leaves Bridge.
+
+// ParseMessageIDs returns message IDs with angle brackets from the value of
+// References, In-Reply-To or Message-Id field in their order and without
+// duplicates. White space inside brackets and comments are removed; IDs
+// without brackets written by broken clients are accepted if they contain @.
+func ParseMessageIDs(value string) []string {
+	var ids []string
+	for value != "" {
+		switch value[0] {
+		case ' ', '\t', '\r', '\n', ',', ';':
+			value = value[1:]
+
+		case '(':
+			end := strings.IndexByte(value, ')')
+			if end < 0 {
+				return uniqueMessageIDs(ids)
+			}
+			value = value[end+1:]
+
+		case '<':
+			end := strings.IndexByte(value, '>')
+			if end < 0 {
+				return uniqueMessageIDs(ids)
+			}
+			if id := strings.Join(strings.Fields(value[1:end]), ""); id != "" {
+				ids = append(ids, "<"+id+">")
+			}
+			value = value[end+1:]
+
+		default:
+			end := strings.IndexAny(value, " \t\r\n,;<(")
+			if end < 0 {
+				end = len(value)
+			}
+			if token := value[:end]; strings.Contains(token, "@") {
+				ids = append(ids, "<"+token+">")
+			}
+			value = value[end:]
+		}
+	}
+	return uniqueMessageIDs(ids)
+}
+
+// FormatMessageIDs returns the value of References or In-Reply-To field.
+func FormatMessageIDs(ids []string) string {
+	return strings.Join(ids, " ")
+}
+
+// AppendMessageIDs returns the normalized value of References field with the
+// IDs appended unless they are already present.
+func AppendMessageIDs(value string, ids ...string) string {
+	return FormatMessageIDs(ParseMessageIDs(value + " " + FormatMessageIDs(ids)))
+}
+
+// InternalMessageID returns the placeholder message ID of the Proton message.
+func InternalMessageID(apiID string) string {
+	return "<" + apiID + "@" + pmapi.InternalIDDomain + ">"
+}
+
+// ConversationMessageID returns the placeholder message ID of the Proton
+// conversation.
+func ConversationMessageID(conversationID string) string {
+	return "<" + conversationID + "@" + pmapi.ConversationIDDomain + ">"
+}
+
+// ParseInternalMessageID returns the ID of Proton message from its
+// placeholder message ID.
+func ParseInternalMessageID(id string) (apiID string, ok bool) {
+	id = strings.Trim(strings.TrimSpace(id), "<>")
+	if apiID = strings.TrimSuffix(id, "@"+pmapi.InternalIDDomain); apiID == id || apiID == "" {
+		return "", false
+	}
+	return apiID, true
+}
+
+func isConversationMessageID(id string) bool {
+	return strings.HasSuffix(strings.Trim(id, "<>"), "@"+pmapi.ConversationIDDomain)
+}
+
+// RewriteInternalMessageIDs replaces placeholder IDs of Proton messages by
+// their external message IDs returned by resolve, which gets the ID of the
+// Proton message and returns empty string when it is not known. Unresolved
+// placeholders and placeholders of conversations are removed.
+func RewriteInternalMessageIDs(ids []string, resolve func(apiID string) string) []string {
+	var rewritten []string
+	for _, id := range ids {
+		if isConversationMessageID(id) {
+			continue
+		}
+		if apiID, ok := ParseInternalMessageID(id); ok {
+			externalID := strings.Trim(resolve(apiID), "<>")
+			if externalID == "" {
+				continue
+			}
+			id = "<" + externalID + ">"
+		}
+		rewritten = append(rewritten, id)
+	}
+	return uniqueMessageIDs(rewritten)
+}
+
+func uniqueMessageIDs(ids []string) []string {
+	var unique []string
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
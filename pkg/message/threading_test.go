@@ -0,0 +1,102 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package message
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseMessageIDsCorpus parses header fields from testdata where each
+// case is the header followed by line with expected IDs after `=>`.
+func TestParseMessageIDsCorpus(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "references.txt"))
+	require.NoError(t, err)
+
+	for _, block := range strings.Split(string(data), "\n\n") {
+		lines := []string{}
+		name := ""
+		for _, line := range strings.Split(strings.TrimSpace(block), "\n") {
+			if strings.HasPrefix(line, "#") {
+				name = line
+				continue
+			}
+			lines = append(lines, line)
+		}
+		want := strings.Fields(strings.TrimPrefix(lines[len(lines)-1], "=>"))
+
+		header := strings.Join(lines[:len(lines)-1], "\r\n") + "\r\n\r\n"
+		h, err := textproto.NewReader(bufio.NewReader(strings.NewReader(header))).ReadMIMEHeader()
+		require.NoError(t, err, name)
+
+		for _, values := range h {
+			require.Equal(t, want, ParseMessageIDs(values[0]), name)
+		}
+	}
+}
+
+func TestParseMessageIDs(t *testing.T) {
+	require.Equal(t, []string{"<a@pm.me>", "<b@pm.me>"}, ParseMessageIDs(" <a@pm.me>\r\n <b@pm.me> <broken"))
+	require.Nil(t, ParseMessageIDs(""))
+}
+
+func TestAppendMessageIDs(t *testing.T) {
+	require.Equal(t, "<a@pm.me>", AppendMessageIDs("", "<a@pm.me>"))
+	require.Equal(t, "<a@pm.me> <b@pm.me>", AppendMessageIDs(" <a@pm.me>,<b@pm.me>", "<a@pm.me>"))
+	require.Equal(t, "<1a@pm.me> <1@"+pmapi.InternalIDDomain+">", AppendMessageIDs("<1a@pm.me>", InternalMessageID("1")))
+}
+
+func TestParseInternalMessageID(t *testing.T) {
+	apiID, ok := ParseInternalMessageID(InternalMessageID("Yq1b=="))
+	require.True(t, ok)
+	require.Equal(t, "Yq1b==", apiID)
+
+	for _, id := range []string{"<a@pm.me>", ConversationMessageID("conv"), "<@" + pmapi.InternalIDDomain + ">", ""} {
+		_, ok := ParseInternalMessageID(id)
+		require.False(t, ok, id)
+	}
+}
+
+func TestRewriteInternalMessageIDs(t *testing.T) {
+	externalIDs := map[string]string{"parent": "parent@pm.me", "known": "<first@pm.me>"}
+	resolve := func(apiID string) string { return externalIDs[apiID] }
+
+	ids := []string{"<first@pm.me>", InternalMessageID("known"), InternalMessageID("unknown"), InternalMessageID("parent"), ConversationMessageID("conv")}
+	require.Equal(t, []string{"<first@pm.me>", "<parent@pm.me>"}, RewriteInternalMessageIDs(ids, resolve))
+	require.Nil(t, RewriteInternalMessageIDs(nil, resolve))
+}
+
+func TestGetHeaderReferences(t *testing.T) {
+	msg := &pmapi.Message{
+		ID:             "1",
+		ConversationID: "conv",
+		Header:         map[string][]string{"References": {"<1a@pm.me>,<1a@pm.me>"}},
+	}
+
+	h := GetHeader(msg)
+	require.Equal(t, "<1a@pm.me> "+InternalMessageID("1")+" "+ConversationMessageID("conv"), h.Get("References"))
+
+	require.Equal(t, h.Get("References"), GetHeader(msg).Get("References"))
+}
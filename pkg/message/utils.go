@@ -18,8 +18,6 @@
 package message
 
 import (
-	"bytes"
-	"html/template"
 	"io"
 	"net/http"
 	"net/mail"
@@ -36,25 +34,6 @@ func WriteHeader(w io.Writer, h textproto.MIMEHeader) (err error) {
 	return
 }
 
-const customMessageTemplate = `
-<html>
-	<head></head>
-	<body style="font-family: Arial,'Helvetica Neue',Helvetica,sans-serif; font-size: 14px;">
-		<div style="color:#555; background-color:#cf9696; padding:20px; border-radius: 4px;">
-			<strong>Decryption error</strong><br/>
-			Decryption of this message's encrypted content failed.
-			<pre>{{.Error}}</pre>
-		</div>
-
-		{{if .AttachBody}}
-		<div style="color:#333; background-color:#f4f4f4;  border: 1px solid #acb0bf; border-radius: 2px; padding:1rem; margin:1rem 0; font-family:monospace; font-size: 1em;">
-			<pre>{{.Body}}</pre>
-		</div>
-		{{- end}}
-	</body>
-</html>
-`
-
 type customMessageData struct {
 	Error      string
 	AttachBody bool
@@ -62,20 +41,17 @@ type customMessageData struct {
 }
 
 func CustomMessage(m *pmapi.Message, decodeError error, attachBody bool) error {
-	t := template.Must(template.New("customMessage").Parse(customMessageTemplate))
-
-	b := new(bytes.Buffer)
-
-	if err := t.Execute(b, customMessageData{
+	body, err := ExecuteTemplate(DecryptionErrorTemplate, customMessageData{
 		Error:      decodeError.Error(),
 		AttachBody: attachBody,
 		Body:       m.Body,
-	}); err != nil {
+	})
+	if err != nil {
 		return err
 	}
 
 	m.MIMEType = pmapi.ContentTypeHTML
-	m.Body = b.String()
+	m.Body = body
 
 	// NOTE: we need to set header in custom message header, so we check that is non-nil.
 	if m.Header == nil {
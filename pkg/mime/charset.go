@@ -0,0 +1,386 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmmime
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+const (
+	// detectSampleSize is how much of the content is used to score charsets.
+	detectSampleSize = 64 * 1024
+
+	// minMisdecodedBytes is how many non-ASCII bytes content declared as
+	// Latin charset must have to check whether it is in other charset.
+	// Shorter texts do not have enough letters to tell reliably.
+	minMisdecodedBytes = 16
+)
+
+// Scores of decoded characters; the higher score the more likely the text
+// was decoded with the right charset.
+const (
+	scoreLetter      = 1
+	scoreLowercase   = 1
+	scoreCommon      = 3
+	scoreSymbol      = -1
+	scoreRare        = -3
+	scoreMixedCase   = -4
+	scoreAdjacent    = -2
+	scoreMixedScript = -10
+	scoreControl     = -20
+	scoreInvalid     = -50
+)
+
+var (
+	// charsetSupersets are charsets often declared for content which uses
+	// also characters of their superset, e.g. GB18030 characters in GBK.
+	charsetSupersets = map[string][]string{ //nolint[gochecknoglobals]
+		"gbk":         {"gb18030"},
+		"koi8-r":      {"koi8-u"},
+		"iso-8859-2":  {"windows-1250"},
+		"iso-8859-6":  {"windows-1256"},
+		"iso-8859-7":  {"windows-1253"},
+		"iso-8859-8":  {"windows-1255"},
+		"iso-8859-13": {"windows-1257"},
+	}
+
+	// detectCandidates are charsets tried by detection. When scores are
+	// equal, the earlier charset wins.
+	detectCandidates = []string{ //nolint[gochecknoglobals]
+		"windows-1252",
+		"windows-1251",
+		"koi8-r",
+		"windows-1253",
+		"iso-2022-jp",
+		"shift_jis",
+		"euc-jp",
+		"gb18030",
+		"big5",
+		"euc-kr",
+	}
+
+	// commonCharacters are the most frequent characters of Chinese,
+	// Japanese and Korean texts. Wrongly decoded text consists of random
+	// characters, so it rarely contains them.
+	commonCharacters = map[rune]bool{} //nolint[gochecknoglobals]
+)
+
+func init() { //nolint[gochecknoinits]
+	for _, r := range "的一是不了我在有他这這个個们們来來国國说說为為时時到和你地出道也" + // Chinese
+		"日本見行後今月円何書語気話読聞食" + // Japanese
+		"のにはをたがでてとしもなかるいす" + // Japanese particles and endings
+		"이다의는에을를가한하고서지기로도사있것수들그" { // Korean
+		commonCharacters[r] = true
+	}
+}
+
+type charsetCandidate struct {
+	name    string
+	decoded []byte
+	score   int
+}
+
+// decodeWithCharset converts the content in declared charset to UTF-8. When
+// the content does not fit the charset, e.g. it has bytes which are not valid
+// in it, a superset of the charset or detected charset is used instead.
+func decodeWithCharset(original []byte, charset string) ([]byte, error) {
+	decoder, err := selectDecoder(charset)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := decoder.Bytes(original)
+	if err != nil {
+		return nil, err
+	}
+
+	name := canonicalCharset(charset)
+	if name == "" || isASCII(original) {
+		return decoded, nil
+	}
+
+	best := charsetCandidate{name: name, decoded: decoded, score: scoreText(decoded)}
+	for _, superset := range charsetSupersets[name] {
+		if candidate, ok := decodeCandidate(original, superset); ok && candidate.score > best.score {
+			best = candidate
+		}
+	}
+
+	isLatin := name == "windows-1252" || name == "iso-8859-15"
+
+	// UTF-8 declared as Latin-1 is the most common mistake and Latin text
+	// is very unlikely valid UTF-8.
+	if isLatin && utf8.Valid(original) {
+		return original, nil
+	}
+
+	if hasInvalid(best.decoded) || (isLatin && looksMisdecoded(original)) {
+		if detected := detectCharset(original); detected.score > best.score {
+			best = detected
+		}
+	}
+
+	return best.decoded, nil
+}
+
+// DetectCharset returns the charset which most likely encodes the content
+// with unknown charset. It prefers UTF-8 and windows-1252 when the content
+// fits them.
+func DetectCharset(original []byte) string {
+	if isISO2022JP(original) {
+		return "iso-2022-jp"
+	}
+
+	if utf8.Valid(original) {
+		return "utf-8"
+	}
+
+	return detectCharset(original).name
+}
+
+func detectCharset(original []byte) (best charsetCandidate) {
+	sample := original
+	if len(sample) > detectSampleSize {
+		sample = sample[:detectSampleSize]
+	}
+
+	// Windows-1252 decodes anything. Short or mostly ASCII text which it
+	// decodes without controls is not worth guessing.
+	best, _ = decodeCandidate(sample, detectCandidates[0])
+	if best.score >= 0 && !looksMisdecoded(sample) {
+		return decodeWhole(original, sample, best)
+	}
+
+	for _, name := range detectCandidates[1:] {
+		candidate, ok := decodeCandidate(sample, name)
+		if ok && candidate.score > best.score {
+			best = candidate
+		}
+	}
+
+	return decodeWhole(original, sample, best)
+}
+
+// decodeWhole decodes whole content with the charset chosen by its sample.
+func decodeWhole(original, sample []byte, best charsetCandidate) charsetCandidate {
+	if len(sample) < len(original) {
+		if candidate, ok := decodeCandidate(original, best.name); ok {
+			best.decoded = candidate.decoded
+		}
+	}
+
+	return best
+}
+
+func decodeCandidate(original []byte, name string) (charsetCandidate, bool) {
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return charsetCandidate{}, false
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(original)
+	if err != nil {
+		return charsetCandidate{}, false
+	}
+
+	return charsetCandidate{name: name, decoded: decoded, score: scoreText(decoded)}, true
+}
+
+// canonicalCharset returns the name used in charsetSupersets and
+// detectCandidates or empty string for charsets handled differently,
+// e.g. UTF-7.
+func canonicalCharset(charset string) string {
+	enc, err := getEncoding(charset)
+	if err != nil {
+		return ""
+	}
+
+	name, err := htmlindex.Name(enc)
+	if err != nil {
+		return ""
+	}
+
+	return name
+}
+
+// looksMisdecoded returns whether the content has more non-ASCII bytes than
+// ASCII letters which is typical for Cyrillic, Greek or CJK text but not for
+// text in Latin script.
+func looksMisdecoded(original []byte) bool {
+	var nonASCII, asciiLetters int
+	for _, b := range original {
+		switch {
+		case b >= utf8.RuneSelf:
+			nonASCII++
+		case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z':
+			asciiLetters++
+		}
+	}
+
+	return nonASCII >= minMisdecodedBytes && nonASCII > asciiLetters
+}
+
+// isISO2022JP returns whether the content is 7-bit with escape sequences
+// switching to JIS X 0208 or JIS X 0212.
+func isISO2022JP(original []byte) bool {
+	if !isASCII(original) {
+		return false
+	}
+
+	for _, escape := range []string{"\x1b$B", "\x1b$@", "\x1b$(D"} {
+		if bytes.Contains(original, []byte(escape)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isASCII(original []byte) bool {
+	for _, b := range original {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func hasInvalid(decoded []byte) bool {
+	return bytes.ContainsRune(decoded, utf8.RuneError)
+}
+
+// scoreText returns how plausible the decoded text is. Characters typical for
+// wrong decoding, such as replacement characters, controls, rare ideographs,
+// letters of different scripts or Latin letters with diacritics next to each
+// other, lower the score.
+func scoreText(decoded []byte) (score int) {
+	var prev rune
+
+	for _, r := range string(decoded) {
+		switch {
+		case r == utf8.RuneError:
+			score += scoreInvalid
+
+		case r < utf8.RuneSelf:
+			if r < ' ' && !strings.ContainsRune("\t\r\n\f", r) {
+				score += scoreControl
+			}
+
+		case unicode.IsControl(r):
+			score += scoreControl
+
+		case unicode.Is(unicode.Co, r), isRareCharacter(r):
+			score += scoreRare
+
+		case unicode.IsLetter(r):
+			score += scoreLetter + scoreLetterInWord(r, prev)
+
+		case isCommonSymbol(r):
+
+		default:
+			score += scoreSymbol
+		}
+
+		prev = r
+	}
+
+	return score
+}
+
+func scoreLetterInWord(r, prev rune) (score int) {
+	if commonCharacters[r] {
+		score += scoreCommon
+	}
+
+	if unicode.IsLower(r) {
+		score += scoreLowercase
+	}
+
+	if !unicode.IsLetter(prev) {
+		return score
+	}
+
+	if unicode.IsUpper(r) && unicode.IsLower(prev) {
+		score += scoreMixedCase
+	}
+
+	if prev >= utf8.RuneSelf && unicode.Is(unicode.Latin, r) && unicode.Is(unicode.Latin, prev) {
+		score += scoreAdjacent
+	}
+
+	if prevScript, script := letterScript(prev), letterScript(r); prevScript != script {
+		score += scoreMixedScript
+	}
+
+	return score
+}
+
+// letterScript groups scripts which are mixed in words, e.g. kanji with
+// kana in Japanese.
+func letterScript(r rune) string {
+	switch {
+	case unicode.Is(unicode.Latin, r):
+		return "latin"
+	case unicode.Is(unicode.Cyrillic, r):
+		return "cyrillic"
+	case unicode.Is(unicode.Greek, r):
+		return "greek"
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana):
+		return "cjk"
+	case unicode.Is(unicode.Hangul, r):
+		return "hangul"
+	}
+	return "other"
+}
+
+// isRareCharacter returns whether the character is rarely used but often
+// appears in text decoded with wrong CJK charset.
+func isRareCharacter(r rune) bool {
+	switch {
+	case 0x3400 <= r && r <= 0x4DBF: // CJK Unified Ideographs Extension A
+		return true
+	case 0xF900 <= r && r <= 0xFAFF: // CJK Compatibility Ideographs
+		return true
+	case 0xFF61 <= r && r <= 0xFF9F: // Halfwidth Katakana
+		return true
+	case 0x2500 <= r && r <= 0x259F: // Box Drawing and Block Elements
+		return true
+	}
+	return false
+}
+
+// isCommonSymbol returns whether the character is punctuation or space
+// used in normal text.
+func isCommonSymbol(r rune) bool {
+	switch {
+	case 0x2000 <= r && r <= 0x206F: // General Punctuation
+		return true
+	case 0x3000 <= r && r <= 0x303F: // CJK Symbols and Punctuation
+		return true
+	case 0xFF01 <= r && r <= 0xFF60: // Fullwidth Forms
+		return true
+	case r == 0xA0 || r == 0xAB || r == 0xBB || r == 0x20AC: // NBSP, guillemets, euro
+		return true
+	}
+	return unicode.IsDigit(r) || unicode.IsMark(r)
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmmime
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+func encodeString(t *testing.T, charset, text string) []byte {
+	enc, err := htmlindex.Get(charset)
+	require.NoError(t, err)
+	b, err := enc.NewEncoder().Bytes([]byte(text))
+	require.NoError(t, err)
+	return b
+}
+
+const (
+	russianText  = "Съешь же ещё этих мягких французских булок, да выпей чаю."
+	chineseText  = "我们的国家在这个时候有很多人来到这里，他说这是一个好地方。"
+	japaneseText = "日本語の文章は、ひらがなとカタカナと漢字で書かれています。"
+	koreanText   = "다람쥐 헌 쳇바퀴에 타고파. 이것은 한국어로 쓴 문장입니다."
+)
+
+func TestDecodeCharsetWrongDeclaration(t *testing.T) {
+	tests := []struct {
+		name, declared, actual, text string
+	}{
+		{"cyrillic as latin", "iso-8859-1", "windows-1251", russianText},
+		{"koi8 as latin", "windows-1252", "koi8-r", russianText},
+		{"utf-8 as latin", "iso-8859-1", "utf-8", "Größe: Съешь же ещё этих"},
+		{"latin as utf-8", "utf-8", "windows-1252", "Grüße aus Köln"},
+		{"shift_jis as iso-2022-jp", "iso-2022-jp", "shift_jis", japaneseText},
+		{"big5 as gb2312", "gb2312", "big5", "我們的國家在這個時候有很多人來到這裡，他說這是一個好地方。"},
+		{"gb18030 as gb2312", "gb2312", "gb18030", "我们的国家€𠀀"},
+		{"ukrainian as koi8-r", "koi8-r", "koi8-u", "Ґанок і їжак, єнот і ґава на подвір'ї"},
+		{"cp1250 as iso-8859-2", "iso-8859-2", "windows-1250", "„Příliš žluťoučký kůň“ úpěl ďábelské ódy"},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			decoded, err := DecodeCharset(encodeString(t, test.actual, test.text), "text/plain; charset="+test.declared)
+			require.NoError(t, err)
+			require.Equal(t, test.text, string(decoded))
+		})
+	}
+}
+
+func TestDecodeCharsetKeepsDeclaration(t *testing.T) {
+	// Short and Latin texts are decoded with declared charset even when
+	// other charsets fit too.
+	tests := []struct{ declared, text string }{
+		{"iso-8859-1", "ÄËÖÜäëöü"},
+		{"windows-1252", "Ça coûte très cher à Zürich, n’est-ce pas?"},
+		{"windows-1250", "áäčéěô"},
+		{"windows-1251", russianText},
+		{"euc-jp", japaneseText},
+	}
+
+	for _, test := range tests {
+		decoded, err := DecodeCharset(encodeString(t, test.declared, test.text), "text/plain; charset="+test.declared)
+		require.NoError(t, err)
+		require.Equal(t, test.text, string(decoded), test.declared)
+	}
+}
+
+func TestDetectCharset(t *testing.T) {
+	tests := []struct{ charset, text string }{
+		{"utf-8", chineseText},
+		{"windows-1252", "Ça coûte très cher à Zürich, n’est-ce pas?"},
+		{"windows-1251", russianText},
+		{"koi8-r", russianText},
+		{"shift_jis", japaneseText},
+		{"euc-jp", japaneseText},
+		{"iso-2022-jp", japaneseText},
+		{"gb18030", chineseText},
+		{"big5", "我們的國家在這個時候有很多人來到這裡，他說這是一個好地方。"},
+		{"euc-kr", koreanText},
+	}
+
+	for _, test := range tests {
+		encoded := encodeString(t, test.charset, test.text)
+		require.Equal(t, test.charset, DetectCharset(encoded), test.text)
+
+		decoded, err := DecodeCharset(encoded, "")
+		require.NoError(t, err)
+		require.Equal(t, test.text, string(decoded), test.charset)
+	}
+}
+
+func TestDecodeHeaderDetectsRawCharset(t *testing.T) {
+	decoded, err := DecodeHeader(string(encodeString(t, "windows-1251", "Съешь же ещё этих мягких булок")))
+	require.NoError(t, err)
+	require.Equal(t, "Съешь же ещё этих мягких булок", decoded)
+
+	decoded, err = DecodeHeader("=?gb2312?B?" + base64.StdEncoding.EncodeToString(encodeString(t, "gb18030", "我们𠀀")) + "?=")
+	require.NoError(t, err)
+	require.Equal(t, "我们𠀀", decoded)
+}
+
+func TestGetEncodingAliases(t *testing.T) {
+	aliases := map[string]string{
+		"cp936":        "gbk",
+		"ms936":        "gbk",
+		"gb-18030":     "gb18030",
+		"x-big5":       "big5",
+		"jis":          "iso-2022-jp",
+		"cp50220":      "iso-2022-jp",
+		"mac-cyrillic": "x-mac-cyrillic",
+	}
+
+	for alias, expected := range aliases {
+		require.Equal(t, expected, canonicalCharset(alias), alias)
+	}
+}
+
+func TestDetectCharsetLongText(t *testing.T) {
+	text := strings.Repeat(russianText+"\n", 2*detectSampleSize/len(russianText))
+
+	decoded, err := DecodeCharset(encodeString(t, "koi8-r", text), "")
+	require.NoError(t, err)
+	require.Equal(t, text, string(decoded))
+}
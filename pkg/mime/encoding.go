@@ -18,8 +18,10 @@
 package pmmime
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime"
 	"mime/quotedprintable"
 	"regexp"
@@ -37,14 +39,15 @@ import (
 
 var wordDec = &mime.WordDecoder{
 	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
-		dec, err := selectDecoder(charset)
+		b, err := ioutil.ReadAll(input)
 		if err != nil {
 			return nil, err
 		}
-		if dec == nil { // utf-8
-			return input, nil
+		decoded, err := decodeWithCharset(b, charset)
+		if err != nil {
+			return nil, err
 		}
-		return dec.Reader(input), nil
+		return bytes.NewReader(decoded), nil
 	},
 }
 
@@ -126,10 +129,14 @@ func getEncoding(charset string) (enc encoding.Encoding, err error) {
 		preparsed = "euc-jp"
 	case "euckr", "ibm-euckr", "cp949":
 		preparsed = "euc-kr"
-	case "euccn", "ibm-euccn":
+	case "euccn", "ibm-euccn", "cp936", "ms936", "windows-936":
 		preparsed = "gbk"
-	case "zht16mswin950", "cp950":
+	case "gb-18030", "cp54936", "windows-54936":
+		preparsed = "gb18030"
+	case "zht16mswin950", "cp950", "x-big5", "big-5", "big-five", "bigfive":
 		preparsed = "big5"
+	case "jis", "cp50220", "cp50221", "cp50222":
+		preparsed = "iso-2022-jp"
 
 	case "csascii",
 		"ansi_x3.4-1968",
@@ -157,6 +164,8 @@ func getEncoding(charset string) (enc encoding.Encoding, err error) {
 
 	case "macroman":
 		preparsed = "macintosh"
+	case "mac-cyrillic", "maccyrillic", "x-mac-ukrainian":
+		preparsed = "x-mac-cyrillic"
 	}
 
 	enc, _ = htmlindex.Get(preparsed)
@@ -181,8 +190,15 @@ func selectDecoder(charset string) (decoder *encoding.Decoder, err error) {
 	return
 }
 
-// DecodeHeader if needed. Returns error if raw contains non-utf8 characters.
+// DecodeHeader if needed. Raw header with 8-bit characters which are not
+// utf8 is decoded with detected charset. Returns error if the result still
+// contains non-utf8 characters.
 func DecodeHeader(raw string) (decoded string, err error) {
+	if !utf8.ValidString(raw) {
+		if b, detectErr := decodeWithCharset([]byte(raw), DetectCharset([]byte(raw))); detectErr == nil {
+			raw = string(b)
+		}
+	}
 	if decoded, err = wordDec.DecodeHeader(raw); err != nil {
 		decoded = raw
 	}
@@ -198,9 +214,11 @@ func EncodeHeader(s string) string {
 }
 
 // DecodeCharset decodes the orginal using content type parameters.
+// If the declared charset does not fit the content, it uses its superset or
+// detected charset instead.
 // If the charset parameter is missing it checks that the content is valid utf8.
 // If it isn't, it checks if it's embedded in the html/xml.
-// If it isn't, it falls back to windows-1252.
+// If it isn't, it detects the charset, falling back to windows-1252.
 // It then reencodes it as utf-8.
 func DecodeCharset(original []byte, contentType string) ([]byte, error) {
 	// If the contentType itself is specified, use that.
@@ -211,36 +229,38 @@ func DecodeCharset(original []byte, contentType string) ([]byte, error) {
 		}
 
 		if charset, ok := params["charset"]; ok {
-			decoder, err := selectDecoder(charset)
+			decoded, err := decodeWithCharset(original, charset)
 			if err != nil {
 				return original, errors.Wrap(err, "unknown charset was specified")
 			}
 
-			return decoder.Bytes(original)
+			return decoded, nil
 		}
 	}
 
 	// The charset was not specified. First try utf8.
-	if utf8.Valid(original) {
+	if utf8.Valid(original) && !isISO2022JP(original) {
 		return original, nil
 	}
 
-	// encoding will be windows-1252 if it can't be determined properly.
+	// BOM or charset embedded in html/xml is certain.
 	encoding, name, certain := charset.DetermineEncoding(original, contentType)
 
 	if !certain {
-		logrus.WithField("encoding", name).Warn("Determined encoding but was not certain")
+		detected := detectCharset(original)
+		logrus.WithField("encoding", detected.name).Warn("Determined encoding but was not certain")
+		return detected.decoded, nil
 	}
 
 	// Reencode as UTF-8.
 	decoded, err := encoding.NewDecoder().Bytes(original)
 	if err != nil {
-		return original, errors.Wrap(err, "failed to decode as windows-1252")
+		return original, errors.Wrap(err, "failed to decode as "+name)
 	}
 
-	// If the decoded string is not valid utf8, it wasn't windows-1252, so give up.
+	// If the decoded string is not valid utf8, it wasn't the encoding, so give up.
 	if !utf8.Valid(decoded) {
-		return original, errors.Wrap(err, "failed to decode as windows-1252")
+		return original, errors.Errorf("failed to decode as %s", name)
 	}
 
 	return decoded, nil
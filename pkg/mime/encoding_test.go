@@ -112,6 +112,16 @@ func TestParseMediaType(t *testing.T) {
 			wantMediaType: "attachment",
 			wantParams:    map[string]string{"title": "smile"},
 		},
+		"SingleLineNoCharset": {
+			arg:           "attachment; filename*=''%C5%BElu%C5%A5ou%C4%8Dk%C3%BD.txt",
+			wantMediaType: "attachment",
+			wantParams:    map[string]string{"filename": "žluťoučký.txt"},
+		},
+		"MultiLineNoCharset": {
+			arg:           "attachment; filename*0*=''%C5%BElu%C5%A5; filename*1*=ou%C4%8Dk%C3%BD.txt",
+			wantMediaType: "attachment",
+			wantParams:    map[string]string{"filename": "žluťoučký.txt"},
+		},
 		"MultiLineBadEncoding": {
 			arg:           "attachment;\nfilename*0*=utf-8'%F0%9F%98%81;   title=smile;\nfilename*1*=%F0%9F%98%82;\nfilename*2=.txt",
 			wantMediaType: "attachment",
@@ -123,6 +133,24 @@ func TestParseMediaType(t *testing.T) {
 	}
 }
 
+func TestFormatMediaType(t *testing.T) {
+	a.Equal(t, `attachment; filename="file name.txt"`, FormatMediaType("attachment", map[string]string{"filename": "file name.txt"}))
+	a.Equal(t, "attachment; filename*=utf-8''%C5%BElu%C5%A5ou%C4%8Dk%C3%BD%20k%C5%AF%C5%88.txt", FormatMediaType("attachment", map[string]string{"filename": "žluťoučký kůň.txt"}))
+	a.Equal(t, "", FormatMediaType("attachment", map[string]string{"file name": "žluťoučký kůň.txt"}))
+
+	long := strings.Repeat("žluťoučký kůň ", 10) + "úpěl ďábelské ódy.txt"
+	formatted := FormatMediaType("application/pdf", map[string]string{"name": long, "x-mac-type": "PDF "})
+	a.True(t, strings.HasPrefix(formatted, `application/pdf; x-mac-type="PDF "; name*0*=utf-8''%C5%BElu`), formatted)
+	for _, section := range strings.Split(formatted, "; ")[2:] {
+		a.True(t, len(section) <= len("name*10*=utf-8''")+maxParamSectionLength, section)
+	}
+
+	mediaType, params, err := ParseMediaType(formatted)
+	a.NoError(t, err)
+	a.Equal(t, "application/pdf", mediaType)
+	a.Equal(t, map[string]string{"name": long, "x-mac-type": "PDF "}, params)
+}
+
 func TestGetEncoding(t *testing.T) {
 	// All MIME charsets with aliases can be found here:
 	// https://www.iana.org/assignments/character-sets/character-sets.xhtml
@@ -0,0 +1,271 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmmime
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Diagnostics are problems of a malformed message which lenient parsing
+// recovered from. They describe what was salvaged instead of failing.
+type Diagnostics []string
+
+// Add appends the problem unless d is nil (strict mode).
+func (d *Diagnostics) Add(format string, args ...interface{}) {
+	if d != nil {
+		*d = append(*d, fmt.Sprintf(format, args...))
+	}
+}
+
+// NormalizeLineEndings replaces bare CR and bare LF by CRLF.
+func NormalizeLineEndings(b []byte, diag *Diagnostics) []byte {
+	out := make([]byte, 0, len(b))
+	bare := 0
+
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == '\r' && i+1 < len(b) && b[i+1] == '\n':
+			out = append(out, '\r', '\n')
+			i++
+		case b[i] == '\r' || b[i] == '\n':
+			out = append(out, '\r', '\n')
+			bare++
+		default:
+			out = append(out, b[i])
+		}
+	}
+
+	if bare > 0 {
+		diag.Add("%d bare CR or LF line endings replaced by CRLF", bare)
+	}
+	return out
+}
+
+// NewLineEndingReader returns r with bare CR and bare LF replaced by CRLF
+// as NormalizeLineEndings does, without reading the whole input first. The
+// problem is added to diag when the first bare line ending is read.
+func NewLineEndingReader(r io.Reader, diag *Diagnostics) io.Reader {
+	return &lineEndingReader{r: bufio.NewReader(r), diag: diag}
+}
+
+type lineEndingReader struct {
+	r    *bufio.Reader
+	diag *Diagnostics
+
+	pendingLF bool
+	foundBare bool
+}
+
+func (lr *lineEndingReader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if lr.pendingLF {
+			p[n] = '\n'
+			n++
+			lr.pendingLF = false
+			continue
+		}
+
+		b, err := lr.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+
+		switch b {
+		case '\r':
+			if next, err := lr.r.Peek(1); err == nil && next[0] == '\n' {
+				_, _ = lr.r.ReadByte()
+			} else {
+				lr.addBare()
+			}
+			p[n] = '\r'
+			lr.pendingLF = true
+		case '\n':
+			lr.addBare()
+			p[n] = '\r'
+			lr.pendingLF = true
+		default:
+			p[n] = b
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (lr *lineEndingReader) addBare() {
+	if !lr.foundBare {
+		lr.foundBare = true
+		lr.diag.Add("bare CR or LF line endings replaced by CRLF")
+	}
+}
+
+// ReadHeader reads the header up to and including the empty line. Unlike
+// textproto, lines which are not valid fields are skipped, values which
+// are not valid UTF-8 are decoded as ISO-8859-1 and a missing empty line
+// at the end of input is accepted. Only read errors are returned.
+func ReadHeader(r *bufio.Reader, diag *Diagnostics) (textproto.MIMEHeader, error) {
+	h := textproto.MIMEHeader{}
+	var field string
+
+	addField := func() {
+		if field == "" {
+			return
+		}
+		colon := strings.IndexByte(field, ':')
+		key := strings.TrimRight(field[:colon], " \t")
+		value := strings.Trim(field[colon+1:], " \t\r\n")
+		if !utf8.ValidString(value) {
+			diag.Add("field %s is not valid UTF-8, decoded as ISO-8859-1", key)
+			value, _ = charmap.ISO8859_1.NewDecoder().String(value)
+		}
+		key = textproto.CanonicalMIMEHeaderKey(key)
+		h[key] = append(h[key], value)
+		field = ""
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return h, err
+		}
+
+		trimmed := strings.TrimRight(line, "\r\n")
+		switch {
+		case trimmed == "":
+			addField()
+			if err == io.EOF && line == "" {
+				diag.Add("header is not terminated by an empty line")
+			}
+			return h, nil
+		case trimmed[0] == ' ' || trimmed[0] == '\t':
+			if field != "" {
+				field += " " + strings.TrimLeft(trimmed, " \t")
+			} else {
+				diag.Add("continuation line without field skipped")
+			}
+		default:
+			addField()
+			if isValidFieldLine(trimmed) {
+				field = trimmed
+			} else {
+				diag.Add("malformed header line skipped: %q", trimmed)
+			}
+		}
+
+		if err == io.EOF {
+			addField()
+			diag.Add("header is not terminated by an empty line")
+			return h, nil
+		}
+	}
+}
+
+// isValidFieldLine returns whether the line starts with a field name made
+// of printable US-ASCII characters followed by colon (RFC 5322 section 2.2).
+func isValidFieldLine(line string) bool {
+	colon := strings.IndexByte(line, ':')
+	if colon <= 0 {
+		return false
+	}
+	for _, c := range []byte(strings.TrimRight(line[:colon], " \t")) {
+		if c <= ' ' || c >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// getMultipartPartsLenient splits the multipart body by the boundary lines.
+// Missing closing boundary is accepted and the last part ends with the
+// input. Body without any boundary is returned as a single text part.
+func getMultipartPartsLenient(r io.Reader, params map[string]string, diag *Diagnostics) (parts []io.Reader, headers []textproto.MIMEHeader, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	dashBoundary := []byte("--" + params["boundary"])
+	if params["boundary"] == "" || !bytes.Contains(body, dashBoundary) {
+		diag.Add("multipart boundary not found, body used as text part")
+		return []io.Reader{bytes.NewReader(body)}, []textproto.MIMEHeader{{"Content-Type": {"text/plain"}}}, nil
+	}
+
+	var part *bytes.Buffer
+	closed := false
+
+	addPart := func() error {
+		if part == nil {
+			return nil
+		}
+		content := bytes.TrimSuffix(bytes.TrimSuffix(part.Bytes(), []byte("\n")), []byte("\r"))
+		br := bufio.NewReader(bytes.NewReader(content))
+		h, err := ReadHeader(br, diag)
+		if err != nil {
+			return err
+		}
+		rest, err := ioutil.ReadAll(br)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, bytes.NewBuffer(rest))
+		headers = append(headers, h)
+		return nil
+	}
+
+	lines := bufio.NewReader(bytes.NewReader(body))
+	for !closed {
+		line, readErr := lines.ReadBytes('\n')
+		trimmed := bytes.TrimRight(line, " \t\r\n")
+
+		switch {
+		case bytes.Equal(trimmed, append(dashBoundary, '-', '-')):
+			if err = addPart(); err != nil {
+				return
+			}
+			part, closed = nil, true
+		case bytes.Equal(trimmed, dashBoundary):
+			if err = addPart(); err != nil {
+				return
+			}
+			part = &bytes.Buffer{}
+		case part != nil:
+			_, _ = part.Write(line)
+		}
+
+		if readErr != nil {
+			break
+		}
+	}
+
+	if !closed {
+		diag.Add("closing multipart boundary is missing")
+		if err = addPart(); err != nil {
+			return
+		}
+	}
+
+	return parts, headers, nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmmime
+
+import (
+	"bufio"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeLineEndings(t *testing.T) {
+	diag := Diagnostics{}
+	require.Equal(t, "a\r\nb\r\nc\r\nd", string(NormalizeLineEndings([]byte("a\r\nb\nc\rd"), &diag)))
+	require.Len(t, diag, 1)
+
+	diag = Diagnostics{}
+	require.Equal(t, "a\r\nb", string(NormalizeLineEndings([]byte("a\r\nb"), &diag)))
+	require.Empty(t, diag)
+}
+
+func TestLineEndingReader(t *testing.T) {
+	for _, input := range []string{"a\r\nb\nc\rd", "a\r\nb", "\r", "\n\n\r\r\n", ""} {
+		want := Diagnostics{}
+		expected := NormalizeLineEndings([]byte(input), &want)
+
+		diag := Diagnostics{}
+		// One byte buffer tests CRLF split across reads.
+		got, err := ioutil.ReadAll(iotest.OneByteReader(NewLineEndingReader(strings.NewReader(input), &diag)))
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(got), input)
+		require.Equal(t, len(want), len(diag), input)
+	}
+}
+
+func TestReadHeaderLenient(t *testing.T) {
+	diag := Diagnostics{}
+	r := bufio.NewReader(strings.NewReader("Subject: Hello\r\n world\r\nnot a field\r\nX-Bad Name: x\r\nX-Latin: caf\xe9\r\n\r\nbody"))
+
+	h, err := ReadHeader(r, &diag)
+	require.NoError(t, err)
+	require.Equal(t, "Hello world", h.Get("Subject"))
+	require.Equal(t, "café", h.Get("X-Latin"))
+	require.Len(t, h, 2)
+	require.Len(t, diag, 3)
+
+	body, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "body", string(body))
+}
+
+func TestReadHeaderWithoutEmptyLine(t *testing.T) {
+	diag := Diagnostics{}
+	h, err := ReadHeader(bufio.NewReader(strings.NewReader("Subject: Hello")), &diag)
+	require.NoError(t, err)
+	require.Equal(t, "Hello", h.Get("Subject"))
+	require.Len(t, diag, 1)
+}
+
+func TestGetMultipartPartsLenientMissingClosingBoundary(t *testing.T) {
+	body := "preamble\r\n--b\r\nContent-Type: text/plain\r\n\r\nfirst\r\n--b\r\nContent-Type: text/html\r\n\r\n<b>second</b>"
+
+	diag := Diagnostics{}
+	parts, headers, err := getMultipartPartsLenient(strings.NewReader(body), map[string]string{"boundary": "b"}, &diag)
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	require.Equal(t, "text/plain", headers[0].Get("Content-Type"))
+	require.Equal(t, "text/html", headers[1].Get("Content-Type"))
+
+	second, err := ioutil.ReadAll(parts[1])
+	require.NoError(t, err)
+	require.Equal(t, "<b>second</b>", string(second))
+	require.Equal(t, Diagnostics{"closing multipart boundary is missing"}, diag)
+}
+
+func TestGetMultipartPartsLenientWithoutBoundary(t *testing.T) {
+	diag := Diagnostics{}
+	parts, headers, err := getMultipartPartsLenient(strings.NewReader("just text"), map[string]string{"boundary": "b"}, &diag)
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	require.Equal(t, "text/plain", headers[0].Get("Content-Type"))
+	require.Len(t, diag, 1)
+}
@@ -20,8 +20,11 @@ package pmmime
 import (
 	"errors"
 	"fmt"
+	"mime"
+	"sort"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/sirupsen/logrus"
 )
@@ -114,6 +117,101 @@ func changeEncodingAndKeepLastParamDefinition(v string) (out string, err error)
 	return
 }
 
+// maxParamSectionLength is the maximal length of the encoded value of one
+// RFC2231 parameter section. Header values are not folded, so the long ones
+// have to be split to keep lines readable for all clients.
+const maxParamSectionLength = 60
+
+// FormatMediaType works like mime.FormatMediaType, but parameters with
+// non-ASCII characters or long values are written using RFC2231 (RFC5987)
+// extended notation with utf-8 charset, split into continuations
+// (filename*0*, filename*1*, ...) when needed.
+// Returns empty string if the media type or a parameter name is invalid.
+func FormatMediaType(mediaType string, params map[string]string) string {
+	plain := map[string]string{}
+	encoded := []string{}
+	for key, value := range params {
+		if key == "" || strings.IndexFunc(key, isNotTokenChar) != -1 {
+			return ""
+		}
+		if needs2231Encoding(value) {
+			encoded = append(encoded, key)
+		} else {
+			plain[key] = value
+		}
+	}
+
+	out := mime.FormatMediaType(mediaType, plain)
+	if out == "" {
+		return ""
+	}
+
+	sort.Strings(encoded)
+	for _, key := range encoded {
+		for _, section := range encode2231Continuations(strings.ToLower(key), params[key]) {
+			out += "; " + section
+		}
+	}
+	return out
+}
+
+func needs2231Encoding(value string) bool {
+	if len(value) > maxParamSectionLength {
+		return true
+	}
+	for _, r := range value {
+		if r < 0x20 || r >= 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// encode2231Continuations returns the sections of the parameter in RFC2231
+// extended notation. Characters are never split between sections.
+func encode2231Continuations(key, value string) []string {
+	sections := []string{}
+	section := ""
+	for len(value) > 0 {
+		_, size := utf8.DecodeRuneInString(value)
+		char := percent2231Escape(value[:size])
+		value = value[size:]
+
+		if section != "" && len(section)+len(char) > maxParamSectionLength {
+			sections = append(sections, section)
+			section = ""
+		}
+		section += char
+	}
+	sections = append(sections, section)
+
+	if len(sections) == 1 {
+		return []string{key + "*=utf-8''" + sections[0]}
+	}
+
+	for i := range sections {
+		if i == 0 {
+			sections[i] = "utf-8''" + sections[i]
+		}
+		sections[i] = fmt.Sprintf("%s*%d*=%s", key, i, sections[i])
+	}
+	return sections
+}
+
+// percent2231Escape escapes all bytes which are not RFC2231 attribute-char.
+func percent2231Escape(v string) string {
+	out := ""
+	for i := 0; i < len(v); i++ {
+		b := v[i]
+		if isTokenChar(rune(b)) && b != '*' && b != '\'' && b != '%' {
+			out += string(b)
+		} else {
+			out += fmt.Sprintf("%%%02X", b)
+		}
+	}
+	return out
+}
+
 func isFirstContinuation(key string) bool {
 	if idx := strings.Index(key, "*"); idx != -1 {
 		return key[idx:] == "*" || key[idx:] == "*0*"
@@ -143,26 +241,30 @@ func mergeContinuations(paramKey string, contMap map[string]string) (string, err
 			return "", err
 		}
 	} else {
-		for n := 0; ; n++ {
+		n := 0
+		for ; ; n++ {
 			contKey := fmt.Sprintf("%s*%d", paramKey, n)
-			contValue, isLast := contMap[contKey]
-			if !isLast {
+			contValue, isPlain := contMap[contKey]
+			if !isPlain {
 				var ok bool
-				contValue, ok = contMap[contKey+"*"]
-				if !ok {
-					return "", errors.New("not valid RFC2231 continuation")
+				if contValue, ok = contMap[contKey+"*"]; !ok {
+					break
 				}
 			}
 			if n == 0 {
-				if charset, value, err = get2231Charset(contValue); err != nil || charset == "" {
-					return "", err
+				// Plain first section has no charset.
+				if charset, value, err = get2231Charset(contValue); err != nil {
+					if !isPlain {
+						return "", err
+					}
+					value, err = contValue, nil
 				}
 			} else {
 				value += contValue
 			}
-			if isLast {
-				break
-			}
+		}
+		if n == 0 {
+			return "", errors.New("not valid RFC2231 continuation")
 		}
 	}
 
@@ -170,7 +272,11 @@ func mergeContinuations(paramKey string, contMap map[string]string) (string, err
 }
 
 // convertHexToUTF converts hex values string with charset to UTF8 in RFC2231 format.
+// RFC2231 allows to omit the charset; such values are assumed to be UTF8.
 func convertHexToUTF(charset, value string) (string, error) {
+	if charset == "" {
+		charset = "utf-8"
+	}
 	raw, err := percentHexUnescape(value)
 	if err != nil {
 		return "", err
@@ -291,7 +397,7 @@ func isTSpecial(r rune) bool {
 
 func percentHexEscape(raw []byte) (out string) {
 	for _, v := range raw {
-		out += fmt.Sprintf("%%%x", v)
+		out += fmt.Sprintf("%%%02X", v)
 	}
 	return
 }
@@ -52,6 +52,9 @@ func IsLeaf(h textproto.MIMEHeader) bool {
 // MIMEVisitor is main object to parse (visit) and process (accept) all parts of MIME message.
 type MimeVisitor struct {
 	target VisitAcceptor
+
+	// diag is set in lenient mode to collect recovered problems.
+	diag *Diagnostics
 }
 
 // Accept reads part recursively if needed.
@@ -61,7 +64,7 @@ func (mv *MimeVisitor) Accept(part io.Reader, h textproto.MIMEHeader, hasPlainSi
 		return
 	}
 
-	parentMediaType, params, err := getContentType(h)
+	parentMediaType, params, err := getContentTypeLenient(h, mv.diag)
 	if err != nil {
 		return
 	}
@@ -73,7 +76,7 @@ func (mv *MimeVisitor) Accept(part io.Reader, h textproto.MIMEHeader, hasPlainSi
 	if !IsLeaf(h) {
 		var multiparts []io.Reader
 		var multipartHeaders []textproto.MIMEHeader
-		if multiparts, multipartHeaders, err = GetMultipartParts(part, params); err != nil {
+		if multiparts, multipartHeaders, err = getMultipartParts(part, params, mv.diag); err != nil {
 			return
 		}
 		hasPlainChild := false
@@ -101,18 +104,36 @@ func (mv *MimeVisitor) Accept(part io.Reader, h textproto.MIMEHeader, hasPlainSi
 
 // NewMIMEVisitor returns a new mime visitor initialised with an acceptor.
 func NewMimeVisitor(targetAccepter VisitAcceptor) *MimeVisitor {
-	return &MimeVisitor{targetAccepter}
+	return &MimeVisitor{target: targetAccepter}
+}
+
+// NewLenientMimeVisitor returns a new mime visitor which recovers from
+// malformed multipart bodies and content types and adds the recovered
+// problems to diag.
+func NewLenientMimeVisitor(targetAccepter VisitAcceptor, diag *Diagnostics) *MimeVisitor {
+	return &MimeVisitor{target: targetAccepter, diag: diag}
 }
 
 func GetAllChildParts(part io.Reader, h textproto.MIMEHeader) (parts []io.Reader, headers []textproto.MIMEHeader, err error) {
-	mediaType, params, err := getContentType(h)
+	return getAllChildParts(part, h, nil)
+}
+
+// GetAllChildPartsLenient is GetAllChildParts which recovers from malformed
+// multipart bodies and content types and adds the problems to diag.
+func GetAllChildPartsLenient(part io.Reader, h textproto.MIMEHeader, diag *Diagnostics) (parts []io.Reader, headers []textproto.MIMEHeader, err error) {
+	return getAllChildParts(part, h, diag)
+}
+
+// getAllChildParts is lenient when diag is set.
+func getAllChildParts(part io.Reader, h textproto.MIMEHeader, diag *Diagnostics) (parts []io.Reader, headers []textproto.MIMEHeader, err error) {
+	mediaType, params, err := getContentTypeLenient(h, diag)
 	if err != nil {
 		return
 	}
 	if strings.HasPrefix(mediaType, "multipart/") {
 		var multiparts []io.Reader
 		var multipartHeaders []textproto.MIMEHeader
-		if multiparts, multipartHeaders, err = GetMultipartParts(part, params); err != nil {
+		if multiparts, multipartHeaders, err = getMultipartParts(part, params, diag); err != nil {
 			return
 		}
 		if strings.Contains(mediaType, "alternative") {
@@ -123,7 +144,7 @@ func GetAllChildParts(part io.Reader, h textproto.MIMEHeader) (parts []io.Reader
 			}
 			var childParts []io.Reader
 			var childHeaders []textproto.MIMEHeader
-			if childParts, childHeaders, err = GetAllChildParts(chosenPart, chosenHeader); err != nil {
+			if childParts, childHeaders, err = getAllChildParts(chosenPart, chosenHeader, diag); err != nil {
 				return
 			}
 			parts = append(parts, childParts...)
@@ -132,7 +153,7 @@ func GetAllChildParts(part io.Reader, h textproto.MIMEHeader) (parts []io.Reader
 			for i, p := range multiparts {
 				var childParts []io.Reader
 				var childHeaders []textproto.MIMEHeader
-				if childParts, childHeaders, err = GetAllChildParts(p, multipartHeaders[i]); err != nil {
+				if childParts, childHeaders, err = getAllChildParts(p, multipartHeaders[i], diag); err != nil {
 					return
 				}
 				parts = append(parts, childParts...)
@@ -169,6 +190,14 @@ func GetMultipartParts(r io.Reader, params map[string]string) (parts []io.Reader
 	return
 }
 
+// getMultipartParts is lenient when diag is set.
+func getMultipartParts(r io.Reader, params map[string]string, diag *Diagnostics) (parts []io.Reader, headers []textproto.MIMEHeader, err error) {
+	if diag != nil {
+		return getMultipartPartsLenient(r, params, diag)
+	}
+	return GetMultipartParts(r, params)
+}
+
 func pickAlternativePart(parts []io.Reader, headers []textproto.MIMEHeader) (part io.Reader, h textproto.MIMEHeader, err error) {
 
 	for i, h := range headers {
@@ -245,6 +274,16 @@ func getContentType(header textproto.MIMEHeader) (mediatype string, params map[s
 	return ParseMediaType(contentType)
 }
 
+// getContentTypeLenient is getContentType which, when diag is set, uses
+// text/plain instead of content type which cannot be parsed.
+func getContentTypeLenient(header textproto.MIMEHeader, diag *Diagnostics) (mediatype string, params map[string]string, err error) {
+	if mediatype, params, err = getContentType(header); err != nil && diag != nil {
+		diag.Add("invalid content type %q used as text/plain: %v", header.Get("Content-Type"), err)
+		return "text/plain", map[string]string{}, nil
+	}
+	return
+}
+
 // ===================== MIME Printer ===================================
 // Simply print resulting MIME tree into text form.
 // TODO move this to file mime_printer.go.
@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"errors"
 	"strings"
 
@@ -164,8 +165,8 @@ func ConstructAddress(headerEmail string, addressEmail string) string {
 }
 
 // GetAddresses requests all of current user addresses (without pagination).
-func (c *client) GetAddresses() (addresses AddressList, err error) {
-	req, err := c.NewRequest("GET", "/addresses", nil)
+func (c *client) GetAddresses(ctx context.Context) (addresses AddressList, err error) {
+	req, err := c.NewRequest(ctx, "GET", "/addresses", nil)
 	if err != nil {
 		return
 	}
@@ -178,14 +179,14 @@ func (c *client) GetAddresses() (addresses AddressList, err error) {
 	return res.Addresses, res.Err()
 }
 
-func (c *client) ReorderAddresses(addressIDs []string) (err error) {
+func (c *client) ReorderAddresses(ctx context.Context, addressIDs []string) (err error) {
 	var reqBody struct {
 		AddressIDs []string
 	}
 
 	reqBody.AddressIDs = addressIDs
 
-	req, err := c.NewJSONRequest("PUT", "/addresses/order", reqBody)
+	req, err := c.NewJSONRequest(ctx, "PUT", "/addresses/order", reqBody)
 	if err != nil {
 		return
 	}
@@ -195,7 +196,30 @@ func (c *client) ReorderAddresses(addressIDs []string) (err error) {
 		return
 	}
 
-	_, err = c.UpdateUser()
+	_, err = c.UpdateUser(ctx)
+
+	return
+}
+
+// UpdateAddressReq contains settings of the address shown to recipients.
+type UpdateAddressReq struct {
+	DisplayName string
+	Signature   string
+}
+
+// UpdateAddress changes the display name and the signature of the address.
+func (c *client) UpdateAddress(ctx context.Context, addressID string, settings *UpdateAddressReq) (err error) {
+	req, err := c.NewJSONRequest(ctx, "PUT", "/addresses/"+addressID, settings)
+	if err != nil {
+		return
+	}
+
+	var res Res
+	if err = c.DoJSON(req, &res); err != nil {
+		return
+	}
+
+	_, err = c.UpdateUser(ctx)
 
 	return
 }
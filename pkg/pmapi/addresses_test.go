@@ -18,6 +18,8 @@
 package pmapi
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"testing"
 )
@@ -82,3 +84,24 @@ func TestAddressList(t *testing.T) {
 		t.Errorf("Main() expected:\n%v\n but have:\n%v\n", testAddressList[1], addr)
 	}
 }
+
+func TestClient_UpdateAddress(t *testing.T) {
+	finish, c := newTestServerCallbacks(t,
+		func(tb testing.TB, w http.ResponseWriter, r *http.Request) string {
+			Ok(tb, checkMethodAndPath(r, "PUT", "/addresses/1"))
+
+			var req UpdateAddressReq
+			Ok(tb, json.NewDecoder(r.Body).Decode(&req))
+			Equals(tb, UpdateAddressReq{DisplayName: "Root", Signature: "<b>Root</b>"}, req)
+
+			return "/HTTP_200.json"
+		},
+		routeGetUsers,
+		routeGetAddresses,
+	)
+	defer finish()
+	c.uid = testUID
+	c.accessToken = testAccessToken
+
+	Ok(t, c.UpdateAddress(context.Background(), "1", &UpdateAddressReq{DisplayName: "Root", Signature: "<b>Root</b>"}))
+}
@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -122,6 +123,18 @@ func (a *Attachment) Decrypt(r io.Reader, kr *crypto.KeyRing) (decrypted io.Read
 	return decryptAttachment(kr, keyPackets, r)
 }
 
+// DecryptStream decrypts an attachment while it is being read, without
+// buffering it. When the attachment is not encrypted to kr,
+// openpgperrors.ErrKeyIncorrect is returned together with a reader of the
+// original encrypted data.
+func (a *Attachment) DecryptStream(r io.Reader, kr *crypto.KeyRing) (decrypted io.Reader, err error) {
+	keyPackets, err := base64.StdEncoding.DecodeString(a.KeyPackets)
+	if err != nil {
+		return
+	}
+	return decryptAttachmentStream(kr, keyPackets, r)
+}
+
 // Encrypt encrypts an attachment.
 func (a *Attachment) Encrypt(kr *crypto.KeyRing, att io.Reader) (encrypted io.Reader, err error) {
 	return encryptAttachment(kr, att, a.Name)
@@ -178,8 +191,8 @@ func writeAttachment(w *multipart.Writer, att *Attachment, r io.Reader, sig io.R
 // CreateAttachment uploads an attachment. It must be already encrypted and contain a MessageID.
 //
 // The returned created attachment contains the new attachment ID and its size.
-func (c *client) CreateAttachment(att *Attachment, r io.Reader, sig io.Reader) (created *Attachment, err error) {
-	req, w, err := c.NewMultipartRequest("POST", "/attachments")
+func (c *client) CreateAttachment(ctx context.Context, att *Attachment, r io.Reader, sig io.Reader) (created *Attachment, err error) {
+	req, w, err := c.NewMultipartRequest(ctx, "POST", "/attachments")
 	if err != nil {
 		return
 	}
@@ -211,9 +224,9 @@ type UpdateAttachmentSignatureReq struct {
 	Signature string
 }
 
-func (c *client) UpdateAttachmentSignature(attachmentID, signature string) (err error) {
+func (c *client) UpdateAttachmentSignature(ctx context.Context, attachmentID, signature string) (err error) {
 	updateReq := &UpdateAttachmentSignatureReq{signature}
-	req, err := c.NewJSONRequest("PUT", "/attachments/"+attachmentID+"/signature", updateReq)
+	req, err := c.NewJSONRequest(ctx, "PUT", "/attachments/"+attachmentID+"/signature", updateReq)
 	if err != nil {
 		return
 	}
@@ -227,8 +240,8 @@ func (c *client) UpdateAttachmentSignature(attachmentID, signature string) (err
 }
 
 // DeleteAttachment removes an attachment. message is the message ID, att is the attachment ID.
-func (c *client) DeleteAttachment(attID string) (err error) {
-	req, err := c.NewRequest("DELETE", "/attachments/"+attID, nil)
+func (c *client) DeleteAttachment(ctx context.Context, attID string) (err error) {
+	req, err := c.NewRequest(ctx, "DELETE", "/attachments/"+attID, nil)
 	if err != nil {
 		return
 	}
@@ -243,13 +256,13 @@ func (c *client) DeleteAttachment(attID string) (err error) {
 }
 
 // GetAttachment gets an attachment's content. The returned data is encrypted.
-func (c *client) GetAttachment(id string) (att io.ReadCloser, err error) {
+func (c *client) GetAttachment(ctx context.Context, id string) (att io.ReadCloser, err error) {
 	if id == "" {
 		err = errors.New("pmapi: cannot get an attachment with an empty id")
 		return
 	}
 
-	req, err := c.NewRequest("GET", "/attachments/"+id, nil)
+	req, err := c.NewRequest(ctx, "GET", "/attachments/"+id, nil)
 	if err != nil {
 		return
 	}
@@ -19,6 +19,7 @@ package pmapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -31,7 +32,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	pmmime "github.com/ProtonMail/proton-bridge/pkg/mime"
+	openpgperrors "golang.org/x/crypto/openpgp/errors"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -141,7 +144,7 @@ func TestClient_CreateAttachment(t *testing.T) {
 	defer s.Close()
 
 	r := strings.NewReader(testAttachmentCleartext) // In reality, this thing is encrypted
-	created, err := c.CreateAttachment(testAttachment, r, strings.NewReader(""))
+	created, err := c.CreateAttachment(context.Background(), testAttachment, r, strings.NewReader(""))
 	if err != nil {
 		t.Fatal("Expected no error while creating attachment, got:", err)
 	}
@@ -164,7 +167,7 @@ func TestClient_DeleteAttachment(t *testing.T) {
 	}))
 	defer s.Close()
 
-	err := c.DeleteAttachment(testAttachment.ID)
+	err := c.DeleteAttachment(context.Background(), testAttachment.ID)
 	if err != nil {
 		t.Fatal("Expected no error while deleting attachment, got:", err)
 	}
@@ -178,7 +181,7 @@ func TestClient_GetAttachment(t *testing.T) {
 	}))
 	defer s.Close()
 
-	r, err := c.GetAttachment(testAttachment.ID)
+	r, err := c.GetAttachment(context.Background(), testAttachment.ID)
 	if err != nil {
 		t.Fatal("Expected no error while getting attachment, got:", err)
 	}
@@ -208,12 +211,52 @@ func TestAttachment_Encrypt(t *testing.T) {
 	decryptAndCheck(t, dataEnc)
 }
 
+func TestAttachment_EncryptLarge(t *testing.T) {
+	data := make([]byte, 3*attachmentEncryptChunk+123)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	r, err := testAttachment.Encrypt(testPublicKeyRing, bytes.NewReader(data))
+	assert.Nil(t, err)
+
+	// Encrypted data can be decrypted while it is being read.
+	decrypted, err := testAttachment.DecryptStream(r, testPrivateKeyRing)
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(decrypted)
+	assert.Nil(t, err)
+	assert.Equal(t, data, b)
+}
+
 func TestAttachment_Decrypt(t *testing.T) {
 	dataBytes, _ := base64.StdEncoding.DecodeString(testAttachmentEncrypted)
 	dataReader := bytes.NewBuffer(dataBytes)
 	decryptAndCheck(t, dataReader)
 }
 
+func TestAttachment_DecryptStream(t *testing.T) {
+	dataBytes, _ := base64.StdEncoding.DecodeString(testAttachmentEncrypted)
+	r, err := testAttachment.DecryptStream(bytes.NewBuffer(dataBytes), testPrivateKeyRing)
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, testAttachmentCleartext, string(b))
+}
+
+func TestAttachment_DecryptStreamWrongKey(t *testing.T) {
+	wrongKey, err := crypto.GenerateKey("wrong", "wrong@pm.me", "x25519", 0)
+	assert.Nil(t, err)
+	wrongKeyRing, err := crypto.NewKeyRing(wrongKey)
+	assert.Nil(t, err)
+
+	dataBytes, _ := base64.StdEncoding.DecodeString(testAttachmentEncrypted)
+	r, err := testAttachment.DecryptStream(bytes.NewBuffer(dataBytes), wrongKeyRing)
+	assert.Equal(t, openpgperrors.ErrKeyIncorrect, err)
+	b, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, dataBytes, b)
+}
+
 func decryptAndCheck(t *testing.T, data io.Reader) {
 	r, err := testAttachment.Decrypt(data, testPrivateKeyRing)
 	assert.Nil(t, err)
@@ -18,16 +18,20 @@
 package pmapi
 
 import (
+	"context"
 	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 
 	"github.com/ProtonMail/proton-bridge/pkg/srp"
 )
 
+const passwordAuthVersion = 4
+
 var ErrBad2FACode = errors.New("incorrect 2FA code")
 var ErrBad2FACodeTryAgain = errors.New("incorrect 2FA code: please try again")
 
@@ -49,10 +53,26 @@ type TwoFactorInfo struct {
 	U2F     U2FInfo
 }
 
+// Bits of TwoFactorInfo.Enabled.
+const (
+	twoFactorTOTP = 1
+	twoFactorU2F  = 2
+)
+
 func (twoFactor *TwoFactorInfo) hasTwoFactor() bool {
 	return twoFactor.Enabled > 0
 }
 
+// HasTOTP returns whether the code from authenticator app can be used as second factor.
+func (twoFactor *TwoFactorInfo) HasTOTP() bool {
+	return twoFactor != nil && twoFactor.Enabled&twoFactorTOTP != 0
+}
+
+// HasU2F returns whether the account has a security key (U2F/FIDO2) as second factor.
+func (twoFactor *TwoFactorInfo) HasU2F() bool {
+	return twoFactor != nil && twoFactor.Enabled&twoFactorU2F != 0
+}
+
 // AuthInfo contains data used when authenticating a user. It should be
 // provided to Client.Auth(). Each AuthInfo can be used for only one login attempt.
 type AuthInfo struct {
@@ -215,12 +235,12 @@ func (c *client) sendAuth(auth *Auth) {
 }
 
 // AuthInfo gets authentication info for a user.
-func (c *client) AuthInfo(username string) (info *AuthInfo, err error) {
+func (c *client) AuthInfo(ctx context.Context, username string) (info *AuthInfo, err error) {
 	infoReq := &AuthInfoReq{
 		Username: username,
 	}
 
-	req, err := c.NewJSONRequest("POST", "/auth/info", infoReq)
+	req, err := c.NewJSONRequest(ctx, "POST", "/auth/info", infoReq)
 	if err != nil {
 		return
 	}
@@ -250,7 +270,7 @@ func srpProofsFromInfo(info *AuthInfo, username, password string, fallbackVersio
 	return
 }
 
-func (c *client) tryAuth(username, password string, info *AuthInfo, fallbackVersion int) (res *AuthRes, err error) {
+func (c *client) tryAuth(ctx context.Context, username, password string, info *AuthInfo, fallbackVersion int) (res *AuthRes, err error) {
 	proofs, err := srpProofsFromInfo(info, username, password, fallbackVersion)
 	if err != nil {
 		return
@@ -263,7 +283,7 @@ func (c *client) tryAuth(username, password string, info *AuthInfo, fallbackVers
 		SRPSession:      info.srpSession,
 	}
 
-	req, err := c.NewJSONRequest("POST", "/auth", authReq)
+	req, err := c.NewJSONRequest(ctx, "POST", "/auth", authReq)
 	if err != nil {
 		return
 	}
@@ -290,29 +310,29 @@ func (c *client) tryAuth(username, password string, info *AuthInfo, fallbackVers
 	return res, err
 }
 
-func (c *client) tryFullAuth(username, password string, fallbackVersion int) (info *AuthInfo, authRes *AuthRes, err error) {
-	info, err = c.AuthInfo(username)
+func (c *client) tryFullAuth(ctx context.Context, username, password string, fallbackVersion int) (info *AuthInfo, authRes *AuthRes, err error) {
+	info, err = c.AuthInfo(ctx, username)
 	if err != nil {
 		return
 	}
-	authRes, err = c.tryAuth(username, password, info, fallbackVersion)
+	authRes, err = c.tryAuth(ctx, username, password, info, fallbackVersion)
 	return
 }
 
 // Auth will authenticate a user.
-func (c *client) Auth(username, password string, info *AuthInfo) (auth *Auth, err error) {
+func (c *client) Auth(ctx context.Context, username, password string, info *AuthInfo) (auth *Auth, err error) {
 	if info == nil {
-		if info, err = c.AuthInfo(username); err != nil {
+		if info, err = c.AuthInfo(ctx, username); err != nil {
 			return
 		}
 	}
 
-	authRes, err := c.tryAuth(username, password, info, 2)
+	authRes, err := c.tryAuth(ctx, username, password, info, 2)
 	if err != nil && info.version == 0 && srp.CleanUserName(username) != strings.ToLower(username) {
-		info, authRes, err = c.tryFullAuth(username, password, 1)
+		info, authRes, err = c.tryFullAuth(ctx, username, password, 1)
 	}
 	if err != nil && info.version == 0 {
-		_, authRes, err = c.tryFullAuth(username, password, 0)
+		_, authRes, err = c.tryFullAuth(ctx, username, password, 0)
 	}
 	if err != nil {
 		return
@@ -326,12 +346,12 @@ func (c *client) Auth(username, password string, info *AuthInfo) (auth *Auth, er
 
 // Auth2FA will authenticate a user into full scope.
 // `Auth` struct contains method `HasTwoFactor` deciding whether this has to be done.
-func (c *client) Auth2FA(twoFactorCode string, auth *Auth) (*Auth2FA, error) {
+func (c *client) Auth2FA(ctx context.Context, twoFactorCode string, auth *Auth) (*Auth2FA, error) {
 	auth2FAReq := &Auth2FAReq{
 		TwoFactorCode: twoFactorCode,
 	}
 
-	req, err := c.NewJSONRequest("POST", "/auth/2fa", auth2FAReq)
+	req, err := c.NewJSONRequest(ctx, "POST", "/auth/2fa", auth2FAReq)
 	if err != nil {
 		return nil, err
 	}
@@ -356,7 +376,7 @@ func (c *client) Auth2FA(twoFactorCode string, auth *Auth) (*Auth2FA, error) {
 }
 
 // AuthRefresh will refresh an expired access token.
-func (c *client) AuthRefresh(uidAndRefreshToken string) (auth *Auth, err error) {
+func (c *client) AuthRefresh(ctx context.Context, uidAndRefreshToken string) (auth *Auth, err error) {
 	c.refreshLocker.Lock()
 	defer c.refreshLocker.Unlock()
 
@@ -382,7 +402,7 @@ func (c *client) AuthRefresh(uidAndRefreshToken string) (auth *Auth, err error)
 	// UID must be set for `x-pm-uid` header field, see backend-communication#11
 	c.uid = split[0]
 
-	req, err := c.NewJSONRequest("POST", "/auth/refresh", refreshReq)
+	req, err := c.NewJSONRequest(ctx, "POST", "/auth/refresh", refreshReq)
 	if err != nil {
 		return
 	}
@@ -408,13 +428,13 @@ func (c *client) AuthRefresh(uidAndRefreshToken string) (auth *Auth, err error)
 	return auth, err
 }
 
-func (c *client) AuthSalt() (string, error) {
-	salts, err := c.GetKeySalts()
+func (c *client) AuthSalt(ctx context.Context) (string, error) {
+	salts, err := c.GetKeySalts(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	if _, err := c.CurrentUser(); err != nil {
+	if _, err := c.CurrentUser(ctx); err != nil {
 		return "", err
 	}
 
@@ -427,14 +447,75 @@ func (c *client) AuthSalt() (string, error) {
 	return "", errors.New("no matching salt found")
 }
 
+// AuthModulus holds a signed SRP modulus which can be used to set up a new password verifier.
+type AuthModulus struct {
+	Modulus   string
+	ModulusID string
+}
+
+type AuthModulusRes struct {
+	Res
+	AuthModulus
+}
+
+// AuthModulus gets a new signed SRP modulus from the API.
+func (c *client) AuthModulus(ctx context.Context) (*AuthModulus, error) {
+	req, err := c.NewRequest(ctx, "GET", "/auth/modulus", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res AuthModulusRes
+	if err := c.DoJSON(req, &res); err != nil {
+		return nil, err
+	}
+
+	return &res.AuthModulus, res.Err()
+}
+
+// PasswordAuth holds the SRP verifier of a password, e.g. the one protecting
+// a message sent encrypted to outside recipients.
+type PasswordAuth struct {
+	Version   int
+	ModulusID string
+	Salt      string
+	Verifier  string
+}
+
+// NewPasswordAuth generates a new salt and an SRP verifier of the password using the given modulus.
+func NewPasswordAuth(password string, modulus *AuthModulus) (*PasswordAuth, error) {
+	salt := make([]byte, 10)
+	if _, err := io.ReadFull(srp.RandReader, salt); err != nil {
+		return nil, err
+	}
+	encodedSalt := base64.StdEncoding.EncodeToString(salt)
+
+	srpAuth, err := srp.NewSrpAuth(passwordAuthVersion, "", password, encodedSalt, modulus.Modulus, "")
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := srpAuth.GenerateVerifier(2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasswordAuth{
+		Version:   passwordAuthVersion,
+		ModulusID: modulus.ModulusID,
+		Salt:      encodedSalt,
+		Verifier:  base64.StdEncoding.EncodeToString(verifier),
+	}, nil
+}
+
 // Logout instructs the client manager to log this client out.
 func (c *client) Logout() {
 	c.cm.LogoutClient(c.userID)
 }
 
 // DeleteAuth deletes the API session.
-func (c *client) DeleteAuth() (err error) {
-	req, err := c.NewRequest("DELETE", "/auth", nil)
+func (c *client) DeleteAuth(ctx context.Context) (err error) {
+	req, err := c.NewRequest(ctx, "DELETE", "/auth", nil)
 	if err != nil {
 		return
 	}
@@ -18,6 +18,8 @@
 package pmapi
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"math/rand"
 	"net/http"
@@ -113,7 +115,7 @@ func TestClient_AuthInfo(t *testing.T) {
 	)
 	defer finish()
 
-	info, err := c.AuthInfo(testCurrentUser.Name)
+	info, err := c.AuthInfo(context.Background(), testCurrentUser.Name)
 	Ok(t, err)
 	Equals(t, testAuthInfo, info)
 }
@@ -134,7 +136,7 @@ func TestClient_Auth(t *testing.T) {
 	)
 	defer finish()
 
-	auth, err := c.Auth(testUsername, testAPIPassword, testAuthInfo)
+	auth, err := c.Auth(context.Background(), testUsername, testAPIPassword, testAuthInfo)
 	r.Nil(t, err)
 
 	exp := &Auth{}
@@ -144,6 +146,43 @@ func TestClient_Auth(t *testing.T) {
 	a.Equal(t, exp, auth)
 }
 
+func TestClient_AuthModulus(t *testing.T) {
+	finish, c := newTestServerCallbacks(t,
+		func(tb testing.TB, w http.ResponseWriter, r *http.Request) string {
+			Ok(t, checkMethodAndPath(r, "GET", "/auth/modulus"))
+			return "/auth/modulus/get_response.json"
+		},
+	)
+	defer finish()
+
+	modulus, err := c.AuthModulus(context.Background())
+	Ok(t, err)
+	Equals(t, testAuthInfo.modulus, modulus.Modulus)
+	Equals(t, "Oq_JB_IkrOx5WlpxzlRPocN3_NhJ80V7DGav77eRtSDkOtLxW2jfI3nUpEqANGpboOyN-GuzEFXadlpxgVp7_g==", modulus.ModulusID)
+}
+
+func TestNewPasswordAuth(t *testing.T) {
+	modulus := &AuthModulus{Modulus: testAuthInfo.modulus, ModulusID: "modulusID"}
+
+	auth, err := NewPasswordAuth("secret", modulus)
+	Ok(t, err)
+	Equals(t, passwordAuthVersion, auth.Version)
+	Equals(t, "modulusID", auth.ModulusID)
+
+	salt, err := base64.StdEncoding.DecodeString(auth.Salt)
+	Ok(t, err)
+	Equals(t, 10, len(salt))
+
+	verifier, err := base64.StdEncoding.DecodeString(auth.Verifier)
+	Ok(t, err)
+	Equals(t, 256, len(verifier))
+
+	other, err := NewPasswordAuth("secret", modulus)
+	Ok(t, err)
+	Assert(t, other.Salt != auth.Salt, "salt should be random")
+	Assert(t, other.Verifier != auth.Verifier, "verifier should depend on salt")
+}
+
 func TestClient_Auth2FA(t *testing.T) {
 	finish, c := newTestServerCallbacks(t,
 		func(tb testing.TB, w http.ResponseWriter, r *http.Request) string {
@@ -160,7 +199,7 @@ func TestClient_Auth2FA(t *testing.T) {
 
 	c.uid = testUID
 	c.accessToken = testAccessToken
-	auth2FA, err := c.Auth2FA(testAuth2FAReq.TwoFactorCode, testAuth)
+	auth2FA, err := c.Auth2FA(context.Background(), testAuth2FAReq.TwoFactorCode, testAuth)
 	Ok(t, err)
 
 	Equals(t, testAuth2FA, auth2FA)
@@ -182,7 +221,7 @@ func TestClient_Auth2FA_Fail(t *testing.T) {
 
 	c.uid = testUID
 	c.accessToken = testAccessToken
-	_, err := c.Auth2FA(testAuth2FAReq.TwoFactorCode, testAuth)
+	_, err := c.Auth2FA(context.Background(), testAuth2FAReq.TwoFactorCode, testAuth)
 	Equals(t, ErrBad2FACode, err)
 }
 
@@ -202,10 +241,25 @@ func TestClient_Auth2FA_Retry(t *testing.T) {
 
 	c.uid = testUID
 	c.accessToken = testAccessToken
-	_, err := c.Auth2FA(testAuth2FAReq.TwoFactorCode, testAuth)
+	_, err := c.Auth2FA(context.Background(), testAuth2FAReq.TwoFactorCode, testAuth)
 	Equals(t, ErrBad2FACodeTryAgain, err)
 }
 
+func TestTwoFactorInfo_Methods(t *testing.T) {
+	var none *TwoFactorInfo
+	Assert(t, !none.HasTOTP() && !none.HasU2F(), "nil info has no method")
+
+	for enabled, want := range map[int][2]bool{
+		0: {false, false},
+		1: {true, false},
+		2: {false, true},
+		3: {true, true},
+	} {
+		info := &TwoFactorInfo{Enabled: enabled}
+		Equals(t, want, [2]bool{info.HasTOTP(), info.HasU2F()})
+	}
+}
+
 func TestClient_Unlock(t *testing.T) {
 	finish, c := newTestServerCallbacks(t,
 		routeGetUsers,
@@ -215,16 +269,16 @@ func TestClient_Unlock(t *testing.T) {
 	c.uid = testUID
 	c.accessToken = testAccessToken
 
-	err := c.Unlock([]byte("wrong"))
+	err := c.Unlock(context.Background(), []byte("wrong"))
 	a.Error(t, err, "expected error, pasword is wrong")
 
-	err = c.Unlock([]byte(testMailboxPassword))
+	err = c.Unlock(context.Background(), []byte(testMailboxPassword))
 	a.Nil(t, err)
 	a.Equal(t, testUID, c.uid)
 	a.Equal(t, testAccessToken, c.accessToken)
 
 	// second try should not fail because there is an unlocked key already
-	err = c.Unlock([]byte("wrong"))
+	err = c.Unlock(context.Background(), []byte("wrong"))
 	a.Nil(t, err)
 }
 
@@ -237,7 +291,7 @@ func TestClient_Unlock_EncPrivKey(t *testing.T) {
 	c.uid = testUID
 	c.accessToken = testAccessToken
 
-	err := c.Unlock([]byte(testMailboxPassword))
+	err := c.Unlock(context.Background(), []byte(testMailboxPassword))
 	Ok(t, err)
 	Equals(t, testUID, c.uid)
 	Equals(t, testAccessToken, c.accessToken)
@@ -263,7 +317,7 @@ func TestClient_AuthRefresh(t *testing.T) {
 	c.uid = "" // Testing that we always send correct `x-pm-uid`.
 	c.accessToken = "oldToken"
 
-	auth, err := c.AuthRefresh(testUID + ":" + testRefreshToken)
+	auth, err := c.AuthRefresh(context.Background(), testUID+":"+testRefreshToken)
 	Ok(t, err)
 	Equals(t, testUID, c.uid)
 
@@ -297,7 +351,7 @@ func TestClient_AuthRefresh_HasUID(t *testing.T) {
 	c.uid = testUID
 	c.accessToken = "oldToken"
 
-	auth, err := c.AuthRefresh(testUID + ":" + testRefreshToken)
+	auth, err := c.AuthRefresh(context.Background(), testUID+":"+testRefreshToken)
 	Ok(t, err)
 
 	exp := &Auth{}
@@ -348,7 +402,7 @@ func TestClient_DoUnauthorized(t *testing.T) {
 	c.accessToken = testAccessTokenOld
 	c.cm.tokens[c.userID] = testUID + ":" + testRefreshToken
 
-	req, err := c.NewRequest("GET", "/", nil)
+	req, err := c.NewRequest(context.Background(), "GET", "/", nil)
 	Ok(t, err)
 
 	res, err := c.Do(req, true)
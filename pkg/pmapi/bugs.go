@@ -19,6 +19,7 @@ package pmapi
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -131,7 +132,7 @@ func writeMultipartReport(w *multipart.Writer, rep *ReportReq) error { // nolint
 }
 
 // Report sends request as json or multipart (if has attachment).
-func (c *client) Report(rep ReportReq) (err error) {
+func (c *client) Report(ctx context.Context, rep ReportReq) (err error) {
 	rep.Client = c.cm.config.ClientID
 	rep.ClientVersion = c.cm.config.AppVersion
 	rep.ClientType = EmailClientType
@@ -139,9 +140,9 @@ func (c *client) Report(rep ReportReq) (err error) {
 	var req *http.Request
 	var w *MultipartWriter
 	if len(rep.Attachments) > 0 {
-		req, w, err = c.NewMultipartRequest("POST", "/reports/bug")
+		req, w, err = c.NewMultipartRequest(ctx, "POST", "/reports/bug")
 	} else {
-		req, err = c.NewJSONRequest("POST", "/reports/bug", rep)
+		req, err = c.NewJSONRequest(ctx, "POST", "/reports/bug", rep)
 	}
 	if err != nil {
 		return
@@ -174,7 +175,7 @@ func (c *client) Report(rep ReportReq) (err error) {
 }
 
 // ReportCrash is old. Use sentry instead.
-func (c *client) ReportCrash(stacktrace string) (err error) {
+func (c *client) ReportCrash(ctx context.Context, stacktrace string) (err error) {
 	crashReq := ReportReq{
 		Client:        c.cm.config.ClientID,
 		ClientVersion: c.cm.config.AppVersion,
@@ -182,7 +183,7 @@ func (c *client) ReportCrash(stacktrace string) (err error) {
 		OS:            runtime.GOOS,
 		Debug:         stacktrace,
 	}
-	req, err := c.NewJSONRequest("POST", "/reports/crash", crashReq)
+	req, err := c.NewJSONRequest(ctx, "POST", "/reports/crash", crashReq)
 	if err != nil {
 		return
 	}
@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -95,7 +96,7 @@ func TestClient_BugReportWithAttachment(t *testing.T) {
 	rep := testBugReportReq
 	rep.AddAttachment("log", "last.log", strings.NewReader(testAttachmentJSON))
 
-	Ok(t, c.Report(rep))
+	Ok(t, c.Report(context.Background(), rep))
 }
 
 func TestClient_BugReport(t *testing.T) {
@@ -123,7 +124,7 @@ func TestClient_BugReport(t *testing.T) {
 		Email:       testBugReportReq.Email,
 	}
 
-	Ok(t, c.Report(r))
+	Ok(t, c.Report(context.Background(), r))
 }
 
 func TestClient_BugsCrash(t *testing.T) {
@@ -141,5 +142,5 @@ func TestClient_BugsCrash(t *testing.T) {
 	c.uid = testUID
 	c.accessToken = testAccessToken
 
-	Ok(t, c.ReportCrash(testBugsCrashReq.Debug))
+	Ok(t, c.ReportCrash(context.Background(), testBugsCrashReq.Debug))
 }
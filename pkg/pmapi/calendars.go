@@ -0,0 +1,298 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"context"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/pkg/errors"
+)
+
+// Calendar is a calendar of the user.
+type Calendar struct {
+	ID          string
+	Name        string
+	Description string
+	Color       string
+	Display     int
+	Flags       int
+}
+
+// CalendarEvent is an event of a calendar. Properties of the event are split
+// into several cards which can be cleartext, signed or encrypted (see Card).
+type CalendarEvent struct {
+	ID                string
+	UID               string
+	CalendarID        string
+	SharedEventID     string
+	CreateTime        int64
+	ModifyTime        int64
+	StartTime         int64
+	EndTime           int64
+	Author            string
+	SharedKeyPacket   string
+	SharedEvents      []Card
+	CalendarKeyPacket string
+	CalendarEvents    []Card
+}
+
+// CalendarEventsFilter restricts listed events to the given time range.
+// Start and End are unix timestamps; zero means no limit.
+type CalendarEventsFilter struct {
+	Start    int64
+	End      int64
+	Page     int
+	PageSize int
+}
+
+func (filter *CalendarEventsFilter) urlValues() url.Values {
+	v := url.Values{}
+	if filter == nil {
+		return v
+	}
+	if filter.Start != 0 {
+		v.Set("Start", strconv.FormatInt(filter.Start, 10))
+	}
+	if filter.End != 0 {
+		v.Set("End", strconv.FormatInt(filter.End, 10))
+	}
+	if filter.Page != 0 {
+		v.Set("Page", strconv.Itoa(filter.Page))
+	}
+	if filter.PageSize != 0 {
+		v.Set("PageSize", strconv.Itoa(filter.PageSize))
+	}
+	return v
+}
+
+type CalendarsListRes struct {
+	Res
+	Calendars []*Calendar
+}
+
+// ListCalendars lists all calendars of the user.
+func (c *client) ListCalendars(ctx context.Context) (calendars []*Calendar, err error) {
+	req, err := c.NewRequest(ctx, "GET", "/calendar/v1", nil)
+	if err != nil {
+		return
+	}
+
+	var res CalendarsListRes
+	if err = c.DoJSON(req, &res); err != nil {
+		return
+	}
+
+	calendars, err = res.Calendars, res.Err()
+	return
+}
+
+type CalendarEventsListRes struct {
+	Res
+	Events []*CalendarEvent
+}
+
+// ListCalendarEvents lists events of the calendar matching the filter.
+func (c *client) ListCalendarEvents(ctx context.Context, calendarID string, filter *CalendarEventsFilter) (events []*CalendarEvent, err error) {
+	path := "/calendar/v1/" + calendarID + "/events"
+	if query := filter.urlValues().Encode(); query != "" {
+		path += "?" + query
+	}
+
+	req, err := c.NewRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return
+	}
+
+	var res CalendarEventsListRes
+	if err = c.DoJSON(req, &res); err != nil {
+		return
+	}
+
+	events, err = res.Events, res.Err()
+	return
+}
+
+type CalendarEventRes struct {
+	Res
+	Event *CalendarEvent
+}
+
+// GetCalendarEvent gets the event of the calendar by its ID.
+func (c *client) GetCalendarEvent(ctx context.Context, calendarID, eventID string) (event *CalendarEvent, err error) {
+	req, err := c.NewRequest(ctx, "GET", "/calendar/v1/"+calendarID+"/events/"+eventID, nil)
+	if err != nil {
+		return
+	}
+
+	var res CalendarEventRes
+	if err = c.DoJSON(req, &res); err != nil {
+		return
+	}
+
+	event, err = res.Event, res.Err()
+	return
+}
+
+type calendarKeysRes struct {
+	Res
+	Keys PMKeys
+}
+
+type calendarMemberPassphrase struct {
+	MemberID   string
+	Passphrase string
+	Signature  string
+}
+
+type calendarPassphraseRes struct {
+	Res
+	Passphrase struct {
+		ID                string
+		MemberPassphrases []calendarMemberPassphrase
+	}
+}
+
+// KeyRingForCalendarID returns the unlocked keyring of the calendar.
+// Calendar keys are locked by a passphrase which is encrypted to the address
+// keys of the calendar members; therefore the client has to be unlocked first.
+func (c *client) KeyRingForCalendarID(ctx context.Context, calendarID string) (kr *crypto.KeyRing, err error) {
+	passphrase, err := c.getCalendarPassphrase(ctx, calendarID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get calendar passphrase")
+	}
+	defer func() {
+		for i := range passphrase {
+			passphrase[i] = 0
+		}
+	}()
+
+	req, err := c.NewRequest(ctx, "GET", "/calendar/v1/"+calendarID+"/keys", nil)
+	if err != nil {
+		return
+	}
+
+	var res calendarKeysRes
+	if err = c.DoJSON(req, &res); err != nil {
+		return
+	}
+	if err = res.Err(); err != nil {
+		return
+	}
+
+	return res.Keys.UnlockAll(passphrase, nil)
+}
+
+func (c *client) getCalendarPassphrase(ctx context.Context, calendarID string) (passphrase []byte, err error) {
+	req, err := c.NewRequest(ctx, "GET", "/calendar/v1/"+calendarID+"/passphrase", nil)
+	if err != nil {
+		return
+	}
+
+	var res calendarPassphraseRes
+	if err = c.DoJSON(req, &res); err != nil {
+		return
+	}
+	if err = res.Err(); err != nil {
+		return
+	}
+
+	c.keyRingLock.Lock()
+	defer c.keyRingLock.Unlock()
+
+	// We don't know which of our addresses is the member, try them all.
+	for _, memberPassphrase := range res.Passphrase.MemberPassphrases {
+		for _, addrKR := range c.addrKeyRing {
+			plain, decryptErr := decrypt(addrKR, memberPassphrase.Passphrase)
+			if decryptErr == nil {
+				return []byte(plain), nil
+			}
+		}
+	}
+
+	return nil, ErrNoKeyringAvailable
+}
+
+// Decrypt returns all cards of the event in cleartext. Encrypted cards are
+// decrypted using the session key from the key packets which is encrypted
+// to the calendar key (see KeyRingForCalendarID).
+func (event *CalendarEvent) Decrypt(kr *crypto.KeyRing) (cards []Card, err error) {
+	shared, err := decryptCalendarCards(kr, event.SharedKeyPacket, event.SharedEvents)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt shared event cards")
+	}
+
+	personal, err := decryptCalendarCards(kr, event.CalendarKeyPacket, event.CalendarEvents)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt calendar event cards")
+	}
+
+	return append(shared, personal...), nil
+}
+
+func decryptCalendarCards(kr *crypto.KeyRing, keyPacket string, cards []Card) (decrypted []Card, err error) {
+	var sessionKey *crypto.SessionKey
+
+	for _, card := range cards {
+		if !isEncryptedCardType(card.Type) {
+			decrypted = append(decrypted, card)
+			continue
+		}
+
+		if kr == nil {
+			return nil, ErrNoKeyringAvailable
+		}
+
+		if sessionKey == nil {
+			if sessionKey, err = decryptCalendarSessionKey(kr, keyPacket); err != nil {
+				return nil, err
+			}
+		}
+
+		dataPacket, err := base64.StdEncoding.DecodeString(card.Data)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode card data")
+		}
+
+		plain, err := sessionKey.Decrypt(dataPacket)
+		if err != nil {
+			return nil, err
+		}
+
+		card.Data = plain.GetString()
+		decrypted = append(decrypted, card)
+	}
+
+	return decrypted, nil
+}
+
+func decryptCalendarSessionKey(kr *crypto.KeyRing, keyPacket string) (*crypto.SessionKey, error) {
+	if keyPacket == "" {
+		return nil, errors.New("missing key packet")
+	}
+
+	rawKeyPacket, err := base64.StdEncoding.DecodeString(keyPacket)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode key packet")
+	}
+
+	return kr.DecryptSessionKey(rawKeyPacket)
+}
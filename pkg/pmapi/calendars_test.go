@@ -0,0 +1,122 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	r "github.com/stretchr/testify/require"
+)
+
+const testCalendarsBody = `{
+    "Calendars": [
+        {
+            "ID": "calendarID",
+            "Name": "Personal",
+            "Description": "",
+            "Color": "#7272a7",
+            "Display": 1,
+            "Flags": 1
+        }
+    ],
+    "Code": 1000
+}
+`
+
+const testCalendarEventsBody = `{
+    "Events": [
+        {
+            "ID": "eventID",
+            "UID": "event@proton.me",
+            "CalendarID": "calendarID",
+            "StartTime": 1600000000,
+            "EndTime": 1600003600,
+            "SharedEvents": [
+                {
+                    "Type": 2,
+                    "Data": "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:event@proton.me\r\nEND:VEVENT\r\nEND:VCALENDAR",
+                    "Signature": ""
+                }
+            ]
+        }
+    ],
+    "Code": 1000
+}
+`
+
+func TestClient_ListCalendars(t *testing.T) {
+	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		Ok(t, checkMethodAndPath(req, "GET", "/calendar/v1"))
+
+		fmt.Fprint(w, testCalendarsBody)
+	}))
+	defer s.Close()
+
+	calendars, err := c.ListCalendars(context.Background())
+	r.NoError(t, err)
+	r.Equal(t, []*Calendar{{ID: "calendarID", Name: "Personal", Color: "#7272a7", Display: 1, Flags: 1}}, calendars)
+}
+
+func TestClient_ListCalendarEvents(t *testing.T) {
+	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		Ok(t, checkMethodAndPath(req, "GET", "/calendar/v1/calendarID/events?End=1700000000&Start=1500000000"))
+
+		fmt.Fprint(w, testCalendarEventsBody)
+	}))
+	defer s.Close()
+
+	events, err := c.ListCalendarEvents(context.Background(), "calendarID", &CalendarEventsFilter{Start: 1500000000, End: 1700000000})
+	r.NoError(t, err)
+	r.Len(t, events, 1)
+	r.Equal(t, "event@proton.me", events[0].UID)
+	r.Len(t, events[0].SharedEvents, 1)
+}
+
+func TestCalendarEvent_Decrypt(t *testing.T) {
+	key, err := crypto.GenerateKey("calendar", "calendar@proton.me", "x25519", 0)
+	r.NoError(t, err)
+	kr, err := crypto.NewKeyRing(key)
+	r.NoError(t, err)
+
+	sessionKey, err := crypto.GenerateSessionKey()
+	r.NoError(t, err)
+	keyPacket, err := kr.EncryptSessionKey(sessionKey)
+	r.NoError(t, err)
+	dataPacket, err := sessionKey.Encrypt(crypto.NewPlainMessageFromString("BEGIN:VCALENDAR\r\nEND:VCALENDAR"))
+	r.NoError(t, err)
+
+	event := &CalendarEvent{
+		SharedKeyPacket: base64.StdEncoding.EncodeToString(keyPacket),
+		SharedEvents: []Card{
+			{Type: CardSigned, Data: "signed"},
+			{Type: CardEncrypted | CardSigned, Data: base64.StdEncoding.EncodeToString(dataPacket)},
+		},
+	}
+
+	cards, err := event.Decrypt(kr)
+	r.NoError(t, err)
+	r.Equal(t, []string{"signed", "BEGIN:VCALENDAR\r\nEND:VCALENDAR"}, []string{cards[0].Data, cards[1].Data})
+
+	_, err = event.Decrypt(nil)
+	r.Error(t, err)
+}
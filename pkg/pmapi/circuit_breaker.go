@@ -0,0 +1,263 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CircuitBreakerPolicy controls when the client manager stops sending
+// requests to the API. After FailureThreshold requests in a row fail
+// because the API cannot be reached or responds with a server error, the
+// circuit opens and all requests fail immediately with ErrAPINotReachable.
+// The API is then probed in the background, first after MinProbeInterval
+// and then with the interval doubled after every failed probe up to
+// MaxProbeInterval. The first successful probe or request closes the circuit.
+type CircuitBreakerPolicy struct {
+	FailureThreshold int
+	MinProbeInterval time.Duration
+	MaxProbeInterval time.Duration
+}
+
+// DefaultCircuitBreakerPolicy is used when ClientConfig does not set the policy.
+var DefaultCircuitBreakerPolicy = CircuitBreakerPolicy{ //nolint[gochecknoglobals]
+	FailureThreshold: 5,
+	MinProbeInterval: 10 * time.Second,
+	MaxProbeInterval: 5 * time.Minute,
+}
+
+// withDefaults replaces unset values by values of DefaultCircuitBreakerPolicy.
+func (p CircuitBreakerPolicy) withDefaults() CircuitBreakerPolicy {
+	if p.FailureThreshold <= 0 {
+		p.FailureThreshold = DefaultCircuitBreakerPolicy.FailureThreshold
+	}
+	if p.MinProbeInterval <= 0 {
+		p.MinProbeInterval = DefaultCircuitBreakerPolicy.MinProbeInterval
+	}
+	if p.MaxProbeInterval <= 0 {
+		p.MaxProbeInterval = DefaultCircuitBreakerPolicy.MaxProbeInterval
+	}
+	if p.MaxProbeInterval < p.MinProbeInterval {
+		p.MaxProbeInterval = p.MinProbeInterval
+	}
+	return p
+}
+
+// CircuitState is the state of the circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed means requests are sent to the API.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen means requests fail without being sent.
+	CircuitOpen
+	// CircuitHalfOpen means the API is being probed and requests still fail.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// APIStatus describes availability of the API as seen by the circuit breaker.
+type APIStatus struct {
+	State CircuitState
+	// Failures is the number of requests failed in a row.
+	Failures int
+	// LastError is the reason of the last failure.
+	LastError string
+	// Since is when the circuit opened; zero when it is closed.
+	Since time.Time
+	// NextProbe is when the API is probed next; zero when it is closed.
+	NextProbe time.Time
+}
+
+// IsAvailable returns whether requests are sent to the API.
+func (s APIStatus) IsAvailable() bool {
+	return s.State == CircuitClosed
+}
+
+// RetryIn returns how long it takes till the next probe of the API.
+func (s APIStatus) RetryIn(now time.Time) time.Duration {
+	if s.IsAvailable() || !s.NextProbe.After(now) {
+		return 0
+	}
+	return s.NextProbe.Sub(now)
+}
+
+type circuitBreaker struct {
+	policy CircuitBreakerPolicy
+	probe  func() error
+
+	status APIStatus
+	lock   sync.Mutex
+
+	log *logrus.Entry
+}
+
+func newCircuitBreaker(policy CircuitBreakerPolicy, probe func() error) *circuitBreaker {
+	return &circuitBreaker{
+		policy: policy.withDefaults(),
+		probe:  probe,
+		log:    logrus.WithField("pkg", "pmapi-circuit"),
+	}
+}
+
+// allow returns ErrAPINotReachable when requests must not be sent.
+func (cb *circuitBreaker) allow() error {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	if cb.status.State != CircuitClosed {
+		return ErrAPINotReachable
+	}
+	return nil
+}
+
+func (cb *circuitBreaker) get() APIStatus {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	return cb.status
+}
+
+// success closes the circuit. Request sent before the circuit opened can
+// still succeed and it is as good as a probe.
+func (cb *circuitBreaker) success() {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	cb.close()
+}
+
+// failure counts the failed request and opens the circuit when there are
+// too many failures in a row.
+func (cb *circuitBreaker) failure(reason string) {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	cb.status.Failures++
+	cb.status.LastError = reason
+
+	if cb.status.State != CircuitClosed || cb.status.Failures < cb.policy.FailureThreshold {
+		return
+	}
+
+	cb.status.State = CircuitOpen
+	cb.status.Since = time.Now()
+	cb.status.NextProbe = cb.status.Since.Add(cb.policy.MinProbeInterval)
+	cb.log.WithField("failures", cb.status.Failures).WithField("reason", reason).Warn("API is unavailable, requests are suspended")
+
+	go cb.probeUntilClosed()
+}
+
+// record counts the response by its status code. Only server errors are
+// failures; any other response proves the API is reachable.
+func (cb *circuitBreaker) record(status int) {
+	if status >= 500 && status != http.StatusNotImplemented {
+		cb.failure(http.StatusText(status))
+		return
+	}
+	cb.success()
+}
+
+func (cb *circuitBreaker) close() {
+	if cb.status.State != CircuitClosed {
+		cb.log.WithField("since", cb.status.Since).Info("API is available again")
+	}
+	cb.status = APIStatus{}
+}
+
+func (cb *circuitBreaker) probeUntilClosed() {
+	interval := cb.policy.MinProbeInterval
+	for {
+		time.Sleep(interval)
+
+		if !cb.startProbe() {
+			return
+		}
+
+		if cb.finishProbe(cb.probe(), interval*2) {
+			return
+		}
+
+		if interval *= 2; interval > cb.policy.MaxProbeInterval {
+			interval = cb.policy.MaxProbeInterval
+		}
+	}
+}
+
+// startProbe switches to half-open state. It returns false when the circuit
+// was closed in the meantime and there is nothing to probe.
+func (cb *circuitBreaker) startProbe() bool {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	if cb.status.State == CircuitClosed {
+		return false
+	}
+	cb.status.State = CircuitHalfOpen
+	return true
+}
+
+// finishProbe closes the circuit when the probe succeeded. Otherwise it
+// opens the circuit again until the next probe.
+func (cb *circuitBreaker) finishProbe(err error, next time.Duration) bool {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	if err == nil || cb.status.State == CircuitClosed {
+		cb.close()
+		return true
+	}
+
+	if next > cb.policy.MaxProbeInterval {
+		next = cb.policy.MaxProbeInterval
+	}
+	cb.status.State = CircuitOpen
+	cb.status.LastError = err.Error()
+	cb.status.NextProbe = time.Now().Add(next)
+	cb.log.WithError(err).WithField("nextProbe", next).Debug("API probe failed")
+	return false
+}
+
+// GetAPIStatus returns availability of the API as seen by the circuit
+// breaker of all clients.
+func (cm *ClientManager) GetAPIStatus() APIStatus {
+	return cm.circuit.get()
+}
+
+// pingAPI is the probe of the circuit breaker.
+func (cm *ClientManager) pingAPI() error {
+	client := getHTTPClient(cm.config, cm.roundTripper, cm.cookieJar)
+	ret := make(chan error, 1)
+	checkConnection(client, cm.GetRootURL()+"/tests/ping", ret)
+	return <-ret
+}
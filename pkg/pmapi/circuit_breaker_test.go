@@ -0,0 +1,121 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreakerOpensAndProbes(t *testing.T) {
+	probes := 0
+	probesLock := sync.Mutex{}
+	probe := func() error {
+		probesLock.Lock()
+		defer probesLock.Unlock()
+
+		if probes++; probes < 3 {
+			return errors.New("still down")
+		}
+		return nil
+	}
+
+	cb := newCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 2, MinProbeInterval: time.Millisecond, MaxProbeInterval: 2 * time.Millisecond}, probe)
+
+	cb.failure("first")
+	require.NoError(t, cb.allow())
+	require.True(t, cb.get().IsAvailable())
+
+	cb.failure("second")
+	require.Equal(t, ErrAPINotReachable, cb.allow())
+	status := cb.get()
+	require.False(t, status.IsAvailable())
+	require.Equal(t, 2, status.Failures)
+	require.Equal(t, "second", status.LastError)
+	require.False(t, status.Since.IsZero())
+
+	require.Eventually(t, func() bool {
+		return cb.get().IsAvailable()
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, cb.allow())
+	require.Equal(t, APIStatus{}, cb.get())
+
+	probesLock.Lock()
+	defer probesLock.Unlock()
+	require.Equal(t, 3, probes)
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	cb := newCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 2}, nil)
+
+	cb.failure("first")
+	cb.record(http.StatusNotImplemented)
+	cb.failure("second")
+	require.True(t, cb.get().IsAvailable())
+
+	cb.record(http.StatusBadGateway)
+	require.Equal(t, 2, cb.get().Failures)
+	require.False(t, cb.get().IsAvailable())
+
+	cb.success()
+	require.True(t, cb.get().IsAvailable())
+
+	require.Equal(t, DefaultCircuitBreakerPolicy, CircuitBreakerPolicy{}.withDefaults())
+}
+
+func TestAPIStatusRetryIn(t *testing.T) {
+	now := time.Now()
+	require.Equal(t, time.Duration(0), APIStatus{NextProbe: now.Add(time.Minute)}.RetryIn(now))
+	require.Equal(t, time.Minute, APIStatus{State: CircuitOpen, NextProbe: now.Add(time.Minute)}.RetryIn(now))
+	require.Equal(t, time.Duration(0), APIStatus{State: CircuitHalfOpen, NextProbe: now.Add(-time.Minute)}.RetryIn(now))
+}
+
+func TestClient_CircuitBreakerFailsFast(t *testing.T) {
+	finish, c := newTestServerCallbacks(t,
+		statusCallback(http.StatusServiceUnavailable),
+		statusCallback(http.StatusServiceUnavailable),
+	)
+	defer finish()
+	c.cm.circuit = newCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 2, MinProbeInterval: time.Hour}, nil)
+
+	for i := 0; i < 2; i++ {
+		req, err := c.NewRequest(context.Background(), "POST", "/", nil)
+		require.NoError(t, err)
+		res, err := c.Do(req, false)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		_ = res.Body.Close()
+	}
+
+	// Third request is not sent to the server at all.
+	req, err := c.NewRequest(context.Background(), "POST", "/", nil)
+	require.NoError(t, err)
+	_, err = c.Do(req, false)
+	require.Equal(t, ErrAPINotReachable, err)
+
+	status := c.cm.GetAPIStatus()
+	require.Equal(t, CircuitOpen, status.State)
+	require.Equal(t, "Service Unavailable", status.LastError)
+}
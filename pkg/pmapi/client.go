@@ -24,7 +24,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math/rand"
 	"net/http"
 	"reflect"
 	"strconv"
@@ -33,6 +32,7 @@ import (
 	"time"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/tracing"
 	"github.com/jaytaylor/html2text"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -102,6 +102,22 @@ type ClientConfig struct {
 	// MinBytesPerSecond specifies minimum Bytes per second or the request will be canceled.
 	// Zero means no limitation.
 	MinBytesPerSecond int64
+
+	// Retry controls retries of requests failed with transient errors.
+	// Unset values are taken from DefaultRetryPolicy.
+	Retry RetryPolicy
+
+	// CircuitBreaker controls when requests stop being sent to unavailable API.
+	// Unset values are taken from DefaultCircuitBreakerPolicy.
+	CircuitBreaker CircuitBreakerPolicy
+
+	// DoHProviders are DNS-over-HTTPS resolvers queried for proxies by
+	// alternative routing. DefaultDoHProviders are used when empty.
+	DoHProviders []string
+
+	// APIHost pins the host requests are sent to instead of the default
+	// one, see ClientManager.SetAPIHost.
+	APIHost string
 }
 
 // client is a client of the protonmail API. It implements the Client interface.
@@ -121,6 +137,9 @@ type client struct {
 	addrKeyRing map[string]*crypto.KeyRing
 	keyRingLock sync.Locker
 
+	verificationKeys     map[string]verificationKeys
+	verificationKeysLock sync.Mutex
+
 	log *logrus.Entry
 }
 
@@ -153,17 +172,17 @@ func (c *client) IsUnlocked() bool {
 
 // Unlock unlocks all the user and address keys using the given passphrase, creating user and address keyrings.
 // If the keyrings are already present, they are not recreated.
-func (c *client) Unlock(passphrase []byte) (err error) {
+func (c *client) Unlock(ctx context.Context, passphrase []byte) (err error) {
 	c.keyRingLock.Lock()
 	defer c.keyRingLock.Unlock()
 
-	return c.unlock(passphrase)
+	return c.unlock(ctx, passphrase)
 }
 
 // unlock unlocks the user's keys but without locking the keyring lock first.
 // Should only be used internally by methods that first lock the lock.
-func (c *client) unlock(passphrase []byte) (err error) {
-	if _, err = c.CurrentUser(); err != nil {
+func (c *client) unlock(ctx context.Context, passphrase []byte) (err error) {
+	if _, err = c.CurrentUser(ctx); err != nil {
 		return
 	}
 
@@ -184,13 +203,13 @@ func (c *client) unlock(passphrase []byte) (err error) {
 	return
 }
 
-func (c *client) ReloadKeys(passphrase []byte) (err error) {
+func (c *client) ReloadKeys(ctx context.Context, passphrase []byte) (err error) {
 	c.keyRingLock.Lock()
 	defer c.keyRingLock.Unlock()
 
 	c.clearKeys()
 
-	return c.unlock(passphrase)
+	return c.unlock(ctx, passphrase)
 }
 
 func (c *client) clearKeys() {
@@ -227,13 +246,17 @@ func (c *client) Do(req *http.Request, retryUnauthorized bool) (res *http.Respon
 		req.Body = ioutil.NopCloser(r)
 	}
 
-	return c.doBuffered(req, bodyBuffer, retryUnauthorized)
+	return c.doBuffered(req, bodyBuffer, retryUnauthorized, 1)
 }
 
-// If needed it retries using req and buffered body.
-func (c *client) doBuffered(req *http.Request, bodyBuffer []byte, retryUnauthorized bool) (res *http.Response, err error) { // nolint[funlen]
+// If needed it retries using req and buffered body. Attempt is the number
+// of the attempt starting with one.
+func (c *client) doBuffered(req *http.Request, bodyBuffer []byte, retryUnauthorized bool, attempt int) (res *http.Response, err error) { // nolint[funlen]
 	isAuthReq := strings.Contains(req.URL.Path, "/auth")
 
+	// Requests of client sessions are logged with the session ID.
+	log := tracing.Logger(req.Context(), c.log)
+
 	req.Header.Set("User-Agent", c.cm.config.UserAgent)
 	req.Header.Set("x-pm-appversion", c.cm.config.AppVersion)
 	req.Header.Set("x-pm-apiversion", strconv.Itoa(Version))
@@ -246,7 +269,7 @@ func (c *client) doBuffered(req *http.Request, bodyBuffer []byte, retryUnauthori
 		req.Header.Set("Authorization", "Bearer "+c.accessToken)
 	}
 
-	c.log.Debugln("Requesting ", req.Method, req.URL.RequestURI())
+	log.Debugln("Requesting ", req.Method, req.URL.RequestURI())
 	if logrus.GetLevel() == logrus.TraceLevel {
 		head := ""
 		for i, v := range req.Header {
@@ -254,19 +277,33 @@ func (c *client) doBuffered(req *http.Request, bodyBuffer []byte, retryUnauthori
 			head += strings.Join(v, "")
 			head += "\n"
 		}
-		c.log.Tracef("REQHEAD \n%s", head)
-		c.log.Tracef("REQBODY '%s'", string(bodyBuffer))
+		log.Tracef("REQHEAD \n%s", head)
+		log.Tracef("REQBODY '%s'", string(bodyBuffer))
+	}
+
+	if err = c.cm.circuit.allow(); err != nil {
+		log.Debug("Request not sent, API is unavailable")
+		return
 	}
 
 	hasBody := len(bodyBuffer) > 0
+	start := time.Now()
 	if res, err = c.hc.Do(req); err != nil {
+		// Cancelled request says nothing about availability of the API.
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			log.WithError(ctxErr).Debug("Request cancelled")
+			return nil, ctxErr
+		}
 		if res == nil {
-			c.log.WithError(err).Error("Cannot get response")
+			log.WithError(err).Error("Cannot get response")
+			c.cm.circuit.failure(err.Error())
 			err = ErrAPINotReachable
 		}
 		return
 	}
 
+	log.WithField("status", res.StatusCode).WithField("duration", time.Since(start).Round(time.Millisecond).String()).Debugln("Response to", req.Method, req.URL.RequestURI())
+
 	resDate := res.Header.Get("Date")
 	if resDate != "" {
 		if serverTime, err := http.ParseTime(resDate); err == nil {
@@ -283,32 +320,30 @@ func (c *client) doBuffered(req *http.Request, bodyBuffer []byte, retryUnauthori
 		if !isAuthReq {
 			_, _ = io.Copy(ioutil.Discard, res.Body)
 			_ = res.Body.Close()
+			c.cm.circuit.success()
 			return c.handleStatusUnauthorized(req, bodyBuffer, res, retryUnauthorized)
 		}
 	}
 
-	// Retry induced by HTTP status code>
-	retryAfter := 10
-	doRetry := res.StatusCode == http.StatusTooManyRequests
-	if doRetry {
-		if headerAfter, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && headerAfter > 0 {
-			retryAfter = headerAfter
+	// Retry induced by HTTP status code.
+	if isRetryableStatus(req.Method, res.StatusCode) {
+		retryAfter := parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+		if !c.waitBeforeRetry(req, attempt, res.StatusCode, retryAfter) {
+			c.cm.circuit.record(res.StatusCode)
+			return res, err
 		}
-		// To avoid spikes when all clients retry at the same time, we add some random wait.
-		retryAfter += rand.Intn(10)
 
 		if hasBody {
 			r := bytes.NewReader(bodyBuffer)
 			req.Body = ioutil.NopCloser(r)
 		}
 
-		c.log.Warningf("Retrying %s after %ds induced by http code %d", req.URL.Path, retryAfter, res.StatusCode)
-		time.Sleep(time.Duration(retryAfter) * time.Second)
 		_, _ = io.Copy(ioutil.Discard, res.Body)
 		_ = res.Body.Close()
-		return c.doBuffered(req, bodyBuffer, false)
+		return c.doBuffered(req, bodyBuffer, false, attempt+1)
 	}
 
+	c.cm.circuit.record(res.StatusCode)
 	return res, err
 }
 
@@ -330,13 +365,15 @@ func (c *client) DoJSON(req *http.Request, data interface{}) error {
 		req.Body = ioutil.NopCloser(bytes.NewReader(reqBodyBuffer))
 	}
 
-	return c.doJSONBuffered(req, reqBodyBuffer, data)
+	return c.doJSONBuffered(req, reqBodyBuffer, data, 1)
 }
 
 // doJSONBuffered performs a buffered json request (see DoJSON for more information).
-func (c *client) doJSONBuffered(req *http.Request, reqBodyBuffer []byte, data interface{}) error { // nolint[funlen]
+func (c *client) doJSONBuffered(req *http.Request, reqBodyBuffer []byte, data interface{}, attempt int) error { // nolint[funlen]
 	req.Header.Set("Accept", "application/vnd.protonmail.v1+json")
 
+	parentCtx := req.Context()
+
 	var cancelRequest context.CancelFunc
 	if c.cm.config.MinBytesPerSecond > 0 {
 		var ctx context.Context
@@ -347,7 +384,7 @@ func (c *client) doJSONBuffered(req *http.Request, reqBodyBuffer []byte, data in
 		req = req.WithContext(ctx)
 	}
 
-	res, err := c.doBuffered(req, reqBodyBuffer, false)
+	res, err := c.doBuffered(req, reqBodyBuffer, false, 1)
 	if err != nil {
 		return err
 	}
@@ -358,7 +395,8 @@ func (c *client) doJSONBuffered(req *http.Request, reqBodyBuffer []byte, data in
 		resBody, err = ioutil.ReadAll(res.Body)
 	} else {
 		resBody, err = c.readAllMinSpeed(res.Body, cancelRequest)
-		if err == context.Canceled {
+		// Only cancellation by the caller is not caused by slow connection.
+		if err == context.Canceled && parentCtx.Err() == nil {
 			err = ErrConnectionSlow
 		}
 	}
@@ -391,14 +429,11 @@ func (c *client) doJSONBuffered(req *http.Request, reqBodyBuffer []byte, data in
 	// Retry induced by API code.
 	errCode := &Res{}
 	if err := json.Unmarshal(resBody, errCode); err == nil {
-		if errCode.Code == BansRequests {
-			retryAfter := 3
-			c.log.Warningf("Retrying %s after %ds induced by API code %d", req.URL.Path, retryAfter, errCode.Code)
-			time.Sleep(time.Duration(retryAfter) * time.Second)
+		if errCode.Code == BansRequests && c.waitBeforeRetry(req, attempt, errCode.Code, 0) {
 			if len(reqBodyBuffer) > 0 {
 				req.Body = ioutil.NopCloser(bytes.NewReader(reqBodyBuffer))
 			}
-			return c.doJSONBuffered(req, reqBodyBuffer, data)
+			return c.doJSONBuffered(req, reqBodyBuffer, data, attempt+1)
 		}
 	}
 
@@ -461,7 +496,7 @@ func (c *client) readAllMinSpeed(data io.Reader, cancelRequest context.CancelFun
 	return ioutil.ReadAll(&buffer)
 }
 
-func (c *client) refreshAccessToken() (err error) {
+func (c *client) refreshAccessToken(ctx context.Context) (err error) {
 	c.log.Debug("Refreshing token")
 
 	refreshToken := c.cm.GetToken(c.userID)
@@ -471,7 +506,7 @@ func (c *client) refreshAccessToken() (err error) {
 		return ErrInvalidToken
 	}
 
-	if _, err := c.AuthRefresh(refreshToken); err != nil {
+	if _, err := c.AuthRefresh(ctx, refreshToken); err != nil {
 		if err != ErrAPINotReachable {
 			c.sendAuth(nil)
 		}
@@ -493,11 +528,11 @@ func (c *client) handleStatusUnauthorized(req *http.Request, reqBodyBuffer []byt
 
 		_, _ = io.Copy(ioutil.Discard, res.Body)
 		_ = res.Body.Close()
-		return c.doBuffered(req, reqBodyBuffer, true)
+		return c.doBuffered(req, reqBodyBuffer, true, 1)
 	}
 
 	// This is already a retry, so we will try to refresh the access token before trying again.
-	if err = c.refreshAccessToken(); err != nil {
+	if err = c.refreshAccessToken(req.Context()); err != nil {
 		c.log.WithError(err).Warn("Cannot refresh token")
 		err = &ErrUnauthorized{err}
 		return
@@ -507,5 +542,5 @@ func (c *client) handleStatusUnauthorized(req *http.Request, reqBodyBuffer []byt
 		c.log.WithError(err).Warn("Failed to read out response body")
 	}
 	_ = res.Body.Close()
-	return c.doBuffered(req, reqBodyBuffer, true)
+	return c.doBuffered(req, reqBodyBuffer, true, 1)
 }
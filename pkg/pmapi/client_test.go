@@ -26,6 +26,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ProtonMail/proton-bridge/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	logrusTest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/require"
 )
 
@@ -50,7 +53,7 @@ func TestClient_Do(t *testing.T) {
 	}))
 	defer s.Close()
 
-	req, err := c.NewRequest("GET", "/", nil)
+	req, err := c.NewRequest(context.Background(), "GET", "/", nil)
 	if err != nil {
 		t.Fatal("Expected no error while creating request, got:", err)
 	}
@@ -85,6 +88,29 @@ func TestClient_Do(t *testing.T) {
 	}
 }
 
+func TestClient_DoLogsSessionID(t *testing.T) {
+	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "OK")
+	}))
+	defer s.Close()
+
+	logger, hook := logrusTest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	c.log = logrus.NewEntry(logger)
+
+	req, err := c.NewRequest(context.Background(), "GET", "/", nil)
+	require.NoError(t, err)
+
+	res, err := c.Do(req.WithContext(tracing.WithSessionID(context.Background(), "imap-1234")), true)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+
+	require.NotEmpty(t, hook.AllEntries())
+	for _, entry := range hook.AllEntries() {
+		require.Equal(t, "imap-1234", entry.Data[tracing.LogField], entry.Message)
+	}
+}
+
 func TestClient_DoRetryAfter(t *testing.T) {
 	testStart := time.Now()
 	secondAttemptTime := time.Now()
@@ -105,7 +131,7 @@ func TestClient_DoRetryAfter(t *testing.T) {
 	)
 	defer finish()
 
-	require.Nil(t, c.SendSimpleMetric("some_category", "some_action", "some_label"))
+	require.Nil(t, c.SendSimpleMetric(context.Background(), "some_category", "some_action", "some_label"))
 	waitedTime := secondAttemptTime.Sub(testStart)
 	isInRange := 1*time.Second < waitedTime && waitedTime <= 11*time.Second
 	require.True(t, isInRange, "Waited time: %v", waitedTime)
@@ -168,7 +194,7 @@ func TestClient_FirstReadTimeout(t *testing.T) {
 	}
 
 	started := time.Now()
-	err := c.SendSimpleMetric("some_category", "some_action", "some_label")
+	err := c.SendSimpleMetric(context.Background(), "some_category", "some_action", "some_label")
 	require.Error(t, err, "cannot reach the server")
 	require.True(t, time.Since(started) < requestTimeout, "Actual waited time: %v", time.Since(started))
 }
@@ -179,7 +205,7 @@ func TestClient_MinSpeedTimeout(t *testing.T) {
 	)
 	defer finish()
 
-	err := c.SendSimpleMetric("some_category", "some_action", "some_label")
+	err := c.SendSimpleMetric(context.Background(), "some_category", "some_action", "some_label")
 	require.Error(t, err, "cannot reach the server")
 }
 
@@ -189,7 +215,7 @@ func TestClient_MinSpeedNoTimeout(t *testing.T) {
 	)
 	defer finish()
 
-	err := c.SendSimpleMetric("some_category", "some_action", "some_label")
+	err := c.SendSimpleMetric(context.Background(), "some_category", "some_action", "some_label")
 	require.Nil(t, err)
 }
 
@@ -211,3 +237,47 @@ func routeSlow(delay time.Duration) func(tb testing.TB, w http.ResponseWriter, r
 		return ""
 	}
 }
+
+func TestClient_CancelledRequest(t *testing.T) {
+	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := c.GetMessage(ctx, "messageID")
+	require.Equal(t, context.Canceled, err)
+
+	// Cancelled request does not count as unavailable API.
+	status := c.cm.GetAPIStatus()
+	require.Equal(t, CircuitClosed, status.State)
+	require.Equal(t, 0, status.Failures)
+}
+
+func TestClient_CancelledRetry(t *testing.T) {
+	finish, c := newTestServerCallbacks(t,
+		func(tb testing.TB, w http.ResponseWriter, req *http.Request) string {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return ""
+		},
+	)
+	defer finish()
+	withTestRetryPolicy(c, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	req, err := c.NewRequest(ctx, "GET", "/", nil)
+	require.NoError(t, err)
+
+	started := time.Now()
+	res, err := c.Do(req, false)
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	require.True(t, time.Since(started) < 10*time.Second, "Waited time: %v", time.Since(started))
+}
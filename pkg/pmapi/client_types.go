@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"io"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
@@ -25,60 +26,74 @@ import (
 
 // Client defines the interface of a PMAPI client.
 type Client interface {
-	Auth(username, password string, info *AuthInfo) (*Auth, error)
-	AuthInfo(username string) (*AuthInfo, error)
-	AuthRefresh(token string) (*Auth, error)
-	Auth2FA(twoFactorCode string, auth *Auth) (*Auth2FA, error)
-	AuthSalt() (salt string, err error)
+	Auth(ctx context.Context, username, password string, info *AuthInfo) (*Auth, error)
+	AuthInfo(ctx context.Context, username string) (*AuthInfo, error)
+	AuthRefresh(ctx context.Context, token string) (*Auth, error)
+	Auth2FA(ctx context.Context, twoFactorCode string, auth *Auth) (*Auth2FA, error)
+	AuthSalt(ctx context.Context) (salt string, err error)
+	AuthModulus(ctx context.Context) (*AuthModulus, error)
 	Logout()
-	DeleteAuth() error
+	DeleteAuth(ctx context.Context) error
 	IsConnected() bool
 	CloseConnections()
 	ClearData()
 
-	CurrentUser() (*User, error)
-	UpdateUser() (*User, error)
-	Unlock(passphrase []byte) (err error)
-	ReloadKeys(passphrase []byte) (err error)
+	CurrentUser(ctx context.Context) (*User, error)
+	UpdateUser(ctx context.Context) (*User, error)
+	Unlock(ctx context.Context, passphrase []byte) (err error)
+	ReloadKeys(ctx context.Context, passphrase []byte) (err error)
 	IsUnlocked() bool
 
-	GetAddresses() (addresses AddressList, err error)
+	GetAddresses(ctx context.Context) (addresses AddressList, err error)
 	Addresses() AddressList
-	ReorderAddresses(addressIDs []string) error
+	ReorderAddresses(ctx context.Context, addressIDs []string) error
+	UpdateAddress(ctx context.Context, addressID string, settings *UpdateAddressReq) error
 
-	GetEvent(eventID string) (*Event, error)
+	GetEvent(ctx context.Context, eventID string) (*Event, error)
 
-	SendMessage(string, *SendMessageReq) (sent, parent *Message, err error)
-	CreateDraft(m *Message, parent string, action int) (created *Message, err error)
-	Import([]*ImportMsgReq) ([]*ImportMsgRes, error)
+	SendMessage(ctx context.Context, id string, sendReq *SendMessageReq) (sent, parent *Message, err error)
+	CreateDraft(ctx context.Context, m *Message, parent string, action int) (created *Message, err error)
+	UpdateDraft(ctx context.Context, id string, m *Message) (updated *Message, err error)
+	Import(ctx context.Context, reqs []*ImportMsgReq) ([]*ImportMsgRes, error)
 
-	CountMessages(addressID string) ([]*MessagesCount, error)
-	ListMessages(filter *MessagesFilter) ([]*Message, int, error)
-	GetMessage(apiID string) (*Message, error)
-	DeleteMessages(apiIDs []string) error
-	LabelMessages(apiIDs []string, labelID string) error
-	UnlabelMessages(apiIDs []string, labelID string) error
-	MarkMessagesRead(apiIDs []string) error
-	MarkMessagesUnread(apiIDs []string) error
+	CountMessages(ctx context.Context, addressID string) ([]*MessagesCount, error)
+	ListMessages(ctx context.Context, filter *MessagesFilter) ([]*Message, int, error)
+	GetMessage(ctx context.Context, apiID string) (*Message, error)
+	DeleteMessages(ctx context.Context, apiIDs []string) error
+	LabelMessages(ctx context.Context, apiIDs []string, labelID string) error
+	UnlabelMessages(ctx context.Context, apiIDs []string, labelID string) error
+	MarkMessagesRead(ctx context.Context, apiIDs []string) error
+	MarkMessagesUnread(ctx context.Context, apiIDs []string) error
+	MarkMessagesHam(ctx context.Context, apiIDs []string) error
 
-	ListLabels() ([]*Label, error)
-	CreateLabel(label *Label) (*Label, error)
-	UpdateLabel(label *Label) (*Label, error)
-	DeleteLabel(labelID string) error
-	EmptyFolder(labelID string, addressID string) error
+	ListLabels(ctx context.Context) ([]*Label, error)
+	CreateLabel(ctx context.Context, label *Label) (*Label, error)
+	UpdateLabel(ctx context.Context, label *Label) (*Label, error)
+	DeleteLabel(ctx context.Context, labelID string) error
+	EmptyFolder(ctx context.Context, labelID string, addressID string) error
 
-	Report(report ReportReq) error
-	SendSimpleMetric(category, action, label string) error
+	Report(ctx context.Context, report ReportReq) error
+	SendSimpleMetric(ctx context.Context, category, action, label string) error
 
-	GetMailSettings() (MailSettings, error)
-	GetContactEmailByEmail(string, int, int) ([]ContactEmail, error)
-	GetContactByID(string) (Contact, error)
+	GetMailSettings(ctx context.Context) (MailSettings, error)
+	GetAllContactsEmails(ctx context.Context, page int, pageSize int) ([]ContactEmail, error)
+	GetContactEmailByEmail(ctx context.Context, email string, page int, pageSize int) ([]ContactEmail, error)
+	GetContactByID(ctx context.Context, id string) (Contact, error)
 	DecryptAndVerifyCards([]Card) ([]Card, error)
+	EncryptAndSignCards([]Card) ([]Card, error)
+	AddContacts(ctx context.Context, cards ContactsCards, overwrite int, groups int, labels int) (*AddContactsResponse, error)
+	UpdateContact(ctx context.Context, id string, cards []Card) (*UpdateContactResponse, error)
 
-	GetAttachment(id string) (att io.ReadCloser, err error)
-	CreateAttachment(att *Attachment, r io.Reader, sig io.Reader) (created *Attachment, err error)
-	DeleteAttachment(attID string) (err error)
+	ListCalendars(ctx context.Context) ([]*Calendar, error)
+	ListCalendarEvents(ctx context.Context, calendarID string, filter *CalendarEventsFilter) ([]*CalendarEvent, error)
+	GetCalendarEvent(ctx context.Context, calendarID, eventID string) (*CalendarEvent, error)
+
+	GetAttachment(ctx context.Context, id string) (att io.ReadCloser, err error)
+	CreateAttachment(ctx context.Context, att *Attachment, r io.Reader, sig io.Reader) (created *Attachment, err error)
+	DeleteAttachment(ctx context.Context, attID string) (err error)
 
 	KeyRingForAddressID(string) (kr *crypto.KeyRing, err error)
-	GetPublicKeysForEmail(string) ([]PublicKey, bool, error)
+	KeyRingForCalendarID(ctx context.Context, calendarID string) (kr *crypto.KeyRing, err error)
+	GetPublicKeysForEmail(ctx context.Context, email string) ([]PublicKey, bool, error)
+	GetVerificationKeyRing(ctx context.Context, email string) (*crypto.KeyRing, error)
 }
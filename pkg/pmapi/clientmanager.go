@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
@@ -53,6 +54,7 @@ type ClientManager struct {
 	authUpdates chan ClientAuth
 
 	host, scheme string
+	pinnedHost   string
 	hostLocker   sync.RWMutex
 
 	allowProxy       bool
@@ -61,6 +63,9 @@ type ClientManager struct {
 
 	idGen idGen
 
+	retries retryCounter
+	circuit *circuitBreaker
+
 	log *logrus.Entry
 }
 
@@ -111,9 +116,18 @@ func NewClientManager(config *ClientConfig) (cm *ClientManager) {
 		log: logrus.WithField("pkg", "pmapi-manager"),
 	}
 
+	if len(config.DoHProviders) > 0 {
+		cm.proxyProvider.providers = config.DoHProviders
+	}
+	if config.APIHost != "" {
+		cm.pinnedHost = config.APIHost
+		cm.host = config.APIHost
+	}
+
 	cm.newClient = func(userID string) Client {
 		return newClient(cm, userID)
 	}
+	cm.circuit = newCircuitBreaker(config.CircuitBreaker, cm.pingAPI)
 	cm.SetUserAgent("", "", "") // Set default user agent.
 
 	go cm.watchTokenExpirations()
@@ -185,7 +199,7 @@ func (cm *ClientManager) LogoutClient(userID string) {
 
 		var retries int
 
-		for client.DeleteAuth() == ErrAPINotReachable {
+		for client.DeleteAuth(context.Background()) == ErrAPINotReachable {
 			retries++
 
 			if retries > maxLogoutRetries {
@@ -237,7 +251,7 @@ func (cm *ClientManager) DisallowProxy() {
 	defer cm.hostLocker.Unlock()
 
 	cm.allowProxy = false
-	cm.host = rootURL
+	cm.host = cm.defaultHost()
 
 	for _, client := range cm.clients {
 		client.CloseConnections()
@@ -249,7 +263,7 @@ func (cm *ClientManager) IsProxyEnabled() bool {
 	cm.hostLocker.RLock()
 	defer cm.hostLocker.RUnlock()
 
-	return cm.host != rootURL
+	return cm.host != cm.defaultHost()
 }
 
 // switchToReachableServer switches to using a reachable server (either proxy or standard API).
@@ -283,7 +297,7 @@ func (cm *ClientManager) switchToReachableServer() (proxy string, err error) {
 			cm.hostLocker.Lock()
 			defer cm.hostLocker.Unlock()
 
-			cm.host = rootURL
+			cm.host = cm.defaultHost()
 		}()
 	}
 
@@ -480,7 +494,7 @@ func (cm *ClientManager) watchTokenExpirations() {
 			continue
 		}
 
-		if _, err := client.AuthRefresh(token); err != nil {
+		if _, err := client.AuthRefresh(context.Background(), token); err != nil {
 			log.WithError(err).Error("Failed to refresh expired token")
 		}
 	}
@@ -32,7 +32,7 @@ var rootScheme = "https"          //nolint[gochecknoglobals]
 
 // The HTTP transport to use by default.
 var defaultTransport = &http.Transport{ //nolint[gochecknoglobals]
-	Proxy: http.ProxyFromEnvironment,
+	Proxy: proxyForRequest,
 }
 
 // checkTLSCerts controls whether TLS certs are checked against known fingerprints.
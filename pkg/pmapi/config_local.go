@@ -32,7 +32,7 @@ func init() {
 
 	// TLS certificate is self-signed
 	defaultTransport = &http.Transport{
-		Proxy:           http.ProxyFromEnvironment,
+		Proxy:           proxyForRequest,
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
 }
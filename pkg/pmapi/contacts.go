@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"errors"
 	"net/url"
 	"strconv"
@@ -113,13 +114,13 @@ type ContactsListRes struct {
 }
 
 // GetContacts gets all contacts.
-func (c *client) GetContacts(page int, pageSize int) (contacts []*Contact, err error) {
+func (c *client) GetContacts(ctx context.Context, page int, pageSize int) (contacts []*Contact, err error) {
 	v := url.Values{}
 	v.Set("Page", strconv.Itoa(page))
 	if pageSize > 0 {
 		v.Set("PageSize", strconv.Itoa(pageSize))
 	}
-	req, err := c.NewRequest("GET", "/contacts?"+v.Encode(), nil)
+	req, err := c.NewRequest(ctx, "GET", "/contacts?"+v.Encode(), nil)
 
 	if err != nil {
 		return
@@ -135,8 +136,8 @@ func (c *client) GetContacts(page int, pageSize int) (contacts []*Contact, err e
 }
 
 // GetContactByID gets contact details specified by contact ID.
-func (c *client) GetContactByID(id string) (contactDetail Contact, err error) {
-	req, err := c.NewRequest("GET", "/contacts/"+id, nil)
+func (c *client) GetContactByID(ctx context.Context, id string) (contactDetail Contact, err error) {
+	req, err := c.NewRequest(ctx, "GET", "/contacts/"+id, nil)
 
 	if err != nil {
 		return
@@ -157,14 +158,14 @@ func (c *client) GetContactByID(id string) (contactDetail Contact, err error) {
 }
 
 // GetContactsForExport gets contacts in vCard format, signed and encrypted.
-func (c *client) GetContactsForExport(page int, pageSize int) (contacts []Contact, err error) {
+func (c *client) GetContactsForExport(ctx context.Context, page int, pageSize int) (contacts []Contact, err error) {
 	v := url.Values{}
 	v.Set("Page", strconv.Itoa(page))
 	if pageSize > 0 {
 		v.Set("PageSize", strconv.Itoa(pageSize))
 	}
 
-	req, err := c.NewRequest("GET", "/contacts/export?"+v.Encode(), nil)
+	req, err := c.NewRequest(ctx, "GET", "/contacts/export?"+v.Encode(), nil)
 
 	if err != nil {
 		return
@@ -191,14 +192,14 @@ type ContactsEmailsRes struct {
 }
 
 // GetAllContactsEmails gets all emails from all contacts.
-func (c *client) GetAllContactsEmails(page int, pageSize int) (contactsEmails []ContactEmail, err error) {
+func (c *client) GetAllContactsEmails(ctx context.Context, page int, pageSize int) (contactsEmails []ContactEmail, err error) {
 	v := url.Values{}
 	v.Set("Page", strconv.Itoa(page))
 	if pageSize > 0 {
 		v.Set("PageSize", strconv.Itoa(pageSize))
 	}
 
-	req, err := c.NewRequest("GET", "/contacts/emails?"+v.Encode(), nil)
+	req, err := c.NewRequest(ctx, "GET", "/contacts/emails?"+v.Encode(), nil)
 	if err != nil {
 		return
 	}
@@ -213,7 +214,7 @@ func (c *client) GetAllContactsEmails(page int, pageSize int) (contactsEmails []
 }
 
 // GetContactEmailByEmail gets all emails from all contacts matching a specified email string.
-func (c *client) GetContactEmailByEmail(email string, page int, pageSize int) (contactEmails []ContactEmail, err error) {
+func (c *client) GetContactEmailByEmail(ctx context.Context, email string, page int, pageSize int) (contactEmails []ContactEmail, err error) {
 	v := url.Values{}
 	v.Set("Page", strconv.Itoa(page))
 	if pageSize > 0 {
@@ -221,7 +222,7 @@ func (c *client) GetContactEmailByEmail(email string, page int, pageSize int) (c
 	}
 	v.Set("Email", email)
 
-	req, err := c.NewRequest("GET", "/contacts/emails?"+v.Encode(), nil)
+	req, err := c.NewRequest(ctx, "GET", "/contacts/emails?"+v.Encode(), nil)
 	if err != nil {
 		return
 	}
@@ -268,7 +269,7 @@ type AddContactsReq struct {
 }
 
 // AddContacts adds contacts specified by cards. Performs signing and encrypting based on card type.
-func (c *client) AddContacts(cards ContactsCards, overwrite int, groups int, labels int) (res *AddContactsResponse, err error) {
+func (c *client) AddContacts(ctx context.Context, cards ContactsCards, overwrite int, groups int, labels int) (res *AddContactsResponse, err error) {
 	reqBody := AddContactsReq{
 		ContactsCards: cards,
 		Overwrite:     overwrite,
@@ -276,7 +277,7 @@ func (c *client) AddContacts(cards ContactsCards, overwrite int, groups int, lab
 		Labels:        labels,
 	}
 
-	req, err := c.NewJSONRequest("POST", "/contacts", reqBody)
+	req, err := c.NewJSONRequest(ctx, "POST", "/contacts", reqBody)
 	if err != nil {
 		return
 	}
@@ -302,11 +303,11 @@ type UpdateContactReq struct {
 }
 
 // UpdateContact updates contact identified by contact ID. Modified contact is specified by cards.
-func (c *client) UpdateContact(id string, cards []Card) (res *UpdateContactResponse, err error) {
+func (c *client) UpdateContact(ctx context.Context, id string, cards []Card) (res *UpdateContactResponse, err error) {
 	reqBody := UpdateContactReq{
 		Cards: cards,
 	}
-	req, err := c.NewJSONRequest("PUT", "/contacts/"+id, reqBody)
+	req, err := c.NewJSONRequest(ctx, "PUT", "/contacts/"+id, reqBody)
 	if err != nil {
 		return
 	}
@@ -329,12 +330,12 @@ type UpdateContactGroupsResponse struct {
 	Response SingleIDResponse
 }
 
-func (c *client) AddContactGroups(groupID string, contactEmailIDs []string) (res *UpdateContactGroupsResponse, err error) {
-	return c.modifyContactGroups(groupID, addContactGroupsAction, contactEmailIDs)
+func (c *client) AddContactGroups(ctx context.Context, groupID string, contactEmailIDs []string) (res *UpdateContactGroupsResponse, err error) {
+	return c.modifyContactGroups(ctx, groupID, addContactGroupsAction, contactEmailIDs)
 }
 
-func (c *client) RemoveContactGroups(groupID string, contactEmailIDs []string) (res *UpdateContactGroupsResponse, err error) {
-	return c.modifyContactGroups(groupID, removeContactGroupsAction, contactEmailIDs)
+func (c *client) RemoveContactGroups(ctx context.Context, groupID string, contactEmailIDs []string) (res *UpdateContactGroupsResponse, err error) {
+	return c.modifyContactGroups(ctx, groupID, removeContactGroupsAction, contactEmailIDs)
 }
 
 const (
@@ -348,13 +349,13 @@ type ModifyContactGroupsReq struct {
 	ContactEmailIDs []string
 }
 
-func (c *client) modifyContactGroups(groupID string, modifyContactGroupsAction int, contactEmailIDs []string) (res *UpdateContactGroupsResponse, err error) {
+func (c *client) modifyContactGroups(ctx context.Context, groupID string, modifyContactGroupsAction int, contactEmailIDs []string) (res *UpdateContactGroupsResponse, err error) {
 	reqBody := ModifyContactGroupsReq{
 		LabelID:         groupID,
 		Action:          modifyContactGroupsAction,
 		ContactEmailIDs: contactEmailIDs,
 	}
-	req, err := c.NewJSONRequest("PUT", "/contacts/group", reqBody)
+	req, err := c.NewJSONRequest(ctx, "PUT", "/contacts/group", reqBody)
 	if err != nil {
 		return
 	}
@@ -372,12 +373,12 @@ type DeleteReq struct {
 }
 
 // DeleteContacts deletes contacts specified by an array of contact IDs.
-func (c *client) DeleteContacts(ids []string) (err error) {
+func (c *client) DeleteContacts(ctx context.Context, ids []string) (err error) {
 	deleteReq := DeleteReq{
 		IDs: ids,
 	}
 
-	req, err := c.NewJSONRequest("PUT", "/contacts/delete", deleteReq)
+	req, err := c.NewJSONRequest(ctx, "PUT", "/contacts/delete", deleteReq)
 	if err != nil {
 		return
 	}
@@ -401,8 +402,8 @@ func (c *client) DeleteContacts(ids []string) (err error) {
 }
 
 // DeleteAllContacts deletes all contacts.
-func (c *client) DeleteAllContacts() (err error) {
-	req, err := c.NewRequest("DELETE", "/contacts", nil)
+func (c *client) DeleteAllContacts(ctx context.Context) (err error) {
+	req, err := c.NewRequest(ctx, "DELETE", "/contacts", nil)
 	if err != nil {
 		return
 	}
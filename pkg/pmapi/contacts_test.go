@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -174,7 +175,7 @@ func TestContact_AddContact(t *testing.T) {
 	}))
 	defer s.Close()
 
-	created, err := c.AddContacts(testAddContactsReq.ContactsCards, 0, 0, 0)
+	created, err := c.AddContacts(context.Background(), testAddContactsReq.ContactsCards, 0, 0, 0)
 	if err != nil {
 		t.Fatal("Expected no error while adding contact, got:", err)
 	}
@@ -239,7 +240,7 @@ func TestContact_GetContacts(t *testing.T) {
 	}))
 	defer s.Close()
 
-	contacts, err := c.GetContacts(0, 1000)
+	contacts, err := c.GetContacts(context.Background(), 0, 1000)
 	if err != nil {
 		t.Fatal("Expected no error while getting contacts, got:", err)
 	}
@@ -328,7 +329,7 @@ func TestContact_GetContactById(t *testing.T) {
 	}))
 	defer s.Close()
 
-	contact, err := c.GetContactByID("s_SN9y1q0jczjYCH4zhvfOdHv1QNovKhnJ9bpDcTE0u7WCr2Z-NV9uubHXvOuRozW-HRVam6bQupVYRMC3BCqg==")
+	contact, err := c.GetContactByID(context.Background(), "s_SN9y1q0jczjYCH4zhvfOdHv1QNovKhnJ9bpDcTE0u7WCr2Z-NV9uubHXvOuRozW-HRVam6bQupVYRMC3BCqg==")
 	if err != nil {
 		t.Fatal("Expected no error while getting contacts, got:", err)
 	}
@@ -416,7 +417,7 @@ func TestContact_GetContactsForExport(t *testing.T) {
 	}))
 	defer s.Close()
 
-	contacts, err := c.GetContactsForExport(0, 1000)
+	contacts, err := c.GetContactsForExport(context.Background(), 0, 1000)
 	if err != nil {
 		t.Fatal("Expected no error while getting contacts for export, got:", err)
 	}
@@ -484,7 +485,7 @@ func TestContact_GetAllContactsEmails(t *testing.T) {
 	}))
 	defer s.Close()
 
-	contactsEmails, err := c.GetAllContactsEmails(0, 1000)
+	contactsEmails, err := c.GetAllContactsEmails(context.Background(), 0, 1000)
 	if err != nil {
 		t.Fatal("Expected no error while getting contacts for export, got:", err)
 	}
@@ -551,7 +552,7 @@ func TestContact_UpdateContact(t *testing.T) {
 	}))
 	defer s.Close()
 
-	created, err := c.UpdateContact("l4PrVkmDsIIDba9aln829uwPK0nnyWZHnFtrsyb7CJsYgrD6JTVTuuoaVmaANfO2jIVxzZ2vtbt74rznGjjwFQ==", testUpdateContactReq.Cards)
+	created, err := c.UpdateContact(context.Background(), "l4PrVkmDsIIDba9aln829uwPK0nnyWZHnFtrsyb7CJsYgrD6JTVTuuoaVmaANfO2jIVxzZ2vtbt74rznGjjwFQ==", testUpdateContactReq.Cards)
 	if err != nil {
 		t.Fatal("Expected no error while updating contact, got:", err)
 	}
@@ -595,7 +596,7 @@ func TestContact_DeleteContacts(t *testing.T) {
 	}))
 	defer s.Close()
 
-	err := c.DeleteContacts([]string{"s_SN9y1q0jczjYCH4zhvfOdHv1QNovKhnJ9bpDcTE0u7WCr2Z-NV9uubHXvOuRozW-HRVam6bQupVYRMC3BCqg=="})
+	err := c.DeleteContacts(context.Background(), []string{"s_SN9y1q0jczjYCH4zhvfOdHv1QNovKhnJ9bpDcTE0u7WCr2Z-NV9uubHXvOuRozW-HRVam6bQupVYRMC3BCqg=="})
 	if err != nil {
 		t.Fatal("Expected no error while getting contacts for export, got:", err)
 	}
@@ -613,7 +614,7 @@ func TestContact_DeleteAllContacts(t *testing.T) {
 	}))
 	defer s.Close()
 
-	err := c.DeleteAllContacts()
+	err := c.DeleteAllContacts(context.Background())
 	if err != nil {
 		t.Fatal("Expected no error while getting contacts for export, got:", err)
 	}
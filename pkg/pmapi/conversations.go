@@ -17,6 +17,8 @@
 
 package pmapi
 
+import "context"
+
 // ConversationsCount have same structure as MessagesCount.
 type ConversationsCount MessagesCount
 
@@ -31,12 +33,12 @@ type ConversationsCountsRes struct {
 type Conversation struct{}
 
 // CountConversations counts conversations by label.
-func (c *client) CountConversations(addressID string) (counts []*ConversationsCount, err error) {
+func (c *client) CountConversations(ctx context.Context, addressID string) (counts []*ConversationsCount, err error) {
 	reqURL := "/conversations/count"
 	if addressID != "" {
 		reqURL += ("?AddressID=" + addressID)
 	}
-	req, err := c.NewRequest("GET", reqURL, nil)
+	req, err := c.NewRequest(ctx, "GET", reqURL, nil)
 	if err != nil {
 		return
 	}
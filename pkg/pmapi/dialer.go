@@ -33,7 +33,13 @@ func CreateTransportWithDialer(dialer TLSDialer) *http.Transport {
 	return &http.Transport{
 		DialTLS: dialer.DialTLS,
 
-		Proxy:                 http.ProxyFromEnvironment,
+		// Upstream proxy is not set as transport Proxy because transport would
+		// then bypass DialTLS. The tunnel is opened by dialers instead so that
+		// pinning and alternative routing are used also behind a proxy.
+		Dial: func(network, address string) (net.Conn, error) {
+			return dialUpstream(&net.Dialer{Timeout: 30 * time.Second}, network, address)
+		},
+
 		MaxIdleConns:          100,
 		IdleConnTimeout:       5 * time.Minute,
 		ExpectContinueTimeout: 500 * time.Millisecond,
@@ -61,12 +67,31 @@ func NewBasicTLSDialer() *BasicTLSDialer {
 func (b *BasicTLSDialer) DialTLS(network, address string) (conn net.Conn, err error) {
 	dialer := &net.Dialer{Timeout: 30 * time.Second} // Alternative Routes spec says this should be a 30s timeout.
 
-	var tlsConfig *tls.Config = nil
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return
+	}
+
+	tlsConfig := &tls.Config{ServerName: host}
 
 	// If we are not dialing the standard API then we should skip cert verification checks.
 	if address != rootURL {
-		tlsConfig = &tls.Config{InsecureSkipVerify: true} // nolint[gosec]
+		tlsConfig.InsecureSkipVerify = true // nolint[gosec]
+	}
+
+	rawConn, err := dialUpstream(dialer, network, address)
+	if err != nil {
+		return
+	}
+
+	tlsConn := tls.Client(rawConn, tlsConfig)
+
+	_ = tlsConn.SetDeadline(time.Now().Add(dialer.Timeout))
+	if err = tlsConn.Handshake(); err != nil {
+		_ = rawConn.Close()
+		return nil, err
 	}
+	_ = tlsConn.SetDeadline(time.Time{})
 
-	return tls.DialWithDialer(dialer, network, address, tlsConfig)
+	return tlsConn, nil
 }
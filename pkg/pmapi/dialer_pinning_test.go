@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -49,7 +50,7 @@ func TestTLSPinValid(t *testing.T) {
 	called, _ := createAndSetPinningDialer(cm)
 	client := cm.GetClient("pmapi" + t.Name())
 
-	_, err := client.AuthInfo("this.address.is.disabled")
+	_, err := client.AuthInfo(context.Background(), "this.address.is.disabled")
 	Ok(t, err)
 
 	Equals(t, 0, *called)
@@ -64,7 +65,7 @@ func TestTLSPinBackup(t *testing.T) {
 
 	client := cm.GetClient("pmapi" + t.Name())
 
-	_, err := client.AuthInfo("this.address.is.disabled")
+	_, err := client.AuthInfo(context.Background(), "this.address.is.disabled")
 	Ok(t, err)
 
 	Equals(t, 0, *called)
@@ -81,12 +82,12 @@ func _TestTLSPinNoMatch(t *testing.T) { // nolint[unused]
 
 	client := cm.GetClient("pmapi" + t.Name())
 
-	_, err := client.AuthInfo("this.address.is.disabled")
+	_, err := client.AuthInfo(context.Background(), "this.address.is.disabled")
 	Ok(t, err)
 
 	// check that it will be called only once per session
 	client = cm.GetClient("pmapi" + t.Name())
-	_, err = client.AuthInfo("this.address.is.disabled")
+	_, err = client.AuthInfo(context.Background(), "this.address.is.disabled")
 	Ok(t, err)
 
 	Equals(t, 1, *called)
@@ -105,11 +106,11 @@ func _TestTLSPinInvalid(t *testing.T) { // nolint[unused]
 	client := cm.GetClient("pmapi" + t.Name())
 
 	cm.host = liveAPI
-	_, err := client.AuthInfo("this.address.is.disabled")
+	_, err := client.AuthInfo(context.Background(), "this.address.is.disabled")
 	Ok(t, err)
 
 	cm.host = ts.URL
-	_, err = client.AuthInfo("this.address.is.disabled")
+	_, err = client.AuthInfo(context.Background(), "this.address.is.disabled")
 	Assert(t, err != nil, "error is expected but have %v", err)
 
 	Equals(t, 1, *called)
@@ -42,7 +42,7 @@ func (d *ProxyTLSDialer) DialTLS(network, address string) (conn net.Conn, err er
 		return
 	}
 
-	if !d.cm.allowProxy {
+	if !d.cm.canSwitchHost() {
 		return
 	}
 
@@ -0,0 +1,181 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+var (
+	// upstreamProxy is the proxy set in settings. When nil, the proxy is taken from environment.
+	upstreamProxy     *url.URL     //nolint[gochecknoglobals]
+	upstreamProxyLock sync.RWMutex //nolint[gochecknoglobals]
+)
+
+// SetUpstreamProxy sets the HTTP, HTTPS or SOCKS5 proxy through which all
+// connections to API are made, including DoH queries and alternative routing.
+// Credentials can be part of the URL. When empty, the proxy is taken from
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+func SetUpstreamProxy(rawURL string) error {
+	proxyURL, err := ParseUpstreamProxy(rawURL)
+	if err != nil {
+		return err
+	}
+
+	upstreamProxyLock.Lock()
+	defer upstreamProxyLock.Unlock()
+
+	upstreamProxy = proxyURL
+	return nil
+}
+
+// ParseUpstreamProxy validates the proxy URL. It returns nil for empty URL.
+func ParseUpstreamProxy(rawURL string) (*url.URL, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid proxy URL")
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, use http, https or socks5", proxyURL.Scheme)
+	}
+
+	if proxyURL.Hostname() == "" {
+		return nil, errors.New("proxy URL has no host")
+	}
+
+	return proxyURL, nil
+}
+
+// proxyForRequest returns the proxy set in settings or from environment.
+// It is used by transports which do not dial through a TLSDialer.
+func proxyForRequest(req *http.Request) (*url.URL, error) {
+	upstreamProxyLock.RLock()
+	defer upstreamProxyLock.RUnlock()
+
+	if upstreamProxy != nil {
+		return upstreamProxy, nil
+	}
+
+	return http.ProxyFromEnvironment(req)
+}
+
+// dialUpstream opens a connection to the address, tunnelled through
+// the upstream proxy if there is any.
+func dialUpstream(dialer *net.Dialer, network, address string) (net.Conn, error) {
+	proxyURL, err := proxyForRequest(&http.Request{URL: &url.URL{Scheme: "https", Host: address}})
+	if err != nil {
+		return nil, err
+	}
+
+	if proxyURL == nil {
+		return dialer.Dial(network, address)
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		socksDialer, err := proxy.FromURL(proxyURL, dialer)
+		if err != nil {
+			return nil, err
+		}
+		return socksDialer.Dial(network, address)
+
+	default:
+		return dialHTTPProxy(dialer, proxyURL, address)
+	}
+}
+
+// dialHTTPProxy opens a tunnel to the address using HTTP CONNECT method.
+func dialHTTPProxy(dialer *net.Dialer, proxyURL *url.URL, address string) (conn net.Conn, err error) {
+	proxyAddress := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddress = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+
+	if proxyURL.Scheme == "https" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", proxyAddress, &tls.Config{ServerName: proxyURL.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", proxyAddress)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to proxy")
+	}
+
+	if dialer.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(dialer.Timeout))
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err = req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "failed to write CONNECT request")
+	}
+
+	// Server does not send anything else before the client starts TLS
+	// handshake, therefore nothing is lost in the buffered reader.
+	res, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "failed to read CONNECT response")
+	}
+	_ = res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy refused connection: %s", res.Status)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
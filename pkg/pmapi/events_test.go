@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/mail"
@@ -37,7 +38,7 @@ func TestClient_GetEvent(t *testing.T) {
 	}))
 	defer s.Close()
 
-	event, err := c.GetEvent("")
+	event, err := c.GetEvent(context.Background(), "")
 	require.NoError(t, err)
 	require.Equal(t, testEvent, event)
 }
@@ -49,7 +50,7 @@ func TestClient_GetEvent_withID(t *testing.T) {
 	}))
 	defer s.Close()
 
-	event, err := c.GetEvent(testEvent.EventID)
+	event, err := c.GetEvent(context.Background(), testEvent.EventID)
 	require.NoError(t, err)
 	require.Equal(t, testEvent, event)
 }
@@ -70,7 +71,7 @@ func TestClient_GetEvent_mergeEvents(t *testing.T) {
 	}))
 	defer s.Close()
 
-	event, err := c.GetEvent("eventID1")
+	event, err := c.GetEvent(context.Background(), "eventID1")
 	require.NoError(t, err)
 	require.Equal(t, testEventMerged, event)
 }
@@ -97,7 +98,7 @@ func TestClient_GetEvent_mergeMaxNumberOfEvents(t *testing.T) {
 	}))
 	defer s.Close()
 
-	event, err := c.GetEvent("eventID1")
+	event, err := c.GetEvent(context.Background(), "eventID1")
 	require.NoError(t, err)
 	require.Equal(t, maxNumberOfMergedEvents, numberOfCalls)
 	require.Equal(t, 1, event.More)
@@ -15,9 +15,10 @@
 // You should have received a copy of the GNU General Public License
 // along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
 
-package fakeapi
+package fakeserver
 
 import (
+	"context"
 	"encoding/base64"
 	"io"
 	"io/ioutil"
@@ -26,7 +27,7 @@ import (
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
-func (api *FakePMAPI) GetAttachment(attachmentID string) (io.ReadCloser, error) {
+func (api *FakePMAPI) GetAttachment(_ context.Context, attachmentID string) (io.ReadCloser, error) {
 	if err := api.checkAndRecordCall(GET, "/attachments/"+attachmentID, nil); err != nil {
 		return nil, err
 	}
@@ -34,7 +35,7 @@ func (api *FakePMAPI) GetAttachment(attachmentID string) (io.ReadCloser, error)
 	return ioutil.NopCloser(data), nil
 }
 
-func (api *FakePMAPI) CreateAttachment(attachment *pmapi.Attachment, data io.Reader, signature io.Reader) (*pmapi.Attachment, error) {
+func (api *FakePMAPI) CreateAttachment(_ context.Context, attachment *pmapi.Attachment, data io.Reader, signature io.Reader) (*pmapi.Attachment, error) {
 	if err := api.checkAndRecordCall(POST, "/attachments", nil); err != nil {
 		return nil, err
 	}
@@ -46,7 +47,7 @@ func (api *FakePMAPI) CreateAttachment(attachment *pmapi.Attachment, data io.Rea
 	return attachment, nil
 }
 
-func (api *FakePMAPI) DeleteAttachment(attID string) error {
+func (api *FakePMAPI) DeleteAttachment(_ context.Context, attID string) error {
 	if err := api.checkAndRecordCall(DELETE, "/attachments/"+attID, nil); err != nil {
 		return err
 	}
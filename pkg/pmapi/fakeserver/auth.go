@@ -15,9 +15,10 @@
 // You should have received a copy of the GNU General Public License
 // along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
 
-package fakeapi
+package fakeserver
 
 import (
+	"context"
 	"strings"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
@@ -27,7 +28,7 @@ func (api *FakePMAPI) SetAuths(auths chan<- *pmapi.Auth) {
 	api.auths = auths
 }
 
-func (api *FakePMAPI) AuthInfo(username string) (*pmapi.AuthInfo, error) {
+func (api *FakePMAPI) AuthInfo(_ context.Context, username string) (*pmapi.AuthInfo, error) {
 	if err := api.checkInternetAndRecordCall(POST, "/auth/info", &pmapi.AuthInfoReq{
 		Username: username,
 	}); err != nil {
@@ -44,7 +45,7 @@ func (api *FakePMAPI) AuthInfo(username string) (*pmapi.AuthInfo, error) {
 	return authInfo, nil
 }
 
-func (api *FakePMAPI) Auth(username, password string, authInfo *pmapi.AuthInfo) (*pmapi.Auth, error) {
+func (api *FakePMAPI) Auth(_ context.Context, username, password string, authInfo *pmapi.AuthInfo) (*pmapi.Auth, error) {
 	if err := api.checkInternetAndRecordCall(POST, "/auth", &pmapi.AuthReq{
 		Username: username,
 	}); err != nil {
@@ -74,7 +75,7 @@ func (api *FakePMAPI) Auth(username, password string, authInfo *pmapi.AuthInfo)
 	return auth, nil
 }
 
-func (api *FakePMAPI) Auth2FA(twoFactorCode string, auth *pmapi.Auth) (*pmapi.Auth2FA, error) {
+func (api *FakePMAPI) Auth2FA(_ context.Context, twoFactorCode string, auth *pmapi.Auth) (*pmapi.Auth2FA, error) {
 	if err := api.checkInternetAndRecordCall(POST, "/auth/2fa", &pmapi.Auth2FAReq{
 		TwoFactorCode: twoFactorCode,
 	}); err != nil {
@@ -97,7 +98,7 @@ func (api *FakePMAPI) Auth2FA(twoFactorCode string, auth *pmapi.Auth) (*pmapi.Au
 	}, nil
 }
 
-func (api *FakePMAPI) AuthRefresh(token string) (*pmapi.Auth, error) {
+func (api *FakePMAPI) AuthRefresh(_ context.Context, token string) (*pmapi.Auth, error) {
 	if api.lastToken == "" {
 		api.lastToken = token
 	}
@@ -147,7 +148,7 @@ func (api *FakePMAPI) AuthRefresh(token string) (*pmapi.Auth, error) {
 	return auth, nil
 }
 
-func (api *FakePMAPI) AuthSalt() (string, error) {
+func (api *FakePMAPI) AuthSalt(_ context.Context) (string, error) {
 	if err := api.checkInternetAndRecordCall(GET, "/keys/salts", nil); err != nil {
 		return "", err
 	}
@@ -155,6 +156,17 @@ func (api *FakePMAPI) AuthSalt() (string, error) {
 	return "", nil
 }
 
+// fakeModulus is a real modulus signed by the API so that SRP verifiers can be generated with it.
+const fakeModulus = "-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA256\n\nW2z5HBi8RvsfYzZTS7qBaUxxPhsfHJFZpu3Kd6s1JafNrCCH9rfvPLrfuqocxWPgWDH2R8neK7PkNvjxto9TStuY5z7jAzWRvFWN9cQhAKkdWgy0JY6ywVn22+HFpF4cYesHrqFIKUPDMSSIlWjBVmEJZ/MusD44ZT29xcPrOqeZvwtCffKtGAIjLYPZIEbZKnDM1Dm3q2K/xS5h+xdhjnndhsrkwm9U9oyA2wxzSXFL+pdfj2fOdRwuR5nW0J2NFrq3kJjkRmpO/Genq1UW+TEknIWAb6VzJJJA244K/H8cnSx2+nSNZO3bbo6Ys228ruV9A8m6DhxmS+bihN3ttQ==\n-----BEGIN PGP SIGNATURE-----\nVersion: ProtonMail\nComment: https://protonmail.com\n\nwl4EARYIABAFAlwB1j0JEDUFhcTpUY8mAAD8CgEAnsFnF4cF0uSHKkXa1GIa\nGO86yMV4zDZEZcDSJo0fgr8A/AlupGN9EdHlsrZLmTA1vhIx+rOgxdEff28N\nkvNM7qIK\n=q6vu\n-----END PGP SIGNATURE-----\n"
+
+func (api *FakePMAPI) AuthModulus(_ context.Context) (*pmapi.AuthModulus, error) {
+	if err := api.checkAndRecordCall(GET, "/auth/modulus", nil); err != nil {
+		return nil, err
+	}
+
+	return &pmapi.AuthModulus{Modulus: fakeModulus, ModulusID: "fakeModulusID"}, nil
+}
+
 func (api *FakePMAPI) Logout() {
 	api.controller.clientManager.LogoutClient(api.userID)
 }
@@ -163,7 +175,7 @@ func (api *FakePMAPI) IsConnected() bool {
 	return api.uid != "" && api.lastToken != ""
 }
 
-func (api *FakePMAPI) DeleteAuth() error {
+func (api *FakePMAPI) DeleteAuth(_ context.Context) error {
 	if err := api.checkAndRecordCall(DELETE, "/auth", nil); err != nil {
 		return err
 	}
@@ -0,0 +1,54 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package fakeserver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+func (api *FakePMAPI) ListCalendars(_ context.Context) ([]*pmapi.Calendar, error) {
+	if err := api.checkAndRecordCall(GET, "/calendar/v1", nil); err != nil {
+		return nil, err
+	}
+	return []*pmapi.Calendar{}, nil
+}
+
+func (api *FakePMAPI) ListCalendarEvents(_ context.Context, calendarID string, filter *pmapi.CalendarEventsFilter) ([]*pmapi.CalendarEvent, error) {
+	if err := api.checkAndRecordCall(GET, "/calendar/v1/"+calendarID+"/events", nil); err != nil {
+		return nil, err
+	}
+	return []*pmapi.CalendarEvent{}, nil
+}
+
+func (api *FakePMAPI) GetCalendarEvent(_ context.Context, calendarID, eventID string) (*pmapi.CalendarEvent, error) {
+	if err := api.checkAndRecordCall(GET, "/calendar/v1/"+calendarID+"/events/"+eventID, nil); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("event %s does not exist", eventID)
+}
+
+func (api *FakePMAPI) KeyRingForCalendarID(_ context.Context, calendarID string) (*crypto.KeyRing, error) {
+	if err := api.checkAndRecordCall(GET, "/calendar/v1/"+calendarID+"/keys", nil); err != nil {
+		return nil, err
+	}
+	return nil, pmapi.ErrNoKeyringAvailable
+}
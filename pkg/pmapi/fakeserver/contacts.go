@@ -0,0 +1,86 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package fakeserver
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+func (api *FakePMAPI) DecryptAndVerifyCards(cards []pmapi.Card) ([]pmapi.Card, error) {
+	return cards, nil
+}
+
+func (api *FakePMAPI) EncryptAndSignCards(cards []pmapi.Card) ([]pmapi.Card, error) {
+	return cards, nil
+}
+
+func (api *FakePMAPI) GetAllContactsEmails(_ context.Context, page int, pageSize int) ([]pmapi.ContactEmail, error) {
+	v := url.Values{}
+	v.Set("Page", strconv.Itoa(page))
+	if pageSize > 0 {
+		v.Set("PageSize", strconv.Itoa(pageSize))
+	}
+	if err := api.checkAndRecordCall(GET, "/contacts/emails?"+v.Encode(), nil); err != nil {
+		return nil, err
+	}
+	return []pmapi.ContactEmail{}, nil
+}
+
+func (api *FakePMAPI) GetContactEmailByEmail(_ context.Context, email string, page int, pageSize int) ([]pmapi.ContactEmail, error) {
+	v := url.Values{}
+	v.Set("Page", strconv.Itoa(page))
+	if pageSize > 0 {
+		v.Set("PageSize", strconv.Itoa(pageSize))
+	}
+	v.Set("Email", email)
+	if err := api.checkAndRecordCall(GET, "/contacts/emails?"+v.Encode(), nil); err != nil {
+		return nil, err
+	}
+	return []pmapi.ContactEmail{}, nil
+}
+
+func (api *FakePMAPI) GetContactByID(_ context.Context, contactID string) (pmapi.Contact, error) {
+	if err := api.checkAndRecordCall(GET, "/contacts/"+contactID, nil); err != nil {
+		return pmapi.Contact{}, err
+	}
+	return pmapi.Contact{}, fmt.Errorf("contact %s does not exist", contactID)
+}
+
+func (api *FakePMAPI) AddContacts(_ context.Context, cards pmapi.ContactsCards, overwrite int, groups int, labels int) (*pmapi.AddContactsResponse, error) {
+	if err := api.checkAndRecordCall(POST, "/contacts", &pmapi.AddContactsReq{
+		ContactsCards: cards,
+		Overwrite:     overwrite,
+		Groups:        groups,
+		Labels:        labels,
+	}); err != nil {
+		return nil, err
+	}
+	return &pmapi.AddContactsResponse{}, nil
+}
+
+func (api *FakePMAPI) UpdateContact(_ context.Context, contactID string, cards []pmapi.Card) (*pmapi.UpdateContactResponse, error) {
+	if err := api.checkAndRecordCall(PUT, "/contacts/"+contactID, &pmapi.UpdateContactReq{Cards: cards}); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("contact %s does not exist", contactID)
+}
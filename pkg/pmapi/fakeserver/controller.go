@@ -15,7 +15,7 @@
 // You should have received a copy of the GNU General Public License
 // along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
 
-package fakeapi
+package fakeserver
 
 import (
 	"sync"
@@ -32,6 +32,7 @@ type Controller struct {
 	labelIDGenerator   idGenerator
 	messageIDGenerator idGenerator
 	tokenGenerator     idGenerator
+	userIDGenerator    idGenerator
 	clientManager      *pmapi.ClientManager
 
 	// State controlled by test.
@@ -64,7 +65,7 @@ func NewController(cm *pmapi.ClientManager) *Controller {
 		messagesByUsername:   map[string][]*pmapi.Message{},
 
 		locker: &sync.Mutex{},
-		log:    logrus.WithField("pkg", "fakeapi-controller"),
+		log:    logrus.WithField("pkg", "fakeserver-controller"),
 	}
 
 	cm.SetClientConstructor(func(userID string) pmapi.Client {
@@ -15,13 +15,15 @@
 // You should have received a copy of the GNU General Public License
 // along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
 
-package fakeapi
+package fakeserver
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
@@ -51,7 +53,7 @@ func (ctl *Controller) ReorderAddresses(user *pmapi.User, addressIDs []string) e
 		return errors.New("no such user")
 	}
 
-	return api.ReorderAddresses(addressIDs)
+	return api.ReorderAddresses(context.Background(), addressIDs)
 }
 
 func (ctl *Controller) AddUser(user *pmapi.User, addresses *pmapi.AddressList, password string, twoFAEnabled bool) error {
@@ -64,6 +66,72 @@ func (ctl *Controller) AddUser(user *pmapi.User, addresses *pmapi.AddressList, p
 	return nil
 }
 
+// CreateUser adds the user with one address and newly generated keys.
+// Keys are locked by the password which is used for login and as mailbox
+// password. It returns also the unlocked address key ring so the test can
+// encrypt bodies of messages added by AddUserMessage.
+func (ctl *Controller) CreateUser(username, email, password string) (*pmapi.User, *pmapi.AddressList, *crypto.KeyRing, error) {
+	userKeys, err := newLockedKeys(username, email, password)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	addressKeys, err := newLockedKeys(username, email, password)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	addressKeyRing, err := addressKeys.UnlockAll([]byte(password), nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	user := &pmapi.User{
+		ID:   ctl.userIDGenerator.next("user"),
+		Name: username,
+		Keys: userKeys,
+	}
+	addresses := &pmapi.AddressList{{
+		ID:          ctl.userIDGenerator.next("address"),
+		Email:       email,
+		Send:        1,
+		Receive:     1,
+		Status:      1,
+		Order:       1,
+		Type:        1,
+		DisplayName: username,
+		HasKeys:     1,
+		Keys:        addressKeys,
+	}}
+
+	if err := ctl.AddUser(user, addresses, password, false); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return user, addresses, addressKeyRing, nil
+}
+
+func newLockedKeys(name, email, password string) (pmapi.PMKeys, error) {
+	key, err := crypto.GenerateKey(name, email, "x25519", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	locked, err := key.Lock([]byte(password))
+	if err != nil {
+		return nil, err
+	}
+
+	return pmapi.PMKeys{{
+		ID:          key.GetFingerprint(),
+		Version:     3,
+		Flags:       3,
+		Fingerprint: key.GetFingerprint(),
+		PrivateKey:  locked,
+		Primary:     1,
+	}}, nil
+}
+
 func (ctl *Controller) AddUserLabel(username string, label *pmapi.Label) error {
 	if _, ok := ctl.labelsByUsername[username]; !ok {
 		ctl.labelsByUsername[username] = []*pmapi.Label{}
@@ -15,11 +15,15 @@
 // You should have received a copy of the GNU General Public License
 // along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
 
-package fakeapi
+package fakeserver
 
-import "github.com/ProtonMail/proton-bridge/pkg/pmapi"
+import (
+	"context"
 
-func (api *FakePMAPI) CountMessages(addressID string) ([]*pmapi.MessagesCount, error) {
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+func (api *FakePMAPI) CountMessages(_ context.Context, addressID string) ([]*pmapi.MessagesCount, error) {
 	if err := api.checkAndRecordCall(GET, "/messages/count?AddressID="+addressID, nil); err != nil {
 		return nil, err
 	}
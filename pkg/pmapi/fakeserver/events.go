@@ -15,13 +15,15 @@
 // You should have received a copy of the GNU General Public License
 // along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
 
-package fakeapi
+package fakeserver
 
 import (
+	"context"
+
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
-func (api *FakePMAPI) GetEvent(eventID string) (*pmapi.Event, error) {
+func (api *FakePMAPI) GetEvent(_ context.Context, eventID string) (*pmapi.Event, error) {
 	if err := api.checkAndRecordCall(GET, "/events/"+eventID, nil); err != nil {
 		return nil, err
 	}
@@ -15,9 +15,13 @@
 // You should have received a copy of the GNU General Public License
 // along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
 
-package fakeapi
+// Package fakeserver is an in-memory fake of the ProtonMail API. Controller
+// sets clients created by the client manager to fakes which share users,
+// labels and messages set up by the test, and records all calls.
+package fakeserver
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -52,7 +56,7 @@ type FakePMAPI struct {
 func New(controller *Controller, userID string) *FakePMAPI {
 	fakePMAPI := &FakePMAPI{
 		controller:  controller,
-		log:         logrus.WithField("pkg", "fakeapi"),
+		log:         logrus.WithField("pkg", "fakeserver"),
 		userID:      userID,
 		addrKeyRing: make(map[string]*crypto.KeyRing),
 	}
@@ -81,7 +85,7 @@ func (api *FakePMAPI) checkAndRecordCall(method method, path string, request int
 	// Try re-auth
 	if api.uid == "" && api.lastToken != "" {
 		api.log.WithField("lastToken", api.lastToken).Warn("Handling unauthorized status")
-		if _, err := api.AuthRefresh(api.lastToken); err != nil {
+		if _, err := api.AuthRefresh(context.Background(), api.lastToken); err != nil {
 			return err
 		}
 	}
@@ -15,9 +15,10 @@
 // You should have received a copy of the GNU General Public License
 // along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
 
-package fakeapi
+package fakeserver
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
@@ -32,19 +33,19 @@ func (api *FakePMAPI) isLabelFolder(labelID string) bool {
 	return labelID == pmapi.InboxLabel || labelID == pmapi.ArchiveLabel || labelID == pmapi.SentLabel
 }
 
-func (api *FakePMAPI) ListLabels() ([]*pmapi.Label, error) {
+func (api *FakePMAPI) ListLabels(_ context.Context) ([]*pmapi.Label, error) {
 	if err := api.checkAndRecordCall(GET, "/labels/1", nil); err != nil {
 		return nil, err
 	}
 	return api.labels, nil
 }
 
-func (api *FakePMAPI) CreateLabel(label *pmapi.Label) (*pmapi.Label, error) {
+func (api *FakePMAPI) CreateLabel(_ context.Context, label *pmapi.Label) (*pmapi.Label, error) {
 	if err := api.checkAndRecordCall(POST, "/labels", &pmapi.LabelReq{Label: label}); err != nil {
 		return nil, err
 	}
 	for _, existingLabel := range api.labels {
-		if existingLabel.Name == label.Name {
+		if existingLabel.Name == label.Name && existingLabel.ParentID == label.ParentID {
 			return nil, fmt.Errorf("folder or label %s already exists", label.Name)
 		}
 	}
@@ -58,7 +59,7 @@ func (api *FakePMAPI) CreateLabel(label *pmapi.Label) (*pmapi.Label, error) {
 	return label, nil
 }
 
-func (api *FakePMAPI) UpdateLabel(label *pmapi.Label) (*pmapi.Label, error) {
+func (api *FakePMAPI) UpdateLabel(_ context.Context, label *pmapi.Label) (*pmapi.Label, error) {
 	if err := api.checkAndRecordCall(PUT, "/labels", &pmapi.LabelReq{Label: label}); err != nil {
 		return nil, err
 	}
@@ -75,7 +76,7 @@ func (api *FakePMAPI) UpdateLabel(label *pmapi.Label) (*pmapi.Label, error) {
 	return nil, fmt.Errorf("label %s does not exist", label.ID)
 }
 
-func (api *FakePMAPI) DeleteLabel(labelID string) error {
+func (api *FakePMAPI) DeleteLabel(_ context.Context, labelID string) error {
 	if err := api.checkAndRecordCall(DELETE, "/labels/"+labelID, nil); err != nil {
 		return err
 	}
@@ -15,13 +15,15 @@
 // You should have received a copy of the GNU General Public License
 // along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
 
-package fakeapi
+package fakeserver
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
@@ -30,7 +32,7 @@ import (
 
 var errWasNotUpdated = errors.New("message was not updated")
 
-func (api *FakePMAPI) GetMessage(apiID string) (*pmapi.Message, error) {
+func (api *FakePMAPI) GetMessage(_ context.Context, apiID string) (*pmapi.Message, error) {
 	if err := api.checkAndRecordCall(GET, "/messages/"+apiID, nil); err != nil {
 		return nil, err
 	}
@@ -50,7 +52,7 @@ func (api *FakePMAPI) GetMessage(apiID string) (*pmapi.Message, error) {
 //  * ID
 //  * Attachments
 //  * AutoWildcard
-func (api *FakePMAPI) ListMessages(filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+func (api *FakePMAPI) ListMessages(_ context.Context, filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
 	if err := api.checkAndRecordCall(GET, "/messages", filter); err != nil {
 		return nil, 0, err
 	}
@@ -151,7 +153,7 @@ func copyFilteredMessage(message *pmapi.Message) *pmapi.Message {
 	return filteredMessage
 }
 
-func (api *FakePMAPI) CreateDraft(message *pmapi.Message, parentID string, action int) (*pmapi.Message, error) {
+func (api *FakePMAPI) CreateDraft(_ context.Context, message *pmapi.Message, parentID string, action int) (*pmapi.Message, error) {
 	if err := api.checkAndRecordCall(POST, "/messages", &pmapi.DraftReq{
 		Message:              message,
 		ParentID:             parentID,
@@ -161,13 +163,16 @@ func (api *FakePMAPI) CreateDraft(message *pmapi.Message, parentID string, actio
 		return nil, err
 	}
 	if parentID != "" {
-		if _, err := api.GetMessage(parentID); err != nil {
+		if _, err := api.GetMessage(context.Background(), parentID); err != nil {
 			return nil, err
 		}
 	}
 	if message.Subject == "" {
 		message.Subject = "(No Subject)"
 	}
+	if message.ExternalID == "" && message.Header != nil {
+		message.ExternalID = strings.Trim(message.Header.Get("Message-Id"), "<>")
+	}
 	message.LabelIDs = append(message.LabelIDs, pmapi.DraftLabel)
 	message.LabelIDs = append(message.LabelIDs, pmapi.AllMailLabel)
 	message.ID = api.controller.messageIDGenerator.next("")
@@ -175,11 +180,38 @@ func (api *FakePMAPI) CreateDraft(message *pmapi.Message, parentID string, actio
 	return message, nil
 }
 
-func (api *FakePMAPI) SendMessage(messageID string, sendMessageRequest *pmapi.SendMessageReq) (sent, parent *pmapi.Message, err error) {
+func (api *FakePMAPI) UpdateDraft(_ context.Context, messageID string, message *pmapi.Message) (*pmapi.Message, error) {
+	if err := api.checkAndRecordCall(PUT, "/messages/"+messageID, &pmapi.UpdateDraftReq{
+		Message: message,
+	}); err != nil {
+		return nil, err
+	}
+	for _, draft := range api.messages {
+		if draft.ID != messageID {
+			continue
+		}
+		if !draft.IsDraft() {
+			return nil, errors.New("message is not a draft")
+		}
+		draft.Subject = message.Subject
+		draft.Sender = message.Sender
+		draft.ToList = message.ToList
+		draft.CCList = message.CCList
+		draft.BCCList = message.BCCList
+		draft.Header = message.Header
+		draft.Body = message.Body
+		draft.MIMEType = message.MIMEType
+		api.addEventMessage(pmapi.EventUpdate, draft)
+		return draft, nil
+	}
+	return nil, fmt.Errorf("draft %s does not exist", messageID)
+}
+
+func (api *FakePMAPI) SendMessage(_ context.Context, messageID string, sendMessageRequest *pmapi.SendMessageReq) (sent, parent *pmapi.Message, err error) {
 	if err := api.checkAndRecordCall(POST, "/messages/"+messageID, sendMessageRequest); err != nil {
 		return nil, nil, err
 	}
-	message, err := api.GetMessage(messageID)
+	message, err := api.GetMessage(context.Background(), messageID)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "draft does not exist")
 	}
@@ -189,7 +221,7 @@ func (api *FakePMAPI) SendMessage(messageID string, sendMessageRequest *pmapi.Se
 	return message, nil, nil
 }
 
-func (api *FakePMAPI) Import(importMessageRequests []*pmapi.ImportMsgReq) ([]*pmapi.ImportMsgRes, error) {
+func (api *FakePMAPI) Import(_ context.Context, importMessageRequests []*pmapi.ImportMsgReq) ([]*pmapi.ImportMsgRes, error) {
 	if err := api.checkAndRecordCall(POST, "/import", importMessageRequests); err != nil {
 		return nil, err
 	}
@@ -249,7 +281,7 @@ func (api *FakePMAPI) addMessage(message *pmapi.Message) {
 	api.addEventMessage(pmapi.EventCreate, message)
 }
 
-func (api *FakePMAPI) DeleteMessages(apiIDs []string) error {
+func (api *FakePMAPI) DeleteMessages(_ context.Context, apiIDs []string) error {
 	err := api.deleteMessages(PUT, "/messages/delete", &pmapi.MessagesActionReq{
 		IDs: apiIDs,
 	}, func(message *pmapi.Message) bool {
@@ -266,7 +298,7 @@ func (api *FakePMAPI) DeleteMessages(apiIDs []string) error {
 	return nil
 }
 
-func (api *FakePMAPI) EmptyFolder(labelID string, addressID string) error {
+func (api *FakePMAPI) EmptyFolder(_ context.Context, labelID string, addressID string) error {
 	err := api.deleteMessages(DELETE, "/messages/empty?LabelID="+labelID+"&AddressID="+addressID, nil, func(message *pmapi.Message) bool {
 		return hasItem(message.LabelIDs, labelID) && message.AddressID == addressID
 	})
@@ -301,7 +333,7 @@ func (api *FakePMAPI) deleteMessages(method method, path string, request interfa
 	return nil
 }
 
-func (api *FakePMAPI) LabelMessages(apiIDs []string, labelID string) error {
+func (api *FakePMAPI) LabelMessages(_ context.Context, apiIDs []string, labelID string) error {
 	return api.updateMessages(PUT, "/messages/label", &pmapi.LabelMessagesReq{
 		IDs:     apiIDs,
 		LabelID: labelID,
@@ -327,7 +359,7 @@ func (api *FakePMAPI) LabelMessages(apiIDs []string, labelID string) error {
 	})
 }
 
-func (api *FakePMAPI) UnlabelMessages(apiIDs []string, labelID string) error {
+func (api *FakePMAPI) UnlabelMessages(_ context.Context, apiIDs []string, labelID string) error {
 	return api.updateMessages(PUT, "/messages/unlabel", &pmapi.LabelMessagesReq{
 		IDs:     apiIDs,
 		LabelID: labelID,
@@ -345,7 +377,7 @@ func (api *FakePMAPI) UnlabelMessages(apiIDs []string, labelID string) error {
 	})
 }
 
-func (api *FakePMAPI) MarkMessagesRead(apiIDs []string) error {
+func (api *FakePMAPI) MarkMessagesRead(_ context.Context, apiIDs []string) error {
 	return api.updateMessages(PUT, "/messages/read", &pmapi.MessagesActionReq{
 		IDs: apiIDs,
 	}, apiIDs, func(message *pmapi.Message) error {
@@ -357,7 +389,7 @@ func (api *FakePMAPI) MarkMessagesRead(apiIDs []string) error {
 	})
 }
 
-func (api *FakePMAPI) MarkMessagesUnread(apiIDs []string) error {
+func (api *FakePMAPI) MarkMessagesUnread(_ context.Context, apiIDs []string) error {
 	err := api.updateMessages(PUT, "/messages/unread", &pmapi.MessagesActionReq{
 		IDs: apiIDs,
 	}, apiIDs, func(message *pmapi.Message) error {
@@ -374,6 +406,12 @@ func (api *FakePMAPI) MarkMessagesUnread(apiIDs []string) error {
 	return nil
 }
 
+func (api *FakePMAPI) MarkMessagesHam(_ context.Context, apiIDs []string) error {
+	return api.checkAndRecordCall(PUT, "/messages/mark/ham", &pmapi.MessagesActionReq{
+		IDs: apiIDs,
+	})
+}
+
 func (api *FakePMAPI) updateMessages(method method, path string, request interface{}, apiIDs []string, updateCallback func(*pmapi.Message) error) error { //nolint[unparam]
 	if err := api.checkAndRecordCall(method, path, request); err != nil {
 		return err
@@ -15,19 +15,20 @@
 // You should have received a copy of the GNU General Public License
 // along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
 
-package fakeapi
+package fakeserver
 
 import (
+	"context"
 	"net/url"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
-func (api *FakePMAPI) Report(report pmapi.ReportReq) error {
+func (api *FakePMAPI) Report(_ context.Context, report pmapi.ReportReq) error {
 	return api.checkInternetAndRecordCall(POST, "/reports/bug", report)
 }
 
-func (api *FakePMAPI) SendSimpleMetric(category, action, label string) error {
+func (api *FakePMAPI) SendSimpleMetric(_ context.Context, category, action, label string) error {
 	v := url.Values{}
 	v.Set("Category", category)
 	v.Set("Action", action)
@@ -15,14 +15,17 @@
 // You should have received a copy of the GNU General Public License
 // along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
 
-package fakeapi
+package fakeserver
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
-func (api *FakePMAPI) GetMailSettings() (pmapi.MailSettings, error) {
+func (api *FakePMAPI) GetMailSettings(_ context.Context) (pmapi.MailSettings, error) {
 	if err := api.checkAndRecordCall(GET, "/settings/mail", nil); err != nil {
 		return pmapi.MailSettings{}, err
 	}
@@ -33,7 +36,7 @@ func (api *FakePMAPI) IsUnlocked() bool {
 	return api.userKeyRing != nil
 }
 
-func (api *FakePMAPI) Unlock(passphrase []byte) (err error) {
+func (api *FakePMAPI) Unlock(_ context.Context, passphrase []byte) (err error) {
 	if api.userKeyRing != nil {
 		return
 	}
@@ -63,19 +66,19 @@ func (api *FakePMAPI) Unlock(passphrase []byte) (err error) {
 	return nil
 }
 
-func (api *FakePMAPI) ReloadKeys(passphrase []byte) (err error) {
-	if _, err = api.UpdateUser(); err != nil {
+func (api *FakePMAPI) ReloadKeys(ctx context.Context, passphrase []byte) (err error) {
+	if _, err = api.UpdateUser(ctx); err != nil {
 		return
 	}
 
-	return api.Unlock(passphrase)
+	return api.Unlock(ctx, passphrase)
 }
 
-func (api *FakePMAPI) CurrentUser() (*pmapi.User, error) {
-	return api.UpdateUser()
+func (api *FakePMAPI) CurrentUser(ctx context.Context) (*pmapi.User, error) {
+	return api.UpdateUser(ctx)
 }
 
-func (api *FakePMAPI) UpdateUser() (*pmapi.User, error) {
+func (api *FakePMAPI) UpdateUser(_ context.Context) (*pmapi.User, error) {
 	if err := api.checkAndRecordCall(GET, "/users", nil); err != nil {
 		return nil, err
 	}
@@ -83,14 +86,14 @@ func (api *FakePMAPI) UpdateUser() (*pmapi.User, error) {
 	return api.user, nil
 }
 
-func (api *FakePMAPI) GetAddresses() (pmapi.AddressList, error) {
+func (api *FakePMAPI) GetAddresses(_ context.Context) (pmapi.AddressList, error) {
 	if err := api.checkAndRecordCall(GET, "/addresses", nil); err != nil {
 		return nil, err
 	}
 	return *api.addresses, nil
 }
 
-func (api *FakePMAPI) ReorderAddresses(addressIDs []string) error {
+func (api *FakePMAPI) ReorderAddresses(_ context.Context, addressIDs []string) error {
 	if err := api.checkAndRecordCall(PUT, "/addresses/order", nil); err != nil {
 		return err
 	}
@@ -113,6 +116,23 @@ func (api *FakePMAPI) ReorderAddresses(addressIDs []string) error {
 	return nil
 }
 
+func (api *FakePMAPI) UpdateAddress(_ context.Context, addressID string, settings *pmapi.UpdateAddressReq) error {
+	if err := api.checkAndRecordCall(PUT, "/addresses/"+addressID, settings); err != nil {
+		return err
+	}
+
+	for _, address := range *api.addresses {
+		if address.ID == addressID {
+			address.DisplayName = settings.DisplayName
+			address.Signature = settings.Signature
+			api.addEventAddress(pmapi.EventUpdate, address)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("address %s does not exist", addressID)
+}
+
 func (api *FakePMAPI) Addresses() pmapi.AddressList {
 	return *api.addresses
 }
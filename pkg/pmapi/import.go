@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"mime/multipart"
@@ -122,10 +123,10 @@ type ImportMsgRes struct {
 }
 
 // Import imports messages to the user's account.
-func (c *client) Import(reqs []*ImportMsgReq) (resps []*ImportMsgRes, err error) {
+func (c *client) Import(ctx context.Context, reqs []*ImportMsgReq) (resps []*ImportMsgRes, err error) {
 	importReq := &ImportReq{Messages: reqs}
 
-	req, w, err := c.NewMultipartRequest("POST", "/import")
+	req, w, err := c.NewMultipartRequest(ctx, "POST", "/import")
 	if err != nil {
 		return
 	}
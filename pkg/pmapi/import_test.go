@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -141,7 +142,7 @@ func TestClient_Import(t *testing.T) { // nolint[funlen]
 	}))
 	defer s.Close()
 
-	imported, err := c.Import(testImportReqs)
+	imported, err := c.Import(context.Background(), testImportReqs)
 	if err != nil {
 		t.Fatal("Expected no error while importing, got:", err)
 	}
@@ -18,13 +18,19 @@
 package pmapi
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
 )
 
+// verificationKeysTTL is how long fetched keys of a sender are used.
+const verificationKeysTTL = time.Hour
+
 // Flags
 const (
 	UseToVerifyFlag = 1 << iota
@@ -45,7 +51,7 @@ type PublicKey struct {
 }
 
 // PublicKeys returns the public keys of the given email addresses.
-func (c *client) PublicKeys(emails []string) (keys map[string]*crypto.Key, err error) {
+func (c *client) PublicKeys(ctx context.Context, emails []string) (keys map[string]*crypto.Key, err error) {
 	if len(emails) == 0 {
 		err = fmt.Errorf("pmapi: cannot get public keys: no email address provided")
 		return
@@ -57,7 +63,7 @@ func (c *client) PublicKeys(emails []string) (keys map[string]*crypto.Key, err e
 		email = url.QueryEscape(email)
 
 		var req *http.Request
-		if req, err = c.NewRequest("GET", "/keys?Email="+email, nil); err != nil {
+		if req, err = c.NewRequest(ctx, "GET", "/keys?Email="+email, nil); err != nil {
 			return
 		}
 
@@ -88,11 +94,11 @@ const (
 )
 
 // GetPublicKeysForEmail returns all sending public keys for the given email address.
-func (c *client) GetPublicKeysForEmail(email string) (keys []PublicKey, internal bool, err error) {
+func (c *client) GetPublicKeysForEmail(ctx context.Context, email string) (keys []PublicKey, internal bool, err error) {
 	email = url.QueryEscape(email)
 
 	var req *http.Request
-	if req, err = c.NewRequest("GET", "/keys?Email="+email, nil); err != nil {
+	if req, err = c.NewRequest(ctx, "GET", "/keys?Email="+email, nil); err != nil {
 		return
 	}
 
@@ -111,6 +117,62 @@ func (c *client) GetPublicKeysForEmail(email string) (keys []PublicKey, internal
 	return
 }
 
+type verificationKeys struct {
+	kr      *crypto.KeyRing
+	fetched time.Time
+}
+
+// GetVerificationKeyRing returns the key ring with public keys of the email
+// address which can be used to verify signatures. Keys are kept for an hour
+// because the same sender usually sends many messages. The key ring is
+// empty when the address has no keys, e.g. external address.
+func (c *client) GetVerificationKeyRing(ctx context.Context, email string) (*crypto.KeyRing, error) {
+	email = strings.ToLower(email)
+
+	c.verificationKeysLock.Lock()
+	cached, ok := c.verificationKeys[email]
+	c.verificationKeysLock.Unlock()
+	if ok && time.Since(cached.fetched) < verificationKeysTTL {
+		return cached.kr, nil
+	}
+
+	req, err := c.NewRequest(ctx, http.MethodGet, "/keys?Email="+url.QueryEscape(email), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res PublicKeyRes
+	if err = c.DoJSON(req, &res); err != nil {
+		return nil, err
+	}
+
+	kr, err := crypto.NewKeyRing(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, rawKey := range res.Keys {
+		if rawKey.Flags&UseToVerifyFlag != UseToVerifyFlag {
+			continue
+		}
+		key, err := crypto.NewKeyFromArmored(rawKey.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := kr.AddKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	c.verificationKeysLock.Lock()
+	defer c.verificationKeysLock.Unlock()
+	if c.verificationKeys == nil {
+		c.verificationKeys = map[string]verificationKeys{}
+	}
+	c.verificationKeys[email] = verificationKeys{kr: kr, fetched: time.Now()}
+
+	return kr, nil
+}
+
 // KeySalt contains id and salt for key.
 type KeySalt struct {
 	ID, KeySalt string
@@ -123,9 +185,9 @@ type KeySaltRes struct {
 }
 
 // GetKeySalts sends request to get list of key salts (n.b. locked route).
-func (c *client) GetKeySalts() (keySalts []KeySalt, err error) {
+func (c *client) GetKeySalts(ctx context.Context) (keySalts []KeySalt, err error) {
 	var req *http.Request
-	if req, err = c.NewRequest("GET", "/keys/salts", nil); err != nil {
+	if req, err = c.NewRequest(ctx, "GET", "/keys/salts", nil); err != nil {
 		return
 	}
 
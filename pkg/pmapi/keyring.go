@@ -26,6 +26,9 @@ import (
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+	openpgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 type PMKey struct {
@@ -230,32 +233,93 @@ func (c *client) verify(plain, amroredSignature string) (err error) {
 	return c.userKeyRing.VerifyDetached(plainMessage, pgpSignature, verifyTime)
 }
 
+// attachmentEncryptChunk is how much plain data is encrypted at once while
+// the encrypted attachment is read.
+const attachmentEncryptChunk = 64 * 1024
+
+// encryptAttachment returns a reader of the key packet followed by the data
+// packet. The data is encrypted lazily while it is being read so neither the
+// plain nor the encrypted attachment has to be kept in memory.
 func encryptAttachment(kr *crypto.KeyRing, data io.Reader, filename string) (encrypted io.Reader, err error) {
 	if kr == nil {
 		return nil, ErrNoKeyringAvailable
 	}
 
+	// We use only primary key to encrypt the message. Our keyring contains all keys (primary, old and deacivated ones).
 	firstKey, err := kr.FirstKey()
 	if err != nil {
 		return nil, err
 	}
 
-	dataBytes, err := ioutil.ReadAll(data)
+	sessionKey, err := crypto.GenerateSessionKey()
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	plainMessage := crypto.NewPlainMessage(dataBytes)
+	keyPacket, err := firstKey.EncryptSessionKey(sessionKey)
+	if err != nil {
+		return nil, err
+	}
 
-	// We use only primary key to encrypt the message. Our keyring contains all keys (primary, old and deacivated ones).
-	pgpSplitMessage, err := firstKey.EncryptAttachment(plainMessage, filename)
+	cipherFunc, err := sessionKey.GetCipherFunc()
 	if err != nil {
-		return
+		return nil, err
+	}
+
+	r := &encryptingReader{data: data, chunk: make([]byte, attachmentEncryptChunk)}
+	r.buf.Write(keyPacket)
+
+	encWriter, err := packet.SerializeSymmetricallyEncrypted(&r.buf, cipherFunc, sessionKey.Key, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	packets := append(pgpSplitMessage.KeyPacket, pgpSplitMessage.DataPacket...)
+	if r.w, err = packet.SerializeLiteral(encWriter, false, filename, uint32(crypto.GetUnixTime())); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
 
-	return bytes.NewReader(packets), nil
+// encryptingReader encrypts next chunk of data every time all previously
+// encrypted data was read.
+type encryptingReader struct {
+	data  io.Reader
+	chunk []byte
+	w     io.WriteCloser // Writes encrypted data to buf.
+	buf   bytes.Buffer
+	err   error
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 && r.err == nil {
+		r.encryptChunk()
+	}
+
+	if r.buf.Len() > 0 {
+		return r.buf.Read(p)
+	}
+	return 0, r.err
+}
+
+func (r *encryptingReader) encryptChunk() {
+	n, err := r.data.Read(r.chunk)
+	if n > 0 {
+		if _, writeErr := r.w.Write(r.chunk[:n]); writeErr != nil {
+			r.err = writeErr
+			return
+		}
+	}
+
+	switch {
+	case err == io.EOF:
+		// Closing writes the end of the packets including the integrity check.
+		if r.err = r.w.Close(); r.err == nil {
+			r.err = io.EOF
+		}
+	case err != nil:
+		r.err = err
+	}
 }
 
 func decryptAttachment(kr *crypto.KeyRing, keyPackets []byte, data io.Reader) (decrypted io.Reader, err error) {
@@ -274,6 +338,116 @@ func decryptAttachment(kr *crypto.KeyRing, keyPackets []byte, data io.Reader) (d
 	return plainMessage.NewReader(), nil
 }
 
+// decryptAttachmentStream decrypts the data lazily while it is being read so
+// the whole attachment does not have to be kept in memory. The integrity of
+// the data is checked at the end of the stream, i.e. the last read returns
+// the error in case of corrupted data.
+// When none of the key packets can be decrypted by kr, ErrKeyIncorrect is
+// returned together with a reader of the original data.
+func decryptAttachmentStream(kr *crypto.KeyRing, keyPackets []byte, data io.Reader) (decrypted io.Reader, err error) {
+	symReader, err := decryptDataPacket(kr, keyPackets, data)
+	if err != nil {
+		return symReader, err
+	}
+
+	md, err := openpgp.ReadMessage(symReader, openpgp.EntityList{}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return md.UnverifiedBody, nil
+}
+
+// decryptDataPacket returns the reader of packets inside the symmetrically
+// encrypted data packet, i.e. literal data possibly compressed and signed.
+// When none of the key packets can be decrypted by kr, ErrKeyIncorrect is
+// returned together with a reader of the original data.
+func decryptDataPacket(kr *crypto.KeyRing, keyPackets []byte, data io.Reader) (decrypted io.Reader, err error) {
+	if kr == nil {
+		return nil, ErrNoKeyringAvailable
+	}
+
+	// Data can start with its own key packets which take precedence. Remember
+	// what was read so far to be able to return the original data when none
+	// of the keys can be decrypted.
+	var sessionKey *crypto.SessionKey
+	consumed := &recordingBuffer{}
+	packets := packet.NewReader(io.TeeReader(data, consumed))
+
+	var p packet.Packet
+	for {
+		keyStart := consumed.Len()
+		if p, err = packets.Next(); err != nil {
+			return nil, err
+		}
+		if _, ok := p.(*packet.EncryptedKey); !ok {
+			break
+		}
+		if sessionKey == nil {
+			sessionKey = decryptSessionKeyPacket(kr, consumed.Bytes()[keyStart:])
+		}
+	}
+
+	if sessionKey == nil {
+		sessionKey = decryptSessionKeyPacket(kr, keyPackets)
+	}
+	if sessionKey == nil {
+		return io.MultiReader(bytes.NewReader(consumed.Bytes()), data), openpgperrors.ErrKeyIncorrect
+	}
+
+	encrypted, ok := p.(*packet.SymmetricallyEncrypted)
+	if !ok {
+		return nil, errors.New("data packet is not symmetrically encrypted")
+	}
+
+	cipherFunc, err := sessionKey.GetCipherFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	// From now on the data must not be recorded anymore.
+	consumed.stop()
+
+	return encrypted.Decrypt(cipherFunc, sessionKey.Key)
+}
+
+// recordingBuffer keeps written data until it is stopped.
+type recordingBuffer struct {
+	bytes.Buffer
+	stopped bool
+}
+
+func (b *recordingBuffer) Write(p []byte) (int, error) {
+	if b.stopped {
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+func (b *recordingBuffer) stop() {
+	b.stopped = true
+	b.Reset()
+}
+
+// decryptSessionKeyPacket returns nil if keyPacket is not an encrypted key
+// packet or cannot be decrypted by kr.
+func decryptSessionKeyPacket(kr *crypto.KeyRing, keyPacket []byte) *crypto.SessionKey {
+	// DecryptSessionKey panics when the first packet is not a key packet.
+	p, err := packet.NewReader(bytes.NewReader(keyPacket)).Next()
+	if err != nil {
+		return nil
+	}
+	if _, ok := p.(*packet.EncryptedKey); !ok {
+		return nil
+	}
+
+	sessionKey, err := kr.DecryptSessionKey(keyPacket)
+	if err != nil {
+		return nil
+	}
+	return sessionKey
+}
+
 func signAttachment(encrypter *crypto.KeyRing, data io.Reader) (signature io.Reader, err error) {
 	if encrypter == nil {
 		return nil, ErrNoKeyringAvailable
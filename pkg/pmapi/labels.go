@@ -17,7 +17,10 @@
 
 package pmapi
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // System labels
 const (
@@ -86,6 +89,9 @@ type Label struct {
 	Exclusive int
 	Type      int
 	Notify    int
+
+	// ParentID is the ID of the parent folder of nested folders.
+	ParentID string `json:",omitempty"`
 }
 
 type LabelListRes struct {
@@ -93,17 +99,17 @@ type LabelListRes struct {
 	Labels []*Label
 }
 
-func (c *client) ListLabels() (labels []*Label, err error) {
-	return c.ListLabelType(LabelTypeMailbox)
+func (c *client) ListLabels(ctx context.Context) (labels []*Label, err error) {
+	return c.ListLabelType(ctx, LabelTypeMailbox)
 }
 
-func (c *client) ListContactGroups() (labels []*Label, err error) {
-	return c.ListLabelType(LabelTypeContactGroup)
+func (c *client) ListContactGroups(ctx context.Context) (labels []*Label, err error) {
+	return c.ListLabelType(ctx, LabelTypeContactGroup)
 }
 
 // ListLabelType lists all labels created by the user.
-func (c *client) ListLabelType(labelType int) (labels []*Label, err error) {
-	req, err := c.NewRequest("GET", fmt.Sprintf("/labels?%d", labelType), nil)
+func (c *client) ListLabelType(ctx context.Context, labelType int) (labels []*Label, err error) {
+	req, err := c.NewRequest(ctx, "GET", fmt.Sprintf("/labels?%d", labelType), nil)
 	if err != nil {
 		return
 	}
@@ -127,9 +133,9 @@ type LabelRes struct {
 }
 
 // CreateLabel creates a new label.
-func (c *client) CreateLabel(label *Label) (created *Label, err error) {
+func (c *client) CreateLabel(ctx context.Context, label *Label) (created *Label, err error) {
 	labelReq := &LabelReq{label}
-	req, err := c.NewJSONRequest("POST", "/labels", labelReq)
+	req, err := c.NewJSONRequest(ctx, "POST", "/labels", labelReq)
 	if err != nil {
 		return
 	}
@@ -143,10 +149,20 @@ func (c *client) CreateLabel(label *Label) (created *Label, err error) {
 	return
 }
 
+// labelUpdateReq always contains ParentID because missing ParentID keeps
+// the current parent while null moves the folder to the top level.
+type labelUpdateReq struct {
+	*Label
+	ParentID *string
+}
+
 // UpdateLabel updates a label.
-func (c *client) UpdateLabel(label *Label) (updated *Label, err error) {
-	labelReq := &LabelReq{label}
-	req, err := c.NewJSONRequest("PUT", "/labels/"+label.ID, labelReq)
+func (c *client) UpdateLabel(ctx context.Context, label *Label) (updated *Label, err error) {
+	labelReq := &labelUpdateReq{Label: label}
+	if label.ParentID != "" {
+		labelReq.ParentID = &label.ParentID
+	}
+	req, err := c.NewJSONRequest(ctx, "PUT", "/labels/"+label.ID, labelReq)
 	if err != nil {
 		return
 	}
@@ -161,8 +177,8 @@ func (c *client) UpdateLabel(label *Label) (updated *Label, err error) {
 }
 
 // DeleteLabel deletes a label.
-func (c *client) DeleteLabel(id string) (err error) {
-	req, err := c.NewRequest("DELETE", "/labels/"+id, nil)
+func (c *client) DeleteLabel(ctx context.Context, id string) (err error) {
+	req, err := c.NewRequest(ctx, "DELETE", "/labels/"+id, nil)
 	if err != nil {
 		return
 	}
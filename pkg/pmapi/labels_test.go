@@ -19,6 +19,7 @@ package pmapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -97,7 +98,7 @@ func TestClient_ListLabels(t *testing.T) {
 	}))
 	defer s.Close()
 
-	labels, err := c.ListLabels()
+	labels, err := c.ListLabels(context.Background())
 	if err != nil {
 		t.Fatal("Expected no error while listing labels, got:", err)
 	}
@@ -137,7 +138,7 @@ func TestClient_CreateLabel(t *testing.T) {
 	}))
 	defer s.Close()
 
-	created, err := c.CreateLabel(testLabelReq.Label)
+	created, err := c.CreateLabel(context.Background(), testLabelReq.Label)
 	if err != nil {
 		t.Fatal("Expected no error while creating label, got:", err)
 	}
@@ -163,7 +164,7 @@ func TestClient_UpdateLabel(t *testing.T) {
 	}))
 	defer s.Close()
 
-	updated, err := c.UpdateLabel(testLabelCreated)
+	updated, err := c.UpdateLabel(context.Background(), testLabelCreated)
 	if err != nil {
 		t.Fatal("Expected no error while updating label, got:", err)
 	}
@@ -173,6 +174,33 @@ func TestClient_UpdateLabel(t *testing.T) {
 	}
 }
 
+func TestClient_UpdateLabelParent(t *testing.T) {
+	tests := []struct {
+		parentID string
+		want     string
+	}{
+		{"", `"ParentID":null`},
+		{"parentID", `"ParentID":"parentID"`},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body := &bytes.Buffer{}
+			_, err := body.ReadFrom(req.Body)
+			Ok(t, err)
+
+			r.Contains(t, body.String(), tc.want)
+			r.Equal(t, 1, bytes.Count(body.Bytes(), []byte("ParentID")))
+
+			fmt.Fprint(w, testCreateLabelBody)
+		}))
+
+		_, err := c.UpdateLabel(context.Background(), &Label{ID: "labelID", Name: "sub", ParentID: tc.parentID})
+		r.NoError(t, err)
+		s.Close()
+	}
+}
+
 func TestClient_DeleteLabel(t *testing.T) {
 	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		Ok(t, checkMethodAndPath(r, "DELETE", "/labels/"+testLabelCreated.ID))
@@ -181,7 +209,7 @@ func TestClient_DeleteLabel(t *testing.T) {
 	}))
 	defer s.Close()
 
-	err := c.DeleteLabel(testLabelCreated.ID)
+	err := c.DeleteLabel(context.Background(), testLabelCreated.ID)
 	if err != nil {
 		t.Fatal("Expected no error while deleting label, got:", err)
 	}
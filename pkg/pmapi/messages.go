@@ -19,6 +19,7 @@ package pmapi
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/base64"
@@ -499,8 +500,8 @@ type MessagesListRes struct {
 }
 
 // ListMessages gets message metadata.
-func (c *client) ListMessages(filter *MessagesFilter) (msgs []*Message, total int, err error) {
-	req, err := c.NewRequest("GET", "/messages", nil)
+func (c *client) ListMessages(ctx context.Context, filter *MessagesFilter) (msgs []*Message, total int, err error) {
+	req, err := c.NewRequest(ctx, "GET", "/messages", nil)
 	if err != nil {
 		return
 	}
@@ -511,7 +512,7 @@ func (c *client) ListMessages(filter *MessagesFilter) (msgs []*Message, total in
 		// If the URI was too long and we searched with IDs, we will try again without the API IDs.
 		if strings.Contains(err.Error(), "api returned: 414") && len(filter.ID) > 0 {
 			filter.ID = []string{}
-			return c.ListMessages(filter)
+			return c.ListMessages(ctx, filter)
 		}
 		return
 	}
@@ -527,12 +528,12 @@ type MessagesCountsRes struct {
 }
 
 // CountMessages counts messages by label.
-func (c *client) CountMessages(addressID string) (counts []*MessagesCount, err error) {
+func (c *client) CountMessages(ctx context.Context, addressID string) (counts []*MessagesCount, err error) {
 	reqURL := "/messages/count"
 	if addressID != "" {
 		reqURL += ("?AddressID=" + addressID)
 	}
-	req, err := c.NewRequest("GET", reqURL, nil)
+	req, err := c.NewRequest(ctx, "GET", reqURL, nil)
 	if err != nil {
 		return
 	}
@@ -553,8 +554,8 @@ type MessageRes struct {
 }
 
 // GetMessage retrieves a message.
-func (c *client) GetMessage(id string) (msg *Message, err error) {
-	req, err := c.NewRequest("GET", "/messages/"+id, nil)
+func (c *client) GetMessage(ctx context.Context, id string) (msg *Message, err error) {
+	req, err := c.NewRequest(ctx, "GET", "/messages/"+id, nil)
 	if err != nil {
 		return
 	}
@@ -568,7 +569,7 @@ func (c *client) GetMessage(id string) (msg *Message, err error) {
 }
 
 type SendMessageReq struct {
-	ExpirationTime int64 `json:",omitempty"`
+	ExpirationTime int64 `json:",omitempty"` // Seconds after sending when the message expires.
 	// AutoSaveContacts int `json:",omitempty"`
 
 	// Data for encrypted recipients.
@@ -605,6 +606,12 @@ type MessageAddress struct {
 	BodyKeyPacket        string // base64-encoded key packet.
 	Signature            int    // 0 = None, 1 = Detached, 2 = Attached/Armored
 	AttachmentKeyPackets map[string]string
+
+	// Only for recipients of EncryptedOutsidePackage.
+	Token        string        `json:",omitempty"` // base64-encoded random token.
+	EncToken     string        `json:",omitempty"` // Token encrypted with the password.
+	PasswordHint string        `json:",omitempty"`
+	Auth         *PasswordAuth `json:",omitempty"`
 }
 
 type AlgoKey struct {
@@ -621,7 +628,7 @@ type SendMessageRes struct {
 	Parent *Message
 }
 
-func (c *client) SendMessage(id string, sendReq *SendMessageReq) (sent, parent *Message, err error) {
+func (c *client) SendMessage(ctx context.Context, id string, sendReq *SendMessageReq) (sent, parent *Message, err error) {
 	if id == "" {
 		err = errors.New("pmapi: cannot send message with an empty id")
 		return
@@ -631,7 +638,7 @@ func (c *client) SendMessage(id string, sendReq *SendMessageReq) (sent, parent *
 		sendReq.Packages = []*MessagePackage{}
 	}
 
-	req, err := c.NewJSONRequest("POST", "/messages/"+id, sendReq)
+	req, err := c.NewJSONRequest(ctx, "POST", "/messages/"+id, sendReq)
 	if err != nil {
 		return
 	}
@@ -658,10 +665,10 @@ type DraftReq struct {
 	AttachmentKeyPackets []string
 }
 
-func (c *client) CreateDraft(m *Message, parent string, action int) (created *Message, err error) {
+func (c *client) CreateDraft(ctx context.Context, m *Message, parent string, action int) (created *Message, err error) {
 	createReq := &DraftReq{Message: m, ParentID: parent, Action: action, AttachmentKeyPackets: []string{}}
 
-	req, err := c.NewJSONRequest("POST", "/messages", createReq)
+	req, err := c.NewJSONRequest(ctx, "POST", "/messages", createReq)
 	if err != nil {
 		return
 	}
@@ -675,6 +682,29 @@ func (c *client) CreateDraft(m *Message, parent string, action int) (created *Me
 	return
 }
 
+type UpdateDraftReq struct {
+	Message *Message
+}
+
+// UpdateDraft replaces content of the draft with id. Attachments of
+// the draft are kept; they are removed by DeleteAttachment.
+func (c *client) UpdateDraft(ctx context.Context, id string, m *Message) (updated *Message, err error) {
+	updateReq := &UpdateDraftReq{Message: m}
+
+	req, err := c.NewJSONRequest(ctx, "PUT", "/messages/"+id, updateReq)
+	if err != nil {
+		return
+	}
+
+	var res MessageRes
+	if err = c.DoJSON(req, &res); err != nil {
+		return
+	}
+
+	updated, err = res.Message, res.Err()
+	return
+}
+
 type MessagesActionReq struct {
 	IDs []string
 }
@@ -704,23 +734,23 @@ func (res MessagesActionRes) Err() error {
 
 // doMessagesAction performs paged requests to doMessagesActionInner.
 // This can eventually be done in parallel though.
-func (c *client) doMessagesAction(action string, ids []string) (err error) {
+func (c *client) doMessagesAction(ctx context.Context, action string, ids []string) (err error) {
 	for len(ids) > messageIDPageSize {
 		var requestIDs []string
 		requestIDs, ids = ids[:messageIDPageSize], ids[messageIDPageSize:]
-		if err = c.doMessagesActionInner(action, requestIDs); err != nil {
+		if err = c.doMessagesActionInner(ctx, action, requestIDs); err != nil {
 			return
 		}
 	}
 
-	return c.doMessagesActionInner(action, ids)
+	return c.doMessagesActionInner(ctx, action, ids)
 }
 
 // doMessagesActionInner is the non-paged inner method of doMessagesAction.
 // You should not call this directly unless you know what you are doing (it can overload the server).
-func (c *client) doMessagesActionInner(action string, ids []string) (err error) {
+func (c *client) doMessagesActionInner(ctx context.Context, action string, ids []string) (err error) {
 	actionReq := &MessagesActionReq{IDs: ids}
-	req, err := c.NewJSONRequest("PUT", "/messages/"+action, actionReq)
+	req, err := c.NewJSONRequest(ctx, "PUT", "/messages/"+action, actionReq)
 	if err != nil {
 		return
 	}
@@ -735,20 +765,27 @@ func (c *client) doMessagesActionInner(action string, ids []string) (err error)
 	return
 }
 
-func (c *client) MarkMessagesRead(ids []string) error {
-	return c.doMessagesAction("read", ids)
+func (c *client) MarkMessagesRead(ctx context.Context, ids []string) error {
+	return c.doMessagesAction(ctx, "read", ids)
+}
+
+func (c *client) MarkMessagesUnread(ctx context.Context, ids []string) error {
+	return c.doMessagesAction(ctx, "unread", ids)
 }
 
-func (c *client) MarkMessagesUnread(ids []string) error {
-	return c.doMessagesAction("unread", ids)
+// MarkMessagesHam reports messages moved out of Spam by the user as not
+// spam to train the spam filter. Moving messages to Spam is reported by
+// the label itself.
+func (c *client) MarkMessagesHam(ctx context.Context, ids []string) error {
+	return c.doMessagesAction(ctx, "mark/ham", ids)
 }
 
-func (c *client) DeleteMessages(ids []string) error {
-	return c.doMessagesAction("delete", ids)
+func (c *client) DeleteMessages(ctx context.Context, ids []string) error {
+	return c.doMessagesAction(ctx, "delete", ids)
 }
 
-func (c *client) UndeleteMessages(ids []string) error {
-	return c.doMessagesAction("undelete", ids)
+func (c *client) UndeleteMessages(ctx context.Context, ids []string) error {
+	return c.doMessagesAction(ctx, "undelete", ids)
 }
 
 type LabelMessagesReq struct {
@@ -758,21 +795,21 @@ type LabelMessagesReq struct {
 
 // LabelMessages labels the given message IDs with the given label.
 // The requests are performed paged; this can eventually be done in parallel.
-func (c *client) LabelMessages(ids []string, label string) (err error) {
+func (c *client) LabelMessages(ctx context.Context, ids []string, label string) (err error) {
 	for len(ids) > messageIDPageSize {
 		var requestIDs []string
 		requestIDs, ids = ids[:messageIDPageSize], ids[messageIDPageSize:]
-		if err = c.labelMessages(requestIDs, label); err != nil {
+		if err = c.labelMessages(ctx, requestIDs, label); err != nil {
 			return
 		}
 	}
 
-	return c.labelMessages(ids, label)
+	return c.labelMessages(ctx, ids, label)
 }
 
-func (c *client) labelMessages(ids []string, label string) (err error) {
+func (c *client) labelMessages(ctx context.Context, ids []string, label string) (err error) {
 	labelReq := &LabelMessagesReq{LabelID: label, IDs: ids}
-	req, err := c.NewJSONRequest("PUT", "/messages/label", labelReq)
+	req, err := c.NewJSONRequest(ctx, "PUT", "/messages/label", labelReq)
 	if err != nil {
 		return
 	}
@@ -788,21 +825,21 @@ func (c *client) labelMessages(ids []string, label string) (err error) {
 
 // UnlabelMessages removes the given label from the given message IDs.
 // The requests are performed paged; this can eventually be done in parallel.
-func (c *client) UnlabelMessages(ids []string, label string) (err error) {
+func (c *client) UnlabelMessages(ctx context.Context, ids []string, label string) (err error) {
 	for len(ids) > messageIDPageSize {
 		var requestIDs []string
 		requestIDs, ids = ids[:messageIDPageSize], ids[messageIDPageSize:]
-		if err = c.unlabelMessages(requestIDs, label); err != nil {
+		if err = c.unlabelMessages(ctx, requestIDs, label); err != nil {
 			return
 		}
 	}
 
-	return c.unlabelMessages(ids, label)
+	return c.unlabelMessages(ctx, ids, label)
 }
 
-func (c *client) unlabelMessages(ids []string, label string) (err error) {
+func (c *client) unlabelMessages(ctx context.Context, ids []string, label string) (err error) {
 	labelReq := &LabelMessagesReq{LabelID: label, IDs: ids}
-	req, err := c.NewJSONRequest("PUT", "/messages/unlabel", labelReq)
+	req, err := c.NewJSONRequest(ctx, "PUT", "/messages/unlabel", labelReq)
 	if err != nil {
 		return
 	}
@@ -816,7 +853,7 @@ func (c *client) unlabelMessages(ids []string, label string) (err error) {
 	return
 }
 
-func (c *client) EmptyFolder(labelID, addressID string) (err error) {
+func (c *client) EmptyFolder(ctx context.Context, labelID, addressID string) (err error) {
 	if labelID == "" {
 		return errors.New("pmapi: labelID parameter is empty string")
 	}
@@ -825,7 +862,7 @@ func (c *client) EmptyFolder(labelID, addressID string) (err error) {
 		reqURL += ("&AddressID=" + addressID)
 	}
 
-	req, err := c.NewRequest("DELETE", reqURL, nil)
+	req, err := c.NewRequest(ctx, "DELETE", reqURL, nil)
 
 	if err != nil {
 		return
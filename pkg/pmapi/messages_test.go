@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"testing"
@@ -205,7 +206,7 @@ func TestMessage_LabelMessages_NoPaging(t *testing.T) {
 	c.uid = testUID
 	c.accessToken = testAccessToken
 
-	assert.NoError(t, c.LabelMessages(testIDs, "mylabel"))
+	assert.NoError(t, c.LabelMessages(context.Background(), testIDs, "mylabel"))
 }
 
 func TestMessage_LabelMessages_Paging(t *testing.T) {
@@ -226,5 +227,23 @@ func TestMessage_LabelMessages_Paging(t *testing.T) {
 	c.uid = testUID
 	c.accessToken = testAccessToken
 
-	assert.NoError(t, c.LabelMessages(testIDs, "mylabel"))
+	assert.NoError(t, c.LabelMessages(context.Background(), testIDs, "mylabel"))
+}
+
+func routeMarkMessagesHam(tb testing.TB, w http.ResponseWriter, r *http.Request) string {
+	Ok(tb, checkMethodAndPath(r, "PUT", "/messages/mark/ham"))
+
+	return "messages/label/put_response.json"
+}
+
+func TestMessage_MarkMessagesHam(t *testing.T) {
+	finish, c := newTestServerCallbacks(t,
+		routeMarkMessagesHam,
+	)
+	defer finish()
+
+	c.uid = testUID
+	c.accessToken = testAccessToken
+
+	assert.NoError(t, c.MarkMessagesHam(context.Background(), []string{"msg1", "msg2"}))
 }
@@ -18,17 +18,18 @@
 package pmapi
 
 import (
+	"context"
 	"net/url"
 )
 
 // SendSimpleMetric makes a simple GET request to send a simple metrics report.
-func (c *client) SendSimpleMetric(category, action, label string) (err error) {
+func (c *client) SendSimpleMetric(ctx context.Context, category, action, label string) (err error) {
 	v := url.Values{}
 	v.Set("Category", category)
 	v.Set("Action", action)
 	v.Set("Label", label)
 
-	req, err := c.NewRequest("GET", "/metrics?"+v.Encode(), nil)
+	req, err := c.NewRequest(ctx, "GET", "/metrics?"+v.Encode(), nil)
 	if err != nil {
 		return
 	}
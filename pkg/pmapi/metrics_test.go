@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"testing"
@@ -36,7 +37,7 @@ func TestClient_SendSimpleMetric(t *testing.T) {
 	}))
 	defer s.Close()
 
-	err := c.SendSimpleMetric("some_category", "some_action", "some_label")
+	err := c.SendSimpleMetric(context.Background(), "some_category", "some_action", "some_label")
 	if err != nil {
 		t.Fatal("Expected no error while sending simple metric, got:", err)
 	}
@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	context "context"
 	crypto "github.com/ProtonMail/gopenpgp/v2/crypto"
 	pmapi "github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	gomock "github.com/golang/mock/gomock"
@@ -35,6 +36,21 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 	return m.recorder
 }
 
+// AddContacts mocks base method
+func (m *MockClient) AddContacts(arg0 context.Context, arg1 pmapi.ContactsCards, arg2, arg3, arg4 int) (*pmapi.AddContactsResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddContacts", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(*pmapi.AddContactsResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddContacts indicates an expected call of AddContacts
+func (mr *MockClientMockRecorder) AddContacts(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddContacts", reflect.TypeOf((*MockClient)(nil).AddContacts), arg0, arg1, arg2, arg3, arg4)
+}
+
 // Addresses mocks base method
 func (m *MockClient) Addresses() pmapi.AddressList {
 	m.ctrl.T.Helper()
@@ -50,78 +66,93 @@ func (mr *MockClientMockRecorder) Addresses() *gomock.Call {
 }
 
 // Auth mocks base method
-func (m *MockClient) Auth(arg0, arg1 string, arg2 *pmapi.AuthInfo) (*pmapi.Auth, error) {
+func (m *MockClient) Auth(arg0 context.Context, arg1, arg2 string, arg3 *pmapi.AuthInfo) (*pmapi.Auth, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Auth", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "Auth", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(*pmapi.Auth)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Auth indicates an expected call of Auth
-func (mr *MockClientMockRecorder) Auth(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) Auth(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Auth", reflect.TypeOf((*MockClient)(nil).Auth), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Auth", reflect.TypeOf((*MockClient)(nil).Auth), arg0, arg1, arg2, arg3)
 }
 
 // Auth2FA mocks base method
-func (m *MockClient) Auth2FA(arg0 string, arg1 *pmapi.Auth) (*pmapi.Auth2FA, error) {
+func (m *MockClient) Auth2FA(arg0 context.Context, arg1 string, arg2 *pmapi.Auth) (*pmapi.Auth2FA, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Auth2FA", arg0, arg1)
+	ret := m.ctrl.Call(m, "Auth2FA", arg0, arg1, arg2)
 	ret0, _ := ret[0].(*pmapi.Auth2FA)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Auth2FA indicates an expected call of Auth2FA
-func (mr *MockClientMockRecorder) Auth2FA(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) Auth2FA(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Auth2FA", reflect.TypeOf((*MockClient)(nil).Auth2FA), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Auth2FA", reflect.TypeOf((*MockClient)(nil).Auth2FA), arg0, arg1, arg2)
 }
 
 // AuthInfo mocks base method
-func (m *MockClient) AuthInfo(arg0 string) (*pmapi.AuthInfo, error) {
+func (m *MockClient) AuthInfo(arg0 context.Context, arg1 string) (*pmapi.AuthInfo, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AuthInfo", arg0)
+	ret := m.ctrl.Call(m, "AuthInfo", arg0, arg1)
 	ret0, _ := ret[0].(*pmapi.AuthInfo)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AuthInfo indicates an expected call of AuthInfo
-func (mr *MockClientMockRecorder) AuthInfo(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) AuthInfo(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthInfo", reflect.TypeOf((*MockClient)(nil).AuthInfo), arg0, arg1)
+}
+
+// AuthModulus mocks base method
+func (m *MockClient) AuthModulus(arg0 context.Context) (*pmapi.AuthModulus, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AuthModulus", arg0)
+	ret0, _ := ret[0].(*pmapi.AuthModulus)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AuthModulus indicates an expected call of AuthModulus
+func (mr *MockClientMockRecorder) AuthModulus(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthInfo", reflect.TypeOf((*MockClient)(nil).AuthInfo), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthModulus", reflect.TypeOf((*MockClient)(nil).AuthModulus), arg0)
 }
 
 // AuthRefresh mocks base method
-func (m *MockClient) AuthRefresh(arg0 string) (*pmapi.Auth, error) {
+func (m *MockClient) AuthRefresh(arg0 context.Context, arg1 string) (*pmapi.Auth, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AuthRefresh", arg0)
+	ret := m.ctrl.Call(m, "AuthRefresh", arg0, arg1)
 	ret0, _ := ret[0].(*pmapi.Auth)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AuthRefresh indicates an expected call of AuthRefresh
-func (mr *MockClientMockRecorder) AuthRefresh(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) AuthRefresh(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthRefresh", reflect.TypeOf((*MockClient)(nil).AuthRefresh), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthRefresh", reflect.TypeOf((*MockClient)(nil).AuthRefresh), arg0, arg1)
 }
 
 // AuthSalt mocks base method
-func (m *MockClient) AuthSalt() (string, error) {
+func (m *MockClient) AuthSalt(arg0 context.Context) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AuthSalt")
+	ret := m.ctrl.Call(m, "AuthSalt", arg0)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AuthSalt indicates an expected call of AuthSalt
-func (mr *MockClientMockRecorder) AuthSalt() *gomock.Call {
+func (mr *MockClientMockRecorder) AuthSalt(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthSalt", reflect.TypeOf((*MockClient)(nil).AuthSalt))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthSalt", reflect.TypeOf((*MockClient)(nil).AuthSalt), arg0)
 }
 
 // ClearData mocks base method
@@ -149,78 +180,78 @@ func (mr *MockClientMockRecorder) CloseConnections() *gomock.Call {
 }
 
 // CountMessages mocks base method
-func (m *MockClient) CountMessages(arg0 string) ([]*pmapi.MessagesCount, error) {
+func (m *MockClient) CountMessages(arg0 context.Context, arg1 string) ([]*pmapi.MessagesCount, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CountMessages", arg0)
+	ret := m.ctrl.Call(m, "CountMessages", arg0, arg1)
 	ret0, _ := ret[0].([]*pmapi.MessagesCount)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CountMessages indicates an expected call of CountMessages
-func (mr *MockClientMockRecorder) CountMessages(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) CountMessages(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountMessages", reflect.TypeOf((*MockClient)(nil).CountMessages), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountMessages", reflect.TypeOf((*MockClient)(nil).CountMessages), arg0, arg1)
 }
 
 // CreateAttachment mocks base method
-func (m *MockClient) CreateAttachment(arg0 *pmapi.Attachment, arg1, arg2 io.Reader) (*pmapi.Attachment, error) {
+func (m *MockClient) CreateAttachment(arg0 context.Context, arg1 *pmapi.Attachment, arg2, arg3 io.Reader) (*pmapi.Attachment, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateAttachment", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "CreateAttachment", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(*pmapi.Attachment)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateAttachment indicates an expected call of CreateAttachment
-func (mr *MockClientMockRecorder) CreateAttachment(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) CreateAttachment(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAttachment", reflect.TypeOf((*MockClient)(nil).CreateAttachment), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAttachment", reflect.TypeOf((*MockClient)(nil).CreateAttachment), arg0, arg1, arg2, arg3)
 }
 
 // CreateDraft mocks base method
-func (m *MockClient) CreateDraft(arg0 *pmapi.Message, arg1 string, arg2 int) (*pmapi.Message, error) {
+func (m *MockClient) CreateDraft(arg0 context.Context, arg1 *pmapi.Message, arg2 string, arg3 int) (*pmapi.Message, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateDraft", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "CreateDraft", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(*pmapi.Message)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateDraft indicates an expected call of CreateDraft
-func (mr *MockClientMockRecorder) CreateDraft(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) CreateDraft(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateDraft", reflect.TypeOf((*MockClient)(nil).CreateDraft), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateDraft", reflect.TypeOf((*MockClient)(nil).CreateDraft), arg0, arg1, arg2, arg3)
 }
 
 // CreateLabel mocks base method
-func (m *MockClient) CreateLabel(arg0 *pmapi.Label) (*pmapi.Label, error) {
+func (m *MockClient) CreateLabel(arg0 context.Context, arg1 *pmapi.Label) (*pmapi.Label, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateLabel", arg0)
+	ret := m.ctrl.Call(m, "CreateLabel", arg0, arg1)
 	ret0, _ := ret[0].(*pmapi.Label)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateLabel indicates an expected call of CreateLabel
-func (mr *MockClientMockRecorder) CreateLabel(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) CreateLabel(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLabel", reflect.TypeOf((*MockClient)(nil).CreateLabel), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLabel", reflect.TypeOf((*MockClient)(nil).CreateLabel), arg0, arg1)
 }
 
 // CurrentUser mocks base method
-func (m *MockClient) CurrentUser() (*pmapi.User, error) {
+func (m *MockClient) CurrentUser(arg0 context.Context) (*pmapi.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CurrentUser")
+	ret := m.ctrl.Call(m, "CurrentUser", arg0)
 	ret0, _ := ret[0].(*pmapi.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CurrentUser indicates an expected call of CurrentUser
-func (mr *MockClientMockRecorder) CurrentUser() *gomock.Call {
+func (mr *MockClientMockRecorder) CurrentUser(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CurrentUser", reflect.TypeOf((*MockClient)(nil).CurrentUser))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CurrentUser", reflect.TypeOf((*MockClient)(nil).CurrentUser), arg0)
 }
 
 // DecryptAndVerifyCards mocks base method
@@ -239,184 +270,229 @@ func (mr *MockClientMockRecorder) DecryptAndVerifyCards(arg0 interface{}) *gomoc
 }
 
 // DeleteAttachment mocks base method
-func (m *MockClient) DeleteAttachment(arg0 string) error {
+func (m *MockClient) DeleteAttachment(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteAttachment", arg0)
+	ret := m.ctrl.Call(m, "DeleteAttachment", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteAttachment indicates an expected call of DeleteAttachment
-func (mr *MockClientMockRecorder) DeleteAttachment(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) DeleteAttachment(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAttachment", reflect.TypeOf((*MockClient)(nil).DeleteAttachment), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAttachment", reflect.TypeOf((*MockClient)(nil).DeleteAttachment), arg0, arg1)
 }
 
 // DeleteAuth mocks base method
-func (m *MockClient) DeleteAuth() error {
+func (m *MockClient) DeleteAuth(arg0 context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteAuth")
+	ret := m.ctrl.Call(m, "DeleteAuth", arg0)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteAuth indicates an expected call of DeleteAuth
-func (mr *MockClientMockRecorder) DeleteAuth() *gomock.Call {
+func (mr *MockClientMockRecorder) DeleteAuth(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAuth", reflect.TypeOf((*MockClient)(nil).DeleteAuth))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAuth", reflect.TypeOf((*MockClient)(nil).DeleteAuth), arg0)
 }
 
 // DeleteLabel mocks base method
-func (m *MockClient) DeleteLabel(arg0 string) error {
+func (m *MockClient) DeleteLabel(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteLabel", arg0)
+	ret := m.ctrl.Call(m, "DeleteLabel", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteLabel indicates an expected call of DeleteLabel
-func (mr *MockClientMockRecorder) DeleteLabel(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) DeleteLabel(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLabel", reflect.TypeOf((*MockClient)(nil).DeleteLabel), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLabel", reflect.TypeOf((*MockClient)(nil).DeleteLabel), arg0, arg1)
 }
 
 // DeleteMessages mocks base method
-func (m *MockClient) DeleteMessages(arg0 []string) error {
+func (m *MockClient) DeleteMessages(arg0 context.Context, arg1 []string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteMessages", arg0)
+	ret := m.ctrl.Call(m, "DeleteMessages", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteMessages indicates an expected call of DeleteMessages
-func (mr *MockClientMockRecorder) DeleteMessages(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) DeleteMessages(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMessages", reflect.TypeOf((*MockClient)(nil).DeleteMessages), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMessages", reflect.TypeOf((*MockClient)(nil).DeleteMessages), arg0, arg1)
 }
 
 // EmptyFolder mocks base method
-func (m *MockClient) EmptyFolder(arg0, arg1 string) error {
+func (m *MockClient) EmptyFolder(arg0 context.Context, arg1, arg2 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "EmptyFolder", arg0, arg1)
+	ret := m.ctrl.Call(m, "EmptyFolder", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // EmptyFolder indicates an expected call of EmptyFolder
-func (mr *MockClientMockRecorder) EmptyFolder(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) EmptyFolder(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EmptyFolder", reflect.TypeOf((*MockClient)(nil).EmptyFolder), arg0, arg1, arg2)
+}
+
+// EncryptAndSignCards mocks base method
+func (m *MockClient) EncryptAndSignCards(arg0 []pmapi.Card) ([]pmapi.Card, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EncryptAndSignCards", arg0)
+	ret0, _ := ret[0].([]pmapi.Card)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EncryptAndSignCards indicates an expected call of EncryptAndSignCards
+func (mr *MockClientMockRecorder) EncryptAndSignCards(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EmptyFolder", reflect.TypeOf((*MockClient)(nil).EmptyFolder), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EncryptAndSignCards", reflect.TypeOf((*MockClient)(nil).EncryptAndSignCards), arg0)
 }
 
 // GetAddresses mocks base method
-func (m *MockClient) GetAddresses() (pmapi.AddressList, error) {
+func (m *MockClient) GetAddresses(arg0 context.Context) (pmapi.AddressList, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAddresses")
+	ret := m.ctrl.Call(m, "GetAddresses", arg0)
 	ret0, _ := ret[0].(pmapi.AddressList)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAddresses indicates an expected call of GetAddresses
-func (mr *MockClientMockRecorder) GetAddresses() *gomock.Call {
+func (mr *MockClientMockRecorder) GetAddresses(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAddresses", reflect.TypeOf((*MockClient)(nil).GetAddresses))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAddresses", reflect.TypeOf((*MockClient)(nil).GetAddresses), arg0)
+}
+
+// GetAllContactsEmails mocks base method
+func (m *MockClient) GetAllContactsEmails(arg0 context.Context, arg1, arg2 int) ([]pmapi.ContactEmail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllContactsEmails", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]pmapi.ContactEmail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllContactsEmails indicates an expected call of GetAllContactsEmails
+func (mr *MockClientMockRecorder) GetAllContactsEmails(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllContactsEmails", reflect.TypeOf((*MockClient)(nil).GetAllContactsEmails), arg0, arg1, arg2)
 }
 
 // GetAttachment mocks base method
-func (m *MockClient) GetAttachment(arg0 string) (io.ReadCloser, error) {
+func (m *MockClient) GetAttachment(arg0 context.Context, arg1 string) (io.ReadCloser, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAttachment", arg0)
+	ret := m.ctrl.Call(m, "GetAttachment", arg0, arg1)
 	ret0, _ := ret[0].(io.ReadCloser)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAttachment indicates an expected call of GetAttachment
-func (mr *MockClientMockRecorder) GetAttachment(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) GetAttachment(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttachment", reflect.TypeOf((*MockClient)(nil).GetAttachment), arg0, arg1)
+}
+
+// GetCalendarEvent mocks base method
+func (m *MockClient) GetCalendarEvent(arg0 context.Context, arg1, arg2 string) (*pmapi.CalendarEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCalendarEvent", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*pmapi.CalendarEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCalendarEvent indicates an expected call of GetCalendarEvent
+func (mr *MockClientMockRecorder) GetCalendarEvent(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttachment", reflect.TypeOf((*MockClient)(nil).GetAttachment), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCalendarEvent", reflect.TypeOf((*MockClient)(nil).GetCalendarEvent), arg0, arg1, arg2)
 }
 
 // GetContactByID mocks base method
-func (m *MockClient) GetContactByID(arg0 string) (pmapi.Contact, error) {
+func (m *MockClient) GetContactByID(arg0 context.Context, arg1 string) (pmapi.Contact, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetContactByID", arg0)
+	ret := m.ctrl.Call(m, "GetContactByID", arg0, arg1)
 	ret0, _ := ret[0].(pmapi.Contact)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetContactByID indicates an expected call of GetContactByID
-func (mr *MockClientMockRecorder) GetContactByID(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) GetContactByID(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContactByID", reflect.TypeOf((*MockClient)(nil).GetContactByID), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContactByID", reflect.TypeOf((*MockClient)(nil).GetContactByID), arg0, arg1)
 }
 
 // GetContactEmailByEmail mocks base method
-func (m *MockClient) GetContactEmailByEmail(arg0 string, arg1, arg2 int) ([]pmapi.ContactEmail, error) {
+func (m *MockClient) GetContactEmailByEmail(arg0 context.Context, arg1 string, arg2, arg3 int) ([]pmapi.ContactEmail, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetContactEmailByEmail", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "GetContactEmailByEmail", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].([]pmapi.ContactEmail)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetContactEmailByEmail indicates an expected call of GetContactEmailByEmail
-func (mr *MockClientMockRecorder) GetContactEmailByEmail(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) GetContactEmailByEmail(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContactEmailByEmail", reflect.TypeOf((*MockClient)(nil).GetContactEmailByEmail), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContactEmailByEmail", reflect.TypeOf((*MockClient)(nil).GetContactEmailByEmail), arg0, arg1, arg2, arg3)
 }
 
 // GetEvent mocks base method
-func (m *MockClient) GetEvent(arg0 string) (*pmapi.Event, error) {
+func (m *MockClient) GetEvent(arg0 context.Context, arg1 string) (*pmapi.Event, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetEvent", arg0)
+	ret := m.ctrl.Call(m, "GetEvent", arg0, arg1)
 	ret0, _ := ret[0].(*pmapi.Event)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetEvent indicates an expected call of GetEvent
-func (mr *MockClientMockRecorder) GetEvent(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) GetEvent(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEvent", reflect.TypeOf((*MockClient)(nil).GetEvent), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEvent", reflect.TypeOf((*MockClient)(nil).GetEvent), arg0, arg1)
 }
 
 // GetMailSettings mocks base method
-func (m *MockClient) GetMailSettings() (pmapi.MailSettings, error) {
+func (m *MockClient) GetMailSettings(arg0 context.Context) (pmapi.MailSettings, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetMailSettings")
+	ret := m.ctrl.Call(m, "GetMailSettings", arg0)
 	ret0, _ := ret[0].(pmapi.MailSettings)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetMailSettings indicates an expected call of GetMailSettings
-func (mr *MockClientMockRecorder) GetMailSettings() *gomock.Call {
+func (mr *MockClientMockRecorder) GetMailSettings(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMailSettings", reflect.TypeOf((*MockClient)(nil).GetMailSettings))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMailSettings", reflect.TypeOf((*MockClient)(nil).GetMailSettings), arg0)
 }
 
 // GetMessage mocks base method
-func (m *MockClient) GetMessage(arg0 string) (*pmapi.Message, error) {
+func (m *MockClient) GetMessage(arg0 context.Context, arg1 string) (*pmapi.Message, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetMessage", arg0)
+	ret := m.ctrl.Call(m, "GetMessage", arg0, arg1)
 	ret0, _ := ret[0].(*pmapi.Message)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetMessage indicates an expected call of GetMessage
-func (mr *MockClientMockRecorder) GetMessage(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) GetMessage(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessage", reflect.TypeOf((*MockClient)(nil).GetMessage), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessage", reflect.TypeOf((*MockClient)(nil).GetMessage), arg0, arg1)
 }
 
 // GetPublicKeysForEmail mocks base method
-func (m *MockClient) GetPublicKeysForEmail(arg0 string) ([]pmapi.PublicKey, bool, error) {
+func (m *MockClient) GetPublicKeysForEmail(arg0 context.Context, arg1 string) ([]pmapi.PublicKey, bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPublicKeysForEmail", arg0)
+	ret := m.ctrl.Call(m, "GetPublicKeysForEmail", arg0, arg1)
 	ret0, _ := ret[0].([]pmapi.PublicKey)
 	ret1, _ := ret[1].(bool)
 	ret2, _ := ret[2].(error)
@@ -424,24 +500,39 @@ func (m *MockClient) GetPublicKeysForEmail(arg0 string) ([]pmapi.PublicKey, bool
 }
 
 // GetPublicKeysForEmail indicates an expected call of GetPublicKeysForEmail
-func (mr *MockClientMockRecorder) GetPublicKeysForEmail(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) GetPublicKeysForEmail(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPublicKeysForEmail", reflect.TypeOf((*MockClient)(nil).GetPublicKeysForEmail), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPublicKeysForEmail", reflect.TypeOf((*MockClient)(nil).GetPublicKeysForEmail), arg0, arg1)
+}
+
+// GetVerificationKeyRing mocks base method
+func (m *MockClient) GetVerificationKeyRing(arg0 context.Context, arg1 string) (*crypto.KeyRing, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVerificationKeyRing", arg0, arg1)
+	ret0, _ := ret[0].(*crypto.KeyRing)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVerificationKeyRing indicates an expected call of GetVerificationKeyRing
+func (mr *MockClientMockRecorder) GetVerificationKeyRing(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVerificationKeyRing", reflect.TypeOf((*MockClient)(nil).GetVerificationKeyRing), arg0, arg1)
 }
 
 // Import mocks base method
-func (m *MockClient) Import(arg0 []*pmapi.ImportMsgReq) ([]*pmapi.ImportMsgRes, error) {
+func (m *MockClient) Import(arg0 context.Context, arg1 []*pmapi.ImportMsgReq) ([]*pmapi.ImportMsgRes, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Import", arg0)
+	ret := m.ctrl.Call(m, "Import", arg0, arg1)
 	ret0, _ := ret[0].([]*pmapi.ImportMsgRes)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Import indicates an expected call of Import
-func (mr *MockClientMockRecorder) Import(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) Import(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Import", reflect.TypeOf((*MockClient)(nil).Import), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Import", reflect.TypeOf((*MockClient)(nil).Import), arg0, arg1)
 }
 
 // IsConnected mocks base method
@@ -487,39 +578,84 @@ func (mr *MockClientMockRecorder) KeyRingForAddressID(arg0 interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "KeyRingForAddressID", reflect.TypeOf((*MockClient)(nil).KeyRingForAddressID), arg0)
 }
 
+// KeyRingForCalendarID mocks base method
+func (m *MockClient) KeyRingForCalendarID(arg0 context.Context, arg1 string) (*crypto.KeyRing, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "KeyRingForCalendarID", arg0, arg1)
+	ret0, _ := ret[0].(*crypto.KeyRing)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// KeyRingForCalendarID indicates an expected call of KeyRingForCalendarID
+func (mr *MockClientMockRecorder) KeyRingForCalendarID(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "KeyRingForCalendarID", reflect.TypeOf((*MockClient)(nil).KeyRingForCalendarID), arg0, arg1)
+}
+
 // LabelMessages mocks base method
-func (m *MockClient) LabelMessages(arg0 []string, arg1 string) error {
+func (m *MockClient) LabelMessages(arg0 context.Context, arg1 []string, arg2 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "LabelMessages", arg0, arg1)
+	ret := m.ctrl.Call(m, "LabelMessages", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // LabelMessages indicates an expected call of LabelMessages
-func (mr *MockClientMockRecorder) LabelMessages(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) LabelMessages(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LabelMessages", reflect.TypeOf((*MockClient)(nil).LabelMessages), arg0, arg1, arg2)
+}
+
+// ListCalendarEvents mocks base method
+func (m *MockClient) ListCalendarEvents(arg0 context.Context, arg1 string, arg2 *pmapi.CalendarEventsFilter) ([]*pmapi.CalendarEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCalendarEvents", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*pmapi.CalendarEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListCalendarEvents indicates an expected call of ListCalendarEvents
+func (mr *MockClientMockRecorder) ListCalendarEvents(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LabelMessages", reflect.TypeOf((*MockClient)(nil).LabelMessages), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCalendarEvents", reflect.TypeOf((*MockClient)(nil).ListCalendarEvents), arg0, arg1, arg2)
+}
+
+// ListCalendars mocks base method
+func (m *MockClient) ListCalendars(arg0 context.Context) ([]*pmapi.Calendar, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCalendars", arg0)
+	ret0, _ := ret[0].([]*pmapi.Calendar)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListCalendars indicates an expected call of ListCalendars
+func (mr *MockClientMockRecorder) ListCalendars(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCalendars", reflect.TypeOf((*MockClient)(nil).ListCalendars), arg0)
 }
 
 // ListLabels mocks base method
-func (m *MockClient) ListLabels() ([]*pmapi.Label, error) {
+func (m *MockClient) ListLabels(arg0 context.Context) ([]*pmapi.Label, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ListLabels")
+	ret := m.ctrl.Call(m, "ListLabels", arg0)
 	ret0, _ := ret[0].([]*pmapi.Label)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // ListLabels indicates an expected call of ListLabels
-func (mr *MockClientMockRecorder) ListLabels() *gomock.Call {
+func (mr *MockClientMockRecorder) ListLabels(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLabels", reflect.TypeOf((*MockClient)(nil).ListLabels))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLabels", reflect.TypeOf((*MockClient)(nil).ListLabels), arg0)
 }
 
 // ListMessages mocks base method
-func (m *MockClient) ListMessages(arg0 *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+func (m *MockClient) ListMessages(arg0 context.Context, arg1 *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ListMessages", arg0)
+	ret := m.ctrl.Call(m, "ListMessages", arg0, arg1)
 	ret0, _ := ret[0].([]*pmapi.Message)
 	ret1, _ := ret[1].(int)
 	ret2, _ := ret[2].(error)
@@ -527,9 +663,9 @@ func (m *MockClient) ListMessages(arg0 *pmapi.MessagesFilter) ([]*pmapi.Message,
 }
 
 // ListMessages indicates an expected call of ListMessages
-func (mr *MockClientMockRecorder) ListMessages(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) ListMessages(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMessages", reflect.TypeOf((*MockClient)(nil).ListMessages), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMessages", reflect.TypeOf((*MockClient)(nil).ListMessages), arg0, arg1)
 }
 
 // Logout mocks base method
@@ -544,80 +680,94 @@ func (mr *MockClientMockRecorder) Logout() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logout", reflect.TypeOf((*MockClient)(nil).Logout))
 }
 
+// MarkMessagesHam mocks base method
+func (m *MockClient) MarkMessagesHam(arg0 context.Context, arg1 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkMessagesHam", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkMessagesHam indicates an expected call of MarkMessagesHam
+func (mr *MockClientMockRecorder) MarkMessagesHam(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkMessagesHam", reflect.TypeOf((*MockClient)(nil).MarkMessagesHam), arg0, arg1)
+}
+
 // MarkMessagesRead mocks base method
-func (m *MockClient) MarkMessagesRead(arg0 []string) error {
+func (m *MockClient) MarkMessagesRead(arg0 context.Context, arg1 []string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "MarkMessagesRead", arg0)
+	ret := m.ctrl.Call(m, "MarkMessagesRead", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // MarkMessagesRead indicates an expected call of MarkMessagesRead
-func (mr *MockClientMockRecorder) MarkMessagesRead(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) MarkMessagesRead(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkMessagesRead", reflect.TypeOf((*MockClient)(nil).MarkMessagesRead), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkMessagesRead", reflect.TypeOf((*MockClient)(nil).MarkMessagesRead), arg0, arg1)
 }
 
 // MarkMessagesUnread mocks base method
-func (m *MockClient) MarkMessagesUnread(arg0 []string) error {
+func (m *MockClient) MarkMessagesUnread(arg0 context.Context, arg1 []string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "MarkMessagesUnread", arg0)
+	ret := m.ctrl.Call(m, "MarkMessagesUnread", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // MarkMessagesUnread indicates an expected call of MarkMessagesUnread
-func (mr *MockClientMockRecorder) MarkMessagesUnread(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) MarkMessagesUnread(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkMessagesUnread", reflect.TypeOf((*MockClient)(nil).MarkMessagesUnread), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkMessagesUnread", reflect.TypeOf((*MockClient)(nil).MarkMessagesUnread), arg0, arg1)
 }
 
 // ReloadKeys mocks base method
-func (m *MockClient) ReloadKeys(arg0 []byte) error {
+func (m *MockClient) ReloadKeys(arg0 context.Context, arg1 []byte) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ReloadKeys", arg0)
+	ret := m.ctrl.Call(m, "ReloadKeys", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // ReloadKeys indicates an expected call of ReloadKeys
-func (mr *MockClientMockRecorder) ReloadKeys(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) ReloadKeys(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReloadKeys", reflect.TypeOf((*MockClient)(nil).ReloadKeys), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReloadKeys", reflect.TypeOf((*MockClient)(nil).ReloadKeys), arg0, arg1)
 }
 
 // ReorderAddresses mocks base method
-func (m *MockClient) ReorderAddresses(arg0 []string) error {
+func (m *MockClient) ReorderAddresses(arg0 context.Context, arg1 []string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ReorderAddresses", arg0)
+	ret := m.ctrl.Call(m, "ReorderAddresses", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // ReorderAddresses indicates an expected call of ReorderAddresses
-func (mr *MockClientMockRecorder) ReorderAddresses(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) ReorderAddresses(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReorderAddresses", reflect.TypeOf((*MockClient)(nil).ReorderAddresses), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReorderAddresses", reflect.TypeOf((*MockClient)(nil).ReorderAddresses), arg0, arg1)
 }
 
 // Report mocks base method
-func (m *MockClient) Report(arg0 pmapi.ReportReq) error {
+func (m *MockClient) Report(arg0 context.Context, arg1 pmapi.ReportReq) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Report", arg0)
+	ret := m.ctrl.Call(m, "Report", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Report indicates an expected call of Report
-func (mr *MockClientMockRecorder) Report(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) Report(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Report", reflect.TypeOf((*MockClient)(nil).Report), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Report", reflect.TypeOf((*MockClient)(nil).Report), arg0, arg1)
 }
 
 // SendMessage mocks base method
-func (m *MockClient) SendMessage(arg0 string, arg1 *pmapi.SendMessageReq) (*pmapi.Message, *pmapi.Message, error) {
+func (m *MockClient) SendMessage(arg0 context.Context, arg1 string, arg2 *pmapi.SendMessageReq) (*pmapi.Message, *pmapi.Message, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SendMessage", arg0, arg1)
+	ret := m.ctrl.Call(m, "SendMessage", arg0, arg1, arg2)
 	ret0, _ := ret[0].(*pmapi.Message)
 	ret1, _ := ret[1].(*pmapi.Message)
 	ret2, _ := ret[2].(error)
@@ -625,79 +775,123 @@ func (m *MockClient) SendMessage(arg0 string, arg1 *pmapi.SendMessageReq) (*pmap
 }
 
 // SendMessage indicates an expected call of SendMessage
-func (mr *MockClientMockRecorder) SendMessage(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) SendMessage(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessage", reflect.TypeOf((*MockClient)(nil).SendMessage), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessage", reflect.TypeOf((*MockClient)(nil).SendMessage), arg0, arg1, arg2)
 }
 
 // SendSimpleMetric mocks base method
-func (m *MockClient) SendSimpleMetric(arg0, arg1, arg2 string) error {
+func (m *MockClient) SendSimpleMetric(arg0 context.Context, arg1, arg2, arg3 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SendSimpleMetric", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "SendSimpleMetric", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SendSimpleMetric indicates an expected call of SendSimpleMetric
-func (mr *MockClientMockRecorder) SendSimpleMetric(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) SendSimpleMetric(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendSimpleMetric", reflect.TypeOf((*MockClient)(nil).SendSimpleMetric), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendSimpleMetric", reflect.TypeOf((*MockClient)(nil).SendSimpleMetric), arg0, arg1, arg2, arg3)
 }
 
 // UnlabelMessages mocks base method
-func (m *MockClient) UnlabelMessages(arg0 []string, arg1 string) error {
+func (m *MockClient) UnlabelMessages(arg0 context.Context, arg1 []string, arg2 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UnlabelMessages", arg0, arg1)
+	ret := m.ctrl.Call(m, "UnlabelMessages", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UnlabelMessages indicates an expected call of UnlabelMessages
-func (mr *MockClientMockRecorder) UnlabelMessages(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) UnlabelMessages(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnlabelMessages", reflect.TypeOf((*MockClient)(nil).UnlabelMessages), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnlabelMessages", reflect.TypeOf((*MockClient)(nil).UnlabelMessages), arg0, arg1, arg2)
 }
 
 // Unlock mocks base method
-func (m *MockClient) Unlock(arg0 []byte) error {
+func (m *MockClient) Unlock(arg0 context.Context, arg1 []byte) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Unlock", arg0)
+	ret := m.ctrl.Call(m, "Unlock", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Unlock indicates an expected call of Unlock
-func (mr *MockClientMockRecorder) Unlock(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) Unlock(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unlock", reflect.TypeOf((*MockClient)(nil).Unlock), arg0, arg1)
+}
+
+// UpdateAddress mocks base method
+func (m *MockClient) UpdateAddress(arg0 context.Context, arg1 string, arg2 *pmapi.UpdateAddressReq) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateAddress", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateAddress indicates an expected call of UpdateAddress
+func (mr *MockClientMockRecorder) UpdateAddress(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateAddress", reflect.TypeOf((*MockClient)(nil).UpdateAddress), arg0, arg1, arg2)
+}
+
+// UpdateContact mocks base method
+func (m *MockClient) UpdateContact(arg0 context.Context, arg1 string, arg2 []pmapi.Card) (*pmapi.UpdateContactResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateContact", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*pmapi.UpdateContactResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateContact indicates an expected call of UpdateContact
+func (mr *MockClientMockRecorder) UpdateContact(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateContact", reflect.TypeOf((*MockClient)(nil).UpdateContact), arg0, arg1, arg2)
+}
+
+// UpdateDraft mocks base method
+func (m *MockClient) UpdateDraft(arg0 context.Context, arg1 string, arg2 *pmapi.Message) (*pmapi.Message, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateDraft", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*pmapi.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateDraft indicates an expected call of UpdateDraft
+func (mr *MockClientMockRecorder) UpdateDraft(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unlock", reflect.TypeOf((*MockClient)(nil).Unlock), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateDraft", reflect.TypeOf((*MockClient)(nil).UpdateDraft), arg0, arg1, arg2)
 }
 
 // UpdateLabel mocks base method
-func (m *MockClient) UpdateLabel(arg0 *pmapi.Label) (*pmapi.Label, error) {
+func (m *MockClient) UpdateLabel(arg0 context.Context, arg1 *pmapi.Label) (*pmapi.Label, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateLabel", arg0)
+	ret := m.ctrl.Call(m, "UpdateLabel", arg0, arg1)
 	ret0, _ := ret[0].(*pmapi.Label)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UpdateLabel indicates an expected call of UpdateLabel
-func (mr *MockClientMockRecorder) UpdateLabel(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) UpdateLabel(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLabel", reflect.TypeOf((*MockClient)(nil).UpdateLabel), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLabel", reflect.TypeOf((*MockClient)(nil).UpdateLabel), arg0, arg1)
 }
 
 // UpdateUser mocks base method
-func (m *MockClient) UpdateUser() (*pmapi.User, error) {
+func (m *MockClient) UpdateUser(arg0 context.Context) (*pmapi.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateUser")
+	ret := m.ctrl.Call(m, "UpdateUser", arg0)
 	ret0, _ := ret[0].(*pmapi.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UpdateUser indicates an expected call of UpdateUser
-func (mr *MockClientMockRecorder) UpdateUser() *gomock.Call {
+func (mr *MockClientMockRecorder) UpdateUser(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockClient)(nil).UpdateUser))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockClient)(nil).UpdateUser), arg0)
 }
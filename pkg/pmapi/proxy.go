@@ -20,6 +20,7 @@ package pmapi
 import (
 	"context"
 	"encoding/base64"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -205,7 +206,7 @@ func (p *proxyProvider) defaultDoHLookup(ctx context.Context, query, dohProvider
 		encodedRequest := base64.RawURLEncoding.EncodeToString(rawRequest)
 
 		// Make DoH request to the given DoH provider.
-		rawResponse, err := resty.New().R().SetContext(ctx).SetQueryParam("dns", encodedRequest).Get(dohProvider)
+		rawResponse, err := resty.New().SetTransport(&http.Transport{Proxy: proxyForRequest}).R().SetContext(ctx).SetQueryParam("dns", encodedRequest).Get(dohProvider)
 		if err != nil {
 			errChan <- errors.Wrap(err, "failed to make DoH request")
 			return
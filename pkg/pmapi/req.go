@@ -19,25 +19,27 @@ package pmapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"mime/multipart"
 	"net/http"
 )
 
-// NewRequest creates a new request.
-func (c *client) NewRequest(method, path string, body io.Reader) (*http.Request, error) {
-	return http.NewRequest(method, c.cm.GetRootURL()+path, body)
+// NewRequest creates a new request which is aborted, including waiting
+// before retries, once the context is done.
+func (c *client) NewRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, method, c.cm.GetRootURL()+path, body)
 }
 
 // NewJSONRequest create a new JSON request.
-func (c *client) NewJSONRequest(method, path string, body interface{}) (*http.Request, error) {
+func (c *client) NewJSONRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
 	b, err := json.Marshal(body)
 	if err != nil {
 		panic(err)
 	}
 
-	req, err := c.NewRequest(method, path, bytes.NewReader(b))
+	req, err := c.NewRequest(ctx, method, path, bytes.NewReader(b))
 	if err != nil {
 		return nil, err
 	}
@@ -66,7 +68,7 @@ func (w *MultipartWriter) Close() error {
 // that writing the request and sending it MUST be done in parallel. If the
 // request fails, subsequent writes to the multipart writer will fail with an
 // io.ErrClosedPipe error.
-func (c *client) NewMultipartRequest(method, path string) (req *http.Request, w *MultipartWriter, err error) {
+func (c *client) NewMultipartRequest(ctx context.Context, method, path string) (req *http.Request, w *MultipartWriter, err error) {
 	// The pipe will connect the multipart writer and the HTTP request body.
 	pr, pw := io.Pipe()
 
@@ -76,7 +78,7 @@ func (c *client) NewMultipartRequest(method, path string) (req *http.Request, w
 		pw,
 	}
 
-	req, err = c.NewRequest(method, path, pr)
+	req, err = c.NewRequest(ctx, method, path, pr)
 	if err != nil {
 		return
 	}
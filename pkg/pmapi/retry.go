@@ -0,0 +1,195 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/tracing"
+)
+
+// RetryPolicy controls how requests failed with a transient error are
+// retried. Transient errors are HTTP 429 Too Many Requests, API code
+// BansRequests and, for idempotent methods only, HTTP 5xx statuses.
+//
+// Wait before the retry starts with MinBackoff and doubles with every next
+// attempt up to MaxBackoff. Random jitter is added to not retry all requests
+// at the same time. When the server sends the Retry-After header, the wait
+// is never shorter.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+// DefaultRetryPolicy is used when ClientConfig does not set the policy.
+var DefaultRetryPolicy = RetryPolicy{ //nolint[gochecknoglobals]
+	MaxAttempts: 10,
+	MinBackoff:  time.Second,
+	MaxBackoff:  time.Minute,
+}
+
+// withDefaults replaces unset values by values of DefaultRetryPolicy.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = DefaultRetryPolicy.MinBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.MaxBackoff < p.MinBackoff {
+		p.MaxBackoff = p.MinBackoff
+	}
+	return p
+}
+
+// backoff returns how long to wait after the failed attempt (starting at
+// one) before the next one.
+func (p RetryPolicy) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	wait := p.MinBackoff
+	for i := 1; i < attempt && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+
+	if retryAfter > 0 {
+		return retryAfter + time.Duration(rand.Int63n(int64(wait))) //nolint[gosec]
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1)) //nolint[gosec]
+}
+
+// isRetryableStatus returns whether the response status is transient and
+// the request can be sent again.
+func isRetryableStatus(method string, status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	if status < 500 || status == http.StatusNotImplemented {
+		return false
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses value of the Retry-After header which is either
+// number of seconds or HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// RetryMetrics counts retries of all clients of the client manager.
+type RetryMetrics struct {
+	// Retries is the total number of retried requests.
+	Retries uint64
+	// GaveUp is the number of requests which failed after all attempts.
+	GaveUp uint64
+	// ByCode is the number of retries by HTTP status or API code.
+	ByCode map[int]uint64
+}
+
+type retryCounter struct {
+	metrics RetryMetrics
+	lock    sync.Mutex
+}
+
+func (rc *retryCounter) retry(code int) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	if rc.metrics.ByCode == nil {
+		rc.metrics.ByCode = map[int]uint64{}
+	}
+	rc.metrics.Retries++
+	rc.metrics.ByCode[code]++
+}
+
+func (rc *retryCounter) gaveUp() {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	rc.metrics.GaveUp++
+}
+
+func (rc *retryCounter) get() RetryMetrics {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	metrics := rc.metrics
+	metrics.ByCode = map[int]uint64{}
+	for code, count := range rc.metrics.ByCode {
+		metrics.ByCode[code] = count
+	}
+	return metrics
+}
+
+// GetRetryMetrics returns counts of retried requests of all clients.
+func (cm *ClientManager) GetRetryMetrics() RetryMetrics {
+	return cm.retries.get()
+}
+
+// waitBeforeRetry decides whether the failed attempt can be retried. If so,
+// it waits and returns true.
+func (c *client) waitBeforeRetry(req *http.Request, attempt, code int, retryAfter time.Duration) bool {
+	policy := c.cm.config.Retry.withDefaults()
+	log := tracing.Logger(req.Context(), c.log)
+	if attempt >= policy.MaxAttempts {
+		c.cm.retries.gaveUp()
+		log.Warningf("Giving up %s after %d attempts, last code %d", req.URL.Path, attempt, code)
+		return false
+	}
+
+	wait := policy.backoff(attempt, retryAfter)
+	c.cm.retries.retry(code)
+	log.Warningf("Retrying %s after %v induced by code %d (attempt %d)", req.URL.Path, wait, code, attempt)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-req.Context().Done():
+		log.Debugf("Not retrying %s, request was cancelled", req.URL.Path)
+		return false
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, MinBackoff: time.Second, MaxBackoff: 4 * time.Second}
+
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		wait := policy.backoff(attempt+1, 0)
+		require.True(t, max/2 <= wait && wait <= max, "attempt %d waits %v", attempt+1, wait)
+	}
+
+	wait := policy.backoff(1, 10*time.Second)
+	require.True(t, 10*time.Second <= wait && wait < 11*time.Second, "waits %v", wait)
+
+	require.Equal(t, DefaultRetryPolicy, RetryPolicy{}.withDefaults())
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	require.True(t, isRetryableStatus("POST", http.StatusTooManyRequests))
+	require.True(t, isRetryableStatus("GET", http.StatusServiceUnavailable))
+	require.True(t, isRetryableStatus("PUT", http.StatusBadGateway))
+	require.False(t, isRetryableStatus("POST", http.StatusServiceUnavailable))
+	require.False(t, isRetryableStatus("GET", http.StatusNotImplemented))
+	require.False(t, isRetryableStatus("GET", http.StatusUnprocessableEntity))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	require.Equal(t, time.Minute, parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now))
+	require.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	require.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+	require.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
+
+func statusCallback(status int) func(testing.TB, http.ResponseWriter, *http.Request) string {
+	return func(tb testing.TB, w http.ResponseWriter, req *http.Request) string {
+		w.WriteHeader(status)
+		return ""
+	}
+}
+
+func withTestRetryPolicy(c *client, maxAttempts int) {
+	config := *c.cm.config
+	config.Retry = RetryPolicy{MaxAttempts: maxAttempts, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	c.cm.config = &config
+}
+
+func TestClient_RetryServerError(t *testing.T) {
+	finish, c := newTestServerCallbacks(t,
+		statusCallback(http.StatusServiceUnavailable),
+		statusCallback(http.StatusBadGateway),
+		func(tb testing.TB, w http.ResponseWriter, req *http.Request) string {
+			return "/HTTP_200.json"
+		},
+	)
+	defer finish()
+	withTestRetryPolicy(c, 3)
+
+	require.NoError(t, c.SendSimpleMetric(context.Background(), "some_category", "some_action", "some_label"))
+
+	metrics := c.cm.GetRetryMetrics()
+	require.Equal(t, uint64(2), metrics.Retries)
+	require.Equal(t, uint64(0), metrics.GaveUp)
+	require.Equal(t, map[int]uint64{http.StatusServiceUnavailable: 1, http.StatusBadGateway: 1}, metrics.ByCode)
+}
+
+func TestClient_RetryGivesUp(t *testing.T) {
+	finish, c := newTestServerCallbacks(t,
+		statusCallback(http.StatusTooManyRequests),
+		statusCallback(http.StatusTooManyRequests),
+	)
+	defer finish()
+	withTestRetryPolicy(c, 2)
+
+	req, err := c.NewRequest(context.Background(), "GET", "/", nil)
+	require.NoError(t, err)
+	res, err := c.Do(req, false)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	_ = res.Body.Close()
+
+	metrics := c.cm.GetRetryMetrics()
+	require.Equal(t, uint64(1), metrics.Retries)
+	require.Equal(t, uint64(1), metrics.GaveUp)
+}
+
+func TestClient_NoRetryOfServerErrorForPost(t *testing.T) {
+	finish, c := newTestServerCallbacks(t,
+		statusCallback(http.StatusServiceUnavailable),
+	)
+	defer finish()
+	withTestRetryPolicy(c, 3)
+
+	req, err := c.NewRequest(context.Background(), "POST", "/", nil)
+	require.NoError(t, err)
+	res, err := c.Do(req, false)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	_ = res.Body.Close()
+
+	require.Equal(t, uint64(0), c.cm.GetRetryMetrics().Retries)
+}
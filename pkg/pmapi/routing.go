@@ -0,0 +1,147 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultDoHProviders returns DNS-over-HTTPS resolvers used by alternative
+// routing unless others are set.
+func DefaultDoHProviders() []string {
+	return append([]string{}, dohProviders...)
+}
+
+// ParseDoHProviders validates comma-separated URLs of DNS-over-HTTPS
+// resolvers, e.g. `https://dns.example.com/dns-query`. It returns nil for
+// empty value.
+func ParseDoHProviders(value string) (providers []string, err error) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		providerURL, err := url.Parse(item)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid DoH provider URL")
+		}
+		if providerURL.Scheme != "https" || providerURL.Host == "" {
+			return nil, fmt.Errorf("DoH provider %q must be an https URL", item)
+		}
+
+		providers = append(providers, providerURL.String())
+	}
+
+	return providers, nil
+}
+
+// ParseAPIHost validates the API host, e.g. `api.example.com` or
+// `api.example.com:8443/api`; `https://` prefix is removed. It returns empty
+// string for empty value.
+func ParseAPIHost(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+
+	if strings.Contains(value, "://") {
+		hostURL, err := url.Parse(value)
+		if err != nil {
+			return "", errors.Wrap(err, "invalid API host")
+		}
+		if hostURL.Scheme != "https" {
+			return "", fmt.Errorf("API host must use https, not %q", hostURL.Scheme)
+		}
+		value = hostURL.Host + hostURL.Path
+	}
+
+	value = strings.TrimSuffix(value, "/")
+	hostURL, err := url.Parse("https://" + value)
+	if err != nil || hostURL.Hostname() == "" || hostURL.RawQuery != "" || hostURL.Fragment != "" {
+		return "", fmt.Errorf("invalid API host %q", value)
+	}
+
+	return value, nil
+}
+
+// SetDoHProviders sets DNS-over-HTTPS resolvers queried for proxies by
+// alternative routing. Default providers are used when empty.
+func (cm *ClientManager) SetDoHProviders(providers []string) {
+	cm.hostLocker.Lock()
+	defer cm.hostLocker.Unlock()
+
+	if len(providers) == 0 {
+		providers = dohProviders
+	}
+	cm.proxyProvider.providers = providers
+}
+
+// GetDoHProviders returns DNS-over-HTTPS resolvers used by alternative routing.
+func (cm *ClientManager) GetDoHProviders() []string {
+	cm.hostLocker.RLock()
+	defer cm.hostLocker.RUnlock()
+
+	return append([]string{}, cm.proxyProvider.providers...)
+}
+
+// SetAPIHost pins the host requests are sent to. Alternative routing never
+// switches away from a pinned host. The default API host is used when
+// empty. The host must still present certificate of Proton, it is checked
+// the same way as the default one.
+func (cm *ClientManager) SetAPIHost(host string) {
+	cm.hostLocker.Lock()
+	defer cm.hostLocker.Unlock()
+
+	cm.pinnedHost = host
+	cm.host = cm.defaultHost()
+
+	for _, client := range cm.clients {
+		client.CloseConnections()
+	}
+}
+
+// GetAPIHost returns the pinned API host or empty string when requests are
+// sent to the default one.
+func (cm *ClientManager) GetAPIHost() string {
+	cm.hostLocker.RLock()
+	defer cm.hostLocker.RUnlock()
+
+	return cm.pinnedHost
+}
+
+// defaultHost returns the host used unless requests go through a proxy.
+// It must be called with hostLocker held.
+func (cm *ClientManager) defaultHost() string {
+	if cm.pinnedHost != "" {
+		return cm.pinnedHost
+	}
+	return rootURL
+}
+
+// canSwitchHost returns whether alternative routing can switch requests
+// to a proxy.
+func (cm *ClientManager) canSwitchHost() bool {
+	cm.hostLocker.RLock()
+	defer cm.hostLocker.RUnlock()
+
+	return cm.allowProxy && cm.pinnedHost == ""
+}
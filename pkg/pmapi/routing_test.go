@@ -0,0 +1,90 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDoHProviders(t *testing.T) {
+	providers, err := ParseDoHProviders(" https://dns.example.com/dns-query, ,https://1.1.1.1/dns-query")
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://dns.example.com/dns-query", "https://1.1.1.1/dns-query"}, providers)
+
+	providers, err = ParseDoHProviders("")
+	require.NoError(t, err)
+	require.Nil(t, providers)
+
+	for _, value := range []string{"http://dns.example.com/dns-query", "dns.example.com", "https:///dns-query"} {
+		_, err := ParseDoHProviders(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestParseAPIHost(t *testing.T) {
+	testData := map[string]string{
+		"":                                  "",
+		"api.example.com":                   "api.example.com",
+		" https://api.example.com/ ":        "api.example.com",
+		"api.example.com:8443/api":          "api.example.com:8443/api",
+		"https://api.example.com:8443/api/": "api.example.com:8443/api",
+		"mail-api.proton.me":                "mail-api.proton.me",
+	}
+	for value, want := range testData {
+		host, err := ParseAPIHost(value)
+		require.NoError(t, err, value)
+		require.Equal(t, want, host, value)
+	}
+
+	for _, value := range []string{"http://api.example.com", "https://", "api.example.com/?query", ":443"} {
+		_, err := ParseAPIHost(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestSetAPIHost(t *testing.T) {
+	cm := newTestClientManager(testClientConfig)
+	cm.AllowProxy()
+	require.True(t, cm.canSwitchHost())
+
+	cm.SetAPIHost("api.example.com")
+	require.Equal(t, "https://api.example.com", cm.GetRootURL())
+	require.False(t, cm.IsProxyEnabled())
+	require.False(t, cm.canSwitchHost())
+
+	cm.DisallowProxy()
+	require.Equal(t, "api.example.com", cm.getHost())
+
+	cm.SetAPIHost("")
+	require.Equal(t, rootURL, cm.getHost())
+	require.Equal(t, "", cm.GetAPIHost())
+}
+
+func TestRoutingClientConfig(t *testing.T) {
+	cm := newTestClientManager(&ClientConfig{
+		DoHProviders: []string{"https://dns.example.com/dns-query"},
+		APIHost:      "api.example.com",
+	})
+	require.Equal(t, []string{"https://dns.example.com/dns-query"}, cm.GetDoHProviders())
+	require.Equal(t, "api.example.com", cm.getHost())
+
+	cm.SetDoHProviders(nil)
+	require.Equal(t, DefaultDoHProviders(), cm.GetDoHProviders())
+}
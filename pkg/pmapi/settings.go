@@ -17,6 +17,8 @@
 
 package pmapi
 
+import "context"
+
 type UserSettings struct {
 	PasswordMode int
 	Email        struct {
@@ -44,8 +46,8 @@ type UserSettings struct {
 }
 
 // GetUserSettings gets general settings.
-func (c *client) GetUserSettings() (settings UserSettings, err error) {
-	req, err := c.NewRequest("GET", "/settings", nil)
+func (c *client) GetUserSettings(ctx context.Context) (settings UserSettings, err error) {
+	req, err := c.NewRequest(ctx, "GET", "/settings", nil)
 
 	if err != nil {
 		return
@@ -103,8 +105,8 @@ const (
 )
 
 // GetMailSettings gets contact details specified by contact ID.
-func (c *client) GetMailSettings() (settings MailSettings, err error) {
-	req, err := c.NewRequest("GET", "/settings/mail", nil)
+func (c *client) GetMailSettings(ctx context.Context) (settings MailSettings, err error) {
+	req, err := c.NewRequest(ctx, "GET", "/settings/mail", nil)
 
 	if err != nil {
 		return
@@ -0,0 +1,140 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"golang.org/x/crypto/openpgp"
+	openpgperrors "golang.org/x/crypto/openpgp/errors"
+)
+
+// SignatureStatus is the result of verification of the signature embedded
+// in the encrypted body of the message.
+type SignatureStatus int
+
+const (
+	// SignatureNotChecked means keys of the sender were not available.
+	SignatureNotChecked SignatureStatus = iota
+	// SignatureNone means the message is not signed.
+	SignatureNone
+	// SignatureValid means the message is signed by a key of the sender.
+	SignatureValid
+	// SignatureInvalid means the signature does not match the content.
+	SignatureInvalid
+	// SignatureUnknownKey means the message is signed by other key than
+	// those of the sender.
+	SignatureUnknownKey
+)
+
+func (s SignatureStatus) String() string {
+	switch s {
+	case SignatureNone:
+		return "none"
+	case SignatureValid:
+		return "valid"
+	case SignatureInvalid:
+		return "invalid"
+	case SignatureUnknownKey:
+		return "unknown-key"
+	}
+	return "not-checked"
+}
+
+// DecryptAndVerify decrypts the body like Decrypt and checks the signature
+// embedded in the encrypted body by the keys of the sender. Nil verifiers
+// means keys of the sender are not known and only unsigned messages are
+// recognised.
+func (m *Message) DecryptAndVerify(kr, verifiers *crypto.KeyRing) (SignatureStatus, error) {
+	if m.IsLegacyMessage() || !m.IsBodyEncrypted() {
+		return SignatureNotChecked, m.Decrypt(kr)
+	}
+
+	body, status, err := decryptAndVerify(kr, verifiers, strings.TrimSpace(m.Body))
+	if err != nil {
+		// Verification is not worth failing the message which can be still
+		// decrypted the usual way.
+		return SignatureNotChecked, m.Decrypt(kr)
+	}
+
+	m.Body = body
+	return status, nil
+}
+
+func decryptAndVerify(kr, verifiers *crypto.KeyRing, armored string) (string, SignatureStatus, error) {
+	pgpMessage, err := crypto.NewPGPMessageFromArmored(armored)
+	if err != nil {
+		return "", SignatureNotChecked, err
+	}
+
+	entities := openpgp.EntityList{}
+	if verifiers != nil {
+		if entities, err = keyRingEntities(verifiers); err != nil {
+			return "", SignatureNotChecked, err
+		}
+	}
+
+	symReader, err := decryptDataPacket(kr, nil, bytes.NewReader(pgpMessage.GetBinary()))
+	if err != nil {
+		return "", SignatureNotChecked, err
+	}
+
+	md, err := openpgp.ReadMessage(symReader, entities, nil, nil)
+	if err != nil {
+		return "", SignatureNotChecked, err
+	}
+
+	// Signature is checked once the whole body is read.
+	body, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return "", SignatureNotChecked, err
+	}
+
+	switch {
+	case !md.IsSigned:
+		return string(body), SignatureNone, nil
+	case verifiers == nil:
+		return string(body), SignatureNotChecked, nil
+	case md.SignedBy == nil:
+		return string(body), SignatureUnknownKey, nil
+	case md.SignatureError == nil, md.SignatureError == openpgperrors.ErrSignatureExpired:
+		// Expiration is tolerated the same way as by decryption.
+		return string(body), SignatureValid, nil
+	}
+	return string(body), SignatureInvalid, nil
+}
+
+// keyRingEntities returns public entities of the keys of the key ring.
+func keyRingEntities(kr *crypto.KeyRing) (openpgp.EntityList, error) {
+	entities := openpgp.EntityList{}
+	for _, key := range kr.GetKeys() {
+		serialized, err := key.GetPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		keyEntities, err := openpgp.ReadKeyRing(bytes.NewReader(serialized))
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, keyEntities...)
+	}
+	return entities, nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessage_DecryptAndVerify(t *testing.T) {
+	otherKey, err := crypto.GenerateKey("other", "other@pm.me", "x25519", 0)
+	require.NoError(t, err)
+	otherKeyRing, err := crypto.NewKeyRing(otherKey)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		signer    *crypto.KeyRing
+		verifiers *crypto.KeyRing
+		want      SignatureStatus
+	}{
+		{"valid", testPrivateKeyRing, testPublicKeyRing, SignatureValid},
+		{"unknown key", otherKeyRing, testPublicKeyRing, SignatureUnknownKey},
+		{"not signed", nil, testPublicKeyRing, SignatureNone},
+		{"no verifiers", testPrivateKeyRing, nil, SignatureNotChecked},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &Message{Body: testMessageCleartext}
+			require.NoError(t, msg.Encrypt(testPrivateKeyRing, tc.signer))
+
+			status, err := msg.DecryptAndVerify(testPrivateKeyRing, tc.verifiers)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, status)
+			require.Equal(t, testMessageCleartext, msg.Body)
+		})
+	}
+}
+
+func TestMessage_DecryptAndVerifyNotEncrypted(t *testing.T) {
+	msg := &Message{Body: testMessageCleartext}
+
+	status, err := msg.DecryptAndVerify(testPrivateKeyRing, testPublicKeyRing)
+	require.NoError(t, err)
+	require.Equal(t, SignatureNotChecked, status)
+	require.Equal(t, testMessageCleartext, msg.Body)
+}
+
+func TestClient_GetVerificationKeyRing(t *testing.T) {
+	publicKey, err := testPublicKeyRing.GetKeys()[0].Armor()
+	require.NoError(t, err)
+
+	calls := 0
+	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		require.NoError(t, checkMethodAndPath(r, "GET", "/keys?Email=sender%40pm.me"))
+		require.NoError(t, json.NewEncoder(w).Encode(PublicKeyRes{
+			Res: Res{Code: 1000},
+			Keys: []PublicKey{
+				{Flags: UseToVerifyFlag | UseToEncryptFlag, PublicKey: publicKey},
+				{Flags: 0, PublicKey: publicKey},
+			},
+		}))
+	}))
+	defer s.Close()
+
+	kr, err := c.GetVerificationKeyRing(context.Background(), "Sender@pm.me")
+	require.NoError(t, err)
+	require.Equal(t, 1, kr.CountEntities())
+
+	// Keys of the sender are fetched only once.
+	_, err = c.GetVerificationKeyRing(context.Background(), "sender@pm.me")
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+}
@@ -18,6 +18,8 @@
 package pmapi
 
 import (
+	"context"
+
 	"github.com/getsentry/raven-go"
 	"github.com/pkg/errors"
 )
@@ -102,8 +104,8 @@ func (c *client) unlockUser(passphrase []byte) (err error) {
 }
 
 // UpdateUser retrieves details about user and loads its addresses.
-func (c *client) UpdateUser() (user *User, err error) {
-	req, err := c.NewRequest("GET", "/users", nil)
+func (c *client) UpdateUser(ctx context.Context) (user *User, err error) {
+	req, err := c.NewRequest(ctx, "GET", "/users", nil)
 	if err != nil {
 		return
 	}
@@ -122,7 +124,7 @@ func (c *client) UpdateUser() (user *User, err error) {
 	raven.SetUserContext(&raven.User{ID: user.ID})
 
 	var tmpList AddressList
-	if tmpList, err = c.GetAddresses(); err == nil {
+	if tmpList, err = c.GetAddresses(ctx); err == nil {
 		c.addresses = tmpList
 	}
 
@@ -130,10 +132,10 @@ func (c *client) UpdateUser() (user *User, err error) {
 }
 
 // CurrentUser returns currently active user or user will be updated.
-func (c *client) CurrentUser() (user *User, err error) {
+func (c *client) CurrentUser(ctx context.Context) (user *User, err error) {
 	if c.user != nil && len(c.addresses) != 0 {
 		user = c.user
 		return
 	}
-	return c.UpdateUser()
+	return c.UpdateUser(ctx)
 }
@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -68,13 +69,13 @@ func TestClient_CurrentUser(t *testing.T) {
 	c.uid = testUID
 	c.accessToken = testAccessToken
 
-	user, err := c.CurrentUser()
+	user, err := c.CurrentUser(context.Background())
 	r.Nil(t, err)
 
 	// Ignore KeyRings during the check because they have unexported fields and cannot be compared
 	r.True(t, cmp.Equal(user, testCurrentUser, cmpopts.IgnoreTypes(&crypto.Key{})))
 
-	r.Nil(t, c.Unlock([]byte(testMailboxPassword)))
+	r.Nil(t, c.Unlock(context.Background(), []byte(testMailboxPassword)))
 }
 
 func TestClient_PublicKeys(t *testing.T) {
@@ -86,7 +87,7 @@ func TestClient_PublicKeys(t *testing.T) {
 	}))
 	defer s.Close()
 
-	keys, err := c.PublicKeys([]string{email})
+	keys, err := c.PublicKeys(context.Background(), []string{email})
 	if err != nil {
 		t.Fatal("Expected no error while getting current user, got:", err)
 	}
@@ -51,13 +51,19 @@ type Thread struct {
 
 // TraceAllRoutines traces all goroutines and saves them to the current object.
 func (s *Threads) TraceAllRoutines() {
-	s.Values = []Thread{}
 	goroutines := &strings.Builder{}
 	_ = pprof.Lookup("goroutine").WriteTo(goroutines, 2)
+	s.ParseRoutines(goroutines.String())
+}
+
+// ParseRoutines saves goroutines from the stack dump, as written by
+// `runtime.Stack`, to the current object. The first one is the crashed one.
+func (s *Threads) ParseRoutines(goroutines string) {
+	s.Values = []Thread{}
 
 	thread := Thread{ID: -1}
 	var frame *raven.StacktraceFrame
-	for _, v := range strings.Split(goroutines.String(), "\n") {
+	for _, v := range strings.Split(goroutines, "\n") {
 		// Ignore empty lines.
 		if v == "" {
 			continue
@@ -165,6 +171,33 @@ func ReportSentryCrash(clientID, appVersion, userAgent string, reportErr error)
 	errorWithFile := findPanicSender(threads, reportErr)
 	packet := raven.NewPacket(errorWithFile, threads)
 
+	return capture(packet, tags, reportErr)
+}
+
+// ReportSavedCrash reports a crash saved earlier with the stack dump of all
+// goroutines, as written by `runtime.Stack`, and extra info such as log.
+func ReportSavedCrash(clientID, appVersion, userAgent string, reportErr error, stack string, extra map[string]interface{}) (err error) {
+	if reportErr == nil {
+		return
+	}
+
+	tags := map[string]string{
+		"OS":        runtime.GOOS,
+		"Client":    clientID,
+		"Version":   appVersion,
+		"UserAgent": userAgent,
+		"UserID":    "",
+	}
+
+	threads := &Threads{}
+	threads.ParseRoutines(stack)
+	errorWithFile := findPanicSender(threads, reportErr)
+	packet := raven.NewPacketWithExtra(errorWithFile, extra, threads)
+
+	return capture(packet, tags, reportErr)
+}
+
+func capture(packet *raven.Packet, tags map[string]string, reportErr error) (err error) {
 	eventID, ch := raven.Capture(packet, tags)
 
 	if err = <-ch; err == nil {
@@ -19,9 +19,11 @@ package sentry
 
 import (
 	"errors"
+	"runtime"
 	"testing"
 
 	"github.com/getsentry/raven-go"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSentryCrashReport(t *testing.T) {
@@ -67,3 +69,21 @@ func (s *Threads) TraceAllRoutinesTest() {
 		},
 	}
 }
+
+func TestParseRoutinesFindsPanicSender(t *testing.T) {
+	var stack string
+	func() {
+		defer func() {
+			_ = recover()
+			buf := make([]byte, 1<<16)
+			stack = string(buf[:runtime.Stack(buf, true)])
+		}()
+		panic("at the disco")
+	}()
+
+	threads := &Threads{}
+	threads.ParseRoutines(stack)
+	require.True(t, len(threads.Values) > 0)
+	require.True(t, threads.Values[0].Crashed)
+	require.Contains(t, findPanicSender(threads, errors.New("at the disco")), "sentry/report_test.go:")
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}     //nolint[gochecknoglobals]
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}     //nolint[gochecknoglobals]
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}     //nolint[gochecknoglobals]
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}     //nolint[gochecknoglobals]
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}     //nolint[gochecknoglobals]
+	oidRSA           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}     //nolint[gochecknoglobals]
+	oidSHA1WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}     //nolint[gochecknoglobals]
+	oidSHA256WithRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}    //nolint[gochecknoglobals]
+	oidSHA384WithRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}    //nolint[gochecknoglobals]
+	oidSHA512WithRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}    //nolint[gochecknoglobals]
+	oidECPublicKey   = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}         //nolint[gochecknoglobals]
+	oidECDSAWithSHA1 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}         //nolint[gochecknoglobals]
+	oidECDSAWith256  = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}      //nolint[gochecknoglobals]
+	oidECDSAWith384  = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}      //nolint[gochecknoglobals]
+	oidECDSAWith512  = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}      //nolint[gochecknoglobals]
+	oidSHA1          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}             //nolint[gochecknoglobals]
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1} //nolint[gochecknoglobals]
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2} //nolint[gochecknoglobals]
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3} //nolint[gochecknoglobals]
+)
+
+// contentInfo is the outer structure of CMS, RFC 5652 section 3.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// signedData is the CMS SignedData, RFC 5652 section 5.1. Only detached
+// signatures are created, so the encapsulated content is left out.
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// signerInfo is RFC 5652 section 5.3. Signed attributes are kept raw
+// because the signature is computed over their original encoding.
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+var errUnsupportedAlgorithm = errors.New("unsupported algorithm")
+
+// digestHash returns the hash of the digest algorithm.
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, errUnsupportedAlgorithm
+}
+
+// x509SignatureAlgorithm returns the algorithm to check the signature with.
+// Some implementations put just the key algorithm, e.g. rsaEncryption, in
+// the signer info; the hash is then given by the digest algorithm.
+func x509SignatureAlgorithm(sigOID asn1.ObjectIdentifier, hash crypto.Hash) (x509.SignatureAlgorithm, error) { //nolint[gocyclo]
+	switch {
+	case sigOID.Equal(oidSHA1WithRSA):
+		return x509.SHA1WithRSA, nil
+	case sigOID.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, nil
+	case sigOID.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, nil
+	case sigOID.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, nil
+	case sigOID.Equal(oidECDSAWithSHA1):
+		return x509.ECDSAWithSHA1, nil
+	case sigOID.Equal(oidECDSAWith256):
+		return x509.ECDSAWithSHA256, nil
+	case sigOID.Equal(oidECDSAWith384):
+		return x509.ECDSAWithSHA384, nil
+	case sigOID.Equal(oidECDSAWith512):
+		return x509.ECDSAWithSHA512, nil
+	case sigOID.Equal(oidRSA):
+		switch hash {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case sigOID.Equal(oidECPublicKey):
+		switch hash {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1, nil
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, errUnsupportedAlgorithm
+}
+
+// signatureAlgorithmFor returns the SHA-256 signature algorithm for the
+// key. Only RSA and ECDSA keys are supported.
+func signatureAlgorithmFor(key crypto.PublicKey) (asn1.ObjectIdentifier, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return oidSHA256WithRSA, nil
+	case *ecdsa.PublicKey:
+		return oidECDSAWith256, nil
+	}
+	return nil, errUnsupportedAlgorithm
+}
+
+// marshalSignedAttributes returns DER of signed attributes as SET OF, which
+// is the input of the signature.
+func marshalSignedAttributes(digest []byte, now time.Time) ([]byte, error) {
+	contentType, err := asn1.Marshal(oidData)
+	if err != nil {
+		return nil, err
+	}
+	signingTime, err := asn1.Marshal(now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	messageDigest, err := asn1.Marshal(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := []attribute{
+		{Type: oidContentType, Values: []asn1.RawValue{{FullBytes: contentType}}},
+		{Type: oidSigningTime, Values: []asn1.RawValue{{FullBytes: signingTime}}},
+		{Type: oidMessageDigest, Values: []asn1.RawValue{{FullBytes: messageDigest}}},
+	}
+
+	// Elements of DER SET OF must be sorted by their encoding.
+	encoded := make([][]byte, len(attrs))
+	for i, attr := range attrs {
+		if encoded[i], err = asn1.Marshal(attr); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSet,
+		IsCompound: true,
+		Bytes:      bytes.Join(encoded, nil),
+	})
+}
+
+// messageDigestAttribute returns the value of the message digest attribute
+// from DER of signed attributes.
+func messageDigestAttribute(signedAttrs []byte) ([]byte, error) {
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(signedAttrs, &attrs, "set"); err != nil {
+		return nil, err
+	}
+
+	for _, attr := range attrs {
+		if !attr.Type.Equal(oidMessageDigest) || len(attr.Values) != 1 {
+			continue
+		}
+		var digest []byte
+		if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &digest); err != nil {
+			return nil, err
+		}
+		return digest, nil
+	}
+
+	return nil, errors.New("missing message digest attribute")
+}
@@ -0,0 +1,270 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smime
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"mime"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	signedMIMEType    = "multipart/signed"
+	signatureMIMEType = "application/pkcs7-signature"
+
+	// legacySignatureMIMEType is still used by some older clients.
+	legacySignatureMIMEType = "application/x-pkcs7-signature"
+)
+
+// SignMessage returns the message with its content signed as
+// multipart/signed. Content-* fields are moved from the message header
+// to the signed part, other fields are kept in the message header.
+func (s *Signer) SignMessage(msg []byte, now time.Time) ([]byte, error) {
+	header, body := splitEntity(canonicalize(msg))
+
+	outer := &bytes.Buffer{}
+	inner := &bytes.Buffer{}
+	hasMIMEVersion := false
+	for _, field := range splitHeaderFields(header) {
+		name := strings.ToLower(strings.TrimSpace(field[:strings.IndexByte(field+":", ':')]))
+		switch {
+		case strings.HasPrefix(name, "content-"):
+			inner.WriteString(field)
+		case name == "mime-version":
+			hasMIMEVersion = true
+			outer.WriteString(field)
+		default:
+			outer.WriteString(field)
+		}
+	}
+	inner.WriteString("\r\n")
+	inner.Write(body)
+
+	signature, err := s.Sign(inner.Bytes(), now)
+	if err != nil {
+		return nil, err
+	}
+
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasMIMEVersion {
+		outer.WriteString("MIME-Version: 1.0\r\n")
+	}
+	outer.WriteString("Content-Type: " + mime.FormatMediaType(signedMIMEType, map[string]string{
+		"protocol": signatureMIMEType,
+		"micalg":   "sha-256",
+		"boundary": boundary,
+	}) + "\r\n\r\n")
+	outer.WriteString("This is a cryptographically signed message in MIME format.\r\n\r\n")
+
+	outer.WriteString("--" + boundary + "\r\n")
+	outer.Write(inner.Bytes())
+	outer.WriteString("\r\n--" + boundary + "\r\n")
+	outer.WriteString("Content-Type: " + signatureMIMEType + "; name=\"smime.p7s\"\r\n")
+	outer.WriteString("Content-Transfer-Encoding: base64\r\n")
+	outer.WriteString("Content-Disposition: attachment; filename=\"smime.p7s\"\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString(signature)
+	for len(encoded) > 76 {
+		outer.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	outer.WriteString(encoded + "\r\n")
+	outer.WriteString("--" + boundary + "--\r\n")
+
+	return outer.Bytes(), nil
+}
+
+// VerifyEntity verifies the signature of multipart/signed MIME entity, i.e.
+// header with body. ErrNotSigned is returned when the entity is not signed
+// by S/MIME.
+func VerifyEntity(entity []byte, opts x509.VerifyOptions) (*Verification, error) {
+	header, body := splitEntity(canonicalize(entity))
+
+	boundary, ok := signedBoundary(header)
+	if !ok {
+		return nil, ErrNotSigned
+	}
+
+	content, signaturePart, err := splitSignedBody(body, boundary)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidSignature, err.Error())
+	}
+
+	signature, err := decodeSignaturePart(signaturePart)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidSignature, err.Error())
+	}
+
+	return Verify(content, signature, opts)
+}
+
+// canonicalize converts line endings to CRLF which is the form signatures
+// are computed over.
+func canonicalize(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+// splitEntity returns the header including the last line ending and the
+// body after the empty line.
+func splitEntity(entity []byte) (header, body []byte) {
+	if bytes.HasPrefix(entity, []byte("\r\n")) {
+		return nil, entity[2:]
+	}
+	if i := bytes.Index(entity, []byte("\r\n\r\n")); i >= 0 {
+		return entity[:i+2], entity[i+4:]
+	}
+	return entity, nil
+}
+
+// splitHeaderFields returns the header fields with their continuation lines
+// and line endings.
+func splitHeaderFields(header []byte) (fields []string) {
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if len(fields) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+func signedBoundary(header []byte) (string, bool) {
+	fields, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(header, '\r', '\n')))).ReadMIMEHeader()
+	if err != nil {
+		return "", false
+	}
+
+	mediaType, params, err := mime.ParseMediaType(fields.Get("Content-Type"))
+	if err != nil || mediaType != signedMIMEType || params["boundary"] == "" {
+		return "", false
+	}
+
+	protocol := strings.ToLower(params["protocol"])
+	if protocol != signatureMIMEType && protocol != legacySignatureMIMEType {
+		return "", false
+	}
+
+	return params["boundary"], true
+}
+
+// splitSignedBody returns the signed part and the signature part of the
+// body. The signed part is taken exactly as it is; the line ending before
+// the delimiter belongs to the delimiter.
+func splitSignedBody(body []byte, boundary string) (content, signature []byte, err error) {
+	// The delimiter can be the first line of the body without the preamble.
+	rest := append([]byte("\r\n"), body...)
+
+	var parts [][]byte
+	inPart := false
+	for {
+		i := indexDelimiter(rest, boundary)
+		if i < 0 {
+			return nil, nil, errors.New("missing closing delimiter")
+		}
+		if inPart {
+			parts = append(parts, rest[:i])
+		}
+
+		rest = rest[i+len("\r\n--"+boundary):]
+		if bytes.HasPrefix(rest, []byte("--")) {
+			break
+		}
+
+		end := bytes.Index(rest, []byte("\r\n"))
+		if end < 0 {
+			return nil, nil, errors.New("unterminated delimiter")
+		}
+		rest = rest[end+2:]
+		inPart = true
+	}
+
+	if len(parts) != 2 {
+		return nil, nil, errors.New("signed message must have two parts")
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// indexDelimiter returns the index of the line ending before the delimiter
+// line of the boundary or -1. Lines starting with a longer boundary with
+// the same prefix are skipped.
+func indexDelimiter(data []byte, boundary string) int {
+	delimiter := []byte("\r\n--" + boundary)
+
+	offset := 0
+	for {
+		i := bytes.Index(data[offset:], delimiter)
+		if i < 0 {
+			return -1
+		}
+		i += offset
+
+		after := data[i+len(delimiter):]
+		if len(after) == 0 || bytes.HasPrefix(after, []byte("--")) || after[0] == '\r' || after[0] == ' ' || after[0] == '\t' {
+			return i
+		}
+		offset = i + len(delimiter)
+	}
+}
+
+func decodeSignaturePart(part []byte) ([]byte, error) {
+	header, body := splitEntity(part)
+
+	fields, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(header, '\r', '\n')))).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(strings.TrimSpace(fields.Get("Content-Transfer-Encoding")), "base64") {
+		clean := strings.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, string(body))
+		return base64.StdEncoding.DecodeString(clean)
+	}
+
+	return body, nil
+}
+
+func randomBoundary() (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return "smime-" + hex.EncodeToString(random), nil
+}
@@ -0,0 +1,346 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package smime signs and verifies messages with detached S/MIME signatures
+// (RFC 8551) for recipients and senders which do not use PGP.
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotSigned is returned when the message has no S/MIME signature.
+	ErrNotSigned = errors.New("message is not signed by S/MIME")
+
+	// ErrInvalidSignature is returned when the signature does not match
+	// the content or cannot be checked.
+	ErrInvalidSignature = errors.New("invalid S/MIME signature")
+)
+
+// Signer signs messages with the certificate and its private key.
+type Signer struct {
+	// Certificate is the certificate of the signer.
+	Certificate *x509.Certificate
+
+	// Chain contains the other certificates from the file, usually
+	// intermediate certificates, attached to the signature so recipients
+	// can build the path to their trusted root.
+	Chain []*x509.Certificate
+
+	key crypto.Signer
+}
+
+// LoadSigner reads the signer from PEM file, see ParseSigner.
+func LoadSigner(path string) (*Signer, error) {
+	data, err := ioutil.ReadFile(path) //nolint[gosec]
+	if err != nil {
+		return nil, err
+	}
+	return ParseSigner(data)
+}
+
+// ParseSigner parses the signer from PEM data with the private key and the
+// certificates. The certificate matching the key is the signer's one; the
+// others are attached to signatures as the chain.
+func ParseSigner(data []byte) (*Signer, error) {
+	var key crypto.Signer
+	var certs []*x509.Certificate
+
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			parsed, err := parsePrivateKey(block)
+			if err != nil {
+				return nil, err
+			}
+			key = parsed
+		}
+	}
+
+	if key == nil {
+		return nil, errors.New("no private key found")
+	}
+
+	signer := &Signer{key: key}
+	for _, cert := range certs {
+		if signer.Certificate == nil && isKeyOfCertificate(key, cert) {
+			signer.Certificate = cert
+		} else {
+			signer.Chain = append(signer.Chain, cert)
+		}
+	}
+
+	if signer.Certificate == nil {
+		return nil, errors.New("no certificate of the private key found")
+	}
+	if _, err := signatureAlgorithmFor(key.Public()); err != nil {
+		return nil, err
+	}
+
+	return signer, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	var key interface{}
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errUnsupportedAlgorithm
+	}
+	return signer, nil
+}
+
+func isKeyOfCertificate(key crypto.Signer, cert *x509.Certificate) bool {
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(public, cert.RawSubjectPublicKeyInfo)
+}
+
+// CanSign returns whether the certificate is valid at the time and issued
+// for the email address.
+func (s *Signer) CanSign(email string, now time.Time) bool {
+	if now.Before(s.Certificate.NotBefore) || now.After(s.Certificate.NotAfter) {
+		return false
+	}
+	for _, certEmail := range s.Certificate.EmailAddresses {
+		if strings.EqualFold(certEmail, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns DER of CMS SignedData with detached signature of the content.
+func (s *Signer) Sign(content []byte, now time.Time) ([]byte, error) {
+	sigOID, err := signatureAlgorithmFor(s.key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	digest := crypto.SHA256.New()
+	_, _ = digest.Write(content)
+
+	signedAttrs, err := marshalSignedAttributes(digest.Sum(nil), now)
+	if err != nil {
+		return nil, err
+	}
+
+	attrsDigest := crypto.SHA256.New()
+	_, _ = attrsDigest.Write(signedAttrs)
+
+	signature, err := s.key.Sign(rand.Reader, attrsDigest.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	// Signed attributes are IMPLICIT [0] in signer info.
+	signedAttrs[0] = 0xa0
+
+	var rawCerts []byte
+	for _, cert := range append([]*x509.Certificate{s.Certificate}, s.Chain...) {
+		rawCerts = append(rawCerts, cert.Raw...)
+	}
+
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	signed := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256ID},
+		EncapContentInfo: encapContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: rawCerts},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: s.Certificate.RawIssuer},
+				SerialNumber: s.Certificate.SerialNumber,
+			},
+			DigestAlgorithm:    sha256ID,
+			SignedAttrs:        asn1.RawValue{FullBytes: signedAttrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: sigOID},
+			Signature:          signature,
+		}},
+	}
+
+	signedDER, err := asn1.Marshal(signed)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedDER},
+	})
+}
+
+// Verification is the result of successfully checked signature.
+type Verification struct {
+	// Signer is the certificate which made the signature.
+	Signer *x509.Certificate
+
+	// TrustError tells why the signer's certificate is not trusted.
+	// It is nil when the certificate chains to a trusted root.
+	TrustError error
+}
+
+// IsTrusted returns whether the signer's certificate is trusted.
+func (v *Verification) IsTrusted() bool {
+	return v.TrustError == nil
+}
+
+// Verify checks DER of CMS SignedData with detached signature of the
+// content. ErrInvalidSignature is returned when the signature is not valid.
+// Trust of the signer's certificate is checked with opts; certificates
+// from the signature are used as intermediates.
+func Verify(content, signature []byte, opts x509.VerifyOptions) (*Verification, error) {
+	signed, certs, err := parseSignedData(signature)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidSignature, err.Error())
+	}
+	if len(signed.SignerInfos) == 0 {
+		return nil, errors.Wrap(ErrInvalidSignature, "no signer")
+	}
+
+	// Messages are signed by one signer. With more signers, all must be valid.
+	var signer *x509.Certificate
+	for _, info := range signed.SignerInfos {
+		if signer, err = verifySignerInfo(info, certs, content); err != nil {
+			return nil, errors.Wrap(ErrInvalidSignature, err.Error())
+		}
+	}
+
+	if opts.Intermediates == nil {
+		opts.Intermediates = x509.NewCertPool()
+	}
+	for _, cert := range certs {
+		if cert != signer {
+			opts.Intermediates.AddCert(cert)
+		}
+	}
+	if len(opts.KeyUsages) == 0 {
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}
+	}
+
+	_, trustErr := signer.Verify(opts)
+	return &Verification{Signer: signer, TrustError: trustErr}, nil
+}
+
+func parseSignedData(der []byte) (*signedData, []*x509.Certificate, error) {
+	var info contentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, nil, err
+	}
+	if !info.ContentType.Equal(oidSignedData) {
+		return nil, nil, errors.New("not a signed data")
+	}
+
+	var signed signedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &signed); err != nil {
+		return nil, nil, err
+	}
+
+	certs, err := x509.ParseCertificates(signed.Certificates.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &signed, certs, nil
+}
+
+func verifySignerInfo(info signerInfo, certs []*x509.Certificate, content []byte) (*x509.Certificate, error) {
+	var signer *x509.Certificate
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, info.SID.Issuer.FullBytes) && cert.SerialNumber.Cmp(info.SID.SerialNumber) == 0 {
+			signer = cert
+			break
+		}
+	}
+	if signer == nil {
+		return nil, errors.New("signer's certificate is missing")
+	}
+
+	hash, err := digestHash(info.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := x509SignatureAlgorithm(info.SignatureAlgorithm.Algorithm, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := hash.New()
+	_, _ = digest.Write(content)
+
+	// Without signed attributes, the content is signed directly.
+	signedInput := content
+	if len(info.SignedAttrs.FullBytes) > 0 {
+		// Signature is computed over signed attributes encoded as SET OF.
+		signedInput = append([]byte{}, info.SignedAttrs.FullBytes...)
+		signedInput[0] = 0x31
+
+		messageDigest, err := messageDigestAttribute(signedInput)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(messageDigest, digest.Sum(nil)) {
+			return nil, errors.New("content does not match the digest")
+		}
+	}
+
+	if err := signer.CheckSignature(algorithm, signedInput, info.Signature); err != nil {
+		return nil, err
+	}
+
+	return signer, nil
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smime
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func loadTestSigner(t *testing.T) *Signer {
+	signer, err := LoadSigner("testdata/signer.pem")
+	require.NoError(t, err)
+	return signer
+}
+
+func testRoots(t *testing.T) *x509.CertPool {
+	data, err := ioutil.ReadFile("testdata/signer.crt")
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(data))
+	return roots
+}
+
+func TestParseSigner(t *testing.T) {
+	signer := loadTestSigner(t)
+
+	require.Equal(t, []string{"alice@example.com"}, signer.Certificate.EmailAddresses)
+	require.Empty(t, signer.Chain)
+	require.True(t, signer.CanSign("Alice@Example.com", time.Now()))
+	require.False(t, signer.CanSign("bob@example.com", time.Now()))
+	require.False(t, signer.CanSign("alice@example.com", signer.Certificate.NotAfter.Add(time.Hour)))
+
+	_, err := ParseSigner([]byte("no PEM"))
+	require.Error(t, err)
+
+	data, err := ioutil.ReadFile("testdata/signer.crt")
+	require.NoError(t, err)
+	_, err = ParseSigner(data)
+	require.Error(t, err, "certificate without key")
+}
+
+func TestVerifyEntityFromOpenSSL(t *testing.T) {
+	entity, err := ioutil.ReadFile("testdata/signed.eml")
+	require.NoError(t, err)
+
+	verification, err := VerifyEntity(entity, x509.VerifyOptions{Roots: testRoots(t)})
+	require.NoError(t, err)
+	require.True(t, verification.IsTrusted())
+	require.Equal(t, []string{"alice@example.com"}, verification.Signer.EmailAddresses)
+
+	// Line endings do not matter, the content is canonicalized.
+	_, err = VerifyEntity(bytes.ReplaceAll(entity, []byte("\r\n"), []byte("\n")), x509.VerifyOptions{Roots: testRoots(t)})
+	require.NoError(t, err)
+
+	verification, err = VerifyEntity(entity, x509.VerifyOptions{Roots: x509.NewCertPool()})
+	require.NoError(t, err)
+	require.False(t, verification.IsTrusted())
+
+	tampered := bytes.Replace(entity, []byte("Hello Bob"), []byte("Hello Eve"), 1)
+	_, err = VerifyEntity(tampered, x509.VerifyOptions{Roots: testRoots(t)})
+	require.Equal(t, ErrInvalidSignature, errors.Cause(err))
+}
+
+func TestVerifyEntityNotSigned(t *testing.T) {
+	entity, err := ioutil.ReadFile("testdata/plain.eml")
+	require.NoError(t, err)
+
+	_, err = VerifyEntity(entity, x509.VerifyOptions{})
+	require.Equal(t, ErrNotSigned, err)
+
+	pgp := "Content-Type: multipart/signed; protocol=\"application/pgp-signature\"; boundary=b\r\n\r\n--b\r\n\r\nx\r\n--b--\r\n"
+	_, err = VerifyEntity([]byte(pgp), x509.VerifyOptions{})
+	require.Equal(t, ErrNotSigned, err)
+}
+
+func TestSignMessage(t *testing.T) {
+	signer := loadTestSigner(t)
+
+	msg, err := ioutil.ReadFile("testdata/plain.eml")
+	require.NoError(t, err)
+
+	signed, err := signer.SignMessage(msg, time.Now())
+	require.NoError(t, err)
+
+	header, _ := splitEntity(signed)
+	require.Contains(t, string(header), "Subject: Signed\r\n")
+	require.Contains(t, string(header), "Content-Type: multipart/signed;")
+	require.NotContains(t, string(header), "text/plain")
+
+	verification, err := VerifyEntity(signed, x509.VerifyOptions{Roots: testRoots(t)})
+	require.NoError(t, err)
+	require.True(t, verification.IsTrusted())
+
+	// Signed part keeps Content-* fields and the body as they were.
+	boundary, ok := signedBoundary(header)
+	require.True(t, ok)
+	_, body := splitEntity(signed)
+	content, _, err := splitSignedBody(body, boundary)
+	require.NoError(t, err)
+	require.Equal(t, "Content-Type: text/plain; charset=utf-8\r\n\r\nHello Bob,\r\nthis message is signed.\r\n", string(content))
+}
+
+func TestSignMessageVerifiedByOpenSSL(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl is not available")
+	}
+
+	signer := loadTestSigner(t)
+
+	msg, err := ioutil.ReadFile("testdata/plain.eml")
+	require.NoError(t, err)
+
+	signed, err := signer.SignMessage(msg, time.Now())
+	require.NoError(t, err)
+
+	cmd := exec.Command("openssl", "smime", "-verify", "-CAfile", "testdata/signer.crt", "-purpose", "any")
+	cmd.Stdin = bytes.NewReader(signed)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	require.Contains(t, string(out), "Hello Bob")
+}
+
+func TestSignWithECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(42),
+		Subject:        pkix.Name{CommonName: "Carol"},
+		EmailAddresses: []string{"carol@example.com"},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+
+	signer, err := ParseSigner(data)
+	require.NoError(t, err)
+
+	signature, err := signer.Sign([]byte("content"), time.Now())
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(signer.Certificate)
+
+	verification, err := Verify([]byte("content"), signature, x509.VerifyOptions{Roots: roots})
+	require.NoError(t, err)
+	require.True(t, verification.IsTrusted())
+
+	_, err = Verify([]byte("other content"), signature, x509.VerifyOptions{Roots: roots})
+	require.Equal(t, ErrInvalidSignature, errors.Cause(err))
+}
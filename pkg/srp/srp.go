@@ -124,22 +124,10 @@ func NewSrpAuth(version int, username, password, salt, signedModulus, serverEphe
 
 // GenerateSrpProofs calculates SPR proofs.
 func (s *SrpAuth) GenerateSrpProofs(length int) (res *SrpProofs, err error) { //nolint[funlen]
-	toInt := func(arr []byte) *big.Int {
-		var reversed = make([]byte, len(arr))
-		for i := 0; i < len(arr); i++ {
-			reversed[len(arr)-i-1] = arr[i]
-		}
-		return big.NewInt(0).SetBytes(reversed)
-	}
-
 	fromInt := func(num *big.Int) []byte {
-		var arr = num.Bytes()
-		var reversed = make([]byte, length/8)
-		for i := 0; i < len(arr); i++ {
-			reversed[len(arr)-i-1] = arr[i]
-		}
-		return reversed
+		return fromLittleEndianInt(num, length)
 	}
+	toInt := toLittleEndianInt
 
 	generator := big.NewInt(2)
 	multiplier := toInt(ExpandHash(append(fromInt(generator), s.Modulus...)))
@@ -213,7 +201,34 @@ func (s *SrpAuth) GenerateSrpProofs(length int) (res *SrpProofs, err error) { //
 	return &SrpProofs{ClientEphemeral: fromInt(clientEphemeral), ClientProof: clientProof, ExpectedServerProof: serverProof}, nil
 }
 
-// GenerateVerifier verifier for update pwds and create accounts
+// GenerateVerifier returns the verifier of the hashed password, e.g. for
+// messages encrypted to outside protected by password. Server ephemeral is
+// not used.
 func (s *SrpAuth) GenerateVerifier(length int) ([]byte, error) {
-	return nil, errors.New("pm-srp: the client doesn't need SRP GenerateVerifier")
+	modulus := toLittleEndianInt(s.Modulus)
+	if modulus.BitLen() != length {
+		return nil, errors.New("pm-srp: SRP modulus has incorrect size")
+	}
+
+	generator := big.NewInt(2)
+	verifier := big.NewInt(0).Exp(generator, toLittleEndianInt(s.HashedPassword), modulus)
+
+	return fromLittleEndianInt(verifier, length), nil
+}
+
+func toLittleEndianInt(arr []byte) *big.Int {
+	var reversed = make([]byte, len(arr))
+	for i := 0; i < len(arr); i++ {
+		reversed[len(arr)-i-1] = arr[i]
+	}
+	return big.NewInt(0).SetBytes(reversed)
+}
+
+func fromLittleEndianInt(num *big.Int, length int) []byte {
+	var arr = num.Bytes()
+	var reversed = make([]byte, length/8)
+	for i := 0; i < len(arr); i++ {
+		reversed[len(arr)-i-1] = arr[i]
+	}
+	return reversed
 }
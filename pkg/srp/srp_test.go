@@ -20,6 +20,7 @@ package srp
 import (
 	"bytes"
 	"encoding/base64"
+	"math/big"
 	"math/rand"
 	"testing"
 )
@@ -109,3 +110,54 @@ func TestSRPauth(t *testing.T) {
 		)
 	}
 }
+
+// TestGenerateVerifier checks that the server which knows only the verifier
+// agrees with the client on the shared session.
+func TestGenerateVerifier(t *testing.T) {
+	const length = 2048
+	salt := "yKlc5/CvObfoiw=="
+
+	auth, err := NewSrpAuth(4, "", "test", salt, testModulusClearSign, "")
+	if err != nil {
+		t.Fatal("Expected no error but have ", err)
+	}
+	verifierBytes, err := auth.GenerateVerifier(length)
+	if err != nil {
+		t.Fatal("Expected no error but have ", err)
+	}
+
+	modulus := toLittleEndianInt(auth.Modulus)
+	generator := big.NewInt(2)
+	verifier := toLittleEndianInt(verifierBytes)
+	multiplier := toLittleEndianInt(ExpandHash(append(fromLittleEndianInt(generator, length), auth.Modulus...)))
+	multiplier.Mod(multiplier, modulus)
+
+	serverSecret := big.NewInt(123456789)
+	serverEphemeral := big.NewInt(0).Exp(generator, serverSecret, modulus)
+	serverEphemeral.Add(serverEphemeral, big.NewInt(0).Mul(multiplier, verifier))
+	serverEphemeral.Mod(serverEphemeral, modulus)
+
+	auth, err = NewSrpAuth(4, "", "test", salt, testModulusClearSign, base64.StdEncoding.EncodeToString(fromLittleEndianInt(serverEphemeral, length)))
+	if err != nil {
+		t.Fatal("Expected no error but have ", err)
+	}
+	proofs, err := auth.GenerateSrpProofs(length)
+	if err != nil {
+		t.Fatal("Expected no error but have ", err)
+	}
+
+	clientEphemeral := toLittleEndianInt(proofs.ClientEphemeral)
+	scramblingParam := toLittleEndianInt(ExpandHash(append(fromLittleEndianInt(clientEphemeral, length), fromLittleEndianInt(serverEphemeral, length)...)))
+	sharedSession := big.NewInt(0).Exp(verifier, scramblingParam, modulus)
+	sharedSession.Mul(sharedSession, clientEphemeral)
+	sharedSession.Exp(sharedSession, serverSecret, modulus)
+
+	clientProof := ExpandHash(bytes.Join([][]byte{
+		fromLittleEndianInt(clientEphemeral, length),
+		fromLittleEndianInt(serverEphemeral, length),
+		fromLittleEndianInt(sharedSession, length),
+	}, []byte{}))
+	if !bytes.Equal(proofs.ClientProof, clientProof) {
+		t.Fatal("Client proof does not match proof computed by server from the verifier")
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package tracing correlates logs of one client session across packages.
+// Every IMAP or SMTP session gets an ID which is passed by context to the
+// store and API requests, and logged in the `session` field, so a single
+// slow command can be followed through the debug logs.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogField is the name of the log field with the session ID.
+const LogField = "session"
+
+type sessionIDKey struct{}
+
+// NewSessionID returns a new random ID of the session of the protocol,
+// e.g. `imap-3f9a1c2e`.
+func NewSessionID(protocol string) string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return protocol
+	}
+	return protocol + "-" + hex.EncodeToString(b)
+}
+
+// WithSessionID returns the context carrying the session ID.
+func WithSessionID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, sessionIDKey{}, id)
+}
+
+// SessionID returns the session ID carried by the context
+// or empty string if there is none.
+func SessionID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(sessionIDKey{}).(string)
+	return id
+}
+
+// Logger returns the log entry with the session ID of the context.
+func Logger(ctx context.Context, l *logrus.Entry) *logrus.Entry {
+	if id := SessionID(ctx); id != "" {
+		return l.WithField(LogField, id)
+	}
+	return l
+}
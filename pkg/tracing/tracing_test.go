@@ -0,0 +1,45 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestSessionID(t *testing.T) {
+	id := NewSessionID("imap")
+	r.True(t, strings.HasPrefix(id, "imap-"))
+	r.Len(t, id, len("imap-")+8)
+	r.NotEqual(t, id, NewSessionID("imap"))
+
+	r.Equal(t, "", SessionID(context.Background()))
+	r.Equal(t, id, SessionID(WithSessionID(context.Background(), id)))
+	r.Equal(t, "", SessionID(WithSessionID(context.Background(), "")))
+}
+
+func TestLogger(t *testing.T) {
+	l := logrus.WithField("pkg", "test")
+
+	r.NotContains(t, Logger(context.Background(), l).Data, LogField)
+	r.Equal(t, "smtp-1", Logger(WithSessionID(context.Background(), "smtp-1"), l).Data[LogField])
+}
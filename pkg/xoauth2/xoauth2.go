@@ -0,0 +1,106 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package xoauth2 implements server side of the SASL XOAUTH2 mechanism used
+// by clients configured for OAuth 2.0 authentication.
+package xoauth2
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/emersion/go-sasl"
+)
+
+// Mechanism is the name of the SASL mechanism.
+const Mechanism = "XOAUTH2"
+
+// errorChallenge is sent to the client when authentication fails. Client
+// has to respond with empty response to get the final error.
+const errorChallenge = `{"status":"401","schemes":"bearer"}`
+
+var errMalformedResponse = errors.New("malformed XOAUTH2 response")
+
+// Authenticator checks the token of the user.
+type Authenticator func(username, token string) error
+
+type server struct {
+	authenticate Authenticator
+	err          error
+}
+
+// NewServer returns a SASL server checking credentials by authenticate.
+func NewServer(authenticate Authenticator) sasl.Server {
+	return &server{authenticate: authenticate}
+}
+
+// NewOAuthBearerServer returns a SASL server of the standard OAUTHBEARER
+// mechanism (RFC 7628) which accepts the same tokens as XOAUTH2.
+func NewOAuthBearerServer(authenticate Authenticator) sasl.Server {
+	return sasl.NewOAuthBearerServer(func(opts sasl.OAuthBearerOptions) *sasl.OAuthBearerError {
+		if opts.Username == "" || opts.Token == "" {
+			return &sasl.OAuthBearerError{Status: "invalid_request", Schemes: "bearer"}
+		}
+		if err := authenticate(opts.Username, opts.Token); err != nil {
+			return &sasl.OAuthBearerError{Status: "invalid_token", Schemes: "bearer"}
+		}
+		return nil
+	})
+}
+
+func (s *server) Next(response []byte) (challenge []byte, done bool, err error) {
+	if s.err != nil {
+		return nil, true, s.err
+	}
+
+	// Client didn't send initial response.
+	if response == nil {
+		return []byte{}, false, nil
+	}
+
+	username, token, err := parseResponse(string(response))
+	if err != nil {
+		return nil, true, err
+	}
+
+	if s.err = s.authenticate(username, token); s.err != nil {
+		return []byte(errorChallenge), false, nil
+	}
+
+	return nil, true, nil
+}
+
+// parseResponse parses `user={User}^Aauth=Bearer {Token}^A^A`.
+func parseResponse(response string) (username, token string, err error) {
+	for _, field := range strings.Split(response, "\x01") {
+		switch {
+		case strings.HasPrefix(field, "user="):
+			username = strings.TrimPrefix(field, "user=")
+		case strings.HasPrefix(field, "auth="):
+			auth := strings.TrimPrefix(field, "auth=")
+			if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+				return "", "", errMalformedResponse
+			}
+			token = strings.TrimSpace(auth[7:])
+		}
+	}
+
+	if username == "" || token == "" {
+		return "", "", errMalformedResponse
+	}
+	return username, token, nil
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package xoauth2
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer() *server {
+	return NewServer(func(username, token string) error {
+		if username == "user@pm.me" && token == "secret" {
+			return nil
+		}
+		return errors.New("invalid token")
+	}).(*server)
+}
+
+func TestServerSuccess(t *testing.T) {
+	s := newTestServer()
+
+	challenge, done, err := s.Next([]byte("user=user@pm.me\x01auth=Bearer secret\x01\x01"))
+	require.NoError(t, err)
+	require.True(t, done)
+	require.Nil(t, challenge)
+}
+
+func TestServerWithoutInitialResponse(t *testing.T) {
+	s := newTestServer()
+
+	challenge, done, err := s.Next(nil)
+	require.NoError(t, err)
+	require.False(t, done)
+	require.Empty(t, challenge)
+
+	_, done, err = s.Next([]byte("user=user@pm.me\x01auth=bearer secret\x01\x01"))
+	require.NoError(t, err)
+	require.True(t, done)
+}
+
+func TestServerFailure(t *testing.T) {
+	s := newTestServer()
+
+	challenge, done, err := s.Next([]byte("user=user@pm.me\x01auth=Bearer wrong\x01\x01"))
+	require.NoError(t, err)
+	require.False(t, done)
+	require.Equal(t, errorChallenge, string(challenge))
+
+	_, done, err = s.Next([]byte{})
+	require.EqualError(t, err, "invalid token")
+	require.True(t, done)
+}
+
+func TestServerMalformedResponse(t *testing.T) {
+	for _, response := range []string{
+		"user=user@pm.me\x01\x01",
+		"auth=Bearer secret\x01\x01",
+		"user=user@pm.me\x01auth=Basic secret\x01\x01",
+	} {
+		_, done, err := newTestServer().Next([]byte(response))
+		require.Error(t, err, response)
+		require.True(t, done)
+	}
+}
+
+func TestOAuthBearerServer(t *testing.T) {
+	authenticate := func(username, token string) error {
+		if username == "user@pm.me" && token == "secret" {
+			return nil
+		}
+		return errors.New("invalid token")
+	}
+
+	_, done, err := NewOAuthBearerServer(authenticate).Next([]byte("n,a=user@pm.me,\x01auth=Bearer secret\x01\x01"))
+	require.NoError(t, err)
+	require.True(t, done)
+
+	s := NewOAuthBearerServer(authenticate)
+	challenge, done, err := s.Next([]byte("n,a=user@pm.me,\x01auth=Bearer wrong\x01\x01"))
+	require.NoError(t, err)
+	require.False(t, done)
+	require.Contains(t, string(challenge), "invalid_token")
+
+	_, done, err = s.Next([]byte{0x01})
+	require.Error(t, err)
+	require.True(t, done)
+}
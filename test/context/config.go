@@ -65,6 +65,18 @@ func (c *fakeConfig) GetAPIConfig() *pmapi.ClientConfig {
 func (c *fakeConfig) GetDBDir() string {
 	return c.dir
 }
+func (c *fakeConfig) GetMessageCacheDir() string {
+	return filepath.Join(c.dir, "messages")
+}
+func (c *fakeConfig) GetMessageCacheKeyPath() string {
+	return filepath.Join(c.dir, "message_cache.key")
+}
+func (c *fakeConfig) GetAttachmentCacheDir() string {
+	return filepath.Join(c.dir, "attachments")
+}
+func (c *fakeConfig) GetSearchIndexDir() string {
+	return filepath.Join(c.dir, "search")
+}
 func (c *fakeConfig) GetVersion() string {
 	return constants.Version
 }
@@ -101,3 +113,9 @@ func (c *fakeConfig) GetDefaultIMAPPort() int {
 func (c *fakeConfig) GetDefaultSMTPPort() int {
 	return 21200 + rand.Intn(100)
 }
+func (c *fakeConfig) GetDefaultCalDAVPort() int {
+	return 21300 + rand.Intn(100)
+}
+func (c *fakeConfig) GetDefaultLDAPPort() int {
+	return 21400 + rand.Intn(100)
+}
@@ -18,7 +18,10 @@
 package context
 
 import (
+	"crypto/sha256"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/users/credentials"
 )
@@ -99,9 +102,22 @@ func (c *fakeCredStore) UpdateToken(userID, apiToken string) error {
 	return nil
 }
 
+func (c *fakeCredStore) GetCacheKey(userID string) ([]byte, error) {
+	key := sha256.Sum256([]byte(userID))
+	return key[:], nil
+}
+
+func (c *fakeCredStore) RotateRefreshTokenNonce(userID string) (*credentials.Credentials, error) {
+	creds, err := c.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	creds.RefreshTokenNonce = strconv.FormatInt(time.Now().UnixNano(), 16)
+	return creds, nil
+}
+
 func (c *fakeCredStore) Logout(userID string) error {
-	c.credentials[userID].APIToken = ""
-	c.credentials[userID].MailboxPassword = ""
+	c.credentials[userID].Logout()
 	return nil
 }
 
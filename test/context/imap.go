@@ -59,7 +59,7 @@ func (ctx *TestContext) withIMAPServer() {
 	tls, _ := config.GetTLSConfig(ctx.cfg)
 
 	backend := imap.NewIMAPBackend(ph, ctx.listener, ctx.cfg, ctx.bridge)
-	server := imap.NewIMAPServer(true, true, port, tls, backend, ctx.listener)
+	server := imap.NewIMAPServer(true, true, port, tls, preferences.GetAuthPolicy(pref), backend, ctx.listener)
 
 	go server.ListenAndServe()
 	require.NoError(ctx.t, waitForPort(port, 5*time.Second))
@@ -21,7 +21,7 @@ import (
 	"os"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
-	"github.com/ProtonMail/proton-bridge/test/fakeapi"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi/fakeserver"
 	"github.com/ProtonMail/proton-bridge/test/liveapi"
 )
 
@@ -52,14 +52,14 @@ func newPMAPIController(cm *pmapi.ClientManager) PMAPIController {
 }
 
 func newFakePMAPIController(cm *pmapi.ClientManager) PMAPIController {
-	return newFakePMAPIControllerWrap(fakeapi.NewController(cm))
+	return newFakePMAPIControllerWrap(fakeserver.NewController(cm))
 }
 
 type fakePMAPIControllerWrap struct {
-	*fakeapi.Controller
+	*fakeserver.Controller
 }
 
-func newFakePMAPIControllerWrap(controller *fakeapi.Controller) PMAPIController {
+func newFakePMAPIControllerWrap(controller *fakeserver.Controller) PMAPIController {
 	return &fakePMAPIControllerWrap{Controller: controller}
 }
 
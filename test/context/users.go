@@ -18,6 +18,7 @@
 package context
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"path/filepath"
@@ -45,7 +46,7 @@ func (ctx *TestContext) LoginUser(username, password, mailboxPassword string) (e
 	}
 
 	if auth.HasTwoFactor() {
-		if _, err := client.Auth2FA("2fa code", auth); err != nil {
+		if _, err := client.Auth2FA(context.Background(), "2fa code", auth); err != nil {
 			return errors.Wrap(err, "failed to login with 2FA")
 		}
 	}
@@ -14,3 +14,5 @@ Feature: IMAP list mailboxes
     Then IMAP response contains "All Mail"
     Then IMAP response contains "Folders/mbox1"
     Then IMAP response contains "Labels/mbox2"
+    Then IMAP response contains "Scheduled"
+    Then IMAP response contains "Outbox"
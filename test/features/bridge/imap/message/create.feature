@@ -18,6 +18,33 @@ Feature: IMAP create messages
       | from      | to                 | subject | read |
       | [primary] | john.doe@email.com | foo     | true |
 
+  Scenario: Saving edited draft updates the draft
+    When IMAP client imports message to "Drafts"
+      """
+      From: Bridge Test <primaryaddress@pm.me>
+      To: John Doe <john.doe@email.com>
+      Subject: foo
+      Message-Id: <draft@pm.test>
+
+      hello
+
+      """
+    Then IMAP response is "OK"
+    When IMAP client imports message to "Drafts"
+      """
+      From: Bridge Test <primaryaddress@pm.me>
+      To: John Doe <john.doe@email.com>
+      Subject: bar
+      Message-Id: <draft@pm.test>
+
+      hello world
+
+      """
+    Then IMAP response is "OK"
+    And mailbox "Drafts" for "userMoreAddresses" has messages
+      | from      | to                 | subject | read |
+      | [primary] | john.doe@email.com | bar     | true |
+
   Scenario: Creates message sent from user's primary address
     Given there is IMAP client selected in "Sent"
     When IMAP client creates message "foo" from address "primary" of "userMoreAddresses" to "john.doe@email.com" with body "hello world" in "Sent"
@@ -18,6 +18,7 @@
 package liveapi
 
 import (
+	"context"
 	"time"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
@@ -43,7 +44,7 @@ func cleanup(client pmapi.Client, addresses *pmapi.AddressList) error {
 func cleanSystemFolders(client pmapi.Client) error {
 	for _, labelID := range []string{pmapi.InboxLabel, pmapi.SentLabel, pmapi.ArchiveLabel, pmapi.AllMailLabel, pmapi.DraftLabel} {
 		for {
-			messages, total, err := client.ListMessages(&pmapi.MessagesFilter{
+			messages, total, err := client.ListMessages(context.Background(), &pmapi.MessagesFilter{
 				PageSize: 150,
 				LabelID:  labelID,
 			})
@@ -60,7 +61,7 @@ func cleanSystemFolders(client pmapi.Client) error {
 				messageIDs = append(messageIDs, message.ID)
 			}
 
-			if err := client.DeleteMessages(messageIDs); err != nil {
+			if err := client.DeleteMessages(context.Background(), messageIDs); err != nil {
 				return errors.Wrap(err, "failed to delete messages")
 			}
 
@@ -73,7 +74,7 @@ func cleanSystemFolders(client pmapi.Client) error {
 }
 
 func cleanCustomLables(client pmapi.Client) error {
-	labels, err := client.ListLabels()
+	labels, err := client.ListLabels(context.Background())
 	if err != nil {
 		return errors.Wrap(err, "failed to list labels")
 	}
@@ -82,7 +83,7 @@ func cleanCustomLables(client pmapi.Client) error {
 		if err := emptyFolder(client, label.ID); err != nil {
 			return errors.Wrap(err, "failed to empty label")
 		}
-		if err := client.DeleteLabel(label.ID); err != nil {
+		if err := client.DeleteLabel(context.Background(), label.ID); err != nil {
 			return errors.Wrap(err, "failed to delete label")
 		}
 	}
@@ -92,7 +93,7 @@ func cleanCustomLables(client pmapi.Client) error {
 
 func cleanTrash(client pmapi.Client) error {
 	for {
-		_, total, err := client.ListMessages(&pmapi.MessagesFilter{
+		_, total, err := client.ListMessages(context.Background(), &pmapi.MessagesFilter{
 			PageSize: 1,
 			LabelID:  pmapi.TrashLabel,
 		})
@@ -114,12 +115,12 @@ func cleanTrash(client pmapi.Client) error {
 }
 
 func emptyFolder(client pmapi.Client, labelID string) error {
-	err := client.EmptyFolder(labelID, "")
+	err := client.EmptyFolder(context.Background(), labelID, "")
 	if err != nil {
 		return err
 	}
 	for {
-		_, total, err := client.ListMessages(&pmapi.MessagesFilter{
+		_, total, err := client.ListMessages(context.Background(), &pmapi.MessagesFilter{
 			PageSize: 1,
 			LabelID:  labelID,
 		})
@@ -141,5 +142,5 @@ func reorderAddresses(client pmapi.Client, addresses *pmapi.AddressList) error {
 		addressIDs = append(addressIDs, address.ID)
 	}
 
-	return client.ReorderAddresses(addressIDs)
+	return client.ReorderAddresses(context.Background(), addressIDs)
 }
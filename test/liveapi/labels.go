@@ -18,6 +18,7 @@
 package liveapi
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -44,7 +45,7 @@ func (ctl *Controller) AddUserLabel(username string, label *pmapi.Label) error {
 	label.Exclusive = getLabelExclusive(label.Name)
 	label.Name = getLabelNameWithoutPrefix(label.Name)
 	label.Color = pmapi.LabelColors[0]
-	if _, err := client.CreateLabel(label); err != nil {
+	if _, err := client.CreateLabel(context.Background(), label); err != nil {
 		return errors.Wrap(err, "failed to create label")
 	}
 	return nil
@@ -72,7 +73,7 @@ func (ctl *Controller) getLabelID(username, labelName string) (string, error) {
 		return "", fmt.Errorf("user %s does not exist", username)
 	}
 
-	labels, err := client.ListLabels()
+	labels, err := client.ListLabels(context.Background())
 	if err != nil {
 		return "", errors.Wrap(err, "failed to list labels")
 	}
@@ -19,6 +19,7 @@ package liveapi
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -54,7 +55,7 @@ func (ctl *Controller) AddUserMessage(username string, message *pmapi.Message) e
 		LabelIDs:  message.LabelIDs,
 	}
 
-	results, err := client.Import([]*pmapi.ImportMsgReq{req})
+	results, err := client.Import(context.Background(), []*pmapi.ImportMsgReq{req})
 	if err != nil {
 		return errors.Wrap(err, "failed to make an import")
 	}
@@ -114,7 +115,7 @@ func buildMessageBody(message *pmapi.Message, body *bytes.Buffer) error {
 		return errors.Wrap(err, "failed to set boundary")
 	}
 
-	bodyHeader := messageUtils.GetBodyHeader(message)
+	bodyHeader := messageUtils.GetBodyHeader(message, messageUtils.QuotedPrintable)
 	bodyHeader.Set("Content-Transfer-Encoding", "7bit")
 
 	part, err := mw.CreatePart(bodyHeader)
@@ -147,7 +148,7 @@ func (ctl *Controller) GetMessages(username, labelID string) ([]*pmapi.Message,
 
 	for {
 		// ListMessages returns empty result, not error, asking for page out of range.
-		pageMessages, _, err := client.ListMessages(&pmapi.MessagesFilter{
+		pageMessages, _, err := client.ListMessages(context.Background(), &pmapi.MessagesFilter{
 			Page:     page,
 			PageSize: 150,
 			LabelID:  labelID,
@@ -18,6 +18,8 @@
 package liveapi
 
 import (
+	"context"
+
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/cucumber/godog"
 	"github.com/pkg/errors"
@@ -30,17 +32,17 @@ func (ctl *Controller) AddUser(user *pmapi.User, addresses *pmapi.AddressList, p
 
 	client := ctl.clientManager.GetClient(user.ID)
 
-	authInfo, err := client.AuthInfo(user.Name)
+	authInfo, err := client.AuthInfo(context.Background(), user.Name)
 	if err != nil {
 		return errors.Wrap(err, "failed to get auth info")
 	}
 
-	_, err = client.Auth(user.Name, password, authInfo)
+	_, err = client.Auth(context.Background(), user.Name, password, authInfo)
 	if err != nil {
 		return errors.Wrap(err, "failed to auth user")
 	}
 
-	salt, err := client.AuthSalt()
+	salt, err := client.AuthSalt(context.Background())
 	if err != nil {
 		return errors.Wrap(err, "failed to get salt")
 	}
@@ -50,7 +52,7 @@ func (ctl *Controller) AddUser(user *pmapi.User, addresses *pmapi.AddressList, p
 		return errors.Wrap(err, "failed to hash mailbox password")
 	}
 
-	if err := client.Unlock([]byte(mailboxPassword)); err != nil {
+	if err := client.Unlock(context.Background(), []byte(mailboxPassword)); err != nil {
 		return errors.Wrap(err, "failed to unlock user")
 	}
 
@@ -66,5 +68,5 @@ func (ctl *Controller) AddUser(user *pmapi.User, addresses *pmapi.AddressList, p
 func (ctl *Controller) ReorderAddresses(user *pmapi.User, addressIDs []string) error {
 	client := ctl.clientManager.GetClient(user.ID)
 
-	return client.ReorderAddresses(addressIDs)
+	return client.ReorderAddresses(context.Background(), addressIDs)
 }